@@ -0,0 +1,190 @@
+package alerts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+)
+
+// ScopeAlerts is the webhook scope of alert events.
+const ScopeAlerts = "alerts"
+
+// Severity levels of an alert.
+const (
+	SeverityInfo Severity = iota + 1
+	SeverityWarning
+	SeverityError
+	SeverityCritical
+)
+
+type (
+	// Severity indicates the severity of an alert.
+	Severity uint8
+
+	// An Alert is a notification of a condition that may require the
+	// operator's attention.
+	Alert struct {
+		// ID is a unique identifier for the alert. Registering an alert with
+		// the same ID replaces the existing alert.
+		ID types.Hash256 `json:"id"`
+		// Severity is the severity of the alert.
+		Severity Severity `json:"severity"`
+		// Message is a human-readable message describing the alert.
+		Message string `json:"message"`
+		// Data is a map of arbitrary data that can be used to provide
+		// additional context to the alert.
+		Data      map[string]any `json:"data,omitempty"`
+		Timestamp time.Time      `json:"timestamp"`
+	}
+
+	// An EventBroadcaster forwards registered and dismissed alerts to
+	// webhooks.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager manages the active alerts. Alerts are kept in memory and are
+	// cleared when walletd restarts.
+	Manager struct {
+		events EventBroadcaster
+		log    *zap.Logger
+
+		mu     sync.Mutex // protects alerts
+		alerts map[types.Hash256]Alert
+	}
+
+	// An Option configures a Manager.
+	Option func(*Manager)
+)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send alert events to
+// webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// String implements fmt.Stringer.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	case SeverityCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "info":
+		*s = SeverityInfo
+	case "warning":
+		*s = SeverityWarning
+	case "error":
+		*s = SeverityError
+	case "critical":
+		*s = SeverityCritical
+	default:
+		return fmt.Errorf("unknown severity %q", b)
+	}
+	return nil
+}
+
+func (m *Manager) broadcastEvent(event string, data any) {
+	if m.events == nil {
+		return
+	} else if err := m.events.BroadcastEvent(ScopeAlerts, event, data); err != nil {
+		m.log.Warn("failed to broadcast alert event", zap.String("event", event), zap.Error(err))
+	}
+}
+
+// Register registers a new alert with the manager. If an alert with the same
+// ID is already active, it is replaced.
+func (m *Manager) Register(a Alert) {
+	if a.ID == (types.Hash256{}) {
+		panic("cannot register alert with empty ID") // developer error
+	} else if a.Timestamp.IsZero() {
+		a.Timestamp = time.Now()
+	}
+
+	m.mu.Lock()
+	_, exists := m.alerts[a.ID]
+	m.alerts[a.ID] = a
+	m.mu.Unlock()
+
+	// only log and broadcast new alerts to avoid flooding webhooks with
+	// alerts that are refreshed on every check
+	if !exists {
+		m.log.Warn("alert registered", zap.Stringer("id", a.ID), zap.Stringer("severity", a.Severity), zap.String("message", a.Message))
+		m.broadcastEvent("register", a)
+	}
+}
+
+// Dismiss removes the alerts with the given IDs.
+func (m *Manager) Dismiss(ids ...types.Hash256) {
+	m.mu.Lock()
+	var dismissed []types.Hash256
+	for _, id := range ids {
+		if _, ok := m.alerts[id]; ok {
+			delete(m.alerts, id)
+			dismissed = append(dismissed, id)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(dismissed) > 0 {
+		m.broadcastEvent("dismiss", dismissed)
+	}
+}
+
+// Active returns the active alerts, newest first.
+func (m *Manager) Active() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(m.alerts))
+	for _, a := range m.alerts {
+		alerts = append(alerts, a)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Timestamp.After(alerts[j].Timestamp)
+	})
+	return alerts
+}
+
+// NewManager creates a new alert manager.
+func NewManager(opts ...Option) *Manager {
+	m := &Manager{
+		log:    zap.NewNop(),
+		alerts: make(map[types.Hash256]Alert),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
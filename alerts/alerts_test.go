@@ -0,0 +1,86 @@
+package alerts_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"lukechampine.com/frand"
+)
+
+type mockBroadcaster struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (mb *mockBroadcaster) BroadcastEvent(scope, event string, _ any) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.events = append(mb.events, scope+"/"+event)
+	return nil
+}
+
+func TestAlerts(t *testing.T) {
+	mb := new(mockBroadcaster)
+	m := alerts.NewManager(alerts.WithEventBroadcaster(mb))
+
+	a := alerts.Alert{
+		ID:        frand.Entropy256(),
+		Severity:  alerts.SeverityWarning,
+		Message:   "foo",
+		Timestamp: time.Now().Add(-time.Minute),
+	}
+	b := alerts.Alert{
+		ID:       frand.Entropy256(),
+		Severity: alerts.SeverityCritical,
+		Message:  "bar",
+	}
+	m.Register(a)
+	m.Register(b)
+	// registering an active alert replaces it without another event
+	a.Message = "baz"
+	m.Register(a)
+
+	active := m.Active()
+	if len(active) != 2 {
+		t.Fatalf("expected 2 alerts, got %d", len(active))
+	} else if active[0].ID != b.ID || active[1].ID != a.ID {
+		t.Fatal("expected alerts to be sorted newest first")
+	} else if active[1].Message != "baz" {
+		t.Fatalf("expected alert to be replaced, got %q", active[1].Message)
+	} else if active[0].Timestamp.IsZero() {
+		t.Fatal("expected timestamp to be set")
+	}
+
+	m.Dismiss(a.ID, types.Hash256{1})
+	if active := m.Active(); len(active) != 1 || active[0].ID != b.ID {
+		t.Fatalf("expected only %v to be active, got %v", b.ID, active)
+	}
+
+	mb.mu.Lock()
+	events := mb.events
+	mb.mu.Unlock()
+	expected := []string{"alerts/register", "alerts/register", "alerts/dismiss"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected events %v, got %v", expected, events)
+		}
+	}
+
+	buf, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded alerts.Alert
+	if err := json.Unmarshal(buf, &decoded); err != nil {
+		t.Fatal(err)
+	} else if decoded.Severity != alerts.SeverityCritical {
+		t.Fatalf("expected severity %v, got %v", alerts.SeverityCritical, decoded.Severity)
+	}
+}
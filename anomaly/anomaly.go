@@ -0,0 +1,322 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// eventsPerCheck is the number of recent events checked for each wallet.
+const eventsPerCheck = 100
+
+type (
+	// A WalletManager provides the wallets, events, and balances to monitor.
+	WalletManager interface {
+		Wallets() ([]wallet.Wallet, error)
+		WalletEvents(ctx context.Context, id wallet.ID, offset, limit int) ([]wallet.Event, error)
+		WalletBalance(id wallet.ID) (wallet.Balance, error)
+		WalletFees(id wallet.ID, since time.Time) ([]wallet.FeeEntry, error)
+	}
+
+	// An Alerter registers alerts.
+	Alerter interface {
+		Register(alerts.Alert)
+	}
+
+	balanceSample struct {
+		siacoins  types.Currency
+		timestamp time.Time
+	}
+
+	// walletState tracks the recent activity of a wallet.
+	walletState struct {
+		seen     map[types.Hash256]time.Time // event ID -> timestamp
+		dust     map[types.Address]time.Time // address -> last dust deposit
+		balances []balanceSample
+		// feeAlert is the time of the last fee budget alert
+		feeAlert time.Time
+	}
+
+	// A Monitor periodically checks wallets for unusual activity and
+	// registers an alert for each anomaly it finds:
+	//   - a single event sending more than the large outflow threshold
+	//   - more than a number of addresses receiving dust within the window
+	//   - the balance dropping by more than a fraction within the window
+	//   - fees paid within the window exceeding the fee budget
+	Monitor struct {
+		wm     WalletManager
+		alerts Alerter
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+
+		interval      time.Duration
+		window        time.Duration
+		largeOutflow  types.Currency
+		dustThreshold types.Currency
+		dustAddresses int
+		balanceDrop   float64
+		feeBudget     types.Currency
+
+		mu      sync.Mutex // protects wallets
+		wallets map[wallet.ID]*walletState
+	}
+)
+
+func alertID(kind string, walletID wallet.ID, suffix string) types.Hash256 {
+	return types.HashBytes([]byte(fmt.Sprintf("anomaly/%s/%d/%s", kind, walletID, suffix)))
+}
+
+// dropFraction returns the fraction of peak lost to reach current.
+func dropFraction(peak, current types.Currency) float64 {
+	if peak.IsZero() || current.Cmp(peak) >= 0 {
+		return 0
+	}
+	f, _ := new(big.Rat).SetFrac(peak.Sub(current).Big(), peak.Big()).Float64()
+	return f
+}
+
+func (m *Monitor) state(id wallet.ID) *walletState {
+	ws, ok := m.wallets[id]
+	if !ok {
+		ws = &walletState{
+			seen: make(map[types.Hash256]time.Time),
+			dust: make(map[types.Address]time.Time),
+		}
+		m.wallets[id] = ws
+	}
+	return ws
+}
+
+// checkEvents checks a wallet's recent events for large outflows and dust
+// deposits.
+func (m *Monitor) checkEvents(w wallet.Wallet, ws *walletState, now time.Time) error {
+	events, err := m.wm.WalletEvents(context.Background(), w.ID, 0, eventsPerCheck)
+	if err != nil {
+		return fmt.Errorf("failed to get events: %w", err)
+	}
+
+	for _, ev := range events {
+		if _, ok := ws.seen[ev.ID]; ok || now.Sub(ev.Timestamp) > m.window {
+			continue
+		}
+		ws.seen[ev.ID] = ev.Timestamp
+
+		inflow, outflow := ev.SiacoinInflow(), ev.SiacoinOutflow()
+		switch {
+		case outflow.Cmp(inflow) > 0:
+			sent := outflow.Sub(inflow)
+			if m.largeOutflow.IsZero() || sent.Cmp(m.largeOutflow) <= 0 {
+				continue
+			}
+			m.alerts.Register(alerts.Alert{
+				ID:       alertID("largeOutflow", w.ID, ev.ID.String()),
+				Severity: alerts.SeverityWarning,
+				Message:  fmt.Sprintf("wallet %q sent %v in a single transaction", w.Name, sent),
+				Data: map[string]any{
+					"walletID": w.ID,
+					"eventID":  ev.ID,
+					"amount":   sent,
+				},
+				Timestamp: now,
+			})
+		case inflow.Cmp(outflow) > 0:
+			received := inflow.Sub(outflow)
+			if m.dustThreshold.IsZero() || received.Cmp(m.dustThreshold) >= 0 {
+				continue
+			}
+			for _, addr := range ev.Relevant {
+				ws.dust[addr] = ev.Timestamp
+			}
+		}
+	}
+
+	for id, timestamp := range ws.seen {
+		if now.Sub(timestamp) > m.window {
+			delete(ws.seen, id)
+		}
+	}
+	for addr, timestamp := range ws.dust {
+		if now.Sub(timestamp) > m.window {
+			delete(ws.dust, addr)
+		}
+	}
+
+	if m.dustAddresses > 0 && len(ws.dust) >= m.dustAddresses {
+		m.alerts.Register(alerts.Alert{
+			ID:       alertID("dust", w.ID, now.Format(time.RFC3339)),
+			Severity: alerts.SeverityWarning,
+			Message:  fmt.Sprintf("%d addresses of wallet %q received dust in the last %v", len(ws.dust), w.Name, m.window),
+			Data: map[string]any{
+				"walletID":  w.ID,
+				"addresses": len(ws.dust),
+				"threshold": m.dustThreshold,
+			},
+			Timestamp: now,
+		})
+		// reset so the same deposits do not trigger another alert
+		ws.dust = make(map[types.Address]time.Time)
+	}
+	return nil
+}
+
+// checkBalance checks whether a wallet's balance has dropped by more than
+// the configured fraction within the window.
+func (m *Monitor) checkBalance(w wallet.Wallet, ws *walletState, now time.Time) error {
+	balance, err := m.wm.WalletBalance(w.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get balance: %w", err)
+	}
+
+	samples := ws.balances[:0]
+	for _, s := range ws.balances {
+		if now.Sub(s.timestamp) <= m.window {
+			samples = append(samples, s)
+		}
+	}
+	ws.balances = append(samples, balanceSample{siacoins: balance.Siacoins, timestamp: now})
+
+	var peak types.Currency
+	for _, s := range ws.balances {
+		if s.siacoins.Cmp(peak) > 0 {
+			peak = s.siacoins
+		}
+	}
+	if drop := dropFraction(peak, balance.Siacoins); drop >= m.balanceDrop {
+		m.alerts.Register(alerts.Alert{
+			ID:       alertID("balanceDrop", w.ID, now.Format(time.RFC3339)),
+			Severity: alerts.SeverityCritical,
+			Message:  fmt.Sprintf("balance of wallet %q dropped %.1f%% in the last %v", w.Name, drop*100, m.window),
+			Data: map[string]any{
+				"walletID": w.ID,
+				"peak":     peak,
+				"balance":  balance.Siacoins,
+			},
+			Timestamp: now,
+		})
+		// reset so the same drop does not trigger another alert
+		ws.balances = ws.balances[len(ws.balances)-1:]
+	}
+	return nil
+}
+
+// checkFees checks whether the fees paid by a wallet within the window
+// exceed the fee budget. At most one alert is raised per window.
+func (m *Monitor) checkFees(w wallet.Wallet, ws *walletState, now time.Time) error {
+	if now.Sub(ws.feeAlert) < m.window {
+		return nil
+	}
+	entries, err := m.wm.WalletFees(w.ID, now.Add(-m.window))
+	if err != nil {
+		return fmt.Errorf("failed to get fees: %w", err)
+	}
+
+	var total types.Currency
+	for _, entry := range entries {
+		total = total.Add(entry.Amount)
+	}
+	if total.Cmp(m.feeBudget) <= 0 {
+		return nil
+	}
+	m.alerts.Register(alerts.Alert{
+		ID:       alertID("feeBudget", w.ID, now.Format(time.RFC3339)),
+		Severity: alerts.SeverityWarning,
+		Message:  fmt.Sprintf("wallet %q paid %v in fees in the last %v", w.Name, total, m.window),
+		Data: map[string]any{
+			"walletID":     w.ID,
+			"fees":         total,
+			"transactions": len(entries),
+			"budget":       m.feeBudget,
+		},
+		Timestamp: now,
+	})
+	ws.feeAlert = now
+	return nil
+}
+
+// check checks every wallet for anomalies.
+func (m *Monitor) check(now time.Time) error {
+	wallets, err := m.wm.Wallets()
+	if err != nil {
+		return fmt.Errorf("failed to get wallets: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[wallet.ID]bool)
+	for _, w := range wallets {
+		current[w.ID] = true
+		ws := m.state(w.ID)
+		if err := m.checkEvents(w, ws, now); err != nil {
+			return fmt.Errorf("failed to check events of wallet %v: %w", w.ID, err)
+		} else if m.balanceDrop > 0 {
+			if err := m.checkBalance(w, ws, now); err != nil {
+				return fmt.Errorf("failed to check balance of wallet %v: %w", w.ID, err)
+			}
+		}
+		if !m.feeBudget.IsZero() {
+			if err := m.checkFees(w, ws, now); err != nil {
+				return fmt.Errorf("failed to check fees of wallet %v: %w", w.ID, err)
+			}
+		}
+	}
+	// forget deleted wallets
+	for id := range m.wallets {
+		if !current[id] {
+			delete(m.wallets, id)
+		}
+	}
+	return nil
+}
+
+// Close stops the monitor.
+func (m *Monitor) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// NewMonitor creates a new anomaly monitor and starts checking wallets in the
+// background.
+func NewMonitor(wm WalletManager, alerter Alerter, opts ...Option) (*Monitor, error) {
+	m := &Monitor{
+		wm:     wm,
+		alerts: alerter,
+		log:    zap.NewNop(),
+		tg:     threadgroup.New(),
+
+		interval: time.Minute,
+		window:   time.Hour,
+
+		wallets: make(map[wallet.ID]*walletState),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "anomaly", "checks wallets for unusual outflows and fees", m.interval, false, func(context.Context) error {
+			err := m.check(time.Now())
+			if err != nil {
+				m.log.Warn("failed to check wallets", zap.Error(err))
+			}
+			return err
+		})
+	}()
+	return m, nil
+}
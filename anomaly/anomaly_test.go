@@ -0,0 +1,133 @@
+package anomaly
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type mockWalletManager struct {
+	wallets  []wallet.Wallet
+	balances map[wallet.ID]types.Currency
+	fees     []wallet.FeeEntry
+}
+
+func (m *mockWalletManager) Wallets() ([]wallet.Wallet, error) {
+	return m.wallets, nil
+}
+
+func (m *mockWalletManager) WalletEvents(context.Context, wallet.ID, int, int) ([]wallet.Event, error) {
+	return nil, nil
+}
+
+func (m *mockWalletManager) WalletBalance(id wallet.ID) (wallet.Balance, error) {
+	return wallet.Balance{Siacoins: m.balances[id]}, nil
+}
+
+func (m *mockWalletManager) WalletFees(_ wallet.ID, since time.Time) (entries []wallet.FeeEntry, _ error) {
+	for _, entry := range m.fees {
+		if !entry.Timestamp.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func TestBalanceDrop(t *testing.T) {
+	wm := &mockWalletManager{
+		wallets:  []wallet.Wallet{{ID: 1, Name: "hot"}},
+		balances: map[wallet.ID]types.Currency{1: types.Siacoins(1000)},
+	}
+	am := alerts.NewManager()
+	m, err := NewMonitor(wm, am, WithLogger(zaptest.NewLogger(t)), WithInterval(time.Hour), WithWindow(time.Hour), WithBalanceDrop(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	now := time.Now()
+	check := func(d time.Duration, balance types.Currency) {
+		t.Helper()
+		wm.balances[1] = balance
+		if err := m.check(now.Add(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check(0, types.Siacoins(1000))
+	check(time.Minute, types.Siacoins(600))
+	if n := len(am.Active()); n != 0 {
+		t.Fatalf("expected no alerts, got %d", n)
+	}
+
+	// a 50% drop from the peak within the window
+	check(2*time.Minute, types.Siacoins(500))
+	if active := am.Active(); len(active) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(active))
+	} else if active[0].Severity != alerts.SeverityCritical {
+		t.Fatalf("expected critical alert, got %v", active[0].Severity)
+	}
+
+	// the same drop does not trigger another alert
+	check(3*time.Minute, types.Siacoins(500))
+	if n := len(am.Active()); n != 1 {
+		t.Fatalf("expected 1 alert, got %d", n)
+	}
+
+	// drops outside of the window are ignored
+	check(4*time.Minute, types.Siacoins(1000))
+	check(2*time.Hour, types.Siacoins(400))
+	if n := len(am.Active()); n != 1 {
+		t.Fatalf("expected 1 alert, got %d", n)
+	}
+
+	if got := dropFraction(types.Siacoins(100), types.Siacoins(25)); got != 0.75 {
+		t.Fatalf("expected 0.75, got %v", got)
+	} else if got := dropFraction(types.ZeroCurrency, types.Siacoins(25)); got != 0 {
+		t.Fatalf("expected 0, got %v", got)
+	}
+}
+
+func TestFeeBudget(t *testing.T) {
+	wm := &mockWalletManager{
+		wallets: []wallet.Wallet{{ID: 1, Name: "payouts"}},
+	}
+	am := alerts.NewManager()
+	m, err := NewMonitor(wm, am, WithLogger(zaptest.NewLogger(t)), WithInterval(time.Hour), WithWindow(time.Hour), WithFeeBudget(types.Siacoins(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	now := time.Now()
+	addFee := func(d time.Duration, sc uint32) {
+		wm.fees = append(wm.fees, wallet.FeeEntry{Amount: types.Siacoins(sc), Timestamp: now.Add(d)})
+	}
+	check := func(d time.Duration, alerts int) {
+		t.Helper()
+		if err := m.check(now.Add(d)); err != nil {
+			t.Fatal(err)
+		} else if n := len(am.Active()); n != alerts {
+			t.Fatalf("expected %d alerts, got %d", alerts, n)
+		}
+	}
+
+	addFee(0, 1)
+	check(time.Minute, 0)
+
+	// exceeding the budget within the window raises an alert
+	addFee(2*time.Minute, 1)
+	check(3*time.Minute, 1)
+
+	// the alert is not repeated within the window
+	addFee(4*time.Minute, 1)
+	check(5*time.Minute, 1)
+
+	// old fees fall out of the window
+	check(2*time.Hour, 1)
+}
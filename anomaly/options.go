@@ -0,0 +1,75 @@
+package anomaly
+
+import (
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Monitor.
+type Option func(*Monitor)
+
+// WithLogger sets the logger used by the monitor.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Monitor) {
+		m.log = log
+	}
+}
+
+// WithInterval sets how often wallets are checked. The default is one
+// minute.
+func WithInterval(d time.Duration) Option {
+	return func(m *Monitor) {
+		m.interval = d
+	}
+}
+
+// WithWindow sets the period over which dust deposits and balance drops are
+// measured. The default is one hour.
+func WithWindow(d time.Duration) Option {
+	return func(m *Monitor) {
+		m.window = d
+	}
+}
+
+// WithLargeOutflow alerts when a single event sends more than amount out of
+// a wallet.
+func WithLargeOutflow(amount types.Currency) Option {
+	return func(m *Monitor) {
+		m.largeOutflow = amount
+	}
+}
+
+// WithDustDetection alerts when at least n addresses of a wallet receive
+// deposits smaller than threshold within the window.
+func WithDustDetection(threshold types.Currency, n int) Option {
+	return func(m *Monitor) {
+		m.dustThreshold = threshold
+		m.dustAddresses = n
+	}
+}
+
+// WithBalanceDrop alerts when a wallet's balance drops by at least fraction
+// (between 0 and 1) of its peak within the window.
+func WithBalanceDrop(fraction float64) Option {
+	return func(m *Monitor) {
+		m.balanceDrop = fraction
+	}
+}
+
+// WithFeeBudget alerts when a wallet pays more than amount in fees within the
+// window.
+func WithFeeBudget(amount types.Currency) Option {
+	return func(m *Monitor) {
+		m.feeBudget = amount
+	}
+}
+
+// WithScheduler registers the outflow and fee checks as the "anomaly" job.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Monitor) {
+		m.sched = s
+	}
+}
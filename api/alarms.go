@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func (s *server) walletsAlarmsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	alarms, err := s.wm.BalanceAlarms(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get balance alarms", err) != nil {
+		return
+	}
+	jc.Encode(alarms)
+}
+
+func (s *server) walletsAlarmsHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req BalanceAlarmRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	a := wallet.BalanceAlarm{
+		WalletID: id,
+		Address:  req.Address,
+		Low:      req.Low,
+		High:     req.High,
+	}
+	if err := a.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	a, err := s.wm.AddBalanceAlarm(a)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't add balance alarm", err) != nil {
+		return
+	}
+	jc.Encode(a)
+}
+
+func (s *server) walletsAlarmsIDHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var alarmID wallet.AlarmID
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("alarm", &alarmID) != nil {
+		return
+	}
+	err := s.wm.RemoveBalanceAlarm(id, alarmID)
+	if errors.Is(err, wallet.ErrAlarmNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove balance alarm", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+)
+
+func (s *server) alertsHandlerGET(jc jape.Context) {
+	var severity alerts.Severity
+	offset, limit := 0, 100
+	if jc.DecodeForm("severity", &severity) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	active := s.am.Active()
+	if severity != 0 {
+		filtered := active[:0]
+		for _, a := range active {
+			if a.Severity == severity {
+				filtered = append(filtered, a)
+			}
+		}
+		active = filtered
+	}
+
+	if offset < 0 || offset > len(active) {
+		offset = len(active)
+	}
+	active = active[offset:]
+	if limit >= 0 && limit < len(active) {
+		active = active[:limit]
+	}
+	jc.Encode(active)
+}
+
+func (s *server) alertsDismissHandlerPOST(jc jape.Context) {
+	var ids []types.Hash256
+	if jc.Decode(&ids) != nil {
+		return
+	}
+	s.am.Dismiss(ids...)
+	jc.EmptyResonse()
+}
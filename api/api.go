@@ -2,8 +2,20 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
+	"go.thebigfile.com/walletd/bandwidth"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/health"
+	"go.thebigfile.com/walletd/ibd"
+	"go.thebigfile.com/walletd/labels"
+	"go.thebigfile.com/walletd/paymenturi"
+	"go.thebigfile.com/walletd/peerscore"
+	"go.thebigfile.com/walletd/reconcile"
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/threshold"
+	"go.thebigfile.com/walletd/usage"
 	"go.thebigfile.com/walletd/wallet"
 	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/types"
@@ -18,6 +30,41 @@ type StateResponse struct {
 	BuildTime time.Time        `json:"buildTime"`
 	StartTime time.Time        `json:"startTime"`
 	IndexMode wallet.IndexMode `json:"indexMode"`
+	// Ingest reports how far the wallet store is behind the chain.
+	Ingest wallet.IngestStatus `json:"ingest"`
+}
+
+// EnumerationsResponse is the response type for [GET] /enums.
+type EnumerationsResponse struct {
+	// Locale is the locale of the display strings.
+	Locale       string               `json:"locale"`
+	Locales      []string             `json:"locales"`
+	Enumerations []labels.Enumeration `json:"enumerations"`
+}
+
+// PaymentURIRequest is the request type for [POST] /payment-uris/parse.
+type PaymentURIRequest struct {
+	URI string `json:"uri"`
+}
+
+// PaymentURIResponse is the response type for [POST] /payment-uris and
+// [POST] /payment-uris/parse. URI is the canonical encoding of the payment
+// request.
+type PaymentURIResponse struct {
+	URI     string         `json:"uri"`
+	Request paymenturi.URI `json:"request"`
+	Expired bool           `json:"expired"`
+}
+
+// LoginRequest is the request type for /auth/login.
+type LoginRequest struct {
+	Password string `json:"password"`
+}
+
+// SessionResponse is the response type for /auth/login and /auth/refresh.
+// The session token itself is returned in an httpOnly cookie.
+type SessionResponse struct {
+	Expiration time.Time `json:"expiration"`
 }
 
 // A GatewayPeer is a currently-connected peer.
@@ -30,14 +77,433 @@ type GatewayPeer struct {
 	ConnectedSince time.Time     `json:"connectedSince,omitempty"`
 	SyncedBlocks   uint64        `json:"syncedBlocks,omitempty"`
 	SyncDuration   time.Duration `json:"syncDuration,omitempty"`
+
+	// BytesSent and BytesReceived are only reported for inbound peers.
+	BytesSent     uint64 `json:"bytesSent,omitempty"`
+	BytesReceived uint64 `json:"bytesReceived,omitempty"`
+
+	Score *peerscore.Score `json:"score,omitempty"`
+}
+
+// SyncerStatusResponse is the response type for [GET] /syncer/status.
+type SyncerStatusResponse struct {
+	Address string `json:"address"`
+	Peers   int    `json:"peers"`
+	// Clock is the result of the last clock skew check. It is omitted if
+	// the check is disabled.
+	Clock *health.ClockStatus `json:"clock,omitempty"`
+	// Bandwidth is the total bandwidth used by inbound peers since
+	// startup. It is omitted if bandwidth accounting is disabled.
+	Bandwidth *bandwidth.Usage `json:"bandwidth,omitempty"`
+	// Sync is the timing of each stage of the initial sync. It is omitted
+	// if the stages are not tracked.
+	Sync *ibd.Status `json:"sync,omitempty"`
+}
+
+// ErrPendingApproval is returned by Client.TxpoolBroadcast and the
+// WalletClient methods that sign or submit transactions when a transaction
+// set is added to the approval queue instead of being broadcast or returned.
+var ErrPendingApproval = errors.New("transaction set requires approval")
+
+// HeaderTotalCount is the response header containing the total number of
+// items matching a paginated request.
+const HeaderTotalCount = "X-Total-Count"
+
+// WebhookRequest is the request type for [POST] /webhooks.
+type WebhookRequest struct {
+	CallbackURL string   `json:"callbackURL"`
+	Scopes      []string `json:"scopes"`
+}
+
+// TriggerRequest is the request type for [POST] /triggers. Exactly one of
+// Height and Interval must be set.
+type TriggerRequest struct {
+	Name     string `json:"name"`
+	Height   uint64 `json:"height,omitempty"`
+	Interval uint64 `json:"interval,omitempty"`
+}
+
+// ApproverPairingRequest is the request type for [POST] /approvers/pairings.
+type ApproverPairingRequest struct {
+	Name string `json:"name"`
+}
+
+// LimitOverrideRequest is the request type for [POST]
+// /wallets/:id/limits/override. A zero or past expiration clears the
+// override.
+type LimitOverrideRequest struct {
+	Expiration time.Time `json:"expiration"`
+}
+
+// AllowlistRequest is the request type for [PUT] /wallets/:id/allowlist.
+type AllowlistRequest struct {
+	Address     types.Address `json:"address"`
+	Description string        `json:"description"`
+}
+
+// PaymentRequest is the request type for [POST] /wallets/:id/payments.
+type PaymentRequest struct {
+	Address types.Address  `json:"address"`
+	Value   types.Currency `json:"value"`
+}
+
+// WithdrawalProposalRequest is the request type for [POST]
+// /wallets/:id/proposals.
+type WithdrawalProposalRequest struct {
+	Outputs []types.SiacoinOutput `json:"outputs"`
+	// ChangeAddress receives the change. Defaults to the address of the
+	// first input.
+	ChangeAddress types.Address `json:"changeAddress,omitempty"`
+}
+
+// WalletSignerRequest is the request type for [PUT] /wallets/:id/signer and
+// the response type for [GET] /wallets/:id/signer.
+type WalletSignerRequest struct {
+	// Signer is the name of a configured signer. An empty name removes the
+	// wallet's signer.
+	Signer string `json:"signer"`
+}
+
+// WalletConfirmationsRequest is the request type for [PUT]
+// /wallets/:id/confirmations and the response type for [GET]
+// /wallets/:id/confirmations.
+type WalletConfirmationsRequest struct {
+	// MinConfirmations is the number of confirmations an output must have
+	// to fund the wallet's transactions. Zero removes the minimum.
+	MinConfirmations uint64 `json:"minConfirmations"`
+}
+
+// WalletSignRequest is the request type for [POST] /wallets/:id/sign.
+// ToSign lists the parent IDs of the v1 transaction's signatures to fill in.
+type WalletSignRequest struct {
+	Transaction   *types.Transaction   `json:"transaction,omitempty"`
+	ToSign        []types.Hash256      `json:"toSign,omitempty"`
+	V2Transaction *types.V2Transaction `json:"v2Transaction,omitempty"`
+}
+
+// WalletSignResponse is the response type for [POST] /wallets/:id/sign.
+type WalletSignResponse struct {
+	Transaction   *types.Transaction   `json:"transaction,omitempty"`
+	V2Transaction *types.V2Transaction `json:"v2Transaction,omitempty"`
+}
+
+// Sources of the inputs of a decoded transaction.
+const (
+	// InputSourceConfirmed is an input that spends a confirmed, unspent
+	// output.
+	InputSourceConfirmed = "confirmed"
+	// InputSourceUnconfirmed is an input that spends an output created by
+	// a transaction in the pool.
+	InputSourceUnconfirmed = "unconfirmed"
+	// InputSourceUnknown is an input whose parent is spent or not indexed.
+	InputSourceUnknown = "unknown"
+)
+
+// TransactionDecodeRequest is the request type for [POST]
+// /transactions/decode. Exactly one of Transaction, V2Transaction, or Hex
+// must be set. Hex is the transaction in Sia's binary encoding, and Version
+// is its version, 1 or 2, defaulting to 2.
+type TransactionDecodeRequest struct {
+	Transaction   *types.Transaction   `json:"transaction,omitempty"`
+	V2Transaction *types.V2Transaction `json:"v2Transaction,omitempty"`
+	Hex           string               `json:"hex,omitempty"`
+	Version       int                  `json:"version,omitempty"`
+}
+
+// A DecodedSiacoinInput is a siacoin input of a decoded transaction. The
+// value of a v1 input is only known if its parent is found.
+type DecodedSiacoinInput struct {
+	ParentID types.SiacoinOutputID `json:"parentID"`
+	Source   string                `json:"source"`
+	Address  types.Address         `json:"address"`
+	Value    *types.Currency       `json:"value,omitempty"`
+	// WalletID is the local wallet that owns the input, if any.
+	WalletID *wallet.ID `json:"walletID,omitempty"`
+}
+
+// A DecodedSiacoinOutput is a siacoin output of a decoded transaction.
+type DecodedSiacoinOutput struct {
+	ID       types.SiacoinOutputID `json:"id"`
+	Address  types.Address         `json:"address"`
+	Value    types.Currency        `json:"value"`
+	WalletID *wallet.ID            `json:"walletID,omitempty"`
+}
+
+// A DecodedSiafundInput is a siafund input of a decoded transaction.
+type DecodedSiafundInput struct {
+	ParentID types.SiafundOutputID `json:"parentID"`
+	Source   string                `json:"source"`
+	Address  types.Address         `json:"address"`
+	Value    *uint64               `json:"value,omitempty"`
+	WalletID *wallet.ID            `json:"walletID,omitempty"`
+}
+
+// A DecodedSiafundOutput is a siafund output of a decoded transaction.
+type DecodedSiafundOutput struct {
+	ID       types.SiafundOutputID `json:"id"`
+	Address  types.Address         `json:"address"`
+	Value    uint64                `json:"value"`
+	WalletID *wallet.ID            `json:"walletID,omitempty"`
+}
+
+// A DecodedTransaction is the response type for [POST]
+// /transactions/decode.
+type DecodedTransaction struct {
+	ID            types.TransactionID  `json:"id"`
+	Version       int                  `json:"version"`
+	Transaction   *types.Transaction   `json:"transaction,omitempty"`
+	V2Transaction *types.V2Transaction `json:"v2Transaction,omitempty"`
+
+	SiacoinInputs  []DecodedSiacoinInput  `json:"siacoinInputs"`
+	SiacoinOutputs []DecodedSiacoinOutput `json:"siacoinOutputs"`
+	SiafundInputs  []DecodedSiafundInput  `json:"siafundInputs"`
+	SiafundOutputs []DecodedSiafundOutput `json:"siafundOutputs"`
+
+	Fee types.Currency `json:"fee"`
+	// Size is the length of the transaction's binary encoding, and Weight
+	// is its weight at the current tip.
+	Size   uint64 `json:"size"`
+	Weight uint64 `json:"weight"`
+}
+
+// WalletSignMessageRequest is the request type for [POST]
+// /wallets/:id/addresses/:addr/sign-message.
+type WalletSignMessageRequest struct {
+	Message string `json:"message"`
+}
+
+// VerifyMessageResponse is the response type for [POST] /verify-message.
+type VerifyMessageResponse struct {
+	Valid bool `json:"valid"`
+	// Reason explains why an invalid message failed verification.
+	Reason string `json:"reason,omitempty"`
+}
+
+// WalletSeedRequest is the request type for [PUT] /wallets/:id/seed.
+type WalletSeedRequest struct {
+	Phrase string `json:"phrase"`
+	// Passphrase encrypts the seed. It is required to unlock the wallet.
+	Passphrase string `json:"passphrase"`
+}
+
+// TOTPConfirmRequest is the request type for [POST] /wallets/:id/totp/confirm.
+type TOTPConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+// WalletUnlockRequest is the request type for [POST] /wallets/:id/unlock.
+type WalletUnlockRequest struct {
+	Passphrase string `json:"passphrase"`
+	// Timeout is how long the wallet stays unlocked. If zero, the default
+	// timeout is used.
+	Timeout time.Duration `json:"timeout"`
+}
+
+// WalletImportRequest is the request type for [POST] /wallets/import.
+type WalletImportRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Metadata    json.RawMessage `json:"metadata"`
+	// Format is the format of Data: "sia-ui", "renterd", or "phrase". If
+	// empty, the format is detected.
+	Format string `json:"format,omitempty"`
+	// Data is the exported wallet definition.
+	Data string `json:"data"`
+	// Addresses is the number of addresses derived for formats that do not
+	// list them. If zero, renterd imports derive one address and seed
+	// phrases derive 20.
+	Addresses uint64 `json:"addresses,omitempty"`
+	// Passphrase, if set, stores the wallet's seed encrypted with it so
+	// that the wallet can sign once unlocked. Otherwise, the seed is
+	// discarded after the addresses are derived.
+	Passphrase string `json:"passphrase,omitempty"`
 }
 
-// TxpoolBroadcastRequest is the request type for /txpool/broadcast.
+// WalletImportResponse is the response type for [POST] /wallets/import.
+type WalletImportResponse struct {
+	Wallet     wallet.Wallet `json:"wallet"`
+	Format     string        `json:"format"`
+	Addresses  int           `json:"addresses"`
+	SeedStored bool          `json:"seedStored"`
+	// Conflicts are the imported addresses that are also in other wallets.
+	Conflicts []AddressConflict `json:"conflicts,omitempty"`
+}
+
+// An AddressConflict is an address that is in more than one wallet. Wallets
+// that the caller cannot access are omitted from WalletIDs.
+type AddressConflict struct {
+	Address   types.Address `json:"address"`
+	WalletIDs []wallet.ID   `json:"walletIDs,omitempty"`
+}
+
+// BackupChallengeRequest is the request type for [POST]
+// /wallets/:id/backup/challenge.
+type BackupChallengeRequest struct {
+	// Words is the number of words of the recovery phrase to confirm. If
+	// zero, three words are requested.
+	Words int `json:"words"`
+}
+
+// BackupVerifyRequest is the request type for [POST]
+// /wallets/:id/backup/verify.
+type BackupVerifyRequest struct {
+	ChallengeID types.Hash256 `json:"challengeID"`
+	// Words are the requested words in the order of the challenge's
+	// positions.
+	Words []string `json:"words"`
+}
+
+// RotationRequest is the request type for [POST] /wallets/:id/rotate.
+type RotationRequest struct {
+	// Addresses is the number of addresses derived from the new seed.
+	Addresses int `json:"addresses,omitempty"`
+	// MaxFeeRate delays sweeps while the wallet's fee rate is higher. A
+	// zero value sweeps at any fee rate.
+	MaxFeeRate types.Currency `json:"maxFeeRate"`
+	// MaxInputs is the maximum number of inputs in each sweep.
+	MaxInputs int `json:"maxInputs,omitempty"`
+}
+
+// RotationResponse is the response type for [POST] /wallets/:id/rotate. The
+// seed phrase of the new addresses is only returned once.
+type RotationResponse struct {
+	Rotation   rotation.Rotation `json:"rotation"`
+	SeedPhrase string            `json:"seedPhrase"`
+}
+
+// ForwardingRuleRequest is the request type for [POST]
+// /wallets/:id/forwarding/rules.
+type ForwardingRuleRequest struct {
+	// Address is the wallet address whose deposits are forwarded.
+	Address types.Address `json:"address"`
+	// Destination is the address deposits are forwarded to. It must be
+	// omitted if Splits is set.
+	Destination types.Address `json:"destination"`
+	// Splits divides deposits among several destinations by percentage.
+	Splits []forwarding.Split `json:"splits,omitempty"`
+	// MinConfirmations is the number of confirmations a deposit needs
+	// before it is forwarded. If zero, the server's default is used.
+	MinConfirmations uint64 `json:"minConfirmations,omitempty"`
+	// MinAmount delays sweeps until the confirmed deposits are worth at
+	// least this amount.
+	MinAmount types.Currency `json:"minAmount"`
+}
+
+// TransferRequest is the request type for [POST] /transfers.
+type TransferRequest struct {
+	From  wallet.ID      `json:"from"`
+	To    wallet.ID      `json:"to"`
+	Value types.Currency `json:"value"`
+	// Method is "ledger" or "chain". If empty, the transfer is recorded as
+	// a ledger entry when both wallets share an operator and the server
+	// prefers ledger transfers, and funded on chain otherwise.
+	Method string `json:"method,omitempty"`
+	Memo   string `json:"memo,omitempty"`
+}
+
+// DigestRequest is the request type for [PUT] /wallets/:id/digest.
+type DigestRequest struct {
+	// Frequency is "daily" or "weekly".
+	Frequency string `json:"frequency"`
+}
+
+// EscrowRequest is the request type for [POST] /wallets/:id/escrows.
+type EscrowRequest struct {
+	Buyer   types.PublicKey `json:"buyer"`
+	Seller  types.PublicKey `json:"seller"`
+	Arbiter types.PublicKey `json:"arbiter"`
+	// BuyerAddress receives refunds and SellerAddress receives releases.
+	// If omitted, the standard address of the party's key is used.
+	BuyerAddress  types.Address  `json:"buyerAddress"`
+	SellerAddress types.Address  `json:"sellerAddress"`
+	Amount        types.Currency `json:"amount"`
+}
+
+// EscrowFundRequest is the request type for [POST]
+// /wallets/:id/escrows/:escrow/fund.
+type EscrowFundRequest struct {
+	// Wallet is the wallet paying the escrow amount.
+	Wallet wallet.ID `json:"wallet"`
+	// ChangeAddress receives the change. If omitted, the address of the
+	// first input is used.
+	ChangeAddress types.Address `json:"changeAddress"`
+}
+
+// EscrowSignatureRequest is the request type for [POST]
+// /wallets/:id/escrows/:escrow/signatures.
+type EscrowSignatureRequest struct {
+	PublicKey types.PublicKey `json:"publicKey"`
+	// Signature signs the SigHash of the escrow's pending settlement.
+	Signature types.Signature `json:"signature"`
+}
+
+// ThresholdGroupRequest is the request type for [POST] /threshold/groups.
+type ThresholdGroupRequest struct {
+	Name            string          `json:"name"`
+	PublicKey       types.PublicKey `json:"publicKey"`
+	Threshold       int             `json:"threshold"`
+	MaxParticipants int             `json:"maxParticipants"`
+}
+
+// ThresholdParticipantRequest is the request type for [POST]
+// /threshold/groups/:id/participants.
+type ThresholdParticipantRequest struct {
+	ID   uint16 `json:"id"`
+	Name string `json:"name"`
+}
+
+// ThresholdSessionRequest is the request type for [POST] /threshold/sessions.
+type ThresholdSessionRequest struct {
+	GroupID     threshold.GroupID   `json:"groupID"`
+	Transaction types.V2Transaction `json:"transaction"`
+}
+
+// TagRequest is the request type for [PUT] /tags.
+type TagRequest struct {
+	Address  types.Address `json:"address"`
+	Label    string        `json:"label"`
+	Category string        `json:"category"`
+}
+
+// TxpoolBroadcastRequest is the request type for /txpool/broadcast and
+// /txpool/graph.
 type TxpoolBroadcastRequest struct {
 	Transactions   []types.Transaction   `json:"transactions"`
 	V2Transactions []types.V2Transaction `json:"v2transactions"`
 }
 
+// A TransactionNode is a transaction in a dependency graph.
+type TransactionNode struct {
+	ID      types.TransactionID `json:"id"`
+	Version int                 `json:"version"`
+	// SiacoinOutputIDs and SiafundOutputIDs are the IDs of the outputs the
+	// transaction creates.
+	SiacoinOutputIDs []types.SiacoinOutputID `json:"siacoinOutputIDs"`
+	SiafundOutputIDs []types.SiafundOutputID `json:"siafundOutputIDs"`
+	// Parents are the transactions in the set whose outputs the transaction
+	// spends, and PoolParents are the transactions in the pool whose outputs
+	// it spends.
+	Parents     []types.TransactionID `json:"parents"`
+	PoolParents []types.TransactionID `json:"poolParents"`
+	// MissingSiacoinParents and MissingSiafundParents are the outputs the
+	// transaction spends that are not created by the set or the pool and
+	// are not unspent in the index.
+	MissingSiacoinParents []types.SiacoinOutputID `json:"missingSiacoinParents"`
+	MissingSiafundParents []types.SiafundOutputID `json:"missingSiafundParents"`
+}
+
+// TxpoolGraphResponse is the response type for [POST] /txpool/graph.
+type TxpoolGraphResponse struct {
+	// Transactions are the v1 transactions of the set followed by its v2
+	// transactions.
+	Transactions []TransactionNode `json:"transactions"`
+	// Order is an order the transactions can be broadcast in, with each
+	// transaction after its parents.
+	Order []types.TransactionID `json:"order"`
+	// Complete is true if no transaction has missing parents.
+	Complete bool `json:"complete"`
+}
+
 // TxpoolTransactionsResponse is the response type for /txpool/transactions.
 type TxpoolTransactionsResponse struct {
 	Transactions   []types.Transaction   `json:"transactions"`
@@ -59,6 +525,70 @@ type WalletUpdateRequest struct {
 	Name        string          `json:"name"`
 	Description string          `json:"description"`
 	Metadata    json.RawMessage `json:"metadata"`
+	// TemplateID applies a template's default settings to a new wallet.
+	// It is ignored when updating a wallet.
+	TemplateID *wallet.TemplateID `json:"templateID,omitempty"`
+	// Type is the type of a new wallet, either empty or "cold". It is
+	// ignored when updating a wallet.
+	Type string `json:"type,omitempty"`
+	// Revision is the revision of the wallet being updated. If set, or if
+	// the If-Match header is set, the update fails with 409 Conflict when
+	// the wallet has been updated since. It is ignored when adding a
+	// wallet.
+	Revision uint64 `json:"revision,omitempty"`
+}
+
+// A TemplateRequest is a request to add or update a wallet template.
+type TemplateRequest struct {
+	Name           string                   `json:"name"`
+	Description    string                   `json:"description"`
+	Metadata       json.RawMessage          `json:"metadata,omitempty"`
+	MetadataSchema json.RawMessage          `json:"metadataSchema,omitempty"`
+	FeeStrategy    *wallet.FeeStrategy      `json:"feeStrategy,omitempty"`
+	Webhooks       []wallet.TemplateWebhook `json:"webhooks,omitempty"`
+}
+
+// A ClassificationRuleRequest is a request to add an event classification
+// rule.
+type ClassificationRuleRequest struct {
+	Name         string          `json:"name"`
+	Category     string          `json:"category"`
+	Types        []string        `json:"types,omitempty"`
+	Counterparty *types.Address  `json:"counterparty,omitempty"`
+	Role         string          `json:"role,omitempty"`
+	MinAmount    *types.Currency `json:"minAmount,omitempty"`
+	MaxAmount    *types.Currency `json:"maxAmount,omitempty"`
+	Memo         string          `json:"memo,omitempty"`
+}
+
+// BalanceAlarmRequest is the request type for [POST] /wallets/:id/alarms.
+type BalanceAlarmRequest struct {
+	// Address restricts the alarm to one of the wallet's addresses. If
+	// nil, the alarm watches the wallet's balance.
+	Address *types.Address  `json:"address,omitempty"`
+	Low     *types.Currency `json:"low,omitempty"`
+	High    *types.Currency `json:"high,omitempty"`
+}
+
+// A MetadataValidationResponse is returned with status 400 when a wallet's
+// metadata does not match its schema.
+type MetadataValidationResponse struct {
+	Error  string                 `json:"error"`
+	Errors []wallet.MetadataError `json:"errors"`
+}
+
+// A WalletConflictResponse is returned with status 409 when a wallet update
+// specifies a revision other than the wallet's current revision.
+type WalletConflictResponse struct {
+	Error    string `json:"error"`
+	Revision uint64 `json:"revision"`
+}
+
+// A GroupRequest is a request to add or update a wallet group.
+type GroupRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	ParentID    *wallet.GroupID `json:"parentID,omitempty"`
 }
 
 // WalletReleaseRequest is the request type for /wallets/:id/release.
@@ -67,11 +597,23 @@ type WalletReleaseRequest struct {
 	SiafundOutputs []types.SiafundOutputID `json:"siafundOutputs"`
 }
 
+// WalletReconcileRequest is the request type for /wallets/:id/reconcile.
+// Entries are reconciled against the wallet's events confirmed between Start
+// and End, inclusive.
+type WalletReconcileRequest struct {
+	Start   uint64            `json:"start"`
+	End     uint64            `json:"end"`
+	Entries []reconcile.Entry `json:"entries"`
+}
+
 // WalletFundRequest is the request type for /wallets/:id/fund.
 type WalletFundRequest struct {
 	Transaction   types.Transaction `json:"transaction"`
 	Amount        types.Currency    `json:"amount"`
 	ChangeAddress types.Address     `json:"changeAddress"`
+	// MinConfirmations is the number of confirmations the funding outputs
+	// must have. The wallet's minimum applies if it is higher.
+	MinConfirmations uint64 `json:"minConfirmations,omitempty"`
 }
 
 // WalletFundSFRequest is the request type for /wallets/:id/fundsf.
@@ -80,6 +622,17 @@ type WalletFundSFRequest struct {
 	Amount        uint64            `json:"amount"`
 	ChangeAddress types.Address     `json:"changeAddress"`
 	ClaimAddress  types.Address     `json:"claimAddress"`
+	// MinConfirmations is the number of confirmations the funding outputs
+	// must have. The wallet's minimum applies if it is higher.
+	MinConfirmations uint64 `json:"minConfirmations,omitempty"`
+}
+
+// WalletEstimateRequest is the request type for [POST] /wallets/:id/estimate.
+type WalletEstimateRequest struct {
+	Outputs []types.SiacoinOutput `json:"outputs"`
+	// MinConfirmations is the number of confirmations the funding outputs
+	// must have. The wallet's minimum applies if it is higher.
+	MinConfirmations uint64 `json:"minConfirmations,omitempty"`
 }
 
 // WalletFundResponse is the response type for /wallets/:id/fund.
@@ -98,10 +651,12 @@ type SeedSignRequest struct {
 
 // RescanResponse contains information about the state of a chain rescan.
 type RescanResponse struct {
-	StartIndex types.ChainIndex `json:"startIndex"`
-	Index      types.ChainIndex `json:"index"`
-	StartTime  time.Time        `json:"startTime"`
-	Error      *string          `json:"error,omitempty"`
+	// OperationID is the ID of the operation running the rescan.
+	OperationID types.Hash256    `json:"operationID"`
+	StartIndex  types.ChainIndex `json:"startIndex"`
+	Index       types.ChainIndex `json:"index"`
+	StartTime   time.Time        `json:"startTime"`
+	Error       *string          `json:"error,omitempty"`
 }
 
 // An ApplyUpdate is a consensus update that was applied to the best chain.
@@ -124,8 +679,75 @@ type ConsensusUpdatesResponse struct {
 	Reverted []RevertUpdate `json:"reverted"`
 }
 
+// A ConsensusStatsWindow summarizes the blocks in a window ending at the tip.
+type ConsensusStatsWindow struct {
+	Blocks      uint64 `json:"blocks"`
+	StartHeight uint64 `json:"startHeight"`
+	EndHeight   uint64 `json:"endHeight"`
+	// AvgBlockInterval is the average time between the window's blocks,
+	// based on their timestamps.
+	AvgBlockInterval time.Duration `json:"avgBlockInterval"`
+	// AvgDifficulty is the average difficulty of the window's blocks.
+	AvgDifficulty types.Work `json:"avgDifficulty"`
+	// Hashrate is the estimated network hashrate over the window, in
+	// hashes per second.
+	Hashrate float64 `json:"hashrate"`
+}
+
+// ConsensusStatsResponse is the response type for [GET] /consensus/stats.
+type ConsensusStatsResponse struct {
+	Tip                 types.ChainIndex       `json:"tip"`
+	Difficulty          types.Work             `json:"difficulty"`
+	TotalWork           types.Work             `json:"totalWork"`
+	TargetBlockInterval time.Duration          `json:"targetBlockInterval"`
+	Windows             []ConsensusStatsWindow `json:"windows"`
+}
+
+// A BatchRequest is a sub-request of [POST] /batch. Path is relative to the
+// API root and may include a query string.
+type BatchRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// A BatchResponse is the response to a BatchRequest. Body holds the JSON
+// response of a successful sub-request and Error holds the error message of
+// a failed one.
+type BatchResponse struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// BatchResult is the response type for [POST] /batch.
+type BatchResult struct {
+	// Tip is the consensus tip when the batch started.
+	Tip types.ChainIndex `json:"tip"`
+	// Consistent is true if the tip did not change while the batch was
+	// executed, i.e. every response reflects the same chain state.
+	Consistent bool            `json:"consistent"`
+	Responses  []BatchResponse `json:"responses"`
+}
+
 // DebugMineRequest is the request type for /debug/mine.
 type DebugMineRequest struct {
 	Blocks  int           `json:"blocks"`
 	Address types.Address `json:"address"`
 }
+
+// TenantUsage is a tenant's resource usage and quota.
+type TenantUsage struct {
+	Tenant    string      `json:"tenant"`
+	Wallets   int         `json:"wallets"`
+	Addresses int         `json:"addresses"`
+	Calls     uint64      `json:"calls"`
+	Quota     usage.Quota `json:"quota"`
+}
+
+// UsageResponse is the response type for /system/usage.
+type UsageResponse struct {
+	Since   time.Time      `json:"since"`
+	Tenants []TenantUsage  `json:"tenants"`
+	Calls   []usage.Record `json:"calls"`
+}
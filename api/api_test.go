@@ -6,17 +6,33 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"go.sia.tech/jape"
 	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/api/apitest"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/internal/password"
+	"go.thebigfile.com/walletd/operations"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/paymenturi"
 	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/reconcile"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/usage"
 	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/walletd/webhooks"
 	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/gateway"
 	"go.thebigfile.com/core/types"
@@ -217,11 +233,19 @@ func TestWalletAdd(t *testing.T) {
 
 		time.Sleep(time.Second) // ensure LastUpdated is different
 
-		w, err = c.UpdateWallet(w.ID, test.Update)
+		// updates must be based on a revision
+		if _, err := c.UpdateWallet(w.ID, test.Update); err == nil || !strings.Contains(err.Error(), "required") {
+			t.Fatalf("expected precondition required error, got %v", err)
+		}
+		update := test.Update
+		update.Revision = w.Revision
+		w, err = c.UpdateWallet(w.ID, update)
 		if err != nil {
 			t.Fatal(err)
 		} else if err := checkWalletResponse(test.Update, w, true); err != nil {
 			t.Fatalf("test %v: %v", i, err)
+		} else if _, err := c.UpdateWallet(w.ID, update); err == nil || !strings.Contains(err.Error(), "wallet was modified") {
+			t.Fatalf("expected revision conflict, got %v", err)
 		}
 
 		// check that the wallet was updated
@@ -332,7 +356,10 @@ func TestWallet(t *testing.T) {
 	}
 
 	// create and add an address
-	addr := sav.NewAddress("primary")
+	addr, err := sav.NewAddress("primary")
+	if err != nil {
+		t.Fatal(err)
+	}
 	if err := wc.AddAddress(addr); err != nil {
 		t.Fatal(err)
 	}
@@ -550,7 +577,10 @@ func TestAddresses(t *testing.T) {
 	}
 
 	// create and add an address
-	addr := sav.NewAddress("primary")
+	addr, err := sav.NewAddress("primary")
+	if err != nil {
+		t.Fatal(err)
+	}
 	if err := wc.AddAddress(addr); err != nil {
 		t.Fatal(err)
 	}
@@ -1286,41 +1316,78 @@ func TestConsensusUpdates(t *testing.T) {
 	}
 }
 
-func TestDebugMine(t *testing.T) {
+func TestConsensusStats(t *testing.T) {
 	log := zaptest.NewLogger(t)
-	n, genesisBlock := testNetwork()
 
-	// create wallets
+	n, genesisBlock := testNetwork()
 	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
 	if err != nil {
 		t.Fatal(err)
 	}
 	cm := chain.NewManager(dbstore, tipState)
 
-	l, err := net.Listen("tcp", ":0")
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer l.Close()
+	defer ws.Close()
 
-	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer ws.Close()
+	defer wm.Close()
 
-	ps, err := sqlite.NewPeerStore(ws)
+	c := runServer(t, cm, nil, wm)
+
+	for i := 0; i < 10; i++ {
+		b, ok := coreutils.MineBlock(cm, types.VoidAddress, time.Second)
+		if !ok {
+			t.Fatal("failed to mine block")
+		} else if err := cm.AddBlocks([]types.Block{b}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := c.ConsensusStats(4, 100)
 	if err != nil {
 		t.Fatal(err)
+	} else if stats.Tip != cm.Tip() {
+		t.Fatalf("expected tip %v, got %v", cm.Tip(), stats.Tip)
+	} else if len(stats.Windows) != 2 {
+		t.Fatalf("expected 2 windows, got %v", len(stats.Windows))
 	}
 
-	s := syncer.New(l, cm, ps, gateway.Header{
-		GenesisID:  genesisBlock.ID(),
-		UniqueID:   gateway.GenerateUniqueID(),
-		NetAddress: l.Addr().String(),
-	})
-	defer s.Close()
-	go s.Run(context.Background())
+	// the second window is clamped to the blocks after genesis
+	for i, expected := range []uint64{4, 10} {
+		w := stats.Windows[i]
+		if w.Blocks != expected || w.EndHeight != 10 || w.StartHeight != 11-expected {
+			t.Fatalf("unexpected window %+v", w)
+		} else if w.AvgDifficulty.Cmp(types.Work{}) <= 0 {
+			t.Fatal("expected non-zero average difficulty")
+		}
+	}
+
+	if _, err := c.ConsensusStats(0); err == nil {
+		t.Fatal("expected error for empty window")
+	}
+}
+
+func TestBinaryFormat(t *testing.T) {
+	log := zaptest.NewLogger(t)
+
+	n, genesisBlock := testNetwork()
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
 
 	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
 	if err != nil {
@@ -1328,30 +1395,84 @@ func TestDebugMine(t *testing.T) {
 	}
 	defer wm.Close()
 
-	c := runServer(t, cm, s, wm)
+	c := runServer(t, cm, nil, wm)
 
-	jc := jape.Client{
-		BaseURL:  c.BaseURL(),
-		Password: "password",
+	b, ok := coreutils.MineBlock(cm, types.VoidAddress, time.Second)
+	if !ok {
+		t.Fatal("failed to mine block")
+	} else if err := cm.AddBlocks([]types.Block{b}); err != nil {
+		t.Fatal(err)
 	}
 
-	err = jc.POST("/debug/mine", api.DebugMineRequest{
-		Blocks:  5,
-		Address: types.VoidAddress,
-	}, nil)
+	if jb, err := c.ConsensusBlock(b.ID()); err != nil {
+		t.Fatal(err)
+	} else if jb.ID() != b.ID() {
+		t.Fatalf("expected block %v, got %v", b.ID(), jb.ID())
+	}
+
+	buf, err := c.ConsensusBlockRaw(b.ID())
 	if err != nil {
 		t.Fatal(err)
 	}
+	var decoded types.Block
+	d := types.NewBufDecoder(buf)
+	(*types.V2Block)(&decoded).DecodeFrom(d)
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	} else if decoded.ID() != b.ID() {
+		t.Fatalf("expected block %v, got %v", b.ID(), decoded.ID())
+	}
 
-	if cm.Tip().Height != 5 {
-		t.Fatalf("expected tip height to be 5, got %v", cm.Tip().Height)
+	jc := jape.Client{BaseURL: c.BaseURL(), Password: "password"}
+	if err := jc.GET(fmt.Sprintf("/consensus/blocks/%v?format=xml", b.ID()), nil); err == nil {
+		t.Fatal("expected error for unknown format")
+	} else if _, err := c.ConsensusBlockRaw(types.BlockID{1}); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
+
+	// a binary client should see the same data as a JSON client
+	bc := api.NewClient(c.BaseURL(), "password", api.WithBinaryEncoding())
+	_, applied, err := c.ConsensusUpdates(types.ChainIndex{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, binApplied, err := bc.ConsensusUpdates(types.ChainIndex{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(binApplied) != len(applied) {
+		t.Fatalf("expected %d updates, got %d", len(applied), len(binApplied))
+	}
+	for i := range applied {
+		if binApplied[i].Block.ID() != applied[i].Block.ID() {
+			t.Fatalf("expected block %v, got %v", applied[i].Block.ID(), binApplied[i].Block.ID())
+		} else if binApplied[i].State.Index != applied[i].State.Index {
+			t.Fatalf("expected state %v, got %v", applied[i].State.Index, binApplied[i].State.Index)
+		} else if binApplied[i].State.Network == nil {
+			t.Fatal("expected network to be set")
+		}
+	}
+
+	scos, err := c.AddressSiacoinOutputs(types.VoidAddress, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binScos, err := bc.AddressSiacoinOutputs(types.VoidAddress, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(binScos) != len(scos) {
+		t.Fatalf("expected %d outputs, got %d", len(scos), len(binScos))
+	}
+	for i := range scos {
+		if binScos[i].ID != scos[i].ID {
+			t.Fatalf("expected output %v, got %v", scos[i].ID, binScos[i].ID)
+		}
 	}
 }
 
-func TestAPISecurity(t *testing.T) {
-	n, genesisBlock := testutil.Network()
+func TestFieldSelection(t *testing.T) {
 	log := zaptest.NewLogger(t)
 
+	n, genesisBlock := testNetwork()
 	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
 	if err != nil {
 		t.Fatal(err)
@@ -1364,128 +1485,663 @@ func TestAPISecurity(t *testing.T) {
 	}
 	defer ws.Close()
 
-	syncerListener, err := net.Listen("tcp", ":0")
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer syncerListener.Close()
+	defer wm.Close()
 
-	ps, err := sqlite.NewPeerStore(ws)
+	c := runServer(t, cm, nil, wm)
+	jc := jape.Client{BaseURL: c.BaseURL(), Password: "password"}
+
+	b, ok := coreutils.MineBlock(cm, types.VoidAddress, time.Second)
+	if !ok {
+		t.Fatal("failed to mine block")
+	} else if err := cm.AddBlocks([]types.Block{b}); err != nil {
+		t.Fatal(err)
+	}
+
+	indexBuf, err := (types.ChainIndex{}).MarshalText()
 	if err != nil {
 		t.Fatal(err)
 	}
+	var resp map[string][]map[string]map[string]json.RawMessage
+	if err := jc.GET(fmt.Sprintf("/consensus/updates/%s?fields=applied.state.index", indexBuf), &resp); err != nil {
+		t.Fatal(err)
+	} else if len(resp) != 1 || len(resp["applied"]) != 2 {
+		t.Fatalf("expected only two applied updates, got %v", resp)
+	}
+	for _, u := range resp["applied"] {
+		if len(u) != 1 || len(u["state"]) != 1 {
+			t.Fatalf("expected only the state index, got %v", u)
+		}
+		var index types.ChainIndex
+		if err := json.Unmarshal(u["state"]["index"], &index); err != nil {
+			t.Fatal(err)
+		}
+	}
 
-	s := syncer.New(syncerListener, cm, ps, gateway.Header{
-		GenesisID:  genesisBlock.ID(),
-		UniqueID:   gateway.GenerateUniqueID(),
-		NetAddress: syncerListener.Addr().String(),
-	})
-	defer s.Close()
-	go s.Run(context.Background())
+	if err := jc.GET(fmt.Sprintf("/consensus/updates/%s?fields=state..index", indexBuf), nil); err == nil {
+		t.Fatal("expected error for invalid field")
+	}
+}
 
-	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
+func TestCurrencyFormat(t *testing.T) {
+	tip := consensus.State{Index: types.ChainIndex{Height: 10, ID: types.BlockID{10}}}
+	cm := apitest.NewChainManager(tip)
+	cm.SetRecommendedFee(types.Siacoins(3).Div64(2))
+	s := apitest.NewSyncer("127.0.0.1:9981")
+
+	get := func(srv *httptest.Server, path, format string) string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("", "password")
+		if format != "" {
+			req.Header.Set(api.CurrencyFormatHeader, format)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		} else if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status %v: %s", resp.Status, body)
+		}
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(v)
+	}
+
+	srv := httptest.NewServer(api.NewServer(cm, s, nil, api.WithBasicAuth("password")))
+	defer srv.Close()
+	hastings := types.Siacoins(3).Div64(2).ExactString()
+	if fee := get(srv, "/txpool/fee", ""); fee != hastings {
+		t.Fatalf("expected %q, got %q", hastings, fee)
+	} else if fee := get(srv, "/txpool/fee", "sc"); fee != "1.5 SC" {
+		t.Fatalf(`expected "1.5 SC", got %q`, fee)
+	}
+
+	// the header overrides the server's default
+	scSrv := httptest.NewServer(api.NewServer(cm, s, nil, api.WithBasicAuth("password"), api.WithCurrencyFormat(api.CurrencyFormatSC)))
+	defer scSrv.Close()
+	if fee := get(scSrv, "/txpool/fee", ""); fee != "1.5 SC" {
+		t.Fatalf(`expected "1.5 SC", got %q`, fee)
+	} else if fee := get(scSrv, "/txpool/fee", "hastings"); fee != hastings {
+		t.Fatalf("expected %q, got %q", hastings, fee)
+	}
+
+	// request bodies accept both formats
+	body := `{"transactions": [{"siacoinOutputs": [{"address": "%s", "value": "2.25 SC"}, {"address": "%[1]s", "value": "%s"}], "minerFees": ["1 mS"]}]}`
+	addrBuf, err := types.VoidAddress.MarshalText()
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer wm.Close()
+	req, err := http.NewRequest(http.MethodPost, scSrv.URL+"/txpool/broadcast", strings.NewReader(fmt.Sprintf(body, addrBuf, hastings)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("", "password")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		b, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status %v: %s", resp.Status, b)
+	}
+	txns := cm.PoolTransactions()
+	if len(txns) != 1 {
+		t.Fatalf("expected 1 pool transaction, got %d", len(txns))
+	} else if sco := txns[0].SiacoinOutputs; len(sco) != 2 || !sco[0].Value.Equals(types.Siacoins(9).Div64(4)) || !sco[1].Value.Equals(types.Siacoins(3).Div64(2)) {
+		t.Fatalf("unexpected outputs %v", sco)
+	} else if fees := txns[0].MinerFees; len(fees) != 1 || !fees[0].Equals(types.Siacoins(1).Div64(1000)) {
+		t.Fatalf("unexpected miner fees %v", fees)
+	}
 
-	httpListener, err := net.Listen("tcp", ":0")
+	// request bodies are limited in size
+	req, err = http.NewRequest(http.MethodPost, srv.URL+"/txpool/broadcast", strings.NewReader(strings.Repeat(" ", 32<<20+1)))
 	if err != nil {
-		t.Fatal("failed to listen:", err)
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("", "password")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %v", resp.Status)
 	}
-	t.Cleanup(func() { httpListener.Close() })
 
-	server := &http.Server{
-		Handler:      api.NewServer(cm, s, wm, api.WithDebug(), api.WithLogger(zaptest.NewLogger(t)), api.WithBasicAuth("test")),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+	if _, err := api.ParseCurrencyFormat("bitcoin"); err == nil {
+		t.Fatal("expected an error for an unknown format")
 	}
-	t.Cleanup(func() { server.Close() })
+}
 
-	go server.Serve(httpListener)
+func TestPasswordHash(t *testing.T) {
+	hash := password.Hash("password")
+	cm := apitest.NewChainManager(consensus.State{})
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), nil, api.WithBasicAuth(hash)))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+	wrong := api.NewClient(srv.URL, "wrong")
 
-	// create a client with correct credentials
-	c := api.NewClient("http://"+httpListener.Addr().String(), "test")
-	if _, err := c.ConsensusTip(); err != nil {
+	// a failed derivation does not reject the correct password
+	if _, err := wrong.ConsensusTip(); err == nil {
+		t.Fatal("expected auth error")
+	} else if _, err := c.ConsensusTip(); err != nil {
 		t.Fatal(err)
 	}
 
-	// create a client with incorrect credentials
-	c = api.NewClient("http://"+httpListener.Addr().String(), "wrong")
-	if _, err := c.ConsensusTip(); err == nil {
+	// once verified, the password is checked against the cached digest
+	if _, err := wrong.ConsensusTip(); err == nil {
 		t.Fatal("expected auth error")
-	} else if err.Error() == "unauthorized" {
-		t.Fatal("expected auth error, got", err)
+	} else if _, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
 	}
+}
 
-	// replace the handler with a new one that doesn't require auth
-	server.Handler = api.NewServer(cm, s, wm, api.WithDebug(), api.WithLogger(zaptest.NewLogger(t)))
+func TestEnumerations(t *testing.T) {
+	cm := apitest.NewChainManager(consensus.State{})
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), nil, api.WithBasicAuth("password")))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
 
-	// create a client without credentials
-	c = api.NewClient("http://"+httpListener.Addr().String(), "")
-	if _, err := c.ConsensusTip(); err != nil {
+	resp, err := c.Enumerations("fr-CA")
+	if err != nil {
 		t.Fatal(err)
+	} else if resp.Locale != "fr" {
+		t.Fatalf("expected locale fr, got %q", resp.Locale)
+	} else if len(resp.Enumerations) == 0 || resp.Enumerations[0].Name != "eventType" {
+		t.Fatalf("unexpected enumerations %v", resp.Enumerations)
+	} else if l := resp.Enumerations[0].Values[0]; l.Value != wallet.EventTypeMinerPayout || l.Label != "Récompense de minage" {
+		t.Fatalf("unexpected label %v", l)
 	}
 
-	// create a client with incorrect credentials
-	c = api.NewClient("http://"+httpListener.Addr().String(), "test")
-	if _, err := c.ConsensusTip(); err != nil {
+	// the locale is negotiated from Accept-Language
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/enums", nil)
+	if err != nil {
 		t.Fatal(err)
 	}
+	req.SetBasicAuth("", "password")
+	req.Header.Set("Accept-Language", "xx, ja;q=0.5, de;q=0.8")
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer httpResp.Body.Close()
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Locale != "de" || httpResp.Header.Get("Content-Language") != "de" {
+		t.Fatalf("expected locale de, got %q", resp.Locale)
+	}
+}
 
-	// replace the handler with one that requires auth and has public endpoints
-	server.Handler = api.NewServer(cm, s, wm, api.WithDebug(), api.WithLogger(zaptest.NewLogger(t)), api.WithBasicAuth("test"), api.WithPublicEndpoints(true))
+// graphqlWalletManager implements the wallet methods used by the GraphQL
+// schema. Calling any other method panics.
+type graphqlWalletManager struct {
+	api.WalletManager
+	w     wallet.Wallet
+	addrs []wallet.Address
+}
 
-	// create a client without credentials
-	c = api.NewClient("http://"+httpListener.Addr().String(), "")
+func (wm *graphqlWalletManager) Wallets() ([]wallet.Wallet, error) {
+	return []wallet.Wallet{wm.w}, nil
+}
 
-	// check that a public endpoint is accessible
-	if _, err := c.ConsensusTip(); err != nil {
-		t.Fatal(err)
+func (wm *graphqlWalletManager) WalletBalance(wallet.ID) (wallet.Balance, error) {
+	return wallet.Balance{Siacoins: types.Siacoins(3).Div64(2), Siafunds: 7}, nil
+}
+
+func (wm *graphqlWalletManager) Addresses(wallet.ID) ([]wallet.Address, error) {
+	return wm.addrs, nil
+}
+
+func (wm *graphqlWalletManager) AddressBalance(types.Address) (wallet.Balance, error) {
+	return wallet.Balance{Siacoins: types.Siacoins(1)}, nil
+}
+
+func TestGraphQL(t *testing.T) {
+	cm := apitest.NewChainManager(consensus.State{})
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	wm := &graphqlWalletManager{
+		w:     wallet.Wallet{ID: 1, Name: "primary"},
+		addrs: []wallet.Address{{Address: addr, Description: "deposit"}},
 	}
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password"), api.WithGraphQL()))
+	defer srv.Close()
 
-	// check that a private endpoint is still protected
-	if _, err := c.Wallets(); err == nil {
-		t.Fatal("expected auth error")
-	} else if err.Error() == "unauthorized" {
-		t.Fatal("expected auth error, got", err)
+	query := func(format, q string, variables map[string]any) (int, string) {
+		t.Helper()
+		buf, _ := json.Marshal(map[string]any{"query": q, "variables": variables})
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/graphql", bytes.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("", "password")
+		if format != "" {
+			req.Header.Set("Currency-Format", format)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
 	}
 
-	// create a client with credentials
-	c = api.NewClient("http://"+httpListener.Addr().String(), "test")
+	status, body := query("", `query ($id: ID!) { wallet(id: $id) { name balance { siacoins siafunds } addresses { address description balance { siacoins } } } missing: wallet(id: 2) { name } }`, map[string]any{"id": 1})
+	expected := fmt.Sprintf(`{"data":{"wallet":{"name":"primary","balance":{"siacoins":%q,"siafunds":7},"addresses":[{"address":%q,"description":"deposit","balance":{"siacoins":%q}}]},"missing":null}}`,
+		types.Siacoins(3).Div64(2).ExactString(), addr, types.Siacoins(1).ExactString())
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", status, body)
+	} else if body != expected {
+		t.Fatalf("expected %s, got %s", expected, body)
+	}
 
-	// check that both public and private endpoints are accessible
-	if _, err := c.Wallets(); err != nil {
+	// currencies follow the requested format, even when aliased
+	status, body = query("sc", `{ wallet(id: "1") { balance { total: siacoins } } }`, nil)
+	if status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", status, body)
+	} else if body != `{"data":{"wallet":{"balance":{"total":"1.5 SC"}}}}` {
+		t.Fatalf("unexpected response %s", body)
+	}
+
+	// invalid queries are rejected without data
+	status, body = query("", `{ wallet(id: 1) { secret } }`, nil)
+	if status != http.StatusBadRequest || !strings.Contains(body, `unknown field \"secret\" on type \"Wallet\"`) {
+		t.Fatalf("expected validation error, got %d: %s", status, body)
+	}
+
+	// the endpoint is disabled by default
+	disabled := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password")))
+	defer disabled.Close()
+	req, err := http.NewRequest(http.MethodPost, disabled.URL+"/graphql", strings.NewReader(`{"query":"{ wallets { id } }"}`))
+	if err != nil {
 		t.Fatal(err)
-	} else if _, err := c.ConsensusTip(); err != nil {
+	}
+	req.SetBasicAuth("", "password")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
 		t.Fatal(err)
 	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", resp.StatusCode)
+	}
 }
 
-func TestAPINoContent(t *testing.T) {
+func TestBatch(t *testing.T) {
 	log := zaptest.NewLogger(t)
-	n, genesisBlock := testNetwork()
 
-	// create wallets
+	n, genesisBlock := testNetwork()
 	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
 	if err != nil {
 		t.Fatal(err)
 	}
 	cm := chain.NewManager(dbstore, tipState)
 
-	l, err := net.Listen("tcp", ":0")
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer l.Close()
+	defer ws.Close()
 
-	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer ws.Close()
+	defer wm.Close()
 
-	ps, err := sqlite.NewPeerStore(ws)
+	c := runServer(t, cm, nil, wm)
+
+	body, err := json.Marshal(api.WalletUpdateRequest{Name: "batch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Batch([]api.BatchRequest{
+		{Method: "POST", Path: "/wallets", Body: body},
+		{Method: "GET", Path: "/wallets"},
+		{Method: "GET", Path: "/consensus/tip"},
+		{Method: "GET", Path: "/nonexistent"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if !res.Consistent || res.Tip != cm.Tip() {
+		t.Fatalf("expected consistent result at %v, got %+v", cm.Tip(), res)
+	} else if len(res.Responses) != 4 {
+		t.Fatalf("expected 4 responses, got %d", len(res.Responses))
+	}
+
+	var w wallet.Wallet
+	if res.Responses[0].Status != http.StatusOK {
+		t.Fatalf("expected status 200, got %+v", res.Responses[0])
+	} else if err := json.Unmarshal(res.Responses[0].Body, &w); err != nil {
+		t.Fatal(err)
+	} else if w.Name != "batch" {
+		t.Fatalf("expected wallet name %q, got %q", "batch", w.Name)
+	}
+
+	// later sub-requests see the effects of earlier ones
+	var wallets []wallet.Wallet
+	if err := json.Unmarshal(res.Responses[1].Body, &wallets); err != nil {
+		t.Fatal(err)
+	} else if len(wallets) != 1 || wallets[0].ID != w.ID {
+		t.Fatalf("expected wallet %v, got %v", w.ID, wallets)
+	}
+
+	var tip types.ChainIndex
+	if err := json.Unmarshal(res.Responses[2].Body, &tip); err != nil {
+		t.Fatal(err)
+	} else if tip != res.Tip {
+		t.Fatalf("expected tip %v, got %v", res.Tip, tip)
+	}
+
+	if res.Responses[3].Status != http.StatusNotFound || res.Responses[3].Error == "" {
+		t.Fatalf("expected not found error, got %+v", res.Responses[3])
+	}
+
+	// sub-requests are served by the same middleware as the batch
+	res, err = c.Batch([]api.BatchRequest{{Method: "GET", Path: "/v2/nonexistent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr api.ErrorResponse
+	if err := json.Unmarshal([]byte(res.Responses[0].Error), &apiErr); err != nil {
+		t.Fatalf("expected structured error, got %q", res.Responses[0].Error)
+	} else if apiErr.Error.Status != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %+v", apiErr)
+	}
+
+	if _, err := c.Batch([]api.BatchRequest{{Method: "POST", Path: "/batch"}}); err == nil {
+		t.Fatal("expected error for nested batch")
+	} else if _, err := c.Batch([]api.BatchRequest{{Method: "POST", Path: "/v2/batch"}}); err == nil {
+		t.Fatal("expected error for nested batch")
+	} else if _, err := c.Batch(nil); err == nil {
+		t.Fatal("expected error for empty batch")
+	}
+
+	// sub-requests do not bypass authentication of the batch
+	unauth := api.NewClient(c.BaseURL(), "wrong")
+	if _, err := unauth.Batch([]api.BatchRequest{{Method: "GET", Path: "/wallets"}}); err == nil {
+		t.Fatal("expected unauthorized error")
+	}
+}
+
+func TestClientReplicas(t *testing.T) {
+	// serveTip returns a server that reports a tip at the given height and
+	// records the number of writes it receives.
+	serveTip := func(height uint64, writes *atomic.Int64) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodGet && r.URL.Path == "/consensus/tip":
+				json.NewEncoder(w).Encode(types.ChainIndex{Height: height})
+			case r.Method == http.MethodPost && r.URL.Path == "/syncer/connect":
+				writes.Add(1)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	// a closed server refuses connections
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var primaryWrites, replicaWrites atomic.Int64
+	primary := serveTip(1, &primaryWrites)
+	replica := serveTip(2, &replicaWrites)
+
+	c := api.NewClient(primary.URL, "password", api.WithReplicas(down.URL, replica.URL))
+	defer c.Close()
+	for i := 0; i < 4; i++ {
+		if tip, err := c.ConsensusTip(); err != nil {
+			t.Fatal(err)
+		} else if tip.Height != 2 {
+			t.Fatalf("expected read from replica, got height %v", tip.Height)
+		}
+	}
+	if err := c.SyncerConnect("foo"); err != nil {
+		t.Fatal(err)
+	} else if primaryWrites.Load() != 1 || replicaWrites.Load() != 0 {
+		t.Fatal("expected write to be sent to primary")
+	}
+
+	// reads fall back to the primary when every replica is down
+	c = api.NewClient(primary.URL, "password", api.WithReplicas(down.URL))
+	if tip, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	} else if tip.Height != 1 {
+		t.Fatalf("expected read from primary, got height %v", tip.Height)
+	}
+
+	// writes only fail over in sticky mode
+	c = api.NewClient(down.URL, "password", api.WithReplicas(replica.URL))
+	if err := c.SyncerConnect("foo"); err == nil {
+		t.Fatal("expected write to unreachable primary to fail")
+	}
+	c = api.NewClient(down.URL, "password", api.WithReplicas(replica.URL), api.WithStickyWrites())
+	for i := 0; i < 2; i++ {
+		if err := c.SyncerConnect("foo"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if replicaWrites.Load() != 2 {
+		t.Fatalf("expected 2 writes to replica, got %v", replicaWrites.Load())
+	}
+}
+
+func TestDebugMine(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	// create wallets
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ps, err := sqlite.NewPeerStore(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := syncer.New(l, cm, ps, gateway.Header{
+		GenesisID:  genesisBlock.ID(),
+		UniqueID:   gateway.GenerateUniqueID(),
+		NetAddress: l.Addr().String(),
+	})
+	defer s.Close()
+	go s.Run(context.Background())
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	c := runServer(t, cm, s, wm)
+
+	jc := jape.Client{
+		BaseURL:  c.BaseURL(),
+		Password: "password",
+	}
+
+	err = jc.POST("/debug/mine", api.DebugMineRequest{
+		Blocks:  5,
+		Address: types.VoidAddress,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cm.Tip().Height != 5 {
+		t.Fatalf("expected tip height to be 5, got %v", cm.Tip().Height)
+	}
+}
+
+func TestAPISecurity(t *testing.T) {
+	n, genesisBlock := testutil.Network()
+	log := zaptest.NewLogger(t)
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	syncerListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syncerListener.Close()
+
+	ps, err := sqlite.NewPeerStore(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := syncer.New(syncerListener, cm, ps, gateway.Header{
+		GenesisID:  genesisBlock.ID(),
+		UniqueID:   gateway.GenerateUniqueID(),
+		NetAddress: syncerListener.Addr().String(),
+	})
+	defer s.Close()
+	go s.Run(context.Background())
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	httpListener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	t.Cleanup(func() { httpListener.Close() })
+
+	server := &http.Server{
+		Handler:      api.NewServer(cm, s, wm, api.WithDebug(), api.WithLogger(zaptest.NewLogger(t)), api.WithBasicAuth("test")),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	t.Cleanup(func() { server.Close() })
+
+	go server.Serve(httpListener)
+
+	// create a client with correct credentials
+	c := api.NewClient("http://"+httpListener.Addr().String(), "test")
+	if _, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	}
+
+	// create a client with incorrect credentials
+	c = api.NewClient("http://"+httpListener.Addr().String(), "wrong")
+	if _, err := c.ConsensusTip(); err == nil {
+		t.Fatal("expected auth error")
+	} else if err.Error() == "unauthorized" {
+		t.Fatal("expected auth error, got", err)
+	}
+
+	// replace the handler with a new one that doesn't require auth
+	server.Handler = api.NewServer(cm, s, wm, api.WithDebug(), api.WithLogger(zaptest.NewLogger(t)))
+
+	// create a client without credentials
+	c = api.NewClient("http://"+httpListener.Addr().String(), "")
+	if _, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	}
+
+	// create a client with incorrect credentials
+	c = api.NewClient("http://"+httpListener.Addr().String(), "test")
+	if _, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the handler with one that requires auth and has public endpoints
+	server.Handler = api.NewServer(cm, s, wm, api.WithDebug(), api.WithLogger(zaptest.NewLogger(t)), api.WithBasicAuth("test"), api.WithPublicEndpoints(true))
+
+	// create a client without credentials
+	c = api.NewClient("http://"+httpListener.Addr().String(), "")
+
+	// check that a public endpoint is accessible
+	if _, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	}
+
+	// check that a private endpoint is still protected
+	if _, err := c.Wallets(); err == nil {
+		t.Fatal("expected auth error")
+	} else if err.Error() == "unauthorized" {
+		t.Fatal("expected auth error, got", err)
+	}
+
+	// create a client with credentials
+	c = api.NewClient("http://"+httpListener.Addr().String(), "test")
+
+	// check that both public and private endpoints are accessible
+	if _, err := c.Wallets(); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPINoContent(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	// create wallets
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ps, err := sqlite.NewPeerStore(ws)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1528,3 +2184,1518 @@ func TestAPINoContent(t *testing.T) {
 		t.Fatalf("expected no content, got %v bytes", resp.ContentLength)
 	}
 }
+
+func TestSessions(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	server := &http.Server{
+		Handler:      api.NewServer(cm, nil, wm, api.WithLogger(log.Named("api")), api.WithBasicAuth("test")),
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+	}
+	defer server.Close()
+	go server.Serve(l)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	baseURL := "http://" + l.Addr().String()
+
+	post := func(path string, body any) *http.Response {
+		t.Helper()
+		buf, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Post(baseURL+path, "application/json", bytes.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	checkWallets := func(expectedStatus int) {
+		t.Helper()
+		resp, err := client.Get(baseURL + "/wallets")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("expected status %d, got %d", expectedStatus, resp.StatusCode)
+		}
+	}
+
+	// no session
+	checkWallets(http.StatusUnauthorized)
+	if resp := post("/auth/refresh", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected refresh without a session to fail, got %d", resp.StatusCode)
+	}
+
+	// wrong password
+	if resp := post("/auth/login", api.LoginRequest{Password: "wrong"}); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected login with wrong password to fail, got %d", resp.StatusCode)
+	}
+	checkWallets(http.StatusUnauthorized)
+
+	// correct password
+	resp := post("/auth/login", api.LoginRequest{Password: "test"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected login to succeed, got %d", resp.StatusCode)
+	}
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "walletd_session" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected session cookie")
+	} else if !cookie.HttpOnly {
+		t.Fatal("expected session cookie to be httpOnly")
+	}
+	checkWallets(http.StatusOK)
+
+	// refreshing should revoke the old token
+	if resp := post("/auth/refresh", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected refresh to succeed, got %d", resp.StatusCode)
+	}
+	checkWallets(http.StatusOK)
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/wallets", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(cookie)
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected old session token to be revoked, got %d", resp.StatusCode)
+	}
+
+	// logout
+	if resp := post("/auth/logout", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected logout to succeed, got %d", resp.StatusCode)
+	}
+	checkWallets(http.StatusUnauthorized)
+}
+
+func TestProfiles(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	checkStatus := func(h http.Handler, method, path string, expectedStatus int) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != expectedStatus {
+			t.Fatalf("%s %s: expected status %d, got %d", method, path, expectedStatus, rec.Code)
+		}
+	}
+
+	explorer := api.NewServer(cm, nil, wm, api.WithBasicAuth("test"), api.WithProfile(api.ProfilePublicExplorer))
+	checkStatus(explorer, http.MethodGet, "/consensus/tip", http.StatusOK)
+	checkStatus(explorer, http.MethodGet, "/wallets", http.StatusNotFound)
+	checkStatus(explorer, http.MethodPost, "/syncer/connect", http.StatusNotFound)
+
+	signer := api.NewServer(cm, nil, wm, api.WithBasicAuth("test"), api.WithProfile(api.ProfileSignerOnly))
+	checkStatus(signer, http.MethodGet, "/consensus/tip", http.StatusUnauthorized)
+	checkStatus(signer, http.MethodGet, "/wallets", http.StatusUnauthorized)
+	checkStatus(signer, http.MethodPost, "/wallets", http.StatusMethodNotAllowed)
+	checkStatus(signer, http.MethodGet, "/addresses/"+types.VoidAddress.String()+"/balance", http.StatusNotFound)
+
+	admin := api.NewServer(cm, nil, wm, api.WithBasicAuth("test"))
+	checkStatus(admin, http.MethodGet, "/wallets", http.StatusUnauthorized)
+
+	if _, err := api.ParseProfile("foo"); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+}
+
+func TestRequestSigning(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	secret := []byte("foo bar baz")
+	keys := map[string]string{"backend": string(secret)}
+	rc := api.NewReplayCache()
+	h := api.NewServer(cm, nil, wm, api.WithSigningKeys(keys), api.WithReplayCache(rc))
+	// a second server sharing the cache, such as the public API
+	public := api.NewServer(cm, nil, wm, api.WithSigningKeys(keys), api.WithReplayCache(rc))
+
+	do := func(req *http.Request) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// unsigned requests should be rejected
+	if code := do(httptest.NewRequest(http.MethodGet, "/wallets", nil)); code != http.StatusUnauthorized {
+		t.Fatalf("expected unsigned request to be rejected, got %d", code)
+	}
+
+	// signed requests should be accepted exactly once
+	req := httptest.NewRequest(http.MethodPost, "/wallets", strings.NewReader(`{"name":"test"}`))
+	if err := api.SignRequest(req, "backend", secret); err != nil {
+		t.Fatal(err)
+	}
+	replay := req.Clone(context.Background())
+	replay.Body = io.NopCloser(strings.NewReader(`{"name":"test"}`))
+	if code := do(req); code != http.StatusOK {
+		t.Fatalf("expected signed request to succeed, got %d", code)
+	} else if code := do(replay); code != http.StatusUnauthorized {
+		t.Fatalf("expected replayed request to be rejected, got %d", code)
+	}
+
+	// signed requests cannot be replayed against a server sharing the cache
+	replay = req.Clone(context.Background())
+	replay.Body = io.NopCloser(strings.NewReader(`{"name":"test"}`))
+	rec := httptest.NewRecorder()
+	public.ServeHTTP(rec, replay)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected request replayed against the public API to be rejected, got %d", rec.Code)
+	}
+
+	// signatures cover the body as sent, before currency values with a
+	// unit are converted, and untyped metadata is not converted
+	const unitBody = `{"name":"units","metadata":{"value":"1 SC"}}`
+	req = httptest.NewRequest(http.MethodPost, "/wallets", strings.NewReader(unitBody))
+	if err := api.SignRequest(req, "backend", secret); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var w wallet.Wallet
+	var metadata map[string]string
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected signed request with units to succeed, got %d: %s", rec.Code, rec.Body)
+	} else if err := json.Unmarshal(rec.Body.Bytes(), &w); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(w.Metadata, &metadata); err != nil {
+		t.Fatal(err)
+	} else if metadata["value"] != "1 SC" {
+		t.Fatalf("expected metadata to be unchanged, got %s", w.Metadata)
+	}
+
+	// tampering with the body should invalidate the signature
+	req = httptest.NewRequest(http.MethodPost, "/wallets", strings.NewReader(`{"name":"test"}`))
+	if err := api.SignRequest(req, "backend", secret); err != nil {
+		t.Fatal(err)
+	}
+	req.Body = io.NopCloser(strings.NewReader(`{"name":"evil"}`))
+	if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("expected tampered request to be rejected, got %d", code)
+	}
+
+	// unknown keys and wrong secrets should be rejected
+	req = httptest.NewRequest(http.MethodGet, "/wallets", nil)
+	if err := api.SignRequest(req, "other", secret); err != nil {
+		t.Fatal(err)
+	} else if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown key to be rejected, got %d", code)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/wallets", nil)
+	if err := api.SignRequest(req, "backend", []byte("wrong")); err != nil {
+		t.Fatal(err)
+	} else if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("expected wrong secret to be rejected, got %d", code)
+	}
+
+	// stale timestamps should be rejected
+	req = httptest.NewRequest(http.MethodGet, "/wallets", nil)
+	if err := api.SignRequest(req, "backend", secret); err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(api.HeaderSigningTimestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+	if code := do(req); code != http.StatusUnauthorized {
+		t.Fatalf("expected stale request to be rejected, got %d", code)
+	}
+
+	// oversized bodies should be rejected rather than truncated
+	req = httptest.NewRequest(http.MethodPost, "/wallets", strings.NewReader(strings.Repeat(" ", 32<<20+1)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if err := api.SignRequest(req, "backend", secret); err != nil {
+		t.Fatal(err)
+	} else if code := do(req); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected oversized request to be rejected with 413, got %d", code)
+	}
+}
+
+type tenantsEscrowManager struct {
+	api.EscrowManager
+	funded []wallet.ID
+}
+
+func (em *tenantsEscrowManager) Fund(id wallet.ID, escrowID int64, fundingWallet wallet.ID, changeAddr types.Address) (escrow.Funding, error) {
+	em.funded = append(em.funded, fundingWallet)
+	return escrow.Funding{}, nil
+}
+
+func TestTenants(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	secrets := map[string]string{"alice": "foo", "bob": "bar", "admin": "baz"}
+	em := new(tenantsEscrowManager)
+	h := api.NewServer(cm, nil, wm,
+		api.WithSigningKeys(secrets),
+		api.WithTenants(map[string][]string{"alice": {"alice"}, "bob": {"bob"}}),
+		api.WithEscrowManager(em))
+
+	do := func(key, method, path, body string, resp any) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if err := api.SignRequest(req, key, []byte(secrets[key])); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if resp != nil && rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code
+	}
+
+	var aliceWallet, bobWallet wallet.Wallet
+	if code := do("alice", http.MethodPost, "/wallets", `{"name":"alice"}`, &aliceWallet); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if aliceWallet.Tenant != "alice" {
+		t.Fatalf("expected wallet to be owned by alice, got %q", aliceWallet.Tenant)
+	} else if code := do("bob", http.MethodPost, "/wallets", `{"name":"bob"}`, &bobWallet); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// tenants only see their own wallets
+	var wallets []wallet.Wallet
+	if code := do("alice", http.MethodGet, "/wallets", "", &wallets); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if len(wallets) != 1 || wallets[0].ID != aliceWallet.ID {
+		t.Fatalf("expected only alice's wallet, got %v", wallets)
+	}
+	if code := do("alice", http.MethodGet, fmt.Sprintf("/wallets/%d/balance", bobWallet.ID), "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another tenant's wallet, got %d", code)
+	} else if code := do("alice", http.MethodGet, fmt.Sprintf("/wallets/%d/balance", aliceWallet.ID), "", nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// escrows can only be funded from the tenant's own wallets
+	if code := do("alice", http.MethodPost, fmt.Sprintf("/wallets/%d/escrows/1/fund", aliceWallet.ID), fmt.Sprintf(`{"wallet":"%d"}`, bobWallet.ID), nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 funding from another tenant's wallet, got %d", code)
+	} else if len(em.funded) != 0 {
+		t.Fatalf("expected escrow not to be funded, got %v", em.funded)
+	} else if code := do("alice", http.MethodPost, fmt.Sprintf("/wallets/%d/escrows/1/fund", aliceWallet.ID), fmt.Sprintf(`{"wallet":"%d"}`, aliceWallet.ID), nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if len(em.funded) != 1 || em.funded[0] != aliceWallet.ID {
+		t.Fatalf("expected escrow to be funded from alice's wallet, got %v", em.funded)
+	}
+
+	// addresses are only visible if they belong to the tenant's wallets
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	var added wallet.AddAddressResult
+	if code := do("bob", http.MethodPut, fmt.Sprintf("/wallets/%d/addresses", bobWallet.ID), fmt.Sprintf(`{"address":%q}`, addr), &added); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if added.Status != wallet.AddressAdded {
+		t.Fatalf("expected address to be added, got %q", added.Status)
+	} else if code := do("alice", http.MethodGet, fmt.Sprintf("/addresses/%v/balance", addr), "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another tenant's address, got %d", code)
+	} else if code := do("bob", http.MethodGet, fmt.Sprintf("/addresses/%v/balance", addr), "", nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// conflicts with other tenants' wallets are not revealed
+	var result wallet.AddAddressResult
+	if code := do("alice", http.MethodPut, fmt.Sprintf("/wallets/%d/addresses", aliceWallet.ID), fmt.Sprintf(`{"address":%q}`, addr), &result); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if result.Status != wallet.AddressAdded || len(result.WalletIDs) != 0 {
+		t.Fatalf("expected bob's wallet to be hidden, got %+v", result)
+	}
+
+	// conflicts with the tenant's own wallets are reported
+	var aliceWallet2 wallet.Wallet
+	if code := do("alice", http.MethodPost, "/wallets", `{"name":"alice 2"}`, &aliceWallet2); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if code := do("alice", http.MethodPut, fmt.Sprintf("/wallets/%d/addresses", aliceWallet2.ID), fmt.Sprintf(`{"address":%q}`, addr), &result); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if result.Status != wallet.AddressConflict || len(result.WalletIDs) != 1 || result.WalletIDs[0] != aliceWallet.ID {
+		t.Fatalf("expected conflict with wallet %v, got %+v", aliceWallet.ID, result)
+	}
+
+	// node management routes are unavailable to tenants
+	if code := do("alice", http.MethodGet, "/rescan", "", nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	}
+
+	// unrestricted keys see every wallet
+	if code := do("admin", http.MethodGet, "/wallets", "", &wallets); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if len(wallets) != 3 {
+		t.Fatalf("expected 3 wallets, got %d", len(wallets))
+	}
+}
+
+type allowlistTreasuryManager struct {
+	api.TreasuryManager
+	added, removed []types.Address
+}
+
+func (tm *allowlistTreasuryManager) AddAllowlistEntry(_ wallet.ID, addr types.Address, description string) (treasury.AllowlistEntry, error) {
+	tm.added = append(tm.added, addr)
+	return treasury.AllowlistEntry{Address: addr, Description: description}, nil
+}
+
+func (tm *allowlistTreasuryManager) RemoveAllowlistEntry(_ wallet.ID, addr types.Address) error {
+	tm.removed = append(tm.removed, addr)
+	return nil
+}
+
+func TestAllowlistAdmin(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	secrets := map[string]string{"bot": "foo"}
+	tm := new(allowlistTreasuryManager)
+	h := api.NewServer(cm, nil, wm,
+		api.WithBasicAuth("password"),
+		api.WithSigningKeys(secrets),
+		api.WithTreasuryManager(tm))
+
+	do := func(key, method, path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key == "" {
+			req.SetBasicAuth("", "password")
+		} else if err := api.SignRequest(req, key, []byte(secrets[key])); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	body := fmt.Sprintf(`{"address":%q}`, addr)
+	deletePath := fmt.Sprintf("/wallets/1/allowlist/%v", addr)
+
+	// signing keys cannot change the allowlist
+	if code := do("bot", http.MethodPut, "/wallets/1/allowlist", body); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	} else if code := do("bot", http.MethodDelete, deletePath, ""); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	} else if len(tm.added) != 0 || len(tm.removed) != 0 {
+		t.Fatalf("expected allowlist to be unchanged, got %v added and %v removed", tm.added, tm.removed)
+	}
+
+	// the API password can
+	if code := do("", http.MethodPut, "/wallets/1/allowlist", body); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	} else if code := do("", http.MethodDelete, deletePath, ""); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	} else if len(tm.added) != 1 || len(tm.removed) != 1 {
+		t.Fatalf("expected allowlist to be changed, got %v added and %v removed", tm.added, tm.removed)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	um, err := usage.NewManager(ws, usage.WithLogger(log.Named("usage")), usage.WithQuotas(map[string]usage.Quota{
+		"alice": {Calls: 5, Wallets: 1, Addresses: 1},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer um.Close()
+
+	secrets := map[string]string{"alice": "foo", "admin": "bar"}
+	h := api.NewServer(cm, nil, wm,
+		api.WithSigningKeys(secrets),
+		api.WithTenants(map[string][]string{"alice": {"alice"}}),
+		api.WithUsageManager(um))
+
+	do := func(key, method, path, body string, resp any) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if err := api.SignRequest(req, key, []byte(secrets[key])); err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if resp != nil && rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code
+	}
+
+	// the wallet quota is enforced
+	var w wallet.Wallet
+	if code := do("alice", http.MethodPost, "/wallets", `{"name":"alice"}`, &w); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if code := do("alice", http.MethodPost, "/wallets", `{"name":"alice2"}`, nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	}
+
+	// the address quota is enforced, but existing addresses can be updated
+	addr1 := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	addr2 := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	path := fmt.Sprintf("/wallets/%d/addresses", w.ID)
+	if code := do("alice", http.MethodPut, path, fmt.Sprintf(`{"address":%q}`, addr1), nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if code := do("alice", http.MethodPut, path, fmt.Sprintf(`{"address":%q}`, addr2), nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	} else if code := do("alice", http.MethodPut, path, fmt.Sprintf(`{"address":%q,"description":"updated"}`, addr1), nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// the daily call quota is enforced
+	if code := do("alice", http.MethodGet, "/wallets", "", nil); code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", code)
+	}
+
+	// usage is only available to unrestricted credentials
+	if code := do("alice", http.MethodGet, "/system/usage", "", nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", code)
+	}
+	var resp api.UsageResponse
+	if code := do("admin", http.MethodGet, "/system/usage", "", &resp); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if len(resp.Tenants) != 1 {
+		t.Fatalf("expected 1 tenant, got %d", len(resp.Tenants))
+	}
+	tu := resp.Tenants[0]
+	if tu.Tenant != "alice" || tu.Wallets != 1 || tu.Addresses != 1 || tu.Calls != 5 || tu.Quota.Calls != 5 {
+		t.Fatalf("unexpected tenant usage: %+v", tu)
+	}
+	calls := make(map[string]uint64)
+	for _, r := range resp.Calls {
+		calls[r.Principal] += r.Calls
+	}
+	if calls["key:alice"] != 5 || calls["key:admin"] != 1 {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+func TestGroupRoutes(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	c := runServer(t, cm, nil, wm)
+	w, err := c.AddWallet(api.WalletUpdateRequest{Name: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := c.AddGroup(api.GroupRequest{Name: "treasury"})
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := c.UpdateGroup(g.ID, api.GroupRequest{Name: "finance"}); err != nil {
+		t.Fatal(err)
+	} else if err := c.Group(g.ID).AddWallet(w.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	wallets, err := c.Group(g.ID).Wallets()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(wallets) != 1 || wallets[0].ID != w.ID {
+		t.Fatalf("expected wallet %v, got %v", w.ID, wallets)
+	}
+
+	if err := c.RemoveGroup(g.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.Group(g.ID).Wallets(); err == nil {
+		t.Fatal("expected error for removed group")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	whm, err := webhooks.NewManager(ws, webhooks.WithLogger(log.Named("webhooks")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer whm.Close()
+
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server := &http.Server{Handler: api.NewServer(cm, nil, wm, api.WithWebhookManager(whm), api.WithLogger(log.Named("api")))}
+	defer server.Close()
+	go server.Serve(l)
+	c := api.NewClient("http://"+l.Addr().String(), "password")
+
+	if _, err := c.AddTemplate(api.TemplateRequest{}); err == nil {
+		t.Fatal("expected error for template without a name")
+	}
+
+	fs := wallet.FeeStrategy{Type: wallet.FeeStrategyFixed, Fee: types.Siacoins(1)}
+	tmpl, err := c.AddTemplate(api.TemplateRequest{
+		Name:        "customer",
+		Metadata:    json.RawMessage(`{"tier":"standard"}`),
+		FeeStrategy: &fs,
+		Webhooks:    []wallet.TemplateWebhook{{CallbackURL: "http://localhost:1234", Scopes: []string{wallet.ScopeWallets}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tier := func(w wallet.Wallet) string {
+		t.Helper()
+		var meta struct {
+			Tier string `json:"tier"`
+		}
+		if err := json.Unmarshal(w.Metadata, &meta); err != nil {
+			t.Fatal(err)
+		}
+		return meta.Tier
+	}
+
+	// wallets created from the template inherit its settings
+	w, err := c.AddWallet(api.WalletUpdateRequest{Name: "alice", TemplateID: &tmpl.ID})
+	if err != nil {
+		t.Fatal(err)
+	} else if tier(w) != "standard" {
+		t.Fatalf("expected template metadata, got %s", w.Metadata)
+	}
+	if strategy, err := c.Wallet(w.ID).FeeStrategy(); err != nil {
+		t.Fatal(err)
+	} else if strategy.Type != wallet.FeeStrategyFixed || !strategy.Fee.Equals(fs.Fee) {
+		t.Fatalf("expected template fee strategy, got %+v", strategy)
+	}
+	hooks, err := c.Webhooks()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(hooks) != 1 || len(hooks[0].Scopes) != 1 || hooks[0].Scopes[0] != wallet.WalletScope(wallet.ScopeWallets, w.ID) {
+		t.Fatalf("expected a webhook scoped to the wallet, got %v", hooks)
+	}
+
+	// explicit metadata overrides the template, and the template's webhook
+	// is subscribed to the new wallet
+	w2, err := c.AddWallet(api.WalletUpdateRequest{Name: "bob", Metadata: json.RawMessage(`{"tier":"gold"}`), TemplateID: &tmpl.ID})
+	if err != nil {
+		t.Fatal(err)
+	} else if tier(w2) != "gold" {
+		t.Fatalf("expected explicit metadata, got %s", w2.Metadata)
+	} else if hooks, err = c.Webhooks(); err != nil {
+		t.Fatal(err)
+	} else if len(hooks) != 1 || len(hooks[0].Scopes) != 2 || hooks[0].Scopes[1] != wallet.WalletScope(wallet.ScopeWallets, w2.ID) {
+		t.Fatalf("expected the webhook to be subscribed to both wallets, got %v", hooks)
+	}
+
+	if _, err := c.UpdateTemplate(tmpl.ID, api.TemplateRequest{Name: "renamed"}); err != nil {
+		t.Fatal(err)
+	} else if tmpl, err = c.Template(tmpl.ID); err != nil {
+		t.Fatal(err)
+	} else if tmpl.Name != "renamed" || tmpl.FeeStrategy != nil {
+		t.Fatalf("unexpected template: %+v", tmpl)
+	}
+
+	if err := c.RemoveTemplate(tmpl.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := c.AddWallet(api.WalletUpdateRequest{Name: "carol", TemplateID: &tmpl.ID}); err == nil {
+		t.Fatal("expected error for removed template")
+	} else if templates, err := c.Templates(); err != nil {
+		t.Fatal(err)
+	} else if len(templates) != 0 {
+		t.Fatalf("expected no templates, got %d", len(templates))
+	}
+}
+
+func TestMetadataSchema(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	h := api.NewServer(cm, nil, wm)
+	do := func(method, path, body string, resp any) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if resp != nil {
+			if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code
+	}
+
+	const schema = `{"type":"object","required":["customerID"],"properties":{"customerID":{"type":"integer"}}}`
+	var w wallet.Wallet
+	if code := do(http.MethodPost, "/wallets", `{"name":"alice"}`, &w); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if code := do(http.MethodPut, fmt.Sprintf("/wallets/%d/metadata/schema", w.ID), `{"type":"map"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid schema, got %d", code)
+	} else if code := do(http.MethodPut, fmt.Sprintf("/wallets/%d/metadata/schema", w.ID), schema, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+
+	// updates must match the schema
+	var resp api.MetadataValidationResponse
+	if code := do(http.MethodPost, fmt.Sprintf("/wallets/%d", w.ID), `{"name":"alice","metadata":{"customerID":"abc"},"revision":1}`, &resp); code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", code)
+	} else if len(resp.Errors) != 1 || resp.Errors[0].Path != "/customerID" {
+		t.Fatalf("unexpected validation errors: %+v", resp)
+	} else if code := do(http.MethodPost, fmt.Sprintf("/wallets/%d", w.ID), `{"name":"alice","metadata":{"customerID":123},"revision":1}`, nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// removing the schema allows any metadata
+	if code := do(http.MethodDelete, fmt.Sprintf("/wallets/%d/metadata/schema", w.ID), "", nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	} else if code := do(http.MethodPost, fmt.Sprintf("/wallets/%d", w.ID), `{"name":"alice","metadata":{"customerID":"abc"},"revision":2}`, nil); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	// wallets created from a template inherit its schema
+	var tmpl wallet.Template
+	if code := do(http.MethodPost, "/wallet-templates", fmt.Sprintf(`{"name":"customer","metadataSchema":%s,"metadata":{"customerID":"abc"}}`, schema), nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for template metadata not matching its schema, got %d", code)
+	} else if code := do(http.MethodPost, "/wallet-templates", fmt.Sprintf(`{"name":"customer","metadataSchema":%s}`, schema), &tmpl); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if code := do(http.MethodPost, "/wallets", fmt.Sprintf(`{"name":"bob","templateID":"%d"}`, tmpl.ID), nil); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for wallet without required metadata, got %d", code)
+	} else if code := do(http.MethodPost, "/wallets", fmt.Sprintf(`{"name":"bob","templateID":"%d","metadata":{"customerID":7}}`, tmpl.ID), &w); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var got json.RawMessage
+	if code := do(http.MethodGet, fmt.Sprintf("/wallets/%d/metadata/schema", w.ID), "", &got); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	} else if string(got) == "null" {
+		t.Fatal("expected wallet to inherit the template's schema")
+	}
+}
+
+func TestWalletFilters(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	n, genesisBlock := testNetwork()
+
+	dbstore, tipState, err := chain.NewDBStore(chain.NewMemDB(), n, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	ws, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "wallets.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	wm, err := wallet.NewManager(cm, ws, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(wallet.IndexModeNone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	h := api.NewServer(cm, nil, wm)
+	var total string
+	list := func(query string) (ids []wallet.ID, code int) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/wallets?"+query, nil))
+		if rec.Code != http.StatusOK {
+			return nil, rec.Code
+		}
+		total = rec.Header().Get(api.HeaderTotalCount)
+		var wallets []wallet.Wallet
+		if err := json.Unmarshal(rec.Body.Bytes(), &wallets); err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range wallets {
+			ids = append(ids, w.ID)
+		}
+		return ids, rec.Code
+	}
+
+	var ids []wallet.ID
+	for i, metadata := range []string{`{"customerID":123,"region":"eu"}`, `{"customerID":456,"region":"eu"}`, `{"customerID":"123"}`} {
+		w, err := wm.AddWallet(wallet.Wallet{Name: fmt.Sprintf("customer %d", i+1), Metadata: json.RawMessage(metadata)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, w.ID)
+	}
+	if _, err := wm.AddWallet(wallet.Wallet{Name: "treasury"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := list("meta.customerID=123"); !reflect.DeepEqual(got, []wallet.ID{ids[0]}) {
+		t.Fatalf("expected wallet %d, got %v", ids[0], got)
+	} else if got, _ := list(`meta.customerID="123"`); !reflect.DeepEqual(got, []wallet.ID{ids[2]}) {
+		t.Fatalf("expected wallet %d, got %v", ids[2], got)
+	} else if got, _ := list("meta.region=eu&namePrefix=customer&offset=1&limit=1"); !reflect.DeepEqual(got, []wallet.ID{ids[1]}) {
+		t.Fatalf("expected wallet %d, got %v", ids[1], got)
+	} else if total != "2" {
+		t.Fatalf("expected total count 2, got %q", total)
+	} else if got, _ := list("namePrefix=customer"); !reflect.DeepEqual(got, ids) {
+		t.Fatalf("expected wallets %v, got %v", ids, got)
+	} else if got, _ := list("namePrefix=customer&sortBy=name&order=desc&limit=2"); !reflect.DeepEqual(got, []wallet.ID{ids[2], ids[1]}) {
+		t.Fatalf("expected wallets %v, got %v", []wallet.ID{ids[2], ids[1]}, got)
+	} else if total != "3" {
+		t.Fatalf("expected total count 3, got %q", total)
+	} else if _, code := list("sortBy=size"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown sort order, got %d", code)
+	} else if _, code := list("order=up"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid order, got %d", code)
+	} else if _, code := list("meta.=1"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty metadata path, got %d", code)
+	} else if _, code := list("limit=0"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid limit, got %d", code)
+	}
+
+	// the client returns the total count
+	c := runServer(t, cm, nil, wm)
+	mf, err := wallet.ParseMetadataFilter("region", "eu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallets, count, err := c.FilterWallets(wallet.WalletFilter{Metadata: []wallet.MetadataFilter{mf}, SortBy: wallet.WalletSortName, Descending: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	} else if count != 2 || len(wallets) != 1 || wallets[0].ID != ids[1] {
+		t.Fatalf("unexpected wallets %+v, total %d", wallets, count)
+	}
+}
+
+func TestPaymentURIs(t *testing.T) {
+	cm := apitest.NewChainManager(consensus.State{})
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), &graphqlWalletManager{}, api.WithBasicAuth("password")))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	req := paymenturi.URI{
+		Address: types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey()),
+		Amount:  types.Siacoins(5),
+		Label:   "invoice 7",
+		Expires: time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	resp, err := c.GeneratePaymentURI(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := c.ParsePaymentURI(resp.URI)
+	if err != nil {
+		t.Fatal(err)
+	} else if parsed.URI != resp.URI || parsed.Expired {
+		t.Fatalf("unexpected response %+v", parsed)
+	} else if !parsed.Request.Amount.Equals(req.Amount) || parsed.Request.Label != req.Label || !parsed.Request.Expires.Equal(req.Expires) {
+		t.Fatalf("expected %+v, got %+v", req, parsed.Request)
+	}
+
+	// expired requests cannot be generated, but can be parsed
+	req.Expires = time.Unix(1, 0)
+	if _, err := c.GeneratePaymentURI(req); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected expired error, got %v", err)
+	}
+	parsed, err = c.ParsePaymentURI(req.String())
+	if err != nil {
+		t.Fatal(err)
+	} else if !parsed.Expired {
+		t.Fatal("expected expired request")
+	}
+
+	if _, err := c.ParsePaymentURI("sia:" + req.Address.String() + "?req-foo=1"); err == nil {
+		t.Fatal("expected error for unsupported requirement")
+	}
+}
+
+// decodeWalletManager implements the wallet methods used to decode
+// transactions and build transaction graphs.
+type decodeWalletManager struct {
+	api.WalletManager
+	elements map[types.SiacoinOutputID]types.SiacoinElement
+	owners   map[types.Address]wallet.ID
+}
+
+func (wm *decodeWalletManager) SiacoinElement(id types.SiacoinOutputID) (types.SiacoinElement, error) {
+	sce, ok := wm.elements[id]
+	if !ok {
+		return types.SiacoinElement{}, wallet.ErrNotFound
+	}
+	return sce, nil
+}
+
+func (wm *decodeWalletManager) SiafundElement(types.SiafundOutputID) (types.SiafundElement, error) {
+	return types.SiafundElement{}, wallet.ErrNotFound
+}
+
+func (wm *decodeWalletManager) AddressWallets(addrs []types.Address) (map[types.Address]wallet.ID, error) {
+	owners := make(map[types.Address]wallet.ID)
+	for _, addr := range addrs {
+		if id, ok := wm.owners[addr]; ok {
+			owners[addr] = id
+		}
+	}
+	return owners, nil
+}
+
+func TestDecodeTransaction(t *testing.T) {
+	uc := types.StandardUnlockConditions(types.GeneratePrivateKey().PublicKey())
+	local := uc.UnlockHash()
+	external := types.Address{1}
+	confirmed := types.SiacoinElement{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: local, Value: types.Siacoins(10)}}
+
+	cm := apitest.NewChainManager(consensus.State{})
+	wm := &decodeWalletManager{
+		elements: map[types.SiacoinOutputID]types.SiacoinElement{confirmed.ID: confirmed},
+		owners:   map[types.Address]wallet.ID{local: 7},
+	}
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password")))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	txn := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: confirmed.ID, UnlockConditions: uc},
+			{ParentID: types.SiacoinOutputID{2}, UnlockConditions: uc},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Address: external, Value: types.Siacoins(5)},
+			{Address: local, Value: types.Siacoins(4)},
+		},
+		MinerFees: []types.Currency{types.Siacoins(1)},
+	}
+	resp, err := c.DecodeTransaction(txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case resp.Version != 1 || resp.ID != txn.ID():
+		t.Fatalf("unexpected transaction %v (version %d)", resp.ID, resp.Version)
+	case !resp.Fee.Equals(types.Siacoins(1)):
+		t.Fatalf("expected %v fee, got %v", types.Siacoins(1), resp.Fee)
+	case resp.Size == 0:
+		t.Fatal("expected non-zero size")
+	case len(resp.SiacoinInputs) != 2 || len(resp.SiacoinOutputs) != 2:
+		t.Fatalf("unexpected inputs and outputs %+v", resp)
+	}
+	if in := resp.SiacoinInputs[0]; in.Source != api.InputSourceConfirmed || in.Value == nil || !in.Value.Equals(types.Siacoins(10)) || in.WalletID == nil || *in.WalletID != 7 {
+		t.Fatalf("unexpected confirmed input %+v", in)
+	} else if in := resp.SiacoinInputs[1]; in.Source != api.InputSourceUnknown || in.Value != nil || in.Address != local {
+		t.Fatalf("unexpected unknown input %+v", in)
+	} else if out := resp.SiacoinOutputs[0]; out.WalletID != nil || out.ID != txn.SiacoinOutputID(0) {
+		t.Fatalf("unexpected external output %+v", out)
+	} else if out := resp.SiacoinOutputs[1]; out.WalletID == nil || *out.WalletID != 7 {
+		t.Fatalf("unexpected local output %+v", out)
+	}
+
+	// v2 transactions can be decoded from hex
+	v2txn := types.V2Transaction{
+		SiacoinInputs:  []types.V2SiacoinInput{{Parent: types.SiacoinElement{ID: types.SiacoinOutputID{3}, SiacoinOutput: types.SiacoinOutput{Address: external, Value: types.Siacoins(3)}}}},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: local, Value: types.Siacoins(2)}},
+		MinerFee:       types.Siacoins(1),
+	}
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	v2txn.EncodeTo(e)
+	e.Flush()
+	body, _ := json.Marshal(api.TransactionDecodeRequest{Hex: hex.EncodeToString(buf.Bytes())})
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/transactions/decode", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("", "password")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var v2resp api.DecodedTransaction
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	} else if err := json.NewDecoder(res.Body).Decode(&v2resp); err != nil {
+		t.Fatal(err)
+	} else if v2resp.Version != 2 || v2resp.ID != v2txn.ID() || !v2resp.Fee.Equals(types.Siacoins(1)) {
+		t.Fatalf("unexpected v2 transaction %+v", v2resp)
+	} else if in := v2resp.SiacoinInputs[0]; in.Source != api.InputSourceUnknown || in.Value == nil || !in.Value.Equals(types.Siacoins(3)) || in.WalletID != nil {
+		t.Fatalf("unexpected v2 input %+v", in)
+	} else if out := v2resp.SiacoinOutputs[0]; out.WalletID == nil || *out.WalletID != 7 {
+		t.Fatalf("unexpected v2 output %+v", out)
+	}
+
+	// exactly one transaction must be set
+	body, _ = json.Marshal(api.TransactionDecodeRequest{Transaction: &txn, V2Transaction: &v2txn})
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/transactions/decode", bytes.NewReader(body))
+	req.SetBasicAuth("", "password")
+	if res, err := http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	} else if res.Body.Close(); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", res.StatusCode)
+	}
+}
+
+func TestTxpoolGraph(t *testing.T) {
+	uc := types.StandardUnlockConditions(types.GeneratePrivateKey().PublicKey())
+	addr := uc.UnlockHash()
+	confirmed := types.SiacoinElement{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(10)}}
+
+	cm := apitest.NewChainManager(consensus.State{})
+	wm := &decodeWalletManager{elements: map[types.SiacoinOutputID]types.SiacoinElement{confirmed.ID: confirmed}}
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password")))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	pooled := types.Transaction{
+		SiacoinInputs:  []types.SiacoinInput{{ParentID: types.SiacoinOutputID{2}, UnlockConditions: uc}},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(3)}},
+	}
+	if _, err := cm.AddPoolTransactions([]types.Transaction{pooled}); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: confirmed.ID, UnlockConditions: uc},
+			{ParentID: pooled.SiacoinOutputID(0), UnlockConditions: uc},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(13)}},
+	}
+	child := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{
+			{ParentID: parent.SiacoinOutputID(0), UnlockConditions: uc},
+			{ParentID: types.SiacoinOutputID{3}, UnlockConditions: uc},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(13)}},
+	}
+
+	// the child is listed first, but is ordered after its parent
+	resp, err := c.TxpoolGraph([]types.Transaction{child, parent}, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(resp.Transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(resp.Transactions))
+	} else if len(resp.Order) != 2 || resp.Order[0] != parent.ID() || resp.Order[1] != child.ID() {
+		t.Fatalf("unexpected order %v", resp.Order)
+	} else if resp.Complete {
+		t.Fatal("expected incomplete set")
+	}
+	childNode, parentNode := resp.Transactions[0], resp.Transactions[1]
+	if childNode.ID != child.ID() || len(childNode.SiacoinOutputIDs) != 1 || childNode.SiacoinOutputIDs[0] != child.SiacoinOutputID(0) {
+		t.Fatalf("unexpected child %+v", childNode)
+	} else if len(childNode.Parents) != 1 || childNode.Parents[0] != parent.ID() {
+		t.Fatalf("unexpected child parents %v", childNode.Parents)
+	} else if len(childNode.MissingSiacoinParents) != 1 || childNode.MissingSiacoinParents[0] != (types.SiacoinOutputID{3}) {
+		t.Fatalf("unexpected missing parents %v", childNode.MissingSiacoinParents)
+	} else if len(parentNode.Parents) != 0 || len(parentNode.MissingSiacoinParents) != 0 {
+		t.Fatalf("unexpected parent %+v", parentNode)
+	} else if len(parentNode.PoolParents) != 1 || parentNode.PoolParents[0] != pooled.ID() {
+		t.Fatalf("unexpected pool parents %v", parentNode.PoolParents)
+	}
+
+	// duplicate transactions are rejected
+	if _, err := c.TxpoolGraph([]types.Transaction{parent, parent}, nil); err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+}
+
+type rawWalletManager struct {
+	api.WalletManager
+	raw map[types.Hash256]wallet.RawTransaction
+}
+
+func (wm *rawWalletManager) EventRawTransaction(id types.Hash256) (wallet.RawTransaction, error) {
+	if id == (types.Hash256{2}) {
+		return wallet.RawTransaction{}, wallet.ErrRawNotRetained
+	}
+	raw, ok := wm.raw[id]
+	if !ok {
+		return wallet.RawTransaction{}, wallet.ErrNotFound
+	}
+	return raw, nil
+}
+
+func TestEventRawTransaction(t *testing.T) {
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: types.Address{1}, Value: types.Siacoins(1)}},
+		ArbitraryData:  [][]byte{[]byte("hello")},
+	}
+	cm := apitest.NewChainManager(consensus.State{})
+	wm := &rawWalletManager{raw: map[types.Hash256]wallet.RawTransaction{{1}: {Transaction: &txn}}}
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password")))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	raw, err := c.EventRawTransaction(types.Hash256{1})
+	if err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction == nil || raw.V2Transaction != nil || raw.Transaction.ID() != txn.ID() {
+		t.Fatalf("unexpected raw transaction %+v", raw)
+	}
+
+	get := func(id types.Hash256, query string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/events/%v/raw%s", srv.URL, id, query), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("", "password")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := get(types.Hash256{1}, "?format=binary")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded types.Transaction
+	d := types.NewBufDecoder(buf)
+	decoded.DecodeFrom(d)
+	if err := d.Err(); err != nil {
+		t.Fatal(err)
+	} else if decoded.ID() != txn.ID() {
+		t.Fatal("decoded transaction does not match")
+	}
+
+	if resp := get(types.Hash256{2}, ""); resp.StatusCode != http.StatusGone {
+		t.Fatalf("expected 410, got %d", resp.StatusCode)
+	} else if resp := get(types.Hash256{3}, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+type reconcileWalletManager struct {
+	api.WalletManager
+	events []wallet.Event
+}
+
+func (wm *reconcileWalletManager) WalletEventsBetween(_ context.Context, id wallet.ID, start, end uint64) (events []wallet.Event, err error) {
+	if id != 1 {
+		return nil, wallet.ErrNotFound
+	}
+	for _, ev := range wm.events {
+		if ev.Index.Height >= start && ev.Index.Height <= end {
+			events = append(events, ev)
+		}
+	}
+	return events, nil
+}
+
+func TestReconcile(t *testing.T) {
+	addr := types.Address{1}
+	payout := func(id byte, height uint64, value types.Currency) wallet.Event {
+		return wallet.Event{
+			ID:       types.Hash256{id},
+			Index:    types.ChainIndex{Height: height},
+			Type:     wallet.EventTypeMinerPayout,
+			Relevant: []types.Address{addr},
+			Data:     wallet.EventPayout{SiacoinElement: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: value}}},
+		}
+	}
+	cm := apitest.NewChainManager(consensus.State{})
+	wm := &reconcileWalletManager{events: []wallet.Event{
+		payout(1, 10, types.Siacoins(5)),
+		payout(2, 20, types.Siacoins(6)),
+		payout(3, 30, types.Siacoins(7)),
+	}}
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password")))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	res, err := c.Wallet(1).Reconcile(10, 20, []reconcile.Entry{
+		{Reference: "a", Direction: reconcile.DirectionIn, Amount: types.Siacoins(6)},
+		{Reference: "b", Direction: reconcile.DirectionIn, Amount: types.Siacoins(7)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Matched) != 1 || res.Matched[0].Entry.Reference != "a" || res.Matched[0].Event.ID != (types.Hash256{2}) {
+		t.Fatalf("expected entry a to match the second event, got %+v", res.Matched)
+	} else if len(res.Missing) != 1 || res.Missing[0].Reference != "b" {
+		t.Fatalf("expected entry b to be missing, got %+v", res.Missing)
+	} else if len(res.Unexpected) != 1 || res.Unexpected[0].ID != (types.Hash256{1}) {
+		t.Fatalf("expected the first event to be unexpected, got %+v", res.Unexpected)
+	}
+
+	if _, err := c.Wallet(1).Reconcile(20, 10, nil); err == nil {
+		t.Fatal("expected error for inverted range")
+	} else if _, err := c.Wallet(1).Reconcile(0, 20000, nil); err == nil {
+		t.Fatal("expected error for oversized range")
+	} else if _, err := c.Wallet(1).Reconcile(0, 10, []reconcile.Entry{{Direction: "sideways", Amount: types.Siacoins(1)}}); err == nil {
+		t.Fatal("expected error for invalid direction")
+	} else if _, err := c.Wallet(2).Reconcile(0, 10, nil); err == nil {
+		t.Fatal("expected error for unknown wallet")
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	txn := types.Transaction{SiacoinOutputs: []types.SiacoinOutput{{Address: types.Address{1}, Value: types.Siacoins(1)}}}
+	cm := apitest.NewChainManager(consensus.State{})
+	wm := &rawWalletManager{raw: map[types.Hash256]wallet.RawTransaction{{1}: {Transaction: &txn}}}
+	sunset := time.Date(2027, 6, 30, 0, 0, 0, 0, time.UTC)
+	handler := api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), wm, api.WithBasicAuth("password"), api.WithLegacySunset(sunset))
+	srv := httptest.NewServer(http.StripPrefix("/api", handler))
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("", "password")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	// unversioned routes are deprecated
+	id := types.Hash256{1}
+	resp, _ := get(fmt.Sprintf("/api/events/%v/raw", id))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	} else if v := resp.Header.Get(api.HeaderAPIVersion); v != "1" {
+		t.Fatalf("expected version 1, got %q", v)
+	} else if resp.Header.Get("Deprecation") != "true" {
+		t.Fatal("expected deprecation header")
+	} else if link := resp.Header.Get("Link"); link != fmt.Sprintf(`</api/v2/events/%v/raw>; rel="successor-version"`, id) {
+		t.Fatalf("unexpected link header %q", link)
+	} else if s := resp.Header.Get("Sunset"); s != sunset.Format(http.TimeFormat) {
+		t.Fatalf("unexpected sunset header %q", s)
+	}
+
+	// unversioned errors are plain text
+	resp, body := get(fmt.Sprintf("/api/events/%v/raw", types.Hash256{3}))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	} else if strings.HasPrefix(string(body), "{") {
+		t.Fatalf("expected plain text error, got %q", body)
+	}
+
+	// v2 routes serve the same responses without deprecation headers
+	resp, body = get(fmt.Sprintf("/api/v2/events/%v/raw", id))
+	var raw wallet.RawTransaction
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	} else if v := resp.Header.Get(api.HeaderAPIVersion); v != "2" {
+		t.Fatalf("expected version 2, got %q", v)
+	} else if resp.Header.Get("Deprecation") != "" || resp.Header.Get("Sunset") != "" {
+		t.Fatal("expected no deprecation headers")
+	} else if err := json.Unmarshal(body, &raw); err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction == nil || raw.Transaction.ID() != txn.ID() {
+		t.Fatalf("unexpected raw transaction %+v", raw)
+	}
+
+	// v2 errors are structured
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{fmt.Sprintf("/api/v2/events/%v/raw", types.Hash256{3}), http.StatusNotFound},
+		{fmt.Sprintf("/api/v2/events/%v/raw", types.Hash256{2}), http.StatusGone},
+		{"/api/v2/unknown", http.StatusNotFound},
+	} {
+		resp, body := get(test.path)
+		var er api.ErrorResponse
+		if resp.StatusCode != test.status {
+			t.Fatalf("%s: expected %d, got %d", test.path, test.status, resp.StatusCode)
+		} else if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("%s: expected JSON error, got %q", test.path, ct)
+		} else if err := json.Unmarshal(body, &er); err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		} else if er.Error.Status != test.status || er.Error.Message == "" {
+			t.Fatalf("%s: unexpected error %+v", test.path, er)
+		}
+	}
+}
+
+type operationsWalletManager struct {
+	api.WalletManager
+}
+
+func (operationsWalletManager) Tip() (types.ChainIndex, error) {
+	return types.ChainIndex{}, nil
+}
+
+func (operationsWalletManager) Scan(ctx context.Context, _ types.ChainIndex) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type operationsPaymentManager struct {
+	api.PaymentManager
+}
+
+func (operationsPaymentManager) Flush(id wallet.ID) (payments.Batch, error) {
+	if id != 1 {
+		return payments.Batch{}, wallet.ErrNotFound
+	}
+	return payments.Batch{ID: 7, WalletID: id}, nil
+}
+
+func TestOperations(t *testing.T) {
+	cm := apitest.NewChainManager(consensus.State{})
+	ops := operations.NewManager()
+	defer ops.Close()
+	srv := httptest.NewServer(api.NewServer(cm, apitest.NewSyncer("127.0.0.1:9981"), operationsWalletManager{}, api.WithBasicAuth("password"), api.WithOperationManager(ops), api.WithPaymentManager(operationsPaymentManager{})))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	waitFinished := func(id types.Hash256) operations.Operation {
+		t.Helper()
+		for i := 0; i < 500; i++ {
+			op, err := c.Operation(id)
+			if err != nil {
+				t.Fatal(err)
+			} else if op.Finished() {
+				return op
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("timed out waiting for operation")
+		return operations.Operation{}
+	}
+
+	// rescans run as exclusive operations
+	scan, err := c.StartRescan(0)
+	if err != nil {
+		t.Fatal(err)
+	} else if scan.Type != operations.TypeRescan || scan.Status != operations.StatusRunning {
+		t.Fatalf("unexpected operation %+v", scan)
+	} else if _, err := c.StartRescan(0); err == nil {
+		t.Fatal("expected error starting a second rescan")
+	} else if status, err := c.ScanStatus(); err != nil {
+		t.Fatal(err)
+	} else if status.OperationID != scan.ID {
+		t.Fatalf("expected scan status to reference operation %v, got %v", scan.ID, status.OperationID)
+	}
+
+	if _, err := c.CancelOperation(scan.ID); err != nil {
+		t.Fatal(err)
+	} else if op := waitFinished(scan.ID); op.Status != operations.StatusCanceled {
+		t.Fatalf("expected canceled rescan, got %+v", op)
+	} else if _, err := c.CancelOperation(scan.ID); err == nil {
+		t.Fatal("expected error canceling a finished operation")
+	} else if status, err := c.ScanStatus(); err != nil {
+		t.Fatal(err)
+	} else if status.Error == nil {
+		t.Fatal("expected scan status to include the cancellation")
+	}
+
+	// flushes can run asynchronously and store their result
+	flush, err := c.Wallet(1).FlushPaymentsAsync()
+	if err != nil {
+		t.Fatal(err)
+	} else if op := waitFinished(flush.ID); op.Status != operations.StatusCompleted {
+		t.Fatalf("expected completed flush, got %+v", op)
+	} else {
+		var batch payments.Batch
+		if err := json.Unmarshal(op.Result, &batch); err != nil {
+			t.Fatal(err)
+		} else if batch.ID != 7 {
+			t.Fatalf("unexpected batch %+v", batch)
+		}
+	}
+	failed, err := c.Wallet(2).FlushPaymentsAsync()
+	if err != nil {
+		t.Fatal(err)
+	} else if op := waitFinished(failed.ID); op.Status != operations.StatusFailed || op.Error != wallet.ErrNotFound.Error() {
+		t.Fatalf("expected failed flush, got %+v", op)
+	}
+
+	if all, err := c.Operations(""); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 3 || all[0].ID != failed.ID {
+		t.Fatalf("expected 3 operations, newest first, got %+v", all)
+	} else if scans, err := c.Operations(operations.TypeRescan); err != nil {
+		t.Fatal(err)
+	} else if len(scans) != 1 || scans[0].ID != scan.ID {
+		t.Fatalf("expected 1 rescan, got %+v", scans)
+	} else if _, err := c.Operation(types.Hash256{1}); err == nil {
+		t.Fatal("expected error for unknown operation")
+	}
+}
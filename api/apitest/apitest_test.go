@@ -0,0 +1,70 @@
+package apitest_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/api/apitest"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestServer(t *testing.T) {
+	tip := consensus.State{Index: types.ChainIndex{Height: 10, ID: types.BlockID{10}}}
+	cm := apitest.NewChainManager(tip)
+	cm.AddState(consensus.State{Index: types.ChainIndex{Height: 9, ID: types.BlockID{9}}})
+	s := apitest.NewSyncer("127.0.0.1:9981")
+
+	srv := httptest.NewServer(api.NewServer(cm, s, nil, api.WithBasicAuth("password"), api.WithLogger(zaptest.NewLogger(t))))
+	defer srv.Close()
+	c := api.NewClient(srv.URL, "password")
+
+	if index, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	} else if index != tip.Index {
+		t.Fatalf("expected tip %v, got %v", tip.Index, index)
+	} else if index, err := c.ConsensusIndex(9); err != nil {
+		t.Fatal(err)
+	} else if index.ID != (types.BlockID{9}) {
+		t.Fatalf("expected block 9, got %v", index)
+	} else if _, err := c.ConsensusIndex(11); err == nil {
+		t.Fatal("expected an error for an unknown height")
+	}
+
+	// a new tip is served immediately
+	next := consensus.State{Index: types.ChainIndex{Height: 11, ID: types.BlockID{11}}}
+	cm.SetTipState(next)
+	if index, err := c.ConsensusTip(); err != nil {
+		t.Fatal(err)
+	} else if index != next.Index {
+		t.Fatalf("expected tip %v, got %v", next.Index, index)
+	}
+
+	txn := types.V2Transaction{MinerFee: types.Siacoins(1)}
+	if err := c.TxpoolBroadcast(nil, []types.V2Transaction{txn}); err != nil {
+		t.Fatal(err)
+	} else if _, v2txns, err := c.TxpoolTransactions(); err != nil {
+		t.Fatal(err)
+	} else if len(v2txns) != 1 {
+		t.Fatalf("expected 1 pool transaction, got %d", len(v2txns))
+	} else if sets := s.BroadcastV2TransactionSets(); len(sets) != 1 || sets[0].Basis != next.Index {
+		t.Fatalf("expected 1 broadcast at the tip, got %v", sets)
+	}
+
+	cm.SetPoolError(errors.New("invalid transaction"))
+	if err := c.TxpoolBroadcast(nil, []types.V2Transaction{txn}); err == nil || !strings.Contains(err.Error(), "invalid transaction") {
+		t.Fatalf("expected the pool error, got %v", err)
+	} else if sets := s.BroadcastV2TransactionSets(); len(sets) != 1 {
+		t.Fatal("expected the rejected set not to be broadcast")
+	}
+
+	if err := c.SyncerConnect("127.0.0.1:9982"); err != nil {
+		t.Fatal(err)
+	} else if connected := s.Connected(); len(connected) != 1 || connected[0] != "127.0.0.1:9982" {
+		t.Fatalf("expected a connection to the peer, got %v", connected)
+	}
+}
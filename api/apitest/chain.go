@@ -0,0 +1,254 @@
+// Package apitest provides fake implementations of the chain manager and
+// syncer used by the api package, so that handlers can be tested without
+// running consensus or connecting to peers.
+package apitest
+
+import (
+	"errors"
+	"sync"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/walletd/api"
+)
+
+var _ api.ChainManager = (*ChainManager)(nil)
+
+// ErrUnknownIndex is returned by ChainManager.UpdatesSince when the index is
+// not part of the scripted chain.
+var ErrUnknownIndex = errors.New("unknown chain index")
+
+// A ChainManager is a scriptable api.ChainManager. It does not validate
+// blocks or transactions: its tip, states, blocks, updates and txpool are
+// whatever the test sets. It is safe for concurrent use.
+type ChainManager struct {
+	mu     sync.Mutex
+	tip    consensus.State
+	states map[types.BlockID]consensus.State
+	best   map[uint64]types.ChainIndex
+	blocks map[types.BlockID]types.Block
+	added  []types.Block
+	fee    types.Currency
+
+	reverted []chain.RevertUpdate
+	applied  []chain.ApplyUpdate
+
+	pool    []types.Transaction
+	v2pool  []types.V2Transaction
+	poolErr error
+}
+
+// NewChainManager returns a ChainManager whose tip is the given state.
+func NewChainManager(tip consensus.State) *ChainManager {
+	cm := &ChainManager{
+		states: make(map[types.BlockID]consensus.State),
+		best:   make(map[uint64]types.ChainIndex),
+		blocks: make(map[types.BlockID]types.Block),
+	}
+	cm.SetTipState(tip)
+	return cm
+}
+
+// SetTipState sets the tip of the chain. The state is also added to the best
+// chain, as with AddState.
+func (cm *ChainManager) SetTipState(cs consensus.State) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.tip = cs
+	cm.states[cs.Index.ID] = cs
+	cm.best[cs.Index.Height] = cs.Index
+}
+
+// AddState adds a state to the best chain without changing the tip.
+func (cm *ChainManager) AddState(cs consensus.State) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.states[cs.Index.ID] = cs
+	cm.best[cs.Index.Height] = cs.Index
+}
+
+// SetBlock adds a block returned by Block.
+func (cm *ChainManager) SetBlock(b types.Block) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.blocks[b.ID()] = b
+}
+
+// SetUpdates sets the updates returned by UpdatesSince. Updates are returned
+// for any index of the best chain, up to the requested maximum.
+func (cm *ChainManager) SetUpdates(reverted []chain.RevertUpdate, applied []chain.ApplyUpdate) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.reverted, cm.applied = reverted, applied
+}
+
+// SetRecommendedFee sets the fee returned by RecommendedFee.
+func (cm *ChainManager) SetRecommendedFee(fee types.Currency) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.fee = fee
+}
+
+// SetPoolError sets the error returned when adding transactions to the pool.
+// A nil error accepts every transaction.
+func (cm *ChainManager) SetPoolError(err error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.poolErr = err
+}
+
+// ClearPool removes every transaction from the pool.
+func (cm *ChainManager) ClearPool() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.pool, cm.v2pool = nil, nil
+}
+
+// AddedBlocks returns the blocks passed to AddBlocks.
+func (cm *ChainManager) AddedBlocks() []types.Block {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return append([]types.Block(nil), cm.added...)
+}
+
+// UpdatesSince implements api.ChainManager.
+func (cm *ChainManager) UpdatesSince(index types.ChainIndex, maxBlocks int) ([]chain.RevertUpdate, []chain.ApplyUpdate, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if index != (types.ChainIndex{}) && cm.best[index.Height] != index {
+		return nil, nil, ErrUnknownIndex
+	}
+	reverted := append([]chain.RevertUpdate(nil), cm.reverted...)
+	applied := append([]chain.ApplyUpdate(nil), cm.applied...)
+	if maxBlocks >= 0 && len(applied) > maxBlocks {
+		applied = applied[:maxBlocks]
+	}
+	return reverted, applied, nil
+}
+
+// Tip implements api.ChainManager.
+func (cm *ChainManager) Tip() types.ChainIndex {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.tip.Index
+}
+
+// BestIndex implements api.ChainManager.
+func (cm *ChainManager) BestIndex(height uint64) (types.ChainIndex, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	index, ok := cm.best[height]
+	return index, ok
+}
+
+// TipState implements api.ChainManager.
+func (cm *ChainManager) TipState() consensus.State {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.tip
+}
+
+// State implements api.ChainManager.
+func (cm *ChainManager) State(id types.BlockID) (consensus.State, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cs, ok := cm.states[id]
+	return cs, ok
+}
+
+// Block implements api.ChainManager.
+func (cm *ChainManager) Block(id types.BlockID) (types.Block, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	b, ok := cm.blocks[id]
+	return b, ok
+}
+
+// AddBlocks implements api.ChainManager. The blocks are recorded and can be
+// retrieved with Block, but the tip is not changed.
+func (cm *ChainManager) AddBlocks(blocks []types.Block) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, b := range blocks {
+		cm.blocks[b.ID()] = b
+		cm.added = append(cm.added, b)
+	}
+	return nil
+}
+
+// RecommendedFee implements api.ChainManager.
+func (cm *ChainManager) RecommendedFee() types.Currency {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.fee
+}
+
+// PoolTransactions implements api.ChainManager.
+func (cm *ChainManager) PoolTransactions() []types.Transaction {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return append([]types.Transaction(nil), cm.pool...)
+}
+
+// V2PoolTransactions implements api.ChainManager.
+func (cm *ChainManager) V2PoolTransactions() []types.V2Transaction {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return append([]types.V2Transaction(nil), cm.v2pool...)
+}
+
+// AddPoolTransactions implements api.ChainManager.
+func (cm *ChainManager) AddPoolTransactions(txns []types.Transaction) (bool, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.poolErr != nil {
+		return false, cm.poolErr
+	}
+	cm.pool = append(cm.pool, txns...)
+	return false, nil
+}
+
+// AddV2PoolTransactions implements api.ChainManager.
+func (cm *ChainManager) AddV2PoolTransactions(_ types.ChainIndex, txns []types.V2Transaction) (bool, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if cm.poolErr != nil {
+		return false, cm.poolErr
+	}
+	cm.v2pool = append(cm.v2pool, txns...)
+	return false, nil
+}
+
+// UnconfirmedParents implements api.ChainManager. It returns the pool
+// transactions that create the siacoin and siafund outputs spent by txn.
+func (cm *ChainManager) UnconfirmedParents(txn types.Transaction) []types.Transaction {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	spent := make(map[types.Hash256]bool)
+	for _, sci := range txn.SiacoinInputs {
+		spent[types.Hash256(sci.ParentID)] = true
+	}
+	for _, sfi := range txn.SiafundInputs {
+		spent[types.Hash256(sfi.ParentID)] = true
+	}
+
+	var parents []types.Transaction
+outer:
+	for _, ptxn := range cm.pool {
+		for i := range ptxn.SiacoinOutputs {
+			if spent[types.Hash256(ptxn.SiacoinOutputID(i))] {
+				parents = append(parents, ptxn)
+				continue outer
+			}
+		}
+		for i := range ptxn.SiafundOutputs {
+			if spent[types.Hash256(ptxn.SiafundOutputID(i))] {
+				parents = append(parents, ptxn)
+				continue outer
+			}
+		}
+	}
+	return parents
+}
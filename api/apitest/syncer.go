@@ -0,0 +1,167 @@
+package apitest
+
+import (
+	"context"
+	"sync"
+
+	"go.thebigfile.com/core/gateway"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/syncer"
+	"go.thebigfile.com/walletd/api"
+)
+
+var _ api.Syncer = (*Syncer)(nil)
+
+// A TransactionSet is a v2 transaction set broadcast by a Syncer.
+type TransactionSet struct {
+	Basis        types.ChainIndex
+	Transactions []types.V2Transaction
+}
+
+// A Syncer is an api.Syncer that records broadcasts instead of sending them
+// to peers. It is safe for concurrent use.
+type Syncer struct {
+	mu         sync.Mutex
+	addr       string
+	peers      []*syncer.Peer
+	peerInfo   map[string]syncer.PeerInfo
+	connectErr error
+	connected  []string
+
+	headers  []types.BlockHeader
+	txnSets  [][]types.Transaction
+	v2Sets   []TransactionSet
+	outlines []gateway.V2BlockOutline
+}
+
+// NewSyncer returns a Syncer listening on addr.
+func NewSyncer(addr string) *Syncer {
+	return &Syncer{
+		addr:     addr,
+		peerInfo: make(map[string]syncer.PeerInfo),
+	}
+}
+
+// SetPeers sets the peers returned by Peers. The peers must be connected,
+// since handlers may call their methods.
+func (s *Syncer) SetPeers(peers []*syncer.Peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peers = append([]*syncer.Peer(nil), peers...)
+}
+
+// SetPeerInfo sets the info returned by PeerInfo for a peer address.
+func (s *Syncer) SetPeerInfo(info syncer.PeerInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerInfo[info.Address] = info
+}
+
+// SetConnectError sets the error returned by Connect. A nil error accepts
+// every connection.
+func (s *Syncer) SetConnectError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connectErr = err
+}
+
+// Connected returns the addresses passed to successful Connect calls.
+func (s *Syncer) Connected() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.connected...)
+}
+
+// BroadcastHeaders returns the broadcast block headers.
+func (s *Syncer) BroadcastHeaders() []types.BlockHeader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.BlockHeader(nil), s.headers...)
+}
+
+// BroadcastTransactionSets returns the broadcast v1 transaction sets.
+func (s *Syncer) BroadcastTransactionSets() [][]types.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]types.Transaction(nil), s.txnSets...)
+}
+
+// BroadcastV2TransactionSets returns the broadcast v2 transaction sets.
+func (s *Syncer) BroadcastV2TransactionSets() []TransactionSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TransactionSet(nil), s.v2Sets...)
+}
+
+// BroadcastV2BlockOutlines returns the broadcast v2 block outlines.
+func (s *Syncer) BroadcastV2BlockOutlines() []gateway.V2BlockOutline {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]gateway.V2BlockOutline(nil), s.outlines...)
+}
+
+// Addr implements api.Syncer.
+func (s *Syncer) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// Peers implements api.Syncer.
+func (s *Syncer) Peers() []*syncer.Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*syncer.Peer(nil), s.peers...)
+}
+
+// PeerInfo implements api.Syncer. It returns syncer.ErrPeerNotFound unless
+// the peer's info was set with SetPeerInfo.
+func (s *Syncer) PeerInfo(addr string) (syncer.PeerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.peerInfo[addr]
+	if !ok {
+		return syncer.PeerInfo{}, syncer.ErrPeerNotFound
+	}
+	return info, nil
+}
+
+// Connect implements api.Syncer. The returned peer is not connected and is
+// not added to Peers.
+func (s *Syncer) Connect(_ context.Context, addr string) (*syncer.Peer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.connectErr != nil {
+		return nil, s.connectErr
+	}
+	s.connected = append(s.connected, addr)
+	return &syncer.Peer{ConnAddr: addr}, nil
+}
+
+// BroadcastHeader implements api.Syncer.
+func (s *Syncer) BroadcastHeader(bh types.BlockHeader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headers = append(s.headers, bh)
+}
+
+// BroadcastTransactionSet implements api.Syncer.
+func (s *Syncer) BroadcastTransactionSet(txns []types.Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txnSets = append(s.txnSets, txns)
+}
+
+// BroadcastV2TransactionSet implements api.Syncer.
+func (s *Syncer) BroadcastV2TransactionSet(basis types.ChainIndex, txns []types.V2Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.v2Sets = append(s.v2Sets, TransactionSet{Basis: basis, Transactions: txns})
+}
+
+// BroadcastV2BlockOutline implements api.Syncer.
+func (s *Syncer) BroadcastV2BlockOutline(bo gateway.V2BlockOutline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outlines = append(s.outlines, bo)
+}
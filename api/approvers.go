@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/approver"
+)
+
+func (s *server) approversHandlerGET(jc jape.Context) {
+	approvers, err := s.apm.Approvers()
+	if jc.Check("couldn't get approvers", err) != nil {
+		return
+	}
+	jc.Encode(approvers)
+}
+
+func (s *server) approversPairingsHandlerPOST(jc jape.Context) {
+	var req ApproverPairingRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("approvers can only be paired with the API password"), http.StatusForbidden)
+		return
+	}
+	p, err := s.apm.CreatePairing(req.Name)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.Encode(p)
+}
+
+func (s *server) approversIDHandlerDELETE(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("approvers can only be removed with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.apm.RemoveApprover(id)
+	if errors.Is(err, approver.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove approver", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
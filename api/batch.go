@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"go.sia.tech/jape"
+)
+
+const (
+	// maxBatchRequests is the maximum number of sub-requests in a batch.
+	maxBatchRequests = 50
+	// maxBatchAttempts is the number of times a read-only batch is executed
+	// while the tip keeps changing before an inconsistent result is
+	// returned.
+	maxBatchAttempts = 3
+)
+
+// validateBatch checks the sub-requests of a batch and returns true if they
+// are all reads, which can be safely repeated.
+func validateBatch(reqs []BatchRequest) (readOnly bool, err error) {
+	if len(reqs) == 0 {
+		return false, errors.New("batch is empty")
+	} else if len(reqs) > maxBatchRequests {
+		return false, fmt.Errorf("batch cannot contain more than %d requests", maxBatchRequests)
+	}
+	readOnly = true
+	for i, req := range reqs {
+		switch req.Method {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return false, fmt.Errorf("request %d: unsupported method %q", i, req.Method)
+		}
+		u, err := url.Parse(req.Path)
+		if err != nil {
+			return false, fmt.Errorf("request %d: invalid path: %w", i, err)
+		} else if !strings.HasPrefix(u.Path, "/") || u.Host != "" {
+			return false, fmt.Errorf("request %d: path must be relative to the API root", i)
+		} else if u.Path == "/batch" || u.Path == v2Prefix+"/batch" {
+			return false, fmt.Errorf("request %d: batches cannot be nested", i)
+		}
+		readOnly = readOnly && req.Method == http.MethodGet
+	}
+	return readOnly, nil
+}
+
+// serveBatchRequest executes a sub-request of a batch. The sub-request
+// inherits the batch request's context, and with it the principal that
+// authenticated the batch. It is served by the same handler as the batch,
+// so it uses the batch's API version unless its path selects one, and the
+// batch's currency format.
+func (s *server) serveBatchRequest(parent *http.Request, req BatchRequest) BatchResponse {
+	path := req.Path
+	if requestAPIVersion(parent) >= APIVersion2 && path != v2Prefix && !strings.HasPrefix(path, v2Prefix+"/") {
+		path = v2Prefix + path
+	}
+	r, err := http.NewRequestWithContext(parent.Context(), req.Method, path, bytes.NewReader(req.Body))
+	if err != nil {
+		return BatchResponse{Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	r.RemoteAddr = parent.RemoteAddr
+	for _, h := range []string{CurrencyFormatHeader, "Accept-Language"} {
+		if v := parent.Header.Get(h); v != "" {
+			r.Header.Set(h, v)
+		}
+	}
+	if len(req.Body) > 0 {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, r)
+
+	resp := BatchResponse{Status: rec.Code}
+	body := bytes.TrimSpace(rec.Body.Bytes())
+	switch ct, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type")); {
+	case rec.Code < 200 || rec.Code >= 300:
+		resp.Error = string(body)
+	case len(body) == 0:
+	case ct == "application/json":
+		resp.Body = body
+	default:
+		// non-JSON responses, such as Sia-encoded responses, are
+		// base64-encoded
+		resp.Body, _ = json.Marshal(body)
+	}
+	return resp
+}
+
+func (s *server) batchHandler(jc jape.Context) {
+	var reqs []BatchRequest
+	if jc.Decode(&reqs) != nil {
+		return
+	}
+	for i := range reqs {
+		reqs[i].Method = strings.ToUpper(reqs[i].Method)
+	}
+	readOnly, err := validateBatch(reqs)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	// reads are repeated until the tip does not change during the batch, so
+	// every response reflects the same chain state. Writes are executed
+	// once.
+	var res BatchResult
+	for attempt := 1; ; attempt++ {
+		res = BatchResult{
+			Tip:       s.cm.Tip(),
+			Responses: make([]BatchResponse, len(reqs)),
+		}
+		for i, req := range reqs {
+			res.Responses[i] = s.serveBatchRequest(jc.Request, req)
+		}
+		res.Consistent = s.cm.Tip() == res.Tip
+		if res.Consistent || !readOnly || attempt >= maxBatchAttempts {
+			break
+		}
+	}
+	jc.Encode(res)
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+)
+
+// ContentTypeBinary is the content type of requests and responses in Sia's
+// canonical binary encoding.
+const ContentTypeBinary = "application/octet-stream"
+
+const (
+	// formatJSON and formatBinary are the values of the format query
+	// parameter.
+	formatJSON   = "json"
+	formatBinary = "binary"
+
+	// maxBinaryRequestSize is the maximum size of a Sia-encoded request
+	// body.
+	maxBinaryRequestSize = 10 << 20 // 10 MiB
+)
+
+// EncodeTo implements types.EncoderTo.
+func (r TxpoolBroadcastRequest) EncodeTo(e *types.Encoder) {
+	types.EncodeSlice(e, r.Transactions)
+	types.EncodeSlice(e, r.V2Transactions)
+}
+
+// DecodeFrom implements types.DecoderFrom.
+func (r *TxpoolBroadcastRequest) DecodeFrom(d *types.Decoder) {
+	types.DecodeSlice(d, &r.Transactions)
+	types.DecodeSlice(d, &r.V2Transactions)
+}
+
+// EncodeTo implements types.EncoderTo.
+func (r TxpoolTransactionsResponse) EncodeTo(e *types.Encoder) {
+	types.EncodeSlice(e, r.Transactions)
+	types.EncodeSlice(e, r.V2Transactions)
+}
+
+// DecodeFrom implements types.DecoderFrom.
+func (r *TxpoolTransactionsResponse) DecodeFrom(d *types.Decoder) {
+	types.DecodeSlice(d, &r.Transactions)
+	types.DecodeSlice(d, &r.V2Transactions)
+}
+
+// EncodeTo implements types.EncoderTo.
+func (u ApplyUpdate) EncodeTo(e *types.Encoder) {
+	u.Update.EncodeTo(e)
+	u.State.EncodeTo(e)
+	types.V2Block(u.Block).EncodeTo(e)
+}
+
+// DecodeFrom implements types.DecoderFrom. The state's network is not
+// encoded and must be set by the caller.
+func (u *ApplyUpdate) DecodeFrom(d *types.Decoder) {
+	u.Update.DecodeFrom(d)
+	u.State.DecodeFrom(d)
+	(*types.V2Block)(&u.Block).DecodeFrom(d)
+}
+
+// EncodeTo implements types.EncoderTo.
+func (u RevertUpdate) EncodeTo(e *types.Encoder) {
+	u.Update.EncodeTo(e)
+	u.State.EncodeTo(e)
+	types.V2Block(u.Block).EncodeTo(e)
+}
+
+// DecodeFrom implements types.DecoderFrom. The state's network is not
+// encoded and must be set by the caller.
+func (u *RevertUpdate) DecodeFrom(d *types.Decoder) {
+	u.Update.DecodeFrom(d)
+	u.State.DecodeFrom(d)
+	(*types.V2Block)(&u.Block).DecodeFrom(d)
+}
+
+// EncodeTo implements types.EncoderTo.
+func (r ConsensusUpdatesResponse) EncodeTo(e *types.Encoder) {
+	types.EncodeSlice(e, r.Applied)
+	types.EncodeSlice(e, r.Reverted)
+}
+
+// DecodeFrom implements types.DecoderFrom.
+func (r *ConsensusUpdatesResponse) DecodeFrom(d *types.Decoder) {
+	types.DecodeSlice(d, &r.Applied)
+	types.DecodeSlice(d, &r.Reverted)
+}
+
+// An encoderFunc implements types.EncoderTo with a function.
+type encoderFunc func(*types.Encoder)
+
+// EncodeTo implements types.EncoderTo.
+func (fn encoderFunc) EncodeTo(e *types.Encoder) { fn(e) }
+
+// A decoderFunc implements types.DecoderFrom with a function.
+type decoderFunc func(*types.Decoder)
+
+// DecodeFrom implements types.DecoderFrom.
+func (fn decoderFunc) DecodeFrom(d *types.Decoder) { fn(d) }
+
+// acceptsBinary returns true if the preferred media type of an Accept header
+// is ContentTypeBinary.
+func acceptsBinary(accept string) bool {
+	preferred, _, _ := strings.Cut(accept, ",")
+	mt, _, err := mime.ParseMediaType(preferred)
+	return err == nil && mt == ContentTypeBinary
+}
+
+// wantsBinary returns true if the request asks for a Sia-encoded response,
+// either with the format query parameter or by preferring ContentTypeBinary
+// in its Accept header. The query parameter takes precedence. If the format
+// is invalid, an error is written and ok is false.
+func wantsBinary(jc jape.Context) (binary, ok bool) {
+	format := formatJSON
+	if acceptsBinary(jc.Request.Header.Get("Accept")) {
+		format = formatBinary
+	}
+	if jc.DecodeForm("format", &format) != nil {
+		return false, false
+	}
+	switch format {
+	case formatJSON:
+		return false, true
+	case formatBinary:
+		return true, true
+	default:
+		jc.Error(fmt.Errorf("invalid format %q: must be %q or %q", format, formatJSON, formatBinary), http.StatusBadRequest)
+		return false, false
+	}
+}
+
+// isBinaryRequest returns true if the request body is Sia-encoded, either
+// because of its content type or its format query parameter.
+func isBinaryRequest(r *http.Request) bool {
+	if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && ct == ContentTypeBinary {
+		return true
+	}
+	return r.FormValue("format") == formatBinary
+}
+
+// encodeBinary writes v to the response in Sia's binary encoding.
+func encodeBinary(jc jape.Context, v types.EncoderTo) {
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	v.EncodeTo(e)
+	if err := e.Flush(); err != nil {
+		jc.Error(fmt.Errorf("failed to encode response: %w", err), http.StatusInternalServerError)
+		return
+	}
+	jc.ResponseWriter.Header().Set("Content-Type", ContentTypeBinary)
+	jc.ResponseWriter.Write(buf.Bytes())
+}
+
+// decodeBinary reads a Sia-encoded request body into v. If decoding fails,
+// an error is written to the response.
+func decodeBinary(jc jape.Context, v types.DecoderFrom) error {
+	d := types.NewDecoder(io.LimitedReader{R: jc.Request.Body, N: maxBinaryRequestSize})
+	v.DecodeFrom(d)
+	if err := d.Err(); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = errors.New("request body is truncated or too large")
+		}
+		return jc.Error(fmt.Errorf("failed to decode request: %w", err), http.StatusBadRequest)
+	}
+	return nil
+}
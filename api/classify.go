@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// exportPageSize is the number of events loaded at a time by the events
+// export.
+const exportPageSize = 1000
+
+func (req ClassificationRuleRequest) rule() wallet.ClassificationRule {
+	return wallet.ClassificationRule{
+		Name:         req.Name,
+		Category:     req.Category,
+		Types:        req.Types,
+		Counterparty: req.Counterparty,
+		Role:         req.Role,
+		MinAmount:    req.MinAmount,
+		MaxAmount:    req.MaxAmount,
+		Memo:         req.Memo,
+	}
+}
+
+// categorize sets the categories of annotated events and marks the ones that
+// only moved funds between wallets on this instance.
+func (s *server) categorize(annotated []wallet.AnnotatedEvent) ([]wallet.AnnotatedEvent, error) {
+	ids := make([]types.Hash256, 0, len(annotated))
+	for _, ae := range annotated {
+		ids = append(ids, ae.ID)
+	}
+	categories, err := s.wm.EventCategories(ids)
+	if err != nil {
+		return nil, err
+	}
+	enrichments, err := s.wm.EventEnrichments(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event enrichments: %w", err)
+	}
+	for i := range annotated {
+		annotated[i].Categories = categories[annotated[i].ID]
+		annotated[i].Enrichments = enrichments[annotated[i].ID]
+	}
+	return s.markInternal(annotated)
+}
+
+// markInternal marks the annotated events that only moved funds between
+// wallets on this instance.
+func (s *server) markInternal(annotated []wallet.AnnotatedEvent) ([]wallet.AnnotatedEvent, error) {
+	var addrs []types.Address
+	for _, ae := range annotated {
+		for _, cp := range ae.Counterparties {
+			addrs = append(addrs, cp.Address)
+		}
+	}
+	owners, err := s.wm.AddressWallets(addrs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address wallets: %w", err)
+	}
+	wallet.MarkInternal(annotated, owners)
+	return annotated, nil
+}
+
+func (s *server) classificationRulesHandlerGET(jc jape.Context) {
+	rules, err := s.wm.ClassificationRules()
+	if jc.Check("couldn't load classification rules", err) != nil {
+		return
+	}
+	jc.Encode(rules)
+}
+
+func (s *server) classificationRulesHandlerPOST(jc jape.Context) {
+	var req ClassificationRuleRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	r := req.rule()
+	if err := r.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	r, err := s.wm.AddClassificationRule(r)
+	if jc.Check("couldn't add classification rule", err) != nil {
+		return
+	}
+	jc.Encode(r)
+}
+
+func (s *server) classificationRulesIDHandlerDELETE(jc jape.Context) {
+	var id wallet.RuleID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.wm.DeleteClassificationRule(id)
+	if errors.Is(err, wallet.ErrRuleNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't delete classification rule", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsEventsExportHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var category string
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("category", &category) != nil {
+		return
+	}
+	format, err := requestCurrencyFormat(jc.Request, s.currencyFormat)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	formatCurrency := func(c types.Currency) string {
+		if format == CurrencyFormatSC {
+			return formatSC(c)
+		}
+		return c.ExactString()
+	}
+
+	// load the first page before writing the header so that errors can
+	// still be reported
+	events, err := s.wm.WalletCategoryEvents(jc.Request.Context(), id, category, 0, exportPageSize)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load events", err) != nil {
+		return
+	}
+
+	jc.ResponseWriter.Header().Set("Content-Type", "text/csv")
+	jc.ResponseWriter.Header().Set("Content-Disposition", `attachment; filename="wallet-`+strconv.FormatInt(int64(id), 10)+`-events.csv"`)
+	w := csv.NewWriter(jc.ResponseWriter)
+	w.Write([]string{"id", "type", "height", "timestamp", "maturityHeight", "inflow", "outflow", "categories"})
+	for offset := 0; ; {
+		annotated, err := s.categorize(wallet.AnnotateEvents(events, nil))
+		if err != nil {
+			// the response has already started, so the export is cut
+			// short instead
+			s.log.Error("failed to load event categories", zap.Error(err))
+			break
+		}
+		for _, ev := range annotated {
+			// change and internal transfers are left out of the flows so
+			// that totals do not count them as income and expense
+			inflow, outflow := wallet.ReportFlows(ev)
+			w.Write([]string{
+				ev.ID.String(),
+				ev.Type,
+				strconv.FormatUint(ev.Index.Height, 10),
+				ev.Timestamp.UTC().Format(time.RFC3339),
+				strconv.FormatUint(ev.MaturityHeight, 10),
+				formatCurrency(inflow),
+				formatCurrency(outflow),
+				strings.Join(ev.Categories, ";"),
+			})
+		}
+		if len(events) < exportPageSize {
+			break
+		}
+		offset += len(events)
+		events, err = s.wm.WalletCategoryEvents(jc.Request.Context(), id, category, offset, exportPageSize)
+		if err != nil {
+			s.log.Error("failed to load events", zap.Error(err))
+			break
+		}
+	}
+	w.Flush()
+}
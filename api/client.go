@@ -1,12 +1,42 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/approver"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/forecast"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/operations"
+	"go.thebigfile.com/walletd/paymenturi"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/reconcile"
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/tags"
+	"go.thebigfile.com/walletd/threshold"
+	"go.thebigfile.com/walletd/totp"
+	"go.thebigfile.com/walletd/transfers"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/triggers"
 	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/walletd/webhooks"
 	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/types"
 	"go.thebigfile.com/coreutils/chain"
@@ -14,7 +44,9 @@ import (
 
 // A Client provides methods for interacting with a walletd API server.
 type Client struct {
-	c jape.Client
+	c              *clientPool
+	binary         bool
+	healthInterval time.Duration
 
 	mu sync.Mutex // protects n
 	n  *consensus.Network
@@ -34,9 +66,15 @@ func (c *Client) getNetwork() (*consensus.Network, error) {
 	return c.n, nil
 }
 
-// BaseURL returns the URL of the walletd server.
+// BaseURL returns the URL of the primary walletd server.
 func (c *Client) BaseURL() string {
-	return c.c.BaseURL
+	return c.c.primary.url
+}
+
+// Close stops the client's health checks, if any.
+func (c *Client) Close() error {
+	c.c.stopHealthChecks()
+	return nil
 }
 
 // State returns information about the current state of the walletd daemon.
@@ -45,9 +83,70 @@ func (c *Client) State() (resp StateResponse, err error) {
 	return
 }
 
-// TxpoolBroadcast broadcasts a set of transaction to the network.
+// Enumerations returns the API's enumerations with display strings in the
+// given locale. If locale is empty, the server's default locale is used.
+func (c *Client) Enumerations(locale string) (resp EnumerationsResponse, err error) {
+	err = c.c.GET("/enums?locale="+url.QueryEscape(locale), &resp)
+	return
+}
+
+// GeneratePaymentURI validates a payment request and returns its canonical
+// URI.
+func (c *Client) GeneratePaymentURI(req paymenturi.URI) (resp PaymentURIResponse, err error) {
+	err = c.c.POST("/payment-uris", req, &resp)
+	return
+}
+
+// ParsePaymentURI parses and validates a payment URI.
+func (c *Client) ParsePaymentURI(uri string) (resp PaymentURIResponse, err error) {
+	err = c.c.POST("/payment-uris/parse", PaymentURIRequest{URI: uri}, &resp)
+	return
+}
+
+// Batch executes a batch of API requests and returns their responses in
+// order.
+func (c *Client) Batch(reqs []BatchRequest) (resp BatchResult, err error) {
+	err = c.c.POST("/batch", reqs, &resp)
+	return
+}
+
+// TxpoolBroadcast broadcasts a set of transaction to the network. If the set
+// requires approval, it is added to the approval queue and an error wrapping
+// ErrPendingApproval is returned.
 func (c *Client) TxpoolBroadcast(txns []types.Transaction, v2txns []types.V2Transaction) (err error) {
-	err = c.c.POST("/txpool/broadcast", TxpoolBroadcastRequest{txns, v2txns}, nil)
+	var pt treasury.PendingTransaction
+	if c.binary {
+		var buf []byte
+		var status int
+		buf, status, err = c.c.binaryRequest(http.MethodPost, "/txpool/broadcast", encodeToBytes(TxpoolBroadcastRequest{txns, v2txns}))
+		if err != nil {
+			return err
+		} else if status != http.StatusAccepted {
+			return nil
+		} else if err = json.Unmarshal(buf, &pt); err != nil {
+			return fmt.Errorf("failed to decode pending transaction: %w", err)
+		}
+		return fmt.Errorf("transaction set %d: %w", pt.ID, ErrPendingApproval)
+	}
+	err = c.c.POST("/txpool/broadcast", TxpoolBroadcastRequest{txns, v2txns}, &pt)
+	if errors.Is(err, io.EOF) {
+		// the set was broadcast; no response body
+		return nil
+	} else if err == nil {
+		return fmt.Errorf("transaction set %d: %w", pt.ID, ErrPendingApproval)
+	}
+	return
+}
+
+// DecodeTransaction returns an annotated breakdown of a v1 transaction.
+func (c *Client) DecodeTransaction(txn types.Transaction) (resp DecodedTransaction, err error) {
+	err = c.c.POST("/transactions/decode", TransactionDecodeRequest{Transaction: &txn}, &resp)
+	return
+}
+
+// DecodeV2Transaction returns an annotated breakdown of a v2 transaction.
+func (c *Client) DecodeV2Transaction(txn types.V2Transaction) (resp DecodedTransaction, err error) {
+	err = c.c.POST("/transactions/decode", TransactionDecodeRequest{V2Transaction: &txn}, &resp)
 	return
 }
 
@@ -65,6 +164,14 @@ func (c *Client) TxpoolParents(txn types.Transaction) (resp []types.Transaction,
 	return
 }
 
+// TxpoolGraph returns the IDs of a set of unconfirmed transactions, their
+// dependencies on each other and on the pool, and an order to broadcast them
+// in.
+func (c *Client) TxpoolGraph(txns []types.Transaction, v2txns []types.V2Transaction) (resp TxpoolGraphResponse, err error) {
+	err = c.c.POST("/txpool/graph", TxpoolBroadcastRequest{txns, v2txns}, &resp)
+	return
+}
+
 // TxpoolFee returns the recommended fee (per weight unit) to ensure a high
 // probability of inclusion in the next block.
 func (c *Client) TxpoolFee() (resp types.Currency, err error) {
@@ -85,6 +192,19 @@ func (c *Client) ConsensusIndex(height uint64) (resp types.ChainIndex, err error
 	return
 }
 
+// ConsensusBlock returns the block with the given ID.
+func (c *Client) ConsensusBlock(id types.BlockID) (resp types.Block, err error) {
+	err = c.c.GET(fmt.Sprintf("/consensus/blocks/%v", id), &resp)
+	return
+}
+
+// ConsensusBlockRaw returns the block with the given ID in Sia's canonical
+// binary encoding.
+func (c *Client) ConsensusBlockRaw(id types.BlockID) ([]byte, error) {
+	buf, _, err := c.c.binaryRequest(http.MethodGet, fmt.Sprintf("/consensus/blocks/%v", id), nil)
+	return buf, err
+}
+
 // ConsensusUpdates returns at most n consensus updates that have occurred since
 // the specified index
 func (c *Client) ConsensusUpdates(index types.ChainIndex, limit int) ([]chain.RevertUpdate, []chain.ApplyUpdate, error) {
@@ -95,7 +215,13 @@ func (c *Client) ConsensusUpdates(index types.ChainIndex, limit int) ([]chain.Re
 	}
 
 	var resp ConsensusUpdatesResponse
-	if err := c.c.GET(fmt.Sprintf("/consensus/updates/%s?limit=%d", indexBuf, limit), &resp); err != nil {
+	route := fmt.Sprintf("/consensus/updates/%s?limit=%d", indexBuf, limit)
+	if c.binary {
+		err = getBinary(c.c, route, &resp)
+	} else {
+		err = c.c.GET(route, &resp)
+	}
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -128,6 +254,22 @@ func (c *Client) ConsensusUpdates(index types.ChainIndex, limit int) ([]chain.Re
 	return reverted, applied, nil
 }
 
+// ConsensusStats returns block interval, difficulty, and hashrate statistics
+// over windows of the given number of blocks ending at the tip. If no
+// windows are given, the server's defaults are used.
+func (c *Client) ConsensusStats(windows ...uint64) (resp ConsensusStatsResponse, err error) {
+	path := "/consensus/stats"
+	if len(windows) > 0 {
+		strs := make([]string, len(windows))
+		for i, w := range windows {
+			strs[i] = strconv.FormatUint(w, 10)
+		}
+		path += "?windows=" + strings.Join(strs, ",")
+	}
+	err = c.c.GET(path, &resp)
+	return
+}
+
 // ConsensusTipState returns the current tip state.
 func (c *Client) ConsensusTipState() (resp consensus.State, err error) {
 	if err = c.c.GET("/consensus/tipstate", &resp); err != nil {
@@ -143,6 +285,12 @@ func (c *Client) ConsensusTip() (resp types.ChainIndex, err error) {
 	return
 }
 
+// SyncerStatus returns the status of the syncer and the local clock.
+func (c *Client) SyncerStatus() (resp SyncerStatusResponse, err error) {
+	err = c.c.GET("/syncer/status", &resp)
+	return
+}
+
 // SyncerPeers returns the current peers of the syncer.
 func (c *Client) SyncerPeers() (resp []GatewayPeer, err error) {
 	err = c.c.GET("/syncer/peers", &resp)
@@ -157,22 +305,186 @@ func (c *Client) SyncerConnect(addr string) (err error) {
 
 // SyncerBroadcastBlock broadcasts a block to all peers.
 func (c *Client) SyncerBroadcastBlock(b types.Block) (err error) {
+	if c.binary {
+		return c.SyncerBroadcastBlockRaw(encodeToBytes(types.V2Block(b)))
+	}
 	err = c.c.POST("/syncer/broadcast/block", b, nil)
 	return
 }
 
+// SyncerBroadcastBlockRaw broadcasts a block in Sia's canonical binary
+// encoding to all peers.
+func (c *Client) SyncerBroadcastBlockRaw(buf []byte) error {
+	_, _, err := c.c.binaryRequest(http.MethodPost, "/syncer/broadcast/block", buf)
+	return err
+}
+
 // Wallets returns the set of tracked wallets.
 func (c *Client) Wallets() (ws []wallet.Wallet, err error) {
 	err = c.c.GET("/wallets", &ws)
 	return
 }
 
+// getWithTotal performs a GET request like jape.Client.GET and returns the
+// total count of a paginated response.
+func (c *Client) getWithTotal(route string, resp any) (total int, err error) {
+	err = c.c.do(http.MethodGet, func(jc jape.Client) error {
+		req, err := http.NewRequest(http.MethodGet, jc.BaseURL+route, nil)
+		if err != nil {
+			return err
+		} else if jc.Password != "" {
+			req.SetBasicAuth("", jc.Password)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer io.Copy(io.Discard, r.Body)
+		defer r.Body.Close()
+		if !(200 <= r.StatusCode && r.StatusCode < 300) {
+			msg, _ := io.ReadAll(r.Body)
+			return errors.New(string(msg))
+		} else if err := json.NewDecoder(r.Body).Decode(resp); err != nil {
+			return err
+		}
+		total, err = strconv.Atoi(r.Header.Get(HeaderTotalCount))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s header: %w", HeaderTotalCount, err)
+		}
+		return nil
+	})
+	return
+}
+
+// encodeToBytes returns the Sia encoding of v.
+func encodeToBytes(v types.EncoderTo) []byte {
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	v.EncodeTo(e)
+	e.Flush() // writes to a bytes.Buffer cannot fail
+	return buf.Bytes()
+}
+
+// binaryRequest performs a request with a Sia-encoded body, if any, asking
+// for a Sia-encoded response. It returns the raw response body and status
+// code. An error is returned if a 200 response is not Sia-encoded, e.g.
+// because the server does not support binary encoding for the route.
+func binaryRequest(jc jape.Client, method, route string, body []byte) ([]byte, int, error) {
+	req, err := http.NewRequest(method, jc.BaseURL+route, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	} else if jc.Password != "" {
+		req.SetBasicAuth("", jc.Password)
+	}
+	req.Header.Set("Accept", ContentTypeBinary)
+	if body != nil {
+		req.Header.Set("Content-Type", ContentTypeBinary)
+	}
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Body.Close()
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, 0, err
+	} else if !(200 <= r.StatusCode && r.StatusCode < 300) {
+		return nil, 0, errors.New(strings.TrimSpace(string(buf)))
+	} else if r.StatusCode == http.StatusOK && len(buf) > 0 {
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct != ContentTypeBinary {
+			return nil, 0, fmt.Errorf("server responded with %q instead of binary encoding", ct)
+		}
+	}
+	return buf, r.StatusCode, nil
+}
+
+// headerRequest performs a JSON request like jape.Client with additional
+// request headers.
+func headerRequest(jc jape.Client, method, route string, header http.Header, d, r any) error {
+	var body io.Reader
+	if d != nil {
+		js, _ := json.Marshal(d)
+		body = bytes.NewReader(js)
+	}
+	req, err := http.NewRequest(method, jc.BaseURL+route, body)
+	if err != nil {
+		return err
+	} else if jc.Password != "" {
+		req.SetBasicAuth("", jc.Password)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(io.Discard, resp.Body)
+	defer resp.Body.Close()
+	if !(200 <= resp.StatusCode && resp.StatusCode < 300) {
+		buf, _ := io.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(buf)))
+	} else if r == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(r)
+}
+
+// getBinary performs a GET request for a Sia-encoded response and decodes it
+// into v.
+func getBinary(p *clientPool, route string, v types.DecoderFrom) error {
+	buf, _, err := p.binaryRequest(http.MethodGet, route, nil)
+	if err != nil {
+		return err
+	}
+	d := types.NewBufDecoder(buf)
+	v.DecodeFrom(d)
+	if err := d.Err(); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// FilterWallets returns a page of the wallets matching the filter and the
+// total number of matching wallets. The filter's tenant is ignored; tenants
+// can only list their own wallets.
+func (c *Client) FilterWallets(f wallet.WalletFilter) (ws []wallet.Wallet, total int, err error) {
+	v := url.Values{}
+	if f.NamePrefix != "" {
+		v.Set("namePrefix", f.NamePrefix)
+	}
+	if f.SortBy != "" {
+		v.Set("sortBy", f.SortBy)
+	}
+	if f.Descending {
+		v.Set("order", "desc")
+	}
+	for _, mf := range f.Metadata {
+		v.Add("meta."+strings.Join(mf.Path, "."), string(mf.Value))
+	}
+	if f.Offset > 0 {
+		v.Set("offset", strconv.Itoa(f.Offset))
+	}
+	if f.Limit > 0 {
+		v.Set("limit", strconv.Itoa(f.Limit))
+	}
+	total, err = c.getWithTotal("/wallets?"+v.Encode(), &ws)
+	return
+}
+
 // AddWallet adds a wallet to the set of tracked wallets.
 func (c *Client) AddWallet(uw WalletUpdateRequest) (w wallet.Wallet, err error) {
 	err = c.c.POST("/wallets", uw, &w)
 	return
 }
 
+// ImportWallet creates a wallet from a wallet definition exported by another
+// Sia wallet.
+func (c *Client) ImportWallet(req WalletImportRequest) (resp WalletImportResponse, err error) {
+	err = c.c.POST("/wallets/import", req, &resp)
+	return
+}
+
 // UpdateWallet updates a wallet.
 func (c *Client) UpdateWallet(id wallet.ID, uw WalletUpdateRequest) (w wallet.Wallet, err error) {
 	err = c.c.POST(fmt.Sprintf("/wallets/%v", id), uw, &w)
@@ -186,9 +498,89 @@ func (c *Client) RemoveWallet(id wallet.ID) (err error) {
 	return
 }
 
+// Groups returns all wallet groups.
+func (c *Client) Groups() (groups []wallet.Group, err error) {
+	err = c.c.GET("/groups", &groups)
+	return
+}
+
+// AddGroup adds a wallet group.
+func (c *Client) AddGroup(req GroupRequest) (g wallet.Group, err error) {
+	err = c.c.POST("/groups", req, &g)
+	return
+}
+
+// UpdateGroup updates a wallet group.
+func (c *Client) UpdateGroup(id wallet.GroupID, req GroupRequest) (g wallet.Group, err error) {
+	err = c.c.POST(fmt.Sprintf("/groups/%v", id), req, &g)
+	return
+}
+
+// RemoveGroup deletes a wallet group. Its wallets are unassigned and its
+// subgroups become top-level groups.
+func (c *Client) RemoveGroup(id wallet.GroupID) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/groups/%v", id))
+	return
+}
+
+// Templates returns all wallet templates.
+func (c *Client) Templates() (templates []wallet.Template, err error) {
+	err = c.c.GET("/wallet-templates", &templates)
+	return
+}
+
+// Template returns a wallet template.
+func (c *Client) Template(id wallet.TemplateID) (t wallet.Template, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallet-templates/%v", id), &t)
+	return
+}
+
+// AddTemplate adds a wallet template.
+func (c *Client) AddTemplate(req TemplateRequest) (t wallet.Template, err error) {
+	err = c.c.POST("/wallet-templates", req, &t)
+	return
+}
+
+// UpdateTemplate updates a wallet template. Existing wallets created from
+// the template are not affected.
+func (c *Client) UpdateTemplate(id wallet.TemplateID, req TemplateRequest) (t wallet.Template, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallet-templates/%v", id), req, &t)
+	return
+}
+
+// RemoveTemplate deletes a wallet template.
+func (c *Client) RemoveTemplate(id wallet.TemplateID) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallet-templates/%v", id))
+	return
+}
+
+// ClassificationRules returns every event classification rule.
+func (c *Client) ClassificationRules() (rules []wallet.ClassificationRule, err error) {
+	err = c.c.GET("/classification-rules", &rules)
+	return
+}
+
+// AddClassificationRule adds an event classification rule. The rule applies
+// to events indexed after it is added.
+func (c *Client) AddClassificationRule(req ClassificationRuleRequest) (r wallet.ClassificationRule, err error) {
+	err = c.c.POST("/classification-rules", req, &r)
+	return
+}
+
+// RemoveClassificationRule deletes an event classification rule.
+func (c *Client) RemoveClassificationRule(id wallet.RuleID) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/classification-rules/%v", id))
+	return
+}
+
+// Group returns a client for interacting with the specified wallet group.
+func (c *Client) Group(id wallet.GroupID) *GroupClient {
+	return &GroupClient{c: c.c, id: id}
+}
+
 // Wallet returns a client for interacting with the specified wallet.
 func (c *Client) Wallet(id wallet.ID) *WalletClient {
-	return &WalletClient{c: c.c, id: id}
+	return &WalletClient{c: c.c, id: id, binary: c.binary}
 }
 
 // ScanStatus returns the current state of wallet scanning.
@@ -203,6 +595,53 @@ func (c *Client) Rescan(height uint64) (err error) {
 	return
 }
 
+// StartRescan rescans the blockchain starting from the specified height and
+// returns the operation running the rescan.
+func (c *Client) StartRescan(height uint64) (resp operations.Operation, err error) {
+	err = c.c.POST("/rescan", height, &resp)
+	return
+}
+
+// Operations returns the node's long-running operations, newest first. If
+// typ is not empty, only operations of that type are returned.
+func (c *Client) Operations(typ string) (resp []operations.Operation, err error) {
+	err = c.c.GET("/operations?type="+url.QueryEscape(typ), &resp)
+	return
+}
+
+// Operation returns the state of a long-running operation.
+func (c *Client) Operation(id types.Hash256) (resp operations.Operation, err error) {
+	err = c.c.GET(fmt.Sprintf("/operations/%v", id), &resp)
+	return
+}
+
+// CancelOperation cancels a running operation.
+func (c *Client) CancelOperation(id types.Hash256) (resp operations.Operation, err error) {
+	err = c.c.headerRequest(http.MethodDelete, fmt.Sprintf("/operations/%v", id), nil, nil, &resp)
+	return
+}
+
+// PendingReorg returns the reorg waiting for operator approval. It returns
+// an error if no reorg is pending.
+func (c *Client) PendingReorg() (resp wallet.PendingReorg, err error) {
+	err = c.c.GET("/system/reorg", &resp)
+	return
+}
+
+// ApproveReorg approves the reorg waiting for operator approval, resuming
+// wallet syncing.
+func (c *Client) ApproveReorg() (err error) {
+	err = c.c.POST("/system/reorg/approve", nil, nil)
+	return
+}
+
+// Attestation returns the node's signed attestation of its current wallet
+// state. Callers should check the attestation's public key and signature.
+func (c *Client) Attestation() (resp wallet.Attestation, err error) {
+	err = c.c.GET("/system/attestation", &resp)
+	return
+}
+
 // AddressBalance returns the balance of a single address.
 func (c *Client) AddressBalance(addr types.Address) (resp BalanceResponse, err error) {
 	err = c.c.GET(fmt.Sprintf("/addresses/%v/balance", addr), &resp)
@@ -210,136 +649,1201 @@ func (c *Client) AddressBalance(addr types.Address) (resp BalanceResponse, err e
 }
 
 // AddressEvents returns the events of a single address.
-func (c *Client) AddressEvents(addr types.Address, offset, limit int) (resp []wallet.Event, err error) {
+func (c *Client) AddressEvents(addr types.Address, offset, limit int) (resp []wallet.AnnotatedEvent, err error) {
 	err = c.c.GET(fmt.Sprintf("/addresses/%v/events?offset=%d&limit=%d", addr, offset, limit), &resp)
 	return
 }
 
+// AddressEventsSince returns the events of a single address confirmed in
+// blocks after the given height, oldest first.
+func (c *Client) AddressEventsSince(addr types.Address, height uint64, offset, limit int) (resp []wallet.AnnotatedEvent, err error) {
+	err = c.c.GET(fmt.Sprintf("/addresses/%v/events?sinceHeight=%d&offset=%d&limit=%d", addr, height, offset, limit), &resp)
+	return
+}
+
 // AddressUnconfirmedEvents returns the unconfirmed events for a single address.
-func (c *Client) AddressUnconfirmedEvents(addr types.Address) (resp []wallet.Event, err error) {
+func (c *Client) AddressUnconfirmedEvents(addr types.Address) (resp []wallet.AnnotatedEvent, err error) {
 	err = c.c.GET(fmt.Sprintf("/addresses/%v/events/unconfirmed", addr), &resp)
 	return
 }
 
 // AddressSiacoinOutputs returns the unspent siacoin outputs for an address.
 func (c *Client) AddressSiacoinOutputs(addr types.Address, offset, limit int) (resp []types.SiacoinElement, err error) {
-	err = c.c.GET(fmt.Sprintf("/addresses/%v/outputs/siacoin?offset=%d&limit=%d", addr, offset, limit), &resp)
+	return c.AddressConfirmedSiacoinOutputs(addr, 0, offset, limit)
+}
+
+// AddressConfirmedSiacoinOutputs returns the unspent siacoin outputs for an
+// address that have at least minConfirmations confirmations.
+func (c *Client) AddressConfirmedSiacoinOutputs(addr types.Address, minConfirmations uint64, offset, limit int) (resp []types.SiacoinElement, err error) {
+	route := fmt.Sprintf("/addresses/%v/outputs/siacoin?offset=%d&limit=%d&minConfirmations=%d", addr, offset, limit, minConfirmations)
+	if c.binary {
+		err = getBinary(c.c, route, decoderFunc(func(d *types.Decoder) { types.DecodeSlice(d, &resp) }))
+		return
+	}
+	err = c.c.GET(route, &resp)
+	return
+}
+
+// SiacoinOutput returns the unspent siacoin output with the given ID.
+func (c *Client) SiacoinOutput(id types.SiacoinOutputID) (resp types.SiacoinElement, err error) {
+	err = c.c.GET(fmt.Sprintf("/outputs/siacoin/%v", id), &resp)
+	return
+}
+
+// SiafundOutput returns the unspent siafund output with the given ID.
+func (c *Client) SiafundOutput(id types.SiafundOutputID) (resp types.SiafundElement, err error) {
+	err = c.c.GET(fmt.Sprintf("/outputs/siafund/%v", id), &resp)
 	return
 }
 
 // AddressSiafundOutputs returns the unspent siafund outputs for an address.
 func (c *Client) AddressSiafundOutputs(addr types.Address, offset, limit int) (resp []types.SiafundElement, err error) {
-	err = c.c.GET(fmt.Sprintf("/addresses/%v/outputs/siafund?offset=%d&limit=%d", addr, offset, limit), &resp)
+	return c.AddressConfirmedSiafundOutputs(addr, 0, offset, limit)
+}
+
+// AddressConfirmedSiafundOutputs returns the unspent siafund outputs for an
+// address that have at least minConfirmations confirmations.
+func (c *Client) AddressConfirmedSiafundOutputs(addr types.Address, minConfirmations uint64, offset, limit int) (resp []types.SiafundElement, err error) {
+	route := fmt.Sprintf("/addresses/%v/outputs/siafund?offset=%d&limit=%d&minConfirmations=%d", addr, offset, limit, minConfirmations)
+	if c.binary {
+		err = getBinary(c.c, route, decoderFunc(func(d *types.Decoder) { types.DecodeSlice(d, &resp) }))
+		return
+	}
+	err = c.c.GET(route, &resp)
+	return
+}
+
+// VerifyMessage checks that a message was signed by the key controlling its
+// address.
+func (c *Client) VerifyMessage(sm signer.SignedMessage) (resp VerifyMessageResponse, err error) {
+	err = c.c.POST("/verify-message", sm, &resp)
 	return
 }
 
-// Event returns the event with the specified ID.
-func (c *Client) Event(id types.Hash256) (resp wallet.Event, err error) {
+// Event returns the event with the specified ID. Events removed from the
+// chain by a reorg are returned with Reverted set.
+func (c *Client) Event(id types.Hash256) (resp wallet.AnnotatedEvent, err error) {
 	err = c.c.GET(fmt.Sprintf("/events/%v", id), &resp)
 	return
 }
 
-// A WalletClient provides methods for interacting with a particular wallet on a
-// walletd API server.
-type WalletClient struct {
-	c  jape.Client
-	id wallet.ID
+// EventRawTransaction returns the full transaction of an event. It fails if
+// the node only stored a summary of the event.
+func (c *Client) EventRawTransaction(id types.Hash256) (resp wallet.RawTransaction, err error) {
+	err = c.c.GET(fmt.Sprintf("/events/%v/raw", id), &resp)
+	return
 }
 
-// AddAddress adds the specified address and associated metadata to the
-// wallet.
-func (c *WalletClient) AddAddress(a wallet.Address) (err error) {
-	err = c.c.PUT(fmt.Sprintf("/wallets/%v/addresses", c.id), a)
+// Alerts returns the active alerts, newest first. A zero severity returns
+// alerts of any severity.
+func (c *Client) Alerts(severity alerts.Severity, offset, limit int) (active []alerts.Alert, err error) {
+	route := fmt.Sprintf("/alerts?offset=%d&limit=%d", offset, limit)
+	if severity != 0 {
+		route += "&severity=" + severity.String()
+	}
+	err = c.c.GET(route, &active)
 	return
 }
 
-// RemoveAddress removes the specified address from the wallet.
-func (c *WalletClient) RemoveAddress(addr types.Address) (err error) {
-	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/addresses/%v", c.id, addr))
+// DismissAlerts dismisses the alerts with the given IDs.
+func (c *Client) DismissAlerts(ids ...types.Hash256) (err error) {
+	err = c.c.POST("/alerts/dismiss", ids, nil)
 	return
 }
 
-// Addresses the addresses controlled by the wallet.
-func (c *WalletClient) Addresses() (resp []wallet.Address, err error) {
-	err = c.c.GET(fmt.Sprintf("/wallets/%v/addresses", c.id), &resp)
+// Tags returns the known-address directory.
+func (c *Client) Tags() (resp []tags.Tag, err error) {
+	err = c.c.GET("/tags", &resp)
 	return
 }
 
-// Balance returns the current wallet balance.
-func (c *WalletClient) Balance() (resp BalanceResponse, err error) {
-	err = c.c.GET(fmt.Sprintf("/wallets/%v/balance", c.id), &resp)
+// Signers returns the names of the configured external signers.
+func (c *Client) Signers() (resp []string, err error) {
+	err = c.c.GET("/signers", &resp)
 	return
 }
 
-// Events returns all events relevant to the wallet.
-func (c *WalletClient) Events(offset, limit int) (resp []wallet.Event, err error) {
-	err = c.c.GET(fmt.Sprintf("/wallets/%v/events?offset=%d&limit=%d", c.id, offset, limit), &resp)
+// ThresholdGroups returns all threshold signing groups.
+func (c *Client) ThresholdGroups() (resp []threshold.Group, err error) {
+	err = c.c.GET("/threshold/groups", &resp)
 	return
 }
 
-// UnconfirmedEvents returns all unconfirmed events relevant to the wallet.
-func (c *WalletClient) UnconfirmedEvents() (resp []wallet.Event, err error) {
-	err = c.c.GET(fmt.Sprintf("/wallets/%v/events/unconfirmed", c.id), &resp)
+// AddThresholdGroup adds a threshold signing group for a key generated by
+// the group's participants.
+func (c *Client) AddThresholdGroup(req ThresholdGroupRequest) (resp threshold.Group, err error) {
+	err = c.c.POST("/threshold/groups", req, &resp)
 	return
 }
 
-// SiacoinOutputs returns the set of unspent outputs controlled by the wallet.
-func (c *WalletClient) SiacoinOutputs(offset, limit int) (sc []types.SiacoinElement, err error) {
-	err = c.c.GET(fmt.Sprintf("/wallets/%v/outputs/siacoin?offset=%d&limit=%d", c.id, offset, limit), &sc)
+// ThresholdGroup returns a threshold signing group.
+func (c *Client) ThresholdGroup(id threshold.GroupID) (resp threshold.Group, err error) {
+	err = c.c.GET(fmt.Sprintf("/threshold/groups/%d", id), &resp)
 	return
 }
 
-// SiafundOutputs returns the set of unspent outputs controlled by the wallet.
-func (c *WalletClient) SiafundOutputs(offset, limit int) (sf []types.SiafundElement, err error) {
-	err = c.c.GET(fmt.Sprintf("/wallets/%v/outputs/siafund?offset=%d&limit=%d", c.id, offset, limit), &sf)
+// RemoveThresholdGroup removes a threshold signing group.
+func (c *Client) RemoveThresholdGroup(id threshold.GroupID) error {
+	return c.c.DELETE(fmt.Sprintf("/threshold/groups/%d", id))
+}
+
+// RegisterThresholdParticipant registers a participant with a threshold
+// signing group.
+func (c *Client) RegisterThresholdParticipant(groupID threshold.GroupID, id uint16, name string) (resp threshold.Group, err error) {
+	err = c.c.POST(fmt.Sprintf("/threshold/groups/%d/participants", groupID), ThresholdParticipantRequest{ID: id, Name: name}, &resp)
 	return
 }
 
-// Reserve reserves a set outputs for use in a transaction.
-func (c *WalletClient) Reserve(sc []types.SiacoinOutputID, sf []types.SiafundOutputID, duration time.Duration) (err error) {
-	err = c.c.POST(fmt.Sprintf("/wallets/%v/reserve", c.id), WalletReserveRequest{
-		SiacoinOutputs: sc,
-		SiafundOutputs: sf,
-		Duration:       duration,
-	}, nil)
+// ThresholdSessions returns the active threshold signing sessions.
+func (c *Client) ThresholdSessions() (resp []threshold.Session, err error) {
+	err = c.c.GET("/threshold/sessions", &resp)
 	return
 }
 
-// Release releases a set of previously-reserved outputs.
-func (c *WalletClient) Release(sc []types.SiacoinOutputID, sf []types.SiafundOutputID) (err error) {
-	err = c.c.POST(fmt.Sprintf("/wallets/%v/release", c.id), WalletReleaseRequest{
-		SiacoinOutputs: sc,
-		SiafundOutputs: sf,
-	}, nil)
+// StartThresholdSession starts a threshold signing session for the inputs
+// of txn controlled by the group's key.
+func (c *Client) StartThresholdSession(groupID threshold.GroupID, txn types.V2Transaction) (resp threshold.Session, err error) {
+	err = c.c.POST("/threshold/sessions", ThresholdSessionRequest{GroupID: groupID, Transaction: txn}, &resp)
 	return
 }
 
-// Fund funds a siacoin transaction.
-func (c *WalletClient) Fund(txn types.Transaction, amount types.Currency, changeAddr types.Address) (resp WalletFundResponse, err error) {
-	err = c.c.POST(fmt.Sprintf("/wallets/%v/fund", c.id), WalletFundRequest{
-		Transaction:   txn,
-		Amount:        amount,
-		ChangeAddress: changeAddr,
-	}, &resp)
+// ThresholdSession returns a threshold signing session.
+func (c *Client) ThresholdSession(id types.Hash256) (resp threshold.Session, err error) {
+	err = c.c.GET(fmt.Sprintf("/threshold/sessions/%v", id), &resp)
 	return
 }
 
-// FundSF funds a siafund transaction.
-func (c *WalletClient) FundSF(txn types.Transaction, amount uint64, changeAddr, claimAddr types.Address) (resp WalletFundResponse, err error) {
-	err = c.c.POST(fmt.Sprintf("/wallets/%v/fundsf", c.id), WalletFundSFRequest{
-		Transaction:   txn,
-		Amount:        amount,
-		ChangeAddress: changeAddr,
-		ClaimAddress:  claimAddr,
-	}, &resp)
+// AddThresholdCommitment submits a participant's nonce commitments to a
+// threshold signing session.
+func (c *Client) AddThresholdCommitment(id types.Hash256, commitment threshold.Commitment) (resp threshold.Session, err error) {
+	err = c.c.POST(fmt.Sprintf("/threshold/sessions/%v/commitments", id), commitment, &resp)
 	return
 }
 
-// NewClient returns a client that communicates with a walletd server listening
-// on the specified address.
-func NewClient(addr, password string) *Client {
-	return &Client{c: jape.Client{
-		BaseURL:  addr,
-		Password: password,
-	}}
+// AddThresholdShare submits a participant's signature share to a threshold
+// signing session.
+func (c *Client) AddThresholdShare(id types.Hash256, share threshold.Share) (resp threshold.Session, err error) {
+	err = c.c.POST(fmt.Sprintf("/threshold/sessions/%v/shares", id), share, &resp)
+	return
+}
+
+// SetTag manually tags an address, replacing any existing tag.
+func (c *Client) SetTag(addr types.Address, label, category string) (err error) {
+	err = c.c.PUT("/tags", TagRequest{
+		Address:  addr,
+		Label:    label,
+		Category: category,
+	})
+	return
+}
+
+// RemoveTag removes the tag of an address.
+func (c *Client) RemoveTag(addr types.Address) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/tags/%v", addr))
+	return
+}
+
+// ImportTags replaces the directory's feed tags with tt. Manually added tags
+// are kept.
+func (c *Client) ImportTags(tt []tags.Tag) (err error) {
+	err = c.c.POST("/tags/import", tt, nil)
+	return
+}
+
+// Usage returns each tenant's resource usage and the API calls made since
+// the given time.
+func (c *Client) Usage(since time.Time) (resp UsageResponse, err error) {
+	err = c.c.GET("/system/usage?since="+url.QueryEscape(since.Format(time.RFC3339)), &resp)
+	return
+}
+
+// Transfer returns a transfer between two wallets.
+func (c *Client) Transfer(id int64) (resp transfers.Transfer, err error) {
+	err = c.c.GET(fmt.Sprintf("/transfers/%d", id), &resp)
+	return
+}
+
+// Jobs returns the state of every background job.
+func (c *Client) Jobs() (resp []jobs.Job, err error) {
+	err = c.c.GET("/system/jobs", &resp)
+	return
+}
+
+// TriggerJob runs a background job as soon as possible, even if it is
+// paused.
+func (c *Client) TriggerJob(name string) (err error) {
+	err = c.c.POST("/system/jobs/"+name+"/trigger", nil, nil)
+	return
+}
+
+// PauseJob stops a background job from running on its schedule.
+func (c *Client) PauseJob(name string) (resp jobs.Job, err error) {
+	err = c.c.POST("/system/jobs/"+name+"/pause", nil, &resp)
+	return
+}
+
+// ResumeJob resumes a paused background job.
+func (c *Client) ResumeJob(name string) (resp jobs.Job, err error) {
+	err = c.c.POST("/system/jobs/"+name+"/resume", nil, &resp)
+	return
+}
+
+// Webhooks returns all registered webhooks.
+func (c *Client) Webhooks() (resp []webhooks.Webhook, err error) {
+	err = c.c.GET("/webhooks", &resp)
+	return
+}
+
+// AddWebhook registers a webhook that receives events from the given scopes.
+func (c *Client) AddWebhook(callbackURL string, scopes []string) (resp webhooks.Webhook, err error) {
+	err = c.c.POST("/webhooks", WebhookRequest{
+		CallbackURL: callbackURL,
+		Scopes:      scopes,
+	}, &resp)
+	return
+}
+
+// RemoveWebhook removes a webhook.
+func (c *Client) RemoveWebhook(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/webhooks/%d", id))
+	return
+}
+
+// Triggers returns all chain triggers.
+func (c *Client) Triggers() (resp []triggers.Trigger, err error) {
+	err = c.c.GET("/triggers", &resp)
+	return
+}
+
+// AddHeightTrigger adds a trigger that fires once when the tip reaches the
+// height. Webhooks subscribed to the trigger's scope receive the event.
+func (c *Client) AddHeightTrigger(name string, height uint64) (resp triggers.Trigger, err error) {
+	err = c.c.POST("/triggers", TriggerRequest{Name: name, Height: height}, &resp)
+	return
+}
+
+// AddIntervalTrigger adds a trigger that fires whenever the tip reaches a
+// multiple of the interval.
+func (c *Client) AddIntervalTrigger(name string, interval uint64) (resp triggers.Trigger, err error) {
+	err = c.c.POST("/triggers", TriggerRequest{Name: name, Interval: interval}, &resp)
+	return
+}
+
+// RemoveTrigger removes a chain trigger.
+func (c *Client) RemoveTrigger(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/triggers/%d", id))
+	return
+}
+
+// Approvals returns transaction sets in the approval queue with the given
+// status. An empty status returns sets with any status.
+func (c *Client) Approvals(status string, offset, limit int) (resp []treasury.PendingTransaction, err error) {
+	err = c.c.GET(fmt.Sprintf("/approvals?status=%s&offset=%d&limit=%d", status, offset, limit), &resp)
+	return
+}
+
+// Approval returns a transaction set in the approval queue.
+func (c *Client) Approval(id int64) (resp treasury.PendingTransaction, err error) {
+	err = c.c.GET(fmt.Sprintf("/approvals/%d", id), &resp)
+	return
+}
+
+// Approve approves and broadcasts a transaction set in the approval queue. It
+// must be called with a different credential than the one that submitted the
+// set.
+func (c *Client) Approve(id int64) (resp treasury.PendingTransaction, err error) {
+	err = c.c.POST(fmt.Sprintf("/approvals/%d/approve", id), nil, &resp)
+	return
+}
+
+// Reject rejects a transaction set in the approval queue.
+func (c *Client) Reject(id int64) (resp treasury.PendingTransaction, err error) {
+	err = c.c.POST(fmt.Sprintf("/approvals/%d/reject", id), nil, &resp)
+	return
+}
+
+// Approvers returns all paired approver apps.
+func (c *Client) Approvers() (resp []approver.Approver, err error) {
+	err = c.c.GET("/approvers", &resp)
+	return
+}
+
+// CreateApproverPairing creates a one-time pairing for a new approver app.
+func (c *Client) CreateApproverPairing(name string) (resp approver.Pairing, err error) {
+	err = c.c.POST("/approvers/pairings", ApproverPairingRequest{Name: name}, &resp)
+	return
+}
+
+// RemoveApprover unpairs an approver app.
+func (c *Client) RemoveApprover(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/approvers/%d", id))
+	return
+}
+
+// A WalletClient provides methods for interacting with a particular wallet on a
+// walletd API server.
+type WalletClient struct {
+	c      *clientPool
+	id     wallet.ID
+	binary bool
+	totp   string
+}
+
+// WithTOTP returns a copy of the client that sends a TOTP code with requests
+// to the wallet's sensitive endpoints. Each code can only be used once.
+func (c *WalletClient) WithTOTP(code string) *WalletClient {
+	wc := *c
+	wc.totp = code
+	return &wc
+}
+
+// sensitive performs a request to an endpoint that requires a TOTP code if
+// the wallet has enabled TOTP.
+func (c *WalletClient) sensitive(method, route string, d, r any) error {
+	if c.totp == "" {
+		switch method {
+		case http.MethodPut:
+			return c.c.PUT(route, d)
+		case http.MethodDelete:
+			return c.c.DELETE(route)
+		default:
+			return c.c.POST(route, d, r)
+		}
+	}
+	header := http.Header{HeaderTOTP: []string{c.totp}}
+	return c.c.headerRequest(method, route, header, d, r)
+}
+
+// AddAddress adds the specified address and associated metadata to the
+// wallet.
+func (c *WalletClient) AddAddress(a wallet.Address) (err error) {
+	_, err = c.AddAddressWithResult(a)
+	return
+}
+
+// AddAddressWithResult adds the specified address and associated metadata to
+// the wallet. The result reports whether the address was already in the
+// wallet or in other wallets.
+func (c *WalletClient) AddAddressWithResult(a wallet.Address) (result wallet.AddAddressResult, err error) {
+	err = c.c.headerRequest(http.MethodPut, fmt.Sprintf("/wallets/%v/addresses", c.id), nil, a, &result)
+	return
+}
+
+// RemoveAddress removes the specified address from the wallet.
+func (c *WalletClient) RemoveAddress(addr types.Address) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/addresses/%v", c.id, addr))
+	return
+}
+
+// Addresses the addresses controlled by the wallet.
+func (c *WalletClient) Addresses() (resp []wallet.Address, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/addresses", c.id), &resp)
+	return
+}
+
+// Policy returns the treasury policy of the wallet.
+func (c *WalletClient) Policy() (resp treasury.Policy, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/policy", c.id), &resp)
+	return
+}
+
+// SetPolicy sets the treasury policy of the wallet.
+func (c *WalletClient) SetPolicy(p treasury.Policy) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/wallets/%v/policy", c.id), p)
+	return
+}
+
+// Limits returns the state of the wallet's spending limits.
+func (c *WalletClient) Limits() (ls treasury.LimitStatus, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/limits", c.id), &ls)
+	return
+}
+
+// Allowlist returns the wallet's allowlisted destination addresses.
+func (c *WalletClient) Allowlist() (entries []treasury.AllowlistEntry, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/allowlist", c.id), &entries)
+	return
+}
+
+// AddAllowlistEntry adds an address to the wallet's allowlist.
+func (c *WalletClient) AddAllowlistEntry(addr types.Address, description string) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/wallets/%v/allowlist", c.id), AllowlistRequest{Address: addr, Description: description})
+	return
+}
+
+// RemoveAllowlistEntry removes an address from the wallet's allowlist.
+func (c *WalletClient) RemoveAllowlistEntry(addr types.Address) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/allowlist/%v", c.id, addr))
+	return
+}
+
+// OverrideLimits suspends enforcement of the wallet's spending limits until
+// the expiration. A zero expiration clears the override.
+func (c *WalletClient) OverrideLimits(expiration time.Time) (err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/limits/override", c.id), LimitOverrideRequest{Expiration: expiration}, nil)
+	return
+}
+
+// Balance returns the current wallet balance.
+func (c *WalletClient) Balance() (resp BalanceResponse, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/balance", c.id), &resp)
+	return
+}
+
+// Privacy returns a report scoring the privacy of the wallet's history.
+func (c *WalletClient) Privacy() (resp wallet.PrivacyReport, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/privacy", c.id), &resp)
+	return
+}
+
+// Fees returns the fees paid by the wallet in each of the last n periods,
+// newest first. Period is one of "day", "week", or "month".
+func (c *WalletClient) Fees(period string, n int) (resp []wallet.FeeSummary, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/fees?period=%s&limit=%d", c.id, period, n), &resp)
+	return
+}
+
+// Deltas returns the change in the wallet's balance from the events in each
+// block between start and end, inclusive. Blocks without events are omitted.
+func (c *WalletClient) Deltas(start, end uint64) (resp []wallet.BlockDelta, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/deltas?start=%d&end=%d", c.id, start, end), &resp)
+	return
+}
+
+// Reconcile matches the entries of an external ledger against the wallet's
+// events confirmed between start and end, inclusive.
+func (c *WalletClient) Reconcile(start, end uint64, entries []reconcile.Entry) (resp reconcile.Result, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/reconcile", c.id), WalletReconcileRequest{Start: start, End: end, Entries: entries}, &resp)
+	return
+}
+
+// FeeStrategy returns the wallet's fee strategy.
+func (c *WalletClient) FeeStrategy() (resp wallet.FeeStrategy, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/fees/strategy", c.id), &resp)
+	return
+}
+
+// SetFeeStrategy sets the wallet's fee strategy.
+func (c *WalletClient) SetFeeStrategy(fs wallet.FeeStrategy) error {
+	return c.c.PUT(fmt.Sprintf("/wallets/%v/fees/strategy", c.id), fs)
+}
+
+// MinConfirmations returns the number of confirmations an output must have
+// to fund the wallet's transactions.
+func (c *WalletClient) MinConfirmations() (uint64, error) {
+	var resp WalletConfirmationsRequest
+	err := c.c.GET(fmt.Sprintf("/wallets/%v/confirmations", c.id), &resp)
+	return resp.MinConfirmations, err
+}
+
+// SetMinConfirmations sets the number of confirmations an output must have
+// to fund the wallet's transactions. Zero removes the minimum.
+func (c *WalletClient) SetMinConfirmations(n uint64) error {
+	return c.c.PUT(fmt.Sprintf("/wallets/%v/confirmations", c.id), WalletConfirmationsRequest{MinConfirmations: n})
+}
+
+// FeeRate returns the fee rate, in Hastings per byte, of the wallet's fee
+// strategy.
+func (c *WalletClient) FeeRate() (resp types.Currency, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/fees/rate", c.id), &resp)
+	return
+}
+
+// MetadataSchema returns the JSON schema of the wallet's metadata, or null if
+// the wallet does not have one.
+func (c *WalletClient) MetadataSchema() (schema json.RawMessage, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/metadata/schema", c.id), &schema)
+	return
+}
+
+// SetMetadataSchema sets the JSON schema that the wallet's metadata must
+// match when the wallet is updated.
+func (c *WalletClient) SetMetadataSchema(schema json.RawMessage) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/wallets/%v/metadata/schema", c.id), schema)
+	return
+}
+
+// RemoveMetadataSchema removes the wallet's metadata schema.
+func (c *WalletClient) RemoveMetadataSchema() (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/metadata/schema", c.id))
+	return
+}
+
+// Payments returns the wallet's queued payments, oldest first.
+func (c *WalletClient) Payments() (resp []payments.Payment, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/payments", c.id), &resp)
+	return
+}
+
+// QueuePayment adds a payment to the wallet's queue.
+func (c *WalletClient) QueuePayment(addr types.Address, value types.Currency) (resp payments.Payment, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/payments", c.id), PaymentRequest{
+		Address: addr,
+		Value:   value,
+	}, &resp)
+	return
+}
+
+// CancelPayment removes a payment from the wallet's queue.
+func (c *WalletClient) CancelPayment(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/payments/%d", c.id, id))
+	return
+}
+
+// FlushPayments immediately batches the wallet's queued payments into a
+// funded transaction. The batch's inputs must be signed before it is
+// broadcast.
+func (c *WalletClient) FlushPayments() (resp payments.Batch, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/payments/flush", c.id), nil, &resp)
+	return
+}
+
+// FlushPaymentsAsync is like FlushPayments, but flushes the payments in the
+// background and returns the operation. The batch is the operation's result.
+func (c *WalletClient) FlushPaymentsAsync() (resp operations.Operation, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/payments/flush?async=true", c.id), nil, &resp)
+	return
+}
+
+// PaymentBatches returns the wallet's payment batches, newest first.
+func (c *WalletClient) PaymentBatches(offset, limit int) (resp []payments.Batch, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/payments/batches?offset=%d&limit=%d", c.id, offset, limit), &resp)
+	return
+}
+
+// Signer returns the name of the external signer assigned to the wallet.
+func (c *WalletClient) Signer() (name string, err error) {
+	var resp WalletSignerRequest
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/signer", c.id), &resp)
+	return resp.Signer, err
+}
+
+// SetSigner assigns a configured external signer to the wallet. An empty
+// name removes the wallet's signer.
+func (c *WalletClient) SetSigner(name string) error {
+	return c.c.PUT(fmt.Sprintf("/wallets/%v/signer", c.id), WalletSignerRequest{Signer: name})
+}
+
+// signResponse is the response of the sign endpoint. If the signed
+// transaction requires approval, the server responds with the pending
+// transaction instead, and only its ID is set.
+type signResponse struct {
+	WalletSignResponse
+	ID int64 `json:"id"`
+}
+
+// SignTransaction fills in the signatures of txn with the given parent IDs
+// using the wallet's external signer. If the transaction requires approval,
+// it is added to the approval queue and an error wrapping ErrPendingApproval
+// is returned.
+func (c *WalletClient) SignTransaction(txn types.Transaction, toSign []types.Hash256) (types.Transaction, error) {
+	var resp signResponse
+	err := c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/sign", c.id), WalletSignRequest{Transaction: &txn, ToSign: toSign}, &resp)
+	if err != nil {
+		return types.Transaction{}, err
+	} else if resp.Transaction == nil {
+		return types.Transaction{}, fmt.Errorf("transaction set %d: %w", resp.ID, ErrPendingApproval)
+	}
+	return *resp.Transaction, nil
+}
+
+// SignV2Transaction signs the inputs of txn that spend the wallet's
+// addresses using the wallet's external signer. If the transaction requires
+// approval, it is added to the approval queue and an error wrapping
+// ErrPendingApproval is returned.
+func (c *WalletClient) SignV2Transaction(txn types.V2Transaction) (types.V2Transaction, error) {
+	var resp signResponse
+	err := c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/sign", c.id), WalletSignRequest{V2Transaction: &txn}, &resp)
+	if err != nil {
+		return types.V2Transaction{}, err
+	} else if resp.V2Transaction == nil {
+		return types.V2Transaction{}, fmt.Errorf("transaction set %d: %w", resp.ID, ErrPendingApproval)
+	}
+	return *resp.V2Transaction, nil
+}
+
+// SignMessage signs a message with the key of one of the wallet's addresses
+// to prove ownership of the address.
+func (c *WalletClient) SignMessage(addr types.Address, msg string) (resp signer.SignedMessage, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/addresses/%v/sign-message", c.id, addr), WalletSignMessageRequest{Message: msg}, &resp)
+	return
+}
+
+// WithdrawalProposals returns the withdrawal proposals of a cold wallet,
+// newest first.
+func (c *WalletClient) WithdrawalProposals(offset, limit int) (resp []wallet.WithdrawalProposal, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/proposals?offset=%d&limit=%d", c.id, offset, limit), &resp)
+	return
+}
+
+// WithdrawalProposal returns a withdrawal proposal of a cold wallet.
+func (c *WalletClient) WithdrawalProposal(id int64) (resp wallet.WithdrawalProposal, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/proposals/%d", c.id, id), &resp)
+	return
+}
+
+// ProposeWithdrawal creates an unsigned withdrawal proposal paying the
+// outputs from a cold wallet. The proposal should be signed offline and
+// submitted with SubmitWithdrawalProposal.
+func (c *WalletClient) ProposeWithdrawal(outputs []types.SiacoinOutput, changeAddress types.Address) (resp wallet.WithdrawalProposal, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/proposals", c.id), WithdrawalProposalRequest{
+		Outputs:       outputs,
+		ChangeAddress: changeAddress,
+	}, &resp)
+	return
+}
+
+// CancelWithdrawalProposal cancels a pending withdrawal proposal.
+func (c *WalletClient) CancelWithdrawalProposal(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/proposals/%d", c.id, id))
+	return
+}
+
+// SubmitWithdrawalProposal broadcasts the signed transaction of a
+// withdrawal proposal. If the transaction requires approval, it is added to
+// the approval queue and an error wrapping ErrPendingApproval is returned.
+func (c *WalletClient) SubmitWithdrawalProposal(id int64, signed types.V2Transaction) (resp wallet.WithdrawalProposal, err error) {
+	var buf json.RawMessage
+	if err = c.c.POST(fmt.Sprintf("/wallets/%v/proposals/%d/submit", c.id, id), signed, &buf); err != nil {
+		return
+	}
+	// the server responds with the pending transaction instead of the
+	// proposal if the transaction requires approval
+	var pt treasury.PendingTransaction
+	if err := json.Unmarshal(buf, &pt); err == nil && pt.Status == treasury.StatusPending {
+		return wallet.WithdrawalProposal{}, fmt.Errorf("transaction set %d: %w", pt.ID, ErrPendingApproval)
+	}
+	err = json.Unmarshal(buf, &resp)
+	return
+}
+
+// SeedStatus returns the lock state of the wallet's stored seed.
+func (c *WalletClient) SeedStatus() (resp keystore.Status, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/seed", c.id), &resp)
+	return
+}
+
+// AddSeed stores the seed of a recovery phrase, encrypted with a passphrase.
+func (c *WalletClient) AddSeed(phrase, passphrase string) (err error) {
+	err = c.sensitive(http.MethodPut, fmt.Sprintf("/wallets/%v/seed", c.id), WalletSeedRequest{
+		Phrase:     phrase,
+		Passphrase: passphrase,
+	}, nil)
+	return
+}
+
+// RemoveSeed removes the wallet's stored seed.
+func (c *WalletClient) RemoveSeed() (err error) {
+	err = c.sensitive(http.MethodDelete, fmt.Sprintf("/wallets/%v/seed", c.id), nil, nil)
+	return
+}
+
+// Unlock decrypts the wallet's stored seed so that it can sign. The wallet is
+// locked automatically after the timeout.
+func (c *WalletClient) Unlock(passphrase string, timeout time.Duration) (resp keystore.Status, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/unlock", c.id), WalletUnlockRequest{
+		Passphrase: passphrase,
+		Timeout:    timeout,
+	}, &resp)
+	return
+}
+
+// Lock clears the wallet's decrypted seed from memory.
+func (c *WalletClient) Lock() (err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/lock", c.id), nil, nil)
+	return
+}
+
+// BackupChallenge asks for random words of the wallet's recovery phrase to
+// verify its backup. If words is zero, three words are requested.
+func (c *WalletClient) BackupChallenge(words int) (resp keystore.Challenge, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/backup/challenge", c.id), BackupChallengeRequest{
+		Words: words,
+	}, &resp)
+	return
+}
+
+// VerifyBackup answers a backup challenge with the requested words in order.
+// The wallet must be unlocked.
+func (c *WalletClient) VerifyBackup(challengeID types.Hash256, words []string) (resp keystore.Status, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/backup/verify", c.id), BackupVerifyRequest{
+		ChallengeID: challengeID,
+		Words:       words,
+	}, &resp)
+	return
+}
+
+// Rotate starts a key rotation, moving the wallet's funds to addresses
+// derived from a new seed. The returned seed phrase is not stored by walletd.
+func (c *WalletClient) Rotate(req RotationRequest) (resp RotationResponse, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/rotate", c.id), req, &resp)
+	return
+}
+
+// Rotations returns the wallet's key rotations, newest first.
+func (c *WalletClient) Rotations() (resp []rotation.Rotation, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/rotations", c.id), &resp)
+	return
+}
+
+// Rotation returns a key rotation and its progress.
+func (c *WalletClient) Rotation(id int64) (resp rotation.Rotation, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/rotations/%d", c.id, id), &resp)
+	return
+}
+
+// CancelRotation stops sweeping a key rotation.
+func (c *WalletClient) CancelRotation(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/rotations/%d", c.id, id))
+	return
+}
+
+// RotationSweeps returns the sweeps of a key rotation, newest first.
+func (c *WalletClient) RotationSweeps(id int64) (resp []rotation.Sweep, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/rotations/%d/sweeps", c.id, id), &resp)
+	return
+}
+
+// SweepRotation immediately sweeps a key rotation, ignoring its maximum fee
+// rate.
+func (c *WalletClient) SweepRotation(id int64) (resp rotation.Sweep, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/rotations/%d/sweeps", c.id, id), nil, &resp)
+	return
+}
+
+// SweepRotationAsync is like SweepRotation, but sweeps in the background and
+// returns the operation. The sweep is the operation's result.
+func (c *WalletClient) SweepRotationAsync(id int64) (resp operations.Operation, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/rotations/%d/sweeps?async=true", c.id, id), nil, &resp)
+	return
+}
+
+// AddForwardingRule adds a rule forwarding the deposits of one of the
+// wallet's addresses.
+func (c *WalletClient) AddForwardingRule(req ForwardingRuleRequest) (resp forwarding.Rule, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/forwarding/rules", c.id), req, &resp)
+	return
+}
+
+// ForwardingRules returns the wallet's forwarding rules.
+func (c *WalletClient) ForwardingRules() (resp []forwarding.Rule, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/forwarding/rules", c.id), &resp)
+	return
+}
+
+// ForwardingRule returns a forwarding rule and its progress.
+func (c *WalletClient) ForwardingRule(id int64) (resp forwarding.Rule, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/forwarding/rules/%d", c.id, id), &resp)
+	return
+}
+
+// RemoveForwardingRule removes a forwarding rule. Its sweeps are kept.
+func (c *WalletClient) RemoveForwardingRule(id int64) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/forwarding/rules/%d", c.id, id))
+	return
+}
+
+// SweepForwardingRule immediately sweeps the confirmed deposits of a
+// forwarding rule, ignoring its minimum amount.
+func (c *WalletClient) SweepForwardingRule(id int64) (resp forwarding.Sweep, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/forwarding/rules/%d/sweeps", c.id, id), nil, &resp)
+	return
+}
+
+// SweepForwardingRuleAsync is like SweepForwardingRule, but sweeps in the
+// background and returns the operation. The sweep is the operation's result.
+func (c *WalletClient) SweepForwardingRuleAsync(id int64) (resp operations.Operation, err error) {
+	err = c.sensitive(http.MethodPost, fmt.Sprintf("/wallets/%v/forwarding/rules/%d/sweeps?async=true", c.id, id), nil, &resp)
+	return
+}
+
+// Transfer moves funds from the wallet to another wallet on the same node.
+// If method is empty, the server chooses between a ledger entry and an
+// on-chain transaction.
+func (c *WalletClient) Transfer(to wallet.ID, value types.Currency, method, memo string) (resp transfers.Transfer, err error) {
+	req := TransferRequest{From: c.id, To: to, Value: value, Method: method, Memo: memo}
+	err = c.sensitive(http.MethodPost, "/transfers", req, &resp)
+	return
+}
+
+// Transfers returns the wallet's transfer entries, newest first.
+func (c *WalletClient) Transfers(offset, limit int) (resp []transfers.Entry, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/transfers?offset=%d&limit=%d", c.id, offset, limit), &resp)
+	return
+}
+
+// Forecast projects the wallet's spendable balance over the next days from
+// its maturing outputs, queued payments, pending approvals, and its average
+// daily flows over the last window days.
+func (c *WalletClient) Forecast(days, window int) (resp forecast.Forecast, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/forecast?days=%d&window=%d", c.id, days, window), &resp)
+	return
+}
+
+// BalanceAlarms returns the wallet's balance alarms.
+func (c *WalletClient) BalanceAlarms() (resp []wallet.BalanceAlarm, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/alarms", c.id), &resp)
+	return
+}
+
+// AddBalanceAlarm adds an alarm on the balance of the wallet, or of one of
+// its addresses if addr is not nil. A nil low or high bound is not checked.
+func (c *WalletClient) AddBalanceAlarm(addr *types.Address, low, high *types.Currency) (resp wallet.BalanceAlarm, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/alarms", c.id), BalanceAlarmRequest{Address: addr, Low: low, High: high}, &resp)
+	return
+}
+
+// RemoveBalanceAlarm removes a balance alarm from the wallet.
+func (c *WalletClient) RemoveBalanceAlarm(id wallet.AlarmID) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/alarms/%v", c.id, id))
+	return
+}
+
+// Digest returns the wallet's digest schedule.
+func (c *WalletClient) Digest() (resp digest.Schedule, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/digest", c.id), &resp)
+	return
+}
+
+// SetDigest sends a summary of the wallet's activity to webhooks daily or
+// weekly.
+func (c *WalletClient) SetDigest(frequency string) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/wallets/%v/digest", c.id), DigestRequest{Frequency: frequency})
+	return
+}
+
+// RemoveDigest stops sending the wallet's digest.
+func (c *WalletClient) RemoveDigest() (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/wallets/%v/digest", c.id))
+	return
+}
+
+// PreviewDigest returns the wallet's digest for the last complete day or week
+// without sending it.
+func (c *WalletClient) PreviewDigest(frequency string) (resp digest.Digest, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/digest/preview?frequency=%s", c.id, frequency), &resp)
+	return
+}
+
+// TOTPStatus returns the wallet's TOTP state.
+func (c *WalletClient) TOTPStatus() (resp totp.Status, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/totp", c.id), &resp)
+	return
+}
+
+// EnrollTOTP generates a new TOTP secret for the wallet. Codes are not
+// required until the enrollment is confirmed with ConfirmTOTP.
+func (c *WalletClient) EnrollTOTP() (resp totp.Enrollment, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/totp", c.id), nil, &resp)
+	return
+}
+
+// ConfirmTOTP enables the wallet's pending TOTP enrollment with a valid code.
+func (c *WalletClient) ConfirmTOTP(code string) (err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/totp/confirm", c.id), TOTPConfirmRequest{Code: code}, nil)
+	return
+}
+
+// DisableTOTP removes the wallet's TOTP secret. If TOTP is enabled, the
+// client must have a code set with WithTOTP.
+func (c *WalletClient) DisableTOTP() (err error) {
+	err = c.sensitive(http.MethodDelete, fmt.Sprintf("/wallets/%v/totp", c.id), nil, nil)
+	return
+}
+
+// ForwardingSweeps returns the wallet's forwarding sweeps, newest first. If
+// ruleID is non-zero, only the sweeps of that rule are returned.
+func (c *WalletClient) ForwardingSweeps(ruleID int64, offset, limit int) (resp []forwarding.Sweep, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/forwarding/sweeps?rule=%d&offset=%d&limit=%d", c.id, ruleID, offset, limit), &resp)
+	return
+}
+
+// CreateEscrow creates a 2-of-3 escrow between a buyer, seller and
+// arbiter.
+func (c *WalletClient) CreateEscrow(req EscrowRequest) (resp escrow.Escrow, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/escrows", c.id), req, &resp)
+	return
+}
+
+// Escrows returns the wallet's escrows, newest first.
+func (c *WalletClient) Escrows() (resp []escrow.Escrow, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/escrows", c.id), &resp)
+	return
+}
+
+// Escrow returns an escrow and the balance of its address.
+func (c *WalletClient) Escrow(id int64) (resp escrow.Escrow, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/escrows/%d", c.id, id), &resp)
+	return
+}
+
+// FundEscrow funds a transaction paying the rest of an escrow's amount from
+// another wallet.
+func (c *WalletClient) FundEscrow(id int64, req EscrowFundRequest) (resp escrow.Funding, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/escrows/%d/fund", c.id, id), req, &resp)
+	return
+}
+
+// ReleaseEscrow proposes a settlement paying an escrow to the seller.
+func (c *WalletClient) ReleaseEscrow(id int64) (resp escrow.Escrow, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/escrows/%d/release", c.id, id), nil, &resp)
+	return
+}
+
+// RefundEscrow proposes a settlement returning an escrow to the buyer.
+func (c *WalletClient) RefundEscrow(id int64) (resp escrow.Escrow, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/escrows/%d/refund", c.id, id), nil, &resp)
+	return
+}
+
+// AddEscrowSignature adds a party's signature to an escrow's pending
+// settlement. The settlement is broadcast once two parties have signed.
+func (c *WalletClient) AddEscrowSignature(id int64, req EscrowSignatureRequest) (resp escrow.Escrow, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/escrows/%d/signatures", c.id, id), req, &resp)
+	return
+}
+
+// Events returns all events relevant to the wallet.
+func (c *WalletClient) Events(offset, limit int) (resp []wallet.AnnotatedEvent, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/events?offset=%d&limit=%d", c.id, offset, limit), &resp)
+	return
+}
+
+// EventFeed returns the events relevant to the wallet, including an entry
+// for each event removed from the chain by a reorg. Reverted entries have
+// Reverted set and, once the chain reaches their height again, ReplacedBy.
+func (c *WalletClient) EventFeed(offset, limit int) (resp []wallet.AnnotatedEvent, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/events?includeReverted=true&offset=%d&limit=%d", c.id, offset, limit), &resp)
+	return
+}
+
+// CategoryEvents returns the events relevant to the wallet with the given
+// category.
+func (c *WalletClient) CategoryEvents(category string, offset, limit int) (resp []wallet.AnnotatedEvent, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/events?category=%s&offset=%d&limit=%d", c.id, url.QueryEscape(category), offset, limit), &resp)
+	return
+}
+
+// ExportEvents returns the events relevant to the wallet as CSV. If category
+// is not empty, only events with the category are exported.
+func (c *WalletClient) ExportEvents(category string) (buf []byte, err error) {
+	route := fmt.Sprintf("/wallets/%v/events/export?category=%s", c.id, url.QueryEscape(category))
+	err = c.c.do(http.MethodGet, func(jc jape.Client) error {
+		req, err := http.NewRequest(http.MethodGet, jc.BaseURL+route, nil)
+		if err != nil {
+			return err
+		} else if jc.Password != "" {
+			req.SetBasicAuth("", jc.Password)
+		}
+		r, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer r.Body.Close()
+		buf, err = io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		} else if !(200 <= r.StatusCode && r.StatusCode < 300) {
+			return errors.New(string(buf))
+		}
+		return nil
+	})
+	return
+}
+
+// UnconfirmedEvents returns all unconfirmed events relevant to the wallet.
+func (c *WalletClient) UnconfirmedEvents() (resp []wallet.AnnotatedEvent, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/events/unconfirmed", c.id), &resp)
+	return
+}
+
+// SiacoinOutputs returns the set of unspent outputs controlled by the wallet.
+func (c *WalletClient) SiacoinOutputs(offset, limit int) (sc []types.SiacoinElement, err error) {
+	return c.ConfirmedSiacoinOutputs(0, offset, limit)
+}
+
+// ConfirmedSiacoinOutputs returns the set of unspent outputs controlled by
+// the wallet that have at least minConfirmations confirmations.
+func (c *WalletClient) ConfirmedSiacoinOutputs(minConfirmations uint64, offset, limit int) (sc []types.SiacoinElement, err error) {
+	route := fmt.Sprintf("/wallets/%v/outputs/siacoin?offset=%d&limit=%d&minConfirmations=%d", c.id, offset, limit, minConfirmations)
+	if c.binary {
+		err = getBinary(c.c, route, decoderFunc(func(d *types.Decoder) { types.DecodeSlice(d, &sc) }))
+		return
+	}
+	err = c.c.GET(route, &sc)
+	return
+}
+
+// SiafundOutputs returns the set of unspent outputs controlled by the wallet.
+func (c *WalletClient) SiafundOutputs(offset, limit int) (sf []types.SiafundElement, err error) {
+	return c.ConfirmedSiafundOutputs(0, offset, limit)
+}
+
+// ConfirmedSiafundOutputs returns the set of unspent siafund outputs
+// controlled by the wallet that have at least minConfirmations
+// confirmations.
+func (c *WalletClient) ConfirmedSiafundOutputs(minConfirmations uint64, offset, limit int) (sf []types.SiafundElement, err error) {
+	route := fmt.Sprintf("/wallets/%v/outputs/siafund?offset=%d&limit=%d&minConfirmations=%d", c.id, offset, limit, minConfirmations)
+	if c.binary {
+		err = getBinary(c.c, route, decoderFunc(func(d *types.Decoder) { types.DecodeSlice(d, &sf) }))
+		return
+	}
+	err = c.c.GET(route, &sf)
+	return
+}
+
+// ExportOutputs returns every unspent output of the wallet with its Merkle
+// proof and the chain index the proofs are valid at.
+func (c *WalletClient) ExportOutputs() (resp wallet.OutputExport, err error) {
+	err = c.c.GET(fmt.Sprintf("/wallets/%v/outputs/export", c.id), &resp)
+	return
+}
+
+// Reserve reserves a set outputs for use in a transaction.
+func (c *WalletClient) Reserve(sc []types.SiacoinOutputID, sf []types.SiafundOutputID, duration time.Duration) (err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/reserve", c.id), WalletReserveRequest{
+		SiacoinOutputs: sc,
+		SiafundOutputs: sf,
+		Duration:       duration,
+	}, nil)
+	return
+}
+
+// Release releases a set of previously-reserved outputs.
+func (c *WalletClient) Release(sc []types.SiacoinOutputID, sf []types.SiafundOutputID) (err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/release", c.id), WalletReleaseRequest{
+		SiacoinOutputs: sc,
+		SiafundOutputs: sf,
+	}, nil)
+	return
+}
+
+// Estimate estimates the size and fee of sending the outputs from the wallet
+// without reserving any of its outputs.
+func (c *WalletClient) Estimate(outputs []types.SiacoinOutput, minConfirmations uint64) (resp wallet.SendEstimate, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/estimate", c.id), WalletEstimateRequest{Outputs: outputs, MinConfirmations: minConfirmations}, &resp)
+	return
+}
+
+// Fund funds a siacoin transaction.
+func (c *WalletClient) Fund(txn types.Transaction, amount types.Currency, changeAddr types.Address) (resp WalletFundResponse, err error) {
+	return c.FundConfirmed(txn, amount, changeAddr, 0)
+}
+
+// FundConfirmed funds a siacoin transaction with outputs that have at least
+// minConfirmations confirmations, or the wallet's minimum if it is higher.
+func (c *WalletClient) FundConfirmed(txn types.Transaction, amount types.Currency, changeAddr types.Address, minConfirmations uint64) (resp WalletFundResponse, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/fund", c.id), WalletFundRequest{
+		Transaction:      txn,
+		Amount:           amount,
+		ChangeAddress:    changeAddr,
+		MinConfirmations: minConfirmations,
+	}, &resp)
+	return
+}
+
+// FundSF funds a siafund transaction.
+func (c *WalletClient) FundSF(txn types.Transaction, amount uint64, changeAddr, claimAddr types.Address) (resp WalletFundResponse, err error) {
+	err = c.c.POST(fmt.Sprintf("/wallets/%v/fundsf", c.id), WalletFundSFRequest{
+		Transaction:   txn,
+		Amount:        amount,
+		ChangeAddress: changeAddr,
+		ClaimAddress:  claimAddr,
+	}, &resp)
+	return
+}
+
+// A ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithBinaryEncoding makes the client use Sia's binary encoding instead of
+// JSON for consensus updates, UTXO listings, and broadcasts. It requires a
+// server that supports binary encoding on those routes.
+func WithBinaryEncoding() ClientOption {
+	return func(c *Client) {
+		c.binary = true
+	}
+}
+
+// WithReplicas adds read replicas to the client. GET requests are spread
+// across healthy replicas and fall back to the primary server if every
+// replica is unreachable. Replicas share the primary's password.
+func WithReplicas(addrs ...string) ClientOption {
+	return func(c *Client) {
+		for _, addr := range addrs {
+			c.c.replicas = append(c.c.replicas, &backend{url: addr})
+		}
+	}
+}
+
+// WithStickyWrites allows writes to fail over from the primary server to the
+// replicas. Writes are sent to the last server that accepted a write until
+// it becomes unreachable. A write is only retried on another server if it
+// could not be sent, so it is never applied twice.
+func WithStickyWrites() ClientOption {
+	return func(c *Client) {
+		c.c.sticky = true
+	}
+}
+
+// WithHealthCheck makes the client check the health of each server every
+// interval, so unreachable servers are skipped before a request fails.
+// Without it, a server is skipped for a short period after a request to it
+// fails. The client must be closed to stop the checks.
+func WithHealthCheck(interval time.Duration) ClientOption {
+	return func(c *Client) {
+		c.healthInterval = interval
+	}
+}
+
+// NewClient returns a client that communicates with a walletd server listening
+// on the specified address.
+func NewClient(addr, password string, opts ...ClientOption) *Client {
+	c := &Client{c: newClientPool(addr, password)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.healthInterval > 0 {
+		c.c.startHealthChecks(c.healthInterval)
+	}
+	return c
+}
+
+// A GroupClient provides methods for interacting with a wallet group.
+type GroupClient struct {
+	c  *clientPool
+	id wallet.GroupID
+}
+
+// Wallets returns the wallets in the group and its subgroups.
+func (c *GroupClient) Wallets() (wallets []wallet.Wallet, err error) {
+	err = c.c.GET(fmt.Sprintf("/groups/%v/wallets", c.id), &wallets)
+	return
+}
+
+// AddWallet assigns a wallet to the group, removing it from any previous
+// group.
+func (c *GroupClient) AddWallet(id wallet.ID) (err error) {
+	err = c.c.PUT(fmt.Sprintf("/groups/%v/wallets/%v", c.id, id), nil)
+	return
+}
+
+// RemoveWallet removes a wallet from the group.
+func (c *GroupClient) RemoveWallet(id wallet.ID) (err error) {
+	err = c.c.DELETE(fmt.Sprintf("/groups/%v/wallets/%v", c.id, id))
+	return
+}
+
+// Balance returns the combined balance of the wallets in the group and its
+// subgroups.
+func (c *GroupClient) Balance() (resp BalanceResponse, err error) {
+	err = c.c.GET(fmt.Sprintf("/groups/%v/balance", c.id), &resp)
+	return
+}
+
+// Events returns the events relevant to the wallets in the group and its
+// subgroups.
+func (c *GroupClient) Events(offset, limit int) (resp []wallet.AnnotatedEvent, err error) {
+	err = c.c.GET(fmt.Sprintf("/groups/%v/events?offset=%d&limit=%d", c.id, offset, limit), &resp)
+	return
 }
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.sia.tech/jape"
+)
+
+const (
+	// backendCooldown is how long a server that failed a request is skipped
+	// before it is tried again.
+	backendCooldown = 30 * time.Second
+	// healthCheckTimeout is the timeout of an active health check.
+	healthCheckTimeout = 10 * time.Second
+)
+
+// A backend is a walletd server in a clientPool.
+type backend struct {
+	url string
+	// downUntil is the Unix time, in nanoseconds, until which the backend
+	// is considered unhealthy.
+	downUntil atomic.Int64
+}
+
+func (b *backend) healthy(now time.Time) bool {
+	return now.UnixNano() >= b.downUntil.Load()
+}
+
+func (b *backend) markDown(d time.Duration) {
+	b.downUntil.Store(time.Now().Add(d).UnixNano())
+}
+
+func (b *backend) markUp() {
+	b.downUntil.Store(0)
+}
+
+// A clientPool sends API requests to a primary walletd server and any number
+// of read replicas. Reads are spread across healthy replicas, falling back
+// to the primary. Writes are sent to the primary or, in sticky mode, to the
+// last server that accepted a write.
+type clientPool struct {
+	password string
+	primary  *backend
+	replicas []*backend
+
+	// sticky allows writes to fail over to replicas
+	sticky bool
+	// writer is the index, in backends(), of the server that receives
+	// writes in sticky mode
+	writer atomic.Int64
+	next   atomic.Uint64 // round-robin counter for reads
+
+	mu   sync.Mutex // protects stop
+	stop chan struct{}
+}
+
+// backends returns the primary followed by the replicas.
+func (p *clientPool) backends() []*backend {
+	return append([]*backend{p.primary}, p.replicas...)
+}
+
+// candidates returns the servers to try for a request, in order. Healthy
+// servers are tried first; unhealthy servers are tried last rather than
+// failing the request outright.
+func (p *clientPool) candidates(method string) []*backend {
+	var ordered []*backend
+	switch {
+	case method == http.MethodGet && len(p.replicas) > 0:
+		start := int(p.next.Add(1) % uint64(len(p.replicas)))
+		for i := range p.replicas {
+			ordered = append(ordered, p.replicas[(start+i)%len(p.replicas)])
+		}
+		ordered = append(ordered, p.primary)
+	case method != http.MethodGet && p.sticky:
+		all := p.backends()
+		start := int(p.writer.Load())
+		for i := range all {
+			ordered = append(ordered, all[(start+i)%len(all)])
+		}
+	default:
+		return []*backend{p.primary}
+	}
+
+	now := time.Now()
+	healthy := make([]*backend, 0, len(ordered))
+	var unhealthy []*backend
+	for _, b := range ordered {
+		if b.healthy(now) {
+			healthy = append(healthy, b)
+		} else {
+			unhealthy = append(unhealthy, b)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// isConnError returns true if err was caused by failing to communicate with
+// the server, as opposed to an error response.
+func isConnError(err error) bool {
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// isDialError returns true if err was caused by failing to connect to the
+// server, in which case the request was never sent.
+func isDialError(err error) bool {
+	var oe *net.OpError
+	return errors.As(err, &oe) && oe.Op == "dial"
+}
+
+// do calls fn with a jape.Client for each candidate server until one
+// succeeds. Reads fail over on any connection error. Writes only fail over
+// if the request was never sent, so they are not applied twice.
+func (p *clientPool) do(method string, fn func(jc jape.Client) error) (err error) {
+	candidates := p.candidates(method)
+	for _, b := range candidates {
+		err = fn(jape.Client{BaseURL: b.url, Password: p.password})
+		if !isConnError(err) {
+			if method != http.MethodGet && p.sticky {
+				for i, wb := range p.backends() {
+					if wb == b {
+						p.writer.Store(int64(i))
+					}
+				}
+			}
+			return err
+		}
+		b.markDown(backendCooldown)
+		if method != http.MethodGet && !isDialError(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// GET performs a GET request like jape.Client.GET.
+func (p *clientPool) GET(route string, r any) error {
+	return p.do(http.MethodGet, func(jc jape.Client) error { return jc.GET(route, r) })
+}
+
+// POST performs a POST request like jape.Client.POST.
+func (p *clientPool) POST(route string, d, r any) error {
+	return p.do(http.MethodPost, func(jc jape.Client) error { return jc.POST(route, d, r) })
+}
+
+// PUT performs a PUT request like jape.Client.PUT.
+func (p *clientPool) PUT(route string, d any) error {
+	return p.do(http.MethodPut, func(jc jape.Client) error { return jc.PUT(route, d) })
+}
+
+// DELETE performs a DELETE request like jape.Client.DELETE.
+func (p *clientPool) DELETE(route string) error {
+	return p.do(http.MethodDelete, func(jc jape.Client) error { return jc.DELETE(route) })
+}
+
+// binaryRequest performs a request like binaryRequest against the pool.
+func (p *clientPool) binaryRequest(method, route string, body []byte) (buf []byte, status int, err error) {
+	err = p.do(method, func(jc jape.Client) error {
+		buf, status, err = binaryRequest(jc, method, route, body)
+		return err
+	})
+	return
+}
+
+// headerRequest performs a request like headerRequest against the pool.
+func (p *clientPool) headerRequest(method, route string, header http.Header, d, r any) error {
+	return p.do(method, func(jc jape.Client) error { return headerRequest(jc, method, route, header, d, r) })
+}
+
+// checkHealth probes every server in the pool with a request for its state.
+func (p *clientPool) checkHealth(interval time.Duration) {
+	var wg sync.WaitGroup
+	for _, b := range p.backends() {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+			defer cancel()
+			jc := jape.Client{BaseURL: b.url, Password: p.password}
+			var resp StateResponse
+			if err := jc.WithContext(ctx).GET("/state", &resp); err != nil {
+				b.markDown(interval)
+			} else {
+				b.markUp()
+			}
+		}(b)
+	}
+	wg.Wait()
+}
+
+// startHealthChecks probes the pool's servers every interval until
+// stopHealthChecks is called.
+func (p *clientPool) startHealthChecks(interval time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stop := make(chan struct{})
+	p.stop = stop
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			p.checkHealth(interval)
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// stopHealthChecks stops active health checks, if any.
+func (p *clientPool) stopHealthChecks() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+func newClientPool(addr, password string) *clientPool {
+	return &clientPool{
+		password: password,
+		primary:  &backend{url: addr},
+	}
+}
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/wallet"
+)
+
+// A CurrencyFormat is the format of currency values in JSON responses.
+type CurrencyFormat string
+
+const (
+	// CurrencyFormatHastings renders currency values as integer strings of
+	// hastings, e.g. "1500000000000000000000000". This is the default.
+	CurrencyFormatHastings CurrencyFormat = "hastings"
+	// CurrencyFormatSC renders currency values as exact decimal strings of
+	// siacoins with a unit, e.g. "1.5 SC".
+	CurrencyFormatSC CurrencyFormat = "sc"
+)
+
+// CurrencyFormatHeader is the request header that selects the currency
+// format of a response, overriding the server's default.
+const CurrencyFormatHeader = "Currency-Format"
+
+// ParseCurrencyFormat parses a currency format name. The empty string is
+// parsed as CurrencyFormatHastings.
+func ParseCurrencyFormat(s string) (CurrencyFormat, error) {
+	switch f := CurrencyFormat(strings.ToLower(s)); f {
+	case "":
+		return CurrencyFormatHastings, nil
+	case CurrencyFormatHastings, CurrencyFormatSC:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown currency format %q", s)
+	}
+}
+
+// maxRequestBodySize is the maximum size of a JSON request body read by
+// formatCurrencies.
+const maxRequestBodySize = 32 << 20 // 32 MiB
+
+// A currencySchema describes where currency values appear in the JSON
+// encoding of a type. Currency values are JSON strings, so they can only be
+// told apart from other strings by their position in a known type. Values
+// of untyped fields, such as wallet metadata, have a nil schema and are
+// never converted.
+type currencySchema struct {
+	// currency is true if the value is a currency value.
+	currency bool
+	// fields are the schemas of a struct's fields by JSON key.
+	fields map[string]*currencySchema
+	// elem is the schema of an array's elements or a map's values.
+	elem *currencySchema
+}
+
+// child returns the schema of the value of an object key.
+func (s *currencySchema) child(key string) *currencySchema {
+	if s == nil {
+		return nil
+	} else if f, ok := s.fields[key]; ok {
+		return f
+	}
+	return s.elem
+}
+
+// currencyImplementations are the implementations of the interface fields of
+// the API's types, which cannot be found by reflection.
+var currencyImplementations = []reflect.Type{
+	reflect.TypeOf(wallet.EventPayout{}),
+	reflect.TypeOf(wallet.EventV1Transaction{}),
+	reflect.TypeOf(wallet.EventV1ContractResolution{}),
+	reflect.TypeOf(wallet.EventV2ContractResolution{}),
+	reflect.TypeOf(wallet.EventV2Transaction{}),
+	reflect.TypeOf(types.V2FileContractRenewal{}),
+}
+
+// apiCurrencySchema is the union of the schemas of the API's requests and
+// responses.
+var apiCurrencySchema = func() *currencySchema {
+	memo := make(map[reflect.Type]*currencySchema)
+	merged := make(map[[2]*currencySchema]*currencySchema)
+	var schema *currencySchema
+	// every request and response type is used by a client method
+	for _, t := range []reflect.Type{
+		reflect.TypeOf((*Client)(nil)),
+		reflect.TypeOf((*WalletClient)(nil)),
+		reflect.TypeOf((*GroupClient)(nil)),
+	} {
+		for i := 0; i < t.NumMethod(); i++ {
+			mt := t.Method(i).Type
+			for j := 0; j < mt.NumIn(); j++ {
+				schema = mergeCurrencySchemas(schema, typeCurrencySchema(mt.In(j), memo, merged), merged)
+			}
+			for j := 0; j < mt.NumOut(); j++ {
+				schema = mergeCurrencySchemas(schema, typeCurrencySchema(mt.Out(j), memo, merged), merged)
+			}
+		}
+	}
+	return schema
+}()
+
+// typeCurrencySchema returns the schema of t.
+func typeCurrencySchema(t reflect.Type, memo map[reflect.Type]*currencySchema, merged map[[2]*currencySchema]*currencySchema) *currencySchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if s, ok := memo[t]; ok {
+		return s
+	} else if t == reflect.TypeOf(types.Currency{}) {
+		return &currencySchema{currency: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// byte slices, such as json.RawMessage, are opaque
+			return nil
+		}
+		s := new(currencySchema)
+		memo[t] = s
+		s.elem = typeCurrencySchema(t.Elem(), memo, merged)
+		return s
+	case reflect.Struct:
+		s := &currencySchema{fields: make(map[string]*currencySchema)}
+		memo[t] = s
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			} else if name == "" && f.Anonymous {
+				// embedded fields are promoted
+				if embedded := typeCurrencySchema(f.Type, memo, merged); embedded != nil {
+					for k, v := range embedded.fields {
+						s.fields[k] = v
+					}
+				}
+				continue
+			} else if name == "" {
+				name = f.Name
+			}
+			s.fields[name] = typeCurrencySchema(f.Type, memo, merged)
+		}
+		return s
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			// values of untyped fields are opaque
+			return nil
+		}
+		s := new(currencySchema)
+		memo[t] = s
+		var union *currencySchema
+		for _, impl := range currencyImplementations {
+			if impl.Implements(t) || reflect.PointerTo(impl).Implements(t) {
+				union = mergeCurrencySchemas(union, typeCurrencySchema(impl, memo, merged), merged)
+			}
+		}
+		if union != nil {
+			*s = *union
+		}
+		return s
+	default:
+		return nil
+	}
+}
+
+// mergeCurrencySchemas returns the union of two schemas.
+func mergeCurrencySchemas(a, b *currencySchema, merged map[[2]*currencySchema]*currencySchema) *currencySchema {
+	if a == nil {
+		return b
+	} else if b == nil || a == b {
+		return a
+	}
+	key := [2]*currencySchema{a, b}
+	if m, ok := merged[key]; ok {
+		return m
+	}
+	m := &currencySchema{currency: a.currency || b.currency}
+	merged[key] = m
+	if a.fields != nil || b.fields != nil {
+		m.fields = make(map[string]*currencySchema)
+		for k, f := range a.fields {
+			m.fields[k] = mergeCurrencySchemas(f, b.fields[k], merged)
+		}
+		for k, f := range b.fields {
+			if _, ok := a.fields[k]; !ok {
+				m.fields[k] = f
+			}
+		}
+	}
+	m.elem = mergeCurrencySchemas(a.elem, b.elem, merged)
+	return m
+}
+
+// rewriteCurrencies replaces every currency value of a JSON document, as
+// described by the schema, with the result of fn. The document is otherwise
+// unchanged, but its whitespace is removed.
+func rewriteCurrencies(data []byte, schema *currencySchema, fn func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := rewriteCurrencyValue(dec, &buf, schema, fn); err != nil {
+		return nil, err
+	} else if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return buf.Bytes(), nil
+}
+
+// rewriteCurrencyValue copies the next JSON value from dec to buf, rewriting
+// the currency values described by the schema.
+func rewriteCurrencyValue(dec *json.Decoder, buf *bytes.Buffer, schema *currencySchema, fn func(string) string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '{':
+			buf.WriteByte('{')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				key, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				b, _ := json.Marshal(key)
+				buf.Write(b)
+				buf.WriteByte(':')
+				if err := rewriteCurrencyValue(dec, buf, schema.child(key.(string)), fn); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+		case '[':
+			buf.WriteByte('[')
+			var elem *currencySchema
+			if schema != nil {
+				elem = schema.elem
+			}
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := rewriteCurrencyValue(dec, buf, elem, fn); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		}
+		// consume the closing delimiter
+		_, err := dec.Token()
+		return err
+	case string:
+		if schema != nil && schema.currency {
+			tok = fn(tok)
+		}
+		b, _ := json.Marshal(tok)
+		buf.Write(b)
+	default:
+		b, err := json.Marshal(tok)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// formatSC formats a currency value as an exact decimal number of siacoins,
+// e.g. "1.5 SC".
+func formatSC(c types.Currency) string {
+	s := new(big.Rat).SetFrac(c.Big(), types.HastingsPerSiacoin.Big()).FloatString(24)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s + " SC"
+}
+
+// hastingsToSC converts a string of hastings to siacoins. Other strings are
+// returned unchanged.
+func hastingsToSC(s string) string {
+	var c types.Currency
+	if err := c.UnmarshalText([]byte(s)); err != nil {
+		return s
+	}
+	return formatSC(c)
+}
+
+// unitRegex matches currency strings with a unit, e.g. "1.5 SC" or "200mS".
+var unitRegex = regexp.MustCompile(`^\s*([0-9]+(?:\.[0-9]*)?|\.[0-9]+)\s*(pS|nS|uS|mS|SC|KS|MS|GS|TS)\s*$`)
+
+// unitBodyRegex matches JSON documents that may contain a currency string
+// with a unit, so that other request bodies are not rewritten.
+var unitBodyRegex = regexp.MustCompile(`[0-9.]\s*(pS|nS|uS|mS|SC|KS|MS|GS|TS)\s*"`)
+
+// unitExponents are the powers of ten of each unit in hastings.
+var unitExponents = map[string]int64{
+	"pS": 12,
+	"nS": 15,
+	"uS": 18,
+	"mS": 21,
+	"SC": 24,
+	"KS": 27,
+	"MS": 30,
+	"GS": 33,
+	"TS": 36,
+}
+
+// unitToHastings converts a currency string with a unit to hastings. Other
+// strings, including amounts that are not a whole number of hastings, are
+// returned unchanged so that they are rejected by the handler.
+func unitToHastings(s string) string {
+	m := unitRegex.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	r, ok := new(big.Rat).SetString(m[1])
+	if !ok {
+		return s
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(unitExponents[m[2]]), nil)))
+	if !r.IsInt() {
+		return s
+	}
+	return r.Num().String()
+}
+
+// requestCurrencyFormat returns the currency format requested by r, or def
+// if the request does not specify one.
+func requestCurrencyFormat(r *http.Request, def CurrencyFormat) (CurrencyFormat, error) {
+	if h := r.Header.Get(CurrencyFormatHeader); h != "" {
+		return ParseCurrencyFormat(h)
+	}
+	return def, nil
+}
+
+// originalBodyKey is the context key of a request body that was rewritten
+// by formatCurrencies.
+type originalBodyKey struct{}
+
+// originalBody returns the body sent by the client if formatCurrencies
+// rewrote it. Request signatures cover the original body.
+func originalBody(r *http.Request) ([]byte, bool) {
+	body, ok := r.Context().Value(originalBodyKey{}).([]byte)
+	return body, ok
+}
+
+// formatCurrencies wraps a handler so that JSON request bodies may contain
+// currency values with a unit, e.g. "1.5 SC", and JSON responses render
+// currency values in the requested format. Values with a unit are converted
+// to hastings before the request is handled, so handlers only see hastings.
+// Only the currency fields of the API's types are converted; untyped values,
+// such as wallet metadata, are left unchanged.
+func formatCurrencies(h http.Handler, def CurrencyFormat) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format, err := requestCurrencyFormat(r, def)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); r.Body != nil && ct != "application/octet-stream" {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				http.Error(w, fmt.Sprintf("request body exceeds %d bytes", mbe.Limit), http.StatusRequestEntityTooLarge)
+				return
+			} else if err != nil {
+				http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+				return
+			}
+			// invalid JSON is passed through for the handler to reject
+			if unitBodyRegex.Match(body) {
+				if converted, err := rewriteCurrencies(body, apiCurrencySchema, unitToHastings); err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), originalBodyKey{}, body))
+					body = converted
+				}
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+		}
+
+		if format == CurrencyFormatHastings {
+			h.ServeHTTP(w, r)
+			return
+		}
+		fw := &fieldsResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(fw, r)
+		if fw.status == 0 {
+			fw.status = http.StatusOK
+		}
+
+		body := fw.buf.Bytes()
+		if ct, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); fw.status >= 200 && fw.status < 300 && ct == "application/json" {
+			var buf bytes.Buffer
+			converted, err := rewriteCurrencies(body, apiCurrencySchema, hastingsToSC)
+			if err == nil {
+				err = json.Indent(&buf, converted, "", "\t")
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("failed to format currencies: %v", err), http.StatusInternalServerError)
+				return
+			}
+			buf.WriteByte('\n')
+			body = buf.Bytes()
+		}
+		w.WriteHeader(fw.status)
+		w.Write(body)
+	})
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// decodeTransactionRequest reads the transaction of a decode request from its
+// JSON or Sia-encoded body. If decoding fails, an error is written to the
+// response.
+func decodeTransactionRequest(jc jape.Context) (req TransactionDecodeRequest, err error) {
+	var buf []byte
+	if isBinaryRequest(jc.Request) {
+		req.Version = 2
+		if err := jc.DecodeForm("version", &req.Version); err != nil {
+			return TransactionDecodeRequest{}, err
+		}
+		buf, err = io.ReadAll(io.LimitReader(jc.Request.Body, maxBinaryRequestSize))
+		if err != nil {
+			return TransactionDecodeRequest{}, jc.Error(fmt.Errorf("failed to read request: %w", err), http.StatusBadRequest)
+		}
+	} else {
+		if err := jc.Decode(&req); err != nil {
+			return TransactionDecodeRequest{}, err
+		}
+		var set int
+		for _, ok := range []bool{req.Transaction != nil, req.V2Transaction != nil, req.Hex != ""} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return TransactionDecodeRequest{}, jc.Error(errors.New("exactly one of transaction, v2Transaction, or hex must be set"), http.StatusBadRequest)
+		} else if req.Hex == "" {
+			return req, nil
+		}
+		buf, err = hex.DecodeString(req.Hex)
+		if err != nil {
+			return TransactionDecodeRequest{}, jc.Error(fmt.Errorf("invalid hex: %w", err), http.StatusBadRequest)
+		} else if req.Version == 0 {
+			req.Version = 2
+		}
+	}
+
+	d := types.NewBufDecoder(buf)
+	switch req.Version {
+	case 1:
+		req.Transaction = new(types.Transaction)
+		req.Transaction.DecodeFrom(d)
+	case 2:
+		req.V2Transaction = new(types.V2Transaction)
+		req.V2Transaction.DecodeFrom(d)
+	default:
+		return TransactionDecodeRequest{}, jc.Error(fmt.Errorf("invalid version %d: must be 1 or 2", req.Version), http.StatusBadRequest)
+	}
+	if err := d.Err(); err != nil {
+		return TransactionDecodeRequest{}, jc.Error(fmt.Errorf("failed to decode transaction: %w", err), http.StatusBadRequest)
+	}
+	return req, nil
+}
+
+// poolOutputs returns the siacoin and siafund outputs created by the
+// transactions in the pool.
+func (s *server) poolOutputs() (map[types.SiacoinOutputID]types.SiacoinOutput, map[types.SiafundOutputID]types.SiafundOutput) {
+	siacoins := make(map[types.SiacoinOutputID]types.SiacoinOutput)
+	siafunds := make(map[types.SiafundOutputID]types.SiafundOutput)
+	for _, txn := range s.cm.PoolTransactions() {
+		for i, sco := range txn.SiacoinOutputs {
+			siacoins[txn.SiacoinOutputID(i)] = sco
+		}
+		for i, sfo := range txn.SiafundOutputs {
+			siafunds[txn.SiafundOutputID(i)] = sfo
+		}
+	}
+	for _, txn := range s.cm.V2PoolTransactions() {
+		txid := txn.ID()
+		for i, sco := range txn.SiacoinOutputs {
+			siacoins[txn.SiacoinOutputID(txid, i)] = sco
+		}
+		for i, sfo := range txn.SiafundOutputs {
+			siafunds[txn.SiafundOutputID(txid, i)] = sfo
+		}
+	}
+	return siacoins, siafunds
+}
+
+// siacoinInputSource returns the source of a siacoin input and the output it
+// spends, if found.
+func (s *server) siacoinInputSource(id types.SiacoinOutputID, pool map[types.SiacoinOutputID]types.SiacoinOutput) (string, *types.SiacoinOutput, error) {
+	sce, err := s.wm.SiacoinElement(id)
+	if err == nil {
+		return InputSourceConfirmed, &sce.SiacoinOutput, nil
+	} else if !errors.Is(err, wallet.ErrNotFound) {
+		return "", nil, fmt.Errorf("failed to get siacoin output %v: %w", id, err)
+	} else if sco, ok := pool[id]; ok {
+		return InputSourceUnconfirmed, &sco, nil
+	}
+	return InputSourceUnknown, nil, nil
+}
+
+// siafundInputSource returns the source of a siafund input and the output it
+// spends, if found.
+func (s *server) siafundInputSource(id types.SiafundOutputID, pool map[types.SiafundOutputID]types.SiafundOutput) (string, *types.SiafundOutput, error) {
+	sfe, err := s.wm.SiafundElement(id)
+	if err == nil {
+		return InputSourceConfirmed, &sfe.SiafundOutput, nil
+	} else if !errors.Is(err, wallet.ErrNotFound) {
+		return "", nil, fmt.Errorf("failed to get siafund output %v: %w", id, err)
+	} else if sfo, ok := pool[id]; ok {
+		return InputSourceUnconfirmed, &sfo, nil
+	}
+	return InputSourceUnknown, nil, nil
+}
+
+// decodeTransaction annotates the inputs and outputs of a v1 or v2
+// transaction.
+func (s *server) decodeTransaction(txn *types.Transaction, v2txn *types.V2Transaction) (DecodedTransaction, error) {
+	cs := s.cm.TipState()
+	poolSiacoins, poolSiafunds := s.poolOutputs()
+	resp := DecodedTransaction{Transaction: txn, V2Transaction: v2txn}
+
+	if txn != nil {
+		resp.ID = txn.ID()
+		resp.Version = 1
+		for _, sci := range txn.SiacoinInputs {
+			source, parent, err := s.siacoinInputSource(sci.ParentID, poolSiacoins)
+			if err != nil {
+				return DecodedTransaction{}, err
+			}
+			in := DecodedSiacoinInput{ParentID: sci.ParentID, Source: source, Address: sci.UnlockConditions.UnlockHash()}
+			if parent != nil {
+				in.Value = &parent.Value
+			}
+			resp.SiacoinInputs = append(resp.SiacoinInputs, in)
+		}
+		for i, sco := range txn.SiacoinOutputs {
+			resp.SiacoinOutputs = append(resp.SiacoinOutputs, DecodedSiacoinOutput{ID: txn.SiacoinOutputID(i), Address: sco.Address, Value: sco.Value})
+		}
+		for _, sfi := range txn.SiafundInputs {
+			source, parent, err := s.siafundInputSource(sfi.ParentID, poolSiafunds)
+			if err != nil {
+				return DecodedTransaction{}, err
+			}
+			in := DecodedSiafundInput{ParentID: sfi.ParentID, Source: source, Address: sfi.UnlockConditions.UnlockHash()}
+			if parent != nil {
+				in.Value = &parent.Value
+			}
+			resp.SiafundInputs = append(resp.SiafundInputs, in)
+		}
+		for i, sfo := range txn.SiafundOutputs {
+			resp.SiafundOutputs = append(resp.SiafundOutputs, DecodedSiafundOutput{ID: txn.SiafundOutputID(i), Address: sfo.Address, Value: sfo.Value})
+		}
+		for _, fee := range txn.MinerFees {
+			resp.Fee = resp.Fee.Add(fee)
+		}
+		resp.Size = uint64(len(encodeToBytes(*txn)))
+		resp.Weight = cs.TransactionWeight(*txn)
+	} else {
+		// v2 inputs include their parent, so only the source is looked up
+		resp.ID = v2txn.ID()
+		resp.Version = 2
+		for _, sci := range v2txn.SiacoinInputs {
+			source, _, err := s.siacoinInputSource(sci.Parent.ID, poolSiacoins)
+			if err != nil {
+				return DecodedTransaction{}, err
+			}
+			value := sci.Parent.SiacoinOutput.Value
+			resp.SiacoinInputs = append(resp.SiacoinInputs, DecodedSiacoinInput{ParentID: sci.Parent.ID, Source: source, Address: sci.Parent.SiacoinOutput.Address, Value: &value})
+		}
+		for i, sco := range v2txn.SiacoinOutputs {
+			resp.SiacoinOutputs = append(resp.SiacoinOutputs, DecodedSiacoinOutput{ID: v2txn.SiacoinOutputID(resp.ID, i), Address: sco.Address, Value: sco.Value})
+		}
+		for _, sfi := range v2txn.SiafundInputs {
+			source, _, err := s.siafundInputSource(sfi.Parent.ID, poolSiafunds)
+			if err != nil {
+				return DecodedTransaction{}, err
+			}
+			value := sfi.Parent.SiafundOutput.Value
+			resp.SiafundInputs = append(resp.SiafundInputs, DecodedSiafundInput{ParentID: sfi.Parent.ID, Source: source, Address: sfi.Parent.SiafundOutput.Address, Value: &value})
+		}
+		for i, sfo := range v2txn.SiafundOutputs {
+			resp.SiafundOutputs = append(resp.SiafundOutputs, DecodedSiafundOutput{ID: v2txn.SiafundOutputID(resp.ID, i), Address: sfo.Address, Value: sfo.Value})
+		}
+		resp.Fee = v2txn.MinerFee
+		resp.Size = uint64(len(encodeToBytes(*v2txn)))
+		resp.Weight = cs.V2TransactionWeight(*v2txn)
+	}
+
+	var addrs []types.Address
+	for _, in := range resp.SiacoinInputs {
+		addrs = append(addrs, in.Address)
+	}
+	for _, out := range resp.SiacoinOutputs {
+		addrs = append(addrs, out.Address)
+	}
+	for _, in := range resp.SiafundInputs {
+		addrs = append(addrs, in.Address)
+	}
+	for _, out := range resp.SiafundOutputs {
+		addrs = append(addrs, out.Address)
+	}
+	owners, err := s.wm.AddressWallets(addrs)
+	if err != nil {
+		return DecodedTransaction{}, fmt.Errorf("failed to get address wallets: %w", err)
+	}
+	owner := func(addr types.Address) *wallet.ID {
+		if id, ok := owners[addr]; ok {
+			return &id
+		}
+		return nil
+	}
+	for i := range resp.SiacoinInputs {
+		resp.SiacoinInputs[i].WalletID = owner(resp.SiacoinInputs[i].Address)
+	}
+	for i := range resp.SiacoinOutputs {
+		resp.SiacoinOutputs[i].WalletID = owner(resp.SiacoinOutputs[i].Address)
+	}
+	for i := range resp.SiafundInputs {
+		resp.SiafundInputs[i].WalletID = owner(resp.SiafundInputs[i].Address)
+	}
+	for i := range resp.SiafundOutputs {
+		resp.SiafundOutputs[i].WalletID = owner(resp.SiafundOutputs[i].Address)
+	}
+	return resp, nil
+}
+
+func (s *server) transactionsDecodeHandlerPOST(jc jape.Context) {
+	req, err := decodeTransactionRequest(jc)
+	if err != nil {
+		return
+	}
+	resp, err := s.decodeTransaction(req.Transaction, req.V2Transaction)
+	if jc.Check("couldn't decode transaction", err) != nil {
+		return
+	}
+	jc.Encode(resp)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkDigestError writes an error response for a digest error and returns
+// it.
+func checkDigestError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, digest.ErrNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, digest.ErrInvalidFrequency):
+		jc.Error(err, http.StatusBadRequest)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) walletsDigestHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	sched, err := s.dgm.Schedule(id)
+	if checkDigestError(jc, "couldn't get digest schedule", err) != nil {
+		return
+	}
+	jc.Encode(sched)
+}
+
+func (s *server) walletsDigestHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var req DigestRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	_, err := s.dgm.SetSchedule(id, req.Frequency)
+	if checkDigestError(jc, "couldn't set digest schedule", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsDigestHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.dgm.RemoveSchedule(id)
+	if checkDigestError(jc, "couldn't remove digest schedule", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsDigestPreviewHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	frequency := digest.FrequencyDaily
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("frequency", &frequency) != nil {
+		return
+	}
+	d, err := s.dgm.Preview(id, frequency)
+	if checkDigestError(jc, "couldn't generate digest", err) != nil {
+		return
+	}
+	jc.Encode(d)
+}
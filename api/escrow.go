@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkEscrowError writes an error response for an escrow error and returns
+// it.
+func checkEscrowError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, escrow.ErrNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, escrow.ErrNotPending), errors.Is(err, escrow.ErrNotFunded), errors.Is(err, escrow.ErrSettlementPending),
+		errors.Is(err, escrow.ErrNoSettlement):
+		jc.Error(err, http.StatusConflict)
+	case errors.Is(err, escrow.ErrInvalidKeys), errors.Is(err, escrow.ErrUnknownKey), errors.Is(err, escrow.ErrInvalidSignature),
+		errors.Is(err, escrow.ErrInsufficientFunds):
+		jc.Error(err, http.StatusBadRequest)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) walletsEscrowsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	escrows, err := s.em.Escrows(id)
+	if checkEscrowError(jc, "couldn't get escrows", err) != nil {
+		return
+	}
+	jc.Encode(escrows)
+}
+
+func (s *server) walletsEscrowsHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req EscrowRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	e, err := s.em.Create(id, req.Buyer, req.Seller, req.Arbiter, req.BuyerAddress, req.SellerAddress, req.Amount)
+	if checkEscrowError(jc, "couldn't create escrow", err) != nil {
+		return
+	}
+	jc.Encode(e)
+}
+
+func (s *server) walletsEscrowsIDHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var escrowID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("escrow", &escrowID) != nil {
+		return
+	}
+	e, err := s.em.Escrow(id, escrowID)
+	if checkEscrowError(jc, "couldn't get escrow", err) != nil {
+		return
+	}
+	jc.Encode(e)
+}
+
+func (s *server) walletsEscrowsIDFundHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var escrowID int64
+	var req EscrowFundRequest
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("escrow", &escrowID) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	// the escrow is funded from req.Wallet, which may differ from the
+	// escrow's wallet, so the funding wallet must belong to the tenant and
+	// requires its own TOTP code
+	if visible, err := s.visibleWalletIDs(jc.Request, []wallet.ID{req.Wallet}); jc.Check("couldn't check wallet tenant", err) != nil {
+		return
+	} else if len(visible) == 0 {
+		jc.Error(wallet.ErrNotFound, http.StatusNotFound)
+		return
+	}
+	if s.totp != nil {
+		err := s.totp.Verify(req.Wallet, jc.Request.Header.Get(HeaderTOTP))
+		if checkTOTPError(jc, "couldn't verify TOTP code", err) != nil {
+			return
+		}
+	}
+	funding, err := s.em.Fund(id, escrowID, req.Wallet, req.ChangeAddress)
+	if checkEscrowError(jc, "couldn't fund escrow", err) != nil {
+		return
+	}
+	jc.Encode(funding)
+}
+
+func (s *server) walletsEscrowsIDSettle(jc jape.Context, settlementType string) {
+	var id wallet.ID
+	var escrowID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("escrow", &escrowID) != nil {
+		return
+	}
+	e, err := s.em.Settle(id, escrowID, settlementType)
+	if checkEscrowError(jc, "couldn't settle escrow", err) != nil {
+		return
+	}
+	jc.Encode(e)
+}
+
+func (s *server) walletsEscrowsIDReleaseHandlerPOST(jc jape.Context) {
+	s.walletsEscrowsIDSettle(jc, escrow.SettlementRelease)
+}
+
+func (s *server) walletsEscrowsIDRefundHandlerPOST(jc jape.Context) {
+	s.walletsEscrowsIDSettle(jc, escrow.SettlementRefund)
+}
+
+func (s *server) walletsEscrowsIDSignaturesHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var escrowID int64
+	var req EscrowSignatureRequest
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("escrow", &escrowID) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	e, err := s.em.AddSignature(id, escrowID, req.PublicKey, req.Signature)
+	if checkEscrowError(jc, "couldn't add escrow signature", err) != nil {
+		return
+	}
+	jc.Encode(e)
+}
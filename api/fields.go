@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go.sia.tech/jape"
+)
+
+// maxFields is the maximum number of fields that can be selected per
+// request.
+const maxFields = 100
+
+// A fieldTree is a set of selected JSON fields. A field with no children is
+// selected in full.
+type fieldTree map[string]fieldTree
+
+// add adds a dot-separated field path to the tree.
+func (ft fieldTree) add(path []string) {
+	node := ft
+	for i, key := range path {
+		child, ok := node[key]
+		if ok && len(child) == 0 {
+			return // the parent is already selected in full
+		} else if i == len(path)-1 {
+			node[key] = nil
+			return
+		} else if !ok {
+			child = make(fieldTree)
+			node[key] = child
+		}
+		node = child
+	}
+}
+
+// filter trims a JSON value to the selected fields. Arrays are filtered
+// element-wise, so a path selects the field from every element.
+func (ft fieldTree) filter(raw json.RawMessage) (json.RawMessage, error) {
+	switch trimmed := bytes.TrimSpace(raw); {
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(trimmed, &elems); err != nil {
+			return nil, err
+		}
+		for i := range elems {
+			v, err := ft.filter(elems[i])
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = v
+		}
+		return json.Marshal(elems)
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &obj); err != nil {
+			return nil, err
+		}
+		out := make(map[string]json.RawMessage, len(ft))
+		for key, child := range ft {
+			v, ok := obj[key]
+			if !ok {
+				continue
+			} else if len(child) == 0 {
+				out[key] = v
+				continue
+			}
+			v, err := child.filter(v)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+		}
+		return json.Marshal(out)
+	default:
+		// scalars and nulls have no fields to select
+		return raw, nil
+	}
+}
+
+// parseFields parses a comma-separated list of dot-separated field paths,
+// e.g. "id,siacoinOutput.value".
+func parseFields(s string) (fieldTree, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > maxFields {
+		return nil, fmt.Errorf("at most %d fields can be selected", maxFields)
+	}
+	ft := make(fieldTree)
+	for _, p := range parts {
+		path := strings.Split(strings.TrimSpace(p), ".")
+		for _, key := range path {
+			if key == "" {
+				return nil, fmt.Errorf("invalid field %q", p)
+			}
+		}
+		ft.add(path)
+	}
+	return ft, nil
+}
+
+// A fieldsResponseWriter buffers a response so its fields can be selected
+// before it is written.
+type fieldsResponseWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *fieldsResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *fieldsResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+// selectFields wraps a handler so its JSON response is trimmed to the fields
+// requested with the fields query parameter. Errors and non-JSON responses,
+// such as Sia-encoded responses, are written unchanged.
+func selectFields(h jape.Handler) jape.Handler {
+	return func(jc jape.Context) {
+		var param string
+		if jc.DecodeForm("fields", &param) != nil {
+			return
+		} else if param == "" {
+			h(jc)
+			return
+		}
+		ft, err := parseFields(param)
+		if err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+
+		w := jc.ResponseWriter
+		fw := &fieldsResponseWriter{ResponseWriter: w}
+		jc.ResponseWriter = fw
+		h(jc)
+		if fw.status == 0 {
+			fw.status = http.StatusOK
+		}
+
+		body := fw.buf.Bytes()
+		if ct, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); fw.status == http.StatusOK && ct == "application/json" {
+			var buf bytes.Buffer
+			filtered, err := ft.filter(body)
+			if err == nil {
+				err = json.Indent(&buf, filtered, "", "\t")
+			}
+			if err != nil {
+				jc.ResponseWriter = w
+				jc.Error(fmt.Errorf("failed to select fields: %w", err), http.StatusInternalServerError)
+				return
+			}
+			buf.WriteByte('\n')
+			body = buf.Bytes()
+		}
+		w.WriteHeader(fw.status)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/forecast"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// forecastItems returns the known future flows of a wallet: its maturing
+// outputs, queued payments, and transaction sets waiting for approval.
+func (s *server) forecastItems(id wallet.ID, now time.Time) ([]forecast.Item, error) {
+	const pageSize = 100
+
+	cs := s.cm.TipState()
+	immature, err := s.wm.ImmatureSiacoinOutputs(id)
+	if err != nil {
+		return nil, err
+	}
+	var items []forecast.Item
+	for _, sce := range immature {
+		items = append(items, forecast.Item{
+			Source: forecast.SourceMaturing,
+			Date:   forecast.MaturityDate(sce.MaturityHeight, cs.Index, now, cs.Network.BlockInterval),
+			Inflow: sce.SiacoinOutput.Value,
+		})
+	}
+
+	if s.pm != nil {
+		queued, err := s.pm.Queue(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range queued {
+			items = append(items, forecast.Item{Source: forecast.SourcePayments, Date: now, Outflow: p.Value})
+		}
+	}
+
+	if s.tm != nil {
+		for offset := 0; ; offset += pageSize {
+			pending, err := s.tm.PendingTransactions(treasury.StatusPending, offset, pageSize)
+			if err != nil {
+				return nil, err
+			}
+			for _, pt := range pending {
+				if pt.WalletID == id {
+					items = append(items, forecast.Item{Source: forecast.SourceApprovals, Date: now, Outflow: pt.Amount})
+				}
+			}
+			if len(pending) < pageSize {
+				break
+			}
+		}
+	}
+	return items, nil
+}
+
+func (s *server) walletsForecastHandlerGET(jc jape.Context) {
+	const pageSize = 1000
+
+	var id wallet.ID
+	days, window := 30, 30
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("days", &days) != nil || jc.DecodeForm("window", &window) != nil {
+		return
+	} else if days < 1 || days > 365 {
+		jc.Error(errors.New("days must be between 1 and 365"), http.StatusBadRequest)
+		return
+	} else if window < 1 || window > 365 {
+		jc.Error(errors.New("window must be between 1 and 365"), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	balance, err := s.wm.WalletBalance(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get balance", err) != nil {
+		return
+	}
+
+	items, err := s.forecastItems(id, now)
+	if jc.Check("couldn't get future flows", err) != nil {
+		return
+	}
+
+	// events are returned newest first
+	start := now.AddDate(0, 0, -window)
+	var history []wallet.Event
+	for offset := 0; ; offset += pageSize {
+		events, err := s.wm.WalletEvents(jc.Request.Context(), id, offset, pageSize)
+		if jc.Check("couldn't get events", err) != nil {
+			return
+		}
+		history = append(history, events...)
+		if len(events) < pageSize || events[len(events)-1].Timestamp.Before(start) {
+			break
+		}
+	}
+	inflow, outflow := forecast.AverageFlows(history, start, now)
+	jc.Encode(forecast.Project(balance.Siacoins, items, inflow, outflow, now, days))
+}
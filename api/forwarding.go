@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/operations"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkForwardingError writes an error response for a forwarding error and
+// returns it.
+func checkForwardingError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, forwarding.ErrNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, forwarding.ErrExists):
+		jc.Error(err, http.StatusConflict)
+	case errors.Is(err, forwarding.ErrNotWalletAddress), errors.Is(err, forwarding.ErrInvalidDestination), errors.Is(err, forwarding.ErrInvalidSplits),
+		errors.Is(err, forwarding.ErrNothingToSweep), errors.Is(err, forwarding.ErrBelowMinimum):
+		jc.Error(err, http.StatusBadRequest)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) walletsForwardingHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	rules, err := s.fm.Rules(id)
+	if checkForwardingError(jc, "couldn't get forwarding rules", err) != nil {
+		return
+	}
+	jc.Encode(rules)
+}
+
+func (s *server) walletsForwardingHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req ForwardingRuleRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		// a rule sends the wallet's future deposits to another address
+		jc.Error(errors.New("forwarding rules can only be added with the API password"), http.StatusForbidden)
+		return
+	}
+	r, err := s.fm.AddRule(id, req.Address, req.Destination, req.Splits, req.MinConfirmations, req.MinAmount)
+	if checkForwardingError(jc, "couldn't add forwarding rule", err) != nil {
+		return
+	}
+	jc.Encode(r)
+}
+
+func (s *server) walletsForwardingIDHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var ruleID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rule", &ruleID) != nil {
+		return
+	}
+	r, err := s.fm.Rule(id, ruleID)
+	if checkForwardingError(jc, "couldn't get forwarding rule", err) != nil {
+		return
+	}
+	jc.Encode(r)
+}
+
+func (s *server) walletsForwardingIDHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var ruleID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rule", &ruleID) != nil {
+		return
+	}
+	err := s.fm.RemoveRule(id, ruleID)
+	if checkForwardingError(jc, "couldn't remove forwarding rule", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsForwardingIDSweepsHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var ruleID int64
+	var async bool
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rule", &ruleID) != nil || jc.DecodeForm("async", &async) != nil {
+		return
+	} else if async {
+		s.startOperation(jc, operations.TypeForwardingSweep, func(context.Context, operations.ProgressFunc) (any, error) {
+			return s.fm.Sweep(id, ruleID)
+		})
+		return
+	}
+	sweep, err := s.fm.Sweep(id, ruleID)
+	if checkForwardingError(jc, "couldn't sweep deposit address", err) != nil {
+		return
+	}
+	jc.Encode(sweep)
+}
+
+func (s *server) walletsForwardingSweepsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var ruleID int64
+	offset, limit := 0, 100
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("rule", &ruleID) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	sweeps, err := s.fm.Sweeps(id, ruleID, offset, limit)
+	if checkForwardingError(jc, "couldn't get forwarding sweeps", err) != nil {
+		return
+	}
+	jc.Encode(sweeps)
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// errInvalidSet is returned when a transaction set cannot be ordered.
+var errInvalidSet = errors.New("invalid transaction set")
+
+// outputCreators maps outputs to the transactions that create them.
+type outputCreators struct {
+	siacoins map[types.SiacoinOutputID]types.TransactionID
+	siafunds map[types.SiafundOutputID]types.TransactionID
+}
+
+// add records the outputs created by a transaction node.
+func (oc outputCreators) add(node TransactionNode) {
+	for _, id := range node.SiacoinOutputIDs {
+		oc.siacoins[id] = node.ID
+	}
+	for _, id := range node.SiafundOutputIDs {
+		oc.siafunds[id] = node.ID
+	}
+}
+
+// A graphInput is the set of outputs spent by a transaction.
+type graphInput struct {
+	siacoins []types.SiacoinOutputID
+	siafunds []types.SiafundOutputID
+}
+
+// transactionNodes returns the nodes of a set of v1 and v2 transactions and
+// the outputs each spends.
+func transactionNodes(txns []types.Transaction, v2txns []types.V2Transaction) (nodes []TransactionNode, inputs []graphInput) {
+	for _, txn := range txns {
+		node := TransactionNode{ID: txn.ID(), Version: 1}
+		var in graphInput
+		for i := range txn.SiacoinOutputs {
+			node.SiacoinOutputIDs = append(node.SiacoinOutputIDs, txn.SiacoinOutputID(i))
+		}
+		for i := range txn.SiafundOutputs {
+			node.SiafundOutputIDs = append(node.SiafundOutputIDs, txn.SiafundOutputID(i))
+		}
+		for _, sci := range txn.SiacoinInputs {
+			in.siacoins = append(in.siacoins, sci.ParentID)
+		}
+		for _, sfi := range txn.SiafundInputs {
+			in.siafunds = append(in.siafunds, sfi.ParentID)
+		}
+		nodes, inputs = append(nodes, node), append(inputs, in)
+	}
+	for _, txn := range v2txns {
+		node := TransactionNode{ID: txn.ID(), Version: 2}
+		var in graphInput
+		for i := range txn.SiacoinOutputs {
+			node.SiacoinOutputIDs = append(node.SiacoinOutputIDs, txn.SiacoinOutputID(node.ID, i))
+		}
+		for i := range txn.SiafundOutputs {
+			node.SiafundOutputIDs = append(node.SiafundOutputIDs, txn.SiafundOutputID(node.ID, i))
+		}
+		for _, sci := range txn.SiacoinInputs {
+			in.siacoins = append(in.siacoins, sci.Parent.ID)
+		}
+		for _, sfi := range txn.SiafundInputs {
+			in.siafunds = append(in.siafunds, sfi.Parent.ID)
+		}
+		nodes, inputs = append(nodes, node), append(inputs, in)
+	}
+	return
+}
+
+// appendUnique appends id to ids if it is not already present.
+func appendUnique(ids []types.TransactionID, id types.TransactionID) []types.TransactionID {
+	for _, existing := range ids {
+		if existing == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
+
+// broadcastOrder returns the IDs of the nodes ordered so that each node comes
+// after its parents. Otherwise, the order of the nodes is preserved.
+func broadcastOrder(nodes []TransactionNode) ([]types.TransactionID, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	index := make(map[types.TransactionID]int, len(nodes))
+	for i, node := range nodes {
+		index[node.ID] = i
+	}
+	state := make([]int, len(nodes))
+	order := make([]types.TransactionID, 0, len(nodes))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: transaction %v depends on itself", errInvalidSet, nodes[i].ID)
+		}
+		state[i] = visiting
+		for _, parent := range nodes[i].Parents {
+			if err := visit(index[parent]); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		order = append(order, nodes[i].ID)
+		return nil
+	}
+	for i := range nodes {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// transactionGraph returns the dependency graph of a set of transactions.
+func (s *server) transactionGraph(txns []types.Transaction, v2txns []types.V2Transaction) (TxpoolGraphResponse, error) {
+	nodes, inputs := transactionNodes(txns, v2txns)
+	set := outputCreators{make(map[types.SiacoinOutputID]types.TransactionID), make(map[types.SiafundOutputID]types.TransactionID)}
+	seen := make(map[types.TransactionID]bool)
+	for _, node := range nodes {
+		if seen[node.ID] {
+			return TxpoolGraphResponse{}, fmt.Errorf("%w: transaction %v is in the set more than once", errInvalidSet, node.ID)
+		}
+		seen[node.ID] = true
+		set.add(node)
+	}
+	poolNodes, _ := transactionNodes(s.cm.PoolTransactions(), s.cm.V2PoolTransactions())
+	pool := outputCreators{make(map[types.SiacoinOutputID]types.TransactionID), make(map[types.SiafundOutputID]types.TransactionID)}
+	for _, node := range poolNodes {
+		pool.add(node)
+	}
+
+	resp := TxpoolGraphResponse{Transactions: nodes, Complete: true}
+	for i := range nodes {
+		node := &resp.Transactions[i]
+		for _, id := range inputs[i].siacoins {
+			if txid, ok := set.siacoins[id]; ok {
+				node.Parents = appendUnique(node.Parents, txid)
+			} else if txid, ok := pool.siacoins[id]; ok {
+				node.PoolParents = appendUnique(node.PoolParents, txid)
+			} else if _, err := s.wm.SiacoinElement(id); errors.Is(err, wallet.ErrNotFound) {
+				node.MissingSiacoinParents = append(node.MissingSiacoinParents, id)
+			} else if err != nil {
+				return TxpoolGraphResponse{}, fmt.Errorf("failed to get siacoin output %v: %w", id, err)
+			}
+		}
+		for _, id := range inputs[i].siafunds {
+			if txid, ok := set.siafunds[id]; ok {
+				node.Parents = appendUnique(node.Parents, txid)
+			} else if txid, ok := pool.siafunds[id]; ok {
+				node.PoolParents = appendUnique(node.PoolParents, txid)
+			} else if _, err := s.wm.SiafundElement(id); errors.Is(err, wallet.ErrNotFound) {
+				node.MissingSiafundParents = append(node.MissingSiafundParents, id)
+			} else if err != nil {
+				return TxpoolGraphResponse{}, fmt.Errorf("failed to get siafund output %v: %w", id, err)
+			}
+		}
+		if len(node.MissingSiacoinParents) != 0 || len(node.MissingSiafundParents) != 0 {
+			resp.Complete = false
+		}
+	}
+
+	order, err := broadcastOrder(resp.Transactions)
+	if err != nil {
+		return TxpoolGraphResponse{}, err
+	}
+	resp.Order = order
+	return resp, nil
+}
+
+func (s *server) txpoolGraphHandlerPOST(jc jape.Context) {
+	var req TxpoolBroadcastRequest
+	if isBinaryRequest(jc.Request) {
+		if decodeBinary(jc, &req) != nil {
+			return
+		}
+	} else if jc.Decode(&req) != nil {
+		return
+	}
+
+	resp, err := s.transactionGraph(req.Transactions, req.V2Transactions)
+	if errors.Is(err, errInvalidSet) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't build transaction graph", err) != nil {
+		return
+	}
+	jc.Encode(resp)
+}
@@ -0,0 +1,369 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/graphql"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// graphqlContentType is the media type of GraphQL responses. Responses are
+// not application/json, so currencies are formatted by the schema rather than
+// rewritten by key name, which would not account for aliases.
+const graphqlContentType = "application/graphql-response+json"
+
+type currencyFormatKey struct{}
+
+// graphqlAddress is the source of the Address type. Info is only set for
+// addresses loaded from a wallet.
+type graphqlAddress struct {
+	Address types.Address
+	Info    *wallet.Address
+}
+
+// WithGraphQL enables the /graphql endpoint.
+func WithGraphQL() ServerOption {
+	return func(s *server) {
+		s.graphqlEnabled = true
+	}
+}
+
+// graphqlCurrency returns a currency in the requested format.
+func graphqlCurrency(ctx context.Context, c types.Currency) any {
+	if format, _ := ctx.Value(currencyFormatKey{}).(CurrencyFormat); format == CurrencyFormatSC {
+		return formatSC(c)
+	}
+	return c
+}
+
+// graphqlPagination returns the offset and limit arguments of a list field.
+func graphqlPagination(args graphql.Args) (offset, limit int, err error) {
+	if offset, err = args.Int("offset", 0); err != nil {
+		return 0, 0, err
+	} else if limit, err = args.Int("limit", 100); err != nil {
+		return 0, 0, err
+	} else if offset < 0 {
+		return 0, 0, errors.New("offset must be non-negative")
+	} else if limit < 1 || limit > 1000 {
+		return 0, 0, errors.New("limit must be between 1 and 1000")
+	}
+	return offset, limit, nil
+}
+
+// graphqlWalletID returns the id argument of a wallet field. Both integers
+// and strings are accepted.
+func graphqlWalletID(args graphql.Args) (wallet.ID, error) {
+	if s, ok := args["id"].(string); ok {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid argument %q: %w", "id", err)
+		}
+		return wallet.ID(n), nil
+	}
+	n, err := args.Int("id", -1)
+	if err != nil {
+		return 0, err
+	} else if n < 0 {
+		return 0, errors.New(`argument "id" is required`)
+	}
+	return wallet.ID(n), nil
+}
+
+// scalar returns a field that resolves to a value derived from its source.
+func scalar[T any](fn func(ctx context.Context, source T) any) *graphql.Field {
+	return &graphql.Field{Resolve: func(ctx context.Context, source any, _ graphql.Args) (any, error) {
+		return fn(ctx, source.(T)), nil
+	}}
+}
+
+// annotate annotates events with their counterparties and categories.
+func (s *server) annotate(events []wallet.Event) ([]wallet.AnnotatedEvent, error) {
+	return s.categorize(wallet.AnnotateEvents(events, s.lookupTag))
+}
+
+// graphqlSchema returns the schema served by the /graphql endpoint.
+func (s *server) graphqlSchema() *graphql.Schema {
+	balance := &graphql.Object{Name: "Balance", Fields: map[string]*graphql.Field{
+		"siacoins":         scalar(func(ctx context.Context, b wallet.Balance) any { return graphqlCurrency(ctx, b.Siacoins) }),
+		"immatureSiacoins": scalar(func(ctx context.Context, b wallet.Balance) any { return graphqlCurrency(ctx, b.ImmatureSiacoins) }),
+		"siafunds":         scalar(func(_ context.Context, b wallet.Balance) any { return b.Siafunds }),
+	}}
+
+	counterparty := &graphql.Object{Name: "Counterparty", Fields: map[string]*graphql.Field{
+		"address":  scalar(func(_ context.Context, cp wallet.Counterparty) any { return cp.Address }),
+		"role":     scalar(func(_ context.Context, cp wallet.Counterparty) any { return cp.Role }),
+		"value":    scalar(func(ctx context.Context, cp wallet.Counterparty) any { return graphqlCurrency(ctx, cp.Value) }),
+		"label":    scalar(func(_ context.Context, cp wallet.Counterparty) any { return cp.Label }),
+		"category": scalar(func(_ context.Context, cp wallet.Counterparty) any { return cp.Category }),
+		"wallet":   scalar(func(_ context.Context, cp wallet.Counterparty) any { return cp.Wallet }),
+	}}
+
+	address := &graphql.Object{Name: "Address"}
+	event := &graphql.Object{Name: "Event"}
+	siacoinOutput := &graphql.Object{Name: "SiacoinOutput"}
+	siafundOutput := &graphql.Object{Name: "SiafundOutput"}
+
+	event.Fields = map[string]*graphql.Field{
+		"id":             scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.ID }),
+		"type":           scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Type }),
+		"height":         scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Index.Height }),
+		"blockID":        scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Index.ID }),
+		"confirmations":  scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Confirmations }),
+		"maturityHeight": scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.MaturityHeight }),
+		"timestamp":      scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Timestamp }),
+		"data":           scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Data }),
+		"categories":     scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return append([]string{}, ev.Categories...) }),
+		"reverted":       scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Reverted }),
+		"internal":       scalar(func(_ context.Context, ev wallet.AnnotatedEvent) any { return ev.Internal }),
+		"change":         scalar(func(ctx context.Context, ev wallet.AnnotatedEvent) any { return graphqlCurrency(ctx, ev.Change) }),
+		"inflow": scalar(func(ctx context.Context, ev wallet.AnnotatedEvent) any {
+			inflow, _ := wallet.EventFlows(ev.Event)
+			return graphqlCurrency(ctx, inflow)
+		}),
+		"outflow": scalar(func(ctx context.Context, ev wallet.AnnotatedEvent) any {
+			_, outflow := wallet.EventFlows(ev.Event)
+			return graphqlCurrency(ctx, outflow)
+		}),
+		"counterparties": {Type: counterparty, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			return append([]wallet.Counterparty{}, source.(wallet.AnnotatedEvent).Counterparties...), nil
+		}},
+		"relevant": {Type: address, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			relevant := make([]graphqlAddress, 0, len(source.(wallet.AnnotatedEvent).Relevant))
+			for _, addr := range source.(wallet.AnnotatedEvent).Relevant {
+				relevant = append(relevant, graphqlAddress{Address: addr})
+			}
+			return relevant, nil
+		}},
+	}
+
+	outputAddress := func(addr types.Address) any { return graphqlAddress{Address: addr} }
+	siacoinOutput.Fields = map[string]*graphql.Field{
+		"id": scalar(func(_ context.Context, sce types.SiacoinElement) any { return sce.ID }),
+		"value": scalar(func(ctx context.Context, sce types.SiacoinElement) any {
+			return graphqlCurrency(ctx, sce.SiacoinOutput.Value)
+		}),
+		"maturityHeight": scalar(func(_ context.Context, sce types.SiacoinElement) any { return sce.MaturityHeight }),
+		"address": {Type: address, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			return outputAddress(source.(types.SiacoinElement).SiacoinOutput.Address), nil
+		}},
+	}
+	siafundOutput.Fields = map[string]*graphql.Field{
+		"id":         scalar(func(_ context.Context, sfe types.SiafundElement) any { return sfe.ID }),
+		"value":      scalar(func(_ context.Context, sfe types.SiafundElement) any { return sfe.SiafundOutput.Value }),
+		"claimStart": scalar(func(ctx context.Context, sfe types.SiafundElement) any { return graphqlCurrency(ctx, sfe.ClaimStart) }),
+		"address": {Type: address, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			return outputAddress(source.(types.SiafundElement).SiafundOutput.Address), nil
+		}},
+	}
+
+	addressInfo := func(fn func(info wallet.Address) any) *graphql.Field {
+		return scalar(func(_ context.Context, a graphqlAddress) any {
+			if a.Info == nil {
+				return nil
+			}
+			return fn(*a.Info)
+		})
+	}
+	address.Fields = map[string]*graphql.Field{
+		"address":        scalar(func(_ context.Context, a graphqlAddress) any { return a.Address }),
+		"description":    addressInfo(func(info wallet.Address) any { return info.Description }),
+		"metadata":       addressInfo(func(info wallet.Address) any { return info.Metadata }),
+		"spendPolicy":    addressInfo(func(info wallet.Address) any { return info.SpendPolicy }),
+		"derivationPath": addressInfo(func(info wallet.Address) any { return info.DerivationPath }),
+		"balance": {Type: balance, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			return s.wm.AddressBalance(source.(graphqlAddress).Address)
+		}},
+		"events": {Type: event, Args: []string{"offset", "limit"}, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			events, err := s.wm.AddressEvents(ctx, source.(graphqlAddress).Address, offset, limit)
+			if err != nil {
+				return nil, err
+			}
+			return s.annotate(events)
+		}},
+		"siacoinOutputs": {Type: siacoinOutput, Args: []string{"offset", "limit"}, Resolve: func(_ context.Context, source any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			return s.wm.AddressSiacoinOutputs(source.(graphqlAddress).Address, offset, limit)
+		}},
+		"siafundOutputs": {Type: siafundOutput, Args: []string{"offset", "limit"}, Resolve: func(_ context.Context, source any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			return s.wm.AddressSiafundOutputs(source.(graphqlAddress).Address, offset, limit)
+		}},
+	}
+
+	walletType := &graphql.Object{Name: "Wallet", Fields: map[string]*graphql.Field{
+		"id":          scalar(func(_ context.Context, w wallet.Wallet) any { return w.ID }),
+		"name":        scalar(func(_ context.Context, w wallet.Wallet) any { return w.Name }),
+		"description": scalar(func(_ context.Context, w wallet.Wallet) any { return w.Description }),
+		"type":        scalar(func(_ context.Context, w wallet.Wallet) any { return w.Type }),
+		"metadata":    scalar(func(_ context.Context, w wallet.Wallet) any { return w.Metadata }),
+		"dateCreated": scalar(func(_ context.Context, w wallet.Wallet) any { return w.DateCreated }),
+		"lastUpdated": scalar(func(_ context.Context, w wallet.Wallet) any { return w.LastUpdated }),
+		"revision":    scalar(func(_ context.Context, w wallet.Wallet) any { return w.Revision }),
+		"balance": {Type: balance, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			return s.wm.WalletBalance(source.(wallet.Wallet).ID)
+		}},
+		"addresses": {Type: address, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			addrs, err := s.wm.Addresses(source.(wallet.Wallet).ID)
+			if err != nil {
+				return nil, err
+			}
+			resp := make([]graphqlAddress, 0, len(addrs))
+			for i := range addrs {
+				resp = append(resp, graphqlAddress{Address: addrs[i].Address, Info: &addrs[i]})
+			}
+			return resp, nil
+		}},
+		"events": {Type: event, Args: []string{"offset", "limit", "category"}, Resolve: func(ctx context.Context, source any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			category, err := args.String("category", "")
+			if err != nil {
+				return nil, err
+			}
+			events, err := s.wm.WalletCategoryEvents(ctx, source.(wallet.Wallet).ID, category, offset, limit)
+			if err != nil {
+				return nil, err
+			}
+			return s.annotate(events)
+		}},
+		"unconfirmedEvents": {Type: event, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+			events, err := s.wm.WalletUnconfirmedEvents(source.(wallet.Wallet).ID)
+			if err != nil {
+				return nil, err
+			}
+			return s.markInternal(wallet.AnnotateEvents(events, s.lookupTag))
+		}},
+		"siacoinOutputs": {Type: siacoinOutput, Args: []string{"offset", "limit"}, Resolve: func(_ context.Context, source any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			return s.wm.UnspentSiacoinOutputs(source.(wallet.Wallet).ID, offset, limit)
+		}},
+		"siafundOutputs": {Type: siafundOutput, Args: []string{"offset", "limit"}, Resolve: func(_ context.Context, source any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			return s.wm.UnspentSiafundOutputs(source.(wallet.Wallet).ID, offset, limit)
+		}},
+	}}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"wallets": {Type: walletType, Args: []string{"offset", "limit", "namePrefix"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			offset, limit, err := graphqlPagination(args)
+			if err != nil {
+				return nil, err
+			}
+			prefix, err := args.String("namePrefix", "")
+			if err != nil {
+				return nil, err
+			}
+			wallets, _, err := s.wm.FilterWallets(wallet.WalletFilter{NamePrefix: prefix, Offset: offset, Limit: limit})
+			return wallets, err
+		}},
+		"wallet": {Type: walletType, Args: []string{"id"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			id, err := graphqlWalletID(args)
+			if err != nil {
+				return nil, err
+			}
+			wallets, err := s.wm.Wallets()
+			if err != nil {
+				return nil, err
+			}
+			for _, w := range wallets {
+				if w.ID == id {
+					return w, nil
+				}
+			}
+			return nil, nil
+		}},
+		"address": {Type: address, Args: []string{"address"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			var addr types.Address
+			if err := args.Text("address", &addr); err != nil {
+				return nil, err
+			}
+			return graphqlAddress{Address: addr}, nil
+		}},
+		"event": {Type: event, Args: []string{"id"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			var id types.Hash256
+			if err := args.Text("id", &id); err != nil {
+				return nil, err
+			}
+			fe, err := s.wm.Event(id)
+			if errors.Is(err, wallet.ErrNotFound) {
+				return nil, nil
+			} else if err != nil {
+				return nil, err
+			}
+			annotated, err := s.categorize(s.annotateFeed([]wallet.FeedEvent{fe}))
+			if err != nil {
+				return nil, err
+			}
+			return annotated[0], nil
+		}},
+		"siacoinOutput": {Type: siacoinOutput, Args: []string{"id"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			var id types.SiacoinOutputID
+			if err := args.Text("id", &id); err != nil {
+				return nil, err
+			}
+			sce, err := s.wm.SiacoinElement(id)
+			if errors.Is(err, wallet.ErrNotFound) {
+				return nil, nil
+			}
+			return sce, err
+		}},
+		"siafundOutput": {Type: siafundOutput, Args: []string{"id"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			var id types.SiafundOutputID
+			if err := args.Text("id", &id); err != nil {
+				return nil, err
+			}
+			sfe, err := s.wm.SiafundElement(id)
+			if errors.Is(err, wallet.ErrNotFound) {
+				return nil, nil
+			}
+			return sfe, err
+		}},
+	}}
+	return &graphql.Schema{Query: query}
+}
+
+func (s *server) graphqlHandlerPOST(jc jape.Context) {
+	var req graphql.Request
+	if jc.Decode(&req) != nil {
+		return
+	}
+	format, err := requestCurrencyFormat(jc.Request, s.currencyFormat)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	ctx := context.WithValue(jc.Request.Context(), currencyFormatKey{}, format)
+	resp := s.gqlSchema.Execute(ctx, req)
+
+	jc.ResponseWriter.Header().Set("Content-Type", graphqlContentType)
+	if resp.Data == nil {
+		// the request could not be executed
+		jc.ResponseWriter.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(jc.ResponseWriter).Encode(resp)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func (s *server) groupsHandlerGET(jc jape.Context) {
+	groups, err := s.wm.Groups()
+	if jc.Check("couldn't load groups", err) != nil {
+		return
+	}
+	jc.Encode(groups)
+}
+
+func (s *server) groupsHandlerPOST(jc jape.Context) {
+	var req GroupRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Name == "" {
+		jc.Error(errors.New("group name is required"), http.StatusBadRequest)
+		return
+	}
+	g, err := s.wm.AddGroup(wallet.Group{
+		Name:        req.Name,
+		Description: req.Description,
+		ParentID:    req.ParentID,
+	})
+	if errors.Is(err, wallet.ErrGroupNotFound) || errors.Is(err, wallet.ErrGroupDepth) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't add group", err) != nil {
+		return
+	}
+	jc.Encode(g)
+}
+
+func (s *server) groupsIDHandlerPOST(jc jape.Context) {
+	var id wallet.GroupID
+	var req GroupRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if req.Name == "" {
+		jc.Error(errors.New("group name is required"), http.StatusBadRequest)
+		return
+	}
+	g, err := s.wm.UpdateGroup(wallet.Group{
+		ID:          id,
+		Name:        req.Name,
+		Description: req.Description,
+		ParentID:    req.ParentID,
+	})
+	if errors.Is(err, wallet.ErrGroupNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, wallet.ErrGroupDepth) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't update group", err) != nil {
+		return
+	}
+	jc.Encode(g)
+}
+
+func (s *server) groupsIDHandlerDELETE(jc jape.Context) {
+	var id wallet.GroupID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.wm.DeleteGroup(id)
+	if errors.Is(err, wallet.ErrGroupNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't delete group", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) groupsIDWalletsHandlerGET(jc jape.Context) {
+	var id wallet.GroupID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	wallets, err := s.wm.GroupWallets(id)
+	if errors.Is(err, wallet.ErrGroupNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load wallets", err) != nil {
+		return
+	}
+	jc.Encode(wallets)
+}
+
+func (s *server) groupsIDWalletsHandlerPUT(jc jape.Context) {
+	var id wallet.GroupID
+	var walletID wallet.ID
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("wallet", &walletID) != nil {
+		return
+	}
+	err := s.wm.AddGroupWallet(id, walletID)
+	if errors.Is(err, wallet.ErrGroupNotFound) || errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't add wallet to group", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) groupsIDWalletsHandlerDELETE(jc jape.Context) {
+	var id wallet.GroupID
+	var walletID wallet.ID
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("wallet", &walletID) != nil {
+		return
+	}
+	err := s.wm.RemoveGroupWallet(id, walletID)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove wallet from group", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) groupsIDBalanceHandlerGET(jc jape.Context) {
+	var id wallet.GroupID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	b, err := s.wm.GroupBalance(id)
+	if errors.Is(err, wallet.ErrGroupNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load balance", err) != nil {
+		return
+	}
+	jc.Encode(BalanceResponse(b))
+}
+
+func (s *server) groupsIDEventsHandlerGET(jc jape.Context) {
+	var id wallet.GroupID
+	offset, limit := 0, 500
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	events, err := s.wm.GroupEvents(jc.Request.Context(), id, offset, limit)
+	if errors.Is(err, wallet.ErrGroupNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load events", err) != nil {
+		return
+	}
+	annotated, err := s.categorize(wallet.AnnotateEvents(events, s.lookupTag))
+	if jc.Check("couldn't load event categories", err) != nil {
+		return
+	}
+	jc.Encode(annotated)
+}
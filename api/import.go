@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/importer"
+	"go.thebigfile.com/walletd/usage"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+func (s *server) walletsImportHandlerPOST(jc jape.Context) {
+	var req WalletImportRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Passphrase != "" && s.ks == nil {
+		jc.Error(errors.New("encrypted seed storage is not enabled"), http.StatusBadRequest)
+		return
+	}
+
+	iw, err := importer.Parse(req.Format, []byte(req.Data), req.Addresses)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	w := wallet.Wallet{
+		Name:        req.Name,
+		Description: req.Description,
+		Metadata:    req.Metadata,
+	}
+	// wallets imported by a tenant are owned by it
+	w.Tenant, _ = tenantFromRequest(jc.Request)
+	if !s.checkWalletQuota(jc, w.Tenant) {
+		return
+	} else if s.um != nil && w.Tenant != "" {
+		quota := s.um.Quota(w.Tenant)
+		tu, err := s.tenantUsage(w.Tenant)
+		if jc.Check("couldn't get tenant usage", err) != nil {
+			return
+		} else if quota.Addresses > 0 && tu.Addresses+len(iw.Addresses) > quota.Addresses {
+			jc.Error(fmt.Errorf("%w: %d addresses", usage.ErrQuotaExceeded, quota.Addresses), http.StatusForbidden)
+			return
+		}
+	}
+
+	w, err = s.wm.AddWallet(w)
+	if jc.Check("couldn't add wallet", err) != nil {
+		return
+	}
+	// remove the partially imported wallet if any step fails
+	fail := func(msg string, err error) {
+		if err := s.wm.DeleteWallet(w.ID); err != nil {
+			s.log.Warn("failed to remove partially imported wallet", zap.Int64("wallet", int64(w.ID)), zap.Error(err))
+		}
+		jc.Error(fmt.Errorf("%s: %w", msg, err), http.StatusInternalServerError)
+	}
+	var conflicts []AddressConflict
+	for _, addr := range iw.Addresses {
+		result, err := s.wm.AddAddressWithResult(w.ID, addr)
+		if err != nil {
+			fail("couldn't add address", err)
+			return
+		}
+		result, err = s.visibleAddAddressResult(jc.Request, result)
+		if err != nil {
+			fail("couldn't check wallet tenants", err)
+			return
+		} else if result.Status != wallet.AddressConflict {
+			continue
+		}
+		conflicts = append(conflicts, AddressConflict{Address: addr.Address, WalletIDs: result.WalletIDs})
+	}
+	if req.Passphrase != "" {
+		if err := s.ks.AddSeed(w.ID, iw.Phrase, req.Passphrase); err != nil {
+			fail("couldn't store seed", err)
+			return
+		}
+	}
+
+	jc.Encode(WalletImportResponse{
+		Wallet:     w,
+		Format:     iw.Format,
+		Addresses:  len(iw.Addresses),
+		SeedStored: req.Passphrase != "",
+		Conflicts:  conflicts,
+	})
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/jobs"
+)
+
+func (s *server) systemJobsHandlerGET(jc jape.Context) {
+	jc.Encode(s.jobs.Jobs())
+}
+
+func (s *server) systemJobsTriggerHandlerPOST(jc jape.Context) {
+	name := jc.PathParam("name")
+	if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("jobs can only be triggered with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.jobs.Trigger(name)
+	if errors.Is(err, jobs.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't trigger job", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) setJobPaused(jc jape.Context, paused bool) {
+	name := jc.PathParam("name")
+	if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("jobs can only be paused or resumed with the API password"), http.StatusForbidden)
+		return
+	}
+	job, err := s.jobs.SetPaused(name, paused)
+	if errors.Is(err, jobs.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't update job", err) != nil {
+		return
+	}
+	jc.Encode(job)
+}
+
+func (s *server) systemJobsPauseHandlerPOST(jc jape.Context) {
+	s.setJobPaused(jc, true)
+}
+
+func (s *server) systemJobsResumeHandlerPOST(jc jape.Context) {
+	s.setJobPaused(jc, false)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkKeyStoreError writes an error response for a keystore error and
+// returns it.
+func checkKeyStoreError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, keystore.ErrNotFound), errors.Is(err, keystore.ErrChallengeNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, keystore.ErrExists):
+		jc.Error(err, http.StatusConflict)
+	case errors.Is(err, keystore.ErrInvalidTimeout), errors.Is(err, keystore.ErrInvalidChallenge), errors.Is(err, keystore.ErrBackupMismatch):
+		jc.Error(err, http.StatusBadRequest)
+	case errors.Is(err, keystore.ErrIncorrectPassphrase):
+		jc.Error(err, http.StatusForbidden)
+	case errors.Is(err, keystore.ErrLocked):
+		jc.Error(err, http.StatusLocked)
+	case errors.Is(err, keystore.ErrBackupLockedOut):
+		jc.Error(err, http.StatusTooManyRequests)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) walletsSeedHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	status, err := s.ks.Status(id)
+	if checkKeyStoreError(jc, "couldn't get seed status", err) != nil {
+		return
+	}
+	jc.Encode(status)
+}
+
+func (s *server) walletsSeedHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var req WalletSeedRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	err := s.ks.AddSeed(id, req.Phrase, req.Passphrase)
+	if errors.Is(err, wallet.ErrNotFound) || errors.Is(err, keystore.ErrExists) {
+		checkKeyStoreError(jc, "", err)
+		return
+	} else if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsSeedHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.ks.RemoveSeed(id)
+	if checkKeyStoreError(jc, "couldn't remove seed", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsUnlockHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req WalletUnlockRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	status, err := s.ks.Unlock(id, req.Passphrase, req.Timeout)
+	if checkKeyStoreError(jc, "couldn't unlock wallet", err) != nil {
+		return
+	}
+	jc.Encode(status)
+}
+
+func (s *server) walletsLockHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.ks.Lock(id)
+	if checkKeyStoreError(jc, "couldn't lock wallet", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsBackupChallengeHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req BackupChallengeRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		// answers reveal words of the recovery phrase
+		jc.Error(errors.New("backups can only be verified with the API password"), http.StatusForbidden)
+		return
+	}
+	c, err := s.ks.BackupChallenge(id, req.Words)
+	if checkKeyStoreError(jc, "couldn't create backup challenge", err) != nil {
+		return
+	}
+	jc.Encode(c)
+}
+
+func (s *server) walletsBackupVerifyHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req BackupVerifyRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("backups can only be verified with the API password"), http.StatusForbidden)
+		return
+	}
+	status, err := s.ks.VerifyBackup(id, req.ChallengeID, req.Words)
+	if checkKeyStoreError(jc, "couldn't verify backup", err) != nil {
+		return
+	}
+	jc.Encode(status)
+}
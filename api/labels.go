@@ -0,0 +1,26 @@
+package api
+
+import (
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/labels"
+)
+
+func (s *server) enumsHandlerGET(jc jape.Context) {
+	// the locale parameter overrides the Accept-Language header
+	var locale string
+	if jc.DecodeForm("locale", &locale) != nil {
+		return
+	} else if locale == "" {
+		locale = jc.Request.Header.Get("Accept-Language")
+	}
+	locale = labels.Negotiate(locale)
+
+	h := jc.ResponseWriter.Header()
+	h.Set("Content-Language", locale)
+	h.Add("Vary", "Accept-Language")
+	jc.Encode(EnumerationsResponse{
+		Locale:       locale,
+		Locales:      labels.Locales(),
+		Enumerations: labels.Enumerations(locale),
+	})
+}
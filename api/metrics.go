@@ -0,0 +1,131 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// metricsWriter writes metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// header writes the help and type lines of a metric.
+func (mw *metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(&mw.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of a metric. labels are alternating names and
+// values.
+func (mw *metricsWriter) sample(name string, value any, labels ...string) {
+	mw.buf.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+		}
+		mw.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(&mw.buf, " %v\n", value)
+}
+
+// metric writes a metric with a single unlabeled sample.
+func (mw *metricsWriter) metric(name, typ, help string, value any) {
+	mw.header(name, typ, help)
+	mw.sample(name, value)
+}
+
+func (s *server) metricsHandler(jc jape.Context) {
+	var mw metricsWriter
+	mw.metric("walletd_consensus_height", "gauge", "Height of the consensus tip.", s.cm.Tip().Height)
+	mw.metric("walletd_syncer_peers", "gauge", "Number of connected peers.", len(s.s.Peers()))
+
+	ingest := s.wm.IngestStatus()
+	mw.metric("walletd_wallet_ingest_queue_depth", "gauge", "Chain update jobs waiting to be applied to the wallet store.", ingest.QueueDepth)
+	mw.metric("walletd_wallet_ingest_lag_blocks", "gauge", "Blocks the wallet store is behind the consensus tip.", ingest.Lag)
+	var catchingUp int
+	if ingest.CatchingUp {
+		catchingUp = 1
+	}
+	mw.metric("walletd_wallet_ingest_catching_up", "gauge", "Whether the wallet store is syncing in catch-up mode.", catchingUp)
+
+	if s.bm != nil {
+		total := s.bm.Total()
+		mw.metric("walletd_syncer_sent_bytes_total", "counter", "Bytes sent to inbound peers.", total.Sent)
+		mw.metric("walletd_syncer_received_bytes_total", "counter", "Bytes received from inbound peers.", total.Received)
+
+		peers := s.bm.Peers()
+		addrs := make([]string, 0, len(peers))
+		for addr := range peers {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		mw.header("walletd_syncer_peer_sent_bytes", "gauge", "Bytes sent to each connected inbound peer.")
+		for _, addr := range addrs {
+			mw.sample("walletd_syncer_peer_sent_bytes", peers[addr].Sent, "peer", addr)
+		}
+		mw.header("walletd_syncer_peer_received_bytes", "gauge", "Bytes received from each connected inbound peer.")
+		for _, addr := range addrs {
+			mw.sample("walletd_syncer_peer_received_bytes", peers[addr].Received, "peer", addr)
+		}
+	}
+
+	if s.qm != nil {
+		counts := s.qm.SlowQueries()
+		ops := make([]string, 0, len(counts))
+		for op := range counts {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+		mw.header("walletd_store_slow_queries_total", "counter", "Store queries that exceeded the slow query threshold.")
+		for _, op := range ops {
+			mw.sample("walletd_store_slow_queries_total", counts[op], "op", op)
+		}
+	}
+
+	if s.pools != nil {
+		queued, inUse := s.pools.PoolQueueDepth(), s.pools.PoolInUse()
+		pools := make([]string, 0, len(queued))
+		for pool := range queued {
+			pools = append(pools, pool)
+		}
+		sort.Strings(pools)
+		mw.header("walletd_store_pool_queue_depth", "gauge", "Store transactions waiting for a database connection.")
+		for _, pool := range pools {
+			mw.sample("walletd_store_pool_queue_depth", queued[pool], "pool", pool)
+		}
+		mw.header("walletd_store_pool_connections_in_use", "gauge", "Database connections in use.")
+		for _, pool := range pools {
+			mw.sample("walletd_store_pool_connections_in_use", inUse[pool], "pool", pool)
+		}
+		mw.metric("walletd_store_busy_retries_total", "counter", "Store transactions retried because the database was locked.", s.pools.BusyRetries())
+
+		stats := s.pools.WalletQueryStats()
+		ids := make([]wallet.ID, 0, len(stats))
+		for id := range stats {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		mw.header("walletd_store_wallet_queries_total", "counter", "Expensive store queries, such as event listings, by wallet.")
+		for _, id := range ids {
+			mw.sample("walletd_store_wallet_queries_total", stats[id].Queries, "wallet", strconv.FormatInt(int64(id), 10))
+		}
+		mw.header("walletd_store_wallet_query_wait_seconds_total", "counter", "Time expensive store queries waited for the fair scheduler, by wallet.")
+		for _, id := range ids {
+			mw.sample("walletd_store_wallet_query_wait_seconds_total", stats[id].Wait.Seconds(), "wallet", strconv.FormatInt(int64(id), 10))
+		}
+		mw.header("walletd_store_wallet_query_seconds_total", "counter", "Time expensive store queries spent running, by wallet.")
+		for _, id := range ids {
+			mw.sample("walletd_store_wallet_query_seconds_total", stats[id].Elapsed.Seconds(), "wallet", strconv.FormatInt(int64(id), 10))
+		}
+	}
+
+	jc.ResponseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	jc.ResponseWriter.Write(mw.buf.Bytes())
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/operations"
+)
+
+// rescanProgressInterval is how often the progress of a rescan operation is
+// updated.
+const rescanProgressInterval = time.Second
+
+// WithOperationManager sets the manager that runs long-running operations,
+// such as rescans. If not set, the server creates its own, which is never
+// closed.
+func WithOperationManager(om *operations.Manager) ServerOption {
+	return func(s *server) {
+		s.ops = om
+	}
+}
+
+// startOperation starts fn as an operation and responds with its initial
+// state.
+func (s *server) startOperation(jc jape.Context, typ string, fn operations.Func) {
+	op, err := s.ops.Start(typ, fn)
+	if jc.Check("couldn't start operation", err) != nil {
+		return
+	}
+	encodeAccepted(jc, op)
+}
+
+// encodeAccepted responds with the initial state of an operation that is
+// running in the background.
+func encodeAccepted(jc jape.Context, op operations.Operation) {
+	jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+	jc.ResponseWriter.WriteHeader(http.StatusAccepted)
+	jc.Encode(op)
+}
+
+func (s *server) operationsHandlerGET(jc jape.Context) {
+	var typ string
+	if jc.DecodeForm("type", &typ) != nil {
+		return
+	}
+	jc.Encode(s.ops.Operations(typ))
+}
+
+func (s *server) operationsIDHandlerGET(jc jape.Context) {
+	var id types.Hash256
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	op, err := s.ops.Operation(id)
+	if errors.Is(err, operations.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get operation", err) != nil {
+		return
+	}
+	jc.Encode(op)
+}
+
+func (s *server) operationsIDHandlerDELETE(jc jape.Context) {
+	var id types.Hash256
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	op, err := s.ops.Cancel(id)
+	if errors.Is(err, operations.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, operations.ErrFinished) {
+		jc.Error(err, http.StatusConflict)
+		return
+	} else if jc.Check("couldn't cancel operation", err) != nil {
+		return
+	}
+	jc.Encode(op)
+}
+
+// rescan scans the chain from index, reporting the number of blocks scanned
+// as its progress. The total is the number of blocks between index and the
+// tip when progress is reported, so it grows as blocks are mined.
+func (s *server) rescan(ctx context.Context, index types.ChainIndex, progress operations.ProgressFunc) (any, error) {
+	done := make(chan error, 1)
+	go func() { done <- s.wm.Scan(ctx, index) }()
+
+	t := time.NewTicker(rescanProgressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case err := <-done:
+			s.scanMu.Lock()
+			defer s.scanMu.Unlock()
+			if err != nil {
+				msg := err.Error()
+				s.scanInfo.Error = &msg
+				return nil, err
+			}
+			return nil, nil
+		case <-t.C:
+			tip, err := s.wm.Tip()
+			if err != nil {
+				continue
+			}
+			var scanned, total uint64
+			if tip.Height > index.Height {
+				scanned = tip.Height - index.Height
+			}
+			if h := s.cm.Tip().Height; h > index.Height {
+				total = h - index.Height
+			}
+			progress(scanned, total)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/operations"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func (s *server) walletsPaymentsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	queued, err := s.pm.Queue(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get queued payments", err) != nil {
+		return
+	}
+	jc.Encode(queued)
+}
+
+func (s *server) walletsPaymentsHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req PaymentRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	p, err := s.pm.Enqueue(id, req.Address, req.Value)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.Encode(p)
+}
+
+func (s *server) walletsPaymentsIDHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var paymentID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("payment", &paymentID) != nil {
+		return
+	}
+	err := s.pm.Cancel(id, paymentID)
+	if errors.Is(err, payments.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't cancel payment", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsPaymentsFlushHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var async bool
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("async", &async) != nil {
+		return
+	} else if async {
+		s.startOperation(jc, operations.TypePayout, func(context.Context, operations.ProgressFunc) (any, error) {
+			return s.pm.Flush(id)
+		})
+		return
+	}
+	batch, err := s.pm.Flush(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, payments.ErrEmptyQueue) || errors.Is(err, payments.ErrInsufficientBalance) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't flush payments", err) != nil {
+		return
+	}
+	jc.Encode(batch)
+}
+
+func (s *server) walletsPaymentsBatchesHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	offset, limit := 0, 100
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	batches, err := s.pm.Batches(id, offset, limit)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get batches", err) != nil {
+		return
+	}
+	jc.Encode(batches)
+}
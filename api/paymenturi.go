@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/paymenturi"
+)
+
+func (s *server) paymentURIsHandlerPOST(jc jape.Context) {
+	var u paymenturi.URI
+	if jc.Decode(&u) != nil {
+		return
+	} else if err := u.Validate(time.Now()); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.Encode(PaymentURIResponse{URI: u.String(), Request: u})
+}
+
+func (s *server) paymentURIsParseHandlerPOST(jc jape.Context) {
+	var req PaymentURIRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	u, err := paymenturi.Parse(req.URI)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	// expired requests are still returned, so callers can show why they
+	// cannot be paid
+	jc.Encode(PaymentURIResponse{URI: u.String(), Request: u, Expired: u.Expired(time.Now())})
+}
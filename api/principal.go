@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+
+	"go.thebigfile.com/walletd/treasury"
+)
+
+// Principals identify the credential used to authenticate a request. A
+// principal has the form credential[/detail], where the detail distinguishes
+// logins that share a credential.
+const (
+	// principalAnonymous is the principal of every request when auth is
+	// disabled.
+	principalAnonymous = "anonymous"
+	// principalPublic is the principal of unauthenticated requests to
+	// public endpoints when auth is enabled.
+	principalPublic   = "public"
+	principalPassword = "password"
+)
+
+type principalKey struct{}
+
+// signingKeyPrincipal returns the principal of a request signed with the
+// given key.
+func signingKeyPrincipal(keyID string) string {
+	return "key:" + keyID
+}
+
+// sessionPrincipal returns the principal of a request authenticated with the
+// session token with the given ID. Sessions are issued in exchange for the
+// API password, so they share its credential.
+func sessionPrincipal(id [16]byte) string {
+	return principalPassword + "/session:" + hex.EncodeToString(id[:4])
+}
+
+// isAdmin returns true if the principal authenticated with the API password
+// or auth is disabled. Signing keys are meant for automated access, so they
+// cannot change the controls that protect against their compromise.
+func isAdmin(principal string) bool {
+	return treasury.Credential(principal) == principalPassword || principal == principalAnonymous
+}
+
+// submitter returns the principal recorded as the submitter of a transaction
+// set that requires approval. Sets submitted while auth is disabled have no
+// submitter, so that they can still be approved.
+func submitter(r *http.Request) string {
+	if principal := principalFromRequest(r); principal != principalAnonymous {
+		return principal
+	}
+	return ""
+}
+
+// withPrincipal returns a copy of the request with the principal attached to
+// its context.
+func withPrincipal(r *http.Request, principal string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// principalFromRequest returns the principal that made the request.
+func principalFromRequest(r *http.Request) string {
+	if principal, ok := r.Context().Value(principalKey{}).(string); ok {
+		return principal
+	}
+	return principalAnonymous
+}
+
+// batchPrincipal returns the principal attached to a request's context by
+// its parent batch request. External requests never have one.
+func batchPrincipal(r *http.Request) (string, bool) {
+	principal, ok := r.Context().Value(principalKey{}).(string)
+	return principal, ok
+}
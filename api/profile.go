@@ -0,0 +1,120 @@
+package api
+
+import "fmt"
+
+// A Profile is a named subset of the API's routes. Routes that are not part of
+// the server's profile are not registered.
+type Profile string
+
+// Endpoint exposure profiles.
+const (
+	// ProfileWalletAdmin exposes every route. All routes other than the auth
+	// routes require authentication. This is the default profile.
+	ProfileWalletAdmin Profile = "wallet-admin"
+	// ProfilePublicExplorer exposes the read-only consensus, txpool, and
+	// address routes, along with transaction broadcasting. Authentication is
+	// disabled on all exposed routes, making it suitable for a public
+	// interface.
+	ProfilePublicExplorer Profile = "public-explorer"
+	// ProfileSignerOnly exposes the routes required by an external signer to
+	// fund, sign, and broadcast transactions for existing wallets.
+	ProfileSignerOnly Profile = "signer-only"
+)
+
+var profileRoutes = map[Profile][]string{
+	ProfileWalletAdmin: nil, // all routes
+	ProfilePublicExplorer: {
+		"GET /state",
+
+		"GET /consensus/network",
+		"GET /consensus/tip",
+		"GET /consensus/tipstate",
+		"GET /consensus/updates/:index",
+		"GET /consensus/index/:height",
+		"GET /consensus/stats",
+		"GET /consensus/blocks/:id",
+
+		"GET /syncer/status",
+		"GET /syncer/peers",
+		"POST /syncer/broadcast/block",
+
+		"GET /txpool/transactions",
+		"GET /txpool/fee",
+		"POST /txpool/parents",
+		"POST /txpool/broadcast",
+
+		"GET /addresses/:addr/balance",
+		"GET /addresses/:addr/events",
+		"GET /addresses/:addr/events/unconfirmed",
+		"GET /addresses/:addr/outputs/siacoin",
+		"GET /addresses/:addr/outputs/siafund",
+
+		"GET /outputs/siacoin/:id",
+		"GET /outputs/siafund/:id",
+
+		"GET /events/:id",
+
+		"GET /enums",
+
+		"POST /payment-uris",
+		"POST /payment-uris/parse",
+	},
+	ProfileSignerOnly: {
+		"GET /state",
+
+		"POST /auth/login",
+		"POST /auth/refresh",
+		"POST /auth/logout",
+
+		"GET /consensus/network",
+		"GET /consensus/tip",
+		"GET /consensus/tipstate",
+
+		"GET /txpool/fee",
+		"POST /txpool/parents",
+		"POST /txpool/broadcast",
+
+		"GET /wallets",
+		"GET /wallets/:id/addresses",
+		"GET /wallets/:id/balance",
+		"GET /wallets/:id/outputs/siacoin",
+		"GET /wallets/:id/outputs/siafund",
+		"GET /wallets/:id/fees/rate",
+		"POST /wallets/:id/reserve",
+		"POST /wallets/:id/release",
+		"POST /wallets/:id/fund",
+		"POST /wallets/:id/fundsf",
+		"POST /wallets/:id/sign",
+	},
+}
+
+// Routes returns the routes exposed by the profile. A nil slice indicates
+// that all routes are exposed.
+func (p Profile) Routes() []string {
+	return append([]string(nil), profileRoutes[p]...)
+}
+
+// allows returns true if the profile exposes the route.
+func (p Profile) allows(route string) bool {
+	routes, ok := profileRoutes[p]
+	if !ok {
+		return false
+	} else if routes == nil {
+		return true
+	}
+	for _, r := range routes {
+		if r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProfile parses a profile name.
+func ParseProfile(s string) (Profile, error) {
+	p := Profile(s)
+	if _, ok := profileRoutes[p]; !ok {
+		return "", fmt.Errorf("unknown profile %q", s)
+	}
+	return p, nil
+}
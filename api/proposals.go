@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkProposalError writes an error response for a withdrawal proposal
+// error and returns it.
+func checkProposalError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, wallet.ErrProposalNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, wallet.ErrNotColdWallet), errors.Is(err, wallet.ErrInsufficientBalance),
+		errors.Is(err, wallet.ErrProposalNotPending), errors.Is(err, wallet.ErrProposalMismatch):
+		jc.Error(err, http.StatusBadRequest)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) walletsProposalsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	offset, limit := 0, 100
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	proposals, err := s.wm.WithdrawalProposals(id, offset, limit)
+	if checkProposalError(jc, "couldn't get proposals", err) != nil {
+		return
+	}
+	jc.Encode(proposals)
+}
+
+func (s *server) walletsProposalsHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req WithdrawalProposalRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	p, err := s.wm.ProposeWithdrawal(id, req.Outputs, req.ChangeAddress)
+	if checkProposalError(jc, "couldn't create proposal", err) != nil {
+		return
+	}
+	jc.Encode(p)
+}
+
+func (s *server) walletsProposalsIDHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var proposalID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("proposal", &proposalID) != nil {
+		return
+	}
+	p, err := s.wm.WithdrawalProposal(id, proposalID)
+	if checkProposalError(jc, "couldn't get proposal", err) != nil {
+		return
+	}
+	jc.Encode(p)
+}
+
+func (s *server) walletsProposalsIDHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var proposalID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("proposal", &proposalID) != nil {
+		return
+	}
+	_, err := s.wm.CancelWithdrawalProposal(id, proposalID)
+	if checkProposalError(jc, "couldn't cancel proposal", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsProposalsIDSubmitHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var proposalID int64
+	var signed types.V2Transaction
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("proposal", &proposalID) != nil || jc.Decode(&signed) != nil {
+		return
+	}
+	var broadcastErr, policyErr error
+	var pt treasury.PendingTransaction
+	var pending bool
+	p, err := s.wm.SubmitWithdrawalProposal(id, proposalID, signed, func(basis types.ChainIndex, txn types.V2Transaction) error {
+		txns := []types.V2Transaction{txn}
+		broadcast := func() error {
+			if _, err := s.cm.AddV2PoolTransactions(basis, txns); err != nil {
+				broadcastErr = fmt.Errorf("invalid transaction: %w", err)
+				return broadcastErr
+			}
+			s.s.BroadcastV2TransactionSet(basis, txns)
+			return nil
+		}
+		if s.tm == nil {
+			return broadcast()
+		}
+		// accepted proposals are subject to the same treasury controls as
+		// /txpool/broadcast
+		pt, pending, policyErr = s.tm.BroadcastTransactionSet(nil, txns, submitter(jc.Request), broadcast)
+		return policyErr
+	})
+	if broadcastErr != nil {
+		jc.Error(broadcastErr, http.StatusBadRequest)
+		return
+	} else if errors.Is(policyErr, treasury.ErrLimitExceeded) || errors.Is(policyErr, treasury.ErrDestinationNotAllowed) {
+		jc.Error(policyErr, http.StatusForbidden)
+		return
+	} else if checkProposalError(jc, "couldn't submit proposal", err) != nil {
+		return
+	} else if pending {
+		// the transaction was added to the approval queue instead of being
+		// broadcast
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusAccepted)
+		jc.Encode(pt)
+		return
+	}
+	jc.Encode(p)
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/reconcile"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// maxReconcileBlocks is the maximum number of blocks that can be reconciled
+// in one request.
+const maxReconcileBlocks = 10000
+
+func (s *server) walletsReconcileHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req WalletReconcileRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if req.Start > req.End {
+		jc.Error(errors.New("start must not be after end"), http.StatusBadRequest)
+		return
+	} else if req.End-req.Start >= maxReconcileBlocks {
+		jc.Error(fmt.Errorf("range must be at most %d blocks", maxReconcileBlocks), http.StatusBadRequest)
+		return
+	} else if err := reconcile.Validate(req.Entries); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.wm.WalletEventsBetween(jc.Request.Context(), id, req.Start, req.End)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get events", err) != nil {
+		return
+	}
+	jc.Encode(reconcile.Reconcile(req.Entries, events))
+}
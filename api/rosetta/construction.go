@@ -0,0 +1,412 @@
+package rosetta
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+type (
+	// PreprocessOptions are the options returned by
+	// /construction/preprocess and passed to /construction/metadata.
+	PreprocessOptions struct {
+		Inputs  []types.SiacoinOutputID `json:"inputs"`
+		Outputs int                     `json:"outputs"`
+	}
+
+	// TransactionMetadata is the metadata returned by
+	// /construction/metadata and passed to /construction/payloads. It
+	// contains the elements spent by the transaction and the index their
+	// proofs are valid at.
+	TransactionMetadata struct {
+		Basis  types.ChainIndex       `json:"basis"`
+		Inputs []types.SiacoinElement `json:"inputs"`
+	}
+)
+
+// An opInput is a coin spent by an operation.
+type opInput struct {
+	ID      types.SiacoinOutputID
+	Address types.Address
+	Value   types.Currency
+}
+
+// parseValue parses the value of an operation. Inputs have negative values
+// and outputs have positive values.
+func parseValue(a *Amount, negative bool) (types.Currency, error) {
+	if a == nil {
+		return types.Currency{}, errors.New("missing amount")
+	} else if a.Currency != SiacoinCurrency {
+		return types.Currency{}, fmt.Errorf("unsupported currency %q", a.Currency.Symbol)
+	}
+	s, isNegative := strings.CutPrefix(a.Value, "-")
+	if isNegative != negative {
+		return types.Currency{}, fmt.Errorf("amount %q has the wrong sign", a.Value)
+	}
+	var c types.Currency
+	if err := c.UnmarshalText([]byte(s)); err != nil {
+		return types.Currency{}, fmt.Errorf("invalid amount %q: %w", a.Value, err)
+	} else if c.IsZero() {
+		return types.Currency{}, errors.New("amount must not be zero")
+	}
+	return c, nil
+}
+
+// parseRecipient parses the address of an output operation. If the operation
+// has a spend policy, the address is derived from it and must match the
+// account, if any.
+func parseRecipient(op Operation) (types.Address, error) {
+	if op.Metadata == nil || op.Metadata.Policy == nil {
+		if op.Account == nil {
+			return types.Address{}, errors.New("missing account")
+		}
+		return parseAddress(*op.Account)
+	}
+	addr := op.Metadata.Policy.Address()
+	if op.Account != nil {
+		if acct, err := parseAddress(*op.Account); err != nil {
+			return types.Address{}, err
+		} else if acct != addr {
+			return types.Address{}, fmt.Errorf("account %v does not match policy address %v", acct, addr)
+		}
+	}
+	return addr, nil
+}
+
+// parseOperations parses the inputs and outputs of a transaction to be
+// constructed.
+func parseOperations(ops []Operation) (inputs []opInput, outputs []types.SiacoinOutput, _ error) {
+	fail := func(i int, err error) error {
+		return ErrInvalidRequest.wrap(fmt.Errorf("operation %d: %w", i, err))
+	}
+	for i, op := range ops {
+		if op.OperationIdentifier.Index != int64(i) {
+			return nil, nil, fail(i, errors.New("operations must be indexed in order"))
+		} else if op.Status != nil {
+			return nil, nil, fail(i, errors.New("status must not be set"))
+		}
+
+		switch op.Type {
+		case OpTypeInput:
+			if op.Account == nil {
+				return nil, nil, fail(i, errors.New("missing account"))
+			} else if op.Metadata != nil && op.Metadata.Policy != nil {
+				return nil, nil, fail(i, errors.New("inputs must not set a policy"))
+			}
+			addr, err := parseAddress(*op.Account)
+			if err != nil {
+				return nil, nil, fail(i, err)
+			}
+			value, err := parseValue(op.Amount, true)
+			if err != nil {
+				return nil, nil, fail(i, err)
+			} else if op.CoinChange == nil || op.CoinChange.CoinAction != coinSpent {
+				return nil, nil, fail(i, errors.New("inputs must spend a coin"))
+			}
+			var id types.SiacoinOutputID
+			if err := id.UnmarshalText([]byte(op.CoinChange.CoinIdentifier.Identifier)); err != nil {
+				return nil, nil, fail(i, fmt.Errorf("invalid coin identifier: %w", err))
+			}
+			for _, in := range inputs {
+				if in.ID == id {
+					return nil, nil, fail(i, fmt.Errorf("coin %v is spent twice", id))
+				}
+			}
+			inputs = append(inputs, opInput{ID: id, Address: addr, Value: value})
+		case OpTypeOutput:
+			addr, err := parseRecipient(op)
+			if err != nil {
+				return nil, nil, fail(i, err)
+			}
+			value, err := parseValue(op.Amount, false)
+			if err != nil {
+				return nil, nil, fail(i, err)
+			} else if op.CoinChange != nil {
+				return nil, nil, fail(i, errors.New("outputs must not set a coin change"))
+			}
+			outputs = append(outputs, types.SiacoinOutput{Address: addr, Value: value})
+		default:
+			return nil, nil, fail(i, fmt.Errorf("unsupported operation type %q", op.Type))
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, nil, ErrInvalidRequest.wrap(errors.New("transaction must have at least one input"))
+	}
+	return inputs, outputs, nil
+}
+
+// parsePublicKey parses an ed25519 public key.
+func parsePublicKey(pk PublicKey) (types.PublicKey, error) {
+	if pk.CurveType != curveEdwards25519 {
+		return types.PublicKey{}, ErrInvalidRequest.wrap(fmt.Errorf("unsupported curve type %q", pk.CurveType))
+	}
+	buf, err := hex.DecodeString(pk.HexBytes)
+	if err != nil || len(buf) != len(types.PublicKey{}) {
+		return types.PublicKey{}, ErrInvalidRequest.wrap(errors.New("public key must be 32 hex-encoded bytes"))
+	}
+	return types.PublicKey(buf), nil
+}
+
+// encodeTransaction encodes a transaction and the index its input proofs are
+// valid at.
+func encodeTransaction(basis types.ChainIndex, txn types.V2Transaction) string {
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	basis.EncodeTo(e)
+	txn.EncodeTo(e)
+	e.Flush()
+	return hex.EncodeToString(buf.Bytes())
+}
+
+// decodeTransaction decodes a transaction encoded by encodeTransaction.
+func decodeTransaction(s string) (basis types.ChainIndex, txn types.V2Transaction, _ error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return types.ChainIndex{}, types.V2Transaction{}, ErrInvalidTransaction.wrap(err)
+	}
+	d := types.NewBufDecoder(buf)
+	basis.DecodeFrom(d)
+	txn.DecodeFrom(d)
+	if err := d.Err(); err != nil {
+		return types.ChainIndex{}, types.V2Transaction{}, ErrInvalidTransaction.wrap(err)
+	}
+	return basis, txn, nil
+}
+
+func (s *Server) constructionDerive(req ConstructionDeriveRequest) (ConstructionDeriveResponse, error) {
+	pk, err := parsePublicKey(req.PublicKey)
+	if err != nil {
+		return ConstructionDeriveResponse{}, err
+	}
+	return ConstructionDeriveResponse{AccountIdentifier: AccountIdentifier{Address: types.StandardUnlockHash(pk).String()}}, nil
+}
+
+func (s *Server) constructionPreprocess(req ConstructionPreprocessRequest) (ConstructionPreprocessResponse, error) {
+	inputs, outputs, err := parseOperations(req.Operations)
+	if err != nil {
+		return ConstructionPreprocessResponse{}, err
+	}
+	opts := &PreprocessOptions{Outputs: len(outputs)}
+	var signers []AccountIdentifier
+	seen := make(map[types.Address]bool)
+	for _, in := range inputs {
+		opts.Inputs = append(opts.Inputs, in.ID)
+		if !seen[in.Address] {
+			seen[in.Address] = true
+			signers = append(signers, AccountIdentifier{Address: in.Address.String()})
+		}
+	}
+	return ConstructionPreprocessResponse{Options: opts, RequiredPublicKeys: signers}, nil
+}
+
+func (s *Server) constructionMetadata(req ConstructionMetadataRequest) (ConstructionMetadataResponse, error) {
+	if len(req.Options.Inputs) == 0 {
+		return ConstructionMetadataResponse{}, ErrInvalidRequest.wrap(errors.New("transaction must have at least one input"))
+	} else if req.Options.Outputs < 0 {
+		return ConstructionMetadataResponse{}, ErrInvalidRequest.wrap(errors.New("output count must not be negative"))
+	}
+	basis, err := s.wm.Tip()
+	if err != nil {
+		return ConstructionMetadataResponse{}, fmt.Errorf("failed to get index tip: %w", err)
+	}
+
+	md := TransactionMetadata{Basis: basis}
+	// the weight of the transaction is estimated with placeholder policies
+	// and outputs
+	var txn types.V2Transaction
+	for _, id := range req.Options.Inputs {
+		sce, err := s.wm.SiacoinElement(id)
+		if errors.Is(err, wallet.ErrNotFound) {
+			return ConstructionMetadataResponse{}, ErrInvalidTransaction.wrap(fmt.Errorf("coin %v does not exist or is spent", id))
+		} else if err != nil {
+			return ConstructionMetadataResponse{}, fmt.Errorf("failed to get coin %v: %w", id, err)
+		} else if sce.MaturityHeight > basis.Height+1 {
+			return ConstructionMetadataResponse{}, ErrInvalidTransaction.wrap(fmt.Errorf("coin %v is immature until height %d", id, sce.MaturityHeight))
+		}
+		md.Inputs = append(md.Inputs, sce)
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+			Parent: sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{
+				Policy:     types.SpendPolicy{Type: types.PolicyTypeUnlockConditions(types.StandardUnlockConditions(types.PublicKey{}))},
+				Signatures: []types.Signature{{}},
+			},
+		})
+	}
+	txn.SiacoinOutputs = make([]types.SiacoinOutput, req.Options.Outputs)
+	fee := s.cm.RecommendedFee().Mul64(s.cm.TipState().V2TransactionWeight(txn))
+	return ConstructionMetadataResponse{Metadata: md, SuggestedFee: []Amount{*amount(fee, false)}}, nil
+}
+
+func (s *Server) constructionPayloads(req ConstructionPayloadsRequest) (ConstructionPayloadsResponse, error) {
+	inputs, outputs, err := parseOperations(req.Operations)
+	if err != nil {
+		return ConstructionPayloadsResponse{}, err
+	} else if len(inputs) != len(req.Metadata.Inputs) {
+		return ConstructionPayloadsResponse{}, ErrInvalidRequest.wrap(errors.New("operations do not match metadata"))
+	}
+	keys := make(map[types.Address]types.PublicKey)
+	for _, pk := range req.PublicKeys {
+		key, err := parsePublicKey(pk)
+		if err != nil {
+			return ConstructionPayloadsResponse{}, err
+		}
+		keys[types.StandardUnlockHash(key)] = key
+	}
+
+	var txn types.V2Transaction
+	var inflow, outflow types.Currency
+	for i, in := range inputs {
+		sce := req.Metadata.Inputs[i]
+		if sce.ID != in.ID || sce.SiacoinOutput.Address != in.Address || !sce.SiacoinOutput.Value.Equals(in.Value) {
+			return ConstructionPayloadsResponse{}, ErrInvalidRequest.wrap(fmt.Errorf("operation %d does not match coin %v", i, sce.ID))
+		}
+		pk, ok := keys[in.Address]
+		if !ok {
+			return ConstructionPayloadsResponse{}, ErrInvalidRequest.wrap(fmt.Errorf("missing public key for address %v", in.Address))
+		}
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+			Parent:          sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{Policy: types.SpendPolicy{Type: types.PolicyTypeUnlockConditions(types.StandardUnlockConditions(pk))}},
+		})
+		inflow = inflow.Add(in.Value)
+	}
+	for _, sco := range outputs {
+		outflow = outflow.Add(sco.Value)
+	}
+	if outflow.Cmp(inflow) > 0 {
+		return ConstructionPayloadsResponse{}, ErrInvalidTransaction.wrap(errors.New("outputs exceed inputs"))
+	}
+	txn.SiacoinOutputs = outputs
+	// the difference between the inputs and outputs is the fee
+	txn.MinerFee = inflow.Sub(outflow)
+
+	sigHash := s.cm.TipState().InputSigHash(txn)
+	var payloads []SigningPayload
+	seen := make(map[types.Address]bool)
+	for _, in := range inputs {
+		if seen[in.Address] {
+			continue
+		}
+		seen[in.Address] = true
+		payloads = append(payloads, SigningPayload{
+			AccountIdentifier: &AccountIdentifier{Address: in.Address.String()},
+			HexBytes:          hex.EncodeToString(sigHash[:]),
+			SignatureType:     signatureEd25519,
+		})
+	}
+	return ConstructionPayloadsResponse{
+		UnsignedTransaction: encodeTransaction(req.Metadata.Basis, txn),
+		Payloads:            payloads,
+	}, nil
+}
+
+func (s *Server) constructionCombine(req ConstructionCombineRequest) (ConstructionCombineResponse, error) {
+	basis, txn, err := decodeTransaction(req.UnsignedTransaction)
+	if err != nil {
+		return ConstructionCombineResponse{}, err
+	}
+	sigHash := s.cm.TipState().InputSigHash(txn)
+	for i, sig := range req.Signatures {
+		pk, err := parsePublicKey(sig.PublicKey)
+		if err != nil {
+			return ConstructionCombineResponse{}, err
+		} else if sig.SignatureType != signatureEd25519 {
+			return ConstructionCombineResponse{}, ErrInvalidRequest.wrap(fmt.Errorf("unsupported signature type %q", sig.SignatureType))
+		}
+		buf, err := hex.DecodeString(sig.HexBytes)
+		if err != nil || len(buf) != len(types.Signature{}) {
+			return ConstructionCombineResponse{}, ErrInvalidRequest.wrap(fmt.Errorf("signature %d must be 64 hex-encoded bytes", i))
+		}
+		signature := types.Signature(buf)
+		if !pk.VerifyHash(sigHash, signature) {
+			return ConstructionCombineResponse{}, ErrInvalidTransaction.wrap(fmt.Errorf("signature %d is invalid", i))
+		}
+		addr := types.StandardUnlockHash(pk)
+		for j := range txn.SiacoinInputs {
+			if txn.SiacoinInputs[j].Parent.SiacoinOutput.Address == addr {
+				txn.SiacoinInputs[j].SatisfiedPolicy.Signatures = []types.Signature{signature}
+			}
+		}
+	}
+	for _, sci := range txn.SiacoinInputs {
+		if len(sci.SatisfiedPolicy.Signatures) == 0 {
+			return ConstructionCombineResponse{}, ErrInvalidRequest.wrap(fmt.Errorf("missing signature for address %v", sci.Parent.SiacoinOutput.Address))
+		}
+	}
+	return ConstructionCombineResponse{SignedTransaction: encodeTransaction(basis, txn)}, nil
+}
+
+func (s *Server) constructionParse(req ConstructionParseRequest) (ConstructionParseResponse, error) {
+	_, txn, err := decodeTransaction(req.Transaction)
+	if err != nil {
+		return ConstructionParseResponse{}, err
+	}
+	resp := ConstructionParseResponse{Operations: v2Transaction(txn, false).Operations}
+	if req.Signed {
+		seen := make(map[types.Address]bool)
+		for _, sci := range txn.SiacoinInputs {
+			addr := sci.Parent.SiacoinOutput.Address
+			if len(sci.SatisfiedPolicy.Signatures) != 0 && !seen[addr] {
+				seen[addr] = true
+				resp.AccountIdentifierSigners = append(resp.AccountIdentifierSigners, AccountIdentifier{Address: addr.String()})
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (s *Server) constructionHash(req ConstructionTransactionRequest) (TransactionIdentifierResponse, error) {
+	_, txn, err := decodeTransaction(req.SignedTransaction)
+	if err != nil {
+		return TransactionIdentifierResponse{}, err
+	}
+	return TransactionIdentifierResponse{TransactionIdentifier: TransactionIdentifier{Hash: textString(txn.ID())}}, nil
+}
+
+func (s *Server) constructionSubmit(req ConstructionTransactionRequest) (TransactionIdentifierResponse, error) {
+	basis, txn, err := decodeTransaction(req.SignedTransaction)
+	if err != nil {
+		return TransactionIdentifierResponse{}, err
+	}
+	txns := []types.V2Transaction{txn}
+	broadcast := func() error {
+		if _, err := s.cm.AddV2PoolTransactions(basis, txns); err != nil {
+			return ErrInvalidTransaction.wrap(err)
+		}
+		s.s.BroadcastV2TransactionSet(basis, txns)
+		return nil
+	}
+
+	if s.tm == nil {
+		err = broadcast()
+	} else {
+		var broadcastErr error
+		var pt treasury.PendingTransaction
+		var pending bool
+		pt, pending, err = s.tm.BroadcastTransactionSet(nil, txns, "rosetta", func() error {
+			broadcastErr = broadcast()
+			return broadcastErr
+		})
+		switch {
+		case broadcastErr != nil:
+			err = broadcastErr
+		case errors.Is(err, treasury.ErrLimitExceeded), errors.Is(err, treasury.ErrDestinationNotAllowed):
+			err = ErrTransactionNotAllowed.wrap(err)
+		case err != nil:
+			err = fmt.Errorf("failed to broadcast transaction: %w", err)
+		case pending:
+			err = ErrTransactionNeedsReview.wrap(errors.New("pending transaction " + strconv.FormatInt(pt.ID, 10)))
+		}
+	}
+	if err != nil {
+		return TransactionIdentifierResponse{}, err
+	}
+	return TransactionIdentifierResponse{TransactionIdentifier: TransactionIdentifier{Hash: textString(txn.ID())}}, nil
+}
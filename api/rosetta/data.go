@@ -0,0 +1,414 @@
+package rosetta
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/walletd/build"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// coinsPageSize is the number of outputs fetched at a time by
+// /account/coins.
+const coinsPageSize = 1000
+
+// textString returns the text encoding of an ID.
+func textString(v encoding.TextMarshaler) string {
+	buf, _ := v.MarshalText()
+	return string(buf)
+}
+
+func blockIdentifier(index types.ChainIndex) BlockIdentifier {
+	return BlockIdentifier{Index: int64(index.Height), Hash: textString(index.ID)}
+}
+
+func amount(value types.Currency, negative bool) *Amount {
+	s := value.ExactString()
+	if negative && !value.IsZero() {
+		s = "-" + s
+	}
+	return &Amount{Value: s, Currency: SiacoinCurrency}
+}
+
+// An opBuilder builds the operations of a transaction.
+type opBuilder struct {
+	status *string
+	ops    []Operation
+}
+
+func (b *opBuilder) add(typ string, id types.SiacoinOutputID, sco types.SiacoinOutput) {
+	action := coinCreated
+	if typ == OpTypeInput {
+		action = coinSpent
+	}
+	b.ops = append(b.ops, Operation{
+		OperationIdentifier: OperationIdentifier{Index: int64(len(b.ops))},
+		Type:                typ,
+		Status:              b.status,
+		Account:             &AccountIdentifier{Address: sco.Address.String()},
+		Amount:              amount(sco.Value, typ == OpTypeInput),
+		CoinChange: &CoinChange{
+			CoinIdentifier: CoinIdentifier{Identifier: textString(id)},
+			CoinAction:     action,
+		},
+	})
+}
+
+func (b *opBuilder) transaction(hash string) Transaction {
+	if b.ops == nil {
+		b.ops = []Operation{}
+	}
+	return Transaction{TransactionIdentifier: TransactionIdentifier{Hash: hash}, Operations: b.ops}
+}
+
+func newOpBuilder(withStatus bool) *opBuilder {
+	if !withStatus {
+		return &opBuilder{}
+	}
+	status := statusSuccess
+	return &opBuilder{status: &status}
+}
+
+// v1Transaction returns the operations of a v1 transaction. The values of
+// its inputs are looked up with parent.
+func v1Transaction(txn types.Transaction, parent func(types.SiacoinOutputID) (types.SiacoinElement, error), withStatus bool) (Transaction, error) {
+	b := newOpBuilder(withStatus)
+	for _, sci := range txn.SiacoinInputs {
+		sce, err := parent(sci.ParentID)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("failed to get parent of input %v: %w", sci.ParentID, err)
+		}
+		b.add(OpTypeInput, sci.ParentID, sce.SiacoinOutput)
+	}
+	for i, sco := range txn.SiacoinOutputs {
+		b.add(OpTypeOutput, txn.SiacoinOutputID(i), sco)
+	}
+	return b.transaction(textString(txn.ID())), nil
+}
+
+// v2Transaction returns the operations of a v2 transaction.
+func v2Transaction(txn types.V2Transaction, withStatus bool) Transaction {
+	b := newOpBuilder(withStatus)
+	for _, sci := range txn.SiacoinInputs {
+		b.add(OpTypeInput, sci.Parent.ID, sci.Parent.SiacoinOutput)
+	}
+	txid := txn.ID()
+	for i, sco := range txn.SiacoinOutputs {
+		b.add(OpTypeOutput, txn.SiacoinOutputID(txid, i), sco)
+	}
+	return b.transaction(textString(txid))
+}
+
+// blockTransactions returns the transactions of an applied block. Siacoin
+// outputs created outside of transactions are operations of a transaction
+// with the block's ID.
+func blockTransactions(au chain.ApplyUpdate) ([]Transaction, error) {
+	elements := make(map[types.SiacoinOutputID]types.SiacoinElement)
+	var created []types.SiacoinOutputID
+	au.ForEachSiacoinElement(func(sce types.SiacoinElement, isCreated, _ bool) {
+		elements[sce.ID] = sce
+		if isCreated {
+			created = append(created, sce.ID)
+		}
+	})
+	parent := func(id types.SiacoinOutputID) (types.SiacoinElement, error) {
+		sce, ok := elements[id]
+		if !ok {
+			return types.SiacoinElement{}, errors.New("input was not spent by block")
+		}
+		return sce, nil
+	}
+
+	claimed := make(map[types.SiacoinOutputID]bool)
+	txns := make([]Transaction, 0, len(au.Block.Transactions)+1)
+	for _, txn := range au.Block.Transactions {
+		t, err := v1Transaction(txn, parent, true)
+		if err != nil {
+			return nil, err
+		}
+		for i := range txn.SiacoinOutputs {
+			claimed[txn.SiacoinOutputID(i)] = true
+		}
+		txns = append(txns, t)
+	}
+	for _, txn := range au.Block.V2Transactions() {
+		txid := txn.ID()
+		for i := range txn.SiacoinOutputs {
+			claimed[txn.SiacoinOutputID(txid, i)] = true
+		}
+		txns = append(txns, v2Transaction(txn, true))
+	}
+
+	payouts := newOpBuilder(true)
+	for _, id := range created {
+		if !claimed[id] {
+			payouts.add(OpTypePayout, id, elements[id].SiacoinOutput)
+		}
+	}
+	if len(payouts.ops) != 0 {
+		txns = append(txns, payouts.transaction(textString(au.Block.ID())))
+	}
+	return txns, nil
+}
+
+// resolveBlock returns the index of a block in the best chain.
+func (s *Server) resolveBlock(pbi PartialBlockIdentifier) (types.ChainIndex, error) {
+	var index types.ChainIndex
+	switch {
+	case pbi.Index != nil:
+		if *pbi.Index < 0 {
+			return types.ChainIndex{}, ErrInvalidRequest.wrap(errors.New("block index must not be negative"))
+		}
+		var ok bool
+		index, ok = s.cm.BestIndex(uint64(*pbi.Index))
+		if !ok {
+			return types.ChainIndex{}, ErrBlockNotFound
+		}
+	case pbi.Hash != nil:
+		var id types.BlockID
+		if err := id.UnmarshalText([]byte(*pbi.Hash)); err != nil {
+			return types.ChainIndex{}, ErrInvalidRequest.wrap(fmt.Errorf("invalid block hash: %w", err))
+		}
+		cs, ok := s.cm.State(id)
+		if !ok {
+			return types.ChainIndex{}, ErrBlockNotFound
+		}
+		index = cs.Index
+	default:
+		return s.cm.Tip(), nil
+	}
+
+	// blocks that are not in the best chain are not found
+	if best, ok := s.cm.BestIndex(index.Height); !ok || best != index {
+		return types.ChainIndex{}, ErrBlockNotFound
+	} else if pbi.Hash != nil && textString(index.ID) != *pbi.Hash {
+		return types.ChainIndex{}, ErrBlockNotFound
+	}
+	return index, nil
+}
+
+// appliedBlock returns the update that applied a block in the best chain.
+func (s *Server) appliedBlock(index types.ChainIndex) (chain.ApplyUpdate, error) {
+	var parent types.ChainIndex
+	if index.Height > 0 {
+		var ok bool
+		parent, ok = s.cm.BestIndex(index.Height - 1)
+		if !ok {
+			return chain.ApplyUpdate{}, ErrBlockNotFound
+		}
+	}
+	_, applied, err := s.cm.UpdatesSince(parent, 1)
+	if err != nil {
+		return chain.ApplyUpdate{}, fmt.Errorf("failed to get block update: %w", err)
+	} else if len(applied) == 0 || applied[0].State.Index != index {
+		// the chain reorged since the index was resolved
+		return chain.ApplyUpdate{}, ErrBlockNotFound
+	}
+	return applied[0], nil
+}
+
+func (s *Server) networkList(NetworkRequest) (NetworkListResponse, error) {
+	return NetworkListResponse{NetworkIdentifiers: []NetworkIdentifier{s.network()}}, nil
+}
+
+func (s *Server) networkStatus(NetworkRequest) (NetworkStatusResponse, error) {
+	tip := s.cm.Tip()
+	genesis, ok := s.cm.BestIndex(0)
+	if !ok {
+		return NetworkStatusResponse{}, errors.New("failed to get genesis block")
+	}
+	block, ok := s.cm.Block(tip.ID)
+	if !ok {
+		return NetworkStatusResponse{}, errors.New("failed to get tip block")
+	}
+	indexed, err := s.wm.Tip()
+	if err != nil {
+		return NetworkStatusResponse{}, fmt.Errorf("failed to get index tip: %w", err)
+	}
+
+	// balances are read from the wallet store, so the node is synced once
+	// the store has indexed the tip
+	current, target, synced := int64(indexed.Height), int64(tip.Height), indexed == tip
+	return NetworkStatusResponse{
+		CurrentBlockIdentifier: blockIdentifier(tip),
+		CurrentBlockTimestamp:  block.Timestamp.UnixMilli(),
+		GenesisBlockIdentifier: blockIdentifier(genesis),
+		SyncStatus: &SyncStatus{
+			CurrentIndex: &current,
+			TargetIndex:  &target,
+			Synced:       &synced,
+		},
+		Peers: []Peer{},
+	}, nil
+}
+
+func (s *Server) networkOptions(NetworkRequest) (NetworkOptionsResponse, error) {
+	errs := make([]Error, 0, len(allErrors))
+	for _, err := range allErrors {
+		errs = append(errs, *err)
+	}
+	return NetworkOptionsResponse{
+		Version: Version{RosettaVersion: SpecVersion, NodeVersion: build.Version()},
+		Allow: Allow{
+			OperationStatuses: []OperationStatus{{Status: statusSuccess, Successful: true}},
+			OperationTypes:    []string{OpTypeInput, OpTypeOutput, OpTypePayout},
+			Errors:            errs,
+		},
+	}, nil
+}
+
+func (s *Server) block(req BlockRequest) (BlockResponse, error) {
+	index, err := s.resolveBlock(req.BlockIdentifier)
+	if err != nil {
+		return BlockResponse{}, err
+	}
+	au, err := s.appliedBlock(index)
+	if err != nil {
+		return BlockResponse{}, err
+	}
+	txns, err := blockTransactions(au)
+	if err != nil {
+		return BlockResponse{}, fmt.Errorf("failed to get block transactions: %w", err)
+	}
+
+	// the genesis block is its own parent
+	parent := index
+	if index.Height > 0 {
+		parent = types.ChainIndex{Height: index.Height - 1, ID: au.Block.ParentID}
+	}
+	return BlockResponse{Block: &Block{
+		BlockIdentifier:       blockIdentifier(index),
+		ParentBlockIdentifier: blockIdentifier(parent),
+		Timestamp:             au.Block.Timestamp.UnixMilli(),
+		Transactions:          txns,
+	}}, nil
+}
+
+func (s *Server) blockTransaction(req BlockTransactionRequest) (BlockTransactionResponse, error) {
+	height := req.BlockIdentifier.Index
+	index, err := s.resolveBlock(PartialBlockIdentifier{Index: &height, Hash: &req.BlockIdentifier.Hash})
+	if err != nil {
+		return BlockTransactionResponse{}, err
+	}
+	au, err := s.appliedBlock(index)
+	if err != nil {
+		return BlockTransactionResponse{}, err
+	}
+	txns, err := blockTransactions(au)
+	if err != nil {
+		return BlockTransactionResponse{}, fmt.Errorf("failed to get block transactions: %w", err)
+	}
+	for _, txn := range txns {
+		if txn.TransactionIdentifier == req.TransactionIdentifier {
+			return BlockTransactionResponse{Transaction: txn}, nil
+		}
+	}
+	return BlockTransactionResponse{}, ErrTransactionNotFound
+}
+
+func (s *Server) mempool(NetworkRequest) (MempoolResponse, error) {
+	ids := []TransactionIdentifier{}
+	for _, txn := range s.cm.PoolTransactions() {
+		ids = append(ids, TransactionIdentifier{Hash: textString(txn.ID())})
+	}
+	for _, txn := range s.cm.V2PoolTransactions() {
+		ids = append(ids, TransactionIdentifier{Hash: textString(txn.ID())})
+	}
+	return MempoolResponse{TransactionIdentifiers: ids}, nil
+}
+
+func (s *Server) mempoolTransaction(req MempoolTransactionRequest) (MempoolTransactionResponse, error) {
+	for _, txn := range s.cm.V2PoolTransactions() {
+		if textString(txn.ID()) == req.TransactionIdentifier.Hash {
+			return MempoolTransactionResponse{Transaction: v2Transaction(txn, true)}, nil
+		}
+	}
+
+	pool := s.cm.PoolTransactions()
+	for _, txn := range pool {
+		if textString(txn.ID()) != req.TransactionIdentifier.Hash {
+			continue
+		}
+		// v1 inputs do not include their values, so they are looked up in
+		// the wallet store, or in the pool if their parent is unconfirmed
+		parent := func(id types.SiacoinOutputID) (types.SiacoinElement, error) {
+			sce, err := s.wm.SiacoinElement(id)
+			if !errors.Is(err, wallet.ErrNotFound) {
+				return sce, err
+			}
+			for _, ptxn := range pool {
+				for i, sco := range ptxn.SiacoinOutputs {
+					if ptxn.SiacoinOutputID(i) == id {
+						return types.SiacoinElement{ID: id, SiacoinOutput: sco}, nil
+					}
+				}
+			}
+			return types.SiacoinElement{}, err
+		}
+		t, err := v1Transaction(txn, parent, true)
+		if err != nil {
+			return MempoolTransactionResponse{}, err
+		}
+		return MempoolTransactionResponse{Transaction: t}, nil
+	}
+	return MempoolTransactionResponse{}, ErrTransactionNotFound
+}
+
+func (s *Server) accountBalance(req AccountBalanceRequest) (AccountBalanceResponse, error) {
+	addr, err := parseAddress(req.AccountIdentifier)
+	if err != nil {
+		return AccountBalanceResponse{}, err
+	}
+	tip, err := s.wm.Tip()
+	if err != nil {
+		return AccountBalanceResponse{}, fmt.Errorf("failed to get index tip: %w", err)
+	}
+	if bi := req.BlockIdentifier; bi != nil {
+		if (bi.Index != nil && *bi.Index != int64(tip.Height)) || (bi.Hash != nil && *bi.Hash != textString(tip.ID)) {
+			return AccountBalanceResponse{}, ErrHistoricalBalance
+		}
+	}
+	balance, err := s.wm.AddressBalance(addr)
+	if err != nil {
+		return AccountBalanceResponse{}, fmt.Errorf("failed to get address balance: %w", err)
+	}
+	// immature payouts are created by the block that pays them, so they are
+	// part of the balance
+	return AccountBalanceResponse{
+		BlockIdentifier: blockIdentifier(tip),
+		Balances:        []Amount{*amount(balance.Siacoins.Add(balance.ImmatureSiacoins), false)},
+	}, nil
+}
+
+func (s *Server) accountCoins(req AccountCoinsRequest) (AccountCoinsResponse, error) {
+	addr, err := parseAddress(req.AccountIdentifier)
+	if err != nil {
+		return AccountCoinsResponse{}, err
+	} else if req.IncludeMempool {
+		return AccountCoinsResponse{}, ErrInvalidRequest.wrap(errors.New("mempool coins are not supported"))
+	}
+	tip, err := s.wm.Tip()
+	if err != nil {
+		return AccountCoinsResponse{}, fmt.Errorf("failed to get index tip: %w", err)
+	}
+	coins := []Coin{}
+	for offset := 0; ; offset += coinsPageSize {
+		page, err := s.wm.AddressSiacoinOutputs(addr, offset, coinsPageSize)
+		if err != nil {
+			return AccountCoinsResponse{}, fmt.Errorf("failed to get address outputs: %w", err)
+		}
+		for _, sce := range page {
+			coins = append(coins, Coin{
+				CoinIdentifier: CoinIdentifier{Identifier: textString(sce.ID)},
+				Amount:         *amount(sce.SiacoinOutput.Value, false),
+			})
+		}
+		if len(page) < coinsPageSize {
+			break
+		}
+	}
+	return AccountCoinsResponse{BlockIdentifier: blockIdentifier(tip), Coins: coins}, nil
+}
@@ -0,0 +1,22 @@
+package rosetta
+
+import "go.uber.org/zap"
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets the logger used by the server.
+func WithLogger(log *zap.Logger) Option {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithTreasuryManager checks submitted transactions against the spending
+// policies of the wallets they spend from. Transactions that exceed a limit
+// or require approval are not broadcast.
+func WithTreasuryManager(tm TreasuryManager) Option {
+	return func(s *Server) {
+		s.tm = tm
+	}
+}
@@ -0,0 +1,244 @@
+// Package rosetta implements the Rosetta Data and Construction APIs, the
+// standard interface custodians and exchanges use to integrate blockchains.
+// Blocks and the mempool are read from the chain manager; balances and
+// unspent outputs are read from the wallet store, which must index every
+// address.
+//
+// Only siacoins are supported. Accounts are addresses, and every siacoin
+// input and output of a block is an operation that spends or creates a coin.
+// Outputs created outside of transactions, such as miner payouts and contract
+// payouts, are operations of a transaction with the block's ID.
+package rosetta
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// SpecVersion is the version of the Rosetta specification implemented by the
+// server.
+const SpecVersion = "1.4.13"
+
+// Blockchain is the blockchain name of the server's network identifier.
+const Blockchain = "Sia"
+
+// Operation types.
+const (
+	OpTypeInput  = "Input"
+	OpTypeOutput = "Output"
+	OpTypePayout = "Payout"
+)
+
+const (
+	statusSuccess = "success"
+
+	coinCreated = "coin_created"
+	coinSpent   = "coin_spent"
+
+	curveEdwards25519 = "edwards25519"
+	signatureEd25519  = "ed25519"
+)
+
+// SiacoinCurrency is the currency of every amount.
+var SiacoinCurrency = Currency{Symbol: "SC", Decimals: 24}
+
+// Errors returned by the server. Every error is listed by /network/options.
+var (
+	ErrUnsupportedNetwork     = &Error{Code: 1, Message: "unsupported network"}
+	ErrInvalidRequest         = &Error{Code: 2, Message: "invalid request"}
+	ErrBlockNotFound          = &Error{Code: 3, Message: "block not found", Retriable: true}
+	ErrTransactionNotFound    = &Error{Code: 4, Message: "transaction not found", Retriable: true}
+	ErrHistoricalBalance      = &Error{Code: 5, Message: "historical balance lookup is not supported"}
+	ErrInvalidTransaction     = &Error{Code: 6, Message: "invalid transaction"}
+	ErrTransactionNotAllowed  = &Error{Code: 7, Message: "transaction is not allowed by wallet policy"}
+	ErrTransactionNeedsReview = &Error{Code: 8, Message: "transaction requires approval"}
+	ErrInternal               = &Error{Code: 9, Message: "internal error", Retriable: true}
+
+	allErrors = []*Error{
+		ErrUnsupportedNetwork,
+		ErrInvalidRequest,
+		ErrBlockNotFound,
+		ErrTransactionNotFound,
+		ErrHistoricalBalance,
+		ErrInvalidTransaction,
+		ErrTransactionNotAllowed,
+		ErrTransactionNeedsReview,
+		ErrInternal,
+	}
+)
+
+func (e *Error) Error() string {
+	if msg, ok := e.Details["error"].(string); ok {
+		return e.Message + ": " + msg
+	}
+	return e.Message
+}
+
+// wrap returns a copy of the error with err as its details.
+func (e *Error) wrap(err error) *Error {
+	c := *e
+	c.Details = map[string]any{"error": err.Error()}
+	return &c
+}
+
+type (
+	// A ChainManager manages the blockchain and transaction pool.
+	ChainManager interface {
+		Tip() types.ChainIndex
+		TipState() consensus.State
+		BestIndex(height uint64) (types.ChainIndex, bool)
+		Block(id types.BlockID) (types.Block, bool)
+		State(id types.BlockID) (consensus.State, bool)
+		UpdatesSince(index types.ChainIndex, max int) ([]chain.RevertUpdate, []chain.ApplyUpdate, error)
+		RecommendedFee() types.Currency
+		PoolTransactions() []types.Transaction
+		V2PoolTransactions() []types.V2Transaction
+		AddV2PoolTransactions(index types.ChainIndex, txns []types.V2Transaction) (bool, error)
+	}
+
+	// A Syncer broadcasts transactions to peers.
+	Syncer interface {
+		BroadcastV2TransactionSet(index types.ChainIndex, txns []types.V2Transaction)
+	}
+
+	// A WalletManager provides the indexed state of addresses.
+	WalletManager interface {
+		IndexMode() wallet.IndexMode
+		Tip() (types.ChainIndex, error)
+		AddressBalance(address types.Address) (wallet.Balance, error)
+		AddressSiacoinOutputs(address types.Address, offset, limit int) ([]types.SiacoinElement, error)
+		SiacoinElement(types.SiacoinOutputID) (types.SiacoinElement, error)
+	}
+
+	// A TreasuryManager enforces wallet spending policies.
+	TreasuryManager interface {
+		BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error)
+	}
+
+	// A Server serves the Rosetta API.
+	Server struct {
+		cm  ChainManager
+		s   Syncer
+		wm  WalletManager
+		tm  TreasuryManager
+		log *zap.Logger
+		mux *http.ServeMux
+	}
+)
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// network returns the identifier of the server's network.
+func (s *Server) network() NetworkIdentifier {
+	return NetworkIdentifier{Blockchain: Blockchain, Network: s.cm.TipState().Network.Name}
+}
+
+// checkNetwork returns an error if the identifier is not the server's
+// network.
+func (s *Server) checkNetwork(ni NetworkIdentifier) *Error {
+	if ni != s.network() {
+		return ErrUnsupportedNetwork
+	}
+	return nil
+}
+
+// handle returns a handler that decodes a request of type Req, checks its
+// network, and encodes the response of fn. Per the specification, every
+// request is a POST and every error is returned with status 500.
+func handle[Req any, Resp any](s *Server, network func(Req) *NetworkIdentifier, fn func(Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		writeError := func(err error) {
+			var re *Error
+			if !errors.As(err, &re) {
+				s.log.Warn("rosetta request failed", zap.String("path", r.URL.Path), zap.Error(err))
+				re = ErrInternal.wrap(err)
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(re)
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req Req
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<22)).Decode(&req); err != nil {
+			writeError(ErrInvalidRequest.wrap(err))
+			return
+		}
+		if network != nil {
+			if err := s.checkNetwork(*network(req)); err != nil {
+				writeError(err)
+				return
+			}
+		}
+		resp, err := fn(req)
+		if err != nil {
+			writeError(err)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// parseAddress parses the address of an account.
+func parseAddress(ai AccountIdentifier) (types.Address, error) {
+	addr, err := types.ParseAddress(ai.Address)
+	if err != nil {
+		return types.Address{}, ErrInvalidRequest.wrap(fmt.Errorf("invalid address %q: %w", ai.Address, err))
+	}
+	return addr, nil
+}
+
+// NewServer returns a new Rosetta server. The wallet manager must be in full
+// index mode.
+func NewServer(cm ChainManager, s Syncer, wm WalletManager, opts ...Option) (*Server, error) {
+	if wm.IndexMode() != wallet.IndexModeFull {
+		return nil, errors.New("rosetta server requires full index mode")
+	}
+	srv := &Server{
+		cm:  cm,
+		s:   s,
+		wm:  wm,
+		log: zap.NewNop(),
+		mux: http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	network := func(r NetworkRequest) *NetworkIdentifier { return &r.NetworkIdentifier }
+	srv.mux.Handle("/network/list", handle(srv, nil, srv.networkList))
+	srv.mux.Handle("/network/status", handle(srv, network, srv.networkStatus))
+	srv.mux.Handle("/network/options", handle(srv, network, srv.networkOptions))
+	srv.mux.Handle("/block", handle(srv, func(r BlockRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.block))
+	srv.mux.Handle("/block/transaction", handle(srv, func(r BlockTransactionRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.blockTransaction))
+	srv.mux.Handle("/mempool", handle(srv, network, srv.mempool))
+	srv.mux.Handle("/mempool/transaction", handle(srv, func(r MempoolTransactionRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.mempoolTransaction))
+	srv.mux.Handle("/account/balance", handle(srv, func(r AccountBalanceRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.accountBalance))
+	srv.mux.Handle("/account/coins", handle(srv, func(r AccountCoinsRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.accountCoins))
+
+	srv.mux.Handle("/construction/derive", handle(srv, func(r ConstructionDeriveRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionDerive))
+	srv.mux.Handle("/construction/preprocess", handle(srv, func(r ConstructionPreprocessRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionPreprocess))
+	srv.mux.Handle("/construction/metadata", handle(srv, func(r ConstructionMetadataRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionMetadata))
+	srv.mux.Handle("/construction/payloads", handle(srv, func(r ConstructionPayloadsRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionPayloads))
+	srv.mux.Handle("/construction/combine", handle(srv, func(r ConstructionCombineRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionCombine))
+	srv.mux.Handle("/construction/parse", handle(srv, func(r ConstructionParseRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionParse))
+	srv.mux.Handle("/construction/hash", handle(srv, func(r ConstructionTransactionRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionHash))
+	srv.mux.Handle("/construction/submit", handle(srv, func(r ConstructionTransactionRequest) *NetworkIdentifier { return &r.NetworkIdentifier }, srv.constructionSubmit))
+	return srv, nil
+}
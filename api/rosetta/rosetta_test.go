@@ -0,0 +1,332 @@
+package rosetta_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/walletd/api/rosetta"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+type chainManager struct {
+	blocks []types.Block
+	pool   []types.V2Transaction
+}
+
+func (cm *chainManager) index(height uint64) types.ChainIndex {
+	return types.ChainIndex{Height: height, ID: cm.blocks[height].ID()}
+}
+
+func (cm *chainManager) Tip() types.ChainIndex { return cm.index(uint64(len(cm.blocks) - 1)) }
+
+func (cm *chainManager) TipState() consensus.State {
+	return consensus.State{Network: &consensus.Network{Name: "zen"}, Index: cm.Tip()}
+}
+
+func (cm *chainManager) BestIndex(height uint64) (types.ChainIndex, bool) {
+	if height >= uint64(len(cm.blocks)) {
+		return types.ChainIndex{}, false
+	}
+	return cm.index(height), true
+}
+
+func (cm *chainManager) Block(id types.BlockID) (types.Block, bool) {
+	for _, b := range cm.blocks {
+		if b.ID() == id {
+			return b, true
+		}
+	}
+	return types.Block{}, false
+}
+
+func (cm *chainManager) State(id types.BlockID) (consensus.State, bool) {
+	for i, b := range cm.blocks {
+		if b.ID() == id {
+			return consensus.State{Index: cm.index(uint64(i))}, true
+		}
+	}
+	return consensus.State{}, false
+}
+
+func (cm *chainManager) UpdatesSince(index types.ChainIndex, _ int) ([]chain.RevertUpdate, []chain.ApplyUpdate, error) {
+	height := index.Height + 1
+	if index == (types.ChainIndex{}) {
+		height = 0
+	}
+	if height >= uint64(len(cm.blocks)) {
+		return nil, nil, nil
+	}
+	return nil, []chain.ApplyUpdate{{Block: cm.blocks[height], State: consensus.State{Index: cm.index(height)}}}, nil
+}
+
+func (cm *chainManager) RecommendedFee() types.Currency            { return types.NewCurrency64(10) }
+func (cm *chainManager) PoolTransactions() []types.Transaction     { return nil }
+func (cm *chainManager) V2PoolTransactions() []types.V2Transaction { return cm.pool }
+
+func (cm *chainManager) AddV2PoolTransactions(_ types.ChainIndex, txns []types.V2Transaction) (bool, error) {
+	cm.pool = append(cm.pool, txns...)
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	cm       *chainManager
+	elements []types.SiacoinElement
+}
+
+func (wm *walletManager) IndexMode() wallet.IndexMode    { return wallet.IndexModeFull }
+func (wm *walletManager) Tip() (types.ChainIndex, error) { return wm.cm.Tip(), nil }
+
+func (wm *walletManager) AddressBalance(addr types.Address) (b wallet.Balance, _ error) {
+	for _, sce := range wm.elements {
+		if sce.SiacoinOutput.Address == addr {
+			b.Siacoins = b.Siacoins.Add(sce.SiacoinOutput.Value)
+		}
+	}
+	return b, nil
+}
+
+func (wm *walletManager) AddressSiacoinOutputs(addr types.Address, offset, _ int) (sces []types.SiacoinElement, _ error) {
+	if offset != 0 {
+		return nil, nil
+	}
+	for _, sce := range wm.elements {
+		if sce.SiacoinOutput.Address == addr {
+			sces = append(sces, sce)
+		}
+	}
+	return sces, nil
+}
+
+func (wm *walletManager) SiacoinElement(id types.SiacoinOutputID) (types.SiacoinElement, error) {
+	for _, sce := range wm.elements {
+		if sce.ID == id {
+			return sce, nil
+		}
+	}
+	return types.SiacoinElement{}, wallet.ErrNotFound
+}
+
+func call[T any](t *testing.T, srv *httptest.Server, path string, req any) (resp T, rerr *rosetta.Error) {
+	t.Helper()
+	buf, _ := json.Marshal(req)
+	r, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		rerr = new(rosetta.Error)
+		if err := json.NewDecoder(r.Body).Decode(rerr); err != nil {
+			t.Fatal(err)
+		}
+		return resp, rerr
+	} else if err := json.NewDecoder(r.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp, nil
+}
+
+func TestRosetta(t *testing.T) {
+	sk := types.GeneratePrivateKey()
+	addr := types.StandardUnlockHash(sk.PublicKey())
+	recipient := types.Address{1}
+
+	cm := &chainManager{blocks: []types.Block{
+		{Timestamp: time.Unix(1000, 0)},
+	}}
+	cm.blocks = append(cm.blocks, types.Block{
+		ParentID:     cm.blocks[0].ID(),
+		Timestamp:    time.Unix(2000, 0),
+		Transactions: []types.Transaction{{SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(10)}}}},
+	})
+	wm := &walletManager{cm: cm, elements: []types.SiacoinElement{{
+		ID:            cm.blocks[1].Transactions[0].SiacoinOutputID(0),
+		SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(10)},
+	}}}
+	rs, err := rosetta.NewServer(cm, syncer{}, wm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	networks, rerr := call[rosetta.NetworkListResponse](t, srv, "/network/list", struct{}{})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(networks.NetworkIdentifiers) != 1 || networks.NetworkIdentifiers[0].Network != "zen" {
+		t.Fatalf("unexpected networks %+v", networks)
+	}
+	network := networks.NetworkIdentifiers[0]
+
+	if _, rerr := call[rosetta.NetworkStatusResponse](t, srv, "/network/status", rosetta.NetworkRequest{NetworkIdentifier: rosetta.NetworkIdentifier{Blockchain: "Sia", Network: "mainnet"}}); rerr == nil || rerr.Code != rosetta.ErrUnsupportedNetwork.Code {
+		t.Fatalf("expected unsupported network error, got %v", rerr)
+	}
+	status, rerr := call[rosetta.NetworkStatusResponse](t, srv, "/network/status", rosetta.NetworkRequest{NetworkIdentifier: network})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if status.CurrentBlockIdentifier.Index != 1 || status.CurrentBlockTimestamp != 2000000 || !*status.SyncStatus.Synced {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// blocks can be requested by index or hash
+	height := int64(1)
+	block, rerr := call[rosetta.BlockResponse](t, srv, "/block", rosetta.BlockRequest{NetworkIdentifier: network, BlockIdentifier: rosetta.PartialBlockIdentifier{Index: &height}})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if block.Block.ParentBlockIdentifier != status.GenesisBlockIdentifier {
+		t.Fatalf("unexpected parent %+v", block.Block.ParentBlockIdentifier)
+	} else if len(block.Block.Transactions) != 1 || len(block.Block.Transactions[0].Operations) != 1 {
+		t.Fatalf("unexpected transactions %+v", block.Block.Transactions)
+	} else if op := block.Block.Transactions[0].Operations[0]; op.Type != rosetta.OpTypeOutput || op.Account.Address != addr.String() || op.Amount.Value != types.Siacoins(10).ExactString() {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+	hash := block.Block.BlockIdentifier.Hash
+	if _, rerr := call[rosetta.BlockResponse](t, srv, "/block", rosetta.BlockRequest{NetworkIdentifier: network, BlockIdentifier: rosetta.PartialBlockIdentifier{Hash: &hash}}); rerr != nil {
+		t.Fatal(rerr)
+	}
+	missing := int64(5)
+	if _, rerr := call[rosetta.BlockResponse](t, srv, "/block", rosetta.BlockRequest{NetworkIdentifier: network, BlockIdentifier: rosetta.PartialBlockIdentifier{Index: &missing}}); rerr == nil || rerr.Code != rosetta.ErrBlockNotFound.Code {
+		t.Fatalf("expected block not found, got %v", rerr)
+	}
+
+	account := rosetta.AccountIdentifier{Address: addr.String()}
+	balance, rerr := call[rosetta.AccountBalanceResponse](t, srv, "/account/balance", rosetta.AccountBalanceRequest{NetworkIdentifier: network, AccountIdentifier: account})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if balance.Balances[0].Value != types.Siacoins(10).ExactString() || balance.BlockIdentifier.Index != 1 {
+		t.Fatalf("unexpected balance %+v", balance)
+	}
+	genesis := int64(0)
+	if _, rerr := call[rosetta.AccountBalanceResponse](t, srv, "/account/balance", rosetta.AccountBalanceRequest{NetworkIdentifier: network, AccountIdentifier: account, BlockIdentifier: &rosetta.PartialBlockIdentifier{Index: &genesis}}); rerr == nil || rerr.Code != rosetta.ErrHistoricalBalance.Code {
+		t.Fatalf("expected historical balance error, got %v", rerr)
+	}
+	coins, rerr := call[rosetta.AccountCoinsResponse](t, srv, "/account/coins", rosetta.AccountCoinsRequest{NetworkIdentifier: network, AccountIdentifier: account})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(coins.Coins) != 1 {
+		t.Fatalf("unexpected coins %+v", coins)
+	}
+
+	// construct, sign, and submit a transaction
+	pk := sk.PublicKey()
+	timelock := types.PolicyThreshold(2, []types.SpendPolicy{types.PolicyAbove(100), types.PolicyPublicKey(pk)})
+	publicKey := rosetta.PublicKey{HexBytes: hex.EncodeToString(pk[:]), CurveType: "edwards25519"}
+	derived, rerr := call[rosetta.ConstructionDeriveResponse](t, srv, "/construction/derive", rosetta.ConstructionDeriveRequest{NetworkIdentifier: network, PublicKey: publicKey})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if derived.AccountIdentifier != account {
+		t.Fatalf("expected %v, got %v", account, derived.AccountIdentifier)
+	}
+
+	ops := []rosetta.Operation{
+		{
+			OperationIdentifier: rosetta.OperationIdentifier{Index: 0},
+			Type:                rosetta.OpTypeInput,
+			Account:             &account,
+			Amount:              &rosetta.Amount{Value: "-" + types.Siacoins(10).ExactString(), Currency: rosetta.SiacoinCurrency},
+			CoinChange:          &rosetta.CoinChange{CoinIdentifier: coins.Coins[0].CoinIdentifier, CoinAction: "coin_spent"},
+		},
+		{
+			OperationIdentifier: rosetta.OperationIdentifier{Index: 1},
+			Type:                rosetta.OpTypeOutput,
+			Account:             &rosetta.AccountIdentifier{Address: recipient.String()},
+			Amount:              &rosetta.Amount{Value: types.Siacoins(5).ExactString(), Currency: rosetta.SiacoinCurrency},
+		},
+		{
+			// the address of a timelocked output is derived from its policy
+			OperationIdentifier: rosetta.OperationIdentifier{Index: 2},
+			Type:                rosetta.OpTypeOutput,
+			Amount:              &rosetta.Amount{Value: types.Siacoins(4).ExactString(), Currency: rosetta.SiacoinCurrency},
+			Metadata:            &rosetta.OperationMetadata{Policy: &timelock},
+		},
+	}
+
+	// the account of a policy output must match the policy's address
+	mismatched := append([]rosetta.Operation(nil), ops...)
+	mismatched[2].Account = &rosetta.AccountIdentifier{Address: recipient.String()}
+	if _, rerr := call[rosetta.ConstructionPreprocessResponse](t, srv, "/construction/preprocess", rosetta.ConstructionPreprocessRequest{NetworkIdentifier: network, Operations: mismatched}); rerr == nil || rerr.Code != rosetta.ErrInvalidRequest.Code {
+		t.Fatalf("expected invalid request, got %v", rerr)
+	}
+
+	pre, rerr := call[rosetta.ConstructionPreprocessResponse](t, srv, "/construction/preprocess", rosetta.ConstructionPreprocessRequest{NetworkIdentifier: network, Operations: ops})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(pre.RequiredPublicKeys) != 1 || pre.RequiredPublicKeys[0] != account {
+		t.Fatalf("unexpected required keys %+v", pre.RequiredPublicKeys)
+	}
+	md, rerr := call[rosetta.ConstructionMetadataResponse](t, srv, "/construction/metadata", rosetta.ConstructionMetadataRequest{NetworkIdentifier: network, Options: *pre.Options})
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	payloads, rerr := call[rosetta.ConstructionPayloadsResponse](t, srv, "/construction/payloads", rosetta.ConstructionPayloadsRequest{NetworkIdentifier: network, Operations: ops, Metadata: md.Metadata, PublicKeys: []rosetta.PublicKey{publicKey}})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(payloads.Payloads) != 1 {
+		t.Fatalf("expected 1 payload, got %d", len(payloads.Payloads))
+	}
+	msg, _ := hex.DecodeString(payloads.Payloads[0].HexBytes)
+	sig := sk.SignHash(types.Hash256(msg))
+
+	parsed, rerr := call[rosetta.ConstructionParseResponse](t, srv, "/construction/parse", rosetta.ConstructionParseRequest{NetworkIdentifier: network, Transaction: payloads.UnsignedTransaction})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(parsed.Operations) != 3 || parsed.Operations[0].Status != nil || len(parsed.AccountIdentifierSigners) != 0 {
+		t.Fatalf("unexpected parse %+v", parsed)
+	} else if parsed.Operations[2].Account.Address != timelock.Address().String() {
+		t.Fatalf("expected policy address %v, got %v", timelock.Address(), parsed.Operations[2].Account.Address)
+	}
+
+	signature := rosetta.Signature{SigningPayload: payloads.Payloads[0], PublicKey: publicKey, SignatureType: "ed25519", HexBytes: hex.EncodeToString(sig[:])}
+	badSig := signature
+	badSig.HexBytes = hex.EncodeToString(make([]byte, 64))
+	if _, rerr := call[rosetta.ConstructionCombineResponse](t, srv, "/construction/combine", rosetta.ConstructionCombineRequest{NetworkIdentifier: network, UnsignedTransaction: payloads.UnsignedTransaction, Signatures: []rosetta.Signature{badSig}}); rerr == nil || rerr.Code != rosetta.ErrInvalidTransaction.Code {
+		t.Fatalf("expected invalid signature error, got %v", rerr)
+	}
+	combined, rerr := call[rosetta.ConstructionCombineResponse](t, srv, "/construction/combine", rosetta.ConstructionCombineRequest{NetworkIdentifier: network, UnsignedTransaction: payloads.UnsignedTransaction, Signatures: []rosetta.Signature{signature}})
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	parsed, rerr = call[rosetta.ConstructionParseResponse](t, srv, "/construction/parse", rosetta.ConstructionParseRequest{NetworkIdentifier: network, Signed: true, Transaction: combined.SignedTransaction})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(parsed.AccountIdentifierSigners) != 1 || parsed.AccountIdentifierSigners[0] != account {
+		t.Fatalf("unexpected signers %+v", parsed.AccountIdentifierSigners)
+	}
+
+	hashed, rerr := call[rosetta.TransactionIdentifierResponse](t, srv, "/construction/hash", rosetta.ConstructionTransactionRequest{NetworkIdentifier: network, SignedTransaction: combined.SignedTransaction})
+	if rerr != nil {
+		t.Fatal(rerr)
+	}
+	submitted, rerr := call[rosetta.TransactionIdentifierResponse](t, srv, "/construction/submit", rosetta.ConstructionTransactionRequest{NetworkIdentifier: network, SignedTransaction: combined.SignedTransaction})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if submitted != hashed {
+		t.Fatalf("expected %v, got %v", hashed, submitted)
+	}
+
+	// the submitted transaction is in the mempool
+	mempool, rerr := call[rosetta.MempoolResponse](t, srv, "/mempool", rosetta.NetworkRequest{NetworkIdentifier: network})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(mempool.TransactionIdentifiers) != 1 || mempool.TransactionIdentifiers[0] != hashed.TransactionIdentifier {
+		t.Fatalf("unexpected mempool %+v", mempool)
+	}
+	mtxn, rerr := call[rosetta.MempoolTransactionResponse](t, srv, "/mempool/transaction", rosetta.MempoolTransactionRequest{NetworkIdentifier: network, TransactionIdentifier: hashed.TransactionIdentifier})
+	if rerr != nil {
+		t.Fatal(rerr)
+	} else if len(mtxn.Transaction.Operations) != 3 || *mtxn.Transaction.Operations[0].Status != "success" {
+		t.Fatalf("unexpected transaction %+v", mtxn.Transaction)
+	}
+}
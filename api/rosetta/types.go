@@ -0,0 +1,362 @@
+package rosetta
+
+import "go.thebigfile.com/core/types"
+
+// The types in this file are the subset of the Rosetta models used by the
+// server. See https://docs.cdp.coinbase.com/mesh/docs/api-reference for the
+// full specification.
+
+type (
+	// A NetworkIdentifier identifies the network a request is for.
+	NetworkIdentifier struct {
+		Blockchain string `json:"blockchain"`
+		Network    string `json:"network"`
+	}
+
+	// A BlockIdentifier identifies a block.
+	BlockIdentifier struct {
+		Index int64  `json:"index"`
+		Hash  string `json:"hash"`
+	}
+
+	// A PartialBlockIdentifier identifies a block by index, hash, or
+	// both. If neither is set, it refers to the current block.
+	PartialBlockIdentifier struct {
+		Index *int64  `json:"index,omitempty"`
+		Hash  *string `json:"hash,omitempty"`
+	}
+
+	// A TransactionIdentifier identifies a transaction.
+	TransactionIdentifier struct {
+		Hash string `json:"hash"`
+	}
+
+	// An OperationIdentifier identifies an operation within a transaction.
+	OperationIdentifier struct {
+		Index int64 `json:"index"`
+	}
+
+	// An AccountIdentifier identifies an account by its address.
+	AccountIdentifier struct {
+		Address string `json:"address"`
+	}
+
+	// A Currency is a currency and its number of decimal places.
+	Currency struct {
+		Symbol   string `json:"symbol"`
+		Decimals int32  `json:"decimals"`
+	}
+
+	// An Amount is a signed integer value in a currency's smallest unit.
+	Amount struct {
+		Value    string   `json:"value"`
+		Currency Currency `json:"currency"`
+	}
+
+	// A CoinIdentifier identifies an unspent output.
+	CoinIdentifier struct {
+		Identifier string `json:"identifier"`
+	}
+
+	// A CoinChange is the creation or spending of an output by an
+	// operation.
+	CoinChange struct {
+		CoinIdentifier CoinIdentifier `json:"coin_identifier"`
+		CoinAction     string         `json:"coin_action"`
+	}
+
+	// A Coin is an unspent output.
+	Coin struct {
+		CoinIdentifier CoinIdentifier `json:"coin_identifier"`
+		Amount         Amount         `json:"amount"`
+	}
+
+	// OperationMetadata is the metadata of an operation to be constructed.
+	OperationMetadata struct {
+		// Policy is the spend policy of an output. The output's address is
+		// the policy's address, so the account may be omitted.
+		Policy *types.SpendPolicy `json:"policy,omitempty"`
+	}
+
+	// An Operation is a change to the balance of an account.
+	Operation struct {
+		OperationIdentifier OperationIdentifier `json:"operation_identifier"`
+		Type                string              `json:"type"`
+		Status              *string             `json:"status,omitempty"`
+		Account             *AccountIdentifier  `json:"account,omitempty"`
+		Amount              *Amount             `json:"amount,omitempty"`
+		CoinChange          *CoinChange         `json:"coin_change,omitempty"`
+		Metadata            *OperationMetadata  `json:"metadata,omitempty"`
+	}
+
+	// A Transaction is a set of operations.
+	Transaction struct {
+		TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+		Operations            []Operation           `json:"operations"`
+	}
+
+	// A Block is a block and its transactions.
+	Block struct {
+		BlockIdentifier       BlockIdentifier `json:"block_identifier"`
+		ParentBlockIdentifier BlockIdentifier `json:"parent_block_identifier"`
+		// Timestamp is in milliseconds since the Unix epoch.
+		Timestamp    int64         `json:"timestamp"`
+		Transactions []Transaction `json:"transactions"`
+	}
+
+	// A PublicKey is a public key and its curve.
+	PublicKey struct {
+		HexBytes  string `json:"hex_bytes"`
+		CurveType string `json:"curve_type"`
+	}
+
+	// A SigningPayload is a message that must be signed by an account.
+	SigningPayload struct {
+		AccountIdentifier *AccountIdentifier `json:"account_identifier,omitempty"`
+		HexBytes          string             `json:"hex_bytes"`
+		SignatureType     string             `json:"signature_type,omitempty"`
+	}
+
+	// A Signature is a signed SigningPayload.
+	Signature struct {
+		SigningPayload SigningPayload `json:"signing_payload"`
+		PublicKey      PublicKey      `json:"public_key"`
+		SignatureType  string         `json:"signature_type"`
+		HexBytes       string         `json:"hex_bytes"`
+	}
+
+	// A Peer is a connected peer.
+	Peer struct {
+		PeerID string `json:"peer_id"`
+	}
+
+	// A SyncStatus is the sync status of the node.
+	SyncStatus struct {
+		CurrentIndex *int64 `json:"current_index,omitempty"`
+		TargetIndex  *int64 `json:"target_index,omitempty"`
+		Synced       *bool  `json:"synced,omitempty"`
+	}
+
+	// A Version is the version of the API and node.
+	Version struct {
+		RosettaVersion string `json:"rosetta_version"`
+		NodeVersion    string `json:"node_version"`
+	}
+
+	// An OperationStatus is a status an operation can have.
+	OperationStatus struct {
+		Status     string `json:"status"`
+		Successful bool   `json:"successful"`
+	}
+
+	// Allow describes the operations and errors the server supports.
+	Allow struct {
+		OperationStatuses       []OperationStatus `json:"operation_statuses"`
+		OperationTypes          []string          `json:"operation_types"`
+		Errors                  []Error           `json:"errors"`
+		HistoricalBalanceLookup bool              `json:"historical_balance_lookup"`
+		MempoolCoins            bool              `json:"mempool_coins"`
+	}
+
+	// An Error is returned by every endpoint on failure.
+	Error struct {
+		Code      int32  `json:"code"`
+		Message   string `json:"message"`
+		Retriable bool   `json:"retriable"`
+		// Details contains the underlying error, if any.
+		Details map[string]any `json:"details,omitempty"`
+	}
+)
+
+// Request and response types.
+type (
+	// A NetworkRequest is a request for information about a network.
+	NetworkRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+	}
+
+	// A NetworkListResponse lists the networks the server supports.
+	NetworkListResponse struct {
+		NetworkIdentifiers []NetworkIdentifier `json:"network_identifiers"`
+	}
+
+	// A NetworkStatusResponse is the current status of the network.
+	NetworkStatusResponse struct {
+		CurrentBlockIdentifier BlockIdentifier `json:"current_block_identifier"`
+		CurrentBlockTimestamp  int64           `json:"current_block_timestamp"`
+		GenesisBlockIdentifier BlockIdentifier `json:"genesis_block_identifier"`
+		SyncStatus             *SyncStatus     `json:"sync_status,omitempty"`
+		Peers                  []Peer          `json:"peers"`
+	}
+
+	// A NetworkOptionsResponse describes the server's version and
+	// capabilities.
+	NetworkOptionsResponse struct {
+		Version Version `json:"version"`
+		Allow   Allow   `json:"allow"`
+	}
+
+	// A BlockRequest is a request for a block.
+	BlockRequest struct {
+		NetworkIdentifier NetworkIdentifier      `json:"network_identifier"`
+		BlockIdentifier   PartialBlockIdentifier `json:"block_identifier"`
+	}
+
+	// A BlockResponse contains a block.
+	BlockResponse struct {
+		Block *Block `json:"block,omitempty"`
+	}
+
+	// A BlockTransactionRequest is a request for a transaction in a
+	// block.
+	BlockTransactionRequest struct {
+		NetworkIdentifier     NetworkIdentifier     `json:"network_identifier"`
+		BlockIdentifier       BlockIdentifier       `json:"block_identifier"`
+		TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+	}
+
+	// A BlockTransactionResponse contains a transaction.
+	BlockTransactionResponse struct {
+		Transaction Transaction `json:"transaction"`
+	}
+
+	// A MempoolResponse lists the transactions in the mempool.
+	MempoolResponse struct {
+		TransactionIdentifiers []TransactionIdentifier `json:"transaction_identifiers"`
+	}
+
+	// A MempoolTransactionRequest is a request for a transaction in the
+	// mempool.
+	MempoolTransactionRequest struct {
+		NetworkIdentifier     NetworkIdentifier     `json:"network_identifier"`
+		TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+	}
+
+	// A MempoolTransactionResponse contains a transaction in the mempool.
+	MempoolTransactionResponse struct {
+		Transaction Transaction `json:"transaction"`
+	}
+
+	// An AccountBalanceRequest is a request for the balance of an account.
+	AccountBalanceRequest struct {
+		NetworkIdentifier NetworkIdentifier       `json:"network_identifier"`
+		AccountIdentifier AccountIdentifier       `json:"account_identifier"`
+		BlockIdentifier   *PartialBlockIdentifier `json:"block_identifier,omitempty"`
+	}
+
+	// An AccountBalanceResponse is the balance of an account at a block.
+	AccountBalanceResponse struct {
+		BlockIdentifier BlockIdentifier `json:"block_identifier"`
+		Balances        []Amount        `json:"balances"`
+	}
+
+	// An AccountCoinsRequest is a request for the unspent outputs of an
+	// account.
+	AccountCoinsRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+		AccountIdentifier AccountIdentifier `json:"account_identifier"`
+		IncludeMempool    bool              `json:"include_mempool"`
+	}
+
+	// An AccountCoinsResponse lists the unspent outputs of an account.
+	AccountCoinsResponse struct {
+		BlockIdentifier BlockIdentifier `json:"block_identifier"`
+		Coins           []Coin          `json:"coins"`
+	}
+
+	// A ConstructionDeriveRequest is a request for the address of a public
+	// key.
+	ConstructionDeriveRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+		PublicKey         PublicKey         `json:"public_key"`
+	}
+
+	// A ConstructionDeriveResponse contains the address of a public key.
+	ConstructionDeriveResponse struct {
+		AccountIdentifier AccountIdentifier `json:"account_identifier"`
+	}
+
+	// A ConstructionPreprocessRequest is a request for the options needed
+	// to construct a transaction.
+	ConstructionPreprocessRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+		Operations        []Operation       `json:"operations"`
+	}
+
+	// A ConstructionPreprocessResponse contains the options passed to
+	// /construction/metadata.
+	ConstructionPreprocessResponse struct {
+		Options            *PreprocessOptions  `json:"options,omitempty"`
+		RequiredPublicKeys []AccountIdentifier `json:"required_public_keys,omitempty"`
+	}
+
+	// A ConstructionMetadataRequest is a request for the metadata needed
+	// to construct a transaction.
+	ConstructionMetadataRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+		Options           PreprocessOptions `json:"options"`
+	}
+
+	// A ConstructionMetadataResponse contains the metadata passed to
+	// /construction/payloads.
+	ConstructionMetadataResponse struct {
+		Metadata     TransactionMetadata `json:"metadata"`
+		SuggestedFee []Amount            `json:"suggested_fee,omitempty"`
+	}
+
+	// A ConstructionPayloadsRequest is a request for an unsigned
+	// transaction and the payloads that must be signed.
+	ConstructionPayloadsRequest struct {
+		NetworkIdentifier NetworkIdentifier   `json:"network_identifier"`
+		Operations        []Operation         `json:"operations"`
+		Metadata          TransactionMetadata `json:"metadata"`
+		PublicKeys        []PublicKey         `json:"public_keys"`
+	}
+
+	// A ConstructionPayloadsResponse contains an unsigned transaction and
+	// the payloads that must be signed.
+	ConstructionPayloadsResponse struct {
+		UnsignedTransaction string           `json:"unsigned_transaction"`
+		Payloads            []SigningPayload `json:"payloads"`
+	}
+
+	// A ConstructionCombineRequest is a request to add signatures to an
+	// unsigned transaction.
+	ConstructionCombineRequest struct {
+		NetworkIdentifier   NetworkIdentifier `json:"network_identifier"`
+		UnsignedTransaction string            `json:"unsigned_transaction"`
+		Signatures          []Signature       `json:"signatures"`
+	}
+
+	// A ConstructionCombineResponse contains a signed transaction.
+	ConstructionCombineResponse struct {
+		SignedTransaction string `json:"signed_transaction"`
+	}
+
+	// A ConstructionParseRequest is a request to parse a signed or
+	// unsigned transaction.
+	ConstructionParseRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+		Signed            bool              `json:"signed"`
+		Transaction       string            `json:"transaction"`
+	}
+
+	// A ConstructionParseResponse contains the operations of a
+	// transaction and, if it is signed, its signers.
+	ConstructionParseResponse struct {
+		Operations               []Operation         `json:"operations"`
+		AccountIdentifierSigners []AccountIdentifier `json:"account_identifier_signers,omitempty"`
+	}
+
+	// A ConstructionTransactionRequest is a request to hash or submit a
+	// signed transaction.
+	ConstructionTransactionRequest struct {
+		NetworkIdentifier NetworkIdentifier `json:"network_identifier"`
+		SignedTransaction string            `json:"signed_transaction"`
+	}
+
+	// A TransactionIdentifierResponse contains the ID of a transaction.
+	TransactionIdentifierResponse struct {
+		TransactionIdentifier TransactionIdentifier `json:"transaction_identifier"`
+	}
+)
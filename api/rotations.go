@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/operations"
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkRotationError writes an error response for a key rotation error and
+// returns it.
+func checkRotationError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, rotation.ErrNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, rotation.ErrActive), errors.Is(err, rotation.ErrNotActive):
+		jc.Error(err, http.StatusConflict)
+	case errors.Is(err, rotation.ErrNoAddresses), errors.Is(err, rotation.ErrNothingToSweep):
+		jc.Error(err, http.StatusBadRequest)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) walletsRotateHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req RotationRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	r, phrase, err := s.rm.Rotate(id, req.Addresses, req.MaxFeeRate, req.MaxInputs)
+	if checkRotationError(jc, "couldn't rotate wallet", err) != nil {
+		return
+	}
+	jc.Encode(RotationResponse{
+		Rotation:   r,
+		SeedPhrase: phrase,
+	})
+}
+
+func (s *server) walletsRotationsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	rotations, err := s.rm.Rotations(id)
+	if checkRotationError(jc, "couldn't get rotations", err) != nil {
+		return
+	}
+	jc.Encode(rotations)
+}
+
+func (s *server) walletsRotationsIDHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var rotationID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rotation", &rotationID) != nil {
+		return
+	}
+	r, err := s.rm.Rotation(id, rotationID)
+	if checkRotationError(jc, "couldn't get rotation", err) != nil {
+		return
+	}
+	jc.Encode(r)
+}
+
+func (s *server) walletsRotationsIDHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var rotationID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rotation", &rotationID) != nil {
+		return
+	}
+	err := s.rm.Cancel(id, rotationID)
+	if checkRotationError(jc, "couldn't cancel rotation", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsRotationsIDSweepsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	var rotationID int64
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rotation", &rotationID) != nil {
+		return
+	}
+	sweeps, err := s.rm.Sweeps(id, rotationID)
+	if checkRotationError(jc, "couldn't get sweeps", err) != nil {
+		return
+	}
+	jc.Encode(sweeps)
+}
+
+func (s *server) walletsRotationsIDSweepsHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var rotationID int64
+	var async bool
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("rotation", &rotationID) != nil || jc.DecodeForm("async", &async) != nil {
+		return
+	} else if async {
+		s.startOperation(jc, operations.TypeRotationSweep, func(context.Context, operations.ProgressFunc) (any, error) {
+			return s.rm.Sweep(id, rotationID)
+		})
+		return
+	}
+	sweep, err := s.rm.Sweep(id, rotationID)
+	if checkRotationError(jc, "couldn't sweep rotation", err) != nil {
+		return
+	}
+	jc.Encode(sweep)
+}
@@ -2,21 +2,51 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/pprof"
 	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/jobs"
 	"go.uber.org/zap"
 	"lukechampine.com/frand"
 
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/approver"
+	"go.thebigfile.com/walletd/bandwidth"
 	"go.thebigfile.com/walletd/build"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/graphql"
+	"go.thebigfile.com/walletd/health"
+	"go.thebigfile.com/walletd/ibd"
+	"go.thebigfile.com/walletd/internal/password"
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/operations"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/peerscore"
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/tags"
+	"go.thebigfile.com/walletd/threshold"
+	"go.thebigfile.com/walletd/totp"
+	"go.thebigfile.com/walletd/transfers"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/triggers"
+	"go.thebigfile.com/walletd/usage"
 	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/walletd/webhooks"
 	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/gateway"
 	"go.thebigfile.com/core/types"
@@ -41,6 +71,15 @@ func WithDebug() ServerOption {
 	}
 }
 
+// WithCurrencyFormat sets the default format of currency values in JSON
+// responses. Clients can override it per request with the Currency-Format
+// header.
+func WithCurrencyFormat(f CurrencyFormat) ServerOption {
+	return func(s *server) {
+		s.currencyFormat = f
+	}
+}
+
 // WithPublicEndpoints sets whether the server should disable authentication
 // on endpoints that are safe for use when running walletd as a service.
 func WithPublicEndpoints(public bool) ServerOption {
@@ -49,13 +88,246 @@ func WithPublicEndpoints(public bool) ServerOption {
 	}
 }
 
-// WithBasicAuth sets the password for basic authentication.
+// WithProfile restricts the server to the routes exposed by the profile.
+// Using ProfilePublicExplorer also disables authentication on the exposed
+// routes, as with WithPublicEndpoints.
+func WithProfile(p Profile) ServerOption {
+	return func(s *server) {
+		s.profile = p
+	}
+}
+
+// WithBasicAuth sets the password for basic authentication. The password may
+// either be plaintext or an argon2id hash generated by password.Hash.
 func WithBasicAuth(password string) ServerOption {
 	return func(s *server) {
 		s.password = password
 	}
 }
 
+// WithPasswordSource reads the password for basic authentication from ps on
+// every request instead of using the password set by WithBasicAuth, so that
+// the password can be rotated without restarting.
+func WithPasswordSource(ps PasswordSource) ServerOption {
+	return func(s *server) {
+		s.passwords = ps
+	}
+}
+
+// WithSigningKeys enables HMAC request signing using the given secrets, keyed
+// by key ID. Signed requests are accepted as an alternative to basic auth.
+func WithSigningKeys(keys map[string]string) ServerOption {
+	return func(s *server) {
+		if len(keys) == 0 {
+			return
+		}
+		secrets := make(map[string][]byte, len(keys))
+		for id, secret := range keys {
+			secrets[id] = []byte(secret)
+		}
+		s.verifier = newRequestVerifier(secrets)
+	}
+}
+
+// WithReplayCache sets the cache of used request signatures. Servers that
+// accept the same signing keys should share a cache. By default, each server
+// has its own.
+func WithReplayCache(rc *ReplayCache) ServerOption {
+	return func(s *server) {
+		s.replay = rc
+	}
+}
+
+// WithWebhookManager enables the webhook endpoints.
+func WithWebhookManager(whm WebhookManager) ServerOption {
+	return func(s *server) {
+		s.whm = whm
+	}
+}
+
+// WithTreasuryManager enables treasury controls on broadcast transactions and
+// the approval endpoints.
+func WithTreasuryManager(tm TreasuryManager) ServerOption {
+	return func(s *server) {
+		s.tm = tm
+	}
+}
+
+// WithAlertManager enables the /alerts endpoints.
+func WithAlertManager(am AlertManager) ServerOption {
+	return func(s *server) {
+		s.am = am
+	}
+}
+
+// WithPaymentManager enables the payment queue endpoints.
+func WithPaymentManager(pm PaymentManager) ServerOption {
+	return func(s *server) {
+		s.pm = pm
+	}
+}
+
+// WithTagManager enables the known-address directory endpoints and labels
+// event counterparties with their tags.
+func WithTagManager(tgm TagManager) ServerOption {
+	return func(s *server) {
+		s.tgm = tgm
+	}
+}
+
+// WithSignerManager enables the external signer endpoints.
+func WithSignerManager(sm SignerManager) ServerOption {
+	return func(s *server) {
+		s.sm = sm
+	}
+}
+
+// WithKeyStore enables the encrypted seed endpoints.
+func WithKeyStore(ks KeyStore) ServerOption {
+	return func(s *server) {
+		s.ks = ks
+	}
+}
+
+// WithThresholdManager enables the threshold signing coordinator endpoints.
+func WithThresholdManager(thm ThresholdManager) ServerOption {
+	return func(s *server) {
+		s.thm = thm
+	}
+}
+
+// WithRotationManager enables the key rotation endpoints.
+func WithRotationManager(rm RotationManager) ServerOption {
+	return func(s *server) {
+		s.rm = rm
+	}
+}
+
+// WithForwardingManager enables the forwarding rule endpoints.
+func WithForwardingManager(fm ForwardingManager) ServerOption {
+	return func(s *server) {
+		s.fm = fm
+	}
+}
+
+// WithTransferManager enables the transfer endpoints.
+func WithTransferManager(tfm TransferManager) ServerOption {
+	return func(s *server) {
+		s.tfm = tfm
+	}
+}
+
+// WithDigestManager enables the wallet digest endpoints.
+func WithDigestManager(dgm DigestManager) ServerOption {
+	return func(s *server) {
+		s.dgm = dgm
+	}
+}
+
+// WithEscrowManager enables the escrow endpoints.
+func WithEscrowManager(em EscrowManager) ServerOption {
+	return func(s *server) {
+		s.em = em
+	}
+}
+
+// WithTriggerManager enables the chain trigger endpoints.
+func WithTriggerManager(trm TriggerManager) ServerOption {
+	return func(s *server) {
+		s.trm = trm
+	}
+}
+
+// WithApproverManager enables the approver app pairing endpoints.
+func WithApproverManager(apm ApproverManager) ServerOption {
+	return func(s *server) {
+		s.apm = apm
+	}
+}
+
+// WithTOTPManager enables the TOTP enrollment endpoints and requires TOTP
+// codes on the sensitive endpoints of wallets that have enabled it.
+func WithTOTPManager(tm TOTPManager) ServerOption {
+	return func(s *server) {
+		s.totp = tm
+	}
+}
+
+// WithJobScheduler enables the /system/jobs endpoints.
+func WithJobScheduler(js JobScheduler) ServerOption {
+	return func(s *server) {
+		s.jobs = js
+	}
+}
+
+// WithUsageManager enables API call accounting, tenant quotas, and the
+// /system/usage endpoint.
+func WithUsageManager(um UsageManager) ServerOption {
+	return func(s *server) {
+		s.um = um
+	}
+}
+
+// WithNodeKey enables the /system/attestation endpoint, signing attestations
+// of the wallet state with the given key.
+func WithNodeKey(sk types.PrivateKey) ServerOption {
+	return func(s *server) {
+		s.nodeKey = sk
+	}
+}
+
+// WithClockMonitor annotates /syncer/status with the result of the clock
+// skew check.
+func WithClockMonitor(cm ClockMonitor) ServerOption {
+	return func(s *server) {
+		s.clock = cm
+	}
+}
+
+// WithBandwidthMonitor adds the bandwidth used by inbound peers to
+// /syncer/peers, /syncer/status, and /metrics.
+func WithBandwidthMonitor(bm BandwidthMonitor) ServerOption {
+	return func(s *server) {
+		s.bm = bm
+	}
+}
+
+// WithSyncTracker adds the timing of each stage of the initial sync to
+// /syncer/status.
+func WithSyncTracker(st SyncTracker) ServerOption {
+	return func(s *server) {
+		s.sync = st
+	}
+}
+
+// WithPeerScorer adds peer quality scores to /syncer/peers.
+func WithPeerScorer(ps PeerScorer) ServerOption {
+	return func(s *server) {
+		s.ps = ps
+	}
+}
+
+// WithQueryMonitor adds slow store query counts to /metrics.
+func WithQueryMonitor(qm QueryMonitor) ServerOption {
+	return func(s *server) {
+		s.qm = qm
+	}
+}
+
+// WithPoolMonitor adds store connection pool queue depths to /metrics.
+func WithPoolMonitor(pm PoolMonitor) ServerOption {
+	return func(s *server) {
+		s.pools = pm
+	}
+}
+
+// WithSessionTTL sets the lifetime of session tokens issued by /auth/login.
+func WithSessionTTL(ttl time.Duration) ServerOption {
+	return func(s *server) {
+		s.sessionTTL = ttl
+	}
+}
+
 type (
 	// A ChainManager manages blockchain and txpool state.
 	ChainManager interface {
@@ -64,6 +336,8 @@ type (
 		Tip() types.ChainIndex
 		BestIndex(height uint64) (types.ChainIndex, bool)
 		TipState() consensus.State
+		State(types.BlockID) (consensus.State, bool)
+		Block(types.BlockID) (types.Block, bool)
 		AddBlocks([]types.Block) error
 		RecommendedFee() types.Currency
 		PoolTransactions() []types.Transaction
@@ -89,55 +363,465 @@ type (
 	WalletManager interface {
 		IndexMode() wallet.IndexMode
 		Tip() (types.ChainIndex, error)
+		IngestStatus() wallet.IngestStatus
 		Scan(_ context.Context, index types.ChainIndex) error
 
 		AddWallet(wallet.Wallet) (wallet.Wallet, error)
 		UpdateWallet(wallet.Wallet) (wallet.Wallet, error)
 		DeleteWallet(wallet.ID) error
 		Wallets() ([]wallet.Wallet, error)
+		FilterWallets(wallet.WalletFilter) ([]wallet.Wallet, int, error)
 
-		AddAddress(id wallet.ID, addr wallet.Address) error
+		AddAddressWithResult(id wallet.ID, addr wallet.Address) (wallet.AddAddressResult, error)
 		RemoveAddress(id wallet.ID, addr types.Address) error
 		Addresses(id wallet.ID) ([]wallet.Address, error)
-		WalletEvents(id wallet.ID, offset, limit int) ([]wallet.Event, error)
+		WalletEvents(ctx context.Context, id wallet.ID, offset, limit int) ([]wallet.Event, error)
+		WalletEventFeed(ctx context.Context, id wallet.ID, offset, limit int) ([]wallet.FeedEvent, error)
 		WalletUnconfirmedEvents(id wallet.ID) ([]wallet.Event, error)
 		UnspentSiacoinOutputs(id wallet.ID, offset, limit int) ([]types.SiacoinElement, error)
+		ImmatureSiacoinOutputs(id wallet.ID) ([]types.SiacoinElement, error)
 		UnspentSiafundOutputs(id wallet.ID, offset, limit int) ([]types.SiafundElement, error)
+		ConfirmedSiacoinOutputs(id wallet.ID, minConfirmations uint64, offset, limit int) ([]types.SiacoinElement, error)
+		ConfirmedSiafundOutputs(id wallet.ID, minConfirmations uint64, offset, limit int) ([]types.SiafundElement, error)
+		ExportOutputs(context.Context, wallet.ID) (wallet.OutputExport, error)
 		WalletBalance(id wallet.ID) (wallet.Balance, error)
+		PrivacyReport(ctx context.Context, id wallet.ID) (wallet.PrivacyReport, error)
+		WalletFeeSummary(id wallet.ID, period string, n int) ([]wallet.FeeSummary, error)
+		WalletDeltas(ctx context.Context, id wallet.ID, start, end uint64) ([]wallet.BlockDelta, error)
+		WalletEventsBetween(ctx context.Context, id wallet.ID, start, end uint64) ([]wallet.Event, error)
+		WalletFeeStrategy(id wallet.ID) (wallet.FeeStrategy, error)
+		SetWalletFeeStrategy(id wallet.ID, fs wallet.FeeStrategy) error
+		WalletMinConfirmations(id wallet.ID) (uint64, error)
+		SetWalletMinConfirmations(id wallet.ID, n uint64) error
+		WalletMetadataSchema(id wallet.ID) (json.RawMessage, error)
+		SetWalletMetadataSchema(id wallet.ID, schema json.RawMessage) error
+		WalletFeeRate(id wallet.ID) (types.Currency, error)
+		BalanceAlarms(id wallet.ID) ([]wallet.BalanceAlarm, error)
+		AddBalanceAlarm(wallet.BalanceAlarm) (wallet.BalanceAlarm, error)
+		RemoveBalanceAlarm(id wallet.ID, alarmID wallet.AlarmID) error
+
+		WalletTenant(id wallet.ID) (string, error)
+		TenantHasAddress(tenant string, address types.Address) (bool, error)
+		TenantHasEvent(tenant string, eventID types.Hash256) (bool, error)
+		TenantUsage() ([]wallet.TenantUsage, error)
+
+		Templates() ([]wallet.Template, error)
+		Template(id wallet.TemplateID) (wallet.Template, error)
+		AddTemplate(wallet.Template) (wallet.Template, error)
+		UpdateTemplate(wallet.Template) (wallet.Template, error)
+		DeleteTemplate(id wallet.TemplateID) error
+		AddWalletFromTemplate(w wallet.Wallet, t wallet.Template) (wallet.Wallet, error)
+
+		ClassificationRules() ([]wallet.ClassificationRule, error)
+		AddClassificationRule(wallet.ClassificationRule) (wallet.ClassificationRule, error)
+		DeleteClassificationRule(id wallet.RuleID) error
+		EventCategories(eventIDs []types.Hash256) (map[types.Hash256][]string, error)
+		WalletCategoryEvents(ctx context.Context, walletID wallet.ID, category string, offset, limit int) ([]wallet.Event, error)
+		EventEnrichments(eventIDs []types.Hash256) (map[types.Hash256]map[string]string, error)
+		// WalletEventCounterparties returns the counterparties of the
+		// wallet's events that were resolved when the events were
+		// applied.
+		WalletEventCounterparties(walletID wallet.ID, eventIDs []types.Hash256) (map[types.Hash256][]wallet.Counterparty, error)
+
+		Groups() ([]wallet.Group, error)
+		AddGroup(wallet.Group) (wallet.Group, error)
+		UpdateGroup(wallet.Group) (wallet.Group, error)
+		DeleteGroup(id wallet.GroupID) error
+		GroupWallets(id wallet.GroupID) ([]wallet.Wallet, error)
+		AddGroupWallet(id wallet.GroupID, walletID wallet.ID) error
+		RemoveGroupWallet(id wallet.GroupID, walletID wallet.ID) error
+		GroupBalance(id wallet.GroupID) (wallet.Balance, error)
+		GroupEvents(ctx context.Context, id wallet.GroupID, offset, limit int) ([]wallet.Event, error)
 
 		AddressBalance(address types.Address) (wallet.Balance, error)
-		AddressEvents(address types.Address, offset, limit int) ([]wallet.Event, error)
+		AddressWallets(addresses []types.Address) (map[types.Address]wallet.ID, error)
+		AddressEvents(ctx context.Context, address types.Address, offset, limit int) ([]wallet.Event, error)
+		AddressEventsSince(ctx context.Context, address types.Address, height uint64, offset, limit int) ([]wallet.Event, error)
 		AddressUnconfirmedEvents(address types.Address) ([]wallet.Event, error)
 		AddressSiacoinOutputs(address types.Address, offset, limit int) ([]types.SiacoinElement, error)
 		AddressSiafundOutputs(address types.Address, offset, limit int) ([]types.SiafundElement, error)
+		AddressConfirmedSiacoinOutputs(address types.Address, minConfirmations uint64, offset, limit int) ([]types.SiacoinElement, error)
+		AddressConfirmedSiafundOutputs(address types.Address, minConfirmations uint64, offset, limit int) ([]types.SiafundElement, error)
 
 		Events(eventIDs []types.Hash256) ([]wallet.Event, error)
+		Event(id types.Hash256) (wallet.FeedEvent, error)
+		// EventRawTransaction returns the full transaction of an event.
+		EventRawTransaction(id types.Hash256) (wallet.RawTransaction, error)
 
 		SiacoinElement(types.SiacoinOutputID) (types.SiacoinElement, error)
 		SiafundElement(types.SiafundOutputID) (types.SiafundElement, error)
 
 		Reserve(ids []types.Hash256, duration time.Duration) error
+
+		PendingReorg() (wallet.PendingReorg, bool)
+		ApproveReorg() error
+		Attest(sk types.PrivateKey) (wallet.Attestation, error)
+
+		ProposeWithdrawal(walletID wallet.ID, outputs []types.SiacoinOutput, changeAddress types.Address) (wallet.WithdrawalProposal, error)
+		EstimateSend(walletID wallet.ID, outputs []types.SiacoinOutput, minConfirmations uint64) (wallet.SendEstimate, error)
+		WithdrawalProposal(walletID wallet.ID, id int64) (wallet.WithdrawalProposal, error)
+		WithdrawalProposals(walletID wallet.ID, offset, limit int) ([]wallet.WithdrawalProposal, error)
+		CancelWithdrawalProposal(walletID wallet.ID, id int64) (wallet.WithdrawalProposal, error)
+		SubmitWithdrawalProposal(walletID wallet.ID, id int64, signed types.V2Transaction, broadcast func(types.ChainIndex, types.V2Transaction) error) (wallet.WithdrawalProposal, error)
+	}
+
+	// A WebhookManager manages webhooks.
+	WebhookManager interface {
+		AddTenantWebhook(tenant, callbackURL string, scopes []string) (webhooks.Webhook, error)
+		SubscribeWebhook(tenant, callbackURL string, scopes []string) (webhooks.Webhook, error)
+		RemoveWebhook(id int64) error
+		Webhooks() []webhooks.Webhook
+	}
+
+	// A ClockMonitor checks the local clock for skew.
+	ClockMonitor interface {
+		Clock() health.ClockStatus
+	}
+
+	// A BandwidthMonitor counts the bytes transferred with peers.
+	BandwidthMonitor interface {
+		Peer(addr string) (bandwidth.Usage, bool)
+		Peers() map[string]bandwidth.Usage
+		Total() bandwidth.Usage
+	}
+
+	// A SyncTracker times the stages of the initial sync.
+	SyncTracker interface {
+		Status() ibd.Status
+	}
+
+	// A PeerScorer scores the quality of peers.
+	PeerScorer interface {
+		Score(addr string) (peerscore.Score, bool)
+	}
+
+	// A QueryMonitor counts slow store queries.
+	QueryMonitor interface {
+		// SlowQueries returns the number of slow queries by operation.
+		SlowQueries() map[string]uint64
+	}
+
+	// A PoolMonitor reports the state of the store's connection pools.
+	PoolMonitor interface {
+		// PoolQueueDepth returns the number of transactions waiting for a
+		// connection by pool.
+		PoolQueueDepth() map[string]int
+		// PoolInUse returns the number of connections in use by pool.
+		PoolInUse() map[string]int
+		// BusyRetries returns the number of transactions retried because
+		// the database was locked.
+		BusyRetries() uint64
+		// WalletQueryStats returns the totals of each wallet's expensive
+		// queries.
+		WalletQueryStats() map[wallet.ID]wallet.QueryStats
+	}
+
+	// An AlertManager manages active alerts.
+	AlertManager interface {
+		Active() []alerts.Alert
+		Dismiss(...types.Hash256)
+	}
+
+	// A PaymentManager queues outgoing payments and batches them into
+	// transactions.
+	PaymentManager interface {
+		Enqueue(id wallet.ID, addr types.Address, value types.Currency) (payments.Payment, error)
+		Queue(wallet.ID) ([]payments.Payment, error)
+		Cancel(id wallet.ID, paymentID int64) error
+		Flush(wallet.ID) (payments.Batch, error)
+		Batches(id wallet.ID, offset, limit int) ([]payments.Batch, error)
+	}
+
+	// A TagManager maintains a directory of known external addresses.
+	TagManager interface {
+		Tags() []tags.Tag
+		Tag(types.Address) (tags.Tag, bool)
+		SetTag(addr types.Address, label, category string) (tags.Tag, error)
+		RemoveTag(types.Address) error
+		Import([]tags.Tag) error
+	}
+
+	// A TreasuryManager enforces treasury controls on outgoing transactions.
+	TreasuryManager interface {
+		WalletPolicy(wallet.ID) (treasury.Policy, error)
+		SetWalletPolicy(wallet.ID, treasury.Policy) error
+
+		LimitStatus(wallet.ID) (treasury.LimitStatus, error)
+		OverrideLimits(id wallet.ID, expiration time.Time, overriddenBy string) error
+		CheckFunding(id wallet.ID, amount types.Currency, txn types.Transaction) error
+
+		Allowlist(wallet.ID) ([]treasury.AllowlistEntry, error)
+		AddAllowlistEntry(id wallet.ID, addr types.Address, description string) (treasury.AllowlistEntry, error)
+		RemoveAllowlistEntry(id wallet.ID, addr types.Address) error
+
+		BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error)
+		SignTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, sign func() ([]types.Transaction, []types.V2Transaction, error)) (treasury.PendingTransaction, bool, error)
+		PendingTransaction(id int64) (treasury.PendingTransaction, error)
+		PendingTransactions(status string, offset, limit int) ([]treasury.PendingTransaction, error)
+		Approve(id int64, approvedBy string, broadcast func(treasury.PendingTransaction) error) (treasury.PendingTransaction, error)
+		Reject(id int64, rejectedBy string) (treasury.PendingTransaction, error)
+	}
+
+	// A SignerManager signs wallet transactions with external signers.
+	SignerManager interface {
+		Signers() []string
+		WalletSigner(wallet.ID) (string, error)
+		SetWalletSigner(id wallet.ID, name string) error
+		SignTransaction(ctx context.Context, id wallet.ID, txn types.Transaction, toSign []types.Hash256) (types.Transaction, error)
+		SignV2Transaction(ctx context.Context, id wallet.ID, txn types.V2Transaction) (types.V2Transaction, error)
+		SignMessage(ctx context.Context, id wallet.ID, addr types.Address, msg string) (signer.SignedMessage, error)
+	}
+
+	// A KeyStore stores encrypted wallet seeds and holds the seeds of
+	// unlocked wallets in memory.
+	KeyStore interface {
+		AddSeed(id wallet.ID, phrase, passphrase string) error
+		RemoveSeed(wallet.ID) error
+		Status(wallet.ID) (keystore.Status, error)
+		Unlock(id wallet.ID, passphrase string, timeout time.Duration) (keystore.Status, error)
+		Lock(wallet.ID) error
+		BackupChallenge(id wallet.ID, words int) (keystore.Challenge, error)
+		VerifyBackup(id wallet.ID, challengeID types.Hash256, words []string) (keystore.Status, error)
+	}
+
+	// A ThresholdManager coordinates threshold signing sessions.
+	ThresholdManager interface {
+		AddGroup(name string, pk types.PublicKey, threshold, maxParticipants int) (threshold.Group, error)
+		Groups() ([]threshold.Group, error)
+		Group(threshold.GroupID) (threshold.Group, error)
+		RemoveGroup(threshold.GroupID) error
+		RegisterParticipant(groupID threshold.GroupID, id uint16, name string) (threshold.Group, error)
+
+		StartSession(groupID threshold.GroupID, txn types.V2Transaction) (threshold.Session, error)
+		Sessions() []threshold.Session
+		Session(types.Hash256) (threshold.Session, error)
+		AddCommitment(sessionID types.Hash256, c threshold.Commitment) (threshold.Session, error)
+		AddShare(sessionID types.Hash256, share threshold.Share) (threshold.Session, error)
+	}
+
+	// A RotationManager rotates wallet keys and sweeps their old addresses.
+	RotationManager interface {
+		Rotate(id wallet.ID, addresses int, maxFeeRate types.Currency, maxInputs int) (rotation.Rotation, string, error)
+		Rotations(wallet.ID) ([]rotation.Rotation, error)
+		Rotation(id wallet.ID, rotationID int64) (rotation.Rotation, error)
+		Cancel(id wallet.ID, rotationID int64) error
+		Sweeps(id wallet.ID, rotationID int64) ([]rotation.Sweep, error)
+		Sweep(id wallet.ID, rotationID int64) (rotation.Sweep, error)
+	}
+
+	// A ForwardingManager sweeps deposit addresses to their forwarding
+	// destinations.
+	ForwardingManager interface {
+		AddRule(id wallet.ID, addr, destination types.Address, splits []forwarding.Split, minConfirmations uint64, minAmount types.Currency) (forwarding.Rule, error)
+		Rules(wallet.ID) ([]forwarding.Rule, error)
+		Rule(id wallet.ID, ruleID int64) (forwarding.Rule, error)
+		RemoveRule(id wallet.ID, ruleID int64) error
+		Sweeps(id wallet.ID, ruleID int64, offset, limit int) ([]forwarding.Sweep, error)
+		Sweep(id wallet.ID, ruleID int64) (forwarding.Sweep, error)
+	}
+
+	// A TransferManager moves funds between wallets.
+	TransferManager interface {
+		Send(from, to wallet.ID, value types.Currency, method, memo string) (transfers.Transfer, error)
+		Transfer(id int64) (transfers.Transfer, error)
+		Entries(id wallet.ID, offset, limit int) ([]transfers.Entry, error)
+	}
+
+	// A DigestManager sends periodic summaries of wallet activity.
+	DigestManager interface {
+		Schedule(wallet.ID) (digest.Schedule, error)
+		SetSchedule(id wallet.ID, frequency string) (digest.Schedule, error)
+		RemoveSchedule(wallet.ID) error
+		Preview(id wallet.ID, frequency string) (digest.Digest, error)
+	}
+
+	// An EscrowManager creates 2-of-3 escrows and assembles their
+	// settlements.
+	EscrowManager interface {
+		Create(id wallet.ID, buyer, seller, arbiter types.PublicKey, buyerAddr, sellerAddr types.Address, amount types.Currency) (escrow.Escrow, error)
+		Escrows(wallet.ID) ([]escrow.Escrow, error)
+		Escrow(id wallet.ID, escrowID int64) (escrow.Escrow, error)
+		Fund(id wallet.ID, escrowID int64, fundingWallet wallet.ID, changeAddr types.Address) (escrow.Funding, error)
+		Settle(id wallet.ID, escrowID int64, settlementType string) (escrow.Escrow, error)
+		AddSignature(id wallet.ID, escrowID int64, pk types.PublicKey, sig types.Signature) (escrow.Escrow, error)
+	}
+
+	// A TriggerManager fires webhook events at chain heights.
+	TriggerManager interface {
+		AddTrigger(name string, height, interval uint64) (triggers.Trigger, error)
+		RemoveTrigger(id int64) error
+		Triggers() ([]triggers.Trigger, error)
+	}
+
+	// An ApproverManager pairs approver apps.
+	ApproverManager interface {
+		CreatePairing(name string) (approver.Pairing, error)
+		Approvers() ([]approver.Approver, error)
+		RemoveApprover(id int64) error
+	}
+
+	// A PasswordSource provides the API password.
+	PasswordSource interface {
+		APIPassword() string
+	}
+
+	// A TOTPManager enrolls wallets in TOTP and verifies codes.
+	TOTPManager interface {
+		Enroll(wallet.ID) (totp.Enrollment, error)
+		Confirm(id wallet.ID, code string) error
+		Status(wallet.ID) (totp.Status, error)
+		Verify(id wallet.ID, code string) error
+		Disable(id wallet.ID, code string) error
+	}
+
+	// A JobScheduler runs background jobs.
+	JobScheduler interface {
+		Jobs() []jobs.Job
+		Trigger(name string) error
+		SetPaused(name string, paused bool) (jobs.Job, error)
+	}
+
+	// A UsageManager counts API calls and enforces tenant quotas.
+	UsageManager interface {
+		RecordCall(tenant, principal string) error
+		Quota(tenant string) usage.Quota
+		Usage(since time.Time) ([]usage.Record, error)
 	}
 )
 
 type server struct {
 	startTime       time.Time
 	debugEnabled    bool
+	graphqlEnabled  bool
 	publicEndpoints bool
+	profile         Profile
 	password        string
-
-	log *zap.Logger
-	cm  ChainManager
-	s   Syncer
-	wm  WalletManager
+	passwords       PasswordSource
+	currencyFormat  CurrencyFormat
+	// legacySunset is the date after which unversioned routes may be
+	// removed
+	legacySunset time.Time
+	// gqlSchema is the schema served by /graphql, if enabled
+	gqlSchema *graphql.Schema
+
+	// authMu protects verifiedPassword, a digest of the last password that
+	// matched verifiedHash, an argon2id password hash. Caching the password
+	// avoids rehashing it on every request.
+	authMu           sync.Mutex
+	verifiedPassword *[32]byte
+	verifiedHash     string
+	// deriveMu serializes password derivations, which each allocate the
+	// hash's full memory cost
+	deriveMu sync.Mutex
+
+	sessionTTL time.Duration
+	sessions   *sessionManager
+	verifier   *requestVerifier
+	replay     *ReplayCache
+	// keyTenants maps signing key IDs to tenants
+	keyTenants map[string]string
+	// nodeKey signs wallet state attestations
+	nodeKey types.PrivateKey
+
+	log  *zap.Logger
+	cm   ChainManager
+	s    Syncer
+	wm   WalletManager
+	whm  WebhookManager
+	tm   TreasuryManager
+	am   AlertManager
+	tgm  TagManager
+	pm   PaymentManager
+	um   UsageManager
+	sm   SignerManager
+	ks   KeyStore
+	thm  ThresholdManager
+	rm   RotationManager
+	fm   ForwardingManager
+	tfm  TransferManager
+	dgm  DigestManager
+	em   EscrowManager
+	trm  TriggerManager
+	apm  ApproverManager
+	totp TOTPManager
+	jobs JobScheduler
+
+	clock ClockMonitor
+	bm    BandwidthMonitor
+	sync  SyncTracker
+	ps    PeerScorer
+	qm    QueryMonitor
+	pools PoolMonitor
+
+	// handler serves the sub-requests of batches
+	handler http.Handler
 
 	// for walletsReserveHandler
 	mu   sync.Mutex
 	used map[types.Hash256]bool
 
-	scanMu         sync.Mutex // for resubscribe
-	scanInProgress bool
-	scanInfo       RescanResponse
+	// ops runs long-running operations
+	ops *operations.Manager
+
+	scanMu   sync.Mutex // for resubscribe
+	scanInfo RescanResponse
+}
+
+// apiPassword returns the server's password.
+func (s *server) apiPassword() string {
+	if s.passwords != nil {
+		return s.passwords.APIPassword()
+	}
+	return s.password
+}
+
+// checkPassword returns true if pass matches the server's password. Once a
+// password has been verified against an argon2id hash, other passwords are
+// compared against it and rejected without being derived.
+func (s *server) checkPassword(pass string) bool {
+	hash := s.apiPassword()
+	if !password.IsHash(hash) {
+		return subtle.ConstantTimeCompare([]byte(pass), []byte(hash)) == 1
+	}
+
+	digest := sha256.Sum256([]byte(pass))
+	if ok, decided := s.checkCachedPassword(hash, digest); decided {
+		return ok
+	}
+
+	// a derivation is expensive, so only one runs at a time. Failed
+	// derivations do not reject other passwords, so that a client sending
+	// wrong passwords delays other clients but cannot lock them out.
+	s.deriveMu.Lock()
+	defer s.deriveMu.Unlock()
+	if ok, decided := s.checkCachedPassword(hash, digest); decided {
+		return ok
+	}
+
+	ok, err := password.Verify(hash, pass)
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if err != nil {
+		s.log.Error("failed to verify password hash", zap.Error(err))
+		return false
+	} else if !ok {
+		return false
+	}
+	s.verifiedPassword = &digest
+	s.verifiedHash = hash
+	return true
+}
+
+// checkCachedPassword checks a password digest against the cached password
+// for hash. decided is false if the password must be derived because no
+// password has been verified against hash.
+func (s *server) checkCachedPassword(hash string, digest [32]byte) (ok, decided bool) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	if s.verifiedPassword != nil && s.verifiedHash == hash {
+		return subtle.ConstantTimeCompare(digest[:], s.verifiedPassword[:]) == 1, true
+	}
+	return false, false
 }
 
 func (s *server) stateHandler(jc jape.Context) {
@@ -148,6 +832,7 @@ func (s *server) stateHandler(jc jape.Context) {
 		BuildTime: build.Time(),
 		StartTime: s.startTime,
 		IndexMode: s.wm.IndexMode(),
+		Ingest:    s.wm.IngestStatus(),
 	})
 }
 
@@ -176,6 +861,26 @@ func (s *server) consensusIndexHeightHandler(jc jape.Context) {
 	jc.Encode(index)
 }
 
+func (s *server) consensusBlocksIDHandler(jc jape.Context) {
+	var id types.BlockID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	binary, ok := wantsBinary(jc)
+	if !ok {
+		return
+	}
+	b, ok := s.cm.Block(id)
+	if !ok {
+		jc.Error(errors.New("block not found"), http.StatusNotFound)
+		return
+	} else if binary {
+		encodeBinary(jc, types.V2Block(b))
+		return
+	}
+	jc.Encode(b)
+}
+
 func (s *server) consensusUpdatesIndexHandler(jc jape.Context) {
 	var index types.ChainIndex
 	if jc.DecodeParam("index", &index) != nil {
@@ -190,6 +895,11 @@ func (s *server) consensusUpdatesIndexHandler(jc jape.Context) {
 		return
 	}
 
+	binary, ok := wantsBinary(jc)
+	if !ok {
+		return
+	}
+
 	reverted, applied, err := s.cm.UpdatesSince(index, limit)
 	if jc.Check("couldn't get updates", err) != nil {
 		return
@@ -210,9 +920,34 @@ func (s *server) consensusUpdatesIndexHandler(jc jape.Context) {
 			Block:  au.Block,
 		})
 	}
+	if binary {
+		encodeBinary(jc, res)
+		return
+	}
 	jc.Encode(res)
 }
 
+func (s *server) syncerStatusHandler(jc jape.Context) {
+	resp := SyncerStatusResponse{
+		Address: s.s.Addr(),
+		Peers:   len(s.s.Peers()),
+	}
+	if s.clock != nil {
+		if status := s.clock.Clock(); status.MaxSkew > 0 {
+			resp.Clock = &status
+		}
+	}
+	if s.bm != nil {
+		total := s.bm.Total()
+		resp.Bandwidth = &total
+	}
+	if s.sync != nil {
+		status := s.sync.Status()
+		resp.Sync = &status
+	}
+	jc.Encode(resp)
+}
+
 func (s *server) syncerPeersHandler(jc jape.Context) {
 	var peers []GatewayPeer
 	for _, p := range s.s.Peers() {
@@ -233,6 +968,16 @@ func (s *server) syncerPeersHandler(jc jape.Context) {
 			peer.SyncedBlocks = info.SyncedBlocks
 			peer.SyncDuration = info.SyncDuration
 		}
+		if s.bm != nil {
+			if u, ok := s.bm.Peer(p.ConnAddr); ok {
+				peer.BytesSent, peer.BytesReceived = u.Sent, u.Received
+			}
+		}
+		if s.ps != nil {
+			if score, ok := s.ps.Score(p.Addr()); ok {
+				peer.Score = &score
+			}
+		}
 		peers = append(peers, peer)
 	}
 	jc.Encode(peers)
@@ -252,9 +997,14 @@ func (s *server) syncerConnectHandler(jc jape.Context) {
 
 func (s *server) syncerBroadcastBlockHandler(jc jape.Context) {
 	var b types.Block
-	if jc.Decode(&b) != nil {
+	if isBinaryRequest(jc.Request) {
+		if decodeBinary(jc, (*types.V2Block)(&b)) != nil {
+			return
+		}
+	} else if jc.Decode(&b) != nil {
 		return
-	} else if jc.Check("block is invalid", s.cm.AddBlocks([]types.Block{b})) != nil {
+	}
+	if jc.Check("block is invalid", s.cm.AddBlocks([]types.Block{b})) != nil {
 		return
 	}
 	if b.V2 == nil {
@@ -275,47 +1025,132 @@ func (s *server) txpoolParentsHandler(jc jape.Context) {
 }
 
 func (s *server) txpoolTransactionsHandler(jc jape.Context) {
-	jc.Encode(TxpoolTransactionsResponse{
+	binary, ok := wantsBinary(jc)
+	if !ok {
+		return
+	}
+	resp := TxpoolTransactionsResponse{
 		Transactions:   s.cm.PoolTransactions(),
 		V2Transactions: s.cm.V2PoolTransactions(),
-	})
+	}
+	if binary {
+		encodeBinary(jc, resp)
+		return
+	}
+	jc.Encode(resp)
 }
 
 func (s *server) txpoolFeeHandler(jc jape.Context) {
 	jc.Encode(s.cm.RecommendedFee())
 }
 
-func (s *server) txpoolBroadcastHandler(jc jape.Context) {
-	var tbr TxpoolBroadcastRequest
-	if jc.Decode(&tbr) != nil {
-		return
-	}
-	if len(tbr.Transactions) != 0 {
-		_, err := s.cm.AddPoolTransactions(tbr.Transactions)
+// broadcastTransactionSet adds a transaction set to the pool and broadcasts it
+// to peers.
+func (s *server) broadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction) error {
+	if len(txns) != 0 {
+		_, err := s.cm.AddPoolTransactions(txns)
 		if err != nil {
-			jc.Error(fmt.Errorf("invalid transaction set: %w", err), http.StatusBadRequest)
-			return
+			return fmt.Errorf("invalid transaction set: %w", err)
 		}
-		s.s.BroadcastTransactionSet(tbr.Transactions)
+		s.s.BroadcastTransactionSet(txns)
 	}
-	if len(tbr.V2Transactions) != 0 {
+	if len(v2txns) != 0 {
 		index := s.cm.TipState().Index
-		_, err := s.cm.AddV2PoolTransactions(index, tbr.V2Transactions)
+		_, err := s.cm.AddV2PoolTransactions(index, v2txns)
 		if err != nil {
-			jc.Error(fmt.Errorf("invalid v2 transaction set: %w", err), http.StatusBadRequest)
+			return fmt.Errorf("invalid v2 transaction set: %w", err)
+		}
+		s.s.BroadcastV2TransactionSet(index, v2txns)
+	}
+	return nil
+}
+
+func (s *server) txpoolBroadcastHandler(jc jape.Context) {
+	var tbr TxpoolBroadcastRequest
+	if isBinaryRequest(jc.Request) {
+		if decodeBinary(jc, &tbr) != nil {
+			return
+		}
+	} else if jc.Decode(&tbr) != nil {
+		return
+	}
+
+	if s.tm != nil {
+		var broadcastErr error
+		pt, pending, err := s.tm.BroadcastTransactionSet(tbr.Transactions, tbr.V2Transactions, submitter(jc.Request), func() error {
+			broadcastErr = s.broadcastTransactionSet(tbr.Transactions, tbr.V2Transactions)
+			return broadcastErr
+		})
+		if broadcastErr != nil {
+			jc.Error(broadcastErr, http.StatusBadRequest)
+			return
+		} else if errors.Is(err, treasury.ErrLimitExceeded) || errors.Is(err, treasury.ErrDestinationNotAllowed) {
+			jc.Error(err, http.StatusForbidden)
+			return
+		} else if jc.Check("couldn't broadcast transaction set", err) != nil {
+			return
+		} else if pending {
+			// the set was added to the approval queue instead of being
+			// broadcast
+			jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+			jc.ResponseWriter.WriteHeader(http.StatusAccepted)
+			jc.Encode(pt)
 			return
 		}
-		s.s.BroadcastV2TransactionSet(index, tbr.V2Transactions)
+		jc.EmptyResonse()
+		return
 	}
 
+	if err := s.broadcastTransactionSet(tbr.Transactions, tbr.V2Transactions); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
 	jc.EmptyResonse()
 }
 
 func (s *server) walletsHandler(jc jape.Context) {
-	wallets, err := s.wm.Wallets()
+	// all matching wallets are returned unless a limit is given
+	filter := wallet.WalletFilter{Limit: -1}
+	order := "asc"
+	if jc.DecodeForm("namePrefix", &filter.NamePrefix) != nil || jc.DecodeForm("sortBy", &filter.SortBy) != nil || jc.DecodeForm("order", &order) != nil || jc.DecodeForm("offset", &filter.Offset) != nil || jc.DecodeForm("limit", &filter.Limit) != nil {
+		return
+	} else if order != "asc" && order != "desc" {
+		jc.Error(errors.New(`order must be "asc" or "desc"`), http.StatusBadRequest)
+		return
+	} else if filter.Offset < 0 {
+		jc.Error(errors.New("offset must be non-negative"), http.StatusBadRequest)
+		return
+	} else if filter.Limit != -1 && (filter.Limit < 1 || filter.Limit > 1000) {
+		jc.Error(errors.New("limit must be between 1 and 1000"), http.StatusBadRequest)
+		return
+	}
+	for key, values := range jc.Request.URL.Query() {
+		path, ok := strings.CutPrefix(key, "meta.")
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			mf, err := wallet.ParseMetadataFilter(path, value)
+			if err != nil {
+				jc.Error(err, http.StatusBadRequest)
+				return
+			}
+			filter.Metadata = append(filter.Metadata, mf)
+		}
+	}
+	filter.Descending = order == "desc"
+	// tenants only see their own wallets
+	filter.Tenant, _ = tenantFromRequest(jc.Request)
+	if err := filter.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	wallets, total, err := s.wm.FilterWallets(filter)
 	if jc.Check("couldn't load wallets", err) != nil {
 		return
 	}
+	jc.ResponseWriter.Header().Set(HeaderTotalCount, strconv.Itoa(total))
 	jc.Encode(wallets)
 }
 
@@ -328,12 +1163,52 @@ func (s *server) walletsHandlerPOST(jc jape.Context) {
 		Name:        req.Name,
 		Description: req.Description,
 		Metadata:    req.Metadata,
+		Type:        req.Type,
+	}
+	// wallets created by a tenant are owned by it
+	w.Tenant, _ = tenantFromRequest(jc.Request)
+	if !s.checkWalletQuota(jc, w.Tenant) {
+		return
 	}
 
-	w, err := s.wm.AddWallet(w)
-	if jc.Check("couldn't add wallet", err) != nil {
+	if req.TemplateID == nil {
+		w, err := s.wm.AddWallet(w)
+		if jc.Check("couldn't add wallet", err) != nil {
+			return
+		}
+		jc.Encode(w)
 		return
 	}
+
+	t, err := s.wm.Template(*req.TemplateID)
+	if errors.Is(err, wallet.ErrTemplateNotFound) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't load template", err) != nil {
+		return
+	} else if len(t.Webhooks) > 0 && s.whm == nil {
+		jc.Error(errors.New("template webhooks require webhooks to be enabled"), http.StatusBadRequest)
+		return
+	}
+	w, err = s.wm.AddWalletFromTemplate(w, t)
+	var ve *wallet.MetadataValidationError
+	if errors.As(err, &ve) {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		jc.Encode(MetadataValidationResponse{Error: ve.Error(), Errors: ve.Errors})
+		return
+	} else if jc.Check("couldn't add wallet", err) != nil {
+		return
+	}
+	for _, tw := range t.Webhooks {
+		scopes := make([]string, 0, len(tw.Scopes))
+		for _, scope := range tw.Scopes {
+			scopes = append(scopes, wallet.WalletScope(scope, w.ID))
+		}
+		if _, err := s.whm.SubscribeWebhook(w.Tenant, tw.CallbackURL, scopes); jc.Check("couldn't add template webhook", err) != nil {
+			return
+		}
+	}
 	jc.Encode(w)
 }
 
@@ -343,166 +1218,499 @@ func (s *server) walletsIDHandlerPOST(jc jape.Context) {
 	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
 		return
 	}
+	revision, err := parseIfMatch(jc.Request.Header.Get("If-Match"))
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if revision != 0 && req.Revision != 0 && revision != req.Revision {
+		jc.Error(errors.New("If-Match header and revision field do not match"), http.StatusBadRequest)
+		return
+	} else if revision == 0 {
+		revision = req.Revision
+	}
+	if revision == 0 {
+		// an update without a revision would silently overwrite concurrent
+		// changes
+		jc.Error(errors.New("If-Match header or revision field is required"), http.StatusPreconditionRequired)
+		return
+	}
 	w := wallet.Wallet{
 		ID:          id,
 		Name:        req.Name,
 		Description: req.Description,
 		Metadata:    req.Metadata,
+		Revision:    revision,
+	}
+
+	w, err = s.wm.UpdateWallet(w)
+	var ve *wallet.MetadataValidationError
+	var ce *wallet.RevisionConflictError
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.As(err, &ve) {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		jc.Encode(MetadataValidationResponse{Error: ve.Error(), Errors: ve.Errors})
+		return
+	} else if errors.As(err, &ce) {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.Header().Set("ETag", revisionETag(ce.Current))
+		jc.ResponseWriter.WriteHeader(http.StatusConflict)
+		jc.Encode(WalletConflictResponse{Error: ce.Error(), Revision: ce.Current})
+		return
+	} else if jc.Check("couldn't update wallet", err) != nil {
+		return
+	}
+	jc.ResponseWriter.Header().Set("ETag", revisionETag(w.Revision))
+	jc.Encode(w)
+}
+
+// staticParam wraps a handler of a parameterized route so that requests whose
+// parameter matches a key of static are served by its handler instead. The
+// router cannot register a static route alongside a parameter, e.g.
+// /wallets/import alongside /wallets/:id.
+func staticParam(param string, h jape.Handler, static map[string]jape.Handler) jape.Handler {
+	return func(jc jape.Context) {
+		if sh, ok := static[jc.PathParam(param)]; ok {
+			sh(jc)
+			return
+		}
+		h(jc)
+	}
+}
+
+// revisionETag returns the entity tag of a wallet revision.
+func revisionETag(revision uint64) string {
+	return strconv.Quote(strconv.FormatUint(revision, 10))
+}
+
+// parseIfMatch parses a wallet revision from an If-Match header. It returns
+// zero if the header is empty.
+func parseIfMatch(header string) (uint64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, nil
+	}
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	revision, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil || revision == 0 {
+		return 0, fmt.Errorf("invalid If-Match header %q: must be a wallet revision", header)
+	}
+	return revision, nil
+}
+
+func (s *server) walletsIDHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.wm.DeleteWallet(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+	} else if jc.Check("couldn't remove wallet", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) rescanHandlerGET(jc jape.Context) {
+	index, err := s.wm.Tip()
+	if jc.Check("couldn't get tip", err) != nil {
+		return
+	}
+
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+	s.scanInfo.Index = index
+	jc.Encode(s.scanInfo)
+}
+
+func (s *server) rescanHandlerPOST(jc jape.Context) {
+	var height uint64
+	if jc.Decode(&height) != nil {
+		return
+	}
+
+	var index types.ChainIndex
+	if height > 0 {
+		var ok bool
+		index, ok = s.cm.BestIndex(height)
+		if !ok {
+			jc.Error(errors.New("height not found"), http.StatusNotFound)
+			return
+		}
+	}
+
+	// hold the lock until the scan state is set, so that the operation
+	// cannot update it first
+	s.scanMu.Lock()
+	defer s.scanMu.Unlock()
+	op, err := s.ops.StartExclusive(operations.TypeRescan, func(ctx context.Context, progress operations.ProgressFunc) (any, error) {
+		return s.rescan(ctx, index, progress)
+	})
+	if errors.Is(err, operations.ErrRunning) {
+		jc.Error(errors.New("scan already in progress"), http.StatusConflict)
+		return
+	} else if jc.Check("couldn't start scan", err) != nil {
+		return
+	}
+	s.scanInfo = RescanResponse{
+		OperationID: op.ID,
+		StartIndex:  index,
+		Index:       index,
+		StartTime:   op.StartTime,
+		Error:       nil,
+	}
+	encodeAccepted(jc, op)
+}
+
+func (s *server) systemReorgHandlerGET(jc jape.Context) {
+	pending, ok := s.wm.PendingReorg()
+	if !ok {
+		jc.Error(wallet.ErrNoPendingReorg, http.StatusNotFound)
+		return
+	}
+	jc.Encode(pending)
+}
+
+func (s *server) systemReorgApproveHandlerPOST(jc jape.Context) {
+	err := s.wm.ApproveReorg()
+	if errors.Is(err, wallet.ErrNoPendingReorg) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't approve reorg", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) systemAttestationHandlerGET(jc jape.Context) {
+	a, err := s.wm.Attest(s.nodeKey)
+	if jc.Check("couldn't attest wallet state", err) != nil {
+		return
+	}
+	jc.Encode(a)
+}
+
+func (s *server) walletsAddressHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var addr wallet.Address
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&addr) != nil {
+		return
+	} else if !s.checkAddressQuota(jc, id, addr.Address) {
+		return
+	}
+	result, err := s.wm.AddAddressWithResult(id, addr)
+	if jc.Check("couldn't add address", err) != nil {
+		return
+	}
+	// only report the other wallets the tenant can access
+	result, err = s.visibleAddAddressResult(jc.Request, result)
+	if jc.Check("couldn't check wallet tenants", err) != nil {
+		return
+	}
+	jc.Encode(result)
+}
+
+func (s *server) walletsAddressHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var addr types.Address
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("addr", &addr) != nil {
+		return
+	}
+
+	err := s.wm.RemoveAddress(id, addr)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+	} else if jc.Check("couldn't remove address", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsAddressesHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	addrs, err := s.wm.Addresses(id)
+	if jc.Check("couldn't load addresses", err) != nil {
+		return
+	}
+	jc.Encode(addrs)
+}
+
+func (s *server) walletsBalanceHandler(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+
+	b, err := s.wm.WalletBalance(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load balance", err) != nil {
+		return
+	}
+	jc.Encode(BalanceResponse(b))
+}
+
+func (s *server) walletsPrivacyHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	report, err := s.wm.PrivacyReport(jc.Request.Context(), id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't generate privacy report", err) != nil {
+		return
+	}
+	jc.Encode(report)
+}
+
+func (s *server) walletsFeesHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	period, limit := wallet.FeePeriodDay, 30
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("period", &period) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	} else if limit < 1 || limit > 1000 {
+		jc.Error(errors.New("limit must be between 1 and 1000"), http.StatusBadRequest)
+		return
+	}
+	summaries, err := s.wm.WalletFeeSummary(id, period, limit)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, wallet.ErrUnknownFeePeriod) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't get fees", err) != nil {
+		return
+	}
+	jc.Encode(summaries)
+}
+
+func (s *server) walletsDeltasHandlerGET(jc jape.Context) {
+	// maxDeltaBlocks is the maximum number of blocks in a range
+	const maxDeltaBlocks = 10000
+
+	var id wallet.ID
+	end := s.cm.Tip().Height
+	start := end - min(end, 143)
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("start", &start) != nil || jc.DecodeForm("end", &end) != nil {
+		return
+	} else if start > end {
+		jc.Error(errors.New("start must not be after end"), http.StatusBadRequest)
+		return
+	} else if end-start >= maxDeltaBlocks {
+		jc.Error(fmt.Errorf("range must be at most %d blocks", maxDeltaBlocks), http.StatusBadRequest)
+		return
+	}
+	deltas, err := s.wm.WalletDeltas(jc.Request.Context(), id, start, end)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get deltas", err) != nil {
+		return
+	}
+	jc.Encode(deltas)
+}
+
+func (s *server) walletsFeesStrategyHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	fs, err := s.wm.WalletFeeStrategy(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get fee strategy", err) != nil {
+		return
+	}
+	jc.Encode(fs)
+}
+
+func (s *server) walletsFeesStrategyHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var fs wallet.FeeStrategy
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&fs) != nil {
+		return
 	}
-
-	w, err := s.wm.UpdateWallet(w)
+	err := s.wm.SetWalletFeeStrategy(id, fs)
 	if errors.Is(err, wallet.ErrNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
-	} else if jc.Check("couldn't update wallet", err) != nil {
+	} else if errors.Is(err, wallet.ErrInvalidFeeStrategy) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't set fee strategy", err) != nil {
 		return
 	}
-	jc.Encode(w)
+	jc.EmptyResonse()
 }
 
-func (s *server) walletsIDHandlerDELETE(jc jape.Context) {
+func (s *server) walletsConfirmationsHandlerGET(jc jape.Context) {
 	var id wallet.ID
 	if jc.DecodeParam("id", &id) != nil {
 		return
 	}
-	err := s.wm.DeleteWallet(id)
+	n, err := s.wm.WalletMinConfirmations(id)
 	if errors.Is(err, wallet.ErrNotFound) {
 		jc.Error(err, http.StatusNotFound)
-	} else if jc.Check("couldn't remove wallet", err) != nil {
 		return
-	}
-	jc.EmptyResonse()
-}
-
-func (s *server) rescanHandlerGET(jc jape.Context) {
-	index, err := s.wm.Tip()
-	if jc.Check("couldn't get tip", err) != nil {
+	} else if jc.Check("couldn't get minimum confirmations", err) != nil {
 		return
 	}
-
-	s.scanMu.Lock()
-	defer s.scanMu.Unlock()
-	s.scanInfo.Index = index
-	jc.Encode(s.scanInfo)
+	jc.Encode(WalletConfirmationsRequest{MinConfirmations: n})
 }
 
-func (s *server) rescanHandlerPOST(jc jape.Context) {
-	var height uint64
-	if jc.Decode(&height) != nil {
+func (s *server) walletsConfirmationsHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var req WalletConfirmationsRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
 		return
 	}
-
-	s.scanMu.Lock()
-	defer s.scanMu.Unlock()
-
-	if s.scanInProgress {
-		jc.Error(errors.New("scan already in progress"), http.StatusConflict)
+	err := s.wm.SetWalletMinConfirmations(id, req.MinConfirmations)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't set minimum confirmations", err) != nil {
 		return
 	}
+	jc.EmptyResonse()
+}
 
-	var index types.ChainIndex
-	if height > 0 {
-		var ok bool
-		index, ok = s.cm.BestIndex(height)
-		if !ok {
-			jc.Error(errors.New("height not found"), http.StatusNotFound)
-			return
-		}
-	}
-
-	s.scanInProgress = true
-	s.scanInfo = RescanResponse{
-		StartIndex: index,
-		Index:      index,
-		StartTime:  time.Now(),
-		Error:      nil,
+// fundingConfirmations returns the number of confirmations the outputs
+// funding a wallet's transaction must have: the greater of the request's and
+// the wallet's minimum.
+func (s *server) fundingConfirmations(jc jape.Context, id wallet.ID, requested uint64) (uint64, bool) {
+	n, err := s.wm.WalletMinConfirmations(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return 0, false
+	} else if jc.Check("couldn't get minimum confirmations", err) != nil {
+		return 0, false
 	}
-
-	go func() {
-		err := s.wm.Scan(context.Background(), index)
-
-		// update the scan state
-		s.scanMu.Lock()
-		defer s.scanMu.Unlock()
-		s.scanInProgress = false
-		if err != nil {
-			msg := err.Error()
-			s.scanInfo.Error = &msg
-		}
-	}()
-
-	jc.EmptyResonse()
+	return max(n, requested), true
 }
 
-func (s *server) walletsAddressHandlerPUT(jc jape.Context) {
+func (s *server) walletsFeesRateHandlerGET(jc jape.Context) {
 	var id wallet.ID
-	var addr wallet.Address
-	if jc.DecodeParam("id", &id) != nil || jc.Decode(&addr) != nil {
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	rate, err := s.wm.WalletFeeRate(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
 		return
-	} else if jc.Check("couldn't add address", s.wm.AddAddress(id, addr)) != nil {
+	} else if jc.Check("couldn't get fee rate", err) != nil {
 		return
 	}
-	jc.EmptyResonse()
+	jc.Encode(rate)
 }
 
-func (s *server) walletsAddressHandlerDELETE(jc jape.Context) {
+func (s *server) walletsMetadataSchemaHandlerGET(jc jape.Context) {
 	var id wallet.ID
-	var addr types.Address
-	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("addr", &addr) != nil {
+	if jc.DecodeParam("id", &id) != nil {
 		return
 	}
-
-	err := s.wm.RemoveAddress(id, addr)
+	schema, err := s.wm.WalletMetadataSchema(id)
 	if errors.Is(err, wallet.ErrNotFound) {
 		jc.Error(err, http.StatusNotFound)
-	} else if jc.Check("couldn't remove address", err) != nil {
 		return
+	} else if jc.Check("couldn't get metadata schema", err) != nil {
+		return
+	} else if schema == nil {
+		schema = json.RawMessage("null")
 	}
-	jc.EmptyResonse()
+	jc.Encode(schema)
 }
 
-func (s *server) walletsAddressesHandlerGET(jc jape.Context) {
+func (s *server) walletsMetadataSchemaHandlerPUT(jc jape.Context) {
 	var id wallet.ID
-	if jc.DecodeParam("id", &id) != nil {
+	var schema json.RawMessage
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&schema) != nil {
 		return
 	}
-	addrs, err := s.wm.Addresses(id)
-	if jc.Check("couldn't load addresses", err) != nil {
+	err := s.wm.SetWalletMetadataSchema(id, schema)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, wallet.ErrInvalidSchema) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't set metadata schema", err) != nil {
 		return
 	}
-	jc.Encode(addrs)
+	jc.EmptyResonse()
 }
 
-func (s *server) walletsBalanceHandler(jc jape.Context) {
+func (s *server) walletsMetadataSchemaHandlerDELETE(jc jape.Context) {
 	var id wallet.ID
 	if jc.DecodeParam("id", &id) != nil {
 		return
 	}
-
-	b, err := s.wm.WalletBalance(id)
+	err := s.wm.SetWalletMetadataSchema(id, nil)
 	if errors.Is(err, wallet.ErrNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
-	} else if jc.Check("couldn't load balance", err) != nil {
+	} else if jc.Check("couldn't remove metadata schema", err) != nil {
 		return
 	}
-	jc.Encode(BalanceResponse(b))
+	jc.EmptyResonse()
 }
 
 func (s *server) walletsEventsHandler(jc jape.Context) {
 	var id wallet.ID
 	offset, limit := 0, 500
-	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+	var includeReverted bool
+	var category string
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("includeReverted", &includeReverted) != nil || jc.DecodeForm("category", &category) != nil {
+		return
+	} else if includeReverted && category != "" {
+		jc.Error(errors.New("category cannot be combined with includeReverted"), http.StatusBadRequest)
+		return
+	}
+	if includeReverted {
+		feed, err := s.wm.WalletEventFeed(jc.Request.Context(), id, offset, limit)
+		if errors.Is(err, wallet.ErrNotFound) {
+			jc.Error(err, http.StatusNotFound)
+			return
+		} else if jc.Check("couldn't load events", err) != nil {
+			return
+		}
+		annotated, err := s.storedCounterparties(id, s.annotateFeed(feed))
+		if jc.Check("couldn't load event counterparties", err) != nil {
+			return
+		}
+		annotated, err = s.categorize(annotated)
+		if jc.Check("couldn't load event categories", err) != nil {
+			return
+		}
+		jc.Encode(annotated)
 		return
 	}
-	events, err := s.wm.WalletEvents(id, offset, limit)
+	events, err := s.wm.WalletCategoryEvents(jc.Request.Context(), id, category, offset, limit)
 	if errors.Is(err, wallet.ErrNotFound) {
 		jc.Error(err, http.StatusNotFound)
 		return
 	} else if jc.Check("couldn't load events", err) != nil {
 		return
 	}
-	jc.Encode(events)
+	annotated, err := s.storedCounterparties(id, wallet.AnnotateEvents(events, s.lookupTag))
+	if jc.Check("couldn't load event counterparties", err) != nil {
+		return
+	}
+	annotated, err = s.categorize(annotated)
+	if jc.Check("couldn't load event categories", err) != nil {
+		return
+	}
+	jc.Encode(annotated)
 }
 
 func (s *server) walletsEventsUnconfirmedHandlerGET(jc jape.Context) {
@@ -519,7 +1727,11 @@ func (s *server) walletsEventsUnconfirmedHandlerGET(jc jape.Context) {
 		jc.Error(err, http.StatusInternalServerError)
 		return
 	}
-	jc.Encode(events)
+	annotated, err := s.markInternal(wallet.AnnotateEvents(events, s.lookupTag))
+	if jc.Check("couldn't mark internal events", err) != nil {
+		return
+	}
+	jc.Encode(annotated)
 }
 
 func (s *server) walletsOutputsSiacoinHandler(jc jape.Context) {
@@ -529,18 +1741,41 @@ func (s *server) walletsOutputsSiacoinHandler(jc jape.Context) {
 	}
 
 	offset, limit := 0, 1000
-	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+	var minConfirmations uint64
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("minConfirmations", &minConfirmations) != nil {
+		return
+	}
+	binary, ok := wantsBinary(jc)
+	if !ok {
 		return
 	}
 
-	scos, err := s.wm.UnspentSiacoinOutputs(id, offset, limit)
+	scos, err := s.wm.ConfirmedSiacoinOutputs(id, minConfirmations, offset, limit)
 	if jc.Check("couldn't load siacoin outputs", err) != nil {
 		return
+	} else if binary {
+		encodeBinary(jc, encoderFunc(func(e *types.Encoder) { types.EncodeSlice(e, scos) }))
+		return
 	}
 
 	jc.Encode(scos)
 }
 
+func (s *server) walletsOutputsExportHandler(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	export, err := s.wm.ExportOutputs(jc.Request.Context(), id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't export outputs", err) != nil {
+		return
+	}
+	jc.Encode(export)
+}
+
 func (s *server) walletsOutputsSiafundHandler(jc jape.Context) {
 	var id wallet.ID
 	if jc.DecodeParam("id", &id) != nil {
@@ -548,13 +1783,21 @@ func (s *server) walletsOutputsSiafundHandler(jc jape.Context) {
 	}
 
 	offset, limit := 0, 1000
-	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+	var minConfirmations uint64
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("minConfirmations", &minConfirmations) != nil {
+		return
+	}
+	binary, ok := wantsBinary(jc)
+	if !ok {
 		return
 	}
 
-	sfos, err := s.wm.UnspentSiafundOutputs(id, offset, limit)
+	sfos, err := s.wm.ConfirmedSiafundOutputs(id, minConfirmations, offset, limit)
 	if jc.Check("couldn't load siacoin outputs", err) != nil {
 		return
+	} else if binary {
+		encodeBinary(jc, encoderFunc(func(e *types.Encoder) { types.EncodeSlice(e, sfos) }))
+		return
 	}
 	jc.Encode(sfos)
 }
@@ -653,7 +1896,23 @@ func (s *server) walletsFundHandler(jc jape.Context) {
 	if jc.DecodeParam("id", &id) != nil || jc.Decode(&wfr) != nil {
 		return
 	}
-	utxos, err := s.wm.UnspentSiacoinOutputs(id, 0, 1000)
+	if s.tm != nil {
+		err := s.tm.CheckFunding(id, wfr.Amount, wfr.Transaction)
+		if errors.Is(err, treasury.ErrLimitExceeded) || errors.Is(err, treasury.ErrDestinationNotAllowed) {
+			jc.Error(err, http.StatusForbidden)
+			return
+		} else if errors.Is(err, wallet.ErrNotFound) {
+			jc.Error(err, http.StatusNotFound)
+			return
+		} else if jc.Check("couldn't check spending limits", err) != nil {
+			return
+		}
+	}
+	minConfirmations, ok := s.fundingConfirmations(jc, id, wfr.MinConfirmations)
+	if !ok {
+		return
+	}
+	utxos, err := s.wm.ConfirmedSiacoinOutputs(id, minConfirmations, 0, 1000)
 	if jc.Check("couldn't get utxos to fund transaction", err) != nil {
 		return
 	}
@@ -670,6 +1929,35 @@ func (s *server) walletsFundHandler(jc jape.Context) {
 	})
 }
 
+func (s *server) walletsEstimateHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req WalletEstimateRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if len(req.Outputs) == 0 {
+		jc.Error(errors.New("estimate must have at least one output"), http.StatusBadRequest)
+		return
+	}
+	for _, sco := range req.Outputs {
+		if sco.Value.IsZero() {
+			jc.Error(errors.New("outputs must have a non-zero value"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	est, err := s.wm.EstimateSend(id, req.Outputs, req.MinConfirmations)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, wallet.ErrInsufficientBalance) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't estimate transaction", err) != nil {
+		return
+	}
+	jc.Encode(est)
+}
+
 func (s *server) walletsFundSFHandler(jc jape.Context) {
 	fundTxn := func(txn *types.Transaction, amount uint64, utxos []types.SiafundElement, changeAddr, claimAddr types.Address, pool []types.Transaction) ([]types.Hash256, error) {
 		s.mu.Lock()
@@ -727,7 +2015,11 @@ func (s *server) walletsFundSFHandler(jc jape.Context) {
 	if jc.DecodeParam("id", &id) != nil || jc.Decode(&wfr) != nil {
 		return
 	}
-	utxos, err := s.wm.UnspentSiafundOutputs(id, 0, 1000)
+	minConfirmations, ok := s.fundingConfirmations(jc, id, wfr.MinConfirmations)
+	if !ok {
+		return
+	}
+	utxos, err := s.wm.ConfirmedSiafundOutputs(id, minConfirmations, 0, 1000)
 	if jc.Check("couldn't get utxos to fund transaction", err) != nil {
 		return
 	}
@@ -763,15 +2055,23 @@ func (s *server) addressesAddrEventsHandlerGET(jc jape.Context) {
 	}
 
 	offset, limit := 0, 1000
-	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+	var sinceHeight uint64
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("sinceHeight", &sinceHeight) != nil {
 		return
 	}
 
-	events, err := s.wm.AddressEvents(addr, offset, limit)
+	var events []wallet.Event
+	var err error
+	if jc.Request.FormValue("sinceHeight") != "" {
+		// polling clients want new events in the order they happened
+		events, err = s.wm.AddressEventsSince(jc.Request.Context(), addr, sinceHeight, offset, limit)
+	} else {
+		events, err = s.wm.AddressEvents(jc.Request.Context(), addr, offset, limit)
+	}
 	if jc.Check("couldn't load events", err) != nil {
 		return
 	}
-	jc.Encode(events)
+	jc.Encode(wallet.AnnotateEvents(events, s.lookupTag))
 }
 
 func (s *server) addressesAddrEventsUnconfirmedHandlerGET(jc jape.Context) {
@@ -784,7 +2084,7 @@ func (s *server) addressesAddrEventsUnconfirmedHandlerGET(jc jape.Context) {
 	if jc.Check("couldn't load events", err) != nil {
 		return
 	}
-	jc.Encode(events)
+	jc.Encode(wallet.AnnotateEvents(events, s.lookupTag))
 }
 
 func (s *server) addressesAddrOutputsSCHandler(jc jape.Context) {
@@ -794,13 +2094,21 @@ func (s *server) addressesAddrOutputsSCHandler(jc jape.Context) {
 	}
 
 	offset, limit := 0, 1000
-	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+	var minConfirmations uint64
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("minConfirmations", &minConfirmations) != nil {
+		return
+	}
+	binary, ok := wantsBinary(jc)
+	if !ok {
 		return
 	}
 
-	utxos, err := s.wm.AddressSiacoinOutputs(addr, offset, limit)
+	utxos, err := s.wm.AddressConfirmedSiacoinOutputs(addr, minConfirmations, offset, limit)
 	if jc.Check("couldn't load utxos", err) != nil {
 		return
+	} else if binary {
+		encodeBinary(jc, encoderFunc(func(e *types.Encoder) { types.EncodeSlice(e, utxos) }))
+		return
 	}
 	jc.Encode(utxos)
 }
@@ -812,13 +2120,21 @@ func (s *server) addressesAddrOutputsSFHandler(jc jape.Context) {
 	}
 
 	offset, limit := 0, 1000
-	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+	var minConfirmations uint64
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("minConfirmations", &minConfirmations) != nil {
+		return
+	}
+	binary, ok := wantsBinary(jc)
+	if !ok {
 		return
 	}
 
-	utxos, err := s.wm.AddressSiafundOutputs(addr, offset, limit)
+	utxos, err := s.wm.AddressConfirmedSiafundOutputs(addr, minConfirmations, offset, limit)
 	if jc.Check("couldn't load utxos", err) != nil {
 		return
+	} else if binary {
+		encodeBinary(jc, encoderFunc(func(e *types.Encoder) { types.EncodeSlice(e, utxos) }))
+		return
 	}
 	jc.Encode(utxos)
 }
@@ -828,14 +2144,85 @@ func (s *server) eventsHandlerGET(jc jape.Context) {
 	if jc.DecodeParam("id", &eventID) != nil {
 		return
 	}
-	events, err := s.wm.Events([]types.Hash256{eventID})
-	if jc.Check("couldn't load events", err) != nil {
-		return
-	} else if len(events) == 0 {
+	fe, err := s.wm.Event(eventID)
+	if errors.Is(err, wallet.ErrNotFound) {
 		jc.Error(errors.New("event not found"), http.StatusNotFound)
 		return
+	} else if jc.Check("couldn't load event", err) != nil {
+		return
+	}
+	annotated, err := s.categorize(s.annotateFeed([]wallet.FeedEvent{fe}))
+	if jc.Check("couldn't load event categories", err) != nil {
+		return
+	}
+	jc.Encode(annotated[0])
+}
+
+func (s *server) eventsRawHandlerGET(jc jape.Context) {
+	var eventID types.Hash256
+	if jc.DecodeParam("id", &eventID) != nil {
+		return
+	}
+	binary, ok := wantsBinary(jc)
+	if !ok {
+		return
+	}
+	raw, err := s.wm.EventRawTransaction(eventID)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(fmt.Errorf("event transaction not found: %w", err), http.StatusNotFound)
+		return
+	} else if errors.Is(err, wallet.ErrRawNotRetained) {
+		jc.Error(err, http.StatusGone)
+		return
+	} else if jc.Check("couldn't load raw transaction", err) != nil {
+		return
+	}
+
+	switch {
+	case !binary:
+		jc.Encode(raw)
+	case raw.Transaction != nil:
+		encodeBinary(jc, raw.Transaction)
+	default:
+		encodeBinary(jc, raw.V2Transaction)
+	}
+}
+
+// annotateFeed annotates feed events, marking reverted events and the
+// blocks that replaced them.
+func (s *server) annotateFeed(feed []wallet.FeedEvent) []wallet.AnnotatedEvent {
+	events := make([]wallet.Event, 0, len(feed))
+	for _, fe := range feed {
+		events = append(events, fe.Event)
+	}
+	annotated := wallet.AnnotateEvents(events, s.lookupTag)
+	for i, fe := range feed {
+		annotated[i].Reverted, annotated[i].ReplacedBy = fe.Reverted, fe.ReplacedBy
+	}
+	return annotated
+}
+
+// storedCounterparties replaces the counterparties of a wallet's annotated
+// events with the ones resolved when the events were applied, so that they
+// keep the labels their addresses had at the time. Events without stored
+// counterparties keep the ones derived from the event.
+func (s *server) storedCounterparties(id wallet.ID, annotated []wallet.AnnotatedEvent) ([]wallet.AnnotatedEvent, error) {
+	ids := make([]types.Hash256, 0, len(annotated))
+	for _, ae := range annotated {
+		if !ae.Reverted {
+			ids = append(ids, ae.ID)
+		}
+	}
+	stored, err := s.wm.WalletEventCounterparties(id, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range annotated {
+		if cps, ok := stored[annotated[i].ID]; ok && !annotated[i].Reverted {
+			annotated[i].Counterparties = cps
+		}
 	}
-	jc.Encode(events[0])
+	return annotated, nil
 }
 
 func (s *server) outputsSiacoinHandlerGET(jc jape.Context) {
@@ -895,6 +2282,14 @@ func (s *server) debugMineHandler(jc jape.Context) {
 	jc.EmptyResonse()
 }
 
+func (s *server) debugVectorsHandler(jc jape.Context) {
+	tv, err := signer.GenerateTestVectors(jc.Request.Context(), s.cm.TipState())
+	if jc.Check("couldn't generate test vectors", err) != nil {
+		return
+	}
+	jc.Encode(tv)
+}
+
 func (s *server) pprofHandler(jc jape.Context) {
 	var handler string
 	if err := jc.DecodeParam("handler", &handler); err != nil {
@@ -911,9 +2306,9 @@ func (s *server) pprofHandler(jc jape.Context) {
 	case "trace":
 		pprof.Trace(jc.ResponseWriter, jc.Request)
 	default:
+		// serves named profiles, e.g. heap and goroutine
 		pprof.Index(jc.ResponseWriter, jc.Request)
 	}
-	pprof.Index(jc.ResponseWriter, jc.Request)
 }
 
 // NewServer returns an HTTP handler that serves the walletd API.
@@ -928,32 +2323,81 @@ func NewServer(cm ChainManager, s Syncer, wm WalletManager, opts ...ServerOption
 		s:    s,
 		wm:   wm,
 		used: make(map[types.Hash256]bool),
+
+		profile:        ProfileWalletAdmin,
+		sessionTTL:     defaultSessionTTL,
+		currencyFormat: CurrencyFormatHastings,
 	}
 	for _, opt := range opts {
 		opt(&srv)
 	}
+	if srv.ops == nil {
+		srv.ops = operations.NewManager(operations.WithLogger(srv.log.Named("operations")))
+	}
+	if srv.profile == ProfilePublicExplorer {
+		srv.publicEndpoints = true
+	}
+	if srv.verifier != nil && srv.replay != nil {
+		srv.verifier.replay = srv.replay
+	}
+	srv.sessions = newSessionManager(srv.sessionTTL)
 
-	// checkAuth checks the request for basic authentication.
-	checkAuth := func(jc jape.Context) bool {
-		if srv.password == "" {
+	// checkAuth checks the request for a valid session, signature, or basic
+	// authentication and returns the principal that made the request.
+	checkAuth := func(jc jape.Context) (string, bool) {
+		if srv.apiPassword() == "" && srv.verifier == nil {
 			// unset password is equivalent to no auth
-			return true
+			return principalAnonymous, true
+		}
+
+		// sub-requests of a batch are authenticated by the batch request
+		if principal, ok := batchPrincipal(jc.Request); ok {
+			return principal, true
+		}
+
+		// verify session cookie
+		if id, _, ok := srv.sessionFromRequest(jc.Request); ok {
+			return sessionPrincipal(id), true
+		}
+
+		// verify request signature
+		if srv.verifier != nil && jc.Request.Header.Get(HeaderSignature) != "" {
+			var mbe *http.MaxBytesError
+			if err := srv.verifier.verify(jc.ResponseWriter, jc.Request); errors.As(err, &mbe) {
+				jc.Error(fmt.Errorf("request body exceeds %d bytes", mbe.Limit), http.StatusRequestEntityTooLarge)
+				return "", false
+			} else if err != nil {
+				jc.Error(fmt.Errorf("unauthorized: %w", err), http.StatusUnauthorized)
+				return "", false
+			}
+			return signingKeyPrincipal(jc.Request.Header.Get(HeaderSigningKey)), true
 		}
 
 		// verify auth header
 		_, pass, ok := jc.Request.BasicAuth()
-		if ok && pass == srv.password {
-			return true
+		if ok && srv.apiPassword() != "" && srv.checkPassword(pass) {
+			return principalPassword, true
 		}
 
 		jc.Error(errors.New("unauthorized"), http.StatusUnauthorized)
-		return false
+		return "", false
 	}
 
 	// wrapAuthHandler wraps a jape handler with an authentication check.
 	wrapAuthHandler := func(h jape.Handler) jape.Handler {
 		return func(jc jape.Context) {
-			if !checkAuth(jc) {
+			principal, ok := checkAuth(jc)
+			if !ok {
+				return
+			}
+			jc.Request = withPrincipal(jc.Request, principal)
+			if tenant, ok := srv.principalTenant(principal); ok {
+				jc.Request = withTenant(jc.Request, tenant)
+				if !srv.checkTenant(jc, tenant) {
+					return
+				}
+			}
+			if !srv.checkUsage(jc, principal) {
 				return
 			}
 			h(jc)
@@ -964,7 +2408,24 @@ func NewServer(cm ChainManager, s Syncer, wm WalletManager, opts ...ServerOption
 	// unless publicEndpoints is true.
 	wrapPublicAuthHandler := func(h jape.Handler) jape.Handler {
 		return func(jc jape.Context) {
-			if !srv.publicEndpoints && !checkAuth(jc) {
+			principal := principalPublic
+			if srv.apiPassword() == "" && srv.verifier == nil {
+				principal = principalAnonymous
+			} else if !srv.publicEndpoints {
+				var ok bool
+				principal, ok = checkAuth(jc)
+				if !ok {
+					return
+				}
+			}
+			jc.Request = withPrincipal(jc.Request, principal)
+			if tenant, ok := srv.principalTenant(principal); ok {
+				jc.Request = withTenant(jc.Request, tenant)
+				if !srv.checkTenant(jc, tenant) {
+					return
+				}
+			}
+			if !srv.checkUsage(jc, principal) {
 				return
 			}
 			h(jc)
@@ -973,14 +2434,29 @@ func NewServer(cm ChainManager, s Syncer, wm WalletManager, opts ...ServerOption
 
 	handlers := map[string]jape.Handler{
 		"GET /state": wrapPublicAuthHandler(srv.stateHandler),
+		"GET /enums": wrapPublicAuthHandler(srv.enumsHandlerGET),
+
+		"POST /payment-uris":       wrapPublicAuthHandler(srv.paymentURIsHandlerPOST),
+		"POST /payment-uris/parse": wrapPublicAuthHandler(srv.paymentURIsParseHandlerPOST),
+
+		"POST /batch": wrapAuthHandler(srv.batchHandler),
+
+		"POST /auth/login":   srv.authLoginHandler,
+		"POST /auth/refresh": srv.authRefreshHandler,
+		"POST /auth/logout":  srv.authLogoutHandler,
 
 		"GET /consensus/network":        wrapPublicAuthHandler(srv.consensusNetworkHandler),
 		"GET /consensus/tip":            wrapPublicAuthHandler(srv.consensusTipHandler),
 		"GET /consensus/tipstate":       wrapPublicAuthHandler(srv.consensusTipStateHandler),
-		"GET /consensus/updates/:index": wrapPublicAuthHandler(srv.consensusUpdatesIndexHandler),
+		"GET /consensus/updates/:index": wrapPublicAuthHandler(selectFields(srv.consensusUpdatesIndexHandler)),
 		"GET /consensus/index/:height":  wrapPublicAuthHandler(srv.consensusIndexHeightHandler),
+		"GET /consensus/stats":          wrapPublicAuthHandler(srv.consensusStatsHandler),
+		"GET /consensus/blocks/:id":     wrapPublicAuthHandler(srv.consensusBlocksIDHandler),
+
+		"GET /metrics": wrapAuthHandler(srv.metricsHandler),
 
 		"POST /syncer/connect":         wrapAuthHandler(srv.syncerConnectHandler),
+		"GET /syncer/status":           wrapPublicAuthHandler(srv.syncerStatusHandler),
 		"GET /syncer/peers":            wrapPublicAuthHandler(srv.syncerPeersHandler),
 		"POST /syncer/broadcast/block": wrapPublicAuthHandler(srv.syncerBroadcastBlockHandler),
 
@@ -988,42 +2464,261 @@ func NewServer(cm ChainManager, s Syncer, wm WalletManager, opts ...ServerOption
 		"GET /txpool/fee":          wrapPublicAuthHandler(srv.txpoolFeeHandler),
 		"POST /txpool/parents":     wrapPublicAuthHandler(srv.txpoolParentsHandler),
 		"POST /txpool/broadcast":   wrapPublicAuthHandler(srv.txpoolBroadcastHandler),
+		"POST /txpool/graph":       wrapPublicAuthHandler(srv.txpoolGraphHandlerPOST),
+
+		"POST /transactions/decode": wrapAuthHandler(srv.transactionsDecodeHandlerPOST),
 
 		"GET /addresses/:addr/balance":            wrapPublicAuthHandler(srv.addressesAddrBalanceHandler),
-		"GET /addresses/:addr/events":             wrapPublicAuthHandler(srv.addressesAddrEventsHandlerGET),
-		"GET /addresses/:addr/events/unconfirmed": wrapPublicAuthHandler(srv.addressesAddrEventsUnconfirmedHandlerGET),
-		"GET /addresses/:addr/outputs/siacoin":    wrapPublicAuthHandler(srv.addressesAddrOutputsSCHandler),
-		"GET /addresses/:addr/outputs/siafund":    wrapPublicAuthHandler(srv.addressesAddrOutputsSFHandler),
+		"GET /addresses/:addr/events":             wrapPublicAuthHandler(selectFields(srv.addressesAddrEventsHandlerGET)),
+		"GET /addresses/:addr/events/unconfirmed": wrapPublicAuthHandler(selectFields(srv.addressesAddrEventsUnconfirmedHandlerGET)),
+		"GET /addresses/:addr/outputs/siacoin":    wrapPublicAuthHandler(selectFields(srv.addressesAddrOutputsSCHandler)),
+		"GET /addresses/:addr/outputs/siafund":    wrapPublicAuthHandler(selectFields(srv.addressesAddrOutputsSFHandler)),
 
 		"GET /outputs/siacoin/:id": wrapPublicAuthHandler(srv.outputsSiacoinHandlerGET),
 		"GET /outputs/siafund/:id": wrapPublicAuthHandler(srv.outputsSiafundHandlerGET),
 
-		"GET /events/:id": wrapPublicAuthHandler(srv.eventsHandlerGET),
+		"GET /events/:id":     wrapPublicAuthHandler(selectFields(srv.eventsHandlerGET)),
+		"GET /events/:id/raw": wrapPublicAuthHandler(srv.eventsRawHandlerGET),
+
+		"POST /verify-message": wrapPublicAuthHandler(srv.verifyMessageHandlerPOST),
 
 		"GET /rescan":  wrapAuthHandler(srv.rescanHandlerGET),
 		"POST /rescan": wrapAuthHandler(srv.rescanHandlerPOST),
 
+		"GET /operations":        wrapAuthHandler(srv.operationsHandlerGET),
+		"GET /operations/:id":    wrapAuthHandler(srv.operationsIDHandlerGET),
+		"DELETE /operations/:id": wrapAuthHandler(srv.operationsIDHandlerDELETE),
+
+		"GET /system/reorg":          wrapAuthHandler(srv.systemReorgHandlerGET),
+		"POST /system/reorg/approve": wrapAuthHandler(srv.systemReorgApproveHandlerPOST),
+
 		"GET /wallets":                        wrapAuthHandler(srv.walletsHandler),
 		"POST /wallets":                       wrapAuthHandler(srv.walletsHandlerPOST),
-		"POST /wallets/:id":                   wrapAuthHandler(srv.walletsIDHandlerPOST),
+		"POST /wallets/:id":                   wrapAuthHandler(staticParam("id", srv.walletsIDHandlerPOST, map[string]jape.Handler{"import": srv.walletsImportHandlerPOST})),
 		"DELETE	/wallets/:id":                 wrapAuthHandler(srv.walletsIDHandlerDELETE),
 		"PUT /wallets/:id/addresses":          wrapAuthHandler(srv.walletsAddressHandlerPUT),
 		"DELETE /wallets/:id/addresses/:addr": wrapAuthHandler(srv.walletsAddressHandlerDELETE),
 		"GET /wallets/:id/addresses":          wrapAuthHandler(srv.walletsAddressesHandlerGET),
 		"GET /wallets/:id/balance":            wrapAuthHandler(srv.walletsBalanceHandler),
-		"GET /wallets/:id/events":             wrapAuthHandler(srv.walletsEventsHandler),
-		"GET /wallets/:id/events/unconfirmed": wrapAuthHandler(srv.walletsEventsUnconfirmedHandlerGET),
-		"GET /wallets/:id/outputs/siacoin":    wrapAuthHandler(srv.walletsOutputsSiacoinHandler),
-		"GET /wallets/:id/outputs/siafund":    wrapAuthHandler(srv.walletsOutputsSiafundHandler),
+		"GET /wallets/:id/privacy":            wrapAuthHandler(srv.walletsPrivacyHandlerGET),
+		"GET /wallets/:id/fees":               wrapAuthHandler(srv.walletsFeesHandlerGET),
+		"GET /wallets/:id/deltas":             wrapAuthHandler(srv.walletsDeltasHandlerGET),
+		"POST /wallets/:id/reconcile":         wrapAuthHandler(srv.walletsReconcileHandlerPOST),
+		"GET /wallets/:id/fees/strategy":      wrapAuthHandler(srv.walletsFeesStrategyHandlerGET),
+		"PUT /wallets/:id/fees/strategy":      wrapAuthHandler(srv.walletsFeesStrategyHandlerPUT),
+		"GET /wallets/:id/confirmations":      wrapAuthHandler(srv.walletsConfirmationsHandlerGET),
+		"PUT /wallets/:id/confirmations":      wrapAuthHandler(srv.walletsConfirmationsHandlerPUT),
+		"GET /wallets/:id/fees/rate":          wrapAuthHandler(srv.walletsFeesRateHandlerGET),
+		"GET /wallets/:id/metadata/schema":    wrapAuthHandler(srv.walletsMetadataSchemaHandlerGET),
+		"PUT /wallets/:id/metadata/schema":    wrapAuthHandler(srv.walletsMetadataSchemaHandlerPUT),
+		"DELETE /wallets/:id/metadata/schema": wrapAuthHandler(srv.walletsMetadataSchemaHandlerDELETE),
+		"GET /wallets/:id/events":             wrapAuthHandler(selectFields(srv.walletsEventsHandler)),
+		"GET /wallets/:id/events/unconfirmed": wrapAuthHandler(selectFields(srv.walletsEventsUnconfirmedHandlerGET)),
+		"GET /wallets/:id/outputs/siacoin":    wrapAuthHandler(selectFields(srv.walletsOutputsSiacoinHandler)),
+		"GET /wallets/:id/outputs/siafund":    wrapAuthHandler(selectFields(srv.walletsOutputsSiafundHandler)),
+		"GET /wallets/:id/outputs/export":     wrapAuthHandler(srv.walletsOutputsExportHandler),
+		"GET /wallets/:id/events/export":      wrapAuthHandler(srv.walletsEventsExportHandlerGET),
 		"POST /wallets/:id/reserve":           wrapAuthHandler(srv.walletsReserveHandler),
 		"POST /wallets/:id/release":           wrapAuthHandler(srv.walletsReleaseHandler),
 		"POST /wallets/:id/fund":              wrapAuthHandler(srv.walletsFundHandler),
 		"POST /wallets/:id/fundsf":            wrapAuthHandler(srv.walletsFundSFHandler),
+		"POST /wallets/:id/estimate":          wrapAuthHandler(srv.walletsEstimateHandlerPOST),
+
+		"GET /wallets/:id/proposals":                   wrapAuthHandler(srv.walletsProposalsHandlerGET),
+		"POST /wallets/:id/proposals":                  wrapAuthHandler(srv.walletsProposalsHandlerPOST),
+		"GET /wallets/:id/proposals/:proposal":         wrapAuthHandler(srv.walletsProposalsIDHandlerGET),
+		"DELETE /wallets/:id/proposals/:proposal":      wrapAuthHandler(srv.walletsProposalsIDHandlerDELETE),
+		"POST /wallets/:id/proposals/:proposal/submit": wrapAuthHandler(srv.walletsProposalsIDSubmitHandlerPOST),
+
+		"GET /wallets/:id/alarms":           wrapAuthHandler(srv.walletsAlarmsHandlerGET),
+		"POST /wallets/:id/alarms":          wrapAuthHandler(srv.walletsAlarmsHandlerPOST),
+		"DELETE /wallets/:id/alarms/:alarm": wrapAuthHandler(srv.walletsAlarmsIDHandlerDELETE),
+		"GET /wallets/:id/forecast":         wrapAuthHandler(srv.walletsForecastHandlerGET),
+
+		"GET /groups":                        wrapAuthHandler(srv.groupsHandlerGET),
+		"POST /groups":                       wrapAuthHandler(srv.groupsHandlerPOST),
+		"POST /groups/:id":                   wrapAuthHandler(srv.groupsIDHandlerPOST),
+		"DELETE /groups/:id":                 wrapAuthHandler(srv.groupsIDHandlerDELETE),
+		"GET /groups/:id/wallets":            wrapAuthHandler(srv.groupsIDWalletsHandlerGET),
+		"PUT /groups/:id/wallets/:wallet":    wrapAuthHandler(srv.groupsIDWalletsHandlerPUT),
+		"DELETE /groups/:id/wallets/:wallet": wrapAuthHandler(srv.groupsIDWalletsHandlerDELETE),
+		"GET /groups/:id/balance":            wrapAuthHandler(srv.groupsIDBalanceHandlerGET),
+		"GET /groups/:id/events":             wrapAuthHandler(selectFields(srv.groupsIDEventsHandlerGET)),
+
+		"GET /wallet-templates":        wrapAuthHandler(srv.walletTemplatesHandlerGET),
+		"POST /wallet-templates":       wrapAuthHandler(srv.walletTemplatesHandlerPOST),
+		"GET /wallet-templates/:id":    wrapAuthHandler(srv.walletTemplatesIDHandlerGET),
+		"POST /wallet-templates/:id":   wrapAuthHandler(srv.walletTemplatesIDHandlerPOST),
+		"DELETE /wallet-templates/:id": wrapAuthHandler(srv.walletTemplatesIDHandlerDELETE),
+
+		"GET /classification-rules":        wrapAuthHandler(srv.classificationRulesHandlerGET),
+		"POST /classification-rules":       wrapAuthHandler(srv.classificationRulesHandlerPOST),
+		"DELETE /classification-rules/:id": wrapAuthHandler(srv.classificationRulesIDHandlerDELETE),
+	}
+
+	if srv.whm != nil {
+		handlers["GET /webhooks"] = wrapAuthHandler(srv.webhooksHandlerGET)
+		handlers["POST /webhooks"] = wrapAuthHandler(srv.webhooksHandlerPOST)
+		handlers["DELETE /webhooks/:id"] = wrapAuthHandler(srv.webhooksIDHandlerDELETE)
+	}
+
+	if srv.am != nil {
+		handlers["GET /alerts"] = wrapAuthHandler(srv.alertsHandlerGET)
+		handlers["POST /alerts/dismiss"] = wrapAuthHandler(srv.alertsDismissHandlerPOST)
+	}
+
+	if srv.pm != nil {
+		handlers["GET /wallets/:id/payments"] = wrapAuthHandler(srv.walletsPaymentsHandlerGET)
+		handlers["POST /wallets/:id/payments"] = wrapAuthHandler(srv.walletsPaymentsHandlerPOST)
+		handlers["DELETE /wallets/:id/payments/:payment"] = wrapAuthHandler(srv.walletsPaymentsIDHandlerDELETE)
+		handlers["POST /wallets/:id/payments/flush"] = wrapAuthHandler(srv.walletsPaymentsFlushHandlerPOST)
+		handlers["GET /wallets/:id/payments/batches"] = wrapAuthHandler(srv.walletsPaymentsBatchesHandlerGET)
+	}
+
+	if srv.sm != nil {
+		handlers["GET /signers"] = wrapAuthHandler(srv.signersHandlerGET)
+		handlers["GET /wallets/:id/signer"] = wrapAuthHandler(srv.walletsSignerHandlerGET)
+		handlers["PUT /wallets/:id/signer"] = wrapAuthHandler(srv.walletsSignerHandlerPUT)
+		handlers["POST /wallets/:id/sign"] = wrapAuthHandler(srv.requireTOTP(srv.walletsSignHandlerPOST))
+		handlers["POST /wallets/:id/addresses/:addr/sign-message"] = wrapAuthHandler(srv.requireTOTP(srv.walletsAddressesSignMessageHandlerPOST))
+	}
+
+	if srv.ks != nil {
+		handlers["GET /wallets/:id/seed"] = wrapAuthHandler(srv.walletsSeedHandlerGET)
+		handlers["PUT /wallets/:id/seed"] = wrapAuthHandler(srv.requireTOTP(srv.walletsSeedHandlerPUT))
+		handlers["DELETE /wallets/:id/seed"] = wrapAuthHandler(srv.requireTOTP(srv.walletsSeedHandlerDELETE))
+		handlers["POST /wallets/:id/unlock"] = wrapAuthHandler(srv.requireTOTP(srv.walletsUnlockHandlerPOST))
+		handlers["POST /wallets/:id/lock"] = wrapAuthHandler(srv.walletsLockHandlerPOST)
+		handlers["POST /wallets/:id/backup/challenge"] = wrapAuthHandler(srv.requireTOTP(srv.walletsBackupChallengeHandlerPOST))
+		handlers["POST /wallets/:id/backup/verify"] = wrapAuthHandler(srv.requireTOTP(srv.walletsBackupVerifyHandlerPOST))
+	}
+
+	if srv.thm != nil {
+		handlers["GET /threshold/groups"] = wrapAuthHandler(srv.thresholdGroupsHandlerGET)
+		handlers["POST /threshold/groups"] = wrapAuthHandler(srv.thresholdGroupsHandlerPOST)
+		handlers["GET /threshold/groups/:id"] = wrapAuthHandler(srv.thresholdGroupsIDHandlerGET)
+		handlers["DELETE /threshold/groups/:id"] = wrapAuthHandler(srv.thresholdGroupsIDHandlerDELETE)
+		handlers["POST /threshold/groups/:id/participants"] = wrapAuthHandler(srv.thresholdGroupsIDParticipantsHandlerPOST)
+		handlers["GET /threshold/sessions"] = wrapAuthHandler(srv.thresholdSessionsHandlerGET)
+		handlers["POST /threshold/sessions"] = wrapAuthHandler(srv.thresholdSessionsHandlerPOST)
+		handlers["GET /threshold/sessions/:id"] = wrapAuthHandler(srv.thresholdSessionsIDHandlerGET)
+		handlers["POST /threshold/sessions/:id/commitments"] = wrapAuthHandler(srv.thresholdSessionsIDCommitmentsHandlerPOST)
+		handlers["POST /threshold/sessions/:id/shares"] = wrapAuthHandler(srv.thresholdSessionsIDSharesHandlerPOST)
+	}
+
+	if srv.rm != nil {
+		handlers["POST /wallets/:id/rotate"] = wrapAuthHandler(srv.requireTOTP(srv.walletsRotateHandlerPOST))
+		handlers["GET /wallets/:id/rotations"] = wrapAuthHandler(srv.walletsRotationsHandlerGET)
+		handlers["GET /wallets/:id/rotations/:rotation"] = wrapAuthHandler(srv.walletsRotationsIDHandlerGET)
+		handlers["DELETE /wallets/:id/rotations/:rotation"] = wrapAuthHandler(srv.walletsRotationsIDHandlerDELETE)
+		handlers["GET /wallets/:id/rotations/:rotation/sweeps"] = wrapAuthHandler(srv.walletsRotationsIDSweepsHandlerGET)
+		handlers["POST /wallets/:id/rotations/:rotation/sweeps"] = wrapAuthHandler(srv.requireTOTP(srv.walletsRotationsIDSweepsHandlerPOST))
+	}
+
+	if srv.fm != nil {
+		handlers["GET /wallets/:id/forwarding/rules"] = wrapAuthHandler(srv.walletsForwardingHandlerGET)
+		handlers["POST /wallets/:id/forwarding/rules"] = wrapAuthHandler(srv.requireTOTP(srv.walletsForwardingHandlerPOST))
+		handlers["GET /wallets/:id/forwarding/rules/:rule"] = wrapAuthHandler(srv.walletsForwardingIDHandlerGET)
+		handlers["DELETE /wallets/:id/forwarding/rules/:rule"] = wrapAuthHandler(srv.walletsForwardingIDHandlerDELETE)
+		handlers["POST /wallets/:id/forwarding/rules/:rule/sweeps"] = wrapAuthHandler(srv.requireTOTP(srv.walletsForwardingIDSweepsHandlerPOST))
+		handlers["GET /wallets/:id/forwarding/sweeps"] = wrapAuthHandler(srv.walletsForwardingSweepsHandlerGET)
+	}
+
+	if srv.tfm != nil {
+		handlers["POST /transfers"] = wrapAuthHandler(srv.transfersHandlerPOST)
+		handlers["GET /transfers/:id"] = wrapAuthHandler(srv.transfersIDHandlerGET)
+		handlers["GET /wallets/:id/transfers"] = wrapAuthHandler(srv.walletsTransfersHandlerGET)
+	}
+
+	if srv.dgm != nil {
+		handlers["GET /wallets/:id/digest"] = wrapAuthHandler(srv.walletsDigestHandlerGET)
+		handlers["PUT /wallets/:id/digest"] = wrapAuthHandler(srv.walletsDigestHandlerPUT)
+		handlers["DELETE /wallets/:id/digest"] = wrapAuthHandler(srv.walletsDigestHandlerDELETE)
+		handlers["GET /wallets/:id/digest/preview"] = wrapAuthHandler(srv.walletsDigestPreviewHandlerGET)
+	}
+
+	if srv.em != nil {
+		handlers["GET /wallets/:id/escrows"] = wrapAuthHandler(srv.walletsEscrowsHandlerGET)
+		handlers["POST /wallets/:id/escrows"] = wrapAuthHandler(srv.walletsEscrowsHandlerPOST)
+		handlers["GET /wallets/:id/escrows/:escrow"] = wrapAuthHandler(srv.walletsEscrowsIDHandlerGET)
+		handlers["POST /wallets/:id/escrows/:escrow/fund"] = wrapAuthHandler(srv.walletsEscrowsIDFundHandlerPOST)
+		handlers["POST /wallets/:id/escrows/:escrow/release"] = wrapAuthHandler(srv.walletsEscrowsIDReleaseHandlerPOST)
+		handlers["POST /wallets/:id/escrows/:escrow/refund"] = wrapAuthHandler(srv.walletsEscrowsIDRefundHandlerPOST)
+		handlers["POST /wallets/:id/escrows/:escrow/signatures"] = wrapAuthHandler(srv.walletsEscrowsIDSignaturesHandlerPOST)
+	}
+
+	if srv.trm != nil {
+		handlers["GET /triggers"] = wrapAuthHandler(srv.triggersHandlerGET)
+		handlers["POST /triggers"] = wrapAuthHandler(srv.triggersHandlerPOST)
+		handlers["DELETE /triggers/:id"] = wrapAuthHandler(srv.triggersIDHandlerDELETE)
+	}
+
+	if srv.tgm != nil {
+		handlers["GET /tags"] = wrapAuthHandler(srv.tagsHandlerGET)
+		handlers["PUT /tags"] = wrapAuthHandler(srv.tagsHandlerPUT)
+		handlers["DELETE /tags/:addr"] = wrapAuthHandler(srv.tagsAddrHandlerDELETE)
+		handlers["POST /tags/import"] = wrapAuthHandler(srv.tagsImportHandlerPOST)
+	}
+
+	if srv.tm != nil {
+		handlers["GET /wallets/:id/policy"] = wrapAuthHandler(srv.walletsPolicyHandlerGET)
+		handlers["PUT /wallets/:id/policy"] = wrapAuthHandler(srv.walletsPolicyHandlerPUT)
+		handlers["GET /wallets/:id/limits"] = wrapAuthHandler(srv.walletsLimitsHandlerGET)
+		handlers["POST /wallets/:id/limits/override"] = wrapAuthHandler(srv.walletsLimitsOverrideHandlerPOST)
+		handlers["GET /wallets/:id/allowlist"] = wrapAuthHandler(srv.walletsAllowlistHandlerGET)
+		handlers["PUT /wallets/:id/allowlist"] = wrapAuthHandler(srv.walletsAllowlistHandlerPUT)
+		handlers["DELETE /wallets/:id/allowlist/:addr"] = wrapAuthHandler(srv.walletsAllowlistHandlerDELETE)
+		handlers["GET /approvals"] = wrapAuthHandler(srv.approvalsHandlerGET)
+		handlers["GET /approvals/:id"] = wrapAuthHandler(srv.approvalsIDHandlerGET)
+		handlers["POST /approvals/:id/approve"] = wrapAuthHandler(srv.approvalsApproveHandlerPOST)
+		handlers["POST /approvals/:id/reject"] = wrapAuthHandler(srv.approvalsRejectHandlerPOST)
+	}
+
+	if srv.apm != nil {
+		handlers["GET /approvers"] = wrapAuthHandler(srv.approversHandlerGET)
+		handlers["POST /approvers/pairings"] = wrapAuthHandler(srv.approversPairingsHandlerPOST)
+		handlers["DELETE /approvers/:id"] = wrapAuthHandler(srv.approversIDHandlerDELETE)
+	}
+
+	if srv.totp != nil {
+		handlers["GET /wallets/:id/totp"] = wrapAuthHandler(srv.walletsTOTPHandlerGET)
+		handlers["POST /wallets/:id/totp"] = wrapAuthHandler(srv.walletsTOTPHandlerPOST)
+		handlers["POST /wallets/:id/totp/confirm"] = wrapAuthHandler(srv.walletsTOTPConfirmHandlerPOST)
+		handlers["DELETE /wallets/:id/totp"] = wrapAuthHandler(srv.walletsTOTPHandlerDELETE)
+	}
+
+	if srv.jobs != nil {
+		handlers["GET /system/jobs"] = wrapAuthHandler(srv.systemJobsHandlerGET)
+		handlers["POST /system/jobs/:name/trigger"] = wrapAuthHandler(srv.systemJobsTriggerHandlerPOST)
+		handlers["POST /system/jobs/:name/pause"] = wrapAuthHandler(srv.systemJobsPauseHandlerPOST)
+		handlers["POST /system/jobs/:name/resume"] = wrapAuthHandler(srv.systemJobsResumeHandlerPOST)
+	}
+
+	if srv.um != nil {
+		handlers["GET /system/usage"] = wrapAuthHandler(srv.systemUsageHandlerGET)
+	}
+
+	if srv.nodeKey != nil {
+		handlers["GET /system/attestation"] = wrapAuthHandler(srv.systemAttestationHandlerGET)
+	}
+
+	if srv.graphqlEnabled {
+		srv.gqlSchema = srv.graphqlSchema()
+		handlers["POST /graphql"] = wrapAuthHandler(srv.graphqlHandlerPOST)
 	}
 
 	if srv.debugEnabled {
 		handlers["POST /debug/mine"] = wrapAuthHandler(srv.debugMineHandler)
+		handlers["GET /debug/vectors"] = wrapAuthHandler(srv.debugVectorsHandler)
 		handlers["GET /debug/pprof/:handler"] = wrapAuthHandler(srv.pprofHandler)
 	}
-	return jape.Mux(handlers)
+
+	// remove any routes not exposed by the profile
+	for route := range handlers {
+		if !srv.profile.allows(route) {
+			delete(handlers, route)
+		}
+	}
+	srv.handler = versionRoutes(structuredErrors(formatCurrencies(jape.Mux(handlers), srv.currencyFormat)), srv.legacySunset)
+	return srv.handler
 }
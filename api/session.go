@@ -0,0 +1,173 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/jape"
+	"lukechampine.com/frand"
+)
+
+const (
+	// sessionCookieName is the name of the cookie containing the session
+	// token.
+	sessionCookieName = "walletd_session"
+
+	// defaultSessionTTL is the default lifetime of a session token.
+	defaultSessionTTL = 30 * time.Minute
+)
+
+// A sessionManager issues and validates signed session tokens. Tokens are
+// signed with a random key generated at startup, so restarting walletd
+// invalidates all sessions.
+type sessionManager struct {
+	key [32]byte
+	ttl time.Duration
+
+	mu      sync.Mutex
+	revoked map[[16]byte]time.Time // token ID -> expiration
+}
+
+func (sm *sessionManager) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, sm.key[:])
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// issue returns a new session token and its expiration.
+func (sm *sessionManager) issue() (string, time.Time) {
+	expiration := time.Now().Add(sm.ttl)
+	payload := make([]byte, 24)
+	frand.Read(payload[:16])
+	binary.BigEndian.PutUint64(payload[16:], uint64(expiration.Unix()))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sm.sign(payload)), expiration
+}
+
+// validate checks the signature and expiration of a session token and returns
+// its ID and expiration.
+func (sm *sessionManager) validate(token string) (id [16]byte, expiration time.Time, ok bool) {
+	payloadStr, sigStr, found := strings.Cut(token, ".")
+	if !found {
+		return
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(payloadStr)
+	if err != nil || len(payload) != 24 {
+		return
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigStr)
+	if err != nil || !hmac.Equal(sig, sm.sign(payload)) {
+		return
+	}
+
+	copy(id[:], payload[:16])
+	expiration = time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0)
+	if time.Now().After(expiration) {
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if _, revoked := sm.revoked[id]; revoked {
+		return
+	}
+	return id, expiration, true
+}
+
+// revoke invalidates the session token with the given ID.
+func (sm *sessionManager) revoke(id [16]byte, expiration time.Time) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	// prune tokens that have already expired
+	now := time.Now()
+	for k, exp := range sm.revoked {
+		if now.After(exp) {
+			delete(sm.revoked, k)
+		}
+	}
+	sm.revoked[id] = expiration
+}
+
+func newSessionManager(ttl time.Duration) *sessionManager {
+	sm := &sessionManager{
+		ttl:     ttl,
+		revoked: make(map[[16]byte]time.Time),
+	}
+	frand.Read(sm.key[:])
+	return sm
+}
+
+// sessionFromRequest returns the ID and expiration of the request's session
+// token, if it has a valid one.
+func (s *server) sessionFromRequest(r *http.Request) ([16]byte, time.Time, bool) {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return [16]byte{}, time.Time{}, false
+	}
+	return s.sessions.validate(c.Value)
+}
+
+// setSessionCookie issues a new session token and sets it as a cookie on the
+// response.
+func (s *server) setSessionCookie(jc jape.Context) time.Time {
+	token, expiration := s.sessions.issue()
+	http.SetCookie(jc.ResponseWriter, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiration,
+		HttpOnly: true,
+		Secure:   jc.Request.TLS != nil || jc.Request.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	return expiration
+}
+
+func (s *server) authLoginHandler(jc jape.Context) {
+	var req LoginRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	// a password is required to log in if any authentication is enabled
+	authEnabled := s.apiPassword() != "" || s.verifier != nil
+	if authEnabled && (s.apiPassword() == "" || !s.checkPassword(req.Password)) {
+		jc.Error(errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	jc.Encode(SessionResponse{
+		Expiration: s.setSessionCookie(jc),
+	})
+}
+
+func (s *server) authRefreshHandler(jc jape.Context) {
+	id, expiration, ok := s.sessionFromRequest(jc.Request)
+	if !ok {
+		jc.Error(errors.New("unauthorized"), http.StatusUnauthorized)
+		return
+	}
+	s.sessions.revoke(id, expiration)
+	jc.Encode(SessionResponse{
+		Expiration: s.setSessionCookie(jc),
+	})
+}
+
+func (s *server) authLogoutHandler(jc jape.Context) {
+	if id, expiration, ok := s.sessionFromRequest(jc.Request); ok {
+		s.sessions.revoke(id, expiration)
+	}
+	http.SetCookie(jc.ResponseWriter, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	jc.EmptyResonse()
+}
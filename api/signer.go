@@ -0,0 +1,153 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func (s *server) signersHandlerGET(jc jape.Context) {
+	names := s.sm.Signers()
+	sort.Strings(names)
+	jc.Encode(names)
+}
+
+func (s *server) walletsSignerHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	name, err := s.sm.WalletSigner(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't get signer", err) != nil {
+		return
+	}
+	jc.Encode(WalletSignerRequest{Signer: name})
+}
+
+func (s *server) walletsSignerHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var req WalletSignerRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	err := s.sm.SetWalletSigner(id, req.Signer)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, signer.ErrNotFound) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if jc.Check("couldn't set signer", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsSignHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req WalletSignRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if (req.Transaction == nil) == (req.V2Transaction == nil) {
+		jc.Error(errors.New("exactly one of transaction or v2Transaction must be set"), http.StatusBadRequest)
+		return
+	}
+
+	var resp WalletSignResponse
+	sign := func() ([]types.Transaction, []types.V2Transaction, error) {
+		if req.Transaction != nil {
+			txn, err := s.sm.SignTransaction(jc.Request.Context(), id, *req.Transaction, req.ToSign)
+			resp.Transaction = &txn
+			return []types.Transaction{txn}, nil, err
+		}
+		txn, err := s.sm.SignV2Transaction(jc.Request.Context(), id, *req.V2Transaction)
+		resp.V2Transaction = &txn
+		return nil, []types.V2Transaction{txn}, err
+	}
+
+	var pt treasury.PendingTransaction
+	var pending bool
+	var err error
+	if s.tm == nil {
+		_, _, err = sign()
+	} else {
+		// a signed transaction can be broadcast without walletd, so the
+		// treasury policy is enforced before it is released
+		var txns []types.Transaction
+		var v2txns []types.V2Transaction
+		if req.Transaction != nil {
+			txns = []types.Transaction{*req.Transaction}
+		} else {
+			v2txns = []types.V2Transaction{*req.V2Transaction}
+		}
+		pt, pending, err = s.tm.SignTransactionSet(txns, v2txns, submitter(jc.Request), sign)
+	}
+	if errors.Is(err, treasury.ErrLimitExceeded) || errors.Is(err, treasury.ErrDestinationNotAllowed) {
+		jc.Error(err, http.StatusForbidden)
+		return
+	} else if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, signer.ErrNoSigner) || errors.Is(err, signer.ErrUnknownKey) || errors.Is(err, signer.ErrUnsupportedPolicy) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, keystore.ErrLocked) {
+		jc.Error(err, http.StatusLocked)
+		return
+	} else if jc.Check("couldn't sign transaction", err) != nil {
+		return
+	} else if pending {
+		// the signed transaction was added to the approval queue instead of
+		// being returned
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusAccepted)
+		jc.Encode(pt)
+		return
+	}
+	jc.Encode(resp)
+}
+
+func (s *server) walletsAddressesSignMessageHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var addr types.Address
+	var req WalletSignMessageRequest
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("addr", &addr) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	sm, err := s.sm.SignMessage(jc.Request.Context(), id, addr, req.Message)
+	if errors.Is(err, wallet.ErrNotFound) || errors.Is(err, signer.ErrNotWalletAddress) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, signer.ErrNoSigner) || errors.Is(err, signer.ErrUnknownKey) || errors.Is(err, signer.ErrUnsupportedPolicy) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if errors.Is(err, keystore.ErrLocked) {
+		jc.Error(err, http.StatusLocked)
+		return
+	} else if jc.Check("couldn't sign message", err) != nil {
+		return
+	}
+	jc.Encode(sm)
+}
+
+func (s *server) verifyMessageHandlerPOST(jc jape.Context) {
+	var sm signer.SignedMessage
+	if jc.Decode(&sm) != nil {
+		return
+	}
+	if err := signer.VerifyMessage(sm); err != nil {
+		jc.Encode(VerifyMessageResponse{Valid: false, Reason: err.Error()})
+		return
+	}
+	jc.Encode(VerifyMessageResponse{Valid: true})
+}
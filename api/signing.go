@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers used by the HMAC request signing scheme.
+const (
+	HeaderSigningKey       = "X-Walletd-Key"
+	HeaderSigningTimestamp = "X-Walletd-Timestamp"
+	HeaderSignature        = "X-Walletd-Signature"
+)
+
+const (
+	// signatureWindow is the maximum difference between a signed request's
+	// timestamp and the server's clock.
+	signatureWindow = 5 * time.Minute
+
+	// maxSignedBodySize is the maximum size of a signed request body.
+	maxSignedBodySize = 32 << 20 // 32 MiB
+)
+
+// signingPayload returns the message authenticated by a request signature.
+// The request URI must include the /api prefix if the API is served under
+// one, since it is the URI the client sent.
+func signingPayload(method, requestURI string, timestamp int64, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	return []byte(method + "\n" + requestURI + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + hex.EncodeToString(bodyHash[:]))
+}
+
+func computeSignature(secret []byte, payload []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// SignRequest signs req with the secret of the given key using the HMAC
+// request signing scheme. The request's body is read and replaced so that it
+// can still be sent.
+func SignRequest(req *http.Request, keyID string, secret []byte) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		} else if err := req.Body.Close(); err != nil {
+			return fmt.Errorf("failed to close request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	timestamp := time.Now().Unix()
+	sig := computeSignature(secret, signingPayload(req.Method, req.URL.RequestURI(), timestamp, body))
+	req.Header.Set(HeaderSigningKey, keyID)
+	req.Header.Set(HeaderSigningTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, hex.EncodeToString(sig))
+	return nil
+}
+
+// A ReplayCache records the signatures of verified requests, so that each
+// signature may only be used once within the signature window. Servers that
+// accept the same signing keys should share a cache, so that a request sent
+// to one cannot be replayed against the other.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // signature -> timestamp
+}
+
+// add records a signature. It returns false if the signature has already
+// been used.
+func (rc *ReplayCache) add(sig []byte, timestamp time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	// prune signatures that are outside of the window, since they can no
+	// longer be replayed
+	for s, t := range rc.seen {
+		if time.Since(t) > signatureWindow {
+			delete(rc.seen, s)
+		}
+	}
+	if _, ok := rc.seen[string(sig)]; ok {
+		return false
+	}
+	rc.seen[string(sig)] = timestamp
+	return true
+}
+
+// NewReplayCache returns an empty ReplayCache.
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+// A requestVerifier verifies HMAC-signed requests. Each signature may only be
+// used once within the signature window.
+type requestVerifier struct {
+	keys   map[string][]byte
+	replay *ReplayCache
+}
+
+// verify checks the signature of the request. The request's body is read
+// and replaced. If the body was rewritten by formatCurrencies, the signature
+// is checked against the body sent by the client. Bodies larger than
+// maxSignedBodySize are rejected with an *http.MaxBytesError.
+func (rv *requestVerifier) verify(w http.ResponseWriter, r *http.Request) error {
+	keyID := r.Header.Get(HeaderSigningKey)
+	secret, ok := rv.keys[keyID]
+	if !ok {
+		return errors.New("unknown signing key")
+	}
+
+	unix, err := strconv.ParseInt(r.Header.Get(HeaderSigningTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	timestamp := time.Unix(unix, 0)
+	if d := time.Since(timestamp); d > signatureWindow || d < -signatureWindow {
+		return errors.New("timestamp outside of signature window")
+	}
+
+	sig, err := hex.DecodeString(r.Header.Get(HeaderSignature))
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+
+	body, ok := originalBody(r)
+	if !ok {
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodySize))
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	requestURI := r.RequestURI
+	if requestURI == "" {
+		requestURI = r.URL.RequestURI()
+	}
+	if !hmac.Equal(sig, computeSignature(secret, signingPayload(r.Method, requestURI, unix, body))) {
+		return errors.New("invalid signature")
+	}
+
+	if !rv.replay.add(sig, timestamp) {
+		return errors.New("signature has already been used")
+	}
+	return nil
+}
+
+func newRequestVerifier(keys map[string][]byte) *requestVerifier {
+	return &requestVerifier{
+		keys:   keys,
+		replay: NewReplayCache(),
+	}
+}
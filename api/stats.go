@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+)
+
+const (
+	// defaultStatsWindows are the windows, in blocks, used when none are
+	// requested: roughly a day, a week, and a month of blocks.
+	defaultStatsWindows = "144,1008,4320"
+	// maxStatsWindows is the maximum number of windows per request.
+	maxStatsWindows = 10
+)
+
+// parseStatsWindows parses a comma-separated list of window sizes.
+func parseStatsWindows(s string) ([]uint64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) > maxStatsWindows {
+		return nil, fmt.Errorf("at most %d windows can be requested", maxStatsWindows)
+	}
+	windows := make([]uint64, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.ParseUint(strings.TrimSpace(p), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", p, err)
+		} else if n == 0 {
+			return nil, errors.New("windows must be at least one block")
+		}
+		windows = append(windows, n)
+	}
+	return windows, nil
+}
+
+// workInt converts a types.Work to a big.Int.
+func workInt(w types.Work) *big.Int {
+	n, _ := new(big.Int).SetString(w.String(), 10)
+	if n == nil {
+		return new(big.Int)
+	}
+	return n
+}
+
+// statsWindow summarizes the blocks between the start and end states. The
+// start state is the state of the block before the window's first block.
+func statsWindow(start, end consensus.State) (ConsensusStatsWindow, error) {
+	w := ConsensusStatsWindow{
+		Blocks:      end.Index.Height - start.Index.Height,
+		StartHeight: start.Index.Height + 1,
+		EndHeight:   end.Index.Height,
+	}
+	// PrevTimestamps[0] is the timestamp of the state's most recent block
+	elapsed := end.PrevTimestamps[0].Sub(start.PrevTimestamps[0])
+	w.AvgBlockInterval = elapsed / time.Duration(w.Blocks)
+
+	// the difference in total work is the sum of the difficulty of each
+	// block in the window
+	work := new(big.Int).Sub(workInt(end.TotalWork), workInt(start.TotalWork))
+	avg := new(big.Int).Div(work, new(big.Int).SetUint64(w.Blocks))
+	if err := w.AvgDifficulty.UnmarshalText([]byte(avg.String())); err != nil {
+		return ConsensusStatsWindow{}, fmt.Errorf("failed to encode difficulty: %w", err)
+	}
+	if elapsed > 0 {
+		w.Hashrate, _ = new(big.Float).Quo(new(big.Float).SetInt(work), big.NewFloat(elapsed.Seconds())).Float64()
+	}
+	return w, nil
+}
+
+func (s *server) consensusStatsHandler(jc jape.Context) {
+	param := defaultStatsWindows
+	if jc.DecodeForm("windows", &param) != nil {
+		return
+	}
+	windows, err := parseStatsWindows(param)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	tip := s.cm.TipState()
+	resp := ConsensusStatsResponse{
+		Tip:        tip.Index,
+		Difficulty: tip.Difficulty,
+		TotalWork:  tip.TotalWork,
+		Windows:    make([]ConsensusStatsWindow, 0, len(windows)),
+	}
+	if tip.Network != nil {
+		resp.TargetBlockInterval = tip.Network.BlockInterval
+	}
+	for _, n := range windows {
+		if tip.Index.Height == 0 {
+			break // no blocks after genesis
+		} else if n > tip.Index.Height {
+			n = tip.Index.Height
+		}
+		index, ok := s.cm.BestIndex(tip.Index.Height - n)
+		if !ok {
+			jc.Error(fmt.Errorf("missing index at height %d", tip.Index.Height-n), http.StatusInternalServerError)
+			return
+		}
+		start, ok := s.cm.State(index.ID)
+		if !ok {
+			jc.Error(fmt.Errorf("missing state for block %v", index), http.StatusInternalServerError)
+			return
+		}
+		w, err := statsWindow(start, tip)
+		if jc.Check("couldn't compute stats", err) != nil {
+			return
+		}
+		resp.Windows = append(resp.Windows, w)
+	}
+	jc.Encode(resp)
+}
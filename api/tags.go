@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/tags"
+)
+
+// lookupTag returns the label and category of a known address.
+func (s *server) lookupTag(addr types.Address) (label, category string, ok bool) {
+	if s.tgm == nil {
+		return "", "", false
+	}
+	t, ok := s.tgm.Tag(addr)
+	return t.Label, t.Category, ok
+}
+
+func (s *server) tagsHandlerGET(jc jape.Context) {
+	jc.Encode(s.tgm.Tags())
+}
+
+func (s *server) tagsHandlerPUT(jc jape.Context) {
+	var req TagRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	if _, err := s.tgm.SetTag(req.Address, req.Label, req.Category); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) tagsAddrHandlerDELETE(jc jape.Context) {
+	var addr types.Address
+	if jc.DecodeParam("addr", &addr) != nil {
+		return
+	}
+	err := s.tgm.RemoveTag(addr)
+	if errors.Is(err, tags.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove tag", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) tagsImportHandlerPOST(jc jape.Context) {
+	var tt []tags.Tag
+	if jc.Decode(&tt) != nil {
+		return
+	}
+	if err := s.tgm.Import(tt); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.EmptyResonse()
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func (req TemplateRequest) template() wallet.Template {
+	return wallet.Template{
+		Name:           req.Name,
+		Description:    req.Description,
+		Metadata:       req.Metadata,
+		MetadataSchema: req.MetadataSchema,
+		FeeStrategy:    req.FeeStrategy,
+		Webhooks:       req.Webhooks,
+	}
+}
+
+func (s *server) walletTemplatesHandlerGET(jc jape.Context) {
+	templates, err := s.wm.Templates()
+	if jc.Check("couldn't load templates", err) != nil {
+		return
+	}
+	jc.Encode(templates)
+}
+
+func (s *server) walletTemplatesHandlerPOST(jc jape.Context) {
+	var req TemplateRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	t := req.template()
+	if err := t.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	t, err := s.wm.AddTemplate(t)
+	if jc.Check("couldn't add template", err) != nil {
+		return
+	}
+	jc.Encode(t)
+}
+
+func (s *server) walletTemplatesIDHandlerGET(jc jape.Context) {
+	var id wallet.TemplateID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	t, err := s.wm.Template(id)
+	if errors.Is(err, wallet.ErrTemplateNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load template", err) != nil {
+		return
+	}
+	jc.Encode(t)
+}
+
+func (s *server) walletTemplatesIDHandlerPOST(jc jape.Context) {
+	var id wallet.TemplateID
+	var req TemplateRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	t := req.template()
+	t.ID = id
+	if err := t.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	t, err := s.wm.UpdateTemplate(t)
+	if errors.Is(err, wallet.ErrTemplateNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't update template", err) != nil {
+		return
+	}
+	jc.Encode(t)
+}
+
+func (s *server) walletTemplatesIDHandlerDELETE(jc jape.Context) {
+	var id wallet.TemplateID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.wm.DeleteTemplate(id)
+	if errors.Is(err, wallet.ErrTemplateNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't delete template", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
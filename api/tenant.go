@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// tenantPaths are the path prefixes that tenant credentials can access.
+// Routes outside of these prefixes manage the node itself and are only
+// available to unrestricted credentials.
+var tenantPaths = []string{
+	"/state",
+	"/consensus/",
+	"/txpool/",
+	"/wallets",
+	"/addresses/",
+	"/events/",
+	"/webhooks",
+	"/payment-uris",
+}
+
+type tenantKey struct{}
+
+// WithTenants assigns signing keys to tenants, keyed by tenant name. Requests
+// signed with a tenant's key can only access the tenant's wallets, addresses,
+// events, and webhooks. Keys that are not assigned to a tenant are
+// unrestricted.
+func WithTenants(tenants map[string][]string) ServerOption {
+	return func(s *server) {
+		s.keyTenants = make(map[string]string)
+		for tenant, keys := range tenants {
+			for _, key := range keys {
+				s.keyTenants[key] = tenant
+			}
+		}
+	}
+}
+
+// principalTenant returns the tenant of the principal, if any.
+func (s *server) principalTenant(principal string) (string, bool) {
+	keyID, ok := strings.CutPrefix(principal, signingKeyPrincipal(""))
+	if !ok {
+		return "", false
+	}
+	tenant, ok := s.keyTenants[keyID]
+	return tenant, ok
+}
+
+// withTenant returns a copy of the request with the tenant attached to its
+// context.
+func withTenant(r *http.Request, tenant string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenant))
+}
+
+// tenantFromRequest returns the tenant that made the request. Requests from
+// unrestricted credentials return false.
+func tenantFromRequest(r *http.Request) (string, bool) {
+	tenant, ok := r.Context().Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// visibleWalletIDs returns the wallets in ids that the request can access.
+// Requests from unrestricted credentials can access every wallet.
+func (s *server) visibleWalletIDs(r *http.Request, ids []wallet.ID) ([]wallet.ID, error) {
+	tenant, ok := tenantFromRequest(r)
+	if !ok {
+		return ids, nil
+	}
+	var visible []wallet.ID
+	for _, id := range ids {
+		owner, err := s.wm.WalletTenant(id)
+		if errors.Is(err, wallet.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else if owner == tenant {
+			visible = append(visible, id)
+		}
+	}
+	return visible, nil
+}
+
+// visibleAddAddressResult filters the other wallets of an AddAddressResult to
+// those the request can access. An address that is only in wallets the
+// request cannot access is reported as added, so that the result does not
+// reveal other tenants' addresses.
+func (s *server) visibleAddAddressResult(r *http.Request, result wallet.AddAddressResult) (wallet.AddAddressResult, error) {
+	walletIDs, err := s.visibleWalletIDs(r, result.WalletIDs)
+	if err != nil {
+		return wallet.AddAddressResult{}, err
+	}
+	result.WalletIDs = walletIDs
+	if result.Status == wallet.AddressConflict && len(walletIDs) == 0 {
+		result.Status = wallet.AddressAdded
+	}
+	return result, nil
+}
+
+// checkTenant checks that the tenant can access the requested route and the
+// wallet, address, event, or webhook it refers to. Resources owned by other
+// tenants are reported as not found. It returns false if the request was
+// rejected.
+func (s *server) checkTenant(jc jape.Context, tenant string) bool {
+	path := jc.Request.URL.Path
+	var allowed bool
+	for _, prefix := range tenantPaths {
+		if strings.HasPrefix(path, prefix) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		jc.Error(errors.New("route is not available to tenants"), http.StatusForbidden)
+		return false
+	}
+
+	switch {
+	case path == "/wallets/import":
+		// imported wallets are owned by the tenant
+	case strings.HasPrefix(path, "/wallets/"):
+		var id wallet.ID
+		if jc.DecodeParam("id", &id) != nil {
+			return false
+		}
+		owner, err := s.wm.WalletTenant(id)
+		if errors.Is(err, wallet.ErrNotFound) || (err == nil && owner != tenant) {
+			jc.Error(wallet.ErrNotFound, http.StatusNotFound)
+			return false
+		} else if jc.Check("couldn't check wallet tenant", err) != nil {
+			return false
+		}
+	case strings.HasPrefix(path, "/addresses/"):
+		var addr types.Address
+		if jc.DecodeParam("addr", &addr) != nil {
+			return false
+		}
+		ok, err := s.wm.TenantHasAddress(tenant, addr)
+		if jc.Check("couldn't check address tenant", err) != nil {
+			return false
+		} else if !ok {
+			jc.Error(errors.New("address not found"), http.StatusNotFound)
+			return false
+		}
+	case strings.HasPrefix(path, "/events/"):
+		var id types.Hash256
+		if jc.DecodeParam("id", &id) != nil {
+			return false
+		}
+		ok, err := s.wm.TenantHasEvent(tenant, id)
+		if jc.Check("couldn't check event tenant", err) != nil {
+			return false
+		} else if !ok {
+			jc.Error(errors.New("event not found"), http.StatusNotFound)
+			return false
+		}
+	case strings.HasPrefix(path, "/webhooks/") && s.whm != nil:
+		var id int64
+		if jc.DecodeParam("id", &id) != nil {
+			return false
+		}
+		for _, hook := range s.whm.Webhooks() {
+			if hook.ID == id && hook.Tenant == tenant {
+				return true
+			}
+		}
+		jc.Error(errors.New("webhook not found"), http.StatusNotFound)
+		return false
+	}
+	return true
+}
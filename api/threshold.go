@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/threshold"
+)
+
+// checkThresholdError writes an error response for a threshold signing error
+// and returns it.
+func checkThresholdError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, threshold.ErrGroupNotFound), errors.Is(err, threshold.ErrSessionNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, threshold.ErrParticipantExists), errors.Is(err, threshold.ErrDuplicateSubmission), errors.Is(err, threshold.ErrWrongStatus):
+		jc.Error(err, http.StatusConflict)
+	case errors.Is(err, threshold.ErrUnknownParticipant), errors.Is(err, threshold.ErrInvalid):
+		jc.Error(err, http.StatusBadRequest)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) thresholdGroupsHandlerGET(jc jape.Context) {
+	groups, err := s.thm.Groups()
+	if jc.Check("couldn't get groups", err) != nil {
+		return
+	}
+	jc.Encode(groups)
+}
+
+func (s *server) thresholdGroupsHandlerPOST(jc jape.Context) {
+	var req ThresholdGroupRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	g, err := s.thm.AddGroup(req.Name, req.PublicKey, req.Threshold, req.MaxParticipants)
+	if checkThresholdError(jc, "couldn't add group", err) != nil {
+		return
+	}
+	jc.Encode(g)
+}
+
+func (s *server) thresholdGroupsIDHandlerGET(jc jape.Context) {
+	var id threshold.GroupID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	g, err := s.thm.Group(id)
+	if checkThresholdError(jc, "couldn't get group", err) != nil {
+		return
+	}
+	jc.Encode(g)
+}
+
+func (s *server) thresholdGroupsIDHandlerDELETE(jc jape.Context) {
+	var id threshold.GroupID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.thm.RemoveGroup(id)
+	if checkThresholdError(jc, "couldn't remove group", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) thresholdGroupsIDParticipantsHandlerPOST(jc jape.Context) {
+	var id threshold.GroupID
+	var req ThresholdParticipantRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	g, err := s.thm.RegisterParticipant(id, req.ID, req.Name)
+	if checkThresholdError(jc, "couldn't register participant", err) != nil {
+		return
+	}
+	jc.Encode(g)
+}
+
+func (s *server) thresholdSessionsHandlerGET(jc jape.Context) {
+	jc.Encode(s.thm.Sessions())
+}
+
+func (s *server) thresholdSessionsHandlerPOST(jc jape.Context) {
+	var req ThresholdSessionRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	session, err := s.thm.StartSession(req.GroupID, req.Transaction)
+	if checkThresholdError(jc, "couldn't start session", err) != nil {
+		return
+	}
+	jc.Encode(session)
+}
+
+func (s *server) thresholdSessionsIDHandlerGET(jc jape.Context) {
+	var id types.Hash256
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	session, err := s.thm.Session(id)
+	if checkThresholdError(jc, "couldn't get session", err) != nil {
+		return
+	}
+	jc.Encode(session)
+}
+
+func (s *server) thresholdSessionsIDCommitmentsHandlerPOST(jc jape.Context) {
+	var id types.Hash256
+	var c threshold.Commitment
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&c) != nil {
+		return
+	}
+	session, err := s.thm.AddCommitment(id, c)
+	if checkThresholdError(jc, "couldn't add commitment", err) != nil {
+		return
+	}
+	jc.Encode(session)
+}
+
+func (s *server) thresholdSessionsIDSharesHandlerPOST(jc jape.Context) {
+	var id types.Hash256
+	var share threshold.Share
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&share) != nil {
+		return
+	}
+	session, err := s.thm.AddShare(id, share)
+	if checkThresholdError(jc, "couldn't add share", err) != nil {
+		return
+	}
+	jc.Encode(session)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/totp"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// HeaderTOTP is the request header containing a TOTP code. It is required by
+// sensitive endpoints of wallets that have enabled TOTP.
+const HeaderTOTP = "X-Walletd-TOTP"
+
+// checkTOTPError writes an error response for a TOTP error. It returns err.
+func checkTOTPError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, totp.ErrNotEnrolled):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, totp.ErrEnabled):
+		jc.Error(err, http.StatusConflict)
+	case errors.Is(err, totp.ErrCodeRequired), errors.Is(err, totp.ErrInvalidCode), errors.Is(err, totp.ErrCodeUsed):
+		jc.Error(err, http.StatusForbidden)
+	default:
+		jc.Check(msg, err)
+	}
+	return err
+}
+
+// requireTOTP wraps a handler of a wallet endpoint so that it requires a
+// valid code in the TOTP header if the wallet has enabled TOTP.
+func (s *server) requireTOTP(h jape.Handler) jape.Handler {
+	return func(jc jape.Context) {
+		if s.totp == nil {
+			h(jc)
+			return
+		}
+		var id wallet.ID
+		if jc.DecodeParam("id", &id) != nil {
+			return
+		}
+		err := s.totp.Verify(id, jc.Request.Header.Get(HeaderTOTP))
+		if checkTOTPError(jc, "couldn't verify TOTP code", err) != nil {
+			return
+		}
+		h(jc)
+	}
+}
+
+func (s *server) walletsTOTPHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	status, err := s.totp.Status(id)
+	if checkTOTPError(jc, "couldn't get TOTP status", err) != nil {
+		return
+	}
+	jc.Encode(status)
+}
+
+func (s *server) walletsTOTPHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("TOTP can only be enrolled with the API password"), http.StatusForbidden)
+		return
+	}
+	enrollment, err := s.totp.Enroll(id)
+	if checkTOTPError(jc, "couldn't enroll TOTP", err) != nil {
+		return
+	}
+	jc.Encode(enrollment)
+}
+
+func (s *server) walletsTOTPConfirmHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req TOTPConfirmRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("TOTP can only be enabled with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.totp.Confirm(id, req.Code)
+	if checkTOTPError(jc, "couldn't enable TOTP", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsTOTPHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("TOTP can only be disabled with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.totp.Disable(id, jc.Request.Header.Get(HeaderTOTP))
+	if checkTOTPError(jc, "couldn't disable TOTP", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/transfers"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkTransferError writes an error response for a transfer error and
+// returns it.
+func checkTransferError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, wallet.ErrNotFound), errors.Is(err, transfers.ErrNotFound):
+		jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, transfers.ErrSameWallet), errors.Is(err, transfers.ErrZeroValue), errors.Is(err, transfers.ErrInvalidMethod),
+		errors.Is(err, transfers.ErrDifferentOperators), errors.Is(err, transfers.ErrNoAddress), errors.Is(err, transfers.ErrInsufficientBalance):
+		jc.Error(err, http.StatusBadRequest)
+	case errors.Is(err, treasury.ErrLimitExceeded), errors.Is(err, treasury.ErrApprovalRequired):
+		jc.Error(err, http.StatusForbidden)
+	default:
+		return jc.Check(msg, err)
+	}
+	return err
+}
+
+func (s *server) transfersHandlerPOST(jc jape.Context) {
+	var req TransferRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	// the transfer spends from the source wallet, so it requires the
+	// source wallet's TOTP code
+	if s.totp != nil {
+		err := s.totp.Verify(req.From, jc.Request.Header.Get(HeaderTOTP))
+		if checkTOTPError(jc, "couldn't verify TOTP code", err) != nil {
+			return
+		}
+	}
+	t, err := s.tfm.Send(req.From, req.To, req.Value, req.Method, req.Memo)
+	if checkTransferError(jc, "couldn't transfer funds", err) != nil {
+		return
+	}
+	jc.Encode(t)
+}
+
+func (s *server) transfersIDHandlerGET(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	t, err := s.tfm.Transfer(id)
+	if checkTransferError(jc, "couldn't get transfer", err) != nil {
+		return
+	}
+	jc.Encode(t)
+}
+
+func (s *server) walletsTransfersHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	offset, limit := 0, 100
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	entries, err := s.tfm.Entries(id, offset, limit)
+	if checkTransferError(jc, "couldn't get transfers", err) != nil {
+		return
+	}
+	jc.Encode(entries)
+}
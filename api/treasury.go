@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func (s *server) walletsPolicyHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	policy, err := s.tm.WalletPolicy(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load policy", err) != nil {
+		return
+	}
+	jc.Encode(policy)
+}
+
+func (s *server) walletsPolicyHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var policy treasury.Policy
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&policy) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("policies can only be changed with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.tm.SetWalletPolicy(id, policy)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't set policy", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsLimitsHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	ls, err := s.tm.LimitStatus(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load spending limits", err) != nil {
+		return
+	}
+	jc.Encode(ls)
+}
+
+func (s *server) walletsLimitsOverrideHandlerPOST(jc jape.Context) {
+	var id wallet.ID
+	var req LimitOverrideRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	principal := principalFromRequest(jc.Request)
+	if !isAdmin(principal) {
+		jc.Error(errors.New("spending limits can only be overridden with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.tm.OverrideLimits(id, req.Expiration, principal)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsAllowlistHandlerGET(jc jape.Context) {
+	var id wallet.ID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	entries, err := s.tm.Allowlist(id)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load allowlist", err) != nil {
+		return
+	}
+	jc.Encode(entries)
+}
+
+func (s *server) walletsAllowlistHandlerPUT(jc jape.Context) {
+	var id wallet.ID
+	var req AllowlistRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("allowlists can only be changed with the API password"), http.StatusForbidden)
+		return
+	}
+	_, err := s.tm.AddAllowlistEntry(id, req.Address, req.Description)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't add allowlist entry", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) walletsAllowlistHandlerDELETE(jc jape.Context) {
+	var id wallet.ID
+	var addr types.Address
+	if jc.DecodeParam("id", &id) != nil || jc.DecodeParam("addr", &addr) != nil {
+		return
+	} else if !isAdmin(principalFromRequest(jc.Request)) {
+		jc.Error(errors.New("allowlists can only be changed with the API password"), http.StatusForbidden)
+		return
+	}
+	err := s.tm.RemoveAllowlistEntry(id, addr)
+	if errors.Is(err, wallet.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove allowlist entry", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
+
+func (s *server) approvalsHandlerGET(jc jape.Context) {
+	var status string
+	offset, limit := 0, 100
+	if jc.DecodeForm("status", &status) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	switch status {
+	case "", treasury.StatusPending, treasury.StatusApproved, treasury.StatusRejected:
+	default:
+		jc.Error(errors.New("invalid status"), http.StatusBadRequest)
+		return
+	}
+	pts, err := s.tm.PendingTransactions(status, offset, limit)
+	if jc.Check("couldn't load pending transactions", err) != nil {
+		return
+	}
+	jc.Encode(pts)
+}
+
+func (s *server) approvalsIDHandlerGET(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	pt, err := s.tm.PendingTransaction(id)
+	if errors.Is(err, treasury.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't load pending transaction", err) != nil {
+		return
+	}
+	jc.Encode(pt)
+}
+
+// checkApprovalError writes the appropriate error response for an error
+// returned when approving or rejecting a pending transaction.
+func checkApprovalError(jc jape.Context, msg string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, treasury.ErrNotFound):
+		return jc.Error(err, http.StatusNotFound)
+	case errors.Is(err, treasury.ErrNotPending):
+		return jc.Error(err, http.StatusConflict)
+	case errors.Is(err, treasury.ErrSameCredential):
+		return jc.Error(err, http.StatusForbidden)
+	default:
+		return jc.Check(msg, err)
+	}
+}
+
+func (s *server) approvalsApproveHandlerPOST(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	pt, err := s.tm.Approve(id, principalFromRequest(jc.Request), func(pt treasury.PendingTransaction) error {
+		return s.broadcastTransactionSet(pt.Transactions, pt.V2Transactions)
+	})
+	if errors.Is(err, treasury.ErrLimitExceeded) || errors.Is(err, treasury.ErrDestinationNotAllowed) {
+		jc.Error(err, http.StatusForbidden)
+		return
+	} else if checkApprovalError(jc, "couldn't approve transaction", err) != nil {
+		return
+	}
+	jc.Encode(pt)
+}
+
+func (s *server) approvalsRejectHandlerPOST(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	pt, err := s.tm.Reject(id, principalFromRequest(jc.Request))
+	if checkApprovalError(jc, "couldn't reject transaction", err) != nil {
+		return
+	}
+	jc.Encode(pt)
+}
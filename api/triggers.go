@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/triggers"
+)
+
+func (s *server) triggersHandlerGET(jc jape.Context) {
+	ts, err := s.trm.Triggers()
+	if jc.Check("couldn't get triggers", err) != nil {
+		return
+	}
+	jc.Encode(ts)
+}
+
+func (s *server) triggersHandlerPOST(jc jape.Context) {
+	var req TriggerRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	t, err := s.trm.AddTrigger(req.Name, req.Height, req.Interval)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.Encode(t)
+}
+
+func (s *server) triggersIDHandlerDELETE(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.trm.RemoveTrigger(id)
+	if errors.Is(err, triggers.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove trigger", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
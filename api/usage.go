@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/usage"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// checkUsage counts the request against the principal's tenant. It returns
+// false if the request was rejected because the tenant exceeded its daily
+// call quota.
+func (s *server) checkUsage(jc jape.Context, principal string) bool {
+	if s.um == nil {
+		return true
+	}
+	tenant, _ := tenantFromRequest(jc.Request)
+	err := s.um.RecordCall(tenant, principal)
+	if errors.Is(err, usage.ErrQuotaExceeded) {
+		jc.Error(err, http.StatusTooManyRequests)
+		return false
+	} else if jc.Check("couldn't record API call", err) != nil {
+		return false
+	}
+	return true
+}
+
+// tenantUsage returns the number of wallets and addresses owned by a tenant.
+func (s *server) tenantUsage(tenant string) (wallet.TenantUsage, error) {
+	owned, err := s.wm.TenantUsage()
+	if err != nil {
+		return wallet.TenantUsage{}, err
+	}
+	for _, tu := range owned {
+		if tu.Tenant == tenant {
+			return tu, nil
+		}
+	}
+	return wallet.TenantUsage{Tenant: tenant}, nil
+}
+
+// checkWalletQuota returns false if the request was rejected because the
+// tenant already owns its quota of wallets.
+func (s *server) checkWalletQuota(jc jape.Context, tenant string) bool {
+	if s.um == nil || tenant == "" {
+		return true
+	}
+	quota := s.um.Quota(tenant)
+	if quota.Wallets <= 0 {
+		return true
+	}
+	tu, err := s.tenantUsage(tenant)
+	if jc.Check("couldn't get tenant usage", err) != nil {
+		return false
+	} else if tu.Wallets >= quota.Wallets {
+		jc.Error(fmt.Errorf("%w: %d wallets", usage.ErrQuotaExceeded, quota.Wallets), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// checkAddressQuota returns false if the request was rejected because adding
+// the address would exceed the tenant's address quota. Updating an address
+// already in the wallet is always allowed.
+func (s *server) checkAddressQuota(jc jape.Context, id wallet.ID, addr types.Address) bool {
+	tenant, ok := tenantFromRequest(jc.Request)
+	if s.um == nil || !ok {
+		return true
+	}
+	quota := s.um.Quota(tenant)
+	if quota.Addresses <= 0 {
+		return true
+	}
+	tu, err := s.tenantUsage(tenant)
+	if jc.Check("couldn't get tenant usage", err) != nil {
+		return false
+	} else if tu.Addresses < quota.Addresses {
+		return true
+	}
+
+	addrs, err := s.wm.Addresses(id)
+	if jc.Check("couldn't load addresses", err) != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if a.Address == addr {
+			return true
+		}
+	}
+	jc.Error(fmt.Errorf("%w: %d addresses", usage.ErrQuotaExceeded, quota.Addresses), http.StatusForbidden)
+	return false
+}
+
+func (s *server) systemUsageHandlerGET(jc jape.Context) {
+	// default to the start of the current billing month
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if jc.DecodeForm("since", &since) != nil {
+		return
+	}
+
+	calls, err := s.um.Usage(since)
+	if jc.Check("couldn't get API usage", err) != nil {
+		return
+	}
+	owned, err := s.wm.TenantUsage()
+	if jc.Check("couldn't get tenant usage", err) != nil {
+		return
+	}
+
+	// include every configured tenant, even those that have not created
+	// any wallets yet
+	tenants := make(map[string]*TenantUsage)
+	var order []string
+	addTenant := func(tenant string) *TenantUsage {
+		if tu, ok := tenants[tenant]; ok {
+			return tu
+		}
+		tenants[tenant] = &TenantUsage{Tenant: tenant, Quota: s.um.Quota(tenant)}
+		order = append(order, tenant)
+		return tenants[tenant]
+	}
+	for _, tu := range owned {
+		t := addTenant(tu.Tenant)
+		t.Wallets, t.Addresses = tu.Wallets, tu.Addresses
+	}
+	for _, tenant := range s.keyTenants {
+		addTenant(tenant)
+	}
+	for _, r := range calls {
+		if r.Tenant != "" {
+			addTenant(r.Tenant).Calls += r.Calls
+		}
+	}
+
+	resp := UsageResponse{
+		Since:   since,
+		Tenants: make([]TenantUsage, 0, len(order)),
+		Calls:   calls,
+	}
+	sort.Strings(order)
+	for _, tenant := range order {
+		resp.Tenants = append(resp.Tenants, *tenants[tenant])
+	}
+	jc.Encode(resp)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Versions of the API. Unversioned routes serve APIVersion1 and are
+// deprecated. Routes prefixed with /v2 serve APIVersion2.
+//
+// APIVersion2 differs from APIVersion1 only in its error responses, which are
+// JSON-encoded ErrorResponses instead of plain text. Future breaking changes
+// to response bodies are only made to versioned routes.
+const (
+	APIVersion1 = 1
+	APIVersion2 = 2
+)
+
+// HeaderAPIVersion is the response header containing the version of the API
+// that served the request.
+const HeaderAPIVersion = "API-Version"
+
+// v2Prefix is the path prefix of APIVersion2 routes.
+const v2Prefix = "/v2"
+
+type (
+	// An ErrorResponse is the body of an error response from an
+	// APIVersion2 route.
+	ErrorResponse struct {
+		Error APIError `json:"error"`
+	}
+
+	// An APIError describes a failed request.
+	APIError struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	}
+)
+
+type apiVersionKey struct{}
+
+// WithLegacySunset sets the date after which unversioned routes may be
+// removed. It is sent in the Sunset header of their responses.
+func WithLegacySunset(t time.Time) ServerOption {
+	return func(s *server) {
+		s.legacySunset = t
+	}
+}
+
+// requestAPIVersion returns the version of the API requested by r.
+func requestAPIVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return APIVersion1
+}
+
+// A structuredErrorWriter buffers plain-text error responses so they can be
+// rewritten as an ErrorResponse. Other responses are written unchanged.
+type structuredErrorWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int // the status of a buffered error
+	buf         bytes.Buffer
+}
+
+func (w *structuredErrorWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if ct, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type")); status >= 400 && (ct == "" || ct == "text/plain") {
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *structuredErrorWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.status != 0 {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// flush writes the buffered error, if any, as an ErrorResponse.
+func (w *structuredErrorWriter) flush() {
+	if w.status == 0 {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	json.NewEncoder(w.ResponseWriter).Encode(ErrorResponse{
+		Error: APIError{Status: w.status, Message: strings.TrimSpace(w.buf.String())},
+	})
+}
+
+// structuredErrors wraps a handler so that plain-text errors returned to
+// APIVersion2 requests are rewritten as ErrorResponses. Handlers continue to
+// return plain-text errors, which APIVersion1 requests receive unchanged.
+func structuredErrors(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestAPIVersion(r) < APIVersion2 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		sw := &structuredErrorWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		sw.flush()
+	})
+}
+
+// versionRoutes wraps a handler so that it serves APIVersion2 under /v2 and
+// APIVersion1 on unversioned routes. The prefix is removed before the request
+// is handled, and the version is available from requestAPIVersion. Responses
+// to unversioned routes include deprecation headers linking to their
+// APIVersion2 successor.
+func versionRoutes(h http.Handler, sunset time.Time) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == v2Prefix || strings.HasPrefix(r.URL.Path, v2Prefix+"/") {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, v2Prefix)
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			r.URL.RawPath = ""
+			r = r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, APIVersion2))
+			w.Header().Set(HeaderAPIVersion, strconv.Itoa(APIVersion2))
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		// the API may be mounted under a prefix, e.g. /api, which is
+		// recovered from the original request URI to build the link
+		prefix := r.RequestURI
+		if i := strings.IndexByte(prefix, '?'); i >= 0 {
+			prefix = prefix[:i]
+		}
+		path := r.URL.EscapedPath()
+		prefix = strings.TrimSuffix(prefix, path)
+		w.Header().Set(HeaderAPIVersion, strconv.Itoa(APIVersion1))
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+prefix+v2Prefix+path+`>; rel="successor-version"`)
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
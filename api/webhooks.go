@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"go.sia.tech/jape"
+	"go.thebigfile.com/walletd/webhooks"
+)
+
+func (s *server) webhooksHandlerGET(jc jape.Context) {
+	hooks := s.whm.Webhooks()
+	if tenant, ok := tenantFromRequest(jc.Request); ok {
+		owned := make([]webhooks.Webhook, 0, len(hooks))
+		for _, hook := range hooks {
+			if hook.Tenant == tenant {
+				owned = append(owned, hook)
+			}
+		}
+		hooks = owned
+	}
+	jc.Encode(hooks)
+}
+
+func (s *server) webhooksHandlerPOST(jc jape.Context) {
+	var req WebhookRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	tenant, _ := tenantFromRequest(jc.Request)
+	hook, err := s.whm.AddTenantWebhook(tenant, req.CallbackURL, req.Scopes)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jc.Encode(hook)
+}
+
+func (s *server) webhooksIDHandlerDELETE(jc jape.Context) {
+	var id int64
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := s.whm.RemoveWebhook(id)
+	if errors.Is(err, webhooks.ErrNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't remove webhook", err) != nil {
+		return
+	}
+	jc.EmptyResonse()
+}
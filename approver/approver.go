@@ -0,0 +1,452 @@
+// Package approver pairs mobile approver apps with walletd and relays the
+// transactions waiting in the treasury approval queue to them, so
+// withdrawals can be approved or rejected from a second device.
+//
+// Apps connect with a WebSocket. Pairing exchanges X25519 keys, and every
+// message after the handshake is encrypted with the derived key, so the
+// connection can be carried over an untrusted relay or proxy without
+// exposing approval requests or allowing decisions to be forged.
+package approver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/internal/websocket"
+	"go.thebigfile.com/walletd/treasury"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/curve25519"
+	"lukechampine.com/frand"
+)
+
+// Message types.
+const (
+	// sent by apps before the connection is encrypted
+	MessagePair  = "pair"
+	MessageHello = "hello"
+
+	// sent by walletd
+	MessageChallenge = "challenge"
+	MessageReady     = "ready"
+	MessageRequest   = "request"
+	MessageResolved  = "resolved"
+	MessageResult    = "result"
+
+	// sent by apps
+	MessageAuth    = "auth"
+	MessageApprove = "approve"
+	MessageReject  = "reject"
+)
+
+// maxPendingRequests is the maximum number of pending transactions sent to
+// an app.
+const maxPendingRequests = 1000
+
+var (
+	// ErrNotFound is returned when an approver or pairing is not found.
+	ErrNotFound = errors.New("approver not found")
+	// ErrPairingExpired is returned when an app completes a pairing after
+	// it has expired.
+	ErrPairingExpired = errors.New("pairing expired")
+)
+
+type (
+	// An Approver is a paired approver app.
+	Approver struct {
+		ID          int64     `json:"id"`
+		Name        string    `json:"name"`
+		DateCreated time.Time `json:"dateCreated"`
+		// Connected is true if the app is currently connected.
+		Connected bool `json:"connected"`
+
+		// Key is the key shared with the app. It encrypts every message
+		// after the handshake.
+		Key [32]byte `json:"-"`
+	}
+
+	// A Pairing is an invitation for an app to pair with walletd. It is
+	// typically displayed as a QR code and can be used once.
+	Pairing struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+		// Code authenticates the app completing the pairing. It must not
+		// be sent over the connection.
+		Code string `json:"code"`
+		// PublicKey is walletd's X25519 public key for the pairing.
+		PublicKey  string    `json:"publicKey"`
+		Expiration time.Time `json:"expiration"`
+	}
+
+	// A Message is exchanged between walletd and an app. Only the fields
+	// relevant to the message's type are set.
+	Message struct {
+		Type string `json:"type"`
+
+		// pair
+		Pairing   string `json:"pairing,omitempty"`
+		PublicKey string `json:"publicKey,omitempty"`
+		Proof     string `json:"proof,omitempty"`
+		// hello and ready
+		Approver int64 `json:"approver,omitempty"`
+		// challenge and auth
+		Challenge string `json:"challenge,omitempty"`
+
+		// Request identifies an approval request for the lifetime of
+		// the connection.
+		Request     string                       `json:"request,omitempty"`
+		Transaction *treasury.PendingTransaction `json:"transaction,omitempty"`
+		Error       string                       `json:"error,omitempty"`
+	}
+
+	// A Store persists paired approvers.
+	Store interface {
+		AddApprover(Approver) (Approver, error)
+		Approver(id int64) (Approver, error)
+		Approvers() ([]Approver, error)
+		RemoveApprover(id int64) error
+	}
+
+	// A TreasuryManager manages the approval queue.
+	TreasuryManager interface {
+		PendingTransactions(status string, offset, limit int) ([]treasury.PendingTransaction, error)
+		Approve(id int64, approvedBy string, broadcast func(treasury.PendingTransaction) error) (treasury.PendingTransaction, error)
+		Reject(id int64, rejectedBy string) (treasury.PendingTransaction, error)
+	}
+
+	// A ChainManager manages the transaction pool.
+	ChainManager interface {
+		TipState() consensus.State
+		AddPoolTransactions([]types.Transaction) (bool, error)
+		AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error)
+	}
+
+	// A Syncer broadcasts transactions to peers.
+	Syncer interface {
+		BroadcastTransactionSet([]types.Transaction)
+		BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction)
+	}
+
+	// A Manager pairs approver apps and serves their connections.
+	Manager struct {
+		store Store
+		tm    TreasuryManager
+		cm    ChainManager
+		s     Syncer
+		log   *zap.Logger
+		tg    *threadgroup.ThreadGroup
+
+		pairingTTL   time.Duration
+		pollInterval time.Duration
+		pingInterval time.Duration
+
+		mu       sync.Mutex // protects the fields below
+		pairings map[string]pairing
+		conns    map[int64]*conn
+	}
+
+	pairing struct {
+		Pairing
+		sk [32]byte
+	}
+)
+
+// Principal returns the principal recorded as the decider of transactions
+// approved or rejected by an approver.
+func Principal(id int64) string {
+	return "approver:" + strconv.FormatInt(id, 10)
+}
+
+// PairingProof returns the proof an app sends to complete a pairing. It binds
+// the app's public key to the pairing code.
+func PairingProof(code []byte, pairingID string, publicKey [32]byte) []byte {
+	h := hmac.New(sha256.New, code)
+	h.Write([]byte(pairingID))
+	h.Write(publicKey[:])
+	return h.Sum(nil)
+}
+
+// CreatePairing creates a pairing for a new approver.
+func (m *Manager) CreatePairing(name string) (Pairing, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Pairing{}, errors.New("name is required")
+	}
+
+	var p pairing
+	frand.Read(p.sk[:])
+	pk, err := curve25519.X25519(p.sk[:], curve25519.Basepoint)
+	if err != nil {
+		return Pairing{}, fmt.Errorf("failed to derive public key: %w", err)
+	}
+	p.Pairing = Pairing{
+		ID:         hex.EncodeToString(frand.Bytes(8)),
+		Name:       name,
+		Code:       hex.EncodeToString(frand.Bytes(16)),
+		PublicKey:  hex.EncodeToString(pk),
+		Expiration: time.Now().Add(m.pairingTTL).Truncate(time.Second),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, p := range m.pairings {
+		if time.Now().After(p.Expiration) {
+			delete(m.pairings, id)
+		}
+	}
+	m.pairings[p.ID] = p
+	return p.Pairing, nil
+}
+
+// Approvers returns all paired approvers.
+func (m *Manager) Approvers() ([]Approver, error) {
+	approvers, err := m.store.Approvers()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range approvers {
+		_, approvers[i].Connected = m.conns[approvers[i].ID]
+	}
+	return approvers, nil
+}
+
+// RemoveApprover unpairs an approver and closes its connection.
+func (m *Manager) RemoveApprover(id int64) error {
+	if err := m.store.RemoveApprover(id); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	c := m.conns[id]
+	m.mu.Unlock()
+	if c != nil {
+		c.ws.Close()
+	}
+	m.log.Info("approver removed", zap.Int64("approver", id))
+	return nil
+}
+
+// completePairing consumes a pairing and adds the approver it creates.
+func (m *Manager) completePairing(msg Message) (Approver, error) {
+	m.mu.Lock()
+	p, ok := m.pairings[msg.Pairing]
+	delete(m.pairings, msg.Pairing)
+	m.mu.Unlock()
+	if !ok {
+		return Approver{}, ErrNotFound
+	} else if time.Now().After(p.Expiration) {
+		return Approver{}, ErrPairingExpired
+	}
+
+	var pk [32]byte
+	if n, err := hex.Decode(pk[:], []byte(msg.PublicKey)); err != nil || n != len(pk) {
+		return Approver{}, errors.New("invalid public key")
+	}
+	code, _ := hex.DecodeString(p.Code)
+	proof, err := hex.DecodeString(msg.Proof)
+	if err != nil || !hmac.Equal(proof, PairingProof(code, p.ID, pk)) {
+		return Approver{}, errors.New("invalid pairing proof")
+	}
+	key, err := DeriveKey(p.sk, pk, p.ID)
+	if err != nil {
+		return Approver{}, fmt.Errorf("failed to derive shared key: %w", err)
+	}
+
+	a, err := m.store.AddApprover(Approver{
+		Name:        p.Name,
+		Key:         key,
+		DateCreated: time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		return Approver{}, fmt.Errorf("failed to add approver: %w", err)
+	}
+	m.log.Info("approver paired", zap.Int64("approver", a.ID), zap.String("name", a.Name))
+	return a, nil
+}
+
+// broadcast adds an approved transaction set to the pool and broadcasts it.
+func (m *Manager) broadcast(pt treasury.PendingTransaction) error {
+	if len(pt.Transactions) != 0 {
+		if _, err := m.cm.AddPoolTransactions(pt.Transactions); err != nil {
+			return fmt.Errorf("invalid transaction set: %w", err)
+		}
+		m.s.BroadcastTransactionSet(pt.Transactions)
+	}
+	if len(pt.V2Transactions) != 0 {
+		index := m.cm.TipState().Index
+		if _, err := m.cm.AddV2PoolTransactions(index, pt.V2Transactions); err != nil {
+			return fmt.Errorf("invalid v2 transaction set: %w", err)
+		}
+		m.s.BroadcastV2TransactionSet(index, pt.V2Transactions)
+	}
+	return nil
+}
+
+// handshake reads the first message of a connection and authenticates the
+// app.
+func (m *Manager) handshake(ws *websocket.Conn) (*conn, error) {
+	ws.SetReadDeadline(time.Now().Add(30 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+
+	typ, buf, err := ws.ReadMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
+	} else if typ != websocket.TextMessage {
+		return nil, errors.New("expected text handshake")
+	}
+	var msg Message
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return nil, fmt.Errorf("failed to decode handshake: %w", err)
+	}
+
+	var a Approver
+	switch msg.Type {
+	case MessagePair:
+		a, err = m.completePairing(msg)
+	case MessageHello:
+		a, err = m.store.Approver(msg.Approver)
+	default:
+		err = fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// prove the app holds the shared key
+	c := &conn{m: m, ws: ws, approver: a, requests: make(map[string]int64), sent: make(map[int64]string)}
+	challenge := hex.EncodeToString(frand.Bytes(32))
+	if err := c.write(Message{Type: MessageChallenge, Challenge: challenge}); err != nil {
+		return nil, err
+	}
+	resp, err := c.read()
+	if err != nil {
+		return nil, err
+	} else if resp.Type != MessageAuth || resp.Challenge != challenge {
+		return nil, errors.New("invalid challenge response")
+	}
+	return c, nil
+}
+
+// ServeHTTP implements http.Handler. Apps connect to /connect.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/connect" {
+		http.NotFound(w, r)
+		return
+	}
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer cancel()
+
+	ws, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	log := m.log.With(zap.Stringer("remote", ws.RemoteAddr()))
+
+	c, err := m.handshake(ws)
+	if err != nil {
+		log.Debug("approver handshake failed", zap.Error(err))
+		return
+	}
+	log = log.With(zap.Int64("approver", c.approver.ID))
+
+	// a new connection replaces any existing connection for the approver
+	m.mu.Lock()
+	if prev := m.conns[c.approver.ID]; prev != nil {
+		prev.ws.Close()
+	}
+	m.conns[c.approver.ID] = c
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		if m.conns[c.approver.ID] == c {
+			delete(m.conns, c.approver.ID)
+		}
+		m.mu.Unlock()
+	}()
+
+	if err := c.write(Message{Type: MessageReady, Approver: c.approver.ID}); err != nil {
+		return
+	}
+	log.Debug("approver connected")
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		poll := time.NewTicker(m.pollInterval)
+		defer poll.Stop()
+		ping := time.NewTicker(m.pingInterval)
+		defer ping.Stop()
+		for {
+			if err := c.sync(); err != nil {
+				log.Debug("failed to send approval requests", zap.Error(err))
+				ws.Close()
+				return
+			}
+			select {
+			case <-ctx.Done():
+				ws.Close()
+				return
+			case <-done:
+				return
+			case <-ping.C:
+				if err := ws.Ping(); err != nil {
+					ws.Close()
+					return
+				}
+			case <-poll.C:
+			}
+		}
+	}()
+
+	if err := c.serve(); err != nil && !errors.Is(err, io.EOF) {
+		log.Debug("approver disconnected", zap.Error(err))
+	}
+}
+
+// Close closes all connections.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// NewManager returns a new Manager.
+func NewManager(store Store, tm TreasuryManager, cm ChainManager, s Syncer, opts ...Option) *Manager {
+	m := &Manager{
+		store: store,
+		tm:    tm,
+		cm:    cm,
+		s:     s,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		pairingTTL:   10 * time.Minute,
+		pollInterval: 2 * time.Second,
+		pingInterval: 30 * time.Second,
+
+		pairings: make(map[string]pairing),
+		conns:    make(map[int64]*conn),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
@@ -0,0 +1,313 @@
+package approver_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/approver"
+	"go.thebigfile.com/walletd/internal/websocket"
+	"go.thebigfile.com/walletd/treasury"
+	"golang.org/x/crypto/curve25519"
+	"lukechampine.com/frand"
+)
+
+type store struct {
+	mu        sync.Mutex
+	approvers []approver.Approver
+}
+
+func (s *store) AddApprover(a approver.Approver) (approver.Approver, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.ID = int64(len(s.approvers) + 1)
+	s.approvers = append(s.approvers, a)
+	return a, nil
+}
+
+func (s *store) Approver(id int64) (approver.Approver, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.approvers {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return approver.Approver{}, approver.ErrNotFound
+}
+
+func (s *store) Approvers() ([]approver.Approver, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]approver.Approver(nil), s.approvers...), nil
+}
+
+func (s *store) RemoveApprover(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, a := range s.approvers {
+		if a.ID == id {
+			s.approvers = append(s.approvers[:i], s.approvers[i+1:]...)
+			return nil
+		}
+	}
+	return approver.ErrNotFound
+}
+
+type treasuryManager struct {
+	mu      sync.Mutex
+	pending []treasury.PendingTransaction
+}
+
+func (tm *treasuryManager) PendingTransactions(status string, _, _ int) (pts []treasury.PendingTransaction, _ error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for _, pt := range tm.pending {
+		if pt.Status == status {
+			pts = append(pts, pt)
+		}
+	}
+	return pts, nil
+}
+
+func (tm *treasuryManager) decide(id int64, status, by string, broadcast func(treasury.PendingTransaction) error) (treasury.PendingTransaction, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	for i, pt := range tm.pending {
+		if pt.ID != id {
+			continue
+		} else if pt.Status != treasury.StatusPending {
+			return treasury.PendingTransaction{}, treasury.ErrNotPending
+		} else if broadcast != nil {
+			if err := broadcast(pt); err != nil {
+				return treasury.PendingTransaction{}, err
+			}
+		}
+		tm.pending[i].Status = status
+		tm.pending[i].DecidedBy = by
+		return tm.pending[i], nil
+	}
+	return treasury.PendingTransaction{}, treasury.ErrNotFound
+}
+
+func (tm *treasuryManager) Approve(id int64, approvedBy string, broadcast func(treasury.PendingTransaction) error) (treasury.PendingTransaction, error) {
+	return tm.decide(id, treasury.StatusApproved, approvedBy, broadcast)
+}
+
+func (tm *treasuryManager) Reject(id int64, rejectedBy string) (treasury.PendingTransaction, error) {
+	return tm.decide(id, treasury.StatusRejected, rejectedBy, nil)
+}
+
+type chainManager struct {
+	mu   sync.Mutex
+	txns []types.Transaction
+}
+
+func (cm *chainManager) TipState() consensus.State { return consensus.State{} }
+
+func (cm *chainManager) AddPoolTransactions(txns []types.Transaction) (bool, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.txns = append(cm.txns, txns...)
+	return false, nil
+}
+
+func (cm *chainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastTransactionSet([]types.Transaction)                       {}
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+// app is a minimal approver app.
+type app struct {
+	t   *testing.T
+	ws  *websocket.Conn
+	key [32]byte
+}
+
+func (a *app) write(msg approver.Message) {
+	a.t.Helper()
+	buf, err := approver.Seal(a.key, msg, true)
+	if err != nil {
+		a.t.Fatal(err)
+	} else if err := a.ws.WriteMessage(websocket.BinaryMessage, buf); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+func (a *app) read() approver.Message {
+	a.t.Helper()
+	a.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, buf, err := a.ws.ReadMessage()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	msg, err := approver.Open(a.key, buf, false)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return msg
+}
+
+// connect sends the handshake and answers the challenge.
+func (a *app) connect(url string, hello approver.Message) {
+	a.t.Helper()
+	ws, err := websocket.Dial(url)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.ws = ws
+	buf, _ := json.Marshal(hello)
+	if err := ws.WriteMessage(websocket.TextMessage, buf); err != nil {
+		a.t.Fatal(err)
+	}
+	challenge := a.read()
+	if challenge.Type != approver.MessageChallenge {
+		a.t.Fatalf("expected challenge, got %q", challenge.Type)
+	}
+	a.write(approver.Message{Type: approver.MessageAuth, Challenge: challenge.Challenge})
+	if ready := a.read(); ready.Type != approver.MessageReady {
+		a.t.Fatalf("expected ready, got %q", ready.Type)
+	}
+}
+
+func TestApprover(t *testing.T) {
+	tm := &treasuryManager{pending: []treasury.PendingTransaction{
+		{ID: 1, Status: treasury.StatusPending, SubmittedBy: "key:bot", Transactions: []types.Transaction{{ArbitraryData: [][]byte{{1}}}}},
+		{ID: 2, Status: treasury.StatusPending, SubmittedBy: "key:bot"},
+	}}
+	cm := &chainManager{}
+	s := &store{}
+	m := approver.NewManager(s, tm, cm, syncer{}, approver.WithPollInterval(10*time.Millisecond))
+	defer m.Close()
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	url := "ws://" + strings.TrimPrefix(srv.URL, "http://") + "/connect"
+
+	p, err := m.CreatePairing("phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sk, pk [32]byte
+	frand.Read(sk[:])
+	buf, _ := curve25519.X25519(sk[:], curve25519.Basepoint)
+	copy(pk[:], buf)
+	// pairMessage derives the shared key and returns the pair message, as
+	// the app would after scanning the pairing
+	a := &app{t: t}
+	pairMessage := func(p approver.Pairing, code []byte) approver.Message {
+		var serverKey [32]byte
+		hex.Decode(serverKey[:], []byte(p.PublicKey))
+		key, err := approver.DeriveKey(sk, serverKey, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.key = key
+		return approver.Message{Type: approver.MessagePair, Pairing: p.ID, PublicKey: hex.EncodeToString(pk[:]), Proof: hex.EncodeToString(approver.PairingProof(code, p.ID, pk))}
+	}
+
+	// a pairing with an invalid proof is rejected and consumed
+	ws, err := websocket.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ = json.Marshal(pairMessage(p, []byte("wrong")))
+	ws.WriteMessage(websocket.TextMessage, buf)
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+	ws.Close()
+
+	p, err = m.CreatePairing("phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := hex.DecodeString(p.Code)
+	pair := pairMessage(p, code)
+	a.connect(url, pair)
+
+	approvers, err := m.Approvers()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(approvers) != 1 || approvers[0].Name != "phone" || !approvers[0].Connected {
+		t.Fatalf("unexpected approvers %+v", approvers)
+	}
+	id := approvers[0].ID
+
+	// the app receives a request for each pending transaction
+	requests := make(map[int64]string)
+	for i := 0; i < 2; i++ {
+		msg := a.read()
+		if msg.Type != approver.MessageRequest || msg.Transaction == nil {
+			t.Fatalf("expected request, got %+v", msg)
+		}
+		requests[msg.Transaction.ID] = msg.Request
+	}
+
+	a.write(approver.Message{Type: approver.MessageApprove, Request: requests[1]})
+	if msg := a.read(); msg.Type != approver.MessageResult || msg.Error != "" || msg.Transaction.Status != treasury.StatusApproved || msg.Transaction.DecidedBy != approver.Principal(id) {
+		t.Fatalf("unexpected result %+v", msg)
+	} else if len(cm.txns) != 1 {
+		t.Fatal("expected approved transaction to be broadcast")
+	}
+	a.write(approver.Message{Type: approver.MessageApprove, Request: "unknown"})
+	if msg := a.read(); msg.Error == "" {
+		t.Fatal("expected unknown request to fail")
+	}
+
+	// a transaction decided elsewhere is resolved
+	tm.Reject(2, "password")
+	if msg := a.read(); msg.Type != approver.MessageResolved || msg.Request != requests[2] {
+		t.Fatalf("expected resolved, got %+v", msg)
+	}
+	a.ws.Close()
+
+	// the pairing cannot be reused
+	ws, err = websocket.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, _ = json.Marshal(pair)
+	ws.WriteMessage(websocket.TextMessage, buf)
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+	ws.Close()
+
+	// the app reconnects with its approver ID and receives new requests
+	tm.mu.Lock()
+	tm.pending = append(tm.pending, treasury.PendingTransaction{ID: 3, Status: treasury.StatusPending, SubmittedBy: "key:bot"})
+	tm.mu.Unlock()
+	a.connect(url, approver.Message{Type: approver.MessageHello, Approver: id})
+	msg := a.read()
+	if msg.Type != approver.MessageRequest || msg.Transaction.ID != 3 {
+		t.Fatalf("expected request for transaction 3, got %+v", msg)
+	}
+	a.write(approver.Message{Type: approver.MessageReject, Request: msg.Request})
+	if msg := a.read(); msg.Transaction == nil || msg.Transaction.Status != treasury.StatusRejected {
+		t.Fatalf("unexpected result %+v", msg)
+	}
+
+	// removing the approver closes its connection
+	if err := m.RemoveApprover(id); err != nil {
+		t.Fatal(err)
+	}
+	a.ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := a.ws.ReadMessage(); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+	if err := m.RemoveApprover(id); !errors.Is(err, approver.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package approver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"go.thebigfile.com/walletd/internal/websocket"
+	"go.thebigfile.com/walletd/treasury"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"lukechampine.com/frand"
+)
+
+// Associated data of encrypted messages. Binding the direction prevents a
+// relay from reflecting walletd's messages back to it.
+var (
+	adServer = []byte("walletd approver: server")
+	adApp    = []byte("walletd approver: app")
+)
+
+// DeriveKey derives the key shared by walletd and an app from one party's
+// X25519 private key and the other party's public key.
+func DeriveKey(privateKey, publicKey [32]byte, pairingID string) (key [32]byte, err error) {
+	shared, err := curve25519.X25519(privateKey[:], publicKey[:])
+	if err != nil {
+		return [32]byte{}, err
+	}
+	r := hkdf.New(sha256.New, shared, []byte(pairingID), []byte("walletd approver"))
+	if _, err := io.ReadFull(r, key[:]); err != nil {
+		panic(err) // should never happen
+	}
+	return key, nil
+}
+
+// Seal encrypts a message with the key shared with an app. fromApp
+// indicates the direction of the message.
+func Seal(key [32]byte, msg Message, fromApp bool) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	ad := adServer
+	if fromApp {
+		ad = adApp
+	}
+	nonce := frand.Bytes(aead.NonceSize())
+	return aead.Seal(nonce, nonce, buf, ad), nil
+}
+
+// Open decrypts a message sealed with the key shared with an app. fromApp
+// indicates the direction of the message.
+func Open(key [32]byte, buf []byte, fromApp bool) (msg Message, err error) {
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return Message{}, err
+	} else if len(buf) < aead.NonceSize() {
+		return Message{}, errors.New("message too short")
+	}
+	ad := adServer
+	if fromApp {
+		ad = adApp
+	}
+	plaintext, err := aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():], ad)
+	if err != nil {
+		return Message{}, errors.New("failed to decrypt message")
+	} else if err := json.Unmarshal(plaintext, &msg); err != nil {
+		return Message{}, fmt.Errorf("failed to decode message: %w", err)
+	}
+	return msg, nil
+}
+
+// A conn is an authenticated connection to an app.
+type conn struct {
+	m        *Manager
+	ws       *websocket.Conn
+	approver Approver
+
+	mu sync.Mutex // protects the fields below
+	// requests maps request IDs to pending transaction IDs and sent maps
+	// them back. Request IDs are random, so decisions recorded from one
+	// connection cannot be replayed on another.
+	requests map[string]int64
+	sent     map[int64]string
+}
+
+func (c *conn) write(msg Message) error {
+	buf, err := Seal(c.approver.Key, msg, false)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	return c.ws.WriteMessage(websocket.BinaryMessage, buf)
+}
+
+func (c *conn) read() (Message, error) {
+	typ, buf, err := c.ws.ReadMessage()
+	if err != nil {
+		return Message{}, err
+	} else if typ != websocket.BinaryMessage {
+		return Message{}, errors.New("expected encrypted message")
+	}
+	return Open(c.approver.Key, buf, true)
+}
+
+// sync sends requests for new pending transactions and notifies the app of
+// requests that were decided elsewhere.
+func (c *conn) sync() error {
+	pending, err := c.m.tm.PendingTransactions(treasury.StatusPending, 0, maxPendingRequests)
+	if err != nil {
+		return fmt.Errorf("failed to get pending transactions: %w", err)
+	}
+
+	var msgs []Message
+	c.mu.Lock()
+	current := make(map[int64]bool, len(pending))
+	for i := range pending {
+		pt := pending[i]
+		current[pt.ID] = true
+		if _, ok := c.sent[pt.ID]; ok {
+			continue
+		}
+		req := hex.EncodeToString(frand.Bytes(16))
+		c.sent[pt.ID] = req
+		c.requests[req] = pt.ID
+		msgs = append(msgs, Message{Type: MessageRequest, Request: req, Transaction: &pt})
+	}
+	for id, req := range c.sent {
+		if !current[id] {
+			delete(c.sent, id)
+			delete(c.requests, req)
+			msgs = append(msgs, Message{Type: MessageResolved, Request: req})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, msg := range msgs {
+		if err := c.write(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decide approves or rejects the transaction of a request.
+func (c *conn) decide(msg Message) Message {
+	resp := Message{Type: MessageResult, Request: msg.Request}
+	c.mu.Lock()
+	id, ok := c.requests[msg.Request]
+	c.mu.Unlock()
+	if !ok {
+		resp.Error = "unknown request"
+		return resp
+	}
+
+	var pt treasury.PendingTransaction
+	var err error
+	principal := Principal(c.approver.ID)
+	if msg.Type == MessageApprove {
+		pt, err = c.m.tm.Approve(id, principal, c.m.broadcast)
+	} else {
+		pt, err = c.m.tm.Reject(id, principal)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+
+	c.mu.Lock()
+	delete(c.requests, msg.Request)
+	delete(c.sent, id)
+	c.mu.Unlock()
+	resp.Transaction = &pt
+	return resp
+}
+
+// serve handles messages from the app until the connection is closed.
+func (c *conn) serve() error {
+	for {
+		msg, err := c.read()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case MessageApprove, MessageReject:
+			if err := c.write(c.decide(msg)); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected message type %q", msg.Type)
+		}
+	}
+}
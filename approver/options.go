@@ -0,0 +1,33 @@
+package approver
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithPairingTTL sets how long a pairing can be completed after it is
+// created. The default is 10 minutes.
+func WithPairingTTL(ttl time.Duration) Option {
+	return func(m *Manager) {
+		m.pairingTTL = ttl
+	}
+}
+
+// WithPollInterval sets how often the approval queue is checked for new
+// requests. The default is 2 seconds.
+func WithPollInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.pollInterval = d
+	}
+}
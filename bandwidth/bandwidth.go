@@ -0,0 +1,183 @@
+// Package bandwidth accounts for the bytes sent and received by the syncer's
+// peers and optionally limits the rate at which data is sent to them.
+package bandwidth
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// maxChunk is the largest write that is rate limited at once.
+const maxChunk = 16 << 10 // 16 KiB
+
+type (
+	// Usage is the number of bytes sent to and received from a peer.
+	Usage struct {
+		Sent     uint64 `json:"sent"`
+		Received uint64 `json:"received"`
+	}
+
+	// A Monitor counts the bytes transferred over the connections it wraps.
+	Monitor struct {
+		limiter *limiter
+
+		mu    sync.Mutex
+		total Usage
+		// peers maps the remote address of open connections to their
+		// usage
+		peers map[string]*Usage
+	}
+
+	// limiter is a token bucket without burst: each write reserves the
+	// time needed to send it at the configured rate.
+	limiter struct {
+		mu   sync.Mutex
+		rate float64 // bytes per second
+		next time.Time
+	}
+
+	conn struct {
+		net.Conn
+		m    *Monitor
+		addr string
+		once sync.Once
+	}
+
+	listener struct {
+		net.Listener
+		m *Monitor
+	}
+)
+
+// wait blocks until n bytes may be sent.
+func (l *limiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.m.add(c.addr, 0, n)
+	return n, err
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if c.m.limiter == nil {
+		n, err := c.Conn.Write(p)
+		c.m.add(c.addr, n, 0)
+		return n, err
+	}
+
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxChunk)]
+		c.m.limiter.wait(len(chunk))
+		n, err := c.Conn.Write(chunk)
+		c.m.add(c.addr, n, 0)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *conn) Close() error {
+	c.once.Do(func() {
+		c.m.mu.Lock()
+		delete(c.m.peers, c.addr)
+		c.m.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.m.Conn(c), nil
+}
+
+func (m *Monitor) add(addr string, sent, received int) {
+	if sent == 0 && received == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total.Sent += uint64(sent)
+	m.total.Received += uint64(received)
+	if u, ok := m.peers[addr]; ok {
+		u.Sent += uint64(sent)
+		u.Received += uint64(received)
+	}
+}
+
+// Conn wraps a connection so that its usage is counted and its writes are
+// rate limited.
+func (m *Monitor) Conn(c net.Conn) net.Conn {
+	addr := c.RemoteAddr().String()
+	m.mu.Lock()
+	m.peers[addr] = new(Usage)
+	m.mu.Unlock()
+	return &conn{Conn: c, m: m, addr: addr}
+}
+
+// Listener wraps a listener so that the usage of each accepted connection is
+// counted and its writes are rate limited.
+func (m *Monitor) Listener(l net.Listener) net.Listener {
+	return &listener{Listener: l, m: m}
+}
+
+// Peer returns the usage of the open connection with the remote address. The
+// second return value is false if no such connection is being monitored.
+func (m *Monitor) Peer(addr string) (Usage, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.peers[addr]
+	if !ok {
+		return Usage{}, false
+	}
+	return *u, true
+}
+
+// Peers returns the usage of each open connection, keyed by remote address.
+func (m *Monitor) Peers() map[string]Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	peers := make(map[string]Usage, len(m.peers))
+	for addr, u := range m.peers {
+		peers[addr] = *u
+	}
+	return peers
+}
+
+// Total returns the usage of every monitored connection since the monitor
+// was created, including connections that have been closed.
+func (m *Monitor) Total() Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
+
+// NewMonitor creates a new bandwidth monitor. If maxUploadRate is non-zero,
+// the combined rate at which data is written to monitored connections is
+// limited to maxUploadRate bytes per second.
+func NewMonitor(maxUploadRate uint64) *Monitor {
+	m := &Monitor{
+		peers: make(map[string]*Usage),
+	}
+	if maxUploadRate > 0 {
+		m.limiter = &limiter{rate: float64(maxUploadRate)}
+	}
+	return m
+}
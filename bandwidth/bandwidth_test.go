@@ -0,0 +1,72 @@
+package bandwidth_test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/bandwidth"
+)
+
+func TestMonitor(t *testing.T) {
+	const rate = 256 << 10 // 256 KiB/s
+	m := bandwidth.NewMonitor(rate)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ml := m.Listener(l)
+	defer ml.Close()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := ml.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	} else if _, err := io.ReadFull(server, make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes are limited to the upload rate
+	const n = 64 << 10
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(client, make([]byte, n))
+		errCh <- err
+	}()
+	start := time.Now()
+	if _, err := server.Write(make([]byte, n)); err != nil {
+		t.Fatal(err)
+	} else if err := <-errCh; err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected write to be rate limited, took %v", elapsed)
+	}
+
+	addr := client.LocalAddr().String()
+	if u, ok := m.Peer(addr); !ok {
+		t.Fatal("expected peer to be monitored")
+	} else if u.Sent != n || u.Received != 1000 {
+		t.Fatalf("unexpected peer usage %+v", u)
+	} else if peers := m.Peers(); len(peers) != 1 || peers[addr] != u {
+		t.Fatalf("unexpected peers %v", peers)
+	}
+
+	// closed connections are removed, but still count towards the total
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := m.Peer(addr); ok {
+		t.Fatal("expected closed peer to be removed")
+	} else if total := m.Total(); total.Sent != n || total.Received != 1000 {
+		t.Fatalf("unexpected total usage %+v", total)
+	}
+}
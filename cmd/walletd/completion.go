@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"lukechampine.com/flagg"
+)
+
+// A completionNode is a command in the CLI tree along with the path of
+// subcommand names leading to it.
+type completionNode struct {
+	path  []string
+	cmd   *flag.FlagSet
+	subs  []string
+	flags []*flag.Flag
+}
+
+func (n completionNode) key() string {
+	return strings.Join(n.path, " ")
+}
+
+func (n completionNode) flagNames() []string {
+	names := make([]string, 0, len(n.flags))
+	for _, f := range n.flags {
+		names = append(names, "-"+f.Name)
+	}
+	return names
+}
+
+// walkCompletionTree flattens the command tree into a list of nodes.
+func walkCompletionTree(t flagg.Tree, path []string) []completionNode {
+	n := completionNode{
+		path: path,
+		cmd:  t.Cmd,
+	}
+	t.Cmd.VisitAll(func(f *flag.Flag) {
+		n.flags = append(n.flags, f)
+	})
+	var children []completionNode
+	for _, sub := range t.Sub {
+		n.subs = append(n.subs, sub.Cmd.Name())
+		childPath := append(append([]string(nil), path...), sub.Cmd.Name())
+		children = append(children, walkCompletionTree(sub, childPath)...)
+	}
+	return append([]completionNode{n}, children...)
+}
+
+// writeBashCompletion writes a bash completion script for the command tree.
+func writeBashCompletion(w io.Writer, t flagg.Tree) {
+	fmt.Fprintln(w, `# bash completion for walletd
+_walletd() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local cmdpath="" word
+	for word in "${COMP_WORDS[@]:1:COMP_CWORD-1}"; do
+		[[ $word == -* ]] || cmdpath="${cmdpath:+$cmdpath }$word"
+	done
+
+	local cmds="" flags=""
+	case "$cmdpath" in`)
+	for _, n := range walkCompletionTree(t, nil) {
+		fmt.Fprintf(w, "\t%q)\n\t\tcmds=%q\n\t\tflags=%q\n\t\t;;\n", n.key(), strings.Join(n.subs, " "), strings.Join(n.flagNames(), " "))
+	}
+	fmt.Fprintln(w, `	esac
+
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+	else
+		COMPREPLY=($(compgen -W "$cmds" -- "$cur"))
+	fi
+}
+complete -o default -F _walletd walletd`)
+}
+
+// writeZshCompletion writes a zsh completion script for the command tree.
+func writeZshCompletion(w io.Writer, t flagg.Tree) {
+	fmt.Fprintln(w, `#compdef walletd
+_walletd() {
+	local cmdpath="" word
+	for word in ${words[2,CURRENT-1]}; do
+		[[ $word == -* ]] || cmdpath="${cmdpath:+$cmdpath }$word"
+	done
+
+	local -a cmds flags
+	case "$cmdpath" in`)
+	for _, n := range walkCompletionTree(t, nil) {
+		fmt.Fprintf(w, "\t%q)\n\t\tcmds=(%s)\n\t\tflags=(%s)\n\t\t;;\n", n.key(), strings.Join(n.subs, " "), strings.Join(n.flagNames(), " "))
+	}
+	fmt.Fprintln(w, `	esac
+
+	if [[ $PREFIX == -* ]]; then
+		compadd -- $flags
+	elif (( ${#cmds} )); then
+		compadd -- $cmds
+	else
+		_files
+	fi
+}
+compdef _walletd walletd`)
+}
+
+// writeFishCompletion writes a fish completion script for the command tree.
+func writeFishCompletion(w io.Writer, t flagg.Tree) {
+	fmt.Fprintln(w, "# fish completion for walletd")
+	for _, n := range walkCompletionTree(t, nil) {
+		// the condition under which the node's subcommands and flags apply
+		var cond string
+		if len(n.path) == 0 {
+			cond = "__fish_use_subcommand"
+		} else {
+			cond = "__fish_seen_subcommand_from " + n.path[len(n.path)-1]
+			if len(n.subs) > 0 {
+				cond += "; and not __fish_seen_subcommand_from " + strings.Join(n.subs, " ")
+			}
+		}
+		for _, sub := range n.subs {
+			fmt.Fprintf(w, "complete -c walletd -f -n %q -a %s\n", cond, sub)
+		}
+		for _, f := range n.flags {
+			fmt.Fprintf(w, "complete -c walletd -n %q -o %s -d %q\n", cond, f.Name, f.Usage)
+		}
+	}
+}
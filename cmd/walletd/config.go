@@ -9,19 +9,25 @@ import (
 	"strconv"
 	"strings"
 
+	"go.thebigfile.com/walletd/internal/password"
 	"go.thebigfile.com/walletd/wallet"
 	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 )
 
-// readPasswordInput reads a password from stdin.
+// readPasswordInput reads a password from stdin. If JSON output is enabled,
+// the prompt is written to stderr to keep stdout machine-readable.
 func readPasswordInput(context string) string {
-	fmt.Printf("%s: ", context)
+	prompt := os.Stdout
+	if jsonOutput {
+		prompt = os.Stderr
+	}
+	fmt.Fprintf(prompt, "%s: ", context)
 	input, err := term.ReadPassword(int(os.Stdin.Fd()))
 	if err != nil {
 		fatalError(fmt.Errorf("could not read password input: %w", err))
 	}
-	fmt.Println("")
+	fmt.Fprintln(prompt, "")
 	return string(input)
 }
 
@@ -230,6 +236,8 @@ func buildConfig() {
 
 	fmt.Println("")
 	setAPIPassword()
+	// store a hash of the password instead of the plaintext
+	cfg.HTTP.Password = password.Hash(cfg.HTTP.Password)
 
 	fmt.Println("")
 	setAdvancedConfig()
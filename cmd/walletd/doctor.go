@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/health"
+	"go.thebigfile.com/walletd/internal/ntp"
+	"go.thebigfile.com/walletd/persist/sqlite"
+)
+
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "fail"
+	statusSkip = "skip"
+
+	// doctorClockFail is the clock offset above which the clock check
+	// fails. Blocks with timestamps more than three hours in the future are
+	// rejected by the network. The check warns above the configured
+	// maximum skew.
+	doctorClockFail = time.Hour
+	// doctorMaxScanLag is the number of blocks the wallet index can be
+	// behind the chain before the scan check warns.
+	doctorMaxScanLag = 10
+	// doctorMinPeers is the number of peers below which the peer check
+	// warns.
+	doctorMinPeers = 3
+)
+
+// A finding is the result of a single doctor check. Findings that are not ok
+// include an action the operator can take to fix the problem.
+type finding struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Action  string `json:"action,omitempty"`
+}
+
+// loopbackAddr returns the loopback address of a listen address, e.g.
+// ":9981" becomes "127.0.0.1:9981".
+func loopbackAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// listening returns true if a process accepts TCP connections on the
+// address.
+func listening(addr string) bool {
+	conn, err := net.DialTimeout("tcp", loopbackAddr(addr), 2*time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func doctorDatabase(dir string) finding {
+	fp := filepath.Join(dir, "walletd.sqlite3")
+	check, err := sqlite.CheckDatabase(fp)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return finding{"database", statusWarn, fmt.Sprintf("%s does not exist", fp), "start walletd to create it, or set -dir to the directory of an existing node"}
+	case err != nil:
+		return finding{"database", statusFail, fmt.Sprintf("failed to check %s: %v", fp, err), "restore the database from a backup, or move it aside and rescan the chain to rebuild it"}
+	case len(check.Problems) != 0:
+		return finding{"database", statusFail, fmt.Sprintf("%s is corrupt: %s", fp, strings.Join(check.Problems, "; ")), "restore the database from a backup, or move it aside and rescan the chain to rebuild it"}
+	case check.Version == 0:
+		return finding{"database", statusFail, fmt.Sprintf("%s is not a walletd database", fp), "check that -dir is the walletd data directory"}
+	case check.Version > check.Expected:
+		return finding{"database", statusFail, fmt.Sprintf("schema version %d is newer than version %d supported by this build", check.Version, check.Expected), "upgrade walletd; databases cannot be downgraded"}
+	case check.Version < check.Expected:
+		return finding{"database", statusWarn, fmt.Sprintf("schema version %d will be migrated to version %d on the next start", check.Version, check.Expected), "back up the database before starting the new version"}
+	}
+	return finding{"database", statusOK, fmt.Sprintf("integrity check passed, schema version %d", check.Version), ""}
+}
+
+func doctorDisk(dir string) finding {
+	free, total, err := health.DiskUsage(dir)
+	if err != nil {
+		return finding{"disk", statusSkip, fmt.Sprintf("couldn't get disk usage: %v", err), ""}
+	}
+	msg := fmt.Sprintf("%d MiB free of %d MiB", free>>20, total>>20)
+	if low, critical := health.LowDisk(free, total); critical {
+		return finding{"disk", statusFail, msg, "free up disk space; walletd stops syncing when the disk is full"}
+	} else if low {
+		return finding{"disk", statusWarn, msg, "free up disk space or move the data directory to a larger disk"}
+	}
+	return finding{"disk", statusOK, msg, ""}
+}
+
+func doctorClock(ctx context.Context) finding {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resp, err := ntp.QueryAny(ctx, cfg.Clock.NTPServers)
+	if err != nil {
+		return finding{"clock", statusSkip, fmt.Sprintf("couldn't check the clock: %v", err), "allow outbound UDP on port 123 to check the clock"}
+	}
+	msg := fmt.Sprintf("local clock is off by %v according to %s", resp.Offset.Round(time.Millisecond), resp.Server)
+	switch offset := resp.Offset.Abs(); {
+	case offset > doctorClockFail:
+		return finding{"clock", statusFail, msg, "enable time synchronization (NTP) on this machine; blocks and peer handshakes depend on an accurate clock"}
+	case cfg.Clock.MaxSkew > 0 && offset > cfg.Clock.MaxSkew:
+		return finding{"clock", statusWarn, msg, "enable time synchronization (NTP) on this machine"}
+	}
+	return finding{"clock", statusOK, msg, ""}
+}
+
+// doctorPorts checks that the syncer and API addresses are either served
+// by walletd or free to be bound.
+func doctorPorts(running bool) []finding {
+	type port struct {
+		check, addr, option string
+	}
+	ports := []port{{"syncer port", cfg.Syncer.Address, "syncer.address"}}
+	for _, addr := range cfg.Syncer.Addresses {
+		ports = append(ports, port{"syncer port", addr, "syncer.addresses"})
+	}
+	ports = append(ports, port{"api port", cfg.HTTP.Address, "http.address"})
+
+	var findings []finding
+	for _, p := range ports {
+		switch {
+		case listening(p.addr):
+			findings = append(findings, finding{p.check, statusOK, fmt.Sprintf("accepting connections on %s", p.addr), ""})
+		case running:
+			findings = append(findings, finding{p.check, statusFail, fmt.Sprintf("walletd is running but not accepting connections on %s", p.addr), fmt.Sprintf("check that %s matches the running node's config", p.option)})
+		default:
+			l, err := net.Listen("tcp", p.addr)
+			if err != nil {
+				findings = append(findings, finding{p.check, statusFail, fmt.Sprintf("cannot listen on %s: %v", p.addr, err), fmt.Sprintf("stop the process using the port or change %s", p.option)})
+				continue
+			}
+			l.Close()
+			findings = append(findings, finding{p.check, statusOK, fmt.Sprintf("%s is available", p.addr), ""})
+		}
+	}
+	return findings
+}
+
+// doctorNode checks the peers, sync, and scan status of a running node.
+func doctorNode(c *api.Client) []finding {
+	cs, err := c.ConsensusTipState()
+	if err != nil {
+		return []finding{{"api", statusFail, fmt.Sprintf("couldn't get consensus state: %v", err), "check the API password"}}
+	}
+	findings := []finding{{"api", statusOK, fmt.Sprintf("connected to walletd at %s", c.BaseURL()), ""}}
+
+	peers, err := c.SyncerPeers()
+	switch {
+	case err != nil:
+		findings = append(findings, finding{"peers", statusFail, fmt.Sprintf("couldn't get peers: %v", err), ""})
+	case len(peers) == 0:
+		findings = append(findings, finding{"peers", statusFail, "not connected to any peers", "allow outbound TCP connections, and enable syncer.bootstrap or add syncer.peers"})
+	case len(peers) < doctorMinPeers:
+		findings = append(findings, finding{"peers", statusWarn, fmt.Sprintf("only connected to %d peers", len(peers)), "allow inbound connections to the syncer port so more peers can connect"})
+	default:
+		findings = append(findings, finding{"peers", statusOK, fmt.Sprintf("connected to %d peers", len(peers)), ""})
+	}
+
+	if sp := estimateSyncProgress(cs); !sp.Synced {
+		findings = append(findings, finding{"sync", statusWarn, fmt.Sprintf("syncing: %.2f%%, ~%d blocks remaining", sp.Percent(), sp.EstimatedHeight-sp.Height), "wait for walletd to sync; balances are incomplete until it does"})
+	} else {
+		findings = append(findings, finding{"sync", statusOK, fmt.Sprintf("synced to height %d", cs.Index.Height), ""})
+	}
+
+	scan, err := c.ScanStatus()
+	if err != nil {
+		return append(findings, finding{"scan", statusFail, fmt.Sprintf("couldn't get scan status: %v", err), ""})
+	}
+	var lag uint64
+	if cs.Index.Height > scan.Index.Height {
+		lag = cs.Index.Height - scan.Index.Height
+	}
+	switch {
+	case scan.Error != nil:
+		findings = append(findings, finding{"scan", statusFail, fmt.Sprintf("rescan failed: %s", *scan.Error), "check the log for the cause, then start the rescan again"})
+	case lag > doctorMaxScanLag:
+		findings = append(findings, finding{"scan", statusWarn, fmt.Sprintf("wallet index is %d blocks behind the chain", lag), "wait for the index to catch up; if it does not advance, check the log for errors"})
+	default:
+		findings = append(findings, finding{"scan", statusOK, fmt.Sprintf("wallet index is at height %d", scan.Index.Height), ""})
+	}
+	return findings
+}
+
+// runDoctor checks the local node and prints its findings. It exits with a
+// non-zero status if any check fails.
+func runDoctor(ctx context.Context) {
+	findings := []finding{
+		doctorDatabase(cfg.Directory),
+		doctorDisk(cfg.Directory),
+		doctorClock(ctx),
+	}
+
+	running := listening(cfg.HTTP.Address)
+	findings = append(findings, doctorPorts(running)...)
+	if running {
+		findings = append(findings, doctorNode(apiClient())...)
+	} else {
+		findings = append(findings, finding{"api", statusSkip, fmt.Sprintf("walletd is not running on %s", cfg.HTTP.Address), "start walletd to check peers, sync, and scan progress"})
+	}
+
+	var failed bool
+	for _, f := range findings {
+		failed = failed || f.Status == statusFail
+	}
+	defer func() {
+		if failed {
+			os.Exit(1)
+		}
+	}()
+
+	if jsonOutput {
+		printJSON(findings)
+		return
+	}
+	for _, f := range findings {
+		var status string
+		switch f.Status {
+		case statusOK:
+			status = wrapANSI("\033[32m", " ok ", "\033[0m")
+		case statusWarn:
+			status = wrapANSI("\033[33m", "warn", "\033[0m")
+		case statusFail:
+			status = wrapANSI("\033[31m", "FAIL", "\033[0m")
+		default:
+			status = "skip"
+		}
+		fmt.Printf("[%s] %-12s %s\n", status, f.Check, f.Message)
+		if f.Action != "" && f.Status != statusOK {
+			fmt.Printf("       %-12s -> %s\n", "", f.Action)
+		}
+	}
+}
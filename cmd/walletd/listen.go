@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"go.thebigfile.com/walletd/config"
+	"go.thebigfile.com/walletd/internal/handover"
+	"go.thebigfile.com/walletd/internal/natpmp"
+	"go.thebigfile.com/walletd/internal/netutil"
+	"go.uber.org/zap"
+)
+
+// natpmpLifetime is the lifetime requested for the NAT-PMP port mapping. The
+// mapping is renewed at half its lifetime.
+const natpmpLifetime = time.Hour
+
+// listenSyncer listens on the syncer's primary address and each of its
+// additional addresses.
+func listenSyncer(ls *handover.Set, sc config.Syncer) (*netutil.MultiListener, error) {
+	var listeners []net.Listener
+	for i, addr := range append([]string{sc.Address}, sc.Addresses...) {
+		l, err := ls.Listen(fmt.Sprintf("syncer.%d", i), addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %q: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return netutil.NewMultiListener(listeners...), nil
+}
+
+// listenerAddress returns the address to advertise based on the syncer's
+// listeners. The gateway header can only carry one address, so a global
+// IPv4 address is preferred over a global IPv6 address, since more peers can
+// reach it. If no listener is bound to a global address, the first
+// listener's address is returned.
+func listenerAddress(addrs []net.Addr) string {
+	var v6 string
+	for _, addr := range addrs {
+		tcp, ok := addr.(*net.TCPAddr)
+		if !ok || !tcp.IP.IsGlobalUnicast() || tcp.IP.IsPrivate() {
+			continue
+		} else if tcp.IP.To4() != nil {
+			return tcp.String()
+		} else if v6 == "" {
+			v6 = tcp.String()
+		}
+	}
+	if v6 != "" {
+		return v6
+	}
+	return addrs[0].String()
+}
+
+// listenerPort returns the port of a listener address.
+func listenerPort(addr net.Addr) (uint16, error) {
+	_, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return 0, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse syncer port: %w", err)
+	}
+	return uint16(port), nil
+}
+
+// setupNATPMP forwards the syncer port using NAT-PMP and returns the
+// external address. The mapping is renewed until the returned function is
+// called, which removes it.
+func setupNATPMP(port uint16, log *zap.Logger) (string, func(), error) {
+	c, err := natpmp.NewClient()
+	if err != nil {
+		return "", nil, fmt.Errorf("couldn't discover NAT-PMP gateway: %w", err)
+	}
+
+	reqCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ip, err := c.ExternalAddress(reqCtx)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get external address: %w", err)
+	}
+	m, err := c.MapTCP(reqCtx, port, port, natpmpLifetime)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to forward port: %w", err)
+	}
+	log.Debug("natpmp: forwarded p2p port", zap.Uint16("internal", m.InternalPort), zap.Uint16("external", m.ExternalPort), zap.Duration("lifetime", m.Lifetime))
+
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wait := m.Lifetime / 2
+		for {
+			select {
+			case <-ctx.Done():
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if _, err := c.MapTCP(ctx, port, 0, 0); err != nil {
+					log.Debug("natpmp: failed to remove port mapping", zap.Error(err))
+				}
+				return
+			case <-time.After(wait):
+			}
+
+			reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			renewed, err := c.MapTCP(reqCtx, port, m.ExternalPort, natpmpLifetime)
+			cancel()
+			if err != nil {
+				log.Warn("failed to renew NAT-PMP port mapping", zap.Error(err))
+				wait = time.Minute
+				continue
+			} else if renewed.ExternalPort != m.ExternalPort {
+				// the advertised address cannot be changed after the
+				// syncer has started
+				log.Warn("NAT-PMP gateway changed the external port", zap.Uint16("old", m.ExternalPort), zap.Uint16("new", renewed.ExternalPort))
+			}
+			m = renewed
+			wait = m.Lifetime / 2
+		}
+	}()
+	addr := net.JoinHostPort(ip.String(), strconv.Itoa(int(m.ExternalPort)))
+	return addr, func() { stop(); <-done }, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -9,8 +10,8 @@ import (
 	"path/filepath"
 	"runtime"
 	"syscall"
+	"time"
 
-	"go.thebigfile.com/walletd/api"
 	"go.thebigfile.com/walletd/build"
 	"go.thebigfile.com/walletd/config"
 	"go.thebigfile.com/walletd/wallet"
@@ -30,18 +31,103 @@ Run 'walletd' with no arguments to start the blockchain node and API server.
 
 Actions:
     version     print walletd version
+    status      print the status of a running walletd node
+    doctor      diagnose common problems with the node
+    wallet      manage the wallets of a running walletd node
     seed        generate a recovery phrase
-    mine        run CPU miner`
+    import-siad import a legacy siad wallet database
+    hash-password
+                generate an argon2id hash of the API password
+    mine        run CPU miner
+    completion  generate a shell completion script`
 
 	versionUsage = `Usage:
     walletd version
 
 Prints the version of the walletd binary.
+`
+	statusUsage = `Usage:
+    walletd status
+
+Prints the sync status, tip, and peer count of a running walletd node.
+`
+	doctorUsage = `Usage:
+    walletd doctor
+
+Checks the node's database integrity and schema version, free disk space,
+clock skew, and ports. If walletd is running, its peers, sync progress, and
+wallet index are checked too. Each problem is printed with an action to fix
+it. Exits with a non-zero status if any check fails.
+`
+	walletUsage = `Usage:
+    walletd wallet [action]
+
+Manages the wallets of a running walletd node using the configured API
+address and password.
+
+Actions:
+    list        list all wallets
+    create      create a new wallet
+    balance     print the balance of a wallet
+    addresses   list the addresses of a wallet
+    send        send siacoins from a wallet
+`
+	walletListUsage = `Usage:
+    walletd wallet list
+
+Lists all wallets tracked by walletd.
+`
+	walletCreateUsage = `Usage:
+    walletd wallet create [flags]
+
+Creates a new wallet.
+`
+	walletBalanceUsage = `Usage:
+    walletd wallet balance <id>
+
+Prints the balance of a wallet.
+`
+	walletAddressesUsage = `Usage:
+    walletd wallet addresses <id>
+
+Lists the addresses of a wallet.
+`
+	walletSendUsage = `Usage:
+    walletd wallet send [flags] <id> <amount> <address>
+
+Sends siacoins from a wallet. The amount may include a unit, e.g. "10 SC".
+The wallet's recovery phrase is read from stdin and used to sign the
+transaction locally.
 `
 	seedUsage = `Usage:
     walletd seed
 
 Generates a secure BIP-39 recovery phrase.
+`
+	importSiadUsage = `Usage:
+    walletd import-siad [flags] <path to wallet.db>
+
+Imports a legacy siad wallet into a running walletd node. The wallet
+database is decrypted with the siad wallet password, read from stdin, which
+is the primary seed phrase if no custom password was set. A wallet is
+created with the addresses derived from the primary and auxiliary seeds and
+the watched addresses, and the chain is rescanned to index their history.
+The seeds are never sent to walletd. siad must not be running.
+`
+	completionUsage = `Usage:
+    walletd completion <bash|zsh|fish>
+
+Prints a shell completion script for walletd. For example, to enable
+completion in the current bash session:
+
+    source <(walletd completion bash)
+`
+	hashPasswordUsage = `Usage:
+    walletd hash-password
+
+Generates an argon2id hash of a password. The hash can be used as the API
+password in the config file so the plaintext password is not stored on disk.
+If stdin is not a terminal, the password is read from the first line of stdin.
 `
 	mineUsage = `Usage:
     walletd mine
@@ -57,18 +143,56 @@ var cfg = config.Config{
 	HTTP: config.HTTP{
 		Address:         "localhost:9980",
 		Password:        os.Getenv("WALLETD_API_PASSWORD"),
+		PasswordFile:    os.Getenv("WALLETD_API_PASSWORD_FILE"),
 		PublicEndpoints: false,
+		Profile:         "wallet-admin",
+		PublicProfile:   "public-explorer",
+		CurrencyFormat:  "hastings",
 	},
 	Syncer: config.Syncer{
 		Address:   ":9981",
 		Bootstrap: true,
+		Relay:     "full",
+	},
+	Clock: config.Clock{
+		MaxSkew: 10 * time.Second,
 	},
 	Consensus: config.Consensus{
 		Network: "mainnet",
 	},
 	Index: config.Index{
-		Mode:      wallet.IndexModePersonal,
-		BatchSize: 1000,
+		Mode:             wallet.IndexModePersonal,
+		BatchSize:        1000,
+		CatchUpThreshold: 1000,
+	},
+	Database: config.Database{
+		SlowQueryThreshold: 500 * time.Millisecond,
+	},
+	Anomaly: config.Anomaly{
+		Window: time.Hour,
+	},
+	Payments: config.Payments{
+		MaxDelay: 10 * time.Minute,
+		MaxSize:  100,
+	},
+	KeyStore: config.KeyStore{
+		UnlockTimeout:    15 * time.Minute,
+		MaxUnlockTimeout: 24 * time.Hour,
+	},
+	Rotation: config.Rotation{
+		SweepInterval: 10 * time.Minute,
+		MaxInputs:     100,
+	},
+	Forwarding: config.Forwarding{
+		SweepInterval:    time.Minute,
+		MinConfirmations: 6,
+		MaxInputs:        100,
+	},
+	Transfers: config.Transfers{
+		PreferLedger: true,
+	},
+	Escrow: config.Escrow{
+		CheckInterval: time.Minute,
 	},
 	Log: config.Log{
 		Level: "info",
@@ -200,38 +324,102 @@ func main() {
 	var minerBlocks int
 	var enableDebug bool
 
+	var walletName, walletDescription string
+	var sendChangeAddrStr string
+	var sendKeys uint64
+
+	var importName string
+	var importLookahead, importAuxKeys, importRescanHeight uint64
+	var importRescan bool
+
 	rootCmd := flagg.Root
 	rootCmd.Usage = flagg.SimpleUsage(rootCmd, rootUsage)
 	rootCmd.BoolVar(&enableDebug, "debug", false, "enable debug mode with additional profiling and mining endpoints")
 	rootCmd.StringVar(&cfg.Directory, "dir", cfg.Directory, "directory to store node state in")
 	rootCmd.StringVar(&cfg.HTTP.Address, "http", cfg.HTTP.Address, "address to serve API on")
 	rootCmd.BoolVar(&cfg.HTTP.PublicEndpoints, "http.public", cfg.HTTP.PublicEndpoints, "disables auth on endpoints that should be publicly accessible when running walletd as a service")
+	rootCmd.StringVar(&cfg.HTTP.PublicAddress, "http.publicAddr", cfg.HTTP.PublicAddress, "optional address to serve the public API profile on")
+	rootCmd.StringVar(&cfg.HTTP.PublicProfile, "http.publicProfile", cfg.HTTP.PublicProfile, "the endpoint exposure profile served on the public address")
+	rootCmd.StringVar(&cfg.HTTP.Profile, "http.profile", cfg.HTTP.Profile, "the endpoint exposure profile (wallet-admin, public-explorer, signer-only)")
+	rootCmd.StringVar(&cfg.HTTP.CurrencyFormat, "http.currencyFormat", cfg.HTTP.CurrencyFormat, "the default format of currency values in API responses (hastings, sc)")
+	rootCmd.BoolVar(&cfg.HTTP.GraphQL, "http.graphql", cfg.HTTP.GraphQL, "enables the GraphQL query endpoint")
+
+	rootCmd.StringVar(&cfg.Electrum.Address, "electrum", cfg.Electrum.Address, "optional address to serve the Electrum-style protocol on (requires full index mode)")
+	rootCmd.StringVar(&cfg.Approvers.Address, "approvers", cfg.Approvers.Address, "optional address approver apps connect to")
+	rootCmd.StringVar(&cfg.Rosetta.Address, "rosetta", cfg.Rosetta.Address, "optional address to serve the Rosetta API on (requires full index mode)")
 
 	rootCmd.StringVar(&cfg.Syncer.Address, "addr", cfg.Syncer.Address, "p2p address to listen on")
 	rootCmd.StringVar(&cfg.Consensus.Network, "network", cfg.Consensus.Network, "network to connect to")
 	rootCmd.BoolVar(&cfg.Syncer.EnableUPnP, "upnp", cfg.Syncer.EnableUPnP, "attempt to forward ports and discover IP with UPnP")
+	rootCmd.BoolVar(&cfg.Syncer.EnableNATPMP, "natpmp", cfg.Syncer.EnableNATPMP, "attempt to forward ports and discover IP with NAT-PMP")
+	rootCmd.StringVar(&cfg.Syncer.AdvertiseAddress, "addr.advertise", cfg.Syncer.AdvertiseAddress, "p2p address to advertise to peers instead of the discovered address")
 	rootCmd.BoolVar(&cfg.Syncer.Bootstrap, "bootstrap", cfg.Syncer.Bootstrap, "attempt to bootstrap the network")
+	rootCmd.StringVar(&cfg.Syncer.Relay, "relay", cfg.Syncer.Relay, "relay policy (full, blocks, leaf)")
 
 	rootCmd.StringVar(&indexModeStr, "index.mode", indexModeStr, "address index mode (personal, full, none)")
 	rootCmd.IntVar(&cfg.Index.BatchSize, "index.batch", cfg.Index.BatchSize, "max number of blocks to index at a time. Increasing this will increase scan speed, but also increase memory and cpu usage.")
 
 	versionCmd := flagg.New("version", versionUsage)
+	statusCmd := flagg.New("status", statusUsage)
+	doctorCmd := flagg.New("doctor", doctorUsage)
+	walletCmd := flagg.New("wallet", walletUsage)
+	walletListCmd := flagg.New("list", walletListUsage)
+	walletCreateCmd := flagg.New("create", walletCreateUsage)
+	walletCreateCmd.StringVar(&walletName, "name", "", "name of the wallet (required)")
+	walletCreateCmd.StringVar(&walletDescription, "description", "", "description of the wallet")
+	walletBalanceCmd := flagg.New("balance", walletBalanceUsage)
+	walletAddressesCmd := flagg.New("addresses", walletAddressesUsage)
+	walletSendCmd := flagg.New("send", walletSendUsage)
+	walletSendCmd.StringVar(&sendChangeAddrStr, "change", "", "address to send change to. Defaults to the wallet's first address")
+	walletSendCmd.Uint64Var(&sendKeys, "keys", 100, "number of seed keys to search for the wallet's addresses")
 	seedCmd := flagg.New("seed", seedUsage)
 	configCmd := flagg.New("config", "interactively configure walletd")
+	importSiadCmd := flagg.New("import-siad", importSiadUsage)
+	importSiadCmd.StringVar(&importName, "name", "siad", "name of the imported wallet")
+	importSiadCmd.Uint64Var(&importLookahead, "lookahead", 100, "number of primary seed addresses to import beyond those generated by siad")
+	importSiadCmd.Uint64Var(&importAuxKeys, "aux.keys", 1000, "number of addresses to import from each auxiliary seed")
+	importSiadCmd.BoolVar(&importRescan, "rescan", true, "rescan the chain after importing")
+	importSiadCmd.Uint64Var(&importRescanHeight, "rescan.height", 0, "height to start the rescan from")
 
 	mineCmd := flagg.New("mine", mineUsage)
 	mineCmd.IntVar(&minerBlocks, "n", -1, "mine this many blocks. If negative, mine indefinitely")
 	mineCmd.StringVar(&minerAddrStr, "addr", "", "address to send block rewards to (required)")
 
-	cmd := flagg.Parse(flagg.Tree{
+	completionCmd := flagg.New("completion", completionUsage)
+	hashPasswordCmd := flagg.New("hash-password", hashPasswordUsage)
+
+	for _, c := range []*flag.FlagSet{versionCmd, statusCmd, doctorCmd, walletListCmd, walletCreateCmd, walletBalanceCmd, walletAddressesCmd, walletSendCmd, seedCmd, importSiadCmd, hashPasswordCmd} {
+		c.BoolVar(&jsonOutput, "json", false, "print output as JSON")
+	}
+
+	tree := flagg.Tree{
 		Cmd: rootCmd,
 		Sub: []flagg.Tree{
 			{Cmd: configCmd},
 			{Cmd: versionCmd},
+			{Cmd: statusCmd},
+			{Cmd: doctorCmd},
+			{
+				Cmd: walletCmd,
+				Sub: []flagg.Tree{
+					{Cmd: walletListCmd},
+					{Cmd: walletCreateCmd},
+					{Cmd: walletBalanceCmd},
+					{Cmd: walletAddressesCmd},
+					{Cmd: walletSendCmd},
+				},
+			},
 			{Cmd: seedCmd},
+			{Cmd: importSiadCmd},
+			{Cmd: hashPasswordCmd},
 			{Cmd: mineCmd},
+			{Cmd: completionCmd},
 		},
-	})
+	}
+	cmd := flagg.Parse(tree)
+
+	// secrets loaded from files override the config file and environment
+	loadSecrets()
 
 	switch cmd {
 	case rootCmd:
@@ -247,7 +435,10 @@ func main() {
 			fatalError(fmt.Errorf("failed to create data directory: %w", err))
 		}
 
-		mustSetAPIPassword()
+		// the API password is fetched from the secrets backend at startup
+		if cfg.Secrets.APIPassword == "" {
+			mustSetAPIPassword()
+		}
 
 		var logCores []zapcore.Core
 		if cfg.Log.StdOut.Enabled {
@@ -324,9 +515,91 @@ func main() {
 			cmd.Usage()
 			return
 		}
+		if jsonOutput {
+			printJSON(struct {
+				Version   string `json:"version"`
+				Commit    string `json:"commit"`
+				BuildTime string `json:"buildTime"`
+			}{build.Version(), build.Commit(), build.Time().Format(time.RFC3339)})
+			return
+		}
 		fmt.Println("walletd", build.Version())
 		fmt.Println("Commit:", build.Commit())
 		fmt.Println("Build Date:", build.Time())
+	case statusCmd:
+		if len(cmd.Args()) != 0 {
+			cmd.Usage()
+			return
+		}
+
+		c := apiClient()
+		printStatus(c)
+	case doctorCmd:
+		if len(cmd.Args()) != 0 {
+			cmd.Usage()
+			return
+		}
+
+		runDoctor(context.Background())
+	case walletCmd:
+		cmd.Usage()
+	case walletListCmd:
+		if len(cmd.Args()) != 0 {
+			cmd.Usage()
+			return
+		}
+
+		c := apiClient()
+		listWallets(c)
+	case walletCreateCmd:
+		if len(cmd.Args()) != 0 {
+			cmd.Usage()
+			return
+		}
+
+		c := apiClient()
+		createWallet(c, walletName, walletDescription)
+	case walletBalanceCmd:
+		if len(cmd.Args()) != 1 {
+			cmd.Usage()
+			return
+		}
+
+		c := apiClient()
+		printWalletBalance(c, parseWalletID(cmd.Arg(0)))
+	case walletAddressesCmd:
+		if len(cmd.Args()) != 1 {
+			cmd.Usage()
+			return
+		}
+
+		c := apiClient()
+		listWalletAddresses(c, parseWalletID(cmd.Arg(0)))
+	case walletSendCmd:
+		if len(cmd.Args()) != 3 {
+			cmd.Usage()
+			return
+		}
+
+		id := parseWalletID(cmd.Arg(0))
+		amount, err := types.ParseCurrency(cmd.Arg(1))
+		if err != nil {
+			fatalError(fmt.Errorf("invalid amount %q: %w", cmd.Arg(1), err))
+		}
+		dest, err := types.ParseAddress(cmd.Arg(2))
+		if err != nil {
+			fatalError(fmt.Errorf("invalid address %q: %w", cmd.Arg(2), err))
+		}
+		var changeAddr types.Address
+		if sendChangeAddrStr != "" {
+			changeAddr, err = types.ParseAddress(sendChangeAddrStr)
+			if err != nil {
+				fatalError(fmt.Errorf("invalid change address %q: %w", sendChangeAddrStr, err))
+			}
+		}
+
+		c := apiClient()
+		sendSiacoins(c, id, amount, dest, changeAddr, sendKeys)
 	case seedCmd:
 		if len(cmd.Args()) != 0 {
 			cmd.Usage()
@@ -338,9 +611,25 @@ func main() {
 			log.Fatal(err)
 		}
 		addr := types.StandardUnlockHash(cwallet.KeyFromSeed(&seed, 0).PublicKey())
+		clear(seed[:])
+		if jsonOutput {
+			printJSON(struct {
+				RecoveryPhrase string        `json:"recoveryPhrase"`
+				Address        types.Address `json:"address"`
+			}{recoveryPhrase, addr})
+			return
+		}
 
 		fmt.Println("Recovery Phrase:", recoveryPhrase)
 		fmt.Println("Address", addr)
+	case importSiadCmd:
+		if len(cmd.Args()) != 1 {
+			cmd.Usage()
+			return
+		}
+
+		c := apiClient()
+		importSiad(c, cmd.Arg(0), importName, importLookahead, importAuxKeys, importRescan, importRescanHeight)
 	case configCmd:
 		if len(cmd.Args()) != 0 {
 			cmd.Usage()
@@ -359,8 +648,30 @@ func main() {
 			log.Fatal(err)
 		}
 
-		mustSetAPIPassword()
-		c := api.NewClient("http://"+cfg.HTTP.Address+"/api", cfg.HTTP.Password)
+		c := apiClient()
 		runCPUMiner(c, minerAddr, minerBlocks)
+	case hashPasswordCmd:
+		if len(cmd.Args()) != 0 {
+			cmd.Usage()
+			return
+		}
+
+		hashPassword()
+	case completionCmd:
+		if len(cmd.Args()) != 1 {
+			cmd.Usage()
+			return
+		}
+
+		switch cmd.Arg(0) {
+		case "bash":
+			writeBashCompletion(os.Stdout, tree)
+		case "zsh":
+			writeZshCompletion(os.Stdout, tree)
+		case "fish":
+			writeFishCompletion(os.Stdout, tree)
+		default:
+			fatalError(fmt.Errorf("unsupported shell %q: must be one of 'bash', 'zsh', or 'fish'", cmd.Arg(0)))
+		}
 	}
 }
@@ -6,16 +6,48 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/anomaly"
 	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/api/rosetta"
+	"go.thebigfile.com/walletd/approver"
+	"go.thebigfile.com/walletd/bandwidth"
 	"go.thebigfile.com/walletd/build"
 	"go.thebigfile.com/walletd/config"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/electrum"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/health"
+	"go.thebigfile.com/walletd/ibd"
+	"go.thebigfile.com/walletd/internal/handover"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/notify"
+	"go.thebigfile.com/walletd/operations"
 	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/secrets"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/peerscore"
+	"go.thebigfile.com/walletd/tags"
+	"go.thebigfile.com/walletd/threshold"
+	"go.thebigfile.com/walletd/totp"
+	"go.thebigfile.com/walletd/transfers"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/triggers"
+	"go.thebigfile.com/walletd/usage"
 	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/walletd/webhooks"
 	"go.sia.tech/web/walletd"
 	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/gateway"
@@ -43,6 +75,201 @@ func setupUPNP(ctx context.Context, port uint16, log *zap.Logger) (string, error
 	return d.ExternalIP()
 }
 
+// parseCurrency parses a currency from the config. An empty string is zero.
+func parseCurrency(s string) (types.Currency, error) {
+	if s == "" {
+		return types.ZeroCurrency, nil
+	}
+	return types.ParseCurrency(s)
+}
+
+// newAnomalyMonitor creates an anomaly monitor from its configuration.
+func newAnomalyMonitor(ac config.Anomaly, wm anomaly.WalletManager, alerter anomaly.Alerter, sched *jobs.Scheduler, log *zap.Logger) (*anomaly.Monitor, error) {
+	largeOutflow, err := parseCurrency(ac.LargeOutflow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse large outflow: %w", err)
+	}
+	dustThreshold, err := parseCurrency(ac.DustThreshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dust threshold: %w", err)
+	} else if ac.BalanceDrop < 0 || ac.BalanceDrop > 1 {
+		return nil, fmt.Errorf("balance drop must be between 0 and 1, got %v", ac.BalanceDrop)
+	}
+	feeBudget, err := parseCurrency(ac.FeeBudget)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fee budget: %w", err)
+	}
+
+	opts := []anomaly.Option{
+		anomaly.WithLogger(log),
+		anomaly.WithScheduler(sched),
+		anomaly.WithLargeOutflow(largeOutflow),
+		anomaly.WithDustDetection(dustThreshold, ac.DustAddresses),
+		anomaly.WithBalanceDrop(ac.BalanceDrop),
+		anomaly.WithFeeBudget(feeBudget),
+	}
+	if ac.Window > 0 {
+		opts = append(opts, anomaly.WithWindow(ac.Window))
+	}
+	return anomaly.NewMonitor(wm, alerter, opts...)
+}
+
+// newSignerManager creates a signer manager with the configured external
+// signers. Wallets without an assigned signer sign with their seed in ks.
+func newSignerManager(signers map[string]config.Signer, store signer.Store, cm signer.ChainManager, wm signer.WalletManager, ks signer.KeyStore, log *zap.Logger) (*signer.Manager, error) {
+	sm := signer.NewManager(store, cm, wm, signer.WithLogger(log), signer.WithKeyStore(ks))
+	for name, sc := range signers {
+		var s signer.Signer
+		switch sc.Type {
+		case "remote":
+			if sc.URL == "" {
+				sm.Close()
+				return nil, fmt.Errorf("remote signer %q requires a URL", name)
+			}
+			s = signer.NewRemoteSigner(sc.URL, sc.Password)
+		case "pkcs11":
+			ps, err := signer.NewPKCS11Signer(sc.Module, sc.TokenLabel, sc.PIN, sc.KeyLabels)
+			if err != nil {
+				sm.Close()
+				return nil, fmt.Errorf("failed to create PKCS#11 signer %q: %w", name, err)
+			}
+			s = ps
+		default:
+			sm.Close()
+			return nil, fmt.Errorf("signer %q has unknown type %q", name, sc.Type)
+		}
+		// add signers as they are created so they are closed on error
+		signer.WithSigner(name, s)(sm)
+	}
+	return sm, nil
+}
+
+// notificationChannel returns an option subscribing the configured
+// notification channel to events.
+func notificationChannel(n config.Notification) (webhooks.Option, error) {
+	scopes := n.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{webhooks.ScopeAll}
+	}
+
+	var ch webhooks.Channel
+	switch n.Type {
+	case "slack", "discord":
+		if u, err := url.Parse(n.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid %s webhook URL %q", n.Type, n.URL)
+		} else if n.Type == "slack" {
+			ch = notify.NewSlackChannel(n.URL)
+		} else {
+			ch = notify.NewDiscordChannel(n.URL)
+		}
+	case "smtp":
+		sc, err := notify.NewSMTPChannel(n.SMTP.Address, n.SMTP.Username, n.SMTP.Password, n.SMTP.From, n.SMTP.To)
+		if err != nil {
+			return nil, err
+		}
+		ch = sc
+	default:
+		return nil, fmt.Errorf("unknown notification type %q", n.Type)
+	}
+	return webhooks.WithChannel(ch, scopes, n.Events), nil
+}
+
+// eventWallet returns the wallet that a webhook event's data belongs to.
+func eventWallet(data any) (wallet.ID, bool) {
+	switch data := data.(type) {
+	case wallet.EventNotification:
+		return data.WalletID, true
+	case wallet.BalanceAlarmNotification:
+		return data.Alarm.WalletID, true
+	case payments.Batch:
+		return data.WalletID, true
+	case rotation.Rotation:
+		return data.WalletID, true
+	case rotation.Sweep:
+		return data.WalletID, true
+	case forwarding.Sweep:
+		return data.WalletID, true
+	case transfers.Transfer:
+		return data.From, true
+	case digest.Digest:
+		return data.WalletID, true
+	case escrow.Escrow:
+		return data.WalletID, true
+	case treasury.PendingTransaction:
+		return data.WalletID, true
+	default:
+		return 0, false
+	}
+}
+
+// newHTTPServer returns an HTTP server that serves the API under /api and
+// the web UI on all other paths.
+func newHTTPServer(api, web http.Handler) *http.Server {
+	return &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/api") {
+				r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api")
+				api.ServeHTTP(w, r)
+				return
+			}
+			web.ServeHTTP(w, r)
+		}),
+		ReadTimeout: 10 * time.Second,
+	}
+}
+
+const (
+	// defaultShutdownTimeout is how long in-flight API requests are given
+	// to complete when walletd stops, if not configured.
+	defaultShutdownTimeout = 30 * time.Second
+	// upgradeTimeout is how long a new process is given to take over the
+	// listeners.
+	upgradeTimeout = time.Minute
+)
+
+// shutdownHTTPServer stops a server gracefully, giving in-flight requests
+// until the timeout to complete before closing their connections.
+func shutdownHTTPServer(srv *http.Server, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+	}
+}
+
+// handleUpgrades hands the listeners over to a new walletd process when
+// SIGUSR2 is received. Once the new process has taken over, stop is called so
+// that this process shuts down.
+func handleUpgrades(ctx context.Context, stop func(), ls *handover.Set, password string, log *zap.Logger) {
+	signals := make(chan os.Signal, 1)
+	handover.Notify(signals)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+
+		log.Info("starting new process")
+		// the new process cannot prompt for the password
+		var env []string
+		if password != "" {
+			env = append(env, "WALLETD_API_PASSWORD="+password)
+		}
+		if err := ls.Upgrade(upgradeTimeout, env...); err != nil {
+			log.Error("upgrade failed", zap.Error(err))
+			continue
+		}
+		log.Info("new process took over listeners, shutting down")
+		stop()
+		return
+	}
+}
+
 func runNode(ctx context.Context, cfg config.Config, log *zap.Logger, enableDebug bool) error {
 	var network *consensus.Network
 	var genesisBlock types.Block
@@ -61,44 +288,82 @@ func runNode(ctx context.Context, cfg config.Config, log *zap.Logger, enableDebu
 		return errors.New("invalid network: must be one of 'mainnet', 'zen', or 'anagami'")
 	}
 
-	bdb, err := coreutils.OpenBoltChainDB(filepath.Join(cfg.Directory, "consensus.db"))
+	// listen before opening the consensus database. After an upgrade, the
+	// database stays locked until the old process exits, and connections
+	// wait in the inherited listeners' queues in the meantime.
+	ls, err := handover.New(cfg.Restart.ReusePort)
 	if err != nil {
-		return fmt.Errorf("failed to open consensus database: %w", err)
+		return fmt.Errorf("failed to initialize listeners: %w", err)
 	}
-	defer bdb.Close()
-
-	dbstore, tipState, err := chain.NewDBStore(bdb, network, genesisBlock)
+	syncerListener, err := listenSyncer(ls, cfg.Syncer)
 	if err != nil {
-		return fmt.Errorf("failed to create chain store: %w", err)
-	}
-	cm := chain.NewManager(dbstore, tipState)
-
-	syncerListener, err := net.Listen("tcp", cfg.Syncer.Address)
-	if err != nil {
-		return fmt.Errorf("failed to listen on %q: %w", cfg.Syncer.Address, err)
+		return err
 	}
 	defer syncerListener.Close()
 
-	httpListener, err := net.Listen("tcp", cfg.HTTP.Address)
+	httpListener, err := ls.Listen("http", cfg.HTTP.Address)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %q: %w", cfg.HTTP.Address, err)
 	}
 	defer httpListener.Close()
 
-	syncerAddr := syncerListener.Addr().String()
-	if cfg.Syncer.EnableUPnP {
-		_, portStr, _ := net.SplitHostPort(cfg.Syncer.Address)
-		port, err := strconv.ParseUint(portStr, 10, 16)
+	var publicListener net.Listener
+	if cfg.HTTP.PublicAddress != "" {
+		publicListener, err = ls.Listen("http.public", cfg.HTTP.PublicAddress)
 		if err != nil {
-			return fmt.Errorf("failed to parse syncer port: %w", err)
+			return fmt.Errorf("failed to listen on %q: %w", cfg.HTTP.PublicAddress, err)
 		}
+		defer publicListener.Close()
+	}
+	if ls.Inherited() {
+		if err := ls.Ready(); err != nil {
+			return fmt.Errorf("failed to take over listeners: %w", err)
+		}
+		log.Info("took over listeners from previous process")
+	}
 
-		ip, err := setupUPNP(context.Background(), uint16(port), log)
+	bdb, err := coreutils.OpenBoltChainDB(filepath.Join(cfg.Directory, "consensus.db"))
+	if err != nil {
+		return fmt.Errorf("failed to open consensus database: %w", err)
+	}
+	defer bdb.Close()
+
+	dbstore, tipState, err := chain.NewDBStore(bdb, network, genesisBlock)
+	if err != nil {
+		return fmt.Errorf("failed to create chain store: %w", err)
+	}
+	cm := chain.NewManager(dbstore, tipState)
+
+	syncerAddr := listenerAddress(syncerListener.Addrs())
+	if cfg.Syncer.EnableUPnP || cfg.Syncer.EnableNATPMP {
+		port, err := listenerPort(syncerListener.Addr())
 		if err != nil {
-			log.Warn("failed to set up UPnP", zap.Error(err))
-		} else {
-			syncerAddr = net.JoinHostPort(ip, portStr)
+			return err
+		}
+
+		if cfg.Syncer.EnableUPnP {
+			ip, err := setupUPNP(context.Background(), port, log)
+			if err != nil {
+				log.Warn("failed to set up UPnP", zap.Error(err))
+			} else {
+				syncerAddr = net.JoinHostPort(ip, strconv.Itoa(int(port)))
+			}
+		}
+		if cfg.Syncer.EnableNATPMP {
+			addr, unmap, err := setupNATPMP(port, log)
+			if err != nil {
+				log.Warn("failed to set up NAT-PMP", zap.Error(err))
+			} else {
+				defer unmap()
+				syncerAddr = addr
+			}
+		}
+	}
+	if cfg.Syncer.AdvertiseAddress != "" {
+		if _, _, err := net.SplitHostPort(cfg.Syncer.AdvertiseAddress); err != nil {
+			return fmt.Errorf("invalid advertise address %q: %w", cfg.Syncer.AdvertiseAddress, err)
 		}
+		syncerAddr = cfg.Syncer.AdvertiseAddress
 	}
 
 	// peers will reject us if our hostname is empty or unspecified, so use loopback
@@ -107,7 +372,11 @@ func runNode(ctx context.Context, cfg config.Config, log *zap.Logger, enableDebu
 		syncerAddr = net.JoinHostPort("127.0.0.1", port)
 	}
 
-	store, err := sqlite.OpenDatabase(filepath.Join(cfg.Directory, "walletd.sqlite3"), log.Named("sqlite3"))
+	enrichers := wallet.RegisteredEventEnrichers()
+	for _, ne := range enrichers {
+		log.Info("event enricher registered", zap.String("name", ne.Name))
+	}
+	store, err := sqlite.OpenDatabase(filepath.Join(cfg.Directory, "walletd.sqlite3"), log.Named("sqlite3"), sqlite.WithSlowQueryThreshold(cfg.Database.SlowQueryThreshold), sqlite.WithReadConnections(cfg.Database.ReadConnections), sqlite.WithEventRetention(cfg.Database.EventRetention), sqlite.WithEventEnrichers(enrichers))
 	if err != nil {
 		return fmt.Errorf("failed to open wallet database: %w", err)
 	}
@@ -137,41 +406,410 @@ func runNode(ctx context.Context, cfg config.Config, log *zap.Logger, enableDebu
 		NetAddress: syncerAddr,
 	}
 
-	s := syncer.New(syncerListener, cm, ps, header, syncer.WithLogger(log.Named("syncer")))
+	// connections dialed by the syncer cannot be wrapped, so only inbound
+	// peers are accounted for and rate limited
+	bm := bandwidth.NewMonitor(cfg.Syncer.MaxUploadRate)
+	sched := jobs.NewScheduler(jobs.WithLogger(log.Named("jobs")))
+	sc := peerscore.NewScorer(ps, peerscore.WithLogger(log.Named("peerscore")), peerscore.WithScheduler(sched))
+	defer sc.Close()
+	relayCM, relayOpts, err := relayPolicy(cfg.Syncer.Relay, cm)
+	if err != nil {
+		return err
+	}
+	syncerOpts := append(relayOpts, syncerTuningOptions(cfg.Syncer)...)
+	s := syncer.New(bm.Listener(syncerListener), relayCM, sc, header, append(syncerOpts, syncer.WithLogger(log.Named("syncer")))...)
 	defer s.Close()
 	go s.Run(ctx)
+	if err := sc.Start(s); err != nil {
+		return fmt.Errorf("failed to start peer scoring: %w", err)
+	}
+
+	for tenant, keys := range cfg.HTTP.Tenants {
+		for _, key := range keys {
+			if _, ok := cfg.HTTP.SigningKeys[key]; !ok {
+				return fmt.Errorf("tenant %q references unknown signing key %q", tenant, key)
+			}
+		}
+	}
+
+	whmOpts := []webhooks.Option{
+		webhooks.WithLogger(log.Named("webhooks")),
+		webhooks.WithTenantResolver(func(_ string, data any) (string, bool) {
+			walletID, ok := eventWallet(data)
+			if !ok {
+				return "", false
+			}
+			tenant, err := store.WalletTenant(walletID)
+			return tenant, err == nil && tenant != ""
+		}),
+		webhooks.WithScopeResolver(func(scope string, data any) (string, bool) {
+			walletID, ok := eventWallet(data)
+			if !ok {
+				return "", false
+			}
+			return wallet.WalletScope(scope, walletID), true
+		}),
+	}
+	for i, n := range cfg.Notifications {
+		opt, err := notificationChannel(n)
+		if err != nil {
+			return fmt.Errorf("failed to configure notification %d: %w", i, err)
+		}
+		whmOpts = append(whmOpts, opt)
+	}
+	whm, err := webhooks.NewManager(store, whmOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook manager: %w", err)
+	}
+	defer whm.Close()
+
+	am := alerts.NewManager(alerts.WithLogger(log.Named("alerts")), alerts.WithEventBroadcaster(whm))
 
-	wm, err := wallet.NewManager(cm, store, wallet.WithLogger(log.Named("wallet")), wallet.WithIndexMode(cfg.Index.Mode), wallet.WithSyncBatchSize(cfg.Index.BatchSize))
+	tgm, err := tags.NewManager(store, tags.WithLogger(log.Named("tags")), tags.WithScheduler(sched), tags.WithFeed(cfg.Tags.FeedURL, cfg.Tags.FeedInterval))
+	if err != nil {
+		return fmt.Errorf("failed to create tag manager: %w", err)
+	}
+	defer tgm.Close()
+
+	wm, err := wallet.NewManager(cm, store,
+		wallet.WithLogger(log.Named("wallet")),
+		wallet.WithCounterpartyLookup(func(addr types.Address) (string, string, bool) {
+			t, ok := tgm.Tag(addr)
+			return t.Label, t.Category, ok
+		}),
+		wallet.WithIndexMode(cfg.Index.Mode),
+		wallet.WithSyncBatchSize(cfg.Index.BatchSize),
+		wallet.WithIngestQueueSize(cfg.Index.QueueSize),
+		wallet.WithCatchUpThreshold(cfg.Index.CatchUpThreshold),
+		wallet.WithEventBroadcaster(whm),
+		wallet.WithAlerter(am),
+		wallet.WithMaxReorgDepth(cfg.Index.MaxReorgDepth, am))
 	if err != nil {
 		return fmt.Errorf("failed to create wallet manager: %w", err)
 	}
 	defer wm.Close()
 
+	syncStages := ibd.NewTracker()
+	go trackSyncStages(ctx, syncStages, cm, wm, func() int { return len(s.Peers()) }, log.Named("sync"))
+
+	tm := treasury.NewManager(store, wm, treasury.WithLogger(log.Named("treasury")), treasury.WithEventBroadcaster(whm))
+
+	pm, err := payments.NewManager(store, cm, wm,
+		payments.WithLogger(log.Named("payments")),
+		payments.WithScheduler(sched),
+		payments.WithEventBroadcaster(whm),
+		payments.WithMaxDelay(cfg.Payments.MaxDelay),
+		payments.WithMaxSize(cfg.Payments.MaxSize))
+	if err != nil {
+		return fmt.Errorf("failed to create payment manager: %w", err)
+	}
+	defer pm.Close()
+
+	quotas := make(map[string]usage.Quota)
+	for tenant, q := range cfg.Usage.Quotas {
+		if _, ok := cfg.HTTP.Tenants[tenant]; !ok {
+			return fmt.Errorf("quota references unknown tenant %q", tenant)
+		}
+		quotas[tenant] = usage.Quota(q)
+	}
+	um, err := usage.NewManager(store,
+		usage.WithLogger(log.Named("usage")),
+		usage.WithScheduler(sched),
+		usage.WithDefaultQuota(usage.Quota(cfg.Usage.DefaultQuota)),
+		usage.WithQuotas(quotas))
+	if err != nil {
+		return fmt.Errorf("failed to create usage manager: %w", err)
+	}
+	defer um.Close()
+
+	thm := threshold.NewManager(store, cm, threshold.WithLogger(log.Named("threshold")))
+
+	trm, err := triggers.NewManager(store, cm, whm, triggers.WithLogger(log.Named("triggers")))
+	if err != nil {
+		return fmt.Errorf("failed to create trigger manager: %w", err)
+	}
+	defer trm.Close()
+
+	rotationOpts := []rotation.Option{
+		rotation.WithLogger(log.Named("rotation")),
+		rotation.WithScheduler(sched),
+		rotation.WithEventBroadcaster(whm),
+		rotation.WithInterval(cfg.Rotation.SweepInterval),
+		rotation.WithMaxInputs(cfg.Rotation.MaxInputs),
+	}
+	backupAlertThreshold, err := parseCurrency(cfg.KeyStore.BackupAlertThreshold)
+	if err != nil {
+		return fmt.Errorf("failed to parse backup alert threshold: %w", err)
+	}
+	ks, err := keystore.NewManager(store, wm,
+		keystore.WithLogger(log.Named("keystore")),
+		keystore.WithScheduler(sched),
+		keystore.WithDefaultTimeout(cfg.KeyStore.UnlockTimeout),
+		keystore.WithMaxTimeout(cfg.KeyStore.MaxUnlockTimeout),
+		keystore.WithBackupAlerts(am, backupAlertThreshold))
+	if err != nil {
+		return fmt.Errorf("failed to create keystore: %w", err)
+	}
+	defer ks.Close()
+	totpm := totp.NewManager(store, totp.WithLogger(log.Named("totp")))
+
+	authOpt := api.WithBasicAuth(cfg.HTTP.Password)
+	if cfg.Secrets.Backend != "" {
+		p, err := newSecretsProvider(cfg.Secrets)
+		if err != nil {
+			return fmt.Errorf("failed to create secrets provider: %w", err)
+		}
+		secretsm, err := secrets.NewManager(p,
+			secrets.WithLogger(log.Named("secrets")),
+			secrets.WithScheduler(sched),
+			secrets.WithRefreshInterval(cfg.Secrets.RefreshInterval),
+			secrets.WithAPIPassword(cfg.Secrets.APIPassword),
+			secrets.WithSeeds(ks, cfg.Secrets.Seeds))
+		if err != nil {
+			return fmt.Errorf("failed to fetch secrets: %w", err)
+		}
+		defer secretsm.Close()
+		if cfg.Secrets.APIPassword != "" {
+			authOpt = api.WithPasswordSource(secretsm)
+		}
+	}
+	sm, err := newSignerManager(cfg.Signers, store, cm, wm, ks, log.Named("signer"))
+	if err != nil {
+		return fmt.Errorf("failed to create signer manager: %w", err)
+	}
+	defer sm.Close()
+	rotationOpts = append(rotationOpts, rotation.WithSigner(sm), rotation.WithTreasuryManager(tm))
+	rm, err := rotation.NewManager(store, cm, s, wm, rotationOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to create rotation manager: %w", err)
+	}
+	defer rm.Close()
+
+	fm, err := forwarding.NewManager(store, cm, s, wm,
+		forwarding.WithLogger(log.Named("forwarding")),
+		forwarding.WithScheduler(sched),
+		forwarding.WithEventBroadcaster(whm),
+		forwarding.WithSigner(sm),
+		forwarding.WithTreasuryManager(tm),
+		forwarding.WithInterval(cfg.Forwarding.SweepInterval),
+		forwarding.WithMinConfirmations(cfg.Forwarding.MinConfirmations),
+		forwarding.WithMaxInputs(cfg.Forwarding.MaxInputs))
+	if err != nil {
+		return fmt.Errorf("failed to create forwarding manager: %w", err)
+	}
+	defer fm.Close()
+
+	tfm, err := transfers.NewManager(store, cm, s, wm,
+		transfers.WithLogger(log.Named("transfers")),
+		transfers.WithEventBroadcaster(whm),
+		transfers.WithSigner(sm),
+		transfers.WithTreasuryManager(tm),
+		transfers.WithPreferLedger(cfg.Transfers.PreferLedger))
+	if err != nil {
+		return fmt.Errorf("failed to create transfer manager: %w", err)
+	}
+	defer tfm.Close()
+
+	dgm, err := digest.NewManager(store, wm,
+		digest.WithLogger(log.Named("digest")),
+		digest.WithAlertManager(am),
+		digest.WithEventBroadcaster(whm),
+		digest.WithScheduler(sched))
+	if err != nil {
+		return fmt.Errorf("failed to create digest manager: %w", err)
+	}
+	defer dgm.Close()
+
+	em, err := escrow.NewManager(store, cm, s, wm,
+		escrow.WithLogger(log.Named("escrow")),
+		escrow.WithScheduler(sched),
+		escrow.WithEventBroadcaster(whm),
+		escrow.WithSigner(sm),
+		escrow.WithTreasuryManager(tm),
+		escrow.WithInterval(cfg.Escrow.CheckInterval))
+	if err != nil {
+		return fmt.Errorf("failed to create escrow manager: %w", err)
+	}
+	defer em.Close()
+
+	maxIndexLag := uint64(10)
+	if cfg.Index.Mode == wallet.IndexModeNone {
+		maxIndexLag = 0 // the index is not updated
+	}
+	hm, err := health.NewMonitor(am,
+		health.WithLogger(log.Named("health")),
+		health.WithScheduler(sched),
+		health.WithIndexCheck(cm, store, maxIndexLag),
+		health.WithPeerCheck(func() int { return len(s.Peers()) }, 3),
+		health.WithWebhookCheck(whm),
+		health.WithDiskCheck(cfg.Directory),
+		health.WithClockCheck(cfg.Clock.NTPServers, cfg.Clock.MaxSkew))
+	if err != nil {
+		return fmt.Errorf("failed to create health monitor: %w", err)
+	}
+	defer hm.Close()
+
+	if cfg.Anomaly.Enabled {
+		monitor, err := newAnomalyMonitor(cfg.Anomaly, wm, am, sched, log.Named("anomaly"))
+		if err != nil {
+			return fmt.Errorf("failed to create anomaly monitor: %w", err)
+		}
+		defer monitor.Close()
+	}
+
+	if cfg.Electrum.Address != "" {
+		es, err := electrum.NewServer(cm, s, wm, electrum.WithLogger(log.Named("electrum")), electrum.WithTreasuryManager(tm))
+		if err != nil {
+			return fmt.Errorf("failed to create electrum server: %w", err)
+		}
+		defer es.Close()
+		electrumListener, err := ls.Listen("electrum", cfg.Electrum.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %q: %w", cfg.Electrum.Address, err)
+		}
+		defer electrumListener.Close()
+		go es.Serve(electrumListener)
+		log.Info("serving electrum protocol", zap.Stringer("address", electrumListener.Addr()))
+	}
+
+	if cfg.Rosetta.Address != "" {
+		rs, err := rosetta.NewServer(cm, s, wm, rosetta.WithLogger(log.Named("rosetta")), rosetta.WithTreasuryManager(tm))
+		if err != nil {
+			return fmt.Errorf("failed to create rosetta server: %w", err)
+		}
+		rosettaListener, err := ls.Listen("rosetta", cfg.Rosetta.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %q: %w", cfg.Rosetta.Address, err)
+		}
+		defer rosettaListener.Close()
+		rosettaServer := &http.Server{Handler: rs, ReadTimeout: 10 * time.Second}
+		defer rosettaServer.Close()
+		go rosettaServer.Serve(rosettaListener)
+		log.Info("serving rosetta api", zap.Stringer("address", rosettaListener.Addr()))
+	}
+
+	var apm *approver.Manager
+	if cfg.Approvers.Address != "" {
+		apm = approver.NewManager(store, tm, cm, s, approver.WithLogger(log.Named("approvers")))
+		defer apm.Close()
+		approverListener, err := ls.Listen("approvers", cfg.Approvers.Address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %q: %w", cfg.Approvers.Address, err)
+		}
+		defer approverListener.Close()
+		approverServer := &http.Server{Handler: apm, ReadHeaderTimeout: 10 * time.Second}
+		defer approverServer.Close()
+		go approverServer.Serve(approverListener)
+		log.Info("serving approver connections", zap.Stringer("address", approverListener.Addr()))
+	}
+
+	profile, err := api.ParseProfile(cfg.HTTP.Profile)
+	if err != nil {
+		return fmt.Errorf("failed to parse http profile: %w", err)
+	}
+	publicProfile, err := api.ParseProfile(cfg.HTTP.PublicProfile)
+	if err != nil {
+		return fmt.Errorf("failed to parse public http profile: %w", err)
+	}
+	currencyFormat, err := api.ParseCurrencyFormat(cfg.HTTP.CurrencyFormat)
+	if err != nil {
+		return fmt.Errorf("failed to parse http currency format: %w", err)
+	}
+
+	// long-running operations are canceled before the managers they use
+	// are closed
+	ops := operations.NewManager(operations.WithLogger(log.Named("operations")))
+	defer ops.Close()
+
+	// the public and private servers accept the same signing keys, so a
+	// signed request may only be used once across both
+	replay := api.NewReplayCache()
 	apiOpts := []api.ServerOption{
 		api.WithLogger(log.Named("api")),
 		api.WithPublicEndpoints(cfg.HTTP.PublicEndpoints),
-		api.WithBasicAuth(cfg.HTTP.Password),
+		api.WithProfile(profile),
+		api.WithCurrencyFormat(currencyFormat),
+		api.WithLegacySunset(cfg.HTTP.LegacySunset),
+		api.WithOperationManager(ops),
+		authOpt,
+		api.WithSigningKeys(cfg.HTTP.SigningKeys),
+		api.WithReplayCache(replay),
+		api.WithTenants(cfg.HTTP.Tenants),
+		api.WithWebhookManager(whm),
+		api.WithTreasuryManager(tm),
+		api.WithAlertManager(am),
+		api.WithTagManager(tgm),
+		api.WithPaymentManager(pm),
+		api.WithUsageManager(um),
+		api.WithThresholdManager(thm),
+		api.WithRotationManager(rm),
+		api.WithForwardingManager(fm),
+		api.WithTransferManager(tfm),
+		api.WithDigestManager(dgm),
+		api.WithEscrowManager(em),
+		api.WithTriggerManager(trm),
+		api.WithSignerManager(sm),
+		api.WithKeyStore(ks),
+		api.WithTOTPManager(totpm),
+		api.WithJobScheduler(sched),
+		api.WithClockMonitor(hm),
+		api.WithBandwidthMonitor(bm),
+		api.WithSyncTracker(syncStages),
+		api.WithPeerScorer(sc),
+		api.WithQueryMonitor(store),
+		api.WithPoolMonitor(store),
+	}
+	if cfg.NodeKeyFile != "" {
+		sk, err := loadNodeKey(cfg.NodeKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load node key: %w", err)
+		}
+		apiOpts = append(apiOpts, api.WithNodeKey(sk))
+		log.Info("signing wallet state attestations", zap.Stringer("publicKey", sk.PublicKey()))
+	}
+	if apm != nil {
+		apiOpts = append(apiOpts, api.WithApproverManager(apm))
+	}
+	if cfg.HTTP.GraphQL {
+		apiOpts = append(apiOpts, api.WithGraphQL())
 	}
 	if enableDebug {
 		apiOpts = append(apiOpts, api.WithDebug())
 	}
-	api := api.NewServer(cm, s, wm, apiOpts...)
-	web := walletd.Handler()
-	server := &http.Server{
-		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if strings.HasPrefix(r.URL.Path, "/api") {
-				r.URL.Path = strings.TrimPrefix(r.URL.Path, "/api")
-				api.ServeHTTP(w, r)
-				return
-			}
-			web.ServeHTTP(w, r)
-		}),
-		ReadTimeout: 10 * time.Second,
-	}
-	defer server.Close()
+	server := newHTTPServer(api.NewServer(cm, s, wm, apiOpts...), walletd.Handler())
+	defer shutdownHTTPServer(server, cfg.Restart.ShutdownTimeout)
 	go server.Serve(httpListener)
 
-	log.Info("node started", zap.String("network", network.Name), zap.Stringer("syncer", syncerListener.Addr()), zap.Stringer("http", httpListener.Addr()), zap.String("version", build.Version()), zap.String("commit", build.Commit()))
+	if publicListener != nil {
+		// the public router shares the same managers as the private one
+		publicAPI := api.NewServer(cm, s, wm,
+			api.WithLogger(log.Named("api.public")),
+			authOpt,
+			api.WithSigningKeys(cfg.HTTP.SigningKeys),
+			api.WithReplayCache(replay),
+			api.WithTenants(cfg.HTTP.Tenants),
+			api.WithTreasuryManager(tm),
+			api.WithTagManager(tgm),
+			api.WithUsageManager(um),
+			api.WithCurrencyFormat(currencyFormat),
+			api.WithLegacySunset(cfg.HTTP.LegacySunset),
+			api.WithOperationManager(ops),
+			api.WithProfile(publicProfile))
+		publicServer := newHTTPServer(publicAPI, http.NotFoundHandler())
+		defer shutdownHTTPServer(publicServer, cfg.Restart.ShutdownTimeout)
+		go publicServer.Serve(publicListener)
+		log.Info("serving public API", zap.Stringer("address", publicListener.Addr()), zap.String("profile", string(publicProfile)))
+	}
+
+	go logSyncProgress(ctx, cm, func() int { return len(s.Peers()) }, log.Named("sync"))
+
+	// inherited listeners of servers that are no longer enabled
+	ls.CloseUnused()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go handleUpgrades(ctx, cancel, ls, cfg.HTTP.Password, log.Named("upgrade"))
+
+	log.Info("node started", zap.String("network", network.Name), zap.Stringers("syncer", syncerListener.Addrs()), zap.String("advertised", syncerAddr), zap.Stringer("http", httpListener.Addr()), zap.String("version", build.Version()), zap.String("commit", build.Commit()))
 	<-ctx.Done()
 	log.Info("shutting down")
 	return nil
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// jsonOutput is set by the -json flag of the CLI subcommands. When true,
+// commands print machine-readable JSON to stdout instead of human-readable
+// text.
+var jsonOutput bool
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	check("Couldn't encode output:", enc.Encode(v))
+}
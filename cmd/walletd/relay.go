@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/coreutils/syncer"
+)
+
+// Relay policies of the syncer.
+const (
+	// relayFull relays blocks and transactions from peers.
+	relayFull = "full"
+	// relayBlocks relays blocks but ignores transactions from peers.
+	relayBlocks = "blocks"
+	// relayLeaf ignores transactions from peers and does not accept inbound
+	// peers, so blocks are only exchanged with outbound peers.
+	relayLeaf = "leaf"
+)
+
+// noRelayChainManager wraps a chain manager so that transactions relayed by
+// peers are reported as already known. The syncer neither adds them to the
+// txpool nor relays them. Transactions broadcast through the API are added
+// to the chain manager directly and are still relayed.
+type noRelayChainManager struct {
+	*chain.Manager
+}
+
+func (noRelayChainManager) AddPoolTransactions([]types.Transaction) (bool, error) {
+	return true, nil
+}
+
+func (noRelayChainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return true, nil
+}
+
+// relayPolicy returns the chain manager passed to the syncer and the syncer
+// options that implement a relay policy.
+func relayPolicy(policy string, cm *chain.Manager) (syncer.ChainManager, []syncer.Option, error) {
+	switch policy {
+	case "", relayFull:
+		return cm, nil, nil
+	case relayBlocks:
+		return noRelayChainManager{cm}, nil, nil
+	case relayLeaf:
+		return noRelayChainManager{cm}, []syncer.Option{syncer.WithMaxInboundPeers(0)}, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid relay policy %q: must be one of %q, %q, or %q", policy, relayFull, relayBlocks, relayLeaf)
+	}
+}
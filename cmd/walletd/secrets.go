@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/config"
+	"go.thebigfile.com/walletd/internal/password"
+	"go.thebigfile.com/walletd/secrets"
+	"golang.org/x/term"
+)
+
+// apiPasswordCredential is the name of the systemd credential containing the
+// API password. See systemd.exec(5) LoadCredential=.
+const apiPasswordCredential = "walletd-api-password"
+
+// readSecretFile reads a secret from a file, trimming any trailing newline.
+func readSecretFile(path string) (string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf), "\r\n"), nil
+}
+
+// loadSecrets loads the API password from the password file or a systemd
+// credential, if either is present. Secrets loaded from files take precedence
+// over the password set in the config file or environment.
+func loadSecrets() {
+	if cfg.HTTP.PasswordFile != "" {
+		pass, err := readSecretFile(cfg.HTTP.PasswordFile)
+		if err != nil {
+			fatalError(fmt.Errorf("failed to read API password file: %w", err))
+		}
+		cfg.HTTP.Password = pass
+		return
+	}
+
+	if dir := os.Getenv("CREDENTIALS_DIRECTORY"); dir != "" {
+		pass, err := readSecretFile(filepath.Join(dir, apiPasswordCredential))
+		if err == nil {
+			cfg.HTTP.Password = pass
+		} else if !os.IsNotExist(err) {
+			fatalError(fmt.Errorf("failed to read API password credential: %w", err))
+		}
+	}
+}
+
+// newSecretsProvider returns the provider of the configured secrets backend.
+func newSecretsProvider(sc config.Secrets) (secrets.Provider, error) {
+	switch sc.Backend {
+	case "vault":
+		return secrets.NewVaultProvider(sc.Vault.Address, sc.Vault.Mount, sc.Vault.Token, sc.Vault.TokenFile)
+	case "awskms":
+		return secrets.NewAWSKMSProvider(sc.AWSKMS.Region, sc.AWSKMS.Endpoint)
+	case "gcpkms":
+		return secrets.NewGCPKMSProvider(sc.GCPKMS.Key, sc.GCPKMS.Endpoint)
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", sc.Backend)
+	}
+}
+
+// loadNodeKey loads the key used to sign wallet state attestations from a
+// file containing its hex-encoded 32-byte seed.
+func loadNodeKey(path string) (types.PrivateKey, error) {
+	s, err := readSecretFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode seed: %w", err)
+	} else if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("seed must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+	return types.NewPrivateKeyFromSeed(seed), nil
+}
+
+// apiClient returns a client for the configured walletd API. If the
+// configured password is a hash, the plaintext password is read from stdin.
+func apiClient() *api.Client {
+	mustSetAPIPassword()
+	pass := cfg.HTTP.Password
+	if password.IsHash(pass) {
+		pass = readPasswordInput("Enter API password")
+	}
+	return api.NewClient("http://"+cfg.HTTP.Address+"/api", pass)
+}
+
+// hashPassword reads a password from stdin and prints its argon2id hash. If
+// stdin is not a terminal, the first line of stdin is used as the password.
+func hashPassword() {
+	var pass string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		pass = readPasswordInput("Enter password")
+		if readPasswordInput("Confirm password") != pass {
+			fatalError(fmt.Errorf("passwords do not match"))
+		}
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fatalError(fmt.Errorf("failed to read password: %w", err))
+		}
+		pass = strings.TrimRight(line, "\r\n")
+	}
+	if len(pass) < 4 {
+		fatalError(fmt.Errorf("password must be at least 4 characters"))
+	}
+
+	hash := password.Hash(pass)
+	if jsonOutput {
+		printJSON(struct {
+			Hash string `json:"hash"`
+		}{hash})
+		return
+	}
+	fmt.Println(hash)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+
+	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/internal/siad"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// importSiad creates a wallet from a legacy siad wallet database, registers
+// the addresses derived from its seeds, and rescans the chain so that the
+// wallet's history is indexed. The password is read from stdin and the seeds
+// are never sent to the server.
+func importSiad(c *api.Client, path, name string, lookahead, auxKeys uint64, rescan bool, rescanHeight uint64) {
+	if name == "" {
+		fatalError(fmt.Errorf("wallet name is required"))
+	}
+
+	password := readPasswordInput("Enter siad wallet password (the primary seed if no password was set)")
+	sw, err := siad.ReadWallet(path, password)
+	check("Couldn't read siad wallet:", err)
+	addrs := sw.Addresses(lookahead, auxKeys)
+	auxSeeds, watched := len(sw.AuxiliarySeeds), len(sw.WatchedAddresses)
+	// only the derived addresses are needed
+	sw.Close()
+
+	w, err := c.AddWallet(api.WalletUpdateRequest{
+		Name:        name,
+		Description: fmt.Sprintf("imported from %s", path),
+	})
+	check("Couldn't create wallet:", err)
+	wc := c.Wallet(w.ID)
+	var conflicts int
+	for i, addr := range addrs {
+		result, err := wc.AddAddressWithResult(addr)
+		if err != nil {
+			fatalError(fmt.Errorf("couldn't add address %d of %d to wallet %v: %w", i+1, len(addrs), w.ID, err))
+		} else if result.Status == wallet.AddressConflict {
+			conflicts++
+		}
+	}
+	if rescan {
+		check("Couldn't start rescan:", c.Rescan(rescanHeight))
+	}
+
+	if jsonOutput {
+		printJSON(struct {
+			WalletID       wallet.ID `json:"walletID"`
+			Addresses      int       `json:"addresses"`
+			AuxiliarySeeds int       `json:"auxiliarySeeds"`
+			Watched        int       `json:"watchedAddresses"`
+			Conflicts      int       `json:"conflicts"`
+			Rescan         bool      `json:"rescan"`
+			RescanHeight   uint64    `json:"rescanHeight"`
+		}{w.ID, len(addrs), auxSeeds, watched, conflicts, rescan, rescanHeight})
+		return
+	}
+	fmt.Printf("Created wallet %v with %d addresses (%d auxiliary seeds, %d watched addresses)\n", w.ID, len(addrs), auxSeeds, watched)
+	if conflicts > 0 {
+		fmt.Printf("Warning: %d addresses are also in other wallets\n", conflicts)
+	}
+	if rescan {
+		fmt.Printf("Rescanning from height %d; run 'walletd status' to follow its progress\n", rescanHeight)
+	}
+}
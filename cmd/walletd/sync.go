@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/coreutils/syncer"
+	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/config"
+	"go.thebigfile.com/walletd/ibd"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+const (
+	// syncedThreshold is the maximum age of the tip block for the node to be
+	// considered synced.
+	syncedThreshold = 3 * time.Hour
+	// syncLogInterval is the interval at which sync progress is logged
+	// during the initial sync.
+	syncLogInterval = 30 * time.Second
+	// syncStageInterval is the interval at which the stages of the initial
+	// sync are updated.
+	syncStageInterval = time.Second
+)
+
+type syncProgress struct {
+	Height          uint64
+	EstimatedHeight uint64
+	Synced          bool
+}
+
+// Percent returns the sync progress as a percentage.
+func (sp syncProgress) Percent() float64 {
+	if sp.Synced || sp.EstimatedHeight == 0 {
+		return 100
+	}
+	return float64(sp.Height) / float64(sp.EstimatedHeight) * 100
+}
+
+// estimateSyncProgress estimates the height of the network from the timestamp
+// of the tip block and the network's block interval.
+func estimateSyncProgress(cs consensus.State) syncProgress {
+	sp := syncProgress{
+		Height:          cs.Index.Height,
+		EstimatedHeight: cs.Index.Height,
+	}
+	age := time.Since(cs.PrevTimestamps[0])
+	if age < syncedThreshold {
+		sp.Synced = true
+		return sp
+	}
+	if cs.Network != nil && cs.Network.BlockInterval > 0 {
+		sp.EstimatedHeight += uint64(age / cs.Network.BlockInterval)
+	}
+	return sp
+}
+
+// syncerTuningOptions returns the syncer options that tune the initial sync.
+// Options that are not set use the syncer's defaults.
+func syncerTuningOptions(cfg config.Syncer) []syncer.Option {
+	var opts []syncer.Option
+	if cfg.MaxOutboundPeers > 0 {
+		opts = append(opts, syncer.WithMaxOutboundPeers(cfg.MaxOutboundPeers))
+	}
+	if cfg.BlocksPerRequest > 0 {
+		opts = append(opts, syncer.WithMaxSendBlocks(cfg.BlocksPerRequest))
+	}
+	if cfg.MaxInflightRPCs > 0 {
+		opts = append(opts, syncer.WithMaxInflightRPCs(cfg.MaxInflightRPCs))
+	}
+	if cfg.BlocksTimeout > 0 {
+		opts = append(opts, syncer.WithSendBlocksTimeout(cfg.BlocksTimeout))
+	}
+	if cfg.SyncInterval > 0 {
+		opts = append(opts, syncer.WithSyncInterval(cfg.SyncInterval))
+	}
+	return opts
+}
+
+// trackSyncStages updates the stages of the initial sync until they are
+// complete or the context is canceled.
+func trackSyncStages(ctx context.Context, tr *ibd.Tracker, cm *chain.Manager, wm *wallet.Manager, peers func() int, log *zap.Logger) {
+	t := time.NewTicker(syncStageInterval)
+	defer t.Stop()
+
+	for {
+		ingest := wm.IngestStatus()
+		tr.Update(ibd.Progress{
+			Peers:   peers(),
+			Height:  ingest.Tip.Height,
+			Synced:  estimateSyncProgress(cm.TipState()).Synced,
+			Indexed: ingest.Applied.Height,
+		})
+		if tr.Complete() {
+			fields := make([]zap.Field, 0, 3)
+			for _, stage := range tr.Status().Stages {
+				fields = append(fields, zap.Duration(stage.Name, stage.Elapsed.Round(time.Second)))
+			}
+			log.Info("initial sync stages complete", fields...)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// logSyncProgress periodically logs the progress of the initial sync until the
+// node is synced or the context is canceled.
+func logSyncProgress(ctx context.Context, cm *chain.Manager, peers func() int, log *zap.Logger) {
+	t := time.NewTicker(syncLogInterval)
+	defer t.Stop()
+
+	lastHeight := cm.Tip().Height
+	lastTime := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		sp := estimateSyncProgress(cm.TipState())
+		if sp.Synced {
+			log.Info("sync complete", zap.Uint64("height", sp.Height), zap.Int("peers", peers()))
+			return
+		}
+
+		fields := []zap.Field{
+			zap.Uint64("height", sp.Height),
+			zap.Uint64("estimatedHeight", sp.EstimatedHeight),
+			zap.String("progress", fmt.Sprintf("%.2f%%", sp.Percent())),
+			zap.Int("peers", peers()),
+		}
+		// estimate the remaining time from the rate since the last log
+		if elapsed := time.Since(lastTime); sp.Height > lastHeight && elapsed > 0 {
+			rate := float64(sp.Height-lastHeight) / elapsed.Seconds()
+			eta := time.Duration(float64(sp.EstimatedHeight-sp.Height)/rate) * time.Second
+			fields = append(fields, zap.Duration("eta", eta.Round(time.Second)))
+		}
+		log.Info("syncing", fields...)
+		lastHeight, lastTime = sp.Height, time.Now()
+	}
+}
+
+// printStatus prints the status of a running walletd node.
+func printStatus(c *api.Client) {
+	state, err := c.State()
+	check("Couldn't get node state:", err)
+	cs, err := c.ConsensusTipState()
+	check("Couldn't get consensus tip state:", err)
+	peers, err := c.SyncerPeers()
+	check("Couldn't get syncer peers:", err)
+	scan, err := c.ScanStatus()
+	check("Couldn't get scan status:", err)
+
+	sp := estimateSyncProgress(cs)
+	if jsonOutput {
+		resp := struct {
+			Version         string             `json:"version"`
+			Network         string             `json:"network"`
+			IndexMode       wallet.IndexMode   `json:"indexMode"`
+			StartTime       time.Time          `json:"startTime"`
+			Tip             types.ChainIndex   `json:"tip"`
+			Synced          bool               `json:"synced"`
+			Progress        float64            `json:"progress"`
+			EstimatedHeight uint64             `json:"estimatedHeight"`
+			Peers           int                `json:"peers"`
+			Scan            api.RescanResponse `json:"scan"`
+		}{state.Version, cs.Network.Name, state.IndexMode, state.StartTime, cs.Index, sp.Synced, sp.Percent(), sp.EstimatedHeight, len(peers), scan}
+		printJSON(resp)
+		return
+	}
+
+	fmt.Println("Version:", state.Version)
+	fmt.Println("Network:", cs.Network.Name)
+	fmt.Println("Index Mode:", state.IndexMode)
+	fmt.Println("Uptime:", time.Since(state.StartTime).Round(time.Second))
+	fmt.Println("Tip:", cs.Index)
+	if sp.Synced {
+		fmt.Println("Synced: yes")
+	} else {
+		fmt.Printf("Synced: no (%.2f%%, ~%d blocks remaining)\n", sp.Percent(), sp.EstimatedHeight-sp.Height)
+	}
+	fmt.Println("Peers:", len(peers))
+	if scan.Error != nil {
+		fmt.Println("Rescan: failed:", *scan.Error)
+	} else if !scan.StartTime.IsZero() && scan.Index.Height < cs.Index.Height {
+		fmt.Printf("Rescan: %d/%d\n", scan.Index.Height, cs.Index.Height)
+	}
+}
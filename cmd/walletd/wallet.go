@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/api"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func parseWalletID(s string) wallet.ID {
+	var id wallet.ID
+	if err := id.UnmarshalText([]byte(s)); err != nil {
+		fatalError(fmt.Errorf("invalid wallet ID %q: %w", s, err))
+	}
+	return id
+}
+
+func listWallets(c *api.Client) {
+	wallets, err := c.Wallets()
+	check("Couldn't get wallets:", err)
+	if jsonOutput {
+		printJSON(wallets)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tDescription\tCreated")
+	for _, wal := range wallets {
+		fmt.Fprintf(w, "%v\t%s\t%s\t%s\n", wal.ID, wal.Name, wal.Description, wal.DateCreated.Format(time.RFC3339))
+	}
+	check("Couldn't write output:", w.Flush())
+}
+
+func createWallet(c *api.Client, name, description string) {
+	if name == "" {
+		fatalError(fmt.Errorf("wallet name is required"))
+	}
+	w, err := c.AddWallet(api.WalletUpdateRequest{
+		Name:        name,
+		Description: description,
+	})
+	check("Couldn't create wallet:", err)
+	if jsonOutput {
+		printJSON(w)
+		return
+	}
+	fmt.Println("Created wallet", w.ID)
+}
+
+func printWalletBalance(c *api.Client, id wallet.ID) {
+	balance, err := c.Wallet(id).Balance()
+	check("Couldn't get wallet balance:", err)
+	if jsonOutput {
+		printJSON(balance)
+		return
+	}
+	fmt.Println("Siacoins:", balance.Siacoins)
+	fmt.Println("Immature Siacoins:", balance.ImmatureSiacoins)
+	fmt.Println("Siafunds:", balance.Siafunds)
+}
+
+func listWalletAddresses(c *api.Client, id wallet.ID) {
+	addresses, err := c.Wallet(id).Addresses()
+	check("Couldn't get wallet addresses:", err)
+	if jsonOutput {
+		printJSON(addresses)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Address\tDescription")
+	for _, addr := range addresses {
+		fmt.Fprintf(w, "%v\t%s\n", addr.Address, addr.Description)
+	}
+	check("Couldn't write output:", w.Flush())
+}
+
+// sendSiacoins funds, signs, and broadcasts a transaction sending siacoins
+// from the wallet. The wallet's keys are derived from a recovery phrase read
+// from stdin; the phrase is never sent to the server.
+func sendSiacoins(c *api.Client, id wallet.ID, amount types.Currency, dest types.Address, changeAddr types.Address, keys uint64) {
+	wc := c.Wallet(id)
+	if changeAddr == types.VoidAddress {
+		addresses, err := wc.Addresses()
+		check("Couldn't get wallet addresses:", err)
+		if len(addresses) == 0 {
+			fatalError(fmt.Errorf("wallet %v has no addresses", id))
+		}
+		changeAddr = addresses[0].Address
+	}
+
+	phrase := readPasswordInput("Enter recovery phrase")
+	var entropy [32]byte
+	if err := cwallet.SeedFromPhrase(&entropy, phrase); err != nil {
+		fatalError(fmt.Errorf("invalid recovery phrase: %w", err))
+	}
+	seed := wallet.NewSeedFromEntropy(&entropy)
+	keyIndices := make(map[types.Address]uint64, keys)
+	for i := uint64(0); i < keys; i++ {
+		keyIndices[types.StandardUnlockHash(seed.PublicKey(i))] = i
+	}
+
+	txn := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: dest, Value: amount}},
+	}
+	resp, err := wc.Fund(txn, amount, changeAddr)
+	check("Couldn't fund transaction:", err)
+	txn = resp.Transaction
+
+	parents := make([]types.SiacoinOutputID, 0, len(txn.SiacoinInputs))
+	for _, sci := range txn.SiacoinInputs {
+		parents = append(parents, sci.ParentID)
+	}
+	// release the funded inputs if the transaction is not broadcast
+	fail := func(context string, err error) {
+		if err := wc.Release(parents, nil); err != nil {
+			fmt.Fprintln(os.Stderr, "Couldn't release inputs:", err)
+		}
+		check(context, err)
+	}
+
+	cs, err := c.ConsensusTipState()
+	if err != nil {
+		fail("Couldn't get consensus tip state:", err)
+	}
+	// fill in the unlock conditions before signing, since the signatures
+	// cover the whole transaction. The fund endpoint does not return the
+	// parent elements, so look up each one to determine which key controls
+	// the input.
+	indices := make([]uint64, len(txn.SiacoinInputs))
+	for i, sci := range txn.SiacoinInputs {
+		parent, err := c.SiacoinOutput(sci.ParentID)
+		if err != nil {
+			fail("Couldn't get input:", fmt.Errorf("failed to get parent of input %v: %w", sci.ParentID, err))
+		}
+		index, ok := keyIndices[parent.SiacoinOutput.Address]
+		if !ok {
+			fail("Couldn't sign transaction:", fmt.Errorf("no key found for input %v", sci.ParentID))
+		}
+		indices[i] = index
+		txn.SiacoinInputs[i].UnlockConditions = types.StandardUnlockConditions(seed.PublicKey(index))
+		txn.Signatures = append(txn.Signatures, wallet.StandardTransactionSignature(types.Hash256(sci.ParentID)))
+	}
+	for i, index := range indices {
+		key := seed.PrivateKey(index)
+		wallet.SignTransaction(cs, &txn, i, key)
+		clear(key)
+	}
+	// the seed is no longer needed
+	clear(entropy[:])
+
+	txnset := append(resp.DependsOn, txn)
+	if err := c.TxpoolBroadcast(txnset, nil); err != nil {
+		fail("Couldn't broadcast transaction:", err)
+	}
+	if jsonOutput {
+		printJSON(struct {
+			ID types.TransactionID `json:"id"`
+		}{txn.ID()})
+		return
+	}
+	fmt.Println("Broadcast transaction", txn.ID())
+}
@@ -1,21 +1,103 @@
 package config
 
-import "go.thebigfile.com/walletd/wallet"
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+)
 
 type (
 	// HTTP contains the configuration for the HTTP server.
 	HTTP struct {
-		Address         string `yaml:"address,omitempty"`
-		Password        string `yaml:"password,omitempty"`
+		Address string `yaml:"address,omitempty"`
+		// Password is the API password. It may be plaintext or an argon2id
+		// hash generated by "walletd hash-password".
+		Password string `yaml:"password,omitempty"`
+		// PasswordFile is the path of a file containing the API password.
+		// If set, it takes precedence over Password.
+		PasswordFile    string `yaml:"passwordFile,omitempty"`
 		PublicEndpoints bool   `yaml:"publicEndpoints,omitempty"`
+		// Profile is the name of the endpoint exposure profile. One of
+		// "wallet-admin", "public-explorer", or "signer-only".
+		Profile string `yaml:"profile,omitempty"`
+
+		// PublicAddress is an optional second address to serve the API on.
+		// Only the routes exposed by PublicProfile are served on it, so
+		// that a safe subset of the API can be bound to a public interface
+		// while Address remains on localhost.
+		PublicAddress string `yaml:"publicAddress,omitempty"`
+		PublicProfile string `yaml:"publicProfile,omitempty"`
+
+		// CurrencyFormat is the default format of currency values in JSON
+		// responses, either "hastings" or "sc". Clients can override it
+		// with the Currency-Format header.
+		CurrencyFormat string `yaml:"currencyFormat,omitempty"`
+		// GraphQL enables the /graphql query endpoint.
+		GraphQL bool `yaml:"graphql,omitempty"`
+		// LegacySunset is the date after which the unversioned API routes
+		// may be removed in favor of /api/v2. It is sent in the Sunset
+		// header of their responses.
+		LegacySunset time.Time `yaml:"legacySunset,omitempty"`
+
+		// SigningKeys maps key IDs to secrets used to authenticate
+		// HMAC-signed requests.
+		SigningKeys map[string]string `yaml:"signingKeys,omitempty"`
+		// Tenants maps tenant names to the signing key IDs that belong to
+		// them. Tenant keys can only access their tenant's wallets,
+		// addresses, events, and webhooks.
+		Tenants map[string][]string `yaml:"tenants,omitempty"`
 	}
 
 	// Syncer contains the configuration for the consensus set syncer.
 	Syncer struct {
-		Address    string   `yaml:"address,omitempty"`
-		Bootstrap  bool     `yaml:"bootstrap,omitempty"`
-		EnableUPnP bool     `yaml:"enableUPnP,omitempty"`
-		Peers      []string `yaml:"peers,omitempty"`
+		Address string `yaml:"address,omitempty"`
+		// Addresses are additional addresses to listen on, e.g. an IPv6
+		// address alongside an IPv4 Address.
+		Addresses []string `yaml:"addresses,omitempty"`
+		// AdvertiseAddress, if set, is the address advertised to peers
+		// instead of the address discovered from the listeners or the
+		// router.
+		AdvertiseAddress string   `yaml:"advertiseAddress,omitempty"`
+		Bootstrap        bool     `yaml:"bootstrap,omitempty"`
+		EnableUPnP       bool     `yaml:"enableUPnP,omitempty"`
+		EnableNATPMP     bool     `yaml:"enableNATPMP,omitempty"`
+		Peers            []string `yaml:"peers,omitempty"`
+		// MaxUploadRate limits the rate, in bytes per second, at which
+		// data is sent to inbound peers. Zero is unlimited.
+		MaxUploadRate uint64 `yaml:"maxUploadRate,omitempty"`
+		// Relay is the relay policy. "full" relays blocks and transactions,
+		// "blocks" ignores transactions relayed by peers, and "leaf" also
+		// refuses inbound peers. Defaults to "full".
+		Relay string `yaml:"relay,omitempty"`
+
+		// The options below tune the initial sync. Zero uses the
+		// syncer's default.
+
+		// MaxOutboundPeers is the number of peers the syncer dials. More
+		// peers give it more candidates to download blocks from.
+		MaxOutboundPeers int `yaml:"maxOutboundPeers,omitempty"`
+		// BlocksPerRequest is the maximum number of blocks requested from,
+		// or sent to, a peer in a single RPC.
+		BlocksPerRequest uint64 `yaml:"blocksPerRequest,omitempty"`
+		// MaxInflightRPCs is the maximum number of RPCs a peer may have
+		// in flight at once.
+		MaxInflightRPCs int `yaml:"maxInflightRPCs,omitempty"`
+		// BlocksTimeout is the time allowed for a peer to send a batch of
+		// blocks before the syncer tries another peer.
+		BlocksTimeout time.Duration `yaml:"blocksTimeout,omitempty"`
+		// SyncInterval is how often the syncer asks its peers for new
+		// blocks.
+		SyncInterval time.Duration `yaml:"syncInterval,omitempty"`
+	}
+
+	// Clock contains the configuration for the clock skew check.
+	Clock struct {
+		// NTPServers are the servers the local clock is checked against, in
+		// order of preference. If empty, public NTP pools are used.
+		NTPServers []string `yaml:"ntpServers,omitempty"`
+		// MaxSkew is the clock offset above which an alert is raised. Zero
+		// disables the check.
+		MaxSkew time.Duration `yaml:"maxSkew,omitempty"`
 	}
 
 	// Consensus contains the configuration for the consensus set.
@@ -27,6 +109,273 @@ type (
 	Index struct {
 		Mode      wallet.IndexMode `yaml:"mode,omitempty"`
 		BatchSize int              `yaml:"batchSize,omitempty"`
+		// MaxReorgDepth pauses indexing when a reorg would revert more
+		// blocks until it is approved. Zero disables the limit.
+		MaxReorgDepth uint64 `yaml:"maxReorgDepth,omitempty"`
+		// QueueSize is the number of indexing jobs that can wait for the
+		// writer. Zero uses the default.
+		QueueSize int `yaml:"queueSize,omitempty"`
+		// CatchUpThreshold is the number of blocks the index must be
+		// behind the tip to sync in catch-up mode, which skips event
+		// notifications and defers secondary indexes. Zero disables
+		// catch-up mode.
+		CatchUpThreshold uint64 `yaml:"catchUpThreshold,omitempty"`
+	}
+
+	// Database contains the configuration for the wallet database.
+	Database struct {
+		// SlowQueryThreshold is the duration after which a query is logged
+		// as slow and counted in /metrics. Zero disables slow query
+		// logging.
+		SlowQueryThreshold time.Duration `yaml:"slowQueryThreshold,omitempty"`
+		// ReadConnections is the maximum number of concurrent read
+		// transactions. Zero uses the number of CPUs, with a minimum
+		// of 4.
+		ReadConnections int `yaml:"readConnections,omitempty"`
+		// EventRetention is "full" to store the full transaction of each
+		// event, retrievable with /events/:id/raw, or "summary" to store
+		// it without signatures and arbitrary data.
+		EventRetention wallet.EventRetention `yaml:"eventRetention,omitempty"`
+	}
+
+	// Anomaly contains the configuration for the anomaly monitor. Currency
+	// values are strings such as "10 KS". Each check is disabled when its
+	// threshold is zero.
+	Anomaly struct {
+		Enabled bool          `yaml:"enabled,omitempty"`
+		Window  time.Duration `yaml:"window,omitempty"`
+		// LargeOutflow alerts when a single event sends more than the
+		// amount out of a wallet.
+		LargeOutflow string `yaml:"largeOutflow,omitempty"`
+		// DustThreshold and DustAddresses alert when at least DustAddresses
+		// addresses receive deposits smaller than DustThreshold within the
+		// window.
+		DustThreshold string `yaml:"dustThreshold,omitempty"`
+		DustAddresses int    `yaml:"dustAddresses,omitempty"`
+		// BalanceDrop alerts when a wallet's balance drops by at least the
+		// fraction (between 0 and 1) within the window.
+		BalanceDrop float64 `yaml:"balanceDrop,omitempty"`
+		// FeeBudget alerts when a wallet pays more than the amount in
+		// fees within the window.
+		FeeBudget string `yaml:"feeBudget,omitempty"`
+	}
+
+	// Payments contains the configuration for the payment batching queue.
+	Payments struct {
+		// MaxDelay is how long a payment can wait in the queue before the
+		// queue is flushed.
+		MaxDelay time.Duration `yaml:"maxDelay,omitempty"`
+		// MaxSize is the maximum number of payments in a batch. A queue is
+		// flushed as soon as it reaches this size.
+		MaxSize int `yaml:"maxSize,omitempty"`
+	}
+
+	// KeyStore contains the configuration for encrypted wallet seeds.
+	KeyStore struct {
+		// UnlockTimeout is how long a wallet stays unlocked if the unlock
+		// request does not specify a timeout.
+		UnlockTimeout time.Duration `yaml:"unlockTimeout,omitempty"`
+		// MaxUnlockTimeout is the longest a wallet can be unlocked for.
+		MaxUnlockTimeout time.Duration `yaml:"maxUnlockTimeout,omitempty"`
+		// BackupAlertThreshold is the siacoin balance, e.g. "1 KS", at which
+		// a wallet with a stored seed whose backup was never verified
+		// raises an alert. If empty, every such wallet raises an alert.
+		BackupAlertThreshold string `yaml:"backupAlertThreshold,omitempty"`
+	}
+
+	// Rotation contains the configuration for key rotations.
+	Rotation struct {
+		// SweepInterval is how often the old addresses of active rotations
+		// are swept.
+		SweepInterval time.Duration `yaml:"sweepInterval,omitempty"`
+		// MaxInputs is the default maximum number of inputs in a sweep.
+		MaxInputs int `yaml:"maxInputs,omitempty"`
+	}
+
+	// Forwarding contains the configuration for deposit forwarding rules.
+	Forwarding struct {
+		// SweepInterval is how often the deposit addresses of forwarding
+		// rules are swept.
+		SweepInterval time.Duration `yaml:"sweepInterval,omitempty"`
+		// MinConfirmations is the default number of confirmations a
+		// deposit needs before it is forwarded.
+		MinConfirmations uint64 `yaml:"minConfirmations,omitempty"`
+		// MaxInputs is the maximum number of inputs in a sweep.
+		MaxInputs int `yaml:"maxInputs,omitempty"`
+	}
+
+	// Transfers contains the configuration for transfers between wallets.
+	Transfers struct {
+		// PreferLedger records transfers between wallets of the same
+		// operator as off-chain ledger entries unless an on-chain
+		// transfer is requested.
+		PreferLedger bool `yaml:"preferLedger,omitempty"`
+	}
+
+	// Escrow contains the configuration for 2-of-3 escrows.
+	Escrow struct {
+		// CheckInterval is how often pending escrows are checked for
+		// funding.
+		CheckInterval time.Duration `yaml:"checkInterval,omitempty"`
+	}
+
+	// Tags contains the configuration for the known-address directory.
+	Tags struct {
+		// FeedURL is the URL of a JSON feed of tags to import. Feed tags
+		// do not replace tags added through the API.
+		FeedURL      string        `yaml:"feedURL,omitempty"`
+		FeedInterval time.Duration `yaml:"feedInterval,omitempty"`
+	}
+
+	// Electrum contains the configuration for the Electrum-style
+	// compatibility server.
+	Electrum struct {
+		// Address is the address the server listens on. If empty, the
+		// server is disabled. The protocol is unauthenticated.
+		Address string `yaml:"address,omitempty"`
+	}
+
+	// Rosetta contains the configuration for the Rosetta API server.
+	Rosetta struct {
+		// Address is the address the server listens on. If empty, the
+		// server is disabled. The API is unauthenticated.
+		Address string `yaml:"address,omitempty"`
+	}
+
+	// Approvers contains the configuration for approver app connections.
+	Approvers struct {
+		// Address is the address approver apps connect to. If empty,
+		// approver apps are disabled.
+		Address string `yaml:"address,omitempty"`
+	}
+
+	// Restart contains the configuration for zero-downtime restarts.
+	Restart struct {
+		// ReusePort sets SO_REUSEPORT on the API and syncer listeners, so
+		// that a new process can listen on the same addresses while the
+		// old one is still running. Only supported on Linux, macOS, and
+		// FreeBSD.
+		ReusePort bool `yaml:"reusePort,omitempty"`
+		// ShutdownTimeout is how long in-flight API requests are given to
+		// complete when walletd stops.
+		ShutdownTimeout time.Duration `yaml:"shutdownTimeout,omitempty"`
+	}
+
+	// Vault contains the configuration for fetching secrets from the KV
+	// version 2 secrets engine of HashiCorp Vault.
+	Vault struct {
+		// Address is the address of the Vault server. If empty, the
+		// VAULT_ADDR environment variable is used.
+		Address string `yaml:"address,omitempty"`
+		// Mount is the mount path of the engine. Defaults to "secret".
+		Mount string `yaml:"mount,omitempty"`
+		// Token is the token used to authenticate. If empty, the
+		// VAULT_TOKEN environment variable is used. TokenFile, if set,
+		// takes precedence and is reread on every refresh.
+		Token     string `yaml:"token,omitempty"`
+		TokenFile string `yaml:"tokenFile,omitempty"`
+	}
+
+	// AWSKMS contains the configuration for decrypting secrets with AWS KMS.
+	AWSKMS struct {
+		// Region is the region of the KMS key. If empty, the AWS_REGION
+		// environment variable is used.
+		Region string `yaml:"region,omitempty"`
+		// Endpoint overrides the regional KMS endpoint.
+		Endpoint string `yaml:"endpoint,omitempty"`
+	}
+
+	// GCPKMS contains the configuration for decrypting secrets with GCP
+	// Cloud KMS.
+	GCPKMS struct {
+		// Key is the resource name of the key, e.g.
+		// "projects/p/locations/global/keyRings/r/cryptoKeys/k".
+		Key string `yaml:"key,omitempty"`
+		// Endpoint overrides the Cloud KMS API endpoint.
+		Endpoint string `yaml:"endpoint,omitempty"`
+	}
+
+	// Secrets contains the configuration for fetching the API password and
+	// wallet seeds from an external secrets backend.
+	Secrets struct {
+		// Backend is one of "vault", "awskms", or "gcpkms". If empty,
+		// secrets are not fetched.
+		Backend string `yaml:"backend,omitempty"`
+		// RefreshInterval is how often secrets are refetched so that they
+		// can be rotated. If zero, secrets are only fetched at startup.
+		RefreshInterval time.Duration `yaml:"refreshInterval,omitempty"`
+		// APIPassword is the reference of the API password. If set, it
+		// takes precedence over http.password.
+		APIPassword string `yaml:"apiPassword,omitempty"`
+		// Seeds maps wallet IDs to the references of their recovery
+		// phrases.
+		Seeds map[wallet.ID]string `yaml:"seeds,omitempty"`
+
+		Vault  Vault  `yaml:"vault,omitempty"`
+		AWSKMS AWSKMS `yaml:"awsKMS,omitempty"`
+		GCPKMS GCPKMS `yaml:"gcpKMS,omitempty"`
+	}
+
+	// Signer configures an external signer that holds wallet keys outside
+	// of walletd.
+	Signer struct {
+		// Type is either "remote" or "pkcs11".
+		Type string `yaml:"type"`
+
+		// URL is the endpoint of a remote signer. Password, if set, is sent
+		// with HTTP basic auth.
+		URL      string `yaml:"url,omitempty"`
+		Password string `yaml:"password,omitempty"`
+
+		// Module is the path of the PKCS#11 module. Keys are Ed25519 key
+		// pairs on the token identified by their labels.
+		Module     string   `yaml:"module,omitempty"`
+		TokenLabel string   `yaml:"tokenLabel,omitempty"`
+		PIN        string   `yaml:"pin,omitempty"`
+		KeyLabels  []string `yaml:"keyLabels,omitempty"`
+	}
+
+	// Quota limits a tenant's usage. Zero values are unlimited.
+	Quota struct {
+		// Calls is the maximum number of API calls per UTC day. Requests
+		// over the quota are rejected with 429 Too Many Requests.
+		Calls     uint64 `yaml:"calls,omitempty"`
+		Wallets   int    `yaml:"wallets,omitempty"`
+		Addresses int    `yaml:"addresses,omitempty"`
+	}
+
+	// Usage contains the configuration for API usage accounting and tenant
+	// quotas.
+	Usage struct {
+		// DefaultQuota applies to tenants not listed in Quotas.
+		DefaultQuota Quota            `yaml:"defaultQuota,omitempty"`
+		Quotas       map[string]Quota `yaml:"quotas,omitempty"`
+	}
+
+	// SMTP contains the configuration for sending email notifications.
+	SMTP struct {
+		// Address is the host:port of the SMTP server.
+		Address  string   `yaml:"address,omitempty"`
+		Username string   `yaml:"username,omitempty"`
+		Password string   `yaml:"password,omitempty"`
+		From     string   `yaml:"from,omitempty"`
+		To       []string `yaml:"to,omitempty"`
+	}
+
+	// Notification configures a notification channel. Channels receive the
+	// same events as webhooks.
+	Notification struct {
+		// Type is one of "smtp", "slack", or "discord".
+		Type string `yaml:"type"`
+		// URL is the incoming webhook URL of a Slack or Discord channel.
+		URL  string `yaml:"url,omitempty"`
+		SMTP SMTP   `yaml:"smtp,omitempty"`
+		// Scopes are the event scopes sent to the channel, e.g. "alerts"
+		// or "wallets". Defaults to all scopes.
+		Scopes []string `yaml:"scopes,omitempty"`
+		// Events optionally restricts the channel to events with the given
+		// names, e.g. "v2Transaction" or "register".
+		Events []string `yaml:"events,omitempty"`
 	}
 
 	// LogFile configures the file output of the logger.
@@ -59,10 +408,36 @@ type (
 		Directory     string `yaml:"directory,omitempty"`
 		AutoOpenWebUI bool   `yaml:"autoOpenWebUI,omitempty"`
 
-		HTTP      HTTP      `yaml:"http,omitempty"`
-		Consensus Consensus `yaml:"consensus,omitempty"`
-		Syncer    Syncer    `yaml:"syncer,omitempty"`
-		Log       Log       `yaml:"log,omitempty"`
-		Index     Index     `yaml:"index,omitempty"`
+		// NodeKeyFile is the path of a file containing the hex-encoded
+		// 32-byte seed of the key used to sign wallet state attestations.
+		// If empty, attestations are disabled.
+		NodeKeyFile string `yaml:"nodeKeyFile,omitempty"`
+
+		HTTP       HTTP       `yaml:"http,omitempty"`
+		Consensus  Consensus  `yaml:"consensus,omitempty"`
+		Syncer     Syncer     `yaml:"syncer,omitempty"`
+		Clock      Clock      `yaml:"clock,omitempty"`
+		Log        Log        `yaml:"log,omitempty"`
+		Index      Index      `yaml:"index,omitempty"`
+		Database   Database   `yaml:"database,omitempty"`
+		Anomaly    Anomaly    `yaml:"anomaly,omitempty"`
+		Tags       Tags       `yaml:"tags,omitempty"`
+		Payments   Payments   `yaml:"payments,omitempty"`
+		Rotation   Rotation   `yaml:"rotation,omitempty"`
+		Forwarding Forwarding `yaml:"forwarding,omitempty"`
+		Transfers  Transfers  `yaml:"transfers,omitempty"`
+		Escrow     Escrow     `yaml:"escrow,omitempty"`
+		KeyStore   KeyStore   `yaml:"keystore,omitempty"`
+		Usage      Usage      `yaml:"usage,omitempty"`
+		Electrum   Electrum   `yaml:"electrum,omitempty"`
+		Rosetta    Rosetta    `yaml:"rosetta,omitempty"`
+		Approvers  Approvers  `yaml:"approvers,omitempty"`
+		Secrets    Secrets    `yaml:"secrets,omitempty"`
+		Restart    Restart    `yaml:"restart,omitempty"`
+
+		Notifications []Notification `yaml:"notifications,omitempty"`
+		// Signers maps signer names to external signers. Signers are
+		// assigned to wallets with the API.
+		Signers map[string]Signer `yaml:"signers,omitempty"`
 	}
 )
@@ -0,0 +1,360 @@
+// Package digest sends periodic summaries of wallet activity, such as the
+// siacoins received and sent, fees paid, new addresses used, and alerts
+// raised, to webhooks and notification channels.
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ScopeDigests is the webhook scope of digests. Each digest is sent as an
+// event named after its frequency.
+const ScopeDigests = "digests"
+
+// eventsPerPage is the number of events loaded at a time when summarizing a
+// period.
+const eventsPerPage = 1000
+
+// Digest frequencies. Periods start at midnight UTC, and weeks start on
+// Monday.
+const (
+	FrequencyDaily  = "daily"
+	FrequencyWeekly = "weekly"
+)
+
+var (
+	// ErrNotFound is returned when a wallet does not have a digest
+	// schedule.
+	ErrNotFound = errors.New("digest not found")
+	// ErrInvalidFrequency is returned when a digest frequency is not
+	// daily or weekly.
+	ErrInvalidFrequency = errors.New("frequency must be daily or weekly")
+)
+
+type (
+	// A Schedule sends a wallet's digest at the end of every period.
+	Schedule struct {
+		WalletID  wallet.ID `json:"walletID"`
+		Frequency string    `json:"frequency"`
+		// LastPeriod is the end of the last period summarized. Periods
+		// ending before a schedule is created are not summarized.
+		LastPeriod time.Time `json:"lastPeriod"`
+	}
+
+	// A Digest summarizes a wallet's activity in a period.
+	Digest struct {
+		WalletID   wallet.ID `json:"walletID"`
+		WalletName string    `json:"walletName"`
+		Frequency  string    `json:"frequency"`
+		Start      time.Time `json:"start"`
+		End        time.Time `json:"end"`
+
+		// Received and Sent are the net siacoins of the events in the
+		// period, so change is not counted.
+		Received types.Currency `json:"received"`
+		Sent     types.Currency `json:"sent"`
+		Fees     types.Currency `json:"fees"`
+		Events   int            `json:"events"`
+		// Balance is the wallet's balance when the digest was generated.
+		Balance types.Currency `json:"balance"`
+		// NewAddresses are the wallet's addresses that were first used
+		// in the period.
+		NewAddresses []types.Address `json:"newAddresses"`
+		// Alerts are the active alerts about the wallet raised in the
+		// period.
+		Alerts []alerts.Alert `json:"alerts"`
+	}
+
+	// A Store persists digest schedules.
+	Store interface {
+		// WalletDigest returns a wallet's schedule. It returns
+		// ErrNotFound if the wallet does not have one.
+		WalletDigest(walletID wallet.ID) (Schedule, error)
+		// SetWalletDigest sets a wallet's schedule, replacing any
+		// existing schedule.
+		SetWalletDigest(Schedule) error
+		// RemoveWalletDigest removes a wallet's schedule. It returns
+		// ErrNotFound if the wallet does not have one.
+		RemoveWalletDigest(walletID wallet.ID) error
+		// WalletDigests returns every schedule.
+		WalletDigests() ([]Schedule, error)
+		// WalletAddressesFirstUsed returns the wallet's addresses whose
+		// first event is in [start, end).
+		WalletAddressesFirstUsed(walletID wallet.ID, start, end time.Time) ([]types.Address, error)
+	}
+
+	// A WalletManager provides the wallets and events to summarize.
+	WalletManager interface {
+		Wallets() ([]wallet.Wallet, error)
+		WalletEvents(ctx context.Context, id wallet.ID, offset, limit int) ([]wallet.Event, error)
+		WalletBalance(id wallet.ID) (wallet.Balance, error)
+		WalletFees(id wallet.ID, since time.Time) ([]wallet.FeeEntry, error)
+	}
+
+	// An AlertManager provides the active alerts.
+	AlertManager interface {
+		Active() []alerts.Alert
+	}
+
+	// An EventBroadcaster delivers digests to the webhooks subscribed to
+	// ScopeDigests.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager periodically sends the digests of wallets with a schedule.
+	Manager struct {
+		store  Store
+		wm     WalletManager
+		alerts AlertManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+
+		interval time.Duration
+
+		mu sync.Mutex // serializes sends
+	}
+)
+
+// periodStart returns the start of the period containing t.
+func periodStart(t time.Time, frequency string) (time.Time, error) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch frequency {
+	case FrequencyDaily:
+		return day, nil
+	case FrequencyWeekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), nil
+	default:
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidFrequency, frequency)
+	}
+}
+
+// periodLength returns the number of days in a period.
+func periodLength(frequency string) int {
+	if frequency == FrequencyWeekly {
+		return 7
+	}
+	return 1
+}
+
+// Schedule returns a wallet's digest schedule.
+func (m *Manager) Schedule(walletID wallet.ID) (Schedule, error) {
+	return m.store.WalletDigest(walletID)
+}
+
+// SetSchedule sends a wallet's digest daily or weekly. The first digest
+// summarizes the current period once it ends.
+func (m *Manager) SetSchedule(walletID wallet.ID, frequency string) (Schedule, error) {
+	start, err := periodStart(time.Now(), frequency)
+	if err != nil {
+		return Schedule{}, err
+	}
+	s := Schedule{WalletID: walletID, Frequency: frequency, LastPeriod: start}
+	if err := m.store.SetWalletDigest(s); err != nil {
+		return Schedule{}, err
+	}
+	return s, nil
+}
+
+// RemoveSchedule stops sending a wallet's digest.
+func (m *Manager) RemoveSchedule(walletID wallet.ID) error {
+	return m.store.RemoveWalletDigest(walletID)
+}
+
+// Preview returns the digest of the last complete period without sending it.
+func (m *Manager) Preview(walletID wallet.ID, frequency string) (Digest, error) {
+	end, err := periodStart(time.Now(), frequency)
+	if err != nil {
+		return Digest{}, err
+	}
+	wallets, err := m.wm.Wallets()
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to get wallets: %w", err)
+	}
+	for _, w := range wallets {
+		if w.ID == walletID {
+			return m.Generate(w, frequency, end.AddDate(0, 0, -periodLength(frequency)), end)
+		}
+	}
+	return Digest{}, wallet.ErrNotFound
+}
+
+// Generate summarizes a wallet's activity in [start, end).
+func (m *Manager) Generate(w wallet.Wallet, frequency string, start, end time.Time) (Digest, error) {
+	d := Digest{
+		WalletID:     w.ID,
+		WalletName:   w.Name,
+		Frequency:    frequency,
+		Start:        start,
+		End:          end,
+		NewAddresses: []types.Address{},
+		Alerts:       []alerts.Alert{},
+	}
+
+	// events are returned newest first
+	for offset := 0; ; offset += eventsPerPage {
+		events, err := m.wm.WalletEvents(context.Background(), w.ID, offset, eventsPerPage)
+		if err != nil {
+			return Digest{}, fmt.Errorf("failed to get events: %w", err)
+		}
+		var done bool
+		for _, ev := range events {
+			if ev.Timestamp.Before(start) {
+				done = true
+				break
+			} else if !ev.Timestamp.Before(end) {
+				continue
+			}
+			d.Events++
+			inflow, outflow := wallet.EventFlows(ev)
+			if inflow.Cmp(outflow) >= 0 {
+				d.Received = d.Received.Add(inflow.Sub(outflow))
+			} else {
+				d.Sent = d.Sent.Add(outflow.Sub(inflow))
+			}
+		}
+		if done || len(events) < eventsPerPage {
+			break
+		}
+	}
+
+	fees, err := m.wm.WalletFees(w.ID, start)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to get fees: %w", err)
+	}
+	for _, entry := range fees {
+		if entry.Timestamp.Before(end) {
+			d.Fees = d.Fees.Add(entry.Amount)
+		}
+	}
+
+	balance, err := m.wm.WalletBalance(w.ID)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to get balance: %w", err)
+	}
+	d.Balance = balance.Siacoins
+
+	addrs, err := m.store.WalletAddressesFirstUsed(w.ID, start, end)
+	if err != nil {
+		return Digest{}, fmt.Errorf("failed to get new addresses: %w", err)
+	}
+	d.NewAddresses = append(d.NewAddresses, addrs...)
+
+	if m.alerts != nil {
+		for _, a := range m.alerts.Active() {
+			if id, ok := a.Data["walletID"].(wallet.ID); ok && id == w.ID && !a.Timestamp.Before(start) && a.Timestamp.Before(end) {
+				d.Alerts = append(d.Alerts, a)
+			}
+		}
+	}
+	return d, nil
+}
+
+// send sends the digests of every schedule whose period has ended.
+func (m *Manager) send(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	schedules, err := m.store.WalletDigests()
+	if err != nil {
+		return fmt.Errorf("failed to get schedules: %w", err)
+	} else if len(schedules) == 0 {
+		return nil
+	}
+	wallets, err := m.wm.Wallets()
+	if err != nil {
+		return fmt.Errorf("failed to get wallets: %w", err)
+	}
+	byID := make(map[wallet.ID]wallet.Wallet, len(wallets))
+	for _, w := range wallets {
+		byID[w.ID] = w
+	}
+
+	var errs []error
+	for _, s := range schedules {
+		w, ok := byID[s.WalletID]
+		if !ok {
+			continue
+		}
+		end, err := periodStart(now, s.Frequency)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid schedule of wallet %d: %w", s.WalletID, err))
+			continue
+		} else if !s.LastPeriod.Before(end) {
+			continue
+		}
+		// only the last complete period is summarized, even if walletd
+		// was offline for several periods
+		d, err := m.Generate(w, s.Frequency, end.AddDate(0, 0, -periodLength(s.Frequency)), end)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to generate digest of wallet %d: %w", s.WalletID, err))
+			continue
+		}
+		if m.events != nil {
+			if err := m.events.BroadcastEvent(ScopeDigests, s.Frequency, d); err != nil {
+				errs = append(errs, fmt.Errorf("failed to send digest of wallet %d: %w", s.WalletID, err))
+				continue
+			}
+		}
+		s.LastPeriod = end
+		if err := m.store.SetWalletDigest(s); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update schedule of wallet %d: %w", s.WalletID, err))
+			continue
+		}
+		m.log.Debug("sent digest", zap.Int64("wallet", int64(s.WalletID)), zap.String("frequency", s.Frequency), zap.Time("end", end))
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops sending digests.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// NewManager creates a new digest manager and starts sending digests in the
+// background.
+func NewManager(store Store, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		interval: time.Hour,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "digests", "sends the daily and weekly digests of wallets", m.interval, true, func(context.Context) error {
+			err := m.send(time.Now())
+			if err != nil {
+				m.log.Warn("failed to send digests", zap.Error(err))
+			}
+			return err
+		})
+	}()
+	return m, nil
+}
@@ -0,0 +1,206 @@
+package digest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type mockStore struct {
+	schedules map[wallet.ID]Schedule
+	firstUsed map[types.Address]time.Time
+}
+
+func (s *mockStore) WalletDigest(id wallet.ID) (Schedule, error) {
+	sched, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, ErrNotFound
+	}
+	return sched, nil
+}
+
+func (s *mockStore) SetWalletDigest(sched Schedule) error {
+	s.schedules[sched.WalletID] = sched
+	return nil
+}
+
+func (s *mockStore) RemoveWalletDigest(id wallet.ID) error {
+	if _, ok := s.schedules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.schedules, id)
+	return nil
+}
+
+func (s *mockStore) WalletDigests() (schedules []Schedule, _ error) {
+	for _, sched := range s.schedules {
+		schedules = append(schedules, sched)
+	}
+	return schedules, nil
+}
+
+func (s *mockStore) WalletAddressesFirstUsed(_ wallet.ID, start, end time.Time) (addrs []types.Address, _ error) {
+	for addr, t := range s.firstUsed {
+		if !t.Before(start) && t.Before(end) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+type mockWalletManager struct {
+	wallets []wallet.Wallet
+	events  []wallet.Event // newest first
+	fees    []wallet.FeeEntry
+}
+
+func (m *mockWalletManager) Wallets() ([]wallet.Wallet, error) {
+	return m.wallets, nil
+}
+
+func (m *mockWalletManager) WalletEvents(_ context.Context, _ wallet.ID, offset, limit int) ([]wallet.Event, error) {
+	if offset >= len(m.events) {
+		return nil, nil
+	}
+	events := m.events[offset:]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (m *mockWalletManager) WalletBalance(wallet.ID) (wallet.Balance, error) {
+	return wallet.Balance{Siacoins: types.Siacoins(42)}, nil
+}
+
+func (m *mockWalletManager) WalletFees(_ wallet.ID, since time.Time) (entries []wallet.FeeEntry, _ error) {
+	for _, entry := range m.fees {
+		if !entry.Timestamp.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+type mockBroadcaster struct {
+	sent []Digest
+}
+
+func (b *mockBroadcaster) BroadcastEvent(scope, event string, data any) error {
+	b.sent = append(b.sent, data.(Digest))
+	return nil
+}
+
+func payout(ts time.Time, value types.Currency) wallet.Event {
+	return wallet.Event{
+		Timestamp: ts,
+		Data:      wallet.EventPayout{SiacoinElement: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Value: value}}},
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, 5, 15, 13, 30, 0, 0, time.UTC)
+	if start, err := periodStart(now, FrequencyDaily); err != nil {
+		t.Fatal(err)
+	} else if !start.Equal(time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected daily start %v", start)
+	}
+	if start, err := periodStart(now, FrequencyWeekly); err != nil {
+		t.Fatal(err)
+	} else if !start.Equal(time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected weekly start %v", start)
+	}
+	if _, err := periodStart(now, "hourly"); err == nil {
+		t.Fatal("expected error for invalid frequency")
+	}
+}
+
+func TestSend(t *testing.T) {
+	day := time.Date(2024, 5, 14, 0, 0, 0, 0, time.UTC)
+	now := day.Add(36 * time.Hour)
+
+	spent := types.Address{1}
+	recipient := types.Address{2}
+	send := wallet.Event{
+		Timestamp: day.Add(2 * time.Hour),
+		Relevant:  []types.Address{spent},
+		Data: wallet.EventV1Transaction{
+			Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Address: recipient, Value: types.Siacoins(3)},
+					{Address: spent, Value: types.Siacoins(6)},
+				},
+			},
+			SpentSiacoinElements: []types.SiacoinElement{{SiacoinOutput: types.SiacoinOutput{Address: spent, Value: types.Siacoins(10)}}},
+		},
+	}
+
+	store := &mockStore{
+		schedules: map[wallet.ID]Schedule{1: {WalletID: 1, Frequency: FrequencyDaily, LastPeriod: day}},
+		firstUsed: map[types.Address]time.Time{
+			{3}: day.Add(time.Hour),
+			{4}: day.Add(-time.Hour),
+		},
+	}
+	wm := &mockWalletManager{
+		wallets: []wallet.Wallet{{ID: 1, Name: "hot"}},
+		events: []wallet.Event{
+			payout(now, types.Siacoins(100)), // after the period
+			send,
+			payout(day.Add(time.Hour), types.Siacoins(5)),
+			payout(day.Add(-time.Hour), types.Siacoins(100)), // before the period
+		},
+		fees: []wallet.FeeEntry{
+			{Amount: types.Siacoins(1), Timestamp: day.Add(2 * time.Hour)},
+			{Amount: types.Siacoins(100), Timestamp: now},
+		},
+	}
+	am := alerts.NewManager()
+	am.Register(alerts.Alert{ID: types.Hash256{1}, Message: "in period", Data: map[string]any{"walletID": wallet.ID(1)}, Timestamp: day.Add(time.Hour)})
+	am.Register(alerts.Alert{ID: types.Hash256{2}, Message: "other wallet", Data: map[string]any{"walletID": wallet.ID(2)}, Timestamp: day.Add(time.Hour)})
+	eb := new(mockBroadcaster)
+
+	// the manager is not started, so the background job does not send
+	// digests for the current time
+	m := &Manager{store: store, wm: wm, alerts: am, events: eb, log: zaptest.NewLogger(t)}
+
+	if err := m.send(now); err != nil {
+		t.Fatal(err)
+	} else if len(eb.sent) != 1 {
+		t.Fatalf("expected 1 digest, got %d", len(eb.sent))
+	}
+	d := eb.sent[0]
+	switch {
+	case !d.Start.Equal(day) || !d.End.Equal(day.AddDate(0, 0, 1)):
+		t.Fatalf("unexpected period %v - %v", d.Start, d.End)
+	case d.Events != 2:
+		t.Fatalf("expected 2 events, got %d", d.Events)
+	case !d.Received.Equals(types.Siacoins(5)):
+		t.Fatalf("expected 5 SC received, got %v", d.Received)
+	case !d.Sent.Equals(types.Siacoins(4)):
+		t.Fatalf("expected 4 SC sent, got %v", d.Sent)
+	case !d.Fees.Equals(types.Siacoins(1)):
+		t.Fatalf("expected 1 SC fees, got %v", d.Fees)
+	case !d.Balance.Equals(types.Siacoins(42)):
+		t.Fatalf("expected 42 SC balance, got %v", d.Balance)
+	case len(d.NewAddresses) != 1 || d.NewAddresses[0] != (types.Address{3}):
+		t.Fatalf("unexpected new addresses %v", d.NewAddresses)
+	case len(d.Alerts) != 1 || d.Alerts[0].Message != "in period":
+		t.Fatalf("unexpected alerts %v", d.Alerts)
+	}
+
+	// the period is only summarized once
+	if !store.schedules[1].LastPeriod.Equal(d.End) {
+		t.Fatalf("expected last period %v, got %v", d.End, store.schedules[1].LastPeriod)
+	} else if err := m.send(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(eb.sent) != 1 {
+		t.Fatalf("expected 1 digest, got %d", len(eb.sent))
+	}
+}
@@ -0,0 +1,51 @@
+package digest
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithAlertManager includes the active alerts about a wallet in its digests.
+func WithAlertManager(am AlertManager) Option {
+	return func(m *Manager) {
+		m.alerts = am
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send digests to webhooks
+// and notification channels.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithInterval sets how often schedules are checked for ended periods. The
+// default is one hour.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.interval = d
+		}
+	}
+}
+
+// WithScheduler registers digest delivery as the "digests" job, so that a
+// missed digest can be sent without waiting for the next interval.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
@@ -0,0 +1,652 @@
+// Package electrum implements a compatibility server speaking an
+// Electrum-like JSON-RPC protocol, so light-wallet tooling built around
+// address subscriptions can be pointed at walletd. It requires the wallet
+// manager to index every address.
+//
+// Requests and responses are JSON-RPC 2.0 objects, one per line. The protocol
+// is unauthenticated; the server should only listen on trusted interfaces.
+package electrum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/build"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ProtocolVersion is the protocol version reported by server.version.
+const ProtocolVersion = "1.4"
+
+const (
+	maxLineSize = 1 << 20 // 1 MiB
+	// maxHistory is the maximum number of events returned for an address.
+	// Requests for larger histories fail, as they do in Electrum servers.
+	maxHistory = 10000
+	pageSize   = 1000
+)
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+type (
+	// A ChainManager manages the transaction pool.
+	ChainManager interface {
+		Tip() types.ChainIndex
+		AddV2PoolTransactions(index types.ChainIndex, txns []types.V2Transaction) (bool, error)
+	}
+
+	// A Syncer broadcasts transactions to peers.
+	Syncer interface {
+		BroadcastV2TransactionSet(index types.ChainIndex, txns []types.V2Transaction)
+	}
+
+	// A WalletManager provides the indexed state of addresses.
+	WalletManager interface {
+		IndexMode() wallet.IndexMode
+		Tip() (types.ChainIndex, error)
+		AddressBalance(address types.Address) (wallet.Balance, error)
+		AddressEvents(ctx context.Context, address types.Address, offset, limit int) ([]wallet.Event, error)
+		AddressUnconfirmedEvents(address types.Address) ([]wallet.Event, error)
+		AddressSiacoinOutputs(address types.Address, offset, limit int) ([]types.SiacoinElement, error)
+	}
+
+	// A TreasuryManager enforces wallet spending policies.
+	TreasuryManager interface {
+		BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error)
+	}
+
+	// A Server serves the protocol to connected clients.
+	Server struct {
+		cm  ChainManager
+		s   Syncer
+		wm  WalletManager
+		tm  TreasuryManager
+		log *zap.Logger
+		tg  *threadgroup.ThreadGroup
+
+		pollInterval     time.Duration
+		maxSubscriptions int
+	}
+)
+
+// A Header is the chain tip reported by blockchain.headers.subscribe.
+type Header struct {
+	Height uint64        `json:"height"`
+	ID     types.BlockID `json:"id"`
+}
+
+// A HistoryItem is an event in the history of an address. Unconfirmed events
+// have a height of 0.
+type HistoryItem struct {
+	TxHash types.Hash256 `json:"tx_hash"`
+	Height uint64        `json:"height"`
+	Type   string        `json:"type"`
+}
+
+// A BalanceResponse is the balance of an address. Unconfirmed is the signed
+// net change of unconfirmed events.
+type BalanceResponse struct {
+	Confirmed   types.Currency `json:"confirmed"`
+	Immature    types.Currency `json:"immature"`
+	Unconfirmed string         `json:"unconfirmed"`
+}
+
+// An Unspent is an unspent siacoin output of an address.
+type Unspent struct {
+	OutputID       types.SiacoinOutputID `json:"output_id"`
+	Value          types.Currency        `json:"value"`
+	MaturityHeight uint64                `json:"maturity_height"`
+}
+
+type (
+	rpcRequest struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params"`
+	}
+
+	rpcError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	rpcResponse struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result,omitempty"`
+		Error   *rpcError       `json:"error,omitempty"`
+	}
+
+	rpcNotification struct {
+		JSONRPC string `json:"jsonrpc"`
+		Method  string `json:"method"`
+		Params  []any  `json:"params"`
+	}
+)
+
+func (e *rpcError) Error() string { return e.Message }
+
+func invalidParams(format string, args ...any) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// parseParams decodes positional params into args.
+func parseParams(params json.RawMessage, args ...any) error {
+	var raw []json.RawMessage
+	if len(params) != 0 && !bytes.Equal(params, []byte("null")) {
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return invalidParams("params must be an array")
+		}
+	}
+	if len(raw) != len(args) {
+		return invalidParams("expected %d params, got %d", len(args), len(raw))
+	}
+	for i := range args {
+		if err := json.Unmarshal(raw[i], args[i]); err != nil {
+			return invalidParams("invalid param %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// A conn is a client connection and its subscriptions.
+type conn struct {
+	srv *Server
+	nc  net.Conn
+
+	wmu sync.Mutex // serializes writes
+
+	mu       sync.Mutex
+	headers  bool
+	lastTip  types.ChainIndex
+	statuses map[types.Address]string
+}
+
+func (c *conn) write(v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.nc.Write(append(buf, '\n'))
+	return err
+}
+
+func (c *conn) notify(method string, params ...any) error {
+	return c.write(rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// handle handles a single request. It returns nil if the request is a
+// notification.
+func (c *conn) handle(req rpcRequest) *rpcResponse {
+	resp := &rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if len(req.ID) == 0 {
+		resp.ID = json.RawMessage("null")
+	}
+	var result any
+	var err error
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		err = &rpcError{Code: codeInvalidRequest, Message: "invalid request"}
+	} else {
+		result, err = c.call(req.Method, req.Params)
+	}
+	if len(req.ID) == 0 && req.JSONRPC == "2.0" {
+		return nil
+	}
+
+	if err == nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		resp.Result = nil
+		var re *rpcError
+		if !errors.As(err, &re) {
+			re = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Error = re
+	}
+	return resp
+}
+
+func (c *conn) call(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "server.version":
+		// the client's name and protocol version are accepted but ignored
+		return []string{"walletd " + build.Version(), ProtocolVersion}, nil
+	case "server.ping":
+		return nil, parseParams(params)
+	case "blockchain.headers.subscribe":
+		if err := parseParams(params); err != nil {
+			return nil, err
+		}
+		tip, err := c.srv.wm.Tip()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get index tip: %w", err)
+		}
+		c.mu.Lock()
+		c.headers, c.lastTip = true, tip
+		c.mu.Unlock()
+		return Header{Height: tip.Height, ID: tip.ID}, nil
+	case "blockchain.address.subscribe":
+		var addr types.Address
+		if err := parseParams(params, &addr); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		_, ok := c.statuses[addr]
+		full := !ok && len(c.statuses) >= c.srv.maxSubscriptions
+		c.mu.Unlock()
+		if full {
+			return nil, invalidParams("too many subscriptions (max %d)", c.srv.maxSubscriptions)
+		}
+		status, err := c.srv.addressStatus(addr)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.statuses[addr] = status
+		c.mu.Unlock()
+		if status == "" {
+			return nil, nil
+		}
+		return status, nil
+	case "blockchain.address.unsubscribe":
+		var addr types.Address
+		if err := parseParams(params, &addr); err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		_, ok := c.statuses[addr]
+		delete(c.statuses, addr)
+		c.mu.Unlock()
+		return ok, nil
+	case "blockchain.address.get_history":
+		var addr types.Address
+		if err := parseParams(params, &addr); err != nil {
+			return nil, err
+		}
+		return c.srv.addressHistory(addr)
+	case "blockchain.address.get_balance":
+		var addr types.Address
+		if err := parseParams(params, &addr); err != nil {
+			return nil, err
+		}
+		return c.srv.addressBalance(addr)
+	case "blockchain.address.listunspent":
+		var addr types.Address
+		if err := parseParams(params, &addr); err != nil {
+			return nil, err
+		}
+		return c.srv.addressUnspent(addr)
+	case "blockchain.transaction.broadcast":
+		var raw string
+		if err := parseParams(params, &raw); err != nil {
+			return nil, err
+		}
+		buf, err := hex.DecodeString(raw)
+		if err != nil {
+			return nil, invalidParams("invalid transaction hex: %v", err)
+		}
+		var txn types.V2Transaction
+		dec := types.NewBufDecoder(buf)
+		txn.DecodeFrom(dec)
+		if err := dec.Err(); err != nil {
+			return nil, invalidParams("invalid transaction: %v", err)
+		}
+		return c.srv.broadcast(txn)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+	}
+}
+
+// poll notifies the client of changes to its subscriptions.
+func (c *conn) poll() error {
+	c.mu.Lock()
+	headers, lastTip := c.headers, c.lastTip
+	statuses := make(map[types.Address]string, len(c.statuses))
+	for addr, status := range c.statuses {
+		statuses[addr] = status
+	}
+	c.mu.Unlock()
+
+	if headers {
+		tip, err := c.srv.wm.Tip()
+		if err != nil {
+			return fmt.Errorf("failed to get index tip: %w", err)
+		} else if tip != lastTip {
+			c.mu.Lock()
+			c.lastTip = tip
+			c.mu.Unlock()
+			if err := c.notify("blockchain.headers.subscribe", Header{Height: tip.Height, ID: tip.ID}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for addr, prev := range statuses {
+		status, err := c.srv.addressStatus(addr)
+		if err != nil {
+			return err
+		} else if status == prev {
+			continue
+		}
+
+		c.mu.Lock()
+		_, ok := c.statuses[addr]
+		if ok {
+			c.statuses[addr] = status
+		}
+		c.mu.Unlock()
+		if !ok {
+			continue // unsubscribed in the meantime
+		}
+		var param any
+		if status != "" {
+			param = status
+		}
+		if err := c.notify("blockchain.address.subscribe", addr, param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serve reads requests from the connection until it is closed.
+func (c *conn) serve() error {
+	sc := bufio.NewScanner(c.nc)
+	sc.Buffer(make([]byte, 0, 4096), maxLineSize)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var resp any
+		if line[0] == '[' {
+			var reqs []json.RawMessage
+			if err := json.Unmarshal(line, &reqs); err != nil {
+				resp = rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: err.Error()}}
+			} else if len(reqs) == 0 {
+				resp = rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeInvalidRequest, Message: "empty batch"}}
+			} else {
+				var batch []*rpcResponse
+				for _, raw := range reqs {
+					var req rpcRequest
+					if err := json.Unmarshal(raw, &req); err != nil {
+						batch = append(batch, &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeInvalidRequest, Message: err.Error()}})
+					} else if r := c.handle(req); r != nil {
+						batch = append(batch, r)
+					}
+				}
+				if len(batch) == 0 {
+					continue
+				}
+				resp = batch
+			}
+		} else {
+			var req rpcRequest
+			if err := json.Unmarshal(line, &req); err != nil {
+				resp = rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: err.Error()}}
+			} else if r := c.handle(req); r != nil {
+				resp = r
+			} else {
+				continue
+			}
+		}
+		if err := c.write(resp); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// addressEvents returns the confirmed events of an address, oldest first.
+func (s *Server) addressEvents(addr types.Address) ([]wallet.Event, error) {
+	var events []wallet.Event
+	for {
+		page, err := s.wm.AddressEvents(context.Background(), addr, len(events), pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get address events: %w", err)
+		}
+		events = append(events, page...)
+		if len(events) > maxHistory {
+			return nil, &rpcError{Code: codeInternalError, Message: fmt.Sprintf("history too large (max %d events)", maxHistory)}
+		} else if len(page) < pageSize {
+			break
+		}
+	}
+	for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+		events[i], events[j] = events[j], events[i]
+	}
+	return events, nil
+}
+
+func (s *Server) addressHistory(addr types.Address) ([]HistoryItem, error) {
+	events, err := s.addressEvents(addr)
+	if err != nil {
+		return nil, err
+	}
+	unconfirmed, err := s.wm.AddressUnconfirmedEvents(addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unconfirmed events: %w", err)
+	}
+	history := make([]HistoryItem, 0, len(events)+len(unconfirmed))
+	for _, ev := range events {
+		history = append(history, HistoryItem{TxHash: ev.ID, Height: ev.Index.Height, Type: ev.Type})
+	}
+	for _, ev := range unconfirmed {
+		history = append(history, HistoryItem{TxHash: ev.ID, Height: 0, Type: ev.Type})
+	}
+	return history, nil
+}
+
+// addressStatus returns the status of an address: the hex-encoded SHA-256
+// hash of "tx_hash:height:" for each history item, or the empty string if the
+// address has no history.
+func (s *Server) addressStatus(addr types.Address) (string, error) {
+	history, err := s.addressHistory(addr)
+	if err != nil || len(history) == 0 {
+		return "", err
+	}
+	h := sha256.New()
+	for _, item := range history {
+		fmt.Fprintf(h, "%x:%d:", item.TxHash[:], item.Height)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (s *Server) addressBalance(addr types.Address) (BalanceResponse, error) {
+	balance, err := s.wm.AddressBalance(addr)
+	if err != nil {
+		return BalanceResponse{}, fmt.Errorf("failed to get address balance: %w", err)
+	}
+	unconfirmed, err := s.wm.AddressUnconfirmedEvents(addr)
+	if err != nil {
+		return BalanceResponse{}, fmt.Errorf("failed to get unconfirmed events: %w", err)
+	}
+	var inflow, outflow types.Currency
+	for _, ev := range unconfirmed {
+		inflow = inflow.Add(ev.SiacoinInflow())
+		outflow = outflow.Add(ev.SiacoinOutflow())
+	}
+	var change string
+	if outflow.Cmp(inflow) > 0 {
+		change = "-" + outflow.Sub(inflow).ExactString()
+	} else {
+		change = inflow.Sub(outflow).ExactString()
+	}
+	return BalanceResponse{
+		Confirmed:   balance.Siacoins,
+		Immature:    balance.ImmatureSiacoins,
+		Unconfirmed: change,
+	}, nil
+}
+
+func (s *Server) addressUnspent(addr types.Address) ([]Unspent, error) {
+	var unspent []Unspent
+	for offset := 0; ; offset += pageSize {
+		page, err := s.wm.AddressSiacoinOutputs(addr, offset, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get address outputs: %w", err)
+		}
+		for _, sce := range page {
+			unspent = append(unspent, Unspent{OutputID: sce.ID, Value: sce.SiacoinOutput.Value, MaturityHeight: sce.MaturityHeight})
+		}
+		if len(unspent) > maxHistory {
+			return nil, &rpcError{Code: codeInternalError, Message: fmt.Sprintf("too many outputs (max %d)", maxHistory)}
+		} else if len(page) < pageSize {
+			break
+		}
+	}
+	if unspent == nil {
+		unspent = []Unspent{}
+	}
+	return unspent, nil
+}
+
+// broadcast adds a transaction to the pool and broadcasts it to peers,
+// returning its ID.
+func (s *Server) broadcast(txn types.V2Transaction) (types.TransactionID, error) {
+	txns := []types.V2Transaction{txn}
+	broadcast := func() error {
+		index := s.cm.Tip()
+		if _, err := s.cm.AddV2PoolTransactions(index, txns); err != nil {
+			return invalidParams("invalid transaction: %v", err)
+		}
+		s.s.BroadcastV2TransactionSet(index, txns)
+		return nil
+	}
+
+	if s.tm == nil {
+		if err := broadcast(); err != nil {
+			return types.TransactionID{}, err
+		}
+		return txn.ID(), nil
+	}
+	var broadcastErr error
+	pt, pending, err := s.tm.BroadcastTransactionSet(nil, txns, "electrum", func() error {
+		broadcastErr = broadcast()
+		return broadcastErr
+	})
+	if broadcastErr != nil {
+		return types.TransactionID{}, broadcastErr
+	} else if err != nil {
+		return types.TransactionID{}, fmt.Errorf("failed to broadcast transaction: %w", err)
+	} else if pending {
+		return types.TransactionID{}, &rpcError{Code: codeInternalError, Message: "transaction requires approval (pending transaction " + strconv.FormatInt(pt.ID, 10) + ")"}
+	}
+	return txn.ID(), nil
+}
+
+// Serve accepts connections from l until the listener or the server is
+// closed.
+func (s *Server) Serve(l net.Listener) error {
+	ctx, cancel, err := s.tg.AddWithContext(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go s.serveConn(nc)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer nc.Close()
+	ctx, cancel, err := s.tg.AddWithContext(context.Background())
+	if err != nil {
+		return
+	}
+	defer cancel()
+
+	log := s.log.With(zap.Stringer("remote", nc.RemoteAddr()))
+	c := &conn{srv: s, nc: nc, statuses: make(map[types.Address]string)}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(s.pollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				nc.Close()
+				return
+			case <-done:
+				return
+			case <-t.C:
+			}
+			if err := c.poll(); err != nil {
+				log.Debug("failed to notify subscriptions", zap.Error(err))
+				nc.Close()
+				return
+			}
+		}
+	}()
+
+	if err := c.serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Debug("connection closed", zap.Error(err))
+	}
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() error {
+	s.tg.Stop()
+	return nil
+}
+
+// NewServer returns a new Server. The wallet manager must be in full index
+// mode.
+func NewServer(cm ChainManager, s Syncer, wm WalletManager, opts ...Option) (*Server, error) {
+	if wm.IndexMode() != wallet.IndexModeFull {
+		return nil, errors.New("electrum server requires full index mode")
+	}
+	srv := &Server{
+		cm:  cm,
+		s:   s,
+		wm:  wm,
+		log: zap.NewNop(),
+		tg:  threadgroup.New(),
+
+		pollInterval:     2 * time.Second,
+		maxSubscriptions: 1000,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv, nil
+}
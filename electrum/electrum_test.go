@@ -0,0 +1,250 @@
+package electrum_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/electrum"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct{}
+
+func (chainManager) Tip() types.ChainIndex { return types.ChainIndex{} }
+
+func (chainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	mode wallet.IndexMode
+
+	mu          sync.Mutex
+	tip         types.ChainIndex
+	events      []wallet.Event // newest first
+	unconfirmed []wallet.Event
+	outputs     []types.SiacoinElement
+}
+
+func (wm *walletManager) IndexMode() wallet.IndexMode { return wm.mode }
+
+func (wm *walletManager) Tip() (types.ChainIndex, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.tip, nil
+}
+
+func (wm *walletManager) AddressBalance(types.Address) (wallet.Balance, error) {
+	return wallet.Balance{Siacoins: types.Siacoins(3)}, nil
+}
+
+func (wm *walletManager) AddressEvents(_ context.Context, _ types.Address, offset, limit int) ([]wallet.Event, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if offset >= len(wm.events) {
+		return nil, nil
+	}
+	events := wm.events[offset:]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (wm *walletManager) AddressUnconfirmedEvents(types.Address) ([]wallet.Event, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.unconfirmed, nil
+}
+
+func (wm *walletManager) AddressSiacoinOutputs(_ types.Address, offset, _ int) ([]types.SiacoinElement, error) {
+	if offset != 0 {
+		return nil, nil
+	}
+	return wm.outputs, nil
+}
+
+func (wm *walletManager) addEvent(height uint64) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.tip = types.ChainIndex{Height: height, ID: types.BlockID{byte(height)}}
+	ev := wallet.Event{ID: types.Hash256{byte(height)}, Index: wm.tip, Type: wallet.EventTypeMinerPayout}
+	wm.events = append([]wallet.Event{ev}, wm.events...)
+}
+
+type client struct {
+	t  *testing.T
+	nc net.Conn
+	sc *bufio.Scanner
+	id int
+}
+
+type message struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *client) next() message {
+	c.t.Helper()
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if !c.sc.Scan() {
+		c.t.Fatal("failed to read message:", c.sc.Err())
+	}
+	var msg message
+	if err := json.Unmarshal(c.sc.Bytes(), &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+func (c *client) call(method string, params ...any) message {
+	c.t.Helper()
+	c.id++
+	if params == nil {
+		params = []any{}
+	}
+	buf, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	if _, err := c.nc.Write(append(buf, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+	msg := c.next()
+	for msg.ID == nil && msg.Method != "" {
+		msg = c.next() // skip notifications
+	}
+	if msg.ID == nil || *msg.ID != c.id {
+		c.t.Fatalf("unexpected response %+v", msg)
+	}
+	return msg
+}
+
+func TestServer(t *testing.T) {
+	if _, err := electrum.NewServer(chainManager{}, syncer{}, &walletManager{mode: wallet.IndexModePersonal}); err == nil {
+		t.Fatal("expected error for personal index mode")
+	}
+
+	wm := &walletManager{
+		mode:    wallet.IndexModeFull,
+		outputs: []types.SiacoinElement{{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(3)}, MaturityHeight: 10}},
+	}
+	srv, err := electrum.NewServer(chainManager{}, syncer{}, wm, electrum.WithLogger(zaptest.NewLogger(t)), electrum.WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	c := &client{t: t, nc: nc, sc: bufio.NewScanner(nc)}
+
+	if msg := c.call("server.version", "test", "1.4"); !strings.Contains(string(msg.Result), electrum.ProtocolVersion) {
+		t.Fatalf("unexpected version %s", msg.Result)
+	}
+	if msg := c.call("server.unknown"); msg.Error == nil || msg.Error.Code != -32601 {
+		t.Fatalf("expected method not found, got %+v", msg)
+	}
+	if msg := c.call("blockchain.address.get_history", "not an address"); msg.Error == nil || msg.Error.Code != -32602 {
+		t.Fatalf("expected invalid params, got %+v", msg)
+	}
+	if msg := c.call("blockchain.transaction.broadcast", "zz"); msg.Error == nil || msg.Error.Code != -32602 {
+		t.Fatalf("expected invalid params, got %+v", msg)
+	}
+
+	addr := types.VoidAddress
+	if msg := c.call("blockchain.address.subscribe", addr); string(msg.Result) != "null" {
+		t.Fatalf("expected null status, got %s", msg.Result)
+	}
+	if msg := c.call("blockchain.headers.subscribe"); msg.Error != nil {
+		t.Fatal(msg.Error.Message)
+	}
+
+	// a new event changes the tip and the address status
+	wm.addEvent(1)
+	var status string
+	var header electrum.Header
+	for i := 0; i < 2; i++ {
+		msg := c.next()
+		switch msg.Method {
+		case "blockchain.headers.subscribe":
+			var params []electrum.Header
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			header = params[0]
+		case "blockchain.address.subscribe":
+			var params []*string
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			} else if params[1] == nil {
+				t.Fatal("expected status")
+			}
+			status = *params[1]
+		default:
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	}
+	if header.Height != 1 {
+		t.Fatalf("expected height 1, got %d", header.Height)
+	} else if len(status) != 64 {
+		t.Fatalf("unexpected status %q", status)
+	}
+
+	wm.addEvent(2)
+	wm.mu.Lock()
+	wm.unconfirmed = []wallet.Event{{ID: types.Hash256{9}, Type: wallet.EventTypeV2Transaction}}
+	wm.mu.Unlock()
+	msg := c.call("blockchain.address.get_history", addr)
+	var history []electrum.HistoryItem
+	if err := json.Unmarshal(msg.Result, &history); err != nil {
+		t.Fatal(err)
+	} else if len(history) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(history))
+	} else if history[0].Height != 1 || history[1].Height != 2 || history[2].Height != 0 {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	msg = c.call("blockchain.address.get_balance", addr)
+	var balance electrum.BalanceResponse
+	if err := json.Unmarshal(msg.Result, &balance); err != nil {
+		t.Fatal(err)
+	} else if !balance.Confirmed.Equals(types.Siacoins(3)) {
+		t.Fatalf("unexpected balance %+v", balance)
+	}
+
+	msg = c.call("blockchain.address.listunspent", addr)
+	var unspent []electrum.Unspent
+	if err := json.Unmarshal(msg.Result, &unspent); err != nil {
+		t.Fatal(err)
+	} else if len(unspent) != 1 || unspent[0].MaturityHeight != 10 {
+		t.Fatalf("unexpected outputs %+v", unspent)
+	}
+
+	if msg := c.call("blockchain.address.unsubscribe", addr); string(msg.Result) != "true" {
+		t.Fatalf("expected true, got %s", msg.Result)
+	}
+}
@@ -0,0 +1,42 @@
+package electrum
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets the logger used by the server.
+func WithLogger(log *zap.Logger) Option {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithTreasuryManager checks broadcast transactions against the spending
+// policies of the wallets they spend from. Transactions that exceed a limit
+// or require approval are not broadcast.
+func WithTreasuryManager(tm TreasuryManager) Option {
+	return func(s *Server) {
+		s.tm = tm
+	}
+}
+
+// WithPollInterval sets how often the statuses of subscribed addresses are
+// recomputed. The default is 2 seconds.
+func WithPollInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.pollInterval = d
+	}
+}
+
+// WithMaxSubscriptions sets the maximum number of addresses a single
+// connection can subscribe to. The default is 1000.
+func WithMaxSubscriptions(n int) Option {
+	return func(s *Server) {
+		s.maxSubscriptions = n
+	}
+}
@@ -0,0 +1,411 @@
+package escrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ScopeEscrow is the webhook scope of escrow events.
+const ScopeEscrow = "escrow"
+
+const (
+	// signatureSize is the size of each signature added to an input.
+	signatureSize = 64
+	// inputWeight estimates the weight of a signed input, including its
+	// spend policy and state proof.
+	inputWeight = 400
+)
+
+// Escrow statuses.
+const (
+	// StatusPending indicates the escrow address has not received the
+	// escrow amount.
+	StatusPending = "pending"
+	// StatusFunded indicates the escrow address holds at least the escrow
+	// amount.
+	StatusFunded = "funded"
+	// StatusReleased indicates the escrow was paid to the seller.
+	StatusReleased = "released"
+	// StatusRefunded indicates the escrow was returned to the buyer.
+	StatusRefunded = "refunded"
+)
+
+// Settlement types.
+const (
+	SettlementRelease = "release"
+	SettlementRefund  = "refund"
+)
+
+// Funding statuses.
+const (
+	// FundingUnsigned indicates the funding transaction must be signed and
+	// broadcast by the client.
+	FundingUnsigned = "unsigned"
+	// FundingBroadcast indicates the funding transaction was signed by the
+	// funding wallet's signer and broadcast.
+	FundingBroadcast = "broadcast"
+	// FundingPending indicates the funding transaction was signed by the
+	// funding wallet's signer and is waiting in the treasury approval
+	// queue.
+	FundingPending = "pending"
+)
+
+var (
+	// ErrNotFound is returned when an escrow is not found.
+	ErrNotFound = errors.New("escrow not found")
+	// ErrInvalidKeys is returned when the buyer, seller and arbiter keys
+	// are not distinct.
+	ErrInvalidKeys = errors.New("buyer, seller and arbiter keys must be distinct")
+	// ErrNotPending is returned when funding an escrow that is already
+	// funded or settled.
+	ErrNotPending = errors.New("escrow is not pending")
+	// ErrNotFunded is returned when settling an escrow that is not funded.
+	ErrNotFunded = errors.New("escrow is not funded")
+	// ErrSettlementPending is returned when proposing a settlement for an
+	// escrow that already has a different settlement awaiting signatures.
+	ErrSettlementPending = errors.New("escrow has a pending settlement")
+	// ErrNoSettlement is returned when signing an escrow without a pending
+	// settlement.
+	ErrNoSettlement = errors.New("escrow has no pending settlement")
+	// ErrUnknownKey is returned when a signature is not made by the buyer,
+	// seller or arbiter.
+	ErrUnknownKey = errors.New("key is not a party to the escrow")
+	// ErrInvalidSignature is returned when a signature does not sign the
+	// settlement.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrInsufficientFunds is returned when the funding wallet cannot pay
+	// the escrow amount.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+type (
+	// A PartySignature is a signature of a settlement by one of the
+	// escrow's parties.
+	PartySignature struct {
+		PublicKey types.PublicKey `json:"publicKey"`
+		Signature types.Signature `json:"signature"`
+	}
+
+	// A Settlement is a transaction paying an escrow's outputs to the seller
+	// or back to the buyer. It is broadcast once two of the three parties
+	// have signed SigHash.
+	Settlement struct {
+		Type        string              `json:"type"`
+		Basis       types.ChainIndex    `json:"basis"`
+		Transaction types.V2Transaction `json:"transaction"`
+		// SigHash is the hash each party signs. Every input of the
+		// transaction has the same signatures.
+		SigHash    types.Hash256    `json:"sigHash"`
+		Signatures []PartySignature `json:"signatures"`
+	}
+
+	// An Escrow holds funds at an address controlled by a 2-of-3 policy of
+	// the buyer, seller and arbiter keys. Any two parties can release the
+	// funds to the seller or refund them to the buyer.
+	Escrow struct {
+		ID       int64     `json:"id"`
+		WalletID wallet.ID `json:"walletID"`
+		Status   string    `json:"status"`
+
+		Buyer   types.PublicKey `json:"buyer"`
+		Seller  types.PublicKey `json:"seller"`
+		Arbiter types.PublicKey `json:"arbiter"`
+		// BuyerAddress receives refunds and SellerAddress receives
+		// releases.
+		BuyerAddress  types.Address `json:"buyerAddress"`
+		SellerAddress types.Address `json:"sellerAddress"`
+
+		Address types.Address     `json:"address"`
+		Policy  types.SpendPolicy `json:"policy"`
+		Amount  types.Currency    `json:"amount"`
+		// Balance is the value of the unspent outputs held by the escrow
+		// address. It is computed when the escrow is retrieved.
+		Balance types.Currency `json:"balance"`
+
+		Settlement *Settlement `json:"settlement,omitempty"`
+
+		DateCreated time.Time `json:"dateCreated"`
+		DateFunded  time.Time `json:"dateFunded"`
+		DateSettled time.Time `json:"dateSettled"`
+	}
+
+	// A Funding is a transaction paying an escrow's amount from a wallet.
+	Funding struct {
+		Status      string              `json:"status"`
+		Basis       types.ChainIndex    `json:"basis"`
+		Transaction types.V2Transaction `json:"transaction"`
+		Fee         types.Currency      `json:"fee"`
+	}
+
+	// A Store persists escrows.
+	Store interface {
+		AddEscrow(Escrow) (Escrow, error)
+		UpdateEscrow(Escrow) error
+		// WalletEscrows returns a wallet's escrows, newest first.
+		WalletEscrows(walletID wallet.ID) ([]Escrow, error)
+		WalletEscrow(walletID wallet.ID, id int64) (Escrow, error)
+		// PendingEscrows returns every escrow that is not funded.
+		PendingEscrows() ([]Escrow, error)
+	}
+
+	// A ChainManager exposes the transaction pool, so that an escrow is not
+	// funded with outputs that are already being spent, and prices and
+	// accepts signed funding transactions.
+	ChainManager interface {
+		TipState() consensus.State
+		PoolTransactions() []types.Transaction
+		V2PoolTransactions() []types.V2Transaction
+		AddV2PoolTransactions(basis types.ChainIndex, txns []types.V2Transaction) (bool, error)
+	}
+
+	// A Syncer relays signed escrow funding transactions to peers once the
+	// pool accepts them.
+	Syncer interface {
+		BroadcastV2TransactionSet(basis types.ChainIndex, txns []types.V2Transaction)
+	}
+
+	// A WalletManager provides the outputs of escrow addresses and funding
+	// wallets.
+	WalletManager interface {
+		Tip() (types.ChainIndex, error)
+		AddAddress(id wallet.ID, addr wallet.Address) error
+		Addresses(id wallet.ID) ([]wallet.Address, error)
+		AddressSiacoinOutputs(addr types.Address, offset, limit int) ([]types.SiacoinElement, error)
+		UnspentSiacoinOutputs(id wallet.ID, offset, limit int) ([]types.SiacoinElement, error)
+		Reserve(ids []types.Hash256, duration time.Duration) error
+		// WalletFeeRate returns the fee rate of the wallet's fee strategy.
+		WalletFeeRate(id wallet.ID) (types.Currency, error)
+	}
+
+	// A Signer signs funding transactions with a wallet's external signer.
+	Signer interface {
+		SignV2Transaction(ctx context.Context, id wallet.ID, txn types.V2Transaction) (types.V2Transaction, error)
+	}
+
+	// An EventBroadcaster notifies webhooks when an escrow is created or
+	// funded.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A TreasuryManager enforces the spending policy of funding wallets.
+	TreasuryManager interface {
+		BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error)
+	}
+
+	// A Manager creates escrows, tracks their funding, and assembles their
+	// settlements.
+	Manager struct {
+		store  Store
+		cm     ChainManager
+		s      Syncer
+		wm     WalletManager
+		signer Signer
+		tm     TreasuryManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+
+		interval        time.Duration
+		reserveDuration time.Duration
+
+		mu sync.Mutex // serializes escrow updates
+	}
+)
+
+// escrowPolicy returns the 2-of-3 policy of an escrow's parties.
+func escrowPolicy(buyer, seller, arbiter types.PublicKey) types.SpendPolicy {
+	return types.PolicyThreshold(2, []types.SpendPolicy{
+		types.PolicyPublicKey(buyer),
+		types.PolicyPublicKey(seller),
+		types.PolicyPublicKey(arbiter),
+	})
+}
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+func (m *Manager) broadcastEvent(log *zap.Logger, event string, data any) {
+	if m.events == nil {
+		return
+	}
+	if err := m.events.BroadcastEvent(ScopeEscrow, event, data); err != nil {
+		log.Warn("failed to broadcast event", zap.Error(err))
+	}
+}
+
+// outputs returns the unspent outputs of the escrow address.
+func (m *Manager) outputs(e Escrow) ([]types.SiacoinElement, error) {
+	const batchSize = 1000
+
+	var utxos []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.wm.AddressSiacoinOutputs(e.Address, offset, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		utxos = append(utxos, batch...)
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	return utxos, nil
+}
+
+// refresh computes the escrow's balance and marks a pending escrow as funded
+// once its balance reaches the escrow amount. The caller must hold the lock.
+func (m *Manager) refresh(e Escrow, now time.Time) (Escrow, error) {
+	utxos, err := m.outputs(e)
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed to get escrow outputs: %w", err)
+	}
+	e.Balance = types.ZeroCurrency
+	for _, sce := range utxos {
+		e.Balance = e.Balance.Add(sce.SiacoinOutput.Value)
+	}
+	if e.Status == StatusPending && e.Balance.Cmp(e.Amount) >= 0 {
+		e.Status = StatusFunded
+		e.DateFunded = now
+		if err := m.store.UpdateEscrow(e); err != nil {
+			return Escrow{}, fmt.Errorf("failed to update escrow: %w", err)
+		}
+		log := m.log.With(zap.Int64("wallet", int64(e.WalletID)), zap.Int64("escrow", e.ID))
+		log.Info("escrow funded", zap.Stringer("balance", e.Balance))
+		m.broadcastEvent(log, "funded", e)
+	}
+	return e, nil
+}
+
+// Create creates an escrow. The escrow address is added to the wallet so its
+// outputs are indexed. If buyerAddr or sellerAddr is the void address, the
+// standard address of the party's key is used.
+func (m *Manager) Create(walletID wallet.ID, buyer, seller, arbiter types.PublicKey, buyerAddr, sellerAddr types.Address, amount types.Currency) (Escrow, error) {
+	if buyer == seller || buyer == arbiter || seller == arbiter {
+		return Escrow{}, ErrInvalidKeys
+	} else if amount.IsZero() {
+		return Escrow{}, errors.New("escrow amount must be greater than zero")
+	}
+	if buyerAddr == types.VoidAddress {
+		buyerAddr = types.StandardAddress(buyer)
+	}
+	if sellerAddr == types.VoidAddress {
+		sellerAddr = types.StandardAddress(seller)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	policy := escrowPolicy(buyer, seller, arbiter)
+	err := m.wm.AddAddress(walletID, wallet.Address{
+		Address:     policy.Address(),
+		Description: "escrow",
+		SpendPolicy: &policy,
+	})
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed to add escrow address: %w", err)
+	}
+
+	e, err := m.store.AddEscrow(Escrow{
+		WalletID:      walletID,
+		Status:        StatusPending,
+		Buyer:         buyer,
+		Seller:        seller,
+		Arbiter:       arbiter,
+		BuyerAddress:  buyerAddr,
+		SellerAddress: sellerAddr,
+		Address:       policy.Address(),
+		Policy:        policy,
+		Amount:        amount,
+		DateCreated:   time.Now(),
+	})
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed to add escrow: %w", err)
+	}
+	log := m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("escrow", e.ID))
+	log.Info("created escrow", zap.Stringer("address", e.Address), zap.Stringer("amount", amount))
+	m.broadcastEvent(log, "created", e)
+	return e, nil
+}
+
+// Escrows returns a wallet's escrows, newest first.
+func (m *Manager) Escrows(walletID wallet.ID) ([]Escrow, error) {
+	return m.store.WalletEscrows(walletID)
+}
+
+// Escrow returns a wallet's escrow, including the balance of its address.
+func (m *Manager) Escrow(walletID wallet.ID, id int64) (Escrow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.store.WalletEscrow(walletID, id)
+	if err != nil {
+		return Escrow{}, err
+	}
+	return m.refresh(e, time.Now())
+}
+
+// check marks every pending escrow whose address holds the escrow amount as
+// funded.
+func (m *Manager) check(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	escrows, err := m.store.PendingEscrows()
+	if err != nil {
+		m.log.Error("failed to get pending escrows", zap.Error(err))
+		return
+	}
+	for _, e := range escrows {
+		if _, err := m.refresh(e, now); err != nil {
+			m.log.Warn("failed to check escrow funding", zap.Int64("escrow", e.ID), zap.Error(err))
+		}
+	}
+}
+
+// NewManager creates a new escrow manager and starts tracking the funding of
+// pending escrows in the background.
+func NewManager(store Store, cm ChainManager, s Syncer, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		cm:    cm,
+		s:     s,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		interval:        time.Minute,
+		reserveDuration: 3 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "escrow", "checks pending escrows for funding", m.interval, false, func(context.Context) error {
+			m.check(time.Now())
+			return nil
+		})
+	}()
+	return m, nil
+}
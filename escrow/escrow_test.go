@@ -0,0 +1,328 @@
+package escrow_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct {
+	mu   sync.Mutex
+	pool []types.V2Transaction
+}
+
+func (*chainManager) TipState() consensus.State             { return consensus.State{} }
+func (*chainManager) PoolTransactions() []types.Transaction { return nil }
+
+func (cm *chainManager) V2PoolTransactions() []types.V2Transaction {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return append([]types.V2Transaction(nil), cm.pool...)
+}
+
+func (cm *chainManager) AddV2PoolTransactions(_ types.ChainIndex, txns []types.V2Transaction) (bool, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.pool = append(cm.pool, txns...)
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	mu        sync.Mutex
+	addresses map[wallet.ID][]wallet.Address
+	utxos     map[wallet.ID][]types.SiacoinElement
+	reserved  map[types.Hash256]bool
+}
+
+func (wm *walletManager) Tip() (types.ChainIndex, error) {
+	return types.ChainIndex{Height: 100}, nil
+}
+
+func (wm *walletManager) AddAddress(id wallet.ID, addr wallet.Address) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.addresses[id] = append(wm.addresses[id], addr)
+	return nil
+}
+
+func (wm *walletManager) Addresses(id wallet.ID) ([]wallet.Address, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]wallet.Address(nil), wm.addresses[id]...), nil
+}
+
+func (wm *walletManager) AddressSiacoinOutputs(addr types.Address, offset, limit int) (utxos []types.SiacoinElement, _ error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if offset > 0 {
+		return nil, nil
+	}
+	for _, outputs := range wm.utxos {
+		for _, sce := range outputs {
+			if sce.SiacoinOutput.Address == addr {
+				utxos = append(utxos, sce)
+			}
+		}
+	}
+	return utxos, nil
+}
+
+func (wm *walletManager) UnspentSiacoinOutputs(id wallet.ID, offset, limit int) ([]types.SiacoinElement, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if offset > 0 {
+		return nil, nil
+	}
+	return append([]types.SiacoinElement(nil), wm.utxos[id]...), nil
+}
+
+func (wm *walletManager) Reserve(ids []types.Hash256, _ time.Duration) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		wm.reserved[id] = true
+	}
+	return nil
+}
+
+func (wm *walletManager) WalletFeeRate(wallet.ID) (types.Currency, error) {
+	return types.NewCurrency64(1), nil
+}
+
+type signer struct{}
+
+func (signer) SignV2Transaction(_ context.Context, _ wallet.ID, txn types.V2Transaction) (types.V2Transaction, error) {
+	return txn, nil
+}
+
+type treasuryManager struct {
+	calls int
+}
+
+func (tm *treasuryManager) BroadcastTransactionSet(_ []types.Transaction, v2txns []types.V2Transaction, submittedBy string, _ func() error) (treasury.PendingTransaction, bool, error) {
+	tm.calls++
+	return treasury.PendingTransaction{ID: 1, V2Transactions: v2txns, SubmittedBy: submittedBy}, true, nil
+}
+
+func TestEscrow(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "escrows"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	funder, err := db.AddWallet(wallet.Wallet{Name: "buyer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{
+		addresses: make(map[wallet.ID][]wallet.Address),
+		utxos:     make(map[wallet.ID][]types.SiacoinElement),
+		reserved:  make(map[types.Hash256]bool),
+	}
+	buyerPolicy := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey())
+	buyerAddr := types.Address{1}
+	wm.addresses[funder.ID] = []wallet.Address{{Address: buyerAddr, SpendPolicy: &buyerPolicy}}
+	wm.utxos[funder.ID] = []types.SiacoinElement{{
+		ID:            types.SiacoinOutputID{1},
+		SiacoinOutput: types.SiacoinOutput{Address: buyerAddr, Value: types.Siacoins(100)},
+	}}
+
+	cm := new(chainManager)
+	tm := new(treasuryManager)
+	em, err := escrow.NewManager(db, cm, syncer{}, wm, escrow.WithLogger(log.Named("escrow")), escrow.WithInterval(time.Hour), escrow.WithTreasuryManager(tm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer em.Close()
+
+	buyer, seller, arbiter := types.GeneratePrivateKey(), types.GeneratePrivateKey(), types.GeneratePrivateKey()
+	sellerAddr := types.Address{2}
+	if _, err := em.Create(w.ID, buyer.PublicKey(), buyer.PublicKey(), arbiter.PublicKey(), buyerAddr, sellerAddr, types.Siacoins(50)); !errors.Is(err, escrow.ErrInvalidKeys) {
+		t.Fatalf("expected ErrInvalidKeys, got %v", err)
+	}
+
+	e, err := em.Create(w.ID, buyer.PublicKey(), seller.PublicKey(), arbiter.PublicKey(), buyerAddr, sellerAddr, types.Siacoins(50))
+	if err != nil {
+		t.Fatal(err)
+	} else if e.Status != escrow.StatusPending {
+		t.Fatalf("expected pending escrow, got %q", e.Status)
+	} else if addrs := wm.addresses[w.ID]; len(addrs) != 1 || addrs[0].Address != e.Address {
+		t.Fatalf("expected the escrow address to be added to the wallet, got %v", addrs)
+	} else if _, err := em.Settle(w.ID, e.ID, escrow.SettlementRelease); !errors.Is(err, escrow.ErrNotFunded) {
+		t.Fatalf("expected ErrNotFunded, got %v", err)
+	}
+
+	funding, err := em.Fund(w.ID, e.ID, funder.ID, types.VoidAddress)
+	if err != nil {
+		t.Fatal(err)
+	} else if funding.Status != escrow.FundingUnsigned {
+		t.Fatalf("expected unsigned funding, got %q", funding.Status)
+	}
+	txn := funding.Transaction
+	if len(txn.SiacoinInputs) != 1 || len(txn.SiacoinOutputs) != 2 {
+		t.Fatalf("expected 1 input and 2 outputs, got %d and %d", len(txn.SiacoinInputs), len(txn.SiacoinOutputs))
+	} else if txn.SiacoinOutputs[0].Address != e.Address || !txn.SiacoinOutputs[0].Value.Equals(types.Siacoins(50)) {
+		t.Fatalf("expected 50 SC to the escrow address, got %v", txn.SiacoinOutputs[0])
+	} else if txn.SiacoinOutputs[1].Address != buyerAddr {
+		t.Fatalf("expected change to the input address, got %v", txn.SiacoinOutputs[1].Address)
+	} else if !txn.SiacoinOutputs[0].Value.Add(txn.SiacoinOutputs[1].Value).Add(txn.MinerFee).Equals(types.Siacoins(100)) {
+		t.Fatal("funding transaction does not balance")
+	} else if !wm.reserved[types.Hash256{1}] {
+		t.Fatal("expected the funding input to be reserved")
+	}
+
+	// confirm the funding transaction
+	wm.mu.Lock()
+	wm.utxos[w.ID] = []types.SiacoinElement{{
+		ID:            types.SiacoinOutputID{2},
+		SiacoinOutput: txn.SiacoinOutputs[0],
+	}}
+	wm.mu.Unlock()
+
+	e, err = em.Escrow(w.ID, e.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if e.Status != escrow.StatusFunded {
+		t.Fatalf("expected funded escrow, got %q", e.Status)
+	} else if !e.Balance.Equals(types.Siacoins(50)) {
+		t.Fatalf("expected balance of 50 SC, got %v", e.Balance)
+	} else if _, err := em.Fund(w.ID, e.ID, funder.ID, types.VoidAddress); !errors.Is(err, escrow.ErrNotPending) {
+		t.Fatalf("expected ErrNotPending, got %v", err)
+	} else if _, err := em.AddSignature(w.ID, e.ID, seller.PublicKey(), types.Signature{}); !errors.Is(err, escrow.ErrNoSettlement) {
+		t.Fatalf("expected ErrNoSettlement, got %v", err)
+	}
+
+	e, err = em.Settle(w.ID, e.ID, escrow.SettlementRelease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := e.Settlement
+	if s == nil || s.Type != escrow.SettlementRelease {
+		t.Fatalf("expected release settlement, got %v", s)
+	} else if len(s.Transaction.SiacoinOutputs) != 1 || s.Transaction.SiacoinOutputs[0].Address != sellerAddr {
+		t.Fatalf("expected the settlement to pay the seller, got %v", s.Transaction.SiacoinOutputs)
+	}
+
+	outsider := types.GeneratePrivateKey()
+	if _, err := em.AddSignature(w.ID, e.ID, outsider.PublicKey(), outsider.SignHash(s.SigHash)); !errors.Is(err, escrow.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	} else if _, err := em.AddSignature(w.ID, e.ID, buyer.PublicKey(), buyer.SignHash(types.Hash256{1})); !errors.Is(err, escrow.ErrInvalidSignature) {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	e, err = em.AddSignature(w.ID, e.ID, seller.PublicKey(), seller.SignHash(s.SigHash))
+	if err != nil {
+		t.Fatal(err)
+	} else if e.Status != escrow.StatusFunded || len(e.Settlement.Signatures) != 1 {
+		t.Fatalf("expected 1 signature on a funded escrow, got %d on %q", len(e.Settlement.Signatures), e.Status)
+	} else if _, err := em.Settle(w.ID, e.ID, escrow.SettlementRefund); !errors.Is(err, escrow.ErrSettlementPending) {
+		t.Fatalf("expected ErrSettlementPending, got %v", err)
+	} else if len(cm.V2PoolTransactions()) != 0 {
+		t.Fatal("expected the settlement not to be broadcast")
+	}
+
+	e, err = em.AddSignature(w.ID, e.ID, arbiter.PublicKey(), arbiter.SignHash(s.SigHash))
+	if err != nil {
+		t.Fatal(err)
+	} else if e.Status != escrow.StatusReleased {
+		t.Fatalf("expected released escrow, got %q", e.Status)
+	} else if e.DateSettled.IsZero() {
+		t.Fatal("expected settlement date to be set")
+	}
+	pool := cm.V2PoolTransactions()
+	if len(pool) != 1 {
+		t.Fatalf("expected 1 pool transaction, got %d", len(pool))
+	} else if sigs := pool[0].SiacoinInputs[0].SatisfiedPolicy.Signatures; len(sigs) != 2 {
+		t.Fatalf("expected 2 signatures, got %d", len(sigs))
+	} else if _, err := em.Settle(w.ID, e.ID, escrow.SettlementRefund); !errors.Is(err, escrow.ErrNotFunded) {
+		t.Fatalf("expected ErrNotFunded, got %v", err)
+	} else if tm.calls != 0 {
+		t.Fatal("expected the settlement to be exempt from the treasury policy")
+	}
+
+	escrows, err := em.Escrows(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(escrows) != 1 || escrows[0].Status != escrow.StatusReleased {
+		t.Fatalf("expected 1 released escrow, got %v", escrows)
+	}
+}
+
+func TestFundingApproval(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "escrows"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	funder, err := db.AddWallet(wallet.Wallet{Name: "buyer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{
+		addresses: make(map[wallet.ID][]wallet.Address),
+		utxos:     make(map[wallet.ID][]types.SiacoinElement),
+		reserved:  make(map[types.Hash256]bool),
+	}
+	buyerPolicy := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey())
+	buyerAddr := types.Address{1}
+	wm.addresses[funder.ID] = []wallet.Address{{Address: buyerAddr, SpendPolicy: &buyerPolicy}}
+	wm.utxos[funder.ID] = []types.SiacoinElement{{
+		ID:            types.SiacoinOutputID{1},
+		SiacoinOutput: types.SiacoinOutput{Address: buyerAddr, Value: types.Siacoins(100)},
+	}}
+
+	cm := new(chainManager)
+	tm := new(treasuryManager)
+	em, err := escrow.NewManager(db, cm, syncer{}, wm, escrow.WithLogger(log.Named("escrow")), escrow.WithInterval(time.Hour), escrow.WithSigner(signer{}), escrow.WithTreasuryManager(tm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer em.Close()
+
+	buyer, seller, arbiter := types.GeneratePrivateKey(), types.GeneratePrivateKey(), types.GeneratePrivateKey()
+	e, err := em.Create(w.ID, buyer.PublicKey(), seller.PublicKey(), arbiter.PublicKey(), buyerAddr, types.Address{2}, types.Siacoins(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed funding transactions go through the treasury manager
+	funding, err := em.Fund(w.ID, e.ID, funder.ID, types.VoidAddress)
+	if err != nil {
+		t.Fatal(err)
+	} else if tm.calls != 1 {
+		t.Fatal("expected the funding transaction to be checked by the treasury manager")
+	} else if funding.Status != escrow.FundingPending {
+		t.Fatalf("expected status %q, got %q", escrow.FundingPending, funding.Status)
+	} else if len(cm.V2PoolTransactions()) != 0 {
+		t.Fatal("expected the funding transaction not to be broadcast")
+	}
+}
@@ -0,0 +1,71 @@
+package escrow
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send escrow events to
+// webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithSigner sets the signer used to sign funding transactions of wallets
+// with an external signer. Funding transactions of other wallets must be
+// signed by the client.
+func WithSigner(s Signer) Option {
+	return func(m *Manager) {
+		m.signer = s
+	}
+}
+
+// WithTreasuryManager checks signed funding transactions against the
+// spending policy of the funding wallet. Funding transactions that violate
+// the policy are left unsigned, and those that require approval are added to
+// the approval queue. Settlements are exempt; see Manager.AddSignature.
+func WithTreasuryManager(tm TreasuryManager) Option {
+	return func(m *Manager) {
+		m.tm = tm
+	}
+}
+
+// WithInterval sets how often pending escrows are checked for funding. The
+// default is one minute.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.interval = d
+		}
+	}
+}
+
+// WithReserveDuration sets how long a funding transaction's inputs are
+// reserved. Unsigned funding transactions must be signed and broadcast
+// within this time. The default is three hours.
+func WithReserveDuration(d time.Duration) Option {
+	return func(m *Manager) {
+		m.reserveDuration = d
+	}
+}
+
+// WithScheduler registers the check for funded escrows as the "escrow" job.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
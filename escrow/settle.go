@@ -0,0 +1,349 @@
+package escrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// inPool returns the IDs of the outputs spent by transactions in the pool.
+func (m *Manager) inPool() map[types.SiacoinOutputID]bool {
+	inPool := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range m.cm.PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.ParentID] = true
+		}
+	}
+	for _, txn := range m.cm.V2PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.Parent.ID] = true
+		}
+	}
+	return inPool
+}
+
+// Fund funds a transaction paying the rest of the escrow amount from a
+// wallet. Change is returned to changeAddr or, if it is the void address, to
+// the address of the first input. If the funding wallet has an external
+// signer, the transaction is signed and broadcast. Otherwise, it must be
+// signed and broadcast by the client.
+func (m *Manager) Fund(walletID wallet.ID, id int64, fundingWallet wallet.ID, changeAddr types.Address) (Funding, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.store.WalletEscrow(walletID, id)
+	if err != nil {
+		return Funding{}, err
+	}
+	e, err = m.refresh(e, time.Now())
+	if err != nil {
+		return Funding{}, err
+	} else if e.Status != StatusPending {
+		return Funding{}, ErrNotPending
+	}
+	amount := e.Amount.Sub(e.Balance)
+
+	feePerByte, err := m.wm.WalletFeeRate(fundingWallet)
+	if err != nil {
+		return Funding{}, fmt.Errorf("failed to get fee rate: %w", err)
+	}
+	addresses, err := m.wm.Addresses(fundingWallet)
+	if err != nil {
+		return Funding{}, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	policies := make(map[types.Address]types.SpendPolicy)
+	for _, addr := range addresses {
+		if addr.SpendPolicy != nil {
+			policies[addr.Address] = *addr.SpendPolicy
+		}
+	}
+
+	// the outputs' proofs must match the basis
+	basis, err := m.wm.Tip()
+	if err != nil {
+		return Funding{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	}
+	const batchSize = 1000
+	var utxos []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.wm.UnspentSiacoinOutputs(fundingWallet, offset, batchSize)
+		if err != nil {
+			return Funding{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+		}
+		utxos = append(utxos, batch...)
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	if tip, err := m.wm.Tip(); err != nil {
+		return Funding{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if tip != basis {
+		return Funding{}, errors.New("wallet tip changed while fetching outputs")
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].SiacoinOutput.Value.Cmp(utxos[j].SiacoinOutput.Value) > 0
+	})
+
+	txn := types.V2Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: e.Address, Value: amount}},
+	}
+	inPool := m.inPool()
+	var inputSum, fee types.Currency
+	for _, sce := range utxos {
+		// the escrow's own outputs are never used to fund it
+		if sce.SiacoinOutput.Address == e.Address || inPool[sce.ID] {
+			continue
+		}
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+			Parent:          sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{Policy: policies[sce.SiacoinOutput.Address]},
+		})
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+		// include a change output in the fee estimate
+		fee = feePerByte.Mul64(m.cm.TipState().V2TransactionWeight(txn) + uint64(len(txn.SiacoinInputs))*(inputWeight+signatureSize))
+		if inputSum.Cmp(amount.Add(fee)) >= 0 {
+			break
+		}
+	}
+	if inputSum.Cmp(amount.Add(fee)) < 0 {
+		return Funding{}, fmt.Errorf("%w: %v available, %v required", ErrInsufficientFunds, inputSum, amount.Add(fee))
+	}
+	txn.MinerFee = fee
+	if change := inputSum.Sub(amount.Add(fee)); !change.IsZero() {
+		if changeAddr == types.VoidAddress {
+			changeAddr = txn.SiacoinInputs[0].Parent.SiacoinOutput.Address
+		}
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{Address: changeAddr, Value: change})
+	}
+
+	ids := make([]types.Hash256, len(txn.SiacoinInputs))
+	for i, sci := range txn.SiacoinInputs {
+		ids[i] = types.Hash256(sci.Parent.ID)
+	}
+	if err := m.wm.Reserve(ids, m.reserveDuration); err != nil {
+		return Funding{}, fmt.Errorf("failed to reserve inputs: %w", err)
+	}
+
+	log := m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("escrow", e.ID), zap.Int64("fundingWallet", int64(fundingWallet)))
+	funding := Funding{
+		Status:      FundingUnsigned,
+		Basis:       basis,
+		Transaction: txn,
+		Fee:         fee,
+	}
+	if m.signer != nil {
+		ctx, cancel, err := m.tg.AddWithContext(context.Background())
+		if err != nil {
+			return Funding{}, err
+		}
+		signed, err := m.signer.SignV2Transaction(ctx, fundingWallet, txn)
+		cancel()
+		switch {
+		case errors.Is(err, signer.ErrNoSigner):
+		case err != nil:
+			log.Warn("failed to sign funding transaction", zap.Error(err))
+		default:
+			txns := []types.V2Transaction{signed}
+			broadcast := func() error {
+				if _, err := m.cm.AddV2PoolTransactions(basis, txns); err != nil {
+					return fmt.Errorf("failed to add funding transaction to pool: %w", err)
+				}
+				m.s.BroadcastV2TransactionSet(basis, txns)
+				return nil
+			}
+			if m.tm == nil {
+				if err := broadcast(); err != nil {
+					log.Warn("failed to broadcast funding transaction", zap.Error(err))
+					break
+				}
+				funding.Transaction, funding.Status = signed, FundingBroadcast
+				break
+			}
+			pt, pending, err := m.tm.BroadcastTransactionSet(nil, txns, "escrow", broadcast)
+			switch {
+			case err != nil:
+				log.Warn("failed to broadcast funding transaction", zap.Error(err))
+			case pending:
+				log.Info("funding transaction requires approval", zap.Int64("pendingTransaction", pt.ID))
+				funding.Transaction, funding.Status = signed, FundingPending
+			default:
+				funding.Transaction, funding.Status = signed, FundingBroadcast
+			}
+		}
+	}
+	log.Info("funded escrow", zap.String("status", funding.Status), zap.Stringer("amount", amount), zap.Stringer("fee", fee))
+	return funding, nil
+}
+
+// Settle proposes a settlement of a funded escrow: a release pays the
+// escrow's outputs to the seller and a refund returns them to the buyer. The
+// settlement is broadcast once two parties have signed it. Proposing the same
+// settlement again rebuilds its transaction and discards its signatures.
+func (m *Manager) Settle(walletID wallet.ID, id int64, settlementType string) (Escrow, error) {
+	var dest func(Escrow) types.Address
+	switch settlementType {
+	case SettlementRelease:
+		dest = func(e Escrow) types.Address { return e.SellerAddress }
+	case SettlementRefund:
+		dest = func(e Escrow) types.Address { return e.BuyerAddress }
+	default:
+		return Escrow{}, fmt.Errorf("unknown settlement type %q", settlementType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.store.WalletEscrow(walletID, id)
+	if err != nil {
+		return Escrow{}, err
+	}
+	e, err = m.refresh(e, time.Now())
+	if err != nil {
+		return Escrow{}, err
+	} else if e.Status != StatusFunded {
+		return Escrow{}, ErrNotFunded
+	} else if e.Settlement != nil && e.Settlement.Type != settlementType && len(e.Settlement.Signatures) > 0 {
+		return Escrow{}, fmt.Errorf("%w: %s", ErrSettlementPending, e.Settlement.Type)
+	}
+
+	feePerByte, err := m.wm.WalletFeeRate(walletID)
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed to get fee rate: %w", err)
+	}
+	basis, err := m.wm.Tip()
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	}
+	utxos, err := m.outputs(e)
+	if err != nil {
+		return Escrow{}, fmt.Errorf("failed to get escrow outputs: %w", err)
+	}
+	if tip, err := m.wm.Tip(); err != nil {
+		return Escrow{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if tip != basis {
+		return Escrow{}, errors.New("wallet tip changed while fetching outputs")
+	}
+
+	var txn types.V2Transaction
+	var inputSum types.Currency
+	for _, sce := range utxos {
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+			Parent:          sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{Policy: e.Policy},
+		})
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+	}
+	txn.SiacoinOutputs = []types.SiacoinOutput{{Address: dest(e), Value: inputSum}}
+	// each input is signed by two parties
+	fee := feePerByte.Mul64(m.cm.TipState().V2TransactionWeight(txn) + uint64(len(txn.SiacoinInputs))*2*signatureSize)
+	if inputSum.Cmp(fee) <= 0 {
+		return Escrow{}, fmt.Errorf("%w: balance %v does not cover the fee %v", ErrNotFunded, inputSum, fee)
+	}
+	txn.SiacoinOutputs[0].Value = inputSum.Sub(fee)
+	txn.MinerFee = fee
+
+	e.Settlement = &Settlement{
+		Type:        settlementType,
+		Basis:       basis,
+		Transaction: txn,
+		SigHash:     m.cm.TipState().InputSigHash(txn),
+	}
+	if err := m.store.UpdateEscrow(e); err != nil {
+		return Escrow{}, fmt.Errorf("failed to update escrow: %w", err)
+	}
+	log := m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("escrow", e.ID))
+	log.Info("proposed escrow settlement", zap.String("type", settlementType), zap.Stringer("value", txn.SiacoinOutputs[0].Value), zap.Stringer("fee", fee))
+	m.broadcastEvent(log, settlementType, e)
+	return e, nil
+}
+
+// satisfiedPolicy returns the policy and signatures satisfying the escrow's
+// 2-of-3 policy with the settlement's signatures. The party that did not sign
+// is replaced by an opaque policy so its key does not consume a signature.
+func satisfiedPolicy(e Escrow, sigs []PartySignature) types.SatisfiedPolicy {
+	byKey := make(map[types.PublicKey]types.Signature)
+	for _, ps := range sigs {
+		byKey[ps.PublicKey] = ps.Signature
+	}
+	var sp types.SatisfiedPolicy
+	of := make([]types.SpendPolicy, 0, 3)
+	for _, pk := range []types.PublicKey{e.Buyer, e.Seller, e.Arbiter} {
+		policy := types.PolicyPublicKey(pk)
+		if sig, ok := byKey[pk]; ok && len(sp.Signatures) < 2 {
+			of = append(of, policy)
+			sp.Signatures = append(sp.Signatures, sig)
+		} else {
+			of = append(of, types.PolicyOpaque(policy))
+		}
+	}
+	sp.Policy = types.PolicyThreshold(2, of)
+	return sp
+}
+
+// AddSignature adds a party's signature to an escrow's pending settlement.
+// Once two parties have signed, the settlement is broadcast and the escrow is
+// released or refunded.
+//
+// Settlements are exempt from the treasury policy of the escrow's wallet. The
+// escrow's outputs are controlled by its 2-of-3 policy rather than the
+// wallet's keys, the signatures of two parties are the settlement's approval,
+// and a spending limit or allowlist must not block a release or refund the
+// parties have agreed to.
+func (m *Manager) AddSignature(walletID wallet.ID, id int64, pk types.PublicKey, sig types.Signature) (Escrow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, err := m.store.WalletEscrow(walletID, id)
+	if err != nil {
+		return Escrow{}, err
+	} else if e.Status != StatusFunded || e.Settlement == nil {
+		return Escrow{}, ErrNoSettlement
+	} else if pk != e.Buyer && pk != e.Seller && pk != e.Arbiter {
+		return Escrow{}, ErrUnknownKey
+	} else if !pk.VerifyHash(e.Settlement.SigHash, sig) {
+		return Escrow{}, ErrInvalidSignature
+	}
+
+	s := e.Settlement
+	for _, ps := range s.Signatures {
+		if ps.PublicKey == pk {
+			return e, nil // already signed
+		}
+	}
+	s.Signatures = append(s.Signatures, PartySignature{PublicKey: pk, Signature: sig})
+
+	log := m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("escrow", e.ID))
+	if len(s.Signatures) >= 2 {
+		txn := s.Transaction
+		sp := satisfiedPolicy(e, s.Signatures)
+		for i := range txn.SiacoinInputs {
+			txn.SiacoinInputs[i].SatisfiedPolicy = sp
+		}
+		txns := []types.V2Transaction{txn}
+		if _, err := m.cm.AddV2PoolTransactions(s.Basis, txns); err != nil {
+			return Escrow{}, fmt.Errorf("failed to add settlement to pool: %w", err)
+		}
+		m.s.BroadcastV2TransactionSet(s.Basis, txns)
+		s.Transaction = txn
+		e.Status = StatusReleased
+		if s.Type == SettlementRefund {
+			e.Status = StatusRefunded
+		}
+		e.DateSettled = time.Now()
+	}
+	if err := m.store.UpdateEscrow(e); err != nil {
+		return Escrow{}, fmt.Errorf("failed to update escrow: %w", err)
+	}
+	if e.Status != StatusFunded {
+		log.Info("settled escrow", zap.String("status", e.Status), zap.Stringer("txn", s.Transaction.ID()))
+		m.broadcastEvent(log, e.Status, e)
+	}
+	return e, nil
+}
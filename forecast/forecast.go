@@ -0,0 +1,162 @@
+// Package forecast projects the spendable balance of a wallet from its known
+// future inflows and outflows and its average daily flows.
+package forecast
+
+import (
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// Sources of known future flows.
+const (
+	// SourceMaturing is an immature output that becomes spendable when it
+	// matures.
+	SourceMaturing = "maturing"
+	// SourcePayments is a payment queued to be sent in the wallet's next
+	// batch.
+	SourcePayments = "payments"
+	// SourceApprovals is a transaction set waiting for approval.
+	SourceApprovals = "approvals"
+)
+
+const day = 24 * time.Hour
+
+type (
+	// An Item is a known future change to a wallet's spendable balance.
+	Item struct {
+		Source  string         `json:"source"`
+		Date    time.Time      `json:"date"`
+		Inflow  types.Currency `json:"inflow"`
+		Outflow types.Currency `json:"outflow"`
+	}
+
+	// A Day is the projected spendable balance of a wallet at the end of a
+	// day.
+	Day struct {
+		// Date is the start of the day in UTC.
+		Date time.Time `json:"date"`
+		// Inflow and Outflow are the known flows of the day, such as
+		// maturing outputs and queued payments.
+		Inflow  types.Currency `json:"inflow"`
+		Outflow types.Currency `json:"outflow"`
+		// Balance is the projected spendable balance, including the
+		// wallet's average daily flows.
+		Balance types.Currency `json:"balance"`
+		// Shortfall is the amount by which the projected outflows exceed
+		// the spendable balance. It is zero if Balance is not.
+		Shortfall types.Currency `json:"shortfall"`
+	}
+
+	// A Forecast projects the spendable balance of a wallet over the next
+	// days.
+	Forecast struct {
+		// Balance is the wallet's current spendable balance.
+		Balance types.Currency `json:"balance"`
+		// AverageInflow and AverageOutflow are the wallet's average daily
+		// flows over the history window. They are applied to every day.
+		AverageInflow  types.Currency `json:"averageInflow"`
+		AverageOutflow types.Currency `json:"averageOutflow"`
+		Items          []Item         `json:"items"`
+		Days           []Day          `json:"days"`
+		// Shortfall is the first day with a shortfall, if any.
+		Shortfall *time.Time `json:"shortfall,omitempty"`
+	}
+)
+
+// startOfDay returns the start of the UTC day containing t.
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// MaturityDate estimates when an output maturing at the given height becomes
+// spendable, assuming blocks are found every blockInterval after the tip.
+func MaturityDate(maturityHeight uint64, tip types.ChainIndex, now time.Time, blockInterval time.Duration) time.Time {
+	if maturityHeight <= tip.Height {
+		return now
+	}
+	return now.Add(time.Duration(maturityHeight-tip.Height) * blockInterval)
+}
+
+// AverageFlows returns the average daily siacoins received and sent by
+// events in [start, end). Each event counts its net flow, so change is not
+// counted.
+func AverageFlows(events []wallet.Event, start, end time.Time) (inflow, outflow types.Currency) {
+	days := uint64(end.Sub(start) / day)
+	if days == 0 {
+		return types.ZeroCurrency, types.ZeroCurrency
+	}
+	for _, ev := range events {
+		if ev.Timestamp.Before(start) || !ev.Timestamp.Before(end) {
+			continue
+		}
+		in, out := wallet.EventFlows(ev)
+		if in.Cmp(out) >= 0 {
+			inflow = inflow.Add(in.Sub(out))
+		} else {
+			outflow = outflow.Add(out.Sub(in))
+		}
+	}
+	return inflow.Div64(days), outflow.Div64(days)
+}
+
+// Project projects the spendable balance over n days starting with the day
+// containing now. Items dated before today are counted today, and items after
+// the last day are ignored.
+func Project(balance types.Currency, items []Item, avgInflow, avgOutflow types.Currency, now time.Time, n int) Forecast {
+	f := Forecast{
+		Balance:        balance,
+		AverageInflow:  avgInflow,
+		AverageOutflow: avgOutflow,
+		Items:          append([]Item{}, items...),
+		Days:           make([]Day, n),
+	}
+
+	today := startOfDay(now)
+	for i := range f.Days {
+		f.Days[i].Date = today.AddDate(0, 0, i)
+	}
+	for _, item := range items {
+		i := int(startOfDay(item.Date).Sub(today) / day)
+		if i < 0 {
+			i = 0
+		} else if i >= n {
+			continue
+		}
+		f.Days[i].Inflow = f.Days[i].Inflow.Add(item.Inflow)
+		f.Days[i].Outflow = f.Days[i].Outflow.Add(item.Outflow)
+	}
+
+	// the balance cannot go negative, so a deficit is carried separately
+	// until inflows cover it
+	bal, deficit := balance, types.ZeroCurrency
+	add := func(c types.Currency) {
+		if deficit.Cmp(c) >= 0 {
+			deficit = deficit.Sub(c)
+		} else {
+			bal, deficit = bal.Add(c.Sub(deficit)), types.ZeroCurrency
+		}
+	}
+	sub := func(c types.Currency) {
+		if bal.Cmp(c) >= 0 {
+			bal = bal.Sub(c)
+		} else {
+			bal, deficit = types.ZeroCurrency, deficit.Add(c.Sub(bal))
+		}
+	}
+	for i := range f.Days {
+		d := &f.Days[i]
+		add(d.Inflow)
+		add(avgInflow)
+		sub(d.Outflow)
+		sub(avgOutflow)
+		d.Balance, d.Shortfall = bal, deficit
+		if !deficit.IsZero() && f.Shortfall == nil {
+			date := d.Date
+			f.Shortfall = &date
+		}
+	}
+	return f
+}
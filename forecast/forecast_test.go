@@ -0,0 +1,97 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func TestMaturityDate(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	tip := types.ChainIndex{Height: 100}
+	if d := MaturityDate(90, tip, now, 10*time.Minute); !d.Equal(now) {
+		t.Fatalf("expected matured output to be dated now, got %v", d)
+	} else if d := MaturityDate(244, tip, now, 10*time.Minute); !d.Equal(now.Add(24 * time.Hour)) {
+		t.Fatalf("expected output to mature in a day, got %v", d)
+	}
+}
+
+func TestAverageFlows(t *testing.T) {
+	end := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -2)
+
+	addr := types.Address{1}
+	payout := func(ts time.Time, value types.Currency) wallet.Event {
+		return wallet.Event{
+			Timestamp: ts,
+			Relevant:  []types.Address{addr},
+			Data:      wallet.EventPayout{SiacoinElement: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: value}}},
+		}
+	}
+	send := wallet.Event{
+		Timestamp: start.Add(time.Hour),
+		Relevant:  []types.Address{addr},
+		Data: wallet.EventV1Transaction{
+			Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Address: types.Address{2}, Value: types.Siacoins(4)},
+					{Address: addr, Value: types.Siacoins(6)},
+				},
+			},
+			SpentSiacoinElements: []types.SiacoinElement{{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(10)}}},
+		},
+	}
+	events := []wallet.Event{
+		payout(end, types.Siacoins(100)), // after the window
+		payout(end.Add(-time.Hour), types.Siacoins(10)),
+		send,
+		payout(start.Add(-time.Hour), types.Siacoins(100)), // before the window
+	}
+
+	inflow, outflow := AverageFlows(events, start, end)
+	if !inflow.Equals(types.Siacoins(5)) {
+		t.Fatalf("expected %v average inflow, got %v", types.Siacoins(5), inflow)
+	} else if !outflow.Equals(types.Siacoins(2)) {
+		t.Fatalf("expected %v average outflow, got %v", types.Siacoins(2), outflow)
+	}
+}
+
+func TestProject(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	today := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
+
+	items := []Item{
+		{Source: SourceApprovals, Date: now.AddDate(0, 0, -3), Outflow: types.Siacoins(5)}, // overdue, counted today
+		{Source: SourcePayments, Date: now.AddDate(0, 0, 1), Outflow: types.Siacoins(20)},
+		{Source: SourceMaturing, Date: now.AddDate(0, 0, 2), Inflow: types.Siacoins(30)},
+		{Source: SourceMaturing, Date: now.AddDate(0, 0, 10), Inflow: types.Siacoins(100)}, // after the forecast
+	}
+	f := Project(types.Siacoins(10), items, types.Siacoins(1), types.Siacoins(2), now, 4)
+	if len(f.Days) != 4 {
+		t.Fatalf("expected 4 days, got %d", len(f.Days))
+	}
+
+	expected := []struct {
+		balance, shortfall types.Currency
+	}{
+		{types.Siacoins(4), types.ZeroCurrency},  // 10 + 1 - 5 - 2
+		{types.ZeroCurrency, types.Siacoins(17)}, // 4 + 1 - 20 - 2
+		{types.Siacoins(12), types.ZeroCurrency}, // -17 + 30 + 1 - 2
+		{types.Siacoins(11), types.ZeroCurrency},
+	}
+	for i, exp := range expected {
+		d := f.Days[i]
+		if !d.Date.Equal(today.AddDate(0, 0, i)) {
+			t.Fatalf("day %d: unexpected date %v", i, d.Date)
+		} else if !d.Balance.Equals(exp.balance) {
+			t.Fatalf("day %d: expected balance %v, got %v", i, exp.balance, d.Balance)
+		} else if !d.Shortfall.Equals(exp.shortfall) {
+			t.Fatalf("day %d: expected shortfall %v, got %v", i, exp.shortfall, d.Shortfall)
+		}
+	}
+	if f.Shortfall == nil || !f.Shortfall.Equal(today.AddDate(0, 0, 1)) {
+		t.Fatalf("expected shortfall on %v, got %v", today.AddDate(0, 0, 1), f.Shortfall)
+	}
+}
@@ -0,0 +1,452 @@
+package forwarding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/sweeper"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ScopeForwarding is the webhook scope of forwarding events.
+const ScopeForwarding = "forwarding"
+
+// Statuses of a forwarding sweep. Unsigned sweeps are sent to webhooks to be
+// signed and broadcast by the client.
+const (
+	SweepUnsigned  = sweeper.StatusUnsigned
+	SweepBroadcast = sweeper.StatusBroadcast
+	SweepPending   = sweeper.StatusPending
+)
+
+var (
+	// ErrNotFound is returned when a forwarding rule is not found.
+	ErrNotFound = errors.New("forwarding rule not found")
+	// ErrExists is returned when adding a rule for an address that already
+	// has one.
+	ErrExists = errors.New("address already has a forwarding rule")
+	// ErrNotWalletAddress is returned when adding a rule for an address
+	// that does not belong to the wallet.
+	ErrNotWalletAddress = errors.New("address does not belong to the wallet")
+	// ErrInvalidDestination is returned when a rule's destination is the
+	// void address or the deposit address itself.
+	ErrInvalidDestination = errors.New("invalid destination address")
+	// ErrNothingToSweep is returned when a deposit address has no
+	// confirmed outputs worth sweeping.
+	ErrNothingToSweep = errors.New("no outputs to sweep")
+	// ErrBelowMinimum is returned when the confirmed outputs of a deposit
+	// address are worth less than the rule's minimum amount.
+	ErrBelowMinimum = errors.New("confirmed value is below the rule minimum")
+)
+
+type (
+	// A Rule forwards the funds received at one of a wallet's deposit
+	// addresses to a destination address, such as a cold wallet or a
+	// consolidation address, or splits them among several destinations by
+	// percentage. Outputs are swept once they have at least
+	// MinConfirmations confirmations and their combined value is at least
+	// MinAmount.
+	Rule struct {
+		ID       int64         `json:"id"`
+		WalletID wallet.ID     `json:"walletID"`
+		Address  types.Address `json:"address"`
+		// Destination receives every sweep. It is the void address if the
+		// rule has Splits.
+		Destination types.Address `json:"destination"`
+		// Splits, if set, divides each sweep among several destinations.
+		Splits           []Split        `json:"splits,omitempty"`
+		MinConfirmations uint64         `json:"minConfirmations"`
+		MinAmount        types.Currency `json:"minAmount"`
+
+		// Sweeps, Forwarded, and Fees count the sweeps broadcast by the
+		// manager. Unsigned sweeps and sweeps waiting for approval are not
+		// counted, since they may never be broadcast.
+		Sweeps    int            `json:"sweeps"`
+		Forwarded types.Currency `json:"forwarded"`
+		Fees      types.Currency `json:"fees"`
+
+		DateCreated time.Time `json:"dateCreated"`
+		LastSweep   time.Time `json:"lastSweep"`
+	}
+
+	// A Sweep is a transaction forwarding outputs from a rule's deposit
+	// address to its destination, or its split destinations. Sweeps are
+	// kept as an audit record after their rule is removed.
+	Sweep struct {
+		ID          int64               `json:"id"`
+		RuleID      int64               `json:"ruleID"`
+		WalletID    wallet.ID           `json:"walletID"`
+		Address     types.Address       `json:"address"`
+		Destination types.Address       `json:"destination"`
+		Splits      []Split             `json:"splits,omitempty"`
+		Status      string              `json:"status"`
+		Basis       types.ChainIndex    `json:"basis"`
+		Transaction types.V2Transaction `json:"transaction"`
+		Value       types.Currency      `json:"value"`
+		Fee         types.Currency      `json:"fee"`
+		DateCreated time.Time           `json:"dateCreated"`
+	}
+
+	// A Store persists forwarding rules and their sweeps.
+	Store interface {
+		// AddForwardingRule adds a rule. It returns ErrExists if the
+		// address already has a rule.
+		AddForwardingRule(Rule) (Rule, error)
+		UpdateForwardingRule(Rule) error
+		RemoveForwardingRule(walletID wallet.ID, id int64) error
+		WalletForwardingRules(walletID wallet.ID) ([]Rule, error)
+		WalletForwardingRule(walletID wallet.ID, id int64) (Rule, error)
+		// ForwardingRules returns every rule.
+		ForwardingRules() ([]Rule, error)
+
+		AddForwardingSweep(Sweep) (Sweep, error)
+		// WalletForwardingSweeps returns a wallet's sweeps, newest first.
+		// If ruleID is non-zero, only the sweeps of that rule are
+		// returned.
+		WalletForwardingSweeps(walletID wallet.ID, ruleID int64, offset, limit int) ([]Sweep, error)
+
+		// ConfirmedSiacoinOutputs returns the unspent, matured outputs of
+		// an address at the tip that were created at or below maxHeight.
+		ConfirmedSiacoinOutputs(addr types.Address, tip types.ChainIndex, maxHeight uint64) ([]types.SiacoinElement, error)
+	}
+
+	// A ChainManager provides the pool and tip state used to build sweeps.
+	ChainManager = sweeper.ChainManager
+	// A Syncer relays signed sweeps to peers.
+	Syncer = sweeper.Syncer
+	// A Signer signs the sweeps of wallets with an external signer.
+	Signer = sweeper.Signer
+	// A TreasuryManager checks signed sweeps against the swept wallet's
+	// spending policy.
+	TreasuryManager = sweeper.TreasuryManager
+
+	// A WalletManager provides the addresses and fee rates of wallets with
+	// forwarding rules, and reserves the inputs of their sweeps.
+	WalletManager interface {
+		sweeper.WalletManager
+		Tip() (types.ChainIndex, error)
+		Addresses(id wallet.ID) ([]wallet.Address, error)
+		// WalletFeeRate returns the fee rate of the wallet's fee strategy.
+		WalletFeeRate(id wallet.ID) (types.Currency, error)
+	}
+
+	// An EventBroadcaster notifies webhooks of forwarding sweeps.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager periodically sweeps the confirmed deposits of addresses with
+	// forwarding rules to their destinations.
+	Manager struct {
+		store  Store
+		wm     WalletManager
+		signer Signer
+		tm     TreasuryManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+
+		interval         time.Duration
+		minConfirmations uint64
+		maxInputs        int
+		reserveDuration  time.Duration
+
+		mu sync.Mutex // serializes sweeps
+		sw *sweeper.Sweeper
+	}
+)
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// AddRule adds a forwarding rule for one of a wallet's addresses. Deposits
+// are forwarded to destination or, if splits are given, divided among the
+// split destinations; destination must be the void address in that case. If
+// minConfirmations is zero, the manager's default is used.
+func (m *Manager) AddRule(walletID wallet.ID, addr, destination types.Address, splits []Split, minConfirmations uint64, minAmount types.Currency) (Rule, error) {
+	if len(splits) > 0 {
+		if destination != types.VoidAddress {
+			return Rule{}, fmt.Errorf("%w: a rule cannot have both a destination and splits", ErrInvalidDestination)
+		} else if err := validateSplits(addr, splits); err != nil {
+			return Rule{}, err
+		}
+	} else if destination == types.VoidAddress || destination == addr {
+		return Rule{}, ErrInvalidDestination
+	}
+	if minConfirmations == 0 {
+		minConfirmations = m.minConfirmations
+	}
+
+	addresses, err := m.wm.Addresses(walletID)
+	if err != nil {
+		return Rule{}, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	var found bool
+	for _, wa := range addresses {
+		if wa.Address == addr {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return Rule{}, fmt.Errorf("%w: %v", ErrNotWalletAddress, addr)
+	}
+
+	r, err := m.store.AddForwardingRule(Rule{
+		WalletID:         walletID,
+		Address:          addr,
+		Destination:      destination,
+		Splits:           splits,
+		MinConfirmations: minConfirmations,
+		MinAmount:        minAmount,
+		DateCreated:      time.Now(),
+	})
+	if err != nil {
+		return Rule{}, err
+	}
+	m.log.Info("added forwarding rule", zap.Int64("wallet", int64(walletID)), zap.Int64("rule", r.ID), zap.Stringer("address", addr), zap.Stringer("destination", destination), zap.Int("splits", len(splits)))
+	return r, nil
+}
+
+// Rules returns a wallet's forwarding rules.
+func (m *Manager) Rules(walletID wallet.ID) ([]Rule, error) {
+	return m.store.WalletForwardingRules(walletID)
+}
+
+// Rule returns a wallet's forwarding rule.
+func (m *Manager) Rule(walletID wallet.ID, id int64) (Rule, error) {
+	return m.store.WalletForwardingRule(walletID, id)
+}
+
+// RemoveRule removes a wallet's forwarding rule. The rule's sweeps are kept.
+func (m *Manager) RemoveRule(walletID wallet.ID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.RemoveForwardingRule(walletID, id)
+}
+
+// Sweeps returns a wallet's forwarding sweeps, newest first. If ruleID is
+// non-zero, only the sweeps of that rule are returned.
+func (m *Manager) Sweeps(walletID wallet.ID, ruleID int64, offset, limit int) ([]Sweep, error) {
+	return m.store.WalletForwardingSweeps(walletID, ruleID, offset, limit)
+}
+
+// Sweep immediately sweeps the confirmed outputs of a rule's deposit
+// address, ignoring its minimum amount.
+func (m *Manager) Sweep(walletID wallet.ID, id int64) (Sweep, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.store.WalletForwardingRule(walletID, id)
+	if err != nil {
+		return Sweep{}, err
+	}
+	return m.sweep(r, true, time.Now())
+}
+
+func (m *Manager) broadcastEvent(log *zap.Logger, event string, data any) {
+	if m.events == nil {
+		return
+	}
+	if err := m.events.BroadcastEvent(ScopeForwarding, event, data); err != nil {
+		log.Warn("failed to broadcast event", zap.Error(err))
+	}
+}
+
+// sweep funds a transaction moving the confirmed outputs of the rule's
+// deposit address to its destination or split destinations. If the wallet
+// has an external signer, the sweep is signed and broadcast, and if signing
+// or broadcasting fails, its inputs are released and no sweep is recorded.
+// Otherwise, it must be signed and broadcast by the client. The caller must
+// hold the lock.
+func (m *Manager) sweep(r Rule, force bool, now time.Time) (Sweep, error) {
+	feePerByte, err := m.wm.WalletFeeRate(r.WalletID)
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get fee rate: %w", err)
+	}
+
+	// the outputs' proofs must match the basis; if the wallet advances
+	// while they are fetched, the sweep is retried later.
+	basis, err := m.wm.Tip()
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if basis.Height+1 < r.MinConfirmations {
+		return Sweep{}, ErrNothingToSweep
+	}
+	utxos, err := m.store.ConfirmedSiacoinOutputs(r.Address, basis, basis.Height+1-r.MinConfirmations)
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get confirmed outputs: %w", err)
+	}
+	if tip, err := m.wm.Tip(); err != nil {
+		return Sweep{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if tip != basis {
+		return Sweep{}, errors.New("wallet tip changed while fetching outputs")
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].SiacoinOutput.Value.Cmp(utxos[j].SiacoinOutput.Value) > 0
+	})
+
+	addresses, err := m.wm.Addresses(r.WalletID)
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	var policy types.SpendPolicy
+	for _, addr := range addresses {
+		if addr.Address == r.Address && addr.SpendPolicy != nil {
+			policy = *addr.SpendPolicy
+		}
+	}
+
+	inputs, inputSum := m.sw.Inputs(utxos, feePerByte, m.maxInputs, func(types.Address) types.SpendPolicy { return policy }, now)
+	if len(inputs) == 0 {
+		return Sweep{}, ErrNothingToSweep
+	} else if !force && inputSum.Cmp(r.MinAmount) < 0 {
+		return Sweep{}, fmt.Errorf("%w: %v < %v", ErrBelowMinimum, inputSum, r.MinAmount)
+	}
+
+	txn := types.V2Transaction{SiacoinInputs: inputs}
+
+	if len(r.Splits) > 0 {
+		txn.SiacoinOutputs = splitOutputs(inputSum, r.Splits)
+	} else {
+		txn.SiacoinOutputs = []types.SiacoinOutput{{
+			Address: r.Destination,
+			Value:   inputSum,
+		}}
+	}
+	fee := m.sw.Fee(txn, feePerByte)
+	if inputSum.Cmp(fee) <= 0 {
+		return Sweep{}, ErrNothingToSweep
+	}
+	value := inputSum.Sub(fee)
+	if len(r.Splits) > 0 {
+		txn.SiacoinOutputs = splitOutputs(value, r.Splits)
+		for _, sco := range txn.SiacoinOutputs {
+			if sco.Value.IsZero() {
+				return Sweep{}, fmt.Errorf("%w: the share of %v would be empty", ErrBelowMinimum, sco.Address)
+			}
+		}
+	} else {
+		txn.SiacoinOutputs[0].Value = value
+	}
+	txn.MinerFee = fee
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return Sweep{}, err
+	}
+	defer cancel()
+	txn, status, err := m.sw.Submit(ctx, r.WalletID, basis, txn, now)
+	if err != nil {
+		return Sweep{}, err
+	}
+
+	sweep, err := m.store.AddForwardingSweep(Sweep{
+		RuleID:      r.ID,
+		WalletID:    r.WalletID,
+		Address:     r.Address,
+		Destination: r.Destination,
+		Splits:      r.Splits,
+		Status:      status,
+		Basis:       basis,
+		Transaction: txn,
+		Value:       value,
+		Fee:         fee,
+		DateCreated: now,
+	})
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to add sweep: %w", err)
+	}
+	if status == SweepBroadcast {
+		r.Sweeps++
+		r.Forwarded = r.Forwarded.Add(sweep.Value)
+		r.Fees = r.Fees.Add(fee)
+	}
+	r.LastSweep = now
+	if err := m.store.UpdateForwardingRule(r); err != nil {
+		return Sweep{}, fmt.Errorf("failed to update rule: %w", err)
+	}
+
+	log := m.log.With(zap.Int64("wallet", int64(r.WalletID)), zap.Int64("rule", r.ID))
+	log.Info("forwarded deposits", zap.Int64("sweep", sweep.ID), zap.String("status", status), zap.Int("inputs", len(txn.SiacoinInputs)), zap.Stringer("value", sweep.Value), zap.Stringer("fee", fee))
+	event := "sweep"
+	if len(r.Splits) > 0 {
+		event = "split"
+	}
+	m.broadcastEvent(log, event, sweep)
+	return sweep, nil
+}
+
+// check sweeps the deposit addresses of every rule.
+func (m *Manager) check(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules, err := m.store.ForwardingRules()
+	if err != nil {
+		m.log.Error("failed to get forwarding rules", zap.Error(err))
+		return
+	}
+	for _, r := range rules {
+		log := m.log.With(zap.Int64("wallet", int64(r.WalletID)), zap.Int64("rule", r.ID))
+		_, err := m.sweep(r, false, now)
+		switch {
+		case errors.Is(err, ErrNothingToSweep):
+		case errors.Is(err, ErrBelowMinimum):
+			log.Debug("delaying sweep", zap.Error(err))
+		case err != nil:
+			log.Warn("failed to sweep deposit address", zap.Error(err))
+		}
+	}
+}
+
+// NewManager creates a new forwarding manager and starts sweeping deposit
+// addresses in the background.
+func NewManager(store Store, cm ChainManager, s Syncer, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		interval:         time.Minute,
+		minConfirmations: 6,
+		maxInputs:        100,
+		reserveDuration:  3 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.minConfirmations == 0 {
+		return nil, errors.New("minimum confirmations must be greater than zero")
+	} else if m.maxInputs <= 0 {
+		return nil, errors.New("maximum inputs must be greater than zero")
+	}
+	m.sw = sweeper.New(cm, s, wm, m.signer, m.tm, "forwarding", m.reserveDuration)
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "forwarding", "sweeps the deposit addresses of forwarding rules", m.interval, false, func(context.Context) error {
+			m.check(time.Now())
+			return nil
+		})
+	}()
+	return m, nil
+}
@@ -0,0 +1,435 @@
+package forwarding_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct{}
+
+func (chainManager) TipState() consensus.State                 { return consensus.State{} }
+func (chainManager) PoolTransactions() []types.Transaction     { return nil }
+func (chainManager) V2PoolTransactions() []types.V2Transaction { return nil }
+func (chainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	mu        sync.Mutex
+	tip       types.ChainIndex
+	addresses []wallet.Address
+	reserved  map[types.Hash256]bool
+}
+
+func (wm *walletManager) Tip() (types.ChainIndex, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.tip, nil
+}
+
+func (wm *walletManager) Addresses(wallet.ID) ([]wallet.Address, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]wallet.Address(nil), wm.addresses...), nil
+}
+
+func (wm *walletManager) Reserve(ids []types.Hash256, _ time.Duration) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		if wm.reserved[id] {
+			return fmt.Errorf("output %v already reserved", id)
+		}
+	}
+	for _, id := range ids {
+		wm.reserved[id] = true
+	}
+	return nil
+}
+
+func (wm *walletManager) Release(ids []types.Hash256) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		delete(wm.reserved, id)
+	}
+}
+
+func (wm *walletManager) WalletFeeRate(wallet.ID) (types.Currency, error) {
+	return types.NewCurrency64(1), nil
+}
+
+// A store replaces the outputs of the database with outputs created at
+// fixed heights.
+type store struct {
+	*sqlite.Store
+
+	mu      sync.Mutex
+	utxos   []types.SiacoinElement
+	heights map[types.SiacoinOutputID]uint64
+}
+
+func (s *store) addOutput(sce types.SiacoinElement, height uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.utxos = append(s.utxos, sce)
+	s.heights[sce.ID] = height
+}
+
+func (s *store) ConfirmedSiacoinOutputs(addr types.Address, _ types.ChainIndex, maxHeight uint64) (utxos []types.SiacoinElement, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sce := range s.utxos {
+		if sce.SiacoinOutput.Address == addr && s.heights[sce.ID] <= maxHeight {
+			utxos = append(utxos, sce)
+		}
+	}
+	return utxos, nil
+}
+
+func TestForwarding(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "deposits"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{
+		tip:      types.ChainIndex{Height: 100},
+		reserved: make(map[types.Hash256]bool),
+	}
+	for i := 0; i < 2; i++ {
+		sk := types.GeneratePrivateKey()
+		policy := types.PolicyPublicKey(sk.PublicKey())
+		wm.addresses = append(wm.addresses, wallet.Address{Address: policy.Address(), SpendPolicy: &policy})
+	}
+	deposit := wm.addresses[0].Address
+	cold := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey()).Address()
+
+	s := &store{Store: db, heights: make(map[types.SiacoinOutputID]uint64)}
+	fm, err := forwarding.NewManager(s, chainManager{}, syncer{}, wm, forwarding.WithLogger(log.Named("forwarding")), forwarding.WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	if _, err := fm.AddRule(w.ID, types.Address{1}, cold, nil, 0, types.ZeroCurrency); !errors.Is(err, forwarding.ErrNotWalletAddress) {
+		t.Fatalf("expected ErrNotWalletAddress, got %v", err)
+	} else if _, err := fm.AddRule(w.ID, deposit, deposit, nil, 0, types.ZeroCurrency); !errors.Is(err, forwarding.ErrInvalidDestination) {
+		t.Fatalf("expected ErrInvalidDestination, got %v", err)
+	}
+
+	r, err := fm.AddRule(w.ID, deposit, cold, nil, 0, types.Siacoins(1500))
+	if err != nil {
+		t.Fatal(err)
+	} else if r.MinConfirmations != 6 {
+		t.Fatalf("expected the default of 6 confirmations, got %d", r.MinConfirmations)
+	} else if _, err := fm.AddRule(w.ID, deposit, cold, nil, 0, types.ZeroCurrency); !errors.Is(err, forwarding.ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+
+	// an output with 6 confirmations is not enough to meet the minimum
+	s.addOutput(types.SiacoinElement{
+		ID:            types.SiacoinOutputID{1},
+		SiacoinOutput: types.SiacoinOutput{Address: deposit, Value: types.Siacoins(1000)},
+	}, 95)
+	// outputs of other addresses are not swept
+	s.addOutput(types.SiacoinElement{
+		ID:            types.SiacoinOutputID{2},
+		SiacoinOutput: types.SiacoinOutput{Address: wm.addresses[1].Address, Value: types.Siacoins(1000)},
+	}, 90)
+	// a recent output is not yet confirmed
+	s.addOutput(types.SiacoinElement{
+		ID:            types.SiacoinOutputID{3},
+		SiacoinOutput: types.SiacoinOutput{Address: deposit, Value: types.Siacoins(1000)},
+	}, 96)
+
+	if _, err := fm.Sweep(w.ID, r.ID+1); !errors.Is(err, forwarding.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// once the recent output is confirmed, both outputs are swept
+	fm.Close()
+	wm.mu.Lock()
+	wm.tip.Height++
+	wm.mu.Unlock()
+	fm, err = forwarding.NewManager(s, chainManager{}, syncer{}, wm, forwarding.WithLogger(log.Named("forwarding")), forwarding.WithInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	var sweeps []forwarding.Sweep
+	for i := 0; ; i++ {
+		sweeps, err = fm.Sweeps(w.ID, r.ID, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(sweeps) != 0 {
+			break
+		} else if i == 100 {
+			t.Fatal("expected deposits to be swept")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sweep := sweeps[0]
+	txn := sweep.Transaction
+	if len(sweeps) != 1 || sweep.Status != forwarding.SweepUnsigned {
+		t.Fatalf("expected a single unsigned sweep, got %v", sweeps)
+	} else if len(txn.SiacoinInputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(txn.SiacoinInputs))
+	} else if len(txn.SiacoinOutputs) != 1 || txn.SiacoinOutputs[0].Address != cold {
+		t.Fatalf("expected a single output to the destination, got %v", txn.SiacoinOutputs)
+	} else if !txn.SiacoinOutputs[0].Value.Add(txn.MinerFee).Equals(types.Siacoins(2000)) || !txn.MinerFee.Equals(sweep.Fee) {
+		t.Fatal("sweep value and fee do not match inputs")
+	} else if sweep.Address != deposit || sweep.Destination != cold || sweep.Basis.Height != 101 {
+		t.Fatalf("unexpected sweep record: %+v", sweep)
+	}
+
+	// reserved inputs are not swept again
+	if _, err := fm.Sweep(w.ID, r.ID); !errors.Is(err, forwarding.ErrNothingToSweep) {
+		t.Fatalf("expected ErrNothingToSweep, got %v", err)
+	}
+
+	r, err = fm.Rule(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if r.Sweeps != 0 || !r.Forwarded.IsZero() || !r.Fees.IsZero() {
+		t.Fatalf("expected unsigned sweep not to be counted, got %+v", r)
+	}
+
+	// removing the rule keeps its sweeps
+	if err := fm.RemoveRule(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	} else if err := fm.RemoveRule(w.ID, r.ID); !errors.Is(err, forwarding.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if rules, err := fm.Rules(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(rules) != 0 {
+		t.Fatalf("expected no rules, got %v", rules)
+	} else if sweeps, err := fm.Sweeps(w.ID, 0, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(sweeps) != 1 || sweeps[0].ID != sweep.ID || sweeps[0].Transaction.ID() != txn.ID() {
+		t.Fatalf("expected the sweep to be kept, got %v", sweeps)
+	}
+}
+
+func TestSplitRule(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "revenue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk := types.GeneratePrivateKey()
+	policy := types.PolicyPublicKey(sk.PublicKey())
+	wm := &walletManager{
+		tip:       types.ChainIndex{Height: 100},
+		addresses: []wallet.Address{{Address: policy.Address(), SpendPolicy: &policy}},
+		reserved:  make(map[types.Hash256]bool),
+	}
+	deposit := wm.addresses[0].Address
+	dest1 := types.Address{1}
+	dest2 := types.Address{2}
+	dest3 := types.Address{3}
+
+	s := &store{Store: db, heights: make(map[types.SiacoinOutputID]uint64)}
+	fm, err := forwarding.NewManager(s, chainManager{}, syncer{}, wm, forwarding.WithLogger(log.Named("forwarding")), forwarding.WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	invalid := [][]forwarding.Split{
+		{{Address: dest1, BasisPoints: 10000}},                                       // a single destination
+		{{Address: dest1, BasisPoints: 5000}, {Address: dest2, BasisPoints: 4000}},   // does not add up to 100%
+		{{Address: dest1, BasisPoints: 5000}, {Address: dest1, BasisPoints: 5000}},   // duplicate destination
+		{{Address: dest1, BasisPoints: 10000}, {Address: dest2, BasisPoints: 0}},     // empty share
+		{{Address: deposit, BasisPoints: 5000}, {Address: dest2, BasisPoints: 5000}}, // the deposit address
+	}
+	for i, splits := range invalid {
+		if _, err := fm.AddRule(w.ID, deposit, types.VoidAddress, splits, 1, types.ZeroCurrency); !errors.Is(err, forwarding.ErrInvalidSplits) {
+			t.Fatalf("%d: expected ErrInvalidSplits, got %v", i, err)
+		}
+	}
+
+	splits := []forwarding.Split{
+		{Address: dest1, BasisPoints: 5000},
+		{Address: dest2, BasisPoints: 3333},
+		{Address: dest3, BasisPoints: 1667},
+	}
+	if _, err := fm.AddRule(w.ID, deposit, dest1, splits, 1, types.ZeroCurrency); !errors.Is(err, forwarding.ErrInvalidDestination) {
+		t.Fatalf("expected ErrInvalidDestination, got %v", err)
+	}
+	r, err := fm.AddRule(w.ID, deposit, types.VoidAddress, splits, 1, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	} else if r, err = fm.Rule(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	} else if len(r.Splits) != 3 || r.Splits[1] != splits[1] {
+		t.Fatalf("expected splits to be stored, got %v", r.Splits)
+	}
+
+	s.addOutput(types.SiacoinElement{
+		ID:            types.SiacoinOutputID{1},
+		SiacoinOutput: types.SiacoinOutput{Address: deposit, Value: types.Siacoins(1000)},
+	}, 100)
+	sweep, err := fm.Sweep(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn := sweep.Transaction
+	if len(txn.SiacoinOutputs) != 3 {
+		t.Fatalf("expected 3 outputs, got %d", len(txn.SiacoinOutputs))
+	}
+	var sum types.Currency
+	for i, sco := range txn.SiacoinOutputs {
+		if sco.Address != splits[i].Address {
+			t.Fatalf("expected output %d to pay %v, got %v", i, splits[i].Address, sco.Address)
+		}
+		sum = sum.Add(sco.Value)
+	}
+	if !sum.Equals(sweep.Value) || !sum.Add(txn.MinerFee).Equals(types.Siacoins(1000)) {
+		t.Fatalf("outputs %v and fee %v do not add up to the swept value", sum, txn.MinerFee)
+	} else if share := sweep.Value.Mul64(3333).Div64(10000); !txn.SiacoinOutputs[1].Value.Equals(share) {
+		t.Fatalf("expected the second destination to receive %v, got %v", share, txn.SiacoinOutputs[1].Value)
+	} else if len(sweep.Splits) != 3 {
+		t.Fatalf("expected the sweep to record its splits, got %v", sweep.Splits)
+	}
+}
+
+type signer struct{}
+
+func (signer) SignV2Transaction(_ context.Context, _ wallet.ID, txn types.V2Transaction) (types.V2Transaction, error) {
+	return txn, nil
+}
+
+type treasuryManager struct {
+	calls int
+	// err rejects sets, and approve broadcasts them instead of queueing
+	// them
+	err     error
+	approve bool
+}
+
+func (tm *treasuryManager) BroadcastTransactionSet(_ []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error) {
+	tm.calls++
+	if tm.err != nil {
+		return treasury.PendingTransaction{}, false, tm.err
+	} else if tm.approve {
+		return treasury.PendingTransaction{}, false, broadcast()
+	}
+	return treasury.PendingTransaction{ID: 1, V2Transactions: v2txns, SubmittedBy: submittedBy}, true, nil
+}
+
+func TestSweepApproval(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "deposits"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey())
+	wm := &walletManager{
+		tip:       types.ChainIndex{Height: 100},
+		addresses: []wallet.Address{{Address: policy.Address(), SpendPolicy: &policy}},
+		reserved:  make(map[types.Hash256]bool),
+	}
+	deposit := wm.addresses[0].Address
+
+	s := &store{Store: db, heights: make(map[types.SiacoinOutputID]uint64)}
+	tm := new(treasuryManager)
+	fm, err := forwarding.NewManager(s, chainManager{}, syncer{}, wm, forwarding.WithLogger(log.Named("forwarding")), forwarding.WithInterval(time.Hour), forwarding.WithSigner(signer{}), forwarding.WithTreasuryManager(tm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fm.Close()
+
+	r, err := fm.AddRule(w.ID, deposit, types.Address{1}, nil, 1, types.ZeroCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.addOutput(types.SiacoinElement{
+		ID:            types.SiacoinOutputID{1},
+		SiacoinOutput: types.SiacoinOutput{Address: deposit, Value: types.Siacoins(1000)},
+	}, 100)
+
+	// signed sweeps go through the treasury manager
+	sweep, err := fm.Sweep(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if tm.calls != 1 {
+		t.Fatal("expected sweep to be checked by the treasury manager")
+	} else if sweep.Status != forwarding.SweepPending {
+		t.Fatalf("expected status %q, got %q", forwarding.SweepPending, sweep.Status)
+	} else if r, err := fm.Rule(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	} else if r.Sweeps != 0 || !r.Forwarded.IsZero() {
+		t.Fatalf("expected pending sweep not to be counted, got %+v", r)
+	}
+
+	// a rejected sweep is not recorded and releases its inputs
+	s.addOutput(types.SiacoinElement{
+		ID:            types.SiacoinOutputID{2},
+		SiacoinOutput: types.SiacoinOutput{Address: deposit, Value: types.Siacoins(1000)},
+	}, 100)
+	tm.err = treasury.ErrLimitExceeded
+	if _, err := fm.Sweep(w.ID, r.ID); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if sweeps, err := fm.Sweeps(w.ID, r.ID, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(sweeps) != 1 {
+		t.Fatalf("expected the rejected sweep not to be recorded, got %d sweeps", len(sweeps))
+	}
+
+	// once allowed, the released output is swept and counted
+	tm.err, tm.approve = nil, true
+	sweep, err = fm.Sweep(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if sweep.Status != forwarding.SweepBroadcast {
+		t.Fatalf("expected status %q, got %q", forwarding.SweepBroadcast, sweep.Status)
+	} else if len(sweep.Transaction.SiacoinInputs) != 1 || sweep.Transaction.SiacoinInputs[0].Parent.ID != (types.SiacoinOutputID{2}) {
+		t.Fatalf("expected the released output to be swept, got %v", sweep.Transaction.SiacoinInputs)
+	} else if r, err := fm.Rule(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	} else if r.Sweeps != 1 || !r.Forwarded.Equals(sweep.Value) || !r.Fees.Equals(sweep.Fee) {
+		t.Fatalf("expected the broadcast sweep to be counted, got %+v", r)
+	}
+}
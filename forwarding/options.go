@@ -0,0 +1,88 @@
+package forwarding
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send forwarding events
+// to webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithSigner sets the signer used to sign sweeps of wallets with an external
+// signer. Sweeps of other wallets must be signed by the client.
+func WithSigner(s Signer) Option {
+	return func(m *Manager) {
+		m.signer = s
+	}
+}
+
+// WithTreasuryManager checks signed sweeps against the spending policy of the
+// swept wallet, so that a forwarding rule cannot move funds past its limits,
+// allowlist, or approval threshold. Sweeps that violate the policy are not
+// recorded and their inputs are released, and sweeps that require approval
+// are added to the approval queue.
+func WithTreasuryManager(tm TreasuryManager) Option {
+	return func(m *Manager) {
+		m.tm = tm
+	}
+}
+
+// WithInterval sets how often deposit addresses are swept. The default is
+// one minute.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.interval = d
+		}
+	}
+}
+
+// WithMinConfirmations sets the default number of confirmations an output
+// needs before it is forwarded. The default is 6.
+func WithMinConfirmations(n uint64) Option {
+	return func(m *Manager) {
+		m.minConfirmations = n
+	}
+}
+
+// WithMaxInputs sets the maximum number of inputs in a sweep. The default
+// is 100.
+func WithMaxInputs(n int) Option {
+	return func(m *Manager) {
+		m.maxInputs = n
+	}
+}
+
+// WithReserveDuration sets how long a sweep's inputs are reserved. Unsigned
+// sweeps must be signed and broadcast within this time. The default is
+// three hours.
+func WithReserveDuration(d time.Duration) Option {
+	return func(m *Manager) {
+		m.reserveDuration = d
+	}
+}
+
+// WithScheduler registers the deposit address sweep as the "forwarding"
+// job. Pausing it leaves funds on the deposit addresses until it resumes.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
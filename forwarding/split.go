@@ -0,0 +1,73 @@
+package forwarding
+
+import (
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+)
+
+const (
+	// totalBasisPoints is the sum of the shares of a split rule's
+	// destinations.
+	totalBasisPoints = 10000
+	// maxSplits is the maximum number of destinations of a split rule.
+	maxSplits = 20
+)
+
+// ErrInvalidSplits is returned when a split rule's destinations are invalid.
+var ErrInvalidSplits = errors.New("invalid split destinations")
+
+// A Split is a destination of a split rule and its share of each sweep.
+type Split struct {
+	Address types.Address `json:"address"`
+	// BasisPoints is the destination's share of each sweep, in hundredths
+	// of a percent. The shares of a rule's destinations must add up to
+	// 10000.
+	BasisPoints uint64 `json:"basisPoints"`
+}
+
+// validateSplits checks that the destinations of a split rule for addr are
+// distinct, valid addresses whose shares add up to 100%.
+func validateSplits(addr types.Address, splits []Split) error {
+	if len(splits) < 2 {
+		return fmt.Errorf("%w: at least 2 destinations are required", ErrInvalidSplits)
+	} else if len(splits) > maxSplits {
+		return fmt.Errorf("%w: at most %d destinations are allowed", ErrInvalidSplits, maxSplits)
+	}
+
+	seen := make(map[types.Address]bool)
+	var total uint64
+	for _, s := range splits {
+		switch {
+		case s.Address == types.VoidAddress || s.Address == addr:
+			return fmt.Errorf("%w: invalid destination %v", ErrInvalidSplits, s.Address)
+		case seen[s.Address]:
+			return fmt.Errorf("%w: duplicate destination %v", ErrInvalidSplits, s.Address)
+		case s.BasisPoints == 0 || s.BasisPoints > totalBasisPoints:
+			return fmt.Errorf("%w: destination %v has an invalid share of %d basis points", ErrInvalidSplits, s.Address, s.BasisPoints)
+		}
+		seen[s.Address] = true
+		total += s.BasisPoints
+	}
+	if total != totalBasisPoints {
+		return fmt.Errorf("%w: shares add up to %d basis points, expected %d", ErrInvalidSplits, total, totalBasisPoints)
+	}
+	return nil
+}
+
+// splitOutputs divides value among the destinations by their shares. The
+// remainder of the division is added to the first destination.
+func splitOutputs(value types.Currency, splits []Split) []types.SiacoinOutput {
+	outputs := make([]types.SiacoinOutput, len(splits))
+	var sum types.Currency
+	for i, s := range splits {
+		outputs[i] = types.SiacoinOutput{
+			Address: s.Address,
+			Value:   value.Mul64(s.BasisPoints).Div64(totalBasisPoints),
+		}
+		sum = sum.Add(outputs[i].Value)
+	}
+	outputs[0].Value = outputs[0].Value.Add(value.Sub(sum))
+	return outputs
+}
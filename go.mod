@@ -6,11 +6,14 @@ toolchain go1.23.2
 
 require (
 	github.com/mattn/go-sqlite3 v1.14.24
+	go.etcd.io/bbolt v1.3.11
 	go.sia.tech/jape v0.12.1
 	go.sia.tech/web/walletd v0.24.0
 	go.thebigfile.com/core v1.0.1
 	go.thebigfile.com/coreutils v0.0.4
 	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.29.0
+	golang.org/x/sys v0.27.0
 	golang.org/x/term v0.26.0
 	gopkg.in/yaml.v3 v3.0.1
 	lukechampine.com/flagg v1.1.1
@@ -20,11 +23,8 @@ require (
 
 require (
 	github.com/julienschmidt/httprouter v1.3.0 // indirect
-	go.etcd.io/bbolt v1.3.11 // indirect
 	go.sia.tech/mux v1.3.0 // indirect
 	go.sia.tech/web v0.0.0-20240610131903-5611d44a533e // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/crypto v0.29.0 // indirect
-	golang.org/x/sys v0.27.0 // indirect
 	golang.org/x/tools v0.22.0 // indirect
 )
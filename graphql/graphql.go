@@ -0,0 +1,621 @@
+// Package graphql implements a small GraphQL query executor. It supports
+// queries with variables, aliases, fragments, and the @skip and @include
+// directives. Mutations, subscriptions, and introspection are not supported.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxDepth is the maximum depth of a query's selections if the schema
+// does not set one.
+const DefaultMaxDepth = 10
+
+type (
+	// A ResolveFunc returns the value of a field. The source is the value
+	// of the field's parent object. Fields of object type return the
+	// object's source value, or a slice of them for list fields; nil
+	// results are returned as null. Scalar fields return a value that is
+	// encoded as JSON.
+	ResolveFunc func(ctx context.Context, source any, args Args) (any, error)
+
+	// A Field is a field of an object type.
+	Field struct {
+		// Type is the type of the field's value. It is nil for scalar
+		// fields.
+		Type *Object
+		// Args are the names of the arguments the field accepts.
+		Args    []string
+		Resolve ResolveFunc
+	}
+
+	// An Object is an object type.
+	Object struct {
+		Name   string
+		Fields map[string]*Field
+	}
+
+	// A Schema is the set of types that can be queried.
+	Schema struct {
+		Query *Object
+		// MaxDepth is the maximum depth of a query's selections. If zero,
+		// DefaultMaxDepth is used.
+		MaxDepth int
+	}
+
+	// Args are the arguments of a field, with variables resolved.
+	Args map[string]any
+
+	// A Request is a GraphQL request.
+	Request struct {
+		Query         string                     `json:"query"`
+		OperationName string                     `json:"operationName,omitempty"`
+		Variables     map[string]json.RawMessage `json:"variables,omitempty"`
+	}
+
+	// A Location is a position in a query document.
+	Location struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	}
+
+	// An Error is an error encountered while validating or executing a
+	// query.
+	Error struct {
+		Message   string     `json:"message"`
+		Locations []Location `json:"locations,omitempty"`
+		// Path is the response path of the field that failed, if any.
+		Path []any `json:"path,omitempty"`
+	}
+
+	// A Response is the result of executing a query. If the query could not
+	// be parsed or validated, Data is nil.
+	Response struct {
+		Data   json.RawMessage `json:"data,omitempty"`
+		Errors []Error         `json:"errors,omitempty"`
+	}
+)
+
+// Int returns the value of an integer argument, or def if it is not set.
+func (a Args) Int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		// variables are decoded as floats
+		if v != math.Trunc(v) || math.Abs(v) > math.MaxInt32 {
+			return 0, fmt.Errorf("argument %q must be an integer", name)
+		}
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("argument %q must be an integer", name)
+	}
+}
+
+// String returns the value of a string argument, or def if it is not set.
+func (a Args) String(name string, def string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+}
+
+// Text decodes a string argument into v using its UnmarshalText method. It
+// returns an error if the argument is not set.
+func (a Args) Text(name string, v encoding.TextUnmarshaler) error {
+	s, ok := a[name].(string)
+	if !ok {
+		return fmt.Errorf("argument %q must be a string", name)
+	} else if err := v.UnmarshalText([]byte(s)); err != nil {
+		return fmt.Errorf("invalid argument %q: %w", name, err)
+	}
+	return nil
+}
+
+// Error implements error.
+func (e Error) Error() string {
+	return e.Message
+}
+
+// orderedObject is a JSON object that keeps the order of its keys.
+type orderedObject struct {
+	keys   []string
+	values []any
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode field %q: %w", key, err)
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type executor struct {
+	schema    *Schema
+	types     map[string]*Object
+	doc       document
+	variables map[string]any
+	errors    []Error
+}
+
+// types returns every object type reachable from the query type, keyed by
+// name.
+func (s *Schema) types() map[string]*Object {
+	types := make(map[string]*Object)
+	var walk func(*Object)
+	walk = func(o *Object) {
+		if _, ok := types[o.Name]; ok {
+			return
+		}
+		types[o.Name] = o
+		for _, f := range o.Fields {
+			if f.Type != nil {
+				walk(f.Type)
+			}
+		}
+	}
+	walk(s.Query)
+	return types
+}
+
+func selectionError(sel selection, format string, args ...any) Error {
+	return Error{
+		Message:   fmt.Sprintf(format, args...),
+		Locations: []Location{{sel.line, sel.col}},
+	}
+}
+
+// validate checks that every selection refers to a field of its type with
+// known arguments, that fields have selections if and only if they are
+// objects, and that the selections are not too deep.
+func (e *executor) validate(selections []selection, obj *Object, depth int, fragments []string) error {
+	maxDepth := e.schema.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	if depth > maxDepth {
+		return fmt.Errorf("query exceeds the maximum depth of %d", maxDepth)
+	}
+
+	for _, sel := range selections {
+		for _, d := range sel.directives {
+			if d.name != "skip" && d.name != "include" {
+				return selectionError(sel, "unknown directive @%s", d.name)
+			} else if len(d.args) != 1 || d.args[0].name != "if" {
+				return selectionError(sel, "directive @%s requires a single \"if\" argument", d.name)
+			}
+		}
+
+		switch {
+		case sel.fragment != "":
+			f, ok := e.doc.fragments[sel.fragment]
+			if !ok {
+				return selectionError(sel, "unknown fragment %q", sel.fragment)
+			}
+			for _, name := range fragments {
+				if name == sel.fragment {
+					return selectionError(sel, "fragment %q spreads itself", sel.fragment)
+				}
+			}
+			cond, ok := e.types[f.typeCondition]
+			if !ok {
+				return selectionError(sel, "unknown type %q", f.typeCondition)
+			} else if err := e.validate(f.selections, cond, depth, append(append([]string(nil), fragments...), sel.fragment)); err != nil {
+				return err
+			}
+		case sel.inline:
+			cond := obj
+			if sel.typeCondition != "" {
+				var ok bool
+				if cond, ok = e.types[sel.typeCondition]; !ok {
+					return selectionError(sel, "unknown type %q", sel.typeCondition)
+				}
+			}
+			if err := e.validate(sel.selections, cond, depth, fragments); err != nil {
+				return err
+			}
+		case sel.name == "__typename":
+			if len(sel.args) != 0 || len(sel.selections) != 0 {
+				return selectionError(sel, "field \"__typename\" does not accept arguments or selections")
+			}
+		default:
+			field, ok := obj.Fields[sel.name]
+			if !ok {
+				return selectionError(sel, "unknown field %q on type %q", sel.name, obj.Name)
+			}
+			for _, arg := range sel.args {
+				var known bool
+				for _, name := range field.Args {
+					known = known || name == arg.name
+				}
+				if !known {
+					return selectionError(sel, "unknown argument %q on field %q", arg.name, sel.name)
+				}
+			}
+			if field.Type == nil && len(sel.selections) != 0 {
+				return selectionError(sel, "field %q is a scalar and cannot have selections", sel.name)
+			} else if field.Type != nil && len(sel.selections) == 0 {
+				return selectionError(sel, "field %q of type %q must have selections", sel.name, field.Type.Name)
+			} else if field.Type != nil {
+				if err := e.validate(sel.selections, field.Type, depth+1, fragments); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resolveValue replaces the variables in an argument value with their
+// values. The second return value is false if the value is a variable that
+// was not provided.
+func (e *executor) resolveValue(v value) (any, bool) {
+	switch v := v.(type) {
+	case variable:
+		val, ok := e.variables[string(v)]
+		return val, ok
+	case []value:
+		list := make([]any, 0, len(v))
+		for _, elem := range v {
+			val, _ := e.resolveValue(elem)
+			list = append(list, val)
+		}
+		return list, true
+	case map[string]value:
+		obj := make(map[string]any, len(v))
+		for name, field := range v {
+			if val, ok := e.resolveValue(field); ok {
+				obj[name] = val
+			}
+		}
+		return obj, true
+	default:
+		return v, true
+	}
+}
+
+func (e *executor) resolveArgs(args []argument) Args {
+	resolved := make(Args, len(args))
+	for _, arg := range args {
+		if v, ok := e.resolveValue(arg.value); ok {
+			resolved[arg.name] = v
+		}
+	}
+	return resolved
+}
+
+// included evaluates the @skip and @include directives of a selection.
+func (e *executor) included(sel selection) (bool, error) {
+	for _, d := range sel.directives {
+		v, _ := e.resolveValue(d.args[0].value)
+		b, ok := v.(bool)
+		if !ok {
+			return false, selectionError(sel, "argument \"if\" of directive @%s must be a boolean", d.name)
+		} else if (d.name == "skip" && b) || (d.name == "include" && !b) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// A collectedField is a response key and the fields that are merged into it.
+type collectedField struct {
+	key    string
+	fields []selection
+}
+
+// collectFields flattens the fragments of a selection set that apply to the
+// object type and groups fields by their response key, in order.
+func (e *executor) collectFields(selections []selection, obj *Object, collected []collectedField) ([]collectedField, error) {
+	for _, sel := range selections {
+		if ok, err := e.included(sel); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		var err error
+		switch {
+		case sel.fragment != "":
+			f := e.doc.fragments[sel.fragment]
+			if f.typeCondition == obj.Name {
+				collected, err = e.collectFields(f.selections, obj, collected)
+			}
+		case sel.inline:
+			if sel.typeCondition == "" || sel.typeCondition == obj.Name {
+				collected, err = e.collectFields(sel.selections, obj, collected)
+			}
+		default:
+			key := sel.name
+			if sel.alias != "" {
+				key = sel.alias
+			}
+			i := 0
+			for i < len(collected) && collected[i].key != key {
+				i++
+			}
+			if i == len(collected) {
+				collected = append(collected, collectedField{key: key})
+			} else if collected[i].fields[0].name != sel.name {
+				return nil, selectionError(sel, "fields %q and %q conflict because they have the same response key %q", collected[i].fields[0].name, sel.name, key)
+			}
+			collected[i].fields = append(collected[i].fields, sel)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return collected, nil
+}
+
+// executeObject executes the selections on an object.
+func (e *executor) executeObject(ctx context.Context, selections []selection, obj *Object, source any, path []any) (*orderedObject, error) {
+	collected, err := e.collectFields(selections, obj, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &orderedObject{}
+	for _, cf := range collected {
+		sel := cf.fields[0]
+		fieldPath := append(append([]any(nil), path...), cf.key)
+
+		var v any
+		if sel.name == "__typename" {
+			v = obj.Name
+		} else {
+			v, err = e.executeField(ctx, cf, obj.Fields[sel.name], source, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.keys = append(result.keys, cf.key)
+		result.values = append(result.values, v)
+	}
+	return result, nil
+}
+
+// executeField resolves a field and executes the selections on its value.
+// Resolver errors are recorded and the field's value is set to null. The
+// returned error is only non-nil if execution cannot continue.
+func (e *executor) executeField(ctx context.Context, cf collectedField, field *Field, source any, path []any) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sel := cf.fields[0]
+	v, err := field.Resolve(ctx, source, e.resolveArgs(sel.args))
+	if err != nil {
+		e.errors = append(e.errors, Error{
+			Message:   err.Error(),
+			Locations: []Location{{sel.line, sel.col}},
+			Path:      path,
+		})
+		return nil, nil
+	} else if field.Type == nil || v == nil {
+		return v, nil
+	}
+
+	// merge the selections of every field with the same response key
+	var selections []selection
+	for _, f := range cf.fields {
+		selections = append(selections, f.selections...)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map:
+		if rv.IsNil() {
+			return nil, nil
+		}
+	case reflect.Slice:
+		if rv.IsNil() {
+			return []any{}, nil
+		}
+		list := make([]any, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elem, err := e.executeObject(ctx, selections, field.Type, rv.Index(i).Interface(), append(append([]any(nil), path...), i))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, nil
+	}
+	return e.executeObject(ctx, selections, field.Type, v, path)
+}
+
+// operation returns the operation to execute.
+func (doc document) operation(name string) (operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return operation{}, errors.New("operationName is required for documents with multiple operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return operation{}, fmt.Errorf("unknown operation %q", name)
+}
+
+// variableValues decodes the variables of a request, applying the defaults
+// of the operation's variable definitions.
+func variableValues(op operation, raw map[string]json.RawMessage) (map[string]any, error) {
+	values := make(map[string]any)
+	for _, vd := range op.variables {
+		buf, ok := raw[vd.name]
+		if !ok {
+			if vd.defaultValue != nil {
+				values[vd.name] = vd.defaultValue
+			} else if vd.nonNull {
+				return nil, fmt.Errorf("variable $%s is required", vd.name)
+			}
+			continue
+		}
+		var v any
+		if err := json.Unmarshal(buf, &v); err != nil {
+			return nil, fmt.Errorf("failed to decode variable $%s: %w", vd.name, err)
+		} else if v == nil && vd.nonNull {
+			return nil, fmt.Errorf("variable $%s must not be null", vd.name)
+		}
+		values[vd.name] = v
+	}
+
+	// reject variables the operation does not define
+	var unknown []string
+	for name := range raw {
+		var defined bool
+		for _, vd := range op.variables {
+			defined = defined || vd.name == name
+		}
+		if !defined {
+			unknown = append(unknown, "$"+name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown variables %s", strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// checkVariables returns an error if the selections use a variable that the
+// operation does not define.
+func checkVariables(doc document, op operation) error {
+	defined := make(map[string]bool)
+	for _, vd := range op.variables {
+		defined[vd.name] = true
+	}
+	var checkValue func(v value) error
+	checkValue = func(v value) error {
+		switch v := v.(type) {
+		case variable:
+			if !defined[string(v)] {
+				return fmt.Errorf("variable $%s is not defined", v)
+			}
+		case []value:
+			for _, elem := range v {
+				if err := checkValue(elem); err != nil {
+					return err
+				}
+			}
+		case map[string]value:
+			for _, field := range v {
+				if err := checkValue(field); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	checkArgs := func(args []argument) error {
+		for _, arg := range args {
+			if err := checkValue(arg.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var check func([]selection) error
+	check = func(selections []selection) error {
+		for _, sel := range selections {
+			if err := checkArgs(sel.args); err != nil {
+				return err
+			}
+			for _, d := range sel.directives {
+				if err := checkArgs(d.args); err != nil {
+					return err
+				}
+			}
+			if sel.fragment != "" && !seen[sel.fragment] {
+				seen[sel.fragment] = true
+				if err := check(doc.fragments[sel.fragment].selections); err != nil {
+					return err
+				}
+			}
+			if err := check(sel.selections); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(op.selections)
+}
+
+// requestError returns a response for a request that could not be executed.
+func requestError(err error) Response {
+	var gerr Error
+	if !errors.As(err, &gerr) {
+		gerr = Error{Message: err.Error()}
+	}
+	return Response{Errors: []Error{gerr}}
+}
+
+// Execute parses, validates, and executes a query. Errors in the request
+// itself are returned with a nil Data, while errors resolving individual
+// fields are returned alongside the rest of the data.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return requestError(err)
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return requestError(err)
+	} else if op.kind != "query" {
+		return requestError(fmt.Errorf("%s operations are not supported", op.kind))
+	}
+
+	e := &executor{schema: s, types: s.types(), doc: doc}
+	if err := e.validate(op.selections, s.Query, 1, nil); err != nil {
+		return requestError(err)
+	} else if err := checkVariables(doc, op); err != nil {
+		return requestError(err)
+	} else if e.variables, err = variableValues(op, req.Variables); err != nil {
+		return requestError(err)
+	}
+
+	data, err := e.executeObject(ctx, op.selections, s.Query, nil, nil)
+	if err != nil {
+		return requestError(err)
+	}
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return requestError(err)
+	}
+	return Response{Data: buf, Errors: e.errors}
+}
@@ -0,0 +1,158 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testAuthor struct {
+	Name  string
+	Books []*testBook
+}
+
+type testBook struct {
+	Title  string
+	Pages  int
+	Author *testAuthor
+}
+
+func testSchema() *Schema {
+	author := &Object{Name: "Author", Fields: map[string]*Field{
+		"name": {Resolve: func(_ context.Context, source any, _ Args) (any, error) {
+			return source.(*testAuthor).Name, nil
+		}},
+	}}
+	book := &Object{Name: "Book", Fields: map[string]*Field{
+		"title": {Resolve: func(_ context.Context, source any, _ Args) (any, error) {
+			return source.(*testBook).Title, nil
+		}},
+		"pages": {Resolve: func(_ context.Context, source any, _ Args) (any, error) {
+			return source.(*testBook).Pages, nil
+		}},
+		"author": {Type: author, Resolve: func(_ context.Context, source any, _ Args) (any, error) {
+			return source.(*testBook).Author, nil
+		}},
+		"fail": {Resolve: func(context.Context, any, Args) (any, error) {
+			return nil, errors.New("failed")
+		}},
+	}}
+	author.Fields["books"] = &Field{Type: book, Args: []string{"limit"}, Resolve: func(_ context.Context, source any, args Args) (any, error) {
+		limit, err := args.Int("limit", 100)
+		if err != nil {
+			return nil, err
+		}
+		books := source.(*testAuthor).Books
+		if limit < len(books) {
+			books = books[:limit]
+		}
+		return books, nil
+	}}
+
+	a := &testAuthor{Name: "Ada"}
+	a.Books = []*testBook{{Title: "Notes", Pages: 40, Author: a}, {Title: "Letters", Pages: 12, Author: a}}
+	query := &Object{Name: "Query", Fields: map[string]*Field{
+		"author": {Type: author, Args: []string{"name"}, Resolve: func(_ context.Context, _ any, args Args) (any, error) {
+			name, err := args.String("name", "")
+			if err != nil {
+				return nil, err
+			} else if name != a.Name {
+				return (*testAuthor)(nil), nil
+			}
+			return a, nil
+		}},
+	}}
+	return &Schema{Query: query, MaxDepth: 4}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables string
+		data      string
+		err       string
+	}{
+		{
+			name:  "nested",
+			query: `{ author(name: "Ada") { name books { title author { name } } } }`,
+			data:  `{"author":{"name":"Ada","books":[{"title":"Notes","author":{"name":"Ada"}},{"title":"Letters","author":{"name":"Ada"}}]}}`,
+		},
+		{
+			name:  "aliases and order",
+			query: `query { a: author(name: "Ada") { n: name } b: author(name: "Bob") { name } }`,
+			data:  `{"a":{"n":"Ada"},"b":null}`,
+		},
+		{
+			name:      "variables",
+			query:     `query Q($name: String!, $limit: Int = 5) { author(name: $name) { books(limit: $limit) { title } } }`,
+			variables: `{"name":"Ada","limit":1}`,
+			data:      `{"author":{"books":[{"title":"Notes"}]}}`,
+		},
+		{
+			name:  "fragments",
+			query: `{ author(name: "Ada") { ...A books(limit: 1) { ... on Book { pages } ... { title } } } } fragment A on Author { __typename name }`,
+			data:  `{"author":{"__typename":"Author","name":"Ada","books":[{"pages":40,"title":"Notes"}]}}`,
+		},
+		{
+			name:      "directives",
+			query:     `query ($yes: Boolean!) { author(name: "Ada") { name @skip(if: $yes) books(limit: 1) @include(if: $yes) { title } } }`,
+			variables: `{"yes":true}`,
+			data:      `{"author":{"books":[{"title":"Notes"}]}}`,
+		},
+		{
+			name:  "merged selections",
+			query: `{ author(name: "Ada") { books(limit: 1) { title } books(limit: 1) { pages } } }`,
+			data:  `{"author":{"books":[{"title":"Notes","pages":40}]}}`,
+		},
+		{
+			name:  "field error",
+			query: `{ author(name: "Ada") { name books(limit: 1) { fail } } }`,
+			data:  `{"author":{"name":"Ada","books":[{"fail":null}]}}`,
+			err:   "failed",
+		},
+		{name: "syntax error", query: `{ author(name: "Ada" { name } }`, err: "syntax error"},
+		{name: "unknown field", query: `{ author(name: "Ada") { age } }`, err: `unknown field "age" on type "Author"`},
+		{name: "unknown argument", query: `{ author(id: 1) { name } }`, err: `unknown argument "id"`},
+		{name: "missing selection", query: `{ author(name: "Ada") }`, err: "must have selections"},
+		{name: "scalar selection", query: `{ author(name: "Ada") { name { x } } }`, err: "is a scalar"},
+		{name: "too deep", query: `{ author { books { author { books { title } } } } }`, err: "maximum depth"},
+		{name: "fragment cycle", query: `{ author { ...A } } fragment A on Author { books { author { ...A } } }`, err: "spreads itself"},
+		{name: "undefined variable", query: `{ author(name: $name) { name } }`, err: "variable $name is not defined"},
+		{name: "missing variable", query: `query ($name: String!) { author(name: $name) { name } }`, err: "variable $name is required"},
+		{name: "mutation", query: `mutation { author { name } }`, err: "mutation operations are not supported"},
+	}
+	s := testSchema()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := Request{Query: test.query}
+			if test.variables != "" {
+				if err := json.Unmarshal([]byte(test.variables), &req.Variables); err != nil {
+					t.Fatal(err)
+				}
+			}
+			resp := s.Execute(context.Background(), req)
+			if string(resp.Data) != test.data {
+				t.Errorf("expected data %s, got %s", test.data, resp.Data)
+			}
+			if test.err == "" && len(resp.Errors) != 0 {
+				t.Errorf("unexpected errors %v", resp.Errors)
+			} else if test.err != "" && (len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, test.err)) {
+				t.Errorf("expected error %q, got %v", test.err, resp.Errors)
+			}
+		})
+	}
+}
+
+func TestFieldErrorPath(t *testing.T) {
+	resp := testSchema().Execute(context.Background(), Request{Query: `{ author(name: "Ada") { b: books { fail } } }`})
+	if len(resp.Errors) != 2 {
+		t.Fatalf("expected 2 errors, got %v", resp.Errors)
+	}
+	path, _ := json.Marshal(resp.Errors[1].Path)
+	if string(path) != `["author","b",1,"fail"]` {
+		t.Fatalf("unexpected path %s", path)
+	}
+}
@@ -0,0 +1,649 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// A value is an unresolved argument value. Variables are resolved when
+	// the query is executed.
+	value = any
+
+	// variable is a reference to an operation variable.
+	variable string
+
+	argument struct {
+		name  string
+		value value
+	}
+
+	directive struct {
+		name string
+		args []argument
+	}
+
+	// A selection is a field, fragment spread, or inline fragment.
+	selection struct {
+		// field
+		alias string
+		name  string
+		args  []argument
+
+		// fragment spread
+		fragment string
+
+		// inline fragment
+		inline        bool
+		typeCondition string
+
+		directives []directive
+		selections []selection
+
+		line, col int
+	}
+
+	variableDefinition struct {
+		name         string
+		nonNull      bool
+		defaultValue value
+	}
+
+	operation struct {
+		kind       string
+		name       string
+		variables  []variableDefinition
+		directives []directive
+		selections []selection
+	}
+
+	fragment struct {
+		name          string
+		typeCondition string
+		selections    []selection
+	}
+
+	document struct {
+		operations []operation
+		fragments  map[string]fragment
+	}
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind      tokenKind
+	value     string
+	line, col int
+}
+
+type lexer struct {
+	src       string
+	pos       int
+	line, col int
+}
+
+func (l *lexer) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at %d:%d: %s", l.line, l.col, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) advance(n int) {
+	for _, r := range l.src[l.pos : l.pos+n] {
+		if r == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col++
+		}
+	}
+	l.pos += n
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// next returns the next token. Whitespace, commas, and comments are ignored.
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.advance(1)
+		case strings.HasPrefix(l.src[l.pos:], "\uFEFF"):
+			// byte order mark
+			l.advance(len("\uFEFF"))
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.advance(1)
+			}
+		default:
+			return l.token()
+		}
+	}
+	return token{kind: tokenEOF, line: l.line, col: l.col}, nil
+}
+
+func (l *lexer) token() (token, error) {
+	start, line, col := l.pos, l.line, l.col
+	tok := func(kind tokenKind, value string) (token, error) {
+		return token{kind: kind, value: value, line: line, col: col}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.advance(3)
+		return tok(tokenPunct, "...")
+	case strings.IndexByte("!$&():=@[]{}|", c) != -1:
+		l.advance(1)
+		return tok(tokenPunct, string(c))
+	case isNameStart(c):
+		for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.advance(1)
+		}
+		return tok(tokenName, l.src[start:l.pos])
+	case c == '-' || isDigit(c):
+		return l.number()
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		return l.blockString()
+	case c == '"':
+		return l.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+		return token{}, l.errorf("unexpected character %q", r)
+	}
+}
+
+func (l *lexer) number() (token, error) {
+	start, line, col := l.pos, l.line, l.col
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.advance(1)
+			n++
+		}
+		return n
+	}
+
+	kind := tokenInt
+	if l.src[l.pos] == '-' {
+		l.advance(1)
+	}
+	if digits() == 0 {
+		return token{}, l.errorf("invalid number")
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokenFloat
+		l.advance(1)
+		if digits() == 0 {
+			return token{}, l.errorf("invalid number")
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokenFloat
+		l.advance(1)
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.advance(1)
+		}
+		if digits() == 0 {
+			return token{}, l.errorf("invalid number")
+		}
+	}
+	if l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || l.src[l.pos] == '.') {
+		return token{}, l.errorf("invalid number")
+	}
+	return token{kind: kind, value: l.src[start:l.pos], line: line, col: col}, nil
+}
+
+func (l *lexer) string() (token, error) {
+	line, col := l.line, l.col
+	l.advance(1)
+	var sb strings.Builder
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' || l.src[l.pos] == '\r' {
+			return token{}, l.errorf("unterminated string")
+		}
+		switch c := l.src[l.pos]; c {
+		case '"':
+			l.advance(1)
+			return token{kind: tokenString, value: sb.String(), line: line, col: col}, nil
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, l.errorf("unterminated string")
+			}
+			switch e := l.src[l.pos+1]; e {
+			case '"', '\\', '/':
+				sb.WriteByte(e)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if l.pos+6 > len(l.src) {
+					return token{}, l.errorf("invalid unicode escape")
+				}
+				n, err := strconv.ParseUint(l.src[l.pos+2:l.pos+6], 16, 16)
+				if err != nil {
+					return token{}, l.errorf("invalid unicode escape")
+				}
+				sb.WriteRune(rune(n))
+				l.advance(4)
+			default:
+				return token{}, l.errorf("invalid escape sequence \\%c", e)
+			}
+			l.advance(2)
+		default:
+			sb.WriteByte(c)
+			l.advance(1)
+		}
+	}
+}
+
+// blockString lexes a block string. Unlike the specification, the common
+// indentation of its lines is not removed.
+func (l *lexer) blockString() (token, error) {
+	line, col := l.line, l.col
+	l.advance(3)
+	var sb strings.Builder
+	for {
+		switch {
+		case l.pos >= len(l.src):
+			return token{}, l.errorf("unterminated string")
+		case strings.HasPrefix(l.src[l.pos:], `\"""`):
+			sb.WriteString(`"""`)
+			l.advance(4)
+		case strings.HasPrefix(l.src[l.pos:], `"""`):
+			l.advance(3)
+			return token{kind: tokenString, value: strings.TrimSpace(sb.String()), line: line, col: col}, nil
+		default:
+			sb.WriteByte(l.src[l.pos])
+			l.advance(1)
+		}
+	}
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at %d:%d: %s", p.tok.line, p.tok.col, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) advance() (err error) {
+	p.tok, err = p.lex.next()
+	return
+}
+
+func (p *parser) peek(value string) bool {
+	return (p.tok.kind == tokenPunct || p.tok.kind == tokenName) && p.tok.value == value
+}
+
+// skip consumes the token if it is the given punctuator or keyword.
+func (p *parser) skip(value string) (bool, error) {
+	if !p.peek(value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(value string) error {
+	if !p.peek(value) {
+		return p.errorf("expected %q, got %q", value, p.tok.value)
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.errorf("expected name, got %q", p.tok.value)
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) document() (document, error) {
+	doc := document{fragments: make(map[string]fragment)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.peek("{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return document{}, err
+			}
+			doc.operations = append(doc.operations, operation{kind: "query", selections: selections})
+		case p.peek("query"), p.peek("mutation"), p.peek("subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return document{}, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek("fragment"):
+			f, err := p.fragment()
+			if err != nil {
+				return document{}, err
+			} else if _, ok := doc.fragments[f.name]; ok {
+				return document{}, fmt.Errorf("fragment %q is defined more than once", f.name)
+			}
+			doc.fragments[f.name] = f
+		default:
+			return document{}, p.errorf("unexpected %q", p.tok.value)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return document{}, fmt.Errorf("document does not contain an operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) operation() (op operation, err error) {
+	op.kind = p.tok.value
+	if err := p.advance(); err != nil {
+		return operation{}, err
+	}
+	if p.tok.kind == tokenName {
+		if op.name, err = p.name(); err != nil {
+			return operation{}, err
+		}
+	}
+	if ok, err := p.skip("("); err != nil {
+		return operation{}, err
+	} else if ok {
+		for !p.peek(")") {
+			vd, err := p.variableDefinition()
+			if err != nil {
+				return operation{}, err
+			}
+			op.variables = append(op.variables, vd)
+		}
+		if err := p.advance(); err != nil {
+			return operation{}, err
+		}
+	}
+	if op.directives, err = p.directives(); err != nil {
+		return operation{}, err
+	}
+	op.selections, err = p.selectionSet()
+	return
+}
+
+func (p *parser) variableDefinition() (vd variableDefinition, err error) {
+	if err := p.expect("$"); err != nil {
+		return variableDefinition{}, err
+	} else if vd.name, err = p.name(); err != nil {
+		return variableDefinition{}, err
+	} else if err := p.expect(":"); err != nil {
+		return variableDefinition{}, err
+	} else if vd.nonNull, err = p.typeRef(); err != nil {
+		return variableDefinition{}, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return variableDefinition{}, err
+	} else if ok {
+		if vd.defaultValue, err = p.value(true); err != nil {
+			return variableDefinition{}, err
+		}
+	}
+	// directives on variable definitions are accepted and ignored
+	_, err = p.directives()
+	return
+}
+
+// typeRef parses a type reference and returns whether it is non-null. Types
+// are not checked, so the named type is discarded.
+func (p *parser) typeRef() (nonNull bool, err error) {
+	if ok, err := p.skip("["); err != nil {
+		return false, err
+	} else if ok {
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		} else if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	return p.skip("!")
+}
+
+func (p *parser) fragment() (f fragment, err error) {
+	if err := p.advance(); err != nil {
+		return fragment{}, err
+	} else if f.name, err = p.name(); err != nil {
+		return fragment{}, err
+	} else if f.name == "on" {
+		return fragment{}, p.errorf("fragment cannot be named \"on\"")
+	} else if err := p.expect("on"); err != nil {
+		return fragment{}, err
+	} else if f.typeCondition, err = p.name(); err != nil {
+		return fragment{}, err
+	} else if _, err := p.directives(); err != nil {
+		return fragment{}, err
+	}
+	f.selections, err = p.selectionSet()
+	return
+}
+
+func (p *parser) selectionSet() (selections []selection, err error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.peek("}") {
+		if p.tok.kind == tokenEOF {
+			return nil, p.errorf("unexpected end of document")
+		}
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, sel)
+	}
+	if len(selections) == 0 {
+		return nil, p.errorf("selection set must not be empty")
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (sel selection, err error) {
+	sel.line, sel.col = p.tok.line, p.tok.col
+	if ok, err := p.skip("..."); err != nil {
+		return selection{}, err
+	} else if ok {
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			if sel.fragment, err = p.name(); err != nil {
+				return selection{}, err
+			}
+			sel.directives, err = p.directives()
+			return sel, err
+		}
+		sel.inline = true
+		if ok, err := p.skip("on"); err != nil {
+			return selection{}, err
+		} else if ok {
+			if sel.typeCondition, err = p.name(); err != nil {
+				return selection{}, err
+			}
+		}
+		if sel.directives, err = p.directives(); err != nil {
+			return selection{}, err
+		}
+		sel.selections, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.name, err = p.name(); err != nil {
+		return selection{}, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return selection{}, err
+	} else if ok {
+		sel.alias = sel.name
+		if sel.name, err = p.name(); err != nil {
+			return selection{}, err
+		}
+	}
+	if sel.args, err = p.arguments(false); err != nil {
+		return selection{}, err
+	} else if sel.directives, err = p.directives(); err != nil {
+		return selection{}, err
+	}
+	if p.peek("{") {
+		sel.selections, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+func (p *parser) arguments(isConst bool) (args []argument, err error) {
+	if ok, err := p.skip("("); err != nil || !ok {
+		return nil, err
+	}
+	for !p.peek(")") {
+		var arg argument
+		if arg.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		for _, a := range args {
+			if a.name == arg.name {
+				return nil, p.errorf("argument %q is given more than once", arg.name)
+			}
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		} else if arg.value, err = p.value(isConst); err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return nil, p.errorf("argument list must not be empty")
+	}
+	return args, p.advance()
+}
+
+func (p *parser) directives() (dirs []directive, err error) {
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		var d directive
+		if d.name, err = p.name(); err != nil {
+			return nil, err
+		} else if d.args, err = p.arguments(false); err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// value parses an input value. Variables are not allowed in constant values,
+// such as the defaults of variable definitions.
+func (p *parser) value(isConst bool) (value, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokenPunct && tok.value == "$":
+		if isConst {
+			return nil, p.errorf("variables are not allowed here")
+		} else if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return variable(name), err
+	case tok.kind == tokenPunct && tok.value == "[":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []value{}
+		for !p.peek("]") {
+			if p.tok.kind == tokenEOF {
+				return nil, p.errorf("unexpected end of document")
+			}
+			v, err := p.value(isConst)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case tok.kind == tokenPunct && tok.value == "{":
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := make(map[string]value)
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			} else if _, ok := obj[name]; ok {
+				return nil, p.errorf("field %q is given more than once", name)
+			} else if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(isConst); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	case tok.kind == tokenInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("integer %s is out of range", tok.value)
+		}
+		return n, p.advance()
+	case tok.kind == tokenFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %s", tok.value)
+		}
+		return f, p.advance()
+	case tok.kind == tokenString:
+		return tok.value, p.advance()
+	case tok.kind == tokenName:
+		var v value
+		switch tok.value {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			// enum values are passed to resolvers as strings
+			v = tok.value
+		}
+		return v, p.advance()
+	default:
+		return nil, p.errorf("unexpected %q", tok.value)
+	}
+}
+
+// parse parses a GraphQL document.
+func parse(src string) (document, error) {
+	p := &parser{lex: &lexer{src: src, line: 1, col: 1}}
+	if err := p.advance(); err != nil {
+		return document{}, err
+	}
+	return p.document()
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package health
+
+import "errors"
+
+func platformDiskUsage(string) (free, total uint64, err error) {
+	return 0, 0, errors.New("disk usage is not supported on this platform")
+}
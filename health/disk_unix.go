@@ -0,0 +1,13 @@
+//go:build linux || darwin || freebsd
+
+package health
+
+import "syscall"
+
+func platformDiskUsage(dir string) (free, total uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize), nil
+}
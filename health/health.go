@@ -0,0 +1,349 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/internal/ntp"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+const (
+	// startupGrace is the time after startup during which scan lag and
+	// peer count are not checked, since both are expected to be poor while
+	// walletd is connecting to peers.
+	startupGrace = 5 * time.Minute
+
+	// diskWarningFraction is the fraction of free disk space below which a
+	// warning is raised.
+	diskWarningFraction = 0.1
+	// diskCriticalBytes is the free disk space below which a critical
+	// alert is raised.
+	diskCriticalBytes = 1 << 30 // 1 GiB
+
+	// clockInterval is how often the clock is checked against the NTP
+	// servers.
+	clockInterval = 15 * time.Minute
+	// clockQueryTimeout is the time allowed to query the NTP servers.
+	clockQueryTimeout = 10 * time.Second
+)
+
+var (
+	alertIndexID = types.HashBytes([]byte("health/index"))
+	alertDBID    = types.HashBytes([]byte("health/database"))
+	alertPeersID = types.HashBytes([]byte("health/peers"))
+	alertDiskID  = types.HashBytes([]byte("health/disk"))
+	alertClockID = types.HashBytes([]byte("health/clock"))
+)
+
+type (
+	// A ChainManager returns the current tip of the chain.
+	ChainManager interface {
+		Tip() types.ChainIndex
+	}
+
+	// An IndexStore returns the last index processed by the wallet indexer.
+	IndexStore interface {
+		LastCommittedIndex() (types.ChainIndex, error)
+	}
+
+	// A WebhookManager returns the webhooks that are failing to receive
+	// events.
+	WebhookManager interface {
+		FailingWebhooks() map[int64]error
+	}
+
+	// An Alerter registers and dismisses alerts.
+	Alerter interface {
+		Register(alerts.Alert)
+		Dismiss(...types.Hash256)
+	}
+
+	// A ClockStatus is the result of the last clock check.
+	ClockStatus struct {
+		// Offset is the amount the local clock must be adjusted by to
+		// match the NTP server. A positive offset means the local clock is
+		// behind.
+		Offset  time.Duration `json:"offset"`
+		Server  string        `json:"server,omitempty"`
+		MaxSkew time.Duration `json:"maxSkew"`
+		// Skewed is true if the offset exceeds MaxSkew.
+		Skewed      bool      `json:"skewed"`
+		LastChecked time.Time `json:"lastChecked"`
+		// Error is set if the NTP servers could not be queried during the
+		// last check. The offset is then that of the last successful check.
+		Error string `json:"error,omitempty"`
+	}
+
+	// A Monitor periodically checks the health of walletd and registers an
+	// alert for each problem it finds. Alerts are dismissed once the
+	// problem is resolved.
+	Monitor struct {
+		alerts   Alerter
+		log      *zap.Logger
+		tg       *threadgroup.ThreadGroup
+		sched    *jobs.Scheduler
+		interval time.Duration
+		started  time.Time
+
+		cm      ChainManager
+		store   IndexStore
+		maxLag  uint64
+		peers   func() int
+		minPeer int
+		whm     WebhookManager
+		dir     string
+
+		ntpServers []string
+		maxSkew    time.Duration
+
+		mu    sync.Mutex // protects clock
+		clock ClockStatus
+
+		webhookAlerts map[int64]types.Hash256
+	}
+)
+
+// diskUsage returns the free and total bytes of the disk containing dir.
+// It is implemented per platform.
+var diskUsage = platformDiskUsage
+
+// queryNTP returns the offset of the local clock.
+var queryNTP = ntp.QueryAny
+
+// DiskUsage returns the free and total bytes of the disk containing dir.
+func DiskUsage(dir string) (free, total uint64, err error) {
+	return platformDiskUsage(dir)
+}
+
+// LowDisk reports whether free bytes of total are low enough to warn about,
+// and whether they are critically low.
+func LowDisk(free, total uint64) (low, critical bool) {
+	critical = free < diskCriticalBytes
+	low = critical || (total > 0 && float64(free)/float64(total) < diskWarningFraction)
+	return
+}
+
+// setAlert registers the alert if active is true and dismisses it otherwise.
+func (m *Monitor) setAlert(active bool, a alerts.Alert) {
+	if active {
+		m.alerts.Register(a)
+	} else {
+		m.alerts.Dismiss(a.ID)
+	}
+}
+
+func (m *Monitor) checkIndex(now time.Time) {
+	index, err := m.store.LastCommittedIndex()
+	m.setAlert(err != nil, alerts.Alert{
+		ID:       alertDBID,
+		Severity: alerts.SeverityError,
+		Message:  fmt.Sprintf("database error: %v", err),
+		Data: map[string]any{
+			"error": fmt.Sprint(err),
+		},
+		Timestamp: now,
+	})
+	if err != nil || m.maxLag == 0 || now.Sub(m.started) < startupGrace {
+		return
+	}
+
+	tip := m.cm.Tip()
+	var lag uint64
+	if tip.Height > index.Height {
+		lag = tip.Height - index.Height
+	}
+	m.setAlert(lag > m.maxLag, alerts.Alert{
+		ID:       alertIndexID,
+		Severity: alerts.SeverityWarning,
+		Message:  fmt.Sprintf("wallet index is %d blocks behind the chain", lag),
+		Data: map[string]any{
+			"tip":     tip,
+			"indexed": index,
+		},
+		Timestamp: now,
+	})
+}
+
+func (m *Monitor) checkPeers(now time.Time) {
+	if now.Sub(m.started) < startupGrace {
+		return
+	}
+	peers := m.peers()
+	m.setAlert(peers < m.minPeer, alerts.Alert{
+		ID:       alertPeersID,
+		Severity: alerts.SeverityWarning,
+		Message:  fmt.Sprintf("only connected to %d peers", peers),
+		Data: map[string]any{
+			"peers":    peers,
+			"minPeers": m.minPeer,
+		},
+		Timestamp: now,
+	})
+}
+
+func (m *Monitor) checkWebhooks(now time.Time) {
+	failing := m.whm.FailingWebhooks()
+	for id, err := range failing {
+		alertID := types.HashBytes([]byte(fmt.Sprintf("health/webhook/%d", id)))
+		m.webhookAlerts[id] = alertID
+		m.alerts.Register(alerts.Alert{
+			ID:       alertID,
+			Severity: alerts.SeverityWarning,
+			Message:  fmt.Sprintf("failed to deliver events to webhook %d", id),
+			Data: map[string]any{
+				"webhookID": id,
+				"error":     err.Error(),
+			},
+			Timestamp: now,
+		})
+	}
+	for id, alertID := range m.webhookAlerts {
+		if _, ok := failing[id]; !ok {
+			m.alerts.Dismiss(alertID)
+			delete(m.webhookAlerts, id)
+		}
+	}
+}
+
+func (m *Monitor) checkDisk(now time.Time) {
+	free, total, err := diskUsage(m.dir)
+	if err != nil {
+		m.log.Debug("failed to get disk usage", zap.Error(err))
+		return
+	}
+
+	low, critical := LowDisk(free, total)
+	severity := alerts.SeverityWarning
+	if critical {
+		severity = alerts.SeverityCritical
+	}
+	m.setAlert(low, alerts.Alert{
+		ID:       alertDiskID,
+		Severity: severity,
+		Message:  fmt.Sprintf("disk is nearly full: %d MiB free", free>>20),
+		Data: map[string]any{
+			"dir":   m.dir,
+			"free":  free,
+			"total": total,
+		},
+		Timestamp: now,
+	})
+}
+
+func (m *Monitor) checkClock(now time.Time) {
+	m.mu.Lock()
+	last := m.clock.LastChecked
+	m.mu.Unlock()
+	if now.Sub(last) < clockInterval {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clockQueryTimeout)
+	defer cancel()
+	resp, err := queryNTP(ctx, m.ntpServers)
+
+	m.mu.Lock()
+	m.clock.LastChecked = now
+	m.clock.MaxSkew = m.maxSkew
+	if err != nil {
+		m.clock.Error = err.Error()
+		m.mu.Unlock()
+		m.log.Warn("failed to check clock", zap.Error(err))
+		return
+	}
+	m.clock.Error = ""
+	m.clock.Offset = resp.Offset
+	m.clock.Server = resp.Server
+	m.clock.Skewed = resp.Offset.Abs() > m.maxSkew
+	status := m.clock
+	m.mu.Unlock()
+
+	m.setAlert(status.Skewed, alerts.Alert{
+		ID:       alertClockID,
+		Severity: alerts.SeverityWarning,
+		Message:  fmt.Sprintf("local clock is off by %v", status.Offset.Round(time.Millisecond)),
+		Data: map[string]any{
+			"offset":  status.Offset,
+			"server":  status.Server,
+			"maxSkew": status.MaxSkew,
+		},
+		Timestamp: now,
+	})
+}
+
+// Clock returns the result of the last clock check. The zero value is
+// returned if the clock check is disabled or has not run yet.
+func (m *Monitor) Clock() ClockStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clock
+}
+
+// check runs every enabled check.
+func (m *Monitor) check(now time.Time) {
+	if m.store != nil {
+		m.checkIndex(now)
+	}
+	if m.peers != nil {
+		m.checkPeers(now)
+	}
+	if m.whm != nil {
+		m.checkWebhooks(now)
+	}
+	if m.dir != "" {
+		m.checkDisk(now)
+	}
+	if m.maxSkew > 0 {
+		m.checkClock(now)
+	}
+}
+
+// Close stops the monitor.
+func (m *Monitor) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// NewMonitor creates a new health monitor and starts checking in the
+// background.
+func NewMonitor(alerter Alerter, opts ...Option) (*Monitor, error) {
+	m := &Monitor{
+		alerts:   alerter,
+		log:      zap.NewNop(),
+		tg:       threadgroup.New(),
+		interval: time.Minute,
+		started:  time.Now(),
+
+		webhookAlerts: make(map[int64]types.Hash256),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		// check the clock immediately, since skew affects the handshakes
+		// made while connecting to peers
+		if m.maxSkew > 0 {
+			m.checkClock(time.Now())
+		}
+
+		m.sched.Run(ctx, "health", "checks the health of the node and registers alerts", m.interval, false, func(context.Context) error {
+			m.check(time.Now())
+			return nil
+		})
+	}()
+	return m, nil
+}
@@ -0,0 +1,185 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/internal/ntp"
+	"go.uber.org/zap/zaptest"
+)
+
+type mockChain struct {
+	tip types.ChainIndex
+}
+
+func (mc *mockChain) Tip() types.ChainIndex { return mc.tip }
+
+type mockStore struct {
+	index types.ChainIndex
+	err   error
+}
+
+func (ms *mockStore) LastCommittedIndex() (types.ChainIndex, error) { return ms.index, ms.err }
+
+type mockWebhooks struct {
+	failing map[int64]error
+}
+
+func (mw *mockWebhooks) FailingWebhooks() map[int64]error { return mw.failing }
+
+func activeAlerts(t *testing.T, am *alerts.Manager) map[types.Hash256]alerts.Alert {
+	t.Helper()
+	active := make(map[types.Hash256]alerts.Alert)
+	for _, a := range am.Active() {
+		active[a.ID] = a
+	}
+	return active
+}
+
+func TestMonitor(t *testing.T) {
+	cm := &mockChain{tip: types.ChainIndex{Height: 100}}
+	store := &mockStore{index: types.ChainIndex{Height: 100}}
+	whm := &mockWebhooks{failing: make(map[int64]error)}
+	peers := 5
+
+	var free, total uint64 = 50 << 30, 100 << 30
+	diskUsage = func(string) (uint64, uint64, error) { return free, total, nil }
+	defer func() { diskUsage = platformDiskUsage }()
+
+	am := alerts.NewManager()
+	m, err := NewMonitor(am,
+		WithLogger(zaptest.NewLogger(t)),
+		WithInterval(time.Hour),
+		WithIndexCheck(cm, store, 10),
+		WithPeerCheck(func() int { return peers }, 3),
+		WithWebhookCheck(whm),
+		WithDiskCheck(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	now := time.Now().Add(startupGrace + time.Minute)
+	m.check(now)
+	if active := am.Active(); len(active) != 0 {
+		t.Fatalf("expected no alerts, got %v", active)
+	}
+
+	// introduce every problem
+	cm.tip.Height = 200
+	peers = 1
+	whm.failing[1] = errors.New("connection refused")
+	free = 5 << 30
+	m.check(now)
+
+	active := activeAlerts(t, am)
+	if len(active) != 4 {
+		t.Fatalf("expected 4 alerts, got %d", len(active))
+	} else if _, ok := active[alertIndexID]; !ok {
+		t.Fatal("expected index alert")
+	} else if _, ok := active[alertPeersID]; !ok {
+		t.Fatal("expected peers alert")
+	} else if a, ok := active[alertDiskID]; !ok || a.Severity != alerts.SeverityWarning {
+		t.Fatalf("expected disk warning, got %+v", a)
+	}
+
+	// a database error
+	store.err = errors.New("database is locked")
+	free = 1 << 20
+	m.check(now)
+	active = activeAlerts(t, am)
+	if a, ok := active[alertDBID]; !ok || a.Severity != alerts.SeverityError {
+		t.Fatalf("expected database error alert, got %+v", a)
+	} else if a := active[alertDiskID]; a.Severity != alerts.SeverityCritical {
+		t.Fatalf("expected critical disk alert, got %v", a.Severity)
+	}
+
+	// resolve every problem
+	store.err = nil
+	store.index.Height = 200
+	peers = 8
+	delete(whm.failing, 1)
+	free = 50 << 30
+	m.check(now)
+	if active := am.Active(); len(active) != 0 {
+		t.Fatalf("expected alerts to be dismissed, got %v", active)
+	}
+}
+
+func TestClockCheck(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		offset time.Duration
+		ntpErr error
+	)
+	queryNTP = func(context.Context, []string) (ntp.Response, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return ntp.Response{Server: "ntp.example.com", Offset: offset}, ntpErr
+	}
+	defer func() { queryNTP = ntp.QueryAny }()
+	setClock := func(d time.Duration, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		offset, ntpErr = d, err
+	}
+
+	am := alerts.NewManager()
+	m, err := NewMonitor(am,
+		WithLogger(zaptest.NewLogger(t)),
+		WithInterval(time.Hour),
+		WithClockCheck(nil, 10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// the clock is checked on startup
+	for i := 0; m.Clock().LastChecked.IsZero(); i++ {
+		if i == 100 {
+			t.Fatal("expected clock to be checked on startup")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := m.Clock(); status.Skewed || status.Server != "ntp.example.com" {
+		t.Fatalf("unexpected clock status %+v", status)
+	}
+
+	// the clock is not checked again until the interval has passed
+	now := time.Now()
+	setClock(-time.Minute, nil)
+	m.check(now)
+	if m.Clock().Skewed {
+		t.Fatal("expected clock not to be checked again")
+	}
+
+	now = now.Add(clockInterval)
+	m.check(now)
+	if status := m.Clock(); !status.Skewed || status.Offset != -time.Minute {
+		t.Fatalf("expected skewed clock, got %+v", status)
+	} else if _, ok := activeAlerts(t, am)[alertClockID]; !ok {
+		t.Fatal("expected clock alert")
+	}
+
+	// a failed query keeps the last offset
+	now = now.Add(clockInterval)
+	setClock(0, errors.New("timeout"))
+	m.check(now)
+	if status := m.Clock(); !status.Skewed || status.Error == "" {
+		t.Fatalf("expected error with last offset, got %+v", status)
+	}
+
+	now = now.Add(clockInterval)
+	setClock(time.Second, nil)
+	m.check(now)
+	if status := m.Clock(); status.Skewed || status.Error != "" {
+		t.Fatalf("expected clock to be in sync, got %+v", status)
+	} else if active := am.Active(); len(active) != 0 {
+		t.Fatalf("expected clock alert to be dismissed, got %v", active)
+	}
+}
@@ -0,0 +1,75 @@
+package health
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Monitor.
+type Option func(*Monitor)
+
+// WithLogger sets the logger used by the monitor.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Monitor) {
+		m.log = log
+	}
+}
+
+// WithInterval sets how often checks are run. The default is one minute.
+func WithInterval(d time.Duration) Option {
+	return func(m *Monitor) {
+		m.interval = d
+	}
+}
+
+// WithIndexCheck alerts when the store returns an error or the wallet index
+// is more than maxLag blocks behind the chain. A maxLag of zero only checks
+// for database errors.
+func WithIndexCheck(cm ChainManager, store IndexStore, maxLag uint64) Option {
+	return func(m *Monitor) {
+		m.cm = cm
+		m.store = store
+		m.maxLag = maxLag
+	}
+}
+
+// WithPeerCheck alerts when fewer than minPeers peers are connected.
+func WithPeerCheck(peers func() int, minPeers int) Option {
+	return func(m *Monitor) {
+		m.peers = peers
+		m.minPeer = minPeers
+	}
+}
+
+// WithWebhookCheck alerts when events cannot be delivered to a webhook.
+func WithWebhookCheck(whm WebhookManager) Option {
+	return func(m *Monitor) {
+		m.whm = whm
+	}
+}
+
+// WithDiskCheck alerts when the disk containing dir is nearly full.
+func WithDiskCheck(dir string) Option {
+	return func(m *Monitor) {
+		m.dir = dir
+	}
+}
+
+// WithClockCheck alerts when the local clock is off by more than maxSkew
+// according to the NTP servers. If servers is empty, public NTP pools are
+// used. The clock is checked every 15 minutes.
+func WithClockCheck(servers []string, maxSkew time.Duration) Option {
+	return func(m *Monitor) {
+		m.ntpServers = servers
+		m.maxSkew = maxSkew
+	}
+}
+
+// WithScheduler registers the node health checks as the "health" job.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Monitor) {
+		m.sched = s
+	}
+}
@@ -0,0 +1,150 @@
+// Package ibd times the stages of the initial blockchain download, so that
+// operators can see where a slow initial sync spends its time.
+package ibd
+
+import (
+	"sync"
+	"time"
+)
+
+// Stages of the initial sync, in order.
+const (
+	// StagePeers is the time spent waiting for the first peer.
+	StagePeers = "peers"
+	// StageBlocks is the time spent downloading and validating blocks
+	// until the consensus tip is recent.
+	StageBlocks = "blocks"
+	// StageIndex is the time spent indexing the remaining blocks after
+	// the download finished.
+	StageIndex = "index"
+)
+
+var stageNames = []string{StagePeers, StageBlocks, StageIndex}
+
+type (
+	// Progress is a snapshot of the node's sync state.
+	Progress struct {
+		// Peers is the number of connected peers.
+		Peers int
+		// Height is the height of the consensus tip.
+		Height uint64
+		// Synced is true if the consensus tip is recent.
+		Synced bool
+		// Indexed is the height of the last block indexed by the wallet
+		// store.
+		Indexed uint64
+	}
+
+	// A Stage is the timing of a stage of the initial sync.
+	Stage struct {
+		Name string `json:"name"`
+		// StartTime and EndTime are zero if the stage has not started or
+		// finished.
+		StartTime time.Time `json:"startTime"`
+		EndTime   time.Time `json:"endTime"`
+		// Elapsed is the duration of the stage, or the time since it
+		// started if it is running.
+		Elapsed time.Duration `json:"elapsed"`
+		// StartHeight and EndHeight are the heights of the consensus tip,
+		// or of the wallet index for StageIndex, when the stage started
+		// and finished.
+		StartHeight uint64 `json:"startHeight"`
+		EndHeight   uint64 `json:"endHeight"`
+	}
+
+	// Status is the progress of the initial sync.
+	Status struct {
+		// Complete is true once every stage has finished.
+		Complete bool    `json:"complete"`
+		Stages   []Stage `json:"stages"`
+	}
+
+	// A Tracker records the stages of the initial sync. Stages advance
+	// as Update observes the node's progress.
+	Tracker struct {
+		mu      sync.Mutex
+		stages  []Stage
+		current int // index of the running stage
+	}
+)
+
+// height returns the height a stage is measured in.
+func (p Progress) height(stage string) uint64 {
+	if stage == StageIndex {
+		return p.Indexed
+	}
+	return p.Height
+}
+
+// finished returns true if the progress completes a stage.
+func (p Progress) finished(stage string) bool {
+	switch stage {
+	case StagePeers:
+		return p.Peers > 0
+	case StageBlocks:
+		return p.Synced
+	case StageIndex:
+		return p.Synced && p.Indexed >= p.Height
+	default:
+		panic("unknown stage " + stage) // developer error
+	}
+}
+
+// Update advances the running stage, and any stages after it, that the
+// progress completes.
+func (t *Tracker) Update(p Progress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for t.current < len(t.stages) {
+		stage := &t.stages[t.current]
+		if stage.StartTime.IsZero() {
+			stage.StartTime = now
+			stage.StartHeight = p.height(stage.Name)
+		}
+		if !p.finished(stage.Name) {
+			return
+		}
+		stage.EndTime = now
+		stage.EndHeight = p.height(stage.Name)
+		t.current++
+	}
+}
+
+// Complete returns true once every stage has finished.
+func (t *Tracker) Complete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current == len(t.stages)
+}
+
+// Status returns the timing of each stage.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := Status{
+		Complete: t.current == len(t.stages),
+		Stages:   append([]Stage(nil), t.stages...),
+	}
+	for i := range status.Stages {
+		stage := &status.Stages[i]
+		switch {
+		case stage.StartTime.IsZero():
+		case stage.EndTime.IsZero():
+			stage.Elapsed = time.Since(stage.StartTime)
+		default:
+			stage.Elapsed = stage.EndTime.Sub(stage.StartTime)
+		}
+	}
+	return status
+}
+
+// NewTracker returns a Tracker. The first stage starts with the first call
+// to Update.
+func NewTracker() *Tracker {
+	t := &Tracker{stages: make([]Stage, len(stageNames))}
+	for i, name := range stageNames {
+		t.stages[i].Name = name
+	}
+	return t
+}
@@ -0,0 +1,65 @@
+package ibd_test
+
+import (
+	"testing"
+
+	"go.thebigfile.com/walletd/ibd"
+)
+
+func TestTracker(t *testing.T) {
+	tr := ibd.NewTracker()
+
+	assertStage := func(name string, started, finished bool) {
+		t.Helper()
+		for _, stage := range tr.Status().Stages {
+			if stage.Name != name {
+				continue
+			} else if started != !stage.StartTime.IsZero() || finished != !stage.EndTime.IsZero() {
+				t.Fatalf("expected stage %q started=%v finished=%v, got %+v", name, started, finished, stage)
+			}
+			return
+		}
+		t.Fatalf("stage %q not found", name)
+	}
+
+	// no stage starts before the first update
+	assertStage(ibd.StagePeers, false, false)
+
+	tr.Update(ibd.Progress{})
+	assertStage(ibd.StagePeers, true, false)
+	assertStage(ibd.StageBlocks, false, false)
+
+	// connecting to a peer starts the download
+	tr.Update(ibd.Progress{Peers: 1, Height: 10, Indexed: 5})
+	assertStage(ibd.StagePeers, true, true)
+	assertStage(ibd.StageBlocks, true, false)
+
+	// the index stage starts once the tip is recent and ends once the
+	// index reaches it
+	tr.Update(ibd.Progress{Peers: 1, Height: 1000, Synced: true, Indexed: 900})
+	assertStage(ibd.StageBlocks, true, true)
+	assertStage(ibd.StageIndex, true, false)
+	if tr.Complete() {
+		t.Fatal("expected sync to be incomplete")
+	}
+	tr.Update(ibd.Progress{Peers: 1, Height: 1001, Synced: true, Indexed: 1001})
+	assertStage(ibd.StageIndex, true, true)
+
+	status := tr.Status()
+	if !status.Complete || !tr.Complete() {
+		t.Fatal("expected sync to be complete")
+	}
+	blocks, index := status.Stages[1], status.Stages[2]
+	if blocks.StartHeight != 10 || blocks.EndHeight != 1000 {
+		t.Fatalf("expected blocks stage from 10 to 1000, got %+v", blocks)
+	} else if index.StartHeight != 900 || index.EndHeight != 1001 {
+		t.Fatalf("expected index stage from 900 to 1001, got %+v", index)
+	}
+
+	// a node that is already synced completes every stage at once
+	tr = ibd.NewTracker()
+	tr.Update(ibd.Progress{Peers: 1, Height: 10, Synced: true, Indexed: 10})
+	if !tr.Complete() {
+		t.Fatal("expected sync to be complete")
+	}
+}
@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/wallet"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported import formats.
+const (
+	// FormatSiaUI is a Sia-UI wallet export: a JSON object with the seed
+	// phrase and the addresses derived from it.
+	//
+	//	{ "seed": "...", "addresses": [{ "address": "addr:...", "index": 0 }] }
+	FormatSiaUI = "sia-ui"
+	// FormatRenterd is a renterd config file, in YAML or JSON, with the
+	// node's seed phrase under the "seed" key. renterd's wallet uses the
+	// address of the seed's first key.
+	FormatRenterd = "renterd"
+	// FormatPhrase is a bare seed phrase.
+	FormatPhrase = "phrase"
+)
+
+const (
+	// defaultPhraseAddresses is the number of addresses derived from a bare
+	// seed phrase if the request does not specify a number.
+	defaultPhraseAddresses = 20
+	// maxAddresses is the maximum number of addresses in an import.
+	maxAddresses = 10000
+)
+
+// ErrUnknownFormat is returned when the format of an import cannot be
+// detected or is not supported.
+var ErrUnknownFormat = errors.New("unknown import format")
+
+type (
+	// siaUIExport is the wallet export format of Sia-UI.
+	siaUIExport struct {
+		Seed      string `json:"seed"`
+		Addresses []struct {
+			Address types.Address `json:"address"`
+			Index   uint64        `json:"index"`
+		} `json:"addresses"`
+	}
+
+	// A Wallet is a parsed wallet definition.
+	Wallet struct {
+		Format string
+		// Phrase is the wallet's seed phrase. The caller should discard it
+		// once the wallet has been imported.
+		Phrase    string
+		Addresses []wallet.Address
+	}
+)
+
+// seedAddress derives the address at index from a seed.
+func seedAddress(seed wallet.Seed, index uint64, desc string) wallet.Address {
+	policy := types.PolicyPublicKey(seed.PublicKey(index))
+	return wallet.Address{
+		Address:     policy.Address(),
+		Description: desc,
+		SpendPolicy: &policy,
+		Metadata:    json.RawMessage(fmt.Sprintf(`{"keyIndex":%d}`, index)),
+	}
+}
+
+// isPhrase returns true if s looks like a seed phrase.
+func isPhrase(s string) bool {
+	words := strings.Fields(s)
+	if len(words) < 12 {
+		return false
+	}
+	for _, word := range words {
+		for _, r := range word {
+			if !unicode.IsLetter(r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Detect returns the format of an exported wallet definition.
+func Detect(data []byte) (string, error) {
+	var obj map[string]any
+	if err := yaml.Unmarshal(data, &obj); err == nil && obj != nil {
+		if _, ok := obj["seed"].(string); !ok {
+			return "", fmt.Errorf("%w: object does not contain a seed", ErrUnknownFormat)
+		} else if _, ok := obj["addresses"]; ok {
+			return FormatSiaUI, nil
+		}
+		return FormatRenterd, nil
+	} else if isPhrase(string(data)) {
+		return FormatPhrase, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Parse parses an exported wallet definition and derives its addresses. If
+// format is empty, it is detected. n is the number of addresses derived from
+// formats that do not list them; if zero, renterd imports derive one
+// address and bare phrases derive 20.
+func Parse(format string, data []byte, n uint64) (Wallet, error) {
+	if format == "" {
+		var err error
+		if format, err = Detect(data); err != nil {
+			return Wallet{}, err
+		}
+	}
+
+	if n > maxAddresses {
+		return Wallet{}, fmt.Errorf("cannot derive more than %d addresses", maxAddresses)
+	}
+
+	w := Wallet{Format: format}
+	switch format {
+	case FormatSiaUI:
+		var export siaUIExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			return Wallet{}, fmt.Errorf("failed to decode Sia-UI export: %w", err)
+		}
+		w.Phrase = export.Seed
+		seed, err := seedFromPhrase(w.Phrase)
+		if err != nil {
+			return Wallet{}, err
+		}
+		if len(export.Addresses) > maxAddresses {
+			return Wallet{}, fmt.Errorf("cannot import more than %d addresses", maxAddresses)
+		}
+		for _, addr := range export.Addresses {
+			derived := seedAddress(seed, addr.Index, "imported from Sia-UI")
+			if derived.Address != addr.Address {
+				return Wallet{}, fmt.Errorf("address %v does not match key %d of the seed", addr.Address, addr.Index)
+			}
+			w.Addresses = append(w.Addresses, derived)
+		}
+	case FormatRenterd:
+		var cfg struct {
+			Seed string `yaml:"seed"`
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return Wallet{}, fmt.Errorf("failed to decode renterd config: %w", err)
+		}
+		w.Phrase = cfg.Seed
+		var err error
+		w.Addresses, err = deriveAddresses(w.Phrase, max(n, 1), "imported from renterd")
+		if err != nil {
+			return Wallet{}, err
+		}
+	case FormatPhrase:
+		w.Phrase = strings.Join(strings.Fields(string(data)), " ")
+		if n == 0 {
+			n = defaultPhraseAddresses
+		}
+		var err error
+		w.Addresses, err = deriveAddresses(w.Phrase, n, "imported from seed phrase")
+		if err != nil {
+			return Wallet{}, err
+		}
+	default:
+		return Wallet{}, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	return w, nil
+}
+
+// seedFromPhrase returns the seed of a phrase.
+func seedFromPhrase(phrase string) (wallet.Seed, error) {
+	var entropy [32]byte
+	if err := cwallet.SeedFromPhrase(&entropy, phrase); err != nil {
+		return wallet.Seed{}, fmt.Errorf("invalid seed phrase: %w", err)
+	}
+	return wallet.NewSeedFromEntropy(&entropy), nil
+}
+
+// deriveAddresses derives the first n addresses of a phrase's seed.
+func deriveAddresses(phrase string, n uint64, desc string) ([]wallet.Address, error) {
+	seed, err := seedFromPhrase(phrase)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]wallet.Address, 0, n)
+	for i := uint64(0); i < n; i++ {
+		addrs = append(addrs, seedAddress(seed, i, desc))
+	}
+	return addrs, nil
+}
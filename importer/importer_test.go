@@ -0,0 +1,68 @@
+package importer_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/importer"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func TestImport(t *testing.T) {
+	phrase := cwallet.NewSeedPhrase()
+	var entropy [32]byte
+	if err := cwallet.SeedFromPhrase(&entropy, phrase); err != nil {
+		t.Fatal(err)
+	}
+	seed := wallet.NewSeedFromEntropy(&entropy)
+	addr := func(i uint64) types.Address {
+		return types.PolicyPublicKey(seed.PublicKey(i)).Address()
+	}
+
+	siaUI := fmt.Sprintf(`{"seed": %q, "addresses": [{"address": %q, "index": 0}, {"address": %q, "index": 5}]}`, phrase, addr(0), addr(5))
+	tests := []struct {
+		data    string
+		format  string
+		n       uint64
+		indices []uint64
+	}{
+		{siaUI, importer.FormatSiaUI, 0, []uint64{0, 5}},
+		{fmt.Sprintf("directory: /var/lib/renterd\nseed: %s\n", phrase), importer.FormatRenterd, 0, []uint64{0}},
+		{fmt.Sprintf(`{"seed": %q}`, phrase), importer.FormatRenterd, 2, []uint64{0, 1}},
+		{phrase + "\n", importer.FormatPhrase, 3, []uint64{0, 1, 2}},
+	}
+	for _, test := range tests {
+		if format, err := importer.Detect([]byte(test.data)); err != nil {
+			t.Fatal(err)
+		} else if format != test.format {
+			t.Fatalf("expected format %q, got %q", test.format, format)
+		}
+
+		w, err := importer.Parse("", []byte(test.data), test.n)
+		if err != nil {
+			t.Fatal(err)
+		} else if w.Phrase != phrase {
+			t.Fatalf("%s: expected the seed phrase", test.format)
+		} else if len(w.Addresses) != len(test.indices) {
+			t.Fatalf("%s: expected %d addresses, got %d", test.format, len(test.indices), len(w.Addresses))
+		}
+		for i, index := range test.indices {
+			if w.Addresses[i].Address != addr(index) || w.Addresses[i].SpendPolicy == nil {
+				t.Fatalf("%s: expected address %d to be key %d of the seed", test.format, i, index)
+			}
+		}
+	}
+
+	// a Sia-UI address that does not belong to the seed is rejected
+	bad := fmt.Sprintf(`{"seed": %q, "addresses": [{"address": %q, "index": 1}]}`, phrase, addr(2))
+	if _, err := importer.Parse("", []byte(bad), 0); err == nil {
+		t.Fatal("expected mismatched address to be rejected")
+	} else if _, err := importer.Parse("", []byte(`{"name": "foo"}`), 0); !errors.Is(err, importer.ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	} else if _, err := importer.Parse("electrum", []byte(phrase), 0); !errors.Is(err, importer.ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
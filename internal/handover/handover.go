@@ -0,0 +1,297 @@
+// Package handover passes listening sockets from a running process to its
+// replacement, so that a new binary can take over the API and syncer
+// addresses without refusing connections. Connections that arrive while the
+// new process starts wait in the socket's accept queue.
+package handover
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// envListeners names the listeners passed to a new process. The
+	// listeners are passed as file descriptors 3 and up, in order,
+	// followed by the write end of the ready pipe.
+	envListeners = "WALLETD_HANDOVER_LISTENERS"
+	// envNotifySocket is the socket systemd receives notifications on.
+	envNotifySocket = "NOTIFY_SOCKET"
+)
+
+// ErrNotSupported is returned on platforms that do not support handing over
+// listeners or SO_REUSEPORT.
+var ErrNotSupported = errors.New("listener handover is not supported on this platform")
+
+// A Set creates named listeners and hands them over to a new process.
+type Set struct {
+	reusePort bool
+
+	mu        sync.Mutex
+	inherited map[string]net.Listener
+	active    map[string]net.Listener
+	ready     *os.File
+	upgrading bool
+}
+
+// matches returns true if l is listening on addr. An unspecified port or host
+// in addr matches any port or host.
+func matches(l net.Listener, addr string) bool {
+	want, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return false
+	}
+	got, ok := l.Addr().(*net.TCPAddr)
+	if !ok {
+		return false
+	} else if want.Port != 0 && want.Port != got.Port {
+		return false
+	}
+	return want.IP == nil || want.IP.IsUnspecified() || want.IP.Equal(got.IP)
+}
+
+// Inherited returns true if the process inherited listeners from the process
+// it replaces.
+func (s *Set) Inherited() bool {
+	return s.ready != nil
+}
+
+// Listen returns the listener named name. If the process inherited a
+// listener with that name on the same address, it is returned. Otherwise, a
+// new listener is created.
+func (s *Set) Listen(name, addr string) (net.Listener, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.active[name]; ok {
+		return nil, fmt.Errorf("listener %q already exists", name)
+	}
+
+	l, ok := s.inherited[name]
+	if ok {
+		delete(s.inherited, name)
+		if !matches(l, addr) {
+			l.Close()
+			ok = false
+		}
+	}
+	if !ok {
+		var err error
+		if l, err = listen(addr, s.reusePort); err != nil {
+			return nil, err
+		}
+	}
+	s.active[name] = &listener{Listener: l, s: s, name: name}
+	return s.active[name], nil
+}
+
+// Ready notifies the process that started this one that the listeners were
+// inherited, so that it can stop. If the process runs under systemd, the
+// service manager is notified of the new main PID.
+func (s *Set) Ready() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ready == nil {
+		return nil
+	}
+	defer func() {
+		s.ready.Close()
+		s.ready = nil
+	}()
+	if _, err := s.ready.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to notify parent: %w", err)
+	} else if err := notifyMainPID(); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
+
+// CloseUnused closes inherited listeners that were not claimed by Listen,
+// e.g. because their server was disabled.
+func (s *Set) CloseUnused() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, l := range s.inherited {
+		l.Close()
+		delete(s.inherited, name)
+	}
+}
+
+// Upgrade starts a new process from the current executable with the same
+// arguments, passing it every open listener and env in addition to the
+// current environment. It returns nil once the new process has inherited
+// the listeners, after which the caller should stop gracefully. If the new
+// process exits or does not become ready before the timeout, it is killed
+// and an error is returned; the caller keeps serving.
+func (s *Set) Upgrade(timeout time.Duration, env ...string) error {
+	if !supported {
+		return ErrNotSupported
+	}
+
+	s.mu.Lock()
+	if s.upgrading {
+		s.mu.Unlock()
+		return errors.New("upgrade already in progress")
+	}
+	s.upgrading = true
+	names := make([]string, 0, len(s.active))
+	for name := range s.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	files := make([]*os.File, 0, len(names)+1)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	var err error
+	for _, name := range names {
+		fl, ok := s.active[name].(*listener).Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			err = fmt.Errorf("listener %q cannot be handed over", name)
+			break
+		}
+		f, ferr := fl.File()
+		if ferr != nil {
+			err = fmt.Errorf("failed to get file of listener %q: %w", name, ferr)
+			break
+		}
+		files = append(files, f)
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.upgrading = false
+		s.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable: %w", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ready pipe: %w", err)
+	}
+	defer r.Close()
+	files = append(files, w)
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Env = append(cmd.Env, envListeners+"="+strings.Join(names, ","))
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+	// close the parent's copy of the write end so that the read fails if
+	// the child exits without signaling
+	w.Close()
+	files = files[:len(files)-1]
+
+	ready := make(chan error, 1)
+	go func() {
+		var buf [1]byte
+		_, err := r.Read(buf[:])
+		ready <- err
+	}()
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-ready:
+		if err == nil {
+			return nil
+		}
+		cmd.Process.Kill()
+		return errors.New("new process exited before taking over listeners")
+	case err := <-exited:
+		return fmt.Errorf("new process exited before taking over listeners: %v", err)
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		return errors.New("timed out waiting for new process")
+	}
+}
+
+// New returns a Set containing the listeners inherited from the process that
+// started this one, if any. If reusePort is true, new listeners set
+// SO_REUSEPORT so that another process can listen on the same addresses.
+func New(reusePort bool) (*Set, error) {
+	if reusePort && !supported {
+		return nil, ErrNotSupported
+	}
+	s := &Set{
+		reusePort: reusePort,
+		inherited: make(map[string]net.Listener),
+		active:    make(map[string]net.Listener),
+	}
+
+	names, ok := os.LookupEnv(envListeners)
+	if !ok {
+		return s, nil
+	}
+	os.Unsetenv(envListeners)
+	var list []string
+	if names != "" {
+		list = strings.Split(names, ",")
+	}
+	for i, name := range list {
+		f := os.NewFile(uintptr(3+i), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			s.CloseUnused()
+			return nil, fmt.Errorf("failed to inherit listener %q: %w", name, err)
+		}
+		s.inherited[name] = l
+	}
+	s.ready = os.NewFile(uintptr(3+len(list)), "ready")
+	return s, nil
+}
+
+// A listener removes itself from its Set when it is closed.
+type listener struct {
+	net.Listener
+	s    *Set
+	name string
+}
+
+// Close implements net.Listener.
+func (l *listener) Close() error {
+	l.s.mu.Lock()
+	if l.s.active[l.name] == net.Listener(l) {
+		delete(l.s.active, l.name)
+	}
+	l.s.mu.Unlock()
+	return l.Listener.Close()
+}
+
+// notifyMainPID tells systemd that this process is the service's main
+// process. The unit must set NotifyAccess=all for the notification to be
+// accepted.
+func notifyMainPID() error {
+	path := os.Getenv(envNotifySocket)
+	if path == "" {
+		return nil
+	}
+	if strings.HasPrefix(path, "@") {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("MAINPID=" + strconv.Itoa(os.Getpid())))
+	return err
+}
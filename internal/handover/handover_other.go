@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd)
+
+package handover
+
+import (
+	"net"
+	"os"
+)
+
+const supported = false
+
+// listen listens on addr. SO_REUSEPORT is not supported.
+func listen(addr string, _ bool) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// Notify does nothing, since upgrades are not supported.
+func Notify(chan<- os.Signal) {}
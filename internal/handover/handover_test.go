@@ -0,0 +1,129 @@
+package handover
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// envTestChild marks the process started by TestUpgrade.
+const envTestChild = "WALLETD_HANDOVER_TEST_CHILD"
+
+func TestUpgrade(t *testing.T) {
+	if !supported {
+		t.Skip(ErrNotSupported)
+	}
+
+	if os.Getenv(envTestChild) != "" {
+		// the new process serves one connection on the inherited
+		// listener and exits
+		s, err := New(false)
+		if err != nil {
+			t.Fatal(err)
+		} else if !s.Inherited() {
+			t.Fatal("expected inherited listeners")
+		}
+		l, err := s.Listen("http", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		} else if err := s.Ready(); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("child"))
+		conn.Close()
+		os.Exit(0)
+	}
+
+	s, err := New(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.Listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upgrade(30*time.Second, envTestChild+"=1"); err != nil {
+		t.Fatal(err)
+	}
+	// the old process stops accepting, but the address stays bound
+	l.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	buf, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(buf) != "child" {
+		t.Fatalf("expected connection to be served by the new process, got %q", buf)
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	if !supported {
+		t.Skip(ErrNotSupported)
+	}
+
+	s1, err := New(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l1, err := s1.Listen("http", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+	if _, err := s1.Listen("http", "127.0.0.1:0"); err == nil {
+		t.Fatal("expected error for duplicate name")
+	}
+
+	// another process can listen on the same address
+	s2, err := New(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := s2.Listen("http", l1.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+
+	if _, err := net.Listen("tcp", l1.Addr().String()); err == nil {
+		t.Fatal("expected listening without SO_REUSEPORT to fail")
+	}
+}
+
+func TestMatches(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{l.Addr().String(), true},
+		{":0", true},
+		{net.JoinHostPort("", strconv.Itoa(port)), true},
+		{net.JoinHostPort("127.0.0.2", strconv.Itoa(port)), false},
+		{net.JoinHostPort("127.0.0.1", strconv.Itoa(port+1)), false},
+	}
+	for _, test := range tests {
+		if got := matches(l, test.addr); got != test.want {
+			t.Errorf("matches(%q): expected %v, got %v", test.addr, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd
+
+package handover
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const supported = true
+
+// listen listens on addr, optionally with SO_REUSEPORT.
+func listen(addr string, reusePort bool) (net.Listener, error) {
+	if !reusePort {
+		return net.Listen("tcp", addr)
+	}
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) (err error) {
+			cerr := c.Control(func(fd uintptr) {
+				err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// Notify relays SIGUSR2, the signal requesting an upgrade, to c.
+func Notify(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR2)
+}
@@ -0,0 +1,388 @@
+// Package jsonschema validates JSON documents against a subset of JSON
+// Schema: type, enum, const, properties, required, additionalProperties,
+// items, minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength,
+// maxLength, pattern, minItems, and maxItems. Other keywords are ignored.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Error describes a value that does not match its schema.
+type Error struct {
+	// Path is a JSON pointer to the invalid value, e.g. "/owner/email".
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Error implements error.
+func (e Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// A Schema is a compiled JSON schema.
+type Schema struct {
+	types     []string
+	enum      []any
+	constant  *any
+	minimum   *float64
+	maximum   *float64
+	exclMin   *float64
+	exclMax   *float64
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	minItems  *int
+	maxItems  *int
+
+	properties map[string]*Schema
+	required   []string
+	// additional is nil if additional properties are allowed without
+	// constraints
+	additional   *Schema
+	noAdditional bool
+	items        *Schema
+	// reject is true for the schema "false"
+	reject bool
+}
+
+var validTypes = map[string]bool{
+	"null":    true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"number":  true,
+	"integer": true,
+	"string":  true,
+}
+
+// decode decodes JSON, keeping numbers as json.Number.
+func decode(buf []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	} else if dec.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// Compile parses a JSON schema.
+func Compile(buf []byte) (*Schema, error) {
+	var v any
+	if err := decode(buf, &v); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	return compile(v, "")
+}
+
+func compile(v any, path string) (*Schema, error) {
+	switch v := v.(type) {
+	case bool:
+		return &Schema{reject: !v}, nil
+	case map[string]any:
+		s := new(Schema)
+		if err := s.load(v, path); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", pathOrRoot(path))
+	}
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "schema"
+	}
+	return path
+}
+
+func (s *Schema) load(m map[string]any, path string) error {
+	number := func(key string) (*float64, error) {
+		v, ok := m[key]
+		if !ok {
+			return nil, nil
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be a number", path, key)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", path, key, err)
+		}
+		return &f, nil
+	}
+	count := func(key string) (*int, error) {
+		f, err := number(key)
+		if err != nil || f == nil {
+			return nil, err
+		} else if *f < 0 || *f != float64(int(*f)) {
+			return nil, fmt.Errorf("%s/%s: must be a non-negative integer", path, key)
+		}
+		n := int(*f)
+		return &n, nil
+	}
+
+	var err error
+	if s.minimum, err = number("minimum"); err != nil {
+		return err
+	} else if s.maximum, err = number("maximum"); err != nil {
+		return err
+	} else if s.exclMin, err = number("exclusiveMinimum"); err != nil {
+		return err
+	} else if s.exclMax, err = number("exclusiveMaximum"); err != nil {
+		return err
+	} else if s.minLength, err = count("minLength"); err != nil {
+		return err
+	} else if s.maxLength, err = count("maxLength"); err != nil {
+		return err
+	} else if s.minItems, err = count("minItems"); err != nil {
+		return err
+	} else if s.maxItems, err = count("maxItems"); err != nil {
+		return err
+	}
+
+	switch t := m["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, v := range t {
+			name, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%s/type: must be a string or array of strings", path)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("%s/type: must be a string or array of strings", path)
+	}
+	for _, t := range s.types {
+		if !validTypes[t] {
+			return fmt.Errorf("%s/type: unknown type %q", path, t)
+		}
+	}
+
+	if v, ok := m["enum"]; ok {
+		enum, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s/enum: must be an array", path)
+		}
+		s.enum = enum
+	}
+	if v, ok := m["const"]; ok {
+		s.constant = &v
+	}
+	if v, ok := m["pattern"]; ok {
+		p, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s/pattern: must be a string", path)
+		}
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return fmt.Errorf("%s/pattern: %w", path, err)
+		}
+	}
+	if v, ok := m["required"]; ok {
+		required, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s/required: must be an array of strings", path)
+		}
+		for _, r := range required {
+			name, ok := r.(string)
+			if !ok {
+				return fmt.Errorf("%s/required: must be an array of strings", path)
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s/properties: must be an object", path)
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, prop := range props {
+			if s.properties[name], err = compile(prop, path+"/properties/"+escape(name)); err != nil {
+				return err
+			}
+		}
+	}
+	if v, ok := m["additionalProperties"]; ok {
+		if allowed, ok := v.(bool); ok {
+			s.noAdditional = !allowed
+		} else if s.additional, err = compile(v, path+"/additionalProperties"); err != nil {
+			return err
+		}
+	}
+	if v, ok := m["items"]; ok {
+		if s.items, err = compile(v, path+"/items"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escape escapes a property name for use in a JSON pointer.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// typeOf returns the JSON type of a decoded value.
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	default:
+		return "string"
+	}
+}
+
+// equal returns true if two decoded JSON values are equal.
+func equal(a, b any) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+		return af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// Validate validates a JSON document against the schema. It returns nil if
+// the document is valid.
+func (s *Schema) Validate(doc []byte) []Error {
+	var v any
+	if err := decode(doc, &v); err != nil {
+		return []Error{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	var errs []Error
+	s.validate(v, "", &errs)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return errs
+}
+
+func (s *Schema) validate(v any, path string, errs *[]Error) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.reject {
+		fail("value is not allowed")
+		return
+	}
+
+	if len(s.types) > 0 {
+		t := typeOf(v)
+		var match bool
+		for _, want := range s.types {
+			if want == t || (want == "number" && t == "integer") {
+				match = true
+				break
+			}
+		}
+		if !match {
+			fail("expected %s, got %s", strings.Join(s.types, " or "), t)
+			return
+		}
+	}
+
+	if s.constant != nil && !equal(v, *s.constant) {
+		fail("value must be %v", *s.constant)
+	}
+	if s.enum != nil {
+		var match bool
+		for _, e := range s.enum {
+			if equal(v, e) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			fail("value must be one of %v", s.enum)
+		}
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			fail("must be at least %v", *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			fail("must be at most %v", *s.maximum)
+		}
+		if s.exclMin != nil && f <= *s.exclMin {
+			fail("must be greater than %v", *s.exclMin)
+		}
+		if s.exclMax != nil && f >= *s.exclMax {
+			fail("must be less than %v", *s.exclMax)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match pattern %q", s.pattern.String())
+		}
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.validate(item, path+"/"+strconv.Itoa(i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		for name, value := range v {
+			propPath := path + "/" + escape(name)
+			if prop, ok := s.properties[name]; ok {
+				prop.validate(value, propPath, errs)
+			} else if s.noAdditional {
+				*errs = append(*errs, Error{Path: propPath, Message: "property is not allowed"})
+			} else if s.additional != nil {
+				s.additional.validate(value, propPath, errs)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package jsonschema
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"type": "object",
+		"required": ["customerID", "tier"],
+		"additionalProperties": false,
+		"properties": {
+			"customerID": {"type": "integer", "minimum": 1},
+			"tier": {"enum": ["standard", "gold"]},
+			"email": {"type": "string", "pattern": "^[^@]+@[^@]+$", "maxLength": 32},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 1}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		doc  string
+		errs []Error
+	}{
+		{`{"customerID": 12, "tier": "gold", "email": "a@b", "tags": ["vip"]}`, nil},
+		{`{"customerID": 12.0, "tier": "standard"}`, nil},
+		{`null`, []Error{{"", "expected object, got null"}}},
+		{`{"tier": "gold"}`, []Error{{"", `missing required property "customerID"`}}},
+		{`{"customerID": 0, "tier": "silver"}`, []Error{
+			{"/customerID", "must be at least 1"},
+			{"/tier", "value must be one of [standard gold]"},
+		}},
+		{`{"customerID": 1.5, "tier": "gold", "extra": true}`, []Error{
+			{"/customerID", "expected integer, got number"},
+			{"/extra", "property is not allowed"},
+		}},
+		{`{"customerID": 1, "tier": "gold", "email": "nope", "tags": ["a", "", "c"]}`, []Error{
+			{"/email", `must match pattern "^[^@]+@[^@]+$"`},
+			{"/tags", "must have at most 2 items"},
+			{"/tags/1", "must be at least 1 characters"},
+		}},
+		{`{`, []Error{{"", "invalid JSON: unexpected EOF"}}},
+	}
+	for _, test := range tests {
+		if errs := schema.Validate([]byte(test.doc)); !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("%s: expected %v, got %v", test.doc, test.errs, errs)
+		}
+	}
+
+	for _, bad := range []string{
+		`"object"`,
+		`{"type": "map"}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": {"minLength": -1}}}`,
+		`{"required": [1]}`,
+	} {
+		if _, err := Compile([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be invalid", bad)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package natpmp implements a minimal NAT-PMP client (RFC 6886) for
+// forwarding a TCP port on the local network's gateway.
+package natpmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Port is the port NAT-PMP gateways listen on.
+const Port = 5351
+
+const (
+	opExternalAddress = 0
+	opMapTCP          = 2
+	opResponse        = 128
+
+	// maxAttempts is the number of times a request is sent before giving
+	// up. The timeout doubles after each attempt, starting at 250ms.
+	maxAttempts = 6
+)
+
+// A Client sends requests to a NAT-PMP gateway.
+type Client struct {
+	// Gateway is the host:port of the gateway.
+	Gateway string
+}
+
+// A Mapping is a port forwarded by the gateway.
+type Mapping struct {
+	InternalPort uint16
+	ExternalPort uint16
+	Lifetime     time.Duration
+}
+
+// resultError returns the error for a NAT-PMP result code.
+func resultError(code uint16) error {
+	switch code {
+	case 0:
+		return nil
+	case 1:
+		return errors.New("unsupported version")
+	case 2:
+		return errors.New("not authorized")
+	case 3:
+		return errors.New("network failure")
+	case 4:
+		return errors.New("out of resources")
+	case 5:
+		return errors.New("unsupported opcode")
+	default:
+		return fmt.Errorf("unknown result code %d", code)
+	}
+}
+
+// request sends a request to the gateway, retrying with exponential backoff,
+// and returns the response.
+func (c *Client) request(ctx context.Context, req []byte, respLen int) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", c.Gateway)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial gateway: %w", err)
+	}
+	defer conn.Close()
+
+	op := req[1]
+	resp := make([]byte, 16)
+	timeout := 250 * time.Millisecond
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if _, err := conn.Write(req); err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		deadline := time.Now().Add(timeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+		timeout *= 2
+
+		n, err := conn.Read(resp)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		} else if n < respLen || resp[0] != 0 || resp[1] != opResponse+op {
+			return nil, errors.New("invalid response")
+		} else if err := resultError(binary.BigEndian.Uint16(resp[2:])); err != nil {
+			return nil, err
+		}
+		return resp[:n], nil
+	}
+	return nil, errors.New("gateway did not respond")
+}
+
+// ExternalAddress returns the gateway's external IPv4 address.
+func (c *Client) ExternalAddress(ctx context.Context) (net.IP, error) {
+	resp, err := c.request(ctx, []byte{0, opExternalAddress}, 12)
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(resp[8], resp[9], resp[10], resp[11]), nil
+}
+
+// MapTCP forwards an external TCP port to the internal port for the given
+// lifetime. The gateway may choose a different external port. A zero
+// lifetime removes the mapping.
+func (c *Client) MapTCP(ctx context.Context, internal, external uint16, lifetime time.Duration) (Mapping, error) {
+	req := make([]byte, 12)
+	req[1] = opMapTCP
+	binary.BigEndian.PutUint16(req[4:], internal)
+	binary.BigEndian.PutUint16(req[6:], external)
+	binary.BigEndian.PutUint32(req[8:], uint32(lifetime/time.Second))
+	resp, err := c.request(ctx, req, 16)
+	if err != nil {
+		return Mapping{}, err
+	}
+	return Mapping{
+		InternalPort: binary.BigEndian.Uint16(resp[8:]),
+		ExternalPort: binary.BigEndian.Uint16(resp[10:]),
+		Lifetime:     time.Duration(binary.BigEndian.Uint32(resp[12:])) * time.Second,
+	}, nil
+}
+
+// DefaultGateway returns the IPv4 address of the default gateway. It is only
+// supported on Linux.
+func DefaultGateway() (net.IP, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing table: %w", err)
+	}
+	defer f.Close()
+	return parseRoutes(bufio.NewScanner(f))
+}
+
+// parseRoutes returns the gateway of the default route in a Linux routing
+// table.
+func parseRoutes(s *bufio.Scanner) (net.IP, error) {
+	s.Scan() // skip the header
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != 4 {
+			return nil, fmt.Errorf("invalid gateway %q", fields[2])
+		}
+		// the address is in host byte order, which is little-endian on
+		// every platform walletd supports
+		return net.IPv4(gw[3], gw[2], gw[1], gw[0]), nil
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("no default route")
+}
+
+// NewClient returns a client for the default gateway.
+func NewClient() (*Client, error) {
+	gw, err := DefaultGateway()
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Gateway: net.JoinHostPort(gw.String(), fmt.Sprint(Port))}, nil
+}
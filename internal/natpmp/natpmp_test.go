@@ -0,0 +1,89 @@
+package natpmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve answers NAT-PMP requests, dropping the first request to exercise
+// retransmission.
+func serve(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 16)
+		var dropped bool
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			} else if !dropped {
+				dropped = true
+				continue
+			}
+			resp := make([]byte, 16)
+			resp[1] = opResponse + buf[1]
+			switch {
+			case n == 2 && buf[1] == opExternalAddress:
+				copy(resp[8:], []byte{203, 0, 113, 7})
+				conn.WriteTo(resp[:12], addr)
+			case n == 12 && buf[1] == opMapTCP:
+				copy(resp[8:10], buf[4:6])
+				binary.BigEndian.PutUint16(resp[10:], binary.BigEndian.Uint16(buf[6:])+1)
+				copy(resp[12:16], buf[8:12])
+				conn.WriteTo(resp, addr)
+			default:
+				binary.BigEndian.PutUint16(resp[2:], 5)
+				conn.WriteTo(resp[:8], addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := &Client{Gateway: serve(t)}
+	ip, err := c.ExternalAddress(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if !ip.Equal(net.IPv4(203, 0, 113, 7)) {
+		t.Fatalf("expected 203.0.113.7, got %v", ip)
+	}
+
+	m, err := c.MapTCP(ctx, 9981, 9981, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	} else if m.InternalPort != 9981 || m.ExternalPort != 9982 || m.Lifetime != time.Hour {
+		t.Fatalf("unexpected mapping %+v", m)
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	const routes = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	0000A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth0	00000000	0100A8C0	0003	0	0	0	00000000	0	0	0
+`
+	gw, err := parseRoutes(bufio.NewScanner(strings.NewReader(routes)))
+	if err != nil {
+		t.Fatal(err)
+	} else if !gw.Equal(net.IPv4(192, 168, 0, 1)) {
+		t.Fatalf("expected 192.168.0.1, got %v", gw)
+	}
+
+	if _, err := parseRoutes(bufio.NewScanner(strings.NewReader(strings.Split(routes, "\n")[0]))); err == nil {
+		t.Fatal("expected error without a default route")
+	}
+}
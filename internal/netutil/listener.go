@@ -0,0 +1,100 @@
+// Package netutil contains networking helpers.
+package netutil
+
+import (
+	"net"
+	"sync"
+)
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// A MultiListener accepts connections from several listeners, e.g. an IPv4
+// and an IPv6 listener, as if they were one.
+type MultiListener struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	closed    chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Accept implements net.Listener.
+func (ml *MultiListener) Accept() (net.Conn, error) {
+	select {
+	case res := <-ml.conns:
+		return res.conn, res.err
+	case <-ml.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Addr implements net.Listener. It returns the address of the first
+// listener.
+func (ml *MultiListener) Addr() net.Addr {
+	return ml.listeners[0].Addr()
+}
+
+// Addrs returns the addresses of every listener.
+func (ml *MultiListener) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(ml.listeners))
+	for i, l := range ml.listeners {
+		addrs[i] = l.Addr()
+	}
+	return addrs
+}
+
+// Close implements net.Listener. It closes every listener.
+func (ml *MultiListener) Close() error {
+	var err error
+	ml.closeOnce.Do(func() {
+		close(ml.closed)
+		for _, l := range ml.listeners {
+			if cerr := l.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		ml.wg.Wait()
+	})
+	return err
+}
+
+func (ml *MultiListener) accept(l net.Listener) {
+	defer ml.wg.Done()
+	for {
+		conn, err := l.Accept()
+		select {
+		case ml.conns <- acceptResult{conn, err}:
+		case <-ml.closed:
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			// listener errors are permanent; the error is returned by
+			// Accept, which is expected to close the listener
+			return
+		}
+	}
+}
+
+// NewMultiListener returns a listener that accepts connections from each of
+// the given listeners. At least one listener is required.
+func NewMultiListener(listeners ...net.Listener) *MultiListener {
+	if len(listeners) == 0 {
+		panic("netutil: no listeners") // developer error
+	}
+	ml := &MultiListener{
+		listeners: listeners,
+		conns:     make(chan acceptResult),
+		closed:    make(chan struct{}),
+	}
+	ml.wg.Add(len(listeners))
+	for _, l := range listeners {
+		go ml.accept(l)
+	}
+	return ml
+}
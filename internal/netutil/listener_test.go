@@ -0,0 +1,54 @@
+package netutil
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestMultiListener(t *testing.T) {
+	var listeners []net.Listener
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+	}
+	ml := NewMultiListener(listeners...)
+	defer ml.Close()
+
+	if ml.Addr() != listeners[0].Addr() {
+		t.Fatalf("expected %v, got %v", listeners[0].Addr(), ml.Addr())
+	} else if len(ml.Addrs()) != 2 {
+		t.Fatalf("expected 2 addresses, got %v", len(ml.Addrs()))
+	}
+
+	for _, l := range listeners {
+		client, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		conn, err := ml.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if conn.LocalAddr().String() != l.Addr().String() {
+			t.Fatalf("expected connection on %v, got %v", l.Addr(), conn.LocalAddr())
+		}
+	}
+
+	if err := ml.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := ml.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	for _, l := range listeners {
+		if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expected listener to be closed, got %v", err)
+		}
+	}
+}
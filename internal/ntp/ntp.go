@@ -0,0 +1,127 @@
+// Package ntp implements a minimal SNTP client (RFC 4330) for measuring the
+// offset of the local clock.
+package ntp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultServers are the servers queried if none are configured.
+var DefaultServers = []string{
+	"pool.ntp.org",
+	"time.google.com",
+	"time.cloudflare.com",
+}
+
+const (
+	packetSize = 48
+	// ntpEpochOffset is the number of seconds between the NTP epoch
+	// (1900-01-01) and the Unix epoch.
+	ntpEpochOffset = 2208988800
+
+	modeClient = 3
+	modeServer = 4
+	version    = 4
+)
+
+// A Response is the result of querying an NTP server.
+type Response struct {
+	Server string `json:"server"`
+	// Offset is the amount the local clock must be adjusted by to match the
+	// server's clock. A positive offset means the local clock is behind.
+	Offset time.Duration `json:"offset"`
+	// RTT is the round trip time of the query, excluding the server's
+	// processing time.
+	RTT time.Duration `json:"rtt"`
+}
+
+func toNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+func fromNTP(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := int64((ts & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs, nanos)
+}
+
+// Query queries an NTP server for the offset of the local clock. If server
+// does not include a port, port 123 is used.
+func Query(ctx context.Context, server string) (Response, error) {
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, "123")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to dial %q: %w", server, err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	req := make([]byte, packetSize)
+	req[0] = version<<3 | modeClient
+	t1 := time.Now()
+	origin := toNTP(t1)
+	binary.BigEndian.PutUint64(req[40:], origin)
+	if _, err := conn.Write(req); err != nil {
+		return Response{}, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	resp := make([]byte, packetSize)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return Response{}, fmt.Errorf("failed to read response: %w", err)
+	}
+	t4 := time.Now()
+	switch {
+	case n < packetSize:
+		return Response{}, errors.New("response is too short")
+	case resp[0]&0x7 != modeServer:
+		return Response{}, fmt.Errorf("unexpected mode %d", resp[0]&0x7)
+	case resp[0]>>6 == 3:
+		return Response{}, errors.New("server clock is not synchronized")
+	case resp[1] == 0:
+		return Response{}, fmt.Errorf("server sent kiss-o'-death %q", resp[12:16])
+	case binary.BigEndian.Uint64(resp[24:]) != origin:
+		return Response{}, errors.New("response does not match request")
+	}
+
+	t2 := fromNTP(binary.BigEndian.Uint64(resp[32:]))
+	t3 := fromNTP(binary.BigEndian.Uint64(resp[40:]))
+	return Response{
+		Server: server,
+		Offset: (t2.Sub(t1) + t3.Sub(t4)) / 2,
+		RTT:    t4.Sub(t1) - t3.Sub(t2),
+	}, nil
+}
+
+// QueryAny queries each server in turn and returns the first successful
+// response. If servers is empty, DefaultServers are queried. If no server
+// responds, the last error is returned.
+func QueryAny(ctx context.Context, servers []string) (Response, error) {
+	if len(servers) == 0 {
+		servers = DefaultServers
+	}
+	var err error
+	for _, server := range servers {
+		var resp Response
+		if resp, err = Query(ctx, server); err == nil {
+			return resp, nil
+		}
+	}
+	return Response{}, fmt.Errorf("no NTP server responded: %w", err)
+}
@@ -0,0 +1,75 @@
+package ntp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// serve answers NTP requests with a clock that is ahead of the local clock
+// by offset.
+func serve(t *testing.T, offset time.Duration, stratum byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, packetSize)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			} else if n != packetSize {
+				continue
+			}
+			received := toNTP(time.Now().Add(offset))
+			resp := make([]byte, packetSize)
+			resp[0] = version<<3 | modeServer
+			resp[1] = stratum
+			copy(resp[24:32], buf[40:48])
+			binary.BigEndian.PutUint64(resp[32:], received)
+			binary.BigEndian.PutUint64(resp[40:], toNTP(time.Now().Add(offset)))
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addr := serve(t, 5*time.Second, 1)
+	resp, err := Query(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	} else if diff := resp.Offset - 5*time.Second; diff < -100*time.Millisecond || diff > 100*time.Millisecond {
+		t.Fatalf("expected offset of 5s, got %v", resp.Offset)
+	}
+
+	// a kiss-o'-death response is rejected
+	kod := serve(t, 0, 0)
+	if _, err := Query(ctx, kod); err == nil {
+		t.Fatal("expected error for kiss-o'-death response")
+	}
+
+	// the first server that responds is used
+	resp, err = QueryAny(ctx, []string{kod, addr})
+	if err != nil {
+		t.Fatal(err)
+	} else if resp.Server != addr {
+		t.Fatalf("expected response from %v, got %v", addr, resp.Server)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	now := time.Now()
+	if got := fromNTP(toNTP(now)); now.Sub(got).Abs() > time.Microsecond {
+		t.Fatalf("expected %v, got %v", now, got)
+	}
+}
@@ -0,0 +1,81 @@
+// Package password implements argon2id password hashing for the walletd API
+// password. Hashes are encoded in the PHC string format, e.g.
+//
+//	$argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+//
+// so that they can be stored in the config file in place of the plaintext
+// password.
+package password
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"lukechampine.com/frand"
+)
+
+const (
+	prefix = "$argon2id$"
+
+	defaultTime    = 1
+	defaultMemory  = 64 * 1024 // KiB
+	defaultThreads = 4
+	saltLen        = 16
+	keyLen         = 32
+)
+
+// ErrInvalidHash is returned when an encoded hash cannot be parsed.
+var ErrInvalidHash = errors.New("invalid argon2id hash")
+
+// IsHash returns true if s is an encoded argon2id hash.
+func IsHash(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Hash returns the encoded argon2id hash of password using a random salt.
+func Hash(password string) string {
+	salt := frand.Bytes(saltLen)
+	key := argon2.IDKey([]byte(password), salt, defaultTime, defaultMemory, defaultThreads, keyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", prefix, argon2.Version, defaultMemory, defaultTime, defaultThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+// Verify returns true if password matches the encoded hash.
+func Verify(encoded, password string) (bool, error) {
+	if !IsHash(encoded) {
+		return false, ErrInvalidHash
+	}
+	parts := strings.Split(strings.TrimPrefix(encoded, prefix), "$")
+	if len(parts) != 4 {
+		return false, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil {
+		return false, fmt.Errorf("%w: failed to parse version: %w", ErrInvalidHash, err)
+	} else if version != argon2.Version {
+		return false, fmt.Errorf("%w: unsupported version %d", ErrInvalidHash, version)
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("%w: failed to parse parameters: %w", ErrInvalidHash, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, fmt.Errorf("%w: failed to decode salt: %w", ErrInvalidHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, fmt.Errorf("%w: failed to decode key: %w", ErrInvalidHash, err)
+	}
+
+	derived := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(derived, key) == 1, nil
+}
@@ -0,0 +1,33 @@
+package password
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHashVerify(t *testing.T) {
+	h := Hash("foo bar baz")
+	if !IsHash(h) {
+		t.Fatalf("expected %q to be a hash", h)
+	} else if h2 := Hash("foo bar baz"); h == h2 {
+		t.Fatal("expected hashes to use random salts")
+	}
+
+	if ok, err := Verify(h, "foo bar baz"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected password to match")
+	}
+
+	if ok, err := Verify(h, "foo bar"); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Fatal("expected password not to match")
+	}
+
+	if _, err := Verify("foo bar baz", "foo bar baz"); !errors.Is(err, ErrInvalidHash) {
+		t.Fatalf("expected ErrInvalidHash, got %v", err)
+	} else if _, err := Verify("$argon2id$v=19$m=65536,t=1,p=4$AAAA", "foo"); !errors.Is(err, ErrInvalidHash) {
+		t.Fatalf("expected ErrInvalidHash, got %v", err)
+	}
+}
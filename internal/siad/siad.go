@@ -0,0 +1,213 @@
+// Package siad reads the seeds and addresses of a legacy siad wallet
+// database (wallet.db) so that the wallet can be imported into walletd.
+//
+// siad encrypts each seed with Twofish-GCM under a key derived from the
+// wallet's master key, which is the BLAKE2b hash of the wallet password. If
+// no custom password was set, the password is the primary seed phrase.
+package siad
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/twofish"
+)
+
+// ErrIncorrectPassword is returned when the wallet's seeds cannot be
+// decrypted with the given password.
+var ErrIncorrectPassword = errors.New("incorrect wallet password")
+
+var (
+	bucketWallet = []byte("bucketWallet")
+
+	keyPrimarySeedFile     = []byte("keyPrimarySeedFile")
+	keyPrimarySeedProgress = []byte("keyPrimarySeedProgress")
+	keyAuxiliarySeedFiles  = []byte("keyAuxiliarySeedFiles")
+	keyWatchedAddrs        = []byte("keyWatchedAddrs")
+)
+
+type (
+	// A seedFile is an encrypted seed as stored by siad.
+	seedFile struct {
+		UID                    [32]byte
+		EncryptionVerification []byte
+		Seed                   []byte
+	}
+
+	// A Wallet is the decrypted contents of a siad wallet database.
+	Wallet struct {
+		PrimarySeed [32]byte
+		// PrimaryProgress is the number of addresses siad derived from the
+		// primary seed.
+		PrimaryProgress  uint64
+		AuxiliarySeeds   [][32]byte
+		WatchedAddresses []types.Address
+	}
+)
+
+func (sf *seedFile) DecodeFrom(d *types.Decoder) {
+	d.Read(sf.UID[:])
+	sf.EncryptionVerification = d.ReadBytes()
+	sf.Seed = d.ReadBytes()
+}
+
+// masterKey derives siad's wallet master key from a password.
+func masterKey(password string) [32]byte {
+	buf := binary.LittleEndian.AppendUint64(nil, uint64(len(password)))
+	return blake2b.Sum256(append(buf, password...))
+}
+
+// decrypt decrypts a Twofish-GCM ciphertext prefixed by its nonce.
+func decrypt(key [32]byte, ciphertext []byte) ([]byte, error) {
+	block, err := twofish.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	} else if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	return aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], nil)
+}
+
+// decryptSeed decrypts a seed file with the wallet's master key.
+func decryptSeed(mk [32]byte, sf seedFile) (seed [32]byte, err error) {
+	key := blake2b.Sum256(append(mk[:], sf.UID[:]...))
+	if verification, err := decrypt(key, sf.EncryptionVerification); err != nil || !bytes.Equal(verification, make([]byte, 32)) {
+		return [32]byte{}, ErrIncorrectPassword
+	}
+	plaintext, err := decrypt(key, sf.Seed)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("failed to decrypt seed: %w", err)
+	} else if len(plaintext) != len(seed) {
+		return [32]byte{}, fmt.Errorf("decrypted seed has length %d, expected %d", len(plaintext), len(seed))
+	}
+	copy(seed[:], plaintext)
+	clear(plaintext)
+	return seed, nil
+}
+
+// ReadWallet reads and decrypts a siad wallet database. The database is
+// opened read-only, so siad must not be running.
+func ReadWallet(path, password string) (w Wallet, err error) {
+	if _, err := os.Stat(path); err != nil {
+		return Wallet{}, err
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return Wallet{}, fmt.Errorf("failed to open wallet database: %w", err)
+	}
+	defer db.Close()
+
+	mk := masterKey(password)
+	err = db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketWallet)
+		if b == nil {
+			return errors.New("not a siad wallet database")
+		}
+
+		buf := b.Get(keyPrimarySeedFile)
+		if buf == nil {
+			return errors.New("wallet has not been initialized")
+		}
+		var primary seedFile
+		d := types.NewBufDecoder(buf)
+		primary.DecodeFrom(d)
+		if err := d.Err(); err != nil {
+			return fmt.Errorf("failed to decode primary seed: %w", err)
+		} else if w.PrimarySeed, err = decryptSeed(mk, primary); err != nil {
+			return err
+		}
+
+		if buf := b.Get(keyPrimarySeedProgress); len(buf) == 8 {
+			w.PrimaryProgress = binary.LittleEndian.Uint64(buf)
+		}
+
+		if buf := b.Get(keyAuxiliarySeedFiles); buf != nil {
+			d := types.NewBufDecoder(buf)
+			n := d.ReadUint64()
+			for i := uint64(0); i < n && d.Err() == nil; i++ {
+				var sf seedFile
+				sf.DecodeFrom(d)
+				if d.Err() != nil {
+					break
+				}
+				seed, err := decryptSeed(mk, sf)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt auxiliary seed %d: %w", i, err)
+				}
+				w.AuxiliarySeeds = append(w.AuxiliarySeeds, seed)
+			}
+			if err := d.Err(); err != nil {
+				return fmt.Errorf("failed to decode auxiliary seeds: %w", err)
+			}
+		}
+
+		if buf := b.Get(keyWatchedAddrs); buf != nil {
+			d := types.NewBufDecoder(buf)
+			n := d.ReadUint64()
+			for i := uint64(0); i < n && d.Err() == nil; i++ {
+				var addr types.Address
+				d.Read(addr[:])
+				w.WatchedAddresses = append(w.WatchedAddresses, addr)
+			}
+			if err := d.Err(); err != nil {
+				return fmt.Errorf("failed to decode watched addresses: %w", err)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Addresses derives the wallet's addresses: the addresses siad generated
+// from the primary seed plus lookahead more, auxKeys addresses from each
+// auxiliary seed, and the watched addresses. Seed addresses include their
+// spend policy and key index.
+func (w *Wallet) Addresses(lookahead, auxKeys uint64) []wallet.Address {
+	var addrs []wallet.Address
+	derive := func(entropy *[32]byte, n uint64, desc string) {
+		seed := wallet.NewSeedFromEntropy(entropy)
+		for i := uint64(0); i < n; i++ {
+			uc := types.StandardUnlockConditions(seed.PublicKey(i))
+			policy := types.SpendPolicy{Type: types.PolicyTypeUnlockConditions(uc)}
+			addrs = append(addrs, wallet.Address{
+				Address:     uc.UnlockHash(),
+				Description: desc,
+				SpendPolicy: &policy,
+				Metadata:    json.RawMessage(fmt.Sprintf(`{"keyIndex":%d}`, i)),
+			})
+		}
+	}
+	derive(&w.PrimarySeed, w.PrimaryProgress+lookahead, "siad primary seed")
+	for i := range w.AuxiliarySeeds {
+		derive(&w.AuxiliarySeeds[i], auxKeys, fmt.Sprintf("siad auxiliary seed %d", i+1))
+	}
+	for _, addr := range w.WatchedAddresses {
+		addrs = append(addrs, wallet.Address{
+			Address:     addr,
+			Description: "siad watched address",
+		})
+	}
+	return addrs
+}
+
+// Close clears the wallet's seeds from memory.
+func (w *Wallet) Close() {
+	clear(w.PrimarySeed[:])
+	for i := range w.AuxiliarySeeds {
+		clear(w.AuxiliarySeeds[i][:])
+	}
+}
@@ -0,0 +1,116 @@
+package siad
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/twofish"
+	"lukechampine.com/frand"
+)
+
+func encrypt(t *testing.T, key [32]byte, plaintext []byte) []byte {
+	t.Helper()
+	block, err := twofish.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := frand.Bytes(aead.NonceSize())
+	return aead.Seal(nonce, nonce, plaintext, nil)
+}
+
+func encryptSeed(t *testing.T, password string, seed [32]byte) seedFile {
+	t.Helper()
+	sf := seedFile{UID: frand.Entropy256()}
+	mk := masterKey(password)
+	key := blake2b.Sum256(append(mk[:], sf.UID[:]...))
+	sf.EncryptionVerification = encrypt(t, key, make([]byte, 32))
+	sf.Seed = encrypt(t, key, seed[:])
+	return sf
+}
+
+func appendSeedFile(buf []byte, sf seedFile) []byte {
+	buf = append(buf, sf.UID[:]...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(sf.EncryptionVerification)))
+	buf = append(buf, sf.EncryptionVerification...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(sf.Seed)))
+	return append(buf, sf.Seed...)
+}
+
+func TestReadWallet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.db")
+	const password = "foo bar baz"
+	primary, aux := frand.Entropy256(), frand.Entropy256()
+	watched := types.Address(frand.Entropy256())
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket(bucketWallet)
+		if err != nil {
+			return err
+		}
+		auxFiles := binary.LittleEndian.AppendUint64(nil, 1)
+		auxFiles = appendSeedFile(auxFiles, encryptSeed(t, password, aux))
+		watchedAddrs := append(binary.LittleEndian.AppendUint64(nil, 1), watched[:]...)
+		for k, v := range map[string][]byte{
+			string(keyPrimarySeedFile):     appendSeedFile(nil, encryptSeed(t, password, primary)),
+			string(keyPrimarySeedProgress): binary.LittleEndian.AppendUint64(nil, 5),
+			string(keyAuxiliarySeedFiles):  auxFiles,
+			string(keyWatchedAddrs):        watchedAddrs,
+		} {
+			if err := b.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadWallet(path, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Fatalf("expected ErrIncorrectPassword, got %v", err)
+	}
+	w, err := ReadWallet(path, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if w.PrimarySeed != primary || w.PrimaryProgress != 5 {
+		t.Fatal("primary seed was not decrypted")
+	} else if len(w.AuxiliarySeeds) != 1 || w.AuxiliarySeeds[0] != aux {
+		t.Fatal("auxiliary seed was not decrypted")
+	} else if len(w.WatchedAddresses) != 1 || w.WatchedAddresses[0] != watched {
+		t.Fatal("watched address was not read")
+	}
+
+	addrs := w.Addresses(3, 2)
+	if len(addrs) != 5+3+2+1 {
+		t.Fatalf("expected 11 addresses, got %d", len(addrs))
+	}
+	seed := wallet.NewSeedFromEntropy(&primary)
+	if addrs[7].Address != types.StandardUnlockHash(seed.PublicKey(7)) || addrs[7].SpendPolicy == nil {
+		t.Fatal("expected primary address 7 to be derived from the primary seed")
+	}
+	auxSeed := wallet.NewSeedFromEntropy(&aux)
+	if addrs[9].Address != types.StandardUnlockHash(auxSeed.PublicKey(1)) {
+		t.Fatal("expected auxiliary address 1 to be derived from the auxiliary seed")
+	} else if addrs[10].Address != watched || addrs[10].SpendPolicy != nil {
+		t.Fatal("expected watched address without a spend policy")
+	}
+}
@@ -0,0 +1,223 @@
+// Package sweeper builds, signs, and submits the v2 transactions that key
+// rotations and forwarding rules use to move a wallet's outputs to other
+// addresses.
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// Sweep statuses.
+const (
+	// StatusUnsigned indicates the sweep must be signed and broadcast by the
+	// client.
+	StatusUnsigned = "unsigned"
+	// StatusBroadcast indicates the sweep was signed by the wallet's signer
+	// and broadcast.
+	StatusBroadcast = "broadcast"
+	// StatusPending indicates the sweep was signed by the wallet's signer
+	// and added to the treasury approval queue. It is broadcast once
+	// approved.
+	StatusPending = "pending"
+)
+
+const (
+	// signatureSize is the size of the signature added to each input when
+	// a sweep is signed.
+	signatureSize = 64
+	// inputWeight estimates the weight of a signed input, including its
+	// spend policy and state proof. Outputs worth less than the fee of
+	// spending them are not swept.
+	inputWeight = 400
+)
+
+type (
+	// A ChainManager provides the pool and tip state used to build sweeps,
+	// and accepts signed sweeps into the pool.
+	ChainManager interface {
+		TipState() consensus.State
+		PoolTransactions() []types.Transaction
+		V2PoolTransactions() []types.V2Transaction
+		AddV2PoolTransactions(basis types.ChainIndex, txns []types.V2Transaction) (bool, error)
+	}
+
+	// A Syncer relays signed sweeps to peers.
+	Syncer interface {
+		BroadcastV2TransactionSet(basis types.ChainIndex, txns []types.V2Transaction)
+	}
+
+	// A WalletManager reserves the inputs of sweeps, so that they are not
+	// spent by other transactions funded by walletd.
+	WalletManager interface {
+		Reserve(ids []types.Hash256, duration time.Duration) error
+		// Release releases outputs reserved by Reserve.
+		Release(ids []types.Hash256)
+	}
+
+	// A Signer signs sweeps with a wallet's external signer.
+	Signer interface {
+		SignV2Transaction(ctx context.Context, id wallet.ID, txn types.V2Transaction) (types.V2Transaction, error)
+	}
+
+	// A TreasuryManager checks signed sweeps against the spending policy of
+	// the swept wallet.
+	TreasuryManager interface {
+		BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error)
+	}
+
+	// A Sweeper selects the inputs of sweeps and submits them. Its methods
+	// must not be called concurrently.
+	Sweeper struct {
+		cm     ChainManager
+		s      Syncer
+		wm     WalletManager
+		signer Signer
+		tm     TreasuryManager
+
+		// submittedBy is the principal recorded on sweeps added to the
+		// approval queue.
+		submittedBy     string
+		reserveDuration time.Duration
+
+		// reserved tracks the inputs of recent sweeps so they are not swept
+		// again before they expire.
+		reserved map[types.SiacoinOutputID]time.Time
+	}
+)
+
+// MinValue returns the smallest output worth sweeping at the fee rate.
+func MinValue(feePerByte types.Currency) types.Currency {
+	return feePerByte.Mul64(inputWeight)
+}
+
+// Inputs returns inputs spending up to maxInputs of the outputs, which must
+// be sorted largest first, along with their total value. Outputs that are
+// not worth sweeping, are reserved by a recent sweep, or are spent in the
+// pool are skipped. policy returns the spend policy of an output's address.
+func (s *Sweeper) Inputs(utxos []types.SiacoinElement, feePerByte types.Currency, maxInputs int, policy func(types.Address) types.SpendPolicy, now time.Time) (inputs []types.V2SiacoinInput, value types.Currency) {
+	for id, expiration := range s.reserved {
+		if now.After(expiration) {
+			delete(s.reserved, id)
+		}
+	}
+	inPool := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range s.cm.PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.ParentID] = true
+		}
+	}
+	for _, txn := range s.cm.V2PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.Parent.ID] = true
+		}
+	}
+
+	minValue := MinValue(feePerByte)
+	for _, sce := range utxos {
+		if len(inputs) >= maxInputs {
+			break
+		} else if sce.SiacoinOutput.Value.Cmp(minValue) <= 0 {
+			break // the remaining outputs are not worth sweeping
+		} else if _, ok := s.reserved[sce.ID]; ok || inPool[sce.ID] {
+			continue
+		}
+		inputs = append(inputs, types.V2SiacoinInput{
+			Parent:          sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{Policy: policy(sce.SiacoinOutput.Address)},
+		})
+		value = value.Add(sce.SiacoinOutput.Value)
+	}
+	return inputs, value
+}
+
+// Fee returns the fee of a sweep once its inputs are signed.
+func (s *Sweeper) Fee(txn types.V2Transaction, feePerByte types.Currency) types.Currency {
+	return feePerByte.Mul64(s.cm.TipState().V2TransactionWeight(txn) + uint64(len(txn.SiacoinInputs))*signatureSize)
+}
+
+// Submit reserves the inputs of a sweep and, if the wallet has an external
+// signer, signs it and broadcasts it through the treasury manager. It
+// returns the transaction, signed if it was signed, and the sweep's status.
+// If signing or broadcasting fails, the inputs are released and an error is
+// returned, so that they can be swept again.
+func (s *Sweeper) Submit(ctx context.Context, walletID wallet.ID, basis types.ChainIndex, txn types.V2Transaction, now time.Time) (types.V2Transaction, string, error) {
+	ids := make([]types.Hash256, len(txn.SiacoinInputs))
+	for i, sci := range txn.SiacoinInputs {
+		ids[i] = types.Hash256(sci.Parent.ID)
+	}
+	if err := s.wm.Reserve(ids, s.reserveDuration); err != nil {
+		return types.V2Transaction{}, "", fmt.Errorf("failed to reserve inputs: %w", err)
+	}
+	for _, sci := range txn.SiacoinInputs {
+		s.reserved[sci.Parent.ID] = now.Add(s.reserveDuration)
+	}
+	release := func() {
+		s.wm.Release(ids)
+		for _, sci := range txn.SiacoinInputs {
+			delete(s.reserved, sci.Parent.ID)
+		}
+	}
+
+	if s.signer == nil {
+		return txn, StatusUnsigned, nil
+	}
+	signed, err := s.signer.SignV2Transaction(ctx, walletID, txn)
+	if errors.Is(err, signer.ErrNoSigner) {
+		return txn, StatusUnsigned, nil
+	} else if err != nil {
+		release()
+		return types.V2Transaction{}, "", fmt.Errorf("failed to sign sweep: %w", err)
+	}
+
+	txns := []types.V2Transaction{signed}
+	broadcast := func() error {
+		if _, err := s.cm.AddV2PoolTransactions(basis, txns); err != nil {
+			return fmt.Errorf("failed to add sweep to pool: %w", err)
+		}
+		s.s.BroadcastV2TransactionSet(basis, txns)
+		return nil
+	}
+	if s.tm == nil {
+		if err := broadcast(); err != nil {
+			release()
+			return types.V2Transaction{}, "", fmt.Errorf("failed to broadcast sweep: %w", err)
+		}
+		return signed, StatusBroadcast, nil
+	}
+	_, pending, err := s.tm.BroadcastTransactionSet(nil, txns, s.submittedBy, broadcast)
+	if err != nil {
+		release()
+		return types.V2Transaction{}, "", fmt.Errorf("failed to broadcast sweep: %w", err)
+	} else if pending {
+		return signed, StatusPending, nil
+	}
+	return signed, StatusBroadcast, nil
+}
+
+// New returns a Sweeper. signer and tm are optional; without a signer, every
+// sweep must be signed by the client. submittedBy is the principal recorded
+// on sweeps added to the approval queue, and inputs are reserved for
+// reserveDuration.
+func New(cm ChainManager, s Syncer, wm WalletManager, signer Signer, tm TreasuryManager, submittedBy string, reserveDuration time.Duration) *Sweeper {
+	return &Sweeper{
+		cm:     cm,
+		s:      s,
+		wm:     wm,
+		signer: signer,
+		tm:     tm,
+
+		submittedBy:     submittedBy,
+		reserveDuration: reserveDuration,
+
+		reserved: make(map[types.SiacoinOutputID]time.Time),
+	}
+}
@@ -0,0 +1,143 @@
+package sweeper
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+type chainManager struct {
+	pool []types.V2Transaction
+}
+
+func (chainManager) TipState() consensus.State                    { return consensus.State{} }
+func (chainManager) PoolTransactions() []types.Transaction        { return nil }
+func (cm chainManager) V2PoolTransactions() []types.V2Transaction { return cm.pool }
+func (chainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	reserved map[types.Hash256]bool
+}
+
+func (wm *walletManager) Reserve(ids []types.Hash256, _ time.Duration) error {
+	for _, id := range ids {
+		wm.reserved[id] = true
+	}
+	return nil
+}
+
+func (wm *walletManager) Release(ids []types.Hash256) {
+	for _, id := range ids {
+		delete(wm.reserved, id)
+	}
+}
+
+type signerFunc func(types.V2Transaction) (types.V2Transaction, error)
+
+func (fn signerFunc) SignV2Transaction(_ context.Context, _ wallet.ID, txn types.V2Transaction) (types.V2Transaction, error) {
+	return fn(txn)
+}
+
+func utxo(id byte, value uint64) types.SiacoinElement {
+	return types.SiacoinElement{
+		ID:            types.SiacoinOutputID{id},
+		SiacoinOutput: types.SiacoinOutput{Value: types.NewCurrency64(value)},
+	}
+}
+
+func TestInputs(t *testing.T) {
+	feePerByte := types.NewCurrency64(1)
+	minValue := MinValue(feePerByte).Big().Uint64()
+	utxos := []types.SiacoinElement{
+		utxo(1, minValue*4),
+		utxo(2, minValue*3),
+		utxo(3, minValue*2),
+		utxo(4, minValue), // not worth sweeping
+	}
+	cm := chainManager{pool: []types.V2Transaction{{
+		SiacoinInputs: []types.V2SiacoinInput{{Parent: utxos[1]}},
+	}}}
+	policy := func(types.Address) types.SpendPolicy { return types.SpendPolicy{} }
+	now := time.Now()
+
+	s := New(cm, syncer{}, &walletManager{reserved: make(map[types.Hash256]bool)}, nil, nil, "test", time.Hour)
+	inputs, value := s.Inputs(utxos, feePerByte, 10, policy, now)
+	if len(inputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(inputs))
+	} else if inputs[0].Parent.ID != utxos[0].ID || inputs[1].Parent.ID != utxos[2].ID {
+		t.Fatal("expected the output spent in the pool to be skipped")
+	} else if !value.Equals(types.NewCurrency64(minValue * 6)) {
+		t.Fatalf("expected value %d, got %v", minValue*6, value)
+	}
+
+	if inputs, _ := s.Inputs(utxos, feePerByte, 1, policy, now); len(inputs) != 1 {
+		t.Fatalf("expected 1 input, got %d", len(inputs))
+	}
+
+	// reserved inputs are skipped until the reservation expires
+	if _, status, err := s.Submit(context.Background(), 1, types.ChainIndex{}, types.V2Transaction{SiacoinInputs: inputs}, now); err != nil {
+		t.Fatal(err)
+	} else if status != StatusUnsigned {
+		t.Fatalf("expected status %q, got %q", StatusUnsigned, status)
+	} else if inputs, _ := s.Inputs(utxos, feePerByte, 10, policy, now); len(inputs) != 0 {
+		t.Fatalf("expected reserved inputs to be skipped, got %d inputs", len(inputs))
+	} else if inputs, _ := s.Inputs(utxos, feePerByte, 10, policy, now.Add(2*time.Hour)); len(inputs) != 2 {
+		t.Fatalf("expected expired reservations to be swept, got %d inputs", len(inputs))
+	}
+}
+
+func TestSubmitRelease(t *testing.T) {
+	wm := &walletManager{reserved: make(map[types.Hash256]bool)}
+	txn := types.V2Transaction{SiacoinInputs: []types.V2SiacoinInput{{Parent: utxo(1, 1000)}}}
+	id := types.Hash256(txn.SiacoinInputs[0].Parent.ID)
+	now := time.Now()
+
+	// a wallet without a signer leaves the sweep to the client
+	noSigner := signerFunc(func(types.V2Transaction) (types.V2Transaction, error) {
+		return types.V2Transaction{}, signer.ErrNoSigner
+	})
+	s := New(chainManager{}, syncer{}, wm, noSigner, nil, "test", time.Hour)
+	if _, status, err := s.Submit(context.Background(), 1, types.ChainIndex{}, txn, now); err != nil {
+		t.Fatal(err)
+	} else if status != StatusUnsigned {
+		t.Fatalf("expected status %q, got %q", StatusUnsigned, status)
+	} else if !wm.reserved[id] {
+		t.Fatal("expected unsigned sweep to reserve its inputs")
+	}
+	wm.Release([]types.Hash256{id})
+
+	// a failed signature releases the inputs
+	errSign := errors.New("signer offline")
+	failing := signerFunc(func(types.V2Transaction) (types.V2Transaction, error) { return types.V2Transaction{}, errSign })
+	s = New(chainManager{}, syncer{}, wm, failing, nil, "test", time.Hour)
+	if _, _, err := s.Submit(context.Background(), 1, types.ChainIndex{}, txn, now); !errors.Is(err, errSign) {
+		t.Fatalf("expected %v, got %v", errSign, err)
+	} else if wm.reserved[id] {
+		t.Fatal("expected failed sweep to release its inputs")
+	} else if _, ok := s.reserved[txn.SiacoinInputs[0].Parent.ID]; ok {
+		t.Fatal("expected failed sweep inputs to be sweepable")
+	}
+
+	// a signed sweep is broadcast
+	signing := signerFunc(func(txn types.V2Transaction) (types.V2Transaction, error) { return txn, nil })
+	s = New(chainManager{}, syncer{}, wm, signing, nil, "test", time.Hour)
+	if _, status, err := s.Submit(context.Background(), 1, types.ChainIndex{}, txn, now); err != nil {
+		t.Fatal(err)
+	} else if status != StatusBroadcast {
+		t.Fatalf("expected status %q, got %q", StatusBroadcast, status)
+	} else if !wm.reserved[id] {
+		t.Fatal("expected broadcast sweep to keep its inputs reserved")
+	}
+}
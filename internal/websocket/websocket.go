@@ -0,0 +1,327 @@
+// Package websocket implements the subset of the WebSocket protocol (RFC 6455)
+// needed to exchange messages with a single peer: the opening handshake,
+// fragmented data frames, and ping, pong, and close control frames.
+// Extensions and subprotocols are not supported.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"lukechampine.com/frand"
+)
+
+// Message types.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+)
+
+const (
+	opContinuation = 0
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// closeNormal is the status code sent when a connection is closed
+	// cleanly.
+	closeNormal = 1000
+	// closeTooLarge is the status code sent when a peer sends a message
+	// larger than the read limit.
+	closeTooLarge = 1009
+
+	maxControlPayload = 125
+)
+
+// ErrMessageTooLarge is returned when a peer sends a message larger than the
+// read limit.
+var ErrMessageTooLarge = errors.New("message too large")
+
+// A Conn is a WebSocket connection.
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	client bool
+	limit  int
+
+	mu sync.Mutex // serializes writes
+}
+
+// SetReadLimit sets the maximum size of a message read from the peer. The
+// default is 64 KiB.
+func (c *Conn) SetReadLimit(n int) {
+	c.limit = n
+}
+
+// SetReadDeadline sets the deadline of future reads.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hdr := make([]byte, 2, 14)
+	hdr[0] = 0x80 | op // FIN
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	// frames sent by clients must be masked
+	if c.client {
+		hdr[1] |= 0x80
+		key := frand.Bytes(4)
+		hdr = append(hdr, key...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ key[i%4]
+		}
+		payload = masked
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(append(hdr, payload...))
+	return err
+}
+
+// readFrame reads a single frame. Payloads longer than max are rejected
+// without being read.
+func (c *Conn) readFrame(max int) (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = hdr[0]&0x80 != 0, hdr[0]&0x0F
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("reserved bits set")
+	}
+	masked := hdr[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, errors.New("invalid frame masking")
+	}
+	n := uint64(hdr[1] & 0x7F)
+	switch n {
+	case 126:
+		var buf [2]byte
+		if _, err := io.ReadFull(c.br, buf[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(buf[:]))
+	case 127:
+		var buf [8]byte
+		if _, err := io.ReadFull(c.br, buf[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(buf[:])
+	}
+	if op >= opClose && (!fin || n > maxControlPayload) {
+		return false, 0, nil, errors.New("invalid control frame")
+	} else if op < opClose && n > uint64(max) {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// ReadMessage reads the next text or binary message from the peer. Pings
+// are answered automatically. If the peer closes the connection, ReadMessage
+// returns io.EOF.
+func (c *Conn) ReadMessage() (typ int, msg []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame(c.limit - len(msg))
+		if errors.Is(err, ErrMessageTooLarge) {
+			c.writeClose(closeTooLarge)
+			return 0, nil, err
+		} else if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeClose(closeNormal)
+			return 0, nil, io.EOF
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, errors.New("unexpected continuation frame")
+			}
+		case TextMessage, BinaryMessage:
+			if typ != 0 {
+				return 0, nil, errors.New("expected continuation frame")
+			}
+			typ = int(op)
+		default:
+			return 0, nil, fmt.Errorf("unknown opcode %d", op)
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return typ, msg, nil
+		}
+	}
+}
+
+// WriteMessage sends a text or binary message to the peer. It is safe to
+// call concurrently.
+func (c *Conn) WriteMessage(typ int, msg []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("invalid message type %d", typ)
+	}
+	return c.writeFrame(byte(typ), msg)
+}
+
+// Ping sends a ping to the peer.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+func (c *Conn) writeClose(code uint16) error {
+	return c.writeFrame(opClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *Conn) Close() error {
+	c.writeClose(closeNormal)
+	return c.conn.Close()
+}
+
+func newConn(conn net.Conn, br *bufio.Reader, client bool) *Conn {
+	return &Conn{
+		conn:   conn,
+		br:     br,
+		client: client,
+		limit:  1 << 16,
+	}
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade upgrades an HTTP request to a WebSocket connection. If the request
+// is not a valid WebSocket handshake, an error response is written and an
+// error is returned.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket handshake")
+	} else if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := rw.WriteString(resp); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write handshake: %w", err)
+	} else if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write handshake: %w", err)
+	}
+	// clear any deadlines set by the HTTP server
+	conn.SetDeadline(time.Time{})
+	return newConn(conn, rw.Reader, false), nil
+}
+
+// Dial opens a WebSocket connection to a ws:// URL. TLS is not supported;
+// use a reverse proxy to terminate it.
+func Dial(rawURL string) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	} else if u.Scheme != "ws" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(frand.Bytes(16))
+	req := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	if _, err := io.WriteString(conn, req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to write handshake: %w", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read handshake: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("handshake failed: %s", resp.Status)
+	} else if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, errors.New("handshake failed: invalid accept key")
+	}
+	return newConn(conn, br, true), nil
+}
@@ -0,0 +1,228 @@
+// Package jobs runs the periodic background jobs of walletd's managers and
+// tracks their state, so that they can be inspected, triggered, and paused.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotFound is returned when a job does not exist.
+var ErrNotFound = errors.New("job not found")
+
+type (
+	// A Job is the state of a background job.
+	Job struct {
+		Name        string        `json:"name"`
+		Description string        `json:"description"`
+		Interval    time.Duration `json:"interval"`
+		// Paused jobs do not run on their schedule, but can still be
+		// triggered.
+		Paused   bool   `json:"paused"`
+		Running  bool   `json:"running"`
+		Runs     uint64 `json:"runs"`
+		Failures uint64 `json:"failures"`
+
+		LastRun      time.Time     `json:"lastRun,omitempty"`
+		LastDuration time.Duration `json:"lastDuration,omitempty"`
+		LastError    string        `json:"lastError,omitempty"`
+		NextRun      time.Time     `json:"nextRun,omitempty"`
+	}
+
+	// A Func is the work of a job.
+	Func func(context.Context) error
+
+	// job is a registered job.
+	job struct {
+		state   Job
+		trigger chan struct{}
+	}
+
+	// A Scheduler runs jobs and records their state. A nil Scheduler runs
+	// jobs without recording them.
+	Scheduler struct {
+		log *zap.Logger
+
+		mu   sync.Mutex
+		jobs map[string]*job
+	}
+)
+
+// run runs fn and records the result. Errors are logged by the job itself.
+func (s *Scheduler) run(ctx context.Context, name string, fn Func) {
+	if s == nil {
+		fn(ctx)
+		return
+	}
+
+	s.mu.Lock()
+	j := s.jobs[name]
+	j.state.Running = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	err := fn(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.state.Running = false
+	j.state.Runs++
+	j.state.LastRun = start
+	j.state.LastDuration = time.Since(start)
+	j.state.LastError = ""
+	if err != nil {
+		j.state.Failures++
+		j.state.LastError = err.Error()
+	}
+}
+
+// Run runs fn every interval until ctx is canceled. If immediate is true, fn
+// also runs once before the first interval elapses. Run blocks, so callers
+// usually call it in a goroutine. The job is removed from the scheduler when
+// Run returns. If a job with the same name is already running, a numeric
+// suffix is added to the name.
+func (s *Scheduler) Run(ctx context.Context, name, description string, interval time.Duration, immediate bool, fn Func) {
+	var trigger chan struct{}
+	if s != nil {
+		trigger = make(chan struct{}, 1)
+		s.mu.Lock()
+		base := name
+		for i := 2; s.jobs[name] != nil; i++ {
+			name = base + "." + strconv.Itoa(i)
+		}
+		s.jobs[name] = &job{
+			state:   Job{Name: name, Description: description, Interval: interval},
+			trigger: trigger,
+		}
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.jobs, name)
+			s.mu.Unlock()
+		}()
+	}
+
+	if immediate {
+		s.run(ctx, name, fn)
+	}
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	s.setNextRun(name, time.Now().Add(interval))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-trigger:
+		case <-t.C:
+			if s.paused(name) {
+				t.Reset(interval)
+				s.setNextRun(name, time.Now().Add(interval))
+				continue
+			}
+		}
+		s.run(ctx, name, fn)
+		if !t.Stop() {
+			select {
+			case <-t.C:
+			default:
+			}
+		}
+		t.Reset(interval)
+		s.setNextRun(name, time.Now().Add(interval))
+	}
+}
+
+func (s *Scheduler) paused(name string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[name].state.Paused
+}
+
+func (s *Scheduler) setNextRun(name string, t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name].state.NextRun = t
+}
+
+// Jobs returns the state of every job, sorted by name.
+func (s *Scheduler) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.state)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// Job returns the state of a job.
+func (s *Scheduler) Job(name string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return j.state, nil
+}
+
+// Trigger runs a job as soon as possible, even if it is paused. If the job
+// is running, it runs again once it finishes.
+func (s *Scheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return ErrNotFound
+	}
+	select {
+	case j.trigger <- struct{}{}:
+	default: // already triggered
+	}
+	return nil
+}
+
+// SetPaused pauses or resumes a job. Pausing does not interrupt a running
+// job, and the state is not persisted across restarts.
+func (s *Scheduler) SetPaused(name string, paused bool) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return Job{}, ErrNotFound
+	} else if j.state.Paused == paused {
+		return j.state, nil
+	}
+	j.state.Paused = paused
+	if paused {
+		s.log.Info("job paused", zap.String("job", name))
+	} else {
+		s.log.Info("job resumed", zap.String("job", name))
+	}
+	return j.state, nil
+}
+
+// NewScheduler returns a new Scheduler.
+func NewScheduler(opts ...Option) *Scheduler {
+	s := &Scheduler{
+		log:  zap.NewNop(),
+		jobs: make(map[string]*job),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
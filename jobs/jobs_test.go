@@ -0,0 +1,131 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+)
+
+// waitFor polls fn until it returns true or the timeout elapses.
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if fn() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
+
+func TestScheduler(t *testing.T) {
+	s := jobs.NewScheduler()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, "test", "a test job", time.Hour, true, func(context.Context) error {
+			runs <- struct{}{}
+			return errors.New("failed")
+		})
+	}()
+	<-runs
+	waitFor(t, func() bool {
+		j, err := s.Job("test")
+		return err == nil && j.Runs == 1
+	})
+	j, _ := s.Job("test")
+	if j.Failures != 1 || j.LastError != "failed" || j.LastRun.IsZero() || j.Interval != time.Hour {
+		t.Fatalf("unexpected job %+v", j)
+	} else if time.Until(j.NextRun) < 59*time.Minute {
+		t.Fatalf("expected next run in an hour, got %v", j.NextRun)
+	}
+
+	// a job with the same name gets a suffix
+	go s.Run(ctx, "test", "another test job", time.Hour, false, func(context.Context) error { return nil })
+	waitFor(t, func() bool { return len(s.Jobs()) == 2 })
+	if jj := s.Jobs(); jj[0].Name != "test" || jj[1].Name != "test.2" {
+		t.Fatalf("unexpected jobs %+v", jj)
+	}
+
+	// a paused job can still be triggered
+	if j, err := s.SetPaused("test", true); err != nil {
+		t.Fatal(err)
+	} else if !j.Paused {
+		t.Fatal("expected job to be paused")
+	} else if err := s.Trigger("test"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("triggered job did not run")
+	}
+
+	if err := s.Trigger("missing"); !errors.Is(err, jobs.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if _, err := s.SetPaused("missing", true); !errors.Is(err, jobs.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// jobs are removed once they stop
+	cancel()
+	<-done
+	waitFor(t, func() bool { return len(s.Jobs()) == 0 })
+}
+
+func TestPaused(t *testing.T) {
+	s := jobs.NewScheduler()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 100)
+	go s.Run(ctx, "test", "", 10*time.Millisecond, false, func(context.Context) error {
+		runs <- struct{}{}
+		return nil
+	})
+	<-runs
+	waitFor(t, func() bool {
+		_, err := s.SetPaused("test", true)
+		return err == nil
+	})
+	// drain any run that started before the job was paused
+	time.Sleep(50 * time.Millisecond)
+	for len(runs) > 0 {
+		<-runs
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(runs) != 0 {
+		t.Fatal("paused job ran")
+	}
+
+	if _, err := s.SetPaused("test", false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-runs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("resumed job did not run")
+	}
+}
+
+func TestNilScheduler(t *testing.T) {
+	var s *jobs.Scheduler
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int
+	s.Run(ctx, "test", "", time.Millisecond, true, func(context.Context) error {
+		if n++; n == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if n != 3 {
+		t.Fatalf("expected 3 runs, got %d", n)
+	}
+}
@@ -0,0 +1,13 @@
+package jobs
+
+import "go.uber.org/zap"
+
+// An Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithLogger sets the logger used by the scheduler.
+func WithLogger(log *zap.Logger) Option {
+	return func(s *Scheduler) {
+		s.log = log
+	}
+}
@@ -0,0 +1,266 @@
+package keystore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// minChallengeWords is the fewest words a challenge asks for, and the
+	// number it asks for if the request does not specify a number. Fewer
+	// words would make a correct guess too likely.
+	minChallengeWords = 3
+	// challengeTTL is how long a challenge can be answered.
+	challengeTTL = 10 * time.Minute
+	// maxBackupFailures is the number of consecutive wrong answers after
+	// which a wallet's backup cannot be verified until backupLockout has
+	// passed.
+	maxBackupFailures = 3
+	// backupLockout is how long backup verification is locked out after
+	// too many wrong answers.
+	backupLockout = time.Hour
+)
+
+var (
+	// ErrInvalidChallenge is returned when a backup challenge cannot be
+	// created for a seed.
+	ErrInvalidChallenge = errors.New("invalid backup challenge")
+	// ErrChallengeNotFound is returned when answering a backup challenge
+	// that does not exist, has expired, or was already answered.
+	ErrChallengeNotFound = errors.New("backup challenge not found")
+	// ErrBackupMismatch is returned when the words answering a backup
+	// challenge do not match the seed's recovery phrase.
+	ErrBackupMismatch = errors.New("words do not match the recovery phrase")
+	// ErrBackupLockedOut is returned when creating or answering a backup
+	// challenge after too many wrong answers.
+	ErrBackupLockedOut = errors.New("too many failed backup verifications")
+)
+
+// A Challenge asks the operator to confirm words of a wallet's recovery
+// phrase. Challenges are single-use.
+type Challenge struct {
+	ID       types.Hash256 `json:"id"`
+	WalletID wallet.ID     `json:"walletID"`
+	// Positions are the 1-based positions of the requested words in
+	// ascending order.
+	Positions []int     `json:"positions"`
+	Expires   time.Time `json:"expires"`
+}
+
+// A backupFailure counts a wallet's consecutive wrong answers to backup
+// challenges.
+type backupFailure struct {
+	count       int
+	lockedUntil time.Time
+}
+
+// alertBackupID returns the ID of the unverified backup alert of a wallet.
+func alertBackupID(id wallet.ID) types.Hash256 {
+	return types.HashBytes([]byte(fmt.Sprintf("keystore/backup/%d", id)))
+}
+
+// wordCommitment commits to the word at a 1-based position of a recovery
+// phrase. The commitment is keyed by the seed so that it cannot be used to
+// guess the phrase without it.
+func wordCommitment(entropy *[32]byte, position int, word string) types.Hash256 {
+	mac := hmac.New(sha256.New, entropy[:])
+	fmt.Fprintf(mac, "walletd/backup/%d/%s", position, strings.ToLower(strings.TrimSpace(word)))
+	var h types.Hash256
+	copy(h[:], mac.Sum(nil))
+	return h
+}
+
+// wordCommitments commits to each word of a recovery phrase.
+func wordCommitments(entropy *[32]byte, phrase string) []types.Hash256 {
+	words := strings.Fields(phrase)
+	commitments := make([]types.Hash256, len(words))
+	for i, word := range words {
+		commitments[i] = wordCommitment(entropy, i+1, word)
+	}
+	return commitments
+}
+
+// pruneChallenges removes expired challenges. The caller must hold the lock.
+func (m *Manager) pruneChallenges(now time.Time) {
+	for id, c := range m.challenges {
+		if now.After(c.Expires) {
+			delete(m.challenges, id)
+		}
+	}
+}
+
+// checkBackupLockout returns ErrBackupLockedOut if a wallet's backup
+// verification is locked out. The caller must hold the lock.
+func (m *Manager) checkBackupLockout(id wallet.ID, now time.Time) error {
+	f, ok := m.backupFailures[id]
+	if !ok || f.lockedUntil.IsZero() {
+		return nil
+	} else if now.Before(f.lockedUntil) {
+		return fmt.Errorf("%w: try again after %v", ErrBackupLockedOut, f.lockedUntil.Truncate(time.Second))
+	}
+	delete(m.backupFailures, id)
+	return nil
+}
+
+// recordBackupFailure counts a wrong answer to a wallet's backup challenge,
+// locking out verification after too many. The caller must hold the lock.
+func (m *Manager) recordBackupFailure(id wallet.ID, now time.Time) {
+	f := m.backupFailures[id]
+	f.count++
+	if f.count >= maxBackupFailures {
+		f.lockedUntil = now.Add(backupLockout)
+		// remove any outstanding challenges so they cannot be answered
+		// during the lockout
+		for cid, c := range m.challenges {
+			if c.WalletID == id {
+				delete(m.challenges, cid)
+			}
+		}
+	}
+	m.backupFailures[id] = f
+	m.log.Warn("backup verification failed", zap.Int64("wallet", int64(id)), zap.Int("failures", f.count))
+}
+
+// BackupChallenge creates a challenge asking for n random words of a
+// wallet's recovery phrase. A zero n asks for three words, the minimum. A
+// wallet has at most one outstanding challenge; creating a challenge
+// replaces the previous one.
+func (m *Manager) BackupChallenge(id wallet.ID, n int) (Challenge, error) {
+	es, err := m.store.WalletSeed(id)
+	if err != nil {
+		return Challenge{}, err
+	} else if len(es.WordCommitments) == 0 {
+		return Challenge{}, fmt.Errorf("%w: seed was stored without word commitments, remove and add it again to verify its backup", ErrInvalidChallenge)
+	}
+	if n == 0 {
+		n = minChallengeWords
+	}
+	if n < minChallengeWords || n > len(es.WordCommitments) {
+		return Challenge{}, fmt.Errorf("%w: number of words must be between %d and %d", ErrInvalidChallenge, minChallengeWords, len(es.WordCommitments))
+	}
+
+	positions := frand.Perm(len(es.WordCommitments))[:n]
+	for i := range positions {
+		positions[i]++
+	}
+	sort.Ints(positions)
+	now := time.Now()
+	c := Challenge{
+		ID:        frand.Entropy256(),
+		WalletID:  id,
+		Positions: positions,
+		Expires:   now.Add(challengeTTL),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkBackupLockout(id, now); err != nil {
+		return Challenge{}, err
+	}
+	m.pruneChallenges(now)
+	for cid, prev := range m.challenges {
+		if prev.WalletID == id {
+			delete(m.challenges, cid)
+		}
+	}
+	m.challenges[c.ID] = c
+	return c, nil
+}
+
+// VerifyBackup answers a backup challenge with the requested words in the
+// order of the challenge's positions. The wallet must be unlocked. A
+// challenge can only be answered once, whether or not the words match. After
+// three consecutive wrong answers, the wallet's backup cannot be verified for
+// an hour. On success, the time of verification is recorded and the wallet's
+// unverified backup alert is dismissed.
+func (m *Manager) VerifyBackup(id wallet.ID, challengeID types.Hash256, words []string) (Status, error) {
+	es, err := m.store.WalletSeed(id)
+	if err != nil {
+		return Status{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if err := m.checkBackupLockout(id, now); err != nil {
+		return Status{}, err
+	}
+	m.pruneChallenges(now)
+	c, ok := m.challenges[challengeID]
+	if !ok || c.WalletID != id {
+		return Status{}, ErrChallengeNotFound
+	}
+	u, ok := m.unlocked[id]
+	if !ok {
+		// leave the challenge so it can be answered after unlocking
+		return Status{}, ErrLocked
+	}
+	delete(m.challenges, challengeID)
+
+	if len(words) != len(c.Positions) {
+		m.recordBackupFailure(id, now)
+		return Status{}, fmt.Errorf("%w: expected %d words, got %d", ErrBackupMismatch, len(c.Positions), len(words))
+	}
+	for i, pos := range c.Positions {
+		commitment := wordCommitment(u.entropy, pos, words[i])
+		if pos > len(es.WordCommitments) || !hmac.Equal(commitment[:], es.WordCommitments[pos-1][:]) {
+			m.recordBackupFailure(id, now)
+			return Status{}, ErrBackupMismatch
+		}
+	}
+	delete(m.backupFailures, id)
+
+	if err := m.store.SetWalletSeedBackupVerified(id, now); err != nil {
+		return Status{}, fmt.Errorf("failed to record backup verification: %w", err)
+	} else if m.alerter != nil {
+		m.alerter.Dismiss(alertBackupID(id))
+	}
+	m.log.Info("backup verified", zap.Int64("wallet", int64(id)))
+	return Status{
+		Locked:         false,
+		UnlockedUntil:  u.expires,
+		BackupVerified: now.UTC().Truncate(time.Second),
+		DateCreated:    es.DateCreated,
+	}, nil
+}
+
+// checkBackups registers an alert for each wallet with an unverified backup
+// holding at least the alert threshold.
+func (m *Manager) checkBackups(now time.Time) {
+	ids, err := m.store.UnverifiedWalletSeeds()
+	if err != nil {
+		m.log.Error("failed to get unverified seeds", zap.Error(err))
+		return
+	}
+	for _, id := range ids {
+		balance, err := m.wm.WalletBalance(id)
+		if err != nil {
+			m.log.Error("failed to get wallet balance", zap.Int64("wallet", int64(id)), zap.Error(err))
+			continue
+		} else if balance.Siacoins.Cmp(m.backupAlertThreshold) < 0 {
+			m.alerter.Dismiss(alertBackupID(id))
+			continue
+		}
+		m.alerter.Register(alerts.Alert{
+			ID:       alertBackupID(id),
+			Severity: alerts.SeverityWarning,
+			Message:  fmt.Sprintf("wallet %d holds %v but the backup of its seed was never verified", id, balance.Siacoins),
+			Data: map[string]any{
+				"walletID": id,
+				"balance":  balance.Siacoins,
+			},
+			Timestamp: now,
+		})
+	}
+}
@@ -0,0 +1,447 @@
+package keystore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/frand"
+)
+
+const (
+	kdfTime    = 1
+	kdfMemory  = 64 * 1024 // KiB
+	kdfThreads = 4
+)
+
+var (
+	// ErrNotFound is returned when a wallet does not have a stored seed.
+	ErrNotFound = errors.New("wallet does not have a stored seed")
+	// ErrExists is returned when storing a seed for a wallet that already
+	// has one.
+	ErrExists = errors.New("wallet already has a stored seed")
+	// ErrLocked is returned when signing with the seed of a locked wallet.
+	ErrLocked = errors.New("wallet is locked")
+	// ErrInvalidTimeout is returned when unlocking a wallet with a
+	// negative timeout or one longer than the maximum.
+	ErrInvalidTimeout = errors.New("invalid unlock timeout")
+	// ErrIncorrectPassphrase is returned when a seed cannot be decrypted
+	// with the given passphrase.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+)
+
+type (
+	// An EncryptedSeed is a wallet seed encrypted with XChaCha20-Poly1305
+	// under a key derived from a passphrase with argon2id.
+	EncryptedSeed struct {
+		Salt       [16]byte
+		Nonce      [chacha20poly1305.NonceSizeX]byte
+		Ciphertext []byte
+		// WordCommitments commit to each word of the seed's recovery phrase
+		// so that a backup can be verified without storing the phrase.
+		WordCommitments []types.Hash256
+		BackupVerified  time.Time
+		DateCreated     time.Time
+	}
+
+	// Status is the lock state of a wallet's seed.
+	Status struct {
+		Locked bool `json:"locked"`
+		// UnlockedUntil is when the wallet will be locked automatically.
+		// It is zero while the wallet is locked.
+		UnlockedUntil time.Time `json:"unlockedUntil"`
+		// BackupVerified is when the operator last confirmed words of the
+		// recovery phrase. It is zero if the backup was never verified.
+		BackupVerified time.Time `json:"backupVerified"`
+		DateCreated    time.Time `json:"dateCreated"`
+		// External is true if the seed was loaded from a secrets backend.
+		// External seeds are never stored and cannot be locked.
+		External bool `json:"external,omitempty"`
+	}
+
+	// A Store persists encrypted seeds.
+	Store interface {
+		// WalletSeed returns a wallet's encrypted seed. It returns
+		// ErrNotFound if the wallet does not have one.
+		WalletSeed(wallet.ID) (EncryptedSeed, error)
+		// AddWalletSeed stores a wallet's encrypted seed. It returns
+		// ErrExists if the wallet already has one.
+		AddWalletSeed(wallet.ID, EncryptedSeed) error
+		// RemoveWalletSeed removes a wallet's encrypted seed. It returns
+		// ErrNotFound if the wallet does not have one.
+		RemoveWalletSeed(wallet.ID) error
+		// SetWalletSeedBackupVerified records when the backup of a wallet's
+		// seed was verified.
+		SetWalletSeedBackupVerified(wallet.ID, time.Time) error
+		// UnverifiedWalletSeeds returns the IDs of wallets with a stored
+		// seed whose backup was never verified.
+		UnverifiedWalletSeeds() ([]wallet.ID, error)
+	}
+
+	// A WalletManager provides the addresses and balance of a wallet.
+	WalletManager interface {
+		Addresses(wallet.ID) ([]wallet.Address, error)
+		WalletBalance(wallet.ID) (wallet.Balance, error)
+	}
+
+	// An Alerter registers and dismisses alerts.
+	Alerter interface {
+		Register(alerts.Alert)
+		Dismiss(...types.Hash256)
+	}
+
+	// unlockedSeed is a decrypted seed and the keys derived from it.
+	unlockedSeed struct {
+		entropy *[32]byte
+		seed    wallet.Seed
+		// keys maps the public keys of the wallet's addresses to their
+		// key index.
+		keys    map[types.PublicKey]uint64
+		expires time.Time
+		timer   *time.Timer
+	}
+
+	// A Manager stores encrypted wallet seeds and signs with the seeds of
+	// unlocked wallets.
+	Manager struct {
+		store Store
+		wm    WalletManager
+		log   *zap.Logger
+		tg    *threadgroup.ThreadGroup
+		sched *jobs.Scheduler
+
+		alerter              Alerter
+		backupAlertThreshold types.Currency
+		backupCheckInterval  time.Duration
+
+		defaultTimeout time.Duration
+		maxTimeout     time.Duration
+
+		mu         sync.Mutex
+		unlocked   map[wallet.ID]*unlockedSeed
+		external   map[wallet.ID]*unlockedSeed
+		challenges map[types.Hash256]Challenge
+		// backupFailures tracks wrong answers to backup challenges.
+		backupFailures map[wallet.ID]backupFailure
+	}
+)
+
+// deriveKey derives the encryption key of a wallet's seed from a passphrase.
+func deriveKey(passphrase string, salt [16]byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt[:], kdfTime, kdfMemory, kdfThreads, chacha20poly1305.KeySize)
+}
+
+// additionalData binds an encrypted seed to its wallet so that it cannot be
+// moved to another wallet.
+func additionalData(id wallet.ID) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(id))
+}
+
+// lock clears the decrypted seed of a wallet. The caller must hold the lock.
+func (m *Manager) lock(id wallet.ID) {
+	u, ok := m.unlocked[id]
+	if !ok {
+		return
+	}
+	u.timer.Stop()
+	clear(u.entropy[:])
+	delete(m.unlocked, id)
+}
+
+// signingSeed returns the seed a wallet signs with. An external seed takes
+// precedence over an unlocked stored seed. The caller must hold the lock.
+func (m *Manager) signingSeed(id wallet.ID) (*unlockedSeed, bool) {
+	if u, ok := m.external[id]; ok {
+		return u, true
+	}
+	u, ok := m.unlocked[id]
+	return u, ok
+}
+
+// SetExternalSeed holds the seed of a recovery phrase fetched from a secrets
+// backend in memory, replacing any external seed the wallet had. The seed is
+// never stored, and the wallet signs with it instead of its stored seed.
+func (m *Manager) SetExternalSeed(id wallet.ID, phrase string) error {
+	entropy := new([32]byte)
+	if err := cwallet.SeedFromPhrase(entropy, phrase); err != nil {
+		clear(entropy[:])
+		return fmt.Errorf("invalid seed phrase: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.external[id]; ok {
+		clear(u.entropy[:])
+	}
+	m.external[id] = &unlockedSeed{
+		entropy: entropy,
+		seed:    wallet.NewSeedFromEntropy(entropy),
+		keys:    make(map[types.PublicKey]uint64),
+	}
+	return nil
+}
+
+// AddSeed encrypts the seed of a recovery phrase with a passphrase and stores
+// it for a wallet. The wallet remains locked.
+func (m *Manager) AddSeed(id wallet.ID, phrase, passphrase string) error {
+	if passphrase == "" {
+		return errors.New("passphrase is required")
+	}
+	var entropy [32]byte
+	defer clear(entropy[:])
+	if err := cwallet.SeedFromPhrase(&entropy, phrase); err != nil {
+		return fmt.Errorf("invalid seed phrase: %w", err)
+	}
+
+	es := EncryptedSeed{
+		WordCommitments: wordCommitments(&entropy, phrase),
+		DateCreated:     time.Now(),
+	}
+	frand.Read(es.Salt[:])
+	frand.Read(es.Nonce[:])
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, es.Salt))
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	es.Ciphertext = aead.Seal(nil, es.Nonce[:], entropy[:], additionalData(id))
+	if err := m.store.AddWalletSeed(id, es); err != nil {
+		return err
+	}
+	m.log.Info("stored encrypted seed", zap.Int64("wallet", int64(id)))
+	return nil
+}
+
+// RemoveSeed locks a wallet and removes its stored seed.
+func (m *Manager) RemoveSeed(id wallet.ID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lock(id)
+	if err := m.store.RemoveWalletSeed(id); err != nil {
+		return err
+	} else if m.alerter != nil {
+		m.alerter.Dismiss(alertBackupID(id))
+	}
+	return nil
+}
+
+// Status returns the lock state of a wallet's seed.
+func (m *Manager) Status(id wallet.ID) (Status, error) {
+	m.mu.Lock()
+	_, external := m.external[id]
+	m.mu.Unlock()
+	if external {
+		return Status{External: true}, nil
+	}
+
+	es, err := m.store.WalletSeed(id)
+	if err != nil {
+		return Status{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := Status{Locked: true, BackupVerified: es.BackupVerified, DateCreated: es.DateCreated}
+	if u, ok := m.unlocked[id]; ok {
+		status.Locked = false
+		status.UnlockedUntil = u.expires
+	}
+	return status, nil
+}
+
+// Unlock decrypts a wallet's seed and holds it in memory until the timeout
+// elapses or the wallet is locked. A zero timeout uses the default timeout.
+// Unlocking an unlocked wallet extends its timeout.
+func (m *Manager) Unlock(id wallet.ID, passphrase string, timeout time.Duration) (Status, error) {
+	if timeout == 0 {
+		timeout = m.defaultTimeout
+	} else if timeout < 0 || timeout > m.maxTimeout {
+		return Status{}, fmt.Errorf("%w: must be between 0 and %v", ErrInvalidTimeout, m.maxTimeout)
+	}
+
+	es, err := m.store.WalletSeed(id)
+	if err != nil {
+		return Status{}, err
+	}
+	aead, err := chacha20poly1305.NewX(deriveKey(passphrase, es.Salt))
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	var entropy [32]byte
+	if _, err := aead.Open(entropy[:0], es.Nonce[:], es.Ciphertext, additionalData(id)); err != nil {
+		clear(entropy[:])
+		return Status{}, ErrIncorrectPassphrase
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lock(id)
+	u := &unlockedSeed{
+		entropy: &entropy,
+		seed:    wallet.NewSeedFromEntropy(&entropy),
+		keys:    make(map[types.PublicKey]uint64),
+		expires: time.Now().Add(timeout),
+	}
+	u.timer = time.AfterFunc(timeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		// the wallet may have been locked and unlocked again
+		if m.unlocked[id] == u {
+			m.lock(id)
+			m.log.Info("wallet locked automatically", zap.Int64("wallet", int64(id)))
+		}
+	})
+	m.unlocked[id] = u
+	m.log.Info("wallet unlocked", zap.Int64("wallet", int64(id)), zap.Time("until", u.expires))
+	return Status{Locked: false, UnlockedUntil: u.expires, BackupVerified: es.BackupVerified, DateCreated: es.DateCreated}, nil
+}
+
+// Lock clears the decrypted seed of a wallet from memory.
+func (m *Manager) Lock(id wallet.ID) error {
+	if _, err := m.store.WalletSeed(id); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lock(id)
+	return nil
+}
+
+// WalletSigner returns a signer using the seed of an unlocked wallet. It
+// returns signer.ErrNoSigner if the wallet does not have a stored seed and
+// ErrLocked if the wallet is locked.
+func (m *Manager) WalletSigner(id wallet.ID) (signer.Signer, error) {
+	m.mu.Lock()
+	_, external := m.external[id]
+	m.mu.Unlock()
+	if external {
+		return seedSigner{m, id}, nil
+	}
+
+	if _, err := m.store.WalletSeed(id); errors.Is(err, ErrNotFound) {
+		return nil, signer.ErrNoSigner
+	} else if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.unlocked[id]; !ok {
+		return nil, ErrLocked
+	}
+	return seedSigner{m, id}, nil
+}
+
+// keyIndex returns the index of the key of pk. If the key is not known, the
+// keys of the wallet's addresses with a "keyIndex" in their metadata are
+// derived. The caller must hold the lock.
+func (m *Manager) keyIndex(id wallet.ID, u *unlockedSeed, pk types.PublicKey) (uint64, bool, error) {
+	if index, ok := u.keys[pk]; ok {
+		return index, true, nil
+	}
+	addrs, err := m.wm.Addresses(id)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	for _, addr := range addrs {
+		var meta struct {
+			KeyIndex *uint64 `json:"keyIndex"`
+		}
+		if len(addr.Metadata) == 0 || json.Unmarshal(addr.Metadata, &meta) != nil || meta.KeyIndex == nil {
+			continue
+		}
+		u.keys[u.seed.PublicKey(*meta.KeyIndex)] = *meta.KeyIndex
+	}
+	index, ok := u.keys[pk]
+	return index, ok, nil
+}
+
+// Close stops the backup check and locks every wallet.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id := range m.unlocked {
+		m.lock(id)
+	}
+	for id, u := range m.external {
+		clear(u.entropy[:])
+		delete(m.external, id)
+	}
+	return nil
+}
+
+// seedSigner signs with the seed of an unlocked wallet.
+type seedSigner struct {
+	m  *Manager
+	id wallet.ID
+}
+
+// SignHash implements signer.Signer.
+func (ss seedSigner) SignHash(_ context.Context, pk types.PublicKey, hash types.Hash256) (types.Signature, error) {
+	ss.m.mu.Lock()
+	defer ss.m.mu.Unlock()
+	u, ok := ss.m.signingSeed(ss.id)
+	if !ok {
+		return types.Signature{}, ErrLocked
+	}
+	index, ok, err := ss.m.keyIndex(ss.id, u, pk)
+	if err != nil {
+		return types.Signature{}, err
+	} else if !ok {
+		return types.Signature{}, signer.ErrUnknownKey
+	}
+	return u.seed.PrivateKey(index).SignHash(hash), nil
+}
+
+// NewManager creates a new keystore.
+func NewManager(store Store, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		backupCheckInterval: time.Hour,
+
+		defaultTimeout: 15 * time.Minute,
+		maxTimeout:     24 * time.Hour,
+
+		unlocked:       make(map[wallet.ID]*unlockedSeed),
+		external:       make(map[wallet.ID]*unlockedSeed),
+		challenges:     make(map[types.Hash256]Challenge),
+		backupFailures: make(map[wallet.ID]backupFailure),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.alerter == nil {
+		return m, nil
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "keystore.backups", "alerts on funded wallets without a verified seed backup", m.backupCheckInterval, true, func(context.Context) error {
+			m.checkBackups(time.Now())
+			return nil
+		})
+	}()
+	return m, nil
+}
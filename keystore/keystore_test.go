@@ -0,0 +1,315 @@
+package keystore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct{}
+
+func (chainManager) TipState() consensus.State { return consensus.State{} }
+
+type walletManager struct {
+	store *sqlite.Store
+}
+
+func (wm walletManager) Addresses(id wallet.ID) ([]wallet.Address, error) {
+	return wm.store.WalletAddresses(id)
+}
+
+func (wm walletManager) WalletBalance(id wallet.ID) (wallet.Balance, error) {
+	return wallet.Balance{Siacoins: types.Siacoins(100)}, nil
+}
+
+type alerter struct {
+	mu     sync.Mutex
+	alerts map[types.Hash256]alerts.Alert
+}
+
+func (a *alerter) Register(alert alerts.Alert) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.alerts[alert.ID] = alert
+}
+
+func (a *alerter) Dismiss(ids ...types.Hash256) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, id := range ids {
+		delete(a.alerts, id)
+	}
+}
+
+func (a *alerter) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.alerts)
+}
+
+func TestKeyStore(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	phrase := cwallet.NewSeedPhrase()
+	var entropy [32]byte
+	if err := cwallet.SeedFromPhrase(&entropy, phrase); err != nil {
+		t.Fatal(err)
+	}
+	seed := wallet.NewSeedFromEntropy(&entropy)
+	policy := types.PolicyPublicKey(seed.PublicKey(3))
+	addr := wallet.Address{
+		Address:     policy.Address(),
+		SpendPolicy: &policy,
+		Metadata:    json.RawMessage(`{"keyIndex":3}`),
+	}
+	if _, err := db.AddWalletAddress(w.ID, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	wm := walletManager{db}
+	ks, err := keystore.NewManager(db, wm, keystore.WithLogger(log.Named("keystore")), keystore.WithMaxTimeout(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+	sm := signer.NewManager(db, chainManager{}, wm, signer.WithKeyStore(ks))
+
+	txn := types.V2Transaction{
+		SiacoinInputs: []types.V2SiacoinInput{
+			{
+				Parent:          types.SiacoinElement{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: addr.Address, Value: types.Siacoins(10)}},
+				SatisfiedPolicy: types.SatisfiedPolicy{Policy: policy},
+			},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: types.VoidAddress, Value: types.Siacoins(10)}},
+	}
+
+	// wallets without a seed or signer cannot sign
+	if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, signer.ErrNoSigner) {
+		t.Fatalf("expected ErrNoSigner, got %v", err)
+	} else if _, err := ks.Status(w.ID); !errors.Is(err, keystore.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if err := ks.AddSeed(w.ID+1, phrase, "hunter2"); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected wallet.ErrNotFound, got %v", err)
+	} else if err := ks.AddSeed(w.ID, phrase, ""); err == nil {
+		t.Fatal("expected error for empty passphrase")
+	}
+
+	if err := ks.AddSeed(w.ID, phrase, "hunter2"); err != nil {
+		t.Fatal(err)
+	} else if err := ks.AddSeed(w.ID, phrase, "hunter2"); !errors.Is(err, keystore.ErrExists) {
+		t.Fatalf("expected ErrExists, got %v", err)
+	}
+
+	// a new seed is locked
+	if status, err := ks.Status(w.ID); err != nil {
+		t.Fatal(err)
+	} else if !status.Locked {
+		t.Fatal("expected wallet to be locked")
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, keystore.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	if _, err := ks.Unlock(w.ID, "hunter3", 0); !errors.Is(err, keystore.ErrIncorrectPassphrase) {
+		t.Fatalf("expected ErrIncorrectPassphrase, got %v", err)
+	} else if _, err := ks.Unlock(w.ID, "hunter2", 2*time.Hour); !errors.Is(err, keystore.ErrInvalidTimeout) {
+		t.Fatalf("expected ErrInvalidTimeout, got %v", err)
+	}
+	status, err := ks.Unlock(w.ID, "hunter2", 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if status.Locked || time.Until(status.UnlockedUntil) < 14*time.Minute {
+		t.Fatalf("expected wallet to be unlocked for the default timeout, got %+v", status)
+	}
+
+	signed, err := sm.SignV2Transaction(context.Background(), w.ID, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigHash := consensus.State{}.InputSigHash(signed)
+	if sigs := signed.SiacoinInputs[0].SatisfiedPolicy.Signatures; len(sigs) != 1 || !seed.PublicKey(3).VerifyHash(sigHash, sigs[0]) {
+		t.Fatalf("expected input to be signed by key 3, got %v", sigs)
+	}
+
+	// locking clears the seed
+	if err := ks.Lock(w.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, keystore.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+
+	// the wallet locks itself after the timeout
+	if _, err := ks.Unlock(w.ID, "hunter2", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		if status, err := ks.Status(w.ID); err != nil {
+			t.Fatal(err)
+		} else if status.Locked {
+			break
+		} else if i == 100 {
+			t.Fatal("expected wallet to lock automatically")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := ks.RemoveSeed(w.ID); err != nil {
+		t.Fatal(err)
+	} else if err := ks.Lock(w.ID); !errors.Is(err, keystore.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, signer.ErrNoSigner) {
+		t.Fatalf("expected ErrNoSigner, got %v", err)
+	}
+
+	// an external seed signs without being stored or unlocked
+	if err := ks.SetExternalSeed(w.ID, phrase); err != nil {
+		t.Fatal(err)
+	} else if status, err := ks.Status(w.ID); err != nil {
+		t.Fatal(err)
+	} else if !status.External || status.Locked {
+		t.Fatalf("expected unlocked external seed, got %+v", status)
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupVerification(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	phrase := cwallet.NewSeedPhrase()
+	words := strings.Fields(phrase)
+
+	a := &alerter{alerts: make(map[types.Hash256]alerts.Alert)}
+	ks, err := keystore.NewManager(db, walletManager{db}, keystore.WithLogger(log.Named("keystore")), keystore.WithBackupAlerts(a, types.Siacoins(50)), keystore.WithBackupCheckInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ks.Close()
+
+	if err := ks.AddSeed(w.ID, phrase, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the wallet holds more than the threshold without a verified backup
+	for i := 0; a.count() != 1; i++ {
+		if i == 100 {
+			t.Fatal("expected unverified backup alert")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := ks.BackupChallenge(w.ID, len(words)+1); !errors.Is(err, keystore.ErrInvalidChallenge) {
+		t.Fatalf("expected ErrInvalidChallenge, got %v", err)
+	} else if _, err := ks.BackupChallenge(w.ID, 2); !errors.Is(err, keystore.ErrInvalidChallenge) {
+		t.Fatalf("expected ErrInvalidChallenge for fewer than 3 words, got %v", err)
+	}
+	c, err := ks.BackupChallenge(w.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(c.Positions) != 3 {
+		t.Fatalf("expected 3 positions, got %v", c.Positions)
+	}
+	answer := func(c keystore.Challenge) []string {
+		var answer []string
+		for _, pos := range c.Positions {
+			answer = append(answer, words[pos-1])
+		}
+		return answer
+	}
+
+	// the wallet must be unlocked to verify the words
+	if _, err := ks.VerifyBackup(w.ID, c.ID, answer(c)); !errors.Is(err, keystore.ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	} else if _, err := ks.Unlock(w.ID, "hunter2", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// a wrong answer consumes the challenge
+	wrong := answer(c)
+	wrong[0] = "zoo"
+	if _, err := ks.VerifyBackup(w.ID, c.ID, wrong); !errors.Is(err, keystore.ErrBackupMismatch) {
+		t.Fatalf("expected ErrBackupMismatch, got %v", err)
+	} else if _, err := ks.VerifyBackup(w.ID, c.ID, answer(c)); !errors.Is(err, keystore.ErrChallengeNotFound) {
+		t.Fatalf("expected ErrChallengeNotFound, got %v", err)
+	}
+
+	// creating a challenge replaces the wallet's previous challenge
+	prev, err := ks.BackupChallenge(w.ID, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = ks.BackupChallenge(w.ID, 4)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := ks.VerifyBackup(w.ID, prev.ID, answer(prev)); !errors.Is(err, keystore.ErrChallengeNotFound) {
+		t.Fatalf("expected ErrChallengeNotFound, got %v", err)
+	}
+	status, err := ks.VerifyBackup(w.ID, c.ID, answer(c))
+	if err != nil {
+		t.Fatal(err)
+	} else if status.BackupVerified.IsZero() {
+		t.Fatal("expected backup to be verified")
+	} else if a.count() != 0 {
+		t.Fatal("expected alert to be dismissed")
+	}
+
+	// the verification is persisted and the alert is not raised again
+	time.Sleep(50 * time.Millisecond)
+	if status, err := ks.Status(w.ID); err != nil {
+		t.Fatal(err)
+	} else if status.BackupVerified.IsZero() {
+		t.Fatal("expected backup verification to be stored")
+	} else if a.count() != 0 {
+		t.Fatal("expected no alerts after verification")
+	}
+
+	// too many wrong answers lock out verification
+	for i := 0; i < 3; i++ {
+		c, err := ks.BackupChallenge(w.ID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrong := answer(c)
+		wrong[0] = "zoo"
+		if _, err := ks.VerifyBackup(w.ID, c.ID, wrong); !errors.Is(err, keystore.ErrBackupMismatch) {
+			t.Fatalf("expected ErrBackupMismatch, got %v", err)
+		}
+	}
+	if _, err := ks.BackupChallenge(w.ID, 0); !errors.Is(err, keystore.ErrBackupLockedOut) {
+		t.Fatalf("expected ErrBackupLockedOut, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package keystore
+
+import (
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithDefaultTimeout sets how long a wallet stays unlocked when no timeout
+// is given. The default is fifteen minutes.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.defaultTimeout = d
+		}
+	}
+}
+
+// WithMaxTimeout sets the longest timeout a wallet can be unlocked for. The
+// default is 24 hours.
+func WithMaxTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.maxTimeout = d
+		}
+	}
+}
+
+// WithBackupAlerts registers an alert for each wallet with a stored seed
+// whose backup was never verified once its confirmed siacoin balance reaches
+// threshold. A zero threshold alerts for every such wallet.
+func WithBackupAlerts(a Alerter, threshold types.Currency) Option {
+	return func(m *Manager) {
+		m.alerter = a
+		m.backupAlertThreshold = threshold
+	}
+}
+
+// WithBackupCheckInterval sets how often wallets are checked for unverified
+// backups. The default is one hour.
+func WithBackupCheckInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.backupCheckInterval = d
+		}
+	}
+}
+
+// WithScheduler registers the check for unverified seed backups as the
+// "keystore.backups" job.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
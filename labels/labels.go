@@ -0,0 +1,211 @@
+// Package labels provides localized display strings for the enumerations
+// used by the API, such as event types and alert severities, so that clients
+// do not need to hardcode English strings.
+package labels
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/tags"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// DefaultLocale is the locale used when no supported locale is requested.
+// Every label has a display string in the default locale.
+const DefaultLocale = "en"
+
+type (
+	// A Label is an enumeration value and its display string.
+	Label struct {
+		Value string `json:"value"`
+		Label string `json:"label"`
+	}
+
+	// An Enumeration is a named set of values used by the API. Names and
+	// values are stable and can be used as keys by clients.
+	Enumeration struct {
+		Name   string  `json:"name"`
+		Values []Label `json:"values"`
+	}
+)
+
+// enumerations are the values of each enumeration, in display order.
+var enumerations = []struct {
+	name   string
+	values []string
+}{
+	{"eventType", []string{
+		wallet.EventTypeMinerPayout,
+		wallet.EventTypeFoundationSubsidy,
+		wallet.EventTypeSiafundClaim,
+		wallet.EventTypeV1Transaction,
+		wallet.EventTypeV1ContractResolution,
+		wallet.EventTypeV2Transaction,
+		wallet.EventTypeV2ContractResolution,
+	}},
+	{"counterpartyRole", []string{
+		wallet.CounterpartySender,
+		wallet.CounterpartyRecipient,
+	}},
+	{"tagCategory", []string{
+		tags.CategoryExchange,
+		tags.CategoryFoundation,
+		tags.CategoryColdStorage,
+	}},
+	{"tagSource", []string{
+		tags.SourceManual,
+		tags.SourceFeed,
+	}},
+	{"alertSeverity", []string{
+		alerts.SeverityInfo.String(),
+		alerts.SeverityWarning.String(),
+		alerts.SeverityError.String(),
+		alerts.SeverityCritical.String(),
+	}},
+	{"indexMode", []string{
+		wallet.IndexModePersonal.String(),
+		wallet.IndexModeFull.String(),
+		wallet.IndexModeNone.String(),
+	}},
+	{"feeStrategy", []string{
+		wallet.FeeStrategyRecommended,
+		wallet.FeeStrategyFixed,
+		wallet.FeeStrategyMultiplier,
+		wallet.FeeStrategyTarget,
+	}},
+	{"feePeriod", []string{
+		wallet.FeePeriodDay,
+		wallet.FeePeriodWeek,
+		wallet.FeePeriodMonth,
+	}},
+	{"proposalStatus", []string{
+		wallet.ProposalStatusPending,
+		wallet.ProposalStatusBroadcast,
+		wallet.ProposalStatusCancelled,
+	}},
+	{"approvalStatus", []string{
+		treasury.StatusPending,
+		treasury.StatusApproved,
+		treasury.StatusRejected,
+	}},
+	{"escrowStatus", []string{
+		escrow.StatusPending,
+		escrow.StatusFunded,
+		escrow.StatusReleased,
+		escrow.StatusRefunded,
+	}},
+}
+
+//go:embed locales/*.json
+var localeFS embed.FS
+
+// catalogs maps locales to the display strings of each enumeration's values.
+var catalogs = func() map[string]map[string]map[string]string {
+	entries, err := localeFS.ReadDir("locales")
+	if err != nil {
+		panic(err) // should never happen
+	}
+	catalogs := make(map[string]map[string]map[string]string)
+	for _, e := range entries {
+		buf, err := localeFS.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err) // should never happen
+		}
+		var catalog map[string]map[string]string
+		if err := json.Unmarshal(buf, &catalog); err != nil {
+			panic(fmt.Sprintf("invalid locale %q: %v", e.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(e.Name(), ".json")] = catalog
+	}
+	return catalogs
+}()
+
+// Locales returns the supported locales, sorted.
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// lookup returns the display string of an enumeration value in a locale,
+// falling back to the default locale and then to the value itself.
+func lookup(locale, name, value string) string {
+	if s, ok := catalogs[locale][name][value]; ok {
+		return s
+	} else if s, ok := catalogs[DefaultLocale][name][value]; ok {
+		return s
+	}
+	return value
+}
+
+// Enumerations returns every enumeration with display strings in the given
+// locale. Unsupported locales use the default locale.
+func Enumerations(locale string) []Enumeration {
+	enums := make([]Enumeration, 0, len(enumerations))
+	for _, e := range enumerations {
+		enum := Enumeration{Name: e.name, Values: make([]Label, 0, len(e.values))}
+		for _, v := range e.values {
+			enum.Values = append(enum.Values, Label{Value: v, Label: lookup(locale, e.name, v)})
+		}
+		enums = append(enums, enum)
+	}
+	return enums
+}
+
+// Negotiate returns the supported locale that best matches an
+// Accept-Language header, e.g. "de-CH, de;q=0.9, en;q=0.8". A language range
+// matches a locale if it is the locale or one of its subtags, so "de-CH"
+// matches "de". If no locale matches, DefaultLocale is returned.
+func Negotiate(acceptLanguage string) string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = f
+		}
+		if tag == "" || q <= 0 {
+			continue
+		}
+		ranges = append(ranges, languageRange{strings.ToLower(tag), q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		if r.tag == "*" {
+			return DefaultLocale
+		}
+		// try the full tag, then remove subtags from the end
+		for tag := r.tag; tag != ""; {
+			if _, ok := catalogs[tag]; ok {
+				return tag
+			}
+			i := strings.LastIndexByte(tag, '-')
+			if i == -1 {
+				break
+			}
+			tag = tag[:i]
+		}
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,72 @@
+package labels
+
+import "testing"
+
+func TestCatalogs(t *testing.T) {
+	if _, ok := catalogs[DefaultLocale]; !ok {
+		t.Fatalf("missing default locale %q", DefaultLocale)
+	}
+
+	// every locale must translate every value, and nothing else
+	for locale, catalog := range catalogs {
+		for _, e := range enumerations {
+			for _, v := range e.values {
+				if s := catalog[e.name][v]; s == "" {
+					t.Errorf("%s: missing label for %s.%s", locale, e.name, v)
+				}
+			}
+		}
+		for name, values := range catalog {
+			for v := range values {
+				var found bool
+				for _, e := range enumerations {
+					for _, ev := range e.values {
+						found = found || (e.name == name && ev == v)
+					}
+				}
+				if !found {
+					t.Errorf("%s: unknown label %s.%s", locale, name, v)
+				}
+			}
+		}
+	}
+}
+
+func TestEnumerations(t *testing.T) {
+	enums := Enumerations("de")
+	if len(enums) != len(enumerations) {
+		t.Fatalf("expected %d enumerations, got %d", len(enumerations), len(enums))
+	} else if enums[0].Name != "eventType" || enums[0].Values[0].Value != "miner" || enums[0].Values[0].Label != "Miner-Auszahlung" {
+		t.Fatalf("unexpected enumeration %+v", enums[0])
+	}
+
+	// unsupported locales fall back to the default locale
+	if enums := Enumerations("xx"); enums[0].Values[0].Label != "Miner payout" {
+		t.Fatalf("expected the default label, got %q", enums[0].Values[0].Label)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-CH", "de"},
+		{"FR-ca", "fr"},
+		{"zh-Hans-CN", "zh"},
+		{"xx, es;q=0.5", "es"},
+		{"en;q=0.5, ja;q=0.8", "ja"},
+		{"de;q=0, fr", "fr"},
+		{"de;q=0", "en"},
+		{"xx, *;q=0.1, fr;q=0.01", "en"},
+		{"xx-YY", "en"},
+		{"de;q=abc, es", "es"},
+	}
+	for _, test := range tests {
+		if got := Negotiate(test.header); got != test.want {
+			t.Errorf("Negotiate(%q): expected %q, got %q", test.header, test.want, got)
+		}
+	}
+}
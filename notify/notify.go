@@ -0,0 +1,140 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/walletd/webhooks"
+)
+
+// Format returns a human-readable subject and body for an event.
+func Format(ev webhooks.Event) (subject, body string) {
+	switch data := ev.Data.(type) {
+	case alerts.Alert:
+		return fmt.Sprintf("[walletd] %s alert", data.Severity), data.Message
+	case wallet.EventNotification:
+		e := data.Event
+		inflow, outflow := e.SiacoinInflow(), e.SiacoinOutflow()
+		switch {
+		case inflow.Cmp(outflow) > 0:
+			subject = fmt.Sprintf("[walletd] wallet %d received %v", data.WalletID, inflow.Sub(outflow))
+		case outflow.Cmp(inflow) > 0:
+			subject = fmt.Sprintf("[walletd] wallet %d sent %v", data.WalletID, outflow.Sub(inflow))
+		default:
+			subject = fmt.Sprintf("[walletd] new %s event in wallet %d", e.Type, data.WalletID)
+		}
+		return subject, fmt.Sprintf("Event %v of type %s was confirmed at height %d.", e.ID, e.Type, e.Index.Height)
+	case wallet.BalanceAlarmNotification:
+		a := data.Alarm
+		target := fmt.Sprintf("wallet %d", a.WalletID)
+		if a.Address != nil {
+			target = fmt.Sprintf("address %v of wallet %d", *a.Address, a.WalletID)
+		}
+		switch a.State {
+		case wallet.AlarmStateLow:
+			return fmt.Sprintf("[walletd] low balance in wallet %d", a.WalletID), fmt.Sprintf("The balance of %s is %v, below %v.", target, data.Balance, *a.Low)
+		case wallet.AlarmStateHigh:
+			return fmt.Sprintf("[walletd] high balance in wallet %d", a.WalletID), fmt.Sprintf("The balance of %s is %v, above %v.", target, data.Balance, *a.High)
+		default:
+			return fmt.Sprintf("[walletd] balance of wallet %d is back in range", a.WalletID), fmt.Sprintf("The balance of %s is %v.", target, data.Balance)
+		}
+	case treasury.PendingTransaction:
+		subject = fmt.Sprintf("[walletd] transaction set %d is %s", data.ID, data.Status)
+		return subject, fmt.Sprintf("Transaction set %d sending %v from wallet %d was submitted by %s and is %s.", data.ID, data.Amount, data.WalletID, data.SubmittedBy, data.Status)
+	case digest.Digest:
+		subject = fmt.Sprintf("[walletd] %s digest for wallet %q", data.Frequency, data.WalletName)
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Activity of wallet %d from %s to %s:\n\n", data.WalletID, data.Start.Format("2006-01-02"), data.End.Format("2006-01-02"))
+		fmt.Fprintf(&sb, "Received: %v\nSent: %v\nFees: %v\nEvents: %d\nNew addresses used: %d\nBalance: %v\n", data.Received, data.Sent, data.Fees, data.Events, len(data.NewAddresses), data.Balance)
+		if len(data.Alerts) > 0 {
+			sb.WriteString("\nAlerts:\n")
+			for _, a := range data.Alerts {
+				fmt.Fprintf(&sb, "- [%s] %s\n", a.Severity, a.Message)
+			}
+		}
+		return subject, sb.String()
+	default:
+		buf, err := json.MarshalIndent(ev.Data, "", "  ")
+		if err != nil {
+			buf = []byte(fmt.Sprint(ev.Data))
+		}
+		return fmt.Sprintf("[walletd] %s/%s", ev.Scope, ev.Event), string(buf)
+	}
+}
+
+// postJSON posts v as JSON to url.
+func postJSON(ctx context.Context, client *http.Client, url string, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// A SlackChannel sends events to a Slack incoming webhook.
+type SlackChannel struct {
+	url    string
+	client *http.Client
+}
+
+// Name implements webhooks.Channel.
+func (sc *SlackChannel) Name() string { return "slack" }
+
+// Send implements webhooks.Channel.
+func (sc *SlackChannel) Send(ctx context.Context, ev webhooks.Event) error {
+	subject, body := Format(ev)
+	return postJSON(ctx, sc.client, sc.url, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", subject, body),
+	})
+}
+
+// NewSlackChannel returns a channel that sends events to a Slack incoming
+// webhook URL.
+func NewSlackChannel(url string) *SlackChannel {
+	return &SlackChannel{url: url, client: &http.Client{}}
+}
+
+// A DiscordChannel sends events to a Discord webhook.
+type DiscordChannel struct {
+	url    string
+	client *http.Client
+}
+
+// Name implements webhooks.Channel.
+func (dc *DiscordChannel) Name() string { return "discord" }
+
+// Send implements webhooks.Channel.
+func (dc *DiscordChannel) Send(ctx context.Context, ev webhooks.Event) error {
+	subject, body := Format(ev)
+	return postJSON(ctx, dc.client, dc.url, map[string]string{
+		"content": fmt.Sprintf("**%s**\n%s", subject, body),
+	})
+}
+
+// NewDiscordChannel returns a channel that sends events to a Discord webhook
+// URL.
+func NewDiscordChannel(url string) *DiscordChannel {
+	return &DiscordChannel{url: url, client: &http.Client{}}
+}
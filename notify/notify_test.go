@@ -0,0 +1,102 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/notify"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/webhooks"
+)
+
+func TestChatChannels(t *testing.T) {
+	received := make(chan map[string]string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- msg
+	}))
+	defer srv.Close()
+
+	ev := webhooks.Event{
+		Scope: alerts.ScopeAlerts,
+		Event: "register",
+		Data: alerts.Alert{
+			Severity: alerts.SeverityCritical,
+			Message:  "balance dropped",
+		},
+		Timestamp: time.Now(),
+	}
+
+	if err := notify.NewSlackChannel(srv.URL).Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	} else if msg := <-received; msg["text"] != "*[walletd] critical alert*\nbalance dropped" {
+		t.Fatalf("unexpected slack message %q", msg["text"])
+	}
+
+	if err := notify.NewDiscordChannel(srv.URL).Send(context.Background(), ev); err != nil {
+		t.Fatal(err)
+	} else if msg := <-received; msg["content"] != "**[walletd] critical alert**\nbalance dropped" {
+		t.Fatalf("unexpected discord message %q", msg["content"])
+	}
+}
+
+func TestFormat(t *testing.T) {
+	subject, body := notify.Format(webhooks.Event{
+		Scope: treasury.ScopeApprovals,
+		Event: "pending",
+		Data: treasury.PendingTransaction{
+			ID:          3,
+			WalletID:    1,
+			Amount:      types.Siacoins(10),
+			Status:      treasury.StatusPending,
+			SubmittedBy: "key:a",
+		},
+	})
+	if subject != "[walletd] transaction set 3 is pending" {
+		t.Fatalf("unexpected subject %q", subject)
+	} else if !strings.Contains(body, "submitted by key:a") {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	subject, body = notify.Format(webhooks.Event{
+		Scope: digest.ScopeDigests,
+		Event: digest.FrequencyWeekly,
+		Data: digest.Digest{
+			WalletID:   2,
+			WalletName: "savings",
+			Frequency:  digest.FrequencyWeekly,
+			Received:   types.Siacoins(5),
+			Alerts:     []alerts.Alert{{Severity: alerts.SeverityWarning, Message: "large outflow"}},
+		},
+	})
+	if subject != `[walletd] weekly digest for wallet "savings"` {
+		t.Fatalf("unexpected subject %q", subject)
+	} else if !strings.Contains(body, "Received: "+types.Siacoins(5).String()) || !strings.Contains(body, "large outflow") {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	subject, body = notify.Format(webhooks.Event{Scope: "foo", Event: "bar", Data: map[string]int{"baz": 1}})
+	if subject != "[walletd] foo/bar" {
+		t.Fatalf("unexpected subject %q", subject)
+	} else if !strings.Contains(body, `"baz": 1`) {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	if _, err := notify.NewSMTPChannel("localhost", "", "", "walletd@example.com", []string{"ops@example.com"}); err == nil {
+		t.Fatal("expected error for address without port")
+	} else if _, err := notify.NewSMTPChannel("localhost:25", "", "", "walletd@example.com", nil); err == nil {
+		t.Fatal("expected error for missing recipients")
+	}
+}
@@ -0,0 +1,104 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"go.thebigfile.com/walletd/webhooks"
+)
+
+// An SMTPChannel sends events by email.
+type SMTPChannel struct {
+	addr     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// Name implements webhooks.Channel.
+func (sc *SMTPChannel) Name() string { return "smtp" }
+
+// Send implements webhooks.Channel.
+func (sc *SMTPChannel) Send(ctx context.Context, ev webhooks.Event) error {
+	host, _, err := net.SplitHostPort(sc.addr)
+	if err != nil {
+		return fmt.Errorf("failed to parse address: %w", err)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", sc.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if sc.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", sc.username, sc.password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := c.Mail(sc.from); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, to := range sc.to {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to add recipient %q: %w", to, err)
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	subject, body := Format(ev)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		sc.from, strings.Join(sc.to, ", "), subject, ev.Timestamp.Format(time.RFC1123Z), body)
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	} else if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return c.Quit()
+}
+
+// NewSMTPChannel returns a channel that sends events by email through the
+// SMTP server at addr. STARTTLS is used if the server supports it, and
+// authentication is skipped if username is empty.
+func NewSMTPChannel(addr, username, password, from string, to []string) (*SMTPChannel, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid SMTP address: %w", err)
+	} else if from == "" {
+		return nil, errors.New("sender address is required")
+	} else if len(to) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+	return &SMTPChannel{
+		addr:     addr,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}, nil
+}
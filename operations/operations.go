@@ -0,0 +1,286 @@
+// Package operations runs long-running tasks, such as rescans and payouts, in
+// the background and tracks their progress, so that they can be inspected
+// and canceled after the request that started them returns.
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+// Statuses of an operation.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Types of operations.
+const (
+	TypeRescan          = "rescan"
+	TypePayout          = "payout"
+	TypeRotationSweep   = "rotationSweep"
+	TypeForwardingSweep = "forwardingSweep"
+)
+
+const (
+	// defaultRetention is how long finished operations are kept by default.
+	defaultRetention = 24 * time.Hour
+	// maxFinished is the maximum number of finished operations that are
+	// kept, regardless of their age.
+	maxFinished = 1000
+)
+
+var (
+	// ErrNotFound is returned when an operation does not exist.
+	ErrNotFound = errors.New("operation not found")
+	// ErrFinished is returned when canceling an operation that has already
+	// finished.
+	ErrFinished = errors.New("operation already finished")
+	// ErrRunning is returned when starting an exclusive operation while
+	// another operation of the same type is running.
+	ErrRunning = errors.New("operation already running")
+)
+
+type (
+	// Progress is the progress of an operation. Total is zero if the amount
+	// of work is unknown.
+	Progress struct {
+		Done  uint64 `json:"done"`
+		Total uint64 `json:"total"`
+	}
+
+	// An Operation is the state of a long-running task.
+	Operation struct {
+		ID       types.Hash256 `json:"id"`
+		Type     string        `json:"type"`
+		Status   string        `json:"status"`
+		Progress Progress      `json:"progress"`
+		// Result is the JSON-encoded result of a completed operation.
+		Result json.RawMessage `json:"result,omitempty"`
+		Error  string          `json:"error,omitempty"`
+
+		StartTime time.Time `json:"startTime"`
+		// EndTime is zero while the operation is running.
+		EndTime time.Time `json:"endTime"`
+	}
+
+	// A ProgressFunc reports the progress of an operation.
+	ProgressFunc func(done, total uint64)
+
+	// A Func is the work of an operation. Its result is JSON-encoded and
+	// stored with the operation. It should return promptly when ctx is
+	// canceled.
+	Func func(ctx context.Context, progress ProgressFunc) (any, error)
+
+	// operation is a tracked operation.
+	operation struct {
+		state  Operation
+		cancel context.CancelFunc
+	}
+
+	// A Manager runs operations and records their state. Operations are not
+	// persisted and are canceled when the manager is closed.
+	Manager struct {
+		log       *zap.Logger
+		retention time.Duration
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		wg     sync.WaitGroup
+
+		mu         sync.Mutex
+		operations map[types.Hash256]*operation
+	}
+)
+
+// Finished returns true if the operation is no longer running.
+func (op Operation) Finished() bool {
+	return op.Status != StatusRunning
+}
+
+// prune removes finished operations that are older than the retention
+// period or exceed the maximum number of finished operations. It must be
+// called with the lock held.
+func (m *Manager) prune() {
+	var finished []*operation
+	for id, op := range m.operations {
+		if !op.state.Finished() {
+			continue
+		} else if time.Since(op.state.EndTime) > m.retention {
+			delete(m.operations, id)
+			continue
+		}
+		finished = append(finished, op)
+	}
+	if len(finished) <= maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].state.EndTime.After(finished[j].state.EndTime) })
+	for _, op := range finished[maxFinished:] {
+		delete(m.operations, op.state.ID)
+	}
+}
+
+// run runs an operation and records its result.
+func (m *Manager) run(ctx context.Context, op *operation, fn Func) {
+	defer m.wg.Done()
+	defer op.cancel()
+
+	log := m.log.With(zap.Stringer("id", op.state.ID), zap.String("type", op.state.Type))
+	progress := func(done, total uint64) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		op.state.Progress = Progress{Done: done, Total: total}
+	}
+	result, err := fn(ctx, progress)
+
+	var buf []byte
+	if err == nil && result != nil {
+		buf, err = json.Marshal(result)
+		if err != nil {
+			err = fmt.Errorf("failed to encode result: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op.state.EndTime = time.Now()
+	switch {
+	case err == nil:
+		op.state.Status = StatusCompleted
+		op.state.Result = buf
+		log.Debug("operation completed", zap.Duration("elapsed", op.state.EndTime.Sub(op.state.StartTime)))
+	case errors.Is(err, context.Canceled):
+		op.state.Status = StatusCanceled
+		op.state.Error = err.Error()
+		log.Info("operation canceled")
+	default:
+		op.state.Status = StatusFailed
+		op.state.Error = err.Error()
+		log.Warn("operation failed", zap.Error(err))
+	}
+}
+
+// start starts an operation. If exclusive is true, ErrRunning is returned if
+// an operation of the same type is running.
+func (m *Manager) start(typ string, exclusive bool, fn Func) (Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.ctx.Err(); err != nil {
+		return Operation{}, errors.New("operation manager is closed")
+	}
+	if exclusive {
+		for _, op := range m.operations {
+			if op.state.Type == typ && !op.state.Finished() {
+				return Operation{}, fmt.Errorf("%w: %v", ErrRunning, op.state.ID)
+			}
+		}
+	}
+	m.prune()
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	op := &operation{
+		state: Operation{
+			ID:        frand.Entropy256(),
+			Type:      typ,
+			Status:    StatusRunning,
+			StartTime: time.Now(),
+		},
+		cancel: cancel,
+	}
+	m.operations[op.state.ID] = op
+	m.wg.Add(1)
+	go m.run(ctx, op, fn)
+	return op.state, nil
+}
+
+// Start runs fn in the background as an operation of the given type and
+// returns its initial state.
+func (m *Manager) Start(typ string, fn Func) (Operation, error) {
+	return m.start(typ, false, fn)
+}
+
+// StartExclusive is like Start, but returns ErrRunning if an operation of the
+// same type is already running.
+func (m *Manager) StartExclusive(typ string, fn Func) (Operation, error) {
+	return m.start(typ, true, fn)
+}
+
+// Operation returns the state of an operation.
+func (m *Manager) Operation(id types.Hash256) (Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op, ok := m.operations[id]
+	if !ok {
+		return Operation{}, ErrNotFound
+	}
+	return op.state, nil
+}
+
+// Operations returns the state of every operation, newest first. If typ is
+// not empty, only operations of that type are returned.
+func (m *Manager) Operations(typ string) []Operation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ops := make([]Operation, 0, len(m.operations))
+	for _, op := range m.operations {
+		if typ == "" || op.state.Type == typ {
+			ops = append(ops, op.state)
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].StartTime.After(ops[j].StartTime) })
+	return ops
+}
+
+// Cancel cancels a running operation. The operation's status changes to
+// StatusCanceled once its work returns.
+func (m *Manager) Cancel(id types.Hash256) (Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	op, ok := m.operations[id]
+	if !ok {
+		return Operation{}, ErrNotFound
+	} else if op.state.Finished() {
+		return op.state, ErrFinished
+	}
+	op.cancel()
+	return op.state, nil
+}
+
+// Close cancels every running operation and waits for them to return.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	m.cancel()
+	m.mu.Unlock()
+	m.wg.Wait()
+	return nil
+}
+
+// NewManager returns a new Manager.
+func NewManager(opts ...Option) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		log:       zap.NewNop(),
+		retention: defaultRetention,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		operations: make(map[types.Hash256]*operation),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
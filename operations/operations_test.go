@@ -0,0 +1,149 @@
+package operations_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/operations"
+)
+
+// waitFor polls fn until it returns true or the timeout elapses.
+func waitFor(t *testing.T, fn func() bool) {
+	t.Helper()
+	for i := 0; i < 500; i++ {
+		if fn() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out")
+}
+
+func TestOperations(t *testing.T) {
+	m := operations.NewManager()
+	defer m.Close()
+
+	// an operation reports progress and stores its result
+	proceed := make(chan struct{})
+	op, err := m.Start(operations.TypePayout, func(_ context.Context, progress operations.ProgressFunc) (any, error) {
+		progress(1, 2)
+		<-proceed
+		return map[string]int{"paid": 2}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if op.Status != operations.StatusRunning || op.Type != operations.TypePayout {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+	waitFor(t, func() bool {
+		op, _ := m.Operation(op.ID)
+		return op.Progress == operations.Progress{Done: 1, Total: 2}
+	})
+	close(proceed)
+	waitFor(t, func() bool {
+		op, _ := m.Operation(op.ID)
+		return op.Finished()
+	})
+	op, err = m.Operation(op.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if op.Status != operations.StatusCompleted || string(op.Result) != `{"paid":2}` || op.EndTime.IsZero() {
+		t.Fatalf("unexpected operation %+v", op)
+	} else if _, err := m.Cancel(op.ID); !errors.Is(err, operations.ErrFinished) {
+		t.Fatalf("expected ErrFinished, got %v", err)
+	}
+
+	// a failed operation records its error
+	failed, err := m.Start(operations.TypePayout, func(context.Context, operations.ProgressFunc) (any, error) {
+		return nil, errors.New("insufficient balance")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		op, _ := m.Operation(failed.ID)
+		return op.Finished()
+	})
+	if op, _ := m.Operation(failed.ID); op.Status != operations.StatusFailed || op.Error != "insufficient balance" {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+
+	// exclusive operations cannot run concurrently
+	scan := func(ctx context.Context, _ operations.ProgressFunc) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	rescan, err := m.StartExclusive(operations.TypeRescan, scan)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := m.StartExclusive(operations.TypeRescan, scan); !errors.Is(err, operations.ErrRunning) {
+		t.Fatalf("expected ErrRunning, got %v", err)
+	}
+
+	// canceling an operation cancels its context
+	if _, err := m.Cancel(rescan.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		op, _ := m.Operation(rescan.ID)
+		return op.Finished()
+	})
+	if op, _ := m.Operation(rescan.ID); op.Status != operations.StatusCanceled {
+		t.Fatalf("expected canceled operation, got %+v", op)
+	} else if _, err := m.StartExclusive(operations.TypeRescan, scan); err != nil {
+		t.Fatal(err)
+	}
+
+	if ops := m.Operations(operations.TypePayout); len(ops) != 2 || ops[0].ID != failed.ID {
+		t.Fatalf("expected 2 payouts, newest first, got %+v", ops)
+	} else if ops := m.Operations(""); len(ops) != 4 {
+		t.Fatalf("expected 4 operations, got %d", len(ops))
+	} else if _, err := m.Operation(types.Hash256{1}); !errors.Is(err, operations.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// closing the manager cancels running operations
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range m.Operations(operations.TypeRescan) {
+		if !op.Finished() {
+			t.Fatalf("expected operation %v to be finished", op.ID)
+		}
+	}
+	if _, err := m.Start(operations.TypePayout, scan); err == nil {
+		t.Fatal("expected error starting operation on closed manager")
+	}
+
+	// results are valid JSON
+	var result map[string]int
+	if err := json.Unmarshal(op.Result, &result); err != nil || result["paid"] != 2 {
+		t.Fatalf("unexpected result %s", op.Result)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	m := operations.NewManager(operations.WithRetention(time.Millisecond))
+	defer m.Close()
+
+	op, err := m.Start(operations.TypePayout, func(context.Context, operations.ProgressFunc) (any, error) { return nil, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		op, _ := m.Operation(op.ID)
+		return op.Finished()
+	})
+	time.Sleep(5 * time.Millisecond)
+
+	// finished operations are pruned when the next operation starts
+	if _, err := m.Start(operations.TypePayout, func(context.Context, operations.ProgressFunc) (any, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	} else if _, err := m.Operation(op.ID); !errors.Is(err, operations.ErrNotFound) {
+		t.Fatalf("expected pruned operation, got %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package operations
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithRetention sets how long finished operations are kept. The default is
+// 24 hours.
+func WithRetention(d time.Duration) Option {
+	return func(m *Manager) {
+		m.retention = d
+	}
+}
@@ -0,0 +1,67 @@
+package payments
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send batch events to
+// webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithInterval sets how often queues are checked. The default is ten
+// seconds.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.interval = d
+	}
+}
+
+// WithMaxDelay sets how long a payment can wait in the queue before it is
+// flushed. The default is ten minutes.
+func WithMaxDelay(d time.Duration) Option {
+	return func(m *Manager) {
+		m.maxDelay = d
+	}
+}
+
+// WithMaxSize sets the maximum number of payments in a batch. A queue is
+// flushed as soon as it reaches this size. The default is 100.
+func WithMaxSize(n int) Option {
+	return func(m *Manager) {
+		m.maxSize = n
+	}
+}
+
+// WithReserveDuration sets how long a batch's inputs are reserved. The batch
+// must be signed and broadcast within this time. The default is one hour.
+func WithReserveDuration(d time.Duration) Option {
+	return func(m *Manager) {
+		m.reserveDuration = d
+	}
+}
+
+// WithScheduler registers the queue flush as the "payments" job, so that
+// queued payments can be batched before the next interval. A paused job
+// leaves payments queued.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
@@ -0,0 +1,554 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ScopePayments is the webhook scope of payment batch events.
+const ScopePayments = "payments"
+
+const (
+	// signedInputSize estimates the size of the unlock conditions and
+	// signature the client adds to each input of a v1 batch before
+	// broadcasting.
+	signedInputSize = 250
+	// signatureSize is the size of the signature the client adds to each
+	// input of a v2 batch before broadcasting.
+	signatureSize = 64
+	// feeOverhead estimates the size of the change output and miner fee,
+	// which are added after the fee is estimated.
+	feeOverhead = 100
+	// maxRetryDelay caps how long a queue that could not be funded waits
+	// before it is flushed again.
+	maxRetryDelay = time.Hour
+)
+
+var (
+	// ErrNotFound is returned when a queued payment is not found.
+	ErrNotFound = errors.New("payment not found")
+	// ErrEmptyQueue is returned when flushing a wallet with no queued
+	// payments.
+	ErrEmptyQueue = errors.New("no queued payments")
+	// ErrInsufficientBalance is returned when a wallet cannot fund a batch.
+	ErrInsufficientBalance = errors.New("insufficient balance")
+)
+
+type (
+	// A Payment is a request to send siacoins from a wallet. Payments are
+	// queued until they are flushed into a batch.
+	Payment struct {
+		ID         int64          `json:"id"`
+		WalletID   wallet.ID      `json:"walletID"`
+		Address    types.Address  `json:"address"`
+		Value      types.Currency `json:"value"`
+		BatchID    int64          `json:"batchID,omitempty"`
+		DateQueued time.Time      `json:"dateQueued"`
+	}
+
+	// A Batch is a funded, unsigned transaction paying a set of queued
+	// payments. The inputs in ToSign must be signed by the client before
+	// the transaction is broadcast. Batches funded before the v2 require
+	// height use Transaction; later batches use V2Transaction, whose
+	// inputs' proofs are valid at Basis.
+	Batch struct {
+		ID            int64                `json:"id"`
+		WalletID      wallet.ID            `json:"walletID"`
+		Payments      []Payment            `json:"payments"`
+		Transaction   types.Transaction    `json:"transaction"`
+		V2Transaction *types.V2Transaction `json:"v2Transaction,omitempty"`
+		Basis         types.ChainIndex     `json:"basis"`
+		ToSign        []types.Hash256      `json:"toSign"`
+		Fee           types.Currency       `json:"fee"`
+		DateCreated   time.Time            `json:"dateCreated"`
+	}
+
+	// A Queue summarizes the queued payments of a wallet.
+	Queue struct {
+		WalletID wallet.ID `json:"walletID"`
+		Payments int       `json:"payments"`
+		Oldest   time.Time `json:"oldest"`
+	}
+
+	// A Store persists queued payments and batches.
+	Store interface {
+		AddPayment(Payment) (Payment, error)
+		// RemovePayment removes a queued payment. It returns ErrNotFound
+		// if the payment does not exist or has already been batched.
+		RemovePayment(walletID wallet.ID, id int64) error
+		// QueuedPayments returns a wallet's queued payments, oldest first.
+		QueuedPayments(walletID wallet.ID) ([]Payment, error)
+		// PaymentQueues returns a summary of every wallet with queued
+		// payments.
+		PaymentQueues() ([]Queue, error)
+
+		// AddPaymentBatch adds a batch and marks its payments as batched.
+		AddPaymentBatch(Batch) (Batch, error)
+		// PaymentBatches returns a wallet's batches, newest first.
+		PaymentBatches(walletID wallet.ID, offset, limit int) ([]Batch, error)
+	}
+
+	// A ChainManager provides the chain state used to fund batches.
+	ChainManager interface {
+		TipState() consensus.State
+		PoolTransactions() []types.Transaction
+		V2PoolTransactions() []types.V2Transaction
+	}
+
+	// A WalletManager provides and reserves the outputs used to fund
+	// batches.
+	WalletManager interface {
+		// ConfirmedSiacoinOutputs returns the wallet's unspent outputs
+		// with at least minConfirmations confirmations.
+		ConfirmedSiacoinOutputs(id wallet.ID, minConfirmations uint64, offset, limit int) ([]types.SiacoinElement, error)
+		// WalletMinConfirmations returns the number of confirmations an
+		// output must have to fund the wallet's transactions.
+		WalletMinConfirmations(id wallet.ID) (uint64, error)
+		Reserve(ids []types.Hash256, duration time.Duration) error
+		// WalletFeeRate returns the fee rate of the wallet's fee strategy.
+		WalletFeeRate(id wallet.ID) (types.Currency, error)
+		// Addresses returns the wallet's addresses, whose spend policies
+		// are added to the inputs of v2 batches.
+		Addresses(id wallet.ID) ([]wallet.Address, error)
+		// Tip returns the last index processed by the wallet manager.
+		Tip() (types.ChainIndex, error)
+	}
+
+	// An EventBroadcaster notifies webhooks when a queue is flushed into a
+	// batch.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager queues outgoing payments and periodically flushes each
+	// wallet's queue into a single batched transaction.
+	Manager struct {
+		store  Store
+		cm     ChainManager
+		wm     WalletManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+
+		interval        time.Duration
+		maxDelay        time.Duration
+		maxSize         int
+		reserveDuration time.Duration
+
+		mu sync.Mutex // serializes flushes
+		// reserved tracks the inputs of recent batches so they are not
+		// used to fund another batch before they expire.
+		reserved map[types.SiacoinOutputID]time.Time
+		// failures tracks the wallets whose queues could not be funded, so
+		// that they are retried with an increasing delay.
+		failures map[wallet.ID]flushFailure
+	}
+
+	// A flushFailure records the consecutive failed flushes of a queue.
+	flushFailure struct {
+		attempts int
+		retry    time.Time
+	}
+)
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// Enqueue adds a payment to a wallet's queue. If the queue is full, it is
+// flushed immediately.
+func (m *Manager) Enqueue(walletID wallet.ID, addr types.Address, value types.Currency) (Payment, error) {
+	if addr == types.VoidAddress {
+		return Payment{}, errors.New("address is required")
+	} else if value.IsZero() {
+		return Payment{}, errors.New("value must be greater than zero")
+	}
+
+	p, err := m.store.AddPayment(Payment{
+		WalletID:   walletID,
+		Address:    addr,
+		Value:      value,
+		DateQueued: time.Now(),
+	})
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to queue payment: %w", err)
+	}
+
+	queued, err := m.store.QueuedPayments(walletID)
+	if err != nil {
+		return Payment{}, fmt.Errorf("failed to get queued payments: %w", err)
+	} else if len(queued) >= m.maxSize {
+		if _, err := m.Flush(walletID); err != nil {
+			m.log.Warn("failed to flush full queue", zap.Int64("wallet", int64(walletID)), zap.Error(err))
+		}
+	}
+	return p, nil
+}
+
+// Queue returns a wallet's queued payments, oldest first.
+func (m *Manager) Queue(walletID wallet.ID) ([]Payment, error) {
+	return m.store.QueuedPayments(walletID)
+}
+
+// Cancel removes a payment from a wallet's queue.
+func (m *Manager) Cancel(walletID wallet.ID, id int64) error {
+	return m.store.RemovePayment(walletID, id)
+}
+
+// Batches returns a wallet's batches, newest first.
+func (m *Manager) Batches(walletID wallet.ID, offset, limit int) ([]Batch, error) {
+	return m.store.PaymentBatches(walletID, offset, limit)
+}
+
+// spendableOutputs returns the wallet's unspent outputs that are not spent
+// by a transaction in the pool or used by a recent batch, largest first.
+// Outputs with fewer than the wallet's minimum number of confirmations are
+// excluded.
+func (m *Manager) spendableOutputs(walletID wallet.ID, now time.Time) ([]types.SiacoinElement, error) {
+	const batchSize = 1000
+
+	minConfirmations, err := m.wm.WalletMinConfirmations(walletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get minimum confirmations: %w", err)
+	}
+
+	for id, expiration := range m.reserved {
+		if now.After(expiration) {
+			delete(m.reserved, id)
+		}
+	}
+
+	inPool := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range m.cm.PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.ParentID] = true
+		}
+	}
+	for _, txn := range m.cm.V2PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.Parent.ID] = true
+		}
+	}
+
+	var utxos []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.wm.ConfirmedSiacoinOutputs(walletID, minConfirmations, offset, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, sce := range batch {
+			if _, ok := m.reserved[sce.ID]; !ok && !inPool[sce.ID] {
+				utxos = append(utxos, sce)
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].SiacoinOutput.Value.Cmp(utxos[j].SiacoinOutput.Value) > 0
+	})
+	return utxos, nil
+}
+
+// fundV1 funds a v1 transaction paying the queued payments. The caller must
+// hold the lock.
+func (m *Manager) fundV1(walletID wallet.ID, queued []Payment, cs consensus.State, feePerByte types.Currency, now time.Time) (Batch, error) {
+	var txn types.Transaction
+	var total types.Currency
+	for _, p := range queued {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: p.Address,
+			Value:   p.Value,
+		})
+		total = total.Add(p.Value)
+	}
+
+	utxos, err := m.spendableOutputs(walletID, now)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+
+	var inputs []types.SiacoinElement
+	var inputSum, fee types.Currency
+	for _, sce := range utxos {
+		inputs = append(inputs, sce)
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+			ParentID: sce.ID,
+			// UnlockConditions left empty for client to fill in
+		})
+		fee = feePerByte.Mul64(cs.TransactionWeight(txn) + uint64(len(inputs))*signedInputSize + feeOverhead)
+		if inputSum.Cmp(total.Add(fee)) >= 0 {
+			break
+		}
+	}
+	if inputSum.Cmp(total.Add(fee)) < 0 {
+		return Batch{}, fmt.Errorf("%w: batch requires %v, wallet has %v available", ErrInsufficientBalance, total.Add(fee), inputSum)
+	}
+
+	txn.MinerFees = []types.Currency{fee}
+	if change := inputSum.Sub(total).Sub(fee); !change.IsZero() {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: inputs[0].SiacoinOutput.Address,
+			Value:   change,
+		})
+	}
+
+	toSign := make([]types.Hash256, len(inputs))
+	for i, sce := range inputs {
+		toSign[i] = types.Hash256(sce.ID)
+	}
+	return Batch{
+		Transaction: txn,
+		ToSign:      toSign,
+		Fee:         fee,
+	}, nil
+}
+
+// fundV2 funds a v2 transaction paying the queued payments. The caller must
+// hold the lock.
+func (m *Manager) fundV2(walletID wallet.ID, queued []Payment, cs consensus.State, feePerByte types.Currency, now time.Time) (Batch, error) {
+	addresses, err := m.wm.Addresses(walletID)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to get addresses: %w", err)
+	}
+	policies := make(map[types.Address]types.SpendPolicy)
+	for _, addr := range addresses {
+		if addr.SpendPolicy != nil {
+			policies[addr.Address] = *addr.SpendPolicy
+		}
+	}
+
+	// the outputs' proofs must match the basis; if the wallet advances
+	// while they are fetched, the flush fails and is retried.
+	basis, err := m.wm.Tip()
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	}
+	utxos, err := m.spendableOutputs(walletID, now)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+	if tip, err := m.wm.Tip(); err != nil {
+		return Batch{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if tip != basis {
+		return Batch{}, errors.New("wallet tip changed while fetching outputs")
+	}
+
+	var txn types.V2Transaction
+	var total types.Currency
+	for _, p := range queued {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: p.Address,
+			Value:   p.Value,
+		})
+		total = total.Add(p.Value)
+	}
+
+	var inputSum, fee types.Currency
+	for _, sce := range utxos {
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+			Parent:          sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{Policy: policies[sce.SiacoinOutput.Address]},
+		})
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+		// include a change output in the estimate
+		withChange := txn
+		withChange.SiacoinOutputs = append(withChange.SiacoinOutputs, types.SiacoinOutput{})
+		fee = feePerByte.Mul64(cs.V2TransactionWeight(withChange) + uint64(len(txn.SiacoinInputs))*signatureSize)
+		if inputSum.Cmp(total.Add(fee)) >= 0 {
+			break
+		}
+	}
+	if inputSum.Cmp(total.Add(fee)) < 0 {
+		return Batch{}, fmt.Errorf("%w: batch requires %v, wallet has %v available", ErrInsufficientBalance, total.Add(fee), inputSum)
+	}
+
+	txn.MinerFee = fee
+	if change := inputSum.Sub(total).Sub(fee); !change.IsZero() {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: txn.SiacoinInputs[0].Parent.SiacoinOutput.Address,
+			Value:   change,
+		})
+	}
+
+	toSign := make([]types.Hash256, len(txn.SiacoinInputs))
+	for i, sci := range txn.SiacoinInputs {
+		toSign[i] = types.Hash256(sci.Parent.ID)
+	}
+	return Batch{
+		V2Transaction: &txn,
+		Basis:         basis,
+		ToSign:        toSign,
+		Fee:           fee,
+	}, nil
+}
+
+// flush funds and stores a batch. The caller must hold the lock.
+func (m *Manager) flush(walletID wallet.ID, now time.Time) (Batch, error) {
+	queued, err := m.store.QueuedPayments(walletID)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to get queued payments: %w", err)
+	} else if len(queued) == 0 {
+		return Batch{}, ErrEmptyQueue
+	} else if len(queued) > m.maxSize {
+		queued = queued[:m.maxSize]
+	}
+
+	cs := m.cm.TipState()
+	feePerByte, err := m.wm.WalletFeeRate(walletID)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to get fee rate: %w", err)
+	}
+	var batch Batch
+	if cs.Index.Height >= cs.Network.HardforkV2.RequireHeight {
+		batch, err = m.fundV2(walletID, queued, cs, feePerByte, now)
+	} else {
+		batch, err = m.fundV1(walletID, queued, cs, feePerByte, now)
+	}
+	if err != nil {
+		return Batch{}, err
+	}
+
+	if err := m.wm.Reserve(batch.ToSign, m.reserveDuration); err != nil {
+		return Batch{}, fmt.Errorf("failed to reserve inputs: %w", err)
+	}
+	for _, id := range batch.ToSign {
+		m.reserved[types.SiacoinOutputID(id)] = now.Add(m.reserveDuration)
+	}
+
+	batch.WalletID = walletID
+	batch.Payments = queued
+	batch.DateCreated = now
+	batch, err = m.store.AddPaymentBatch(batch)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to add batch: %w", err)
+	}
+	return batch, nil
+}
+
+// Flush funds a batched transaction paying a wallet's queued payments, up to
+// the maximum batch size. The batch's inputs are reserved so they are not
+// used to fund another transaction before the batch is broadcast. Change is
+// returned to the address of the first input. After the v2 require height,
+// the batch is a v2 transaction.
+func (m *Manager) Flush(walletID wallet.ID) (Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	batch, err := m.flush(walletID, now)
+	if errors.Is(err, ErrInsufficientBalance) {
+		// back off exponentially, so that an unfundable queue is not
+		// retried every interval
+		f := m.failures[walletID]
+		delay := maxRetryDelay
+		if f.attempts < 32 && m.interval<<f.attempts < maxRetryDelay {
+			delay = m.interval << f.attempts
+		}
+		f.attempts++
+		f.retry = now.Add(delay)
+		m.failures[walletID] = f
+		return Batch{}, err
+	} else if errors.Is(err, ErrEmptyQueue) {
+		delete(m.failures, walletID)
+		return Batch{}, err
+	} else if err != nil {
+		return Batch{}, err
+	}
+	delete(m.failures, walletID)
+
+	log := m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("batch", batch.ID))
+	log.Info("flushed payment queue", zap.Int("payments", len(batch.Payments)), zap.Stringer("fee", batch.Fee))
+	if m.events != nil {
+		if err := m.events.BroadcastEvent(ScopePayments, "batch", batch); err != nil {
+			log.Warn("failed to broadcast event", zap.Error(err))
+		}
+	}
+	return batch, nil
+}
+
+// retrying returns true if a wallet's queue could not be funded recently and
+// should not be flushed yet.
+func (m *Manager) retrying(walletID wallet.ID, now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.failures[walletID]
+	return ok && now.Before(f.retry)
+}
+
+// check flushes every queue that is full or whose oldest payment has waited
+// longer than the maximum delay. Queues that could not be funded are retried
+// with an increasing delay, up to an hour.
+func (m *Manager) check(now time.Time) {
+	queues, err := m.store.PaymentQueues()
+	if err != nil {
+		m.log.Error("failed to get payment queues", zap.Error(err))
+		return
+	}
+	for _, q := range queues {
+		if q.Payments < m.maxSize && now.Sub(q.Oldest) < m.maxDelay {
+			continue
+		} else if m.retrying(q.WalletID, now) {
+			continue
+		}
+		if _, err := m.Flush(q.WalletID); err != nil && !errors.Is(err, ErrEmptyQueue) {
+			m.log.Warn("failed to flush payment queue", zap.Int64("wallet", int64(q.WalletID)), zap.Error(err))
+		}
+	}
+}
+
+// NewManager creates a new payment manager and starts flushing queues in the
+// background.
+func NewManager(store Store, cm ChainManager, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		cm:    cm,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		interval:        10 * time.Second,
+		maxDelay:        10 * time.Minute,
+		maxSize:         100,
+		reserveDuration: time.Hour,
+
+		reserved: make(map[types.SiacoinOutputID]time.Time),
+		failures: make(map[wallet.ID]flushFailure),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.maxSize <= 0 {
+		return nil, errors.New("maximum batch size must be greater than zero")
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "payments", "flushes queued payments into batches", m.interval, false, func(context.Context) error {
+			m.check(time.Now())
+			return nil
+		})
+	}()
+	return m, nil
+}
@@ -0,0 +1,286 @@
+package payments_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct {
+	network *consensus.Network
+}
+
+func (cm chainManager) TipState() consensus.State              { return consensus.State{Network: cm.network} }
+func (chainManager) PoolTransactions() []types.Transaction     { return nil }
+func (chainManager) V2PoolTransactions() []types.V2Transaction { return nil }
+
+type walletManager struct {
+	mu       sync.Mutex
+	utxos    []types.SiacoinElement
+	reserved map[types.Hash256]bool
+}
+
+func (wm *walletManager) WalletMinConfirmations(wallet.ID) (uint64, error) { return 0, nil }
+
+func (wm *walletManager) ConfirmedSiacoinOutputs(_ wallet.ID, _ uint64, offset, limit int) ([]types.SiacoinElement, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if offset > len(wm.utxos) {
+		return nil, nil
+	}
+	utxos := wm.utxos[offset:]
+	if len(utxos) > limit {
+		utxos = utxos[:limit]
+	}
+	return append([]types.SiacoinElement(nil), utxos...), nil
+}
+
+func (wm *walletManager) Reserve(ids []types.Hash256, _ time.Duration) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		if wm.reserved[id] {
+			return fmt.Errorf("output %v already reserved", id)
+		}
+	}
+	for _, id := range ids {
+		wm.reserved[id] = true
+	}
+	return nil
+}
+
+func (wm *walletManager) WalletFeeRate(wallet.ID) (types.Currency, error) {
+	return types.NewCurrency64(1), nil
+}
+
+func (wm *walletManager) Addresses(wallet.ID) ([]wallet.Address, error) {
+	policy := types.PolicyPublicKey(types.PublicKey{1})
+	return []wallet.Address{{Address: types.Address{1}, SpendPolicy: &policy}}, nil
+}
+
+func (wm *walletManager) Tip() (types.ChainIndex, error) {
+	return types.ChainIndex{Height: 10, ID: types.BlockID{10}}, nil
+}
+
+func checkBatch(t *testing.T, b payments.Batch) {
+	t.Helper()
+
+	// every test output is worth 1 KS
+	inputs := types.Siacoins(1000).Mul64(uint64(len(b.ToSign)))
+	var outputs types.Currency
+	for _, sco := range b.Transaction.SiacoinOutputs {
+		outputs = outputs.Add(sco.Value)
+	}
+	if len(b.Transaction.SiacoinInputs) != len(b.ToSign) {
+		t.Fatalf("expected %d inputs, got %d", len(b.ToSign), len(b.Transaction.SiacoinInputs))
+	} else if len(b.Transaction.MinerFees) != 1 || !b.Transaction.MinerFees[0].Equals(b.Fee) {
+		t.Fatalf("expected miner fee %v, got %v", b.Fee, b.Transaction.MinerFees)
+	} else if !inputs.Equals(outputs.Add(b.Fee)) {
+		t.Fatalf("inputs %v do not equal outputs %v plus fee %v", inputs, outputs, b.Fee)
+	}
+	for i, p := range b.Payments {
+		if p.BatchID != b.ID {
+			t.Fatalf("expected payment %d to be in batch %d, got %d", p.ID, b.ID, p.BatchID)
+		} else if sco := b.Transaction.SiacoinOutputs[i]; sco.Address != p.Address || !sco.Value.Equals(p.Value) {
+			t.Fatalf("output %d does not match payment %d", i, p.ID)
+		}
+	}
+}
+
+func TestPaymentQueue(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "payouts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{reserved: make(map[types.Hash256]bool)}
+	for i := 0; i < 3; i++ {
+		wm.utxos = append(wm.utxos, types.SiacoinElement{
+			ID:            types.SiacoinOutputID{byte(i + 1)},
+			SiacoinOutput: types.SiacoinOutput{Address: types.Address{1}, Value: types.Siacoins(1000)},
+		})
+	}
+
+	// batches funded before the require height are v1 transactions
+	n, _ := chain.TestnetZen()
+	n.HardforkV2.AllowHeight = 1000
+	n.HardforkV2.RequireHeight = 2000
+	pm, err := payments.NewManager(db, chainManager{n}, wm, payments.WithLogger(log.Named("payments")), payments.WithMaxSize(3), payments.WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Close()
+
+	if _, err := pm.Enqueue(w.ID, types.VoidAddress, types.Siacoins(1)); err == nil {
+		t.Fatal("expected error for void address")
+	} else if _, err := pm.Enqueue(w.ID, types.Address{2}, types.ZeroCurrency); err == nil {
+		t.Fatal("expected error for zero value")
+	} else if _, err := pm.Enqueue(w.ID+1, types.Address{2}, types.Siacoins(1)); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if _, err := pm.Flush(w.ID); !errors.Is(err, payments.ErrEmptyQueue) {
+		t.Fatalf("expected ErrEmptyQueue, got %v", err)
+	}
+
+	p1, err := pm.Enqueue(w.ID, types.Address{2}, types.Siacoins(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := pm.Enqueue(w.ID, types.Address{3}, types.Siacoins(200))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := pm.Cancel(w.ID, p1.ID); err != nil {
+		t.Fatal(err)
+	} else if err := pm.Cancel(w.ID, p1.ID); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	queued, err := pm.Queue(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(queued) != 1 || queued[0].ID != p2.ID {
+		t.Fatalf("expected payment %d to be queued, got %v", p2.ID, queued)
+	}
+
+	// force a flush
+	b1, err := pm.Flush(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(b1.Payments) != 1 || len(b1.ToSign) != 1 {
+		t.Fatalf("expected 1 payment and 1 input, got %d and %d", len(b1.Payments), len(b1.ToSign))
+	}
+	checkBatch(t, b1)
+	if err := pm.Cancel(w.ID, p2.ID); !errors.Is(err, payments.ErrNotFound) {
+		t.Fatalf("expected batched payment to be uncancellable, got %v", err)
+	}
+
+	// filling the queue should flush it automatically using an input that
+	// is not reserved by the first batch
+	for i := 0; i < 3; i++ {
+		if _, err := pm.Enqueue(w.ID, types.Address{byte(10 + i)}, types.Siacoins(500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if queued, err := pm.Queue(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(queued) != 0 {
+		t.Fatalf("expected queue to be flushed, got %d payments", len(queued))
+	}
+
+	batches, err := pm.Batches(w.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(batches) != 2 || batches[1].ID != b1.ID {
+		t.Fatalf("expected 2 batches, got %v", batches)
+	}
+	b2 := batches[0]
+	if len(b2.Payments) != 3 || len(b2.ToSign) != 2 {
+		t.Fatalf("expected 3 payments and 2 inputs, got %d and %d", len(b2.Payments), len(b2.ToSign))
+	}
+	checkBatch(t, b2)
+	for _, id := range b2.ToSign {
+		if id == b1.ToSign[0] {
+			t.Fatal("second batch reused an input of the first batch")
+		}
+	}
+
+	// the remaining output cannot fund a large payment
+	if _, err := pm.Enqueue(w.ID, types.Address{20}, types.Siacoins(5000)); err != nil {
+		t.Fatal(err)
+	} else if _, err := pm.Flush(w.ID); !errors.Is(err, payments.ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+	}
+}
+
+func TestPaymentBatchV2(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "payouts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{reserved: make(map[types.Hash256]bool)}
+	for i := 0; i < 2; i++ {
+		wm.utxos = append(wm.utxos, types.SiacoinElement{
+			ID:            types.SiacoinOutputID{byte(i + 1)},
+			SiacoinOutput: types.SiacoinOutput{Address: types.Address{1}, Value: types.Siacoins(1000)},
+		})
+	}
+
+	// batches funded after the require height are v2 transactions
+	n, _ := chain.TestnetZen()
+	n.HardforkV2.AllowHeight = 0
+	n.HardforkV2.RequireHeight = 0
+	pm, err := payments.NewManager(db, chainManager{n}, wm, payments.WithLogger(log.Named("payments")), payments.WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Close()
+
+	if _, err := pm.Enqueue(w.ID, types.Address{2}, types.Siacoins(1500)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := pm.Flush(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn := b.V2Transaction
+	if txn == nil {
+		t.Fatal("expected a v2 transaction")
+	} else if len(b.Transaction.SiacoinInputs) != 0 {
+		t.Fatal("expected no v1 inputs")
+	} else if b.Basis != (types.ChainIndex{Height: 10, ID: types.BlockID{10}}) {
+		t.Fatalf("expected basis to be the wallet tip, got %v", b.Basis)
+	} else if !txn.MinerFee.Equals(b.Fee) {
+		t.Fatalf("expected miner fee %v, got %v", b.Fee, txn.MinerFee)
+	} else if len(txn.SiacoinInputs) != 2 || len(b.ToSign) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(txn.SiacoinInputs))
+	}
+	var outputs types.Currency
+	for _, sco := range txn.SiacoinOutputs {
+		outputs = outputs.Add(sco.Value)
+	}
+	if !types.Siacoins(2000).Equals(outputs.Add(b.Fee)) {
+		t.Fatalf("inputs do not equal outputs %v plus fee %v", outputs, b.Fee)
+	}
+	for i, sci := range txn.SiacoinInputs {
+		if types.Hash256(sci.Parent.ID) != b.ToSign[i] {
+			t.Fatalf("expected input %d to be %v, got %v", i, b.ToSign[i], sci.Parent.ID)
+		} else if sci.SatisfiedPolicy.Policy.Address() != types.PolicyPublicKey(types.PublicKey{1}).Address() {
+			t.Fatalf("expected input %d to have the address's spend policy", i)
+		}
+	}
+
+	batches, err := pm.Batches(w.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(batches) != 1 || batches[0].V2Transaction == nil {
+		t.Fatalf("expected 1 v2 batch, got %v", batches)
+	} else if batches[0].V2Transaction.ID() != txn.ID() || batches[0].Basis != b.Basis {
+		t.Fatal("stored batch does not match")
+	}
+}
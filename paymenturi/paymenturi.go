@@ -0,0 +1,304 @@
+// Package paymenturi parses and generates payment URIs, modeled on BIP21, so
+// that wallets, shops, and QR code generators agree on a single encoding of
+// payment requests.
+//
+// A payment URI has the form
+//
+//	sia:<address>?amount=<siacoins>&label=<label>&message=<message>&exp=<unix>&minconf=<n>
+//
+// where every parameter is optional. Amounts are exact decimal strings of
+// siacoins. Values are percent-encoded. Unknown parameters are preserved, but
+// unknown parameters prefixed with "req-" make the URI invalid, since the
+// payer cannot honor a requirement it does not understand.
+package paymenturi
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.thebigfile.com/core/types"
+)
+
+// Scheme is the URI scheme of payment URIs.
+const Scheme = "sia"
+
+// MaxTextLength is the maximum length, in bytes, of a label, message, or
+// extra parameter value.
+const MaxTextLength = 256
+
+// Parameter names.
+const (
+	paramAmount           = "amount"
+	paramLabel            = "label"
+	paramMessage          = "message"
+	paramExpires          = "exp"
+	paramMinConfirmations = "minconf"
+)
+
+// requiredPrefix marks parameters the payer must understand.
+const requiredPrefix = "req-"
+
+var (
+	// ErrExpired is returned by Validate when a URI has expired.
+	ErrExpired = errors.New("payment URI has expired")
+
+	amountRegex    = regexp.MustCompile(`^(0|[1-9][0-9]*)(\.[0-9]{1,24})?$`)
+	paramNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// A URI is a payment request.
+type URI struct {
+	Address types.Address `json:"address"`
+	// Amount is the requested amount. Zero means the payer chooses the
+	// amount.
+	Amount  types.Currency `json:"amount"`
+	Label   string         `json:"label,omitempty"`
+	Message string         `json:"message,omitempty"`
+	// Expires is the time after which the request should not be paid.
+	// Zero means the request does not expire. It has a precision of one
+	// second.
+	Expires time.Time `json:"expires,omitempty"`
+
+	// MinConfirmations is a policy hint: the number of confirmations the
+	// payee waits for before considering the request paid.
+	MinConfirmations uint64 `json:"minConfirmations,omitempty"`
+
+	// Extra contains parameters that are not part of this package's
+	// format, keyed by name.
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// Expired returns true if the URI expired before now.
+func (u URI) Expired(now time.Time) bool {
+	return !u.Expires.IsZero() && !u.Expires.After(now)
+}
+
+// Validate checks that the URI can be encoded. It returns ErrExpired if the
+// URI expired before now.
+func (u URI) Validate(now time.Time) error {
+	if u.Address == types.VoidAddress {
+		return errors.New("address is required")
+	}
+	for name, s := range map[string]string{paramLabel: u.Label, paramMessage: u.Message} {
+		if err := validateText(s); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	if !u.Expires.IsZero() {
+		if u.Expires.Unix() <= 0 {
+			return errors.New("expiration must be after the Unix epoch")
+		} else if u.Expired(now) {
+			return ErrExpired
+		}
+	}
+	for name, value := range u.Extra {
+		if err := validateExtra(name); err != nil {
+			return err
+		} else if err := validateText(value); err != nil {
+			return fmt.Errorf("invalid parameter %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// String encodes the URI. Parameters are encoded in a fixed order, followed
+// by extra parameters sorted by name, so equal URIs encode identically. The
+// URI is not validated.
+func (u URI) String() string {
+	var params []string
+	add := func(name, value string) {
+		params = append(params, name+"="+escape(value))
+	}
+	if !u.Amount.IsZero() {
+		add(paramAmount, formatAmount(u.Amount))
+	}
+	if u.Label != "" {
+		add(paramLabel, u.Label)
+	}
+	if u.Message != "" {
+		add(paramMessage, u.Message)
+	}
+	if !u.Expires.IsZero() {
+		add(paramExpires, strconv.FormatInt(u.Expires.Unix(), 10))
+	}
+	if u.MinConfirmations != 0 {
+		add(paramMinConfirmations, strconv.FormatUint(u.MinConfirmations, 10))
+	}
+	names := make([]string, 0, len(u.Extra))
+	for name := range u.Extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add(name, u.Extra[name])
+	}
+
+	s := Scheme + ":" + u.Address.String()
+	if len(params) != 0 {
+		s += "?" + strings.Join(params, "&")
+	}
+	return s
+}
+
+// Parse parses a payment URI. The scheme is case-insensitive; everything else
+// must be in canonical form. Parse does not check whether the URI has
+// expired.
+func Parse(s string) (URI, error) {
+	scheme, rest, ok := strings.Cut(s, ":")
+	if !ok || !strings.EqualFold(scheme, Scheme) {
+		return URI{}, fmt.Errorf("scheme must be %q", Scheme)
+	}
+	addrStr, query, hasQuery := strings.Cut(rest, "?")
+	if strings.HasPrefix(addrStr, "//") {
+		return URI{}, errors.New("URI must not have an authority")
+	} else if strings.ContainsRune(query, '#') {
+		return URI{}, errors.New("URI must not have a fragment")
+	}
+
+	var u URI
+	if err := u.Address.UnmarshalText([]byte(addrStr)); err != nil {
+		return URI{}, fmt.Errorf("invalid address: %w", err)
+	} else if u.Address.String() != addrStr {
+		return URI{}, fmt.Errorf("address %q is not in canonical form", addrStr)
+	} else if u.Address == types.VoidAddress {
+		return URI{}, errors.New("address must not be the void address")
+	} else if hasQuery && query == "" {
+		return URI{}, errors.New("empty query")
+	}
+
+	var params []string
+	if hasQuery {
+		params = strings.Split(query, "&")
+	}
+	seen := make(map[string]bool)
+	for _, param := range params {
+		name, rawValue, ok := strings.Cut(param, "=")
+		if !ok {
+			return URI{}, fmt.Errorf("parameter %q has no value", param)
+		} else if seen[name] {
+			return URI{}, fmt.Errorf("duplicate parameter %q", name)
+		}
+		seen[name] = true
+		value, err := unescape(rawValue)
+		if err != nil {
+			return URI{}, fmt.Errorf("invalid parameter %q: %w", name, err)
+		}
+
+		switch name {
+		case paramAmount:
+			u.Amount, err = parseAmount(value)
+		case paramLabel:
+			u.Label, err = value, validateText(value)
+		case paramMessage:
+			u.Message, err = value, validateText(value)
+		case paramExpires:
+			var exp int64
+			exp, err = parseUint(value)
+			if err == nil && exp == 0 {
+				err = errors.New("expiration must be after the Unix epoch")
+			}
+			u.Expires = time.Unix(exp, 0)
+		case paramMinConfirmations:
+			var n int64
+			n, err = parseUint(value)
+			u.MinConfirmations = uint64(n)
+		default:
+			if err := validateExtra(name); err != nil {
+				return URI{}, err
+			} else if err := validateText(value); err != nil {
+				return URI{}, fmt.Errorf("invalid parameter %q: %w", name, err)
+			}
+			if u.Extra == nil {
+				u.Extra = make(map[string]string)
+			}
+			u.Extra[name] = value
+		}
+		if err != nil {
+			return URI{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return u, nil
+}
+
+// validateExtra checks the name of an extra parameter.
+func validateExtra(name string) error {
+	switch {
+	case !paramNameRegex.MatchString(name):
+		return fmt.Errorf("invalid parameter name %q", name)
+	case strings.HasPrefix(name, requiredPrefix):
+		return fmt.Errorf("unsupported required parameter %q", name)
+	case name == paramAmount, name == paramLabel, name == paramMessage, name == paramExpires, name == paramMinConfirmations:
+		return fmt.Errorf("parameter %q is not an extra parameter", name)
+	}
+	return nil
+}
+
+func validateText(s string) error {
+	if len(s) > MaxTextLength {
+		return fmt.Errorf("longer than %d bytes", MaxTextLength)
+	} else if !utf8.ValidString(s) {
+		return errors.New("not valid UTF-8")
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return errors.New("contains control characters")
+		}
+	}
+	return nil
+}
+
+// parseUint parses a canonical decimal integer that fits in an int64.
+func parseUint(s string) (int64, error) {
+	if s == "" || (len(s) > 1 && s[0] == '0') || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, fmt.Errorf("%q is not a canonical integer", s)
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseAmount parses an exact decimal string of siacoins.
+func parseAmount(s string) (types.Currency, error) {
+	if !amountRegex.MatchString(s) {
+		return types.Currency{}, fmt.Errorf("%q is not a decimal amount of siacoins", s)
+	} else if strings.Contains(s, ".") && strings.HasSuffix(s, "0") {
+		return types.Currency{}, fmt.Errorf("%q has trailing zeros", s)
+	}
+	r, _ := new(big.Rat).SetString(s)
+	r.Mul(r, new(big.Rat).SetInt(types.HastingsPerSiacoin.Big()))
+	if r.Sign() == 0 {
+		return types.Currency{}, errors.New("amount must be positive")
+	}
+	var c types.Currency
+	if err := c.UnmarshalText([]byte(r.Num().String())); err != nil {
+		return types.Currency{}, fmt.Errorf("amount %q is too large: %w", s, err)
+	}
+	return c, nil
+}
+
+// formatAmount formats a currency as an exact decimal string of siacoins.
+func formatAmount(c types.Currency) string {
+	s := new(big.Rat).SetFrac(c.Big(), types.HastingsPerSiacoin.Big()).FloatString(24)
+	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+}
+
+// escape percent-encodes a parameter value. Spaces are encoded as "%20"
+// rather than "+", which some decoders do not treat as a space.
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// unescape decodes a percent-encoded parameter value. "+" is not decoded as
+// a space, so it must be escaped.
+func unescape(s string) (string, error) {
+	if strings.ContainsRune(s, '+') {
+		return "", errors.New(`"+" must be percent-encoded`)
+	}
+	return url.PathUnescape(s)
+}
@@ -0,0 +1,94 @@
+package paymenturi_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/paymenturi"
+)
+
+func TestRoundTrip(t *testing.T) {
+	u := paymenturi.URI{
+		Address:          types.Address{1, 2, 3},
+		Amount:           types.Siacoins(3).Add(types.Siacoins(1).Div64(2)),
+		Label:            "Shop & Co",
+		Message:          "Order #12 + tip=100%",
+		Expires:          time.Unix(1900000000, 0),
+		MinConfirmations: 6,
+		Extra:            map[string]string{"order-id": "a/b", "lang": "ja"},
+	}
+	if err := u.Validate(time.Unix(1800000000, 0)); err != nil {
+		t.Fatal(err)
+	}
+	s := u.String()
+	exp := "sia:" + u.Address.String() + "?amount=3.5&label=Shop%20%26%20Co&message=Order%20%2312%20%2B%20tip%3D100%25&exp=1900000000&minconf=6&lang=ja&order-id=a%2Fb"
+	if s != exp {
+		t.Fatalf("expected %q, got %q", exp, s)
+	}
+	parsed, err := paymenturi.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(parsed, u) {
+		t.Fatalf("expected %+v, got %+v", u, parsed)
+	}
+
+	if err := u.Validate(time.Unix(1900000000, 0)); !errors.Is(err, paymenturi.ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+
+	// an address alone has no query
+	if s := (paymenturi.URI{Address: u.Address}).String(); s != "sia:"+u.Address.String() {
+		t.Fatalf("unexpected URI %q", s)
+	}
+}
+
+func TestParse(t *testing.T) {
+	addr := types.Address{0xab, 0xcd}.String()
+	tests := []struct {
+		uri    string
+		amount types.Currency
+		err    string
+	}{
+		{uri: "SIA:" + addr},
+		{uri: "sia:" + addr + "?amount=1", amount: types.Siacoins(1)},
+		{uri: "sia:" + addr + "?amount=0.000000000000000000000001", amount: types.NewCurrency64(1)},
+		{uri: "bitcoin:" + addr, err: "scheme"},
+		{uri: "sia://" + addr, err: "authority"},
+		{uri: "sia:" + strings.ToUpper(addr), err: "canonical"},
+		{uri: "sia:" + types.VoidAddress.String(), err: "void address"},
+		{uri: "sia:" + addr + "?", err: "empty query"},
+		{uri: "sia:" + addr + "?label=a#frag", err: "fragment"},
+		{uri: "sia:" + addr + "?label", err: "no value"},
+		{uri: "sia:" + addr + "?label=a&label=b", err: "duplicate"},
+		{uri: "sia:" + addr + "?label=a+b", err: "percent-encoded"},
+		{uri: "sia:" + addr + "?label=%zz", err: "invalid parameter"},
+		{uri: "sia:" + addr + "?label=%0A", err: "control characters"},
+		{uri: "sia:" + addr + "?message=" + strings.Repeat("a", paymenturi.MaxTextLength+1), err: "longer than"},
+		{uri: "sia:" + addr + "?amount=0", err: "positive"},
+		{uri: "sia:" + addr + "?amount=1.50", err: "trailing zeros"},
+		{uri: "sia:" + addr + "?amount=01", err: "decimal amount"},
+		{uri: "sia:" + addr + "?amount=1e3", err: "decimal amount"},
+		{uri: "sia:" + addr + "?amount=0.0000000000000000000000001", err: "decimal amount"},
+		{uri: "sia:" + addr + "?exp=0", err: "Unix epoch"},
+		{uri: "sia:" + addr + "?exp=-1", err: "canonical integer"},
+		{uri: "sia:" + addr + "?minconf=06", err: "canonical integer"},
+		{uri: "sia:" + addr + "?req-refund=abc", err: "unsupported required parameter"},
+		{uri: "sia:" + addr + "?Label=abc", err: "invalid parameter name"},
+	}
+	for _, test := range tests {
+		u, err := paymenturi.Parse(test.uri)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.uri, err)
+			} else if !u.Amount.Equals(test.amount) {
+				t.Errorf("%q: expected amount %v, got %v", test.uri, test.amount, u.Amount)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: expected error containing %q, got %v", test.uri, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package peerscore
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Scorer.
+type Option func(*Scorer)
+
+// WithLogger sets the logger used by the scorer.
+func WithLogger(log *zap.Logger) Option {
+	return func(sc *Scorer) {
+		sc.log = log
+	}
+}
+
+// WithProbeInterval sets how often peers are probed. The default is five
+// minutes.
+func WithProbeInterval(d time.Duration) Option {
+	return func(sc *Scorer) {
+		sc.interval = d
+	}
+}
+
+// WithProbes sets the number of known peers that are probed in addition to
+// the connected peers. The default is 10.
+func WithProbes(n int) Option {
+	return func(sc *Scorer) {
+		sc.probes = n
+	}
+}
+
+// WithRotation sets the score below which a peer is rotated out and how
+// long it is rotated out for. The defaults are 0.2 and one hour. A minimum
+// score of zero disables rotation.
+func WithRotation(minScore float64, d time.Duration) Option {
+	return func(sc *Scorer) {
+		sc.minScore = minScore
+		sc.rotateFor = d
+	}
+}
+
+// WithScheduler registers the peer probe as the "peerscore" job, so that
+// operators can probe peers on demand or pause the rotation of low scoring
+// peers.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(sc *Scorer) {
+		sc.sched = s
+	}
+}
@@ -0,0 +1,326 @@
+// Package peerscore scores the syncer's peers by latency, block propagation
+// speed, and reliability. Peers are offered to the syncer in order of score
+// and chronically bad peers are rotated out for a while.
+package peerscore
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/coreutils/syncer"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// ewmaWeight is the weight of a new latency or speed sample.
+	ewmaWeight = 0.3
+
+	// targetLatency and targetSpeed are the latency and block propagation
+	// speed at which those components of a peer's score are 0.5.
+	targetLatency = 250 * time.Millisecond
+	targetSpeed   = 100 // blocks per second
+
+	// minAttempts is the number of connection attempts before a peer can be
+	// rotated out.
+	minAttempts = 5
+)
+
+type (
+	// A Syncer returns the connected peers.
+	Syncer interface {
+		Peers() []*syncer.Peer
+	}
+
+	// A Score is the quality of a peer. Scores are kept in memory and reset
+	// when walletd restarts.
+	Score struct {
+		Address string `json:"address"`
+		// Score is between 0 and 1. Higher is better.
+		Score float64 `json:"score"`
+		// Latency is the average time to establish a TCP connection to the
+		// peer. It is zero if the peer has not been probed.
+		Latency time.Duration `json:"latency,omitempty"`
+		// BlocksPerSecond is the average rate at which the peer sent blocks
+		// while syncing.
+		BlocksPerSecond float64 `json:"blocksPerSecond,omitempty"`
+		Attempts        int     `json:"attempts"`
+		Failures        int     `json:"failures"`
+		// RotatedOut is set if the peer is excluded from the peers offered
+		// to the syncer until the given time.
+		RotatedOut time.Time `json:"rotatedOut,omitempty"`
+	}
+
+	// A Scorer wraps a syncer.PeerStore, scoring its peers and ordering them
+	// by score.
+	Scorer struct {
+		syncer.PeerStore
+
+		log         *zap.Logger
+		tg          *threadgroup.ThreadGroup
+		sched       *jobs.Scheduler
+		interval    time.Duration
+		probes      int
+		minScore    float64
+		rotateFor   time.Duration
+		dialTimeout time.Duration
+
+		mu     sync.Mutex
+		scores map[string]*Score
+	}
+)
+
+// compute updates the score of s.
+func (s *Score) compute() {
+	latency := 0.5
+	if s.Latency > 0 {
+		latency = float64(targetLatency) / float64(targetLatency+s.Latency)
+	}
+	speed := 0.5
+	if s.BlocksPerSecond > 0 {
+		speed = s.BlocksPerSecond / (s.BlocksPerSecond + targetSpeed)
+	}
+	reliability := float64(s.Attempts-s.Failures+1) / float64(s.Attempts+2)
+	s.Score = reliability * (latency + speed) / 2
+}
+
+func ewma(avg, sample float64) float64 {
+	if avg == 0 {
+		return sample
+	}
+	return avg*(1-ewmaWeight) + sample*ewmaWeight
+}
+
+// score returns the score of a peer, creating it if necessary. The caller
+// must hold the lock.
+func (sc *Scorer) score(addr string) *Score {
+	s, ok := sc.scores[addr]
+	if !ok {
+		s = &Score{Address: addr}
+		s.compute()
+		sc.scores[addr] = s
+	}
+	return s
+}
+
+// record records the outcome of a connection attempt. The caller must hold
+// the lock.
+func (sc *Scorer) record(addr string, success bool, now time.Time) *Score {
+	s := sc.score(addr)
+	s.Attempts++
+	if !success {
+		s.Failures++
+	}
+	s.compute()
+	if s.Attempts >= minAttempts && s.Score < sc.minScore && now.After(s.RotatedOut) {
+		s.RotatedOut = now.Add(sc.rotateFor)
+		sc.log.Debug("rotating out peer", zap.String("peer", addr), zap.Float64("score", s.Score), zap.Time("until", s.RotatedOut))
+	}
+	return s
+}
+
+// rotatedOut returns true if the peer is rotated out. The caller must hold
+// the lock.
+func (sc *Scorer) rotatedOut(addr string, now time.Time) bool {
+	s, ok := sc.scores[addr]
+	return ok && now.Before(s.RotatedOut)
+}
+
+// Peers implements syncer.PeerStore. Peers are returned in descending order
+// of score. Rotated out peers are omitted unless every peer is rotated out.
+func (sc *Scorer) Peers() ([]syncer.PeerInfo, error) {
+	peers, err := sc.PeerStore.Peers()
+	if err != nil {
+		return nil, err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	now := time.Now()
+	filtered := peers[:0:0]
+	for _, p := range peers {
+		if !sc.rotatedOut(p.Address, now) {
+			filtered = append(filtered, p)
+		}
+	}
+	if len(filtered) == 0 {
+		filtered = peers
+	}
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return sc.score(filtered[i].Address).Score > sc.score(filtered[j].Address).Score
+	})
+	return filtered, nil
+}
+
+// UpdatePeerInfo implements syncer.PeerStore. The syncer updates a peer's
+// info when it connects and after syncing blocks from it, so the changes are
+// used to score the peer.
+func (sc *Scorer) UpdatePeerInfo(addr string, fn func(*syncer.PeerInfo)) error {
+	var before, after syncer.PeerInfo
+	err := sc.PeerStore.UpdatePeerInfo(addr, func(info *syncer.PeerInfo) {
+		before = *info
+		fn(info)
+		after = *info
+	})
+	if err != nil {
+		return err
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	now := time.Now()
+	if after.LastConnect.After(before.LastConnect) {
+		sc.record(addr, true, now)
+	}
+	if after.SyncedBlocks > before.SyncedBlocks && after.SyncDuration > before.SyncDuration {
+		blocks := float64(after.SyncedBlocks - before.SyncedBlocks)
+		s := sc.score(addr)
+		s.BlocksPerSecond = ewma(s.BlocksPerSecond, blocks/(after.SyncDuration-before.SyncDuration).Seconds())
+		s.compute()
+	}
+	return nil
+}
+
+// Ban implements syncer.PeerStore. The syncer bans peers that misbehave, so
+// a ban counts as a failure.
+func (sc *Scorer) Ban(addr string, duration time.Duration, reason string) error {
+	sc.mu.Lock()
+	sc.record(addr, false, time.Now())
+	sc.mu.Unlock()
+	return sc.PeerStore.Ban(addr, duration, reason)
+}
+
+// Score returns the score of a peer. The second return value is false if
+// the peer has not been scored.
+func (sc *Scorer) Score(addr string) (Score, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	s, ok := sc.scores[addr]
+	if !ok {
+		return Score{}, false
+	}
+	return *s, true
+}
+
+// Scores returns the scores of every scored peer in descending order.
+func (sc *Scorer) Scores() []Score {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	scores := make([]Score, 0, len(sc.scores))
+	for _, s := range sc.scores {
+		scores = append(scores, *s)
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	return scores
+}
+
+// probe measures the latency of a peer.
+func (sc *Scorer) probe(addr string) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", addr, sc.dialTimeout)
+	if err == nil {
+		conn.Close()
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	s := sc.record(addr, err == nil, time.Now())
+	if err == nil {
+		s.Latency = time.Duration(ewma(float64(s.Latency), float64(time.Since(start))))
+		s.compute()
+	}
+}
+
+// probePeers probes the connected peers and a random sample of the known
+// peers, then disconnects connected peers that were rotated out.
+func (sc *Scorer) probePeers(ctx context.Context, s Syncer) {
+	connected := s.Peers()
+	addrs := make(map[string]bool)
+	for _, p := range connected {
+		addrs[p.Addr()] = true
+	}
+	known, err := sc.PeerStore.Peers()
+	if err != nil {
+		sc.log.Warn("failed to get peers", zap.Error(err))
+	}
+	frand.Shuffle(len(known), func(i, j int) { known[i], known[j] = known[j], known[i] })
+	for _, p := range known {
+		if len(addrs) >= len(connected)+sc.probes {
+			break
+		}
+		addrs[p.Address] = true
+	}
+
+	var wg sync.WaitGroup
+	for addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sc.probe(addr)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	now := time.Now()
+	for _, p := range connected {
+		if sc.rotatedOut(p.Addr(), now) {
+			sc.log.Info("disconnecting low scoring peer", zap.String("peer", p.Addr()), zap.Float64("score", sc.scores[p.Addr()].Score))
+			p.Close()
+		}
+	}
+}
+
+// Start probes the peers in the background and disconnects connected peers
+// once they are rotated out.
+func (sc *Scorer) Start(s Syncer) error {
+	ctx, cancel, err := sc.tg.AddWithContext(context.Background())
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer cancel()
+
+		sc.sched.Run(ctx, "peerscore", "probes peers and rotates out low scoring ones", sc.interval, false, func(ctx context.Context) error {
+			sc.probePeers(ctx, s)
+			return nil
+		})
+	}()
+	return nil
+}
+
+// Close stops probing peers.
+func (sc *Scorer) Close() error {
+	sc.tg.Stop()
+	return nil
+}
+
+// NewScorer wraps a peer store with a Scorer.
+func NewScorer(ps syncer.PeerStore, opts ...Option) *Scorer {
+	sc := &Scorer{
+		PeerStore: ps,
+
+		log:         zap.NewNop(),
+		tg:          threadgroup.New(),
+		interval:    5 * time.Minute,
+		probes:      10,
+		minScore:    0.2,
+		rotateFor:   time.Hour,
+		dialTimeout: 5 * time.Second,
+
+		scores: make(map[string]*Score),
+	}
+	for _, opt := range opts {
+		opt(sc)
+	}
+	return sc
+}
@@ -0,0 +1,164 @@
+package peerscore_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/coreutils/syncer"
+	"go.thebigfile.com/walletd/peerscore"
+	"go.uber.org/zap/zaptest"
+)
+
+type peerStore struct {
+	mu    sync.Mutex
+	peers map[string]syncer.PeerInfo
+}
+
+func (ps *peerStore) AddPeer(addr string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.peers[addr] = syncer.PeerInfo{Address: addr, FirstSeen: time.Now()}
+	return nil
+}
+
+func (ps *peerStore) Peers() ([]syncer.PeerInfo, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	var peers []syncer.PeerInfo
+	for _, p := range ps.peers {
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+func (ps *peerStore) PeerInfo(addr string) (syncer.PeerInfo, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p, ok := ps.peers[addr]
+	if !ok {
+		return syncer.PeerInfo{}, syncer.ErrPeerNotFound
+	}
+	return p, nil
+}
+
+func (ps *peerStore) UpdatePeerInfo(addr string, fn func(*syncer.PeerInfo)) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	p, ok := ps.peers[addr]
+	if !ok {
+		return syncer.ErrPeerNotFound
+	}
+	fn(&p)
+	ps.peers[addr] = p
+	return nil
+}
+
+func (ps *peerStore) Ban(string, time.Duration, string) error { return nil }
+func (ps *peerStore) Banned(string) (bool, error)             { return false, nil }
+
+type noPeers struct{}
+
+func (noPeers) Peers() []*syncer.Peer { return nil }
+
+func TestScorer(t *testing.T) {
+	ps := &peerStore{peers: make(map[string]syncer.PeerInfo)}
+	sc := peerscore.NewScorer(ps, peerscore.WithLogger(zaptest.NewLogger(t)), peerscore.WithRotation(0.2, time.Hour))
+
+	for _, addr := range []string{"1.1.1.1:9981", "2.2.2.2:9981", "3.3.3.3:9981"} {
+		if err := sc.AddPeer(addr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// syncing blocks quickly raises a peer's score
+	syncBlocks := func(addr string, blocks uint64, d time.Duration) {
+		t.Helper()
+		err := sc.UpdatePeerInfo(addr, func(info *syncer.PeerInfo) {
+			info.LastConnect = time.Now()
+			info.SyncedBlocks += blocks
+			info.SyncDuration += d
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncBlocks("1.1.1.1:9981", 10, 10*time.Second)
+	syncBlocks("2.2.2.2:9981", 1000, time.Second)
+
+	peers, err := sc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(peers) != 3 || peers[0].Address != "2.2.2.2:9981" || peers[2].Address != "1.1.1.1:9981" {
+		t.Fatalf("unexpected peer order %v", peers)
+	} else if s, ok := sc.Score("2.2.2.2:9981"); !ok || s.BlocksPerSecond != 1000 {
+		t.Fatalf("unexpected score %+v", s)
+	}
+
+	// repeated failures rotate a peer out
+	for i := 0; i < 5; i++ {
+		if err := sc.Ban("3.3.3.3:9981", time.Minute, "misbehaving"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s, _ := sc.Score("3.3.3.3:9981"); s.RotatedOut.IsZero() {
+		t.Fatalf("expected peer to be rotated out, got %+v", s)
+	}
+	peers, err = sc.Peers()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(peers) != 2 {
+		t.Fatalf("expected rotated out peer to be omitted, got %v", peers)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	// a port with nothing listening
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	ps := &peerStore{peers: make(map[string]syncer.PeerInfo)}
+	sc := peerscore.NewScorer(ps, peerscore.WithLogger(zaptest.NewLogger(t)), peerscore.WithProbeInterval(10*time.Millisecond))
+	defer sc.Close()
+	sc.AddPeer(l.Addr().String())
+	sc.AddPeer(closedAddr)
+	if err := sc.Start(noPeers{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; ; i++ {
+		if s, ok := sc.Score(l.Addr().String()); ok && s.Latency > 0 {
+			break
+		} else if i == 100 {
+			t.Fatal("expected peer to be probed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	good, _ := sc.Score(l.Addr().String())
+	bad, _ := sc.Score(closedAddr)
+	if bad.Failures == 0 || good.Failures != 0 {
+		t.Fatalf("unexpected failures: good %+v, bad %+v", good, bad)
+	} else if good.Score <= bad.Score {
+		t.Fatalf("expected reachable peer to score higher: good %+v, bad %+v", good, bad)
+	}
+}
@@ -1,9 +1,11 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"go.thebigfile.com/walletd/wallet"
@@ -12,7 +14,7 @@ import (
 
 // AddressBalance returns the balance of a single address.
 func (s *Store) AddressBalance(address types.Address) (balance wallet.Balance, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		const query = `SELECT siacoin_balance, immature_siacoin_balance, siafund_balance FROM sia_addresses WHERE sia_address=$1`
 		err := tx.QueryRow(query, encode(address)).Scan(decode(&balance.Siacoins), decode(&balance.ImmatureSiacoins), &balance.Siafunds)
 		if errors.Is(err, sql.ErrNoRows) {
@@ -24,9 +26,39 @@ func (s *Store) AddressBalance(address types.Address) (balance wallet.Balance, e
 	return
 }
 
+// AddressWallets returns the wallet that owns each of the given addresses.
+// Addresses that are not in any wallet are omitted. If an address is in more
+// than one wallet, the wallet with the lowest ID is returned.
+func (s *Store) AddressWallets(addresses []types.Address) (owners map[types.Address]wallet.ID, err error) {
+	owners = make(map[types.Address]wallet.ID)
+	err = s.readTransaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`SELECT MIN(wa.wallet_id) FROM wallet_addresses wa
+INNER JOIN sia_addresses sa ON wa.address_id = sa.id
+WHERE sa.sia_address=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, addr := range addresses {
+			if _, ok := owners[addr]; ok {
+				continue
+			}
+			var id sql.NullInt64
+			if err := stmt.QueryRow(encode(addr)).Scan(&id); err != nil {
+				return fmt.Errorf("failed to get wallet of address %q: %w", addr, err)
+			} else if id.Valid {
+				owners[addr] = wallet.ID(id.Int64)
+			}
+		}
+		return nil
+	})
+	return
+}
+
 // AddressEvents returns the events of a single address.
-func (s *Store) AddressEvents(address types.Address, offset, limit int) (events []wallet.Event, err error) {
-	err = s.transaction(func(tx *txn) error {
+func (s *Store) AddressEvents(ctx context.Context, address types.Address, offset, limit int) (events []wallet.Event, err error) {
+	err = s.scheduledReadTransaction(ctx, addressQueryKey(), func(tx *txn) error {
 		const query = `
 WITH last_chain_index AS (
     SELECT last_indexed_height+1 AS height FROM global_settings LIMIT 1
@@ -72,16 +104,72 @@ LIMIT $2 OFFSET $3`
 	return
 }
 
+// AddressEventsSince returns the events of a single address confirmed in
+// blocks after the given height, oldest first.
+func (s *Store) AddressEventsSince(ctx context.Context, address types.Address, height uint64, offset, limit int) (events []wallet.Event, err error) {
+	err = s.scheduledReadTransaction(ctx, addressQueryKey(), func(tx *txn) error {
+		const query = `
+WITH last_chain_index AS (
+    SELECT last_indexed_height+1 AS height FROM global_settings LIMIT 1
+)
+SELECT 
+	ev.id, 
+	ev.event_id, 
+	ev.maturity_height, 
+	ev.date_created, 
+	ci.height, 
+	ci.block_id,
+	CASE 
+		WHEN last_chain_index.height < ci.height THEN 0
+		ELSE last_chain_index.height - ci.height
+	END AS confirmations,
+	ev.event_type, 
+	ev.event_data
+FROM events ev
+INNER JOIN event_addresses ea ON (ev.id = ea.event_id)
+INNER JOIN sia_addresses sa ON (ea.address_id = sa.id)
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+CROSS JOIN last_chain_index
+WHERE sa.sia_address = $1 AND ci.height > $2
+ORDER BY ci.height ASC, ev.id ASC
+LIMIT $3 OFFSET $4`
+
+		rows, err := tx.Query(query, encode(address), height, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			event, _, err := scanEvent(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan event: %w", err)
+			}
+			event.Relevant = []types.Address{address}
+			events = append(events, event)
+		}
+		return rows.Err()
+	})
+	return
+}
+
 // AddressSiacoinOutputs returns the unspent siacoin outputs for an address.
 func (s *Store) AddressSiacoinOutputs(address types.Address, index types.ChainIndex, offset, limit int) (siacoins []types.SiacoinElement, err error) {
-	err = s.transaction(func(tx *txn) error {
+	return s.AddressConfirmedSiacoinOutputs(address, index, math.MaxInt64, offset, limit)
+}
+
+// AddressConfirmedSiacoinOutputs returns the unspent siacoin outputs for an
+// address that were created at or below maxHeight.
+func (s *Store) AddressConfirmedSiacoinOutputs(address types.Address, index types.ChainIndex, maxHeight uint64, offset, limit int) (siacoins []types.SiacoinElement, err error) {
+	err = s.readTransaction(func(tx *txn) error {
 		const query = `SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address 
 		FROM siacoin_elements se
 		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
-		WHERE sa.sia_address=$1 AND se.maturity_height <= $2 AND se.spent_index_id IS NULL
-		LIMIT $3 OFFSET $4`
+		INNER JOIN chain_indices ci ON (se.chain_index_id = ci.id)
+		WHERE sa.sia_address=$1 AND se.maturity_height <= $2 AND ci.height <= $3 AND se.spent_index_id IS NULL
+		LIMIT $4 OFFSET $5`
 
-		rows, err := tx.Query(query, encode(address), index.Height, limit, offset)
+		rows, err := tx.Query(query, encode(address), index.Height, maxHeight, limit, offset)
 		if err != nil {
 			return err
 		}
@@ -120,14 +208,21 @@ func (s *Store) AddressSiacoinOutputs(address types.Address, index types.ChainIn
 
 // AddressSiafundOutputs returns the unspent siafund outputs for an address.
 func (s *Store) AddressSiafundOutputs(address types.Address, offset, limit int) (siafunds []types.SiafundElement, err error) {
-	err = s.transaction(func(tx *txn) error {
+	return s.AddressConfirmedSiafundOutputs(address, math.MaxInt64, offset, limit)
+}
+
+// AddressConfirmedSiafundOutputs returns the unspent siafund outputs for an
+// address that were created at or below maxHeight.
+func (s *Store) AddressConfirmedSiafundOutputs(address types.Address, maxHeight uint64, offset, limit int) (siafunds []types.SiafundElement, err error) {
+	err = s.readTransaction(func(tx *txn) error {
 		const query = `SELECT se.id, se.leaf_index, se.merkle_proof, se.siafund_value, se.claim_start, sa.sia_address 
 		FROM siafund_elements se
 		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
-		WHERE sa.sia_address = $1 AND se.spent_index_id IS NULL
-		LIMIT $2 OFFSET $3`
+		INNER JOIN chain_indices ci ON (se.chain_index_id = ci.id)
+		WHERE sa.sia_address = $1 AND ci.height <= $2 AND se.spent_index_id IS NULL
+		LIMIT $3 OFFSET $4`
 
-		rows, err := tx.Query(query, encode(address), limit, offset)
+		rows, err := tx.Query(query, encode(address), maxHeight, limit, offset)
 		if err != nil {
 			return err
 		}
@@ -166,7 +261,7 @@ func (s *Store) AddressSiafundOutputs(address types.Address, offset, limit int)
 // AnnotateV1Events annotates a list of unconfirmed transactions with
 // relevant addresses and siacoin/siafund elements.
 func (s *Store) AnnotateV1Events(index types.ChainIndex, timestamp time.Time, v1 []types.Transaction) (annotated []wallet.Event, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		siacoinElementStmt, err := tx.Prepare(`SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address
 		FROM siacoin_elements se
 		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
@@ -0,0 +1,154 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const balanceAlarmColumns = `ba.id, ba.wallet_id, sa.sia_address, ba.low_balance, ba.high_balance, ba.state, ba.date_created, ba.date_triggered`
+
+// encodeOptionalCurrency encodes c, or returns nil if c is nil.
+func encodeOptionalCurrency(c *types.Currency) any {
+	if c == nil {
+		return nil
+	}
+	return encode(*c)
+}
+
+// decodeOptionalCurrency decodes a nullable currency column.
+func decodeOptionalCurrency(buf []byte) (*types.Currency, error) {
+	if buf == nil {
+		return nil, nil
+	}
+	c := new(types.Currency)
+	if err := decode(c).Scan(buf); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func scanBalanceAlarm(s scanner) (a wallet.BalanceAlarm, err error) {
+	var addr, low, high []byte
+	if err := s.Scan(&a.ID, &a.WalletID, &addr, &low, &high, &a.State, decode(&a.DateCreated), decode(&a.DateTriggered)); err != nil {
+		return wallet.BalanceAlarm{}, err
+	}
+	if addr != nil {
+		a.Address = new(types.Address)
+		if err := decode(a.Address).Scan(addr); err != nil {
+			return wallet.BalanceAlarm{}, fmt.Errorf("failed to decode address: %w", err)
+		}
+	}
+	if a.Low, err = decodeOptionalCurrency(low); err != nil {
+		return wallet.BalanceAlarm{}, fmt.Errorf("failed to decode low balance: %w", err)
+	} else if a.High, err = decodeOptionalCurrency(high); err != nil {
+		return wallet.BalanceAlarm{}, fmt.Errorf("failed to decode high balance: %w", err)
+	}
+	return a, nil
+}
+
+func queryBalanceAlarms(tx *txn, query string, args ...any) (alarms []wallet.BalanceAlarm, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanBalanceAlarm(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan balance alarm: %w", err)
+		}
+		alarms = append(alarms, a)
+	}
+	return alarms, rows.Err()
+}
+
+// AddBalanceAlarm adds a balance alarm to a wallet. If the alarm watches an
+// address, the address must be in the wallet.
+func (s *Store) AddBalanceAlarm(a wallet.BalanceAlarm) (wallet.BalanceAlarm, error) {
+	err := s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, a.WalletID); err != nil {
+			return err
+		}
+
+		var addressID any
+		if a.Address != nil {
+			var id int64
+			err := tx.QueryRow(`SELECT sa.id FROM sia_addresses sa
+INNER JOIN wallet_addresses wa ON sa.id = wa.address_id
+WHERE wa.wallet_id=$1 AND sa.sia_address=$2`, a.WalletID, encode(*a.Address)).Scan(&id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("address %v is not in wallet %v: %w", *a.Address, a.WalletID, wallet.ErrNotFound)
+			} else if err != nil {
+				return fmt.Errorf("failed to get address: %w", err)
+			}
+			addressID = id
+		}
+
+		const query = `INSERT INTO wallet_balance_alarms (wallet_id, address_id, low_balance, high_balance, state, date_created, date_triggered) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		return tx.QueryRow(query, a.WalletID, addressID, encodeOptionalCurrency(a.Low), encodeOptionalCurrency(a.High), a.State, encode(a.DateCreated), encode(a.DateTriggered)).Scan(&a.ID)
+	})
+	return a, err
+}
+
+// WalletBalanceAlarms returns a wallet's balance alarms.
+func (s *Store) WalletBalanceAlarms(walletID wallet.ID) (alarms []wallet.BalanceAlarm, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		alarms, err = queryBalanceAlarms(tx, `SELECT `+balanceAlarmColumns+` FROM wallet_balance_alarms ba
+LEFT JOIN sia_addresses sa ON ba.address_id = sa.id
+WHERE ba.wallet_id=$1
+ORDER BY ba.id ASC`, walletID)
+		return err
+	})
+	return
+}
+
+// BalanceAlarms returns the balance alarms of every wallet.
+func (s *Store) BalanceAlarms() (alarms []wallet.BalanceAlarm, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		alarms, err = queryBalanceAlarms(tx, `SELECT `+balanceAlarmColumns+` FROM wallet_balance_alarms ba
+LEFT JOIN sia_addresses sa ON ba.address_id = sa.id
+ORDER BY ba.id ASC`)
+		return err
+	})
+	return
+}
+
+// RemoveBalanceAlarm removes a wallet's balance alarm.
+func (s *Store) RemoveBalanceAlarm(walletID wallet.ID, id wallet.AlarmID) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM wallet_balance_alarms WHERE id=$1 AND wallet_id=$2`, id, walletID)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrAlarmNotFound
+		}
+		return nil
+	})
+}
+
+// UpdateBalanceAlarmState sets the state of a balance alarm and the time it
+// last triggered.
+func (s *Store) UpdateBalanceAlarmState(id wallet.AlarmID, state string, triggered time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE wallet_balance_alarms SET state=$1, date_triggered=$2 WHERE id=$3`, state, encode(triggered), id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrAlarmNotFound
+		}
+		return nil
+	})
+}
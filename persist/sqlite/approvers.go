@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/walletd/approver"
+)
+
+// AddApprover adds a paired approver to the database.
+func (s *Store) AddApprover(a approver.Approver) (approver.Approver, error) {
+	err := s.transaction(func(tx *txn) error {
+		return tx.QueryRow(`INSERT INTO approvers (name, shared_key, date_created) VALUES ($1, $2, $3) RETURNING id`, a.Name, a.Key[:], encode(a.DateCreated)).Scan(&a.ID)
+	})
+	return a, err
+}
+
+// Approver returns a paired approver.
+func (s *Store) Approver(id int64) (a approver.Approver, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		var key []byte
+		err := tx.QueryRow(`SELECT id, name, shared_key, date_created FROM approvers WHERE id=$1`, id).Scan(&a.ID, &a.Name, &key, decode(&a.DateCreated))
+		if errors.Is(err, sql.ErrNoRows) {
+			return approver.ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		copy(a.Key[:], key)
+		return nil
+	})
+	return
+}
+
+// Approvers returns all paired approvers.
+func (s *Store) Approvers() (approvers []approver.Approver, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT id, name, shared_key, date_created FROM approvers ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var a approver.Approver
+			var key []byte
+			if err := rows.Scan(&a.ID, &a.Name, &key, decode(&a.DateCreated)); err != nil {
+				return fmt.Errorf("failed to scan approver: %w", err)
+			}
+			copy(a.Key[:], key)
+			approvers = append(approvers, a)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// RemoveApprover removes a paired approver from the database.
+func (s *Store) RemoveApprover(id int64) error {
+	return s.transaction(func(tx *txn) error {
+		var dummyID int64
+		err := tx.QueryRow(`DELETE FROM approvers WHERE id=$1 RETURNING id`, id).Scan(&dummyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return approver.ErrNotFound
+		}
+		return err
+	})
+}
@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+)
+
+// WalletStateRoot returns the last indexed chain index and the state root of
+// the addresses of all wallets at that index. The root is the hash of each
+// address and its siacoin, immature siacoin, and siafund balances, in
+// address order, so it does not depend on wallet IDs or names.
+func (s *Store) WalletStateRoot() (index types.ChainIndex, root types.Hash256, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := tx.QueryRow(`SELECT last_indexed_height, last_indexed_id FROM global_settings`).Scan(&index.Height, decode(&index.ID)); err != nil {
+			return fmt.Errorf("failed to get last indexed tip: %w", err)
+		}
+
+		const query = `SELECT sa.sia_address, sa.siacoin_balance, sa.immature_siacoin_balance, sa.siafund_balance FROM sia_addresses sa
+WHERE sa.id IN (SELECT address_id FROM wallet_addresses)
+ORDER BY sa.sia_address ASC`
+		rows, err := tx.Query(query)
+		if err != nil {
+			return fmt.Errorf("failed to query address balances: %w", err)
+		}
+		defer rows.Close()
+
+		h := types.NewHasher()
+		h.WriteDistinguisher("walletd/stateroot")
+		for rows.Next() {
+			var addr types.Address
+			var siacoins, immature types.Currency
+			var siafunds uint64
+			if err := rows.Scan(decode(&addr), decode(&siacoins), decode(&immature), &siafunds); err != nil {
+				return fmt.Errorf("failed to scan address balance: %w", err)
+			}
+			h.E.Write(addr[:])
+			h.E.WriteUint64(siacoins.Lo)
+			h.E.WriteUint64(siacoins.Hi)
+			h.E.WriteUint64(immature.Lo)
+			h.E.WriteUint64(immature.Hi)
+			h.E.WriteUint64(siafunds)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		root = h.Sum()
+		return nil
+	})
+	return
+}
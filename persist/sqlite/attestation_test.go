@@ -0,0 +1,68 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWalletStateRoot(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	openDB := func() *Store {
+		t.Helper()
+		db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	stateRoot := func(db *Store) types.Hash256 {
+		t.Helper()
+		_, root, err := db.WalletStateRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	addr1 := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	addr2 := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+
+	// add the same addresses to differently named wallets in a different
+	// order
+	db1, db2 := openDB(), openDB()
+	for _, a := range []struct {
+		db    *Store
+		name  string
+		addrs []types.Address
+	}{
+		{db1, "a", []types.Address{addr1, addr2}},
+		{db2, "unused", nil},
+		{db2, "b", []types.Address{addr2}},
+		{db2, "c", []types.Address{addr1}},
+	} {
+		w, err := a.db.AddWallet(wallet.Wallet{Name: a.name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, addr := range a.addrs {
+			if _, err := a.db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if stateRoot(db1) != stateRoot(db2) {
+		t.Fatal("expected state roots to match")
+	}
+
+	// a balance change changes the root
+	if _, err := db2.writer.db.Exec(`UPDATE sia_addresses SET siacoin_balance=$1 WHERE sia_address=$2`, encode(types.Siacoins(1)), encode(addr1)); err != nil {
+		t.Fatal(err)
+	} else if stateRoot(db1) == stateRoot(db2) {
+		t.Fatal("expected state roots to differ")
+	}
+}
@@ -0,0 +1,184 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/coreutils/chain"
+	"go.thebigfile.com/coreutils/testutil"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// benchBlocks is the number of blocks mined for each benchmark.
+	benchBlocks = 50
+	// benchPayouts is the number of wallet addresses paid by each block.
+	benchPayouts = 100
+)
+
+// benchScales are the numbers of wallet addresses the benchmarks are run
+// with. Scales above 1k are skipped in short mode.
+var benchScales = []int{1_000, 100_000, 1_000_000}
+
+func benchScaleName(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%dM", n/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%dk", n/1_000)
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+// mineBlockPayouts returns a block that splits the block reward between the
+// addresses.
+func mineBlockPayouts(state consensus.State, addrs []types.Address) types.Block {
+	reward := state.BlockReward()
+	share := reward.Div64(uint64(len(addrs)))
+	b := types.Block{
+		ParentID:  state.Index.ID,
+		Timestamp: types.CurrentTimestamp(),
+	}
+	for _, addr := range addrs {
+		b.MinerPayouts = append(b.MinerPayouts, types.SiacoinOutput{Address: addr, Value: share})
+	}
+	// the remainder goes to the first payout
+	b.MinerPayouts[0].Value = b.MinerPayouts[0].Value.Add(reward.Sub(share.Mul64(uint64(len(addrs)))))
+	for b.ID().CmpWork(state.ChildTarget) < 0 {
+		b.Nonce += state.NonceFactor()
+	}
+	return b
+}
+
+// newBenchChain returns a chain of benchBlocks blocks, each paying
+// benchPayouts of the addresses.
+func newBenchChain(tb testing.TB, addrs []types.Address) *chain.Manager {
+	network, genesisBlock := testutil.Network()
+	store, genesisState, err := chain.NewDBStore(chain.NewMemDB(), network, genesisBlock)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	cm := chain.NewManager(store, genesisState)
+	for i := 0; i < benchBlocks; i++ {
+		payees := make([]types.Address, benchPayouts)
+		for j := range payees {
+			payees[j] = addrs[frand.Intn(len(addrs))]
+		}
+		if err := cm.AddBlocks([]types.Block{mineBlockPayouts(cm.TipState(), payees)}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return cm
+}
+
+// newBenchStore returns a store with a wallet containing the addresses. The
+// addresses are added in a single transaction to keep setup fast at large
+// scales.
+func newBenchStore(tb testing.TB, addrs []types.Address) (*Store, wallet.ID) {
+	db, err := OpenDatabase(filepath.Join(tb.TempDir(), "walletd.sqlite3"), zap.NewNop())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "bench"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	err = db.transaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`INSERT INTO wallet_addresses (wallet_id, address_id, description) VALUES ($1, $2, '')`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, addr := range addrs {
+			addressID, err := insertAddress(tx, addr)
+			if err != nil {
+				return fmt.Errorf("failed to insert address: %w", err)
+			} else if _, err := stmt.Exec(w.ID, addressID); err != nil {
+				return fmt.Errorf("failed to add wallet address: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db, w.ID
+}
+
+func benchAddresses(n int) []types.Address {
+	addrs := make([]types.Address, n)
+	for i := range addrs {
+		addrs[i] = frand.Entropy256()
+	}
+	return addrs
+}
+
+// runScales runs fn as a sub-benchmark at each scale.
+func runScales(b *testing.B, fn func(b *testing.B, addrs []types.Address)) {
+	for _, n := range benchScales {
+		b.Run(benchScaleName(n), func(b *testing.B) {
+			if testing.Short() && n > 1_000 {
+				b.Skip("skipping large scale in short mode")
+			}
+			fn(b, benchAddresses(n))
+		})
+	}
+}
+
+// BenchmarkScan measures rescan throughput: indexing a chain into a fresh
+// store with a large wallet.
+func BenchmarkScan(b *testing.B) {
+	runScales(b, func(b *testing.B, addrs []types.Address) {
+		cm := newBenchChain(b, addrs)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			db, _ := newBenchStore(b, addrs)
+			b.StartTimer()
+			syncDB(b, db, cm)
+		}
+		b.ReportMetric(float64(benchBlocks*b.N)/b.Elapsed().Seconds(), "blocks/s")
+	})
+}
+
+// BenchmarkWalletEvents measures the latency of querying a page of a large
+// wallet's events.
+func BenchmarkWalletEvents(b *testing.B) {
+	runScales(b, func(b *testing.B, addrs []types.Address) {
+		cm := newBenchChain(b, addrs)
+		db, id := newBenchStore(b, addrs)
+		syncDB(b, db, cm)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := db.WalletEvents(context.Background(), id, 0, 100); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkWalletBalance measures the latency of computing a large wallet's
+// balance.
+func BenchmarkWalletBalance(b *testing.B) {
+	runScales(b, func(b *testing.B, addrs []types.Address) {
+		cm := newBenchChain(b, addrs)
+		db, id := newBenchStore(b, addrs)
+		syncDB(b, db, cm)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := db.WalletBalance(id); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// catchUpBatchSize is the number of deferred events classified and enriched
+// per transaction when catch-up mode ends.
+const catchUpBatchSize = 1000
+
+// deferredEvents returns up to limit events added after the event with the
+// given ID, oldest first, along with their database IDs.
+func deferredEvents(tx *txn, after int64, limit int) (events []wallet.Event, ids []int64, err error) {
+	const query = `WITH last_chain_index AS (
+	SELECT last_indexed_height+1 AS height FROM global_settings LIMIT 1
+)
+SELECT ev.id, ev.event_id, ev.maturity_height, ev.date_created, ci.height, ci.block_id,
+	CASE
+		WHEN last_chain_index.height < ci.height THEN 0
+		ELSE last_chain_index.height - ci.height
+	END AS confirmations,
+	ev.event_type, ev.event_data
+FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+CROSS JOIN last_chain_index
+WHERE ev.id > $1
+ORDER BY ev.id ASC
+LIMIT $2`
+
+	rows, err := tx.Query(query, after, limit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, id, err := scanEvent(rows)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// classification rules match on the event's relevant addresses
+	stmt, err := tx.Prepare(`SELECT sa.sia_address FROM event_addresses ea
+INNER JOIN sia_addresses sa ON (ea.address_id = sa.id)
+WHERE ea.event_id=$1`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+	for i := range events {
+		rows, err := stmt.Query(ids[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to query relevant addresses: %w", err)
+		}
+		for rows.Next() {
+			var addr types.Address
+			if err := rows.Scan(decode(&addr)); err != nil {
+				rows.Close()
+				return nil, nil, fmt.Errorf("failed to scan relevant address: %w", err)
+			}
+			events[i].Relevant = append(events[i].Relevant, addr)
+		}
+		if err := rows.Close(); err != nil {
+			return nil, nil, err
+		}
+	}
+	return events, ids, nil
+}
+
+// indexDeferredEvents classifies and enriches up to catchUpBatchSize events
+// added after the event with the given ID. It returns the ID of the last
+// event indexed and the number of events indexed.
+func indexDeferredEvents(tx *txn, after int64, enrichers []wallet.NamedEnricher, log *zap.Logger) (last int64, n int, err error) {
+	events, ids, err := deferredEvents(tx, after, catchUpBatchSize)
+	if err != nil {
+		return 0, 0, err
+	} else if len(events) == 0 {
+		return after, 0, nil
+	}
+
+	rules, err := classificationRules(tx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get classification rules: %w", err)
+	}
+	categoryStmt, err := tx.Prepare(`INSERT INTO event_categories (event_id, category) VALUES ($1, $2) ON CONFLICT (event_id, category) DO NOTHING`)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to prepare category statement: %w", err)
+	}
+	defer categoryStmt.Close()
+
+	for i, event := range events {
+		if err := classifyEvent(categoryStmt, rules, ids[i], event); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := addEventEnrichments(tx, events, enrichers, log); err != nil {
+		return 0, 0, fmt.Errorf("failed to add event enrichments: %w", err)
+	}
+	return ids[len(ids)-1], len(events), nil
+}
+
+// CatchingUp returns true if the store is in catch-up mode.
+func (s *Store) CatchingUp() (catchingUp bool, err error) {
+	err = s.reader.db.QueryRow(`SELECT deferred_index_event_id IS NOT NULL FROM global_settings`).Scan(&catchingUp)
+	return
+}
+
+// SetCatchingUp enables or disables catch-up mode. While catching up, new
+// events are stored without categories or enrichments. Disabling catch-up
+// mode classifies and enriches the events added while it was enabled, in
+// batches, so that chain updates are not blocked for long. Catch-up mode is
+// persisted, so deferred events are indexed even if walletd restarts before
+// it ends.
+func (s *Store) SetCatchingUp(catchingUp bool) error {
+	if catchingUp {
+		return s.transaction(func(tx *txn) error {
+			_, err := tx.Exec(`UPDATE global_settings SET deferred_index_event_id=(SELECT COALESCE(MAX(id), 0) FROM events) WHERE deferred_index_event_id IS NULL`)
+			if err != nil {
+				return fmt.Errorf("failed to enable catch-up mode: %w", err)
+			}
+			return nil
+		})
+	}
+
+	log := s.log.Named("catchUp")
+	var indexed int
+	for {
+		var done bool
+		err := s.transaction(func(tx *txn) error {
+			var after sql.NullInt64
+			if err := tx.QueryRow(`SELECT deferred_index_event_id FROM global_settings`).Scan(&after); err != nil {
+				return fmt.Errorf("failed to get deferred events: %w", err)
+			} else if !after.Valid {
+				done = true
+				return nil
+			}
+
+			last, n, err := indexDeferredEvents(tx, after.Int64, s.enrichers, log)
+			if err != nil {
+				return fmt.Errorf("failed to index deferred events: %w", err)
+			}
+			indexed += n
+
+			// the column is cleared once every deferred event is indexed
+			more := n == catchUpBatchSize
+			next := sql.NullInt64{Int64: last, Valid: more}
+			if _, err := tx.Exec(`UPDATE global_settings SET deferred_index_event_id=$1`, next); err != nil {
+				return fmt.Errorf("failed to update deferred events: %w", err)
+			}
+			done = !more
+			return nil
+		})
+		if err != nil {
+			return err
+		} else if done {
+			log.Debug("indexed deferred events", zap.Int("events", indexed))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCatchUpDeferredIndexes(t *testing.T) {
+	enrichers := []wallet.NamedEnricher{
+		{Name: "source", Enricher: wallet.EventEnricherFunc(func(_ context.Context, _ wallet.Event, fields map[string]string) error {
+			fields["source"] = "pool"
+			return nil
+		})},
+	}
+
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log, WithEventEnrichers(enrichers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.AddClassificationRule(wallet.ClassificationRule{
+		Name:     "payouts",
+		Category: "mining",
+		Types:    []string{wallet.EventTypeMinerPayout},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	applyPayout := func(height uint64) {
+		t.Helper()
+		index := types.ChainIndex{Height: height, ID: types.BlockID{byte(height)}}
+		event := wallet.Event{
+			ID:        types.Hash256{byte(height)},
+			Index:     index,
+			Type:      wallet.EventTypeMinerPayout,
+			Timestamp: time.Unix(int64(height), 0),
+			Data: wallet.EventPayout{SiacoinElement: types.SiacoinElement{
+				SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(1)},
+			}},
+			Relevant: []types.Address{addr},
+		}
+		catchingUp, err := db.CatchingUp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.transaction(func(tx *txn) error {
+			utx := &updateTx{
+				indexMode:      wallet.IndexModeFull,
+				eventRetention: wallet.EventRetentionFull,
+				enrichers:      db.enrichers,
+				deferIndexes:   catchingUp,
+
+				tx:                tx,
+				relevantAddresses: make(map[types.Address]bool),
+			}
+			return utx.ApplyIndex(index, wallet.AppliedState{Events: []wallet.Event{event}})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertIndexed := func(expected map[types.Hash256]bool) {
+		t.Helper()
+		ids := []types.Hash256{{1}, {2}, {3}}
+		categories, err := db.EventCategories(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		enrichments, err := db.EventEnrichments(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			if expected[id] != reflect.DeepEqual(categories[id], []string{"mining"}) {
+				t.Fatalf("event %v: expected classified %v, got categories %v", id, expected[id], categories[id])
+			} else if expected[id] != (enrichments[id]["source"] == "pool") {
+				t.Fatalf("event %v: expected enriched %v, got %v", id, expected[id], enrichments[id])
+			}
+		}
+	}
+
+	applyPayout(1)
+	if err := db.SetCatchingUp(true); err != nil {
+		t.Fatal(err)
+	} else if catchingUp, err := db.CatchingUp(); err != nil {
+		t.Fatal(err)
+	} else if !catchingUp {
+		t.Fatal("expected catch-up mode")
+	}
+
+	// events applied while catching up are not classified or enriched
+	applyPayout(2)
+	applyPayout(3)
+	assertIndexed(map[types.Hash256]bool{{1}: true})
+
+	// ending catch-up mode indexes the deferred events
+	if err := db.SetCatchingUp(false); err != nil {
+		t.Fatal(err)
+	} else if catchingUp, err := db.CatchingUp(); err != nil {
+		t.Fatal(err)
+	} else if catchingUp {
+		t.Fatal("expected catch-up mode to end")
+	}
+	assertIndexed(map[types.Hash256]bool{{1}: true, {2}: true, {3}: true})
+}
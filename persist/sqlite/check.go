@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// A DatabaseCheck is the result of checking a database file.
+type DatabaseCheck struct {
+	// Version is the schema version of the database and Expected is the
+	// version this build of walletd migrates it to.
+	Version  int64
+	Expected int64
+	// Problems are the issues reported by SQLite's integrity check. A
+	// healthy database has no problems.
+	Problems []string
+}
+
+// CheckDatabase opens the database at fp read-only and checks its schema
+// version and integrity. The database is not created or migrated, so it is
+// safe to check while walletd is running.
+func CheckDatabase(fp string) (DatabaseCheck, error) {
+	if _, err := os.Stat(fp); err != nil {
+		return DatabaseCheck{}, err
+	}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", fp, busyTimeout))
+	if err != nil {
+		return DatabaseCheck{}, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	check := DatabaseCheck{
+		Version:  getDBVersion(db),
+		Expected: int64(len(migrations) + 1),
+	}
+	rows, err := db.Query(`PRAGMA quick_check`)
+	if err != nil {
+		return DatabaseCheck{}, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return DatabaseCheck{}, fmt.Errorf("failed to scan integrity check: %w", err)
+		} else if msg != "ok" {
+			check.Problems = append(check.Problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return DatabaseCheck{}, fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	return check, nil
+}
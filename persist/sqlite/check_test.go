@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCheckDatabase(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+
+	if _, err := CheckDatabase(filepath.Join(dir, "missing.db")); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+
+	fp := filepath.Join(dir, "test.db")
+	db, err := OpenDatabase(fp, log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the database can be checked while it is open
+	check, err := CheckDatabase(fp)
+	if err != nil {
+		t.Fatal(err)
+	} else if check.Version != check.Expected {
+		t.Fatalf("expected version %d, got %d", check.Expected, check.Version)
+	} else if len(check.Problems) != 0 {
+		t.Fatalf("expected no problems, got %v", check.Problems)
+	}
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, make([]byte, 4096), 0600); err != nil {
+		t.Fatal(err)
+	} else if _, err := CheckDatabase(garbage); err == nil {
+		t.Fatal("expected error for invalid database")
+	}
+}
@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// ruleConditions are the conditions of a classification rule, stored as
+// JSON.
+type ruleConditions struct {
+	Types        []string        `json:"types,omitempty"`
+	Counterparty *types.Address  `json:"counterparty,omitempty"`
+	Role         string          `json:"role,omitempty"`
+	MinAmount    *types.Currency `json:"minAmount,omitempty"`
+	MaxAmount    *types.Currency `json:"maxAmount,omitempty"`
+	Memo         string          `json:"memo,omitempty"`
+}
+
+func scanClassificationRule(s scanner) (r wallet.ClassificationRule, err error) {
+	var buf []byte
+	if err := s.Scan(&r.ID, &r.Name, &r.Category, &buf, decode(&r.DateCreated)); err != nil {
+		return wallet.ClassificationRule{}, err
+	}
+	var rc ruleConditions
+	if err := json.Unmarshal(buf, &rc); err != nil {
+		return wallet.ClassificationRule{}, fmt.Errorf("failed to decode conditions: %w", err)
+	}
+	r.Types, r.Counterparty, r.Role, r.MinAmount, r.MaxAmount, r.Memo = rc.Types, rc.Counterparty, rc.Role, rc.MinAmount, rc.MaxAmount, rc.Memo
+	return r, nil
+}
+
+// classificationRules returns every classification rule, oldest first.
+func classificationRules(tx *txn) (rules []wallet.ClassificationRule, err error) {
+	rows, err := tx.Query(`SELECT id, name, category, conditions, date_created FROM classification_rules ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanClassificationRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan classification rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// ClassificationRules returns every classification rule, oldest first.
+func (s *Store) ClassificationRules() (rules []wallet.ClassificationRule, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rules, err = classificationRules(tx)
+		return err
+	})
+	return
+}
+
+// AddClassificationRule adds a classification rule and returns it with its
+// ID set.
+func (s *Store) AddClassificationRule(r wallet.ClassificationRule) (wallet.ClassificationRule, error) {
+	buf, err := json.Marshal(ruleConditions{
+		Types:        r.Types,
+		Counterparty: r.Counterparty,
+		Role:         r.Role,
+		MinAmount:    r.MinAmount,
+		MaxAmount:    r.MaxAmount,
+		Memo:         r.Memo,
+	})
+	if err != nil {
+		return wallet.ClassificationRule{}, fmt.Errorf("failed to encode conditions: %w", err)
+	}
+	err = s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO classification_rules (name, category, conditions, date_created) VALUES ($1, $2, $3, $4) RETURNING id`
+		return tx.QueryRow(query, r.Name, r.Category, buf, encode(r.DateCreated)).Scan(&r.ID)
+	})
+	return r, err
+}
+
+// DeleteClassificationRule deletes a classification rule.
+func (s *Store) DeleteClassificationRule(id wallet.RuleID) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM classification_rules WHERE id=$1`, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrRuleNotFound
+		}
+		return nil
+	})
+}
+
+// EventCategories returns the categories attached to each of the events.
+// Events without categories are omitted.
+func (s *Store) EventCategories(eventIDs []types.Hash256) (categories map[types.Hash256][]string, err error) {
+	categories = make(map[types.Hash256][]string)
+	err = s.readTransaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`SELECT ec.category FROM event_categories ec
+INNER JOIN events ev ON (ec.event_id = ev.id)
+WHERE ev.event_id=$1
+ORDER BY ec.category ASC`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, id := range eventIDs {
+			if _, ok := categories[id]; ok {
+				continue
+			}
+			rows, err := stmt.Query(encode(id))
+			if err != nil {
+				return fmt.Errorf("failed to query categories: %w", err)
+			}
+			for rows.Next() {
+				var category string
+				if err := rows.Scan(&category); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan category: %w", err)
+				}
+				categories[id] = append(categories[id], category)
+			}
+			if err := rows.Err(); err != nil {
+				rows.Close()
+				return err
+			}
+			rows.Close()
+		}
+		return nil
+	})
+	return
+}
+
+// WalletCategoryEvents returns the events relevant to a wallet with the
+// given category, sorted by height descending.
+func (s *Store) WalletCategoryEvents(ctx context.Context, id wallet.ID, category string, offset, limit int) (events []wallet.Event, err error) {
+	err = s.scheduledReadTransaction(ctx, walletQueryKey(id), func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		var dbIDs []int64
+		events, dbIDs, err = getWalletEvents(tx, id, category, offset, limit)
+		if err != nil {
+			return fmt.Errorf("failed to get wallet events: %w", err)
+		}
+
+		eventRelevantAddresses, err := s.getWalletEventRelevantAddresses(tx, id, dbIDs)
+		if err != nil {
+			return fmt.Errorf("failed to get relevant addresses: %w", err)
+		}
+		for i := range events {
+			events[i].Relevant = eventRelevantAddresses[dbIDs[i]]
+		}
+		return nil
+	})
+	return
+}
+
+// classifyEvent attaches the categories of the matching rules to an event.
+func classifyEvent(stmt *stmt, rules []wallet.ClassificationRule, eventID int64, event wallet.Event) error {
+	for _, category := range wallet.Classify(rules, event) {
+		if _, err := stmt.Exec(eventID, category); err != nil {
+			return fmt.Errorf("failed to add event category: %w", err)
+		}
+	}
+	return nil
+}
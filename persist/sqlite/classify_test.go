@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestClassificationRules(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "books"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	minPayout := types.Siacoins(100)
+	mining, err := db.AddClassificationRule(wallet.ClassificationRule{
+		Name:      "large payouts",
+		Category:  "mining",
+		Types:     []string{wallet.EventTypeMinerPayout},
+		MinAmount: &minPayout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoices, err := db.AddClassificationRule(wallet.ClassificationRule{
+		Name:     "invoices",
+		Category: "invoices",
+		Memo:     "INVOICE",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules, err := db.ClassificationRules()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rules) != 2 || rules[0].ID != mining.ID || rules[1].ID != invoices.ID {
+		t.Fatalf("unexpected rules %+v", rules)
+	} else if rules[0].MinAmount == nil || !rules[0].MinAmount.Equals(minPayout) {
+		t.Fatalf("expected min amount %v, got %v", minPayout, rules[0].MinAmount)
+	}
+
+	index := types.ChainIndex{Height: 10, ID: types.BlockID{10}}
+	payout := func(id byte, value types.Currency) wallet.Event {
+		return wallet.Event{
+			ID:        types.Hash256{id},
+			Index:     index,
+			Type:      wallet.EventTypeMinerPayout,
+			Timestamp: time.Unix(int64(id), 0),
+			Data: wallet.EventPayout{SiacoinElement: types.SiacoinElement{
+				SiacoinOutput: types.SiacoinOutput{Address: addr, Value: value},
+			}},
+			Relevant: []types.Address{addr},
+		}
+	}
+	events := []wallet.Event{
+		payout(1, types.Siacoins(300)),
+		payout(2, types.Siacoins(50)),
+		{
+			ID:        types.Hash256{3},
+			Index:     index,
+			Type:      wallet.EventTypeV1Transaction,
+			Timestamp: time.Unix(3, 0),
+			Data: wallet.EventV1Transaction{Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(1)}},
+				ArbitraryData:  [][]byte{[]byte("Invoice #42")},
+			}},
+			Relevant: []types.Address{addr},
+		},
+	}
+	err = db.transaction(func(tx *txn) error {
+		var indexID int64
+		if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(index.ID), index.Height).Scan(&indexID); err != nil {
+			return err
+		}
+		return addEvents(tx, events, indexID, wallet.EventRetentionFull, true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories, err := db.EventCategories([]types.Hash256{{1}, {2}, {3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[types.Hash256][]string{
+		{1}: {"mining"},
+		{3}: {"invoices"},
+	}
+	if !reflect.DeepEqual(categories, expected) {
+		t.Fatalf("expected categories %v, got %v", expected, categories)
+	}
+
+	filtered, err := db.WalletCategoryEvents(context.Background(), w.ID, "invoices", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(filtered) != 1 || filtered[0].ID != (types.Hash256{3}) {
+		t.Fatalf("expected event 3, got %v", filtered)
+	}
+	all, err := db.WalletCategoryEvents(context.Background(), w.ID, "", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(all) != 3 {
+		t.Fatalf("expected 3 events, got %v", len(all))
+	}
+
+	// deleting a rule keeps the categories it attached
+	if err := db.DeleteClassificationRule(mining.ID); err != nil {
+		t.Fatal(err)
+	} else if err := db.DeleteClassificationRule(mining.ID); !errors.Is(err, wallet.ErrRuleNotFound) {
+		t.Fatalf("expected ErrRuleNotFound, got %v", err)
+	}
+	filtered, err = db.WalletCategoryEvents(context.Background(), w.ID, "mining", 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(filtered) != 1 || filtered[0].ID != (types.Hash256{1}) {
+		t.Fatalf("expected event 1, got %v", filtered)
+	}
+}
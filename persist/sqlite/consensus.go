@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"go.thebigfile.com/walletd/wallet"
 	"go.thebigfile.com/core/consensus"
@@ -14,7 +15,12 @@ import (
 )
 
 type updateTx struct {
-	indexMode wallet.IndexMode
+	indexMode      wallet.IndexMode
+	eventRetention wallet.EventRetention
+	enrichers      []wallet.NamedEnricher
+	// deferIndexes is true in catch-up mode. Events are stored without
+	// categories or enrichments, which are added when catch-up mode ends.
+	deferIndexes bool
 
 	tx                *txn
 	relevantAddresses map[types.Address]bool
@@ -134,8 +140,12 @@ func (ut *updateTx) ApplyIndex(index types.ChainIndex, state wallet.AppliedState
 		return fmt.Errorf("failed to add siafund elements: %w", err)
 	}
 
-	if err := addEvents(tx, state.Events, indexID); err != nil {
+	if err := addEvents(tx, state.Events, indexID, ut.eventRetention, !ut.deferIndexes); err != nil {
 		return fmt.Errorf("failed to add events: %w", err)
+	} else if ut.deferIndexes {
+		return nil
+	} else if err := addEventEnrichments(tx, state.Events, ut.enrichers, log.Named("enrichEvents")); err != nil {
+		return fmt.Errorf("failed to add event enrichments: %w", err)
 	}
 	return nil
 }
@@ -172,11 +182,16 @@ func (s *Store) UpdateChainState(reverted []chain.RevertUpdate, applied []chain.
 	log := s.log.Named("UpdateChainState").With(zap.Int("revertedUpdates", len(reverted)), zap.Int("appliedUpdates", len(applied)))
 	return s.transaction(func(tx *txn) error {
 		utx := &updateTx{
-			indexMode: s.indexMode,
+			indexMode:      s.indexMode,
+			eventRetention: s.eventRetention,
+			enrichers:      s.enrichers,
 
 			tx:                tx,
 			relevantAddresses: make(map[types.Address]bool),
 		}
+		if err := tx.QueryRow(`SELECT deferred_index_event_id IS NOT NULL FROM global_settings`).Scan(&utx.deferIndexes); err != nil {
+			return fmt.Errorf("failed to get catch-up mode: %w", err)
+		}
 
 		if err := wallet.UpdateChainState(utx, reverted, applied, s.indexMode, log); err != nil {
 			return err
@@ -219,20 +234,20 @@ func (s *Store) UpdateChainState(reverted []chain.RevertUpdate, applied []chain.
 
 // LastCommittedIndex returns the last chain index that was committed.
 func (s *Store) LastCommittedIndex() (index types.ChainIndex, err error) {
-	err = s.db.QueryRow(`SELECT last_indexed_height, last_indexed_id FROM global_settings`).Scan(&index.Height, decode(&index.ID))
+	err = s.reader.db.QueryRow(`SELECT last_indexed_height, last_indexed_id FROM global_settings`).Scan(&index.Height, decode(&index.ID))
 	return
 }
 
 // ResetLastIndex resets the last indexed tip to trigger a full rescan.
 func (s *Store) ResetLastIndex() error {
-	_, err := s.db.Exec(`UPDATE global_settings SET last_indexed_height=0, last_indexed_id=$1`, encode(types.BlockID{}))
+	_, err := s.writer.db.Exec(`UPDATE global_settings SET last_indexed_height=0, last_indexed_id=$1`, encode(types.BlockID{}))
 	return err
 }
 
 // IndexMode returns the current index mode.
 func (s *Store) IndexMode() (wallet.IndexMode, error) {
 	var mode wallet.IndexMode
-	err := s.db.QueryRow(`SELECT index_mode FROM global_settings`).Scan(&mode)
+	err := s.reader.db.QueryRow(`SELECT index_mode FROM global_settings`).Scan(&mode)
 	return mode, err
 }
 
@@ -1048,12 +1063,12 @@ func revertSpentSiafundElements(tx *txn, elements []types.SiafundElement) error
 	return nil
 }
 
-func addEvents(tx *txn, events []wallet.Event, indexID int64) error {
+func addEvents(tx *txn, events []wallet.Event, indexID int64, retention wallet.EventRetention, classify bool) error {
 	if len(events) == 0 {
 		return nil
 	}
 
-	insertEventStmt, err := tx.Prepare(`INSERT INTO events (event_id, maturity_height, date_created, event_type, event_data, chain_index_id) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (event_id) DO NOTHING RETURNING id`)
+	insertEventStmt, err := tx.Prepare(`INSERT INTO events (event_id, maturity_height, date_created, event_type, event_data, summarized, chain_index_id) VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (event_id) DO NOTHING RETURNING id`)
 	if err != nil {
 		return fmt.Errorf("failed to prepare event statement: %w", err)
 	}
@@ -1071,9 +1086,43 @@ func addEvents(tx *txn, events []wallet.Event, indexID int64) error {
 	}
 	defer relevantAddrStmt.Close()
 
+	feeStmt, err := tx.Prepare(`INSERT INTO event_fees (event_id, address_id, amount) VALUES ($1, $2, $3) ON CONFLICT (event_id, address_id) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare fee statement: %w", err)
+	}
+	defer feeStmt.Close()
+
+	categoryStmt, err := tx.Prepare(`INSERT INTO event_categories (event_id, category) VALUES ($1, $2) ON CONFLICT (event_id, category) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare category statement: %w", err)
+	}
+	defer categoryStmt.Close()
+
+	unresolvedStmt, err := tx.Prepare(`INSERT INTO unresolved_events (event_id) SELECT $1 WHERE EXISTS (SELECT 1 FROM event_addresses ea
+INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+WHERE ea.event_id=$1)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare unresolved event statement: %w", err)
+	}
+	defer unresolvedStmt.Close()
+
+	// unclassified events are classified when catch-up mode ends
+	var rules []wallet.ClassificationRule
+	if classify {
+		rules, err = classificationRules(tx)
+		if err != nil {
+			return fmt.Errorf("failed to get classification rules: %w", err)
+		}
+	}
+
 	var buf bytes.Buffer
 	enc := types.NewEncoder(&buf)
 	for _, event := range events {
+		var summarized bool
+		if retention == wallet.EventRetentionSummary {
+			event, summarized = wallet.SummarizeEvent(event)
+		}
+
 		buf.Reset()
 		ev, ok := event.Data.(types.EncoderTo)
 		if !ok {
@@ -1083,16 +1132,16 @@ func addEvents(tx *txn, events []wallet.Event, indexID int64) error {
 		enc.Flush()
 
 		var eventID int64
-		err = insertEventStmt.QueryRow(encode(event.ID), event.MaturityHeight, encode(event.Timestamp), event.Type, buf.Bytes(), indexID).Scan(&eventID)
+		err = insertEventStmt.QueryRow(encode(event.ID), event.MaturityHeight, encode(event.Timestamp), event.Type, buf.Bytes(), summarized, indexID).Scan(&eventID)
 		if errors.Is(err, sql.ErrNoRows) {
 			continue // skip if the event already exists
 		} else if err != nil {
 			return fmt.Errorf("failed to add event: %w", err)
 		}
 
-		used := make(map[types.Address]bool)
+		used := make(map[types.Address]int64)
 		for _, addr := range event.Relevant {
-			if used[addr] {
+			if _, ok := used[addr]; ok {
 				continue
 			}
 
@@ -1107,14 +1156,74 @@ func addEvents(tx *txn, events []wallet.Event, indexID int64) error {
 				return fmt.Errorf("failed to add relevant address: %w", err)
 			}
 
-			used[addr] = true
+			used[addr] = addressID
+		}
+
+		// events relevant to wallets are resolved and broadcast after
+		// the update
+		if _, err := unresolvedStmt.Exec(eventID); err != nil {
+			return fmt.Errorf("failed to queue event: %w", err)
+		}
+
+		if err := classifyEvent(categoryStmt, rules, eventID, event); err != nil {
+			return err
+		}
+
+		// record the fee against the relevant addresses that funded the
+		// transaction
+		fee, payers := wallet.TransactionFee(event)
+		if fee.IsZero() {
+			continue
+		}
+		for _, addr := range payers {
+			if _, err := feeStmt.Exec(eventID, used[addr], encode(fee)); err != nil {
+				return fmt.Errorf("failed to add fee: %w", err)
+			}
 		}
 	}
 	return nil
 }
 
+// archiveEvents copies the events matching the condition to the
+// reverted_events table before they are deleted. The condition is applied to
+// the events table, ev, joined with the chain_indices table, ci.
+func archiveEvents(tx *txn, condition string, args ...any) error {
+	// an event reverted more than once keeps only its latest record
+	_, err := tx.Exec(`DELETE FROM reverted_events WHERE event_id IN (SELECT ev.event_id FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id=ci.id)
+WHERE `+condition+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete previous records: %w", err)
+	}
+
+	// the timestamp is not a parameter since parameters are numbered in
+	// the order they appear
+	_, err = tx.Exec(fmt.Sprintf(`INSERT INTO reverted_events (event_id, block_id, height, maturity_height, date_created, event_type, event_data, date_reverted)
+SELECT ev.event_id, ci.block_id, ci.height, ev.maturity_height, ev.date_created, ev.event_type, ev.event_data, %d FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id=ci.id)
+WHERE `+condition+`
+ORDER BY ev.id ASC`, encode(time.Now())), args...)
+	if err != nil {
+		return fmt.Errorf("failed to archive events: %w", err)
+	}
+
+	_, err = tx.Exec(`INSERT INTO reverted_event_addresses (event_id, address_id)
+SELECT re.id, ea.address_id FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id=ci.id)
+INNER JOIN event_addresses ea ON (ev.id=ea.event_id)
+INNER JOIN reverted_events re ON (ev.event_id=re.event_id)
+WHERE `+condition, args...)
+	if err != nil {
+		return fmt.Errorf("failed to archive event addresses: %w", err)
+	}
+	return nil
+}
+
 // RevertEvents reverts any events that were added by the index
 func revertEvents(tx *txn, index types.ChainIndex) error {
+	if err := archiveEvents(tx, `ci.block_id=$1 AND ci.height=$2`, encode(index.ID), index.Height); err != nil {
+		return err
+	}
 	const query = `DELETE FROM events WHERE chain_index_id IN (SELECT id FROM chain_indices WHERE block_id=$1 AND height=$2)`
 	_, err := tx.Exec(query, encode(index.ID), index.Height)
 	return err
@@ -1236,6 +1345,9 @@ RETURNING id, address_id, siafund_value, spent_index_id IS NOT NULL`, index.Heig
 }
 
 func deleteOrphanedEvents(tx *txn, index types.ChainIndex) error {
+	if err := archiveEvents(tx, `ci.height=$1 AND ci.block_id<>$2`, index.Height, encode(index.ID)); err != nil {
+		return err
+	}
 	_, err := tx.Exec(`DELETE FROM events WHERE id IN (SELECT ev.id FROM events ev
 INNER JOIN chain_indices ci ON (ev.chain_index_id=ci.id)
 WHERE ci.height=$1 AND ci.block_id<>$2);`, index.Height, encode(index.ID))
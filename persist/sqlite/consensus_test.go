@@ -79,7 +79,7 @@ func TestPruneSiacoins(t *testing.T) {
 	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
 	if err != nil {
 		t.Fatal(err)
-	} else if err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+	} else if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -108,14 +108,14 @@ func TestPruneSiacoins(t *testing.T) {
 		t.Helper()
 
 		var n int
-		err := db.db.QueryRow(`SELECT COUNT(*) FROM siacoin_elements WHERE spent_index_id IS NOT NULL`).Scan(&n)
+		err := db.reader.db.QueryRow(`SELECT COUNT(*) FROM siacoin_elements WHERE spent_index_id IS NOT NULL`).Scan(&n)
 		if err != nil {
 			t.Fatalf("failed to count spent siacoin elements: %v", err)
 		} else if n != spent {
 			t.Fatalf("expected %v spent siacoin elements, got %v", spent, n)
 		}
 
-		err = db.db.QueryRow(`SELECT COUNT(*) FROM siacoin_elements WHERE spent_index_id IS NULL`).Scan(&n)
+		err = db.reader.db.QueryRow(`SELECT COUNT(*) FROM siacoin_elements WHERE spent_index_id IS NULL`).Scan(&n)
 		if err != nil {
 			t.Fatalf("failed to count unspent siacoin elements: %v", err)
 		} else if n != unspent {
@@ -222,7 +222,7 @@ func TestPruneSiafunds(t *testing.T) {
 	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
 	if err != nil {
 		t.Fatal(err)
-	} else if err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+	} else if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -243,14 +243,14 @@ func TestPruneSiafunds(t *testing.T) {
 		t.Helper()
 
 		var n int
-		err := db.db.QueryRow(`SELECT COUNT(*) FROM siafund_elements WHERE spent_index_id IS NOT NULL`).Scan(&n)
+		err := db.reader.db.QueryRow(`SELECT COUNT(*) FROM siafund_elements WHERE spent_index_id IS NOT NULL`).Scan(&n)
 		if err != nil {
 			t.Fatalf("failed to count spent siacoin elements: %v", err)
 		} else if n != spent {
 			t.Fatalf("expected %v spent siacoin elements, got %v", spent, n)
 		}
 
-		err = db.db.QueryRow(`SELECT COUNT(*) FROM siafund_elements WHERE spent_index_id IS NULL`).Scan(&n)
+		err = db.reader.db.QueryRow(`SELECT COUNT(*) FROM siafund_elements WHERE spent_index_id IS NULL`).Scan(&n)
 		if err != nil {
 			t.Fatalf("failed to count unspent siacoin elements: %v", err)
 		} else if n != unspent {
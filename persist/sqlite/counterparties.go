@@ -0,0 +1,199 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// AddEventCounterparties stores the counterparties of the wallet's events,
+// replacing any stored for the same events. Events that are no longer in the
+// database are skipped.
+func (s *Store) AddEventCounterparties(walletID wallet.ID, counterparties map[types.Hash256][]wallet.Counterparty) error {
+	return s.transaction(func(tx *txn) error {
+		eventStmt, err := tx.Prepare(`SELECT id FROM events WHERE event_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare event statement: %w", err)
+		}
+		defer eventStmt.Close()
+
+		deleteStmt, err := tx.Prepare(`DELETE FROM event_counterparties WHERE wallet_id=$1 AND event_id=$2`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare delete statement: %w", err)
+		}
+		defer deleteStmt.Close()
+
+		insertStmt, err := tx.Prepare(`INSERT INTO event_counterparties (wallet_id, event_id, position, address, role, value, label, category, counterparty_wallet_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert statement: %w", err)
+		}
+		defer insertStmt.Close()
+
+		for id, cps := range counterparties {
+			var dbID int64
+			if err := eventStmt.QueryRow(encode(id)).Scan(&dbID); errors.Is(err, sql.ErrNoRows) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to get event %v: %w", id, err)
+			}
+			if _, err := deleteStmt.Exec(walletID, dbID); err != nil {
+				return fmt.Errorf("failed to delete counterparties of event %v: %w", id, err)
+			}
+			for i, cp := range cps {
+				if _, err := insertStmt.Exec(walletID, dbID, i, encode(cp.Address), cp.Role, encode(cp.Value), cp.Label, cp.Category, cp.Wallet); err != nil {
+					return fmt.Errorf("failed to add counterparty of event %v: %w", id, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// EventCounterparties returns the stored counterparties of the wallet's
+// events, omitting events with none stored.
+func (s *Store) EventCounterparties(walletID wallet.ID, eventIDs []types.Hash256) (counterparties map[types.Hash256][]wallet.Counterparty, err error) {
+	counterparties = make(map[types.Hash256][]wallet.Counterparty)
+	err = s.readTransaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`SELECT ec.address, ec.role, ec.value, ec.label, ec.category, ec.counterparty_wallet_id FROM event_counterparties ec
+INNER JOIN events ev ON (ec.event_id = ev.id)
+WHERE ec.wallet_id=$1 AND ev.event_id=$2
+ORDER BY ec.position ASC`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, id := range eventIDs {
+			if _, ok := counterparties[id]; ok {
+				continue
+			}
+			rows, err := stmt.Query(walletID, encode(id))
+			if err != nil {
+				return fmt.Errorf("failed to query counterparties: %w", err)
+			}
+			for rows.Next() {
+				var cp wallet.Counterparty
+				if err := rows.Scan(decode(&cp.Address), &cp.Role, decode(&cp.Value), &cp.Label, &cp.Category, &cp.Wallet); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan counterparty: %w", err)
+				}
+				counterparties[id] = append(counterparties[id], cp)
+			}
+			if err := rows.Err(); err != nil {
+				rows.Close()
+				return err
+			}
+			rows.Close()
+		}
+		return nil
+	})
+	return
+}
+
+// UnresolvedEvents returns up to limit of the oldest applied events relevant
+// to wallets that have not been marked resolved. The events' relevant
+// addresses are returned for each wallet rather than in Event.Relevant.
+func (s *Store) UnresolvedEvents(limit int) (unresolved []wallet.UnresolvedEvent, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `
+WITH last_chain_index AS (
+	SELECT last_indexed_height+1 AS height FROM global_settings LIMIT 1
+)
+SELECT
+	ev.id,
+	ev.event_id,
+	ev.maturity_height,
+	ev.date_created,
+	ci.height,
+	ci.block_id,
+	CASE
+		WHEN last_chain_index.height < ci.height THEN 0
+		ELSE last_chain_index.height - ci.height
+	END AS confirmations,
+	ev.event_type,
+	ev.event_data
+FROM unresolved_events ue
+INNER JOIN events ev ON (ue.event_id = ev.id)
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+CROSS JOIN last_chain_index
+ORDER BY ue.event_id ASC
+LIMIT $1`
+		rows, err := tx.Query(query, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ue wallet.UnresolvedEvent
+			ue.Event, ue.Seq, err = scanEvent(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan event: %w", err)
+			}
+			unresolved = append(unresolved, ue)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		walletsStmt, err := tx.Prepare(`SELECT wa.wallet_id, sa.sia_address FROM event_addresses ea
+INNER JOIN sia_addresses sa ON (ea.address_id = sa.id)
+INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+WHERE ea.event_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare wallets statement: %w", err)
+		}
+		defer walletsStmt.Close()
+
+		for i := range unresolved {
+			ue := &unresolved[i]
+			ue.Wallets = make(map[wallet.ID][]types.Address)
+			walletRows, err := walletsStmt.Query(ue.Seq)
+			if err != nil {
+				return fmt.Errorf("failed to query wallets: %w", err)
+			}
+			for walletRows.Next() {
+				var id wallet.ID
+				var addr types.Address
+				if err := walletRows.Scan(&id, decode(&addr)); err != nil {
+					walletRows.Close()
+					return fmt.Errorf("failed to scan wallet address: %w", err)
+				}
+				ue.Wallets[id] = append(ue.Wallets[id], addr)
+			}
+			if err := walletRows.Err(); err != nil {
+				walletRows.Close()
+				return err
+			}
+			walletRows.Close()
+		}
+		return nil
+	})
+	return
+}
+
+// MarkEventsResolved removes the events with the given sequence numbers from
+// the events returned by UnresolvedEvents.
+func (s *Store) MarkEventsResolved(seqs []int64) error {
+	if len(seqs) == 0 {
+		return nil
+	}
+	return s.transaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`DELETE FROM unresolved_events WHERE event_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, seq := range seqs {
+			if _, err := stmt.Exec(seq); err != nil {
+				return fmt.Errorf("failed to mark event %d resolved: %w", seq, err)
+			}
+		}
+		return nil
+	})
+}
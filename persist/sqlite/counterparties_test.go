@@ -0,0 +1,174 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestEventCounterparties(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w1, err := db.AddWallet(wallet.Wallet{Name: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := db.AddWallet(wallet.Wallet{Name: "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	index := types.ChainIndex{Height: 1, ID: types.BlockID{1}}
+	event := wallet.Event{
+		ID:        types.Hash256{1},
+		Index:     index,
+		Type:      wallet.EventTypeMinerPayout,
+		Timestamp: time.Unix(1, 0),
+		Data: wallet.EventPayout{SiacoinElement: types.SiacoinElement{
+			SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(1)},
+		}},
+		Relevant: []types.Address{addr},
+	}
+	err = db.transaction(func(tx *txn) error {
+		utx := &updateTx{
+			indexMode:      wallet.IndexModeFull,
+			eventRetention: wallet.EventRetentionFull,
+
+			tx:                tx,
+			relevantAddresses: make(map[types.Address]bool),
+		}
+		return utx.ApplyIndex(index, wallet.AppliedState{Events: []wallet.Event{event}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cps := []wallet.Counterparty{
+		{Address: types.Address{2}, Role: wallet.CounterpartySender, Value: types.Siacoins(3), Label: "exchange", Category: "cex"},
+		{Address: types.Address{3}, Role: wallet.CounterpartyRecipient, Value: types.Siacoins(2), Wallet: w2.ID},
+	}
+	// unknown events are skipped
+	if err := db.AddEventCounterparties(w1.ID, map[types.Hash256][]wallet.Counterparty{event.ID: cps, {9}: cps}); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.EventCounterparties(w1.ID, []types.Hash256{event.ID, {9}})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(stored) != 1 || !reflect.DeepEqual(stored[event.ID], cps) {
+		t.Fatalf("expected %v, got %v", cps, stored)
+	}
+
+	// counterparties are stored per wallet
+	if stored, err := db.EventCounterparties(w2.ID, []types.Hash256{event.ID}); err != nil {
+		t.Fatal(err)
+	} else if len(stored) != 0 {
+		t.Fatalf("expected no counterparties for the other wallet, got %v", stored)
+	}
+
+	// storing again replaces the event's counterparties
+	if err := db.AddEventCounterparties(w1.ID, map[types.Hash256][]wallet.Counterparty{event.ID: cps[:1]}); err != nil {
+		t.Fatal(err)
+	} else if stored, err := db.EventCounterparties(w1.ID, []types.Hash256{event.ID}); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(stored[event.ID], cps[:1]) {
+		t.Fatalf("expected %v, got %v", cps[:1], stored[event.ID])
+	}
+}
+
+func TestUnresolvedEvents(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	payout := func(id byte, addr types.Address) wallet.Event {
+		return wallet.Event{
+			ID:        types.Hash256{id},
+			Type:      wallet.EventTypeMinerPayout,
+			Timestamp: time.Unix(int64(id), 0),
+			Data: wallet.EventPayout{SiacoinElement: types.SiacoinElement{
+				SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(1)},
+			}},
+			Relevant: []types.Address{addr},
+		}
+	}
+	applyEvents := func(index types.ChainIndex, events ...wallet.Event) {
+		t.Helper()
+		err := db.transaction(func(tx *txn) error {
+			utx := &updateTx{
+				indexMode:      wallet.IndexModeFull,
+				eventRetention: wallet.EventRetentionFull,
+
+				tx:                tx,
+				relevantAddresses: make(map[types.Address]bool),
+			}
+			return utx.ApplyIndex(index, wallet.AppliedState{Events: events})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only events relevant to wallets are queued
+	other := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	applyEvents(types.ChainIndex{Height: 1, ID: types.BlockID{1}}, payout(1, addr), payout(2, other), payout(3, addr))
+
+	unresolved, err := db.UnresolvedEvents(100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(unresolved) != 2 {
+		t.Fatalf("expected 2 unresolved events, got %d", len(unresolved))
+	} else if unresolved[0].Event.ID != (types.Hash256{1}) || unresolved[1].Event.ID != (types.Hash256{3}) {
+		t.Fatal("expected unresolved events oldest first")
+	} else if !reflect.DeepEqual(unresolved[0].Wallets, map[wallet.ID][]types.Address{w.ID: {addr}}) {
+		t.Fatalf("expected event to be relevant to wallet %v, got %v", w.ID, unresolved[0].Wallets)
+	}
+
+	// the limit applies to events, and resolved events are not returned
+	if page, err := db.UnresolvedEvents(1); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 1 || page[0].Seq != unresolved[0].Seq {
+		t.Fatalf("expected the oldest event, got %v", page)
+	} else if err := db.MarkEventsResolved([]int64{page[0].Seq}); err != nil {
+		t.Fatal(err)
+	} else if page, err := db.UnresolvedEvents(100); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 1 || page[0].Seq != unresolved[1].Seq {
+		t.Fatalf("expected the remaining event, got %v", page)
+	}
+
+	// reverted events are no longer unresolved
+	err = db.transaction(func(tx *txn) error {
+		utx := &updateTx{indexMode: wallet.IndexModeFull, tx: tx, relevantAddresses: make(map[types.Address]bool)}
+		return utx.RevertIndex(types.ChainIndex{Height: 1, ID: types.BlockID{1}}, wallet.RevertedState{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if page, err := db.UnresolvedEvents(100); err != nil {
+		t.Fatal(err)
+	} else if len(page) != 0 {
+		t.Fatalf("expected no unresolved events, got %v", page)
+	}
+}
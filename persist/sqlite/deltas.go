@@ -0,0 +1,123 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// walletEventsBetween returns the events relevant to a wallet confirmed
+// between start and end, inclusive, ordered by height. Their relevant
+// addresses are limited to the wallet's addresses.
+func (s *Store) walletEventsBetween(tx *txn, walletID wallet.ID, start, end uint64) ([]wallet.Event, error) {
+	const query = `SELECT DISTINCT ev.id, ev.event_id, ev.maturity_height, ev.date_created, ci.height, ci.block_id, 0, ev.event_type, ev.event_data
+FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+INNER JOIN event_addresses ea ON (ev.id = ea.event_id)
+INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+WHERE wa.wallet_id=$1 AND ci.height BETWEEN $2 AND $3
+ORDER BY ci.height ASC, ev.id ASC`
+
+	rows, err := tx.Query(query, walletID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []wallet.Event
+	var dbIDs []int64
+	for rows.Next() {
+		event, dbID, err := scanEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+		dbIDs = append(dbIDs, dbID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	relevant, err := s.getWalletEventRelevantAddresses(tx, walletID, dbIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relevant addresses: %w", err)
+	}
+	for i := range events {
+		events[i].Relevant = relevant[dbIDs[i]]
+	}
+	return events, nil
+}
+
+// WalletEventsBetween returns the events relevant to a wallet confirmed
+// between start and end, inclusive, ordered by height.
+func (s *Store) WalletEventsBetween(ctx context.Context, walletID wallet.ID, start, end uint64) (events []wallet.Event, err error) {
+	err = s.scheduledReadTransaction(ctx, walletQueryKey(walletID), func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		events, err = s.walletEventsBetween(tx, walletID, start, end)
+		return err
+	})
+	return
+}
+
+// WalletDeltas returns the change in a wallet's balance from the events in
+// each block between start and end, inclusive, ordered by height. Blocks
+// without events relevant to the wallet are omitted.
+func (s *Store) WalletDeltas(ctx context.Context, walletID wallet.ID, start, end uint64) (deltas []wallet.BlockDelta, err error) {
+	err = s.scheduledReadTransaction(ctx, walletQueryKey(walletID), func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+
+		const blocksQuery = `SELECT ci.height, ci.block_id, COUNT(DISTINCT ev.id)
+FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+INNER JOIN event_addresses ea ON (ev.id = ea.event_id)
+INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+WHERE wa.wallet_id=$1 AND ci.height BETWEEN $2 AND $3
+GROUP BY ci.id
+ORDER BY ci.height ASC`
+
+		rows, err := tx.Query(blocksQuery, walletID, start, end)
+		if err != nil {
+			return fmt.Errorf("failed to query blocks: %w", err)
+		}
+		defer rows.Close()
+
+		blocks := make(map[types.BlockID]int)
+		for rows.Next() {
+			var delta wallet.BlockDelta
+			if err := rows.Scan(&delta.Index.Height, decode(&delta.Index.ID), &delta.Events); err != nil {
+				return fmt.Errorf("failed to scan block: %w", err)
+			}
+			blocks[delta.Index.ID] = len(deltas)
+			deltas = append(deltas, delta)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		} else if len(deltas) == 0 {
+			return nil
+		}
+
+		// siacoin values are stored as blobs, so the flows are summed from
+		// the decoded events rather than in SQL
+		events, err := s.walletEventsBetween(tx, walletID, start, end)
+		if err != nil {
+			return fmt.Errorf("failed to get events: %w", err)
+		}
+		for _, event := range events {
+			delta := &deltas[blocks[event.Index.ID]]
+			inflow, outflow := wallet.EventFlows(event)
+			delta.SiacoinsReceived = delta.SiacoinsReceived.Add(inflow)
+			delta.SiacoinsSent = delta.SiacoinsSent.Add(outflow)
+			sfInflow, sfOutflow := wallet.EventSiafundFlows(event)
+			delta.SiafundsReceived += sfInflow
+			delta.SiafundsSent += sfOutflow
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,113 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+func TestWalletDeltas(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+	other := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+
+	newEvent := func(data wallet.EventV1Transaction, relevant ...types.Address) wallet.Event {
+		return wallet.Event{
+			ID:        frand.Entropy256(),
+			Type:      wallet.EventTypeV1Transaction,
+			Data:      data,
+			Timestamp: time.Now().Truncate(time.Second),
+			Relevant:  relevant,
+		}
+	}
+	received := types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(10)}}
+	blocks := map[uint64][]wallet.Event{
+		10: {
+			newEvent(wallet.EventV1Transaction{Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{received.SiacoinOutput},
+				SiafundOutputs: []types.SiafundOutput{{Address: addr, Value: 5}},
+			}}, addr),
+			newEvent(wallet.EventV1Transaction{Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(2)}},
+			}}, addr),
+		},
+		11: {
+			newEvent(wallet.EventV1Transaction{
+				Transaction: types.Transaction{
+					SiacoinOutputs: []types.SiacoinOutput{
+						{Address: other, Value: types.Siacoins(3)},
+						{Address: addr, Value: types.Siacoins(6)},
+					},
+				},
+				SpentSiacoinElements: []types.SiacoinElement{received},
+			}, addr, other),
+		},
+		// events of other addresses are not counted
+		12: {
+			newEvent(wallet.EventV1Transaction{Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{{Address: other, Value: types.Siacoins(1)}},
+			}}, other),
+		},
+	}
+	err = db.transaction(func(tx *txn) error {
+		for height, events := range blocks {
+			var indexID int64
+			if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(types.BlockID{byte(height)}), height).Scan(&indexID); err != nil {
+				return err
+			} else if err := addEvents(tx, events, indexID, wallet.EventRetentionFull, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deltas, err := db.WalletDeltas(context.Background(), w.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(deltas) != 2 {
+		t.Fatalf("expected 2 deltas, got %d", len(deltas))
+	}
+	expected := []wallet.BlockDelta{
+		{Index: types.ChainIndex{Height: 10, ID: types.BlockID{10}}, Events: 2, SiacoinsReceived: types.Siacoins(12), SiafundsReceived: 5},
+		{Index: types.ChainIndex{Height: 11, ID: types.BlockID{11}}, Events: 1, SiacoinsReceived: types.Siacoins(6), SiacoinsSent: types.Siacoins(10)},
+	}
+	for i, exp := range expected {
+		d := deltas[i]
+		if d.Index != exp.Index || d.Events != exp.Events || d.SiafundsReceived != exp.SiafundsReceived || d.SiafundsSent != exp.SiafundsSent {
+			t.Fatalf("delta %d: expected %+v, got %+v", i, exp, d)
+		} else if !d.SiacoinsReceived.Equals(exp.SiacoinsReceived) || !d.SiacoinsSent.Equals(exp.SiacoinsSent) {
+			t.Fatalf("delta %d: expected %v received and %v sent, got %v and %v", i, exp.SiacoinsReceived, exp.SiacoinsSent, d.SiacoinsReceived, d.SiacoinsSent)
+		}
+	}
+
+	if deltas, err := db.WalletDeltas(context.Background(), w.ID, 11, 11); err != nil {
+		t.Fatal(err)
+	} else if len(deltas) != 1 || deltas[0].Index.Height != 11 {
+		t.Fatalf("expected only block 11, got %+v", deltas)
+	} else if _, err := db.WalletDeltas(context.Background(), 100, 0, 100); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
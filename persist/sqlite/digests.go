@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// WalletDigest returns a wallet's digest schedule.
+func (s *Store) WalletDigest(walletID wallet.ID) (sched digest.Schedule, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		err := tx.QueryRow(`SELECT wallet_id, frequency, last_period FROM wallet_digests WHERE wallet_id=$1`, walletID).Scan(&sched.WalletID, &sched.Frequency, decode(&sched.LastPeriod))
+		if errors.Is(err, sql.ErrNoRows) {
+			return digest.ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// SetWalletDigest sets a wallet's digest schedule, replacing any existing
+// schedule.
+func (s *Store) SetWalletDigest(sched digest.Schedule) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, sched.WalletID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_digests (wallet_id, frequency, last_period) VALUES ($1, $2, $3) ON CONFLICT (wallet_id) DO UPDATE SET frequency=EXCLUDED.frequency, last_period=EXCLUDED.last_period`, sched.WalletID, sched.Frequency, encode(sched.LastPeriod))
+		return err
+	})
+}
+
+// RemoveWalletDigest removes a wallet's digest schedule.
+func (s *Store) RemoveWalletDigest(walletID wallet.ID) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM wallet_digests WHERE wallet_id=$1`, walletID)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if n == 0 {
+			return digest.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// WalletDigests returns every digest schedule.
+func (s *Store) WalletDigests() (schedules []digest.Schedule, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT wallet_id, frequency, last_period FROM wallet_digests ORDER BY wallet_id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var sched digest.Schedule
+			if err := rows.Scan(&sched.WalletID, &sched.Frequency, decode(&sched.LastPeriod)); err != nil {
+				return fmt.Errorf("failed to scan schedule: %w", err)
+			}
+			schedules = append(schedules, sched)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// WalletAddressesFirstUsed returns the wallet's addresses whose first event
+// is in [start, end).
+func (s *Store) WalletAddressesFirstUsed(walletID wallet.ID, start, end time.Time) (addresses []types.Address, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		const query = `SELECT sa.sia_address
+FROM wallet_addresses wa
+INNER JOIN sia_addresses sa ON wa.address_id = sa.id
+INNER JOIN event_addresses ea ON ea.address_id = sa.id
+INNER JOIN events ev ON ea.event_id = ev.id
+WHERE wa.wallet_id=$1
+GROUP BY sa.id
+HAVING MIN(ev.date_created) >= $2 AND MIN(ev.date_created) < $3
+ORDER BY MIN(ev.date_created) ASC`
+		rows, err := tx.Query(query, walletID, encode(start), encode(end))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr types.Address
+			if err := rows.Scan(decode(&addr)); err != nil {
+				return fmt.Errorf("failed to scan address: %w", err)
+			}
+			addresses = append(addresses, addr)
+		}
+		return rows.Err()
+	})
+	return
+}
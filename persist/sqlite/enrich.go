@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"fmt"
+	"sort"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// addEventEnrichments runs the enrichers on each event and stores the fields
+// they add. The events must already be stored.
+func addEventEnrichments(tx *txn, events []wallet.Event, enrichers []wallet.NamedEnricher, log *zap.Logger) error {
+	if len(enrichers) == 0 || len(events) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO event_enrichments (event_id, field, value)
+SELECT id, $1, $2 FROM events WHERE event_id=$3
+ON CONFLICT (event_id, field) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		fields := wallet.EnrichEvent(enrichers, event, log)
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if _, err := stmt.Exec(k, fields[k], encode(event.ID)); err != nil {
+				return fmt.Errorf("failed to add field %q: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// EventEnrichments returns the fields attached to each of the events by
+// enrichers.
+func (s *Store) EventEnrichments(eventIDs []types.Hash256) (enrichments map[types.Hash256]map[string]string, err error) {
+	enrichments = make(map[types.Hash256]map[string]string)
+	err = s.readTransaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`SELECT ee.field, ee.value FROM event_enrichments ee
+INNER JOIN events ev ON (ee.event_id = ev.id)
+WHERE ev.event_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, id := range eventIDs {
+			if _, ok := enrichments[id]; ok {
+				continue
+			}
+			rows, err := stmt.Query(encode(id))
+			if err != nil {
+				return fmt.Errorf("failed to query enrichments: %w", err)
+			}
+			for rows.Next() {
+				var field, value string
+				if err := rows.Scan(&field, &value); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan enrichment: %w", err)
+				}
+				if enrichments[id] == nil {
+					enrichments[id] = make(map[string]string)
+				}
+				enrichments[id][field] = value
+			}
+			if err := rows.Err(); err != nil {
+				rows.Close()
+				return err
+			}
+			rows.Close()
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestEventEnrichments(t *testing.T) {
+	orders := map[types.Hash256]string{{1}: "order-1"}
+	enrichers := []wallet.NamedEnricher{
+		{Name: "orders", Enricher: wallet.EventEnricherFunc(func(_ context.Context, ev wallet.Event, fields map[string]string) error {
+			if id, ok := orders[ev.ID]; ok {
+				fields["orderID"] = id
+			}
+			return nil
+		})},
+		{Name: "failing", Enricher: wallet.EventEnricherFunc(func(_ context.Context, _ wallet.Event, fields map[string]string) error {
+			fields["orderID"] = "overwritten"
+			return errors.New("lookup failed")
+		})},
+		{Name: "panicking", Enricher: wallet.EventEnricherFunc(func(context.Context, wallet.Event, map[string]string) error {
+			panic("boom")
+		})},
+		{Name: "oversized", Enricher: wallet.EventEnricherFunc(func(_ context.Context, _ wallet.Event, fields map[string]string) error {
+			fields["blob"] = strings.Repeat("a", 2048)
+			return nil
+		})},
+		{Name: "customers", Enricher: wallet.EventEnricherFunc(func(_ context.Context, _ wallet.Event, fields map[string]string) error {
+			// later enrichers see the fields added before them
+			if fields["orderID"] != "" {
+				fields["customer"] = "alice"
+			}
+			return nil
+		})},
+	}
+
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log, WithEventEnrichers(enrichers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	index := types.ChainIndex{Height: 10, ID: types.BlockID{10}}
+	payout := func(id byte) wallet.Event {
+		return wallet.Event{
+			ID:        types.Hash256{id},
+			Index:     index,
+			Type:      wallet.EventTypeMinerPayout,
+			Timestamp: time.Unix(int64(id), 0),
+			Data: wallet.EventPayout{SiacoinElement: types.SiacoinElement{
+				SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(1)},
+			}},
+			Relevant: []types.Address{addr},
+		}
+	}
+	events := []wallet.Event{payout(1), payout(2)}
+	err = db.transaction(func(tx *txn) error {
+		var indexID int64
+		if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(index.ID), index.Height).Scan(&indexID); err != nil {
+			return err
+		} else if err := addEvents(tx, events, indexID, wallet.EventRetentionFull, true); err != nil {
+			return err
+		}
+		return addEventEnrichments(tx, events, db.enrichers, log)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enrichments, err := db.EventEnrichments([]types.Hash256{{1}, {2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[types.Hash256]map[string]string{
+		{1}: {"orderID": "order-1", "customer": "alice"},
+	}
+	if !reflect.DeepEqual(enrichments, expected) {
+		t.Fatalf("expected enrichments %v, got %v", expected, enrichments)
+	}
+}
@@ -0,0 +1,108 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/walletd/escrow"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const escrowColumns = `id, wallet_id, status, buyer_key, seller_key, arbiter_key, buyer_address, seller_address, address, policy, amount, settlement, date_created, date_funded, date_settled`
+
+func scanEscrow(s scanner) (e escrow.Escrow, err error) {
+	var settlement []byte
+	if err := s.Scan(&e.ID, &e.WalletID, &e.Status, decode(&e.Buyer), decode(&e.Seller), decode(&e.Arbiter), decode(&e.BuyerAddress), decode(&e.SellerAddress), decode(&e.Address), decode(&e.Policy), decode(&e.Amount), &settlement, decode(&e.DateCreated), decode(&e.DateFunded), decode(&e.DateSettled)); err != nil {
+		return escrow.Escrow{}, err
+	} else if err := json.Unmarshal(settlement, &e.Settlement); err != nil {
+		return escrow.Escrow{}, fmt.Errorf("failed to decode settlement: %w", err)
+	}
+	return e, nil
+}
+
+func queryEscrows(tx *txn, query string, args ...any) (escrows []escrow.Escrow, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEscrow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan escrow: %w", err)
+		}
+		escrows = append(escrows, e)
+	}
+	return escrows, rows.Err()
+}
+
+// AddEscrow adds an escrow to a wallet.
+func (s *Store) AddEscrow(e escrow.Escrow) (escrow.Escrow, error) {
+	settlement, err := json.Marshal(e.Settlement)
+	if err != nil {
+		return escrow.Escrow{}, fmt.Errorf("failed to encode settlement: %w", err)
+	}
+	err = s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, e.WalletID); err != nil {
+			return err
+		}
+		const query = `INSERT INTO escrows (wallet_id, status, buyer_key, seller_key, arbiter_key, buyer_address, seller_address, address, policy, amount, settlement, date_created, date_funded, date_settled) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id`
+		return tx.QueryRow(query, e.WalletID, e.Status, encode(e.Buyer), encode(e.Seller), encode(e.Arbiter), encode(e.BuyerAddress), encode(e.SellerAddress), encode(e.Address), encode(e.Policy), encode(e.Amount), settlement, encode(e.DateCreated), encode(e.DateFunded), encode(e.DateSettled)).Scan(&e.ID)
+	})
+	return e, err
+}
+
+// UpdateEscrow updates the status and settlement of an escrow.
+func (s *Store) UpdateEscrow(e escrow.Escrow) error {
+	settlement, err := json.Marshal(e.Settlement)
+	if err != nil {
+		return fmt.Errorf("failed to encode settlement: %w", err)
+	}
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE escrows SET status=$1, settlement=$2, date_funded=$3, date_settled=$4 WHERE id=$5 AND wallet_id=$6`, e.Status, settlement, encode(e.DateFunded), encode(e.DateSettled), e.ID, e.WalletID)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return escrow.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// WalletEscrows returns the escrows of a wallet, newest first.
+func (s *Store) WalletEscrows(walletID wallet.ID) (escrows []escrow.Escrow, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		escrows, err = queryEscrows(tx, `SELECT `+escrowColumns+` FROM escrows WHERE wallet_id=$1 ORDER BY id DESC`, walletID)
+		return err
+	})
+	return
+}
+
+// WalletEscrow returns an escrow of a wallet.
+func (s *Store) WalletEscrow(walletID wallet.ID, id int64) (e escrow.Escrow, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		e, err = scanEscrow(tx.QueryRow(`SELECT `+escrowColumns+` FROM escrows WHERE id=$1 AND wallet_id=$2`, id, walletID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return escrow.ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// PendingEscrows returns every escrow that has not been funded.
+func (s *Store) PendingEscrows() (escrows []escrow.Escrow, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		escrows, err = queryEscrows(tx, `SELECT `+escrowColumns+` FROM escrows WHERE status=$1 ORDER BY id ASC`, escrow.StatusPending)
+		return err
+	})
+	return
+}
@@ -12,7 +12,7 @@ import (
 // Events returns the events with the given event IDs. If an event is not found,
 // it is skipped.
 func (s *Store) Events(eventIDs []types.Hash256) (events []wallet.Event, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		// sqlite doesn't have easy support for IN clauses, use a statement since
 		// the number of event IDs is likely to be small instead of dynamically
 		// building the query
@@ -61,6 +61,45 @@ WHERE ev.event_id = $1`
 	return
 }
 
+// EventRawTransaction returns the full transaction of a confirmed event. It
+// returns wallet.ErrRawNotRetained if the event was stored as a summary.
+func (s *Store) EventRawTransaction(id types.Hash256) (raw wallet.RawTransaction, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		var eventType string
+		var buf []byte
+		var summarized bool
+		err := tx.QueryRow(`SELECT event_type, event_data, summarized FROM events WHERE event_id=$1`, encode(id)).Scan(&eventType, &buf, &summarized)
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to query event: %w", err)
+		}
+
+		dec := types.NewBufDecoder(buf)
+		switch eventType {
+		case wallet.EventTypeV1Transaction:
+			if summarized {
+				return wallet.ErrRawNotRetained
+			}
+			ev := decodeEventData[wallet.EventV1Transaction](dec)
+			raw.Transaction = &ev.Transaction
+		case wallet.EventTypeV2Transaction:
+			if summarized {
+				return wallet.ErrRawNotRetained
+			}
+			txn := types.V2Transaction(decodeEventData[wallet.EventV2Transaction](dec))
+			raw.V2Transaction = &txn
+		default:
+			return fmt.Errorf("%s event has no transaction: %w", eventType, wallet.ErrNotFound)
+		}
+		if err := dec.Err(); err != nil {
+			return fmt.Errorf("failed to decode event data: %w", err)
+		}
+		return nil
+	})
+	return
+}
+
 func decodeEventData[T wallet.EventPayout |
 	wallet.EventV1Transaction |
 	wallet.EventV2Transaction |
@@ -102,3 +141,134 @@ func scanEvent(s scanner) (ev wallet.Event, eventID int64, err error) {
 
 	return
 }
+
+// scannerFunc adapts a function to the scanner interface.
+type scannerFunc func(dest ...any) error
+
+// Scan implements scanner.
+func (fn scannerFunc) Scan(dest ...any) error { return fn(dest...) }
+
+// revertedEventColumns selects a reverted event in the column order expected
+// by scanEvent. Reverted events have no confirmations.
+const revertedEventColumns = `re.id, re.event_id, re.maturity_height, re.date_created, re.height, re.block_id, 0, re.event_type, re.event_data`
+
+// revertedEventAddresses returns the relevant addresses of a reverted event.
+func revertedEventAddresses(tx *txn, id int64) (addresses []types.Address, err error) {
+	rows, err := tx.Query(`SELECT sa.sia_address FROM reverted_event_addresses rea
+INNER JOIN sia_addresses sa ON (rea.address_id = sa.id)
+WHERE rea.event_id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var addr types.Address
+		if err := rows.Scan(decode(&addr)); err != nil {
+			return nil, fmt.Errorf("failed to scan address: %w", err)
+		}
+		addresses = append(addresses, addr)
+	}
+	return addresses, rows.Err()
+}
+
+// RevertedEvents returns the reverted events with the given event IDs. If an
+// event is not found, it is skipped.
+func (s *Store) RevertedEvents(eventIDs []types.Hash256) (events []wallet.Event, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`SELECT ` + revertedEventColumns + ` FROM reverted_events re WHERE re.event_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		events = make([]wallet.Event, 0, len(eventIDs))
+		for _, id := range eventIDs {
+			event, dbID, err := scanEvent(stmt.QueryRow(encode(id)))
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to query reverted event %q: %w", id, err)
+			}
+			event.Relevant, err = revertedEventAddresses(tx, dbID)
+			if err != nil {
+				return fmt.Errorf("failed to get relevant addresses of reverted event %q: %w", id, err)
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	return
+}
+
+// RevertedEventsAfter returns up to limit events reverted after the event
+// with sequence number seq, in the order they were reverted.
+func (s *Store) RevertedEventsAfter(seq int64, limit int) (reverted []wallet.RevertedEvent, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT `+revertedEventColumns+`, re.date_reverted FROM reverted_events re WHERE re.id > $1 ORDER BY re.id ASC LIMIT $2`, seq, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var re wallet.RevertedEvent
+			re.Event, re.Seq, err = scanEvent(scannerFunc(func(dest ...any) error {
+				return rows.Scan(append(dest, decode(&re.DateReverted))...)
+			}))
+			if err != nil {
+				return fmt.Errorf("failed to scan reverted event: %w", err)
+			}
+			reverted = append(reverted, re)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		walletsStmt, err := tx.Prepare(`SELECT DISTINCT wa.wallet_id FROM reverted_event_addresses rea
+INNER JOIN wallet_addresses wa ON (rea.address_id = wa.address_id)
+WHERE rea.event_id=$1
+ORDER BY wa.wallet_id ASC`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare wallets statement: %w", err)
+		}
+		defer walletsStmt.Close()
+
+		for i := range reverted {
+			reverted[i].Event.Relevant, err = revertedEventAddresses(tx, reverted[i].Seq)
+			if err != nil {
+				return fmt.Errorf("failed to get relevant addresses: %w", err)
+			}
+
+			walletRows, err := walletsStmt.Query(reverted[i].Seq)
+			if err != nil {
+				return fmt.Errorf("failed to query wallets: %w", err)
+			}
+			for walletRows.Next() {
+				var id wallet.ID
+				if err := walletRows.Scan(&id); err != nil {
+					walletRows.Close()
+					return fmt.Errorf("failed to scan wallet ID: %w", err)
+				}
+				reverted[i].WalletIDs = append(reverted[i].WalletIDs, id)
+			}
+			if err := walletRows.Err(); err != nil {
+				walletRows.Close()
+				return err
+			}
+			walletRows.Close()
+		}
+		return nil
+	})
+	return
+}
+
+// LastRevertedEventSeq returns the sequence number of the most recently
+// reverted event, or 0 if no events have been reverted.
+func (s *Store) LastRevertedEventSeq() (seq int64, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		return tx.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM reverted_events`).Scan(&seq)
+	})
+	return
+}
@@ -0,0 +1,229 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+func TestRevertedEvents(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := wallet.Event{
+		ID:             frand.Entropy256(),
+		Type:           wallet.EventTypeMinerPayout,
+		Data:           wallet.EventPayout{},
+		MaturityHeight: 150,
+		Timestamp:      time.Now().Truncate(time.Second),
+		Relevant:       []types.Address{addr},
+	}
+	// addEvent confirms an event in a block at the given height
+	addEvent := func(tx *txn, event wallet.Event, height uint64) types.ChainIndex {
+		index := types.ChainIndex{ID: frand.Entropy256(), Height: height}
+		var indexID int64
+		if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(index.ID), index.Height).Scan(&indexID); err != nil {
+			t.Fatal(err)
+		} else if err := addEvents(tx, []wallet.Event{event}, indexID, wallet.EventRetentionFull, true); err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+	assertReverted := func(index types.ChainIndex, afterSeq int64) int64 {
+		t.Helper()
+		if events, err := db.Events([]types.Hash256{event.ID}); err != nil {
+			t.Fatal(err)
+		} else if len(events) != 0 {
+			t.Fatal("expected reverted event to be removed")
+		}
+
+		events, err := db.RevertedEvents([]types.Hash256{event.ID})
+		if err != nil {
+			t.Fatal(err)
+		} else if len(events) != 1 {
+			t.Fatalf("expected 1 reverted event, got %d", len(events))
+		} else if events[0].Index != index {
+			t.Fatalf("expected index %v, got %v", index, events[0].Index)
+		} else if len(events[0].Relevant) != 1 || events[0].Relevant[0] != addr {
+			t.Fatalf("unexpected relevant addresses %v", events[0].Relevant)
+		}
+
+		reverted, err := db.RevertedEventsAfter(afterSeq, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(reverted) != 1 {
+			t.Fatalf("expected 1 reverted event, got %d", len(reverted))
+		} else if reverted[0].Event.ID != event.ID || reverted[0].Event.Index != index {
+			t.Fatalf("unexpected reverted event %+v", reverted[0].Event)
+		} else if len(reverted[0].WalletIDs) != 1 || reverted[0].WalletIDs[0] != w.ID {
+			t.Fatalf("expected wallet %v, got %v", w.ID, reverted[0].WalletIDs)
+		}
+
+		seq, err := db.LastRevertedEventSeq()
+		if err != nil {
+			t.Fatal(err)
+		} else if seq != reverted[0].Seq {
+			t.Fatalf("expected last sequence number %d, got %d", reverted[0].Seq, seq)
+		}
+		return seq
+	}
+
+	// revert the block
+	var index types.ChainIndex
+	err = db.transaction(func(tx *txn) error {
+		index = addEvent(tx, event, 5)
+		return revertEvents(tx, index)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq := assertReverted(index, 0)
+
+	// confirm the event again in a block that is later orphaned
+	err = db.transaction(func(tx *txn) error {
+		index = addEvent(tx, event, 6)
+		return deleteOrphanedEvents(tx, types.ChainIndex{ID: frand.Entropy256(), Height: index.Height})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the event keeps a single record with its latest index
+	assertReverted(index, seq)
+	if reverted, err := db.RevertedEventsAfter(0, 10); err != nil {
+		t.Fatal(err)
+	} else if len(reverted) != 1 {
+		t.Fatalf("expected 1 reverted event, got %d", len(reverted))
+	}
+
+	// the feed includes the reverted event alongside confirmed events
+	assertFeed := func(replacedBy *types.ChainIndex) {
+		t.Helper()
+		feed, err := db.WalletEventFeed(context.Background(), w.ID, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(feed) != 2 {
+			t.Fatalf("expected 2 feed events, got %d", len(feed))
+		} else if feed[0].Reverted || feed[0].Event.ID == event.ID {
+			t.Fatalf("expected confirmed event first, got %+v", feed[0])
+		} else if !feed[1].Reverted || feed[1].Event.ID != event.ID || feed[1].Event.Index != index {
+			t.Fatalf("expected reverted event, got %+v", feed[1])
+		} else if len(feed[1].Event.Relevant) != 1 || feed[1].Event.Relevant[0] != addr {
+			t.Fatalf("unexpected relevant addresses %v", feed[1].Event.Relevant)
+		} else if (feed[1].ReplacedBy == nil) != (replacedBy == nil) || (replacedBy != nil && *feed[1].ReplacedBy != *replacedBy) {
+			t.Fatalf("expected replaced by %v, got %v", replacedBy, feed[1].ReplacedBy)
+		}
+	}
+	err = db.transaction(func(tx *txn) error {
+		confirmed := event
+		confirmed.ID = frand.Entropy256()
+		confirmed.MaturityHeight = 200
+		addEvent(tx, confirmed, 7)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(nil)
+
+	// replace the reverted event's block
+	replacement := types.ChainIndex{ID: frand.Entropy256(), Height: index.Height}
+	if _, err := db.writer.db.Exec(`UPDATE chain_indices SET block_id=$1 WHERE height=$2`, encode(replacement.ID), replacement.Height); err != nil {
+		t.Fatal(err)
+	}
+	assertFeed(&replacement)
+}
+
+func TestEventRawTransaction(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	v1 := types.Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: addr, Value: types.Siacoins(1)}},
+		ArbitraryData:  [][]byte{[]byte("hello")},
+		Signatures:     []types.TransactionSignature{{ParentID: types.Hash256{1}}},
+	}
+	newEvent := func() wallet.Event {
+		return wallet.Event{
+			ID:        frand.Entropy256(),
+			Type:      wallet.EventTypeV1Transaction,
+			Data:      wallet.EventV1Transaction{Transaction: v1},
+			Timestamp: time.Now().Truncate(time.Second),
+			Relevant:  []types.Address{addr},
+		}
+	}
+	full, summary := newEvent(), newEvent()
+	payout := wallet.Event{
+		ID:        frand.Entropy256(),
+		Type:      wallet.EventTypeMinerPayout,
+		Data:      wallet.EventPayout{SiacoinElement: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(1)}}},
+		Timestamp: time.Now().Truncate(time.Second),
+		Relevant:  []types.Address{addr},
+	}
+
+	err = db.transaction(func(tx *txn) error {
+		var indexID int64
+		if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(types.BlockID{1}), 1).Scan(&indexID); err != nil {
+			return err
+		} else if err := addEvents(tx, []wallet.Event{full, payout}, indexID, wallet.EventRetentionFull, true); err != nil {
+			return err
+		}
+		return addEvents(tx, []wallet.Event{summary}, indexID, wallet.EventRetentionSummary, true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := db.EventRawTransaction(full.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if raw.Transaction == nil || raw.V2Transaction != nil {
+		t.Fatalf("expected v1 transaction, got %+v", raw)
+	} else if len(raw.Transaction.Signatures) != 1 || len(raw.Transaction.ArbitraryData) != 1 {
+		t.Fatalf("expected full transaction, got %+v", raw.Transaction)
+	}
+
+	if _, err := db.EventRawTransaction(summary.ID); !errors.Is(err, wallet.ErrRawNotRetained) {
+		t.Fatalf("expected ErrRawNotRetained, got %v", err)
+	} else if _, err := db.EventRawTransaction(payout.ID); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if _, err := db.EventRawTransaction(frand.Entropy256()); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// summarized events keep their outputs
+	var buf []byte
+	if err := db.readTransaction(func(tx *txn) error {
+		return tx.QueryRow(`SELECT event_data FROM events WHERE event_id=$1`, encode(summary.ID)).Scan(&buf)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ev := decodeEventData[wallet.EventV1Transaction](types.NewBufDecoder(buf))
+	if len(ev.Transaction.SiacoinOutputs) != 1 || len(ev.Transaction.Signatures) != 0 || len(ev.Transaction.ArbitraryData) != 0 {
+		t.Fatalf("expected summarized transaction, got %+v", ev.Transaction)
+	}
+}
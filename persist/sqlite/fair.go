@@ -0,0 +1,199 @@
+package sqlite
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// Kinds of scheduled queries.
+const (
+	queryKindWallet  = "wallet"
+	queryKindGroup   = "group"
+	queryKindAddress = "address"
+)
+
+type (
+	// A queryKey identifies the queue of a scheduled query. Queries for
+	// the same wallet or group share a queue, and all address queries
+	// share a single queue.
+	queryKey struct {
+		kind string
+		id   int64
+	}
+
+	// A fairScheduler limits the number of expensive read transactions
+	// that run at once. When every slot is in use, waiting transactions are
+	// admitted round-robin by queue, so a client paginating through one
+	// wallet's history cannot starve queries for other wallets, and the
+	// read connections that are not scheduled stay free for cheap queries
+	// such as balance lookups.
+	fairScheduler struct {
+		mu      sync.Mutex
+		slots   int
+		running int
+		waiting map[queryKey][]chan struct{}
+		order   []queryKey // queues with waiting transactions, in turn order
+
+		stats map[wallet.ID]wallet.QueryStats
+	}
+)
+
+func walletQueryKey(id wallet.ID) queryKey {
+	return queryKey{kind: queryKindWallet, id: int64(id)}
+}
+
+func groupQueryKey(id wallet.GroupID) queryKey {
+	return queryKey{kind: queryKindGroup, id: int64(id)}
+}
+
+func addressQueryKey() queryKey {
+	return queryKey{kind: queryKindAddress}
+}
+
+// dispatch admits the next waiting transaction, if any, into a free slot.
+// It must be called with the lock held.
+func (fs *fairScheduler) dispatch() {
+	for fs.running < fs.slots && len(fs.order) > 0 {
+		key := fs.order[0]
+		fs.order = fs.order[1:]
+		queue := fs.waiting[key]
+		ch := queue[0]
+		if len(queue) > 1 {
+			fs.waiting[key] = queue[1:]
+			// the queue goes to the back of the line until its next turn
+			fs.order = append(fs.order, key)
+		} else {
+			delete(fs.waiting, key)
+		}
+		fs.running++
+		close(ch)
+	}
+}
+
+// remove removes a waiting transaction from its queue, returning false if it
+// was already admitted. It must be called with the lock held.
+func (fs *fairScheduler) remove(key queryKey, ch chan struct{}) bool {
+	queue := fs.waiting[key]
+	for i := range queue {
+		if queue[i] != ch {
+			continue
+		}
+		queue = append(queue[:i:i], queue[i+1:]...)
+		if len(queue) > 0 {
+			fs.waiting[key] = queue
+			return true
+		}
+		delete(fs.waiting, key)
+		for j := range fs.order {
+			if fs.order[j] == key {
+				fs.order = append(fs.order[:j:j], fs.order[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// release frees a slot and admits the next waiting transaction.
+func (fs *fairScheduler) release() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.running--
+	fs.dispatch()
+}
+
+// acquire waits for a slot for a transaction in the given queue. The
+// returned function must be called to release the slot.
+func (fs *fairScheduler) acquire(ctx context.Context, key queryKey) (func(), error) {
+	fs.mu.Lock()
+	if fs.running < fs.slots && len(fs.order) == 0 {
+		fs.running++
+		fs.mu.Unlock()
+		return fs.release, nil
+	}
+	ch := make(chan struct{})
+	if _, ok := fs.waiting[key]; !ok {
+		fs.order = append(fs.order, key)
+	}
+	fs.waiting[key] = append(fs.waiting[key], ch)
+	fs.mu.Unlock()
+
+	select {
+	case <-ch:
+		return fs.release, nil
+	case <-ctx.Done():
+		fs.mu.Lock()
+		removed := fs.remove(key, ch)
+		fs.mu.Unlock()
+		if !removed {
+			// the slot was granted after the context was canceled
+			fs.release()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// load returns the number of transactions waiting for a slot and the number
+// running.
+func (fs *fairScheduler) load() (waiting, running int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for _, queue := range fs.waiting {
+		waiting += len(queue)
+	}
+	return waiting, fs.running
+}
+
+// record adds a completed query to the stats of its wallet.
+func (fs *fairScheduler) record(key queryKey, wait, elapsed time.Duration) {
+	if key.kind != queryKindWallet {
+		return
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	stats := fs.stats[wallet.ID(key.id)]
+	stats.Queries++
+	stats.Wait += wait
+	stats.Elapsed += elapsed
+	fs.stats[wallet.ID(key.id)] = stats
+}
+
+func newFairScheduler(slots int) *fairScheduler {
+	return &fairScheduler{
+		slots:   max(1, slots),
+		waiting: make(map[queryKey][]chan struct{}),
+		stats:   make(map[wallet.ID]wallet.QueryStats),
+	}
+}
+
+// scheduledReadTransaction is like readTransactionContext, but first waits
+// for the fair scheduler to admit the transaction. It is used by reads that
+// may scan many rows.
+func (s *Store) scheduledReadTransaction(ctx context.Context, key queryKey, fn func(*txn) error) error {
+	start := time.Now()
+	release, err := s.scheduler.acquire(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer release()
+	wait := time.Since(start)
+	err = s.readTransactionContext(ctx, fn)
+	s.scheduler.record(key, wait, time.Since(start)-wait)
+	return err
+}
+
+// WalletQueryStats returns the totals of each wallet's expensive queries,
+// such as event listings, since the store was opened.
+func (s *Store) WalletQueryStats() map[wallet.ID]wallet.QueryStats {
+	s.scheduler.mu.Lock()
+	defer s.scheduler.mu.Unlock()
+	stats := make(map[wallet.ID]wallet.QueryStats, len(s.scheduler.stats))
+	for id, qs := range s.scheduler.stats {
+		stats[id] = qs
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFairScheduler(t *testing.T) {
+	fs := newFairScheduler(1)
+
+	release, err := fs.acquire(context.Background(), walletQueryKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// queue three transactions for wallet 1, then one for wallet 2
+	admitted := make(chan wallet.ID, 4)
+	for i, id := range []wallet.ID{1, 1, 1, 2} {
+		go func() {
+			release, err := fs.acquire(context.Background(), walletQueryKey(id))
+			if err != nil {
+				panic(err)
+			}
+			admitted <- id
+			release()
+		}()
+		// wait for the transaction to be queued
+		for waiting, _ := fs.load(); waiting <= i; waiting, _ = fs.load() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// wallet 2 is admitted after wallet 1's first queued transaction
+	// instead of after all of them
+	release()
+	var order []wallet.ID
+	for range 4 {
+		order = append(order, <-admitted)
+	}
+	if order[0] != 1 || order[1] != 2 {
+		t.Fatalf("expected wallet 2 to be admitted second, got %v", order)
+	}
+	if waiting, running := fs.load(); waiting != 0 || running != 0 {
+		t.Fatalf("expected idle scheduler, got %d waiting and %d running", waiting, running)
+	}
+
+	// a canceled transaction leaves the queue
+	release, err = fs.acquire(context.Background(), walletQueryKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := fs.acquire(ctx, walletQueryKey(2)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	} else if waiting, _ := fs.load(); waiting != 0 || len(fs.order) != 0 {
+		t.Fatalf("expected empty queue, got %d waiting", waiting)
+	}
+	release()
+}
+
+func TestWalletQueryStats(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := db.WalletEvents(context.Background(), w.ID, 0, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.AddressEvents(context.Background(), [32]byte{1}, 0, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := db.WalletQueryStats()
+	if len(stats) != 1 || stats[w.ID].Queries != 3 || stats[w.ID].Elapsed <= 0 {
+		t.Fatalf("expected 3 queries for wallet %v, got %+v", w.ID, stats)
+	}
+	if waiting := db.PoolQueueDepth()[poolScheduled]; waiting != 0 {
+		t.Fatalf("expected no waiting queries, got %d", waiting)
+	} else if running := db.PoolInUse()[poolScheduled]; running != 0 {
+		t.Fatalf("expected no running queries, got %d", running)
+	}
+}
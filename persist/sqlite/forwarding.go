@@ -0,0 +1,221 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/forwarding"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const forwardingRuleColumns = `id, wallet_id, address, destination, splits, min_confirmations, min_amount, sweeps, forwarded, fees, date_created, last_sweep`
+
+func scanForwardingRule(s scanner) (r forwarding.Rule, err error) {
+	var splits []byte
+	if err := s.Scan(&r.ID, &r.WalletID, decode(&r.Address), decode(&r.Destination), &splits, &r.MinConfirmations, decode(&r.MinAmount), &r.Sweeps, decode(&r.Forwarded), decode(&r.Fees), decode(&r.DateCreated), decode(&r.LastSweep)); err != nil {
+		return forwarding.Rule{}, err
+	} else if err := json.Unmarshal(splits, &r.Splits); err != nil {
+		return forwarding.Rule{}, fmt.Errorf("failed to decode splits: %w", err)
+	}
+	return r, nil
+}
+
+func queryForwardingRules(tx *txn, query string, args ...any) (rules []forwarding.Rule, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanForwardingRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan forwarding rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// AddForwardingRule adds a forwarding rule to a wallet. Each address can
+// have at most one rule.
+func (s *Store) AddForwardingRule(r forwarding.Rule) (forwarding.Rule, error) {
+	splits, err := json.Marshal(r.Splits)
+	if err != nil {
+		return forwarding.Rule{}, fmt.Errorf("failed to encode splits: %w", err)
+	}
+	err = s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, r.WalletID); err != nil {
+			return err
+		}
+		var id int64
+		err := tx.QueryRow(`SELECT id FROM forwarding_rules WHERE address=$1`, encode(r.Address)).Scan(&id)
+		if err == nil {
+			return fmt.Errorf("%w: %d", forwarding.ErrExists, id)
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to check existing rule: %w", err)
+		}
+		const query = `INSERT INTO forwarding_rules (wallet_id, address, destination, splits, min_confirmations, min_amount, sweeps, forwarded, fees, date_created, last_sweep) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+		return tx.QueryRow(query, r.WalletID, encode(r.Address), encode(r.Destination), splits, r.MinConfirmations, encode(r.MinAmount), r.Sweeps, encode(r.Forwarded), encode(r.Fees), encode(r.DateCreated), encode(r.LastSweep)).Scan(&r.ID)
+	})
+	return r, err
+}
+
+// UpdateForwardingRule updates the progress of a forwarding rule.
+func (s *Store) UpdateForwardingRule(r forwarding.Rule) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE forwarding_rules SET sweeps=$1, forwarded=$2, fees=$3, last_sweep=$4 WHERE id=$5 AND wallet_id=$6`, r.Sweeps, encode(r.Forwarded), encode(r.Fees), encode(r.LastSweep), r.ID, r.WalletID)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return forwarding.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// RemoveForwardingRule removes a wallet's forwarding rule. The rule's sweeps
+// are kept.
+func (s *Store) RemoveForwardingRule(walletID wallet.ID, id int64) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM forwarding_rules WHERE id=$1 AND wallet_id=$2`, id, walletID)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return forwarding.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// WalletForwardingRules returns the forwarding rules of a wallet.
+func (s *Store) WalletForwardingRules(walletID wallet.ID) (rules []forwarding.Rule, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		rules, err = queryForwardingRules(tx, `SELECT `+forwardingRuleColumns+` FROM forwarding_rules WHERE wallet_id=$1 ORDER BY id ASC`, walletID)
+		return err
+	})
+	return
+}
+
+// WalletForwardingRule returns a forwarding rule of a wallet.
+func (s *Store) WalletForwardingRule(walletID wallet.ID, id int64) (r forwarding.Rule, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		r, err = scanForwardingRule(tx.QueryRow(`SELECT `+forwardingRuleColumns+` FROM forwarding_rules WHERE id=$1 AND wallet_id=$2`, id, walletID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return forwarding.ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// ForwardingRules returns every forwarding rule.
+func (s *Store) ForwardingRules() (rules []forwarding.Rule, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rules, err = queryForwardingRules(tx, `SELECT `+forwardingRuleColumns+` FROM forwarding_rules ORDER BY id ASC`)
+		return err
+	})
+	return
+}
+
+// AddForwardingSweep adds the audit record of a forwarding sweep.
+func (s *Store) AddForwardingSweep(sweep forwarding.Sweep) (forwarding.Sweep, error) {
+	splits, err := json.Marshal(sweep.Splits)
+	if err != nil {
+		return forwarding.Sweep{}, fmt.Errorf("failed to encode splits: %w", err)
+	}
+	err = s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO forwarding_sweeps (rule_id, wallet_id, address, destination, splits, status, basis_height, basis_id, txn, value, fee, date_created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+		return tx.QueryRow(query, sweep.RuleID, sweep.WalletID, encode(sweep.Address), encode(sweep.Destination), splits, sweep.Status, sweep.Basis.Height, encode(sweep.Basis.ID), encode(sweep.Transaction), encode(sweep.Value), encode(sweep.Fee), encode(sweep.DateCreated)).Scan(&sweep.ID)
+	})
+	return sweep, err
+}
+
+// WalletForwardingSweeps returns the forwarding sweeps of a wallet, newest
+// first. If ruleID is non-zero, only the sweeps of that rule are returned.
+func (s *Store) WalletForwardingSweeps(walletID wallet.ID, ruleID int64, offset, limit int) (sweeps []forwarding.Sweep, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		const query = `SELECT id, rule_id, wallet_id, address, destination, splits, status, basis_height, basis_id, txn, value, fee, date_created
+FROM forwarding_sweeps
+WHERE wallet_id=$1 AND ($2=0 OR rule_id=$2)
+ORDER BY id DESC
+LIMIT $3 OFFSET $4`
+		rows, err := tx.Query(query, walletID, ruleID, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var sweep forwarding.Sweep
+			var splits []byte
+			if err := rows.Scan(&sweep.ID, &sweep.RuleID, &sweep.WalletID, decode(&sweep.Address), decode(&sweep.Destination), &splits, &sweep.Status, &sweep.Basis.Height, decode(&sweep.Basis.ID), decode(&sweep.Transaction), decode(&sweep.Value), decode(&sweep.Fee), decode(&sweep.DateCreated)); err != nil {
+				return fmt.Errorf("failed to scan sweep: %w", err)
+			} else if err := json.Unmarshal(splits, &sweep.Splits); err != nil {
+				return fmt.Errorf("failed to decode splits: %w", err)
+			}
+			sweeps = append(sweeps, sweep)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// ConfirmedSiacoinOutputs returns the unspent siacoin outputs of an address
+// that are mature at the tip and were created at or below maxHeight.
+func (s *Store) ConfirmedSiacoinOutputs(addr types.Address, tip types.ChainIndex, maxHeight uint64) (siacoins []types.SiacoinElement, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address
+		FROM siacoin_elements se
+		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
+		INNER JOIN chain_indices ci ON (se.chain_index_id = ci.id)
+		WHERE sa.sia_address=$1 AND se.maturity_height <= $2 AND ci.height <= $3 AND se.spent_index_id IS NULL`
+
+		rows, err := tx.Query(query, encode(addr), tip.Height, maxHeight)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			siacoin, err := scanSiacoinElement(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan siacoin element: %w", err)
+			}
+			siacoins = append(siacoins, siacoin)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// retrieve the merkle proofs for the siacoin elements
+		if s.indexMode == wallet.IndexModeFull {
+			indices := make([]uint64, len(siacoins))
+			for i, se := range siacoins {
+				indices[i] = se.StateElement.LeafIndex
+			}
+			proofs, err := fillElementProofs(tx, indices)
+			if err != nil {
+				return fmt.Errorf("failed to fill element proofs: %w", err)
+			}
+			for i, proof := range proofs {
+				siacoins[i].StateElement.MerkleProof = proof
+			}
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,318 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// groupWalletsQuery selects the IDs of the wallets in a group and its
+// subgroups.
+const groupWalletsQuery = `SELECT gm.wallet_id FROM wallet_group_members gm
+INNER JOIN wallet_groups g ON (gm.group_id = g.id)
+WHERE g.id=$1 OR g.parent_id=$1`
+
+func groupExists(tx *txn, id wallet.GroupID) error {
+	var dummy int
+	err := tx.QueryRow(`SELECT 1 FROM wallet_groups WHERE id=$1`, id).Scan(&dummy)
+	if errors.Is(err, sql.ErrNoRows) {
+		return wallet.ErrGroupNotFound
+	}
+	return err
+}
+
+// checkGroupParent returns an error if setting the group's parent would nest
+// groups more than one level deep.
+func checkGroupParent(tx *txn, g wallet.Group) error {
+	if g.ParentID == nil {
+		return nil
+	}
+
+	var grandparent sql.NullInt64
+	err := tx.QueryRow(`SELECT parent_id FROM wallet_groups WHERE id=$1`, *g.ParentID).Scan(&grandparent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("parent %w", wallet.ErrGroupNotFound)
+	} else if err != nil {
+		return fmt.Errorf("failed to get parent group: %w", err)
+	} else if grandparent.Valid {
+		return wallet.ErrGroupDepth
+	}
+
+	if g.ID != 0 {
+		var hasChildren bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM wallet_groups WHERE parent_id=$1)`, g.ID).Scan(&hasChildren); err != nil {
+			return fmt.Errorf("failed to check subgroups: %w", err)
+		} else if hasChildren {
+			return wallet.ErrGroupDepth
+		}
+	}
+	return nil
+}
+
+func scanGroup(s scanner) (g wallet.Group, err error) {
+	var parentID sql.NullInt64
+	err = s.Scan(&g.ID, &g.Name, &g.Description, &parentID, decode(&g.DateCreated), decode(&g.LastUpdated))
+	if parentID.Valid {
+		id := wallet.GroupID(parentID.Int64)
+		g.ParentID = &id
+	}
+	return
+}
+
+// Groups returns all wallet groups.
+func (s *Store) Groups() (groups []wallet.Group, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT id, name, description, parent_id, date_created, last_updated FROM wallet_groups ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			g, err := scanGroup(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan group: %w", err)
+			}
+			groups = append(groups, g)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// AddGroup adds a wallet group.
+func (s *Store) AddGroup(g wallet.Group) (wallet.Group, error) {
+	g.ID = 0
+	g.DateCreated = time.Now().Truncate(time.Second)
+	g.LastUpdated = g.DateCreated
+	err := s.transaction(func(tx *txn) error {
+		if err := checkGroupParent(tx, g); err != nil {
+			return err
+		}
+		const query = `INSERT INTO wallet_groups (name, description, parent_id, date_created, last_updated) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+		return tx.QueryRow(query, g.Name, g.Description, g.ParentID, encode(g.DateCreated), encode(g.LastUpdated)).Scan(&g.ID)
+	})
+	return g, err
+}
+
+// UpdateGroup updates a wallet group.
+func (s *Store) UpdateGroup(g wallet.Group) (wallet.Group, error) {
+	g.LastUpdated = time.Now().Truncate(time.Second)
+	err := s.transaction(func(tx *txn) error {
+		if err := groupExists(tx, g.ID); err != nil {
+			return err
+		} else if err := checkGroupParent(tx, g); err != nil {
+			return err
+		}
+		const query = `UPDATE wallet_groups SET name=$1, description=$2, parent_id=$3, last_updated=$4 WHERE id=$5 RETURNING date_created`
+		return tx.QueryRow(query, g.Name, g.Description, g.ParentID, encode(g.LastUpdated), g.ID).Scan(decode(&g.DateCreated))
+	})
+	return g, err
+}
+
+// DeleteGroup deletes a wallet group. Its wallets are unassigned and its
+// subgroups become top-level groups.
+func (s *Store) DeleteGroup(id wallet.GroupID) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM wallet_groups WHERE id=$1`, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrGroupNotFound
+		}
+		return nil
+	})
+}
+
+// GroupWallets returns the wallets in a group and its subgroups.
+func (s *Store) GroupWallets(id wallet.GroupID) (wallets []wallet.Wallet, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := groupExists(tx, id); err != nil {
+			return err
+		}
+
+		query := `SELECT id, friendly_name, description, date_created, last_updated, extra_data, tenant, wallet_type, revision FROM wallets
+WHERE id IN (` + groupWalletsQuery + `)
+ORDER BY id ASC`
+		rows, err := tx.Query(query, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var w wallet.Wallet
+			if err := rows.Scan(&w.ID, &w.Name, &w.Description, decode(&w.DateCreated), decode(&w.LastUpdated), (*[]byte)(&w.Metadata), &w.Tenant, &w.Type, &w.Revision); err != nil {
+				return fmt.Errorf("failed to scan wallet: %w", err)
+			}
+			wallets = append(wallets, w)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// AddGroupWallet assigns a wallet to a group, removing it from any previous
+// group.
+func (s *Store) AddGroupWallet(id wallet.GroupID, walletID wallet.ID) error {
+	return s.transaction(func(tx *txn) error {
+		if err := groupExists(tx, id); err != nil {
+			return err
+		} else if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_group_members (wallet_id, group_id) VALUES ($1, $2) ON CONFLICT (wallet_id) DO UPDATE SET group_id=EXCLUDED.group_id`, walletID, id)
+		return err
+	})
+}
+
+// RemoveGroupWallet removes a wallet from a group.
+func (s *Store) RemoveGroupWallet(id wallet.GroupID, walletID wallet.ID) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM wallet_group_members WHERE wallet_id=$1 AND group_id=$2`, walletID, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// GroupBalance returns the combined balance of the wallets in a group and its
+// subgroups.
+func (s *Store) GroupBalance(id wallet.GroupID) (balance wallet.Balance, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := groupExists(tx, id); err != nil {
+			return err
+		}
+
+		// addresses shared by multiple wallets are only counted once
+		query := `SELECT siacoin_balance, immature_siacoin_balance, siafund_balance FROM sia_addresses
+WHERE id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id IN (` + groupWalletsQuery + `))`
+		rows, err := tx.Query(query, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addressSC types.Currency
+			var addressISC types.Currency
+			var addressSF uint64
+
+			if err := rows.Scan(decode(&addressSC), decode(&addressISC), &addressSF); err != nil {
+				return fmt.Errorf("failed to scan address balance: %w", err)
+			}
+			balance.Siacoins = balance.Siacoins.Add(addressSC)
+			balance.ImmatureSiacoins = balance.ImmatureSiacoins.Add(addressISC)
+			balance.Siafunds += addressSF
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// GroupEvents returns the events relevant to the wallets in a group and its
+// subgroups, sorted by height descending.
+func (s *Store) GroupEvents(ctx context.Context, id wallet.GroupID, offset, limit int) (events []wallet.Event, err error) {
+	err = s.scheduledReadTransaction(ctx, groupQueryKey(id), func(tx *txn) error {
+		if err := groupExists(tx, id); err != nil {
+			return err
+		}
+
+		query := `WITH last_chain_index AS (
+	SELECT last_indexed_height+1 AS height FROM global_settings LIMIT 1
+),
+group_addresses AS (
+	SELECT DISTINCT address_id FROM wallet_addresses WHERE wallet_id IN (` + groupWalletsQuery + `)
+),
+event_ids AS (
+	SELECT ev.id
+	FROM events ev
+	INNER JOIN event_addresses ea ON ev.id = ea.event_id
+	INNER JOIN group_addresses ga ON ea.address_id = ga.address_id
+	GROUP BY ev.id
+	ORDER BY ev.maturity_height DESC, ev.id DESC
+	LIMIT $2 OFFSET $3
+)
+SELECT
+	ev.id,
+	ev.event_id,
+	ev.maturity_height,
+	ev.date_created,
+	ci.height,
+	ci.block_id,
+	CASE
+		WHEN last_chain_index.height < ci.height THEN 0
+		ELSE last_chain_index.height - ci.height
+	END AS confirmations,
+	ev.event_type,
+	ev.event_data
+FROM events ev
+INNER JOIN event_ids ei ON ev.id = ei.id
+INNER JOIN chain_indices ci ON ev.chain_index_id = ci.id
+CROSS JOIN last_chain_index
+ORDER BY ev.maturity_height DESC, ev.id DESC`
+
+		rows, err := tx.Query(query, id, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		var dbIDs []int64
+		for rows.Next() {
+			event, eventID, err := scanEvent(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan event: %w", err)
+			}
+			events = append(events, event)
+			dbIDs = append(dbIDs, eventID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare(`SELECT DISTINCT sa.sia_address
+FROM event_addresses ea
+INNER JOIN sia_addresses sa ON (ea.address_id = sa.id)
+INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+WHERE wa.wallet_id IN (` + groupWalletsQuery + `) AND ea.event_id=$2`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for i := range events {
+			rows, err := stmt.Query(id, dbIDs[i])
+			if err != nil {
+				return fmt.Errorf("failed to query relevant addresses: %w", err)
+			}
+			for rows.Next() {
+				var address types.Address
+				if err := rows.Scan(decode(&address)); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan relevant address: %w", err)
+				}
+				events[i].Relevant = append(events[i].Relevant, address)
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
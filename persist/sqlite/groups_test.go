@@ -0,0 +1,110 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestGroups(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w1, err := db.AddWallet(wallet.Wallet{Name: "customer 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := db.AddWallet(wallet.Wallet{Name: "customer 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent, err := db.AddGroup(wallet.Group{Name: "retail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := db.AddGroup(wallet.Group{Name: "retail/eu", ParentID: &parent.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// groups can only be nested one level
+	if _, err := db.AddGroup(wallet.Group{Name: "retail/eu/de", ParentID: &child.ID}); !errors.Is(err, wallet.ErrGroupDepth) {
+		t.Fatalf("expected ErrGroupDepth, got %v", err)
+	}
+	other, err := db.AddGroup(wallet.Group{Name: "wholesale"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent.ParentID = &other.ID
+	if _, err := db.UpdateGroup(parent); !errors.Is(err, wallet.ErrGroupDepth) {
+		t.Fatalf("expected ErrGroupDepth, got %v", err)
+	}
+
+	if err := db.AddGroupWallet(parent.ID, w1.ID); err != nil {
+		t.Fatal(err)
+	} else if err := db.AddGroupWallet(child.ID, w2.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	checkWallets := func(id wallet.GroupID, expected ...wallet.ID) {
+		t.Helper()
+		wallets, err := db.GroupWallets(id)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(wallets) != len(expected) {
+			t.Fatalf("expected %d wallets, got %d", len(expected), len(wallets))
+		}
+		for i := range wallets {
+			if wallets[i].ID != expected[i] {
+				t.Fatalf("expected wallet %d, got %d", expected[i], wallets[i].ID)
+			}
+		}
+	}
+	// a group includes the wallets of its subgroups
+	checkWallets(parent.ID, w1.ID, w2.ID)
+	checkWallets(child.ID, w2.ID)
+
+	// assigning a wallet to a new group moves it
+	if err := db.AddGroupWallet(other.ID, w2.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkWallets(parent.ID, w1.ID)
+	checkWallets(other.ID, w2.ID)
+
+	if err := db.RemoveGroupWallet(parent.ID, w2.ID); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if err := db.RemoveGroupWallet(other.ID, w2.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkWallets(other.ID)
+
+	// deleting a parent promotes its subgroups
+	if err := db.DeleteGroup(parent.ID); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := db.Groups()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	} else if groups[0].ID != child.ID || groups[0].ParentID != nil {
+		t.Fatalf("expected group %d to have no parent, got %v", child.ID, groups[0].ParentID)
+	}
+
+	if _, err := db.GroupBalance(parent.ID); !errors.Is(err, wallet.ErrGroupNotFound) {
+		t.Fatalf("expected ErrGroupNotFound, got %v", err)
+	} else if events, err := db.GroupEvents(context.Background(), child.ID, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 0 {
+		t.Fatalf("expected no events, got %d", len(events))
+	}
+}
@@ -65,7 +65,7 @@ func (s *Store) init() error {
 	// calculate the expected final database version
 	target := int64(len(migrations) + 1)
 
-	version := getDBVersion(s.db)
+	version := getDBVersion(s.writer.db)
 	switch {
 	case version == 0:
 		return s.initNewDatabase(target)
@@ -59,7 +59,8 @@ CREATE TABLE events (
 	maturity_height INTEGER NOT NULL,
 	date_created INTEGER NOT NULL,
 	event_type TEXT NOT NULL,
-	event_data BLOB NOT NULL
+	event_data BLOB NOT NULL,
+	summarized BOOLEAN NOT NULL DEFAULT false /* true if the event's transaction was stored without its signatures or arbitrary data */
 );
 CREATE INDEX events_chain_index_id_idx ON events (chain_index_id);
 CREATE INDEX events_maturity_height_id_idx ON events (maturity_height DESC, id DESC);
@@ -73,14 +74,65 @@ CREATE INDEX event_addresses_event_id_idx ON event_addresses (event_id);
 CREATE INDEX event_addresses_address_id_idx ON event_addresses (address_id);
 CREATE INDEX event_addresses_event_id_address_id_idx ON event_addresses (event_id, address_id);
 
+-- reverted_events keeps events removed from the chain by a reorg with the
+-- chain index they were reported at. The id orders events by when they were
+-- reverted.
+CREATE TABLE reverted_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id BLOB UNIQUE NOT NULL,
+	block_id BLOB NOT NULL,
+	height INTEGER NOT NULL,
+	maturity_height INTEGER NOT NULL,
+	date_created INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	event_data BLOB NOT NULL,
+	date_reverted INTEGER NOT NULL
+);
+
+CREATE TABLE reverted_event_addresses (
+	event_id INTEGER NOT NULL REFERENCES reverted_events (id) ON DELETE CASCADE,
+	address_id INTEGER NOT NULL REFERENCES sia_addresses (id),
+	PRIMARY KEY (event_id, address_id)
+);
+CREATE INDEX reverted_event_addresses_address_id_idx ON reverted_event_addresses (address_id);
+
+CREATE TABLE event_fees (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	address_id INTEGER NOT NULL REFERENCES sia_addresses (id),
+	amount BLOB NOT NULL,
+	PRIMARY KEY (event_id, address_id)
+);
+CREATE INDEX event_fees_address_id_idx ON event_fees (address_id);
+
 CREATE TABLE wallets (
 	id INTEGER PRIMARY KEY,
 	friendly_name TEXT NOT NULL,
 	description TEXT NOT NULL,
 	date_created INTEGER NOT NULL,
 	last_updated INTEGER NOT NULL,
-	extra_data BLOB
+	extra_data BLOB,
+	tenant TEXT NOT NULL DEFAULT '',
+	wallet_type TEXT NOT NULL DEFAULT '',
+	revision INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX wallets_tenant_idx ON wallets (tenant);
+CREATE INDEX wallets_friendly_name_idx ON wallets (friendly_name);
+
+CREATE TABLE wallet_groups (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	parent_id INTEGER REFERENCES wallet_groups (id) ON DELETE SET NULL,
+	date_created INTEGER NOT NULL,
+	last_updated INTEGER NOT NULL
+);
+CREATE INDEX wallet_groups_parent_id_idx ON wallet_groups (parent_id);
+
+CREATE TABLE wallet_group_members (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	group_id INTEGER NOT NULL REFERENCES wallet_groups (id) ON DELETE CASCADE
 );
+CREATE INDEX wallet_group_members_group_id_idx ON wallet_group_members (group_id);
 
 CREATE TABLE wallet_addresses (
 	wallet_id INTEGER NOT NULL REFERENCES wallets (id),
@@ -88,6 +140,7 @@ CREATE TABLE wallet_addresses (
 	description TEXT NOT NULL,
 	spend_policy BLOB,
 	extra_data BLOB,
+	derivation_path TEXT NOT NULL DEFAULT '',
 	UNIQUE (wallet_id, address_id)
 );
 CREATE INDEX wallet_addresses_wallet_id_idx ON wallet_addresses (wallet_id);
@@ -106,11 +159,412 @@ CREATE TABLE syncer_bans (
 );
 CREATE INDEX syncer_bans_expiration_index_idx ON syncer_bans (expiration);
 
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY,
+	callback_url TEXT UNIQUE NOT NULL,
+	scopes TEXT NOT NULL,
+	secret_key TEXT NOT NULL,
+	date_created INTEGER NOT NULL,
+	tenant TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE wallet_policies (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	approval_threshold BLOB NOT NULL,
+	daily_limit BLOB NOT NULL,
+	weekly_limit BLOB NOT NULL,
+	restrict_destinations BOOLEAN NOT NULL,
+	allowlist_delay INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_fee_strategies (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	strategy BLOB NOT NULL
+);
+
+CREATE TABLE wallet_min_confirmations (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	min_confirmations INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_signers (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	signer TEXT NOT NULL
+);
+
+CREATE TABLE wallet_seeds (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	salt BLOB NOT NULL,
+	nonce BLOB NOT NULL,
+	ciphertext BLOB NOT NULL,
+	word_commitments BLOB NOT NULL,
+	backup_verified INTEGER, -- NULL if the backup was never verified
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE address_vaults (
+	id INTEGER PRIMARY KEY,
+	fingerprint BLOB UNIQUE NOT NULL,
+	next_index INTEGER NOT NULL,
+	wallet_id INTEGER REFERENCES wallets (id) ON DELETE SET NULL, -- NULL if the vault is not watching a wallet
+	lookahead INTEGER NOT NULL,
+	registered INTEGER NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE address_vault_addresses (
+	vault_id INTEGER NOT NULL REFERENCES address_vaults (id) ON DELETE CASCADE,
+	key_index INTEGER NOT NULL,
+	sia_address BLOB NOT NULL,
+	description TEXT NOT NULL,
+	date_issued INTEGER NOT NULL,
+	PRIMARY KEY (vault_id, key_index)
+);
+
+CREATE TABLE wallet_metadata_schemas (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	schema BLOB NOT NULL
+);
+
+-- wallet_metadata_values indexes the scalar values of each wallet's metadata
+-- by path for filtering. The value column has no type affinity so values keep
+-- their JSON type.
+CREATE TABLE wallet_metadata_values (
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	path TEXT NOT NULL,
+	value_type TEXT NOT NULL,
+	value
+);
+CREATE INDEX wallet_metadata_values_path_value_idx ON wallet_metadata_values (path, value);
+CREATE INDEX wallet_metadata_values_wallet_id_idx ON wallet_metadata_values (wallet_id);
+
+CREATE TABLE pending_transactions (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	amount BLOB NOT NULL,
+	transactions BLOB NOT NULL,
+	status TEXT NOT NULL,
+	submitted_by TEXT NOT NULL,
+	decided_by TEXT,
+	date_created INTEGER NOT NULL,
+	date_decided INTEGER
+);
+CREATE INDEX pending_transactions_status_idx ON pending_transactions (status);
+
+CREATE TABLE wallet_limit_overrides (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	expiration INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_spends (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	amount BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX wallet_spends_wallet_id_date_created_idx ON wallet_spends (wallet_id, date_created);
+
+CREATE TABLE signed_transactions (
+	transaction_id BLOB PRIMARY KEY,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_allowlist (
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB NOT NULL,
+	description TEXT NOT NULL,
+	date_added INTEGER NOT NULL,
+	active_after INTEGER NOT NULL,
+	UNIQUE (wallet_id, address)
+);
+
+CREATE TABLE address_tags (
+	address BLOB PRIMARY KEY,
+	label TEXT NOT NULL,
+	category TEXT NOT NULL,
+	source TEXT NOT NULL,
+	date_added INTEGER NOT NULL
+);
+
+CREATE TABLE payment_batches (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	txn BLOB NOT NULL,
+	v2_txn BLOB,
+	basis BLOB,
+	to_sign BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX payment_batches_wallet_id_idx ON payment_batches (wallet_id);
+
+CREATE TABLE withdrawal_proposals (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB NOT NULL,
+	inputs BLOB NOT NULL,
+	sig_hash BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_updated INTEGER NOT NULL
+);
+CREATE INDEX withdrawal_proposals_wallet_id_status_idx ON withdrawal_proposals (wallet_id, status);
+
+CREATE TABLE threshold_groups (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	public_key BLOB NOT NULL,
+	threshold INTEGER NOT NULL,
+	max_participants INTEGER NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE threshold_participants (
+	group_id INTEGER NOT NULL REFERENCES threshold_groups (id) ON DELETE CASCADE,
+	participant_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	date_registered INTEGER NOT NULL,
+	PRIMARY KEY (group_id, participant_id)
+);
+
+CREATE TABLE wallet_rotations (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	old_addresses BLOB NOT NULL,
+	new_addresses BLOB NOT NULL,
+	max_fee_rate BLOB NOT NULL,
+	max_inputs INTEGER NOT NULL,
+	sweeps INTEGER NOT NULL,
+	swept BLOB NOT NULL,
+	fees BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	last_sweep INTEGER NOT NULL,
+	date_completed INTEGER NOT NULL
+);
+CREATE INDEX wallet_rotations_wallet_id_idx ON wallet_rotations (wallet_id);
+CREATE INDEX wallet_rotations_status_idx ON wallet_rotations (status);
+
+CREATE TABLE rotation_sweeps (
+	id INTEGER PRIMARY KEY,
+	rotation_id INTEGER NOT NULL REFERENCES wallet_rotations (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB NOT NULL,
+	value BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX rotation_sweeps_rotation_id_idx ON rotation_sweeps (rotation_id);
+
+CREATE TABLE payments (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB NOT NULL,
+	value BLOB NOT NULL,
+	batch_id INTEGER REFERENCES payment_batches (id) ON DELETE CASCADE,
+	date_queued INTEGER NOT NULL
+);
+CREATE INDEX payments_wallet_id_batch_id_idx ON payments (wallet_id, batch_id);
+CREATE INDEX payments_batch_id_idx ON payments (batch_id);
+
+CREATE TABLE wallet_templates (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	metadata BLOB,
+	metadata_schema BLOB,
+	fee_strategy BLOB,
+	webhooks BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	last_updated INTEGER NOT NULL
+);
+
+CREATE TABLE api_usage (
+	date INTEGER NOT NULL,
+	tenant TEXT NOT NULL,
+	principal TEXT NOT NULL,
+	calls INTEGER NOT NULL,
+	PRIMARY KEY (date, tenant, principal)
+);
+
+CREATE TABLE chain_triggers (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	height INTEGER NOT NULL,
+	block_interval INTEGER NOT NULL,
+	next_height INTEGER NOT NULL,
+	last_fired_height INTEGER NOT NULL,
+	last_fired_id BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX chain_triggers_next_height_idx ON chain_triggers (next_height);
+
+CREATE TABLE forwarding_rules (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB UNIQUE NOT NULL,
+	destination BLOB NOT NULL,
+	splits BLOB NOT NULL,
+	min_confirmations INTEGER NOT NULL,
+	min_amount BLOB NOT NULL,
+	sweeps INTEGER NOT NULL,
+	forwarded BLOB NOT NULL,
+	fees BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	last_sweep INTEGER NOT NULL
+);
+CREATE INDEX forwarding_rules_wallet_id_idx ON forwarding_rules (wallet_id);
+
+CREATE TABLE forwarding_sweeps (
+	id INTEGER PRIMARY KEY,
+	rule_id INTEGER NOT NULL, /* not a foreign key so sweeps are kept when their rule is removed */
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB NOT NULL,
+	destination BLOB NOT NULL,
+	splits BLOB NOT NULL,
+	status TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB NOT NULL,
+	value BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX forwarding_sweeps_wallet_id_rule_id_idx ON forwarding_sweeps (wallet_id, rule_id);
+
+CREATE TABLE escrows (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	buyer_key BLOB NOT NULL,
+	seller_key BLOB NOT NULL,
+	arbiter_key BLOB NOT NULL,
+	buyer_address BLOB NOT NULL,
+	seller_address BLOB NOT NULL,
+	address BLOB NOT NULL,
+	policy BLOB NOT NULL,
+	amount BLOB NOT NULL,
+	settlement BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_funded INTEGER NOT NULL,
+	date_settled INTEGER NOT NULL
+);
+CREATE INDEX escrows_wallet_id_idx ON escrows (wallet_id);
+CREATE INDEX escrows_status_idx ON escrows (status);
+
+CREATE TABLE transfers (
+	id INTEGER PRIMARY KEY,
+	from_wallet_id INTEGER NOT NULL, /* not foreign keys so transfers are kept when a wallet is deleted */
+	to_wallet_id INTEGER NOT NULL,
+	value BLOB NOT NULL,
+	method TEXT NOT NULL,
+	status TEXT NOT NULL,
+	memo TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE transfer_entries (
+	id INTEGER PRIMARY KEY,
+	transfer_id INTEGER NOT NULL REFERENCES transfers (id),
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	counterparty_id INTEGER NOT NULL,
+	entry_type TEXT NOT NULL,
+	value BLOB NOT NULL
+);
+CREATE INDEX transfer_entries_wallet_id_idx ON transfer_entries (wallet_id);
+CREATE INDEX transfer_entries_transfer_id_idx ON transfer_entries (transfer_id);
+
+CREATE TABLE wallet_digests (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	frequency TEXT NOT NULL,
+	last_period INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_balance_alarms (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address_id INTEGER REFERENCES sia_addresses (id), /* NULL if the alarm watches the wallet's balance */
+	low_balance BLOB,
+	high_balance BLOB,
+	state TEXT NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_triggered INTEGER NOT NULL
+);
+CREATE INDEX wallet_balance_alarms_wallet_id_idx ON wallet_balance_alarms (wallet_id);
+
+CREATE TABLE classification_rules (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	category TEXT NOT NULL,
+	conditions BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE event_categories (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	category TEXT NOT NULL,
+	PRIMARY KEY (event_id, category)
+);
+CREATE INDEX event_categories_category_idx ON event_categories (category);
+
+CREATE TABLE event_enrichments (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	field TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (event_id, field)
+);
+
+CREATE TABLE event_counterparties (
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	address BLOB NOT NULL,
+	role TEXT NOT NULL,
+	value BLOB NOT NULL,
+	label TEXT NOT NULL,
+	category TEXT NOT NULL,
+	counterparty_wallet_id INTEGER NOT NULL,
+	PRIMARY KEY (wallet_id, event_id, position)
+);
+CREATE INDEX event_counterparties_event_id_idx ON event_counterparties (event_id);
+
+-- unresolved_events queues the applied events relevant to wallets until
+-- their counterparties are resolved and broadcast.
+CREATE TABLE unresolved_events (
+	event_id INTEGER PRIMARY KEY REFERENCES events (id) ON DELETE CASCADE
+);
+
+CREATE TABLE approvers (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	shared_key BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_totp (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	secret BLOB NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	last_counter INTEGER NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_enabled INTEGER NOT NULL
+);
+
 CREATE TABLE global_settings (
 	id INTEGER PRIMARY KEY NOT NULL DEFAULT 0 CHECK (id = 0), -- enforce a single row
 	db_version INTEGER NOT NULL, -- used for migrations
 	index_mode INTEGER, -- the mode of the data store
 	last_indexed_height INTEGER NOT NULL, -- the height of the last chain index that was processed
 	last_indexed_id BLOB NOT NULL, -- the block ID of the last chain index that was processed
-	element_num_leaves INTEGER NOT NULL -- the number of leaves in the state tree
+	element_num_leaves INTEGER NOT NULL, -- the number of leaves in the state tree
+	deferred_index_event_id INTEGER -- if not NULL, events after this ID have not been classified or enriched
 );
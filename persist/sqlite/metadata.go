@@ -0,0 +1,92 @@
+package sqlite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// indexWalletMetadata replaces the indexed metadata values of a wallet.
+// Metadata that is not valid JSON is not indexed.
+func indexWalletMetadata(tx *txn, id wallet.ID, metadata []byte) error {
+	if _, err := tx.Exec(`DELETE FROM wallet_metadata_values WHERE wallet_id=$1`, id); err != nil {
+		return fmt.Errorf("failed to delete metadata values: %w", err)
+	} else if len(metadata) == 0 || !json.Valid(metadata) {
+		return nil
+	}
+
+	// array elements are indexed under the path of their array so a filter
+	// can match any element
+	const query = `INSERT INTO wallet_metadata_values (wallet_id, path, value_type, value)
+SELECT $1, CASE WHEN typeof(key)='integer' THEN path ELSE fullkey END, type, atom FROM json_tree($2)
+WHERE type NOT IN ('object', 'array')`
+	if _, err := tx.Exec(query, id, string(metadata)); err != nil {
+		return fmt.Errorf("failed to insert metadata values: %w", err)
+	}
+	return nil
+}
+
+// metadataPath returns the path of a metadata value in the format of
+// json_tree's fullkey column. Keys are quoted unless they are alphanumeric
+// and start with a letter.
+func metadataPath(keys []string) string {
+	isPlain := func(key string) bool {
+		for i, c := range key {
+			isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+			if !isLetter && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+		return true
+	}
+
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, key := range keys {
+		sb.WriteString(".")
+		if isPlain(key) {
+			sb.WriteString(key)
+		} else {
+			sb.WriteString(`"` + key + `"`)
+		}
+	}
+	return sb.String()
+}
+
+// metadataCondition returns a condition matching wallets with the filter's
+// value. Parameters are numbered starting at n.
+func metadataCondition(mf wallet.MetadataFilter, n int) (string, []any, error) {
+	dec := json.NewDecoder(bytes.NewReader(mf.Value))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", nil, fmt.Errorf("failed to decode metadata filter value: %w", err)
+	}
+
+	path := metadataPath(mf.Path)
+	const subquery = `w.id IN (SELECT wallet_id FROM wallet_metadata_values WHERE path=$%d AND %s)`
+	switch v := v.(type) {
+	case nil:
+		return fmt.Sprintf(subquery, n, `value_type='null'`), []any{path}, nil
+	case bool:
+		return fmt.Sprintf(subquery, n, fmt.Sprintf(`value_type=$%d`, n+1)), []any{path, strconv.FormatBool(v)}, nil
+	case string:
+		return fmt.Sprintf(subquery, n, fmt.Sprintf(`value_type='text' AND value=$%d`, n+1)), []any{path, v}, nil
+	case json.Number:
+		var value any
+		if i, err := v.Int64(); err == nil {
+			value = i
+		} else if f, err := v.Float64(); err == nil {
+			value = f
+		} else {
+			return "", nil, fmt.Errorf("invalid metadata filter number %q", v)
+		}
+		return fmt.Sprintf(subquery, n, fmt.Sprintf(`value_type IN ('integer', 'real') AND value=$%d`, n+1)), []any{path, value}, nil
+	default:
+		return "", nil, fmt.Errorf("metadata filter value must be a scalar, got %T", v)
+	}
+}
@@ -0,0 +1,158 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestFilterWallets(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	addWallet := func(name, tenant, metadata string) wallet.Wallet {
+		t.Helper()
+		w, err := db.AddWallet(wallet.Wallet{Name: name, Tenant: tenant, Metadata: json.RawMessage(metadata)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+	w1 := addWallet("customer 1", "", `{"customerID":123,"tier":"gold","owner":{"email":"a@example.com"},"tags":["vip","eu"]}`)
+	w2 := addWallet("customer 2", "", `{"customerID":"123","tier":"gold","active":true,"tax_id":null}`)
+	w3 := addWallet("customer 3", "acme", `{"customerID":456,"tier":"silver","tags":["eu"]}`)
+	w4 := addWallet("treasury", "", `null`)
+
+	filter := func(path, value string) wallet.MetadataFilter {
+		t.Helper()
+		mf, err := wallet.ParseMetadataFilter(path, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mf
+	}
+
+	tests := []struct {
+		name   string
+		filter wallet.WalletFilter
+		want   []wallet.ID
+	}{
+		{"all", wallet.WalletFilter{Limit: -1}, []wallet.ID{w1.ID, w2.ID, w3.ID, w4.ID}},
+		{"tenant", wallet.WalletFilter{Tenant: "acme", Limit: -1}, []wallet.ID{w3.ID}},
+		{"name prefix", wallet.WalletFilter{NamePrefix: "customer", Limit: -1}, []wallet.ID{w1.ID, w2.ID, w3.ID}},
+		{"name prefix case", wallet.WalletFilter{NamePrefix: "Customer", Limit: -1}, nil},
+		{"number", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("customerID", "123")}, Limit: -1}, []wallet.ID{w1.ID}},
+		{"quoted string", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("customerID", `"123"`)}, Limit: -1}, []wallet.ID{w2.ID}},
+		{"string", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("tier", "gold")}, Limit: -1}, []wallet.ID{w1.ID, w2.ID}},
+		{"bool", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("active", "true")}, Limit: -1}, []wallet.ID{w2.ID}},
+		{"null", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("tax_id", "null")}, Limit: -1}, []wallet.ID{w2.ID}},
+		{"nested", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("owner.email", "a@example.com")}, Limit: -1}, []wallet.ID{w1.ID}},
+		{"array element", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("tags", "eu")}, Limit: -1}, []wallet.ID{w1.ID, w3.ID}},
+		{"multiple", wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("tags", "eu"), filter("tier", "silver")}, Limit: -1}, []wallet.ID{w3.ID}},
+		{"limit", wallet.WalletFilter{Limit: 2}, []wallet.ID{w1.ID, w2.ID}},
+		{"offset", wallet.WalletFilter{Offset: 3, Limit: 2}, []wallet.ID{w4.ID}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			wallets, _, err := db.FilterWallets(test.filter)
+			if err != nil {
+				t.Fatal(err)
+			} else if len(wallets) != len(test.want) {
+				t.Fatalf("expected %d wallets, got %d", len(test.want), len(wallets))
+			}
+			for i := range wallets {
+				if wallets[i].ID != test.want[i] {
+					t.Fatalf("expected wallet %d, got %d", test.want[i], wallets[i].ID)
+				}
+			}
+		})
+	}
+
+	// updating a wallet reindexes its metadata
+	w1.Metadata = json.RawMessage(`{"tier":"silver"}`)
+	if _, err := db.UpdateWallet(w1); err != nil {
+		t.Fatal(err)
+	}
+	wallets, _, err := db.FilterWallets(wallet.WalletFilter{Metadata: []wallet.MetadataFilter{filter("tier", "silver")}, Limit: -1})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(wallets) != 2 || wallets[0].ID != w1.ID || wallets[1].ID != w3.ID {
+		t.Fatalf("unexpected wallets after update: %+v", wallets)
+	}
+
+	// deleting a wallet removes its indexed values
+	if err := db.DeleteWallet(w3.ID); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.writer.db.QueryRow(`SELECT COUNT(*) FROM wallet_metadata_values WHERE wallet_id=$1`, w3.ID).Scan(&n); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected no indexed values, got %d", n)
+	}
+}
+
+func TestSortWallets(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// add wallets with names and balances in different orders
+	var ids []wallet.ID
+	for i, name := range []string{"bob", "carol", "alice"} {
+		w, err := db.AddWallet(wallet.Wallet{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, w.ID)
+
+		addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+		if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+			t.Fatal(err)
+		}
+		balance := types.Siacoins(uint32([]int{20, 10, 30}[i]))
+		if _, err := db.writer.db.Exec(`UPDATE sia_addresses SET siacoin_balance=$1 WHERE sia_address=$2`, encode(balance), encode(addr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter wallet.WalletFilter
+		want   []wallet.ID
+	}{
+		{wallet.WalletFilter{Limit: -1}, ids},
+		{wallet.WalletFilter{SortBy: wallet.WalletSortID, Descending: true, Limit: -1}, []wallet.ID{ids[2], ids[1], ids[0]}},
+		{wallet.WalletFilter{SortBy: wallet.WalletSortName, Limit: -1}, []wallet.ID{ids[2], ids[0], ids[1]}},
+		{wallet.WalletFilter{SortBy: wallet.WalletSortName, Offset: 1, Limit: 1}, []wallet.ID{ids[0]}},
+		{wallet.WalletFilter{SortBy: wallet.WalletSortBalance, Limit: -1}, []wallet.ID{ids[1], ids[0], ids[2]}},
+		{wallet.WalletFilter{SortBy: wallet.WalletSortBalance, Descending: true, Offset: 1, Limit: 5}, []wallet.ID{ids[0], ids[1]}},
+		{wallet.WalletFilter{SortBy: wallet.WalletSortLastActivity, Limit: -1}, ids},
+	}
+	for _, test := range tests {
+		wallets, total, err := db.FilterWallets(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		} else if total != len(ids) {
+			t.Fatalf("expected total %d, got %d", len(ids), total)
+		}
+		got := make([]wallet.ID, 0, len(wallets))
+		for _, w := range wallets {
+			got = append(got, w.ID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("%+v: expected %v, got %v", test.filter, test.want, got)
+		}
+	}
+}
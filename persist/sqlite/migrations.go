@@ -1,9 +1,12 @@
 package sqlite
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
 	"go.uber.org/zap"
 )
 
@@ -155,12 +158,841 @@ CREATE INDEX IF NOT EXISTS syncer_bans_expiration_index_idx ON syncer_bans (expi
 	return err
 }
 
+// migrateVersion6 adds the webhooks, wallet_policies, and
+// pending_transactions tables
+func migrateVersion6(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY,
+	callback_url TEXT UNIQUE NOT NULL,
+	scopes TEXT NOT NULL,
+	secret_key TEXT NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE wallet_policies (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	policy BLOB NOT NULL
+);
+
+CREATE TABLE pending_transactions (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	amount BLOB NOT NULL,
+	transactions BLOB NOT NULL,
+	status TEXT NOT NULL,
+	submitted_by TEXT NOT NULL,
+	decided_by TEXT,
+	date_created INTEGER NOT NULL,
+	date_decided INTEGER
+);
+CREATE INDEX pending_transactions_status_idx ON pending_transactions (status);`)
+	return err
+}
+
+// migrateVersion7 adds the wallet_spends table
+func migrateVersion7(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_spends (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	amount BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX wallet_spends_wallet_id_date_created_idx ON wallet_spends (wallet_id, date_created);`)
+	return err
+}
+
+// migrateVersion8 adds the wallet_allowlist table
+func migrateVersion8(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_allowlist (
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB NOT NULL,
+	description TEXT NOT NULL,
+	date_added INTEGER NOT NULL,
+	active_after INTEGER NOT NULL,
+	UNIQUE (wallet_id, address)
+);`)
+	return err
+}
+
+// migrateVersion9 adds the address_tags table
+func migrateVersion9(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE address_tags (
+	address BLOB PRIMARY KEY,
+	label TEXT NOT NULL,
+	category TEXT NOT NULL,
+	source TEXT NOT NULL,
+	date_added INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion10 adds the payments and payment_batches tables
+func migrateVersion10(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE payment_batches (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	txn BLOB NOT NULL,
+	to_sign BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX payment_batches_wallet_id_idx ON payment_batches (wallet_id);
+CREATE TABLE payments (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB NOT NULL,
+	value BLOB NOT NULL,
+	batch_id INTEGER REFERENCES payment_batches (id) ON DELETE CASCADE,
+	date_queued INTEGER NOT NULL
+);
+CREATE INDEX payments_wallet_id_batch_id_idx ON payments (wallet_id, batch_id);
+CREATE INDEX payments_batch_id_idx ON payments (batch_id);`)
+	return err
+}
+
+// migrateVersion11 adds the event_fees table and records the fees of
+// existing transaction events
+func migrateVersion11(tx *txn, log *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE event_fees (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	address_id INTEGER NOT NULL REFERENCES sia_addresses (id),
+	amount BLOB NOT NULL,
+	PRIMARY KEY (event_id, address_id)
+);
+CREATE INDEX event_fees_address_id_idx ON event_fees (address_id);`)
+	if err != nil {
+		return fmt.Errorf("failed to create event_fees table: %w", err)
+	}
+
+	relevantStmt, err := tx.Prepare(`SELECT sa.id, sa.sia_address FROM event_addresses ea INNER JOIN sia_addresses sa ON (ea.address_id = sa.id) WHERE ea.event_id=$1`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare relevant address statement: %w", err)
+	}
+	defer relevantStmt.Close()
+
+	feeStmt, err := tx.Prepare(`INSERT INTO event_fees (event_id, address_id, amount) VALUES ($1, $2, $3) ON CONFLICT (event_id, address_id) DO NOTHING`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare fee statement: %w", err)
+	}
+	defer feeStmt.Close()
+
+	type storedEvent struct {
+		id  int64
+		ev  wallet.Event
+		buf []byte
+	}
+
+	const batchSize = 1000
+	var lastID int64
+	var recorded int
+	for {
+		rows, err := tx.Query(`SELECT id, event_type, event_data FROM events WHERE id > $1 AND event_type IN ($2, $3) ORDER BY id ASC LIMIT $4`, lastID, wallet.EventTypeV1Transaction, wallet.EventTypeV2Transaction, batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to query events: %w", err)
+		}
+		var events []storedEvent
+		for rows.Next() {
+			var se storedEvent
+			if err := rows.Scan(&se.id, &se.ev.Type, &se.buf); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan event: %w", err)
+			}
+			events = append(events, se)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		} else if len(events) == 0 {
+			break
+		}
+
+		for _, se := range events {
+			lastID = se.id
+
+			dec := types.NewBufDecoder(se.buf)
+			if se.ev.Type == wallet.EventTypeV1Transaction {
+				se.ev.Data = decodeEventData[wallet.EventV1Transaction](dec)
+			} else {
+				se.ev.Data = decodeEventData[wallet.EventV2Transaction](dec)
+			}
+			if err := dec.Err(); err != nil {
+				return fmt.Errorf("failed to decode event %d: %w", se.id, err)
+			}
+
+			addressIDs := make(map[types.Address]int64)
+			rows, err := relevantStmt.Query(se.id)
+			if err != nil {
+				return fmt.Errorf("failed to query relevant addresses: %w", err)
+			}
+			for rows.Next() {
+				var id int64
+				var addr types.Address
+				if err := rows.Scan(&id, decode(&addr)); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan relevant address: %w", err)
+				}
+				addressIDs[addr] = id
+				se.ev.Relevant = append(se.ev.Relevant, addr)
+			}
+			if err := rows.Close(); err != nil {
+				return err
+			}
+
+			fee, payers := wallet.TransactionFee(se.ev)
+			if fee.IsZero() {
+				continue
+			}
+			for _, addr := range payers {
+				if _, err := feeStmt.Exec(se.id, addressIDs[addr], encode(fee)); err != nil {
+					return fmt.Errorf("failed to add fee: %w", err)
+				}
+			}
+			recorded++
+		}
+	}
+	log.Debug("recorded fees of existing transactions", zap.Int("transactions", recorded))
+	return nil
+}
+
 // migrations is a list of functions that are run to migrate the database from
 // one version to the next. Migrations are used to update existing databases to
 // match the schema in init.sql.
+// migrateVersion12 adds the wallet_fee_strategies table
+func migrateVersion12(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_fee_strategies (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	strategy BLOB NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion13 adds the wallet_groups and wallet_group_members tables
+func migrateVersion13(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_groups (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	parent_id INTEGER REFERENCES wallet_groups (id) ON DELETE SET NULL,
+	date_created INTEGER NOT NULL,
+	last_updated INTEGER NOT NULL
+);
+CREATE INDEX wallet_groups_parent_id_idx ON wallet_groups (parent_id);
+CREATE TABLE wallet_group_members (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	group_id INTEGER NOT NULL REFERENCES wallet_groups (id) ON DELETE CASCADE
+);
+CREATE INDEX wallet_group_members_group_id_idx ON wallet_group_members (group_id);`)
+	return err
+}
+
+// migrateVersion14 adds the tenant column to the wallets and webhooks tables
+func migrateVersion14(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE wallets ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+CREATE INDEX wallets_tenant_idx ON wallets (tenant);
+ALTER TABLE webhooks ADD COLUMN tenant TEXT NOT NULL DEFAULT '';`)
+	return err
+}
+
+// migrateVersion15 adds the api_usage table
+func migrateVersion15(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE api_usage (
+	date INTEGER NOT NULL,
+	tenant TEXT NOT NULL,
+	principal TEXT NOT NULL,
+	calls INTEGER NOT NULL,
+	PRIMARY KEY (date, tenant, principal)
+);`)
+	return err
+}
+
+// migrateVersion16 adds the wallet_templates table
+func migrateVersion16(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_templates (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL,
+	metadata BLOB,
+	fee_strategy BLOB,
+	webhooks BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	last_updated INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion17 adds the wallet_metadata_schemas table and the
+// metadata_schema column to the wallet_templates table
+func migrateVersion17(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_metadata_schemas (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	schema BLOB NOT NULL
+);
+ALTER TABLE wallet_templates ADD COLUMN metadata_schema BLOB;`)
+	return err
+}
+
+// migrateVersion18 adds the wallet_metadata_values table and an index on
+// wallet names
+func migrateVersion18(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_metadata_values (
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	path TEXT NOT NULL,
+	value_type TEXT NOT NULL,
+	value
+);
+CREATE INDEX wallet_metadata_values_path_value_idx ON wallet_metadata_values (path, value);
+CREATE INDEX wallet_metadata_values_wallet_id_idx ON wallet_metadata_values (wallet_id);
+CREATE INDEX wallets_friendly_name_idx ON wallets (friendly_name);`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, extra_data FROM wallets`)
+	if err != nil {
+		return fmt.Errorf("failed to query wallets: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[int64][]byte)
+	for rows.Next() {
+		var id int64
+		var buf []byte
+		if err := rows.Scan(&id, &buf); err != nil {
+			return fmt.Errorf("failed to scan wallet: %w", err)
+		}
+		metadata[id] = buf
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, buf := range metadata {
+		if err := indexWalletMetadata(tx, wallet.ID(id), buf); err != nil {
+			return fmt.Errorf("failed to index metadata of wallet %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// migrateVersion19 adds the reverted_events and reverted_event_addresses
+// tables
+func migrateVersion19(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE reverted_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id BLOB UNIQUE NOT NULL,
+	block_id BLOB NOT NULL,
+	height INTEGER NOT NULL,
+	maturity_height INTEGER NOT NULL,
+	date_created INTEGER NOT NULL,
+	event_type TEXT NOT NULL,
+	event_data BLOB NOT NULL,
+	date_reverted INTEGER NOT NULL
+);
+
+CREATE TABLE reverted_event_addresses (
+	event_id INTEGER NOT NULL REFERENCES reverted_events (id) ON DELETE CASCADE,
+	address_id INTEGER NOT NULL REFERENCES sia_addresses (id),
+	PRIMARY KEY (event_id, address_id)
+);
+CREATE INDEX reverted_event_addresses_address_id_idx ON reverted_event_addresses (address_id);`)
+	return err
+}
+
+// migrateVersion20 adds wallet types, address derivation paths, and the
+// withdrawal_proposals table
+func migrateVersion20(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE wallets ADD COLUMN wallet_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE wallet_addresses ADD COLUMN derivation_path TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE withdrawal_proposals (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB NOT NULL,
+	inputs BLOB NOT NULL,
+	sig_hash BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_updated INTEGER NOT NULL
+);
+CREATE INDEX withdrawal_proposals_wallet_id_status_idx ON withdrawal_proposals (wallet_id, status);`)
+	return err
+}
+
+// migrateVersion21 adds the wallet_signers table.
+func migrateVersion21(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_signers (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	signer TEXT NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion22 adds the threshold_groups and threshold_participants
+// tables.
+func migrateVersion22(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE threshold_groups (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	public_key BLOB NOT NULL,
+	threshold INTEGER NOT NULL,
+	max_participants INTEGER NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE threshold_participants (
+	group_id INTEGER NOT NULL REFERENCES threshold_groups (id) ON DELETE CASCADE,
+	participant_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	date_registered INTEGER NOT NULL,
+	PRIMARY KEY (group_id, participant_id)
+);`)
+	return err
+}
+
+// migrateVersion23 adds the wallet_rotations and rotation_sweeps tables.
+func migrateVersion23(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_rotations (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	old_addresses BLOB NOT NULL,
+	new_addresses BLOB NOT NULL,
+	max_fee_rate BLOB NOT NULL,
+	max_inputs INTEGER NOT NULL,
+	sweeps INTEGER NOT NULL,
+	swept BLOB NOT NULL,
+	fees BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	last_sweep INTEGER NOT NULL,
+	date_completed INTEGER NOT NULL
+);
+CREATE INDEX wallet_rotations_wallet_id_idx ON wallet_rotations (wallet_id);
+CREATE INDEX wallet_rotations_status_idx ON wallet_rotations (status);
+
+CREATE TABLE rotation_sweeps (
+	id INTEGER PRIMARY KEY,
+	rotation_id INTEGER NOT NULL REFERENCES wallet_rotations (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB NOT NULL,
+	value BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX rotation_sweeps_rotation_id_idx ON rotation_sweeps (rotation_id);`)
+	return err
+}
+
+// migrateVersion24 adds the wallet_seeds table.
+func migrateVersion24(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_seeds (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	salt BLOB NOT NULL,
+	nonce BLOB NOT NULL,
+	ciphertext BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion25 adds backup verification to stored seeds. Existing seeds
+// have no word commitments, encoded as an empty slice.
+func migrateVersion25(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE wallet_seeds ADD COLUMN word_commitments BLOB NOT NULL DEFAULT X'0000000000000000';
+ALTER TABLE wallet_seeds ADD COLUMN backup_verified INTEGER;`)
+	return err
+}
+
+// migrateVersion26 adds the address_vaults and address_vault_addresses
+// tables.
+func migrateVersion26(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE address_vaults (
+	id INTEGER PRIMARY KEY,
+	fingerprint BLOB UNIQUE NOT NULL,
+	next_index INTEGER NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE address_vault_addresses (
+	vault_id INTEGER NOT NULL REFERENCES address_vaults (id) ON DELETE CASCADE,
+	key_index INTEGER NOT NULL,
+	sia_address BLOB NOT NULL,
+	description TEXT NOT NULL,
+	date_issued INTEGER NOT NULL,
+	PRIMARY KEY (vault_id, key_index)
+);`)
+	return err
+}
+
+// migrateVersion27 adds the watched wallet and lookahead to address vaults.
+func migrateVersion27(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE address_vaults ADD COLUMN wallet_id INTEGER REFERENCES wallets (id) ON DELETE SET NULL;
+ALTER TABLE address_vaults ADD COLUMN lookahead INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE address_vaults ADD COLUMN registered INTEGER NOT NULL DEFAULT 0;`)
+	return err
+}
+
+// migrateVersion28 adds the chain_triggers table.
+func migrateVersion28(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE chain_triggers (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	height INTEGER NOT NULL,
+	block_interval INTEGER NOT NULL,
+	next_height INTEGER NOT NULL,
+	last_fired_height INTEGER NOT NULL,
+	last_fired_id BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX chain_triggers_next_height_idx ON chain_triggers (next_height);`)
+	return err
+}
+
+// migrateVersion29 adds revisions to wallets.
+func migrateVersion29(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE wallets ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;`)
+	return err
+}
+
+// migrateVersion30 adds the forwarding_rules and forwarding_sweeps tables.
+func migrateVersion30(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE forwarding_rules (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB UNIQUE NOT NULL,
+	destination BLOB NOT NULL,
+	min_confirmations INTEGER NOT NULL,
+	min_amount BLOB NOT NULL,
+	sweeps INTEGER NOT NULL,
+	forwarded BLOB NOT NULL,
+	fees BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	last_sweep INTEGER NOT NULL
+);
+CREATE INDEX forwarding_rules_wallet_id_idx ON forwarding_rules (wallet_id);
+
+CREATE TABLE forwarding_sweeps (
+	id INTEGER PRIMARY KEY,
+	rule_id INTEGER NOT NULL, /* not a foreign key so sweeps are kept when their rule is removed */
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address BLOB NOT NULL,
+	destination BLOB NOT NULL,
+	status TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB NOT NULL,
+	value BLOB NOT NULL,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+CREATE INDEX forwarding_sweeps_wallet_id_rule_id_idx ON forwarding_sweeps (wallet_id, rule_id);`)
+	return err
+}
+
+// migrateVersion31 adds split destinations to forwarding rules and sweeps.
+func migrateVersion31(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE forwarding_rules ADD COLUMN splits BLOB NOT NULL DEFAULT 'null';
+ALTER TABLE forwarding_sweeps ADD COLUMN splits BLOB NOT NULL DEFAULT 'null';`)
+	return err
+}
+
+// migrateVersion32 adds the escrows table.
+func migrateVersion32(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE escrows (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	buyer_key BLOB NOT NULL,
+	seller_key BLOB NOT NULL,
+	arbiter_key BLOB NOT NULL,
+	buyer_address BLOB NOT NULL,
+	seller_address BLOB NOT NULL,
+	address BLOB NOT NULL,
+	policy BLOB NOT NULL,
+	amount BLOB NOT NULL,
+	settlement BLOB NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_funded INTEGER NOT NULL,
+	date_settled INTEGER NOT NULL
+);
+CREATE INDEX escrows_wallet_id_idx ON escrows (wallet_id);
+CREATE INDEX escrows_status_idx ON escrows (status);`)
+	return err
+}
+
+// migrateVersion33 adds event classification rules and event categories.
+func migrateVersion33(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE classification_rules (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	category TEXT NOT NULL,
+	conditions BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE event_categories (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	category TEXT NOT NULL,
+	PRIMARY KEY (event_id, category)
+);
+CREATE INDEX event_categories_category_idx ON event_categories (category);`)
+	return err
+}
+
+// migrateVersion34 adds the approvers table.
+func migrateVersion34(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE approvers (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	shared_key BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion35 adds the wallet_totp table.
+func migrateVersion35(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_totp (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	secret BLOB NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	last_counter INTEGER NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_enabled INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion36 adds the wallet_min_confirmations table.
+func migrateVersion36(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_min_confirmations (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	min_confirmations INTEGER NOT NULL
+);`)
+	return err
+}
+
+func migrateVersion37(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE transfers (
+	id INTEGER PRIMARY KEY,
+	from_wallet_id INTEGER NOT NULL, /* not foreign keys so transfers are kept when a wallet is deleted */
+	to_wallet_id INTEGER NOT NULL,
+	value BLOB NOT NULL,
+	method TEXT NOT NULL,
+	status TEXT NOT NULL,
+	memo TEXT NOT NULL,
+	basis_height INTEGER NOT NULL,
+	basis_id BLOB NOT NULL,
+	txn BLOB,
+	fee BLOB NOT NULL,
+	date_created INTEGER NOT NULL
+);
+
+CREATE TABLE transfer_entries (
+	id INTEGER PRIMARY KEY,
+	transfer_id INTEGER NOT NULL REFERENCES transfers (id),
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	counterparty_id INTEGER NOT NULL,
+	entry_type TEXT NOT NULL,
+	value BLOB NOT NULL
+);
+CREATE INDEX transfer_entries_wallet_id_idx ON transfer_entries (wallet_id);
+CREATE INDEX transfer_entries_transfer_id_idx ON transfer_entries (transfer_id);`)
+	return err
+}
+
+func migrateVersion38(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_digests (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	frequency TEXT NOT NULL,
+	last_period INTEGER NOT NULL
+);`)
+	return err
+}
+
+func migrateVersion39(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_balance_alarms (
+	id INTEGER PRIMARY KEY,
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	address_id INTEGER REFERENCES sia_addresses (id), /* NULL if the alarm watches the wallet's balance */
+	low_balance BLOB,
+	high_balance BLOB,
+	state TEXT NOT NULL,
+	date_created INTEGER NOT NULL,
+	date_triggered INTEGER NOT NULL
+);
+CREATE INDEX wallet_balance_alarms_wallet_id_idx ON wallet_balance_alarms (wallet_id);`)
+	return err
+}
+
+func migrateVersion40(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE events ADD COLUMN summarized BOOLEAN NOT NULL DEFAULT false;`)
+	return err
+}
+
+// migrateVersion41 adds the event_enrichments table.
+func migrateVersion41(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE event_enrichments (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	field TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (event_id, field)
+);`)
+	return err
+}
+
+// migrateVersion42 adds the deferred_index_event_id column used by catch-up
+// mode.
+func migrateVersion42(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE global_settings ADD COLUMN deferred_index_event_id INTEGER;`)
+	return err
+}
+
+// migrateVersion43 stores treasury policies in columns instead of JSON
+// blobs.
+func migrateVersion43(tx *txn, _ *zap.Logger) error {
+	rows, err := tx.Query(`SELECT wallet_id, policy FROM wallet_policies`)
+	if err != nil {
+		return fmt.Errorf("failed to query policies: %w", err)
+	}
+	policies := make(map[wallet.ID]treasury.Policy)
+	for rows.Next() {
+		var id wallet.ID
+		var buf []byte
+		var policy treasury.Policy
+		if err := rows.Scan(&id, &buf); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan policy: %w", err)
+		} else if err := json.Unmarshal(buf, &policy); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to decode policy of wallet %v: %w", id, err)
+		}
+		policies[id] = policy
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP TABLE wallet_policies;
+CREATE TABLE wallet_policies (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	approval_threshold BLOB NOT NULL,
+	daily_limit BLOB NOT NULL,
+	weekly_limit BLOB NOT NULL,
+	restrict_destinations BOOLEAN NOT NULL,
+	allowlist_delay INTEGER NOT NULL
+);`)
+	if err != nil {
+		return fmt.Errorf("failed to recreate wallet_policies: %w", err)
+	}
+	for id, policy := range policies {
+		if err := insertPolicy(tx, id, policy); err != nil {
+			return fmt.Errorf("failed to migrate policy of wallet %v: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// migrateVersion44 adds the wallet_limit_overrides table.
+func migrateVersion44(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE wallet_limit_overrides (
+	wallet_id INTEGER PRIMARY KEY REFERENCES wallets (id) ON DELETE CASCADE,
+	expiration INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion45 adds the event_counterparties table.
+func migrateVersion45(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE event_counterparties (
+	wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	address BLOB NOT NULL,
+	role TEXT NOT NULL,
+	value BLOB NOT NULL,
+	label TEXT NOT NULL,
+	category TEXT NOT NULL,
+	counterparty_wallet_id INTEGER NOT NULL,
+	PRIMARY KEY (wallet_id, event_id, position)
+);
+CREATE INDEX event_counterparties_event_id_idx ON event_counterparties (event_id);`)
+	return err
+}
+
+// migrateVersion46 adds the v2 transaction and basis of payment batches.
+func migrateVersion46(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`ALTER TABLE payment_batches ADD COLUMN v2_txn BLOB;
+ALTER TABLE payment_batches ADD COLUMN basis BLOB;`)
+	return err
+}
+
+// migrateVersion47 adds the signed_transactions table.
+func migrateVersion47(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE signed_transactions (
+	transaction_id BLOB PRIMARY KEY,
+	date_created INTEGER NOT NULL
+);`)
+	return err
+}
+
+// migrateVersion48 adds the unresolved_events table. Existing events are
+// treated as resolved.
+func migrateVersion48(tx *txn, _ *zap.Logger) error {
+	_, err := tx.Exec(`CREATE TABLE unresolved_events (
+	event_id INTEGER PRIMARY KEY REFERENCES events (id) ON DELETE CASCADE
+);`)
+	return err
+}
+
 var migrations = []func(tx *txn, log *zap.Logger) error{
 	migrateVersion2,
 	migrateVersion3,
 	migrateVersion4,
 	migrateVersion5,
+	migrateVersion6,
+	migrateVersion7,
+	migrateVersion8,
+	migrateVersion9,
+	migrateVersion10,
+	migrateVersion11,
+	migrateVersion12,
+	migrateVersion13,
+	migrateVersion14,
+	migrateVersion15,
+	migrateVersion16,
+	migrateVersion17,
+	migrateVersion18,
+	migrateVersion19,
+	migrateVersion20,
+	migrateVersion21,
+	migrateVersion22,
+	migrateVersion23,
+	migrateVersion24,
+	migrateVersion25,
+	migrateVersion26,
+	migrateVersion27,
+	migrateVersion28,
+	migrateVersion29,
+	migrateVersion30,
+	migrateVersion31,
+	migrateVersion32,
+	migrateVersion33,
+	migrateVersion34,
+	migrateVersion35,
+	migrateVersion36,
+	migrateVersion37,
+	migrateVersion38,
+	migrateVersion39,
+	migrateVersion40,
+	migrateVersion41,
+	migrateVersion42,
+	migrateVersion43,
+	migrateVersion44,
+	migrateVersion45,
+	migrateVersion46,
+	migrateVersion47,
+	migrateVersion48,
 }
@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// An Option configures a Store.
+type Option func(*Store)
+
+// WithSlowQueryThreshold sets the duration after which a query is logged as
+// slow and counted in SlowQueries. A threshold of zero disables slow query
+// logging. The default is 500ms.
+func WithSlowQueryThreshold(d time.Duration) Option {
+	return func(s *Store) {
+		s.queries.threshold = d
+	}
+}
+
+// WithEventRetention sets how much of the transaction of each new event is
+// stored. Events that were already indexed are not changed. The default is
+// wallet.EventRetentionFull.
+func WithEventRetention(r wallet.EventRetention) Option {
+	return func(s *Store) {
+		s.eventRetention = r
+	}
+}
+
+// WithEventEnrichers sets the enrichers run on each new event before it is
+// stored. Events that were already indexed are not enriched.
+func WithEventEnrichers(enrichers []wallet.NamedEnricher) Option {
+	return func(s *Store) {
+		s.enrichers = enrichers
+	}
+}
+
+// WithReadConnections sets the maximum number of concurrent read
+// transactions. Writes always use a single connection. The default is the
+// number of CPUs, with a minimum of 4.
+func WithReadConnections(n int) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.readConns = n
+		}
+	}
+}
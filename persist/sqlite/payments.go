@@ -0,0 +1,179 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/payments"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const paymentColumns = `id, wallet_id, address, value, batch_id, date_queued`
+
+func scanPayment(s scanner) (p payments.Payment, err error) {
+	var batchID sql.NullInt64
+	if err := s.Scan(&p.ID, &p.WalletID, decode(&p.Address), decode(&p.Value), &batchID, decode(&p.DateQueued)); err != nil {
+		return payments.Payment{}, err
+	}
+	p.BatchID = batchID.Int64
+	return p, nil
+}
+
+func queryPayments(tx *txn, query string, args ...any) (queued []payments.Payment, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment: %w", err)
+		}
+		queued = append(queued, p)
+	}
+	return queued, rows.Err()
+}
+
+// AddPayment adds a payment to a wallet's queue.
+func (s *Store) AddPayment(p payments.Payment) (payments.Payment, error) {
+	err := s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, p.WalletID); err != nil {
+			return err
+		}
+		const query = `INSERT INTO payments (wallet_id, address, value, date_queued) VALUES ($1, $2, $3, $4) RETURNING id`
+		return tx.QueryRow(query, p.WalletID, encode(p.Address), encode(p.Value), encode(p.DateQueued)).Scan(&p.ID)
+	})
+	return p, err
+}
+
+// RemovePayment removes a queued payment. Batched payments cannot be
+// removed.
+func (s *Store) RemovePayment(walletID wallet.ID, id int64) error {
+	return s.transaction(func(tx *txn) error {
+		var dummyID int64
+		err := tx.QueryRow(`DELETE FROM payments WHERE id=$1 AND wallet_id=$2 AND batch_id IS NULL RETURNING id`, id, walletID).Scan(&dummyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return payments.ErrNotFound
+		}
+		return err
+	})
+}
+
+// QueuedPayments returns a wallet's queued payments, oldest first.
+func (s *Store) QueuedPayments(walletID wallet.ID) (queued []payments.Payment, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		queued, err = queryPayments(tx, `SELECT `+paymentColumns+` FROM payments WHERE wallet_id=$1 AND batch_id IS NULL ORDER BY id ASC`, walletID)
+		return err
+	})
+	return
+}
+
+// PaymentQueues returns a summary of every wallet with queued payments.
+func (s *Store) PaymentQueues() (queues []payments.Queue, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT wallet_id, COUNT(*), MIN(date_queued) FROM payments WHERE batch_id IS NULL GROUP BY wallet_id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var q payments.Queue
+			if err := rows.Scan(&q.WalletID, &q.Payments, decode(&q.Oldest)); err != nil {
+				return fmt.Errorf("failed to scan queue: %w", err)
+			}
+			queues = append(queues, q)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// AddPaymentBatch adds a batch and marks its payments as batched.
+func (s *Store) AddPaymentBatch(b payments.Batch) (payments.Batch, error) {
+	var v2TxnBuf, basisBuf any
+	if b.V2Transaction != nil {
+		v2TxnBuf = encode(*b.V2Transaction)
+		basisBuf = encode(b.Basis)
+	}
+	err := s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO payment_batches (wallet_id, txn, v2_txn, basis, to_sign, fee, date_created) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		if err := tx.QueryRow(query, b.WalletID, encode(b.Transaction), v2TxnBuf, basisBuf, encode(b.ToSign), encode(b.Fee), encode(b.DateCreated)).Scan(&b.ID); err != nil {
+			return fmt.Errorf("failed to insert batch: %w", err)
+		}
+
+		stmt, err := tx.Prepare(`UPDATE payments SET batch_id=$1 WHERE id=$2 AND wallet_id=$3 AND batch_id IS NULL RETURNING id`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for i := range b.Payments {
+			var dummyID int64
+			err := stmt.QueryRow(b.ID, b.Payments[i].ID, b.WalletID).Scan(&dummyID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("payment %d: %w", b.Payments[i].ID, payments.ErrNotFound)
+			} else if err != nil {
+				return fmt.Errorf("failed to update payment %d: %w", b.Payments[i].ID, err)
+			}
+			b.Payments[i].BatchID = b.ID
+		}
+		return nil
+	})
+	return b, err
+}
+
+// PaymentBatches returns a wallet's batches, newest first.
+func (s *Store) PaymentBatches(walletID wallet.ID, offset, limit int) (batches []payments.Batch, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT id, wallet_id, txn, v2_txn, basis, to_sign, fee, date_created FROM payment_batches WHERE wallet_id=$1 ORDER BY id DESC LIMIT $2 OFFSET $3`, walletID, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var b payments.Batch
+			var v2TxnBuf, basisBuf []byte
+			if err := rows.Scan(&b.ID, &b.WalletID, decode(&b.Transaction), &v2TxnBuf, &basisBuf, decode(&b.ToSign), decode(&b.Fee), decode(&b.DateCreated)); err != nil {
+				return fmt.Errorf("failed to scan batch: %w", err)
+			} else if v2TxnBuf != nil {
+				b.V2Transaction = new(types.V2Transaction)
+				dec := types.NewBufDecoder(v2TxnBuf)
+				b.V2Transaction.DecodeFrom(dec)
+				if err := dec.Err(); err != nil {
+					return fmt.Errorf("failed to decode transaction: %w", err)
+				}
+				dec = types.NewBufDecoder(basisBuf)
+				b.Basis.DecodeFrom(dec)
+				if err := dec.Err(); err != nil {
+					return fmt.Errorf("failed to decode basis: %w", err)
+				}
+			}
+			batches = append(batches, b)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range batches {
+			batches[i].Payments, err = queryPayments(tx, `SELECT `+paymentColumns+` FROM payments WHERE batch_id=$1 ORDER BY id ASC`, batches[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to get payments of batch %d: %w", batches[i].ID, err)
+			}
+		}
+		return nil
+	})
+	return
+}
@@ -110,7 +110,7 @@ func (s *Store) AddPeer(peer string) error {
 
 // Peers returns the addresses of all known peers.
 func (s *Store) Peers() (peers []syncer.PeerInfo, _ error) {
-	err := s.transaction(func(tx *txn) error {
+	err := s.readTransaction(func(tx *txn) error {
 		const query = `SELECT peer_address, first_seen FROM syncer_peers`
 		rows, err := tx.Query(query)
 		if err != nil {
@@ -206,7 +206,7 @@ func (s *Store) Banned(peer string) (banned bool, _ error) {
 		checkSubnets = append(checkSubnets, subnet.String())
 	}
 
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		checkSubnetStmt, err := tx.Prepare(`SELECT expiration FROM syncer_bans WHERE net_cidr = $1 ORDER BY expiration DESC LIMIT 1`)
 		if err != nil {
 			return fmt.Errorf("failed to prepare statement: %w", err)
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Connection pools, as reported by PoolQueueDepth and PoolInUse. The
+// scheduled pool is the subset of read connections used by expensive reads,
+// which are admitted by the fair scheduler.
+const (
+	poolRead      = "read"
+	poolWrite     = "write"
+	poolScheduled = "scheduled"
+)
+
+// defaultReadConnections is the default size of the read pool.
+var defaultReadConnections = max(4, runtime.NumCPU())
+
+// A connPool is a database handle that tracks the number of transactions
+// waiting for a connection.
+type connPool struct {
+	db      *sql.DB
+	waiting atomic.Int64
+}
+
+// begin starts a transaction, blocking until a connection is available or
+// ctx is canceled. If ctx is canceled, the transaction is rolled back.
+func (p *connPool) begin(ctx context.Context) (*sql.Tx, error) {
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+	return p.db.BeginTx(ctx, nil)
+}
+
+// isBusyError returns true if err was caused by another connection holding a
+// conflicting lock on the database.
+func isBusyError(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && (se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked)
+}
+
+// writerFilepath returns the DSN of the write connection. Transactions begin
+// with BEGIN IMMEDIATE so the write lock is acquired, and waited for, up
+// front instead of failing when a read transaction is upgraded.
+func writerFilepath(fp string) string {
+	return sqliteFilepath(fp) + "&_txlock=immediate"
+}
+
+// readerFilepath returns the DSN of the read connections. The journal mode is
+// persistent and set by the write connection.
+func readerFilepath(fp string) string {
+	params := []string{
+		fmt.Sprintf("_busy_timeout=%d", busyTimeout),
+		"_query_only=true",
+		"_cache_size=-65536", // 64MiB
+	}
+	return "file:" + fp + "?" + strings.Join(params, "&")
+}
+
+// openPools opens the store's database handles: a single write connection and
+// a pool of n read-only connections. SQLite allows one writer at a time, so
+// serializing writes in the pool avoids lock contention between them, while
+// WAL mode lets readers proceed concurrently with the writer.
+func openPools(fp string, n int) (writer, reader *connPool, err error) {
+	wdb, err := sql.Open("sqlite3", writerFilepath(fp))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open write connection: %w", err)
+	}
+	wdb.SetMaxOpenConns(1)
+	wdb.SetMaxIdleConns(1)
+	wdb.SetConnMaxLifetime(0)
+	wdb.SetConnMaxIdleTime(0)
+
+	rdb, err := sql.Open("sqlite3", readerFilepath(fp))
+	if err != nil {
+		wdb.Close()
+		return nil, nil, fmt.Errorf("failed to open read connections: %w", err)
+	}
+	rdb.SetMaxOpenConns(n)
+	rdb.SetMaxIdleConns(n)
+	return &connPool{db: wdb}, &connPool{db: rdb}, nil
+}
+
+// PoolQueueDepth returns the number of transactions waiting for a database
+// connection, keyed by pool: read or write.
+func (s *Store) PoolQueueDepth() map[string]int {
+	waiting, _ := s.scheduler.load()
+	return map[string]int{
+		poolRead:      int(s.reader.waiting.Load()),
+		poolWrite:     int(s.writer.waiting.Load()),
+		poolScheduled: waiting,
+	}
+}
+
+// PoolInUse returns the number of database connections in use, keyed by
+// pool: read or write.
+func (s *Store) PoolInUse() map[string]int {
+	_, running := s.scheduler.load()
+	return map[string]int{
+		poolRead:      s.reader.db.Stats().InUse,
+		poolWrite:     s.writer.db.Stats().InUse,
+		poolScheduled: running,
+	}
+}
+
+// BusyRetries returns the number of transactions that were retried because
+// the database was locked by another connection.
+func (s *Store) BusyRetries() uint64 {
+	return s.busyRetries.Load()
+}
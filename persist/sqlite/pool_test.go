@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+func TestConcurrentReadWrite(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log, WithReadConnections(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		writers = 4
+		readers = 16
+		writes  = 25
+	)
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, writers+readers)
+	done := make(chan struct{})
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				addr := wallet.Address{Address: types.Address(frand.Entropy256())}
+				if _, err := db.AddWalletAddress(w.ID, addr); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+	var readWG sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		readWG.Add(1)
+		go func() {
+			defer readWG.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := db.WalletAddresses(w.ID); err != nil {
+					errCh <- err
+					return
+				} else if _, err := db.WalletBalance(w.ID); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readWG.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatal(err)
+	}
+
+	addrs, err := db.WalletAddresses(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != writers*writes {
+		t.Fatalf("expected %d addresses, got %d", writers*writes, len(addrs))
+	} else if n := db.BusyRetries(); n != 0 {
+		t.Fatalf("expected no busy retries, got %d", n)
+	}
+
+	for pool, n := range db.PoolQueueDepth() {
+		if n != 0 {
+			t.Fatalf("expected empty %s queue, got %d", pool, n)
+		}
+	}
+}
+
+func TestReadTransactionIsReadOnly(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.readTransaction(func(tx *txn) error {
+		_, err := tx.Exec(`UPDATE global_settings SET last_indexed_height=1`)
+		return err
+	})
+	if err == nil {
+		t.Fatal("expected write in read transaction to fail")
+	}
+}
+
+func TestReadTransactionCanceled(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a running query is interrupted when the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = db.readTransactionContext(ctx, func(tx *txn) error {
+		var n int64
+		return tx.QueryRow(`WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT COUNT(*) FROM c`).Scan(&n)
+	})
+	if err == nil {
+		t.Fatal("expected query to be interrupted")
+	}
+
+	// reads with a canceled context fail without running
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.WalletEvents(ctx, w.ID, 0, 100); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	} else if _, err := db.WalletEvents(context.Background(), w.ID, 0, 100); err != nil {
+		t.Fatal(err)
+	}
+}
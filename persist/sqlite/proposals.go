@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const proposalColumns = `id, wallet_id, status, basis_height, basis_id, txn, inputs, sig_hash, fee, date_created, date_updated`
+
+func scanProposal(s scanner) (p wallet.WithdrawalProposal, err error) {
+	var inputs []byte
+	if err := s.Scan(&p.ID, &p.WalletID, &p.Status, &p.Basis.Height, decode(&p.Basis.ID), decode(&p.Transaction), &inputs, decode(&p.SigHash), decode(&p.Fee), decode(&p.DateCreated), decode(&p.DateUpdated)); err != nil {
+		return wallet.WithdrawalProposal{}, err
+	} else if err := json.Unmarshal(inputs, &p.Inputs); err != nil {
+		return wallet.WithdrawalProposal{}, fmt.Errorf("failed to decode inputs: %w", err)
+	}
+	return p, nil
+}
+
+func getProposal(tx *txn, walletID wallet.ID, id int64) (wallet.WithdrawalProposal, error) {
+	p, err := scanProposal(tx.QueryRow(`SELECT `+proposalColumns+` FROM withdrawal_proposals WHERE id=$1 AND wallet_id=$2`, id, walletID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return wallet.WithdrawalProposal{}, wallet.ErrProposalNotFound
+	}
+	return p, err
+}
+
+// AddWithdrawalProposal adds a withdrawal proposal to a wallet.
+func (s *Store) AddWithdrawalProposal(p wallet.WithdrawalProposal) (wallet.WithdrawalProposal, error) {
+	inputs, err := json.Marshal(p.Inputs)
+	if err != nil {
+		return wallet.WithdrawalProposal{}, fmt.Errorf("failed to encode inputs: %w", err)
+	}
+	err = s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, p.WalletID); err != nil {
+			return err
+		}
+		const query = `INSERT INTO withdrawal_proposals (wallet_id, status, basis_height, basis_id, txn, inputs, sig_hash, fee, date_created, date_updated) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+		return tx.QueryRow(query, p.WalletID, p.Status, p.Basis.Height, encode(p.Basis.ID), encode(p.Transaction), inputs, encode(p.SigHash), encode(p.Fee), encode(p.DateCreated), encode(p.DateUpdated)).Scan(&p.ID)
+	})
+	return p, err
+}
+
+// WithdrawalProposal returns a withdrawal proposal of a wallet.
+func (s *Store) WithdrawalProposal(walletID wallet.ID, id int64) (p wallet.WithdrawalProposal, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		p, err = getProposal(tx, walletID, id)
+		return err
+	})
+	return
+}
+
+// WithdrawalProposals returns the withdrawal proposals of a wallet, newest
+// first.
+func (s *Store) WithdrawalProposals(walletID wallet.ID, offset, limit int) (proposals []wallet.WithdrawalProposal, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		rows, err := tx.Query(`SELECT `+proposalColumns+` FROM withdrawal_proposals WHERE wallet_id=$1 ORDER BY id DESC LIMIT $2 OFFSET $3`, walletID, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			p, err := scanProposal(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan proposal: %w", err)
+			}
+			proposals = append(proposals, p)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// UpdateWithdrawalProposal changes the status of a pending withdrawal
+// proposal. If signed is not nil, it replaces the proposal's transaction.
+func (s *Store) UpdateWithdrawalProposal(walletID wallet.ID, id int64, status string, signed *types.V2Transaction) (p wallet.WithdrawalProposal, err error) {
+	err = s.transaction(func(tx *txn) error {
+		p, err = getProposal(tx, walletID, id)
+		if err != nil {
+			return err
+		} else if p.Status != wallet.ProposalStatusPending {
+			return wallet.ErrProposalNotPending
+		}
+
+		p.Status = status
+		p.DateUpdated = time.Now().Truncate(time.Second)
+		if signed != nil {
+			p.Transaction = *signed
+		}
+		_, err = tx.Exec(`UPDATE withdrawal_proposals SET status=$1, txn=$2, date_updated=$3 WHERE id=$4`, p.Status, encode(p.Transaction), encode(p.DateUpdated), p.ID)
+		return err
+	})
+	return
+}
+
+// PendingProposalInputs returns the IDs of the outputs spent by a wallet's
+// pending withdrawal proposals.
+func (s *Store) PendingProposalInputs(walletID wallet.ID) (ids []types.SiacoinOutputID, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT inputs FROM withdrawal_proposals WHERE wallet_id=$1 AND status=$2`, walletID, wallet.ProposalStatusPending)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var buf []byte
+			var inputs []wallet.ProposalInput
+			if err := rows.Scan(&buf); err != nil {
+				return fmt.Errorf("failed to scan inputs: %w", err)
+			} else if err := json.Unmarshal(buf, &inputs); err != nil {
+				return fmt.Errorf("failed to decode inputs: %w", err)
+			}
+			for _, in := range inputs {
+				ids = append(ids, in.ParentID)
+			}
+		}
+		return rows.Err()
+	})
+	return
+}
@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestWithdrawalProposals(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "test.db"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "cold", Type: wallet.WalletTypeCold})
+	if err != nil {
+		t.Fatal(err)
+	} else if w.Type != wallet.WalletTypeCold {
+		t.Fatalf("expected wallet type %q, got %q", wallet.WalletTypeCold, w.Type)
+	} else if walletType, err := db.WalletType(w.ID); err != nil {
+		t.Fatal(err)
+	} else if walletType != wallet.WalletTypeCold {
+		t.Fatalf("expected wallet type %q, got %q", wallet.WalletTypeCold, walletType)
+	}
+
+	// updating the wallet should not change its type
+	w.Name = "renamed"
+	if w, err := db.UpdateWallet(w); err != nil {
+		t.Fatal(err)
+	} else if w.Type != wallet.WalletTypeCold {
+		t.Fatalf("expected wallet type %q, got %q", wallet.WalletTypeCold, w.Type)
+	}
+
+	pk := types.GeneratePrivateKey().PublicKey()
+	policy := types.SpendPolicy{Type: types.PolicyTypeUnlockConditions(types.StandardUnlockConditions(pk))}
+	addr := wallet.Address{
+		Address:        policy.Address(),
+		SpendPolicy:    &policy,
+		DerivationPath: "m/44'/1991'/0'/0/3",
+	}
+	if _, err := db.AddWalletAddress(w.ID, addr); err != nil {
+		t.Fatal(err)
+	} else if addrs, err := db.WalletAddresses(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 1 {
+		t.Fatalf("expected 1 address, got %d", len(addrs))
+	} else if addrs[0].DerivationPath != addr.DerivationPath {
+		t.Fatalf("expected derivation path %q, got %q", addr.DerivationPath, addrs[0].DerivationPath)
+	}
+
+	input := wallet.ProposalInput{
+		ParentID:       types.SiacoinOutputID{1},
+		Address:        addr.Address,
+		Value:          types.Siacoins(10),
+		SpendPolicy:    addr.SpendPolicy,
+		DerivationPath: addr.DerivationPath,
+	}
+	now := time.Now().Truncate(time.Second)
+	p, err := db.AddWithdrawalProposal(wallet.WithdrawalProposal{
+		WalletID: w.ID,
+		Status:   wallet.ProposalStatusPending,
+		Basis:    types.ChainIndex{Height: 10, ID: types.BlockID{2}},
+		Transaction: types.V2Transaction{
+			SiacoinOutputs: []types.SiacoinOutput{{Address: types.VoidAddress, Value: types.Siacoins(9)}},
+			MinerFee:       types.Siacoins(1),
+		},
+		Inputs:      []wallet.ProposalInput{input},
+		SigHash:     types.Hash256{3},
+		Fee:         types.Siacoins(1),
+		DateCreated: now,
+		DateUpdated: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.WithdrawalProposal(w.ID, p.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if got.Status != wallet.ProposalStatusPending || got.Basis != p.Basis || got.SigHash != p.SigHash || !got.Fee.Equals(p.Fee) {
+		t.Fatalf("expected proposal %+v, got %+v", p, got)
+	} else if len(got.Inputs) != 1 || got.Inputs[0].ParentID != input.ParentID || got.Inputs[0].DerivationPath != input.DerivationPath {
+		t.Fatalf("expected inputs %+v, got %+v", p.Inputs, got.Inputs)
+	} else if _, err := db.WithdrawalProposal(w.ID+1, p.ID); !errors.Is(err, wallet.ErrProposalNotFound) {
+		t.Fatalf("expected ErrProposalNotFound, got %v", err)
+	}
+
+	if ids, err := db.PendingProposalInputs(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 1 || ids[0] != input.ParentID {
+		t.Fatalf("expected pending input %v, got %v", input.ParentID, ids)
+	}
+
+	// cancelling the proposal releases its inputs
+	if p, err := db.UpdateWithdrawalProposal(w.ID, p.ID, wallet.ProposalStatusCancelled, nil); err != nil {
+		t.Fatal(err)
+	} else if p.Status != wallet.ProposalStatusCancelled {
+		t.Fatalf("expected status %q, got %q", wallet.ProposalStatusCancelled, p.Status)
+	} else if ids, err := db.PendingProposalInputs(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(ids) != 0 {
+		t.Fatalf("expected no pending inputs, got %v", ids)
+	} else if _, err := db.UpdateWithdrawalProposal(w.ID, p.ID, wallet.ProposalStatusBroadcast, nil); !errors.Is(err, wallet.ErrProposalNotPending) {
+		t.Fatalf("expected ErrProposalNotPending, got %v", err)
+	}
+
+	if proposals, err := db.WithdrawalProposals(w.ID, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(proposals) != 1 {
+		t.Fatalf("expected 1 proposal, got %d", len(proposals))
+	}
+
+	// deleting the wallet removes its proposals
+	if err := db.DeleteWallet(w.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.WithdrawalProposal(w.ID, p.ID); !errors.Is(err, wallet.ErrProposalNotFound) {
+		t.Fatalf("expected ErrProposalNotFound, got %v", err)
+	}
+}
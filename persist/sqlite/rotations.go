@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const rotationColumns = `id, wallet_id, status, old_addresses, new_addresses, max_fee_rate, max_inputs, sweeps, swept, fees, date_created, last_sweep, date_completed`
+
+func scanRotation(s scanner) (r rotation.Rotation, err error) {
+	var oldAddrs, newAddrs []byte
+	if err := s.Scan(&r.ID, &r.WalletID, &r.Status, &oldAddrs, &newAddrs, decode(&r.MaxFeeRate), &r.MaxInputs, &r.Sweeps, decode(&r.Swept), decode(&r.Fees), decode(&r.DateCreated), decode(&r.LastSweep), decode(&r.DateCompleted)); err != nil {
+		return rotation.Rotation{}, err
+	} else if err := json.Unmarshal(oldAddrs, &r.OldAddresses); err != nil {
+		return rotation.Rotation{}, fmt.Errorf("failed to decode old addresses: %w", err)
+	} else if err := json.Unmarshal(newAddrs, &r.NewAddresses); err != nil {
+		return rotation.Rotation{}, fmt.Errorf("failed to decode new addresses: %w", err)
+	}
+	return r, nil
+}
+
+func queryRotations(tx *txn, query string, args ...any) (rotations []rotation.Rotation, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r, err := scanRotation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan rotation: %w", err)
+		}
+		rotations = append(rotations, r)
+	}
+	return rotations, rows.Err()
+}
+
+// AddRotation adds a key rotation to a wallet.
+func (s *Store) AddRotation(r rotation.Rotation) (rotation.Rotation, error) {
+	oldAddrs, err := json.Marshal(r.OldAddresses)
+	if err != nil {
+		return rotation.Rotation{}, fmt.Errorf("failed to encode old addresses: %w", err)
+	}
+	newAddrs, err := json.Marshal(r.NewAddresses)
+	if err != nil {
+		return rotation.Rotation{}, fmt.Errorf("failed to encode new addresses: %w", err)
+	}
+	err = s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, r.WalletID); err != nil {
+			return err
+		}
+		const query = `INSERT INTO wallet_rotations (wallet_id, status, old_addresses, new_addresses, max_fee_rate, max_inputs, sweeps, swept, fees, date_created, last_sweep, date_completed) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+		return tx.QueryRow(query, r.WalletID, r.Status, oldAddrs, newAddrs, encode(r.MaxFeeRate), r.MaxInputs, r.Sweeps, encode(r.Swept), encode(r.Fees), encode(r.DateCreated), encode(r.LastSweep), encode(r.DateCompleted)).Scan(&r.ID)
+	})
+	return r, err
+}
+
+// UpdateRotation updates the status and progress of a key rotation.
+func (s *Store) UpdateRotation(r rotation.Rotation) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE wallet_rotations SET status=$1, sweeps=$2, swept=$3, fees=$4, last_sweep=$5, date_completed=$6 WHERE id=$7 AND wallet_id=$8`, r.Status, r.Sweeps, encode(r.Swept), encode(r.Fees), encode(r.LastSweep), encode(r.DateCompleted), r.ID, r.WalletID)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return rotation.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// WalletRotations returns the key rotations of a wallet, newest first.
+func (s *Store) WalletRotations(walletID wallet.ID) (rotations []rotation.Rotation, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		rotations, err = queryRotations(tx, `SELECT `+rotationColumns+` FROM wallet_rotations WHERE wallet_id=$1 ORDER BY id DESC`, walletID)
+		return err
+	})
+	return
+}
+
+// WalletRotation returns a key rotation of a wallet.
+func (s *Store) WalletRotation(walletID wallet.ID, id int64) (r rotation.Rotation, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		r, err = scanRotation(tx.QueryRow(`SELECT `+rotationColumns+` FROM wallet_rotations WHERE id=$1 AND wallet_id=$2`, id, walletID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return rotation.ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// ActiveRotations returns every active key rotation.
+func (s *Store) ActiveRotations() (rotations []rotation.Rotation, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rotations, err = queryRotations(tx, `SELECT `+rotationColumns+` FROM wallet_rotations WHERE status=$1 ORDER BY id ASC`, rotation.StatusActive)
+		return err
+	})
+	return
+}
+
+// AddRotationSweep adds a sweep to a key rotation.
+func (s *Store) AddRotationSweep(sweep rotation.Sweep) (rotation.Sweep, error) {
+	err := s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO rotation_sweeps (rotation_id, status, basis_height, basis_id, txn, value, fee, date_created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		return tx.QueryRow(query, sweep.RotationID, sweep.Status, sweep.Basis.Height, encode(sweep.Basis.ID), encode(sweep.Transaction), encode(sweep.Value), encode(sweep.Fee), encode(sweep.DateCreated)).Scan(&sweep.ID)
+	})
+	return sweep, err
+}
+
+// RotationSweeps returns the sweeps of a key rotation, newest first.
+func (s *Store) RotationSweeps(rotationID int64) (sweeps []rotation.Sweep, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT s.id, s.rotation_id, r.wallet_id, s.status, s.basis_height, s.basis_id, s.txn, s.value, s.fee, s.date_created
+FROM rotation_sweeps s
+INNER JOIN wallet_rotations r ON r.id=s.rotation_id
+WHERE s.rotation_id=$1
+ORDER BY s.id DESC`
+		rows, err := tx.Query(query, rotationID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var sweep rotation.Sweep
+			if err := rows.Scan(&sweep.ID, &sweep.RotationID, &sweep.WalletID, &sweep.Status, &sweep.Basis.Height, decode(&sweep.Basis.ID), decode(&sweep.Transaction), decode(&sweep.Value), decode(&sweep.Fee), decode(&sweep.DateCreated)); err != nil {
+				return fmt.Errorf("failed to scan sweep: %w", err)
+			}
+			sweeps = append(sweeps, sweep)
+		}
+		return rows.Err()
+	})
+	return
+}
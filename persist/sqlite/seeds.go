@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.thebigfile.com/walletd/keystore"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// WalletSeed returns the encrypted seed of a wallet.
+func (s *Store) WalletSeed(id wallet.ID) (es keystore.EncryptedSeed, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		var salt, nonce []byte
+		var verified sql.NullInt64
+		err := tx.QueryRow(`SELECT salt, nonce, ciphertext, word_commitments, backup_verified, date_created FROM wallet_seeds WHERE wallet_id=$1`, id).Scan(&salt, &nonce, &es.Ciphertext, decode(&es.WordCommitments), &verified, decode(&es.DateCreated))
+		if errors.Is(err, sql.ErrNoRows) {
+			return keystore.ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		copy(es.Salt[:], salt)
+		copy(es.Nonce[:], nonce)
+		if verified.Valid {
+			es.BackupVerified = time.Unix(verified.Int64, 0).UTC()
+		}
+		return nil
+	})
+	return
+}
+
+// AddWalletSeed stores the encrypted seed of a wallet.
+func (s *Store) AddWalletSeed(id wallet.ID, es keystore.EncryptedSeed) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM wallet_seeds WHERE wallet_id=$1)`, id).Scan(&exists); err != nil {
+			return err
+		} else if exists {
+			return keystore.ErrExists
+		}
+		var verified sql.NullInt64
+		if !es.BackupVerified.IsZero() {
+			verified = sql.NullInt64{Int64: es.BackupVerified.Unix(), Valid: true}
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_seeds (wallet_id, salt, nonce, ciphertext, word_commitments, backup_verified, date_created) VALUES ($1, $2, $3, $4, $5, $6, $7)`, id, es.Salt[:], es.Nonce[:], es.Ciphertext, encode(es.WordCommitments), verified, encode(es.DateCreated))
+		return err
+	})
+}
+
+// RemoveWalletSeed removes the encrypted seed of a wallet.
+func (s *Store) RemoveWalletSeed(id wallet.ID) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM wallet_seeds WHERE wallet_id=$1`, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return keystore.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// SetWalletSeedBackupVerified records when the backup of a wallet's seed was
+// verified.
+func (s *Store) SetWalletSeedBackupVerified(id wallet.ID, verified time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`UPDATE wallet_seeds SET backup_verified=$1 WHERE wallet_id=$2`, encode(verified), id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return keystore.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// UnverifiedWalletSeeds returns the IDs of wallets with a stored seed whose
+// backup was never verified.
+func (s *Store) UnverifiedWalletSeeds() (ids []wallet.ID, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT wallet_id FROM wallet_seeds WHERE backup_verified IS NULL ORDER BY wallet_id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id wallet.ID
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		return rows.Err()
+	})
+	return
+}
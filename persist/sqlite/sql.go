@@ -3,7 +3,10 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // import sqlite3 driver
@@ -11,8 +14,18 @@ import (
 )
 
 const (
-	longQueryDuration = 10 * time.Millisecond
-	longTxnDuration   = time.Second // reduce syncing spam
+	// defaultSlowQueryThreshold is the default duration after which a query
+	// is logged as slow.
+	defaultSlowQueryThreshold = 500 * time.Millisecond
+	longTxnDuration           = time.Second // reduce syncing spam
+)
+
+// Query operations, as reported by SlowQueries.
+const (
+	opExec     = "exec"
+	opQuery    = "query"
+	opQueryRow = "query_row"
+	opPrepare  = "prepare"
 )
 
 type (
@@ -21,39 +34,134 @@ type (
 		Scan(dest ...any) error
 	}
 
-	// A stmt wraps a *sql.Stmt, logging slow queries.
+	// A queryMonitor logs and counts queries that take longer than its
+	// threshold.
+	queryMonitor struct {
+		threshold time.Duration // 0 disables monitoring
+
+		mu     sync.Mutex
+		counts map[string]uint64
+	}
+
+	// A stmt wraps a *sql.Stmt, logging slow queries. Its queries use the
+	// context of the transaction that prepared it.
 	stmt struct {
 		*sql.Stmt
 		query string
+		ctx   context.Context
 
+		qm  *queryMonitor
 		log *zap.Logger
 	}
 
-	// A txn wraps a *sql.Tx, logging slow queries.
+	// A txn wraps a *sql.Tx, logging slow queries. Its queries are
+	// interrupted when ctx is canceled.
 	txn struct {
 		*sql.Tx
+		ctx context.Context
+		qm  *queryMonitor
 		log *zap.Logger
 	}
 
-	// A row wraps a *sql.Row, logging slow queries.
+	// A row wraps a *sql.Row, logging slow queries. The time spent in Scan
+	// counts towards the query's duration.
 	row struct {
 		*sql.Row
+		query   string
+		args    []any
+		elapsed time.Duration
+
+		qm  *queryMonitor
 		log *zap.Logger
 	}
 
-	// rows wraps a *sql.Rows, logging slow queries.
+	// rows wraps a *sql.Rows, logging slow queries. The time spent in Next
+	// and Scan counts towards the query's duration, which is checked when
+	// the rows are closed.
 	rows struct {
 		*sql.Rows
+		query   string
+		args    []any
+		elapsed time.Duration
+		n       int64
+		closed  bool
 
+		qm  *queryMonitor
 		log *zap.Logger
 	}
 )
 
+// compactQuery collapses the whitespace of a query so it fits on one line.
+func compactQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// summarizeArgs describes a query's arguments without logging their
+// contents. Integers and booleans are included, since they are usually
+// limits, offsets, and heights; blobs and strings are replaced with their
+// length.
+func summarizeArgs(args []any) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			parts[i] = "null"
+		case int, int32, int64, uint32, uint64, bool:
+			parts[i] = fmt.Sprint(arg)
+		case []byte:
+			parts[i] = fmt.Sprintf("blob(%d)", len(arg))
+		case string:
+			parts[i] = fmt.Sprintf("text(%d)", len(arg))
+		default:
+			parts[i] = fmt.Sprintf("%T", arg)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// observe logs and counts a query if it took longer than the threshold.
+// rows is the number of rows returned or affected by the query, or -1 if
+// unknown.
+func (qm *queryMonitor) observe(log *zap.Logger, op, query string, args []any, rows int64, elapsed time.Duration) {
+	if qm == nil || qm.threshold <= 0 || elapsed < qm.threshold {
+		return
+	}
+	qm.mu.Lock()
+	qm.counts[op]++
+	qm.mu.Unlock()
+	log.Warn("slow query",
+		zap.String("op", op),
+		zap.String("query", compactQuery(query)),
+		zap.String("args", summarizeArgs(args)),
+		zap.Int64("rows", rows),
+		zap.Duration("elapsed", elapsed),
+		zap.Stack("stack"))
+}
+
+// slowQueries returns the number of slow queries by operation.
+func (qm *queryMonitor) slowQueries() map[string]uint64 {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	counts := make(map[string]uint64, len(qm.counts))
+	for op, n := range qm.counts {
+		counts[op] = n
+	}
+	return counts
+}
+
+func newQueryMonitor(threshold time.Duration) *queryMonitor {
+	return &queryMonitor{
+		threshold: threshold,
+		counts:    make(map[string]uint64),
+	}
+}
+
 func (r *rows) Next() bool {
 	start := time.Now()
 	next := r.Rows.Next()
-	if dur := time.Since(start); dur > longQueryDuration {
-		r.log.Debug("slow next", zap.Duration("elapsed", dur), zap.Stack("stack"))
+	r.elapsed += time.Since(start)
+	if next {
+		r.n++
 	}
 	return next
 }
@@ -61,8 +169,16 @@ func (r *rows) Next() bool {
 func (r *rows) Scan(dest ...any) error {
 	start := time.Now()
 	err := r.Rows.Scan(dest...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		r.log.Debug("slow scan", zap.Duration("elapsed", dur), zap.Stack("stack"))
+	r.elapsed += time.Since(start)
+	return err
+}
+
+// Close closes the rows and logs the query if it was slow.
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.qm.observe(r.log, opQuery, r.query, r.args, r.n, r.elapsed)
 	}
 	return err
 }
@@ -70,59 +186,69 @@ func (r *rows) Scan(dest ...any) error {
 func (r *row) Scan(dest ...any) error {
 	start := time.Now()
 	err := r.Row.Scan(dest...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		r.log.Debug("slow scan", zap.Duration("elapsed", dur), zap.Stack("stack"))
+	r.elapsed += time.Since(start)
+	var n int64
+	if err == nil {
+		n = 1
 	}
+	r.qm.observe(r.log, opQueryRow, r.query, r.args, n, r.elapsed)
 	return err
 }
 
+// rowsAffected returns the number of rows affected by an exec, or -1 if it
+// is unknown.
+func rowsAffected(result sql.Result, err error) int64 {
+	if err != nil {
+		return -1
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
 func (s *stmt) Exec(args ...any) (sql.Result, error) {
-	return s.ExecContext(context.Background(), args...)
+	return s.ExecContext(s.ctx, args...)
 }
 
 func (s *stmt) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
 	start := time.Now()
 	result, err := s.Stmt.ExecContext(ctx, args...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		s.log.Debug("slow exec", zap.String("query", s.query), zap.Duration("elapsed", dur), zap.Stack("stack"))
-	}
+	s.qm.observe(s.log, opExec, s.query, args, rowsAffected(result, err), time.Since(start))
 	return result, err
 }
 
-func (s *stmt) Query(args ...any) (*sql.Rows, error) {
-	return s.QueryContext(context.Background(), args...)
+func (s *stmt) Query(args ...any) (*rows, error) {
+	return s.QueryContext(s.ctx, args...)
 }
 
-func (s *stmt) QueryContext(ctx context.Context, args ...any) (*sql.Rows, error) {
+func (s *stmt) QueryContext(ctx context.Context, args ...any) (*rows, error) {
 	start := time.Now()
-	rows, err := s.Stmt.QueryContext(ctx, args...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		s.log.Debug("slow query", zap.String("query", s.query), zap.Duration("elapsed", dur), zap.Stack("stack"))
+	r, err := s.Stmt.QueryContext(ctx, args...)
+	if err != nil {
+		s.qm.observe(s.log, opQuery, s.query, args, -1, time.Since(start))
+		return nil, err
 	}
-	return rows, err
+	return &rows{Rows: r, query: s.query, args: args, elapsed: time.Since(start), qm: s.qm, log: s.log.Named("rows")}, nil
 }
 
 func (s *stmt) QueryRow(args ...any) *row {
-	return s.QueryRowContext(context.Background(), args...)
+	return s.QueryRowContext(s.ctx, args...)
 }
 
 func (s *stmt) QueryRowContext(ctx context.Context, args ...any) *row {
 	start := time.Now()
 	r := s.Stmt.QueryRowContext(ctx, args...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		s.log.Debug("slow query row", zap.String("query", s.query), zap.Duration("elapsed", dur), zap.Stack("stack"))
-	}
-	return &row{r, s.log.Named("row")}
+	return &row{Row: r, query: s.query, args: args, elapsed: time.Since(start), qm: s.qm, log: s.log.Named("row")}
 }
 
 // Exec executes a query without returning any rows. The args are for
 // any placeholder parameters in the query.
 func (tx *txn) Exec(query string, args ...any) (sql.Result, error) {
 	start := time.Now()
-	result, err := tx.Tx.Exec(query, args...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		tx.log.Debug("slow exec", zap.String("query", query), zap.Duration("elapsed", dur), zap.Stack("stack"))
-	}
+	result, err := tx.Tx.ExecContext(tx.ctx, query, args...)
+	tx.qm.observe(tx.log, opExec, query, args, rowsAffected(result, err), time.Since(start))
 	return result, err
 }
 
@@ -132,15 +258,16 @@ func (tx *txn) Exec(query string, args ...any) (sql.Result, error) {
 // when the statement is no longer needed.
 func (tx *txn) Prepare(query string) (*stmt, error) {
 	start := time.Now()
-	s, err := tx.Tx.Prepare(query)
-	if dur := time.Since(start); dur > longQueryDuration {
-		tx.log.Debug("slow prepare", zap.String("query", query), zap.Duration("elapsed", dur), zap.Stack("stack"))
-	} else if err != nil {
+	s, err := tx.Tx.PrepareContext(tx.ctx, query)
+	tx.qm.observe(tx.log, opPrepare, query, nil, -1, time.Since(start))
+	if err != nil {
 		return nil, err
 	}
 	return &stmt{
 		Stmt:  s,
 		query: query,
+		ctx:   tx.ctx,
+		qm:    tx.qm,
 		log:   tx.log.Named("statement"),
 	}, nil
 }
@@ -149,11 +276,12 @@ func (tx *txn) Prepare(query string) (*stmt, error) {
 // args are for any placeholder parameters in the query.
 func (tx *txn) Query(query string, args ...any) (*rows, error) {
 	start := time.Now()
-	r, err := tx.Tx.Query(query, args...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		tx.log.Debug("slow query", zap.String("query", query), zap.Duration("elapsed", dur), zap.Stack("stack"))
+	r, err := tx.Tx.QueryContext(tx.ctx, query, args...)
+	if err != nil {
+		tx.qm.observe(tx.log, opQuery, query, args, -1, time.Since(start))
+		return nil, err
 	}
-	return &rows{r, tx.log.Named("rows")}, err
+	return &rows{Rows: r, query: query, args: args, elapsed: time.Since(start), qm: tx.qm, log: tx.log.Named("rows")}, nil
 }
 
 // QueryRow executes a query that is expected to return at most one row.
@@ -163,11 +291,8 @@ func (tx *txn) Query(query string, args ...any) (*rows, error) {
 // first selected row and discards the rest.
 func (tx *txn) QueryRow(query string, args ...any) *row {
 	start := time.Now()
-	r := tx.Tx.QueryRow(query, args...)
-	if dur := time.Since(start); dur > longQueryDuration {
-		tx.log.Debug("slow query row", zap.String("query", query), zap.Duration("elapsed", dur), zap.Stack("stack"))
-	}
-	return &row{r, tx.log.Named("row")}
+	r := tx.Tx.QueryRowContext(tx.ctx, query, args...)
+	return &row{Row: r, query: query, args: args, elapsed: time.Since(start), qm: tx.qm, log: tx.log.Named("row")}
 }
 
 // getDBVersion returns the current version of the database.
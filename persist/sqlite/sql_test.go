@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSlowQueries(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), zap.New(core), WithSlowQueryThreshold(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.AddWallet(wallet.Wallet{Name: "test"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.Wallets(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := db.SlowQueries()
+	if counts[opExec]+counts[opQueryRow] == 0 || counts[opQuery] == 0 {
+		t.Fatalf("expected slow queries to be counted, got %v", counts)
+	}
+
+	entries := logs.FilterMessage("slow query").FilterField(zap.String("op", opQuery)).All()
+	if len(entries) == 0 {
+		t.Fatal("expected slow queries to be logged")
+	}
+	fields := entries[0].ContextMap()
+	if q, _ := fields["query"].(string); q == "" {
+		t.Fatal("expected query to be logged")
+	} else if _, ok := fields["rows"]; !ok {
+		t.Fatal("expected rows to be logged")
+	} else if _, ok := fields["args"]; !ok {
+		t.Fatal("expected args to be logged")
+	}
+
+	// a zero threshold disables logging
+	db.queries.threshold = 0
+	n := logs.Len()
+	if _, err := db.Wallets(); err != nil {
+		t.Fatal(err)
+	} else if logs.Len() != n {
+		t.Fatal("expected no slow queries to be logged")
+	}
+}
+
+func TestSummarizeArgs(t *testing.T) {
+	got := summarizeArgs([]any{int64(5), []byte{1, 2, 3}, "secret", nil, true, time.Time{}})
+	const want = "5, blob(3), text(6), null, true, time.Time"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
@@ -1,12 +1,14 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.thebigfile.com/walletd/wallet"
@@ -17,41 +19,75 @@ import (
 type (
 	// A Store is a persistent store that uses a SQL database as its backend.
 	Store struct {
-		indexMode wallet.IndexMode
+		indexMode      wallet.IndexMode
+		eventRetention wallet.EventRetention
+		enrichers      []wallet.NamedEnricher
 
-		db  *sql.DB
-		log *zap.Logger
+		writer *connPool // a single connection for transactions that write
+		reader *connPool // read-only connections
+		// scheduler admits expensive reads fairly between wallets
+		scheduler *fairScheduler
+
+		log         *zap.Logger
+		queries     *queryMonitor
+		readConns   int
+		busyRetries atomic.Uint64
 	}
 )
 
 // Close closes the underlying database.
 func (s *Store) Close() error {
-	return s.db.Close()
+	return errors.Join(s.reader.db.Close(), s.writer.db.Close())
 }
 
-// transaction executes a function within a database transaction. If the
-// function returns an error, the transaction is rolled back. Otherwise, the
-// transaction is committed. If the transaction fails due to a busy error, it is
-// retried up to 10 times before returning.
+// transaction executes a function within a database transaction on the write
+// connection. If the function returns an error, the transaction is rolled
+// back. Otherwise, the transaction is committed. If the transaction fails due
+// to a busy error, it is retried with exponential backoff.
 func (s *Store) transaction(fn func(*txn) error) error {
+	return s.retryTransaction(context.Background(), s.writer, "transaction", fn)
+}
+
+// readTransaction executes a function within a read-only transaction. Read
+// transactions run concurrently with each other and with the write
+// connection, and see a consistent snapshot of the database. fn must not
+// modify the database.
+func (s *Store) readTransaction(fn func(*txn) error) error {
+	return s.readTransactionContext(context.Background(), fn)
+}
+
+// readTransactionContext is like readTransaction, but interrupts the
+// transaction's queries and rolls it back when ctx is canceled. It is used
+// by reads that may scan many rows, so that they stop when the request that
+// started them is canceled.
+func (s *Store) readTransactionContext(ctx context.Context, fn func(*txn) error) error {
+	return s.retryTransaction(ctx, s.reader, "readTransaction", fn)
+}
+
+func (s *Store) retryTransaction(ctx context.Context, pool *connPool, name string, fn func(*txn) error) error {
 	var err error
 	txnID := hex.EncodeToString(frand.Bytes(4))
-	log := s.log.Named("transaction").With(zap.String("id", txnID))
+	log := s.log.Named(name).With(zap.String("id", txnID))
 	start := time.Now()
 	attempt := 1
 	for ; attempt < maxRetryAttempts; attempt++ {
 		attemptStart := time.Now()
 		log := log.With(zap.Int("attempt", attempt))
-		err = doTransaction(s.db, log, fn)
+		err = doTransaction(ctx, pool, log, s.queries, fn)
 		if err == nil {
 			// no error, break out of the loop
 			return nil
 		}
 
-		// return immediately if the error is not a busy error
-		if !strings.Contains(err.Error(), "database is locked") {
+		// return immediately if the error is not a busy error or the
+		// transaction was canceled
+		if !isBusyError(err) {
+			break
+		} else if ctx.Err() != nil {
+			err = errors.Join(ctx.Err(), err)
 			break
 		}
+		s.busyRetries.Add(1)
 		// exponential backoff
 		sleep := time.Duration(math.Pow(factor, float64(attempt))) * time.Millisecond
 		if sleep > maxBackoff {
@@ -76,9 +112,9 @@ func sqliteFilepath(fp string) string {
 
 // doTransaction is a helper function to execute a function within a transaction. If fn returns
 // an error, the transaction is rolled back. Otherwise, the transaction is
-// committed.
-func doTransaction(db *sql.DB, log *zap.Logger, fn func(tx *txn) error) error {
-	dbtx, err := db.Begin()
+// committed. The transaction's queries are interrupted when ctx is canceled.
+func doTransaction(ctx context.Context, pool *connPool, log *zap.Logger, qm *queryMonitor, fn func(tx *txn) error) error {
+	dbtx, err := pool.begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
@@ -95,6 +131,8 @@ func doTransaction(db *sql.DB, log *zap.Logger, fn func(tx *txn) error) error {
 
 	tx := &txn{
 		Tx:  dbtx,
+		ctx: ctx,
+		qm:  qm,
 		log: log,
 	}
 	if err := fn(tx); err != nil {
@@ -105,18 +143,33 @@ func doTransaction(db *sql.DB, log *zap.Logger, fn func(tx *txn) error) error {
 	return nil
 }
 
+// SlowQueries returns the number of queries that exceeded the slow query
+// threshold, keyed by operation: exec, query, query_row, or prepare.
+func (s *Store) SlowQueries() map[string]uint64 {
+	return s.queries.slowQueries()
+}
+
 // OpenDatabase creates a new SQLite store and initializes the database. If the
 // database does not exist, it is created.
-func OpenDatabase(fp string, log *zap.Logger) (*Store, error) {
-	db, err := sql.Open("sqlite3", sqliteFilepath(fp))
+func OpenDatabase(fp string, log *zap.Logger, opts ...Option) (*Store, error) {
+	store := &Store{
+		log:       log,
+		queries:   newQueryMonitor(defaultSlowQueryThreshold),
+		readConns: defaultReadConnections,
+	}
+	for _, opt := range opts {
+		opt(store)
+	}
+	writer, reader, err := openPools(fp, store.readConns)
 	if err != nil {
 		return nil, err
 	}
-	store := &Store{
-		db:  db,
-		log: log,
-	}
+	store.writer, store.reader = writer, reader
+	// one read connection is left unscheduled so that cheap reads are
+	// never stuck behind expensive ones
+	store.scheduler = newFairScheduler(store.readConns - 1)
 	if err := store.init(); err != nil {
+		store.Close()
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 	return store, nil
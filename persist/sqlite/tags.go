@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/tags"
+)
+
+// AddressTags returns every tagged address.
+func (s *Store) AddressTags() (tt []tags.Tag, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT address, label, category, source, date_added FROM address_tags`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t tags.Tag
+			if err := rows.Scan(decode(&t.Address), &t.Label, &t.Category, &t.Source, decode(&t.DateAdded)); err != nil {
+				return fmt.Errorf("failed to scan tag: %w", err)
+			}
+			tt = append(tt, t)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// SetAddressTag adds or replaces the tag of an address.
+func (s *Store) SetAddressTag(t tags.Tag) error {
+	return s.transaction(func(tx *txn) error {
+		_, err := tx.Exec(`INSERT INTO address_tags (address, label, category, source, date_added) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (address) DO UPDATE SET label=EXCLUDED.label, category=EXCLUDED.category, source=EXCLUDED.source, date_added=EXCLUDED.date_added`, encode(t.Address), t.Label, t.Category, t.Source, encode(t.DateAdded))
+		return err
+	})
+}
+
+// RemoveAddressTag removes the tag of an address.
+func (s *Store) RemoveAddressTag(addr types.Address) error {
+	return s.transaction(func(tx *txn) error {
+		var dummy []byte
+		err := tx.QueryRow(`DELETE FROM address_tags WHERE address=$1 RETURNING address`, encode(addr)).Scan(&dummy)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tags.ErrNotFound
+		}
+		return err
+	})
+}
+
+// ReplaceFeedTags replaces every tag imported from a feed. Existing manual
+// tags are not overwritten.
+func (s *Store) ReplaceFeedTags(tt []tags.Tag) error {
+	return s.transaction(func(tx *txn) error {
+		if _, err := tx.Exec(`DELETE FROM address_tags WHERE source=$1`, tags.SourceFeed); err != nil {
+			return fmt.Errorf("failed to remove feed tags: %w", err)
+		}
+
+		stmt, err := tx.Prepare(`INSERT INTO address_tags (address, label, category, source, date_added) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (address) DO NOTHING`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, t := range tt {
+			if _, err := stmt.Exec(encode(t.Address), t.Label, t.Category, t.Source, encode(t.DateAdded)); err != nil {
+				return fmt.Errorf("failed to add tag %v: %w", t.Address, err)
+			}
+		}
+		return nil
+	})
+}
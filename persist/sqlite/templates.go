@@ -0,0 +1,139 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+)
+
+const templateColumns = `id, name, description, metadata, metadata_schema, fee_strategy, webhooks, date_created, last_updated`
+
+func scanTemplate(s scanner) (t wallet.Template, err error) {
+	var metadata, schema, feeStrategy, webhooks []byte
+	if err = s.Scan(&t.ID, &t.Name, &t.Description, &metadata, &schema, &feeStrategy, &webhooks, decode(&t.DateCreated), decode(&t.LastUpdated)); err != nil {
+		return
+	}
+	if len(metadata) > 0 {
+		t.Metadata = json.RawMessage(metadata)
+	}
+	if len(schema) > 0 {
+		t.MetadataSchema = json.RawMessage(schema)
+	}
+	if len(feeStrategy) > 0 {
+		t.FeeStrategy = new(wallet.FeeStrategy)
+		if err = json.Unmarshal(feeStrategy, t.FeeStrategy); err != nil {
+			return t, fmt.Errorf("failed to decode fee strategy: %w", err)
+		}
+	}
+	if err = json.Unmarshal(webhooks, &t.Webhooks); err != nil {
+		return t, fmt.Errorf("failed to decode webhooks: %w", err)
+	}
+	return
+}
+
+// encodeTemplate returns the JSON-encoded fee strategy and webhooks of a
+// template.
+func encodeTemplate(t wallet.Template) (feeStrategy, webhooks []byte, err error) {
+	if t.FeeStrategy != nil {
+		feeStrategy, err = json.Marshal(t.FeeStrategy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encode fee strategy: %w", err)
+		}
+	}
+	if t.Webhooks == nil {
+		t.Webhooks = []wallet.TemplateWebhook{}
+	}
+	webhooks, err = json.Marshal(t.Webhooks)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode webhooks: %w", err)
+	}
+	return
+}
+
+// Templates returns all wallet templates.
+func (s *Store) Templates() (templates []wallet.Template, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT ` + templateColumns + ` FROM wallet_templates ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			t, err := scanTemplate(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan template: %w", err)
+			}
+			templates = append(templates, t)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// Template returns a wallet template.
+func (s *Store) Template(id wallet.TemplateID) (t wallet.Template, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		t, err = scanTemplate(tx.QueryRow(`SELECT `+templateColumns+` FROM wallet_templates WHERE id=$1`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrTemplateNotFound
+		}
+		return err
+	})
+	return
+}
+
+// AddTemplate adds a wallet template.
+func (s *Store) AddTemplate(t wallet.Template) (wallet.Template, error) {
+	feeStrategy, webhooks, err := encodeTemplate(t)
+	if err != nil {
+		return wallet.Template{}, err
+	}
+
+	t.ID = 0
+	t.DateCreated = time.Now().Truncate(time.Second)
+	t.LastUpdated = t.DateCreated
+	err = s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO wallet_templates (name, description, metadata, metadata_schema, fee_strategy, webhooks, date_created, last_updated) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+		return tx.QueryRow(query, t.Name, t.Description, []byte(t.Metadata), []byte(t.MetadataSchema), feeStrategy, webhooks, encode(t.DateCreated), encode(t.LastUpdated)).Scan(&t.ID)
+	})
+	return t, err
+}
+
+// UpdateTemplate updates a wallet template.
+func (s *Store) UpdateTemplate(t wallet.Template) (wallet.Template, error) {
+	feeStrategy, webhooks, err := encodeTemplate(t)
+	if err != nil {
+		return wallet.Template{}, err
+	}
+
+	t.LastUpdated = time.Now().Truncate(time.Second)
+	err = s.transaction(func(tx *txn) error {
+		const query = `UPDATE wallet_templates SET name=$1, description=$2, metadata=$3, metadata_schema=$4, fee_strategy=$5, webhooks=$6, last_updated=$7 WHERE id=$8 RETURNING date_created`
+		err := tx.QueryRow(query, t.Name, t.Description, []byte(t.Metadata), []byte(t.MetadataSchema), feeStrategy, webhooks, encode(t.LastUpdated), t.ID).Scan(decode(&t.DateCreated))
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrTemplateNotFound
+		}
+		return err
+	})
+	return t, err
+}
+
+// DeleteTemplate deletes a wallet template.
+func (s *Store) DeleteTemplate(id wallet.TemplateID) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM wallet_templates WHERE id=$1`, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrTemplateNotFound
+		}
+		return nil
+	})
+}
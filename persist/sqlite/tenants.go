@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// TenantWallets returns the wallets owned by a tenant.
+func (s *Store) TenantWallets(tenant string) (wallets []wallet.Wallet, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT id, friendly_name, description, date_created, last_updated, extra_data, tenant, wallet_type, revision FROM wallets WHERE tenant=$1`
+
+		rows, err := tx.Query(query, tenant)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var w wallet.Wallet
+			if err := rows.Scan(&w.ID, &w.Name, &w.Description, decode(&w.DateCreated), decode(&w.LastUpdated), (*[]byte)(&w.Metadata), &w.Tenant, &w.Type, &w.Revision); err != nil {
+				return fmt.Errorf("failed to scan wallet: %w", err)
+			}
+			wallets = append(wallets, w)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// WalletTenant returns the tenant that owns a wallet.
+func (s *Store) WalletTenant(id wallet.ID) (tenant string, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		err := tx.QueryRow(`SELECT tenant FROM wallets WHERE id=$1`, id).Scan(&tenant)
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// TenantHasAddress returns true if the address belongs to any of the
+// tenant's wallets.
+func (s *Store) TenantHasAddress(tenant string, address types.Address) (exists bool, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT EXISTS (
+	SELECT 1 FROM wallet_addresses wa
+	INNER JOIN wallets w ON (wa.wallet_id = w.id)
+	INNER JOIN sia_addresses sa ON (wa.address_id = sa.id)
+	WHERE w.tenant=$1 AND sa.sia_address=$2
+)`
+		return tx.QueryRow(query, tenant, encode(address)).Scan(&exists)
+	})
+	return
+}
+
+// TenantHasEvent returns true if the event is relevant to any of the tenant's
+// wallets.
+func (s *Store) TenantHasEvent(tenant string, eventID types.Hash256) (exists bool, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT EXISTS (
+	SELECT 1 FROM events ev
+	INNER JOIN event_addresses ea ON (ev.id = ea.event_id)
+	INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+	INNER JOIN wallets w ON (wa.wallet_id = w.id)
+	WHERE w.tenant=$1 AND ev.event_id=$2
+)`
+		return tx.QueryRow(query, tenant, encode(eventID)).Scan(&exists)
+	})
+	return
+}
+
+// TenantUsage returns the number of wallets and addresses owned by each
+// tenant.
+func (s *Store) TenantUsage() (usage []wallet.TenantUsage, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT w.tenant, COUNT(DISTINCT w.id), COUNT(wa.address_id)
+FROM wallets w
+LEFT JOIN wallet_addresses wa ON (wa.wallet_id = w.id)
+WHERE w.tenant <> ''
+GROUP BY w.tenant
+ORDER BY w.tenant ASC`
+
+		rows, err := tx.Query(query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var tu wallet.TenantUsage
+			if err := rows.Scan(&tu.Tenant, &tu.Wallets, &tu.Addresses); err != nil {
+				return fmt.Errorf("failed to scan tenant usage: %w", err)
+			}
+			usage = append(usage, tu)
+		}
+		return rows.Err()
+	})
+	return
+}
@@ -0,0 +1,124 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/walletd/threshold"
+)
+
+const thresholdGroupColumns = `id, name, public_key, threshold, max_participants, date_created`
+
+func scanThresholdGroup(s scanner) (g threshold.Group, err error) {
+	err = s.Scan(&g.ID, &g.Name, decode(&g.PublicKey), &g.Threshold, &g.MaxParticipants, decode(&g.DateCreated))
+	return
+}
+
+// thresholdParticipants returns the participants of a group, ordered by
+// identifier.
+func thresholdParticipants(tx *txn, id threshold.GroupID) ([]threshold.Participant, error) {
+	rows, err := tx.Query(`SELECT participant_id, name, date_registered FROM threshold_participants WHERE group_id=$1 ORDER BY participant_id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := []threshold.Participant{}
+	for rows.Next() {
+		var p threshold.Participant
+		if err := rows.Scan(&p.ID, &p.Name, decode(&p.DateRegistered)); err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %w", err)
+		}
+		participants = append(participants, p)
+	}
+	return participants, rows.Err()
+}
+
+// AddThresholdGroup adds a threshold signing group.
+func (s *Store) AddThresholdGroup(g threshold.Group) (threshold.Group, error) {
+	err := s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO threshold_groups (name, public_key, threshold, max_participants, date_created) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+		return tx.QueryRow(query, g.Name, encode(g.PublicKey), g.Threshold, g.MaxParticipants, encode(g.DateCreated)).Scan(&g.ID)
+	})
+	return g, err
+}
+
+// ThresholdGroups returns all threshold signing groups.
+func (s *Store) ThresholdGroups() (groups []threshold.Group, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT ` + thresholdGroupColumns + ` FROM threshold_groups ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			g, err := scanThresholdGroup(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan group: %w", err)
+			}
+			groups = append(groups, g)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range groups {
+			groups[i].Participants, err = thresholdParticipants(tx, groups[i].ID)
+			if err != nil {
+				return fmt.Errorf("failed to get participants of group %d: %w", groups[i].ID, err)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// ThresholdGroup returns a threshold signing group.
+func (s *Store) ThresholdGroup(id threshold.GroupID) (g threshold.Group, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		g, err = scanThresholdGroup(tx.QueryRow(`SELECT `+thresholdGroupColumns+` FROM threshold_groups WHERE id=$1`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return threshold.ErrGroupNotFound
+		} else if err != nil {
+			return err
+		}
+		g.Participants, err = thresholdParticipants(tx, id)
+		return err
+	})
+	return
+}
+
+// RemoveThresholdGroup removes a threshold signing group and its
+// participants.
+func (s *Store) RemoveThresholdGroup(id threshold.GroupID) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`DELETE FROM threshold_groups WHERE id=$1`, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return threshold.ErrGroupNotFound
+		}
+		return nil
+	})
+}
+
+// AddThresholdParticipant registers a participant with a threshold signing
+// group.
+func (s *Store) AddThresholdParticipant(id threshold.GroupID, p threshold.Participant) error {
+	return s.transaction(func(tx *txn) error {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM threshold_participants WHERE group_id=$1 AND participant_id=$2)`, id, p.ID).Scan(&exists)
+		if err != nil {
+			return err
+		} else if exists {
+			return threshold.ErrParticipantExists
+		}
+
+		_, err = tx.Exec(`INSERT INTO threshold_participants (group_id, participant_id, name, date_registered) VALUES ($1, $2, $3, $4)`, id, p.ID, p.Name, encode(p.DateRegistered))
+		return err
+	})
+}
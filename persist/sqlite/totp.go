@@ -0,0 +1,89 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.thebigfile.com/walletd/totp"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// WalletTOTP returns the TOTP secret of a wallet.
+func (s *Store) WalletTOTP(id wallet.ID) (secret totp.Secret, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		err := tx.QueryRow(`SELECT secret, enabled, last_counter, date_created, date_enabled FROM wallet_totp WHERE wallet_id=$1`, id).Scan(&secret.Key, &secret.Enabled, &secret.LastCounter, decode(&secret.DateCreated), decode(&secret.DateEnabled))
+		if errors.Is(err, sql.ErrNoRows) {
+			return totp.ErrNotEnrolled
+		}
+		return err
+	})
+	return
+}
+
+// SetWalletTOTP sets the TOTP secret of a wallet, replacing any existing
+// secret.
+func (s *Store) SetWalletTOTP(id wallet.ID, secret totp.Secret) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_totp (wallet_id, secret, enabled, last_counter, date_created, date_enabled) VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (wallet_id) DO UPDATE SET secret=EXCLUDED.secret, enabled=EXCLUDED.enabled, last_counter=EXCLUDED.last_counter, date_created=EXCLUDED.date_created, date_enabled=EXCLUDED.date_enabled`, id, secret.Key, secret.Enabled, secret.LastCounter, encode(secret.DateCreated), encode(secret.DateEnabled))
+		return err
+	})
+}
+
+// EnableWalletTOTP enables the TOTP secret of a wallet.
+func (s *Store) EnableWalletTOTP(id wallet.ID, counter uint64, timestamp time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`UPDATE wallet_totp SET enabled=TRUE, last_counter=$1, date_enabled=$2 WHERE wallet_id=$3`, counter, encode(timestamp), id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return totp.ErrNotEnrolled
+		}
+		return nil
+	})
+}
+
+// RemoveWalletTOTP removes the TOTP secret of a wallet.
+func (s *Store) RemoveWalletTOTP(id wallet.ID) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM wallet_totp WHERE wallet_id=$1`, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return totp.ErrNotEnrolled
+		}
+		return nil
+	})
+}
+
+// UseWalletTOTPCounter records the time step of a used TOTP code.
+func (s *Store) UseWalletTOTPCounter(id wallet.ID, counter uint64) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE wallet_totp SET last_counter=$1 WHERE wallet_id=$2 AND last_counter < $3`, counter, id, counter)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return totp.ErrCodeUsed
+		}
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/transfers"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// AddTransfer adds a transfer between two wallets and its linked debit and
+// credit entries.
+func (s *Store) AddTransfer(t transfers.Transfer) (transfers.Transfer, error) {
+	var txnBuf any
+	if t.Transaction != nil {
+		txnBuf = encode(*t.Transaction)
+	}
+	err := s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, t.From); err != nil {
+			return err
+		} else if err := walletExists(tx, t.To); err != nil {
+			return err
+		}
+
+		const query = `INSERT INTO transfers (from_wallet_id, to_wallet_id, value, method, status, memo, basis_height, basis_id, txn, fee, date_created) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id`
+		if err := tx.QueryRow(query, t.From, t.To, encode(t.Value), t.Method, t.Status, t.Memo, t.Basis.Height, encode(t.Basis.ID), txnBuf, encode(t.Fee), encode(t.DateCreated)).Scan(&t.ID); err != nil {
+			return fmt.Errorf("failed to add transfer: %w", err)
+		}
+
+		stmt, err := tx.Prepare(`INSERT INTO transfer_entries (transfer_id, wallet_id, counterparty_id, entry_type, value) VALUES ($1, $2, $3, $4, $5)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		if _, err := stmt.Exec(t.ID, t.From, t.To, transfers.EntryDebit, encode(t.Value)); err != nil {
+			return fmt.Errorf("failed to add debit entry: %w", err)
+		} else if _, err := stmt.Exec(t.ID, t.To, t.From, transfers.EntryCredit, encode(t.Value)); err != nil {
+			return fmt.Errorf("failed to add credit entry: %w", err)
+		}
+		return nil
+	})
+	return t, err
+}
+
+// Transfer returns a transfer.
+func (s *Store) Transfer(id int64) (t transfers.Transfer, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		var buf []byte
+		const query = `SELECT id, from_wallet_id, to_wallet_id, value, method, status, memo, basis_height, basis_id, txn, fee, date_created FROM transfers WHERE id=$1`
+		err := tx.QueryRow(query, id).Scan(&t.ID, &t.From, &t.To, decode(&t.Value), &t.Method, &t.Status, &t.Memo, &t.Basis.Height, decode(&t.Basis.ID), &buf, decode(&t.Fee), decode(&t.DateCreated))
+		if errors.Is(err, sql.ErrNoRows) {
+			return transfers.ErrNotFound
+		} else if err != nil {
+			return err
+		} else if buf != nil {
+			t.Transaction = new(types.V2Transaction)
+			dec := types.NewBufDecoder(buf)
+			t.Transaction.DecodeFrom(dec)
+			if err := dec.Err(); err != nil {
+				return fmt.Errorf("failed to decode transaction: %w", err)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// WalletTransferEntries returns the transfer entries of a wallet, newest
+// first.
+func (s *Store) WalletTransferEntries(walletID wallet.ID, offset, limit int) (entries []transfers.Entry, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, walletID); err != nil {
+			return err
+		}
+		const query = `SELECT te.id, te.transfer_id, te.wallet_id, te.counterparty_id, te.entry_type, t.method, te.value, t.date_created
+FROM transfer_entries te
+INNER JOIN transfers t ON te.transfer_id = t.id
+WHERE te.wallet_id=$1
+ORDER BY te.id DESC
+LIMIT $2 OFFSET $3`
+		rows, err := tx.Query(query, walletID, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e transfers.Entry
+			if err := rows.Scan(&e.ID, &e.TransferID, &e.WalletID, &e.Counterparty, &e.Type, &e.Method, decode(&e.Value), decode(&e.DateCreated)); err != nil {
+				return fmt.Errorf("failed to scan entry: %w", err)
+			}
+			entries = append(entries, e)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// WalletLedgerTotals returns the total value of the ledger entries credited
+// to and debited from a wallet.
+func (s *Store) WalletLedgerTotals(walletID wallet.ID) (credited, debited types.Currency, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT te.entry_type, te.value
+FROM transfer_entries te
+INNER JOIN transfers t ON te.transfer_id = t.id
+WHERE te.wallet_id=$1 AND t.method=$2`
+		rows, err := tx.Query(query, walletID, transfers.MethodLedger)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var entryType string
+			var value types.Currency
+			if err := rows.Scan(&entryType, decode(&value)); err != nil {
+				return fmt.Errorf("failed to scan entry: %w", err)
+			}
+			switch entryType {
+			case transfers.EntryCredit:
+				credited = credited.Add(value)
+			case transfers.EntryDebit:
+				debited = debited.Add(value)
+			}
+		}
+		return rows.Err()
+	})
+	return
+}
@@ -0,0 +1,382 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// WalletPolicy returns the treasury policy of a wallet. The zero policy is
+// returned if the wallet does not have one.
+func (s *Store) WalletPolicy(id wallet.ID) (policy treasury.Policy, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		policy, err = scanPolicy(tx.QueryRow(`SELECT `+policyColumns+` FROM wallet_policies WHERE wallet_id=$1`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	return
+}
+
+const policyColumns = `approval_threshold, daily_limit, weekly_limit, restrict_destinations, allowlist_delay`
+
+func scanPolicy(s scanner) (p treasury.Policy, err error) {
+	err = s.Scan(decode(&p.ApprovalThreshold), decode(&p.DailyLimit), decode(&p.WeeklyLimit), &p.RestrictDestinations, &p.AllowlistDelay)
+	return
+}
+
+func insertPolicy(tx *txn, id wallet.ID, p treasury.Policy) error {
+	const query = `INSERT INTO wallet_policies (wallet_id, ` + policyColumns + `) VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (wallet_id) DO UPDATE SET approval_threshold=EXCLUDED.approval_threshold, daily_limit=EXCLUDED.daily_limit, weekly_limit=EXCLUDED.weekly_limit, restrict_destinations=EXCLUDED.restrict_destinations, allowlist_delay=EXCLUDED.allowlist_delay`
+	_, err := tx.Exec(query, id, encode(p.ApprovalThreshold), encode(p.DailyLimit), encode(p.WeeklyLimit), p.RestrictDestinations, p.AllowlistDelay)
+	return err
+}
+
+// SetWalletPolicy sets the treasury policy of a wallet.
+func (s *Store) SetWalletPolicy(id wallet.ID, policy treasury.Policy) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		return insertPolicy(tx, id, policy)
+	})
+}
+
+// WalletPolicies returns the treasury policies of all wallets that have one.
+func (s *Store) WalletPolicies() (policies map[wallet.ID]treasury.Policy, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT wallet_id, ` + policyColumns + ` FROM wallet_policies`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		policies = make(map[wallet.ID]treasury.Policy)
+		for rows.Next() {
+			var id wallet.ID
+			var p treasury.Policy
+			if err := rows.Scan(&id, decode(&p.ApprovalThreshold), decode(&p.DailyLimit), decode(&p.WeeklyLimit), &p.RestrictDestinations, &p.AllowlistDelay); err != nil {
+				return fmt.Errorf("failed to scan policy: %w", err)
+			}
+			policies[id] = p
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// pendingTransactionSet is the encoded form of a pending transaction set.
+type pendingTransactionSet struct {
+	Transactions   []types.Transaction   `json:"transactions"`
+	V2Transactions []types.V2Transaction `json:"v2transactions"`
+}
+
+// AddPendingTransaction adds a transaction set to the pending queue.
+func (s *Store) AddPendingTransaction(pt treasury.PendingTransaction) (treasury.PendingTransaction, error) {
+	buf, err := json.Marshal(pendingTransactionSet{pt.Transactions, pt.V2Transactions})
+	if err != nil {
+		return treasury.PendingTransaction{}, fmt.Errorf("failed to encode transactions: %w", err)
+	}
+
+	err = s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO pending_transactions (wallet_id, amount, transactions, status, submitted_by, date_created) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+		return tx.QueryRow(query, pt.WalletID, encode(pt.Amount), buf, pt.Status, pt.SubmittedBy, encode(pt.DateCreated)).Scan(&pt.ID)
+	})
+	return pt, err
+}
+
+func scanPendingTransaction(s scanner) (pt treasury.PendingTransaction, err error) {
+	var buf []byte
+	var decidedBy sql.NullString
+	var dateDecided sql.NullInt64
+	if err := s.Scan(&pt.ID, &pt.WalletID, decode(&pt.Amount), &buf, &pt.Status, &pt.SubmittedBy, &decidedBy, decode(&pt.DateCreated), &dateDecided); err != nil {
+		return treasury.PendingTransaction{}, err
+	}
+	pt.DecidedBy = decidedBy.String
+	if dateDecided.Valid {
+		pt.DateDecided = time.Unix(dateDecided.Int64, 0).UTC()
+	}
+
+	var set pendingTransactionSet
+	if err := json.Unmarshal(buf, &set); err != nil {
+		return treasury.PendingTransaction{}, fmt.Errorf("failed to decode transaction set: %w", err)
+	}
+	pt.Transactions, pt.V2Transactions = set.Transactions, set.V2Transactions
+	return pt, nil
+}
+
+const pendingTransactionColumns = `id, wallet_id, amount, transactions, status, submitted_by, decided_by, date_created, date_decided`
+
+// PendingTransaction returns a pending transaction.
+func (s *Store) PendingTransaction(id int64) (pt treasury.PendingTransaction, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		pt, err = scanPendingTransaction(tx.QueryRow(`SELECT `+pendingTransactionColumns+` FROM pending_transactions WHERE id=$1`, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return treasury.ErrNotFound
+		}
+		return err
+	})
+	return
+}
+
+// PendingTransactions returns pending transactions with the given status,
+// newest first. An empty status returns transactions with any status.
+func (s *Store) PendingTransactions(status string, offset, limit int) (pts []treasury.PendingTransaction, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT `+pendingTransactionColumns+` FROM pending_transactions WHERE $1='' OR status=$1 ORDER BY id DESC LIMIT $2 OFFSET $3`, status, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			pt, err := scanPendingTransaction(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan pending transaction: %w", err)
+			}
+			pts = append(pts, pt)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// DecidePendingTransaction sets the status of a pending transaction.
+func (s *Store) DecidePendingTransaction(id int64, status, decidedBy string, timestamp time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		var dummyID int64
+		err := tx.QueryRow(`UPDATE pending_transactions SET status=$1, decided_by=$2, date_decided=$3 WHERE id=$4 AND status=$5 RETURNING id`, status, decidedBy, encode(timestamp), id, treasury.StatusPending).Scan(&dummyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err := s.pendingTransactionStatus(tx, id); err != nil {
+				return err
+			}
+			return treasury.ErrNotPending
+		}
+		return err
+	})
+}
+
+// ReopenPendingTransaction returns an approved transaction to the pending
+// queue.
+func (s *Store) ReopenPendingTransaction(id int64) error {
+	return s.transaction(func(tx *txn) error {
+		_, err := tx.Exec(`UPDATE pending_transactions SET status=$1, decided_by=NULL, date_decided=NULL WHERE id=$2 AND status=$3`, treasury.StatusPending, id, treasury.StatusApproved)
+		return err
+	})
+}
+
+func (s *Store) pendingTransactionStatus(tx *txn, id int64) (status string, err error) {
+	err = tx.QueryRow(`SELECT status FROM pending_transactions WHERE id=$1`, id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", treasury.ErrNotFound
+	}
+	return
+}
+
+// LimitOverride returns the expiration of a wallet's spending limit override,
+// or the zero time if it has none.
+func (s *Store) LimitOverride(id wallet.ID) (expiration time.Time, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		err := tx.QueryRow(`SELECT expiration FROM wallet_limit_overrides WHERE wallet_id=$1`, id).Scan(decode(&expiration))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	return
+}
+
+// SetLimitOverride sets the expiration of a wallet's spending limit override.
+// The zero time removes the override.
+func (s *Store) SetLimitOverride(id wallet.ID, expiration time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		} else if expiration.IsZero() {
+			_, err := tx.Exec(`DELETE FROM wallet_limit_overrides WHERE wallet_id=$1`, id)
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_limit_overrides (wallet_id, expiration) VALUES ($1, $2) ON CONFLICT (wallet_id) DO UPDATE SET expiration=EXCLUDED.expiration`, id, encode(expiration))
+		return err
+	})
+}
+
+// AddWalletSpend records siacoins sent by a wallet.
+func (s *Store) AddWalletSpend(id wallet.ID, amount types.Currency, timestamp time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		_, err := tx.Exec(`INSERT INTO wallet_spends (wallet_id, amount, date_created) VALUES ($1, $2, $3)`, id, encode(amount), encode(timestamp))
+		return err
+	})
+}
+
+// AddSignedSpends records the spends of a signed transaction set along with
+// the IDs of its transactions.
+func (s *Store) AddSignedSpends(txnIDs []types.TransactionID, spends map[wallet.ID]types.Currency, timestamp time.Time) error {
+	return s.transaction(func(tx *txn) error {
+		spendStmt, err := tx.Prepare(`INSERT INTO wallet_spends (wallet_id, amount, date_created) VALUES ($1, $2, $3)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare spend statement: %w", err)
+		}
+		defer spendStmt.Close()
+		for id, amount := range spends {
+			if _, err := spendStmt.Exec(id, encode(amount), encode(timestamp)); err != nil {
+				return fmt.Errorf("failed to add spend of wallet %v: %w", id, err)
+			}
+		}
+
+		txnStmt, err := tx.Prepare(`INSERT INTO signed_transactions (transaction_id, date_created) VALUES ($1, $2) ON CONFLICT (transaction_id) DO NOTHING`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare transaction statement: %w", err)
+		}
+		defer txnStmt.Close()
+		for _, id := range txnIDs {
+			if _, err := txnStmt.Exec(encode(id), encode(timestamp)); err != nil {
+				return fmt.Errorf("failed to add signed transaction %v: %w", id, err)
+			}
+		}
+		return nil
+	})
+}
+
+// SignedTransactions returns the transactions whose spends were recorded
+// when they were signed.
+func (s *Store) SignedTransactions(txnIDs []types.TransactionID) (signed map[types.TransactionID]bool, err error) {
+	signed = make(map[types.TransactionID]bool)
+	err = s.readTransaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`SELECT 1 FROM signed_transactions WHERE transaction_id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+		for _, id := range txnIDs {
+			var exists bool
+			if err := stmt.QueryRow(encode(id)).Scan(&exists); errors.Is(err, sql.ErrNoRows) {
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to query transaction %v: %w", id, err)
+			}
+			signed[id] = true
+		}
+		return nil
+	})
+	return
+}
+
+// WalletSpent returns the total siacoins sent by a wallet since the given
+// time.
+func (s *Store) WalletSpent(id wallet.ID, since time.Time) (spent types.Currency, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT amount FROM wallet_spends WHERE wallet_id=$1 AND date_created >= $2`, id, encode(since))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var amount types.Currency
+			if err := rows.Scan(decode(&amount)); err != nil {
+				return fmt.Errorf("failed to scan amount: %w", err)
+			}
+			spent = spent.Add(amount)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// AddAllowlistEntry adds an address to a wallet's allowlist. If the address
+// is already allowlisted, the existing entry is kept.
+func (s *Store) AddAllowlistEntry(id wallet.ID, entry treasury.AllowlistEntry) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_allowlist (wallet_id, address, description, date_added, active_after) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (wallet_id, address) DO NOTHING`, id, encode(entry.Address), entry.Description, encode(entry.DateAdded), encode(entry.ActiveAfter))
+		return err
+	})
+}
+
+// RemoveAllowlistEntry removes an address from a wallet's allowlist.
+func (s *Store) RemoveAllowlistEntry(id wallet.ID, addr types.Address) error {
+	return s.transaction(func(tx *txn) error {
+		var dummyID int64
+		err := tx.QueryRow(`DELETE FROM wallet_allowlist WHERE wallet_id=$1 AND address=$2 RETURNING wallet_id`, id, encode(addr)).Scan(&dummyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrNotFound
+		}
+		return err
+	})
+}
+
+// Allowlist returns a wallet's allowlisted addresses.
+func (s *Store) Allowlist(id wallet.ID) (entries []treasury.AllowlistEntry, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT address, description, date_added, active_after FROM wallet_allowlist WHERE wallet_id=$1 ORDER BY date_added ASC`, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var entry treasury.AllowlistEntry
+			if err := rows.Scan(decode(&entry.Address), &entry.Description, decode(&entry.DateAdded), decode(&entry.ActiveAfter)); err != nil {
+				return fmt.Errorf("failed to scan allowlist entry: %w", err)
+			}
+			entries = append(entries, entry)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// UnallowedDestinations returns the addresses that do not belong to the
+// wallet and are not active on its allowlist at the given time.
+func (s *Store) UnallowedDestinations(id wallet.ID, addrs []types.Address, now time.Time) (unallowed []types.Address, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		ownedStmt, err := tx.Prepare(`SELECT 1 FROM wallet_addresses wa INNER JOIN sia_addresses sa ON (sa.id = wa.address_id) WHERE wa.wallet_id=$1 AND sa.sia_address=$2`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer ownedStmt.Close()
+
+		allowedStmt, err := tx.Prepare(`SELECT 1 FROM wallet_allowlist WHERE wallet_id=$1 AND address=$2 AND active_after <= $3`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer allowedStmt.Close()
+
+		for _, addr := range addrs {
+			var dummy int
+			err := ownedStmt.QueryRow(id, encode(addr)).Scan(&dummy)
+			if err == nil {
+				continue
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("failed to check wallet address: %w", err)
+			}
+
+			err = allowedStmt.QueryRow(id, encode(addr), encode(now)).Scan(&dummy)
+			if errors.Is(err, sql.ErrNoRows) {
+				unallowed = append(unallowed, addr)
+			} else if err != nil {
+				return fmt.Errorf("failed to check allowlist: %w", err)
+			}
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/triggers"
+)
+
+// AddTrigger adds a trigger to the database.
+func (s *Store) AddTrigger(t triggers.Trigger) (triggers.Trigger, error) {
+	err := s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO chain_triggers (name, height, block_interval, next_height, last_fired_height, last_fired_id, date_created) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		return tx.QueryRow(query, t.Name, t.Height, t.Interval, t.NextHeight, t.LastFired.Height, encode(t.LastFired.ID), encode(t.DateCreated)).Scan(&t.ID)
+	})
+	return t, err
+}
+
+// Triggers returns all triggers in the database, ordered by the height at
+// which they fire next.
+func (s *Store) Triggers() (ts []triggers.Trigger, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT id, name, height, block_interval, next_height, last_fired_height, last_fired_id, date_created FROM chain_triggers ORDER BY next_height ASC, id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t triggers.Trigger
+			if err := rows.Scan(&t.ID, &t.Name, &t.Height, &t.Interval, &t.NextHeight, &t.LastFired.Height, decode(&t.LastFired.ID), decode(&t.DateCreated)); err != nil {
+				return fmt.Errorf("failed to scan trigger: %w", err)
+			}
+			ts = append(ts, t)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// RemoveTrigger removes a trigger from the database.
+func (s *Store) RemoveTrigger(id int64) error {
+	return s.transaction(func(tx *txn) error {
+		var dummyID int64
+		err := tx.QueryRow(`DELETE FROM chain_triggers WHERE id=$1 RETURNING id`, id).Scan(&dummyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return triggers.ErrNotFound
+		}
+		return err
+	})
+}
+
+// UpdateTrigger sets the tip a trigger last fired at and the height it fires
+// at next.
+func (s *Store) UpdateTrigger(id int64, lastFired types.ChainIndex, nextHeight uint64) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE chain_triggers SET last_fired_height=$1, last_fired_id=$2, next_height=$3 WHERE id=$4`, lastFired.Height, encode(lastFired.ID), nextHeight, id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return triggers.ErrNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/walletd/usage"
+)
+
+// AddAPICalls adds the calls of each record to the stored count for its
+// date, tenant, and principal.
+func (s *Store) AddAPICalls(records []usage.Record) error {
+	return s.transaction(func(tx *txn) error {
+		stmt, err := tx.Prepare(`INSERT INTO api_usage (date, tenant, principal, calls) VALUES ($1, $2, $3, $4)
+ON CONFLICT (date, tenant, principal) DO UPDATE SET calls=calls+EXCLUDED.calls`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, r := range records {
+			if _, err := stmt.Exec(encode(r.Date), r.Tenant, r.Principal, int64(r.Calls)); err != nil {
+				return fmt.Errorf("failed to add API calls: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// APICalls returns the API call counts on or after the given date.
+func (s *Store) APICalls(since time.Time) (records []usage.Record, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT date, tenant, principal, calls FROM api_usage WHERE date >= $1 ORDER BY date ASC, tenant ASC, principal ASC`, encode(since))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r usage.Record
+			if err := rows.Scan(decode(&r.Date), &r.Tenant, &r.Principal, decode(&r.Calls)); err != nil {
+				return fmt.Errorf("failed to scan API calls: %w", err)
+			}
+			records = append(records, r)
+		}
+		return rows.Err()
+	})
+	return
+}
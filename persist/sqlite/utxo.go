@@ -11,7 +11,7 @@ import (
 
 // SiacoinElement returns an unspent Siacoin UTXO by its ID.
 func (s *Store) SiacoinElement(id types.SiacoinOutputID) (ele types.SiacoinElement, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		const query = `SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address 
 FROM siacoin_elements se
 INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
@@ -42,7 +42,7 @@ WHERE se.id=$1 AND spent_index_id IS NULL`
 
 // SiafundElement returns an unspent Siafund UTXO by its ID.
 func (s *Store) SiafundElement(id types.SiafundOutputID) (ele types.SiafundElement, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		const query = `SELECT se.id, se.leaf_index, se.merkle_proof, se.siafund_value, se.claim_start, sa.sia_address 
 FROM siafund_elements se
 INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// AddressVault returns the state of the address vault of a seed.
+func (s *Store) AddressVault(fingerprint types.Hash256) (state wallet.VaultState, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		var vaultID int64
+		var walletID sql.NullInt64
+		err := tx.QueryRow(`SELECT id, fingerprint, next_index, wallet_id, lookahead, registered, date_created FROM address_vaults WHERE fingerprint=$1`, encode(fingerprint)).Scan(&vaultID, decode(&state.Fingerprint), decode(&state.NextIndex), &walletID, decode(&state.Lookahead), decode(&state.Registered), decode(&state.DateCreated))
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get vault: %w", err)
+		} else if walletID.Valid {
+			state.WalletID = wallet.ID(walletID.Int64)
+		}
+
+		rows, err := tx.Query(`SELECT key_index, sia_address, description, date_issued FROM address_vault_addresses WHERE vault_id=$1 ORDER BY key_index ASC`, vaultID)
+		if err != nil {
+			return fmt.Errorf("failed to query issued addresses: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var addr wallet.IssuedAddress
+			if err := rows.Scan(decode(&addr.Index), decode(&addr.Address), &addr.Description, decode(&addr.DateIssued)); err != nil {
+				return fmt.Errorf("failed to scan issued address: %w", err)
+			}
+			state.Issued = append(state.Issued, addr)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// AddAddressVault adds the address vault of a seed.
+func (s *Store) AddAddressVault(state wallet.VaultState) error {
+	return s.transaction(func(tx *txn) error {
+		var walletID sql.NullInt64
+		if state.WalletID != 0 {
+			if err := walletExists(tx, state.WalletID); err != nil {
+				return err
+			}
+			walletID = sql.NullInt64{Int64: int64(state.WalletID), Valid: true}
+		}
+		_, err := tx.Exec(`INSERT INTO address_vaults (fingerprint, next_index, wallet_id, lookahead, registered, date_created) VALUES ($1, $2, $3, $4, $5, $6)`, encode(state.Fingerprint), encode(state.NextIndex), walletID, encode(state.Lookahead), encode(state.Registered), encode(state.DateCreated))
+		return err
+	})
+}
+
+// IssueVaultAddress records an address issued by a vault and advances the
+// vault's next index past it.
+func (s *Store) IssueVaultAddress(fingerprint types.Hash256, addr wallet.IssuedAddress) error {
+	return s.transaction(func(tx *txn) error {
+		var vaultID int64
+		var next uint64
+		err := tx.QueryRow(`SELECT id, next_index FROM address_vaults WHERE fingerprint=$1`, encode(fingerprint)).Scan(&vaultID, decode(&next))
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to get vault: %w", err)
+		} else if addr.Index < next {
+			return wallet.ErrVaultIndexIssued
+		}
+
+		if _, err := tx.Exec(`INSERT INTO address_vault_addresses (vault_id, key_index, sia_address, description, date_issued) VALUES ($1, $2, $3, $4, $5)`, vaultID, encode(addr.Index), encode(addr.Address), addr.Description, encode(addr.DateIssued)); err != nil {
+			return fmt.Errorf("failed to insert issued address: %w", err)
+		} else if _, err := tx.Exec(`UPDATE address_vaults SET next_index=$1 WHERE id=$2`, encode(addr.Index+1), vaultID); err != nil {
+			return fmt.Errorf("failed to update next index: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateAddressVault updates the wallet, lookahead and number of registered
+// addresses of a vault.
+func (s *Store) UpdateAddressVault(state wallet.VaultState) error {
+	return s.transaction(func(tx *txn) error {
+		var walletID sql.NullInt64
+		if state.WalletID != 0 {
+			if err := walletExists(tx, state.WalletID); err != nil {
+				return err
+			}
+			walletID = sql.NullInt64{Int64: int64(state.WalletID), Valid: true}
+		}
+		res, err := tx.Exec(`UPDATE address_vaults SET wallet_id=$1, lookahead=$2, registered=$3 WHERE fingerprint=$4`, walletID, encode(state.Lookahead), encode(state.Registered), encode(state.Fingerprint))
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return wallet.ErrNotFound
+		}
+		return nil
+	})
+}
@@ -1,11 +1,17 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"math/bits"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"go.thebigfile.com/walletd/wallet"
 	"go.thebigfile.com/core/types"
@@ -51,10 +57,10 @@ WHERE wa.wallet_id=? AND ea.event_id=?`)
 }
 
 // WalletEvents returns the events relevant to a wallet, sorted by height descending.
-func (s *Store) WalletEvents(id wallet.ID, offset, limit int) (events []wallet.Event, err error) {
-	err = s.transaction(func(tx *txn) error {
+func (s *Store) WalletEvents(ctx context.Context, id wallet.ID, offset, limit int) (events []wallet.Event, err error) {
+	err = s.scheduledReadTransaction(ctx, walletQueryKey(id), func(tx *txn) error {
 		var dbIDs []int64
-		events, dbIDs, err = getWalletEvents(tx, id, offset, limit)
+		events, dbIDs, err = getWalletEvents(tx, id, "", offset, limit)
 		if err != nil {
 			return fmt.Errorf("failed to get wallet events: %w", err)
 		}
@@ -76,25 +82,42 @@ func (s *Store) WalletEvents(id wallet.ID, offset, limit int) (events []wallet.E
 func (s *Store) AddWallet(w wallet.Wallet) (wallet.Wallet, error) {
 	w.DateCreated = time.Now().Truncate(time.Second)
 	w.LastUpdated = time.Now().Truncate(time.Second)
+	w.Revision = 1
 
 	err := s.transaction(func(tx *txn) error {
-		const query = `INSERT INTO wallets (friendly_name, description, date_created, last_updated, extra_data) VALUES ($1, $2, $3, $4, $5) RETURNING id`
-		return tx.QueryRow(query, w.Name, w.Description, encode(w.DateCreated), encode(w.LastUpdated), w.Metadata).Scan(&w.ID)
+		const query = `INSERT INTO wallets (friendly_name, description, date_created, last_updated, extra_data, tenant, wallet_type) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		if err := tx.QueryRow(query, w.Name, w.Description, encode(w.DateCreated), encode(w.LastUpdated), w.Metadata, w.Tenant, w.Type).Scan(&w.ID); err != nil {
+			return err
+		}
+		return indexWalletMetadata(tx, w.ID, w.Metadata)
 	})
 	return w, err
 }
 
-// UpdateWallet updates a wallet in the database.
+// UpdateWallet updates a wallet in the database and increments its revision.
+// If w.Revision is non-zero, the update fails with a
+// *wallet.RevisionConflictError unless it matches the wallet's current
+// revision.
 func (s *Store) UpdateWallet(w wallet.Wallet) (wallet.Wallet, error) {
 	w.LastUpdated = time.Now()
 	err := s.transaction(func(tx *txn) error {
 		var dummyID int64
-		const query = `UPDATE wallets SET friendly_name=$1, description=$2, last_updated=$3, extra_data=$4 WHERE id=$5 RETURNING id, date_created, last_updated`
-		err := tx.QueryRow(query, w.Name, w.Description, encode(w.LastUpdated), w.Metadata, w.ID).Scan(&dummyID, decode(&w.DateCreated), decode(&w.LastUpdated))
+		const query = `UPDATE wallets SET friendly_name=$1, description=$2, last_updated=$3, extra_data=$4, revision=revision+1 WHERE id=$5 AND ($6=0 OR revision=$6) RETURNING id, date_created, last_updated, tenant, wallet_type, revision`
+		expected := w.Revision
+		err := tx.QueryRow(query, w.Name, w.Description, encode(w.LastUpdated), w.Metadata, w.ID, expected).Scan(&dummyID, decode(&w.DateCreated), decode(&w.LastUpdated), &w.Tenant, &w.Type, &w.Revision)
 		if errors.Is(err, sql.ErrNoRows) {
-			return wallet.ErrNotFound
+			var current uint64
+			err := tx.QueryRow(`SELECT revision FROM wallets WHERE id=$1`, w.ID).Scan(&current)
+			if errors.Is(err, sql.ErrNoRows) {
+				return wallet.ErrNotFound
+			} else if err != nil {
+				return fmt.Errorf("failed to get wallet revision: %w", err)
+			}
+			return &wallet.RevisionConflictError{Expected: expected, Current: current}
+		} else if err != nil {
+			return err
 		}
-		return err
+		return indexWalletMetadata(tx, w.ID, w.Metadata)
 	})
 	return w, err
 }
@@ -119,8 +142,8 @@ func (s *Store) DeleteWallet(id wallet.ID) error {
 
 // Wallets returns a map of wallet names to wallet extra data.
 func (s *Store) Wallets() (wallets []wallet.Wallet, err error) {
-	err = s.transaction(func(tx *txn) error {
-		const query = `SELECT id, friendly_name, description, date_created, last_updated, extra_data FROM wallets`
+	err = s.readTransaction(func(tx *txn) error {
+		const query = `SELECT id, friendly_name, description, date_created, last_updated, extra_data, tenant, wallet_type, revision FROM wallets`
 
 		rows, err := tx.Query(query)
 		if err != nil {
@@ -130,7 +153,7 @@ func (s *Store) Wallets() (wallets []wallet.Wallet, err error) {
 
 		for rows.Next() {
 			var w wallet.Wallet
-			if err := rows.Scan(&w.ID, &w.Name, &w.Description, decode(&w.DateCreated), decode(&w.LastUpdated), (*[]byte)(&w.Metadata)); err != nil {
+			if err := rows.Scan(&w.ID, &w.Name, &w.Description, decode(&w.DateCreated), decode(&w.LastUpdated), (*[]byte)(&w.Metadata), &w.Tenant, &w.Type, &w.Revision); err != nil {
 				return fmt.Errorf("failed to scan wallet: %w", err)
 			}
 			wallets = append(wallets, w)
@@ -140,9 +163,165 @@ func (s *Store) Wallets() (wallets []wallet.Wallet, err error) {
 	return
 }
 
-// AddWalletAddress adds an address to a wallet.
-func (s *Store) AddWalletAddress(id wallet.ID, addr wallet.Address) error {
-	return s.transaction(func(tx *txn) error {
+// FilterWallets returns a page of the wallets matching a filter and the total
+// number of matching wallets.
+func (s *Store) FilterWallets(f wallet.WalletFilter) (wallets []wallet.Wallet, total int, err error) {
+	var conditions []string
+	var args []any
+	if f.Tenant != "" {
+		args = append(args, f.Tenant)
+		conditions = append(conditions, fmt.Sprintf(`w.tenant=$%d`, len(args)))
+	}
+	if f.NamePrefix != "" {
+		// a range scan can use the name index, unlike LIKE or GLOB with
+		// user-supplied patterns
+		args = append(args, f.NamePrefix, f.NamePrefix+string(utf8.MaxRune))
+		conditions = append(conditions, fmt.Sprintf(`w.friendly_name >= $%d AND w.friendly_name < $%d`, len(args)-1, len(args)))
+	}
+	for _, mf := range f.Metadata {
+		cond, condArgs, err := metadataCondition(mf, len(args)+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		conditions = append(conditions, cond)
+		args = append(args, condArgs...)
+	}
+	var where string
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	dir := "ASC"
+	if f.Descending {
+		dir = "DESC"
+	}
+	var orderBy string
+	switch f.SortBy {
+	case "", wallet.WalletSortID, wallet.WalletSortBalance:
+		// balances are encoded, so wallets are sorted by balance after
+		// they are loaded
+		orderBy = fmt.Sprintf(`w.id %s`, dir)
+	case wallet.WalletSortName:
+		orderBy = fmt.Sprintf(`w.friendly_name %[1]s, w.id %[1]s`, dir)
+	case wallet.WalletSortCreated:
+		orderBy = fmt.Sprintf(`w.date_created %[1]s, w.id %[1]s`, dir)
+	case wallet.WalletSortLastActivity:
+		orderBy = fmt.Sprintf(`(SELECT MAX(e.date_created) FROM events e
+INNER JOIN event_addresses ea ON (e.id = ea.event_id)
+INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id)
+WHERE wa.wallet_id = w.id) %[1]s, w.id %[1]s`, dir)
+	default:
+		return nil, 0, fmt.Errorf("unknown sort order %q", f.SortBy)
+	}
+
+	limit, offset := f.Limit, f.Offset
+	if limit < 0 || f.SortBy == wallet.WalletSortBalance {
+		limit = -1
+	}
+	if f.SortBy == wallet.WalletSortBalance {
+		offset = 0
+	}
+
+	err = s.readTransaction(func(tx *txn) error {
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM wallets w`+where, args...).Scan(&total); err != nil {
+			return fmt.Errorf("failed to count wallets: %w", err)
+		}
+
+		query := `SELECT w.id, w.friendly_name, w.description, w.date_created, w.last_updated, w.extra_data, w.tenant, w.wallet_type, w.revision FROM wallets w` + where +
+			fmt.Sprintf(` ORDER BY %s LIMIT $%d OFFSET $%d`, orderBy, len(args)+1, len(args)+2)
+		rows, err := tx.Query(query, append(args, limit, offset)...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var w wallet.Wallet
+			if err := rows.Scan(&w.ID, &w.Name, &w.Description, decode(&w.DateCreated), decode(&w.LastUpdated), (*[]byte)(&w.Metadata), &w.Tenant, &w.Type, &w.Revision); err != nil {
+				return fmt.Errorf("failed to scan wallet: %w", err)
+			}
+			wallets = append(wallets, w)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		} else if f.SortBy != wallet.WalletSortBalance {
+			return nil
+		}
+
+		balances, err := walletSiacoinBalances(tx, where, args)
+		if err != nil {
+			return fmt.Errorf("failed to get wallet balances: %w", err)
+		}
+		sort.SliceStable(wallets, func(i, j int) bool {
+			a, b := wallets[i], wallets[j]
+			if f.Descending {
+				a, b = b, a
+			}
+			return balances[a.ID].Cmp(balances[b.ID]) < 0
+		})
+		return nil
+	})
+	if err != nil || f.SortBy != wallet.WalletSortBalance {
+		return
+	}
+
+	if f.Offset >= len(wallets) {
+		return nil, total, nil
+	}
+	wallets = wallets[f.Offset:]
+	if f.Limit >= 0 && f.Limit < len(wallets) {
+		wallets = wallets[:f.Limit]
+	}
+	return
+}
+
+// walletSiacoinBalances returns the confirmed siacoin balance of each wallet
+// matching the conditions.
+func walletSiacoinBalances(tx *txn, where string, args []any) (map[wallet.ID]types.Currency, error) {
+	query := `SELECT wa.wallet_id, sa.siacoin_balance FROM wallet_addresses wa
+INNER JOIN sia_addresses sa ON (wa.address_id = sa.id)
+INNER JOIN wallets w ON (wa.wallet_id = w.id)` + where
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[wallet.ID]types.Currency)
+	for rows.Next() {
+		var id wallet.ID
+		var balance types.Currency
+		if err := rows.Scan(&id, decode(&balance)); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances[id] = balances[id].Add(balance)
+	}
+	return balances, rows.Err()
+}
+
+// addressWalletIDs returns the IDs of the wallets that contain an address.
+func addressWalletIDs(tx *txn, addressID int64) ([]wallet.ID, error) {
+	rows, err := tx.Query(`SELECT wallet_id FROM wallet_addresses WHERE address_id=$1 ORDER BY wallet_id ASC`, addressID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []wallet.ID
+	for rows.Next() {
+		var id wallet.ID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan wallet ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AddWalletAddress adds an address to a wallet, reporting whether it was
+// already in the wallet or in other wallets.
+func (s *Store) AddWalletAddress(id wallet.ID, addr wallet.Address) (result wallet.AddAddressResult, err error) {
+	err = s.transaction(func(tx *txn) error {
 		if err := walletExists(tx, id); err != nil {
 			return err
 		}
@@ -152,14 +331,31 @@ func (s *Store) AddWalletAddress(id wallet.ID, addr wallet.Address) error {
 			return fmt.Errorf("failed to insert address: %w", err)
 		}
 
+		walletIDs, err := addressWalletIDs(tx, addressID)
+		if err != nil {
+			return fmt.Errorf("failed to get address wallets: %w", err)
+		}
+		result.Status = wallet.AddressAdded
+		for _, walletID := range walletIDs {
+			if walletID == id {
+				result.Status = wallet.AddressExists
+			} else {
+				result.WalletIDs = append(result.WalletIDs, walletID)
+			}
+		}
+		if result.Status == wallet.AddressAdded && len(result.WalletIDs) != 0 {
+			result.Status = wallet.AddressConflict
+		}
+
 		var encodedPolicy any
 		if addr.SpendPolicy != nil {
 			encodedPolicy = encode(*addr.SpendPolicy)
 		}
 
-		_, err = tx.Exec(`INSERT INTO wallet_addresses (wallet_id, address_id, description, spend_policy, extra_data) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (wallet_id, address_id) DO UPDATE set description=EXCLUDED.description, spend_policy=EXCLUDED.spend_policy, extra_data=EXCLUDED.extra_data`, id, addressID, addr.Description, encodedPolicy, addr.Metadata)
+		_, err = tx.Exec(`INSERT INTO wallet_addresses (wallet_id, address_id, description, spend_policy, extra_data, derivation_path) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (wallet_id, address_id) DO UPDATE set description=EXCLUDED.description, spend_policy=EXCLUDED.spend_policy, extra_data=EXCLUDED.extra_data, derivation_path=EXCLUDED.derivation_path`, id, addressID, addr.Description, encodedPolicy, addr.Metadata, addr.DerivationPath)
 		return err
 	})
+	return
 }
 
 // RemoveWalletAddress removes an address from a wallet. This does not stop tracking
@@ -178,12 +374,12 @@ func (s *Store) RemoveWalletAddress(id wallet.ID, address types.Address) error {
 
 // WalletAddresses returns a slice of addresses registered to the wallet.
 func (s *Store) WalletAddresses(id wallet.ID) (addresses []wallet.Address, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		if err := walletExists(tx, id); err != nil {
 			return err
 		}
 
-		const query = `SELECT sa.sia_address, wa.description, wa.spend_policy, wa.extra_data
+		const query = `SELECT sa.sia_address, wa.description, wa.spend_policy, wa.extra_data, wa.derivation_path
 FROM wallet_addresses wa
 INNER JOIN sia_addresses sa ON (sa.id = wa.address_id)
 WHERE wa.wallet_id=$1`
@@ -197,7 +393,7 @@ WHERE wa.wallet_id=$1`
 		for rows.Next() {
 			var address wallet.Address
 			var decodedPolicy any
-			if err := rows.Scan(decode(&address.Address), &address.Description, &decodedPolicy, (*[]byte)(&address.Metadata)); err != nil {
+			if err := rows.Scan(decode(&address.Address), &address.Description, &decodedPolicy, (*[]byte)(&address.Metadata), &address.DerivationPath); err != nil {
 				return fmt.Errorf("failed to scan address: %w", err)
 			}
 
@@ -224,7 +420,14 @@ WHERE wa.wallet_id=$1`
 
 // WalletSiacoinOutputs returns the unspent siacoin outputs for a wallet.
 func (s *Store) WalletSiacoinOutputs(id wallet.ID, index types.ChainIndex, offset, limit int) (siacoins []types.SiacoinElement, err error) {
-	err = s.transaction(func(tx *txn) error {
+	return s.WalletConfirmedSiacoinOutputs(id, index, math.MaxInt64, offset, limit)
+}
+
+// WalletImmatureSiacoinOutputs returns the unspent siacoin outputs for a
+// wallet that have not matured at the given index, ordered by maturity
+// height. Merkle proofs are not included.
+func (s *Store) WalletImmatureSiacoinOutputs(id wallet.ID, index types.ChainIndex) (siacoins []types.SiacoinElement, err error) {
+	err = s.readTransaction(func(tx *txn) error {
 		if err := walletExists(tx, id); err != nil {
 			return err
 		}
@@ -232,10 +435,43 @@ func (s *Store) WalletSiacoinOutputs(id wallet.ID, index types.ChainIndex, offse
 		const query = `SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address
 		FROM siacoin_elements se
 		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
-		WHERE se.spent_index_id IS NULL AND se.maturity_height <= $1 AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$2)
-		LIMIT $3 OFFSET $4`
+		WHERE se.spent_index_id IS NULL AND se.maturity_height > $1 AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$2)
+		ORDER BY se.maturity_height ASC`
+
+		rows, err := tx.Query(query, index.Height, id)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			siacoin, err := scanSiacoinElement(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan siacoin element: %w", err)
+			}
+			siacoins = append(siacoins, siacoin)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// WalletConfirmedSiacoinOutputs returns the unspent siacoin outputs for a
+// wallet that were created at or below maxHeight.
+func (s *Store) WalletConfirmedSiacoinOutputs(id wallet.ID, index types.ChainIndex, maxHeight uint64, offset, limit int) (siacoins []types.SiacoinElement, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		const query = `SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address
+		FROM siacoin_elements se
+		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
+		INNER JOIN chain_indices ci ON (se.chain_index_id = ci.id)
+		WHERE se.spent_index_id IS NULL AND se.maturity_height <= $1 AND ci.height <= $2 AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$3)
+		LIMIT $4 OFFSET $5`
 
-		rows, err := tx.Query(query, index.Height, id, limit, offset)
+		rows, err := tx.Query(query, index.Height, maxHeight, id, limit, offset)
 		if err != nil {
 			return err
 		}
@@ -275,7 +511,13 @@ func (s *Store) WalletSiacoinOutputs(id wallet.ID, index types.ChainIndex, offse
 
 // WalletSiafundOutputs returns the unspent siafund outputs for a wallet.
 func (s *Store) WalletSiafundOutputs(id wallet.ID, offset, limit int) (siafunds []types.SiafundElement, err error) {
-	err = s.transaction(func(tx *txn) error {
+	return s.WalletConfirmedSiafundOutputs(id, math.MaxInt64, offset, limit)
+}
+
+// WalletConfirmedSiafundOutputs returns the unspent siafund outputs for a
+// wallet that were created at or below maxHeight.
+func (s *Store) WalletConfirmedSiafundOutputs(id wallet.ID, maxHeight uint64, offset, limit int) (siafunds []types.SiafundElement, err error) {
+	err = s.readTransaction(func(tx *txn) error {
 		if err := walletExists(tx, id); err != nil {
 			return err
 		}
@@ -283,10 +525,11 @@ func (s *Store) WalletSiafundOutputs(id wallet.ID, offset, limit int) (siafunds
 		const query = `SELECT se.id, se.leaf_index, se.merkle_proof, se.siafund_value, se.claim_start, sa.sia_address 
 		FROM siafund_elements se
 		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
-		WHERE se.spent_index_id IS NULL AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$1)
-		LIMIT $2 OFFSET $3`
+		INNER JOIN chain_indices ci ON (se.chain_index_id = ci.id)
+		WHERE se.spent_index_id IS NULL AND ci.height <= $1 AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$2)
+		LIMIT $3 OFFSET $4`
 
-		rows, err := tx.Query(query, id, limit, offset)
+		rows, err := tx.Query(query, maxHeight, id, limit, offset)
 		if err != nil {
 			return err
 		}
@@ -322,9 +565,86 @@ func (s *Store) WalletSiafundOutputs(id wallet.ID, offset, limit int) (siafunds
 	return
 }
 
+// WalletOutputExport returns every unspent siacoin and siafund output of a
+// wallet, including immature outputs, with their Merkle proofs at the last
+// indexed chain index.
+func (s *Store) WalletOutputExport(ctx context.Context, id wallet.ID) (export wallet.OutputExport, err error) {
+	export.WalletID = id
+	err = s.scheduledReadTransaction(ctx, walletQueryKey(id), func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		} else if err := tx.QueryRow(`SELECT last_indexed_height, last_indexed_id FROM global_settings`).Scan(&export.Basis.Height, decode(&export.Basis.ID)); err != nil {
+			return fmt.Errorf("failed to get last indexed tip: %w", err)
+		}
+
+		rows, err := tx.Query(`SELECT se.id, se.siacoin_value, se.merkle_proof, se.leaf_index, se.maturity_height, sa.sia_address
+		FROM siacoin_elements se
+		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
+		WHERE se.spent_index_id IS NULL AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$1)
+		ORDER BY se.leaf_index ASC`, id)
+		if err != nil {
+			return fmt.Errorf("failed to query siacoin elements: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			siacoin, err := scanSiacoinElement(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan siacoin element: %w", err)
+			}
+			export.Siacoins = append(export.Siacoins, siacoin)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		rows, err = tx.Query(`SELECT se.id, se.leaf_index, se.merkle_proof, se.siafund_value, se.claim_start, sa.sia_address
+		FROM siafund_elements se
+		INNER JOIN sia_addresses sa ON (se.address_id = sa.id)
+		WHERE se.spent_index_id IS NULL AND se.address_id IN (SELECT address_id FROM wallet_addresses WHERE wallet_id=$1)
+		ORDER BY se.leaf_index ASC`, id)
+		if err != nil {
+			return fmt.Errorf("failed to query siafund elements: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			siafund, err := scanSiafundElement(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan siafund element: %w", err)
+			}
+			export.Siafunds = append(export.Siafunds, siafund)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// retrieve the merkle proofs at the last indexed tip
+		if s.indexMode == wallet.IndexModeFull {
+			indices := make([]uint64, 0, len(export.Siacoins)+len(export.Siafunds))
+			for _, se := range export.Siacoins {
+				indices = append(indices, se.StateElement.LeafIndex)
+			}
+			for _, se := range export.Siafunds {
+				indices = append(indices, se.StateElement.LeafIndex)
+			}
+			proofs, err := fillElementProofs(tx, indices)
+			if err != nil {
+				return fmt.Errorf("failed to fill element proofs: %w", err)
+			}
+			for i := range export.Siacoins {
+				export.Siacoins[i].StateElement.MerkleProof = proofs[i]
+			}
+			for i := range export.Siafunds {
+				export.Siafunds[i].StateElement.MerkleProof = proofs[len(export.Siacoins)+i]
+			}
+		}
+		return nil
+	})
+	return
+}
+
 // WalletBalance returns the total balance of a wallet.
 func (s *Store) WalletBalance(id wallet.ID) (balance wallet.Balance, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		if err := walletExists(tx, id); err != nil {
 			return err
 		}
@@ -359,7 +679,7 @@ func (s *Store) WalletBalance(id wallet.ID) (balance wallet.Balance, err error)
 // WalletUnconfirmedEvents annotates a list of unconfirmed transactions with
 // relevant addresses and siacoin/siafund elements.
 func (s *Store) WalletUnconfirmedEvents(id wallet.ID, index types.ChainIndex, timestamp time.Time, v1 []types.Transaction, v2 []types.V2Transaction) (annotated []wallet.Event, err error) {
-	err = s.transaction(func(tx *txn) error {
+	err = s.readTransaction(func(tx *txn) error {
 		if err := walletExists(tx, id); err != nil {
 			return err
 		}
@@ -655,7 +975,9 @@ func fillElementProofs(tx *txn, indices []uint64) (proofs [][]types.Hash256, _ e
 	return
 }
 
-func getWalletEvents(tx *txn, id wallet.ID, offset, limit int) (events []wallet.Event, eventIDs []int64, err error) {
+// getWalletEvents returns the events relevant to a wallet. If category is
+// not empty, only events with the category are returned.
+func getWalletEvents(tx *txn, id wallet.ID, category string, offset, limit int) (events []wallet.Event, eventIDs []int64, err error) {
 	// the events query can be slow in full index mode for wallets with no
 	// events. Check if the wallet has events first.
 	const hasEventsQuery = `SELECT EXISTS (
@@ -681,10 +1003,10 @@ event_ids AS (
 	FROM events ev
 	INNER JOIN event_addresses ea ON ev.id = ea.event_id
 	INNER JOIN wallet_addresses wa ON ea.address_id = wa.address_id
-	WHERE wa.wallet_id = $1
+	WHERE wa.wallet_id = $1 AND ($2 = '' OR EXISTS (SELECT 1 FROM event_categories ec WHERE ec.event_id = ev.id AND ec.category = $2))
 	GROUP BY ev.id
 	ORDER BY ev.maturity_height DESC, ev.id DESC
-	LIMIT $2 OFFSET $3
+	LIMIT $3 OFFSET $4
 )
 SELECT 
 	ev.id, 
@@ -705,7 +1027,7 @@ INNER JOIN chain_indices ci ON ev.chain_index_id = ci.id
 CROSS JOIN last_chain_index
 ORDER BY ev.maturity_height DESC, ev.id DESC;`
 
-	rows, err := tx.Query(eventsQuery, id, limit, offset)
+	rows, err := tx.Query(eventsQuery, id, category, limit, offset)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -735,3 +1057,328 @@ func walletExists(tx *txn, id wallet.ID) error {
 	}
 	return err
 }
+
+// WalletFees returns the fees paid by a wallet's transactions since the given
+// time, oldest first.
+func (s *Store) WalletFees(id wallet.ID, since time.Time) (entries []wallet.FeeEntry, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		const query = `SELECT DISTINCT ev.id, ev.event_id, ci.height, ci.block_id, ef.amount, ev.date_created
+FROM event_fees ef
+INNER JOIN wallet_addresses wa ON (ef.address_id = wa.address_id)
+INNER JOIN events ev ON (ef.event_id = ev.id)
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+WHERE wa.wallet_id=$1 AND ev.date_created >= $2
+ORDER BY ev.date_created ASC, ev.id ASC`
+
+		rows, err := tx.Query(query, id, encode(since))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var dbID int64
+			var entry wallet.FeeEntry
+			if err := rows.Scan(&dbID, decode(&entry.EventID), &entry.Index.Height, decode(&entry.Index.ID), decode(&entry.Amount), decode(&entry.Timestamp)); err != nil {
+				return fmt.Errorf("failed to scan fee: %w", err)
+			}
+			entries = append(entries, entry)
+		}
+		return rows.Err()
+	})
+	return
+}
+
+// WalletFeeStrategy returns the fee strategy of a wallet. The default
+// strategy is returned if the wallet does not have one.
+func (s *Store) WalletFeeStrategy(id wallet.ID) (fs wallet.FeeStrategy, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		var buf []byte
+		err := tx.QueryRow(`SELECT strategy FROM wallet_fee_strategies WHERE wallet_id=$1`, id).Scan(&buf)
+		if errors.Is(err, sql.ErrNoRows) {
+			fs = wallet.DefaultFeeStrategy
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return json.Unmarshal(buf, &fs)
+	})
+	return
+}
+
+// SetWalletFeeStrategy sets the fee strategy of a wallet.
+func (s *Store) SetWalletFeeStrategy(id wallet.ID, fs wallet.FeeStrategy) error {
+	buf, err := json.Marshal(fs)
+	if err != nil {
+		return fmt.Errorf("failed to encode fee strategy: %w", err)
+	}
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_fee_strategies (wallet_id, strategy) VALUES ($1, $2) ON CONFLICT (wallet_id) DO UPDATE SET strategy=EXCLUDED.strategy`, id, buf)
+		return err
+	})
+}
+
+// WalletMinConfirmations returns the number of confirmations an output must
+// have to be used to fund a wallet's transactions. It returns zero if the
+// wallet does not have a minimum.
+func (s *Store) WalletMinConfirmations(id wallet.ID) (n uint64, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		err := tx.QueryRow(`SELECT min_confirmations FROM wallet_min_confirmations WHERE wallet_id=$1`, id).Scan(&n)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	return
+}
+
+// SetWalletMinConfirmations sets the minimum number of confirmations of a
+// wallet's funding outputs. Zero removes the minimum.
+func (s *Store) SetWalletMinConfirmations(id wallet.ID, n uint64) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		} else if n == 0 {
+			_, err := tx.Exec(`DELETE FROM wallet_min_confirmations WHERE wallet_id=$1`, id)
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_min_confirmations (wallet_id, min_confirmations) VALUES ($1, $2) ON CONFLICT (wallet_id) DO UPDATE SET min_confirmations=EXCLUDED.min_confirmations`, id, n)
+		return err
+	})
+}
+
+// WalletSigner returns the name of the signer assigned to a wallet, or an
+// empty string if the wallet does not have one.
+func (s *Store) WalletSigner(id wallet.ID) (name string, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		err := tx.QueryRow(`SELECT signer FROM wallet_signers WHERE wallet_id=$1`, id).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	return
+}
+
+// SetWalletSigner assigns a signer to a wallet. An empty name removes the
+// wallet's signer.
+func (s *Store) SetWalletSigner(id wallet.ID, name string) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		} else if name == "" {
+			_, err := tx.Exec(`DELETE FROM wallet_signers WHERE wallet_id=$1`, id)
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_signers (wallet_id, signer) VALUES ($1, $2) ON CONFLICT (wallet_id) DO UPDATE SET signer=EXCLUDED.signer`, id, name)
+		return err
+	})
+}
+
+// WalletMetadataSchema returns the metadata schema of a wallet, or nil if the
+// wallet does not have one.
+func (s *Store) WalletMetadataSchema(id wallet.ID) (schema json.RawMessage, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		err := tx.QueryRow(`SELECT schema FROM wallet_metadata_schemas WHERE wallet_id=$1`, id).Scan((*[]byte)(&schema))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	return
+}
+
+// SetWalletMetadataSchema sets the metadata schema of a wallet. A nil schema
+// removes the wallet's schema.
+func (s *Store) SetWalletMetadataSchema(id wallet.ID, schema json.RawMessage) error {
+	return s.transaction(func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+		if schema == nil {
+			_, err := tx.Exec(`DELETE FROM wallet_metadata_schemas WHERE wallet_id=$1`, id)
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO wallet_metadata_schemas (wallet_id, schema) VALUES ($1, $2) ON CONFLICT (wallet_id) DO UPDATE SET schema=EXCLUDED.schema`, id, []byte(schema))
+		return err
+	})
+}
+
+// WalletEventFeed returns the events relevant to a wallet and the events
+// removed from the chain by reorgs, sorted by height descending.
+func (s *Store) WalletEventFeed(ctx context.Context, id wallet.ID, offset, limit int) (feed []wallet.FeedEvent, err error) {
+	err = s.scheduledReadTransaction(ctx, walletQueryKey(id), func(tx *txn) error {
+		if err := walletExists(tx, id); err != nil {
+			return err
+		}
+
+		const feedQuery = `SELECT reverted, id FROM (
+	SELECT 0 AS reverted, ev.id AS id, ev.maturity_height AS maturity_height, ci.height AS height
+	FROM events ev
+	INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+	WHERE ev.id IN (SELECT ea.event_id FROM event_addresses ea INNER JOIN wallet_addresses wa ON (ea.address_id = wa.address_id) WHERE wa.wallet_id = $1)
+	UNION ALL
+	SELECT 1, re.id, re.maturity_height, re.height
+	FROM reverted_events re
+	WHERE re.id IN (SELECT rea.event_id FROM reverted_event_addresses rea INNER JOIN wallet_addresses wa ON (rea.address_id = wa.address_id) WHERE wa.wallet_id = $1)
+)
+ORDER BY maturity_height DESC, height DESC, reverted DESC, id DESC
+LIMIT $2 OFFSET $3`
+
+		type entry struct {
+			reverted bool
+			id       int64
+		}
+		rows, err := tx.Query(feedQuery, id, limit, offset)
+		if err != nil {
+			return fmt.Errorf("failed to query feed: %w", err)
+		}
+		var entries []entry
+		for rows.Next() {
+			var e entry
+			if err := rows.Scan(&e.reverted, &e.id); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan feed entry: %w", err)
+			}
+			entries = append(entries, e)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+
+		eventStmt, err := tx.Prepare(`WITH last_chain_index AS (
+	SELECT last_indexed_height+1 AS height FROM global_settings LIMIT 1
+)
+SELECT ev.id, ev.event_id, ev.maturity_height, ev.date_created, ci.height, ci.block_id,
+	CASE
+		WHEN last_chain_index.height < ci.height THEN 0
+		ELSE last_chain_index.height - ci.height
+	END AS confirmations,
+	ev.event_type, ev.event_data
+FROM events ev
+INNER JOIN chain_indices ci ON (ev.chain_index_id = ci.id)
+CROSS JOIN last_chain_index
+WHERE ev.id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare event statement: %w", err)
+		}
+		defer eventStmt.Close()
+
+		revertedStmt, err := tx.Prepare(`SELECT ` + revertedEventColumns + ` FROM reverted_events re WHERE re.id=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare reverted event statement: %w", err)
+		}
+		defer revertedStmt.Close()
+
+		revertedAddrStmt, err := tx.Prepare(`SELECT sa.sia_address FROM reverted_event_addresses rea
+INNER JOIN sia_addresses sa ON (rea.address_id = sa.id)
+INNER JOIN wallet_addresses wa ON (rea.address_id = wa.address_id)
+WHERE wa.wallet_id=$1 AND rea.event_id=$2`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare reverted address statement: %w", err)
+		}
+		defer revertedAddrStmt.Close()
+
+		replacedStmt, err := tx.Prepare(`SELECT block_id FROM chain_indices WHERE height=$1`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare chain index statement: %w", err)
+		}
+		defer replacedStmt.Close()
+
+		var eventIDs []int64
+		for _, e := range entries {
+			if e.reverted {
+				continue
+			}
+			eventIDs = append(eventIDs, e.id)
+		}
+		relevant, err := s.getWalletEventRelevantAddresses(tx, id, eventIDs)
+		if err != nil {
+			return fmt.Errorf("failed to get relevant addresses: %w", err)
+		}
+
+		feed = make([]wallet.FeedEvent, 0, len(entries))
+		for _, e := range entries {
+			if !e.reverted {
+				event, _, err := scanEvent(eventStmt.QueryRow(e.id))
+				if err != nil {
+					return fmt.Errorf("failed to get event %d: %w", e.id, err)
+				}
+				event.Relevant = relevant[e.id]
+				feed = append(feed, wallet.FeedEvent{Event: event})
+				continue
+			}
+
+			event, _, err := scanEvent(revertedStmt.QueryRow(e.id))
+			if err != nil {
+				return fmt.Errorf("failed to get reverted event %d: %w", e.id, err)
+			}
+			addrRows, err := revertedAddrStmt.Query(id, e.id)
+			if err != nil {
+				return fmt.Errorf("failed to query relevant addresses: %w", err)
+			}
+			for addrRows.Next() {
+				var addr types.Address
+				if err := addrRows.Scan(decode(&addr)); err != nil {
+					addrRows.Close()
+					return fmt.Errorf("failed to scan relevant address: %w", err)
+				}
+				event.Relevant = append(event.Relevant, addr)
+			}
+			if err := addrRows.Err(); err != nil {
+				addrRows.Close()
+				return err
+			}
+			addrRows.Close()
+
+			fe := wallet.FeedEvent{Event: event, Reverted: true}
+			// the block at the event's height on the current chain, if
+			// the chain has reached it again
+			var blockID types.BlockID
+			err = replacedStmt.QueryRow(event.Index.Height).Scan(decode(&blockID))
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("failed to get replacing chain index: %w", err)
+			} else if err == nil && blockID != event.Index.ID {
+				fe.ReplacedBy = &types.ChainIndex{ID: blockID, Height: event.Index.Height}
+			}
+			feed = append(feed, fe)
+		}
+		return nil
+	})
+	return
+}
+
+// WalletType returns the type of a wallet.
+func (s *Store) WalletType(id wallet.ID) (walletType string, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		err := tx.QueryRow(`SELECT wallet_type FROM wallets WHERE id=$1`, id).Scan(&walletType)
+		if errors.Is(err, sql.ErrNoRows) {
+			return wallet.ErrNotFound
+		}
+		return err
+	})
+	return
+}
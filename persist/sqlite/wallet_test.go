@@ -0,0 +1,455 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/digest"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestUpdateWalletRevision(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	} else if w.Revision != 1 {
+		t.Fatalf("expected revision 1, got %d", w.Revision)
+	}
+
+	// two operators edit the same revision
+	first, second := w, w
+	first.Name = "first"
+	second.Name = "second"
+
+	updated, err := db.UpdateWallet(first)
+	if err != nil {
+		t.Fatal(err)
+	} else if updated.Revision != 2 {
+		t.Fatalf("expected revision 2, got %d", updated.Revision)
+	}
+
+	var ce *wallet.RevisionConflictError
+	if _, err := db.UpdateWallet(second); !errors.As(err, &ce) {
+		t.Fatalf("expected revision conflict, got %v", err)
+	} else if ce.Expected != 1 || ce.Current != 2 {
+		t.Fatalf("expected conflict between revisions 1 and 2, got %d and %d", ce.Expected, ce.Current)
+	}
+
+	wallets, err := db.Wallets()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(wallets) != 1 || wallets[0].Name != "first" || wallets[0].Revision != 2 {
+		t.Fatalf("unexpected wallets: %+v", wallets)
+	}
+
+	// an update without a revision always applies
+	second.Revision = 0
+	if updated, err := db.UpdateWallet(second); err != nil {
+		t.Fatal(err)
+	} else if updated.Name != "second" || updated.Revision != 3 {
+		t.Fatalf("unexpected wallet: %+v", updated)
+	}
+
+	if _, err := db.UpdateWallet(wallet.Wallet{ID: 100, Revision: 1}); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWalletOutputExport(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "audited"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	other := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	basis := types.ChainIndex{Height: 10, ID: types.BlockID{10}}
+	proof := []types.Hash256{{1}, {2}}
+	err = db.transaction(func(tx *txn) error {
+		if _, err := tx.Exec(`UPDATE global_settings SET last_indexed_height=$1, last_indexed_id=$2`, basis.Height, encode(basis.ID)); err != nil {
+			return err
+		}
+		var indexID int64
+		if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(basis.ID), basis.Height).Scan(&indexID); err != nil {
+			return err
+		}
+		addrID, err := insertAddress(tx, addr)
+		if err != nil {
+			return err
+		}
+		otherID, err := insertAddress(tx, other)
+		if err != nil {
+			return err
+		}
+		for i, o := range []struct {
+			addressID int64
+			maturity  uint64
+			spent     any
+		}{
+			{addrID, 0, nil},
+			{addrID, 100, nil},   // immature
+			{addrID, 0, indexID}, // spent
+			{otherID, 0, nil},    // not in the wallet
+		} {
+			const query = `INSERT INTO siacoin_elements (id, siacoin_value, merkle_proof, leaf_index, maturity_height, address_id, matured, chain_index_id, spent_index_id) VALUES ($1, $2, $3, $4, $5, $6, true, $7, $8)`
+			if _, err := tx.Exec(query, encode(types.SiacoinOutputID{byte(i + 1)}), encode(types.Siacoins(uint32(i+1))), encode(proof), i, o.maturity, o.addressID, indexID, o.spent); err != nil {
+				return err
+			}
+		}
+		const query = `INSERT INTO siafund_elements (id, claim_start, merkle_proof, leaf_index, siafund_value, address_id, chain_index_id) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		_, err = tx.Exec(query, encode(types.SiafundOutputID{1}), encode(types.ZeroCurrency), encode(proof), 10, 5, addrID, indexID)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := db.WalletOutputExport(context.Background(), w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if export.Basis != basis {
+		t.Fatalf("expected basis %v, got %v", basis, export.Basis)
+	} else if len(export.Siacoins) != 2 {
+		t.Fatalf("expected 2 siacoin elements, got %d", len(export.Siacoins))
+	} else if export.Siacoins[0].ID != (types.SiacoinOutputID{1}) || export.Siacoins[1].ID != (types.SiacoinOutputID{2}) {
+		t.Fatalf("unexpected siacoin elements %v", export.Siacoins)
+	} else if len(export.Siacoins[1].StateElement.MerkleProof) != len(proof) {
+		t.Fatal("expected the merkle proof to be exported")
+	} else if len(export.Siafunds) != 1 || export.Siafunds[0].SiafundOutput.Value != 5 {
+		t.Fatalf("unexpected siafund elements %v", export.Siafunds)
+	}
+
+	if _, err := db.WalletOutputExport(context.Background(), w.ID+1); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWalletConfirmedOutputs(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "withdrawals"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	// create an output of each type at heights 5 and 10
+	tip := types.ChainIndex{Height: 10, ID: types.BlockID{10}}
+	err = db.transaction(func(tx *txn) error {
+		addrID, err := insertAddress(tx, addr)
+		if err != nil {
+			return err
+		}
+		for i, height := range []uint64{5, 10} {
+			var indexID int64
+			if err := tx.QueryRow(`INSERT INTO chain_indices (block_id, height) VALUES ($1, $2) RETURNING id`, encode(types.BlockID{byte(height)}), height).Scan(&indexID); err != nil {
+				return err
+			}
+			const scQuery = `INSERT INTO siacoin_elements (id, siacoin_value, merkle_proof, leaf_index, maturity_height, address_id, matured, chain_index_id) VALUES ($1, $2, $3, $4, 0, $5, true, $6)`
+			if _, err := tx.Exec(scQuery, encode(types.SiacoinOutputID{byte(height)}), encode(types.Siacoins(1)), encode([]types.Hash256{}), i, addrID, indexID); err != nil {
+				return err
+			}
+			const sfQuery = `INSERT INTO siafund_elements (id, claim_start, merkle_proof, leaf_index, siafund_value, address_id, chain_index_id) VALUES ($1, $2, $3, $4, 1, $5, $6)`
+			if _, err := tx.Exec(sfQuery, encode(types.SiafundOutputID{byte(height)}), encode(types.ZeroCurrency), encode([]types.Hash256{}), 10+i, addrID, indexID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		maxHeight uint64
+		outputs   int
+	}{
+		{4, 0},
+		{5, 1},
+		{9, 1},
+		{10, 2},
+	} {
+		if scos, err := db.WalletConfirmedSiacoinOutputs(w.ID, tip, test.maxHeight, 0, 100); err != nil {
+			t.Fatal(err)
+		} else if len(scos) != test.outputs {
+			t.Fatalf("max height %d: expected %d wallet siacoin outputs, got %d", test.maxHeight, test.outputs, len(scos))
+		} else if len(scos) == 1 && scos[0].ID != (types.SiacoinOutputID{5}) {
+			t.Fatalf("expected output created at height 5, got %v", scos[0].ID)
+		}
+		if sfos, err := db.WalletConfirmedSiafundOutputs(w.ID, test.maxHeight, 0, 100); err != nil {
+			t.Fatal(err)
+		} else if len(sfos) != test.outputs {
+			t.Fatalf("max height %d: expected %d wallet siafund outputs, got %d", test.maxHeight, test.outputs, len(sfos))
+		}
+		if scos, err := db.AddressConfirmedSiacoinOutputs(addr, tip, test.maxHeight, 0, 100); err != nil {
+			t.Fatal(err)
+		} else if len(scos) != test.outputs {
+			t.Fatalf("max height %d: expected %d address siacoin outputs, got %d", test.maxHeight, test.outputs, len(scos))
+		}
+		if sfos, err := db.AddressConfirmedSiafundOutputs(addr, test.maxHeight, 0, 100); err != nil {
+			t.Fatal(err)
+		} else if len(sfos) != test.outputs {
+			t.Fatalf("max height %d: expected %d address siafund outputs, got %d", test.maxHeight, test.outputs, len(sfos))
+		}
+	}
+
+	// the unfiltered queries are unchanged
+	if scos, err := db.WalletSiacoinOutputs(w.ID, tip, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(scos) != 2 {
+		t.Fatalf("expected 2 siacoin outputs, got %d", len(scos))
+	}
+
+	if n, err := db.WalletMinConfirmations(w.ID); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected no minimum, got %d", n)
+	} else if err := db.SetWalletMinConfirmations(w.ID, 6); err != nil {
+		t.Fatal(err)
+	} else if n, err := db.WalletMinConfirmations(w.ID); err != nil {
+		t.Fatal(err)
+	} else if n != 6 {
+		t.Fatalf("expected 6 confirmations, got %d", n)
+	} else if err := db.SetWalletMinConfirmations(w.ID, 0); err != nil {
+		t.Fatal(err)
+	} else if n, err := db.WalletMinConfirmations(w.ID); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected minimum to be removed, got %d", n)
+	} else if err := db.SetWalletMinConfirmations(w.ID+1, 6); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestAddressWallets(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hot, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold, err := db.AddWallet(wallet.Wallet{Name: "cold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hotAddr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	coldAddr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	sharedAddr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	for _, wa := range []struct {
+		id   wallet.ID
+		addr types.Address
+	}{{hot.ID, hotAddr}, {cold.ID, coldAddr}, {cold.ID, sharedAddr}, {hot.ID, sharedAddr}} {
+		if _, err := db.AddWalletAddress(wa.id, wallet.Address{Address: wa.addr}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	external := types.Address{1}
+	owners, err := db.AddressWallets([]types.Address{hotAddr, coldAddr, sharedAddr, external, hotAddr})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(owners) != 3 {
+		t.Fatalf("expected 3 owned addresses, got %v", owners)
+	} else if owners[hotAddr] != hot.ID || owners[coldAddr] != cold.ID || owners[sharedAddr] != hot.ID {
+		t.Fatalf("unexpected owners %v", owners)
+	} else if _, ok := owners[external]; ok {
+		t.Fatal("expected external address to be omitted")
+	}
+}
+
+func TestWalletDigests(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.WalletDigest(w.ID); !errors.Is(err, digest.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if err := db.RemoveWalletDigest(w.ID); !errors.Is(err, digest.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if err := db.SetWalletDigest(digest.Schedule{WalletID: w.ID + 1, Frequency: digest.FrequencyDaily}); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected wallet.ErrNotFound, got %v", err)
+	}
+
+	period := time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)
+	if err := db.SetWalletDigest(digest.Schedule{WalletID: w.ID, Frequency: digest.FrequencyDaily, LastPeriod: period}); err != nil {
+		t.Fatal(err)
+	} else if err := db.SetWalletDigest(digest.Schedule{WalletID: w.ID, Frequency: digest.FrequencyWeekly, LastPeriod: period}); err != nil {
+		t.Fatal(err)
+	}
+	if sched, err := db.WalletDigest(w.ID); err != nil {
+		t.Fatal(err)
+	} else if sched.Frequency != digest.FrequencyWeekly || !sched.LastPeriod.Equal(period) {
+		t.Fatalf("unexpected schedule %+v", sched)
+	} else if schedules, err := db.WalletDigests(); err != nil {
+		t.Fatal(err)
+	} else if len(schedules) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(schedules))
+	}
+
+	// addresses without events were never used
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	} else if addrs, err := db.WalletAddressesFirstUsed(w.ID, time.Time{}, time.Now()); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 0 {
+		t.Fatalf("expected no new addresses, got %v", addrs)
+	}
+
+	if err := db.RemoveWalletDigest(w.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.WalletDigest(w.ID); !errors.Is(err, digest.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestBalanceAlarms(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	low, high := types.Siacoins(10), types.Siacoins(100)
+	other := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddBalanceAlarm(wallet.BalanceAlarm{WalletID: w.ID, Address: &other, Low: &low, State: wallet.AlarmStateOK}); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	walletAlarm, err := db.AddBalanceAlarm(wallet.BalanceAlarm{WalletID: w.ID, Low: &low, State: wallet.AlarmStateOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrAlarm, err := db.AddBalanceAlarm(wallet.BalanceAlarm{WalletID: w.ID, Address: &addr, High: &high, State: wallet.AlarmStateOK})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	triggered := time.Date(2024, 5, 13, 12, 0, 0, 0, time.UTC)
+	if err := db.UpdateBalanceAlarmState(addrAlarm.ID, wallet.AlarmStateHigh, triggered); err != nil {
+		t.Fatal(err)
+	}
+	alarms, err := db.WalletBalanceAlarms(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(alarms) != 2 {
+		t.Fatalf("expected 2 alarms, got %d", len(alarms))
+	}
+	if a := alarms[0]; a.ID != walletAlarm.ID || a.Address != nil || a.Low == nil || !a.Low.Equals(low) || a.High != nil {
+		t.Fatalf("unexpected wallet alarm %+v", a)
+	} else if a := alarms[1]; a.Address == nil || *a.Address != addr || a.Low != nil || !a.High.Equals(high) || a.State != wallet.AlarmStateHigh || !a.DateTriggered.Equal(triggered) {
+		t.Fatalf("unexpected address alarm %+v", a)
+	}
+
+	if err := db.RemoveBalanceAlarm(w.ID+1, walletAlarm.ID); !errors.Is(err, wallet.ErrAlarmNotFound) {
+		t.Fatalf("expected ErrAlarmNotFound, got %v", err)
+	} else if err := db.RemoveBalanceAlarm(w.ID, walletAlarm.ID); err != nil {
+		t.Fatal(err)
+	} else if alarms, err := db.BalanceAlarms(); err != nil {
+		t.Fatal(err)
+	} else if len(alarms) != 1 || alarms[0].ID != addrAlarm.ID {
+		t.Fatalf("unexpected alarms %+v", alarms)
+	}
+}
+
+func TestAddWalletAddressResult(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w1, err := db.AddWallet(wallet.Wallet{Name: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := db.AddWallet(wallet.Wallet{Name: "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if res, err := db.AddWalletAddress(w1.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	} else if res.Status != wallet.AddressAdded || len(res.WalletIDs) != 0 {
+		t.Fatalf("expected address to be added, got %+v", res)
+	}
+
+	// adding the address again updates it
+	if res, err := db.AddWalletAddress(w1.ID, wallet.Address{Address: addr, Description: "updated"}); err != nil {
+		t.Fatal(err)
+	} else if res.Status != wallet.AddressExists || len(res.WalletIDs) != 0 {
+		t.Fatalf("expected address to exist, got %+v", res)
+	} else if addrs, err := db.WalletAddresses(w1.ID); err != nil {
+		t.Fatal(err)
+	} else if len(addrs) != 1 || addrs[0].Description != "updated" {
+		t.Fatalf("expected updated address, got %+v", addrs)
+	}
+
+	// adding the address to another wallet reports the conflict
+	if res, err := db.AddWalletAddress(w2.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	} else if res.Status != wallet.AddressConflict || len(res.WalletIDs) != 1 || res.WalletIDs[0] != w1.ID {
+		t.Fatalf("expected conflict with wallet %v, got %+v", w1.ID, res)
+	} else if res, err := db.AddWalletAddress(w1.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	} else if res.Status != wallet.AddressExists || len(res.WalletIDs) != 1 || res.WalletIDs[0] != w2.ID {
+		t.Fatalf("expected address to exist and be shared with wallet %v, got %+v", w2.ID, res)
+	}
+
+	if _, err := db.AddWalletAddress(100, wallet.Address{Address: addr}); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
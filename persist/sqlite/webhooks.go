@@ -0,0 +1,69 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.thebigfile.com/walletd/webhooks"
+)
+
+// AddWebhook adds a webhook to the database.
+func (s *Store) AddWebhook(hook webhooks.Webhook) (webhooks.Webhook, error) {
+	err := s.transaction(func(tx *txn) error {
+		const query = `INSERT INTO webhooks (callback_url, scopes, secret_key, date_created, tenant) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+		return tx.QueryRow(query, hook.CallbackURL, strings.Join(hook.Scopes, ","), hook.SecretKey, encode(hook.DateCreated), hook.Tenant).Scan(&hook.ID)
+	})
+	return hook, err
+}
+
+// UpdateWebhookScopes replaces the scopes of a webhook.
+func (s *Store) UpdateWebhookScopes(id int64, scopes []string) error {
+	return s.transaction(func(tx *txn) error {
+		res, err := tx.Exec(`UPDATE webhooks SET scopes=$1 WHERE id=$2`, strings.Join(scopes, ","), id)
+		if err != nil {
+			return err
+		} else if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return webhooks.ErrNotFound
+		}
+		return nil
+	})
+}
+
+// RemoveWebhook removes a webhook from the database.
+func (s *Store) RemoveWebhook(id int64) error {
+	return s.transaction(func(tx *txn) error {
+		var dummyID int64
+		err := tx.QueryRow(`DELETE FROM webhooks WHERE id=$1 RETURNING id`, id).Scan(&dummyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return webhooks.ErrNotFound
+		}
+		return err
+	})
+}
+
+// Webhooks returns all webhooks in the database.
+func (s *Store) Webhooks() (hooks []webhooks.Webhook, err error) {
+	err = s.readTransaction(func(tx *txn) error {
+		rows, err := tx.Query(`SELECT id, callback_url, scopes, secret_key, date_created, tenant FROM webhooks`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var hook webhooks.Webhook
+			var scopes string
+			if err := rows.Scan(&hook.ID, &hook.CallbackURL, &scopes, &hook.SecretKey, decode(&hook.DateCreated), &hook.Tenant); err != nil {
+				return fmt.Errorf("failed to scan webhook: %w", err)
+			}
+			hook.Scopes = strings.Split(scopes, ",")
+			hooks = append(hooks, hook)
+		}
+		return rows.Err()
+	})
+	return
+}
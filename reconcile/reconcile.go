@@ -0,0 +1,164 @@
+// Package reconcile matches the entries of an external ledger against the
+// events of a wallet.
+package reconcile
+
+import (
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// Directions of an entry.
+const (
+	// DirectionIn is an entry that increased the wallet's balance.
+	DirectionIn = "in"
+	// DirectionOut is an entry that decreased the wallet's balance,
+	// including the miner fee.
+	DirectionOut = "out"
+)
+
+type (
+	// An Entry is an expected movement of siacoins recorded by an external
+	// ledger.
+	Entry struct {
+		// Reference identifies the entry in the external ledger.
+		Reference string `json:"reference"`
+		// EventID, if set, matches the entry only to the event with the
+		// ID. Otherwise, the entry is matched to the earliest unmatched
+		// event with the same direction and amount.
+		EventID *types.Hash256 `json:"eventID,omitempty"`
+		// Height, if set, only matches events confirmed at the height.
+		Height    *uint64        `json:"height,omitempty"`
+		Direction string         `json:"direction"`
+		Amount    types.Currency `json:"amount"`
+	}
+
+	// A Match pairs an entry with the event it matched.
+	Match struct {
+		Entry Entry        `json:"entry"`
+		Event wallet.Event `json:"event"`
+	}
+
+	// A Discrepancy is an entry that matched an event by ID, but whose
+	// direction or amount differs from the event's.
+	Discrepancy struct {
+		Entry     Entry          `json:"entry"`
+		Event     wallet.Event   `json:"event"`
+		Direction string         `json:"direction"`
+		Amount    types.Currency `json:"amount"`
+	}
+
+	// A Result is the outcome of reconciling a ledger against a wallet's
+	// events.
+	Result struct {
+		Matched []Match `json:"matched"`
+		// Mismatched are entries that name an event whose net flow does
+		// not match them.
+		Mismatched []Discrepancy `json:"mismatched"`
+		// Missing are entries without a matching event.
+		Missing []Entry `json:"missing"`
+		// Unexpected are events without a matching entry.
+		Unexpected []wallet.Event `json:"unexpected"`
+	}
+)
+
+// NetFlow returns the direction and amount of the net change in the balance
+// of an event's relevant addresses. Change returned to them is netted out.
+func NetFlow(ev wallet.Event) (string, types.Currency) {
+	inflow, outflow := wallet.EventFlows(ev)
+	if inflow.Cmp(outflow) >= 0 {
+		return DirectionIn, inflow.Sub(outflow)
+	}
+	return DirectionOut, outflow.Sub(inflow)
+}
+
+// Validate checks that the entries have a valid direction and unique
+// references and event IDs.
+func Validate(entries []Entry) error {
+	references := make(map[string]bool)
+	eventIDs := make(map[types.Hash256]bool)
+	for i, e := range entries {
+		if e.Direction != DirectionIn && e.Direction != DirectionOut {
+			return fmt.Errorf("entry %d: direction must be %q or %q", i, DirectionIn, DirectionOut)
+		} else if e.Reference != "" && references[e.Reference] {
+			return fmt.Errorf("entry %d: duplicate reference %q", i, e.Reference)
+		} else if e.EventID != nil && eventIDs[*e.EventID] {
+			return fmt.Errorf("entry %d: duplicate event ID %v", i, *e.EventID)
+		} else if e.EventID == nil && e.Amount.IsZero() {
+			return fmt.Errorf("entry %d: entries without an event ID must have a non-zero amount", i)
+		}
+		references[e.Reference] = true
+		if e.EventID != nil {
+			eventIDs[*e.EventID] = true
+		}
+	}
+	return nil
+}
+
+// Reconcile matches the entries against the events. Entries with an event ID
+// are matched first. The remaining entries are matched in order to the
+// earliest unmatched event with the same direction and amount. The events
+// must be sorted by height.
+func Reconcile(entries []Entry, events []wallet.Event) Result {
+	type flow struct {
+		direction string
+		amount    types.Currency
+	}
+	flows := make([]flow, len(events))
+	index := make(map[types.Hash256]int, len(events))
+	for i, ev := range events {
+		flows[i].direction, flows[i].amount = NetFlow(ev)
+		index[ev.ID] = i
+	}
+
+	res := Result{
+		Matched:    []Match{},
+		Mismatched: []Discrepancy{},
+		Missing:    []Entry{},
+		Unexpected: []wallet.Event{},
+	}
+	matched := make([]bool, len(events))
+	var unmatched []Entry
+	for _, e := range entries {
+		if e.EventID == nil {
+			unmatched = append(unmatched, e)
+			continue
+		}
+		i, ok := index[*e.EventID]
+		if !ok || (e.Height != nil && events[i].Index.Height != *e.Height) {
+			res.Missing = append(res.Missing, e)
+			continue
+		}
+		matched[i] = true
+		if f := flows[i]; f.direction != e.Direction || !f.amount.Equals(e.Amount) {
+			res.Mismatched = append(res.Mismatched, Discrepancy{Entry: e, Event: events[i], Direction: f.direction, Amount: f.amount})
+			continue
+		}
+		res.Matched = append(res.Matched, Match{Entry: e, Event: events[i]})
+	}
+
+	for _, e := range unmatched {
+		found := false
+		for i, f := range flows {
+			if matched[i] || f.direction != e.Direction || !f.amount.Equals(e.Amount) {
+				continue
+			} else if e.Height != nil && events[i].Index.Height != *e.Height {
+				continue
+			}
+			matched[i], found = true, true
+			res.Matched = append(res.Matched, Match{Entry: e, Event: events[i]})
+			break
+		}
+		if !found {
+			res.Missing = append(res.Missing, e)
+		}
+	}
+
+	for i, ev := range events {
+		if !matched[i] {
+			res.Unexpected = append(res.Unexpected, ev)
+		}
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package reconcile
+
+import (
+	"testing"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+func TestReconcile(t *testing.T) {
+	addr := types.Address{1}
+	payout := func(id byte, height uint64, value types.Currency) wallet.Event {
+		return wallet.Event{
+			ID:       types.Hash256{id},
+			Index:    types.ChainIndex{Height: height},
+			Relevant: []types.Address{addr},
+			Data:     wallet.EventPayout{SiacoinElement: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: value}}},
+		}
+	}
+	send := wallet.Event{
+		ID:       types.Hash256{3},
+		Index:    types.ChainIndex{Height: 12},
+		Relevant: []types.Address{addr},
+		Data: wallet.EventV1Transaction{
+			Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Address: types.Address{2}, Value: types.Siacoins(4)},
+					{Address: addr, Value: types.Siacoins(6)},
+				},
+			},
+			SpentSiacoinElements: []types.SiacoinElement{{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(10)}}},
+		},
+	}
+	events := []wallet.Event{
+		payout(1, 10, types.Siacoins(5)),
+		payout(2, 11, types.Siacoins(5)),
+		send,
+		payout(4, 13, types.Siacoins(7)),
+	}
+
+	if dir, amount := NetFlow(send); dir != DirectionOut || !amount.Equals(types.Siacoins(4)) {
+		t.Fatalf("expected net outflow of %v, got %v %v", types.Siacoins(4), dir, amount)
+	}
+
+	height := uint64(11)
+	entries := []Entry{
+		{Reference: "a", Direction: DirectionIn, Amount: types.Siacoins(5), Height: &height},
+		{Reference: "b", Direction: DirectionIn, Amount: types.Siacoins(5)},
+		{Reference: "c", Direction: DirectionOut, Amount: types.Siacoins(4), EventID: &send.ID},
+		{Reference: "d", Direction: DirectionIn, Amount: types.Siacoins(5)},
+		{Reference: "e", Direction: DirectionIn, Amount: types.Siacoins(8), EventID: &events[3].ID},
+	}
+	if err := Validate(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	res := Reconcile(entries, events)
+	if len(res.Matched) != 3 {
+		t.Fatalf("expected 3 matches, got %d", len(res.Matched))
+	}
+	// entries with an event ID are matched first
+	for i, want := range []struct {
+		ref string
+		id  types.Hash256
+	}{{"c", send.ID}, {"a", events[1].ID}, {"b", events[0].ID}} {
+		if m := res.Matched[i]; m.Entry.Reference != want.ref || m.Event.ID != want.id {
+			t.Fatalf("match %d: expected %q to match %v, got %q and %v", i, want.ref, want.id, m.Entry.Reference, m.Event.ID)
+		}
+	}
+	if len(res.Mismatched) != 1 || res.Mismatched[0].Entry.Reference != "e" || !res.Mismatched[0].Amount.Equals(types.Siacoins(7)) {
+		t.Fatalf("expected entry e to be mismatched, got %+v", res.Mismatched)
+	} else if len(res.Missing) != 1 || res.Missing[0].Reference != "d" {
+		t.Fatalf("expected entry d to be missing, got %+v", res.Missing)
+	} else if len(res.Unexpected) != 0 {
+		t.Fatalf("expected no unexpected events, got %d", len(res.Unexpected))
+	}
+
+	// without entries, every event is unexpected
+	if res := Reconcile(nil, events); len(res.Unexpected) != len(events) {
+		t.Fatalf("expected %d unexpected events, got %d", len(events), len(res.Unexpected))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	id := types.Hash256{1}
+	tests := []struct {
+		entries []Entry
+		valid   bool
+	}{
+		{[]Entry{{Direction: DirectionIn, Amount: types.Siacoins(1)}}, true},
+		{[]Entry{{Direction: DirectionOut, EventID: &id}}, true},
+		{[]Entry{{Direction: "sideways", Amount: types.Siacoins(1)}}, false},
+		{[]Entry{{Direction: DirectionIn}}, false},
+		{[]Entry{{Reference: "a", Direction: DirectionIn, Amount: types.Siacoins(1)}, {Reference: "a", Direction: DirectionIn, Amount: types.Siacoins(1)}}, false},
+		{[]Entry{{Direction: DirectionIn, EventID: &id}, {Direction: DirectionOut, EventID: &id}}, false},
+	}
+	for i, test := range tests {
+		if err := Validate(test.entries); (err == nil) != test.valid {
+			t.Fatalf("test %d: expected valid=%v, got %v", i, test.valid, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package rotation
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send rotation events to
+// webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithSigner sets the signer used to sign sweeps of wallets with an external
+// signer. Sweeps of other wallets must be signed by the client.
+func WithSigner(s Signer) Option {
+	return func(m *Manager) {
+		m.signer = s
+	}
+}
+
+// WithTreasuryManager checks signed sweeps against the spending policy of the
+// rotated wallet. Sweeps that violate the policy are not recorded and their
+// inputs are released, and sweeps that require approval are added to the
+// approval queue.
+func WithTreasuryManager(tm TreasuryManager) Option {
+	return func(m *Manager) {
+		m.tm = tm
+	}
+}
+
+// WithInterval sets how often active rotations are swept. The default is ten
+// minutes.
+func WithInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.interval = d
+		}
+	}
+}
+
+// WithAddresses sets the default number of addresses derived from a
+// rotation's new seed. The default is 20.
+func WithAddresses(n int) Option {
+	return func(m *Manager) {
+		m.addresses = n
+	}
+}
+
+// WithMaxInputs sets the default maximum number of inputs in a sweep. The
+// default is 100.
+func WithMaxInputs(n int) Option {
+	return func(m *Manager) {
+		m.maxInputs = n
+	}
+}
+
+// WithReserveDuration sets how long a sweep's inputs are reserved. Unsigned
+// sweeps must be signed and broadcast within this time. The default is
+// three hours.
+func WithReserveDuration(d time.Duration) Option {
+	return func(m *Manager) {
+		m.reserveDuration = d
+	}
+}
+
+// WithScheduler registers the sweep of rotated-out addresses as the
+// "rotation" job.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
@@ -0,0 +1,546 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/internal/sweeper"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ScopeRotations is the webhook scope of key rotation events.
+const ScopeRotations = "rotations"
+
+// Rotation statuses.
+const (
+	StatusActive    = "active"
+	StatusComplete  = "complete"
+	StatusCancelled = "cancelled"
+)
+
+// Statuses of a rotation sweep. Unsigned sweeps are sent to webhooks to be
+// signed with the old seed and broadcast by the client.
+const (
+	SweepUnsigned  = sweeper.StatusUnsigned
+	SweepBroadcast = sweeper.StatusBroadcast
+	SweepPending   = sweeper.StatusPending
+)
+
+var (
+	// ErrNotFound is returned when a rotation is not found.
+	ErrNotFound = errors.New("rotation not found")
+	// ErrActive is returned when starting a rotation for a wallet that
+	// already has an active rotation.
+	ErrActive = errors.New("wallet already has an active rotation")
+	// ErrNotActive is returned when sweeping or cancelling a rotation that
+	// is complete or cancelled.
+	ErrNotActive = errors.New("rotation is not active")
+	// ErrNoAddresses is returned when rotating a wallet without
+	// addresses.
+	ErrNoAddresses = errors.New("wallet has no addresses to rotate")
+	// ErrNothingToSweep is returned when none of the rotated addresses
+	// have outputs worth sweeping.
+	ErrNothingToSweep = errors.New("no outputs to sweep")
+	// ErrFeeRateTooHigh is returned when the wallet's fee rate exceeds the
+	// rotation's maximum fee rate.
+	ErrFeeRateTooHigh = errors.New("fee rate exceeds rotation maximum")
+)
+
+type (
+	// A Rotation moves a wallet's funds from its existing addresses to
+	// addresses derived from a new seed. The old addresses are swept in
+	// batches until none of them have outputs worth sweeping.
+	Rotation struct {
+		ID           int64           `json:"id"`
+		WalletID     wallet.ID       `json:"walletID"`
+		Status       string          `json:"status"`
+		OldAddresses []types.Address `json:"oldAddresses"`
+		NewAddresses []types.Address `json:"newAddresses"`
+		// MaxFeeRate delays sweeps while the wallet's fee rate is higher.
+		// A zero value sweeps at any fee rate.
+		MaxFeeRate types.Currency `json:"maxFeeRate"`
+		MaxInputs  int            `json:"maxInputs"`
+
+		Sweeps int            `json:"sweeps"`
+		Swept  types.Currency `json:"swept"`
+		Fees   types.Currency `json:"fees"`
+
+		// RemainingOutputs and Remaining are the number and value of the
+		// unspent outputs still held by the old addresses. They are
+		// computed when the rotation is retrieved.
+		RemainingOutputs int            `json:"remainingOutputs"`
+		Remaining        types.Currency `json:"remaining"`
+
+		DateCreated   time.Time `json:"dateCreated"`
+		LastSweep     time.Time `json:"lastSweep"`
+		DateCompleted time.Time `json:"dateCompleted"`
+	}
+
+	// A Sweep is a transaction moving outputs from a rotation's old
+	// addresses to one of its new addresses.
+	Sweep struct {
+		ID          int64               `json:"id"`
+		RotationID  int64               `json:"rotationID"`
+		WalletID    wallet.ID           `json:"walletID"`
+		Status      string              `json:"status"`
+		Basis       types.ChainIndex    `json:"basis"`
+		Transaction types.V2Transaction `json:"transaction"`
+		Value       types.Currency      `json:"value"`
+		Fee         types.Currency      `json:"fee"`
+		DateCreated time.Time           `json:"dateCreated"`
+	}
+
+	// A Store persists rotations and their sweeps.
+	Store interface {
+		AddRotation(Rotation) (Rotation, error)
+		UpdateRotation(Rotation) error
+		// WalletRotations returns a wallet's rotations, newest first.
+		WalletRotations(walletID wallet.ID) ([]Rotation, error)
+		WalletRotation(walletID wallet.ID, id int64) (Rotation, error)
+		// ActiveRotations returns every active rotation.
+		ActiveRotations() ([]Rotation, error)
+
+		AddRotationSweep(Sweep) (Sweep, error)
+		// RotationSweeps returns a rotation's sweeps, newest first.
+		RotationSweeps(rotationID int64) ([]Sweep, error)
+	}
+
+	// A ChainManager provides the pool and tip state used to build sweeps.
+	ChainManager = sweeper.ChainManager
+	// A Syncer relays signed sweeps to peers.
+	Syncer = sweeper.Syncer
+	// A Signer signs the sweeps of rotated wallets with an external signer.
+	Signer = sweeper.Signer
+	// A TreasuryManager checks signed sweeps against the rotated wallet's
+	// spending policy.
+	TreasuryManager = sweeper.TreasuryManager
+
+	// A WalletManager provides the addresses and outputs of rotated
+	// wallets, and reserves the inputs of their sweeps.
+	WalletManager interface {
+		sweeper.WalletManager
+		Tip() (types.ChainIndex, error)
+		Addresses(id wallet.ID) ([]wallet.Address, error)
+		AddAddress(id wallet.ID, addr wallet.Address) error
+		UnspentSiacoinOutputs(id wallet.ID, offset, limit int) ([]types.SiacoinElement, error)
+		// WalletFeeRate returns the fee rate of the wallet's fee strategy.
+		WalletFeeRate(id wallet.ID) (types.Currency, error)
+	}
+
+	// An EventBroadcaster notifies webhooks when a key rotation starts,
+	// sweeps, completes, or is cancelled.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager rotates the keys of seed wallets and periodically sweeps
+	// the funds of their old addresses.
+	Manager struct {
+		store  Store
+		wm     WalletManager
+		signer Signer
+		tm     TreasuryManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+
+		interval        time.Duration
+		addresses       int
+		maxInputs       int
+		reserveDuration time.Duration
+
+		mu sync.Mutex // serializes sweeps
+		sw *sweeper.Sweeper
+	}
+)
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// Rotate starts a key rotation for a wallet. A new seed is generated and
+// the given number of addresses derived from it are added to the wallet.
+// The wallet's existing addresses are swept to the new addresses in the
+// background. The seed phrase is returned and is not stored; it must be
+// saved by the caller.
+func (m *Manager) Rotate(walletID wallet.ID, addresses int, maxFeeRate types.Currency, maxInputs int) (Rotation, string, error) {
+	if addresses <= 0 {
+		addresses = m.addresses
+	}
+	if maxInputs <= 0 {
+		maxInputs = m.maxInputs
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotations, err := m.store.WalletRotations(walletID)
+	if err != nil {
+		return Rotation{}, "", fmt.Errorf("failed to get rotations: %w", err)
+	}
+	for _, r := range rotations {
+		if r.Status == StatusActive {
+			return Rotation{}, "", fmt.Errorf("%w: %d", ErrActive, r.ID)
+		}
+	}
+
+	existing, err := m.wm.Addresses(walletID)
+	if err != nil {
+		return Rotation{}, "", fmt.Errorf("failed to get wallet addresses: %w", err)
+	} else if len(existing) == 0 {
+		return Rotation{}, "", ErrNoAddresses
+	}
+	old := make([]types.Address, len(existing))
+	for i, addr := range existing {
+		old[i] = addr.Address
+	}
+
+	phrase := cwallet.NewSeedPhrase()
+	var entropy [32]byte
+	if err := cwallet.SeedFromPhrase(&entropy, phrase); err != nil {
+		return Rotation{}, "", fmt.Errorf("failed to derive seed: %w", err)
+	}
+	defer clear(entropy[:])
+	seed := wallet.NewSeedFromEntropy(&entropy)
+
+	now := time.Now()
+	newAddrs := make([]types.Address, addresses)
+	for i := range newAddrs {
+		policy := types.PolicyPublicKey(seed.PublicKey(uint64(i)))
+		newAddrs[i] = policy.Address()
+		err := m.wm.AddAddress(walletID, wallet.Address{
+			Address:     newAddrs[i],
+			Description: fmt.Sprintf("rotated key %d", i),
+			SpendPolicy: &policy,
+			Metadata:    json.RawMessage(fmt.Sprintf(`{"keyIndex":%d}`, i)),
+		})
+		if err != nil {
+			return Rotation{}, "", fmt.Errorf("failed to add address: %w", err)
+		}
+	}
+
+	r, err := m.store.AddRotation(Rotation{
+		WalletID:     walletID,
+		Status:       StatusActive,
+		OldAddresses: old,
+		NewAddresses: newAddrs,
+		MaxFeeRate:   maxFeeRate,
+		MaxInputs:    maxInputs,
+		DateCreated:  now,
+	})
+	if err != nil {
+		return Rotation{}, "", fmt.Errorf("failed to add rotation: %w", err)
+	}
+
+	log := m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("rotation", r.ID))
+	log.Info("started key rotation", zap.Int("oldAddresses", len(old)), zap.Int("newAddresses", len(newAddrs)))
+	m.broadcastEvent(log, "started", r)
+	return r, phrase, nil
+}
+
+// Rotations returns a wallet's rotations, newest first.
+func (m *Manager) Rotations(walletID wallet.ID) ([]Rotation, error) {
+	return m.store.WalletRotations(walletID)
+}
+
+// Rotation returns a wallet's rotation, including the outputs remaining on
+// its old addresses.
+func (m *Manager) Rotation(walletID wallet.ID, id int64) (Rotation, error) {
+	r, err := m.store.WalletRotation(walletID, id)
+	if err != nil {
+		return Rotation{}, err
+	}
+	utxos, err := m.oldOutputs(r)
+	if err != nil {
+		return Rotation{}, fmt.Errorf("failed to get remaining outputs: %w", err)
+	}
+	r.RemainingOutputs = len(utxos)
+	for _, sce := range utxos {
+		r.Remaining = r.Remaining.Add(sce.SiacoinOutput.Value)
+	}
+	return r, nil
+}
+
+// Sweeps returns the sweeps of a wallet's rotation, newest first.
+func (m *Manager) Sweeps(walletID wallet.ID, id int64) ([]Sweep, error) {
+	if _, err := m.store.WalletRotation(walletID, id); err != nil {
+		return nil, err
+	}
+	return m.store.RotationSweeps(id)
+}
+
+// Cancel stops sweeping a wallet's rotation. The new addresses remain in
+// the wallet.
+func (m *Manager) Cancel(walletID wallet.ID, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.store.WalletRotation(walletID, id)
+	if err != nil {
+		return err
+	} else if r.Status != StatusActive {
+		return ErrNotActive
+	}
+	r.Status = StatusCancelled
+	r.DateCompleted = time.Now()
+	if err := m.store.UpdateRotation(r); err != nil {
+		return fmt.Errorf("failed to update rotation: %w", err)
+	}
+	m.broadcastEvent(m.log.With(zap.Int64("wallet", int64(walletID)), zap.Int64("rotation", id)), "cancelled", r)
+	return nil
+}
+
+// Sweep immediately sweeps a wallet's rotation, ignoring its maximum fee
+// rate.
+func (m *Manager) Sweep(walletID wallet.ID, id int64) (Sweep, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, err := m.store.WalletRotation(walletID, id)
+	if err != nil {
+		return Sweep{}, err
+	} else if r.Status != StatusActive {
+		return Sweep{}, ErrNotActive
+	}
+	return m.sweep(r, true, time.Now())
+}
+
+func (m *Manager) broadcastEvent(log *zap.Logger, event string, data any) {
+	if m.events == nil {
+		return
+	}
+	if err := m.events.BroadcastEvent(ScopeRotations, event, data); err != nil {
+		log.Warn("failed to broadcast event", zap.Error(err))
+	}
+}
+
+// oldOutputs returns the wallet's unspent outputs held by the rotation's
+// old addresses, largest first.
+func (m *Manager) oldOutputs(r Rotation) ([]types.SiacoinElement, error) {
+	const batchSize = 1000
+
+	old := make(map[types.Address]bool, len(r.OldAddresses))
+	for _, addr := range r.OldAddresses {
+		old[addr] = true
+	}
+
+	var utxos []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.wm.UnspentSiacoinOutputs(r.WalletID, offset, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, sce := range batch {
+			if old[sce.SiacoinOutput.Address] {
+				utxos = append(utxos, sce)
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].SiacoinOutput.Value.Cmp(utxos[j].SiacoinOutput.Value) > 0
+	})
+	return utxos, nil
+}
+
+// sweep funds a transaction moving the largest outputs of the rotation's old
+// addresses to the next new address. If the wallet has an external signer,
+// the sweep is signed and broadcast. Otherwise, it must be signed and
+// broadcast by the client. If signing or broadcasting fails, no sweep is
+// recorded and the inputs are released. The caller must hold the lock.
+func (m *Manager) sweep(r Rotation, force bool, now time.Time) (Sweep, error) {
+	feePerByte, err := m.wm.WalletFeeRate(r.WalletID)
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get fee rate: %w", err)
+	} else if !force && !r.MaxFeeRate.IsZero() && feePerByte.Cmp(r.MaxFeeRate) > 0 {
+		return Sweep{}, fmt.Errorf("%w: %v > %v", ErrFeeRateTooHigh, feePerByte, r.MaxFeeRate)
+	}
+
+	// the outputs' proofs must match the basis; if the wallet advances
+	// while they are fetched, the sweep is retried later.
+	basis, err := m.wm.Tip()
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	}
+	utxos, err := m.oldOutputs(r)
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+	if tip, err := m.wm.Tip(); err != nil {
+		return Sweep{}, fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if tip != basis {
+		return Sweep{}, errors.New("wallet tip changed while fetching outputs")
+	}
+
+	addresses, err := m.wm.Addresses(r.WalletID)
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	policies := make(map[types.Address]types.SpendPolicy)
+	for _, addr := range addresses {
+		if addr.SpendPolicy != nil {
+			policies[addr.Address] = *addr.SpendPolicy
+		}
+	}
+
+	inputs, inputSum := m.sw.Inputs(utxos, feePerByte, r.MaxInputs, func(addr types.Address) types.SpendPolicy { return policies[addr] }, now)
+	if len(inputs) == 0 {
+		return Sweep{}, ErrNothingToSweep
+	}
+
+	txn := types.V2Transaction{
+		SiacoinInputs: inputs,
+		SiacoinOutputs: []types.SiacoinOutput{{
+			Address: r.NewAddresses[r.Sweeps%len(r.NewAddresses)],
+			Value:   inputSum,
+		}},
+	}
+	fee := m.sw.Fee(txn, feePerByte)
+	if inputSum.Cmp(fee) <= 0 {
+		return Sweep{}, ErrNothingToSweep
+	}
+	txn.SiacoinOutputs[0].Value = inputSum.Sub(fee)
+	txn.MinerFee = fee
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return Sweep{}, err
+	}
+	defer cancel()
+	txn, status, err := m.sw.Submit(ctx, r.WalletID, basis, txn, now)
+	if err != nil {
+		return Sweep{}, err
+	}
+
+	sweep, err := m.store.AddRotationSweep(Sweep{
+		RotationID:  r.ID,
+		WalletID:    r.WalletID,
+		Status:      status,
+		Basis:       basis,
+		Transaction: txn,
+		Value:       txn.SiacoinOutputs[0].Value,
+		Fee:         fee,
+		DateCreated: now,
+	})
+	if err != nil {
+		return Sweep{}, fmt.Errorf("failed to add sweep: %w", err)
+	}
+	r.Sweeps++
+	r.Swept = r.Swept.Add(sweep.Value)
+	r.Fees = r.Fees.Add(fee)
+	r.LastSweep = now
+	if err := m.store.UpdateRotation(r); err != nil {
+		return Sweep{}, fmt.Errorf("failed to update rotation: %w", err)
+	}
+
+	log := m.log.With(zap.Int64("wallet", int64(r.WalletID)), zap.Int64("rotation", r.ID))
+	log.Info("swept rotated addresses", zap.Int64("sweep", sweep.ID), zap.String("status", status), zap.Int("inputs", len(txn.SiacoinInputs)), zap.Stringer("value", sweep.Value), zap.Stringer("fee", fee))
+	m.broadcastEvent(log, "sweep", sweep)
+	return sweep, nil
+}
+
+// complete marks the rotation as complete if none of its old addresses hold
+// outputs worth sweeping, including outputs spent by pending sweeps.
+func (m *Manager) complete(r Rotation, now time.Time) error {
+	feePerByte, err := m.wm.WalletFeeRate(r.WalletID)
+	if err != nil {
+		return fmt.Errorf("failed to get fee rate: %w", err)
+	}
+	utxos, err := m.oldOutputs(r)
+	if err != nil {
+		return fmt.Errorf("failed to get unspent outputs: %w", err)
+	} else if len(utxos) > 0 && utxos[0].SiacoinOutput.Value.Cmp(sweeper.MinValue(feePerByte)) > 0 {
+		return nil
+	}
+
+	r.Status = StatusComplete
+	r.DateCompleted = now
+	if err := m.store.UpdateRotation(r); err != nil {
+		return fmt.Errorf("failed to update rotation: %w", err)
+	}
+	log := m.log.With(zap.Int64("wallet", int64(r.WalletID)), zap.Int64("rotation", r.ID))
+	log.Info("completed key rotation", zap.Int("sweeps", r.Sweeps), zap.Stringer("swept", r.Swept))
+	m.broadcastEvent(log, "complete", r)
+	return nil
+}
+
+// check sweeps every active rotation and completes the rotations with
+// nothing left to sweep.
+func (m *Manager) check(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotations, err := m.store.ActiveRotations()
+	if err != nil {
+		m.log.Error("failed to get active rotations", zap.Error(err))
+		return
+	}
+	for _, r := range rotations {
+		log := m.log.With(zap.Int64("wallet", int64(r.WalletID)), zap.Int64("rotation", r.ID))
+		_, err := m.sweep(r, false, now)
+		switch {
+		case errors.Is(err, ErrNothingToSweep):
+			if err := m.complete(r, now); err != nil {
+				log.Warn("failed to complete rotation", zap.Error(err))
+			}
+		case errors.Is(err, ErrFeeRateTooHigh):
+			log.Debug("delaying sweep", zap.Error(err))
+		case err != nil:
+			log.Warn("failed to sweep rotation", zap.Error(err))
+		}
+	}
+}
+
+// NewManager creates a new rotation manager and starts sweeping active
+// rotations in the background.
+func NewManager(store Store, cm ChainManager, s Syncer, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		interval:        10 * time.Minute,
+		addresses:       20,
+		maxInputs:       100,
+		reserveDuration: 3 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.addresses <= 0 {
+		return nil, errors.New("number of addresses must be greater than zero")
+	} else if m.maxInputs <= 0 {
+		return nil, errors.New("maximum inputs must be greater than zero")
+	}
+	m.sw = sweeper.New(cm, s, wm, m.signer, m.tm, "rotation", m.reserveDuration)
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "rotation", "sweeps the old addresses of active key rotations", m.interval, false, func(context.Context) error {
+			m.check(time.Now())
+			return nil
+		})
+	}()
+	return m, nil
+}
@@ -0,0 +1,321 @@
+package rotation_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/rotation"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct{}
+
+func (chainManager) TipState() consensus.State                 { return consensus.State{} }
+func (chainManager) PoolTransactions() []types.Transaction     { return nil }
+func (chainManager) V2PoolTransactions() []types.V2Transaction { return nil }
+func (chainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	mu        sync.Mutex
+	addresses []wallet.Address
+	utxos     []types.SiacoinElement
+	reserved  map[types.Hash256]bool
+}
+
+func (wm *walletManager) Tip() (types.ChainIndex, error) {
+	return types.ChainIndex{Height: 10}, nil
+}
+
+func (wm *walletManager) Addresses(wallet.ID) ([]wallet.Address, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]wallet.Address(nil), wm.addresses...), nil
+}
+
+func (wm *walletManager) AddAddress(_ wallet.ID, addr wallet.Address) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.addresses = append(wm.addresses, addr)
+	return nil
+}
+
+func (wm *walletManager) UnspentSiacoinOutputs(_ wallet.ID, offset, limit int) ([]types.SiacoinElement, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if offset > len(wm.utxos) {
+		return nil, nil
+	}
+	utxos := wm.utxos[offset:]
+	if len(utxos) > limit {
+		utxos = utxos[:limit]
+	}
+	return append([]types.SiacoinElement(nil), utxos...), nil
+}
+
+func (wm *walletManager) Reserve(ids []types.Hash256, _ time.Duration) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		if wm.reserved[id] {
+			return fmt.Errorf("output %v already reserved", id)
+		}
+	}
+	for _, id := range ids {
+		wm.reserved[id] = true
+	}
+	return nil
+}
+
+func (wm *walletManager) Release(ids []types.Hash256) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		delete(wm.reserved, id)
+	}
+}
+
+func (wm *walletManager) WalletFeeRate(wallet.ID) (types.Currency, error) {
+	return types.NewCurrency64(1), nil
+}
+
+func checkSweep(t *testing.T, sweep rotation.Sweep, r rotation.Rotation, inputs int) {
+	t.Helper()
+
+	old := make(map[types.Address]bool)
+	for _, addr := range r.OldAddresses {
+		old[addr] = true
+	}
+	var inputSum types.Currency
+	for _, sci := range sweep.Transaction.SiacoinInputs {
+		if !old[sci.Parent.SiacoinOutput.Address] {
+			t.Fatalf("sweep spends output %v of address %v, which was not rotated", sci.Parent.ID, sci.Parent.SiacoinOutput.Address)
+		}
+		inputSum = inputSum.Add(sci.Parent.SiacoinOutput.Value)
+	}
+
+	txn := sweep.Transaction
+	if sweep.Status != rotation.SweepUnsigned {
+		t.Fatalf("expected status %q, got %q", rotation.SweepUnsigned, sweep.Status)
+	} else if len(txn.SiacoinInputs) != inputs {
+		t.Fatalf("expected %d inputs, got %d", inputs, len(txn.SiacoinInputs))
+	} else if len(txn.SiacoinOutputs) != 1 || txn.SiacoinOutputs[0].Address != r.NewAddresses[(r.Sweeps-1)%len(r.NewAddresses)] {
+		t.Fatalf("expected a single output to new address %d, got %v", r.Sweeps-1, txn.SiacoinOutputs)
+	} else if !txn.MinerFee.Equals(sweep.Fee) || !txn.SiacoinOutputs[0].Value.Equals(sweep.Value) {
+		t.Fatal("sweep value and fee do not match transaction")
+	} else if !inputSum.Equals(sweep.Value.Add(sweep.Fee)) {
+		t.Fatalf("inputs %v do not equal output %v plus fee %v", inputSum, sweep.Value, sweep.Fee)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{reserved: make(map[types.Hash256]bool)}
+	for i := 0; i < 2; i++ {
+		sk := types.GeneratePrivateKey()
+		policy := types.PolicyPublicKey(sk.PublicKey())
+		wm.addresses = append(wm.addresses, wallet.Address{Address: policy.Address(), SpendPolicy: &policy})
+	}
+	for i := 0; i < 3; i++ {
+		wm.utxos = append(wm.utxos, types.SiacoinElement{
+			ID:            types.SiacoinOutputID{byte(i + 1)},
+			SiacoinOutput: types.SiacoinOutput{Address: wm.addresses[0].Address, Value: types.Siacoins(uint32(1000 * (i + 1)))},
+		})
+	}
+	// dust is not worth sweeping
+	dust := types.SiacoinElement{
+		ID:            types.SiacoinOutputID{4},
+		SiacoinOutput: types.SiacoinOutput{Address: wm.addresses[1].Address, Value: types.NewCurrency64(1)},
+	}
+	wm.utxos = append(wm.utxos, dust)
+
+	rm, err := rotation.NewManager(db, chainManager{}, syncer{}, wm, rotation.WithLogger(log.Named("rotation")), rotation.WithInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm.Close()
+
+	if _, _, err := rm.Rotate(w.ID+1, 2, types.ZeroCurrency, 2); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	r, _, err := rm.Rotate(w.ID, 2, types.ZeroCurrency, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if r.Status != rotation.StatusActive {
+		t.Fatalf("expected status %q, got %q", rotation.StatusActive, r.Status)
+	} else if len(r.OldAddresses) != 2 || len(r.NewAddresses) != 2 {
+		t.Fatalf("expected 2 old and 2 new addresses, got %d and %d", len(r.OldAddresses), len(r.NewAddresses))
+	} else if len(wm.addresses) != 4 || wm.addresses[2].Address != r.NewAddresses[0] || wm.addresses[2].SpendPolicy == nil {
+		t.Fatal("expected new addresses to be added to the wallet")
+	} else if _, _, err := rm.Rotate(w.ID, 2, types.ZeroCurrency, 2); !errors.Is(err, rotation.ErrActive) {
+		t.Fatalf("expected ErrActive, got %v", err)
+	}
+
+	// the largest outputs are swept first
+	s1, err := rm.Sweep(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if r, err = rm.Rotation(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkSweep(t, s1, r, 2)
+	if s1.Transaction.SiacoinInputs[0].Parent.ID != wm.utxos[2].ID {
+		t.Fatal("expected largest output to be swept first")
+	} else if s1.Transaction.SiacoinInputs[0].SatisfiedPolicy.Policy.Type == nil {
+		t.Fatal("expected input to include its spend policy")
+	}
+
+	// the next sweep does not reuse reserved inputs and leaves the dust
+	s2, err := rm.Sweep(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if r, err = rm.Rotation(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkSweep(t, s2, r, 1)
+	if s2.Transaction.SiacoinInputs[0].Parent.ID != wm.utxos[0].ID {
+		t.Fatal("expected second sweep to spend the remaining output")
+	} else if _, err := rm.Sweep(w.ID, r.ID); !errors.Is(err, rotation.ErrNothingToSweep) {
+		t.Fatalf("expected ErrNothingToSweep, got %v", err)
+	}
+
+	if r.Sweeps != 2 || !r.Swept.Equals(s1.Value.Add(s2.Value)) || !r.Fees.Equals(s1.Fee.Add(s2.Fee)) {
+		t.Fatalf("unexpected rotation progress: %+v", r)
+	} else if r.RemainingOutputs != 4 {
+		t.Fatalf("expected 4 remaining outputs, got %d", r.RemainingOutputs)
+	} else if sweeps, err := rm.Sweeps(w.ID, r.ID); err != nil {
+		t.Fatal(err)
+	} else if len(sweeps) != 2 || sweeps[0].ID != s2.ID || sweeps[1].Transaction.ID() != s1.Transaction.ID() {
+		t.Fatalf("expected 2 sweeps, got %v", sweeps)
+	}
+	rm.Close()
+
+	// once the sweeps confirm, only dust remains and the rotation completes
+	wm.mu.Lock()
+	wm.utxos = []types.SiacoinElement{dust}
+	wm.mu.Unlock()
+
+	rm, err = rotation.NewManager(db, chainManager{}, syncer{}, wm, rotation.WithLogger(log.Named("rotation")), rotation.WithInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm.Close()
+
+	for i := 0; ; i++ {
+		r, err = rm.Rotation(w.ID, r.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if r.Status == rotation.StatusComplete {
+			break
+		} else if i == 100 {
+			t.Fatalf("expected rotation to complete, got status %q", r.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if r.RemainingOutputs != 1 || !r.Remaining.Equals(dust.SiacoinOutput.Value) {
+		t.Fatalf("expected dust to remain, got %d outputs worth %v", r.RemainingOutputs, r.Remaining)
+	} else if err := rm.Cancel(w.ID, r.ID); !errors.Is(err, rotation.ErrNotActive) {
+		t.Fatalf("expected ErrNotActive, got %v", err)
+	}
+
+	// a new rotation can be started once the previous one is complete
+	r2, _, err := rm.Rotate(w.ID, 1, types.ZeroCurrency, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(r2.OldAddresses) != 4 || r2.MaxInputs != 100 {
+		t.Fatalf("expected 4 old addresses and the default max inputs, got %d and %d", len(r2.OldAddresses), r2.MaxInputs)
+	} else if err := rm.Cancel(w.ID, r2.ID); err != nil {
+		t.Fatal(err)
+	} else if rotations, err := rm.Rotations(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(rotations) != 2 || rotations[0].Status != rotation.StatusCancelled {
+		t.Fatalf("expected 2 rotations with the newest cancelled, got %v", rotations)
+	}
+}
+
+type signer struct{}
+
+func (signer) SignV2Transaction(_ context.Context, _ wallet.ID, txn types.V2Transaction) (types.V2Transaction, error) {
+	return txn, nil
+}
+
+type treasuryManager struct {
+	calls int
+}
+
+func (tm *treasuryManager) BroadcastTransactionSet(_ []types.Transaction, v2txns []types.V2Transaction, submittedBy string, _ func() error) (treasury.PendingTransaction, bool, error) {
+	tm.calls++
+	return treasury.PendingTransaction{ID: 1, V2Transactions: v2txns, SubmittedBy: submittedBy}, true, nil
+}
+
+func TestSweepApproval(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &walletManager{reserved: make(map[types.Hash256]bool)}
+	sk := types.GeneratePrivateKey()
+	policy := types.PolicyPublicKey(sk.PublicKey())
+	wm.addresses = append(wm.addresses, wallet.Address{Address: policy.Address(), SpendPolicy: &policy})
+	wm.utxos = append(wm.utxos, types.SiacoinElement{
+		ID:            types.SiacoinOutputID{1},
+		SiacoinOutput: types.SiacoinOutput{Address: policy.Address(), Value: types.Siacoins(1000)},
+	})
+
+	tm := new(treasuryManager)
+	rm, err := rotation.NewManager(db, chainManager{}, syncer{}, wm, rotation.WithLogger(log.Named("rotation")), rotation.WithInterval(time.Hour), rotation.WithSigner(signer{}), rotation.WithTreasuryManager(tm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rm.Close()
+
+	r, _, err := rm.Rotate(w.ID, 1, types.ZeroCurrency, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed sweeps go through the treasury manager
+	sweep, err := rm.Sweep(w.ID, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if tm.calls != 1 {
+		t.Fatal("expected sweep to be checked by the treasury manager")
+	} else if sweep.Status != rotation.SweepPending {
+		t.Fatalf("expected status %q, got %q", rotation.SweepPending, sweep.Status)
+	}
+}
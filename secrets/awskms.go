@@ -0,0 +1,152 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An AWSKMSProvider decrypts secrets with AWS KMS. References are the
+// base64-encoded ciphertext blobs returned by "aws kms encrypt", so only
+// ciphertext is stored in the config file. Credentials are read from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment
+// variables.
+type AWSKMSProvider struct {
+	region   string
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+}
+
+// awsCredentials are the credentials used to sign requests.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 signs a request with AWS Signature Version 4. The request must not
+// have a body other than payload.
+func signV4(req *http.Request, payload []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// Fetch implements Provider.
+func (kp *AWSKMSProvider) Fetch(ctx context.Context, ref string) (string, error) {
+	if _, err := base64.StdEncoding.DecodeString(ref); err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return "", fmt.Errorf("AWS credentials are not set")
+	}
+
+	payload, _ := json.Marshal(map[string]string{"CiphertextBlob": ref})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, kp.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	signV4(req, payload, creds, kp.region, "kms", kp.now())
+
+	var resp struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := doJSON(kp.client, req, &resp); err != nil {
+		return "", err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode plaintext: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NewAWSKMSProvider returns a provider that decrypts secrets with AWS KMS in
+// region. If region is empty, the AWS_REGION environment variable is used.
+// If endpoint is empty, the regional KMS endpoint is used.
+func NewAWSKMSProvider(region, endpoint string) (*AWSKMSProvider, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("AWS region is required")
+	} else if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", region)
+	}
+	return &AWSKMSProvider{
+		region:   region,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		now:      time.Now,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gcpKMSEndpoint = "https://cloudkms.googleapis.com"
+	// gcpTokenURL returns an access token for the default service account
+	// of a Compute Engine instance or GKE workload.
+	gcpTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// A GCPKMSProvider decrypts secrets with a GCP Cloud KMS key. References are
+// the base64-encoded ciphertexts returned by "gcloud kms encrypt", so only
+// ciphertext is stored in the config file. The access token is read from the
+// GOOGLE_OAUTH_ACCESS_TOKEN environment variable if set, and otherwise from
+// the metadata server.
+type GCPKMSProvider struct {
+	key      string
+	endpoint string
+	tokenURL string
+	client   *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// accessToken returns an OAuth access token, fetching a new one from the
+// metadata server when the previous one is about to expire.
+func (kp *GCPKMSProvider) accessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	if kp.token != "" && time.Until(kp.tokenExpiry) > time.Minute {
+		return kp.token, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, kp.tokenURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := doJSON(kp.client, req, &resp); err != nil {
+		return "", err
+	}
+	kp.token = resp.AccessToken
+	kp.tokenExpiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	return kp.token, nil
+}
+
+// Fetch implements Provider.
+func (kp *GCPKMSProvider) Fetch(ctx context.Context, ref string) (string, error) {
+	if _, err := base64.StdEncoding.DecodeString(ref); err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	token, err := kp.accessToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	payload, _ := json.Marshal(map[string]string{"ciphertext": ref})
+	u := fmt.Sprintf("%s/v1/%s:decrypt", kp.endpoint, kp.key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := doJSON(kp.client, req, &resp); err != nil {
+		return "", err
+	}
+	plaintext, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode plaintext: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// NewGCPKMSProvider returns a provider that decrypts secrets with the key
+// named key, e.g.
+// "projects/p/locations/global/keyRings/r/cryptoKeys/k". If endpoint is empty,
+// the Cloud KMS API endpoint is used.
+func NewGCPKMSProvider(key, endpoint string) (*GCPKMSProvider, error) {
+	if !strings.HasPrefix(key, "projects/") {
+		return nil, fmt.Errorf("invalid key name %q", key)
+	} else if endpoint == "" {
+		endpoint = gcpKMSEndpoint
+	}
+	return &GCPKMSProvider{
+		key:      key,
+		endpoint: strings.TrimRight(endpoint, "/"),
+		tokenURL: gcpTokenURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithRefreshInterval sets how often secrets are refetched. If zero, secrets
+// are only fetched at startup.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.refreshInterval = d
+	}
+}
+
+// WithAPIPassword fetches the API password from ref.
+func WithAPIPassword(ref string) Option {
+	return func(m *Manager) {
+		m.apiPasswordRef = ref
+	}
+}
+
+// WithSeeds fetches the recovery phrases of wallets, keyed by wallet ID, and
+// loads their seeds into sl.
+func WithSeeds(sl SeedLoader, refs map[wallet.ID]string) Option {
+	return func(m *Manager) {
+		m.sl = sl
+		m.seedRefs = refs
+	}
+}
+
+// WithScheduler registers the secret refresh as the "secrets" job, so that
+// rotated secrets can be refetched immediately.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
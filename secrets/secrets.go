@@ -0,0 +1,188 @@
+// Package secrets fetches the API password and wallet seeds from an external
+// secrets backend, such as HashiCorp Vault or a cloud KMS, so that they do not
+// have to be stored in walletd's database or config file.
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// fetchTimeout is the timeout of fetching every secret once.
+const fetchTimeout = time.Minute
+
+// ErrNotFound is returned by a Provider when a secret does not exist.
+var ErrNotFound = errors.New("secret not found")
+
+type (
+	// A Provider fetches secrets from a secrets backend. The format of a
+	// reference depends on the provider.
+	Provider interface {
+		Fetch(ctx context.Context, ref string) (string, error)
+	}
+
+	// A SeedLoader holds the seeds of wallets in memory.
+	SeedLoader interface {
+		// SetExternalSeed holds the seed of a recovery phrase for a wallet,
+		// replacing any seed it held before.
+		SetExternalSeed(id wallet.ID, phrase string) error
+	}
+
+	// A Manager fetches secrets from a Provider at startup and refetches
+	// them periodically so that they can be rotated without restarting.
+	Manager struct {
+		p     Provider
+		log   *zap.Logger
+		tg    *threadgroup.ThreadGroup
+		sched *jobs.Scheduler
+
+		refreshInterval time.Duration
+		apiPasswordRef  string
+		seedRefs        map[wallet.ID]string
+		sl              SeedLoader
+
+		mu          sync.Mutex // protects the fields below
+		apiPassword string
+		// seeds holds a digest of the last phrase loaded for each wallet,
+		// so that unchanged seeds are not reloaded.
+		seeds map[wallet.ID][32]byte
+	}
+)
+
+// APIPassword returns the API password fetched from the secrets backend. It
+// returns an empty string if the API password is not fetched.
+func (m *Manager) APIPassword() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.apiPassword
+}
+
+// Refresh fetches every secret and applies the ones that changed. If a secret
+// cannot be fetched, the previous value is kept.
+func (m *Manager) Refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var errs []error
+	if m.apiPasswordRef != "" {
+		if pass, err := m.p.Fetch(ctx, m.apiPasswordRef); err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch API password: %w", err))
+		} else if pass == "" {
+			errs = append(errs, errors.New("fetched API password is empty"))
+		} else {
+			m.mu.Lock()
+			if m.apiPassword != "" && m.apiPassword != pass {
+				m.log.Info("API password rotated")
+			}
+			m.apiPassword = pass
+			m.mu.Unlock()
+		}
+	}
+
+	for id, ref := range m.seedRefs {
+		phrase, err := m.p.Fetch(ctx, ref)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch seed of wallet %d: %w", id, err))
+			continue
+		}
+		digest := sha256.Sum256([]byte(phrase))
+		m.mu.Lock()
+		prev, ok := m.seeds[id]
+		m.mu.Unlock()
+		if ok && prev == digest {
+			continue
+		} else if err := m.sl.SetExternalSeed(id, phrase); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load seed of wallet %d: %w", id, err))
+			continue
+		}
+		m.mu.Lock()
+		m.seeds[id] = digest
+		m.mu.Unlock()
+		if ok {
+			m.log.Info("wallet seed rotated", zap.Int64("wallet", int64(id)))
+		} else {
+			m.log.Info("loaded wallet seed", zap.Int64("wallet", int64(id)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops refreshing secrets.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// NewManager fetches the configured secrets from p. It returns an error if any
+// of them cannot be fetched, so that walletd does not start without them.
+func NewManager(p Provider, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		p:   p,
+		log: zap.NewNop(),
+		tg:  threadgroup.New(),
+
+		seeds: make(map[wallet.ID][32]byte),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if len(m.seedRefs) > 0 && m.sl == nil {
+		return nil, errors.New("seeds require a seed loader")
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Refresh(ctx); err != nil {
+		cancel()
+		return nil, err
+	} else if m.refreshInterval <= 0 {
+		cancel()
+		return m, nil
+	}
+
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "secrets", "refetches secrets from the secrets backend", m.refreshInterval, false, func(ctx context.Context) error {
+			err := m.Refresh(ctx)
+			if err != nil {
+				m.log.Error("failed to refresh secrets", zap.Error(err))
+			}
+			return err
+		})
+	}()
+	return m, nil
+}
+
+// doJSON performs a request and decodes its JSON response into v.
+func doJSON(client *http.Client, req *http.Request, v any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		buf, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(buf)))
+	} else if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
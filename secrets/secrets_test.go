@@ -0,0 +1,211 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+)
+
+type provider struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func (p *provider) Fetch(_ context.Context, ref string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.secrets[ref]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return s, nil
+}
+
+func (p *provider) set(ref, s string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.secrets[ref] = s
+}
+
+type seedLoader struct {
+	mu    sync.Mutex
+	seeds map[wallet.ID]string
+	loads int
+}
+
+func (sl *seedLoader) SetExternalSeed(id wallet.ID, phrase string) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	sl.seeds[id] = phrase
+	sl.loads++
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	p := &provider{secrets: map[string]string{
+		"api":  "hunter2",
+		"seed": "phrase one",
+	}}
+	sl := &seedLoader{seeds: make(map[wallet.ID]string)}
+
+	// missing secrets prevent startup
+	if _, err := NewManager(p, WithAPIPassword("missing")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	m, err := NewManager(p, WithAPIPassword("api"), WithSeeds(sl, map[wallet.ID]string{1: "seed"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.APIPassword() != "hunter2" {
+		t.Fatalf("unexpected API password %q", m.APIPassword())
+	} else if sl.seeds[1] != "phrase one" {
+		t.Fatalf("unexpected seed %q", sl.seeds[1])
+	}
+
+	// unchanged seeds are not reloaded
+	if err := m.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if sl.loads != 1 {
+		t.Fatalf("expected 1 load, got %d", sl.loads)
+	}
+
+	// rotated secrets are applied on refresh
+	p.set("api", "hunter3")
+	p.set("seed", "phrase two")
+	if err := m.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if m.APIPassword() != "hunter3" {
+		t.Fatalf("unexpected API password %q", m.APIPassword())
+	} else if sl.seeds[1] != "phrase two" || sl.loads != 2 {
+		t.Fatalf("unexpected seed %q after %d loads", sl.seeds[1], sl.loads)
+	}
+
+	// a secret that cannot be fetched keeps its previous value
+	p.set("api", "")
+	if err := m.Refresh(context.Background()); err == nil {
+		t.Fatal("expected error")
+	} else if m.APIPassword() != "hunter3" {
+		t.Fatalf("unexpected API password %q", m.APIPassword())
+	}
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		} else if r.URL.Path != "/v1/kv/data/walletd/api" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{
+				"data":     map[string]any{"value": "hunter2", "password": "hunter3"},
+				"metadata": map[string]any{"version": 1},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	vp, err := NewVaultProvider(srv.URL, "kv", "token", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if s, err := vp.Fetch(ctx, "walletd/api"); err != nil {
+		t.Fatal(err)
+	} else if s != "hunter2" {
+		t.Fatalf("unexpected secret %q", s)
+	} else if s, err := vp.Fetch(ctx, "walletd/api#password"); err != nil {
+		t.Fatal(err)
+	} else if s != "hunter3" {
+		t.Fatalf("unexpected secret %q", s)
+	} else if _, err := vp.Fetch(ctx, "walletd/api#missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if _, err := vp.Fetch(ctx, "walletd/missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	vp, err = NewVaultProvider(srv.URL, "kv", "wrong", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := vp.Fetch(ctx, "walletd/api"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected 403 error, got %v", err)
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// example request from the AWS Signature Version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := awsCredentials{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	const expected = "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if auth := req.Header.Get("Authorization"); auth != expected {
+		t.Fatalf("expected %q, got %q", expected, auth)
+	}
+}
+
+func TestKMS(t *testing.T) {
+	ciphertext := base64.StdEncoding.EncodeToString([]byte("ciphertext"))
+	plaintext := base64.StdEncoding.EncodeToString([]byte("hunter2"))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case r.Header.Get("X-Amz-Target") == "TrentService.Decrypt":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || req["CiphertextBlob"] != ciphertext {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"Plaintext": plaintext})
+		case r.URL.Path == "/v1/projects/p/locations/global/keyRings/r/cryptoKeys/k:decrypt":
+			if r.Header.Get("Authorization") != "Bearer token" || req["ciphertext"] != ciphertext {
+				http.Error(w, "invalid request", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"plaintext": plaintext})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+
+	aws, err := NewAWSKMSProvider("us-east-1", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcp, err := NewGCPKMSProvider("projects/p/locations/global/keyRings/r/cryptoKeys/k", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []Provider{aws, gcp} {
+		if s, err := p.Fetch(context.Background(), ciphertext); err != nil {
+			t.Fatal(err)
+		} else if s != "hunter2" {
+			t.Fatalf("unexpected secret %q", s)
+		} else if _, err := p.Fetch(context.Background(), "not base64!"); err == nil {
+			t.Fatal("expected error for invalid ciphertext")
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// A VaultProvider fetches secrets from the KV version 2 secrets engine of
+// HashiCorp Vault. References have the form "path#field", where path is the
+// path of a secret in the engine and field is the key of a value in the
+// secret. If the field is omitted, "value" is used.
+type VaultProvider struct {
+	address string
+	mount   string
+	client  *http.Client
+
+	// token returns the token used to authenticate with Vault. It is
+	// called for every request so that a token file can be rotated.
+	token func() (string, error)
+}
+
+// Fetch implements Provider.
+func (vp *VaultProvider) Fetch(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok {
+		field = "value"
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("invalid reference %q", ref)
+	}
+	token, err := vp.token()
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %w", err)
+	}
+
+	u := fmt.Sprintf("%s/v1/%s/data/%s", vp.address, vp.mount, path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	var resp struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := doJSON(vp.client, req, &resp); err != nil {
+		return "", err
+	}
+	v, ok := resp.Data.Data[field]
+	if !ok {
+		return "", fmt.Errorf("%w: secret %q has no field %q", ErrNotFound, path, field)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("field %q of secret %q is not a string", field, path)
+	}
+	return s, nil
+}
+
+// NewVaultProvider returns a provider for the KV version 2 engine mounted at
+// mount, "secret" if empty. If address is empty, the VAULT_ADDR environment
+// variable is used. The token is read from tokenFile if set, and otherwise
+// from token or the VAULT_TOKEN environment variable.
+func NewVaultProvider(address, mount, token, tokenFile string) (*VaultProvider, error) {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("vault address is required")
+	} else if mount == "" {
+		mount = "secret"
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	vp := &VaultProvider{
+		address: strings.TrimRight(address, "/"),
+		mount:   strings.Trim(mount, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+	switch {
+	case tokenFile != "":
+		vp.token = func() (string, error) {
+			buf, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(string(buf)), nil
+		}
+	case token != "":
+		vp.token = func() (string, error) { return token, nil }
+	default:
+		return nil, fmt.Errorf("vault token is required")
+	}
+	return vp, nil
+}
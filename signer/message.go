@@ -0,0 +1,90 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+var (
+	// ErrNotWalletAddress is returned when signing a message with an
+	// address that does not belong to the wallet.
+	ErrNotWalletAddress = errors.New("address does not belong to wallet")
+	// ErrInvalidMessageSignature is returned when a signed message's
+	// signature is invalid or its key does not control its address.
+	ErrInvalidMessageSignature = errors.New("invalid message signature")
+)
+
+// A SignedMessage proves that the holder of an address's key signed a
+// message.
+type SignedMessage struct {
+	Address   types.Address   `json:"address"`
+	PublicKey types.PublicKey `json:"publicKey"`
+	Message   string          `json:"message"`
+	Signature types.Signature `json:"signature"`
+}
+
+// MessageHash returns the hash signed for a message. The hash is
+// domain-separated so that a signed message cannot be used as a transaction
+// signature.
+func MessageHash(msg string) types.Hash256 {
+	h := types.NewHasher()
+	h.WriteDistinguisher("walletd/message")
+	h.E.WriteString(msg)
+	return h.Sum()
+}
+
+// keyControls reports whether pk alone controls addr, either through a
+// public key policy or standard unlock conditions.
+func keyControls(pk types.PublicKey, addr types.Address) bool {
+	return types.PolicyPublicKey(pk).Address() == addr || types.StandardAddress(pk) == addr
+}
+
+// VerifyMessage checks that a message was signed by the key controlling its
+// address. It returns ErrInvalidMessageSignature if it was not.
+func VerifyMessage(sm SignedMessage) error {
+	if !keyControls(sm.PublicKey, sm.Address) {
+		return fmt.Errorf("%w: key %v does not control address %v", ErrInvalidMessageSignature, sm.PublicKey, sm.Address)
+	} else if !sm.PublicKey.VerifyHash(MessageHash(sm.Message), sm.Signature) {
+		return ErrInvalidMessageSignature
+	}
+	return nil
+}
+
+// SignMessage signs a message with the key of one of the wallet's addresses,
+// proving ownership of the address to anyone holding the signed message. The
+// address must be controlled by a single key.
+func (m *Manager) SignMessage(ctx context.Context, id wallet.ID, addr types.Address, msg string) (SignedMessage, error) {
+	policies, err := m.walletPolicies(id)
+	if err != nil {
+		return SignedMessage{}, err
+	}
+	policy, ok := policies[addr]
+	if !ok {
+		return SignedMessage{}, ErrNotWalletAddress
+	}
+	keys, err := policyKeys(policy)
+	if err != nil {
+		return SignedMessage{}, err
+	} else if len(keys) != 1 || !keyControls(keys[0], addr) {
+		return SignedMessage{}, fmt.Errorf("%w: address is not controlled by a single key", ErrUnsupportedPolicy)
+	}
+
+	s, err := m.walletSigner(id)
+	if err != nil {
+		return SignedMessage{}, err
+	}
+	sig, err := signHash(ctx, s, keys[0], MessageHash(msg))
+	if err != nil {
+		return SignedMessage{}, err
+	}
+	return SignedMessage{
+		Address:   addr,
+		PublicKey: keys[0],
+		Message:   msg,
+		Signature: sig,
+	}, nil
+}
@@ -0,0 +1,28 @@
+package signer
+
+import "go.uber.org/zap"
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithSigner adds a named signer that can be assigned to wallets.
+func WithSigner(name string, s Signer) Option {
+	return func(m *Manager) {
+		m.signers[name] = s
+	}
+}
+
+// WithKeyStore sets the keystore used to sign for wallets that are not
+// assigned a signer.
+func WithKeyStore(ks KeyStore) Option {
+	return func(m *Manager) {
+		m.ks = ks
+	}
+}
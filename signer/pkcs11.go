@@ -0,0 +1,169 @@
+//go:build pkcs11
+
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+	"go.thebigfile.com/core/types"
+)
+
+// ckmEDDSA is the PKCS#11 3.0 EdDSA signing mechanism.
+const ckmEDDSA = 0x1057
+
+// A PKCS11Signer signs hashes with Ed25519 keys stored in a PKCS#11 token,
+// such as an HSM. The private keys never leave the token.
+type PKCS11Signer struct {
+	mu      sync.Mutex // PKCS#11 sessions are not safe for concurrent use
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	keys    map[types.PublicKey]pkcs11.ObjectHandle
+}
+
+// findObject returns the handle of the object with the given class and
+// label.
+func (ps *PKCS11Signer) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := ps.ctx.FindObjectsInit(ps.session, template); err != nil {
+		return 0, fmt.Errorf("failed to search objects: %w", err)
+	}
+	objs, _, err := ps.ctx.FindObjects(ps.session, 1)
+	if err := errors.Join(err, ps.ctx.FindObjectsFinal(ps.session)); err != nil {
+		return 0, fmt.Errorf("failed to search objects: %w", err)
+	} else if len(objs) == 0 {
+		return 0, fmt.Errorf("object %q not found", label)
+	}
+	return objs[0], nil
+}
+
+// publicKey returns the Ed25519 public key of the key pair with the given
+// label.
+func (ps *PKCS11Signer) publicKey(label string) (types.PublicKey, error) {
+	obj, err := ps.findObject(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return types.PublicKey{}, err
+	}
+	attrs, err := ps.ctx.GetAttributeValue(ps.session, obj, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+	if err != nil {
+		return types.PublicKey{}, fmt.Errorf("failed to get public key: %w", err)
+	}
+
+	// the point is usually a DER-encoded octet string
+	var pk types.PublicKey
+	point := attrs[0].Value
+	switch {
+	case len(point) == len(pk):
+	case len(point) == len(pk)+2 && point[0] == 0x04 && point[1] == byte(len(pk)):
+		point = point[2:]
+	default:
+		return types.PublicKey{}, fmt.Errorf("key %q is not an Ed25519 key", label)
+	}
+	copy(pk[:], point)
+	return pk, nil
+}
+
+// SignHash implements Signer.
+func (ps *PKCS11Signer) SignHash(_ context.Context, pk types.PublicKey, hash types.Hash256) (types.Signature, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	key, ok := ps.keys[pk]
+	if !ok {
+		return types.Signature{}, ErrUnknownKey
+	} else if err := ps.ctx.SignInit(ps.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(ckmEDDSA, nil)}, key); err != nil {
+		return types.Signature{}, fmt.Errorf("failed to initialize signing: %w", err)
+	}
+	buf, err := ps.ctx.Sign(ps.session, hash[:])
+	if err != nil {
+		return types.Signature{}, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	var sig types.Signature
+	if len(buf) != len(sig) {
+		return types.Signature{}, fmt.Errorf("token returned a %d-byte signature", len(buf))
+	}
+	copy(sig[:], buf)
+	return sig, nil
+}
+
+// Close logs out of the token and unloads the PKCS#11 module.
+func (ps *PKCS11Signer) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	err := errors.Join(ps.ctx.Logout(ps.session), ps.ctx.CloseSession(ps.session), ps.ctx.Finalize())
+	ps.ctx.Destroy()
+	return err
+}
+
+// NewPKCS11Signer loads the PKCS#11 module at modulePath, logs in to the token
+// with the given label, and loads the key pairs with the given labels.
+func NewPKCS11Signer(modulePath, tokenLabel, pin string, keyLabels []string) (_ *PKCS11Signer, err error) {
+	p := pkcs11.New(modulePath)
+	if p == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", modulePath)
+	} else if err := p.Initialize(); err != nil {
+		p.Destroy()
+		return nil, fmt.Errorf("failed to initialize PKCS#11 module: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			p.Finalize()
+			p.Destroy()
+		}
+	}()
+
+	slots, err := p.GetSlotList(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list slots: %w", err)
+	}
+	slot, found := uint(0), false
+	for _, id := range slots {
+		info, err := p.GetTokenInfo(id)
+		// token labels are padded with spaces
+		if err == nil && strings.TrimSpace(info.Label) == tokenLabel {
+			slot, found = id, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("token %q not found", tokenLabel)
+	}
+
+	session, err := p.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	} else if err := p.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		p.CloseSession(session)
+		return nil, fmt.Errorf("failed to log in to token: %w", err)
+	}
+
+	ps := &PKCS11Signer{
+		ctx:     p,
+		session: session,
+		keys:    make(map[types.PublicKey]pkcs11.ObjectHandle),
+	}
+	for _, label := range keyLabels {
+		pk, err := ps.publicKey(label)
+		if err != nil {
+			p.Logout(session)
+			p.CloseSession(session)
+			return nil, fmt.Errorf("failed to load key %q: %w", label, err)
+		}
+		key, err := ps.findObject(pkcs11.CKO_PRIVATE_KEY, label)
+		if err != nil {
+			p.Logout(session)
+			p.CloseSession(session)
+			return nil, fmt.Errorf("failed to load key %q: %w", label, err)
+		}
+		ps.keys[pk] = key
+	}
+	return ps, nil
+}
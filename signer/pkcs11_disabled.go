@@ -0,0 +1,32 @@
+//go:build !pkcs11
+
+package signer
+
+import (
+	"context"
+	"errors"
+
+	"go.thebigfile.com/core/types"
+)
+
+// errPKCS11Disabled is returned when walletd was built without PKCS#11
+// support.
+var errPKCS11Disabled = errors.New("PKCS#11 support requires building walletd with the pkcs11 tag")
+
+// A PKCS11Signer signs hashes with Ed25519 keys stored in a PKCS#11 token.
+// This build does not support PKCS#11.
+type PKCS11Signer struct{}
+
+// SignHash implements Signer.
+func (ps *PKCS11Signer) SignHash(context.Context, types.PublicKey, types.Hash256) (types.Signature, error) {
+	return types.Signature{}, errPKCS11Disabled
+}
+
+// Close implements io.Closer.
+func (ps *PKCS11Signer) Close() error { return nil }
+
+// NewPKCS11Signer returns an error; walletd must be built with the pkcs11
+// tag to use PKCS#11 tokens.
+func NewPKCS11Signer(modulePath, tokenLabel, pin string, keyLabels []string) (*PKCS11Signer, error) {
+	return nil, errPKCS11Disabled
+}
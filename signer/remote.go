@@ -0,0 +1,87 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.thebigfile.com/core/types"
+)
+
+// maxResponseSize is the maximum size of a remote signer's response.
+const maxResponseSize = 1 << 16 // 64 KiB
+
+type (
+	// A SignRequest is the request sent to a remote signer.
+	SignRequest struct {
+		PublicKey types.PublicKey `json:"publicKey"`
+		Hash      types.Hash256   `json:"hash"`
+	}
+
+	// A SignResponse is the response of a remote signer.
+	SignResponse struct {
+		Signature types.Signature `json:"signature"`
+	}
+
+	// A RemoteSigner delegates signing to an external signing service over
+	// HTTP. Each hash is POSTed to the service's URL as a SignRequest and
+	// the service responds with a SignResponse, or 404 Not Found if it
+	// does not hold the key.
+	RemoteSigner struct {
+		url      string
+		password string
+		client   *http.Client
+	}
+)
+
+// SignHash implements Signer.
+func (rs *RemoteSigner) SignHash(ctx context.Context, pk types.PublicKey, hash types.Hash256) (types.Signature, error) {
+	buf, err := json.Marshal(SignRequest{PublicKey: pk, Hash: hash})
+	if err != nil {
+		return types.Signature{}, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rs.url, bytes.NewReader(buf))
+	if err != nil {
+		return types.Signature{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if rs.password != "" {
+		req.SetBasicAuth("", rs.password)
+	}
+
+	resp, err := rs.client.Do(req)
+	if err != nil {
+		return types.Signature{}, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	r := io.LimitReader(resp.Body, maxResponseSize)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return types.Signature{}, ErrUnknownKey
+	case resp.StatusCode != http.StatusOK:
+		msg, _ := io.ReadAll(r)
+		return types.Signature{}, fmt.Errorf("remote signer returned %v: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var sr SignResponse
+	if err := json.NewDecoder(r).Decode(&sr); err != nil {
+		return types.Signature{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return sr.Signature, nil
+}
+
+// NewRemoteSigner returns a signer that sends signing requests to url. If
+// password is not empty, requests are authenticated with HTTP basic auth.
+func NewRemoteSigner(url, password string) *RemoteSigner {
+	return &RemoteSigner{
+		url:      url,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
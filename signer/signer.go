@@ -0,0 +1,318 @@
+package signer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned when a signer is not configured.
+	ErrNotFound = errors.New("signer not found")
+	// ErrNoSigner is returned when signing for a wallet that is not
+	// assigned a signer.
+	ErrNoSigner = errors.New("wallet does not have a signer")
+	// ErrUnknownKey is returned by a Signer that does not hold the key for
+	// a public key.
+	ErrUnknownKey = errors.New("signer does not hold key")
+	// ErrUnsupportedPolicy is returned when an input's spend policy cannot
+	// be satisfied by a signer.
+	ErrUnsupportedPolicy = errors.New("unsupported spend policy")
+)
+
+type (
+	// A Signer signs hashes with keys held outside of walletd, such as in an
+	// HSM or a remote signing service.
+	Signer interface {
+		// SignHash signs the hash with the private key of pk. It returns
+		// ErrUnknownKey if the signer does not hold the key.
+		SignHash(ctx context.Context, pk types.PublicKey, hash types.Hash256) (types.Signature, error)
+	}
+
+	// A Store persists the signer assigned to each wallet.
+	Store interface {
+		// WalletSigner returns the name of the signer assigned to a
+		// wallet, or an empty string if the wallet does not have one.
+		WalletSigner(wallet.ID) (string, error)
+		// SetWalletSigner assigns a signer to a wallet. An empty name
+		// removes the wallet's signer.
+		SetWalletSigner(id wallet.ID, name string) error
+	}
+
+	// A ChainManager provides the chain state used to compute signature
+	// hashes.
+	ChainManager interface {
+		TipState() consensus.State
+	}
+
+	// A WalletManager provides the addresses of a wallet.
+	WalletManager interface {
+		Addresses(wallet.ID) ([]wallet.Address, error)
+	}
+
+	// A KeyStore provides signers for wallets with a seed stored by walletd.
+	KeyStore interface {
+		// WalletSigner returns a signer using the wallet's stored seed. It
+		// returns ErrNoSigner if the wallet does not have a stored seed.
+		WalletSigner(wallet.ID) (Signer, error)
+	}
+
+	// A Manager signs wallet transactions with the signer assigned to each
+	// wallet. Private keys are never held by the manager.
+	Manager struct {
+		store Store
+		cm    ChainManager
+		wm    WalletManager
+		ks    KeyStore
+		log   *zap.Logger
+
+		signers map[string]Signer
+	}
+)
+
+// policyKeys returns the public keys that must sign to satisfy a spend
+// policy.
+func policyKeys(p types.SpendPolicy) ([]types.PublicKey, error) {
+	switch p := p.Type.(type) {
+	case types.PolicyTypePublicKey:
+		return []types.PublicKey{types.PublicKey(p)}, nil
+	case types.PolicyTypeUnlockConditions:
+		if p.SignaturesRequired > uint64(len(p.PublicKeys)) {
+			return nil, fmt.Errorf("%w: unlock conditions require more signatures than keys", ErrUnsupportedPolicy)
+		}
+		keys := make([]types.PublicKey, 0, p.SignaturesRequired)
+		for _, uk := range p.PublicKeys[:p.SignaturesRequired] {
+			if uk.Algorithm != types.SpecifierEd25519 || len(uk.Key) != len(types.PublicKey{}) {
+				return nil, fmt.Errorf("%w: unlock conditions contain a non-ed25519 key", ErrUnsupportedPolicy)
+			}
+			keys = append(keys, types.PublicKey(uk.Key))
+		}
+		return keys, nil
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedPolicy, p)
+	}
+}
+
+// walletSigner returns the signer assigned to a wallet. Wallets without an
+// assigned signer use their stored seed, if any.
+func (m *Manager) walletSigner(id wallet.ID) (Signer, error) {
+	name, err := m.store.WalletSigner(id)
+	if err != nil {
+		return nil, err
+	} else if name == "" && m.ks != nil {
+		return m.ks.WalletSigner(id)
+	} else if name == "" {
+		return nil, ErrNoSigner
+	}
+	s, ok := m.signers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return s, nil
+}
+
+// walletPolicies returns the spend policies of a wallet's addresses. Addresses
+// without a spend policy map to an empty policy.
+func (m *Manager) walletPolicies(id wallet.ID) (map[types.Address]types.SpendPolicy, error) {
+	addrs, err := m.wm.Addresses(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	policies := make(map[types.Address]types.SpendPolicy, len(addrs))
+	for _, addr := range addrs {
+		if addr.SpendPolicy != nil {
+			policies[addr.Address] = *addr.SpendPolicy
+		} else {
+			policies[addr.Address] = types.SpendPolicy{}
+		}
+	}
+	return policies, nil
+}
+
+// signHash signs a hash and checks the returned signature.
+func signHash(ctx context.Context, s Signer, pk types.PublicKey, hash types.Hash256) (types.Signature, error) {
+	sig, err := s.SignHash(ctx, pk, hash)
+	if err != nil {
+		return types.Signature{}, fmt.Errorf("failed to sign with key %v: %w", pk, err)
+	} else if !pk.VerifyHash(hash, sig) {
+		return types.Signature{}, fmt.Errorf("signer returned an invalid signature for key %v", pk)
+	}
+	return sig, nil
+}
+
+// Signers returns the names of the configured signers.
+func (m *Manager) Signers() []string {
+	names := make([]string, 0, len(m.signers))
+	for name := range m.signers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// WalletSigner returns the name of the signer assigned to a wallet.
+func (m *Manager) WalletSigner(id wallet.ID) (string, error) {
+	return m.store.WalletSigner(id)
+}
+
+// SetWalletSigner assigns a configured signer to a wallet. An empty name
+// removes the wallet's signer.
+func (m *Manager) SetWalletSigner(id wallet.ID, name string) error {
+	if _, ok := m.signers[name]; !ok && name != "" {
+		return fmt.Errorf("%w: %q", ErrNotFound, name)
+	}
+	return m.store.SetWalletSigner(id, name)
+}
+
+// SignV2Transaction signs each input of txn that spends one of the wallet's
+// addresses. Inputs without a satisfied policy use the spend policy of
+// their address. Other inputs are left unchanged.
+func (m *Manager) SignV2Transaction(ctx context.Context, id wallet.ID, txn types.V2Transaction) (types.V2Transaction, error) {
+	s, err := m.walletSigner(id)
+	if err != nil {
+		return types.V2Transaction{}, err
+	}
+	policies, err := m.walletPolicies(id)
+	if err != nil {
+		return types.V2Transaction{}, err
+	}
+
+	sigHash := m.cm.TipState().InputSigHash(txn)
+	satisfy := func(addr types.Address, sp *types.SatisfiedPolicy) error {
+		policy, ok := policies[addr]
+		if !ok {
+			return nil
+		} else if sp.Policy.Type == nil {
+			sp.Policy = policy
+		}
+		keys, err := policyKeys(sp.Policy)
+		if err != nil {
+			return err
+		}
+		sp.Signatures = sp.Signatures[:0]
+		for _, pk := range keys {
+			sig, err := signHash(ctx, s, pk, sigHash)
+			if err != nil {
+				return err
+			}
+			sp.Signatures = append(sp.Signatures, sig)
+		}
+		return nil
+	}
+
+	txn.SiacoinInputs = append([]types.V2SiacoinInput(nil), txn.SiacoinInputs...)
+	for i := range txn.SiacoinInputs {
+		sci := &txn.SiacoinInputs[i]
+		if err := satisfy(sci.Parent.SiacoinOutput.Address, &sci.SatisfiedPolicy); err != nil {
+			return types.V2Transaction{}, fmt.Errorf("failed to sign siacoin input %d: %w", i, err)
+		}
+	}
+	txn.SiafundInputs = append([]types.V2SiafundInput(nil), txn.SiafundInputs...)
+	for i := range txn.SiafundInputs {
+		sfi := &txn.SiafundInputs[i]
+		if err := satisfy(sfi.Parent.SiafundOutput.Address, &sfi.SatisfiedPolicy); err != nil {
+			return types.V2Transaction{}, fmt.Errorf("failed to sign siafund input %d: %w", i, err)
+		}
+	}
+	m.log.Debug("signed v2 transaction", zap.Int64("wallet", int64(id)), zap.Stringer("sigHash", sigHash))
+	return txn, nil
+}
+
+// SignTransaction fills in the signatures of txn with the given parent IDs.
+// Each signature must already be present in txn and belong to an input
+// spending one of the wallet's addresses.
+func (m *Manager) SignTransaction(ctx context.Context, id wallet.ID, txn types.Transaction, toSign []types.Hash256) (types.Transaction, error) {
+	s, err := m.walletSigner(id)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+	policies, err := m.walletPolicies(id)
+	if err != nil {
+		return types.Transaction{}, err
+	}
+
+	unlockConditions := func(parentID types.Hash256) (types.UnlockConditions, bool) {
+		for _, sci := range txn.SiacoinInputs {
+			if types.Hash256(sci.ParentID) == parentID {
+				return sci.UnlockConditions, true
+			}
+		}
+		for _, sfi := range txn.SiafundInputs {
+			if types.Hash256(sfi.ParentID) == parentID {
+				return sfi.UnlockConditions, true
+			}
+		}
+		return types.UnlockConditions{}, false
+	}
+
+	cs := m.cm.TipState()
+	txn.Signatures = append([]types.TransactionSignature(nil), txn.Signatures...)
+outer:
+	for _, parentID := range toSign {
+		uc, ok := unlockConditions(parentID)
+		if !ok {
+			return types.Transaction{}, fmt.Errorf("ID %v not present in transaction", parentID)
+		} else if _, ok := policies[uc.UnlockHash()]; !ok {
+			return types.Transaction{}, fmt.Errorf("input %v does not belong to wallet", parentID)
+		}
+		for i, tsig := range txn.Signatures {
+			if tsig.ParentID != parentID {
+				continue
+			} else if tsig.PublicKeyIndex >= uint64(len(uc.PublicKeys)) {
+				return types.Transaction{}, fmt.Errorf("signature %v has invalid public key index", parentID)
+			}
+			uk := uc.PublicKeys[tsig.PublicKeyIndex]
+			if uk.Algorithm != types.SpecifierEd25519 || len(uk.Key) != len(types.PublicKey{}) {
+				return types.Transaction{}, fmt.Errorf("%w: signature %v is not for an ed25519 key", ErrUnsupportedPolicy, parentID)
+			}
+
+			var sigHash types.Hash256
+			if tsig.CoveredFields.WholeTransaction {
+				sigHash = cs.WholeSigHash(txn, tsig.ParentID, tsig.PublicKeyIndex, tsig.Timelock, tsig.CoveredFields.Signatures)
+			} else {
+				sigHash = cs.PartialSigHash(txn, tsig.CoveredFields)
+			}
+			sig, err := signHash(ctx, s, types.PublicKey(uk.Key), sigHash)
+			if err != nil {
+				return types.Transaction{}, err
+			}
+			txn.Signatures[i].Signature = sig[:]
+			continue outer
+		}
+		return types.Transaction{}, fmt.Errorf("signature %v not present in transaction", parentID)
+	}
+	return txn, nil
+}
+
+// Close closes the manager's signers.
+func (m *Manager) Close() error {
+	for name, s := range m.signers {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				m.log.Warn("failed to close signer", zap.String("signer", name), zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+// NewManager creates a new signer manager.
+func NewManager(store Store, cm ChainManager, wm WalletManager, opts ...Option) *Manager {
+	m := &Manager{
+		store: store,
+		cm:    cm,
+		wm:    wm,
+		log:   zap.NewNop(),
+
+		signers: make(map[string]Signer),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
@@ -0,0 +1,240 @@
+package signer_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct{}
+
+func (chainManager) TipState() consensus.State { return consensus.State{} }
+
+type walletManager struct {
+	addrs []wallet.Address
+}
+
+func (wm walletManager) Addresses(wallet.ID) ([]wallet.Address, error) { return wm.addrs, nil }
+
+// newSigningService returns a remote signing service holding the given keys.
+func newSigningService(t *testing.T, password string, keys ...types.PrivateKey) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pass, _ := r.BasicAuth(); pass != password {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req signer.SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, sk := range keys {
+			if sk.PublicKey() == req.PublicKey {
+				json.NewEncoder(w).Encode(signer.SignResponse{Signature: sk.SignHash(req.Hash)})
+				return
+			}
+		}
+		http.Error(w, "unknown key", http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRemoteSigner(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk := types.GeneratePrivateKey()
+	policy := types.PolicyPublicKey(sk.PublicKey())
+	addr := wallet.Address{Address: policy.Address(), SpendPolicy: &policy}
+	srv := newSigningService(t, "foo", sk)
+
+	sm := signer.NewManager(db, chainManager{}, walletManager{addrs: []wallet.Address{addr}},
+		signer.WithLogger(log.Named("signer")),
+		signer.WithSigner("hsm", signer.NewRemoteSigner(srv.URL, "foo")),
+		signer.WithSigner("unauthorized", signer.NewRemoteSigner(srv.URL, "bar")),
+		signer.WithSigner("empty", signer.NewRemoteSigner(newSigningService(t, "").URL, "")))
+	defer sm.Close()
+
+	txn := types.V2Transaction{
+		SiacoinInputs: []types.V2SiacoinInput{
+			{Parent: types.SiacoinElement{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: addr.Address, Value: types.Siacoins(10)}}},
+			// inputs from other wallets are not signed
+			{Parent: types.SiacoinElement{ID: types.SiacoinOutputID{2}, SiacoinOutput: types.SiacoinOutput{Address: types.VoidAddress, Value: types.Siacoins(10)}}},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: types.VoidAddress, Value: types.Siacoins(20)}},
+	}
+
+	if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, signer.ErrNoSigner) {
+		t.Fatalf("expected ErrNoSigner, got %v", err)
+	} else if err := sm.SetWalletSigner(w.ID, "missing"); !errors.Is(err, signer.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if err := sm.SetWalletSigner(w.ID+1, "hsm"); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected wallet.ErrNotFound, got %v", err)
+	}
+
+	// signers that reject the request or do not hold the key should fail
+	if err := sm.SetWalletSigner(w.ID, "unauthorized"); err != nil {
+		t.Fatal(err)
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); err == nil {
+		t.Fatal("expected unauthorized signer to fail")
+	} else if err := sm.SetWalletSigner(w.ID, "empty"); err != nil {
+		t.Fatal(err)
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, signer.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+
+	if err := sm.SetWalletSigner(w.ID, "hsm"); err != nil {
+		t.Fatal(err)
+	} else if name, err := sm.WalletSigner(w.ID); err != nil {
+		t.Fatal(err)
+	} else if name != "hsm" {
+		t.Fatalf("expected signer %q, got %q", "hsm", name)
+	}
+
+	signed, err := sm.SignV2Transaction(context.Background(), w.ID, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigHash := consensus.State{}.InputSigHash(signed)
+	if sigs := signed.SiacoinInputs[0].SatisfiedPolicy.Signatures; len(sigs) != 1 {
+		t.Fatalf("expected 1 signature, got %d", len(sigs))
+	} else if !sk.PublicKey().VerifyHash(sigHash, sigs[0]) {
+		t.Fatal("invalid signature")
+	} else if signed.SiacoinInputs[0].SatisfiedPolicy.Policy.Address() != addr.Address {
+		t.Fatal("expected input policy to be set")
+	} else if len(signed.SiacoinInputs[1].SatisfiedPolicy.Signatures) != 0 {
+		t.Fatal("expected foreign input to be unsigned")
+	} else if len(txn.SiacoinInputs[0].SatisfiedPolicy.Signatures) != 0 {
+		t.Fatal("expected original transaction to be unchanged")
+	}
+
+	// removing the signer should prevent signing
+	if err := sm.SetWalletSigner(w.ID, ""); err != nil {
+		t.Fatal(err)
+	} else if _, err := sm.SignV2Transaction(context.Background(), w.ID, txn); !errors.Is(err, signer.ErrNoSigner) {
+		t.Fatalf("expected ErrNoSigner, got %v", err)
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk := types.GeneratePrivateKey()
+	policy := types.PolicyPublicKey(sk.PublicKey())
+	addr := wallet.Address{Address: policy.Address(), SpendPolicy: &policy}
+	sm := signer.NewManager(db, chainManager{}, walletManager{addrs: []wallet.Address{addr}},
+		signer.WithLogger(log.Named("signer")),
+		signer.WithSigner("hsm", signer.NewRemoteSigner(newSigningService(t, "foo", sk).URL, "foo")))
+	defer sm.Close()
+
+	const msg = "I control this address"
+	if _, err := sm.SignMessage(context.Background(), w.ID, addr.Address, msg); !errors.Is(err, signer.ErrNoSigner) {
+		t.Fatalf("expected ErrNoSigner, got %v", err)
+	} else if err := sm.SetWalletSigner(w.ID, "hsm"); err != nil {
+		t.Fatal(err)
+	} else if _, err := sm.SignMessage(context.Background(), w.ID, types.Address{1}, msg); !errors.Is(err, signer.ErrNotWalletAddress) {
+		t.Fatalf("expected ErrNotWalletAddress, got %v", err)
+	}
+
+	signed, err := sm.SignMessage(context.Background(), w.ID, addr.Address, msg)
+	if err != nil {
+		t.Fatal(err)
+	} else if signed.PublicKey != sk.PublicKey() || signed.Message != msg {
+		t.Fatalf("unexpected signed message %+v", signed)
+	} else if err := signer.VerifyMessage(signed); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := signed
+	tampered.Message = "I control every address"
+	if err := signer.VerifyMessage(tampered); !errors.Is(err, signer.ErrInvalidMessageSignature) {
+		t.Fatalf("expected ErrInvalidMessageSignature, got %v", err)
+	}
+	other := types.GeneratePrivateKey()
+	forged := signed
+	forged.PublicKey, forged.Signature = other.PublicKey(), other.SignHash(signer.MessageHash(msg))
+	if err := signer.VerifyMessage(forged); !errors.Is(err, signer.ErrInvalidMessageSignature) {
+		t.Fatalf("expected ErrInvalidMessageSignature, got %v", err)
+	}
+}
+
+func TestGenerateTestVectors(t *testing.T) {
+	tv, err := signer.GenerateTestVectors(context.Background(), consensus.State{})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(tv.Keys) != 3 || len(tv.Transactions) != 2 || len(tv.V2Transactions) != 2 || len(tv.Messages) != 2 {
+		t.Fatalf("unexpected number of vectors: %d keys, %d v1, %d v2, %d messages", len(tv.Keys), len(tv.Transactions), len(tv.V2Transactions), len(tv.Messages))
+	}
+
+	// the vectors must be deterministic
+	again, err := signer.GenerateTestVectors(context.Background(), consensus.State{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := json.Marshal(tv)
+	b, _ := json.Marshal(again)
+	if string(a) != string(b) {
+		t.Fatal("test vectors are not deterministic")
+	}
+
+	keys := make(map[types.PublicKey]bool)
+	for _, key := range tv.Keys {
+		keys[key.PublicKey] = true
+	}
+	for _, v := range tv.Transactions {
+		if len(v.SigHashes) != len(v.Transaction.Signatures) {
+			t.Fatalf("%q: expected %d sighashes, got %d", v.Description, len(v.Transaction.Signatures), len(v.SigHashes))
+		}
+		for i, tsig := range v.Transaction.Signatures {
+			pk := types.PublicKey(v.Transaction.SiacoinInputs[i].UnlockConditions.PublicKeys[0].Key)
+			if !pk.VerifyHash(v.SigHashes[i], types.Signature(tsig.Signature)) {
+				t.Fatalf("%q: invalid signature %d", v.Description, i)
+			}
+		}
+	}
+	for _, v := range tv.V2Transactions {
+		for i, sci := range v.Transaction.SiacoinInputs {
+			if len(sci.SatisfiedPolicy.Signatures) != 1 {
+				t.Fatalf("%q: expected 1 signature on input %d", v.Description, i)
+			}
+		}
+	}
+	for _, v := range tv.Messages {
+		if !keys[v.SignedMessage.PublicKey] {
+			t.Fatal("message signed by an unknown key")
+		} else if err := signer.VerifyMessage(v.SignedMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
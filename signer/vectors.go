@@ -0,0 +1,259 @@
+package signer
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	cwallet "go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/wallet"
+)
+
+// TestVectorPhrase is the published recovery phrase of the seed used to
+// generate signing test vectors. Its keys are public and must never hold
+// funds.
+const TestVectorPhrase = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// testVectorKeys is the number of keys derived for the test vectors.
+const testVectorKeys = 3
+
+type (
+	// A KeyVector is a key derived from the test vector seed and its
+	// addresses.
+	KeyVector struct {
+		Index uint64 `json:"index"`
+		// PrivateKey is the hex-encoded 64-byte ed25519 private key.
+		PrivateKey       string                 `json:"privateKey"`
+		PublicKey        types.PublicKey        `json:"publicKey"`
+		UnlockConditions types.UnlockConditions `json:"unlockConditions"`
+		// StandardAddress is the address of the key's standard unlock
+		// conditions. PolicyAddress is the address of its public key spend
+		// policy.
+		StandardAddress types.Address `json:"standardAddress"`
+		PolicyAddress   types.Address `json:"policyAddress"`
+	}
+
+	// A TransactionVector is a signed v1 transaction and the hash signed by
+	// each of its signatures.
+	TransactionVector struct {
+		Description string            `json:"description"`
+		SigHashes   []types.Hash256   `json:"sigHashes"`
+		Transaction types.Transaction `json:"transaction"`
+	}
+
+	// A V2TransactionVector is a signed v2 transaction and the hash signed
+	// by each of its inputs.
+	V2TransactionVector struct {
+		Description string              `json:"description"`
+		SigHash     types.Hash256       `json:"sigHash"`
+		Transaction types.V2Transaction `json:"transaction"`
+	}
+
+	// A MessageVector is a signed message and the hash signed for it.
+	MessageVector struct {
+		Hash          types.Hash256 `json:"hash"`
+		SignedMessage SignedMessage `json:"signedMessage"`
+	}
+
+	// TestVectors are canonical signing examples for integrators validating
+	// their own signing implementations. Signature hashes depend on the
+	// consensus state, so the vectors are generated at a chain index.
+	TestVectors struct {
+		Phrase  string           `json:"phrase"`
+		Network string           `json:"network"`
+		Index   types.ChainIndex `json:"index"`
+
+		Keys           []KeyVector           `json:"keys"`
+		Transactions   []TransactionVector   `json:"transactions"`
+		V2Transactions []V2TransactionVector `json:"v2Transactions"`
+		Messages       []MessageVector       `json:"messages"`
+	}
+)
+
+// vectorSigner signs with the keys of the test vector seed.
+type vectorSigner struct {
+	seed wallet.Seed
+}
+
+// SignHash implements Signer.
+func (vs vectorSigner) SignHash(_ context.Context, pk types.PublicKey, hash types.Hash256) (types.Signature, error) {
+	for i := uint64(0); i < testVectorKeys; i++ {
+		if vs.seed.PublicKey(i) == pk {
+			return vs.seed.PrivateKey(i).SignHash(hash), nil
+		}
+	}
+	return types.Signature{}, ErrUnknownKey
+}
+
+// vectorStore assigns the test vector signer to every wallet.
+type vectorStore struct{}
+
+func (vectorStore) WalletSigner(wallet.ID) (string, error)  { return "vectors", nil }
+func (vectorStore) SetWalletSigner(wallet.ID, string) error { return nil }
+
+type vectorChain struct {
+	cs consensus.State
+}
+
+func (vc vectorChain) TipState() consensus.State { return vc.cs }
+
+type vectorWallet struct {
+	addrs []wallet.Address
+}
+
+func (vw vectorWallet) Addresses(wallet.ID) ([]wallet.Address, error) { return vw.addrs, nil }
+
+// vectorOutputID returns a deterministic output ID for the test vectors.
+func vectorOutputID(i int) types.SiacoinOutputID {
+	return types.SiacoinOutputID(types.HashBytes([]byte(fmt.Sprintf("walletd/vectors/output/%d", i))))
+}
+
+// GenerateTestVectors signs example transactions and messages with the keys
+// of the test vector seed. The signatures are made by a Manager, so they are
+// produced by the same code that signs wallet transactions.
+func GenerateTestVectors(ctx context.Context, cs consensus.State) (TestVectors, error) {
+	var entropy [32]byte
+	if err := cwallet.SeedFromPhrase(&entropy, TestVectorPhrase); err != nil {
+		return TestVectors{}, fmt.Errorf("failed to parse test vector phrase: %w", err)
+	}
+	seed := wallet.NewSeedFromEntropy(&entropy)
+
+	var network string
+	if cs.Network != nil {
+		network = cs.Network.Name
+	}
+	tv := TestVectors{
+		Phrase:  TestVectorPhrase,
+		Network: network,
+		Index:   cs.Index,
+	}
+	var addrs []wallet.Address
+	for i := uint64(0); i < testVectorKeys; i++ {
+		pk := seed.PublicKey(i)
+		uc := types.UnlockConditions{
+			PublicKeys:         []types.UnlockKey{pk.UnlockKey()},
+			SignaturesRequired: 1,
+		}
+		ucPolicy := types.SpendPolicy{Type: types.PolicyTypeUnlockConditions(uc)}
+		pkPolicy := types.PolicyPublicKey(pk)
+		tv.Keys = append(tv.Keys, KeyVector{
+			Index:            i,
+			PrivateKey:       hex.EncodeToString(seed.PrivateKey(i)),
+			PublicKey:        pk,
+			UnlockConditions: uc,
+			StandardAddress:  uc.UnlockHash(),
+			PolicyAddress:    pkPolicy.Address(),
+		})
+		addrs = append(addrs,
+			wallet.Address{Address: uc.UnlockHash(), SpendPolicy: &ucPolicy},
+			wallet.Address{Address: pkPolicy.Address(), SpendPolicy: &pkPolicy})
+	}
+
+	m := NewManager(vectorStore{}, vectorChain{cs}, vectorWallet{addrs}, WithSigner("vectors", vectorSigner{seed}))
+	keys := tv.Keys
+
+	// v1 transactions sign the whole transaction with standard unlock
+	// conditions
+	v1 := func(desc string, inputs []int, outputs []types.SiacoinOutput, fee types.Currency) error {
+		txn := types.Transaction{SiacoinOutputs: outputs, MinerFees: []types.Currency{fee}}
+		var toSign []types.Hash256
+		for i, key := range inputs {
+			parentID := vectorOutputID(i)
+			txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
+				ParentID:         parentID,
+				UnlockConditions: keys[key].UnlockConditions,
+			})
+			txn.Signatures = append(txn.Signatures, types.TransactionSignature{
+				ParentID:      types.Hash256(parentID),
+				CoveredFields: types.CoveredFields{WholeTransaction: true},
+			})
+			toSign = append(toSign, types.Hash256(parentID))
+		}
+		var sigHashes []types.Hash256
+		for _, tsig := range txn.Signatures {
+			sigHashes = append(sigHashes, cs.WholeSigHash(txn, tsig.ParentID, tsig.PublicKeyIndex, tsig.Timelock, nil))
+		}
+		signed, err := m.SignTransaction(ctx, 0, txn, toSign)
+		if err != nil {
+			return fmt.Errorf("failed to sign %q: %w", desc, err)
+		}
+		tv.Transactions = append(tv.Transactions, TransactionVector{
+			Description: desc,
+			SigHashes:   sigHashes,
+			Transaction: signed,
+		})
+		return nil
+	}
+
+	// v2 transactions sign the input signature hash with public key spend
+	// policies
+	v2 := func(desc string, inputs []int, values []types.Currency, outputs []types.SiacoinOutput, fee types.Currency) error {
+		txn := types.V2Transaction{SiacoinOutputs: outputs, MinerFee: fee}
+		for i, key := range inputs {
+			txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+				Parent: types.SiacoinElement{
+					ID:            vectorOutputID(i),
+					StateElement:  types.StateElement{LeafIndex: uint64(i)},
+					SiacoinOutput: types.SiacoinOutput{Address: keys[key].PolicyAddress, Value: values[i]},
+				},
+			})
+		}
+		signed, err := m.SignV2Transaction(ctx, 0, txn)
+		if err != nil {
+			return fmt.Errorf("failed to sign %q: %w", desc, err)
+		}
+		tv.V2Transactions = append(tv.V2Transactions, V2TransactionVector{
+			Description: desc,
+			SigHash:     cs.InputSigHash(signed),
+			Transaction: signed,
+		})
+		return nil
+	}
+
+	err := v1("one input, one output", []int{0},
+		[]types.SiacoinOutput{{Address: keys[1].StandardAddress, Value: types.Siacoins(99)}},
+		types.Siacoins(1))
+	if err != nil {
+		return TestVectors{}, err
+	}
+	err = v1("two inputs from different keys, payment and change", []int{0, 1},
+		[]types.SiacoinOutput{
+			{Address: keys[2].StandardAddress, Value: types.Siacoins(150)},
+			{Address: keys[0].StandardAddress, Value: types.Siacoins(49)},
+		},
+		types.Siacoins(1))
+	if err != nil {
+		return TestVectors{}, err
+	}
+	err = v2("one input, one output", []int{0},
+		[]types.Currency{types.Siacoins(100)},
+		[]types.SiacoinOutput{{Address: keys[1].PolicyAddress, Value: types.Siacoins(99)}},
+		types.Siacoins(1))
+	if err != nil {
+		return TestVectors{}, err
+	}
+	err = v2("two inputs from different keys, payment and change", []int{0, 1},
+		[]types.Currency{types.Siacoins(100), types.Siacoins(100)},
+		[]types.SiacoinOutput{
+			{Address: keys[2].PolicyAddress, Value: types.Siacoins(150)},
+			{Address: keys[0].PolicyAddress, Value: types.Siacoins(49)},
+		},
+		types.Siacoins(1))
+	if err != nil {
+		return TestVectors{}, err
+	}
+
+	for _, msg := range []string{"", "walletd test vector"} {
+		signed, err := m.SignMessage(ctx, 0, keys[0].PolicyAddress, msg)
+		if err != nil {
+			return TestVectors{}, fmt.Errorf("failed to sign message %q: %w", msg, err)
+		}
+		tv.Messages = append(tv.Messages, MessageVector{
+			Hash:          MessageHash(msg),
+			SignedMessage: signed,
+		})
+	}
+	return tv, nil
+}
@@ -0,0 +1,38 @@
+package tags
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithFeed imports tags from a JSON feed at url, refreshing it every
+// interval. The feed is a JSON array of tags; only the address, label, and
+// category fields are used.
+func WithFeed(url string, interval time.Duration) Option {
+	return func(m *Manager) {
+		m.feedURL = url
+		if interval > 0 {
+			m.feedInterval = interval
+		}
+	}
+}
+
+// WithScheduler registers the address tag feed import as the "tags.feed"
+// job, so that an updated feed can be imported on demand.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
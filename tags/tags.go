@@ -0,0 +1,223 @@
+package tags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// sources indicate how a tag was added to the directory.
+const (
+	SourceManual = "manual"
+	SourceFeed   = "feed"
+)
+
+// common tag categories
+const (
+	CategoryExchange    = "exchange"
+	CategoryFoundation  = "foundation"
+	CategoryColdStorage = "coldStorage"
+)
+
+// maxFeedSize is the maximum size of a tag feed.
+const maxFeedSize = 16 << 20 // 16 MiB
+
+// ErrNotFound is returned when an address is not tagged.
+var ErrNotFound = errors.New("tag not found")
+
+type (
+	// A Tag labels a known external address.
+	Tag struct {
+		Address   types.Address `json:"address"`
+		Label     string        `json:"label"`
+		Category  string        `json:"category,omitempty"`
+		Source    string        `json:"source"`
+		DateAdded time.Time     `json:"dateAdded"`
+	}
+
+	// A Store persists address tags.
+	Store interface {
+		AddressTags() ([]Tag, error)
+		SetAddressTag(Tag) error
+		RemoveAddressTag(types.Address) error
+		// ReplaceFeedTags replaces every tag imported from a feed. Manually
+		// added tags take precedence over feed tags for the same address.
+		ReplaceFeedTags([]Tag) error
+	}
+
+	// A Manager maintains the directory of known addresses.
+	Manager struct {
+		store  Store
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		sched  *jobs.Scheduler
+		client *http.Client
+
+		feedURL      string
+		feedInterval time.Duration
+
+		mu   sync.Mutex
+		tags map[types.Address]Tag
+	}
+)
+
+// reload refreshes the in-memory directory from the store.
+func (m *Manager) reload() error {
+	tags, err := m.store.AddressTags()
+	if err != nil {
+		return fmt.Errorf("failed to load tags: %w", err)
+	}
+	dir := make(map[types.Address]Tag, len(tags))
+	for _, t := range tags {
+		dir[t.Address] = t
+	}
+	m.mu.Lock()
+	m.tags = dir
+	m.mu.Unlock()
+	return nil
+}
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// Tags returns every tagged address.
+func (m *Manager) Tags() []Tag {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tags := make([]Tag, 0, len(m.tags))
+	for _, t := range m.tags {
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// Tag returns the tag of an address.
+func (m *Manager) Tag(addr types.Address) (Tag, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tags[addr]
+	return t, ok
+}
+
+// SetTag manually tags an address, replacing any existing tag.
+func (m *Manager) SetTag(addr types.Address, label, category string) (Tag, error) {
+	if label == "" {
+		return Tag{}, errors.New("label is required")
+	}
+	t := Tag{
+		Address:   addr,
+		Label:     label,
+		Category:  category,
+		Source:    SourceManual,
+		DateAdded: time.Now(),
+	}
+	if err := m.store.SetAddressTag(t); err != nil {
+		return Tag{}, fmt.Errorf("failed to set tag: %w", err)
+	}
+	m.mu.Lock()
+	m.tags[addr] = t
+	m.mu.Unlock()
+	return t, nil
+}
+
+// RemoveTag removes the tag of an address.
+func (m *Manager) RemoveTag(addr types.Address) error {
+	if err := m.store.RemoveAddressTag(addr); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.tags, addr)
+	m.mu.Unlock()
+	return nil
+}
+
+// Import replaces the feed tags in the directory with tags. Manually added
+// tags are kept.
+func (m *Manager) Import(tags []Tag) error {
+	now := time.Now()
+	for i := range tags {
+		if tags[i].Label == "" {
+			return fmt.Errorf("tag %d (%v) has no label", i, tags[i].Address)
+		}
+		tags[i].Source = SourceFeed
+		tags[i].DateAdded = now
+	}
+	if err := m.store.ReplaceFeedTags(tags); err != nil {
+		return fmt.Errorf("failed to import tags: %w", err)
+	}
+	return m.reload()
+}
+
+// fetchFeed downloads and imports the tag feed.
+func (m *Manager) fetchFeed(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.feedURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	var tags []Tag
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxFeedSize)).Decode(&tags); err != nil {
+		return fmt.Errorf("failed to decode feed: %w", err)
+	}
+	return m.Import(tags)
+}
+
+// NewManager creates a new tag manager. If a feed is configured, it is
+// imported in the background and refreshed periodically.
+func NewManager(store Store, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store:  store,
+		log:    zap.NewNop(),
+		tg:     threadgroup.New(),
+		client: &http.Client{Timeout: 30 * time.Second},
+
+		feedInterval: 24 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	if m.feedURL == "" {
+		return m, nil
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "tags.feed", "imports the address tag feed", m.feedInterval, true, func(ctx context.Context) error {
+			err := m.fetchFeed(ctx)
+			if err != nil {
+				m.log.Warn("failed to import tag feed", zap.String("url", m.feedURL), zap.Error(err))
+			}
+			return err
+		})
+	}()
+	return m, nil
+}
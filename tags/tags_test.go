@@ -0,0 +1,103 @@
+package tags_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/tags"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTags(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	exchange := types.Address{1}
+	foundation := types.Address{2}
+	cold := types.Address{3}
+
+	feed := make(chan []tags.Tag, 1)
+	feed <- []tags.Tag{
+		{Address: exchange, Label: "Exchange", Category: tags.CategoryExchange},
+		{Address: foundation, Label: "Foundation", Category: tags.CategoryFoundation},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case tt := <-feed:
+			json.NewEncoder(w).Encode(tt)
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	tm, err := tags.NewManager(db, tags.WithLogger(log.Named("tags")), tags.WithFeed(srv.URL, 50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tm.Close()
+
+	waitForTags := func(n int) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if len(tm.Tags()) == n {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("expected %d tags, got %d", n, len(tm.Tags()))
+	}
+	waitForTags(2)
+
+	if tag, ok := tm.Tag(exchange); !ok {
+		t.Fatal("expected exchange to be tagged")
+	} else if tag.Label != "Exchange" || tag.Source != tags.SourceFeed {
+		t.Fatalf("unexpected tag %+v", tag)
+	}
+
+	if _, err := tm.SetTag(cold, "", tags.CategoryColdStorage); err == nil {
+		t.Fatal("expected error for missing label")
+	} else if _, err := tm.SetTag(cold, "Cold storage", tags.CategoryColdStorage); err != nil {
+		t.Fatal(err)
+	} else if _, err := tm.SetTag(exchange, "My exchange account", tags.CategoryExchange); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next feed drops the foundation and renames the exchange; the
+	// manual tags should be kept
+	feed <- []tags.Tag{
+		{Address: exchange, Label: "Renamed exchange", Category: tags.CategoryExchange},
+	}
+	waitForTags(2)
+	if tag, ok := tm.Tag(exchange); !ok || tag.Label != "My exchange account" || tag.Source != tags.SourceManual {
+		t.Fatalf("unexpected tag %+v", tag)
+	} else if _, ok := tm.Tag(foundation); ok {
+		t.Fatal("expected foundation tag to be removed")
+	}
+
+	// the directory should be loaded from the store
+	tm2, err := tags.NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tm2.Close()
+	if tag, ok := tm2.Tag(cold); !ok || tag.Label != "Cold storage" {
+		t.Fatalf("unexpected tag %+v", tag)
+	}
+
+	if err := tm.RemoveTag(cold); err != nil {
+		t.Fatal(err)
+	} else if err := tm.RemoveTag(cold); !errors.Is(err, tags.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package threshold
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithSessionTTL sets how long a signing session is kept before it expires.
+// The default is one hour.
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(m *Manager) {
+		if ttl > 0 {
+			m.sessionTTL = ttl
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package threshold
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+// session statuses
+const (
+	// StatusCommit sessions are collecting nonce commitments.
+	StatusCommit = "commit"
+	// StatusSign sessions are collecting signature shares from the
+	// participants that committed.
+	StatusSign = "sign"
+	// StatusComplete sessions have produced a valid signature.
+	StatusComplete = "complete"
+	// StatusFailed sessions produced an invalid signature. A new session
+	// must be started with fresh nonces.
+	StatusFailed = "failed"
+)
+
+var (
+	// ErrGroupNotFound is returned when a group does not exist.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrSessionNotFound is returned when a session does not exist or has
+	// expired.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrParticipantExists is returned when registering a participant
+	// identifier that is already registered.
+	ErrParticipantExists = errors.New("participant already registered")
+	// ErrUnknownParticipant is returned when a participant is not
+	// registered with a session's group or was not selected to sign.
+	ErrUnknownParticipant = errors.New("unknown participant")
+	// ErrDuplicateSubmission is returned when a participant submits a
+	// second commitment or share for a session.
+	ErrDuplicateSubmission = errors.New("participant already submitted")
+	// ErrWrongStatus is returned when a commitment or share is submitted
+	// to a session that is not collecting them.
+	ErrWrongStatus = errors.New("session is not accepting submissions")
+	// ErrInvalid is returned when a group, commitment, or share is
+	// malformed.
+	ErrInvalid = errors.New("invalid request")
+)
+
+// groupOrder is the order of the edwards25519 base point.
+var groupOrder, _ = new(big.Int).SetString("7237005577332262213973186563042994811857908960391810195474960843440592740317", 10)
+
+type (
+	// A Scalar is a little-endian edwards25519 scalar.
+	Scalar [32]byte
+	// A Point is a compressed edwards25519 point.
+	Point [32]byte
+
+	// A GroupID uniquely identifies a group.
+	GroupID int64
+
+	// A Participant holds one share of a group's key.
+	Participant struct {
+		// ID is the participant's FROST identifier, between 1 and the
+		// group's maximum number of participants.
+		ID             uint16    `json:"id"`
+		Name           string    `json:"name"`
+		DateRegistered time.Time `json:"dateRegistered"`
+	}
+
+	// A Group is a threshold key shared by its participants. The key is
+	// generated by the participants outside of walletd; walletd only
+	// coordinates signing.
+	Group struct {
+		ID              GroupID         `json:"id"`
+		Name            string          `json:"name"`
+		PublicKey       types.PublicKey `json:"publicKey"`
+		Threshold       int             `json:"threshold"`
+		MaxParticipants int             `json:"maxParticipants"`
+		Participants    []Participant   `json:"participants"`
+		DateCreated     time.Time       `json:"dateCreated"`
+	}
+
+	// A Commitment is a participant's pair of nonce commitments for a
+	// session.
+	Commitment struct {
+		Participant uint16 `json:"participant"`
+		Hiding      Point  `json:"hiding"`
+		Binding     Point  `json:"binding"`
+	}
+
+	// A Share is a participant's signature share for a session, along with
+	// the group commitment the participant derived from the session's
+	// commitments.
+	Share struct {
+		Participant     uint16 `json:"participant"`
+		GroupCommitment Point  `json:"groupCommitment"`
+		Share           Scalar `json:"share"`
+	}
+
+	// A Session coordinates a single threshold signature over a v2
+	// transaction's input sig hash. The first Threshold participants to
+	// submit commitments are selected to sign.
+	Session struct {
+		ID          types.Hash256       `json:"id"`
+		GroupID     GroupID             `json:"groupID"`
+		Status      string              `json:"status"`
+		Transaction types.V2Transaction `json:"transaction"`
+		Message     types.Hash256       `json:"message"`
+		// Commitments are sorted by participant once the signers have
+		// been selected.
+		Commitments []Commitment `json:"commitments"`
+		// Signers are the participants selected to sign, in order.
+		Signers []uint16 `json:"signers,omitempty"`
+		// Submitted are the signers that have submitted their shares.
+		Submitted  []uint16         `json:"submitted,omitempty"`
+		Signature  *types.Signature `json:"signature,omitempty"`
+		Error      string           `json:"error,omitempty"`
+		Expiration time.Time        `json:"expiration"`
+
+		shares map[uint16]Share
+	}
+
+	// A Store persists threshold groups.
+	Store interface {
+		AddThresholdGroup(Group) (Group, error)
+		ThresholdGroups() ([]Group, error)
+		// ThresholdGroup returns ErrGroupNotFound if the group does not
+		// exist.
+		ThresholdGroup(GroupID) (Group, error)
+		RemoveThresholdGroup(GroupID) error
+		// AddThresholdParticipant returns ErrParticipantExists if the
+		// identifier is already registered.
+		AddThresholdParticipant(GroupID, Participant) error
+	}
+
+	// A ChainManager provides the chain state used to compute signature
+	// hashes.
+	ChainManager interface {
+		TipState() consensus.State
+	}
+
+	// A Manager coordinates FROST threshold signing sessions between the
+	// participants of a group. Participants exchange nonce commitments and
+	// signature shares through the manager, which aggregates the shares into
+	// a single ed25519 signature. Sessions are kept in memory; nonces must
+	// never be reused, so sessions do not survive restarts.
+	Manager struct {
+		store Store
+		cm    ChainManager
+		log   *zap.Logger
+
+		sessionTTL time.Duration
+
+		mu       sync.Mutex
+		sessions map[types.Hash256]*Session
+	}
+)
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Scalar) MarshalText() ([]byte, error) { return []byte(hex.EncodeToString(s[:])), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Scalar) UnmarshalText(b []byte) error { return unmarshalHex(s[:], b) }
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Point) MarshalText() ([]byte, error) { return []byte(hex.EncodeToString(p[:])), nil }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Point) UnmarshalText(b []byte) error { return unmarshalHex(p[:], b) }
+
+func unmarshalHex(dst []byte, b []byte) error {
+	if hex.DecodedLen(len(b)) != len(dst) {
+		return fmt.Errorf("expected %d hex bytes, got %d", len(dst), hex.DecodedLen(len(b)))
+	}
+	_, err := hex.Decode(dst, b)
+	return err
+}
+
+// bigInt returns the scalar as an integer.
+func (s Scalar) bigInt() *big.Int {
+	be := make([]byte, len(s))
+	for i := range s {
+		be[len(s)-1-i] = s[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+// aggregateShares returns the sum of the shares modulo the group order.
+func aggregateShares(shares []Scalar) (sum Scalar, err error) {
+	z := new(big.Int)
+	for _, s := range shares {
+		n := s.bigInt()
+		if n.Cmp(groupOrder) >= 0 {
+			return Scalar{}, fmt.Errorf("%w: share is not a canonical scalar", ErrInvalid)
+		}
+		z.Add(z, n)
+	}
+	z.Mod(z, groupOrder)
+	be := z.FillBytes(make([]byte, len(sum)))
+	for i := range be {
+		sum[i] = be[len(be)-1-i]
+	}
+	return sum, nil
+}
+
+// clone returns a copy of the session that is safe to return to callers.
+func (s *Session) clone() Session {
+	c := *s
+	c.Commitments = append([]Commitment(nil), s.Commitments...)
+	c.Signers = append([]uint16(nil), s.Signers...)
+	c.Submitted = append([]uint16(nil), s.Submitted...)
+	c.shares = nil
+	return c
+}
+
+// isRegistered returns true if the participant is registered with the group.
+func (g Group) isRegistered(id uint16) bool {
+	for _, p := range g.Participants {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// session returns an unexpired session. The caller must hold m.mu.
+func (m *Manager) session(id types.Hash256) (*Session, error) {
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	} else if time.Now().After(s.Expiration) {
+		delete(m.sessions, id)
+		return nil, ErrSessionNotFound
+	}
+	return s, nil
+}
+
+// finalize aggregates the shares of a session once every signer has
+// submitted one. The caller must hold m.mu.
+func (m *Manager) finalize(s *Session, pk types.PublicKey) {
+	fail := func(msg string) {
+		s.Status = StatusFailed
+		s.Error = msg
+		m.log.Warn("threshold signing session failed", zap.Stringer("session", s.ID), zap.Int64("group", int64(s.GroupID)), zap.String("reason", msg))
+	}
+
+	// every signer must have derived the same group commitment
+	r := s.shares[s.Signers[0]].GroupCommitment
+	zs := make([]Scalar, 0, len(s.Signers))
+	for _, id := range s.Signers {
+		share := s.shares[id]
+		if share.GroupCommitment != r {
+			fail(fmt.Sprintf("participant %d derived a different group commitment", id))
+			return
+		}
+		zs = append(zs, share.Share)
+	}
+	z, err := aggregateShares(zs)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	var sig types.Signature
+	copy(sig[:32], r[:])
+	copy(sig[32:], z[:])
+	if !pk.VerifyHash(s.Message, sig) {
+		fail("aggregate signature is invalid")
+		return
+	}
+
+	// copy the inputs so sessions returned to callers are not modified
+	s.Transaction.SiacoinInputs = append([]types.V2SiacoinInput(nil), s.Transaction.SiacoinInputs...)
+	s.Transaction.SiafundInputs = append([]types.V2SiafundInput(nil), s.Transaction.SiafundInputs...)
+	for i := range s.Transaction.SiacoinInputs {
+		sp := &s.Transaction.SiacoinInputs[i].SatisfiedPolicy
+		if sp.Policy.Address() == types.PolicyPublicKey(pk).Address() {
+			sp.Signatures = []types.Signature{sig}
+		}
+	}
+	for i := range s.Transaction.SiafundInputs {
+		sp := &s.Transaction.SiafundInputs[i].SatisfiedPolicy
+		if sp.Policy.Address() == types.PolicyPublicKey(pk).Address() {
+			sp.Signatures = []types.Signature{sig}
+		}
+	}
+	s.Signature = &sig
+	s.Status = StatusComplete
+	s.shares = nil
+	m.log.Info("threshold signing session complete", zap.Stringer("session", s.ID), zap.Int64("group", int64(s.GroupID)))
+}
+
+// AddGroup adds a threshold group. Participants register with the group
+// separately.
+func (m *Manager) AddGroup(name string, pk types.PublicKey, threshold, maxParticipants int) (Group, error) {
+	switch {
+	case pk == (types.PublicKey{}):
+		return Group{}, fmt.Errorf("%w: public key is required", ErrInvalid)
+	case threshold < 1:
+		return Group{}, fmt.Errorf("%w: threshold must be at least 1", ErrInvalid)
+	case maxParticipants < threshold:
+		return Group{}, fmt.Errorf("%w: threshold %d exceeds the number of participants %d", ErrInvalid, threshold, maxParticipants)
+	case maxParticipants > 1<<16-1:
+		return Group{}, fmt.Errorf("%w: too many participants", ErrInvalid)
+	}
+	return m.store.AddThresholdGroup(Group{
+		Name:            name,
+		PublicKey:       pk,
+		Threshold:       threshold,
+		MaxParticipants: maxParticipants,
+		Participants:    []Participant{},
+		DateCreated:     time.Now().Truncate(time.Second),
+	})
+}
+
+// Groups returns all threshold groups.
+func (m *Manager) Groups() ([]Group, error) {
+	return m.store.ThresholdGroups()
+}
+
+// Group returns a threshold group.
+func (m *Manager) Group(id GroupID) (Group, error) {
+	return m.store.ThresholdGroup(id)
+}
+
+// RemoveGroup removes a threshold group and cancels its sessions.
+func (m *Manager) RemoveGroup(id GroupID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.store.RemoveThresholdGroup(id); err != nil {
+		return err
+	}
+	for sid, s := range m.sessions {
+		if s.GroupID == id {
+			delete(m.sessions, sid)
+		}
+	}
+	return nil
+}
+
+// RegisterParticipant registers a participant with a group.
+func (m *Manager) RegisterParticipant(groupID GroupID, id uint16, name string) (Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.store.ThresholdGroup(groupID)
+	if err != nil {
+		return Group{}, err
+	} else if id == 0 || int(id) > g.MaxParticipants {
+		return Group{}, fmt.Errorf("%w: participant identifier must be between 1 and %d", ErrInvalid, g.MaxParticipants)
+	}
+	p := Participant{ID: id, Name: name, DateRegistered: time.Now().Truncate(time.Second)}
+	if err := m.store.AddThresholdParticipant(groupID, p); err != nil {
+		return Group{}, err
+	}
+	return m.store.ThresholdGroup(groupID)
+}
+
+// StartSession starts a signing session for the inputs of txn controlled by
+// the group's key. The inputs' policies are set to the group's public key.
+func (m *Manager) StartSession(groupID GroupID, txn types.V2Transaction) (Session, error) {
+	g, err := m.store.ThresholdGroup(groupID)
+	if err != nil {
+		return Session{}, err
+	} else if len(g.Participants) < g.Threshold {
+		return Session{}, fmt.Errorf("%w: group has %d of %d required participants", ErrInvalid, len(g.Participants), g.Threshold)
+	}
+
+	policy := types.PolicyPublicKey(g.PublicKey)
+	addr := policy.Address()
+	txn.SiacoinInputs = append([]types.V2SiacoinInput(nil), txn.SiacoinInputs...)
+	txn.SiafundInputs = append([]types.V2SiafundInput(nil), txn.SiafundInputs...)
+	var controlled int
+	for i := range txn.SiacoinInputs {
+		if txn.SiacoinInputs[i].Parent.SiacoinOutput.Address == addr {
+			txn.SiacoinInputs[i].SatisfiedPolicy = types.SatisfiedPolicy{Policy: policy}
+			controlled++
+		}
+	}
+	for i := range txn.SiafundInputs {
+		if txn.SiafundInputs[i].Parent.SiafundOutput.Address == addr {
+			txn.SiafundInputs[i].SatisfiedPolicy = types.SatisfiedPolicy{Policy: policy}
+			controlled++
+		}
+	}
+	if controlled == 0 {
+		return Session{}, fmt.Errorf("%w: transaction does not spend any outputs of the group's address %v", ErrInvalid, addr)
+	}
+
+	s := &Session{
+		ID:          types.Hash256(frand.Entropy256()),
+		GroupID:     groupID,
+		Status:      StatusCommit,
+		Transaction: txn,
+		Message:     m.cm.TipState().InputSigHash(txn),
+		Commitments: []Commitment{},
+		Expiration:  time.Now().Add(m.sessionTTL),
+		shares:      make(map[uint16]Share),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[s.ID] = s
+	m.log.Info("started threshold signing session", zap.Stringer("session", s.ID), zap.Int64("group", int64(groupID)), zap.Stringer("message", s.Message))
+	return s.clone(), nil
+}
+
+// Sessions returns the unexpired signing sessions.
+func (m *Manager) Sessions() []Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := make([]Session, 0, len(m.sessions))
+	for id := range m.sessions {
+		if s, err := m.session(id); err == nil {
+			sessions = append(sessions, s.clone())
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Expiration.Before(sessions[j].Expiration)
+	})
+	return sessions
+}
+
+// Session returns a signing session.
+func (m *Manager) Session(id types.Hash256) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, err := m.session(id)
+	if err != nil {
+		return Session{}, err
+	}
+	return s.clone(), nil
+}
+
+// AddCommitment adds a participant's nonce commitments to a session. Once
+// the group's threshold of participants has committed, they are selected to
+// sign and the session starts collecting shares.
+func (m *Manager) AddCommitment(sessionID types.Hash256, c Commitment) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.session(sessionID)
+	if err != nil {
+		return Session{}, err
+	} else if s.Status != StatusCommit {
+		return Session{}, ErrWrongStatus
+	} else if c.Hiding == (Point{}) || c.Binding == (Point{}) {
+		return Session{}, fmt.Errorf("%w: commitments must not be empty", ErrInvalid)
+	}
+	for _, existing := range s.Commitments {
+		if existing.Participant == c.Participant {
+			return Session{}, ErrDuplicateSubmission
+		}
+	}
+	g, err := m.store.ThresholdGroup(s.GroupID)
+	if err != nil {
+		return Session{}, err
+	} else if !g.isRegistered(c.Participant) {
+		return Session{}, ErrUnknownParticipant
+	}
+
+	s.Commitments = append(s.Commitments, c)
+	if len(s.Commitments) == g.Threshold {
+		sort.Slice(s.Commitments, func(i, j int) bool {
+			return s.Commitments[i].Participant < s.Commitments[j].Participant
+		})
+		for _, c := range s.Commitments {
+			s.Signers = append(s.Signers, c.Participant)
+		}
+		s.Status = StatusSign
+	}
+	return s.clone(), nil
+}
+
+// AddShare adds a signer's signature share to a session. Once every signer
+// has submitted a share, the shares are aggregated and the signature is
+// added to the session's transaction.
+func (m *Manager) AddShare(sessionID types.Hash256, share Share) (Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, err := m.session(sessionID)
+	if err != nil {
+		return Session{}, err
+	} else if s.Status != StatusSign {
+		return Session{}, ErrWrongStatus
+	} else if _, ok := s.shares[share.Participant]; ok {
+		return Session{}, ErrDuplicateSubmission
+	}
+	var selected bool
+	for _, id := range s.Signers {
+		selected = selected || id == share.Participant
+	}
+	if !selected {
+		return Session{}, ErrUnknownParticipant
+	}
+
+	s.shares[share.Participant] = share
+	s.Submitted = append(s.Submitted, share.Participant)
+	if len(s.shares) == len(s.Signers) {
+		g, err := m.store.ThresholdGroup(s.GroupID)
+		if err != nil {
+			return Session{}, err
+		}
+		m.finalize(s, g.PublicKey)
+	}
+	return s.clone(), nil
+}
+
+// NewManager creates a new threshold signing coordinator.
+func NewManager(store Store, cm ChainManager, opts ...Option) *Manager {
+	m := &Manager{
+		store: store,
+		cm:    cm,
+		log:   zap.NewNop(),
+
+		sessionTTL: time.Hour,
+		sessions:   make(map[types.Hash256]*Session),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
@@ -0,0 +1,191 @@
+package threshold_test
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/threshold"
+	"go.uber.org/zap/zaptest"
+	"lukechampine.com/frand"
+)
+
+var groupOrder, _ = new(big.Int).SetString("7237005577332262213973186563042994811857908960391810195474960843440592740317", 10)
+
+type chainManager struct{}
+
+func (chainManager) TipState() consensus.State { return consensus.State{} }
+
+func scalarToInt(s []byte) *big.Int {
+	be := make([]byte, len(s))
+	for i := range s {
+		be[len(s)-1-i] = s[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
+
+func intToScalar(n *big.Int) (s threshold.Scalar) {
+	be := new(big.Int).Mod(n, groupOrder).FillBytes(make([]byte, 32))
+	for i := range be {
+		s[i] = be[len(be)-1-i]
+	}
+	return
+}
+
+// splitSignature splits the scalar of an ed25519 signature into n shares
+// that sum to it, mimicking the shares produced by FROST signers.
+func splitSignature(sig types.Signature, n int) (r threshold.Point, shares []threshold.Scalar) {
+	copy(r[:], sig[:32])
+	remaining := scalarToInt(sig[32:])
+	for i := 0; i < n-1; i++ {
+		share := new(big.Int).Mod(new(big.Int).SetBytes(frand.Bytes(32)), groupOrder)
+		shares = append(shares, intToScalar(share))
+		remaining.Sub(remaining, share)
+	}
+	return r, append(shares, intToScalar(remaining))
+}
+
+func randomPoint() (p threshold.Point) {
+	frand.Read(p[:])
+	return
+}
+
+func TestThresholdSigning(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := threshold.NewManager(db, chainManager{}, threshold.WithLogger(log.Named("threshold")))
+
+	sk := types.GeneratePrivateKey()
+	if _, err := m.AddGroup("custody", sk.PublicKey(), 3, 2); !errors.Is(err, threshold.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	g, err := m.AddGroup("custody", sk.PublicKey(), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := types.PolicyPublicKey(sk.PublicKey()).Address()
+	txn := types.V2Transaction{
+		SiacoinInputs: []types.V2SiacoinInput{
+			{Parent: types.SiacoinElement{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(10)}}},
+		},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: types.VoidAddress, Value: types.Siacoins(10)}},
+	}
+
+	// sessions require the threshold of participants to be registered
+	if _, err := m.RegisterParticipant(g.ID, 1, "alice"); err != nil {
+		t.Fatal(err)
+	} else if _, err := m.StartSession(g.ID, txn); !errors.Is(err, threshold.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	} else if _, err := m.RegisterParticipant(g.ID, 1, "mallory"); !errors.Is(err, threshold.ErrParticipantExists) {
+		t.Fatalf("expected ErrParticipantExists, got %v", err)
+	} else if _, err := m.RegisterParticipant(g.ID, 4, "mallory"); !errors.Is(err, threshold.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+	for i, name := range []string{"bob", "carol"} {
+		if _, err := m.RegisterParticipant(g.ID, uint16(i+2), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if g, err := m.Group(g.ID); err != nil {
+		t.Fatal(err)
+	} else if len(g.Participants) != 3 {
+		t.Fatalf("expected 3 participants, got %d", len(g.Participants))
+	}
+
+	// sign runs a session with participants 3 and 1, passing each share
+	// through tamper before it is submitted.
+	sign := func(tamper func(i int, share *threshold.Share)) threshold.Session {
+		t.Helper()
+
+		session, err := m.StartSession(g.ID, txn)
+		if err != nil {
+			t.Fatal(err)
+		} else if session.Status != threshold.StatusCommit {
+			t.Fatalf("expected status %q, got %q", threshold.StatusCommit, session.Status)
+		}
+
+		if _, err := m.AddCommitment(session.ID, threshold.Commitment{Participant: 5, Hiding: randomPoint(), Binding: randomPoint()}); !errors.Is(err, threshold.ErrUnknownParticipant) {
+			t.Fatalf("expected ErrUnknownParticipant, got %v", err)
+		} else if _, err := m.AddShare(session.ID, threshold.Share{Participant: 3}); !errors.Is(err, threshold.ErrWrongStatus) {
+			t.Fatalf("expected ErrWrongStatus, got %v", err)
+		}
+		for _, id := range []uint16{3, 1} {
+			session, err = m.AddCommitment(session.ID, threshold.Commitment{Participant: id, Hiding: randomPoint(), Binding: randomPoint()})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if session.Status != threshold.StatusSign {
+			t.Fatalf("expected status %q, got %q", threshold.StatusSign, session.Status)
+		} else if len(session.Signers) != 2 || session.Signers[0] != 1 || session.Signers[1] != 3 {
+			t.Fatalf("expected signers [1 3], got %v", session.Signers)
+		} else if _, err := m.AddCommitment(session.ID, threshold.Commitment{Participant: 2, Hiding: randomPoint(), Binding: randomPoint()}); !errors.Is(err, threshold.ErrWrongStatus) {
+			t.Fatalf("expected ErrWrongStatus, got %v", err)
+		} else if _, err := m.AddShare(session.ID, threshold.Share{Participant: 2}); !errors.Is(err, threshold.ErrUnknownParticipant) {
+			t.Fatalf("expected ErrUnknownParticipant, got %v", err)
+		}
+
+		r, shares := splitSignature(sk.SignHash(session.Message), 2)
+		for i, id := range session.Signers {
+			share := threshold.Share{Participant: id, GroupCommitment: r, Share: shares[i]}
+			tamper(i, &share)
+			session, err = m.AddShare(session.ID, share)
+			if err != nil {
+				t.Fatal(err)
+			} else if i == 0 {
+				if _, err := m.AddShare(session.ID, share); !errors.Is(err, threshold.ErrDuplicateSubmission) {
+					t.Fatalf("expected ErrDuplicateSubmission, got %v", err)
+				}
+			}
+		}
+		return session
+	}
+
+	session := sign(func(int, *threshold.Share) {})
+	if session.Status != threshold.StatusComplete {
+		t.Fatalf("expected status %q, got %q (%v)", threshold.StatusComplete, session.Status, session.Error)
+	} else if !sk.PublicKey().VerifyHash(session.Message, *session.Signature) {
+		t.Fatal("invalid signature")
+	} else if sigs := session.Transaction.SiacoinInputs[0].SatisfiedPolicy.Signatures; len(sigs) != 1 || sigs[0] != *session.Signature {
+		t.Fatalf("expected input to be signed, got %v", sigs)
+	}
+
+	// a bad share should fail the session
+	session = sign(func(i int, share *threshold.Share) {
+		if i == 1 {
+			share.Share[0] ^= 1
+		}
+	})
+	if session.Status != threshold.StatusFailed || session.Signature != nil {
+		t.Fatalf("expected status %q, got %q", threshold.StatusFailed, session.Status)
+	}
+
+	// signers must agree on the group commitment
+	session = sign(func(i int, share *threshold.Share) {
+		if i == 1 {
+			share.GroupCommitment = randomPoint()
+		}
+	})
+	if session.Status != threshold.StatusFailed {
+		t.Fatalf("expected status %q, got %q", threshold.StatusFailed, session.Status)
+	}
+
+	// removing the group removes its sessions
+	if err := m.RemoveGroup(g.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := m.Session(session.ID); !errors.Is(err, threshold.ErrSessionNotFound) {
+		t.Fatalf("expected ErrSessionNotFound, got %v", err)
+	} else if _, err := m.Group(g.ID); !errors.Is(err, threshold.ErrGroupNotFound) {
+		t.Fatalf("expected ErrGroupNotFound, got %v", err)
+	}
+}
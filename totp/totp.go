@@ -0,0 +1,246 @@
+// Package totp implements time-based one-time passwords (RFC 6238) as a
+// second factor for sensitive wallet operations. Codes are compatible with
+// common authenticator apps: HMAC-SHA1, six digits, and a 30 second step.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// Digits is the number of digits in a code.
+	Digits = 6
+	// Period is the duration of a time step.
+	Period = 30 * time.Second
+
+	// skew is the number of time steps before and after the current one
+	// whose codes are accepted, allowing for clock drift.
+	skew = 1
+
+	secretSize = 20
+	issuer     = "walletd"
+)
+
+var (
+	// ErrNotEnrolled is returned when a wallet does not have a TOTP secret.
+	ErrNotEnrolled = errors.New("wallet is not enrolled in TOTP")
+	// ErrEnabled is returned when enrolling a wallet that already requires
+	// TOTP codes.
+	ErrEnabled = errors.New("TOTP is already enabled for wallet")
+	// ErrCodeRequired is returned when a wallet requires a TOTP code and
+	// none was provided.
+	ErrCodeRequired = errors.New("TOTP code required")
+	// ErrInvalidCode is returned when a TOTP code is incorrect or expired.
+	ErrInvalidCode = errors.New("invalid TOTP code")
+	// ErrCodeUsed is returned when a TOTP code, or a code for a later time
+	// step, has already been used.
+	ErrCodeUsed = errors.New("TOTP code already used")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type (
+	// A Secret is a wallet's TOTP secret.
+	Secret struct {
+		Key []byte
+		// Enabled is true once the enrollment has been confirmed with a
+		// valid code. Codes are only required after that.
+		Enabled bool
+		// LastCounter is the time step of the last code used. Codes for
+		// the same or earlier steps are rejected.
+		LastCounter uint64
+		DateCreated time.Time
+		DateEnabled time.Time
+	}
+
+	// An Enrollment contains the secret to add to an authenticator app.
+	Enrollment struct {
+		Secret string `json:"secret"`
+		// URI is an otpauth:// URI that can be displayed as a QR code.
+		URI string `json:"uri"`
+	}
+
+	// Status is the TOTP state of a wallet.
+	Status struct {
+		Enrolled    bool      `json:"enrolled"`
+		Enabled     bool      `json:"enabled"`
+		DateEnabled time.Time `json:"dateEnabled,omitempty"`
+	}
+
+	// A Store persists TOTP secrets.
+	Store interface {
+		// WalletTOTP returns a wallet's TOTP secret. It returns
+		// ErrNotEnrolled if the wallet does not have one.
+		WalletTOTP(wallet.ID) (Secret, error)
+		// SetWalletTOTP sets a wallet's TOTP secret, replacing any
+		// existing secret.
+		SetWalletTOTP(wallet.ID, Secret) error
+		// EnableWalletTOTP enables a wallet's TOTP secret and records the
+		// time step of the code that confirmed it.
+		EnableWalletTOTP(id wallet.ID, counter uint64, timestamp time.Time) error
+		// RemoveWalletTOTP removes a wallet's TOTP secret. It returns
+		// ErrNotEnrolled if the wallet does not have one.
+		RemoveWalletTOTP(wallet.ID) error
+		// UseWalletTOTPCounter records the time step of a used code. It
+		// returns ErrCodeUsed if a code for the same or a later step was
+		// already used.
+		UseWalletTOTPCounter(id wallet.ID, counter uint64) error
+	}
+
+	// A Manager enrolls wallets in TOTP and verifies codes.
+	Manager struct {
+		store Store
+		log   *zap.Logger
+		now   func() time.Time
+	}
+)
+
+// Code returns the code of a secret for a time step.
+func Code(key []byte, counter uint64) string {
+	h := hmac.New(sha1.New, key)
+	h.Write(binary.BigEndian.AppendUint64(nil, counter))
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0F
+	n := binary.BigEndian.Uint32(sum[offset:]) & 0x7FFFFFFF
+	return fmt.Sprintf("%0*d", Digits, n%1000000)
+}
+
+// Counter returns the time step of a time.
+func Counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(Period/time.Second)
+}
+
+// match returns the time step of a valid code.
+func (m *Manager) match(key []byte, code string) (uint64, error) {
+	if code == "" {
+		return 0, ErrCodeRequired
+	} else if len(code) != Digits {
+		return 0, ErrInvalidCode
+	}
+	current := Counter(m.now())
+	for i := -skew; i <= skew; i++ {
+		counter := current + uint64(i)
+		if subtle.ConstantTimeCompare([]byte(Code(key, counter)), []byte(code)) == 1 {
+			return counter, nil
+		}
+	}
+	return 0, ErrInvalidCode
+}
+
+// Enroll generates a new TOTP secret for a wallet. The secret is not required
+// until the enrollment is confirmed. Enrolling again before confirming
+// replaces the secret.
+func (m *Manager) Enroll(id wallet.ID) (Enrollment, error) {
+	existing, err := m.store.WalletTOTP(id)
+	if err != nil && !errors.Is(err, ErrNotEnrolled) {
+		return Enrollment{}, err
+	} else if existing.Enabled {
+		return Enrollment{}, ErrEnabled
+	}
+
+	key := frand.Bytes(secretSize)
+	if err := m.store.SetWalletTOTP(id, Secret{Key: key, DateCreated: m.now().Truncate(time.Second)}); err != nil {
+		return Enrollment{}, err
+	}
+	secret := encoding.EncodeToString(key)
+	v := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(Digits)},
+		"period":    {fmt.Sprint(int(Period / time.Second))},
+	}
+	uri := (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     fmt.Sprintf("/%s:wallet-%d", issuer, id),
+		RawQuery: v.Encode(),
+	}).String()
+	return Enrollment{Secret: secret, URI: uri}, nil
+}
+
+// Confirm enables a wallet's pending enrollment with a valid code.
+func (m *Manager) Confirm(id wallet.ID, code string) error {
+	s, err := m.store.WalletTOTP(id)
+	if err != nil {
+		return err
+	} else if s.Enabled {
+		return ErrEnabled
+	}
+	counter, err := m.match(s.Key, code)
+	if err != nil {
+		return err
+	} else if err := m.store.EnableWalletTOTP(id, counter, m.now().Truncate(time.Second)); err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	m.log.Info("TOTP enabled", zap.Int64("wallet", int64(id)))
+	return nil
+}
+
+// Status returns the TOTP state of a wallet.
+func (m *Manager) Status(id wallet.ID) (Status, error) {
+	s, err := m.store.WalletTOTP(id)
+	if errors.Is(err, ErrNotEnrolled) {
+		return Status{}, nil
+	} else if err != nil {
+		return Status{}, err
+	}
+	return Status{Enrolled: true, Enabled: s.Enabled, DateEnabled: s.DateEnabled}, nil
+}
+
+// Verify checks a code for a wallet. It returns nil if the wallet does not
+// require TOTP codes. Each code can only be used once.
+func (m *Manager) Verify(id wallet.ID, code string) error {
+	s, err := m.store.WalletTOTP(id)
+	if errors.Is(err, ErrNotEnrolled) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if !s.Enabled {
+		return nil
+	}
+	counter, err := m.match(s.Key, code)
+	if err != nil {
+		return err
+	} else if counter <= s.LastCounter {
+		return ErrCodeUsed
+	}
+	return m.store.UseWalletTOTPCounter(id, counter)
+}
+
+// Disable removes a wallet's TOTP secret. If the secret is enabled, a valid
+// code is required.
+func (m *Manager) Disable(id wallet.ID, code string) error {
+	if err := m.Verify(id, code); err != nil {
+		return err
+	} else if err := m.store.RemoveWalletTOTP(id); err != nil {
+		return err
+	}
+	m.log.Info("TOTP disabled", zap.Int64("wallet", int64(id)))
+	return nil
+}
+
+// NewManager returns a new Manager.
+func NewManager(store Store, opts ...Option) *Manager {
+	m := &Manager{
+		store: store,
+		log:   zap.NewNop(),
+		now:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
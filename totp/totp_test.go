@@ -0,0 +1,156 @@
+package totp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/wallet"
+)
+
+type store struct {
+	mu      sync.Mutex
+	secrets map[wallet.ID]Secret
+}
+
+func (s *store) WalletTOTP(id wallet.ID) (Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[id]
+	if !ok {
+		return Secret{}, ErrNotEnrolled
+	}
+	return secret, nil
+}
+
+func (s *store) SetWalletTOTP(id wallet.ID, secret Secret) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[id] = secret
+	return nil
+}
+
+func (s *store) EnableWalletTOTP(id wallet.ID, counter uint64, timestamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[id]
+	if !ok {
+		return ErrNotEnrolled
+	}
+	secret.Enabled = true
+	secret.LastCounter = counter
+	secret.DateEnabled = timestamp
+	s.secrets[id] = secret
+	return nil
+}
+
+func (s *store) RemoveWalletTOTP(id wallet.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[id]; !ok {
+		return ErrNotEnrolled
+	}
+	delete(s.secrets, id)
+	return nil
+}
+
+func (s *store) UseWalletTOTPCounter(id wallet.ID, counter uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[id]
+	if !ok {
+		return ErrNotEnrolled
+	} else if secret.LastCounter >= counter {
+		return ErrCodeUsed
+	}
+	secret.LastCounter = counter
+	s.secrets[id] = secret
+	return nil
+}
+
+func TestCode(t *testing.T) {
+	// test vectors from RFC 6238, truncated to six digits
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, test := range tests {
+		if code := Code(key, Counter(time.Unix(test.unix, 0))); code != test.code {
+			t.Errorf("expected code %q at %d, got %q", test.code, test.unix, code)
+		}
+	}
+}
+
+func TestManager(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	m := NewManager(&store{secrets: make(map[wallet.ID]Secret)})
+	m.now = func() time.Time { return now }
+	const id = wallet.ID(1)
+
+	// codes are not required before enrolling
+	if err := m.Verify(id, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := m.Enroll(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(e.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := func(t time.Time) string { return Code(key, Counter(t)) }
+
+	// codes are not required until the enrollment is confirmed
+	if err := m.Verify(id, ""); err != nil {
+		t.Fatal(err)
+	} else if status, err := m.Status(id); err != nil {
+		t.Fatal(err)
+	} else if !status.Enrolled || status.Enabled {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	if err := m.Confirm(id, "000000"); !errors.Is(err, ErrInvalidCode) && code(now) != "000000" {
+		t.Fatalf("expected ErrInvalidCode, got %v", err)
+	} else if err := m.Confirm(id, code(now)); err != nil {
+		t.Fatal(err)
+	} else if _, err := m.Enroll(id); !errors.Is(err, ErrEnabled) {
+		t.Fatalf("expected ErrEnabled, got %v", err)
+	}
+
+	// the code used to confirm cannot be reused
+	if err := m.Verify(id, ""); !errors.Is(err, ErrCodeRequired) {
+		t.Fatalf("expected ErrCodeRequired, got %v", err)
+	} else if err := m.Verify(id, code(now)); !errors.Is(err, ErrCodeUsed) {
+		t.Fatalf("expected ErrCodeUsed, got %v", err)
+	}
+
+	// a code for the next step is accepted once to allow for clock drift
+	next := now.Add(Period)
+	if err := m.Verify(id, code(next)); err != nil {
+		t.Fatal(err)
+	} else if err := m.Verify(id, code(next)); !errors.Is(err, ErrCodeUsed) {
+		t.Fatalf("expected ErrCodeUsed, got %v", err)
+	} else if err := m.Verify(id, code(now.Add(3*Period))); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("expected ErrInvalidCode, got %v", err)
+	}
+
+	now = now.Add(2 * Period)
+	if err := m.Disable(id, ""); !errors.Is(err, ErrCodeRequired) {
+		t.Fatalf("expected ErrCodeRequired, got %v", err)
+	} else if err := m.Disable(id, code(now)); err != nil {
+		t.Fatal(err)
+	} else if status, err := m.Status(id); err != nil {
+		t.Fatal(err)
+	} else if status.Enrolled {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
@@ -0,0 +1,71 @@
+package transfers
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send transfer events to
+// webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithSigner sets the signer used to sign on-chain transfers from wallets
+// with an external signer. Transfers from other wallets must be signed by
+// the client.
+func WithSigner(s Signer) Option {
+	return func(m *Manager) {
+		m.signer = s
+	}
+}
+
+// WithTreasuryManager checks transfers against the spending policy of the
+// source wallet. Ledger transfers that violate the policy are rejected and
+// count toward its spending limits once recorded. Signed on-chain transfers
+// that violate it are left unsigned, and those that require approval are
+// added to the approval queue.
+func WithTreasuryManager(tm TreasuryManager) Option {
+	return func(m *Manager) {
+		m.tm = tm
+	}
+}
+
+// WithPreferLedger sets whether transfers between wallets of the same
+// operator are recorded as ledger entries when no method is requested. If
+// false, they are funded on chain. The default is true.
+func WithPreferLedger(prefer bool) Option {
+	return func(m *Manager) {
+		m.preferLedger = prefer
+	}
+}
+
+// WithMaxInputs sets the maximum number of inputs in an on-chain transfer.
+// The default is 100.
+func WithMaxInputs(n int) Option {
+	return func(m *Manager) {
+		m.maxInputs = n
+	}
+}
+
+// WithReserveDuration sets how long the inputs of an on-chain transfer are
+// reserved. Unsigned transfers must be signed and broadcast within this
+// time. The default is three hours.
+func WithReserveDuration(d time.Duration) Option {
+	return func(m *Manager) {
+		m.reserveDuration = d
+	}
+}
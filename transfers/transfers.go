@@ -0,0 +1,547 @@
+// Package transfers moves funds between two wallets on the same walletd
+// instance. Transfers between wallets of the same operator are recorded as
+// off-chain ledger entries; other transfers are funded on chain.
+package transfers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/signer"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// ScopeTransfers is the webhook scope of transfer events.
+const ScopeTransfers = "transfers"
+
+// signatureSize is the size of the signature added to each input when a
+// transfer is signed.
+const signatureSize = 64
+
+// Transfer methods.
+const (
+	// MethodLedger records the transfer as an off-chain ledger entry. The
+	// wallets' outputs are not moved.
+	MethodLedger = "ledger"
+	// MethodChain funds a transaction paying the destination wallet.
+	MethodChain = "chain"
+)
+
+// Transfer statuses.
+const (
+	// StatusRecorded indicates a ledger transfer was recorded.
+	StatusRecorded = "recorded"
+	// StatusUnsigned indicates an on-chain transfer must be signed and
+	// broadcast by the client.
+	StatusUnsigned = "unsigned"
+	// StatusBroadcast indicates an on-chain transfer was signed by the
+	// source wallet's signer and broadcast.
+	StatusBroadcast = "broadcast"
+	// StatusPending indicates an on-chain transfer was signed by the source
+	// wallet's signer and is waiting in the treasury approval queue.
+	StatusPending = "pending"
+)
+
+// Entry types.
+const (
+	// EntryDebit is the entry of the wallet funds were moved from.
+	EntryDebit = "debit"
+	// EntryCredit is the entry of the wallet funds were moved to.
+	EntryCredit = "credit"
+)
+
+var (
+	// ErrNotFound is returned when a transfer is not found.
+	ErrNotFound = errors.New("transfer not found")
+	// ErrSameWallet is returned when a transfer's source and destination
+	// are the same wallet.
+	ErrSameWallet = errors.New("cannot transfer to the same wallet")
+	// ErrZeroValue is returned when a transfer has no value.
+	ErrZeroValue = errors.New("transfer value must be greater than zero")
+	// ErrInvalidMethod is returned when a transfer requests an unknown
+	// method.
+	ErrInvalidMethod = errors.New("invalid transfer method")
+	// ErrDifferentOperators is returned when requesting a ledger transfer
+	// between wallets of different operators.
+	ErrDifferentOperators = errors.New("ledger transfers require wallets of the same operator")
+	// ErrNoAddress is returned when the destination of an on-chain
+	// transfer has no addresses.
+	ErrNoAddress = errors.New("destination wallet has no addresses")
+	// ErrInsufficientBalance is returned when the source wallet cannot fund
+	// a transfer.
+	ErrInsufficientBalance = errors.New("insufficient balance")
+)
+
+type (
+	// A Transfer moves siacoins from one wallet to another. Basis,
+	// Transaction, and Fee are only set for on-chain transfers.
+	Transfer struct {
+		ID          int64                `json:"id"`
+		From        wallet.ID            `json:"from"`
+		To          wallet.ID            `json:"to"`
+		Value       types.Currency       `json:"value"`
+		Method      string               `json:"method"`
+		Status      string               `json:"status"`
+		Memo        string               `json:"memo,omitempty"`
+		Basis       types.ChainIndex     `json:"basis"`
+		Transaction *types.V2Transaction `json:"transaction,omitempty"`
+		Fee         types.Currency       `json:"fee"`
+		DateCreated time.Time            `json:"dateCreated"`
+	}
+
+	// An Entry is one side of a transfer. Every transfer records a linked
+	// pair of entries: a debit of the source wallet and a credit of the
+	// destination wallet.
+	Entry struct {
+		ID           int64          `json:"id"`
+		TransferID   int64          `json:"transferID"`
+		WalletID     wallet.ID      `json:"walletID"`
+		Counterparty wallet.ID      `json:"counterparty"`
+		Type         string         `json:"type"`
+		Method       string         `json:"method"`
+		Value        types.Currency `json:"value"`
+		DateCreated  time.Time      `json:"dateCreated"`
+	}
+
+	// A Store persists transfers and their entries.
+	Store interface {
+		// AddTransfer adds a transfer and its debit and credit entries.
+		AddTransfer(Transfer) (Transfer, error)
+		// Transfer returns a transfer. It returns ErrNotFound if the
+		// transfer does not exist.
+		Transfer(id int64) (Transfer, error)
+		// WalletTransferEntries returns a wallet's entries, newest first.
+		WalletTransferEntries(walletID wallet.ID, offset, limit int) ([]Entry, error)
+		// WalletLedgerTotals returns the total value of the ledger
+		// entries credited to and debited from a wallet.
+		WalletLedgerTotals(walletID wallet.ID) (credited, debited types.Currency, err error)
+	}
+
+	// A ChainManager prices the inputs of an on-chain transfer, skips
+	// outputs spent in the pool, and accepts the signed transfer.
+	ChainManager interface {
+		TipState() consensus.State
+		PoolTransactions() []types.Transaction
+		V2PoolTransactions() []types.V2Transaction
+		AddV2PoolTransactions(basis types.ChainIndex, txns []types.V2Transaction) (bool, error)
+	}
+
+	// A Syncer announces an on-chain transfer between wallets to peers
+	// after it enters the pool.
+	Syncer interface {
+		BroadcastV2TransactionSet(basis types.ChainIndex, txns []types.V2Transaction)
+	}
+
+	// A WalletManager provides the wallets, balances, and outputs used to
+	// make transfers.
+	WalletManager interface {
+		Tip() (types.ChainIndex, error)
+		// WalletTenant returns the tenant that owns a wallet.
+		WalletTenant(id wallet.ID) (string, error)
+		WalletBalance(id wallet.ID) (wallet.Balance, error)
+		Addresses(id wallet.ID) ([]wallet.Address, error)
+		// ConfirmedSiacoinOutputs returns the wallet's unspent outputs
+		// with at least minConfirmations confirmations.
+		ConfirmedSiacoinOutputs(id wallet.ID, minConfirmations uint64, offset, limit int) ([]types.SiacoinElement, error)
+		// WalletMinConfirmations returns the number of confirmations an
+		// output must have to fund the wallet's transactions.
+		WalletMinConfirmations(id wallet.ID) (uint64, error)
+		Reserve(ids []types.Hash256, duration time.Duration) error
+		// WalletFeeRate returns the fee rate of the wallet's fee strategy.
+		WalletFeeRate(id wallet.ID) (types.Currency, error)
+	}
+
+	// A Signer signs transfers with a wallet's external signer.
+	Signer interface {
+		SignV2Transaction(ctx context.Context, id wallet.ID, txn types.V2Transaction) (types.V2Transaction, error)
+	}
+
+	// An EventBroadcaster notifies webhooks of new transfers.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A TreasuryManager enforces the spending policy of source wallets.
+	TreasuryManager interface {
+		BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (treasury.PendingTransaction, bool, error)
+		// RecordTransfer checks an off-chain transfer against the
+		// wallet's policy, then calls record and counts the transfer
+		// toward the wallet's spending limits.
+		RecordTransfer(id wallet.ID, amount types.Currency, record func() error) error
+	}
+
+	// A Manager moves funds between wallets.
+	Manager struct {
+		store  Store
+		cm     ChainManager
+		s      Syncer
+		wm     WalletManager
+		signer Signer
+		tm     TreasuryManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+
+		preferLedger    bool
+		maxInputs       int
+		reserveDuration time.Duration
+
+		mu sync.Mutex // serializes transfers
+		// reserved tracks the inputs of recent on-chain transfers so they
+		// are not spent again before they expire.
+		reserved map[types.SiacoinOutputID]time.Time
+	}
+)
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// Transfer returns a transfer.
+func (m *Manager) Transfer(id int64) (Transfer, error) {
+	return m.store.Transfer(id)
+}
+
+// Entries returns a wallet's transfer entries, newest first.
+func (m *Manager) Entries(walletID wallet.ID, offset, limit int) ([]Entry, error) {
+	return m.store.WalletTransferEntries(walletID, offset, limit)
+}
+
+func (m *Manager) broadcastEvent(log *zap.Logger, event string, data any) {
+	if m.events == nil {
+		return
+	}
+	if err := m.events.BroadcastEvent(ScopeTransfers, event, data); err != nil {
+		log.Warn("failed to broadcast event", zap.Error(err))
+	}
+}
+
+// sameOperator returns true if both wallets are owned by the same tenant.
+// Wallets without a tenant are owned by the node operator.
+func (m *Manager) sameOperator(from, to wallet.ID) (bool, error) {
+	fromTenant, err := m.wm.WalletTenant(from)
+	if err != nil {
+		return false, fmt.Errorf("failed to get tenant of wallet %d: %w", from, err)
+	}
+	toTenant, err := m.wm.WalletTenant(to)
+	if err != nil {
+		return false, fmt.Errorf("failed to get tenant of wallet %d: %w", to, err)
+	}
+	return fromTenant == toTenant, nil
+}
+
+// Send moves value from one wallet to another. If method is empty, the
+// transfer is recorded as a ledger entry when both wallets share an operator
+// and ledger transfers are preferred, and funded on chain otherwise. On-chain
+// transfers pay the first address of the destination wallet and return change
+// to the address of the first input. If the source wallet has an external
+// signer, the transfer is signed and broadcast; otherwise it must be signed
+// and broadcast by the client.
+func (m *Manager) Send(from, to wallet.ID, value types.Currency, method, memo string) (Transfer, error) {
+	if from == to {
+		return Transfer{}, ErrSameWallet
+	} else if value.IsZero() {
+		return Transfer{}, ErrZeroValue
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shared, err := m.sameOperator(from, to)
+	if err != nil {
+		return Transfer{}, err
+	}
+	switch method {
+	case "":
+		method = MethodChain
+		if shared && m.preferLedger {
+			method = MethodLedger
+		}
+	case MethodLedger:
+		if !shared {
+			return Transfer{}, ErrDifferentOperators
+		}
+	case MethodChain:
+	default:
+		return Transfer{}, fmt.Errorf("%w: %q", ErrInvalidMethod, method)
+	}
+
+	t := Transfer{
+		From:        from,
+		To:          to,
+		Value:       value,
+		Method:      method,
+		Memo:        memo,
+		DateCreated: time.Now().Truncate(time.Second),
+	}
+	log := m.log.With(zap.Int64("from", int64(from)), zap.Int64("to", int64(to)), zap.String("method", method))
+	if method == MethodLedger {
+		err = m.recordLedger(&t)
+	} else {
+		err = m.fundChain(&t, log)
+	}
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	add := func() (err error) {
+		t, err = m.store.AddTransfer(t)
+		if err != nil {
+			return fmt.Errorf("failed to add transfer: %w", err)
+		}
+		return nil
+	}
+	// ledger transfers are not broadcast, so they are checked against the
+	// source wallet's policy and counted toward its limits as they are
+	// recorded
+	if method == MethodLedger && m.tm != nil {
+		err = m.tm.RecordTransfer(from, value, add)
+	} else {
+		err = add()
+	}
+	if err != nil {
+		return Transfer{}, err
+	}
+	log.Info("transferred funds", zap.Int64("transfer", t.ID), zap.String("status", t.Status), zap.Stringer("value", value))
+	m.broadcastEvent(log, "transfer", t)
+	return t, nil
+}
+
+// recordLedger checks that the source wallet's balance, adjusted by its
+// earlier ledger entries, covers a ledger transfer. The caller must hold the
+// lock.
+func (m *Manager) recordLedger(t *Transfer) error {
+	balance, err := m.wm.WalletBalance(t.From)
+	if err != nil {
+		return fmt.Errorf("failed to get balance: %w", err)
+	}
+	credited, debited, err := m.store.WalletLedgerTotals(t.From)
+	if err != nil {
+		return fmt.Errorf("failed to get ledger totals: %w", err)
+	}
+	available := balance.Siacoins.Add(credited)
+	if available.Cmp(debited) < 0 {
+		available = types.ZeroCurrency
+	} else {
+		available = available.Sub(debited)
+	}
+	if available.Cmp(t.Value) < 0 {
+		return fmt.Errorf("%w: %v available", ErrInsufficientBalance, available)
+	}
+	t.Status = StatusRecorded
+	return nil
+}
+
+// spendableOutputs returns a wallet's confirmed outputs that are not in the
+// pool or reserved by an earlier transfer, largest first. The caller must
+// hold the lock.
+func (m *Manager) spendableOutputs(walletID wallet.ID, now time.Time) ([]types.SiacoinElement, error) {
+	const batchSize = 1000
+
+	minConfirmations, err := m.wm.WalletMinConfirmations(walletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get minimum confirmations: %w", err)
+	}
+
+	for id, expiration := range m.reserved {
+		if now.After(expiration) {
+			delete(m.reserved, id)
+		}
+	}
+	inPool := make(map[types.SiacoinOutputID]bool)
+	for _, txn := range m.cm.PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.ParentID] = true
+		}
+	}
+	for _, txn := range m.cm.V2PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			inPool[sci.Parent.ID] = true
+		}
+	}
+
+	var utxos []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.wm.ConfirmedSiacoinOutputs(walletID, minConfirmations, offset, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get confirmed outputs: %w", err)
+		}
+		for _, sce := range batch {
+			if _, ok := m.reserved[sce.ID]; !ok && !inPool[sce.ID] {
+				utxos = append(utxos, sce)
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].SiacoinOutput.Value.Cmp(utxos[j].SiacoinOutput.Value) > 0
+	})
+	return utxos, nil
+}
+
+// fundChain funds, and if possible signs and broadcasts, a transaction
+// paying an on-chain transfer. The caller must hold the lock.
+func (m *Manager) fundChain(t *Transfer, log *zap.Logger) error {
+	destinations, err := m.wm.Addresses(t.To)
+	if err != nil {
+		return fmt.Errorf("failed to get destination addresses: %w", err)
+	} else if len(destinations) == 0 {
+		return ErrNoAddress
+	}
+	addresses, err := m.wm.Addresses(t.From)
+	if err != nil {
+		return fmt.Errorf("failed to get source addresses: %w", err)
+	}
+	policies := make(map[types.Address]types.SpendPolicy)
+	for _, addr := range addresses {
+		if addr.SpendPolicy != nil {
+			policies[addr.Address] = *addr.SpendPolicy
+		}
+	}
+	feePerByte, err := m.wm.WalletFeeRate(t.From)
+	if err != nil {
+		return fmt.Errorf("failed to get fee rate: %w", err)
+	}
+
+	// the outputs' proofs must match the basis; if the wallet advances
+	// while they are fetched, the transfer fails and can be retried.
+	now := time.Now()
+	basis, err := m.wm.Tip()
+	if err != nil {
+		return fmt.Errorf("failed to get wallet tip: %w", err)
+	}
+	utxos, err := m.spendableOutputs(t.From, now)
+	if err != nil {
+		return err
+	}
+	if tip, err := m.wm.Tip(); err != nil {
+		return fmt.Errorf("failed to get wallet tip: %w", err)
+	} else if tip != basis {
+		return errors.New("wallet tip changed while fetching outputs")
+	}
+
+	txn := types.V2Transaction{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: destinations[0].Address, Value: t.Value}},
+	}
+	var inputSum, fee types.Currency
+	for _, sce := range utxos {
+		if len(txn.SiacoinInputs) >= m.maxInputs {
+			break
+		}
+		txn.SiacoinInputs = append(txn.SiacoinInputs, types.V2SiacoinInput{
+			Parent:          sce,
+			SatisfiedPolicy: types.SatisfiedPolicy{Policy: policies[sce.SiacoinOutput.Address]},
+		})
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+		// include a change output in the estimate
+		withChange := txn
+		withChange.SiacoinOutputs = append(withChange.SiacoinOutputs, types.SiacoinOutput{})
+		fee = feePerByte.Mul64(m.cm.TipState().V2TransactionWeight(withChange) + uint64(len(txn.SiacoinInputs))*signatureSize)
+		if inputSum.Cmp(t.Value.Add(fee)) >= 0 {
+			break
+		}
+	}
+	if inputSum.Cmp(t.Value.Add(fee)) < 0 {
+		return fmt.Errorf("%w: %v available", ErrInsufficientBalance, inputSum)
+	}
+	if change := inputSum.Sub(t.Value.Add(fee)); !change.IsZero() {
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: txn.SiacoinInputs[0].Parent.SiacoinOutput.Address,
+			Value:   change,
+		})
+	}
+	txn.MinerFee = fee
+
+	ids := make([]types.Hash256, len(txn.SiacoinInputs))
+	for i, sci := range txn.SiacoinInputs {
+		ids[i] = types.Hash256(sci.Parent.ID)
+	}
+	if err := m.wm.Reserve(ids, m.reserveDuration); err != nil {
+		return fmt.Errorf("failed to reserve inputs: %w", err)
+	}
+	for _, sci := range txn.SiacoinInputs {
+		m.reserved[sci.Parent.ID] = now.Add(m.reserveDuration)
+	}
+
+	t.Status = StatusUnsigned
+	if m.signer != nil {
+		ctx, cancel, err := m.tg.AddWithContext(context.Background())
+		if err != nil {
+			return err
+		}
+		signed, err := m.signer.SignV2Transaction(ctx, t.From, txn)
+		cancel()
+		switch {
+		case errors.Is(err, signer.ErrNoSigner):
+		case err != nil:
+			log.Warn("failed to sign transfer", zap.Error(err))
+		default:
+			txns := []types.V2Transaction{signed}
+			broadcast := func() error {
+				if _, err := m.cm.AddV2PoolTransactions(basis, txns); err != nil {
+					return fmt.Errorf("failed to add transfer to pool: %w", err)
+				}
+				m.s.BroadcastV2TransactionSet(basis, txns)
+				return nil
+			}
+			if m.tm == nil {
+				if err := broadcast(); err != nil {
+					log.Warn("failed to broadcast transfer", zap.Error(err))
+					break
+				}
+				txn, t.Status = signed, StatusBroadcast
+				break
+			}
+			pt, pending, err := m.tm.BroadcastTransactionSet(nil, txns, "transfers", broadcast)
+			switch {
+			case err != nil:
+				log.Warn("failed to broadcast transfer", zap.Error(err))
+			case pending:
+				log.Info("transfer requires approval", zap.Int64("pendingTransaction", pt.ID))
+				txn, t.Status = signed, StatusPending
+			default:
+				txn, t.Status = signed, StatusBroadcast
+			}
+		}
+	}
+	t.Basis, t.Transaction, t.Fee = basis, &txn, fee
+	return nil
+}
+
+// NewManager creates a new transfer manager.
+func NewManager(store Store, cm ChainManager, s Syncer, wm WalletManager, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		cm:    cm,
+		s:     s,
+		wm:    wm,
+		log:   zap.NewNop(),
+		tg:    threadgroup.New(),
+
+		preferLedger:    true,
+		maxInputs:       100,
+		reserveDuration: 3 * time.Hour,
+
+		reserved: make(map[types.SiacoinOutputID]time.Time),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.maxInputs <= 0 {
+		return nil, errors.New("maximum inputs must be greater than zero")
+	}
+	return m, nil
+}
@@ -0,0 +1,301 @@
+package transfers_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/transfers"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct{}
+
+func (chainManager) TipState() consensus.State                 { return consensus.State{} }
+func (chainManager) PoolTransactions() []types.Transaction     { return nil }
+func (chainManager) V2PoolTransactions() []types.V2Transaction { return nil }
+func (chainManager) AddV2PoolTransactions(types.ChainIndex, []types.V2Transaction) (bool, error) {
+	return false, nil
+}
+
+type syncer struct{}
+
+func (syncer) BroadcastV2TransactionSet(types.ChainIndex, []types.V2Transaction) {}
+
+type walletManager struct {
+	mu        sync.Mutex
+	tenants   map[wallet.ID]string
+	balances  map[wallet.ID]types.Currency
+	addresses map[wallet.ID][]wallet.Address
+	utxos     map[wallet.ID][]types.SiacoinElement
+	reserved  map[types.Hash256]bool
+}
+
+func (wm *walletManager) Tip() (types.ChainIndex, error) {
+	return types.ChainIndex{Height: 100}, nil
+}
+
+func (wm *walletManager) WalletTenant(id wallet.ID) (string, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wm.tenants[id], nil
+}
+
+func (wm *walletManager) WalletBalance(id wallet.ID) (wallet.Balance, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return wallet.Balance{Siacoins: wm.balances[id]}, nil
+}
+
+func (wm *walletManager) Addresses(id wallet.ID) ([]wallet.Address, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	return append([]wallet.Address(nil), wm.addresses[id]...), nil
+}
+
+func (wm *walletManager) ConfirmedSiacoinOutputs(id wallet.ID, _ uint64, offset, limit int) ([]types.SiacoinElement, error) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	utxos := wm.utxos[id]
+	if offset >= len(utxos) {
+		return nil, nil
+	}
+	utxos = utxos[offset:]
+	if len(utxos) > limit {
+		utxos = utxos[:limit]
+	}
+	return append([]types.SiacoinElement(nil), utxos...), nil
+}
+
+func (wm *walletManager) WalletMinConfirmations(wallet.ID) (uint64, error) { return 0, nil }
+
+func (wm *walletManager) Reserve(ids []types.Hash256, _ time.Duration) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	for _, id := range ids {
+		wm.reserved[id] = true
+	}
+	return nil
+}
+
+func (wm *walletManager) WalletFeeRate(wallet.ID) (types.Currency, error) {
+	return types.NewCurrency64(1), nil
+}
+
+type signer struct{}
+
+func (signer) SignV2Transaction(_ context.Context, _ wallet.ID, txn types.V2Transaction) (types.V2Transaction, error) {
+	return txn, nil
+}
+
+type treasuryManager struct {
+	limit types.Currency
+	spent types.Currency
+	calls int
+}
+
+func (tm *treasuryManager) BroadcastTransactionSet(_ []types.Transaction, v2txns []types.V2Transaction, submittedBy string, _ func() error) (treasury.PendingTransaction, bool, error) {
+	tm.calls++
+	return treasury.PendingTransaction{ID: 1, V2Transactions: v2txns, SubmittedBy: submittedBy}, true, nil
+}
+
+func (tm *treasuryManager) RecordTransfer(_ wallet.ID, amount types.Currency, record func() error) error {
+	if tm.spent.Add(amount).Cmp(tm.limit) > 0 {
+		return treasury.ErrLimitExceeded
+	} else if err := record(); err != nil {
+		return err
+	}
+	tm.spent = tm.spent.Add(amount)
+	return nil
+}
+
+func TestTransfers(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hot, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold, err := db.AddWallet(wallet.Wallet{Name: "cold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey())
+	hotAddr := policy.Address()
+	wm := &walletManager{
+		tenants:   make(map[wallet.ID]string),
+		balances:  map[wallet.ID]types.Currency{hot.ID: types.Siacoins(100)},
+		addresses: map[wallet.ID][]wallet.Address{hot.ID: {{Address: hotAddr, SpendPolicy: &policy}}},
+		utxos: map[wallet.ID][]types.SiacoinElement{hot.ID: {
+			{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: hotAddr, Value: types.Siacoins(50)}},
+			{ID: types.SiacoinOutputID{2}, SiacoinOutput: types.SiacoinOutput{Address: hotAddr, Value: types.Siacoins(30)}},
+		}},
+		reserved: make(map[types.Hash256]bool),
+	}
+	tm, err := transfers.NewManager(db, chainManager{}, syncer{}, wm, transfers.WithLogger(log.Named("transfers")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tm.Close()
+
+	if _, err := tm.Send(hot.ID, hot.ID, types.Siacoins(1), "", ""); !errors.Is(err, transfers.ErrSameWallet) {
+		t.Fatalf("expected ErrSameWallet, got %v", err)
+	} else if _, err := tm.Send(hot.ID, cold.ID, types.ZeroCurrency, "", ""); !errors.Is(err, transfers.ErrZeroValue) {
+		t.Fatalf("expected ErrZeroValue, got %v", err)
+	} else if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(1), "carrier pigeon", ""); !errors.Is(err, transfers.ErrInvalidMethod) {
+		t.Fatalf("expected ErrInvalidMethod, got %v", err)
+	}
+
+	// wallets of the same operator transfer through the ledger
+	ledger, err := tm.Send(hot.ID, cold.ID, types.Siacoins(40), "", "rebalance")
+	if err != nil {
+		t.Fatal(err)
+	} else if ledger.Method != transfers.MethodLedger || ledger.Status != transfers.StatusRecorded || ledger.Transaction != nil {
+		t.Fatalf("expected recorded ledger transfer, got %+v", ledger)
+	} else if len(wm.reserved) != 0 {
+		t.Fatal("expected no outputs to be reserved")
+	}
+
+	// the transfer is recorded as a linked debit and credit
+	debits, err := tm.Entries(hot.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits, err := tm.Entries(cold.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(debits) != 1 || len(credits) != 1 {
+		t.Fatalf("expected one entry per wallet, got %v and %v", debits, credits)
+	} else if d := debits[0]; d.TransferID != ledger.ID || d.Type != transfers.EntryDebit || d.Counterparty != cold.ID || !d.Value.Equals(types.Siacoins(40)) {
+		t.Fatalf("unexpected debit %+v", d)
+	} else if c := credits[0]; c.TransferID != ledger.ID || c.Type != transfers.EntryCredit || c.Counterparty != hot.ID || c.Method != transfers.MethodLedger {
+		t.Fatalf("unexpected credit %+v", c)
+	}
+
+	// earlier ledger debits count against the balance
+	if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(70), transfers.MethodLedger, ""); !errors.Is(err, transfers.ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+	}
+
+	// on-chain transfers need a destination address
+	if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(60), transfers.MethodChain, ""); !errors.Is(err, transfers.ErrNoAddress) {
+		t.Fatalf("expected ErrNoAddress, got %v", err)
+	}
+	coldAddr := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey()).Address()
+	wm.addresses[cold.ID] = []wallet.Address{{Address: coldAddr}}
+
+	// wallets of different operators transfer on chain
+	wm.tenants[cold.ID] = "acme"
+	if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(1), transfers.MethodLedger, ""); !errors.Is(err, transfers.ErrDifferentOperators) {
+		t.Fatalf("expected ErrDifferentOperators, got %v", err)
+	}
+	chain, err := tm.Send(hot.ID, cold.ID, types.Siacoins(60), "", "")
+	if err != nil {
+		t.Fatal(err)
+	} else if chain.Method != transfers.MethodChain || chain.Status != transfers.StatusUnsigned || chain.Transaction == nil {
+		t.Fatalf("expected unsigned on-chain transfer, got %+v", chain)
+	}
+	txn := chain.Transaction
+	if len(txn.SiacoinInputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(txn.SiacoinInputs))
+	} else if txn.SiacoinOutputs[0].Address != coldAddr || !txn.SiacoinOutputs[0].Value.Equals(types.Siacoins(60)) {
+		t.Fatalf("unexpected payment output %+v", txn.SiacoinOutputs[0])
+	} else if len(txn.SiacoinOutputs) != 2 || txn.SiacoinOutputs[1].Address != hotAddr {
+		t.Fatalf("expected change to the first input's address, got %+v", txn.SiacoinOutputs)
+	} else if !txn.SiacoinOutputs[1].Value.Add(txn.MinerFee).Equals(types.Siacoins(20)) {
+		t.Fatalf("expected change and fee to total 20 SC, got %v and %v", txn.SiacoinOutputs[1].Value, txn.MinerFee)
+	} else if len(wm.reserved) != 2 {
+		t.Fatalf("expected 2 reserved outputs, got %d", len(wm.reserved))
+	}
+
+	// the reserved outputs cannot fund another transfer
+	if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(1), transfers.MethodChain, ""); !errors.Is(err, transfers.ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+	}
+
+	stored, err := tm.Transfer(chain.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if stored.Transaction == nil || stored.Transaction.ID() != txn.ID() || stored.From != hot.ID || stored.To != cold.ID {
+		t.Fatalf("unexpected stored transfer %+v", stored)
+	} else if _, err := tm.Transfer(chain.ID + 1); !errors.Is(err, transfers.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestTransferPolicy(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hot, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold, err := db.AddWallet(wallet.Wallet{Name: "cold"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey())
+	hotAddr := policy.Address()
+	coldAddr := types.PolicyPublicKey(types.GeneratePrivateKey().PublicKey()).Address()
+	wm := &walletManager{
+		tenants:  make(map[wallet.ID]string),
+		balances: map[wallet.ID]types.Currency{hot.ID: types.Siacoins(100)},
+		addresses: map[wallet.ID][]wallet.Address{
+			hot.ID:  {{Address: hotAddr, SpendPolicy: &policy}},
+			cold.ID: {{Address: coldAddr}},
+		},
+		utxos: map[wallet.ID][]types.SiacoinElement{hot.ID: {
+			{ID: types.SiacoinOutputID{1}, SiacoinOutput: types.SiacoinOutput{Address: hotAddr, Value: types.Siacoins(100)}},
+		}},
+		reserved: make(map[types.Hash256]bool),
+	}
+	trm := &treasuryManager{limit: types.Siacoins(50)}
+	tm, err := transfers.NewManager(db, chainManager{}, syncer{}, wm, transfers.WithLogger(log.Named("transfers")), transfers.WithSigner(signer{}), transfers.WithTreasuryManager(trm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tm.Close()
+
+	// ledger transfers count toward the source wallet's limits
+	if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(40), "", ""); err != nil {
+		t.Fatal(err)
+	} else if !trm.spent.Equals(types.Siacoins(40)) {
+		t.Fatalf("expected 40 SC spent, got %v", trm.spent)
+	} else if _, err := tm.Send(hot.ID, cold.ID, types.Siacoins(20), "", ""); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if entries, err := tm.Entries(hot.ID, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Fatalf("expected the rejected transfer not to be recorded, got %v", entries)
+	}
+
+	// signed on-chain transfers go through the treasury manager
+	chain, err := tm.Send(hot.ID, cold.ID, types.Siacoins(20), transfers.MethodChain, "")
+	if err != nil {
+		t.Fatal(err)
+	} else if trm.calls != 1 {
+		t.Fatal("expected the transfer to be checked by the treasury manager")
+	} else if chain.Status != transfers.StatusPending || chain.Transaction == nil {
+		t.Fatalf("expected pending on-chain transfer, got %+v", chain)
+	}
+}
@@ -0,0 +1,690 @@
+package treasury
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap"
+)
+
+// Statuses of a pending transaction.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// ScopeApprovals is the webhook scope of approval events.
+const ScopeApprovals = "treasury/approvals"
+
+var (
+	// ErrNotFound is returned when a pending transaction is not found.
+	ErrNotFound = errors.New("pending transaction not found")
+	// ErrNotPending is returned when approving or rejecting a transaction
+	// that has already been decided.
+	ErrNotPending = errors.New("transaction is not pending")
+	// ErrSameCredential is returned when a transaction is approved with the
+	// credential that submitted it.
+	ErrSameCredential = errors.New("transaction must be approved by a different credential than the one that submitted it")
+	// ErrLimitExceeded is returned when a transaction set would exceed a
+	// wallet's spending limit.
+	ErrLimitExceeded = errors.New("spending limit exceeded")
+	// ErrDestinationNotAllowed is returned when a transaction set sends
+	// funds to an address that is not on a wallet's allowlist.
+	ErrDestinationNotAllowed = errors.New("destination address is not allowlisted")
+	// ErrApprovalRequired is returned when an off-chain transfer exceeds a
+	// wallet's approval threshold. Only transaction sets can be queued for
+	// approval.
+	ErrApprovalRequired = errors.New("transfer exceeds the approval threshold")
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+
+	// maxOverrideDuration is the maximum duration of a spending limit
+	// override.
+	maxOverrideDuration = week
+)
+
+type (
+	// A Policy contains the treasury controls of a wallet.
+	Policy struct {
+		// ApprovalThreshold is the maximum amount of siacoins the wallet can
+		// send in a transaction set without approval. Zero disables
+		// approvals.
+		ApprovalThreshold types.Currency `json:"approvalThreshold"`
+		// DailyLimit and WeeklyLimit are the maximum amount of siacoins
+		// the wallet can send in any rolling 24 hour or 7 day period. Zero
+		// disables the limit.
+		DailyLimit  types.Currency `json:"dailyLimit"`
+		WeeklyLimit types.Currency `json:"weeklyLimit"`
+		// RestrictDestinations only allows the wallet to send to its own
+		// addresses and active allowlisted addresses.
+		RestrictDestinations bool `json:"restrictDestinations"`
+		// AllowlistDelay is the number of seconds before a newly
+		// allowlisted address can receive funds.
+		AllowlistDelay uint64 `json:"allowlistDelay"`
+	}
+
+	// An AllowlistEntry is an address a wallet is allowed to send to.
+	AllowlistEntry struct {
+		Address     types.Address `json:"address"`
+		Description string        `json:"description,omitempty"`
+		DateAdded   time.Time     `json:"dateAdded"`
+		ActiveAfter time.Time     `json:"activeAfter"`
+	}
+
+	// A Limit is the state of a spending limit.
+	Limit struct {
+		Limit     types.Currency `json:"limit"`
+		Spent     types.Currency `json:"spent"`
+		Remaining types.Currency `json:"remaining"`
+	}
+
+	// LimitStatus is the state of a wallet's spending limits.
+	LimitStatus struct {
+		Daily  Limit `json:"daily"`
+		Weekly Limit `json:"weekly"`
+		// OverrideExpiration is the time at which the current override
+		// expires. Limits are not enforced until then.
+		OverrideExpiration time.Time `json:"overrideExpiration,omitempty"`
+	}
+
+	// A PendingTransaction is a transaction set that requires approval
+	// before it is broadcast.
+	PendingTransaction struct {
+		ID             int64                 `json:"id"`
+		WalletID       wallet.ID             `json:"walletID"`
+		Amount         types.Currency        `json:"amount"`
+		Transactions   []types.Transaction   `json:"transactions"`
+		V2Transactions []types.V2Transaction `json:"v2transactions"`
+		Status         string                `json:"status"`
+		SubmittedBy    string                `json:"submittedBy"`
+		DecidedBy      string                `json:"decidedBy,omitempty"`
+		DateCreated    time.Time             `json:"dateCreated"`
+		DateDecided    time.Time             `json:"dateDecided,omitempty"`
+	}
+
+	// A Store persists treasury policies and pending transactions.
+	Store interface {
+		WalletPolicy(wallet.ID) (Policy, error)
+		SetWalletPolicy(wallet.ID, Policy) error
+		WalletPolicies() (map[wallet.ID]Policy, error)
+
+		AddPendingTransaction(PendingTransaction) (PendingTransaction, error)
+		PendingTransaction(id int64) (PendingTransaction, error)
+		PendingTransactions(status string, offset, limit int) ([]PendingTransaction, error)
+		// DecidePendingTransaction sets the status of a pending
+		// transaction. It returns ErrNotPending if the transaction has
+		// already been decided.
+		DecidePendingTransaction(id int64, status, decidedBy string, timestamp time.Time) error
+		// ReopenPendingTransaction returns an approved transaction to the
+		// pending queue.
+		ReopenPendingTransaction(id int64) error
+
+		// LimitOverride returns the expiration of a wallet's spending
+		// limit override, or the zero time if it has none.
+		LimitOverride(id wallet.ID) (time.Time, error)
+		// SetLimitOverride sets the expiration of a wallet's spending limit
+		// override. The zero time removes the override.
+		SetLimitOverride(id wallet.ID, expiration time.Time) error
+
+		// AddWalletSpend records siacoins sent by a wallet.
+		AddWalletSpend(id wallet.ID, amount types.Currency, timestamp time.Time) error
+		// WalletSpent returns the total siacoins sent by a wallet since
+		// the given time.
+		WalletSpent(id wallet.ID, since time.Time) (types.Currency, error)
+		// AddSignedSpends records the spends of a signed transaction set
+		// along with the IDs of its transactions.
+		AddSignedSpends(txnIDs []types.TransactionID, spends map[wallet.ID]types.Currency, timestamp time.Time) error
+		// SignedTransactions returns the transactions whose spends were
+		// recorded when they were signed.
+		SignedTransactions(txnIDs []types.TransactionID) (map[types.TransactionID]bool, error)
+
+		// AddAllowlistEntry adds an address to a wallet's allowlist. If the
+		// address is already allowlisted, the existing entry is kept.
+		AddAllowlistEntry(id wallet.ID, entry AllowlistEntry) error
+		RemoveAllowlistEntry(id wallet.ID, addr types.Address) error
+		Allowlist(id wallet.ID) ([]AllowlistEntry, error)
+		// UnallowedDestinations returns the addresses that do not belong to
+		// the wallet and are not active on its allowlist at the given time.
+		UnallowedDestinations(id wallet.ID, addrs []types.Address, now time.Time) ([]types.Address, error)
+	}
+
+	// A WalletManager calculates the siacoins sent by a wallet.
+	WalletManager interface {
+		WalletOutflow(id wallet.ID, txns []types.Transaction, v2txns []types.V2Transaction) (types.Currency, error)
+	}
+
+	// An EventBroadcaster notifies approvers when a transaction is held for
+	// approval, approved, or rejected.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager enforces treasury controls on outgoing transactions.
+	Manager struct {
+		store  Store
+		wm     WalletManager
+		events EventBroadcaster
+		log    *zap.Logger
+
+		// spendMu is held from the policy check of a transaction set until
+		// its spends are recorded, so that concurrent broadcasts and
+		// signatures cannot exceed a limit together.
+		spendMu sync.Mutex
+	}
+)
+
+func (m *Manager) broadcastEvent(event string, pt PendingTransaction) {
+	if m.events == nil {
+		return
+	}
+	if err := m.events.BroadcastEvent(ScopeApprovals, event, pt); err != nil {
+		m.log.Warn("failed to broadcast event", zap.String("event", event), zap.Int64("id", pt.ID), zap.Error(err))
+	}
+}
+
+// WalletPolicy returns the treasury policy of a wallet.
+func (m *Manager) WalletPolicy(id wallet.ID) (Policy, error) {
+	return m.store.WalletPolicy(id)
+}
+
+// SetWalletPolicy sets the treasury policy of a wallet.
+func (m *Manager) SetWalletPolicy(id wallet.ID, p Policy) error {
+	return m.store.SetWalletPolicy(id, p)
+}
+
+// walletOutflows returns the siacoins sent by each wallet with a policy.
+func (m *Manager) walletOutflows(policies map[wallet.ID]Policy, txns []types.Transaction, v2txns []types.V2Transaction) (map[wallet.ID]types.Currency, error) {
+	outflows := make(map[wallet.ID]types.Currency)
+	for id := range policies {
+		outflow, err := m.wm.WalletOutflow(id, txns, v2txns)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate outflow of wallet %v: %w", id, err)
+		} else if !outflow.IsZero() {
+			outflows[id] = outflow
+		}
+	}
+	return outflows, nil
+}
+
+// overridden returns true if the wallet's spending limits are currently
+// overridden.
+func (m *Manager) overridden(id wallet.ID) (bool, error) {
+	exp, err := m.store.LimitOverride(id)
+	if err != nil {
+		return false, fmt.Errorf("failed to get limit override: %w", err)
+	}
+	return time.Now().Before(exp), nil
+}
+
+// checkLimit returns an error if sending amount would exceed the limit over
+// the period.
+func (m *Manager) checkLimit(id wallet.ID, limit, amount types.Currency, period time.Duration) error {
+	if limit.IsZero() {
+		return nil
+	}
+	spent, err := m.store.WalletSpent(id, time.Now().Add(-period))
+	if err != nil {
+		return fmt.Errorf("failed to get amount spent: %w", err)
+	}
+	total, overflow := spent.AddWithOverflow(amount)
+	if overflow || total.Cmp(limit) > 0 {
+		return fmt.Errorf("wallet %v would send %v of %v in %v: %w", id, total, limit, period, ErrLimitExceeded)
+	}
+	return nil
+}
+
+// checkLimits returns an error if sending amount would exceed any of the
+// wallet's spending limits.
+func (m *Manager) checkLimits(id wallet.ID, policy Policy, amount types.Currency) error {
+	if overridden, err := m.overridden(id); err != nil || overridden {
+		return err
+	} else if err := m.checkLimit(id, policy.DailyLimit, amount, day); err != nil {
+		return err
+	}
+	return m.checkLimit(id, policy.WeeklyLimit, amount, week)
+}
+
+// outputAddresses returns the addresses receiving outputs in a transaction
+// set.
+func outputAddresses(txns []types.Transaction, v2txns []types.V2Transaction) []types.Address {
+	seen := make(map[types.Address]bool)
+	var addrs []types.Address
+	add := func(addr types.Address) {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	for _, txn := range txns {
+		for _, sco := range txn.SiacoinOutputs {
+			add(sco.Address)
+		}
+		for _, sfo := range txn.SiafundOutputs {
+			add(sfo.Address)
+		}
+	}
+	for _, txn := range v2txns {
+		for _, sco := range txn.SiacoinOutputs {
+			add(sco.Address)
+		}
+		for _, sfo := range txn.SiafundOutputs {
+			add(sfo.Address)
+		}
+	}
+	return addrs
+}
+
+// checkDestinations returns an error if the wallet is not allowed to send to
+// any of the addresses.
+func (m *Manager) checkDestinations(id wallet.ID, policy Policy, addrs []types.Address) error {
+	if !policy.RestrictDestinations || len(addrs) == 0 {
+		return nil
+	}
+	unallowed, err := m.store.UnallowedDestinations(id, addrs, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to check destinations: %w", err)
+	} else if len(unallowed) > 0 {
+		return fmt.Errorf("wallet %v cannot send to %v: %w", id, unallowed[0], ErrDestinationNotAllowed)
+	}
+	return nil
+}
+
+// checkPolicies returns an error if the transaction set violates the
+// policy of any wallet it spends from.
+func (m *Manager) checkPolicies(policies map[wallet.ID]Policy, outflows map[wallet.ID]types.Currency, txns []types.Transaction, v2txns []types.V2Transaction) error {
+	addrs := outputAddresses(txns, v2txns)
+	for id, outflow := range outflows {
+		if err := m.checkLimits(id, policies[id], outflow); err != nil {
+			return err
+		} else if err := m.checkDestinations(id, policies[id], addrs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckFunding returns an error if funding txn with amount siacoins from the
+// wallet would violate its policy. It is used to reject transactions before
+// they are constructed.
+func (m *Manager) CheckFunding(id wallet.ID, amount types.Currency, txn types.Transaction) error {
+	policy, err := m.store.WalletPolicy(id)
+	if err != nil {
+		return fmt.Errorf("failed to get wallet policy: %w", err)
+	} else if err := m.checkLimits(id, policy, amount); err != nil {
+		return err
+	}
+	return m.checkDestinations(id, policy, outputAddresses([]types.Transaction{txn}, nil))
+}
+
+// Allowlist returns a wallet's allowlisted addresses.
+func (m *Manager) Allowlist(id wallet.ID) ([]AllowlistEntry, error) {
+	return m.store.Allowlist(id)
+}
+
+// AddAllowlistEntry adds an address to a wallet's allowlist. The address can
+// receive funds once the wallet's allowlist delay has passed.
+func (m *Manager) AddAllowlistEntry(id wallet.ID, addr types.Address, description string) (AllowlistEntry, error) {
+	policy, err := m.store.WalletPolicy(id)
+	if err != nil {
+		return AllowlistEntry{}, fmt.Errorf("failed to get wallet policy: %w", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	entry := AllowlistEntry{
+		Address:     addr,
+		Description: description,
+		DateAdded:   now,
+		ActiveAfter: now.Add(time.Duration(policy.AllowlistDelay) * time.Second),
+	}
+	if err := m.store.AddAllowlistEntry(id, entry); err != nil {
+		return AllowlistEntry{}, fmt.Errorf("failed to add allowlist entry: %w", err)
+	}
+	m.log.Info("address allowlisted", zap.Int64("wallet", int64(id)), zap.Stringer("address", addr), zap.Time("activeAfter", entry.ActiveAfter))
+	return entry, nil
+}
+
+// RemoveAllowlistEntry removes an address from a wallet's allowlist.
+// Removal takes effect immediately.
+func (m *Manager) RemoveAllowlistEntry(id wallet.ID, addr types.Address) error {
+	return m.store.RemoveAllowlistEntry(id, addr)
+}
+
+// Credential returns the credential part of a principal. Principals have the
+// form credential[/detail], where the detail distinguishes logins that share
+// a credential, such as sessions issued for the API password.
+func Credential(principal string) string {
+	credential, _, _ := strings.Cut(principal, "/")
+	return credential
+}
+
+// transactionIDs returns the IDs of the transactions in a set.
+func transactionIDs(txns []types.Transaction, v2txns []types.V2Transaction) []types.TransactionID {
+	ids := make([]types.TransactionID, 0, len(txns)+len(v2txns))
+	for _, txn := range txns {
+		ids = append(ids, txn.ID())
+	}
+	for _, txn := range v2txns {
+		ids = append(ids, txn.ID())
+	}
+	return ids
+}
+
+// setOutflows returns the siacoins sent by each wallet with a policy in the
+// transactions of a set whose spends were not recorded when they were
+// signed, so that a set signed and then broadcast through walletd is only
+// counted once.
+func (m *Manager) setOutflows(policies map[wallet.ID]Policy, txns []types.Transaction, v2txns []types.V2Transaction) (map[wallet.ID]types.Currency, error) {
+	signed, err := m.store.SignedTransactions(transactionIDs(txns, v2txns))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signed transactions: %w", err)
+	} else if len(signed) == 0 {
+		return m.walletOutflows(policies, txns, v2txns)
+	}
+
+	var unsignedTxns []types.Transaction
+	for _, txn := range txns {
+		if !signed[txn.ID()] {
+			unsignedTxns = append(unsignedTxns, txn)
+		}
+	}
+	var unsignedV2Txns []types.V2Transaction
+	for _, txn := range v2txns {
+		if !signed[txn.ID()] {
+			unsignedV2Txns = append(unsignedV2Txns, txn)
+		}
+	}
+	if len(unsignedTxns) == 0 && len(unsignedV2Txns) == 0 {
+		return nil, nil
+	}
+	return m.walletOutflows(policies, unsignedTxns, unsignedV2Txns)
+}
+
+// broadcast calls fn and records the spends of each wallet if it succeeds.
+func (m *Manager) broadcast(outflows map[wallet.ID]types.Currency, fn func() error) error {
+	if err := fn(); err != nil {
+		return err
+	}
+	return m.recordSpends(outflows)
+}
+
+// recordSpends records the spends of each wallet.
+func (m *Manager) recordSpends(outflows map[wallet.ID]types.Currency) error {
+	timestamp := time.Now()
+	for id, amount := range outflows {
+		if err := m.store.AddWalletSpend(id, amount, timestamp); err != nil {
+			return fmt.Errorf("failed to record spend of wallet %v: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// BroadcastTransactionSet checks a transaction set against the policies of
+// every wallet it spends from, then calls broadcast with it. If the set
+// requires approval, it is added to the pending queue instead and returned
+// with pending set to true. Broadcasts are serialized, so that the spends of
+// one set count against the limits checked for the next. Transactions whose
+// spends were recorded by SignTransactionSet are not counted again.
+// submittedBy is the principal that submitted the set; it is empty if the set
+// was submitted without authentication, in which case any principal can
+// approve it.
+func (m *Manager) BroadcastTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, broadcast func() error) (pt PendingTransaction, pending bool, err error) {
+	m.spendMu.Lock()
+	defer m.spendMu.Unlock()
+
+	policies, err := m.store.WalletPolicies()
+	if err != nil {
+		return PendingTransaction{}, false, fmt.Errorf("failed to get wallet policies: %w", err)
+	}
+	outflows, err := m.setOutflows(policies, txns, v2txns)
+	if err != nil {
+		return PendingTransaction{}, false, err
+	}
+
+	if err := m.checkPolicies(policies, outflows, txns, v2txns); err != nil {
+		return PendingTransaction{}, false, err
+	} else if id, outflow, ok := requiresApproval(policies, outflows); ok {
+		pt, err := m.addPending(id, outflow, txns, v2txns, submittedBy)
+		return pt, err == nil, err
+	}
+	return PendingTransaction{}, false, m.broadcast(outflows, broadcast)
+}
+
+// SignTransactionSet checks an unsigned transaction set against the policies
+// of every wallet it spends from, then calls sign to sign it. A signed set can
+// be broadcast without walletd, so if the set requires approval it is added
+// to the pending queue once signed and returned with pending set to true
+// instead of being released to the caller; it is broadcast when approved.
+// Otherwise the set's spends are recorded when it is signed, keyed by its
+// transaction IDs, since it may be broadcast elsewhere.
+func (m *Manager) SignTransactionSet(txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string, sign func() ([]types.Transaction, []types.V2Transaction, error)) (pt PendingTransaction, pending bool, err error) {
+	m.spendMu.Lock()
+	defer m.spendMu.Unlock()
+
+	policies, err := m.store.WalletPolicies()
+	if err != nil {
+		return PendingTransaction{}, false, fmt.Errorf("failed to get wallet policies: %w", err)
+	}
+	outflows, err := m.setOutflows(policies, txns, v2txns)
+	if err != nil {
+		return PendingTransaction{}, false, err
+	} else if err := m.checkPolicies(policies, outflows, txns, v2txns); err != nil {
+		return PendingTransaction{}, false, err
+	}
+
+	signed, v2signed, err := sign()
+	if err != nil {
+		return PendingTransaction{}, false, err
+	} else if id, outflow, ok := requiresApproval(policies, outflows); ok {
+		pt, err := m.addPending(id, outflow, signed, v2signed, submittedBy)
+		return pt, err == nil, err
+	} else if err := m.store.AddSignedSpends(transactionIDs(signed, v2signed), outflows, time.Now()); err != nil {
+		return PendingTransaction{}, false, fmt.Errorf("failed to record spends: %w", err)
+	}
+	return PendingTransaction{}, false, nil
+}
+
+// RecordTransfer checks an off-chain transfer of amount siacoins from a
+// wallet against its policy, then calls record and records the spend.
+// Off-chain transfers do not pay an address, so the wallet's allowlist does
+// not apply, and they cannot be queued, so transfers over the approval
+// threshold return ErrApprovalRequired.
+func (m *Manager) RecordTransfer(id wallet.ID, amount types.Currency, record func() error) error {
+	m.spendMu.Lock()
+	defer m.spendMu.Unlock()
+
+	policy, err := m.store.WalletPolicy(id)
+	if err != nil {
+		return fmt.Errorf("failed to get wallet policy: %w", err)
+	} else if threshold := policy.ApprovalThreshold; !threshold.IsZero() && amount.Cmp(threshold) > 0 {
+		return fmt.Errorf("wallet %v would send %v of %v: %w", id, amount, threshold, ErrApprovalRequired)
+	} else if err := m.checkLimits(id, policy, amount); err != nil {
+		return err
+	}
+	return m.broadcast(map[wallet.ID]types.Currency{id: amount}, record)
+}
+
+// requiresApproval returns the first wallet whose outflow exceeds its
+// approval threshold.
+func requiresApproval(policies map[wallet.ID]Policy, outflows map[wallet.ID]types.Currency) (wallet.ID, types.Currency, bool) {
+	for id, outflow := range outflows {
+		threshold := policies[id].ApprovalThreshold
+		if !threshold.IsZero() && outflow.Cmp(threshold) > 0 {
+			return id, outflow, true
+		}
+	}
+	return 0, types.ZeroCurrency, false
+}
+
+// addPending adds a transaction set to the pending queue.
+func (m *Manager) addPending(id wallet.ID, outflow types.Currency, txns []types.Transaction, v2txns []types.V2Transaction, submittedBy string) (PendingTransaction, error) {
+	pt, err := m.store.AddPendingTransaction(PendingTransaction{
+		WalletID:       id,
+		Amount:         outflow,
+		Transactions:   txns,
+		V2Transactions: v2txns,
+		Status:         StatusPending,
+		SubmittedBy:    submittedBy,
+		DateCreated:    time.Now().Truncate(time.Second),
+	})
+	if err != nil {
+		return PendingTransaction{}, fmt.Errorf("failed to add pending transaction: %w", err)
+	}
+	m.log.Info("transaction set requires approval", zap.Int64("id", pt.ID), zap.Int64("wallet", int64(id)), zap.Stringer("amount", outflow))
+	m.broadcastEvent("pending", pt)
+	return pt, nil
+}
+
+// LimitStatus returns the state of a wallet's spending limits.
+func (m *Manager) LimitStatus(id wallet.ID) (LimitStatus, error) {
+	policy, err := m.store.WalletPolicy(id)
+	if err != nil {
+		return LimitStatus{}, fmt.Errorf("failed to get wallet policy: %w", err)
+	}
+
+	status := func(limit types.Currency, period time.Duration) (Limit, error) {
+		spent, err := m.store.WalletSpent(id, time.Now().Add(-period))
+		if err != nil {
+			return Limit{}, fmt.Errorf("failed to get amount spent: %w", err)
+		}
+		l := Limit{Limit: limit, Spent: spent}
+		if spent.Cmp(limit) < 0 {
+			l.Remaining = limit.Sub(spent)
+		}
+		return l, nil
+	}
+
+	var ls LimitStatus
+	if ls.Daily, err = status(policy.DailyLimit, day); err != nil {
+		return LimitStatus{}, err
+	} else if ls.Weekly, err = status(policy.WeeklyLimit, week); err != nil {
+		return LimitStatus{}, err
+	}
+	exp, err := m.store.LimitOverride(id)
+	if err != nil {
+		return LimitStatus{}, fmt.Errorf("failed to get limit override: %w", err)
+	} else if time.Now().Before(exp) {
+		ls.OverrideExpiration = exp
+	}
+	return ls, nil
+}
+
+// OverrideLimits suspends enforcement of a wallet's spending limits until the
+// expiration. An expiration in the past removes the override.
+func (m *Manager) OverrideLimits(id wallet.ID, expiration time.Time, overriddenBy string) error {
+	if _, err := m.store.WalletPolicy(id); err != nil {
+		return err
+	} else if time.Until(expiration) > maxOverrideDuration {
+		return fmt.Errorf("override cannot be longer than %v", maxOverrideDuration)
+	}
+
+	if !time.Now().Before(expiration) {
+		expiration = time.Time{}
+	}
+	if err := m.store.SetLimitOverride(id, expiration); err != nil {
+		return fmt.Errorf("failed to set limit override: %w", err)
+	}
+	m.log.Warn("spending limits overridden", zap.Int64("wallet", int64(id)), zap.Time("expiration", expiration), zap.String("overriddenBy", overriddenBy))
+	return nil
+}
+
+// PendingTransaction returns a pending transaction.
+func (m *Manager) PendingTransaction(id int64) (PendingTransaction, error) {
+	return m.store.PendingTransaction(id)
+}
+
+// PendingTransactions returns pending transactions with the given status. An
+// empty status returns transactions with any status.
+func (m *Manager) PendingTransactions(status string, offset, limit int) ([]PendingTransaction, error) {
+	return m.store.PendingTransactions(status, offset, limit)
+}
+
+// Approve approves a pending transaction and calls broadcast with it. The
+// approver must use a different credential than the submitter. The
+// transaction is marked approved before broadcast is called, so concurrent
+// approvals broadcast it at most once, and is returned to the pending queue
+// if broadcast returns an error. The wallet's spending limits and allowlist
+// are checked again before the transaction set is broadcast.
+func (m *Manager) Approve(id int64, approvedBy string, broadcast func(PendingTransaction) error) (PendingTransaction, error) {
+	pt, err := m.store.PendingTransaction(id)
+	if err != nil {
+		return PendingTransaction{}, err
+	} else if pt.Status != StatusPending {
+		return PendingTransaction{}, ErrNotPending
+	} else if pt.SubmittedBy != "" && Credential(pt.SubmittedBy) == Credential(approvedBy) {
+		return PendingTransaction{}, ErrSameCredential
+	}
+
+	m.spendMu.Lock()
+	defer m.spendMu.Unlock()
+	policies, err := m.store.WalletPolicies()
+	if err != nil {
+		return PendingTransaction{}, fmt.Errorf("failed to get wallet policies: %w", err)
+	}
+	outflows, err := m.setOutflows(policies, pt.Transactions, pt.V2Transactions)
+	if err != nil {
+		return PendingTransaction{}, err
+	}
+	if err := m.checkPolicies(policies, outflows, pt.Transactions, pt.V2Transactions); err != nil {
+		return PendingTransaction{}, err
+	}
+
+	pt.Status = StatusApproved
+	pt.DecidedBy = approvedBy
+	pt.DateDecided = time.Now().Truncate(time.Second)
+	if err := m.store.DecidePendingTransaction(id, pt.Status, pt.DecidedBy, pt.DateDecided); err != nil {
+		return PendingTransaction{}, fmt.Errorf("failed to approve transaction: %w", err)
+	}
+	if err := broadcast(pt); err != nil {
+		if err := m.store.ReopenPendingTransaction(id); err != nil {
+			m.log.Error("failed to reopen pending transaction", zap.Int64("id", id), zap.Error(err))
+		}
+		return PendingTransaction{}, fmt.Errorf("failed to broadcast transaction set: %w", err)
+	} else if err := m.recordSpends(outflows); err != nil {
+		return PendingTransaction{}, err
+	}
+	m.log.Info("transaction set approved", zap.Int64("id", id), zap.String("approvedBy", approvedBy))
+	m.broadcastEvent("approved", pt)
+	return pt, nil
+}
+
+// Reject rejects a pending transaction.
+func (m *Manager) Reject(id int64, rejectedBy string) (PendingTransaction, error) {
+	pt, err := m.store.PendingTransaction(id)
+	if err != nil {
+		return PendingTransaction{}, err
+	} else if pt.Status != StatusPending {
+		return PendingTransaction{}, ErrNotPending
+	}
+
+	pt.Status = StatusRejected
+	pt.DecidedBy = rejectedBy
+	pt.DateDecided = time.Now().Truncate(time.Second)
+	if err := m.store.DecidePendingTransaction(id, pt.Status, pt.DecidedBy, pt.DateDecided); err != nil {
+		return PendingTransaction{}, fmt.Errorf("failed to reject transaction: %w", err)
+	}
+	m.log.Info("transaction set rejected", zap.Int64("id", id), zap.String("rejectedBy", rejectedBy))
+	m.broadcastEvent("rejected", pt)
+	return pt, nil
+}
+
+// NewManager creates a new treasury manager.
+func NewManager(store Store, wm WalletManager, opts ...Option) *Manager {
+	m := &Manager{
+		store: store,
+		wm:    wm,
+		log:   zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
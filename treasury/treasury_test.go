@@ -0,0 +1,531 @@
+package treasury_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/treasury"
+	"go.thebigfile.com/walletd/wallet"
+	"go.uber.org/zap/zaptest"
+)
+
+type mockWalletManager struct {
+	outflows map[wallet.ID]types.Currency
+}
+
+func (m *mockWalletManager) WalletOutflow(id wallet.ID, txns []types.Transaction, v2txns []types.V2Transaction) (types.Currency, error) {
+	return m.outflows[id], nil
+}
+
+func TestApprovals(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "treasury"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &mockWalletManager{outflows: make(map[wallet.ID]types.Currency)}
+	tm := treasury.NewManager(db, wm, treasury.WithLogger(log.Named("treasury")))
+
+	if err := tm.SetWalletPolicy(w.ID, treasury.Policy{ApprovalThreshold: types.Siacoins(100)}); err != nil {
+		t.Fatal(err)
+	} else if policy, err := tm.WalletPolicy(w.ID); err != nil {
+		t.Fatal(err)
+	} else if !policy.ApprovalThreshold.Equals(types.Siacoins(100)) {
+		t.Fatalf("expected threshold %v, got %v", types.Siacoins(100), policy.ApprovalThreshold)
+	}
+
+	txns := []types.Transaction{{
+		SiacoinOutputs: []types.SiacoinOutput{{Address: types.VoidAddress, Value: types.Siacoins(150)}},
+	}}
+
+	noop := func() error { return nil }
+
+	// below the threshold
+	wm.outflows[w.ID] = types.Siacoins(100)
+	if _, pending, err := tm.BroadcastTransactionSet(txns, nil, "key:a", noop); err != nil {
+		t.Fatal(err)
+	} else if pending {
+		t.Fatal("expected transaction set below the threshold to be allowed")
+	}
+
+	// above the threshold
+	wm.outflows[w.ID] = types.Siacoins(150)
+	pt, pending, err := tm.BroadcastTransactionSet(txns, nil, "key:a", noop)
+	if err != nil {
+		t.Fatal(err)
+	} else if !pending {
+		t.Fatal("expected transaction set above the threshold to require approval")
+	} else if pt.Status != treasury.StatusPending || pt.WalletID != w.ID || !pt.Amount.Equals(types.Siacoins(150)) {
+		t.Fatalf("unexpected pending transaction: %+v", pt)
+	} else if len(pt.Transactions) != 1 || pt.Transactions[0].ID() != txns[0].ID() {
+		t.Fatal("expected pending transaction to contain the transaction set")
+	}
+
+	if pending, err := tm.PendingTransactions(treasury.StatusPending, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(pending) != 1 || pending[0].ID != pt.ID {
+		t.Fatalf("expected 1 pending transaction, got %d", len(pending))
+	}
+
+	var broadcast int
+	broadcastFn := func(treasury.PendingTransaction) error {
+		broadcast++
+		return nil
+	}
+
+	// the submitter cannot approve their own transaction
+	if _, err := tm.Approve(pt.ID, "key:a", broadcastFn); !errors.Is(err, treasury.ErrSameCredential) {
+		t.Fatalf("expected ErrSameCredential, got %v", err)
+	} else if broadcast != 0 {
+		t.Fatal("expected transaction set not to be broadcast")
+	}
+
+	// a failed broadcast leaves the transaction pending
+	if _, err := tm.Approve(pt.ID, "key:b", func(treasury.PendingTransaction) error { return errors.New("invalid") }); err == nil {
+		t.Fatal("expected approval to fail")
+	} else if pt, err := tm.PendingTransaction(pt.ID); err != nil {
+		t.Fatal(err)
+	} else if pt.Status != treasury.StatusPending {
+		t.Fatalf("expected status %q, got %q", treasury.StatusPending, pt.Status)
+	}
+
+	approved, err := tm.Approve(pt.ID, "key:b", broadcastFn)
+	if err != nil {
+		t.Fatal(err)
+	} else if broadcast != 1 {
+		t.Fatal("expected transaction set to be broadcast")
+	} else if approved.Status != treasury.StatusApproved || approved.DecidedBy != "key:b" {
+		t.Fatalf("unexpected approved transaction: %+v", approved)
+	}
+
+	if _, err := tm.Approve(pt.ID, "key:b", broadcastFn); !errors.Is(err, treasury.ErrNotPending) {
+		t.Fatalf("expected ErrNotPending, got %v", err)
+	} else if _, err := tm.Reject(pt.ID, "key:b"); !errors.Is(err, treasury.ErrNotPending) {
+		t.Fatalf("expected ErrNotPending, got %v", err)
+	}
+
+	// reject a second transaction
+	pt, _, err = tm.BroadcastTransactionSet(txns, nil, "key:a", noop)
+	if err != nil {
+		t.Fatal(err)
+	} else if rejected, err := tm.Reject(pt.ID, "key:b"); err != nil {
+		t.Fatal(err)
+	} else if rejected.Status != treasury.StatusRejected {
+		t.Fatalf("expected status %q, got %q", treasury.StatusRejected, rejected.Status)
+	}
+
+	if all, err := tm.PendingTransactions("", 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(all) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(all))
+	} else if pending, err := tm.PendingTransactions(treasury.StatusPending, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(pending) != 0 {
+		t.Fatalf("expected 0 pending transactions, got %d", len(pending))
+	}
+
+	if _, err := tm.PendingTransaction(1000); !errors.Is(err, treasury.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// logins that share a credential cannot approve each other's
+	// transactions
+	pt, _, err = tm.BroadcastTransactionSet(txns, nil, "password", noop)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := tm.Approve(pt.ID, "password/session:01020304", broadcastFn); !errors.Is(err, treasury.ErrSameCredential) {
+		t.Fatalf("expected ErrSameCredential, got %v", err)
+	}
+
+	// concurrent approvals broadcast the transaction set once
+	var mu sync.Mutex
+	broadcast = 0
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = tm.Approve(pt.ID, fmt.Sprintf("key:%d", i), func(treasury.PendingTransaction) error {
+				mu.Lock()
+				defer mu.Unlock()
+				broadcast++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	var approvals int
+	for _, err := range errs {
+		if err == nil {
+			approvals++
+		} else if !errors.Is(err, treasury.ErrNotPending) {
+			t.Fatalf("expected ErrNotPending, got %v", err)
+		}
+	}
+	if approvals != 1 || broadcast != 1 {
+		t.Fatalf("expected 1 approval and broadcast, got %d approvals and %d broadcasts", approvals, broadcast)
+	}
+
+	// sets submitted without authentication can be approved by anyone
+	pt, _, err = tm.BroadcastTransactionSet(txns, nil, "", noop)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := tm.Approve(pt.ID, "anonymous", broadcastFn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignTransactionSet(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &mockWalletManager{outflows: make(map[wallet.ID]types.Currency)}
+	tm := treasury.NewManager(db, wm, treasury.WithLogger(log.Named("treasury")))
+	if err := tm.SetWalletPolicy(w.ID, treasury.Policy{ApprovalThreshold: types.Siacoins(100), DailyLimit: types.Siacoins(500)}); err != nil {
+		t.Fatal(err)
+	}
+
+	txn := types.Transaction{ArbitraryData: [][]byte{[]byte("unsigned")}}
+	var signed int
+	sign := func() ([]types.Transaction, []types.V2Transaction, error) {
+		signed++
+		return []types.Transaction{{ArbitraryData: [][]byte{[]byte("signed")}}}, nil, nil
+	}
+
+	// below the threshold
+	wm.outflows[w.ID] = types.Siacoins(50)
+	if _, pending, err := tm.SignTransactionSet([]types.Transaction{txn}, nil, "key:a", sign); err != nil {
+		t.Fatal(err)
+	} else if pending || signed != 1 {
+		t.Fatal("expected transaction to be signed and released")
+	}
+
+	// above the threshold, the signed transaction is queued
+	wm.outflows[w.ID] = types.Siacoins(150)
+	pt, pending, err := tm.SignTransactionSet([]types.Transaction{txn}, nil, "key:a", sign)
+	if err != nil {
+		t.Fatal(err)
+	} else if !pending || signed != 2 {
+		t.Fatal("expected signed transaction to require approval")
+	} else if len(pt.Transactions) != 1 || string(pt.Transactions[0].ArbitraryData[0]) != "signed" {
+		t.Fatalf("expected pending transaction to contain the signed transaction, got %+v", pt.Transactions)
+	}
+
+	// over the limit, the transaction is not signed
+	wm.outflows[w.ID] = types.Siacoins(600)
+	if _, _, err := tm.SignTransactionSet([]types.Transaction{txn}, nil, "key:a", sign); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if signed != 2 {
+		t.Fatal("expected transaction not to be signed")
+	}
+
+	// released signatures count against the limit, so a second set that
+	// would exceed it together with the first is not signed
+	signAs := func(txn types.Transaction) func() ([]types.Transaction, []types.V2Transaction, error) {
+		return func() ([]types.Transaction, []types.V2Transaction, error) {
+			signed++
+			return []types.Transaction{txn}, nil, nil
+		}
+	}
+	first := types.Transaction{ArbitraryData: [][]byte{[]byte("first")}}
+	second := types.Transaction{ArbitraryData: [][]byte{[]byte("second")}}
+	wm.outflows[w.ID] = types.Siacoins(90)
+	if _, pending, err := tm.SignTransactionSet([]types.Transaction{first}, nil, "key:a", signAs(first)); err != nil {
+		t.Fatal(err)
+	} else if pending || signed != 3 {
+		t.Fatal("expected transaction to be signed and released")
+	}
+	wm.outflows[w.ID] = types.Siacoins(400)
+	if _, _, err := tm.SignTransactionSet([]types.Transaction{second}, nil, "key:a", signAs(second)); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if signed != 3 {
+		t.Fatal("expected transaction not to be signed")
+	}
+
+	// broadcasting a signed set through walletd does not count it twice
+	wm.outflows[w.ID] = types.Siacoins(90)
+	if _, _, err := tm.BroadcastTransactionSet([]types.Transaction{first}, nil, "key:a", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	} else if status, err := tm.LimitStatus(w.ID); err != nil {
+		t.Fatal(err)
+	} else if !status.Daily.Spent.Equals(types.Siacoins(140)) {
+		t.Fatalf("expected 140 SC spent, got %v", status.Daily.Spent)
+	}
+}
+
+func TestSpendingLimits(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &mockWalletManager{outflows: make(map[wallet.ID]types.Currency)}
+	tm := treasury.NewManager(db, wm, treasury.WithLogger(log.Named("treasury")))
+
+	if err := tm.SetWalletPolicy(w.ID, treasury.Policy{DailyLimit: types.Siacoins(100), WeeklyLimit: types.Siacoins(500)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var broadcast int
+	broadcastFn := func() error {
+		broadcast++
+		return nil
+	}
+
+	// spend 60 of the daily limit
+	wm.outflows[w.ID] = types.Siacoins(60)
+	if _, pending, err := tm.BroadcastTransactionSet(nil, nil, "key:a", broadcastFn); err != nil {
+		t.Fatal(err)
+	} else if pending {
+		t.Fatal("expected transaction set to be broadcast")
+	} else if broadcast != 1 {
+		t.Fatal("expected broadcast to be called")
+	}
+
+	ls, err := tm.LimitStatus(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	} else if !ls.Daily.Spent.Equals(types.Siacoins(60)) || !ls.Daily.Remaining.Equals(types.Siacoins(40)) {
+		t.Fatalf("unexpected daily limit status: %+v", ls.Daily)
+	} else if !ls.Weekly.Remaining.Equals(types.Siacoins(440)) {
+		t.Fatalf("unexpected weekly limit status: %+v", ls.Weekly)
+	}
+
+	// a failed broadcast is not counted
+	if _, _, err := tm.BroadcastTransactionSet(nil, nil, "key:a", func() error { return errors.New("invalid") }); err == nil {
+		t.Fatal("expected broadcast to fail")
+	} else if ls, err := tm.LimitStatus(w.ID); err != nil {
+		t.Fatal(err)
+	} else if !ls.Daily.Spent.Equals(types.Siacoins(60)) {
+		t.Fatalf("expected 60 SC spent, got %v", ls.Daily.Spent)
+	}
+
+	// another 60 would exceed the daily limit
+	if _, _, err := tm.BroadcastTransactionSet(nil, nil, "key:a", broadcastFn); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if broadcast != 1 {
+		t.Fatal("expected transaction set not to be broadcast")
+	} else if err := tm.CheckFunding(w.ID, types.Siacoins(60), types.Transaction{}); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if err := tm.CheckFunding(w.ID, types.Siacoins(40), types.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// override the limits
+	if err := tm.OverrideLimits(w.ID, time.Now().Add(30*24*time.Hour), "password"); err == nil {
+		t.Fatal("expected override longer than a week to be rejected")
+	} else if err := tm.OverrideLimits(w.ID, time.Now().Add(time.Hour), "password"); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := tm.BroadcastTransactionSet(nil, nil, "key:a", broadcastFn); err != nil {
+		t.Fatal(err)
+	} else if broadcast != 2 {
+		t.Fatal("expected transaction set to be broadcast")
+	} else if ls, err := tm.LimitStatus(w.ID); err != nil {
+		t.Fatal(err)
+	} else if ls.OverrideExpiration.IsZero() {
+		t.Fatal("expected override to be reported")
+	} else if !ls.Daily.Spent.Equals(types.Siacoins(120)) || !ls.Daily.Remaining.IsZero() {
+		t.Fatalf("unexpected daily limit status: %+v", ls.Daily)
+	}
+
+	// overrides are persisted
+	tm = treasury.NewManager(db, wm, treasury.WithLogger(log.Named("treasury")))
+	if err := tm.CheckFunding(w.ID, types.Siacoins(1), types.Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// clear the override
+	if err := tm.OverrideLimits(w.ID, time.Time{}, "password"); err != nil {
+		t.Fatal(err)
+	} else if err := tm.CheckFunding(w.ID, types.Siacoins(1), types.Transaction{}); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+
+	// concurrent broadcasts cannot exceed a limit together
+	w2, err := db.AddWallet(wallet.Wallet{Name: "hot2"})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tm.SetWalletPolicy(w2.ID, treasury.Policy{DailyLimit: types.Siacoins(100)}); err != nil {
+		t.Fatal(err)
+	}
+	delete(wm.outflows, w.ID)
+	wm.outflows[w2.ID] = types.Siacoins(30)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sent int
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tm.BroadcastTransactionSet(nil, nil, "key:a", func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				sent++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if sent != 3 {
+		t.Fatalf("expected 3 broadcasts within the limit, got %d", sent)
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	if _, err := db.AddWalletAddress(w.ID, wallet.Address{Address: change}); err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &mockWalletManager{outflows: map[wallet.ID]types.Currency{w.ID: types.Siacoins(10)}}
+	tm := treasury.NewManager(db, wm, treasury.WithLogger(log.Named("treasury")))
+
+	if err := tm.SetWalletPolicy(w.ID, treasury.Policy{RestrictDestinations: true, AllowlistDelay: 3600}); err != nil {
+		t.Fatal(err)
+	}
+
+	noop := func() error { return nil }
+	dest := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	txns := []types.Transaction{{
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Address: dest, Value: types.Siacoins(10)},
+			{Address: change, Value: types.Siacoins(5)},
+		},
+	}}
+
+	// the destination is not allowlisted
+	if _, _, err := tm.BroadcastTransactionSet(txns, nil, "key:a", noop); !errors.Is(err, treasury.ErrDestinationNotAllowed) {
+		t.Fatalf("expected ErrDestinationNotAllowed, got %v", err)
+	} else if err := tm.CheckFunding(w.ID, types.Siacoins(10), txns[0]); !errors.Is(err, treasury.ErrDestinationNotAllowed) {
+		t.Fatalf("expected ErrDestinationNotAllowed, got %v", err)
+	}
+
+	// sending to the wallet's own addresses is always allowed
+	if err := tm.CheckFunding(w.ID, types.Siacoins(5), types.Transaction{SiacoinOutputs: txns[0].SiacoinOutputs[1:]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the destination is not active until the delay has passed
+	entry, err := tm.AddAllowlistEntry(w.ID, dest, "exchange")
+	if err != nil {
+		t.Fatal(err)
+	} else if entry.ActiveAfter.Sub(entry.DateAdded) != time.Hour {
+		t.Fatalf("expected entry to activate after 1 hour, got %v", entry.ActiveAfter.Sub(entry.DateAdded))
+	} else if _, _, err := tm.BroadcastTransactionSet(txns, nil, "key:a", noop); !errors.Is(err, treasury.ErrDestinationNotAllowed) {
+		t.Fatalf("expected ErrDestinationNotAllowed, got %v", err)
+	}
+
+	// re-adding the address does not reset the delay
+	if err := db.AddAllowlistEntry(w.ID, treasury.AllowlistEntry{Address: dest, DateAdded: time.Now(), ActiveAfter: time.Now()}); err != nil {
+		t.Fatal(err)
+	} else if entries, err := tm.Allowlist(w.ID); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || !entries[0].ActiveAfter.Equal(entry.ActiveAfter) || entries[0].Description != "exchange" {
+		t.Fatalf("unexpected allowlist: %+v", entries)
+	}
+
+	// remove the delay and add an active entry
+	if err := tm.RemoveAllowlistEntry(w.ID, dest); err != nil {
+		t.Fatal(err)
+	} else if err := tm.SetWalletPolicy(w.ID, treasury.Policy{RestrictDestinations: true}); err != nil {
+		t.Fatal(err)
+	} else if _, err := tm.AddAllowlistEntry(w.ID, dest, "exchange"); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := tm.BroadcastTransactionSet(txns, nil, "key:a", noop); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tm.RemoveAllowlistEntry(w.ID, dest); err != nil {
+		t.Fatal(err)
+	} else if err := tm.RemoveAllowlistEntry(w.ID, dest); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	} else if _, _, err := tm.BroadcastTransactionSet(txns, nil, "key:a", noop); !errors.Is(err, treasury.ErrDestinationNotAllowed) {
+		t.Fatalf("expected ErrDestinationNotAllowed, got %v", err)
+	}
+}
+
+func TestRecordTransfer(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wm := &mockWalletManager{outflows: make(map[wallet.ID]types.Currency)}
+	tm := treasury.NewManager(db, wm, treasury.WithLogger(log.Named("treasury")))
+	if err := tm.SetWalletPolicy(w.ID, treasury.Policy{ApprovalThreshold: types.Siacoins(80), DailyLimit: types.Siacoins(100)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var recorded int
+	record := func() error {
+		recorded++
+		return nil
+	}
+
+	// transfers count toward the spending limits
+	if err := tm.RecordTransfer(w.ID, types.Siacoins(60), record); err != nil {
+		t.Fatal(err)
+	} else if recorded != 1 {
+		t.Fatal("expected the transfer to be recorded")
+	} else if ls, err := tm.LimitStatus(w.ID); err != nil {
+		t.Fatal(err)
+	} else if !ls.Daily.Spent.Equals(types.Siacoins(60)) {
+		t.Fatalf("expected 60 SC spent, got %v", ls.Daily.Spent)
+	}
+
+	if err := tm.RecordTransfer(w.ID, types.Siacoins(60), record); !errors.Is(err, treasury.ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	} else if err := tm.RecordTransfer(w.ID, types.Siacoins(90), record); !errors.Is(err, treasury.ErrApprovalRequired) {
+		t.Fatalf("expected ErrApprovalRequired, got %v", err)
+	} else if recorded != 1 {
+		t.Fatal("expected rejected transfers not to be recorded")
+	}
+}
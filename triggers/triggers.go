@@ -0,0 +1,229 @@
+// Package triggers fires webhook events at chain heights, so external jobs
+// can be scheduled against chain time instead of polling.
+package triggers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.uber.org/zap"
+)
+
+// ScopeTriggers is the webhook scope of trigger events. Each trigger's
+// events are sent to the narrower scope "triggers/<id>".
+const ScopeTriggers = "triggers"
+
+// EventFired is the name of the event sent when a trigger fires.
+const EventFired = "fired"
+
+var (
+	// ErrNotFound is returned when a trigger is not found.
+	ErrNotFound = errors.New("trigger not found")
+	// ErrHeightReached is returned when adding a trigger for a height the
+	// tip has already reached.
+	ErrHeightReached = errors.New("height has already been reached")
+)
+
+type (
+	// A Trigger fires an event when the tip reaches a height. A trigger
+	// with a Height fires once and is then removed. A trigger with an
+	// Interval fires whenever the tip reaches a multiple of the interval.
+	Trigger struct {
+		ID       int64  `json:"id"`
+		Name     string `json:"name"`
+		Height   uint64 `json:"height,omitempty"`
+		Interval uint64 `json:"interval,omitempty"`
+		// NextHeight is the height at which the trigger fires next.
+		NextHeight uint64 `json:"nextHeight"`
+		// LastFired is the tip the trigger last fired at. It is zero if
+		// the trigger has not fired.
+		LastFired   types.ChainIndex `json:"lastFired"`
+		DateCreated time.Time        `json:"dateCreated"`
+	}
+
+	// A FiredEvent is the data of the event sent when a trigger fires.
+	FiredEvent struct {
+		Trigger Trigger `json:"trigger"`
+		// Tip is the tip that caused the trigger to fire. If the tip
+		// skipped past the trigger's height, e.g. while syncing, it is
+		// higher than the scheduled height and the trigger fires once.
+		Tip types.ChainIndex `json:"tip"`
+	}
+
+	// A Store persists triggers.
+	Store interface {
+		AddTrigger(Trigger) (Trigger, error)
+		Triggers() ([]Trigger, error)
+		// RemoveTrigger returns ErrNotFound if the trigger does not
+		// exist.
+		RemoveTrigger(id int64) error
+		// UpdateTrigger sets the tip a trigger last fired at and the
+		// height it fires at next.
+		UpdateTrigger(id int64, lastFired types.ChainIndex, nextHeight uint64) error
+	}
+
+	// A ChainManager provides the consensus tip.
+	ChainManager interface {
+		Tip() types.ChainIndex
+		OnReorg(fn func(types.ChainIndex)) (cancel func())
+	}
+
+	// An EventBroadcaster delivers fired triggers to the webhooks
+	// subscribed to each trigger's scope.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// A Manager fires triggers as the consensus tip advances.
+	Manager struct {
+		store  Store
+		cm     ChainManager
+		events EventBroadcaster
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+
+		mu sync.Mutex // serializes changes to triggers
+	}
+)
+
+// Scope returns the webhook scope of a trigger's events.
+func Scope(id int64) string {
+	return ScopeTriggers + "/" + strconv.FormatInt(id, 10)
+}
+
+// nextMultiple returns the smallest multiple of interval greater than
+// height.
+func nextMultiple(height, interval uint64) uint64 {
+	return (height/interval + 1) * interval
+}
+
+// Close stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// AddTrigger adds a trigger that fires once at the given height, or every
+// interval blocks. Exactly one of height and interval must be non-zero.
+func (m *Manager) AddTrigger(name string, height, interval uint64) (Trigger, error) {
+	if (height == 0) == (interval == 0) {
+		return Trigger{}, errors.New("exactly one of height and interval must be set")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tip := m.cm.Tip()
+	t := Trigger{
+		Name:        name,
+		Height:      height,
+		Interval:    interval,
+		DateCreated: time.Now().Truncate(time.Second),
+	}
+	if height != 0 {
+		if height <= tip.Height {
+			return Trigger{}, ErrHeightReached
+		}
+		t.NextHeight = height
+	} else {
+		t.NextHeight = nextMultiple(tip.Height, interval)
+	}
+	t, err := m.store.AddTrigger(t)
+	if err != nil {
+		return Trigger{}, fmt.Errorf("failed to add trigger: %w", err)
+	}
+	return t, nil
+}
+
+// RemoveTrigger removes a trigger.
+func (m *Manager) RemoveTrigger(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.store.RemoveTrigger(id)
+}
+
+// Triggers returns all triggers.
+func (m *Manager) Triggers() ([]Trigger, error) {
+	return m.store.Triggers()
+}
+
+// fire fires every trigger whose next height has been reached by the tip.
+func (m *Manager) fire(tip types.ChainIndex) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	triggers, err := m.store.Triggers()
+	if err != nil {
+		return fmt.Errorf("failed to get triggers: %w", err)
+	}
+	for _, t := range triggers {
+		if t.NextHeight > tip.Height {
+			continue
+		}
+
+		t.LastFired = tip
+		if err := m.events.BroadcastEvent(Scope(t.ID), EventFired, FiredEvent{Trigger: t, Tip: tip}); err != nil {
+			return fmt.Errorf("failed to broadcast trigger %d: %w", t.ID, err)
+		}
+		m.log.Debug("fired trigger", zap.Int64("id", t.ID), zap.String("name", t.Name), zap.Stringer("tip", tip))
+
+		if t.Interval == 0 {
+			err = m.store.RemoveTrigger(t.ID)
+		} else {
+			err = m.store.UpdateTrigger(t.ID, tip, nextMultiple(tip.Height, t.Interval))
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return fmt.Errorf("failed to update trigger %d: %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// NewManager creates a new trigger manager. Triggers whose height was
+// reached while walletd was offline fire immediately.
+func NewManager(store Store, cm ChainManager, events EventBroadcaster, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store:  store,
+		cm:     cm,
+		events: events,
+		log:    zap.NewNop(),
+		tg:     threadgroup.New(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	signal := make(chan struct{}, 1)
+	signal <- struct{}{}
+	unsubscribe := cm.OnReorg(func(types.ChainIndex) {
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	})
+	go func() {
+		defer cancel()
+		defer unsubscribe()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signal:
+			}
+			if err := m.fire(m.cm.Tip()); err != nil {
+				m.log.Warn("failed to fire triggers", zap.Error(err))
+			}
+		}
+	}()
+	return m, nil
+}
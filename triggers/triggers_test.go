@@ -0,0 +1,149 @@
+package triggers_test
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/triggers"
+	"go.uber.org/zap/zaptest"
+)
+
+type chainManager struct {
+	mu  sync.Mutex
+	tip types.ChainIndex
+	fns []func(types.ChainIndex)
+}
+
+func (cm *chainManager) Tip() types.ChainIndex {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.tip
+}
+
+func (cm *chainManager) OnReorg(fn func(types.ChainIndex)) func() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.fns = append(cm.fns, fn)
+	return func() {}
+}
+
+func (cm *chainManager) setTip(height uint64) {
+	cm.mu.Lock()
+	cm.tip = types.ChainIndex{Height: height, ID: types.BlockID{byte(height)}}
+	fns := cm.fns
+	cm.mu.Unlock()
+	for _, fn := range fns {
+		fn(cm.tip)
+	}
+}
+
+type event struct {
+	scope string
+	data  triggers.FiredEvent
+}
+
+type broadcaster struct {
+	events chan event
+}
+
+func (b *broadcaster) BroadcastEvent(scope, name string, data any) error {
+	if name != triggers.EventFired {
+		panic("unexpected event " + name)
+	}
+	b.events <- event{scope, data.(triggers.FiredEvent)}
+	return nil
+}
+
+func (b *broadcaster) next(t *testing.T) event {
+	t.Helper()
+	select {
+	case ev := <-b.events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for trigger")
+		panic("unreachable")
+	}
+}
+
+func (b *broadcaster) none(t *testing.T) {
+	t.Helper()
+	select {
+	case ev := <-b.events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTriggers(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cm := &chainManager{}
+	cm.setTip(10)
+	b := &broadcaster{events: make(chan event, 10)}
+	m, err := triggers.NewManager(db, cm, b, triggers.WithLogger(log.Named("triggers")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if _, err := m.AddTrigger("invalid", 20, 5); err == nil {
+		t.Fatal("expected error with both height and interval")
+	} else if _, err := m.AddTrigger("past", 10, 0); !errors.Is(err, triggers.ErrHeightReached) {
+		t.Fatalf("expected ErrHeightReached, got %v", err)
+	}
+
+	once, err := m.AddTrigger("payout", 12, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	every, err := m.AddTrigger("maintenance", 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	} else if every.NextHeight != 15 {
+		t.Fatalf("expected next height 15, got %v", every.NextHeight)
+	}
+
+	cm.setTip(11)
+	b.none(t)
+
+	cm.setTip(12)
+	if ev := b.next(t); ev.scope != triggers.Scope(once.ID) || ev.data.Tip.Height != 12 || ev.data.Trigger.Name != "payout" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	b.none(t)
+	if ts, err := m.Triggers(); err != nil {
+		t.Fatal(err)
+	} else if len(ts) != 1 || ts[0].ID != every.ID {
+		t.Fatalf("expected only the interval trigger, got %+v", ts)
+	}
+
+	// skipping past several multiples fires once
+	cm.setTip(27)
+	if ev := b.next(t); ev.scope != triggers.Scope(every.ID) || ev.data.Tip.Height != 27 {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	b.none(t)
+	if ts, err := m.Triggers(); err != nil {
+		t.Fatal(err)
+	} else if ts[0].NextHeight != 30 || ts[0].LastFired.Height != 27 {
+		t.Fatalf("unexpected trigger %+v", ts[0])
+	}
+
+	if err := m.RemoveTrigger(every.ID); err != nil {
+		t.Fatal(err)
+	} else if err := m.RemoveTrigger(every.ID); !errors.Is(err, triggers.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	cm.setTip(30)
+	b.none(t)
+}
@@ -0,0 +1,50 @@
+package usage
+
+import (
+	"time"
+
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// An Option configures a Manager.
+type Option func(*Manager)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithFlushInterval sets how often call counts are written to the store. The
+// default is one minute.
+func WithFlushInterval(d time.Duration) Option {
+	return func(m *Manager) {
+		m.flushInterval = d
+	}
+}
+
+// WithDefaultQuota sets the quota of tenants that do not have their own.
+func WithDefaultQuota(q Quota) Option {
+	return func(m *Manager) {
+		m.defaultQuota = q
+	}
+}
+
+// WithQuotas sets the quotas of individual tenants, keyed by tenant name.
+func WithQuotas(quotas map[string]Quota) Option {
+	return func(m *Manager) {
+		for tenant, q := range quotas {
+			m.quotas[tenant] = q
+		}
+	}
+}
+
+// WithScheduler registers the flush of API call counts as the "usage" job.
+// Pausing it keeps the counts in memory until it resumes.
+func WithScheduler(s *jobs.Scheduler) Option {
+	return func(m *Manager) {
+		m.sched = s
+	}
+}
@@ -0,0 +1,221 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/walletd/jobs"
+	"go.uber.org/zap"
+)
+
+// ErrQuotaExceeded is returned when a tenant has exceeded its quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type (
+	// A Quota limits a tenant's usage. Zero values are unlimited.
+	Quota struct {
+		// Calls is the maximum number of API calls per UTC day.
+		Calls     uint64 `json:"calls"`
+		Wallets   int    `json:"wallets"`
+		Addresses int    `json:"addresses"`
+	}
+
+	// A Record is the number of API calls made by a principal on a UTC
+	// day.
+	Record struct {
+		Date      time.Time `json:"date"`
+		Tenant    string    `json:"tenant,omitempty"`
+		Principal string    `json:"principal"`
+		Calls     uint64    `json:"calls"`
+	}
+
+	// A Store persists API call counts.
+	Store interface {
+		// AddAPICalls adds the calls of each record to the stored count for
+		// its date, tenant, and principal.
+		AddAPICalls([]Record) error
+		// APICalls returns the call counts on or after the given date.
+		APICalls(since time.Time) ([]Record, error)
+	}
+
+	// A Manager counts API calls and enforces quotas. Calls are counted in
+	// memory and periodically flushed to the store.
+	Manager struct {
+		store         Store
+		log           *zap.Logger
+		tg            *threadgroup.ThreadGroup
+		sched         *jobs.Scheduler
+		flushInterval time.Duration
+
+		defaultQuota Quota
+		quotas       map[string]Quota
+
+		mu          sync.Mutex
+		day         time.Time
+		tenantCalls map[string]uint64 // calls made today by each tenant
+		pending     map[recordKey]uint64
+	}
+
+	recordKey struct {
+		date      time.Time
+		tenant    string
+		principal string
+	}
+)
+
+// day returns the start of the UTC day containing t.
+func day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Quota returns the quota of a tenant. Credentials without a tenant are
+// unlimited.
+func (m *Manager) Quota(tenant string) Quota {
+	if tenant == "" {
+		return Quota{}
+	} else if q, ok := m.quotas[tenant]; ok {
+		return q
+	}
+	return m.defaultQuota
+}
+
+// RecordCall counts an API call made by the principal. If the principal's
+// tenant has already made its daily quota of calls, the call is not counted
+// and ErrQuotaExceeded is returned.
+func (m *Manager) RecordCall(tenant, principal string) error {
+	today := day(time.Now())
+	quota := m.Quota(tenant)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !today.Equal(m.day) {
+		m.day = today
+		m.tenantCalls = make(map[string]uint64)
+	}
+	if quota.Calls > 0 && m.tenantCalls[tenant] >= quota.Calls {
+		return fmt.Errorf("%w: %d calls per day", ErrQuotaExceeded, quota.Calls)
+	}
+	m.tenantCalls[tenant]++
+	m.pending[recordKey{today, tenant, principal}]++
+	return nil
+}
+
+// flush writes the pending call counts to the store.
+func (m *Manager) flush() error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[recordKey]uint64)
+	m.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	records := make([]Record, 0, len(pending))
+	for k, calls := range pending {
+		records = append(records, Record{Date: k.date, Tenant: k.tenant, Principal: k.principal, Calls: calls})
+	}
+	if err := m.store.AddAPICalls(records); err != nil {
+		// add the calls back so they are retried on the next flush
+		m.mu.Lock()
+		for k, calls := range pending {
+			m.pending[k] += calls
+		}
+		m.mu.Unlock()
+		return fmt.Errorf("failed to store API calls: %w", err)
+	}
+	return nil
+}
+
+// Usage returns the API calls made on or after the UTC day containing since,
+// including calls that have not been flushed. Records are sorted by date,
+// then tenant, then principal.
+func (m *Manager) Usage(since time.Time) ([]Record, error) {
+	since = day(since)
+	stored, err := m.store.APICalls(since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API calls: %w", err)
+	}
+
+	merged := make(map[recordKey]uint64)
+	for _, r := range stored {
+		merged[recordKey{r.Date.UTC(), r.Tenant, r.Principal}] += r.Calls
+	}
+	m.mu.Lock()
+	for k, calls := range m.pending {
+		if !k.date.Before(since) {
+			merged[k] += calls
+		}
+	}
+	m.mu.Unlock()
+
+	records := make([]Record, 0, len(merged))
+	for k, calls := range merged {
+		records = append(records, Record{Date: k.date, Tenant: k.tenant, Principal: k.principal, Calls: calls})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		} else if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Principal < b.Principal
+	})
+	return records, nil
+}
+
+// Close flushes pending call counts and stops the manager.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return m.flush()
+}
+
+// NewManager creates a new usage manager.
+func NewManager(store Store, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store:         store,
+		log:           zap.NewNop(),
+		tg:            threadgroup.New(),
+		flushInterval: time.Minute,
+
+		quotas:  make(map[string]Quota),
+		pending: make(map[recordKey]uint64),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	// load today's calls so that quotas survive restarts
+	m.day = day(time.Now())
+	m.tenantCalls = make(map[string]uint64)
+	records, err := store.APICalls(m.day)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API calls: %w", err)
+	}
+	for _, r := range records {
+		m.tenantCalls[r.Tenant] += r.Calls
+	}
+
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer cancel()
+
+		m.sched.Run(ctx, "usage", "flushes API call counts to the database", m.flushInterval, false, func(context.Context) error {
+			err := m.flush()
+			if err != nil {
+				m.log.Warn("failed to flush API usage", zap.Error(err))
+			}
+			return err
+		})
+	}()
+	return m, nil
+}
@@ -0,0 +1,85 @@
+package usage_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/usage"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestQuotas(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	opts := []usage.Option{
+		usage.WithLogger(log.Named("usage")),
+		usage.WithDefaultQuota(usage.Quota{Calls: 3}),
+		usage.WithQuotas(map[string]usage.Quota{"bob": {Calls: 1}}),
+	}
+	m, err := usage.NewManager(db, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := m.RecordCall("alice", "key:alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.RecordCall("alice", "key:alice"); !errors.Is(err, usage.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	} else if err := m.RecordCall("bob", "key:bob"); err != nil {
+		t.Fatal(err)
+	} else if err := m.RecordCall("bob", "key:bob"); !errors.Is(err, usage.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// credentials without a tenant are unlimited
+	for i := 0; i < 10; i++ {
+		if err := m.RecordCall("", "password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// unflushed calls are included in the usage
+	checkUsage := func(m *usage.Manager) {
+		t.Helper()
+		records, err := m.Usage(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		calls := make(map[string]uint64)
+		for _, r := range records {
+			calls[r.Principal] = r.Calls
+		}
+		if len(records) != 3 {
+			t.Fatalf("expected 3 records, got %d", len(records))
+		} else if calls["key:alice"] != 3 || calls["key:bob"] != 1 || calls["password"] != 10 {
+			t.Fatalf("unexpected calls: %v", calls)
+		}
+	}
+	checkUsage(m)
+
+	// calls are flushed on close and count against the quota after a restart
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m, err = usage.NewManager(db, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	checkUsage(m)
+	if err := m.RecordCall("alice", "key:alice"); !errors.Is(err, usage.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded after restart, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"context"
 	"time"
 
 	"go.thebigfile.com/core/types"
@@ -11,6 +12,12 @@ func (m *Manager) AddressBalance(address types.Address) (balance Balance, err er
 	return m.store.AddressBalance(address)
 }
 
+// AddressWallets returns the wallet that owns each of the given addresses.
+// Addresses that are not in any wallet are omitted.
+func (m *Manager) AddressWallets(addresses []types.Address) (map[types.Address]ID, error) {
+	return m.store.AddressWallets(addresses)
+}
+
 // AddressSiacoinOutputs returns the unspent siacoin outputs for an address.
 func (m *Manager) AddressSiacoinOutputs(address types.Address, offset, limit int) (siacoins []types.SiacoinElement, err error) {
 	return m.store.AddressSiacoinOutputs(address, m.chain.Tip(), offset, limit)
@@ -22,8 +29,15 @@ func (m *Manager) AddressSiafundOutputs(address types.Address, offset, limit int
 }
 
 // AddressEvents returns the events of a single address.
-func (m *Manager) AddressEvents(address types.Address, offset, limit int) (events []Event, err error) {
-	return m.store.AddressEvents(address, offset, limit)
+func (m *Manager) AddressEvents(ctx context.Context, address types.Address, offset, limit int) (events []Event, err error) {
+	return m.store.AddressEvents(ctx, address, offset, limit)
+}
+
+// AddressEventsSince returns the events of a single address confirmed in
+// blocks after the given height, oldest first. Polling with the height of the
+// last event seen returns only new events.
+func (m *Manager) AddressEventsSince(ctx context.Context, address types.Address, height uint64, offset, limit int) ([]Event, error) {
+	return m.store.AddressEventsSince(ctx, address, height, offset, limit)
 }
 
 // AddressUnconfirmedEvents returns the unconfirmed events for a single address.
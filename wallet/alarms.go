@@ -0,0 +1,216 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.uber.org/zap"
+)
+
+// ScopeBalanceAlarms is the webhook scope of balance alarms. The event name
+// is the alarm's new state.
+const ScopeBalanceAlarms = "alarms"
+
+// Balance alarm states.
+const (
+	AlarmStateOK   = "ok"
+	AlarmStateLow  = "low"
+	AlarmStateHigh = "high"
+)
+
+// ErrAlarmNotFound is returned when a balance alarm is not found.
+var ErrAlarmNotFound = errors.New("balance alarm not found")
+
+type (
+	// An AlarmID is a unique identifier for a balance alarm.
+	AlarmID int64
+
+	// A BalanceAlarm raises an alert when the confirmed siacoin balance of
+	// a wallet, or of one of its addresses, falls below Low or rises above
+	// High. Alarms are evaluated after each chain update is applied, and
+	// alert and notify only when their state changes.
+	BalanceAlarm struct {
+		ID       AlarmID `json:"id"`
+		WalletID ID      `json:"walletID"`
+		// Address restricts the alarm to one of the wallet's addresses.
+		// If nil, the alarm watches the wallet's balance.
+		Address *types.Address `json:"address,omitempty"`
+		// Low and High are exclusive bounds on the balance. At least one
+		// must be set.
+		Low  *types.Currency `json:"low,omitempty"`
+		High *types.Currency `json:"high,omitempty"`
+
+		// State is the alarm's state when it was last evaluated.
+		State         string    `json:"state"`
+		DateCreated   time.Time `json:"dateCreated"`
+		DateTriggered time.Time `json:"dateTriggered"`
+	}
+
+	// A BalanceAlarmNotification is broadcast when a balance alarm changes
+	// state.
+	BalanceAlarmNotification struct {
+		Alarm   BalanceAlarm   `json:"alarm"`
+		Balance types.Currency `json:"balance"`
+		// Previous is the alarm's state before the change.
+		Previous string `json:"previous"`
+	}
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *AlarmID) UnmarshalText(buf []byte) error {
+	n, err := strconv.ParseInt(string(buf), 10, 64)
+	if err != nil {
+		return err
+	}
+	*id = AlarmID(n)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (id AlarmID) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(id), 10)), nil
+}
+
+// Validate returns an error if the alarm is invalid.
+func (a BalanceAlarm) Validate() error {
+	switch {
+	case a.Low == nil && a.High == nil:
+		return errors.New("alarm must have a low or high balance")
+	case a.Low != nil && a.High != nil && a.Low.Cmp(*a.High) >= 0:
+		return errors.New("alarm low balance must be less than its high balance")
+	}
+	return nil
+}
+
+// Check returns the alarm's state for the given balance.
+func (a BalanceAlarm) Check(balance types.Currency) string {
+	switch {
+	case a.Low != nil && balance.Cmp(*a.Low) < 0:
+		return AlarmStateLow
+	case a.High != nil && balance.Cmp(*a.High) > 0:
+		return AlarmStateHigh
+	default:
+		return AlarmStateOK
+	}
+}
+
+// alarmAlertID returns the ID of the alert raised by a balance alarm.
+func alarmAlertID(id AlarmID) types.Hash256 {
+	return types.HashBytes([]byte(fmt.Sprintf("wallet/alarm/%d", id)))
+}
+
+// alarmAlert returns the alert raised by a balance alarm in a low or high
+// state.
+func alarmAlert(a BalanceAlarm, balance types.Currency) alerts.Alert {
+	subject := fmt.Sprintf("wallet %d", a.WalletID)
+	if a.Address != nil {
+		subject = fmt.Sprintf("address %v of wallet %d", *a.Address, a.WalletID)
+	}
+	var message string
+	if a.State == AlarmStateLow {
+		message = fmt.Sprintf("balance of %s is %v, below %v", subject, balance, *a.Low)
+	} else {
+		message = fmt.Sprintf("balance of %s is %v, above %v", subject, balance, *a.High)
+	}
+	data := map[string]any{
+		"walletID": a.WalletID,
+		"alarmID":  a.ID,
+		"balance":  balance,
+	}
+	if a.Address != nil {
+		data["address"] = *a.Address
+	}
+	return alerts.Alert{
+		ID:        alarmAlertID(a.ID),
+		Severity:  alerts.SeverityWarning,
+		Message:   message,
+		Data:      data,
+		Timestamp: a.DateTriggered,
+	}
+}
+
+// BalanceAlarms returns a wallet's balance alarms.
+func (m *Manager) BalanceAlarms(walletID ID) ([]BalanceAlarm, error) {
+	return m.store.WalletBalanceAlarms(walletID)
+}
+
+// AddBalanceAlarm adds a balance alarm to a wallet. It is first evaluated
+// when the next chain update is applied.
+func (m *Manager) AddBalanceAlarm(a BalanceAlarm) (BalanceAlarm, error) {
+	if err := a.Validate(); err != nil {
+		return BalanceAlarm{}, err
+	}
+	a.State = AlarmStateOK
+	a.DateCreated = time.Now().Truncate(time.Second)
+	a.DateTriggered = time.Time{}
+	return m.store.AddBalanceAlarm(a)
+}
+
+// RemoveBalanceAlarm removes a wallet's balance alarm and dismisses its
+// alert.
+func (m *Manager) RemoveBalanceAlarm(walletID ID, id AlarmID) error {
+	if err := m.store.RemoveBalanceAlarm(walletID, id); err != nil {
+		return err
+	}
+	if m.alerts != nil {
+		m.alerts.Dismiss(alarmAlertID(id))
+	}
+	return nil
+}
+
+// checkBalanceAlarms evaluates every balance alarm against the balances in
+// the store, raising or dismissing alerts and broadcasting the alarms whose
+// state changed.
+func (m *Manager) checkBalanceAlarms() error {
+	alarms, err := m.store.BalanceAlarms()
+	if err != nil {
+		return fmt.Errorf("failed to get balance alarms: %w", err)
+	}
+
+	var errs []error
+	for _, a := range alarms {
+		var balance Balance
+		if a.Address != nil {
+			balance, err = m.store.AddressBalance(*a.Address)
+		} else {
+			balance, err = m.store.WalletBalance(a.WalletID)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get balance of alarm %d: %w", a.ID, err))
+			continue
+		}
+
+		state := a.Check(balance.Siacoins)
+		if state == a.State {
+			continue
+		}
+		previous := a.State
+		a.State = state
+		if state != AlarmStateOK {
+			a.DateTriggered = time.Now().Truncate(time.Second)
+		}
+		if err := m.store.UpdateBalanceAlarmState(a.ID, a.State, a.DateTriggered); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update state of alarm %d: %w", a.ID, err))
+			continue
+		}
+		m.log.Debug("balance alarm changed state", zap.Int64("alarm", int64(a.ID)), zap.String("previous", previous), zap.String("state", state), zap.Stringer("balance", balance.Siacoins))
+
+		if m.alerts != nil {
+			if state == AlarmStateOK {
+				m.alerts.Dismiss(alarmAlertID(a.ID))
+			} else {
+				m.alerts.Register(alarmAlert(a, balance.Siacoins))
+			}
+		}
+		if m.events != nil {
+			if err := m.events.BroadcastEvent(ScopeBalanceAlarms, state, BalanceAlarmNotification{Alarm: a, Balance: balance.Siacoins, Previous: previous}); err != nil {
+				errs = append(errs, fmt.Errorf("failed to broadcast alarm %d: %w", a.ID, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
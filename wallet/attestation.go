@@ -0,0 +1,54 @@
+package wallet
+
+import (
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+)
+
+// An Attestation is a node's signed statement of its wallet state at a chain
+// index. Nodes indexing the same wallets agree on the state root at the same
+// index, so replicas can be cross-checked before acting on their data.
+type Attestation struct {
+	Index types.ChainIndex `json:"index"`
+	// StateRoot commits to the balances of every wallet address. It does
+	// not depend on wallet IDs or names.
+	StateRoot types.Hash256   `json:"stateRoot"`
+	Timestamp time.Time       `json:"timestamp"`
+	PublicKey types.PublicKey `json:"publicKey"`
+	Signature types.Signature `json:"signature"`
+}
+
+// SigHash returns the hash signed by the attestation's signature.
+func (a Attestation) SigHash() types.Hash256 {
+	h := types.NewHasher()
+	h.WriteDistinguisher("walletd/attestation")
+	a.Index.EncodeTo(h.E)
+	a.StateRoot.EncodeTo(h.E)
+	h.E.WriteTime(a.Timestamp)
+	a.PublicKey.EncodeTo(h.E)
+	return h.Sum()
+}
+
+// Verify returns true if the attestation is signed by its public key.
+func (a Attestation) Verify() bool {
+	return a.PublicKey.VerifyHash(a.SigHash(), a.Signature)
+}
+
+// Attest returns an attestation of the current wallet state signed with the
+// node's key.
+func (m *Manager) Attest(sk types.PrivateKey) (Attestation, error) {
+	index, root, err := m.store.WalletStateRoot()
+	if err != nil {
+		return Attestation{}, fmt.Errorf("failed to get wallet state root: %w", err)
+	}
+	a := Attestation{
+		Index:     index,
+		StateRoot: root,
+		Timestamp: time.Now().Truncate(time.Second),
+		PublicKey: sk.PublicKey(),
+	}
+	a.Signature = sk.SignHash(a.SigHash())
+	return a, nil
+}
@@ -0,0 +1,242 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.thebigfile.com/core/types"
+)
+
+// maxCategoryLength is the maximum length of an event category.
+const maxCategoryLength = 64
+
+// ErrRuleNotFound is returned when a classification rule is not found.
+var ErrRuleNotFound = errors.New("classification rule not found")
+
+type (
+	// A RuleID is a unique identifier for a classification rule.
+	RuleID int64
+
+	// A ClassificationRule attaches a category to matching events as they
+	// are indexed. Every condition that is set must match. Rules do not
+	// apply to events indexed before they were added, and deleting a rule
+	// does not remove the categories it attached.
+	ClassificationRule struct {
+		ID       RuleID `json:"id"`
+		Name     string `json:"name"`
+		Category string `json:"category"`
+
+		// Types restricts the rule to events of the given types.
+		Types []string `json:"types,omitempty"`
+		// Counterparty matches events with the address as a counterparty.
+		Counterparty *types.Address `json:"counterparty,omitempty"`
+		// Role matches events with a counterparty in the role, "sender"
+		// for incoming funds or "recipient" for outgoing funds. If
+		// Counterparty is also set, it must have the role.
+		Role string `json:"role,omitempty"`
+		// MinAmount and MaxAmount are inclusive bounds on the net value of
+		// the event to its relevant addresses.
+		MinAmount *types.Currency `json:"minAmount,omitempty"`
+		MaxAmount *types.Currency `json:"maxAmount,omitempty"`
+		// Memo matches transaction events whose arbitrary data contains
+		// the string. The match is case-insensitive.
+		Memo string `json:"memo,omitempty"`
+
+		DateCreated time.Time `json:"dateCreated"`
+	}
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *RuleID) UnmarshalText(buf []byte) error {
+	n, err := strconv.ParseInt(string(buf), 10, 64)
+	if err != nil {
+		return err
+	}
+	*id = RuleID(n)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (id RuleID) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(id), 10)), nil
+}
+
+// Validate returns an error if the rule is invalid.
+func (r ClassificationRule) Validate() error {
+	switch {
+	case r.Category == "":
+		return errors.New("rule category is required")
+	case len(r.Category) > maxCategoryLength:
+		return fmt.Errorf("rule category must be at most %d bytes", maxCategoryLength)
+	case r.Role != "" && r.Role != CounterpartySender && r.Role != CounterpartyRecipient:
+		return fmt.Errorf("rule role must be %q or %q", CounterpartySender, CounterpartyRecipient)
+	case r.MinAmount != nil && r.MaxAmount != nil && r.MinAmount.Cmp(*r.MaxAmount) > 0:
+		return errors.New("rule minimum amount must not exceed its maximum amount")
+	case len(r.Types) == 0 && r.Counterparty == nil && r.Role == "" && r.MinAmount == nil && r.MaxAmount == nil && r.Memo == "":
+		return errors.New("rule must have at least one condition")
+	}
+	for _, t := range r.Types {
+		switch t {
+		case EventTypeMinerPayout, EventTypeFoundationSubsidy, EventTypeSiafundClaim,
+			EventTypeV1Transaction, EventTypeV1ContractResolution,
+			EventTypeV2Transaction, EventTypeV2ContractResolution:
+		default:
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// EventFlows returns the siacoins received and sent by the relevant
+// addresses of an event. Change returned to a relevant address is counted in
+// both.
+func EventFlows(ev Event) (inflow, outflow types.Currency) {
+	inputs, outputs, ok := transactionFlows(ev)
+	if !ok {
+		switch data := ev.Data.(type) {
+		case EventPayout:
+			return data.SiacoinElement.SiacoinOutput.Value, types.ZeroCurrency
+		case EventV1ContractResolution:
+			return data.SiacoinElement.SiacoinOutput.Value, types.ZeroCurrency
+		case EventV2ContractResolution:
+			return data.SiacoinElement.SiacoinOutput.Value, types.ZeroCurrency
+		}
+		return types.ZeroCurrency, types.ZeroCurrency
+	}
+
+	relevant := make(map[types.Address]bool, len(ev.Relevant))
+	for _, addr := range ev.Relevant {
+		relevant[addr] = true
+	}
+	for _, sco := range inputs {
+		if relevant[sco.Address] {
+			outflow = outflow.Add(sco.Value)
+		}
+	}
+	for _, sco := range outputs {
+		if relevant[sco.Address] {
+			inflow = inflow.Add(sco.Value)
+		}
+	}
+	return
+}
+
+// eventMemos returns the arbitrary data of a transaction event.
+func eventMemos(ev Event) [][]byte {
+	switch data := ev.Data.(type) {
+	case EventV1Transaction:
+		return data.Transaction.ArbitraryData
+	case EventV2Transaction:
+		if len(data.ArbitraryData) == 0 {
+			return nil
+		}
+		return [][]byte{data.ArbitraryData}
+	default:
+		return nil
+	}
+}
+
+// Matches returns true if the event matches every condition of the rule.
+func (r ClassificationRule) Matches(ev Event) bool {
+	if len(r.Types) > 0 {
+		var ok bool
+		for _, t := range r.Types {
+			ok = ok || t == ev.Type
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if r.Counterparty != nil || r.Role != "" {
+		var ok bool
+		for _, cp := range Counterparties(ev) {
+			if (r.Counterparty == nil || cp.Address == *r.Counterparty) && (r.Role == "" || cp.Role == r.Role) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if r.MinAmount != nil || r.MaxAmount != nil {
+		inflow, outflow := EventFlows(ev)
+		amount := inflow.Sub(outflow)
+		if outflow.Cmp(inflow) > 0 {
+			amount = outflow.Sub(inflow)
+		}
+		if (r.MinAmount != nil && amount.Cmp(*r.MinAmount) < 0) || (r.MaxAmount != nil && amount.Cmp(*r.MaxAmount) > 0) {
+			return false
+		}
+	}
+
+	if r.Memo != "" {
+		var ok bool
+		memo := bytes.ToLower([]byte(r.Memo))
+		for _, data := range eventMemos(ev) {
+			if bytes.Contains(bytes.ToLower(data), memo) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Classify returns the sorted, distinct categories of the rules matching an
+// event.
+func Classify(rules []ClassificationRule, ev Event) []string {
+	seen := make(map[string]bool)
+	var categories []string
+	for _, r := range rules {
+		if !seen[r.Category] && r.Matches(ev) {
+			seen[r.Category] = true
+			categories = append(categories, r.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// ClassificationRules returns every classification rule.
+func (m *Manager) ClassificationRules() ([]ClassificationRule, error) {
+	return m.store.ClassificationRules()
+}
+
+// AddClassificationRule adds a classification rule. It applies to events
+// indexed after it is added.
+func (m *Manager) AddClassificationRule(r ClassificationRule) (ClassificationRule, error) {
+	if err := r.Validate(); err != nil {
+		return ClassificationRule{}, err
+	}
+	r.DateCreated = time.Now().Truncate(time.Second)
+	return m.store.AddClassificationRule(r)
+}
+
+// DeleteClassificationRule deletes a classification rule. Categories it
+// already attached to events are kept.
+func (m *Manager) DeleteClassificationRule(id RuleID) error {
+	return m.store.DeleteClassificationRule(id)
+}
+
+// EventCategories returns the categories attached to each of the events.
+// Events without categories are omitted.
+func (m *Manager) EventCategories(eventIDs []types.Hash256) (map[types.Hash256][]string, error) {
+	return m.store.EventCategories(eventIDs)
+}
+
+// WalletCategoryEvents returns the events relevant to a wallet with the
+// given category, sorted by height descending.
+func (m *Manager) WalletCategoryEvents(ctx context.Context, walletID ID, category string, offset, limit int) ([]Event, error) {
+	return m.store.WalletCategoryEvents(ctx, walletID, category, offset, limit)
+}
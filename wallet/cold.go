@@ -0,0 +1,332 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+)
+
+// WalletTypeCold is the type of watch-only wallets whose keys are kept
+// offline. Cold wallets are spent from with withdrawal proposals, which are
+// signed on an offline machine and submitted back for broadcast.
+const WalletTypeCold = "cold"
+
+// Withdrawal proposal statuses.
+const (
+	ProposalStatusPending   = "pending"
+	ProposalStatusBroadcast = "broadcast"
+	ProposalStatusCancelled = "cancelled"
+)
+
+// proposalSignatureSize estimates the size of the signature an offline
+// signer adds to each input of a proposal.
+const proposalSignatureSize = 64
+
+// maxBasisAttempts is the number of times a proposal's outputs are read
+// while chain updates keep changing the store's index.
+const maxBasisAttempts = 5
+
+var (
+	// ErrNotColdWallet is returned when creating a withdrawal proposal for
+	// a wallet that is not a cold wallet.
+	ErrNotColdWallet = errors.New("wallet is not a cold wallet")
+	// ErrInsufficientBalance is returned when a wallet cannot fund a
+	// withdrawal.
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrProposalNotFound is returned when a withdrawal proposal does not
+	// exist.
+	ErrProposalNotFound = errors.New("proposal not found")
+	// ErrProposalNotPending is returned when cancelling or submitting a
+	// proposal that has already been broadcast or cancelled.
+	ErrProposalNotPending = errors.New("proposal is not pending")
+	// ErrProposalMismatch is returned when a signed transaction does not
+	// match its proposal.
+	ErrProposalMismatch = errors.New("signed transaction does not match proposal")
+)
+
+type (
+	// A ProposalInput describes an input of a withdrawal proposal so an
+	// offline signer can find the key that signs it.
+	ProposalInput struct {
+		ParentID       types.SiacoinOutputID `json:"parentID"`
+		Address        types.Address         `json:"address"`
+		Value          types.Currency        `json:"value"`
+		SpendPolicy    *types.SpendPolicy    `json:"spendPolicy,omitempty"`
+		DerivationPath string                `json:"derivationPath,omitempty"`
+	}
+
+	// A WithdrawalProposal is an unsigned v2 transaction spending a cold
+	// wallet's outputs. The transaction's inputs include their parent
+	// elements and proofs at Basis. Each input is signed by signing SigHash
+	// with the input's key. The inputs of pending proposals are not used to
+	// fund other proposals.
+	WithdrawalProposal struct {
+		ID          int64               `json:"id"`
+		WalletID    ID                  `json:"walletID"`
+		Status      string              `json:"status"`
+		Basis       types.ChainIndex    `json:"basis"`
+		Transaction types.V2Transaction `json:"transaction"`
+		Inputs      []ProposalInput     `json:"inputs"`
+		SigHash     types.Hash256       `json:"sigHash"`
+		Fee         types.Currency      `json:"fee"`
+		DateCreated time.Time           `json:"dateCreated"`
+		DateUpdated time.Time           `json:"dateUpdated"`
+	}
+)
+
+// validateWalletType returns an error if the wallet type is unknown.
+func validateWalletType(walletType string) error {
+	switch walletType {
+	case "", WalletTypeCold:
+		return nil
+	default:
+		return fmt.Errorf("unknown wallet type %q", walletType)
+	}
+}
+
+// matchesProposal returns an error if the signed transaction differs from
+// the proposed transaction in anything other than its signatures and proofs.
+func matchesProposal(proposed, signed types.V2Transaction) error {
+	switch {
+	case len(signed.SiacoinInputs) != len(proposed.SiacoinInputs):
+		return fmt.Errorf("%w: expected %d inputs, got %d", ErrProposalMismatch, len(proposed.SiacoinInputs), len(signed.SiacoinInputs))
+	case len(signed.SiacoinOutputs) != len(proposed.SiacoinOutputs):
+		return fmt.Errorf("%w: expected %d outputs, got %d", ErrProposalMismatch, len(proposed.SiacoinOutputs), len(signed.SiacoinOutputs))
+	case !signed.MinerFee.Equals(proposed.MinerFee):
+		return fmt.Errorf("%w: expected miner fee %v, got %v", ErrProposalMismatch, proposed.MinerFee, signed.MinerFee)
+	case len(signed.SiafundInputs) != 0 || len(signed.SiafundOutputs) != 0 || len(signed.FileContracts) != 0 || len(signed.FileContractRevisions) != 0 ||
+		len(signed.FileContractResolutions) != 0 || len(signed.Attestations) != 0 || len(signed.ArbitraryData) != 0 || signed.NewFoundationAddress != nil:
+		return fmt.Errorf("%w: unexpected fields", ErrProposalMismatch)
+	}
+	for i := range signed.SiacoinInputs {
+		if signed.SiacoinInputs[i].Parent.ID != proposed.SiacoinInputs[i].Parent.ID {
+			return fmt.Errorf("%w: input %d spends %v, expected %v", ErrProposalMismatch, i, signed.SiacoinInputs[i].Parent.ID, proposed.SiacoinInputs[i].Parent.ID)
+		}
+	}
+	for i := range signed.SiacoinOutputs {
+		if signed.SiacoinOutputs[i] != proposed.SiacoinOutputs[i] {
+			return fmt.Errorf("%w: output %d differs", ErrProposalMismatch, i)
+		}
+	}
+	return nil
+}
+
+// spendableOutputs returns the wallet's unspent outputs at the last committed
+// index that are not reserved, spent in the pool, or used by a pending
+// proposal, largest first. Outputs with fewer than minConfirmations, or the
+// wallet's minimum number of confirmations if higher, are excluded. The caller
+// must hold m.mu.
+func (m *Manager) spendableOutputs(walletID ID, basis types.ChainIndex, minConfirmations uint64) ([]types.SiacoinElement, error) {
+	const batchSize = 1000
+
+	walletMin, err := m.store.WalletMinConfirmations(walletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get minimum confirmations: %w", err)
+	}
+	minConfirmations = max(minConfirmations, walletMin)
+	maxHeight, ok := confirmedHeight(basis, minConfirmations)
+	if !ok {
+		return nil, nil
+	}
+
+	locked, err := m.store.PendingProposalInputs(walletID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending proposal inputs: %w", err)
+	}
+	used := make(map[types.SiacoinOutputID]bool)
+	for _, id := range locked {
+		used[id] = true
+	}
+	for _, txn := range m.chain.PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			used[sci.ParentID] = true
+		}
+	}
+	for _, txn := range m.chain.V2PoolTransactions() {
+		for _, sci := range txn.SiacoinInputs {
+			used[sci.Parent.ID] = true
+		}
+	}
+
+	var utxos []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.store.WalletConfirmedSiacoinOutputs(walletID, basis, maxHeight, offset, batchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, sce := range batch {
+			if !used[sce.ID] && !m.used[types.Hash256(sce.ID)] {
+				utxos = append(utxos, sce)
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].SiacoinOutput.Value.Cmp(utxos[j].SiacoinOutput.Value) > 0
+	})
+	return utxos, nil
+}
+
+// ProposeWithdrawal creates a withdrawal proposal paying the outputs from a
+// cold wallet. The fee is determined by the wallet's fee strategy. Change is
+// sent to changeAddress, or to the address of the first input if
+// changeAddress is the void address.
+func (m *Manager) ProposeWithdrawal(walletID ID, outputs []types.SiacoinOutput, changeAddress types.Address) (WithdrawalProposal, error) {
+	if walletType, err := m.store.WalletType(walletID); err != nil {
+		return WithdrawalProposal{}, err
+	} else if walletType != WalletTypeCold {
+		return WithdrawalProposal{}, ErrNotColdWallet
+	} else if len(outputs) == 0 {
+		return WithdrawalProposal{}, errors.New("withdrawal must have at least one output")
+	}
+
+	var total types.Currency
+	for _, sco := range outputs {
+		if sco.Value.IsZero() {
+			return WithdrawalProposal{}, errors.New("withdrawal outputs must have a non-zero value")
+		}
+		total = total.Add(sco.Value)
+	}
+
+	feePerByte, err := m.WalletFeeRate(walletID)
+	if err != nil {
+		return WithdrawalProposal{}, fmt.Errorf("failed to get fee rate: %w", err)
+	}
+	addresses, err := m.store.WalletAddresses(walletID)
+	if err != nil {
+		return WithdrawalProposal{}, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	addrInfo := make(map[types.Address]Address, len(addresses))
+	for _, addr := range addresses {
+		addrInfo[addr.Address] = addr
+	}
+
+	// hold the lock so concurrent proposals do not select the same outputs
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// chain updates are applied concurrently, so the outputs are read until
+	// the store's index does not change while reading them, ensuring the
+	// outputs and their proofs match the basis
+	var basis types.ChainIndex
+	var utxos []types.SiacoinElement
+	for attempt := 1; ; attempt++ {
+		basis, err = m.store.LastCommittedIndex()
+		if err != nil {
+			return WithdrawalProposal{}, fmt.Errorf("failed to get last committed index: %w", err)
+		}
+		utxos, err = m.spendableOutputs(walletID, basis, 0)
+		if err != nil {
+			return WithdrawalProposal{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+		}
+		if after, err := m.store.LastCommittedIndex(); err != nil {
+			return WithdrawalProposal{}, fmt.Errorf("failed to get last committed index: %w", err)
+		} else if after == basis {
+			break
+		} else if attempt >= maxBasisAttempts {
+			return WithdrawalProposal{}, errors.New("chain state changed while selecting outputs, try again")
+		}
+	}
+
+	cs := m.chain.TipState()
+	txn := types.V2Transaction{
+		SiacoinOutputs: append([]types.SiacoinOutput(nil), outputs...),
+	}
+	// reserve space for the change output
+	txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{})
+	var inputs []ProposalInput
+	var inputSum, fee types.Currency
+	for _, sce := range utxos {
+		info := addrInfo[sce.SiacoinOutput.Address]
+		sci := types.V2SiacoinInput{Parent: sce}
+		if info.SpendPolicy != nil {
+			sci.SatisfiedPolicy.Policy = *info.SpendPolicy
+		}
+		txn.SiacoinInputs = append(txn.SiacoinInputs, sci)
+		inputs = append(inputs, ProposalInput{
+			ParentID:       sce.ID,
+			Address:        sce.SiacoinOutput.Address,
+			Value:          sce.SiacoinOutput.Value,
+			SpendPolicy:    info.SpendPolicy,
+			DerivationPath: info.DerivationPath,
+		})
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+		fee = feePerByte.Mul64(cs.V2TransactionWeight(txn) + uint64(len(inputs))*proposalSignatureSize)
+		if inputSum.Cmp(total.Add(fee)) >= 0 {
+			break
+		}
+	}
+	if inputSum.Cmp(total.Add(fee)) < 0 {
+		return WithdrawalProposal{}, fmt.Errorf("%w: withdrawal requires %v, wallet has %v available", ErrInsufficientBalance, total.Add(fee), inputSum)
+	}
+
+	txn.MinerFee = fee
+	txn.SiacoinOutputs = txn.SiacoinOutputs[:len(outputs)]
+	if change := inputSum.Sub(total).Sub(fee); !change.IsZero() {
+		if changeAddress == types.VoidAddress {
+			changeAddress = inputs[0].Address
+		}
+		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
+			Address: changeAddress,
+			Value:   change,
+		})
+	}
+
+	now := time.Now().Truncate(time.Second)
+	p, err := m.store.AddWithdrawalProposal(WithdrawalProposal{
+		WalletID:    walletID,
+		Status:      ProposalStatusPending,
+		Basis:       basis,
+		Transaction: txn,
+		Inputs:      inputs,
+		SigHash:     cs.InputSigHash(txn),
+		Fee:         fee,
+		DateCreated: now,
+		DateUpdated: now,
+	})
+	if err != nil {
+		return WithdrawalProposal{}, fmt.Errorf("failed to add proposal: %w", err)
+	}
+	m.log.Info("created withdrawal proposal", zap.Int64("wallet", int64(walletID)), zap.Int64("proposal", p.ID), zap.Stringer("amount", total), zap.Stringer("fee", fee))
+	return p, nil
+}
+
+// WithdrawalProposal returns a withdrawal proposal of a wallet.
+func (m *Manager) WithdrawalProposal(walletID ID, id int64) (WithdrawalProposal, error) {
+	return m.store.WithdrawalProposal(walletID, id)
+}
+
+// WithdrawalProposals returns the withdrawal proposals of a wallet, newest
+// first.
+func (m *Manager) WithdrawalProposals(walletID ID, offset, limit int) ([]WithdrawalProposal, error) {
+	return m.store.WithdrawalProposals(walletID, offset, limit)
+}
+
+// CancelWithdrawalProposal cancels a pending withdrawal proposal, releasing
+// its inputs.
+func (m *Manager) CancelWithdrawalProposal(walletID ID, id int64) (WithdrawalProposal, error) {
+	return m.store.UpdateWithdrawalProposal(walletID, id, ProposalStatusCancelled, nil)
+}
+
+// SubmitWithdrawalProposal checks that the signed transaction matches a
+// pending proposal and broadcasts it. The signed transaction's proofs must
+// be valid at the proposal's basis.
+func (m *Manager) SubmitWithdrawalProposal(walletID ID, id int64, signed types.V2Transaction, broadcast func(basis types.ChainIndex, txn types.V2Transaction) error) (WithdrawalProposal, error) {
+	p, err := m.store.WithdrawalProposal(walletID, id)
+	if err != nil {
+		return WithdrawalProposal{}, err
+	} else if p.Status != ProposalStatusPending {
+		return WithdrawalProposal{}, ErrProposalNotPending
+	} else if err := matchesProposal(p.Transaction, signed); err != nil {
+		return WithdrawalProposal{}, err
+	} else if err := broadcast(p.Basis, signed); err != nil {
+		return WithdrawalProposal{}, err
+	}
+	return m.store.UpdateWithdrawalProposal(walletID, id, ProposalStatusBroadcast, &signed)
+}
@@ -0,0 +1,74 @@
+package wallet
+
+import (
+	"math"
+
+	"go.thebigfile.com/core/types"
+)
+
+// confirmedHeight returns the maximum height of a block whose outputs have at
+// least minConfirmations confirmations at the tip. The block at the tip has
+// one confirmation. It returns false if no block has enough confirmations.
+func confirmedHeight(tip types.ChainIndex, minConfirmations uint64) (uint64, bool) {
+	if minConfirmations == 0 {
+		return math.MaxInt64, true
+	} else if tip.Height+1 < minConfirmations {
+		return 0, false
+	}
+	return tip.Height + 1 - minConfirmations, true
+}
+
+// ConfirmedSiacoinOutputs returns a paginated list of matured siacoin outputs
+// relevant to the wallet that have at least minConfirmations confirmations.
+func (m *Manager) ConfirmedSiacoinOutputs(walletID ID, minConfirmations uint64, offset, limit int) ([]types.SiacoinElement, error) {
+	tip := m.chain.Tip()
+	maxHeight, ok := confirmedHeight(tip, minConfirmations)
+	if !ok {
+		return nil, nil
+	}
+	return m.store.WalletConfirmedSiacoinOutputs(walletID, tip, maxHeight, offset, limit)
+}
+
+// ConfirmedSiafundOutputs returns a paginated list of siafund outputs
+// relevant to the wallet that have at least minConfirmations confirmations.
+func (m *Manager) ConfirmedSiafundOutputs(walletID ID, minConfirmations uint64, offset, limit int) ([]types.SiafundElement, error) {
+	maxHeight, ok := confirmedHeight(m.chain.Tip(), minConfirmations)
+	if !ok {
+		return nil, nil
+	}
+	return m.store.WalletConfirmedSiafundOutputs(walletID, maxHeight, offset, limit)
+}
+
+// AddressConfirmedSiacoinOutputs returns the unspent siacoin outputs for an
+// address that have at least minConfirmations confirmations.
+func (m *Manager) AddressConfirmedSiacoinOutputs(address types.Address, minConfirmations uint64, offset, limit int) ([]types.SiacoinElement, error) {
+	tip := m.chain.Tip()
+	maxHeight, ok := confirmedHeight(tip, minConfirmations)
+	if !ok {
+		return nil, nil
+	}
+	return m.store.AddressConfirmedSiacoinOutputs(address, tip, maxHeight, offset, limit)
+}
+
+// AddressConfirmedSiafundOutputs returns the unspent siafund outputs for an
+// address that have at least minConfirmations confirmations.
+func (m *Manager) AddressConfirmedSiafundOutputs(address types.Address, minConfirmations uint64, offset, limit int) ([]types.SiafundElement, error) {
+	maxHeight, ok := confirmedHeight(m.chain.Tip(), minConfirmations)
+	if !ok {
+		return nil, nil
+	}
+	return m.store.AddressConfirmedSiafundOutputs(address, maxHeight, offset, limit)
+}
+
+// WalletMinConfirmations returns the number of confirmations an output must
+// have to fund the wallet's transactions, or zero if the wallet does not have
+// a minimum.
+func (m *Manager) WalletMinConfirmations(walletID ID) (uint64, error) {
+	return m.store.WalletMinConfirmations(walletID)
+}
+
+// SetWalletMinConfirmations sets the number of confirmations an output must
+// have to fund the wallet's transactions. Zero removes the minimum.
+func (m *Manager) SetWalletMinConfirmations(walletID ID, n uint64) error {
+	return m.store.SetWalletMinConfirmations(walletID, n)
+}
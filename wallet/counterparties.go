@@ -0,0 +1,212 @@
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+)
+
+// counterparty roles indicate the direction of funds between a wallet and an
+// external address.
+const (
+	CounterpartySender    = "sender"
+	CounterpartyRecipient = "recipient"
+)
+
+type (
+	// A Counterparty is an external address that sent siacoins to, or
+	// received siacoins from, the addresses relevant to an event. Value is
+	// the net amount after netting out change. Label and Category are set if
+	// the address is in the known-address directory. Wallet is set if the
+	// address belongs to a wallet on this instance.
+	Counterparty struct {
+		Address  types.Address  `json:"address"`
+		Role     string         `json:"role"`
+		Value    types.Currency `json:"value"`
+		Label    string         `json:"label,omitempty"`
+		Category string         `json:"category,omitempty"`
+		Wallet   ID             `json:"wallet,omitempty"`
+	}
+
+	// An AnnotatedEvent is an event with its derived counterparties.
+	AnnotatedEvent struct {
+		Event
+		Counterparties []Counterparty `json:"counterparties,omitempty"`
+		// Categories are the categories attached to the event by
+		// classification rules when it was indexed.
+		Categories []string `json:"categories,omitempty"`
+		// Enrichments are the fields attached to the event by enrichers
+		// when it was indexed.
+		Enrichments map[string]string `json:"enrichments,omitempty"`
+		// Reverted is true if a reorg removed the event from the chain.
+		Reverted bool `json:"reverted,omitempty"`
+		// ReplacedBy is the index of the block that replaced a reverted
+		// event's block.
+		ReplacedBy *types.ChainIndex `json:"replacedBy,omitempty"`
+		// Change is the value of the outputs a transaction returned to
+		// the addresses that funded it.
+		Change types.Currency `json:"change,omitempty"`
+		// Internal is true if the event only moved funds between wallets
+		// on this instance. See MarkInternal.
+		Internal bool `json:"internal,omitempty"`
+	}
+
+	// An UnresolvedEvent is an applied event whose counterparties have not
+	// been resolved and broadcast to the wallets it is relevant to.
+	UnresolvedEvent struct {
+		// Seq increases with each applied event.
+		Seq   int64
+		Event Event
+		// Wallets maps each wallet the event is relevant to to the
+		// wallet's relevant addresses.
+		Wallets map[ID][]types.Address
+	}
+)
+
+// MarshalJSON implements json.Marshaler.
+func (ae AnnotatedEvent) MarshalJSON() ([]byte, error) {
+	buf, err := json.Marshal(&ae.Event)
+	if err != nil {
+		return nil, err
+	} else if len(ae.Counterparties) == 0 && len(ae.Categories) == 0 && len(ae.Enrichments) == 0 && !ae.Reverted && ae.ReplacedBy == nil && ae.Change.IsZero() && !ae.Internal {
+		return buf, nil
+	} else if len(buf) < 2 || buf[len(buf)-1] != '}' {
+		return nil, fmt.Errorf("unexpected event encoding %q", buf)
+	}
+	var change *types.Currency
+	if !ae.Change.IsZero() {
+		change = &ae.Change
+	}
+	extra, err := json.Marshal(struct {
+		Counterparties []Counterparty    `json:"counterparties,omitempty"`
+		Categories     []string          `json:"categories,omitempty"`
+		Enrichments    map[string]string `json:"enrichments,omitempty"`
+		Reverted       bool              `json:"reverted,omitempty"`
+		ReplacedBy     *types.ChainIndex `json:"replacedBy,omitempty"`
+		Change         *types.Currency   `json:"change,omitempty"`
+		Internal       bool              `json:"internal,omitempty"`
+	}{ae.Counterparties, ae.Categories, ae.Enrichments, ae.Reverted, ae.ReplacedBy, change, ae.Internal})
+	if err != nil {
+		return nil, err
+	}
+	// splice the extra fields into the event object
+	out := append([]byte(nil), buf[:len(buf)-1]...)
+	if len(buf) > 2 {
+		out = append(out, ',')
+	}
+	out = append(out, extra[1:]...)
+	return out, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (ae *AnnotatedEvent) UnmarshalJSON(b []byte) error {
+	var extra struct {
+		Counterparties []Counterparty    `json:"counterparties"`
+		Categories     []string          `json:"categories"`
+		Enrichments    map[string]string `json:"enrichments"`
+		Reverted       bool              `json:"reverted"`
+		ReplacedBy     *types.ChainIndex `json:"replacedBy"`
+		Change         types.Currency    `json:"change"`
+		Internal       bool              `json:"internal"`
+	}
+	if err := json.Unmarshal(b, &ae.Event); err != nil {
+		return err
+	} else if err := json.Unmarshal(b, &extra); err != nil {
+		return err
+	}
+	ae.Counterparties, ae.Categories, ae.Reverted, ae.ReplacedBy = extra.Counterparties, extra.Categories, extra.Reverted, extra.ReplacedBy
+	ae.Enrichments, ae.Change, ae.Internal = extra.Enrichments, extra.Change, extra.Internal
+	return nil
+}
+
+// transactionFlows returns the siacoin outputs spent and created by a
+// transaction event. ok is false if the event is not a transaction.
+func transactionFlows(ev Event) (inputs, outputs []types.SiacoinOutput, ok bool) {
+	switch data := ev.Data.(type) {
+	case EventV1Transaction:
+		for _, sce := range data.SpentSiacoinElements {
+			inputs = append(inputs, sce.SiacoinOutput)
+		}
+		return inputs, data.Transaction.SiacoinOutputs, true
+	case EventV2Transaction:
+		for _, sci := range data.SiacoinInputs {
+			inputs = append(inputs, sci.Parent.SiacoinOutput)
+		}
+		return inputs, data.SiacoinOutputs, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// Counterparties returns the external addresses that funds in the event came
+// from or went to. Addresses in the event's relevant set are treated as
+// owned, so change returned to them is netted out. Only transaction events
+// have counterparties.
+func Counterparties(ev Event) []Counterparty {
+	inputs, outputs, ok := transactionFlows(ev)
+	if !ok {
+		return nil
+	}
+
+	var order []types.Address
+	in := make(map[types.Address]types.Currency)
+	out := make(map[types.Address]types.Currency)
+	add := func(m map[types.Address]types.Currency, sco types.SiacoinOutput) {
+		if _, ok := in[sco.Address]; !ok {
+			if _, ok := out[sco.Address]; !ok {
+				order = append(order, sco.Address)
+			}
+		}
+		m[sco.Address] = m[sco.Address].Add(sco.Value)
+	}
+	for _, sco := range inputs {
+		add(in, sco)
+	}
+	for _, sco := range outputs {
+		add(out, sco)
+	}
+
+	owned := make(map[types.Address]bool, len(ev.Relevant))
+	for _, addr := range ev.Relevant {
+		owned[addr] = true
+	}
+
+	var cps []Counterparty
+	for _, addr := range order {
+		if owned[addr] {
+			continue
+		}
+		sent, received := in[addr], out[addr]
+		switch sent.Cmp(received) {
+		case 1:
+			cps = append(cps, Counterparty{Address: addr, Role: CounterpartySender, Value: sent.Sub(received)})
+		case -1:
+			cps = append(cps, Counterparty{Address: addr, Role: CounterpartyRecipient, Value: received.Sub(sent)})
+		}
+	}
+	return cps
+}
+
+// AnnotateEvents annotates each event with its counterparties. If lookup is
+// not nil, it is used to label counterparties with their known label and
+// category.
+func AnnotateEvents(events []Event, lookup func(types.Address) (label, category string, ok bool)) []AnnotatedEvent {
+	annotated := make([]AnnotatedEvent, len(events))
+	for i, ev := range events {
+		cps := Counterparties(ev)
+		if lookup != nil {
+			for j := range cps {
+				if label, category, ok := lookup(cps[j].Address); ok {
+					cps[j].Label, cps[j].Category = label, category
+				}
+			}
+		}
+		annotated[i] = AnnotatedEvent{
+			Event:          ev,
+			Counterparties: cps,
+			Change:         Change(ev),
+		}
+	}
+	return annotated
+}
@@ -0,0 +1,66 @@
+package wallet
+
+import (
+	"context"
+
+	"go.thebigfile.com/core/types"
+)
+
+// A BlockDelta is the change in a wallet's balance from the events confirmed
+// in a block. Received siacoins include immature payouts and change returned
+// to the wallet, which is also counted in SiacoinsSent.
+type BlockDelta struct {
+	Index            types.ChainIndex `json:"index"`
+	Events           int              `json:"events"`
+	SiacoinsReceived types.Currency   `json:"siacoinsReceived"`
+	SiacoinsSent     types.Currency   `json:"siacoinsSent"`
+	SiafundsReceived uint64           `json:"siafundsReceived"`
+	SiafundsSent     uint64           `json:"siafundsSent"`
+}
+
+// EventSiafundFlows returns the siafunds received and sent by the relevant
+// addresses of a transaction event.
+func EventSiafundFlows(ev Event) (inflow, outflow uint64) {
+	relevant := make(map[types.Address]bool, len(ev.Relevant))
+	for _, addr := range ev.Relevant {
+		relevant[addr] = true
+	}
+
+	var inputs, outputs []types.SiafundOutput
+	switch data := ev.Data.(type) {
+	case EventV1Transaction:
+		for _, sfe := range data.SpentSiafundElements {
+			inputs = append(inputs, sfe.SiafundOutput)
+		}
+		outputs = data.Transaction.SiafundOutputs
+	case EventV2Transaction:
+		for _, sfi := range data.SiafundInputs {
+			inputs = append(inputs, sfi.Parent.SiafundOutput)
+		}
+		outputs = data.SiafundOutputs
+	}
+	for _, sfo := range inputs {
+		if relevant[sfo.Address] {
+			outflow += sfo.Value
+		}
+	}
+	for _, sfo := range outputs {
+		if relevant[sfo.Address] {
+			inflow += sfo.Value
+		}
+	}
+	return
+}
+
+// WalletDeltas returns the change in the given wallet's balance from the
+// events in each block between start and end, inclusive, ordered by height.
+// Blocks without events relevant to the wallet are omitted.
+func (m *Manager) WalletDeltas(ctx context.Context, walletID ID, start, end uint64) ([]BlockDelta, error) {
+	return m.store.WalletDeltas(ctx, walletID, start, end)
+}
+
+// WalletEventsBetween returns the events relevant to the given wallet
+// confirmed between start and end, inclusive, ordered by height.
+func (m *Manager) WalletEventsBetween(ctx context.Context, walletID ID, start, end uint64) ([]Event, error) {
+	return m.store.WalletEventsBetween(ctx, walletID, start, end)
+}
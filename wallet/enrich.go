@@ -0,0 +1,145 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// enrichTimeout is the maximum time an enricher may spend on a single
+	// event.
+	enrichTimeout = 5 * time.Second
+
+	maxEnrichmentFields      = 32
+	maxEnrichmentFieldLength = 64
+	maxEnrichmentValueLength = 1024
+)
+
+type (
+	// An EventEnricher attaches fields to events before they are stored,
+	// e.g. an internal order ID looked up in an external system. Enrichers
+	// are compiled into walletd and run in the indexing transaction, so
+	// they should be fast and must not call back into walletd.
+	EventEnricher interface {
+		// EnrichEvent adds fields to the event. fields contains the fields
+		// added by the enrichers that ran before it, which it may also
+		// modify. If EnrichEvent returns an error, its changes are
+		// discarded and the event is stored without them.
+		EnrichEvent(ctx context.Context, ev Event, fields map[string]string) error
+	}
+
+	// An EventEnricherFunc is an EventEnricher implemented by a function.
+	EventEnricherFunc func(ctx context.Context, ev Event, fields map[string]string) error
+
+	// A NamedEnricher is an EventEnricher with the name used to identify
+	// it in logs.
+	NamedEnricher struct {
+		Name     string
+		Enricher EventEnricher
+	}
+)
+
+// EnrichEvent implements EventEnricher.
+func (fn EventEnricherFunc) EnrichEvent(ctx context.Context, ev Event, fields map[string]string) error {
+	return fn(ctx, ev, fields)
+}
+
+var registry struct {
+	mu        sync.Mutex
+	enrichers []NamedEnricher
+}
+
+// RegisterEventEnricher registers an enricher to run on every event indexed
+// by walletd. Enrichers run in the order they are registered. It is intended
+// to be called from an init function and panics if the name is empty or
+// already registered.
+func RegisterEventEnricher(name string, e EventEnricher) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	if name == "" || e == nil {
+		panic("enricher must have a name and implementation") // developer error
+	}
+	for _, ne := range registry.enrichers {
+		if ne.Name == name {
+			panic(fmt.Sprintf("enricher %q is already registered", name)) // developer error
+		}
+	}
+	registry.enrichers = append(registry.enrichers, NamedEnricher{Name: name, Enricher: e})
+}
+
+// RegisteredEventEnrichers returns the registered enrichers in the order
+// they were registered.
+func RegisteredEventEnrichers() []NamedEnricher {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	return append([]NamedEnricher(nil), registry.enrichers...)
+}
+
+// validateEnrichment returns an error if the fields cannot be stored.
+func validateEnrichment(fields map[string]string) error {
+	if len(fields) > maxEnrichmentFields {
+		return fmt.Errorf("events can have at most %d fields", maxEnrichmentFields)
+	}
+	for k, v := range fields {
+		switch {
+		case k == "":
+			return errors.New("field names must not be empty")
+		case len(k) > maxEnrichmentFieldLength:
+			return fmt.Errorf("field name %q must be at most %d bytes", k, maxEnrichmentFieldLength)
+		case len(v) > maxEnrichmentValueLength:
+			return fmt.Errorf("field %q must be at most %d bytes", k, maxEnrichmentValueLength)
+		}
+	}
+	return nil
+}
+
+// runEnricher runs a single enricher on a copy of the fields, returning the
+// copy if the enricher succeeds. Panics are recovered and returned as errors.
+func runEnricher(e EventEnricher, ev Event, fields map[string]string) (enriched map[string]string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("enricher panicked: %v", r)
+		}
+	}()
+
+	enriched = make(map[string]string, len(fields))
+	for k, v := range fields {
+		enriched[k] = v
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+	defer cancel()
+	if err := e.EnrichEvent(ctx, ev, enriched); err != nil {
+		return nil, err
+	} else if err := validateEnrichment(enriched); err != nil {
+		return nil, err
+	}
+	return enriched, nil
+}
+
+// EnrichEvent runs the enrichers on an event in order and returns the fields
+// they added. An enricher that fails is logged and skipped, so enrichment
+// never prevents an event from being indexed.
+func EnrichEvent(enrichers []NamedEnricher, ev Event, log *zap.Logger) map[string]string {
+	fields := make(map[string]string)
+	for _, ne := range enrichers {
+		enriched, err := runEnricher(ne.Enricher, ev, fields)
+		if err != nil {
+			log.Warn("failed to enrich event", zap.String("enricher", ne.Name), zap.Stringer("eventID", ev.ID), zap.Error(err))
+			continue
+		}
+		fields = enriched
+	}
+	return fields
+}
+
+// EventEnrichments returns the fields attached to each of the events by
+// enrichers when they were indexed.
+func (m *Manager) EventEnrichments(eventIDs []types.Hash256) (map[types.Hash256]map[string]string, error) {
+	return m.store.EventEnrichments(eventIDs)
+}
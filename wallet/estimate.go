@@ -0,0 +1,174 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+)
+
+// maxChangelessTries bounds the search for a changeless set of inputs.
+const maxChangelessTries = 100000
+
+// A SendEstimate estimates the cost of sending siacoins from a wallet with a
+// v2 transaction. Inputs are selected largest first, as they are for
+// withdrawal proposals.
+type SendEstimate struct {
+	Inputs int `json:"inputs"`
+	// Size and Weight include a placeholder signature for each input.
+	Size    uint64         `json:"size"`
+	Weight  uint64         `json:"weight"`
+	FeeRate types.Currency `json:"feeRate"`
+	Fee     types.Currency `json:"fee"`
+	Change  types.Currency `json:"change"`
+
+	// Changeless is true if a set of the wallet's outputs can pay the
+	// outputs and fee without a change output, overpaying the fee by less
+	// than a change output would cost. ChangelessInputs and ChangelessFee
+	// describe that set.
+	Changeless       bool           `json:"changeless"`
+	ChangelessInputs int            `json:"changelessInputs,omitempty"`
+	ChangelessFee    types.Currency `json:"changelessFee"`
+}
+
+// findChangeless searches for a subset of values whose sum is in [target,
+// target+window], returning its size and sum. The values must be sorted in
+// descending order.
+func findChangeless(values []types.Currency, target, window types.Currency) (int, types.Currency, bool) {
+	// suffix[i] is the sum of values[i:]
+	suffix := make([]types.Currency, len(values)+1)
+	for i := len(values) - 1; i >= 0; i-- {
+		suffix[i] = suffix[i+1].Add(values[i])
+	}
+	upper := target.Add(window)
+
+	var tries int
+	var search func(i, n int, sum types.Currency) (int, types.Currency, bool)
+	search = func(i, n int, sum types.Currency) (int, types.Currency, bool) {
+		if tries++; tries > maxChangelessTries {
+			return 0, types.ZeroCurrency, false
+		} else if sum.Cmp(target) >= 0 {
+			return n, sum, sum.Cmp(upper) <= 0
+		} else if i == len(values) || sum.Add(suffix[i]).Cmp(target) < 0 {
+			return 0, types.ZeroCurrency, false
+		}
+		if n, total, ok := search(i+1, n+1, sum.Add(values[i])); ok {
+			return n, total, true
+		}
+		return search(i+1, n, sum)
+	}
+	return search(0, 0, types.ZeroCurrency)
+}
+
+// EstimateSend estimates the size and fee of a transaction paying the
+// outputs from a wallet, without reserving any of its outputs. Outputs with
+// fewer than minConfirmations, or the wallet's minimum number of
+// confirmations if higher, are not used.
+func (m *Manager) EstimateSend(walletID ID, outputs []types.SiacoinOutput, minConfirmations uint64) (SendEstimate, error) {
+	if len(outputs) == 0 {
+		return SendEstimate{}, errors.New("estimate must have at least one output")
+	}
+	var total types.Currency
+	for _, sco := range outputs {
+		if sco.Value.IsZero() {
+			return SendEstimate{}, errors.New("outputs must have a non-zero value")
+		}
+		total = total.Add(sco.Value)
+	}
+
+	feePerByte, err := m.WalletFeeRate(walletID)
+	if err != nil {
+		return SendEstimate{}, fmt.Errorf("failed to get fee rate: %w", err)
+	}
+	addresses, err := m.store.WalletAddresses(walletID)
+	if err != nil {
+		return SendEstimate{}, fmt.Errorf("failed to get wallet addresses: %w", err)
+	}
+	policies := make(map[types.Address]types.SpendPolicy, len(addresses))
+	for _, addr := range addresses {
+		if addr.SpendPolicy != nil {
+			policies[addr.Address] = *addr.SpendPolicy
+		}
+	}
+	basis, err := m.store.LastCommittedIndex()
+	if err != nil {
+		return SendEstimate{}, fmt.Errorf("failed to get last committed index: %w", err)
+	}
+	m.mu.Lock()
+	utxos, err := m.spendableOutputs(walletID, basis, minConfirmations)
+	m.mu.Unlock()
+	if err != nil {
+		return SendEstimate{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+	}
+
+	cs := m.chain.TipState()
+	input := func(sce types.SiacoinElement) types.V2SiacoinInput {
+		sci := types.V2SiacoinInput{Parent: sce}
+		if policy, ok := policies[sce.SiacoinOutput.Address]; ok {
+			sci.SatisfiedPolicy.Policy = policy
+		}
+		return sci
+	}
+	weight := func(txn types.V2Transaction) uint64 {
+		return cs.V2TransactionWeight(txn) + uint64(len(txn.SiacoinInputs))*proposalSignatureSize
+	}
+
+	// select the largest outputs, reserving space for the change output
+	est := SendEstimate{FeeRate: feePerByte}
+	txn := types.V2Transaction{
+		SiacoinOutputs: append(append([]types.SiacoinOutput(nil), outputs...), types.SiacoinOutput{}),
+	}
+	var inputSum types.Currency
+	for _, sce := range utxos {
+		txn.SiacoinInputs = append(txn.SiacoinInputs, input(sce))
+		inputSum = inputSum.Add(sce.SiacoinOutput.Value)
+		est.Fee = feePerByte.Mul64(weight(txn))
+		if inputSum.Cmp(total.Add(est.Fee)) >= 0 {
+			break
+		}
+	}
+	if inputSum.Cmp(total.Add(est.Fee)) < 0 {
+		return SendEstimate{}, fmt.Errorf("%w: sending requires %v, wallet has %v available", ErrInsufficientBalance, total.Add(est.Fee), inputSum)
+	}
+	est.Inputs = len(txn.SiacoinInputs)
+	est.Change = inputSum.Sub(total).Sub(est.Fee)
+	if est.Change.IsZero() {
+		txn.SiacoinOutputs = txn.SiacoinOutputs[:len(outputs)]
+	}
+	txn.MinerFee = est.Fee
+	est.Weight = weight(txn)
+	var buf bytes.Buffer
+	e := types.NewEncoder(&buf)
+	txn.EncodeTo(e)
+	e.Flush()
+	est.Size = uint64(buf.Len()) + uint64(est.Inputs)*proposalSignatureSize
+
+	// look for a set of inputs whose value, net of the fee each input adds,
+	// covers the outputs and base fee without exceeding it by more than the
+	// cost of a change output
+	base := types.V2Transaction{SiacoinOutputs: outputs}
+	baseWeight := weight(base)
+	withChange := types.V2Transaction{SiacoinOutputs: append(append([]types.SiacoinOutput(nil), outputs...), types.SiacoinOutput{})}
+	changeCost := feePerByte.Mul64(weight(withChange) - baseWeight)
+	base.SiacoinInputs = []types.V2SiacoinInput{input(utxos[0])}
+	inputFee := feePerByte.Mul64(weight(base) - baseWeight)
+
+	var values []types.Currency
+	for _, sce := range utxos {
+		// utxos are sorted largest first, so the remaining outputs cost
+		// more to spend than they are worth
+		if sce.SiacoinOutput.Value.Cmp(inputFee) <= 0 {
+			break
+		}
+		values = append(values, sce.SiacoinOutput.Value.Sub(inputFee))
+	}
+	baseFee := feePerByte.Mul64(baseWeight)
+	if n, sum, ok := findChangeless(values, total.Add(baseFee), changeCost); ok {
+		est.Changeless = true
+		est.ChangelessInputs = n
+		// the value in excess of the outputs is paid as the fee
+		est.ChangelessFee = sum.Add(inputFee.Mul64(uint64(n))).Sub(total)
+	}
+	return est, nil
+}
@@ -0,0 +1,46 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+)
+
+// An OutputExport is every unspent output of a wallet with its Merkle proof
+// at a chain index. An auditor can check each element against the state
+// accumulator of a consensus node at Basis and sum the outputs themselves,
+// without trusting walletd's balances.
+type OutputExport struct {
+	WalletID ID `json:"walletID"`
+	// Basis is the chain index the proofs are valid at.
+	Basis    types.ChainIndex       `json:"basis"`
+	Siacoins []types.SiacoinElement `json:"siacoins"`
+	Siafunds []types.SiafundElement `json:"siafunds"`
+	// SiacoinTotal and SiafundTotal are the sums of the exported outputs,
+	// including immature siacoin outputs.
+	SiacoinTotal types.Currency `json:"siacoinTotal"`
+	SiafundTotal uint64         `json:"siafundTotal"`
+	DateCreated  time.Time      `json:"dateCreated"`
+}
+
+// ExportOutputs returns every unspent output of a wallet with its Merkle
+// proof and the chain index the proofs are valid at.
+func (m *Manager) ExportOutputs(ctx context.Context, walletID ID) (OutputExport, error) {
+	if m.indexMode == IndexModeNone {
+		return OutputExport{}, fmt.Errorf("outputs cannot be exported in index mode %s", m.indexMode)
+	}
+	export, err := m.store.WalletOutputExport(ctx, walletID)
+	if err != nil {
+		return OutputExport{}, err
+	}
+	for _, sce := range export.Siacoins {
+		export.SiacoinTotal = export.SiacoinTotal.Add(sce.SiacoinOutput.Value)
+	}
+	for _, sfe := range export.Siafunds {
+		export.SiafundTotal += sfe.SiafundOutput.Value
+	}
+	export.DateCreated = time.Now().Truncate(time.Second)
+	return export, nil
+}
@@ -0,0 +1,153 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+)
+
+// fee periods group fee ledger entries by UTC calendar period.
+const (
+	FeePeriodDay   = "day"
+	FeePeriodWeek  = "week"
+	FeePeriodMonth = "month"
+)
+
+// ErrUnknownFeePeriod is returned when a fee period is not one of the
+// FeePeriod constants.
+var ErrUnknownFeePeriod = errors.New("unknown fee period")
+
+type (
+	// A FeeEntry records the miner fee paid by a transaction funded by a
+	// wallet.
+	FeeEntry struct {
+		EventID   types.Hash256    `json:"eventID"`
+		Index     types.ChainIndex `json:"index"`
+		Amount    types.Currency   `json:"amount"`
+		Timestamp time.Time        `json:"timestamp"`
+	}
+
+	// A FeeSummary is the total fees paid by a wallet in a period.
+	FeeSummary struct {
+		Start        time.Time      `json:"start"`
+		End          time.Time      `json:"end"`
+		Total        types.Currency `json:"total"`
+		Transactions int            `json:"transactions"`
+	}
+)
+
+// TransactionFee returns the miner fee of a transaction event and the
+// event's relevant addresses that funded it. The fee is zero for other
+// events.
+func TransactionFee(ev Event) (fee types.Currency, payers []types.Address) {
+	switch data := ev.Data.(type) {
+	case EventV1Transaction:
+		for _, c := range data.Transaction.MinerFees {
+			fee = fee.Add(c)
+		}
+	case EventV2Transaction:
+		fee = data.MinerFee
+	default:
+		return types.ZeroCurrency, nil
+	}
+
+	inputs, _, _ := transactionFlows(ev)
+	relevant := make(map[types.Address]bool, len(ev.Relevant))
+	for _, addr := range ev.Relevant {
+		relevant[addr] = true
+	}
+	for _, sco := range inputs {
+		if relevant[sco.Address] {
+			payers = append(payers, sco.Address)
+			delete(relevant, sco.Address)
+		}
+	}
+	return fee, payers
+}
+
+// feePeriodStart returns the start of the period containing t.
+func feePeriodStart(t time.Time, period string) (time.Time, error) {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case FeePeriodDay:
+		return day, nil
+	case FeePeriodWeek:
+		// weeks start on Monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), nil
+	case FeePeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC), nil
+	default:
+		return time.Time{}, fmt.Errorf("%w %q", ErrUnknownFeePeriod, period)
+	}
+}
+
+// nextFeePeriod returns the start of the period n periods after start.
+func nextFeePeriod(start time.Time, period string, n int) time.Time {
+	switch period {
+	case FeePeriodDay:
+		return start.AddDate(0, 0, n)
+	case FeePeriodWeek:
+		return start.AddDate(0, 0, 7*n)
+	default:
+		return start.AddDate(0, n, 0)
+	}
+}
+
+// SummarizeFees groups fee entries into the n periods ending with the period
+// containing now. Summaries are returned newest first; entries outside the
+// periods are ignored.
+func SummarizeFees(entries []FeeEntry, period string, n int, now time.Time) ([]FeeSummary, error) {
+	current, err := feePeriodStart(now, period)
+	if err != nil {
+		return nil, err
+	} else if n <= 0 {
+		return nil, nil
+	}
+
+	summaries := make([]FeeSummary, n)
+	for i := range summaries {
+		start := nextFeePeriod(current, period, -i)
+		summaries[i] = FeeSummary{
+			Start: start,
+			End:   nextFeePeriod(start, period, 1),
+		}
+	}
+	oldest := summaries[n-1].Start
+	for _, entry := range entries {
+		if entry.Timestamp.Before(oldest) {
+			continue
+		}
+		for i := range summaries {
+			if !entry.Timestamp.Before(summaries[i].Start) && entry.Timestamp.Before(summaries[i].End) {
+				summaries[i].Total = summaries[i].Total.Add(entry.Amount)
+				summaries[i].Transactions++
+				break
+			}
+		}
+	}
+	return summaries, nil
+}
+
+// WalletFees returns the fees paid by the given wallet's transactions since
+// the given time, oldest first.
+func (m *Manager) WalletFees(walletID ID, since time.Time) ([]FeeEntry, error) {
+	return m.store.WalletFees(walletID, since)
+}
+
+// WalletFeeSummary returns the fees paid by the given wallet in each of the
+// last n periods, newest first.
+func (m *Manager) WalletFeeSummary(walletID ID, period string, n int) ([]FeeSummary, error) {
+	now := time.Now()
+	current, err := feePeriodStart(now, period)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := m.store.WalletFees(walletID, nextFeePeriod(current, period, 1-n))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fees: %w", err)
+	}
+	return SummarizeFees(entries, period, n, now)
+}
@@ -0,0 +1,158 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"go.thebigfile.com/core/consensus"
+	"go.thebigfile.com/core/types"
+)
+
+// fee strategy types determine how a wallet's fee rate is derived.
+const (
+	FeeStrategyRecommended = "recommended"
+	FeeStrategyFixed       = "fixed"
+	FeeStrategyMultiplier  = "multiplier"
+	FeeStrategyTarget      = "target"
+)
+
+// multiplierPrecision is the precision used when scaling a fee rate by a
+// multiplier.
+const multiplierPrecision = 1000
+
+// ErrInvalidFeeStrategy is returned when a fee strategy is not valid.
+var ErrInvalidFeeStrategy = errors.New("invalid fee strategy")
+
+// A FeeStrategy determines the fee rate, in Hastings per byte, used when
+// funding a wallet's transactions.
+type FeeStrategy struct {
+	Type string `json:"type"`
+	// Fee is the fee rate of the fixed strategy.
+	Fee types.Currency `json:"fee"`
+	// Multiplier scales the recommended fee rate for the multiplier
+	// strategy.
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// TargetBlocks is the number of blocks within which the target strategy
+	// aims to be confirmed.
+	TargetBlocks uint64 `json:"targetBlocks,omitempty"`
+	// MaxFee caps the fee rate of every strategy. A zero MaxFee disables the
+	// cap.
+	MaxFee types.Currency `json:"maxFee"`
+}
+
+// DefaultFeeStrategy is the fee strategy of wallets that have not configured
+// one.
+var DefaultFeeStrategy = FeeStrategy{Type: FeeStrategyRecommended}
+
+// Validate returns an error if the fee strategy is not valid.
+func (fs FeeStrategy) Validate() error {
+	switch fs.Type {
+	case FeeStrategyRecommended:
+	case FeeStrategyFixed:
+		if fs.Fee.IsZero() {
+			return fmt.Errorf("%w: fixed strategy requires a fee", ErrInvalidFeeStrategy)
+		}
+	case FeeStrategyMultiplier:
+		if fs.Multiplier <= 0 || math.IsInf(fs.Multiplier, 0) || math.IsNaN(fs.Multiplier) {
+			return fmt.Errorf("%w: multiplier must be positive", ErrInvalidFeeStrategy)
+		}
+	case FeeStrategyTarget:
+		if fs.TargetBlocks == 0 {
+			return fmt.Errorf("%w: target strategy requires target blocks", ErrInvalidFeeStrategy)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidFeeStrategy, fs.Type)
+	}
+	return nil
+}
+
+// targetFeeRate estimates the fee rate needed for a transaction to be
+// confirmed within the target number of blocks. Pool transactions are
+// ordered by fee rate and the rate of the first transaction that would not
+// fit in the target blocks is returned, plus one Hasting per byte. If the
+// whole pool fits, the recommended fee rate is returned.
+func targetFeeRate(cs consensus.State, recommended types.Currency, target uint64, v1 []types.Transaction, v2 []types.V2Transaction) types.Currency {
+	type poolTxn struct {
+		rate   types.Currency
+		weight uint64
+	}
+	var txns []poolTxn
+	add := func(fee types.Currency, weight uint64) {
+		if weight == 0 {
+			return
+		}
+		txns = append(txns, poolTxn{fee.Div64(weight), weight})
+	}
+	for _, txn := range v1 {
+		var fee types.Currency
+		for _, c := range txn.MinerFees {
+			fee = fee.Add(c)
+		}
+		add(fee, cs.TransactionWeight(txn))
+	}
+	for _, txn := range v2 {
+		add(txn.MinerFee, cs.V2TransactionWeight(txn))
+	}
+	sort.Slice(txns, func(i, j int) bool {
+		return txns[i].rate.Cmp(txns[j].rate) > 0
+	})
+
+	capacity := cs.MaxBlockWeight() * target
+	var weight uint64
+	for _, txn := range txns {
+		weight += txn.weight
+		if weight > capacity {
+			if rate := txn.rate.Add(types.NewCurrency64(1)); rate.Cmp(recommended) > 0 {
+				return rate
+			}
+			break
+		}
+	}
+	return recommended
+}
+
+// FeeRate returns the fee rate of the strategy given the chain state, the
+// recommended fee rate, and the transactions in the pool.
+func (fs FeeStrategy) FeeRate(cs consensus.State, recommended types.Currency, v1 []types.Transaction, v2 []types.V2Transaction) types.Currency {
+	var rate types.Currency
+	switch fs.Type {
+	case FeeStrategyFixed:
+		rate = fs.Fee
+	case FeeStrategyMultiplier:
+		rate = recommended.Mul64(uint64(fs.Multiplier * multiplierPrecision)).Div64(multiplierPrecision)
+	case FeeStrategyTarget:
+		rate = targetFeeRate(cs, recommended, fs.TargetBlocks, v1, v2)
+	default:
+		rate = recommended
+	}
+
+	if !fs.MaxFee.IsZero() && rate.Cmp(fs.MaxFee) > 0 {
+		rate = fs.MaxFee
+	}
+	return rate
+}
+
+// WalletFeeStrategy returns the fee strategy of the given wallet.
+func (m *Manager) WalletFeeStrategy(walletID ID) (FeeStrategy, error) {
+	return m.store.WalletFeeStrategy(walletID)
+}
+
+// SetWalletFeeStrategy sets the fee strategy of the given wallet.
+func (m *Manager) SetWalletFeeStrategy(walletID ID, fs FeeStrategy) error {
+	if err := fs.Validate(); err != nil {
+		return err
+	}
+	return m.store.SetWalletFeeStrategy(walletID, fs)
+}
+
+// WalletFeeRate returns the fee rate, in Hastings per byte, that the given
+// wallet's fee strategy currently yields.
+func (m *Manager) WalletFeeRate(walletID ID) (types.Currency, error) {
+	fs, err := m.store.WalletFeeStrategy(walletID)
+	if err != nil {
+		return types.ZeroCurrency, fmt.Errorf("failed to get fee strategy: %w", err)
+	}
+	return fs.FeeRate(m.chain.TipState(), m.chain.RecommendedFee(), m.chain.PoolTransactions(), m.chain.V2PoolTransactions()), nil
+}
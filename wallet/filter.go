@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Wallet sort orders. Ties are broken by wallet ID.
+const (
+	WalletSortID   = "id"
+	WalletSortName = "name"
+	// WalletSortCreated sorts wallets by creation date.
+	WalletSortCreated = "created"
+	// WalletSortLastActivity sorts wallets by the timestamp of their most
+	// recent confirmed event. Wallets without events sort first.
+	WalletSortLastActivity = "lastActivity"
+	// WalletSortBalance sorts wallets by confirmed siacoin balance.
+	WalletSortBalance = "balance"
+)
+
+type (
+	// A MetadataFilter matches wallets whose metadata contains a value at a
+	// path. Values are typed: the filter value 123 matches the number 123,
+	// but not the string "123".
+	MetadataFilter struct {
+		// Path is the list of object keys leading to the value, e.g.
+		// ["owner", "email"]. Array elements are matched by the path of
+		// their array, so ["tags"] matches any element of the "tags" array.
+		Path []string `json:"path"`
+		// Value is a JSON string, number, boolean, or null.
+		Value json.RawMessage `json:"value"`
+	}
+
+	// A WalletFilter filters and paginates wallets. The zero value matches
+	// all wallets.
+	WalletFilter struct {
+		// Tenant restricts the results to a tenant's wallets. If empty,
+		// wallets of all tenants are returned.
+		Tenant string
+		// NamePrefix restricts the results to wallets whose name starts
+		// with the prefix. The match is case-sensitive.
+		NamePrefix string
+		// Metadata restricts the results to wallets matching every filter.
+		Metadata []MetadataFilter
+
+		// SortBy is the sort order of the results. If empty, wallets are
+		// sorted by ID.
+		SortBy     string
+		Descending bool
+
+		Offset int
+		// Limit is the maximum number of wallets to return. If Limit is
+		// negative, all matching wallets are returned.
+		Limit int
+	}
+)
+
+// ParseMetadataFilter parses a metadata filter from a dot-separated path and
+// a value, e.g. "owner.email" and "alice@example.com". Values that are valid
+// JSON scalars are matched by type; other values are matched as strings. To
+// match a string that looks like a number or boolean, quote it, e.g. "\"123\"".
+func ParseMetadataFilter(path, value string) (MetadataFilter, error) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return MetadataFilter{}, fmt.Errorf("invalid metadata path %q", path)
+		}
+	}
+
+	v := json.RawMessage(value)
+	if !isScalar(v) {
+		v, _ = json.Marshal(value)
+	}
+	return MetadataFilter{Path: keys, Value: v}, nil
+}
+
+// isScalar returns true if v is a single JSON string, number, boolean, or
+// null.
+func isScalar(v json.RawMessage) bool {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 || v[0] == '{' || v[0] == '[' {
+		return false
+	}
+	return json.Valid(v)
+}
+
+// Validate returns an error if the filter is invalid.
+func (mf MetadataFilter) Validate() error {
+	if len(mf.Path) == 0 {
+		return errors.New("metadata filter path is required")
+	}
+	for _, key := range mf.Path {
+		if key == "" {
+			return errors.New("metadata filter path cannot contain empty keys")
+		}
+	}
+	if !isScalar(mf.Value) {
+		return fmt.Errorf("metadata filter value %q must be a JSON string, number, boolean, or null", mf.Value)
+	}
+	return nil
+}
+
+// Validate returns an error if the filter is invalid.
+func (f WalletFilter) Validate() error {
+	switch f.SortBy {
+	case "", WalletSortID, WalletSortName, WalletSortCreated, WalletSortLastActivity, WalletSortBalance:
+	default:
+		return fmt.Errorf("unknown sort order %q", f.SortBy)
+	}
+	if f.Offset < 0 {
+		return errors.New("offset must be non-negative")
+	}
+	for _, mf := range f.Metadata {
+		if err := mf.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilterWallets returns a page of the wallets matching the filter and the
+// total number of matching wallets.
+func (m *Manager) FilterWallets(f WalletFilter) ([]Wallet, int, error) {
+	if err := f.Validate(); err != nil {
+		return nil, 0, err
+	}
+	return m.store.FilterWallets(f)
+}
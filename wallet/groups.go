@@ -0,0 +1,103 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrGroupNotFound is returned when a wallet group is not found.
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupDepth is returned when nesting a group would exceed one level.
+	ErrGroupDepth = errors.New("groups can only be nested one level")
+)
+
+type (
+	// A GroupID is a unique identifier for a wallet group.
+	GroupID int64
+
+	// A Group organizes wallets, e.g. by business unit. Groups can be nested
+	// one level: a group with a parent cannot have subgroups.
+	Group struct {
+		ID          GroupID   `json:"id"`
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		ParentID    *GroupID  `json:"parentID,omitempty"`
+		DateCreated time.Time `json:"dateCreated"`
+		LastUpdated time.Time `json:"lastUpdated"`
+	}
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *GroupID) UnmarshalText(buf []byte) error {
+	n, err := strconv.ParseInt(string(buf), 10, 64)
+	if err != nil {
+		return err
+	}
+	*id = GroupID(n)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (id GroupID) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(id), 10)), nil
+}
+
+// Groups returns all wallet groups.
+func (m *Manager) Groups() ([]Group, error) {
+	return m.store.Groups()
+}
+
+// AddGroup adds a wallet group.
+func (m *Manager) AddGroup(g Group) (Group, error) {
+	if g.Name == "" {
+		return Group{}, errors.New("group name is required")
+	}
+	return m.store.AddGroup(g)
+}
+
+// UpdateGroup updates a wallet group.
+func (m *Manager) UpdateGroup(g Group) (Group, error) {
+	if g.Name == "" {
+		return Group{}, errors.New("group name is required")
+	} else if g.ParentID != nil && *g.ParentID == g.ID {
+		return Group{}, ErrGroupDepth
+	}
+	return m.store.UpdateGroup(g)
+}
+
+// DeleteGroup deletes a wallet group. Its wallets are unassigned and its
+// subgroups become top-level groups.
+func (m *Manager) DeleteGroup(id GroupID) error {
+	return m.store.DeleteGroup(id)
+}
+
+// GroupWallets returns the wallets assigned to a group and its subgroups.
+func (m *Manager) GroupWallets(id GroupID) ([]Wallet, error) {
+	return m.store.GroupWallets(id)
+}
+
+// AddGroupWallet assigns a wallet to a group. A wallet belongs to at most one
+// group; assigning it to a new group removes it from its previous group.
+func (m *Manager) AddGroupWallet(id GroupID, walletID ID) error {
+	return m.store.AddGroupWallet(id, walletID)
+}
+
+// RemoveGroupWallet removes a wallet from a group.
+func (m *Manager) RemoveGroupWallet(id GroupID, walletID ID) error {
+	return m.store.RemoveGroupWallet(id, walletID)
+}
+
+// GroupBalance returns the combined balance of the wallets in a group and
+// its subgroups.
+func (m *Manager) GroupBalance(id GroupID) (Balance, error) {
+	return m.store.GroupBalance(id)
+}
+
+// GroupEvents returns the events relevant to the wallets in a group and its
+// subgroups.
+func (m *Manager) GroupEvents(ctx context.Context, id GroupID, offset, limit int) ([]Event, error) {
+	return m.store.GroupEvents(ctx, id, offset, limit)
+}
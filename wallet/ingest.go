@@ -0,0 +1,219 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+)
+
+// defaultIngestQueueSize is the default capacity of the ingestion queue.
+const defaultIngestQueueSize = 64
+
+type (
+	// An ingestJob asks the writer goroutine to apply chain updates to the
+	// store.
+	ingestJob struct {
+		// scan is the index a rescan starts from. If nil, the store is
+		// synced from its last committed index.
+		scan *types.ChainIndex
+		// ctx and done are only set for scans. done receives the result
+		// of the scan.
+		ctx  context.Context
+		done chan error
+	}
+
+	// IngestStatus reports the progress of applying chain updates to the
+	// store.
+	IngestStatus struct {
+		// QueueDepth is the number of jobs waiting for the writer.
+		QueueDepth int `json:"queueDepth"`
+		// QueueCapacity is the maximum number of queued jobs. Chain
+		// updates received while the queue is full are coalesced into
+		// the jobs already queued.
+		QueueCapacity int `json:"queueCapacity"`
+		// Applying is true while the writer is applying updates.
+		Applying bool `json:"applying"`
+		// Applied is the last index committed to the store.
+		Applied types.ChainIndex `json:"applied"`
+		// Tip is the chain manager's tip.
+		Tip types.ChainIndex `json:"tip"`
+		// Lag is the number of blocks the store is behind the tip.
+		Lag uint64 `json:"lag"`
+		// CatchingUp is true while the store is being synced in
+		// catch-up mode.
+		CatchingUp bool `json:"catchingUp"`
+	}
+)
+
+// queueSync queues a sync of the store with the chain manager. If the queue
+// is full, the sync is dropped; the queued jobs sync the store to the tip
+// when they run.
+func (m *Manager) queueSync() {
+	select {
+	case m.ingest <- ingestJob{}:
+	default:
+	}
+}
+
+// setApplying records whether the writer is applying updates.
+func (m *Manager) setApplying(applying bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applying = applying
+}
+
+// setApplied records the last index committed to the store.
+func (m *Manager) setApplied(index types.ChainIndex) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applied = index
+}
+
+// setCatchingUp records whether the store is in catch-up mode.
+func (m *Manager) setCatchingUp(catchingUp bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.catchingUp = catchingUp
+}
+
+// IngestStatus returns the state of the ingestion queue. It does not access
+// the store, so it never blocks behind chain updates being applied.
+func (m *Manager) IngestStatus() IngestStatus {
+	tip := m.chain.Tip()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := IngestStatus{
+		QueueDepth:    len(m.ingest),
+		QueueCapacity: cap(m.ingest),
+		Applying:      m.applying,
+		Applied:       m.applied,
+		Tip:           tip,
+		CatchingUp:    m.catchingUp,
+	}
+	if tip.Height > m.applied.Height {
+		status.Lag = tip.Height - m.applied.Height
+	}
+	return status
+}
+
+// catchUp syncs the store in catch-up mode from index while it is more than
+// the catch-up threshold behind the tip, and returns the index it synced to.
+// Catch-up mode skips the per-block work that is only useful near the tip:
+// events confirmed while catching up are not broadcast, and the store defers
+// secondary indexes until catch-up mode ends.
+func (m *Manager) catchUp(ctx context.Context, log *zap.Logger, index types.ChainIndex) (types.ChainIndex, error) {
+	behind := func(index types.ChainIndex) bool {
+		tip := m.chain.Tip()
+		return m.catchUpThreshold > 0 && tip.Height > index.Height && tip.Height-index.Height > m.catchUpThreshold
+	}
+	if !m.catchingUp && !behind(index) {
+		return index, nil
+	}
+
+	start := time.Now()
+	if !m.catchingUp {
+		log.Info("entering catch-up mode", zap.Stringer("index", index), zap.Stringer("tip", m.chain.Tip()))
+		if err := m.store.SetCatchingUp(true); err != nil {
+			return index, fmt.Errorf("failed to enable catch-up mode: %w", err)
+		}
+		m.setCatchingUp(true)
+	}
+
+	index, err := syncStoreWhile(ctx, m.store, m.chain, index, m.syncBatchSize, m.setApplied, behind)
+	if err != nil {
+		return index, err
+	}
+
+	// build the deferred indexes before the events are broadcast
+	if err := m.store.SetCatchingUp(false); err != nil {
+		return index, fmt.Errorf("failed to disable catch-up mode: %w", err)
+	}
+	m.setCatchingUp(false)
+	// events reverted while catching up are not broadcast either
+	seq, err := m.store.LastRevertedEventSeq()
+	if err != nil {
+		return index, fmt.Errorf("failed to get last reverted event: %w", err)
+	}
+	m.revertedSeq = seq
+	log.Info("left catch-up mode", zap.Stringer("index", index), zap.Duration("elapsed", time.Since(start)))
+	return index, nil
+}
+
+// runJob applies the chain updates requested by a job. The store is only
+// written to by the writer goroutine, so API reads, which use separate
+// read transactions, never wait for block application.
+func (m *Manager) runJob(ctx context.Context, log *zap.Logger, job ingestJob) error {
+	m.setApplying(true)
+	defer m.setApplying(false)
+
+	if job.scan != nil {
+		return syncStore(job.ctx, m.store, m.chain, *job.scan, m.syncBatchSize, m.setApplied)
+	}
+
+	lastTip, err := m.store.LastCommittedIndex()
+	if err != nil {
+		return fmt.Errorf("failed to get last committed index: %w", err)
+	}
+	m.setApplied(lastTip)
+	// deep reorgs are not applied until approved
+	if ok, err := m.checkReorgDepth(lastTip); err != nil {
+		return fmt.Errorf("failed to check reorg depth: %w", err)
+	} else if !ok {
+		return nil
+	}
+	if lastTip, err = m.catchUp(ctx, log, lastTip); err != nil {
+		return err
+	}
+	if err := syncStore(ctx, m.store, m.chain, lastTip, m.syncBatchSize, m.setApplied); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.approvedDepth = 0
+	m.mu.Unlock()
+
+	if m.events != nil {
+		// broadcast reversals before the events that replace them
+		if err := m.broadcastRevertedEvents(); err != nil {
+			log.Warn("failed to broadcast reverted wallet events", zap.Error(err))
+		}
+	}
+	if m.indexMode != IndexModeNone {
+		if err := m.resolveEvents(); err != nil {
+			log.Warn("failed to resolve wallet events", zap.Error(err))
+		}
+	}
+	if err := m.checkBalanceAlarms(); err != nil {
+		log.Warn("failed to check balance alarms", zap.Error(err))
+	}
+	return nil
+}
+
+// runWriter applies queued jobs until ctx is canceled.
+func (m *Manager) runWriter(ctx context.Context) {
+	log := m.log.Named("sync")
+	for {
+		var job ingestJob
+		select {
+		case <-ctx.Done():
+			return
+		case job = <-m.ingest:
+		}
+
+		if job.scan != nil && job.ctx.Err() != nil {
+			// the scan was canceled while queued
+			job.done <- job.ctx.Err()
+			continue
+		}
+		err := m.runJob(ctx, log, job)
+		if job.done != nil {
+			job.done <- err
+		} else if err != nil && !errors.Is(err, context.Canceled) {
+			log.Panic("failed to sync store", zap.Error(err))
+		}
+	}
+}
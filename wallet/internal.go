@@ -0,0 +1,92 @@
+package wallet
+
+import (
+	"sort"
+
+	"go.thebigfile.com/core/types"
+)
+
+// CategoryInternal is the category of events that only moved funds between
+// wallets on this instance. Across the instance their net value is zero, less
+// the miner fee, so aggregate reports should not count them as income or
+// expense.
+const CategoryInternal = "internal"
+
+// Change returns the value of the siacoin outputs that a transaction event
+// returned to its relevant addresses. Outputs are only change if the
+// transaction also spent from a relevant address.
+func Change(ev Event) types.Currency {
+	inputs, outputs, ok := transactionFlows(ev)
+	if !ok {
+		return types.ZeroCurrency
+	}
+	relevant := make(map[types.Address]bool, len(ev.Relevant))
+	for _, addr := range ev.Relevant {
+		relevant[addr] = true
+	}
+
+	var funded bool
+	for _, sco := range inputs {
+		if relevant[sco.Address] {
+			funded = true
+			break
+		}
+	}
+	if !funded {
+		return types.ZeroCurrency
+	}
+
+	var change types.Currency
+	for _, sco := range outputs {
+		if relevant[sco.Address] {
+			change = change.Add(sco.Value)
+		}
+	}
+	return change
+}
+
+// MarkInternal marks the events that only moved funds between wallets on this
+// instance. owners maps addresses to the wallet that owns them. Counterparties
+// in owners are labeled with their wallet, and a transaction event whose
+// counterparties are all in owners is marked Internal and given the
+// CategoryInternal category. A transaction with no counterparties, such as a
+// wallet consolidating its own outputs, is internal as well.
+func MarkInternal(annotated []AnnotatedEvent, owners map[types.Address]ID) {
+	for i := range annotated {
+		ae := &annotated[i]
+		if _, _, ok := transactionFlows(ae.Event); !ok {
+			continue
+		}
+
+		internal := true
+		for j := range ae.Counterparties {
+			if id, ok := owners[ae.Counterparties[j].Address]; ok {
+				ae.Counterparties[j].Wallet = id
+			} else {
+				internal = false
+			}
+		}
+		if !internal {
+			continue
+		}
+		ae.Internal = true
+		if n := sort.SearchStrings(ae.Categories, CategoryInternal); n == len(ae.Categories) || ae.Categories[n] != CategoryInternal {
+			ae.Categories = append(ae.Categories, CategoryInternal)
+			sort.Strings(ae.Categories)
+		}
+	}
+}
+
+// ReportFlows returns the siacoins received and sent by the relevant addresses
+// of an annotated event for aggregate reports. Change is netted out of both,
+// and internal events have no flows.
+func ReportFlows(ae AnnotatedEvent) (inflow, outflow types.Currency) {
+	if ae.Internal {
+		return types.ZeroCurrency, types.ZeroCurrency
+	}
+	inflow, outflow = EventFlows(ae.Event)
+	if change := ae.Change; !change.IsZero() && inflow.Cmp(change) >= 0 && outflow.Cmp(change) >= 0 {
+		inflow, outflow = inflow.Sub(change), outflow.Sub(change)
+	}
+	return
+}
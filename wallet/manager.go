@@ -2,12 +2,14 @@ package wallet
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
 	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/types"
 	"go.thebigfile.com/coreutils/chain"
 	"go.uber.org/zap"
@@ -35,6 +37,14 @@ const (
 
 const defaultSyncBatchSize = 1
 
+// ScopeWallets is the webhook scope of wallet events. The event name is the
+// type of the wallet event, e.g. "v2Transaction".
+const ScopeWallets = "wallets"
+
+// maxBroadcastEvents is the maximum number of events resolved or broadcast
+// in each batch.
+const maxBroadcastEvents = 100
+
 type (
 	// An IndexMode determines the chain state that the wallet manager stores.
 	IndexMode uint8
@@ -45,6 +55,8 @@ type (
 		V2PoolTransactions() []types.V2Transaction
 
 		Tip() types.ChainIndex
+		TipState() consensus.State
+		RecommendedFee() types.Currency
 		BestIndex(height uint64) (types.ChainIndex, bool)
 
 		OnReorg(fn func(types.ChainIndex)) (cancel func())
@@ -56,25 +68,159 @@ type (
 		UpdateChainState(reverted []chain.RevertUpdate, applied []chain.ApplyUpdate) error
 
 		WalletUnconfirmedEvents(id ID, index types.ChainIndex, timestamp time.Time, v1 []types.Transaction, v2 []types.V2Transaction) (annotated []Event, err error)
-		WalletEvents(walletID ID, offset, limit int) ([]Event, error)
+		WalletEvents(ctx context.Context, walletID ID, offset, limit int) ([]Event, error)
+		// WalletEventFeed returns the events of a wallet and the events
+		// removed from the chain by reorgs, newest first.
+		WalletEventFeed(ctx context.Context, walletID ID, offset, limit int) ([]FeedEvent, error)
 		AddWallet(Wallet) (Wallet, error)
 		UpdateWallet(Wallet) (Wallet, error)
 		DeleteWallet(walletID ID) error
 		WalletBalance(walletID ID) (Balance, error)
 		WalletSiacoinOutputs(walletID ID, index types.ChainIndex, offset, limit int) ([]types.SiacoinElement, error)
+		// WalletImmatureSiacoinOutputs returns the wallet's unspent
+		// outputs that have not matured at the index.
+		WalletImmatureSiacoinOutputs(walletID ID, index types.ChainIndex) ([]types.SiacoinElement, error)
 		WalletSiafundOutputs(walletID ID, offset, limit int) ([]types.SiafundElement, error)
+		// WalletConfirmedSiacoinOutputs and WalletConfirmedSiafundOutputs
+		// return the unspent outputs of a wallet created at or below
+		// maxHeight.
+		WalletConfirmedSiacoinOutputs(walletID ID, index types.ChainIndex, maxHeight uint64, offset, limit int) ([]types.SiacoinElement, error)
+		WalletConfirmedSiafundOutputs(walletID ID, maxHeight uint64, offset, limit int) ([]types.SiafundElement, error)
+		// WalletOutputExport returns every unspent output of a wallet with
+		// its Merkle proof and the last committed index, read atomically.
+		WalletOutputExport(ctx context.Context, walletID ID) (OutputExport, error)
 		WalletAddresses(walletID ID) ([]Address, error)
 		Wallets() ([]Wallet, error)
-
-		AddWalletAddress(walletID ID, address Address) error
+		// FilterWallets returns a page of the wallets matching a filter
+		// and the total number of matching wallets.
+		FilterWallets(WalletFilter) ([]Wallet, int, error)
+		// TenantWallets returns the wallets owned by a tenant.
+		TenantWallets(tenant string) ([]Wallet, error)
+		// WalletTenant returns the tenant that owns a wallet.
+		WalletTenant(walletID ID) (string, error)
+		// TenantHasAddress returns true if the address belongs to any of
+		// the tenant's wallets.
+		TenantHasAddress(tenant string, address types.Address) (bool, error)
+		// TenantHasEvent returns true if the event is relevant to any of
+		// the tenant's wallets.
+		TenantHasEvent(tenant string, eventID types.Hash256) (bool, error)
+		// TenantUsage returns the number of wallets and addresses owned by
+		// each tenant.
+		TenantUsage() ([]TenantUsage, error)
+		// WalletDeltas returns the change in a wallet's balance from the
+		// events in each block between start and end, inclusive.
+		WalletDeltas(ctx context.Context, walletID ID, start, end uint64) ([]BlockDelta, error)
+		// WalletEventsBetween returns the events relevant to a wallet
+		// confirmed between start and end, inclusive, ordered by height.
+		WalletEventsBetween(ctx context.Context, walletID ID, start, end uint64) ([]Event, error)
+		// WalletFees returns the fees paid by a wallet's transactions since
+		// the given time, oldest first.
+		WalletFees(walletID ID, since time.Time) ([]FeeEntry, error)
+		// WalletFeeStrategy returns a wallet's fee strategy, or
+		// DefaultFeeStrategy if none is set.
+		WalletFeeStrategy(walletID ID) (FeeStrategy, error)
+		SetWalletFeeStrategy(walletID ID, fs FeeStrategy) error
+		// WalletMinConfirmations returns the minimum number of
+		// confirmations of a wallet's funding outputs, or zero if none is
+		// set.
+		WalletMinConfirmations(walletID ID) (uint64, error)
+		SetWalletMinConfirmations(walletID ID, n uint64) error
+		// WalletMetadataSchema returns a wallet's metadata schema, or nil
+		// if it does not have one.
+		WalletMetadataSchema(walletID ID) (json.RawMessage, error)
+		// SetWalletMetadataSchema sets a wallet's metadata schema. A nil
+		// schema removes it.
+		SetWalletMetadataSchema(walletID ID, schema json.RawMessage) error
+		// AddBalanceAlarm adds a balance alarm. It returns ErrNotFound if
+		// the alarm's address is not in the wallet.
+		AddBalanceAlarm(BalanceAlarm) (BalanceAlarm, error)
+		WalletBalanceAlarms(walletID ID) ([]BalanceAlarm, error)
+		RemoveBalanceAlarm(walletID ID, id AlarmID) error
+		// BalanceAlarms returns the balance alarms of every wallet.
+		BalanceAlarms() ([]BalanceAlarm, error)
+		UpdateBalanceAlarmState(id AlarmID, state string, triggered time.Time) error
+
+		Groups() ([]Group, error)
+		AddGroup(Group) (Group, error)
+		UpdateGroup(Group) (Group, error)
+		DeleteGroup(id GroupID) error
+		GroupWallets(id GroupID) ([]Wallet, error)
+		AddGroupWallet(id GroupID, walletID ID) error
+		RemoveGroupWallet(id GroupID, walletID ID) error
+		GroupBalance(id GroupID) (Balance, error)
+		GroupEvents(ctx context.Context, id GroupID, offset, limit int) ([]Event, error)
+
+		Templates() ([]Template, error)
+		Template(id TemplateID) (Template, error)
+		AddTemplate(Template) (Template, error)
+		UpdateTemplate(Template) (Template, error)
+		DeleteTemplate(id TemplateID) error
+
+		ClassificationRules() ([]ClassificationRule, error)
+		AddClassificationRule(ClassificationRule) (ClassificationRule, error)
+		DeleteClassificationRule(id RuleID) error
+		// EventCategories returns the categories attached to each of the
+		// events by classification rules.
+		EventCategories(eventIDs []types.Hash256) (map[types.Hash256][]string, error)
+		// WalletCategoryEvents returns the events relevant to a wallet with
+		// the given category, sorted by height descending.
+		WalletCategoryEvents(ctx context.Context, walletID ID, category string, offset, limit int) ([]Event, error)
+		// EventEnrichments returns the fields attached to each of the
+		// events by enrichers.
+		EventEnrichments(eventIDs []types.Hash256) (map[types.Hash256]map[string]string, error)
+		// AddEventCounterparties stores the counterparties of the wallet's
+		// events, replacing any stored for the same events.
+		AddEventCounterparties(walletID ID, counterparties map[types.Hash256][]Counterparty) error
+		// EventCounterparties returns the stored counterparties of the
+		// wallet's events, omitting events with none stored.
+		EventCounterparties(walletID ID, eventIDs []types.Hash256) (map[types.Hash256][]Counterparty, error)
+		// UnresolvedEvents returns up to limit of the oldest applied events
+		// relevant to wallets that have not been marked resolved. Events
+		// removed by a reorg are no longer returned.
+		UnresolvedEvents(limit int) ([]UnresolvedEvent, error)
+		// MarkEventsResolved marks the events with the given sequence
+		// numbers resolved.
+		MarkEventsResolved(seqs []int64) error
+
+		// AddWalletAddress adds an address to a wallet, reporting whether it
+		// was already in the wallet or in other wallets.
+		AddWalletAddress(walletID ID, address Address) (AddAddressResult, error)
 		RemoveWalletAddress(walletID ID, address types.Address) error
 
 		AddressBalance(address types.Address) (balance Balance, err error)
-		AddressEvents(address types.Address, offset, limit int) (events []Event, err error)
+		// AddressWallets returns the wallet that owns each of the given
+		// addresses, omitting addresses that are not in any wallet.
+		AddressWallets(addresses []types.Address) (map[types.Address]ID, error)
+		AddressEvents(ctx context.Context, address types.Address, offset, limit int) (events []Event, err error)
+		// AddressEventsSince returns the events of an address confirmed in
+		// blocks after the given height, oldest first.
+		AddressEventsSince(ctx context.Context, address types.Address, height uint64, offset, limit int) (events []Event, err error)
 		AddressSiacoinOutputs(address types.Address, index types.ChainIndex, offset, limit int) (siacoins []types.SiacoinElement, err error)
 		AddressSiafundOutputs(address types.Address, offset, limit int) (siafunds []types.SiafundElement, err error)
+		AddressConfirmedSiacoinOutputs(address types.Address, index types.ChainIndex, maxHeight uint64, offset, limit int) (siacoins []types.SiacoinElement, err error)
+		AddressConfirmedSiafundOutputs(address types.Address, maxHeight uint64, offset, limit int) (siafunds []types.SiafundElement, err error)
 
 		Events(eventIDs []types.Hash256) ([]Event, error)
+		// RevertedEvents returns the events with the given IDs that were
+		// removed from the chain by a reorg.
+		RevertedEvents(eventIDs []types.Hash256) ([]Event, error)
+		// EventRawTransaction returns the full transaction of a confirmed
+		// event.
+		EventRawTransaction(eventID types.Hash256) (RawTransaction, error)
+		// RevertedEventsAfter returns up to limit events reverted after
+		// the event with sequence number seq, in the order they were
+		// reverted.
+		RevertedEventsAfter(seq int64, limit int) ([]RevertedEvent, error)
+		// LastRevertedEventSeq returns the sequence number of the most
+		// recently reverted event.
+		LastRevertedEventSeq() (int64, error)
+		// CatchingUp returns true if the store is in catch-up mode.
+		CatchingUp() (bool, error)
+		// SetCatchingUp enables or disables catch-up mode. While
+		// catching up, the store defers secondary indexes, such as event
+		// categories and enrichments, and builds them when catch-up mode
+		// is disabled.
+		SetCatchingUp(bool) error
 		AnnotateV1Events(index types.ChainIndex, timestamp time.Time, v1 []types.Transaction) (annotated []Event, err error)
 
 		SiacoinElement(types.SiacoinOutputID) (types.SiacoinElement, error)
@@ -82,20 +228,92 @@ type (
 
 		SetIndexMode(IndexMode) error
 		LastCommittedIndex() (types.ChainIndex, error)
+		// WalletStateRoot returns the last committed index and the state
+		// root of the wallet addresses at that index.
+		WalletStateRoot() (types.ChainIndex, types.Hash256, error)
+
+		// WalletType returns the type of a wallet.
+		WalletType(ID) (string, error)
+		AddWithdrawalProposal(WithdrawalProposal) (WithdrawalProposal, error)
+		WithdrawalProposal(walletID ID, id int64) (WithdrawalProposal, error)
+		WithdrawalProposals(walletID ID, offset, limit int) ([]WithdrawalProposal, error)
+		// UpdateWithdrawalProposal changes the status of a pending
+		// proposal. If signed is not nil, it replaces the proposal's
+		// transaction.
+		UpdateWithdrawalProposal(walletID ID, id int64, status string, signed *types.V2Transaction) (WithdrawalProposal, error)
+		// PendingProposalInputs returns the IDs of the outputs spent by the
+		// wallet's pending withdrawal proposals.
+		PendingProposalInputs(walletID ID) ([]types.SiacoinOutputID, error)
+	}
+
+	// An EventBroadcaster notifies webhooks of confirmed and reverted
+	// wallet events and of balance alarms.
+	EventBroadcaster interface {
+		BroadcastEvent(scope, event string, data any) error
+	}
+
+	// An EventNotification is broadcast when a wallet event is confirmed
+	// or reverted. Event IDs are derived from the chain data, so they are
+	// stable across restarts and reorgs. Notifications are delivered at
+	// least once; receivers should deduplicate them by event ID and
+	// Reverted.
+	EventNotification struct {
+		WalletID ID    `json:"walletID"`
+		Event    Event `json:"event"`
+		// Reverted is true if a reorg removed the event from the chain.
+		// The event keeps the index it was previously confirmed at.
+		Reverted bool `json:"reverted,omitempty"`
+		// ReplacedBy is the index of the block that replaced the reverted
+		// event's block, if the chain has reached its height again.
+		ReplacedBy *types.ChainIndex `json:"replacedBy,omitempty"`
+		// Counterparties are the event's counterparties, resolved when
+		// the event was applied.
+		Counterparties []Counterparty `json:"counterparties,omitempty"`
 	}
 
 	// A Manager manages wallets.
 	Manager struct {
-		indexMode     IndexMode
-		syncBatchSize int
-
-		chain ChainManager
-		store Store
-		log   *zap.Logger
-		tg    *threadgroup.ThreadGroup
+		indexMode       IndexMode
+		syncBatchSize   int
+		maxReorgDepth   uint64
+		ingestQueueSize int
+		// catchUpThreshold is the number of blocks the store must be
+		// behind the tip to enter catch-up mode. Zero disables catch-up
+		// mode.
+		catchUpThreshold uint64
+
+		chain  ChainManager
+		store  Store
+		events EventBroadcaster
+		alerts Alerter
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+		// lookup labels counterparties with their known label and
+		// category
+		lookup func(types.Address) (label, category string, ok bool)
+
+		// ingest is the queue of jobs for the writer goroutine, which
+		// applies chain updates to the store.
+		ingest chan ingestJob
+
+		// revertedSeq is the sequence number of the last reverted event
+		// broadcast. It is only accessed by the writer goroutine.
+		revertedSeq int64
 
 		mu   sync.Mutex // protects the fields below
 		used map[types.Hash256]bool
+		// applied is the last index the writer committed to the store.
+		applied types.ChainIndex
+		// applying is true while the writer is applying a job.
+		applying bool
+		// pendingReorg is the reorg waiting for approval, if any.
+		pendingReorg *PendingReorg
+		// approvedDepth is the depth of the last approved reorg. It is
+		// reset once the store has synced.
+		approvedDepth uint64
+		// catchingUp is true while the store is in catch-up mode. It is
+		// only written by the writer goroutine.
+		catchingUp bool
 	}
 )
 
@@ -140,11 +358,21 @@ func (m *Manager) Tip() (types.ChainIndex, error) {
 
 // AddWallet adds the given wallet.
 func (m *Manager) AddWallet(w Wallet) (Wallet, error) {
+	if err := validateWalletType(w.Type); err != nil {
+		return Wallet{}, err
+	}
 	return m.store.AddWallet(w)
 }
 
-// UpdateWallet updates the given wallet.
+// UpdateWallet updates the given wallet. If the wallet has a metadata
+// schema, the new metadata must match it.
 func (m *Manager) UpdateWallet(w Wallet) (Wallet, error) {
+	schema, err := m.store.WalletMetadataSchema(w.ID)
+	if err != nil {
+		return Wallet{}, err
+	} else if err := validateMetadata(schema, w.Metadata); err != nil {
+		return Wallet{}, err
+	}
 	return m.store.UpdateWallet(w)
 }
 
@@ -158,8 +386,46 @@ func (m *Manager) Wallets() ([]Wallet, error) {
 	return m.store.Wallets()
 }
 
-// AddAddress adds the given address to the given wallet.
+// TenantWallets returns the wallets owned by the given tenant.
+func (m *Manager) TenantWallets(tenant string) ([]Wallet, error) {
+	return m.store.TenantWallets(tenant)
+}
+
+// WalletTenant returns the tenant that owns the given wallet.
+func (m *Manager) WalletTenant(id ID) (string, error) {
+	return m.store.WalletTenant(id)
+}
+
+// TenantHasAddress returns true if the address belongs to any of the given
+// tenant's wallets.
+func (m *Manager) TenantHasAddress(tenant string, address types.Address) (bool, error) {
+	return m.store.TenantHasAddress(tenant, address)
+}
+
+// TenantHasEvent returns true if the event is relevant to any of the given
+// tenant's wallets.
+func (m *Manager) TenantHasEvent(tenant string, eventID types.Hash256) (bool, error) {
+	return m.store.TenantHasEvent(tenant, eventID)
+}
+
+// TenantUsage returns the number of wallets and addresses owned by each
+// tenant.
+func (m *Manager) TenantUsage() ([]TenantUsage, error) {
+	return m.store.TenantUsage()
+}
+
+// AddAddress adds the given address to the given wallet. Adding an address
+// that is already in the wallet updates its metadata.
 func (m *Manager) AddAddress(walletID ID, addr Address) error {
+	_, err := m.store.AddWalletAddress(walletID, addr)
+	return err
+}
+
+// AddAddressWithResult adds the given address to the given wallet, like
+// AddAddress. Addresses can be in more than one wallet; the result reports
+// whether the address was already in the wallet and lists the other wallets
+// that contain it.
+func (m *Manager) AddAddressWithResult(walletID ID, addr Address) (AddAddressResult, error) {
 	return m.store.AddWalletAddress(walletID, addr)
 }
 
@@ -174,8 +440,8 @@ func (m *Manager) Addresses(walletID ID) ([]Address, error) {
 }
 
 // WalletEvents returns the events of the given wallet.
-func (m *Manager) WalletEvents(walletID ID, offset, limit int) ([]Event, error) {
-	return m.store.WalletEvents(walletID, offset, limit)
+func (m *Manager) WalletEvents(ctx context.Context, walletID ID, offset, limit int) ([]Event, error) {
+	return m.store.WalletEvents(ctx, walletID, offset, limit)
 }
 
 // UnspentSiacoinOutputs returns a paginated list of matured siacoin outputs
@@ -184,6 +450,12 @@ func (m *Manager) UnspentSiacoinOutputs(walletID ID, offset, limit int) ([]types
 	return m.store.WalletSiacoinOutputs(walletID, m.chain.Tip(), offset, limit)
 }
 
+// ImmatureSiacoinOutputs returns the wallet's unspent siacoin outputs that
+// have not matured, ordered by maturity height.
+func (m *Manager) ImmatureSiacoinOutputs(walletID ID) ([]types.SiacoinElement, error) {
+	return m.store.WalletImmatureSiacoinOutputs(walletID, m.chain.Tip())
+}
+
 // UnspentSiafundOutputs returns a paginated list of siafund outputs relevant to
 // the wallet
 func (m *Manager) UnspentSiafundOutputs(walletID ID, offset, limit int) ([]types.SiafundElement, error) {
@@ -198,6 +470,29 @@ func (m *Manager) WalletUnconfirmedEvents(walletID ID) ([]Event, error) {
 	return m.store.WalletUnconfirmedEvents(walletID, index, time.Now(), m.chain.PoolTransactions(), m.chain.V2PoolTransactions())
 }
 
+// WalletOutflow returns the net amount of siacoins sent from the wallet's
+// addresses by the transaction set. Siacoins sent back to the wallet, e.g.
+// change outputs, are subtracted from the outflow.
+func (m *Manager) WalletOutflow(walletID ID, txns []types.Transaction, v2txns []types.V2Transaction) (types.Currency, error) {
+	index := m.chain.Tip()
+	index.Height++
+	index.ID = types.BlockID{}
+	events, err := m.store.WalletUnconfirmedEvents(walletID, index, time.Now(), txns, v2txns)
+	if err != nil {
+		return types.ZeroCurrency, err
+	}
+
+	var inflow, outflow types.Currency
+	for _, event := range events {
+		inflow = inflow.Add(event.SiacoinInflow())
+		outflow = outflow.Add(event.SiacoinOutflow())
+	}
+	if outflow.Cmp(inflow) <= 0 {
+		return types.ZeroCurrency, nil
+	}
+	return outflow.Sub(inflow), nil
+}
+
 // WalletBalance returns the balance of the given wallet.
 func (m *Manager) WalletBalance(walletID ID) (Balance, error) {
 	return m.store.WalletBalance(walletID)
@@ -263,8 +558,19 @@ func (m *Manager) Reserve(ids []types.Hash256, duration time.Duration) error {
 	return nil
 }
 
-// Scan rescans the chain starting from the given index. The scan will complete
-// when the chain manager reaches the current tip or the context is canceled.
+// Release releases outputs reserved by Reserve before their reservation
+// expires.
+func (m *Manager) Release(ids []types.Hash256) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.used, id)
+	}
+}
+
+// Scan rescans the chain starting from the given index. The scan is queued
+// behind pending chain updates and will complete when the chain manager
+// reaches the current tip or the context is canceled.
 func (m *Manager) Scan(ctx context.Context, index types.ChainIndex) error {
 	if m.indexMode != IndexModePersonal {
 		return fmt.Errorf("scans are disabled in index mode %s", m.indexMode)
@@ -276,9 +582,18 @@ func (m *Manager) Scan(ctx context.Context, index types.ChainIndex) error {
 	}
 	defer cancel()
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	return syncStore(ctx, m.store, m.chain, index, m.syncBatchSize)
+	job := ingestJob{scan: &index, ctx: ctx, done: make(chan error, 1)}
+	select {
+	case m.ingest <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-job.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // IndexMode returns the index mode of the wallet manager.
@@ -296,24 +611,138 @@ func (m *Manager) SiafundElement(id types.SiafundOutputID) (types.SiafundElement
 	return m.store.SiafundElement(id)
 }
 
+// resolveEvents resolves and stores the counterparties of the events applied
+// since they were last resolved, then broadcasts the events with their
+// counterparties, oldest first. Counterparties keep the labels their
+// addresses had when the event was applied. Events are marked resolved once
+// they are broadcast to each of their wallets, so events that fail to
+// broadcast are retried after the next sync.
+func (m *Manager) resolveEvents() error {
+	for {
+		unresolved, err := m.store.UnresolvedEvents(maxBroadcastEvents)
+		if err != nil {
+			return fmt.Errorf("failed to get unresolved events: %w", err)
+		} else if len(unresolved) == 0 {
+			return nil
+		}
+
+		// resolve each wallet's events together
+		walletEvents := make(map[ID][]Event)
+		for _, ue := range unresolved {
+			for id, relevant := range ue.Wallets {
+				ev := ue.Event
+				ev.Relevant = relevant
+				walletEvents[id] = append(walletEvents[id], ev)
+			}
+		}
+		annotated := make(map[ID]map[types.Hash256]AnnotatedEvent, len(walletEvents))
+		for id, events := range walletEvents {
+			resolved, err := m.resolveCounterparties(id, events)
+			if err != nil {
+				return err
+			}
+			annotated[id] = resolved
+		}
+
+		var broadcastErr error
+		seqs := make([]int64, 0, len(unresolved))
+		for _, ue := range unresolved {
+			if broadcastErr = m.broadcastResolved(ue, annotated); broadcastErr != nil {
+				break
+			}
+			seqs = append(seqs, ue.Seq)
+		}
+		if err := m.store.MarkEventsResolved(seqs); err != nil {
+			return fmt.Errorf("failed to mark events resolved: %w", err)
+		} else if broadcastErr != nil {
+			return broadcastErr
+		}
+	}
+}
+
+// broadcastResolved broadcasts a resolved event to each of its wallets.
+func (m *Manager) broadcastResolved(ue UnresolvedEvent, annotated map[ID]map[types.Hash256]AnnotatedEvent) error {
+	if m.events == nil {
+		return nil
+	}
+	ids := make([]ID, 0, len(ue.Wallets))
+	for id := range ue.Wallets {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		ae := annotated[id][ue.Event.ID]
+		if err := m.events.BroadcastEvent(ScopeWallets, ae.Type, EventNotification{WalletID: id, Event: ae.Event, Counterparties: ae.Counterparties}); err != nil {
+			return fmt.Errorf("failed to broadcast event %v: %w", ae.ID, err)
+		}
+	}
+	return nil
+}
+
+// resolveCounterparties annotates the wallet's events with their
+// counterparties and stores them.
+func (m *Manager) resolveCounterparties(walletID ID, events []Event) (map[types.Hash256]AnnotatedEvent, error) {
+	annotated := AnnotateEvents(events, m.lookup)
+	var addrs []types.Address
+	for _, ae := range annotated {
+		for _, cp := range ae.Counterparties {
+			addrs = append(addrs, cp.Address)
+		}
+	}
+	owners, err := m.store.AddressWallets(addrs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address wallets: %w", err)
+	}
+	MarkInternal(annotated, owners)
+
+	resolved := make(map[types.Hash256]AnnotatedEvent, len(annotated))
+	counterparties := make(map[types.Hash256][]Counterparty, len(annotated))
+	for _, ae := range annotated {
+		resolved[ae.ID] = ae
+		counterparties[ae.ID] = ae.Counterparties
+	}
+	if err := m.store.AddEventCounterparties(walletID, counterparties); err != nil {
+		return nil, fmt.Errorf("failed to store counterparties of wallet %v: %w", walletID, err)
+	}
+	return resolved, nil
+}
+
+// WalletEventCounterparties returns the counterparties of the wallet's
+// events that were resolved when the events were applied. Events applied
+// before their counterparties were stored, or that have not been resolved
+// yet, are omitted.
+func (m *Manager) WalletEventCounterparties(walletID ID, eventIDs []types.Hash256) (map[types.Hash256][]Counterparty, error) {
+	return m.store.EventCounterparties(walletID, eventIDs)
+}
+
 // Close closes the wallet manager.
 func (m *Manager) Close() error {
 	m.tg.Stop()
 	return nil
 }
 
-func syncStore(ctx context.Context, store Store, cm ChainManager, index types.ChainIndex, batchSize int) error {
-	for index != cm.Tip() {
+// syncStore applies chain updates to the store from index until it reaches
+// the chain manager's tip. applied is called with the store's index after
+// each batch.
+func syncStore(ctx context.Context, store Store, cm ChainManager, index types.ChainIndex, batchSize int, applied func(types.ChainIndex)) error {
+	_, err := syncStoreWhile(ctx, store, cm, index, batchSize, applied, func(types.ChainIndex) bool { return true })
+	return err
+}
+
+// syncStoreWhile is like syncStore, but stops once cond returns false for the
+// last applied index. It returns the last applied index.
+func syncStoreWhile(ctx context.Context, store Store, cm ChainManager, index types.ChainIndex, batchSize int, applied func(types.ChainIndex), cond func(types.ChainIndex) bool) (types.ChainIndex, error) {
+	for index != cm.Tip() && cond(index) {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return index, ctx.Err()
 		default:
 		}
 		crus, caus, err := cm.UpdatesSince(index, batchSize)
 		if err != nil {
-			return fmt.Errorf("failed to subscribe to chain manager: %w", err)
+			return index, fmt.Errorf("failed to subscribe to chain manager: %w", err)
 		} else if err := store.UpdateChainState(crus, caus); err != nil {
-			return fmt.Errorf("failed to update chain state: %w", err)
+			return index, fmt.Errorf("failed to update chain state: %w", err)
 		}
 
 		switch {
@@ -322,8 +751,9 @@ func syncStore(ctx context.Context, store Store, cm ChainManager, index types.Ch
 		case len(crus) > 0:
 			index = crus[len(crus)-1].State.Index
 		}
+		applied(index)
 	}
-	return nil
+	return index, nil
 }
 
 // NewManager creates a new wallet manager.
@@ -336,11 +766,14 @@ func NewManager(cm ChainManager, store Store, opts ...Option) (*Manager, error)
 		store: store,
 		log:   zap.NewNop(),
 		tg:    threadgroup.New(),
+
+		ingestQueueSize: defaultIngestQueueSize,
 	}
 
 	for _, opt := range opts {
 		opt(m)
 	}
+	m.ingest = make(chan ingestJob, m.ingestQueueSize)
 
 	// if the index mode is none, skip setting the index mode in the store
 	// and return the manager
@@ -350,43 +783,31 @@ func NewManager(cm ChainManager, store Store, opts ...Option) (*Manager, error)
 		return nil, err
 	}
 
-	// start a goroutine to sync the store with the chain manager
-	reorgChan := make(chan struct{}, 1)
-	reorgChan <- struct{}{}
-	unsubscribe := cm.OnReorg(func(index types.ChainIndex) {
-		select {
-		case reorgChan <- struct{}{}:
-		default:
-		}
-	})
+	// only events reverted after startup are broadcast
+	seq, err := store.LastRevertedEventSeq()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last reverted event: %w", err)
+	}
+	m.revertedSeq = seq
 
-	go func() {
-		defer unsubscribe()
+	// resume catch-up mode if walletd stopped before it ended
+	catchingUp, err := store.CatchingUp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get catch-up mode: %w", err)
+	}
+	m.catchingUp = catchingUp
 
-		log := m.log.Named("sync")
-		ctx, cancel, err := m.tg.AddWithContext(context.Background())
-		if err != nil {
-			log.Panic("failed to add to threadgroup", zap.Error(err))
-		}
+	// start the writer goroutine and queue an initial sync
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to add to threadgroup: %w", err)
+	}
+	m.queueSync()
+	unsubscribe := cm.OnReorg(func(types.ChainIndex) { m.queueSync() })
+	go func() {
 		defer cancel()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-reorgChan:
-			}
-
-			m.mu.Lock()
-			// update the store
-			lastTip, err := store.LastCommittedIndex()
-			if err != nil {
-				log.Panic("failed to get last committed index", zap.Error(err))
-			} else if err := syncStore(ctx, store, cm, lastTip, m.syncBatchSize); err != nil && !errors.Is(err, context.Canceled) {
-				log.Panic("failed to sync store", zap.Error(err))
-			}
-			m.mu.Unlock()
-		}
+		defer unsubscribe()
+		m.runWriter(ctx)
 	}()
 	return m, nil
 }
@@ -0,0 +1,99 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.thebigfile.com/walletd/internal/jsonschema"
+)
+
+// ErrInvalidSchema is returned when a metadata schema cannot be parsed.
+var ErrInvalidSchema = errors.New("invalid metadata schema")
+
+type (
+	// A MetadataError describes a value in a wallet's metadata that does
+	// not match the wallet's schema.
+	MetadataError struct {
+		// Path is a JSON pointer to the invalid value, e.g. "/owner/email".
+		Path    string `json:"path"`
+		Message string `json:"message"`
+	}
+
+	// A MetadataValidationError is returned when metadata does not match
+	// its schema.
+	MetadataValidationError struct {
+		Errors []MetadataError `json:"errors"`
+	}
+)
+
+// Error implements error.
+func (e *MetadataValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, me := range e.Errors {
+		if me.Path == "" {
+			msgs = append(msgs, me.Message)
+		} else {
+			msgs = append(msgs, me.Path+": "+me.Message)
+		}
+	}
+	return "metadata does not match schema: " + strings.Join(msgs, "; ")
+}
+
+// isNull returns true if the JSON value is empty or null.
+func isNull(v json.RawMessage) bool {
+	return len(v) == 0 || string(v) == "null"
+}
+
+// compileSchema parses a metadata schema. A nil schema is returned if the
+// schema is empty or null.
+func compileSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	if isNull(schema) {
+		return nil, nil
+	}
+	s, err := jsonschema.Compile(schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	return s, nil
+}
+
+// validateMetadata returns a *MetadataValidationError if the metadata does
+// not match the schema. Empty metadata is validated as null.
+func validateMetadata(schema, metadata json.RawMessage) error {
+	s, err := compileSchema(schema)
+	if err != nil || s == nil {
+		return err
+	}
+	if len(metadata) == 0 {
+		metadata = json.RawMessage("null")
+	}
+	errs := s.Validate(metadata)
+	if len(errs) == 0 {
+		return nil
+	}
+	ve := &MetadataValidationError{Errors: make([]MetadataError, 0, len(errs))}
+	for _, err := range errs {
+		ve.Errors = append(ve.Errors, MetadataError{Path: err.Path, Message: err.Message})
+	}
+	return ve
+}
+
+// WalletMetadataSchema returns the JSON schema that a wallet's metadata must
+// match, or nil if the wallet does not have one.
+func (m *Manager) WalletMetadataSchema(id ID) (json.RawMessage, error) {
+	return m.store.WalletMetadataSchema(id)
+}
+
+// SetWalletMetadataSchema sets the JSON schema that a wallet's metadata must
+// match when the wallet is updated. A null schema removes the wallet's
+// schema.
+func (m *Manager) SetWalletMetadataSchema(id ID, schema json.RawMessage) error {
+	if _, err := compileSchema(schema); err != nil {
+		return err
+	} else if isNull(schema) {
+		schema = nil
+	}
+	return m.store.SetWalletMetadataSchema(id, schema)
+}
@@ -1,6 +1,9 @@
 package wallet
 
-import "go.uber.org/zap"
+import (
+	"go.thebigfile.com/core/types"
+	"go.uber.org/zap"
+)
 
 // An Option configures a wallet Manager.
 type Option func(*Manager)
@@ -27,3 +30,60 @@ func WithSyncBatchSize(size int) Option {
 		m.syncBatchSize = size
 	}
 }
+
+// WithIngestQueueSize sets the number of chain update jobs that can wait for
+// the writer goroutine. Updates received while the queue is full are
+// coalesced into the queued jobs. The default is 64.
+func WithIngestQueueSize(size int) Option {
+	return func(m *Manager) {
+		if size > 0 {
+			m.ingestQueueSize = size
+		}
+	}
+}
+
+// WithCatchUpThreshold sets the number of blocks the store must be behind
+// the tip for the manager to sync it in catch-up mode. While catching up,
+// newly confirmed events are not broadcast and the store defers secondary
+// indexes until it is within the threshold of the tip. A threshold of zero,
+// the default, disables catch-up mode.
+func WithCatchUpThreshold(blocks uint64) Option {
+	return func(m *Manager) {
+		m.catchUpThreshold = blocks
+	}
+}
+
+// WithEventBroadcaster sets the broadcaster used to send newly confirmed
+// wallet events to webhooks.
+func WithEventBroadcaster(eb EventBroadcaster) Option {
+	return func(m *Manager) {
+		m.events = eb
+	}
+}
+
+// WithCounterpartyLookup sets the function used to label the counterparties
+// of new events with their known label and category when the events are
+// applied.
+func WithCounterpartyLookup(lookup func(types.Address) (label, category string, ok bool)) Option {
+	return func(m *Manager) {
+		m.lookup = lookup
+	}
+}
+
+// WithAlerter sets the alerter used to raise balance alarm alerts.
+func WithAlerter(alerter Alerter) Option {
+	return func(m *Manager) {
+		m.alerts = alerter
+	}
+}
+
+// WithMaxReorgDepth sets the maximum number of blocks a reorg can revert
+// before the manager pauses syncing until the reorg is approved with
+// ApproveReorg. Alerts are raised with the alerter, which may be nil. A
+// depth of zero disables the limit.
+func WithMaxReorgDepth(depth uint64, alerter Alerter) Option {
+	return func(m *Manager) {
+		m.maxReorgDepth = depth
+		m.alerts = alerter
+	}
+}
@@ -0,0 +1,168 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+)
+
+// consolidationThreshold is the number of unspent outputs above which
+// consolidation is suggested.
+const consolidationThreshold = 100
+
+type (
+	// A PrivacyMetric measures how often a wallet exhibits a behavior that
+	// links its addresses. Score ranges from 0 (always) to 100 (never).
+	PrivacyMetric struct {
+		Total   int `json:"total"`
+		Flagged int `json:"flagged"`
+		Score   int `json:"score"`
+	}
+
+	// A PrivacyReport scores how much a wallet's on-chain history reveals
+	// about which addresses belong to it.
+	PrivacyReport struct {
+		// Score is the average of the metric scores.
+		Score int `json:"score"`
+		// AddressReuse counts the addresses that received funds in more
+		// than one event.
+		AddressReuse PrivacyMetric `json:"addressReuse"`
+		// ChangeLinkage counts the outgoing transactions that returned
+		// change to an address they spent from.
+		ChangeLinkage PrivacyMetric `json:"changeLinkage"`
+		// UTXOMerging counts the outgoing transactions that spent outputs
+		// from more than one of the wallet's addresses.
+		UTXOMerging PrivacyMetric `json:"utxoMerging"`
+
+		UnspentOutputs int      `json:"unspentOutputs"`
+		Suggestions    []string `json:"suggestions"`
+	}
+)
+
+// newPrivacyMetric returns a metric with its score computed.
+func newPrivacyMetric(total, flagged int) PrivacyMetric {
+	score := 100
+	if total > 0 {
+		score = 100 - (100*flagged)/total
+	}
+	return PrivacyMetric{Total: total, Flagged: flagged, Score: score}
+}
+
+// AnalyzePrivacy scores a wallet's privacy from its events and unspent
+// siacoin outputs. Addresses in each event's relevant set are treated as
+// belonging to the wallet.
+func AnalyzePrivacy(events []Event, outputs []types.SiacoinElement) PrivacyReport {
+	receipts := make(map[types.Address]int)
+	var outgoing, linked, merged int
+	for _, ev := range events {
+		owned := make(map[types.Address]bool, len(ev.Relevant))
+		for _, addr := range ev.Relevant {
+			owned[addr] = true
+		}
+
+		inputs, outs, ok := transactionFlows(ev)
+		if !ok {
+			// payouts and contract resolutions only receive funds
+			switch data := ev.Data.(type) {
+			case EventPayout:
+				outs = []types.SiacoinOutput{data.SiacoinElement.SiacoinOutput}
+			case EventV1ContractResolution:
+				outs = []types.SiacoinOutput{data.SiacoinElement.SiacoinOutput}
+			case EventV2ContractResolution:
+				outs = []types.SiacoinOutput{data.SiacoinElement.SiacoinOutput}
+			}
+		}
+
+		spent := make(map[types.Address]bool)
+		for _, sco := range inputs {
+			if owned[sco.Address] {
+				spent[sco.Address] = true
+			}
+		}
+		received := make(map[types.Address]bool)
+		var change bool
+		for _, sco := range outs {
+			switch {
+			case !owned[sco.Address]:
+			case spent[sco.Address]:
+				change = true
+			default:
+				received[sco.Address] = true
+			}
+		}
+		for addr := range received {
+			receipts[addr]++
+		}
+
+		if len(spent) > 0 {
+			outgoing++
+			if change {
+				linked++
+			}
+			if len(spent) > 1 {
+				merged++
+			}
+		}
+	}
+
+	var reused int
+	for _, n := range receipts {
+		if n > 1 {
+			reused++
+		}
+	}
+
+	report := PrivacyReport{
+		AddressReuse:   newPrivacyMetric(len(receipts), reused),
+		ChangeLinkage:  newPrivacyMetric(outgoing, linked),
+		UTXOMerging:    newPrivacyMetric(outgoing, merged),
+		UnspentOutputs: len(outputs),
+		Suggestions:    []string{},
+	}
+	report.Score = (report.AddressReuse.Score + report.ChangeLinkage.Score + report.UTXOMerging.Score) / 3
+
+	if reused > 0 {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d addresses received funds more than once; rotate to a new address for each incoming payment", reused))
+	}
+	if linked > 0 {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d transactions returned change to an address they spent from; send change to a new address", linked))
+	}
+	if merged > 0 {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("%d transactions spent outputs from multiple addresses; fund payments from a single address where possible", merged))
+	}
+	if len(outputs) > consolidationThreshold {
+		report.Suggestions = append(report.Suggestions, fmt.Sprintf("the wallet has %d unspent outputs; consolidate them while fees are low, one address at a time to avoid linking addresses", len(outputs)))
+	}
+	return report
+}
+
+// PrivacyReport scores the privacy of the given wallet's history.
+func (m *Manager) PrivacyReport(ctx context.Context, walletID ID) (PrivacyReport, error) {
+	const batchSize = 1000
+
+	var events []Event
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.store.WalletEvents(ctx, walletID, offset, batchSize)
+		if err != nil {
+			return PrivacyReport{}, fmt.Errorf("failed to get events: %w", err)
+		}
+		events = append(events, batch...)
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	var outputs []types.SiacoinElement
+	for offset := 0; ; offset += batchSize {
+		batch, err := m.UnspentSiacoinOutputs(walletID, offset, batchSize)
+		if err != nil {
+			return PrivacyReport{}, fmt.Errorf("failed to get unspent outputs: %w", err)
+		}
+		outputs = append(outputs, batch...)
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	return AnalyzePrivacy(events, outputs), nil
+}
@@ -0,0 +1,131 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/alerts"
+	"go.uber.org/zap"
+)
+
+// alertReorgID is the ID of the alert raised when a reorg is paused.
+var alertReorgID = types.HashBytes([]byte("wallet/reorg"))
+
+// ErrNoPendingReorg is returned when approving a reorg while none is
+// waiting for approval.
+var ErrNoPendingReorg = errors.New("no reorg is waiting for approval")
+
+type (
+	// An Alerter registers and dismisses alerts.
+	Alerter interface {
+		Register(alerts.Alert)
+		Dismiss(...types.Hash256)
+	}
+
+	// A PendingReorg is a reorg deeper than the maximum reorg depth that is
+	// waiting for operator approval.
+	PendingReorg struct {
+		// From is the last index applied to the store.
+		From types.ChainIndex `json:"from"`
+		// To is the chain manager's tip when the reorg was detected.
+		To types.ChainIndex `json:"to"`
+		// Depth is the number of blocks the reorg reverts.
+		Depth uint64 `json:"depth"`
+	}
+)
+
+// reorgDepth returns the number of blocks that must be reverted to move the
+// store from index to the chain manager's best chain.
+func reorgDepth(cm ChainManager, index types.ChainIndex, batchSize int) (uint64, error) {
+	var depth uint64
+	for {
+		if best, ok := cm.BestIndex(index.Height); ok && best == index {
+			return depth, nil
+		}
+		crus, _, err := cm.UpdatesSince(index, batchSize)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get updates since %v: %w", index, err)
+		} else if len(crus) == 0 {
+			return depth, nil
+		}
+		depth += uint64(len(crus))
+		index = crus[len(crus)-1].State.Index
+	}
+}
+
+// checkReorgDepth returns false if the store should not be synced because
+// the reorg from index is deeper than the maximum reorg depth and has not
+// been approved.
+func (m *Manager) checkReorgDepth(index types.ChainIndex) (bool, error) {
+	if m.maxReorgDepth == 0 {
+		return true, nil
+	}
+	depth, err := reorgDepth(m.chain, index, m.syncBatchSize)
+	if err != nil {
+		return false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if depth <= m.maxReorgDepth || depth <= m.approvedDepth {
+		// the chain may have switched back before the reorg was approved
+		if m.pendingReorg != nil {
+			m.pendingReorg = nil
+			if m.alerts != nil {
+				m.alerts.Dismiss(alertReorgID)
+			}
+		}
+		return true, nil
+	}
+
+	pending := PendingReorg{From: index, To: m.chain.Tip(), Depth: depth}
+	if m.pendingReorg == nil || *m.pendingReorg != pending {
+		m.log.Warn("pausing sync until deep reorg is approved", zap.Stringer("from", pending.From), zap.Stringer("to", pending.To), zap.Uint64("depth", depth))
+	}
+	m.pendingReorg = &pending
+	if m.alerts != nil {
+		m.alerts.Register(alerts.Alert{
+			ID:       alertReorgID,
+			Severity: alerts.SeverityCritical,
+			Message:  fmt.Sprintf("wallet sync paused: reorg of %d blocks exceeds the maximum depth of %d and must be approved", depth, m.maxReorgDepth),
+			Data: map[string]any{
+				"from":     pending.From,
+				"to":       pending.To,
+				"depth":    depth,
+				"maxDepth": m.maxReorgDepth,
+			},
+			Timestamp: time.Now(),
+		})
+	}
+	return false, nil
+}
+
+// PendingReorg returns the reorg waiting for approval, if any.
+func (m *Manager) PendingReorg() (PendingReorg, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pendingReorg == nil {
+		return PendingReorg{}, false
+	}
+	return *m.pendingReorg, true
+}
+
+// ApproveReorg approves the reorg waiting for approval and resumes syncing.
+// The approval also covers shallower reorgs until the store has synced.
+func (m *Manager) ApproveReorg() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pendingReorg == nil {
+		return ErrNoPendingReorg
+	}
+	m.log.Info("deep reorg approved", zap.Stringer("from", m.pendingReorg.From), zap.Stringer("to", m.pendingReorg.To), zap.Uint64("depth", m.pendingReorg.Depth))
+	m.approvedDepth = m.pendingReorg.Depth
+	m.pendingReorg = nil
+	if m.alerts != nil {
+		m.alerts.Dismiss(alertReorgID)
+	}
+	m.queueSync()
+	return nil
+}
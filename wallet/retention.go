@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"go.thebigfile.com/core/types"
+)
+
+// EventRetention determines how much of an event's transaction is stored.
+//
+// EventRetentionFull - Events store their full transaction, which can be
+// retrieved with EventRawTransaction.
+//
+// EventRetentionSummary - Events store their transaction without its
+// signatures, arbitrary data, storage proofs, or attestations. The inputs,
+// outputs, and fees used to summarize the event are kept, but the raw
+// transaction cannot be retrieved.
+const (
+	EventRetentionFull EventRetention = iota
+	EventRetentionSummary
+)
+
+// ErrRawNotRetained is returned when the raw transaction of an event was not
+// stored because the event was indexed with EventRetentionSummary.
+var ErrRawNotRetained = errors.New("raw transaction was not retained")
+
+type (
+	// An EventRetention determines how much of an event's transaction is
+	// stored.
+	EventRetention uint8
+
+	// A RawTransaction is the full transaction of an event. Exactly one of
+	// Transaction and V2Transaction is set.
+	RawTransaction struct {
+		Transaction   *types.Transaction   `json:"transaction,omitempty"`
+		V2Transaction *types.V2Transaction `json:"v2Transaction,omitempty"`
+	}
+)
+
+// String implements fmt.Stringer.
+func (r EventRetention) String() string {
+	switch r {
+	case EventRetentionFull:
+		return "full"
+	case EventRetentionSummary:
+		return "summary"
+	default:
+		return "unknown"
+	}
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (r *EventRetention) UnmarshalText(buf []byte) error {
+	switch string(buf) {
+	case "full":
+		*r = EventRetentionFull
+	case "summary":
+		*r = EventRetentionSummary
+	default:
+		return fmt.Errorf("unknown event retention %q", buf)
+	}
+	return nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (r EventRetention) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// SummarizeEvent returns a copy of the event without the parts of its
+// transaction that are not retained by EventRetentionSummary. The second
+// return value is false if the event has no transaction.
+func SummarizeEvent(ev Event) (Event, bool) {
+	switch data := ev.Data.(type) {
+	case EventV1Transaction:
+		txn := data.Transaction
+		txn.StorageProofs = nil
+		txn.ArbitraryData = nil
+		txn.Signatures = nil
+		data.Transaction = txn
+		ev.Data = data
+	case EventV2Transaction:
+		txn := types.V2Transaction(data)
+		txn.SiacoinInputs = append([]types.V2SiacoinInput(nil), txn.SiacoinInputs...)
+		for i := range txn.SiacoinInputs {
+			txn.SiacoinInputs[i].SatisfiedPolicy.Signatures = nil
+			txn.SiacoinInputs[i].SatisfiedPolicy.Preimages = nil
+		}
+		txn.SiafundInputs = append([]types.V2SiafundInput(nil), txn.SiafundInputs...)
+		for i := range txn.SiafundInputs {
+			txn.SiafundInputs[i].SatisfiedPolicy.Signatures = nil
+			txn.SiafundInputs[i].SatisfiedPolicy.Preimages = nil
+		}
+		txn.Attestations = nil
+		txn.ArbitraryData = nil
+		ev.Data = EventV2Transaction(txn)
+	default:
+		return ev, false
+	}
+	return ev, true
+}
+
+// EventRawTransaction returns the full transaction of an event. It returns
+// ErrRawNotRetained if only a summary of the event was stored.
+func (m *Manager) EventRawTransaction(id types.Hash256) (RawTransaction, error) {
+	return m.store.EventRawTransaction(id)
+}
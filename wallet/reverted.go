@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.thebigfile.com/core/types"
+)
+
+// A RevertedEvent is an event that was removed from the chain by a reorg.
+// The event keeps the ID and chain index it was reported with. If its
+// transaction is confirmed again, the event is re-reported with the same ID
+// and its new index.
+type RevertedEvent struct {
+	// Seq increases with each reverted event.
+	Seq          int64
+	Event        Event
+	WalletIDs    []ID
+	DateReverted time.Time
+}
+
+// A FeedEvent is an entry in a wallet's event feed. In addition to the
+// wallet's confirmed events, the feed contains an entry for each event a
+// reorg removed from the chain, so accounting systems can post compensating
+// entries.
+type FeedEvent struct {
+	Event Event
+	// Reverted is true if the entry records the removal of the event. The
+	// event keeps the index it was previously confirmed at.
+	Reverted bool
+	// ReplacedBy is the index of the block that replaced the reverted
+	// event's block. It is nil if the chain has not reached the event's
+	// height again.
+	ReplacedBy *types.ChainIndex
+}
+
+// replacedBy returns the index of the block that replaced index on the best
+// chain, or nil if there is none.
+func (m *Manager) replacedBy(index types.ChainIndex) *types.ChainIndex {
+	best, ok := m.chain.BestIndex(index.Height)
+	if !ok || best == index {
+		return nil
+	}
+	return &best
+}
+
+// Event returns the event with the given ID. If the event was removed from
+// the chain by a reorg, Reverted is set and the event has the index it was
+// previously confirmed at.
+func (m *Manager) Event(id types.Hash256) (FeedEvent, error) {
+	events, err := m.store.Events([]types.Hash256{id})
+	if err != nil {
+		return FeedEvent{}, err
+	} else if len(events) > 0 {
+		return FeedEvent{Event: events[0]}, nil
+	}
+
+	events, err = m.store.RevertedEvents([]types.Hash256{id})
+	if err != nil {
+		return FeedEvent{}, fmt.Errorf("failed to get reverted events: %w", err)
+	} else if len(events) == 0 {
+		return FeedEvent{}, ErrNotFound
+	}
+	return FeedEvent{Event: events[0], Reverted: true, ReplacedBy: m.replacedBy(events[0].Index)}, nil
+}
+
+// WalletEventFeed returns the wallet's event feed, newest first. Unlike
+// WalletEvents, the feed includes the events removed from the chain by
+// reorgs.
+func (m *Manager) WalletEventFeed(ctx context.Context, walletID ID, offset, limit int) ([]FeedEvent, error) {
+	return m.store.WalletEventFeed(ctx, walletID, offset, limit)
+}
+
+// broadcastRevertedEvents broadcasts the events reverted since the last
+// broadcast to each wallet they were reported to.
+func (m *Manager) broadcastRevertedEvents() error {
+	for {
+		reverted, err := m.store.RevertedEventsAfter(m.revertedSeq, maxBroadcastEvents)
+		if err != nil {
+			return fmt.Errorf("failed to get reverted events: %w", err)
+		} else if len(reverted) == 0 {
+			return nil
+		}
+		for _, re := range reverted {
+			replacedBy := m.replacedBy(re.Event.Index)
+			for _, id := range re.WalletIDs {
+				if err := m.events.BroadcastEvent(ScopeWallets, re.Event.Type, EventNotification{WalletID: id, Event: re.Event, Reverted: true, ReplacedBy: replacedBy}); err != nil {
+					return fmt.Errorf("failed to broadcast reverted event %v: %w", re.Event.ID, err)
+				}
+			}
+			m.revertedSeq = re.Seq
+		}
+	}
+}
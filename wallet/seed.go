@@ -1,14 +1,18 @@
 package wallet
 
 import (
+	"context"
 	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"go.thebigfile.com/core/consensus"
 	"go.thebigfile.com/core/types"
 	"go.thebigfile.com/coreutils/wallet"
+	"go.thebigfile.com/walletd/internal/threadgroup"
 	"lukechampine.com/frand"
 )
 
@@ -31,6 +35,13 @@ func (s Seed) PrivateKey(index uint64) types.PrivateKey {
 	return key[:]
 }
 
+// Fingerprint returns an identifier of the seed that does not reveal its
+// keys.
+func (s Seed) Fingerprint() types.Hash256 {
+	pk := s.PublicKey(0)
+	return types.HashBytes(append([]byte("walletd/seed/fingerprint/"), pk[:]...))
+}
+
 // NewSeed returns a random Seed.
 func NewSeed() Seed {
 	var entropy [32]byte
@@ -43,12 +54,77 @@ func NewSeedFromEntropy(entropy *[32]byte) Seed {
 	return Seed{entropy}
 }
 
+// ErrVaultIndexIssued is returned by a VaultStore when an address index
+// was already issued.
+var ErrVaultIndexIssued = errors.New("address index already issued")
+
+type (
+	// An IssuedAddress is an address issued by a SeedAddressVault.
+	IssuedAddress struct {
+		Index       uint64        `json:"index"`
+		Address     types.Address `json:"address"`
+		Description string        `json:"description"`
+		DateIssued  time.Time     `json:"dateIssued"`
+	}
+
+	// VaultState is the persisted state of a SeedAddressVault.
+	VaultState struct {
+		Fingerprint types.Hash256 `json:"fingerprint"`
+		NextIndex   uint64        `json:"nextIndex"`
+		// WalletID is the wallet the vault registers its lookahead
+		// addresses with. It is zero if the vault is not watching a
+		// wallet.
+		WalletID ID `json:"walletID"`
+		// Lookahead is the number of addresses beyond the last issued or
+		// used address registered with the wallet.
+		Lookahead uint64 `json:"lookahead"`
+		// Registered is the number of addresses, starting from index 0,
+		// registered with the wallet.
+		Registered  uint64          `json:"registered"`
+		Issued      []IssuedAddress `json:"issued"`
+		DateCreated time.Time       `json:"dateCreated"`
+	}
+
+	// A VaultWallet registers a vault's addresses with a wallet and reports
+	// whether they have been used.
+	VaultWallet interface {
+		AddAddress(ID, Address) error
+		AddressEvents(ctx context.Context, addr types.Address, offset, limit int) ([]Event, error)
+	}
+
+	// A VaultStore persists the state of seed address vaults.
+	VaultStore interface {
+		// AddressVault returns the state of the vault of a seed. It
+		// returns ErrNotFound if the vault does not exist.
+		AddressVault(fingerprint types.Hash256) (VaultState, error)
+		// AddAddressVault adds the vault of a seed.
+		AddAddressVault(VaultState) error
+		// IssueVaultAddress records an issued address and advances the
+		// vault's next index past it. It returns ErrVaultIndexIssued if
+		// the index is below the vault's next index.
+		IssueVaultAddress(fingerprint types.Hash256, addr IssuedAddress) error
+		// UpdateAddressVault updates the wallet, lookahead and number of
+		// registered addresses of a vault.
+		UpdateAddressVault(VaultState) error
+	}
+)
+
 // A SeedAddressVault generates and stores addresses from a seed.
 type SeedAddressVault struct {
 	seed      Seed
 	lookahead uint64
-	addrs     map[types.Address]uint64
-	mu        sync.Mutex
+	store     VaultStore
+	tg        *threadgroup.ThreadGroup
+
+	mu    sync.Mutex
+	addrs map[types.Address]uint64
+	next  uint64
+
+	// the wallet the vault keeps its lookahead addresses registered with
+	wallet          VaultWallet
+	walletID        ID
+	walletLookahead uint64
+	registered      uint64
 }
 
 func (sav *SeedAddressVault) gen(index uint64) {
@@ -68,21 +144,224 @@ func (sav *SeedAddressVault) OwnsAddress(addr types.Address) bool {
 	return ok
 }
 
+// refresh catches up with addresses issued by another process sharing the
+// vault's store. The caller must hold the lock.
+func (sav *SeedAddressVault) refresh() error {
+	state, err := sav.store.AddressVault(sav.seed.Fingerprint())
+	if err != nil {
+		return fmt.Errorf("failed to get vault state: %w", err)
+	} else if state.NextIndex <= sav.next {
+		return fmt.Errorf("index %d was issued but the vault did not advance", sav.next)
+	}
+	sav.next = state.NextIndex
+	return nil
+}
+
+// NextIndex returns the index of the next address the vault will issue.
+func (sav *SeedAddressVault) NextIndex() uint64 {
+	sav.mu.Lock()
+	defer sav.mu.Unlock()
+	return sav.next
+}
+
 // NewAddress returns a new address derived from the seed, along with
-// descriptive metadata.
-func (sav *SeedAddressVault) NewAddress(desc string) Address {
+// descriptive metadata. If the vault is persisted, the address is recorded
+// before it is returned so that its index is never issued again.
+func (sav *SeedAddressVault) NewAddress(desc string) (Address, error) {
 	sav.mu.Lock()
 	defer sav.mu.Unlock()
-	index := uint64(len(sav.addrs)) - sav.lookahead + 1
-	sav.gen(index + sav.lookahead)
+	if sav.store != nil {
+		fingerprint := sav.seed.Fingerprint()
+		for {
+			policy := types.PolicyPublicKey(sav.seed.PublicKey(sav.next))
+			err := sav.store.IssueVaultAddress(fingerprint, IssuedAddress{
+				Index:       sav.next,
+				Address:     policy.Address(),
+				Description: desc,
+				DateIssued:  time.Now(),
+			})
+			if err == nil {
+				break
+			} else if !errors.Is(err, ErrVaultIndexIssued) {
+				return Address{}, fmt.Errorf("failed to issue address: %w", err)
+			}
+			// another process issued the index; catch up and try again
+			if err := sav.refresh(); err != nil {
+				return Address{}, err
+			}
+		}
+	}
+	index := sav.next
+	sav.next++
+	sav.gen(sav.next + sav.lookahead)
 	policy := types.PolicyPublicKey(sav.seed.PublicKey(index))
-	addr := policy.Address()
 	return Address{
-		Address:     addr,
+		Address:     policy.Address(),
 		Description: desc,
 		SpendPolicy: &policy,
 		Metadata:    json.RawMessage(fmt.Sprintf(`{"keyIndex":%d}`, index)),
+	}, nil
+}
+
+// address returns the lookahead address at index.
+func (sav *SeedAddressVault) address(index uint64) Address {
+	policy := types.PolicyPublicKey(sav.seed.PublicKey(index))
+	return Address{
+		Address:     policy.Address(),
+		Description: "lookahead",
+		SpendPolicy: &policy,
+		Metadata:    json.RawMessage(fmt.Sprintf(`{"keyIndex":%d}`, index)),
+	}
+}
+
+// topUp registers addresses with the watched wallet until lookahead
+// addresses beyond the last issued or used address are registered. A used
+// address that was never issued advances the next index past it, so the
+// addresses before it are skipped. The caller must hold the lock.
+func (sav *SeedAddressVault) topUp() error {
+	if sav.wallet == nil {
+		return nil
+	}
+
+	// find the highest used address that was not issued
+	for i := sav.registered; i > sav.next; i-- {
+		addr := sav.address(i - 1)
+		events, err := sav.wallet.AddressEvents(context.Background(), addr.Address, 0, 1)
+		if err != nil {
+			return fmt.Errorf("failed to get events of address %d: %w", i-1, err)
+		} else if len(events) == 0 {
+			continue
+		}
+		if sav.store != nil {
+			err := sav.store.IssueVaultAddress(sav.seed.Fingerprint(), IssuedAddress{
+				Index:       i - 1,
+				Address:     addr.Address,
+				Description: addr.Description,
+				DateIssued:  time.Now(),
+			})
+			if errors.Is(err, ErrVaultIndexIssued) {
+				if err := sav.refresh(); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return fmt.Errorf("failed to issue used address %d: %w", i-1, err)
+			}
+		}
+		sav.next = max(sav.next, i)
+		break
+	}
+
+	target := sav.next + sav.walletLookahead
+	if sav.registered >= target {
+		return nil
+	}
+	for ; sav.registered < target; sav.registered++ {
+		if err := sav.wallet.AddAddress(sav.walletID, sav.address(sav.registered)); err != nil {
+			return fmt.Errorf("failed to register address %d: %w", sav.registered, err)
+		}
+	}
+	sav.gen(target)
+	return sav.persist()
+}
+
+// persist stores the vault's wallet, lookahead and number of registered
+// addresses. The caller must hold the lock.
+func (sav *SeedAddressVault) persist() error {
+	if sav.store == nil {
+		return nil
+	}
+	err := sav.store.UpdateAddressVault(VaultState{
+		Fingerprint: sav.seed.Fingerprint(),
+		WalletID:    sav.walletID,
+		Lookahead:   sav.walletLookahead,
+		Registered:  sav.registered,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update vault: %w", err)
+	}
+	return nil
+}
+
+// WatchWallet keeps lookahead addresses beyond the last issued or used
+// address registered with a wallet, so that deposits to addresses that were
+// handed out by another copy of the seed are not missed. The addresses are
+// checked immediately and then every interval until the vault is closed. A
+// zero lookahead uses the lookahead of the vault's last watched wallet, or
+// the vault's lookahead if it never watched one.
+func (sav *SeedAddressVault) WatchWallet(walletID ID, w VaultWallet, lookahead uint64, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	sav.mu.Lock()
+	if sav.wallet != nil {
+		sav.mu.Unlock()
+		return errors.New("vault is already watching a wallet")
+	} else if walletID != sav.walletID {
+		// addresses registered with another wallet must be registered again
+		sav.registered = 0
+		sav.walletLookahead = 0
+	}
+	sav.wallet = w
+	sav.walletID = walletID
+	if lookahead != 0 {
+		sav.walletLookahead = lookahead
+	} else if sav.walletLookahead == 0 {
+		sav.walletLookahead = sav.lookahead
+	}
+	err := sav.persist()
+	if err == nil {
+		err = sav.topUp()
+	}
+	sav.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := sav.tg.AddWithContext(context.Background())
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer cancel()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			sav.mu.Lock()
+			// errors are retried on the next tick
+			_ = sav.topUp()
+			sav.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// SetLookahead changes the number of addresses registered with the watched
+// wallet beyond the last issued or used address. Addresses that are already
+// registered are not removed when the lookahead shrinks.
+func (sav *SeedAddressVault) SetLookahead(lookahead uint64) error {
+	if lookahead == 0 {
+		return errors.New("lookahead must be positive")
 	}
+	sav.mu.Lock()
+	defer sav.mu.Unlock()
+	sav.walletLookahead = lookahead
+	if err := sav.persist(); err != nil {
+		return err
+	}
+	return sav.topUp()
+}
+
+// Close stops watching the vault's wallet.
+func (sav *SeedAddressVault) Close() error {
+	sav.tg.Stop()
+	return nil
 }
 
 // SignTransaction signs the specified transaction using keys derived from the
@@ -149,13 +428,46 @@ outer:
 	return nil
 }
 
-// NewSeedAddressVault initializes a SeedAddressVault.
+// NewSeedAddressVault initializes an in-memory SeedAddressVault. The first
+// initialAddrs addresses are treated as already issued.
 func NewSeedAddressVault(seed Seed, initialAddrs, lookahead uint64) *SeedAddressVault {
 	sav := &SeedAddressVault{
 		seed:      seed,
 		lookahead: lookahead,
+		tg:        threadgroup.New(),
 		addrs:     make(map[types.Address]uint64),
+		next:      initialAddrs,
 	}
 	sav.gen(initialAddrs + lookahead)
 	return sav
 }
+
+// LoadSeedAddressVault initializes a SeedAddressVault whose state is
+// persisted in store. The vault is identified by the seed's fingerprint and
+// is created if it does not exist.
+func LoadSeedAddressVault(seed Seed, lookahead uint64, store VaultStore) (*SeedAddressVault, error) {
+	state, err := store.AddressVault(seed.Fingerprint())
+	if errors.Is(err, ErrNotFound) {
+		state = VaultState{Fingerprint: seed.Fingerprint(), DateCreated: time.Now()}
+		if err := store.AddAddressVault(state); err != nil {
+			return nil, fmt.Errorf("failed to add vault: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get vault state: %w", err)
+	}
+
+	sav := &SeedAddressVault{
+		seed:      seed,
+		lookahead: lookahead,
+		store:     store,
+		tg:        threadgroup.New(),
+		addrs:     make(map[types.Address]uint64),
+		next:      state.NextIndex,
+
+		walletID:        state.WalletID,
+		walletLookahead: state.Lookahead,
+		registered:      state.Registered,
+	}
+	sav.gen(max(sav.next+lookahead, sav.registered))
+	return sav, nil
+}
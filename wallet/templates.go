@@ -0,0 +1,165 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrTemplateNotFound is returned when a wallet template is not found.
+var ErrTemplateNotFound = errors.New("template not found")
+
+type (
+	// A TemplateID is a unique identifier for a wallet template.
+	TemplateID int64
+
+	// A TemplateWebhook is a webhook created for each wallet added from a
+	// template. Its scopes are narrowed to the new wallet's events.
+	TemplateWebhook struct {
+		CallbackURL string   `json:"callbackURL"`
+		Scopes      []string `json:"scopes"`
+	}
+
+	// A Template is a set of default settings applied to wallets created
+	// from it. Changing a template does not affect existing wallets.
+	Template struct {
+		ID          TemplateID `json:"id"`
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		// Metadata is the metadata of new wallets that do not specify
+		// their own.
+		Metadata json.RawMessage `json:"metadata,omitempty"`
+		// MetadataSchema is the JSON schema of new wallets' metadata.
+		MetadataSchema json.RawMessage `json:"metadataSchema,omitempty"`
+		// FeeStrategy is the fee strategy of new wallets. If nil, new
+		// wallets use DefaultFeeStrategy.
+		FeeStrategy *FeeStrategy      `json:"feeStrategy,omitempty"`
+		Webhooks    []TemplateWebhook `json:"webhooks,omitempty"`
+		DateCreated time.Time         `json:"dateCreated"`
+		LastUpdated time.Time         `json:"lastUpdated"`
+	}
+)
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *TemplateID) UnmarshalText(buf []byte) error {
+	n, err := strconv.ParseInt(string(buf), 10, 64)
+	if err != nil {
+		return err
+	}
+	*id = TemplateID(n)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (id TemplateID) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(int64(id), 10)), nil
+}
+
+// WalletScope returns the webhook scope of a wallet's events within scope,
+// e.g. "wallets/1" for the wallet events of wallet 1.
+func WalletScope(scope string, id ID) string {
+	return scope + "/" + strconv.FormatInt(int64(id), 10)
+}
+
+// Validate returns an error if the template is invalid.
+func (t Template) Validate() error {
+	if t.Name == "" {
+		return errors.New("template name is required")
+	} else if len(t.Metadata) > 0 && !json.Valid(t.Metadata) {
+		return errors.New("template metadata must be valid JSON")
+	} else if _, err := compileSchema(t.MetadataSchema); err != nil {
+		return err
+	} else if !isNull(t.Metadata) {
+		if err := validateMetadata(t.MetadataSchema, t.Metadata); err != nil {
+			return fmt.Errorf("template metadata: %w", err)
+		}
+	}
+	if t.FeeStrategy != nil {
+		if err := t.FeeStrategy.Validate(); err != nil {
+			return err
+		}
+	}
+	for i, wh := range t.Webhooks {
+		if wh.CallbackURL == "" {
+			return fmt.Errorf("webhook %d: callback URL is required", i)
+		} else if len(wh.Scopes) == 0 {
+			return fmt.Errorf("webhook %d: at least one scope is required", i)
+		}
+	}
+	return nil
+}
+
+// Templates returns all wallet templates.
+func (m *Manager) Templates() ([]Template, error) {
+	return m.store.Templates()
+}
+
+// Template returns a wallet template.
+func (m *Manager) Template(id TemplateID) (Template, error) {
+	return m.store.Template(id)
+}
+
+// AddTemplate adds a wallet template.
+func (m *Manager) AddTemplate(t Template) (Template, error) {
+	if err := t.Validate(); err != nil {
+		return Template{}, err
+	}
+	return m.store.AddTemplate(t)
+}
+
+// UpdateTemplate updates a wallet template.
+func (m *Manager) UpdateTemplate(t Template) (Template, error) {
+	if err := t.Validate(); err != nil {
+		return Template{}, err
+	}
+	return m.store.UpdateTemplate(t)
+}
+
+// DeleteTemplate deletes a wallet template. Wallets created from it are not
+// affected.
+func (m *Manager) DeleteTemplate(id TemplateID) error {
+	return m.store.DeleteTemplate(id)
+}
+
+// AddWalletFromTemplate adds a wallet with the template's default settings.
+// The template's metadata is used if the wallet does not have any, and must
+// match the template's metadata schema. Creating the template's webhooks is
+// left to the caller.
+func (m *Manager) AddWalletFromTemplate(w Wallet, t Template) (Wallet, error) {
+	if isNull(w.Metadata) {
+		w.Metadata = t.Metadata
+	}
+	if err := validateMetadata(t.MetadataSchema, w.Metadata); err != nil {
+		return Wallet{}, err
+	} else if err := validateWalletType(w.Type); err != nil {
+		return Wallet{}, err
+	}
+	w, err := m.store.AddWallet(w)
+	if err != nil {
+		return Wallet{}, err
+	}
+
+	// remove the wallet if the template cannot be fully applied
+	rollback := func() {
+		if err := m.store.DeleteWallet(w.ID); err != nil {
+			m.log.Error("failed to remove wallet after applying template failed", zap.Int64("wallet", int64(w.ID)), zap.Error(err))
+		}
+	}
+	if t.FeeStrategy != nil {
+		if err := m.store.SetWalletFeeStrategy(w.ID, *t.FeeStrategy); err != nil {
+			rollback()
+			return Wallet{}, fmt.Errorf("failed to set fee strategy: %w", err)
+		}
+	}
+	if !isNull(t.MetadataSchema) {
+		if err := m.store.SetWalletMetadataSchema(w.ID, t.MetadataSchema); err != nil {
+			rollback()
+			return Wallet{}, fmt.Errorf("failed to set metadata schema: %w", err)
+		}
+	}
+	return w, nil
+}
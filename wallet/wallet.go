@@ -3,6 +3,7 @@ package wallet
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -67,6 +68,40 @@ type (
 		DateCreated time.Time       `json:"dateCreated"`
 		LastUpdated time.Time       `json:"lastUpdated"`
 		Metadata    json.RawMessage `json:"metadata"`
+		// Tenant is the tenant that owns the wallet. Wallets without a
+		// tenant are only visible to unrestricted credentials.
+		Tenant string `json:"tenant,omitempty"`
+		// Type is the type of the wallet, e.g. WalletTypeCold. It is set
+		// when the wallet is created and cannot be changed.
+		Type string `json:"type,omitempty"`
+		// Revision is incremented each time the wallet is updated. An
+		// update that specifies a revision fails with a
+		// RevisionConflictError if the wallet was updated since.
+		Revision uint64 `json:"revision"`
+	}
+
+	// A RevisionConflictError is returned when a wallet is updated with a
+	// revision that does not match its current revision.
+	RevisionConflictError struct {
+		Expected uint64
+		Current  uint64
+	}
+
+	// TenantUsage is the number of wallets and wallet addresses owned by a
+	// tenant.
+	TenantUsage struct {
+		Tenant    string `json:"tenant"`
+		Wallets   int    `json:"wallets"`
+		Addresses int    `json:"addresses"`
+	}
+
+	// QueryStats are the totals of a wallet's expensive store queries, such
+	// as event listings. Wait is the time spent waiting for a turn to run,
+	// and Elapsed is the time spent running.
+	QueryStats struct {
+		Queries uint64        `json:"queries"`
+		Wait    time.Duration `json:"wait"`
+		Elapsed time.Duration `json:"elapsed"`
 	}
 
 	// A Address is an address associated with a wallet.
@@ -75,6 +110,17 @@ type (
 		Description string             `json:"description"`
 		SpendPolicy *types.SpendPolicy `json:"spendPolicy,omitempty"`
 		Metadata    json.RawMessage    `json:"metadata"`
+		// DerivationPath is the path of the address's key in an offline
+		// key hierarchy, e.g. "m/44'/1991'/0'/0/5". It is included in
+		// withdrawal proposals so offline signers can derive the key.
+		DerivationPath string `json:"derivationPath,omitempty"`
+	}
+
+	// An AddAddressResult is the result of adding an address to a wallet.
+	AddAddressResult struct {
+		Status string `json:"status"`
+		// WalletIDs are the other wallets that contain the address.
+		WalletIDs []ID `json:"walletIDs,omitempty"`
 	}
 
 	// A ChainUpdate is a set of changes to the consensus state.
@@ -86,9 +132,26 @@ type (
 	}
 )
 
+// AddAddress statuses.
+const (
+	// AddressAdded indicates the address was not in any wallet.
+	AddressAdded = "added"
+	// AddressExists indicates the address was already in the wallet. Its
+	// description, spend policy, and metadata are updated.
+	AddressExists = "exists"
+	// AddressConflict indicates the address was added to the wallet, but is
+	// also in other wallets.
+	AddressConflict = "conflict"
+)
+
 // ErrNotFound is returned when a requested wallet or address is not found.
 var ErrNotFound = errors.New("not found")
 
+// Error implements error.
+func (e *RevisionConflictError) Error() string {
+	return fmt.Sprintf("wallet was modified: expected revision %d, current revision is %d", e.Expected, e.Current)
+}
+
 // UnmarshalText implements encoding.TextUnmarshaler.
 func (w *ID) UnmarshalText(buf []byte) error {
 	id, err := strconv.ParseInt(string(buf), 10, 64)
@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/bits"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	"go.thebigfile.com/walletd/alerts"
 	"go.thebigfile.com/walletd/persist/sqlite"
 	"go.thebigfile.com/walletd/wallet"
 	"go.thebigfile.com/core/consensus"
@@ -167,7 +170,7 @@ func TestReorg(t *testing.T) {
 		}
 
 		// check that a payout event was recorded
-		events, err := wm.WalletEvents(w.ID, 0, 100)
+		events, err := wm.WalletEvents(context.Background(), w.ID, 0, 100)
 		if err != nil {
 			t.Fatal(err)
 		} else if len(events) != 1 {
@@ -204,7 +207,7 @@ func TestReorg(t *testing.T) {
 		}
 
 		// check that the payout event was reverted
-		events, err = wm.WalletEvents(w.ID, 0, 100)
+		events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 		if err != nil {
 			t.Fatal(err)
 		} else if len(events) != 0 {
@@ -233,7 +236,7 @@ func TestReorg(t *testing.T) {
 		}
 
 		// check that a payout event was recorded
-		events, err = wm.WalletEvents(w.ID, 0, 100)
+		events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 		if err != nil {
 			t.Fatal(err)
 		} else if len(events) != 1 {
@@ -367,7 +370,7 @@ func TestEphemeralBalance(t *testing.T) {
 	}
 
 	// check that a payout event was recorded
-	events, err := wm.WalletEvents(w.ID, 0, 100)
+	events, err := wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -459,7 +462,7 @@ func TestEphemeralBalance(t *testing.T) {
 	}
 
 	// check that both transactions were added
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 3 { // 1 payout, 2 transactions
@@ -498,7 +501,7 @@ func TestEphemeralBalance(t *testing.T) {
 	}
 
 	// check that only the payout event remains
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -577,7 +580,7 @@ func TestWalletAddresses(t *testing.T) {
 		SpendPolicy: &spendPolicy,
 		Description: "hello, world",
 	}
-	err = db.AddWalletAddress(w.ID, addr)
+	_, err = db.AddWalletAddress(w.ID, addr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -600,7 +603,7 @@ func TestWalletAddresses(t *testing.T) {
 	addr.Description = "goodbye, world"
 	addr.Metadata = json.RawMessage(`{"foo": "bar"}`)
 
-	if err := db.AddWalletAddress(w.ID, addr); err != nil {
+	if _, err := db.AddWalletAddress(w.ID, addr); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1033,7 +1036,7 @@ func TestOrphans(t *testing.T) {
 	}
 
 	// check that a payout event was recorded
-	events, err := wm.WalletEvents(w.ID, 0, 100)
+	events, err := wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -1093,7 +1096,7 @@ func TestOrphans(t *testing.T) {
 	}
 
 	// check that the transaction event was recorded
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
@@ -1136,7 +1139,7 @@ func TestOrphans(t *testing.T) {
 	}
 
 	// check that the transaction event was reverted
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -1206,7 +1209,7 @@ func TestFullIndex(t *testing.T) {
 	}
 
 	// check the events are empty for the first address
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 0 {
 		t.Fatalf("expected 0 events, got %v", len(events))
@@ -1215,7 +1218,7 @@ func TestFullIndex(t *testing.T) {
 	// assert that the airdropped siafunds are on the second address
 	assertBalance(t, addr2, types.ZeroCurrency, types.ZeroCurrency, cm.TipState().SiafundCount())
 	// check the events for the air dropped siafunds
-	if events, err := wm.AddressEvents(addr2, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr2, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
 		t.Fatalf("expected 1 event, got %v", len(events))
@@ -1232,7 +1235,7 @@ func TestFullIndex(t *testing.T) {
 	waitForBlock(t, cm, db)
 
 	// check the payout was received
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
 		t.Fatalf("expected 1 events, got %v", len(events))
@@ -1240,6 +1243,21 @@ func TestFullIndex(t *testing.T) {
 		t.Fatalf("expected miner payout event, got %v", events[0].Type)
 	}
 
+	// check that only events after the height are returned
+	if events, err := wm.AddressEventsSince(context.Background(), addr, 0, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 || events[0].Type != wallet.EventTypeMinerPayout {
+		t.Fatalf("expected 1 miner payout event, got %v", events)
+	} else if events, err := wm.AddressEventsSince(context.Background(), addr, cm.Tip().Height, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 0 {
+		t.Fatalf("expected 0 events, got %v", len(events))
+	} else if events, err := wm.AddressEventsSince(context.Background(), addr2, 0, 0, 100); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 0 {
+		t.Fatalf("expected genesis events to be excluded, got %v", len(events))
+	}
+
 	assertBalance(t, addr, types.ZeroCurrency, expectedBalance1, 0)
 
 	// mine until the payout matures
@@ -1251,7 +1269,7 @@ func TestFullIndex(t *testing.T) {
 	waitForBlock(t, cm, db)
 
 	// check that the events did not change
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
 		t.Fatalf("expected 1 events, got %v", len(events))
@@ -1303,7 +1321,7 @@ func TestFullIndex(t *testing.T) {
 	assertBalance(t, addr2, expectedBalance1.Div64(2), types.ZeroCurrency, cm.TipState().SiafundCount())
 
 	// check the events for the transaction
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
 		t.Fatalf("expected 2 events, got %v", len(events))
@@ -1312,7 +1330,7 @@ func TestFullIndex(t *testing.T) {
 	}
 
 	// check the events for the second address
-	if events, err := wm.AddressEvents(addr2, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr2, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
 		t.Fatalf("expected 2 event, got %v", len(events))
@@ -1362,7 +1380,7 @@ func TestFullIndex(t *testing.T) {
 	assertBalance(t, addr2, expectedBalance1.Div64(2), types.ZeroCurrency, 0)
 
 	// check the events for the transaction
-	if events, err := wm.AddressEvents(addr2, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr2, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 4 {
 		t.Fatalf("expected 4 events, got %v", len(events))
@@ -1371,7 +1389,7 @@ func TestFullIndex(t *testing.T) {
 	}
 
 	// check the events for the first address
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 3 {
 		t.Fatalf("expected 3 events, got %v", len(events))
@@ -1432,7 +1450,7 @@ func TestEvents(t *testing.T) {
 	}
 
 	// check the events are empty for the first address
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 0 {
 		t.Fatalf("expected 0 events, got %v", len(events))
@@ -1441,7 +1459,7 @@ func TestEvents(t *testing.T) {
 	// assert that the airdropped siafunds are on the second address
 	assertBalance(t, addr2, types.ZeroCurrency, types.ZeroCurrency, cm.TipState().SiafundCount())
 	// check the events for the air dropped siafunds
-	if events, err := wm.AddressEvents(addr2, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr2, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
 		t.Fatalf("expected 1 event, got %v", len(events))
@@ -1458,7 +1476,7 @@ func TestEvents(t *testing.T) {
 	waitForBlock(t, cm, db)
 
 	// check the payout was received
-	events, err := wm.AddressEvents(addr, 0, 100)
+	events, err := wm.AddressEvents(context.Background(), addr, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -1487,7 +1505,7 @@ func TestEvents(t *testing.T) {
 	waitForBlock(t, cm, db)
 
 	// check that the events did not change
-	if events, err := wm.AddressEvents(addr, 0, 100); err != nil {
+	if events, err := wm.AddressEvents(context.Background(), addr, 0, 100); err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
 		t.Fatalf("expected 1 events, got %v", len(events))
@@ -1532,7 +1550,7 @@ func TestEvents(t *testing.T) {
 	assertBalance(t, addr2, expectedBalance1.Div64(2), types.ZeroCurrency, cm.TipState().SiafundCount())
 
 	// check the events for the transaction
-	events, err = wm.AddressEvents(addr, 0, 100)
+	events, err = wm.AddressEvents(context.Background(), addr, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
@@ -1550,7 +1568,7 @@ func TestEvents(t *testing.T) {
 	}
 
 	// check the events for the second address
-	events, err = wm.AddressEvents(addr2, 0, 100)
+	events, err = wm.AddressEvents(context.Background(), addr2, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
@@ -1602,7 +1620,7 @@ func TestEvents(t *testing.T) {
 	assertBalance(t, addr2, expectedBalance1.Div64(2), types.ZeroCurrency, 0)
 
 	// check the events for the transaction
-	events, err = wm.AddressEvents(addr2, 0, 100)
+	events, err = wm.AddressEvents(context.Background(), addr2, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 4 {
@@ -1620,7 +1638,7 @@ func TestEvents(t *testing.T) {
 	}
 
 	// check the events for the first address
-	events, err = wm.AddressEvents(addr, 0, 100)
+	events, err = wm.AddressEvents(context.Background(), addr, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 3 {
@@ -2125,7 +2143,7 @@ func TestV2(t *testing.T) {
 	}
 
 	// check that a payout event was recorded
-	events, err := wm.WalletEvents(w.ID, 0, 100)
+	events, err := wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -2179,7 +2197,7 @@ func TestV2(t *testing.T) {
 	}
 
 	// check that a transaction event was recorded
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
@@ -2444,7 +2462,7 @@ func TestReorgV2(t *testing.T) {
 	}
 
 	// check that a payout event was recorded
-	events, err := wm.WalletEvents(w.ID, 0, 100)
+	events, err := wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -2481,7 +2499,7 @@ func TestReorgV2(t *testing.T) {
 	}
 
 	// check that the payout event was reverted
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 0 {
@@ -2510,7 +2528,7 @@ func TestReorgV2(t *testing.T) {
 	}
 
 	// check that a payout event was recorded
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -2679,7 +2697,7 @@ func TestOrphansV2(t *testing.T) {
 	}
 
 	// check that a payout event was recorded
-	events, err := wm.WalletEvents(w.ID, 0, 100)
+	events, err := wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -2730,7 +2748,7 @@ func TestOrphansV2(t *testing.T) {
 	}
 
 	// check that the transaction event was recorded
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 2 {
@@ -2773,7 +2791,7 @@ func TestOrphansV2(t *testing.T) {
 	}
 
 	// check that the transaction event was reverted
-	events, err = wm.WalletEvents(w.ID, 0, 100)
+	events, err = wm.WalletEvents(context.Background(), w.ID, 0, 100)
 	if err != nil {
 		t.Fatal(err)
 	} else if len(events) != 1 {
@@ -2993,7 +3011,7 @@ func TestEventTypes(t *testing.T) {
 	assertEvent := func(t *testing.T, id types.Hash256, eventType string, expectedInflow, expectedOutflow types.Currency, maturityHeight uint64) {
 		t.Helper()
 
-		events, err := wm.AddressEvents(addr, 0, 100)
+		events, err := wm.AddressEvents(context.Background(), addr, 0, 100)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -3512,3 +3530,798 @@ func TestEventTypes(t *testing.T) {
 		assertEvent(t, types.Hash256(types.SiafundOutputID(sfe[0].ID).V2ClaimOutputID()), wallet.EventTypeSiafundClaim, claimValue, types.ZeroCurrency, cm.Tip().Height+144)
 	})
 }
+
+func TestCounterparties(t *testing.T) {
+	owned := types.Address{1}
+	change := types.Address{2}
+	recipient := types.Address{3}
+	sender := types.Address{4}
+
+	// v1 payment from the wallet to a recipient, with change
+	ev := wallet.Event{
+		Type: wallet.EventTypeV1Transaction,
+		Data: wallet.EventV1Transaction{
+			Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Address: recipient, Value: types.Siacoins(30)},
+					{Address: change, Value: types.Siacoins(69)},
+				},
+				MinerFees: []types.Currency{types.Siacoins(1)},
+			},
+			SpentSiacoinElements: []types.SiacoinElement{
+				{SiacoinOutput: types.SiacoinOutput{Address: owned, Value: types.Siacoins(100)}},
+			},
+		},
+		Relevant: []types.Address{owned, change},
+	}
+	cps := wallet.Counterparties(ev)
+	if len(cps) != 1 {
+		t.Fatalf("expected 1 counterparty, got %d", len(cps))
+	} else if cps[0].Address != recipient || cps[0].Role != wallet.CounterpartyRecipient || !cps[0].Value.Equals(types.Siacoins(30)) {
+		t.Fatalf("unexpected counterparty %+v", cps[0])
+	}
+
+	// v2 deposit from a sender that receives its own change
+	ev = wallet.Event{
+		Type: wallet.EventTypeV2Transaction,
+		Data: wallet.EventV2Transaction{
+			SiacoinInputs: []types.V2SiacoinInput{
+				{Parent: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: sender, Value: types.Siacoins(50)}}},
+			},
+			SiacoinOutputs: []types.SiacoinOutput{
+				{Address: owned, Value: types.Siacoins(20)},
+				{Address: sender, Value: types.Siacoins(29)},
+			},
+			MinerFee: types.Siacoins(1),
+		},
+		Relevant: []types.Address{owned},
+	}
+	cps = wallet.Counterparties(ev)
+	if len(cps) != 1 {
+		t.Fatalf("expected 1 counterparty, got %d", len(cps))
+	} else if cps[0].Address != sender || cps[0].Role != wallet.CounterpartySender || !cps[0].Value.Equals(types.Siacoins(21)) {
+		t.Fatalf("unexpected counterparty %+v", cps[0])
+	}
+
+	// payouts have no counterparties
+	ev = wallet.Event{
+		Type: wallet.EventTypeMinerPayout,
+		Data: wallet.EventPayout{
+			SiacoinElement: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: owned, Value: types.Siacoins(300)}},
+		},
+		Relevant: []types.Address{owned},
+	}
+	if cps := wallet.Counterparties(ev); len(cps) != 0 {
+		t.Fatalf("expected no counterparties, got %v", cps)
+	}
+}
+
+func TestMarkInternal(t *testing.T) {
+	owned := types.Address{1}
+	change := types.Address{2}
+	other := types.Address{3}
+	external := types.Address{4}
+
+	// payment builds a v2 transaction spending 100 SC from the wallet to a
+	// recipient, with change
+	payment := func(recipient types.Address) wallet.Event {
+		return wallet.Event{
+			Type: wallet.EventTypeV2Transaction,
+			Data: wallet.EventV2Transaction{
+				SiacoinInputs: []types.V2SiacoinInput{
+					{Parent: types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: owned, Value: types.Siacoins(100)}}},
+				},
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Address: recipient, Value: types.Siacoins(30)},
+					{Address: change, Value: types.Siacoins(69)},
+				},
+				MinerFee: types.Siacoins(1),
+			},
+			Relevant: []types.Address{owned, change},
+		}
+	}
+
+	annotated := wallet.AnnotateEvents([]wallet.Event{payment(other), payment(external)}, nil)
+	annotated[0].Categories = []string{"revenue"}
+	wallet.MarkInternal(annotated, map[types.Address]wallet.ID{other: 2})
+	for _, ae := range annotated {
+		if !ae.Change.Equals(types.Siacoins(69)) {
+			t.Fatalf("expected 69 SC change, got %v", ae.Change)
+		}
+	}
+
+	// a payment to another wallet is internal
+	if ae := annotated[0]; !ae.Internal || ae.Counterparties[0].Wallet != 2 {
+		t.Fatalf("expected internal transfer to wallet 2, got %+v", ae)
+	} else if len(ae.Categories) != 2 || ae.Categories[0] != wallet.CategoryInternal || ae.Categories[1] != "revenue" {
+		t.Fatalf("unexpected categories %v", ae.Categories)
+	} else if inflow, outflow := wallet.ReportFlows(ae); !inflow.IsZero() || !outflow.IsZero() {
+		t.Fatalf("expected no flows, got %v and %v", inflow, outflow)
+	}
+
+	// a payment to an external address is not, and only its change is
+	// netted out of its flows
+	if ae := annotated[1]; ae.Internal || ae.Counterparties[0].Wallet != 0 || len(ae.Categories) != 0 {
+		t.Fatalf("expected external payment, got %+v", ae)
+	} else if inflow, outflow := wallet.ReportFlows(ae); !inflow.IsZero() || !outflow.Equals(types.Siacoins(31)) {
+		t.Fatalf("expected 0 SC inflow and 31 SC outflow, got %v and %v", inflow, outflow)
+	}
+
+	// the recipient's view of the transfer has no change
+	ev := payment(other)
+	ev.Relevant = []types.Address{other}
+	annotated = wallet.AnnotateEvents([]wallet.Event{ev}, nil)
+	wallet.MarkInternal(annotated, map[types.Address]wallet.ID{owned: 1, change: 1})
+	if ae := annotated[0]; !ae.Change.IsZero() || !ae.Internal {
+		t.Fatalf("expected internal deposit without change, got %+v", ae)
+	}
+}
+
+func TestAnalyzePrivacy(t *testing.T) {
+	a1, a2, a3 := types.Address{1}, types.Address{2}, types.Address{3}
+	external := types.Address{4}
+	owned := []types.Address{a1, a2, a3}
+
+	sce := func(addr types.Address, sc uint32) types.SiacoinElement {
+		return types.SiacoinElement{SiacoinOutput: types.SiacoinOutput{Address: addr, Value: types.Siacoins(sc)}}
+	}
+	events := []wallet.Event{
+		// a1 receives twice
+		{Type: wallet.EventTypeMinerPayout, Data: wallet.EventPayout{SiacoinElement: sce(a1, 300)}, Relevant: owned},
+		{Type: wallet.EventTypeV2Transaction, Data: wallet.EventV2Transaction{
+			SiacoinInputs:  []types.V2SiacoinInput{{Parent: sce(external, 100)}},
+			SiacoinOutputs: []types.SiacoinOutput{{Address: a1, Value: types.Siacoins(100)}},
+		}, Relevant: owned},
+		// a2 receives once
+		{Type: wallet.EventTypeV2Transaction, Data: wallet.EventV2Transaction{
+			SiacoinInputs:  []types.V2SiacoinInput{{Parent: sce(external, 50)}},
+			SiacoinOutputs: []types.SiacoinOutput{{Address: a2, Value: types.Siacoins(50)}},
+		}, Relevant: owned},
+		// a1 and a2 are merged, with change returned to a1
+		{Type: wallet.EventTypeV1Transaction, Data: wallet.EventV1Transaction{
+			Transaction: types.Transaction{
+				SiacoinOutputs: []types.SiacoinOutput{
+					{Address: external, Value: types.Siacoins(350)},
+					{Address: a1, Value: types.Siacoins(100)},
+				},
+			},
+			SpentSiacoinElements: []types.SiacoinElement{sce(a1, 400), sce(a2, 50)},
+		}, Relevant: owned},
+		// a single-address payment with change to a fresh address
+		{Type: wallet.EventTypeV2Transaction, Data: wallet.EventV2Transaction{
+			SiacoinInputs: []types.V2SiacoinInput{{Parent: sce(a1, 100)}},
+			SiacoinOutputs: []types.SiacoinOutput{
+				{Address: external, Value: types.Siacoins(40)},
+				{Address: a3, Value: types.Siacoins(60)},
+			},
+		}, Relevant: owned},
+	}
+
+	report := wallet.AnalyzePrivacy(events, nil)
+	if report.AddressReuse != (wallet.PrivacyMetric{Total: 3, Flagged: 1, Score: 67}) {
+		t.Fatalf("unexpected address reuse %+v", report.AddressReuse)
+	} else if report.ChangeLinkage != (wallet.PrivacyMetric{Total: 2, Flagged: 1, Score: 50}) {
+		t.Fatalf("unexpected change linkage %+v", report.ChangeLinkage)
+	} else if report.UTXOMerging != (wallet.PrivacyMetric{Total: 2, Flagged: 1, Score: 50}) {
+		t.Fatalf("unexpected UTXO merging %+v", report.UTXOMerging)
+	} else if report.Score != 55 {
+		t.Fatalf("expected score 55, got %d", report.Score)
+	} else if len(report.Suggestions) != 3 {
+		t.Fatalf("expected 3 suggestions, got %v", report.Suggestions)
+	}
+
+	// a wallet with no history has a perfect score
+	if report := wallet.AnalyzePrivacy(nil, nil); report.Score != 100 || len(report.Suggestions) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestSummarizeFees(t *testing.T) {
+	// Wednesday
+	now := time.Date(2024, time.May, 15, 12, 0, 0, 0, time.UTC)
+	entries := []wallet.FeeEntry{
+		{Amount: types.Siacoins(1), Timestamp: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{Amount: types.Siacoins(2), Timestamp: time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC)},
+		{Amount: types.Siacoins(3), Timestamp: time.Date(2024, time.May, 14, 23, 59, 0, 0, time.UTC)},
+		{Amount: types.Siacoins(4), Timestamp: time.Date(2024, time.May, 15, 1, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		period string
+		n      int
+		totals []uint32
+		counts []int
+	}{
+		{wallet.FeePeriodDay, 3, []uint32{4, 3, 2}, []int{1, 1, 1}},
+		{wallet.FeePeriodWeek, 2, []uint32{9, 0}, []int{3, 0}},
+		{wallet.FeePeriodMonth, 2, []uint32{10, 0}, []int{4, 0}},
+	}
+	for _, test := range tests {
+		summaries, err := wallet.SummarizeFees(entries, test.period, test.n, now)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(summaries) != test.n {
+			t.Fatalf("%s: expected %d summaries, got %d", test.period, test.n, len(summaries))
+		}
+		for i, s := range summaries {
+			if !s.Total.Equals(types.Siacoins(test.totals[i])) {
+				t.Fatalf("%s: expected period %d total %v, got %v", test.period, i, types.Siacoins(test.totals[i]), s.Total)
+			} else if s.Transactions != test.counts[i] {
+				t.Fatalf("%s: expected period %d to have %d transactions, got %d", test.period, i, test.counts[i], s.Transactions)
+			}
+		}
+	}
+
+	if summaries, _ := wallet.SummarizeFees(nil, wallet.FeePeriodWeek, 1, now); !summaries[0].Start.Equal(time.Date(2024, time.May, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected week to start on Monday, got %v", summaries[0].Start)
+	}
+	if _, err := wallet.SummarizeFees(entries, "year", 1, now); !errors.Is(err, wallet.ErrUnknownFeePeriod) {
+		t.Fatalf("expected ErrUnknownFeePeriod, got %v", err)
+	}
+}
+
+func TestFeeStrategy(t *testing.T) {
+	var cs consensus.State
+	recommended := types.NewCurrency64(100)
+
+	tests := []struct {
+		fs   wallet.FeeStrategy
+		rate uint64
+	}{
+		{wallet.DefaultFeeStrategy, 100},
+		{wallet.FeeStrategy{Type: wallet.FeeStrategyFixed, Fee: types.NewCurrency64(30)}, 30},
+		{wallet.FeeStrategy{Type: wallet.FeeStrategyMultiplier, Multiplier: 1.5}, 150},
+		{wallet.FeeStrategy{Type: wallet.FeeStrategyMultiplier, Multiplier: 3, MaxFee: types.NewCurrency64(200)}, 200},
+		{wallet.FeeStrategy{Type: wallet.FeeStrategyRecommended, MaxFee: types.NewCurrency64(50)}, 50},
+		{wallet.FeeStrategy{Type: wallet.FeeStrategyTarget, TargetBlocks: 6}, 100},
+	}
+	for _, test := range tests {
+		if err := test.fs.Validate(); err != nil {
+			t.Fatalf("%s: %v", test.fs.Type, err)
+		} else if rate := test.fs.FeeRate(cs, recommended, nil, nil); !rate.Equals(types.NewCurrency64(test.rate)) {
+			t.Fatalf("%s: expected rate %d, got %v", test.fs.Type, test.rate, rate)
+		}
+	}
+
+	invalid := []wallet.FeeStrategy{
+		{Type: "auction"},
+		{Type: wallet.FeeStrategyFixed},
+		{Type: wallet.FeeStrategyMultiplier, Multiplier: -1},
+		{Type: wallet.FeeStrategyTarget},
+	}
+	for _, fs := range invalid {
+		if err := fs.Validate(); !errors.Is(err, wallet.ErrInvalidFeeStrategy) {
+			t.Fatalf("%+v: expected ErrInvalidFeeStrategy, got %v", fs, err)
+		}
+	}
+}
+
+func TestMaxReorgDepth(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bdb, err := coreutils.OpenBoltChainDB(filepath.Join(dir, "consensus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+
+	network, genesisBlock := testV1Network(types.VoidAddress)
+	store, genesisState, err := chain.NewDBStore(bdb, network, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(store, genesisState)
+
+	am := alerts.NewManager()
+	wm, err := wallet.NewManager(cm, db, wallet.WithLogger(log.Named("wallet")), wallet.WithMaxReorgDepth(2, am))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	if err := wm.ApproveReorg(); !errors.Is(err, wallet.ErrNoPendingReorg) {
+		t.Fatalf("expected ErrNoPendingReorg, got %v", err)
+	}
+
+	// mine the main chain
+	for i := 0; i < 5; i++ {
+		if err := cm.AddBlocks([]types.Block{mineBlock(cm.TipState(), nil, types.VoidAddress)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForBlock(t, cm, db)
+	mainTip := cm.Tip()
+
+	// mine a longer fork from genesis, reverting the main chain
+	var fork []types.Block
+	state := genesisState
+	for i := 0; i < 10; i++ {
+		block := mineBlock(state, nil, types.VoidAddress)
+		fork = append(fork, block)
+		state.Index.ID = block.ID()
+		state.Index.Height++
+	}
+	if err := cm.AddBlocks(fork); err != nil {
+		t.Fatal(err)
+	}
+
+	// the wallet should stop at the main chain's tip
+	var pending wallet.PendingReorg
+	var ok bool
+	for i := 0; i < 100; i++ {
+		if pending, ok = wm.PendingReorg(); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !ok {
+		t.Fatal("expected pending reorg")
+	} else if pending.From != mainTip || pending.Depth != 5 {
+		t.Fatalf("unexpected pending reorg %+v", pending)
+	} else if tip, err := wm.Tip(); err != nil {
+		t.Fatal(err)
+	} else if tip != mainTip {
+		t.Fatalf("expected tip %v, got %v", mainTip, tip)
+	} else if len(am.Active()) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(am.Active()))
+	}
+
+	// approving the reorg resumes syncing
+	if err := wm.ApproveReorg(); err != nil {
+		t.Fatal(err)
+	}
+	waitForBlock(t, cm, db)
+	if _, ok := wm.PendingReorg(); ok {
+		t.Fatal("expected no pending reorg")
+	} else if len(am.Active()) != 0 {
+		t.Fatalf("expected alert to be dismissed, got %d", len(am.Active()))
+	}
+}
+
+func TestSeedAddressVaultPersistence(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	seed := wallet.NewSeed()
+	sav, err := wallet.LoadSeedAddressVault(seed, 10, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := make(map[types.Address]bool)
+	for i := 0; i < 3; i++ {
+		addr, err := sav.NewAddress(fmt.Sprintf("addr %d", i))
+		if err != nil {
+			t.Fatal(err)
+		} else if addr.Address != types.StandardAddress(seed.PublicKey(uint64(i))) {
+			t.Fatalf("expected address %d to be derived from index %d", i, i)
+		}
+		issued[addr.Address] = true
+	}
+
+	// a second process sharing the store must not reuse the issued indices
+	other, err := wallet.LoadSeedAddressVault(seed, 10, db)
+	if err != nil {
+		t.Fatal(err)
+	} else if other.NextIndex() != 3 {
+		t.Fatalf("expected next index 3, got %d", other.NextIndex())
+	}
+	addr, err := other.NewAddress("other")
+	if err != nil {
+		t.Fatal(err)
+	} else if issued[addr.Address] {
+		t.Fatal("reloaded vault reissued an address")
+	}
+	issued[addr.Address] = true
+
+	// the stale vault catches up instead of issuing index 3 again
+	addr, err = sav.NewAddress("stale")
+	if err != nil {
+		t.Fatal(err)
+	} else if issued[addr.Address] {
+		t.Fatal("stale vault reissued an address")
+	} else if sav.NextIndex() != 5 {
+		t.Fatalf("expected next index 5, got %d", sav.NextIndex())
+	}
+
+	state, err := db.AddressVault(seed.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	} else if state.NextIndex != 5 || len(state.Issued) != 5 {
+		t.Fatalf("expected 5 issued addresses, got %d with next index %d", len(state.Issued), state.NextIndex)
+	} else if state.Issued[4].Description != "stale" || state.Issued[4].Index != 4 {
+		t.Fatalf("unexpected issued address %+v", state.Issued[4])
+	} else if !sav.OwnsAddress(types.StandardAddress(seed.PublicKey(14))) {
+		t.Fatal("expected vault to own addresses within the lookahead")
+	}
+}
+
+type vaultWallet struct {
+	mu    sync.Mutex
+	addrs map[types.Address]wallet.Address
+	used  map[types.Address]bool
+}
+
+func (vw *vaultWallet) AddAddress(_ wallet.ID, addr wallet.Address) error {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	vw.addrs[addr.Address] = addr
+	return nil
+}
+
+func (vw *vaultWallet) AddressEvents(_ context.Context, addr types.Address, _, _ int) ([]wallet.Event, error) {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	if vw.used[addr] {
+		return []wallet.Event{{ID: types.Hash256(addr)}}, nil
+	}
+	return nil, nil
+}
+
+func (vw *vaultWallet) registered() int {
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	return len(vw.addrs)
+}
+
+func TestSeedAddressVaultLookahead(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	w, err := db.AddWallet(wallet.Wallet{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seed := wallet.NewSeed()
+	sav, err := wallet.LoadSeedAddressVault(seed, 20, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sav.Close()
+
+	vw := &vaultWallet{addrs: make(map[types.Address]wallet.Address), used: make(map[types.Address]bool)}
+	if err := sav.WatchWallet(w.ID, vw, 5, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	} else if vw.registered() != 5 {
+		t.Fatalf("expected 5 registered addresses, got %d", vw.registered())
+	}
+
+	// a deposit to a lookahead address extends the window past it
+	vw.mu.Lock()
+	vw.used[types.StandardAddress(seed.PublicKey(3))] = true
+	vw.mu.Unlock()
+	for i := 0; vw.registered() != 9; i++ {
+		if i == 100 {
+			t.Fatalf("expected 9 registered addresses, got %d", vw.registered())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sav.NextIndex() != 4 {
+		t.Fatalf("expected used address to advance the next index to 4, got %d", sav.NextIndex())
+	} else if addr, err := sav.NewAddress("after deposit"); err != nil {
+		t.Fatal(err)
+	} else if addr.Address != types.StandardAddress(seed.PublicKey(4)) {
+		t.Fatal("expected the next issued address to follow the used address")
+	}
+
+	if err := sav.SetLookahead(10); err != nil {
+		t.Fatal(err)
+	} else if vw.registered() != 15 {
+		t.Fatalf("expected 15 registered addresses, got %d", vw.registered())
+	}
+	sav.Close()
+
+	// the lookahead and registered addresses survive a restart
+	state, err := db.AddressVault(seed.Fingerprint())
+	if err != nil {
+		t.Fatal(err)
+	} else if state.WalletID != w.ID || state.Lookahead != 10 || state.Registered != 15 || state.NextIndex != 5 {
+		t.Fatalf("unexpected vault state %+v", state)
+	}
+	sav, err = wallet.LoadSeedAddressVault(seed, 20, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sav.Close()
+	vw = &vaultWallet{addrs: make(map[types.Address]wallet.Address), used: make(map[types.Address]bool)}
+	if err := sav.WatchWallet(w.ID, vw, 0, time.Hour); err != nil {
+		t.Fatal(err)
+	} else if vw.registered() != 0 {
+		t.Fatalf("expected registered addresses not to be registered again, got %d", vw.registered())
+	}
+}
+
+func TestIngestStatus(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bdb, err := coreutils.OpenBoltChainDB(filepath.Join(dir, "consensus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+
+	network, genesisBlock := testV1Network(types.VoidAddress)
+	store, genesisState, err := chain.NewDBStore(bdb, network, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(store, genesisState)
+
+	wm, err := wallet.NewManager(cm, db, wallet.WithLogger(log.Named("wallet")), wallet.WithIngestQueueSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	if status := wm.IngestStatus(); status.QueueCapacity != 2 {
+		t.Fatalf("expected queue capacity 2, got %d", status.QueueCapacity)
+	}
+
+	// mine blocks one at a time, notifying the writer more times than the
+	// queue can hold
+	for i := 0; i < 10; i++ {
+		if err := cm.AddBlocks([]types.Block{mineBlock(cm.TipState(), nil, types.VoidAddress)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForBlock(t, cm, db)
+
+	// reads are served while the writer is idle or busy
+	if _, err := wm.Wallets(); err != nil {
+		t.Fatal(err)
+	}
+
+	var status wallet.IngestStatus
+	for i := 0; i < 100; i++ {
+		status = wm.IngestStatus()
+		if !status.Applying && status.QueueDepth == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status.Applied != cm.Tip() {
+		t.Fatalf("expected applied index %v, got %v", cm.Tip(), status.Applied)
+	} else if status.Tip != cm.Tip() {
+		t.Fatalf("expected tip %v, got %v", cm.Tip(), status.Tip)
+	} else if status.Lag != 0 {
+		t.Fatalf("expected no lag, got %d", status.Lag)
+	}
+
+	// scans are queued behind chain updates
+	if err := wm.Scan(context.Background(), types.ChainIndex{}); err != nil {
+		t.Fatal(err)
+	} else if status := wm.IngestStatus(); status.Applied != cm.Tip() {
+		t.Fatalf("expected applied index %v after scan, got %v", cm.Tip(), status.Applied)
+	}
+}
+
+func TestBalanceAlarmCheck(t *testing.T) {
+	low, high := types.Siacoins(10), types.Siacoins(100)
+	a := wallet.BalanceAlarm{Low: &low, High: &high}
+	if err := a.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		balance types.Currency
+		state   string
+	}{
+		{types.ZeroCurrency, wallet.AlarmStateLow},
+		{types.Siacoins(10), wallet.AlarmStateOK},
+		{types.Siacoins(100), wallet.AlarmStateOK},
+		{types.Siacoins(101), wallet.AlarmStateHigh},
+	}
+	for _, test := range tests {
+		if state := a.Check(test.balance); state != test.state {
+			t.Fatalf("%v: expected state %q, got %q", test.balance, test.state, state)
+		}
+	}
+
+	invalid := []wallet.BalanceAlarm{
+		{},
+		{Low: &high, High: &low},
+		{Low: &low, High: &low},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Fatalf("%+v: expected error", a)
+		}
+	}
+}
+
+func TestBalanceAlarms(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bdb, err := coreutils.OpenBoltChainDB(filepath.Join(dir, "consensus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+
+	network, genesisBlock := testV1Network(types.VoidAddress)
+	store, genesisState, err := chain.NewDBStore(bdb, network, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(store, genesisState)
+
+	am := alerts.NewManager()
+	wm, err := wallet.NewManager(cm, db, wallet.WithLogger(log.Named("wallet")), wallet.WithAlerter(am))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	w, err := wm.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := wm.AddAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the alarm's address must be in the wallet
+	other := types.VoidAddress
+	high := types.Siacoins(1)
+	if _, err := wm.AddBalanceAlarm(wallet.BalanceAlarm{WalletID: w.ID, Address: &other, High: &high}); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	alarm, err := wm.AddBalanceAlarm(wallet.BalanceAlarm{WalletID: w.ID, Address: &addr, High: &high})
+	if err != nil {
+		t.Fatal(err)
+	} else if alarm.State != wallet.AlarmStateOK {
+		t.Fatalf("expected state ok, got %q", alarm.State)
+	}
+
+	// mine a payout to the address and wait for it to mature
+	if err := cm.AddBlocks([]types.Block{mineBlock(cm.TipState(), nil, addr)}); err != nil {
+		t.Fatal(err)
+	}
+	maturityHeight := cm.TipState().MaturityHeight()
+	for cm.Tip().Height < maturityHeight {
+		if err := cm.AddBlocks([]types.Block{mineBlock(cm.TipState(), nil, types.VoidAddress)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForBlock(t, cm, db)
+
+	// alarms are checked after the update is applied
+	var alarms []wallet.BalanceAlarm
+	for i := 0; i < 100; i++ {
+		alarms, err = wm.BalanceAlarms(w.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(alarms) == 1 && alarms[0].State == wallet.AlarmStateHigh {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(alarms) != 1 || alarms[0].State != wallet.AlarmStateHigh {
+		t.Fatalf("expected high alarm, got %+v", alarms)
+	} else if alarms[0].DateTriggered.IsZero() {
+		t.Fatal("expected trigger date to be set")
+	} else if active := am.Active(); len(active) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(active))
+	}
+
+	// removing the alarm dismisses its alert
+	if err := wm.RemoveBalanceAlarm(w.ID, alarm.ID); err != nil {
+		t.Fatal(err)
+	} else if len(am.Active()) != 0 {
+		t.Fatalf("expected alert to be dismissed, got %d", len(am.Active()))
+	} else if err := wm.RemoveBalanceAlarm(w.ID, alarm.ID); !errors.Is(err, wallet.ErrAlarmNotFound) {
+		t.Fatalf("expected ErrAlarmNotFound, got %v", err)
+	}
+}
+
+func TestEstimateSend(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	dir := t.TempDir()
+	db, err := sqlite.OpenDatabase(filepath.Join(dir, "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bdb, err := coreutils.OpenBoltChainDB(filepath.Join(dir, "consensus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+
+	network, genesisBlock := testV1Network(types.VoidAddress)
+	store, genesisState, err := chain.NewDBStore(bdb, network, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm := chain.NewManager(store, genesisState)
+
+	wm, err := wallet.NewManager(cm, db, wallet.WithLogger(log.Named("wallet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wm.Close()
+
+	addr := types.StandardUnlockHash(types.GeneratePrivateKey().PublicKey())
+	w, err := wm.AddWallet(wallet.Wallet{Name: "hot"})
+	if err != nil {
+		t.Fatal(err)
+	} else if err := wm.AddAddress(w.ID, wallet.Address{Address: addr}); err != nil {
+		t.Fatal(err)
+	}
+
+	// mine two payouts to the address and wait for them to mature
+	for i := 0; i < 2; i++ {
+		if err := cm.AddBlocks([]types.Block{mineBlock(cm.TipState(), nil, addr)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	maturityHeight := cm.TipState().MaturityHeight()
+	for cm.Tip().Height < maturityHeight {
+		if err := cm.AddBlocks([]types.Block{mineBlock(cm.TipState(), nil, types.VoidAddress)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForBlock(t, cm, db)
+
+	balance, err := wm.WalletBalance(w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient := types.Address{1}
+	amount := types.Siacoins(1)
+	est, err := wm.EstimateSend(w.ID, []types.SiacoinOutput{{Address: recipient, Value: amount}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if est.Inputs != 1 {
+		t.Fatalf("expected 1 input, got %d", est.Inputs)
+	} else if est.Size == 0 || est.Weight == 0 {
+		t.Fatalf("expected non-zero size and weight, got %d and %d", est.Size, est.Weight)
+	}
+
+	// estimating does not reserve outputs
+	if again, err := wm.EstimateSend(w.ID, []types.SiacoinOutput{{Address: recipient, Value: amount}}, 0); err != nil {
+		t.Fatal(err)
+	} else if again != est {
+		t.Fatalf("expected %+v, got %+v", est, again)
+	}
+
+	// sending more than one payout requires both
+	est, err = wm.EstimateSend(w.ID, []types.SiacoinOutput{{Address: recipient, Value: balance.Siacoins.Div64(2).Add(amount)}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if est.Inputs != 2 {
+		t.Fatalf("expected 2 inputs, got %d", est.Inputs)
+	}
+
+	if _, err := wm.EstimateSend(w.ID, []types.SiacoinOutput{{Address: recipient, Value: balance.Siacoins}}, 0); !errors.Is(err, wallet.ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance, got %v", err)
+	} else if _, err := wm.EstimateSend(w.ID, []types.SiacoinOutput{{Address: recipient, Value: amount}}, 1000); !errors.Is(err, wallet.ErrInsufficientBalance) {
+		t.Fatalf("expected ErrInsufficientBalance with unconfirmed outputs, got %v", err)
+	}
+}
@@ -0,0 +1,446 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.thebigfile.com/core/types"
+	"go.thebigfile.com/walletd/internal/threadgroup"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+// HeaderSignature is the header containing the hex-encoded HMAC-SHA256 of the
+// request body, keyed by the webhook's secret.
+const HeaderSignature = "X-Walletd-Webhook-Signature"
+
+// ScopeAll matches events from every scope.
+const ScopeAll = "all"
+
+const (
+	deliveryTimeout  = 10 * time.Second
+	deliveryAttempts = 3
+)
+
+// ErrNotFound is returned when a webhook is not found.
+var ErrNotFound = errors.New("webhook not found")
+
+type (
+	// A Webhook is a callback URL that receives events.
+	Webhook struct {
+		ID          int64     `json:"id"`
+		CallbackURL string    `json:"callbackURL"`
+		Scopes      []string  `json:"scopes"`
+		SecretKey   string    `json:"secretKey"`
+		DateCreated time.Time `json:"dateCreated"`
+		// Tenant restricts the webhook to events owned by the tenant.
+		// Webhooks without a tenant receive every event in their scopes.
+		Tenant string `json:"tenant,omitempty"`
+	}
+
+	// An Event is sent to webhooks subscribed to its scope.
+	Event struct {
+		ID        types.Hash256 `json:"id"`
+		Scope     string        `json:"scope"`
+		Event     string        `json:"event"`
+		Data      any           `json:"data"`
+		Timestamp time.Time     `json:"timestamp"`
+	}
+
+	// A Channel delivers events to a notification service, such as email or
+	// a chat webhook.
+	Channel interface {
+		// Name identifies the channel in logs.
+		Name() string
+		Send(ctx context.Context, ev Event) error
+	}
+
+	// A subscription subscribes a channel to events.
+	subscription struct {
+		channel Channel
+		scopes  []string
+		events  []string
+	}
+
+	// A Store persists webhooks.
+	Store interface {
+		AddWebhook(Webhook) (Webhook, error)
+		UpdateWebhookScopes(id int64, scopes []string) error
+		RemoveWebhook(id int64) error
+		Webhooks() ([]Webhook, error)
+	}
+
+	// A Manager manages webhooks and delivers events to them.
+	Manager struct {
+		store  Store
+		client *http.Client
+		log    *zap.Logger
+		tg     *threadgroup.ThreadGroup
+
+		channels []subscription
+		// tenantOf returns the tenant that owns an event's data
+		tenantOf func(scope string, data any) (string, bool)
+		// scopeOf returns a narrower scope for an event's data
+		scopeOf func(scope string, data any) (string, bool)
+
+		mu      sync.Mutex // protects the fields below
+		hooks   map[int64]Webhook
+		failing map[int64]error // the last delivery error of failing webhooks
+	}
+
+	// An Option configures a Manager.
+	Option func(*Manager)
+)
+
+// WithLogger sets the logger used by the manager.
+func WithLogger(log *zap.Logger) Option {
+	return func(m *Manager) {
+		m.log = log
+	}
+}
+
+// WithTenantResolver sets the function used to determine the tenant that owns
+// an event's data. Webhooks with a tenant only receive events owned by their
+// tenant; without a resolver, they receive no events.
+func WithTenantResolver(fn func(scope string, data any) (tenant string, ok bool)) Option {
+	return func(m *Manager) {
+		m.tenantOf = fn
+	}
+}
+
+// WithScopeResolver sets the function used to narrow an event's scope based
+// on its data, e.g. to "wallets/1" for events of wallet 1. Webhooks and
+// channels subscribed to the narrower scope receive the event in addition to
+// those subscribed to the event's scope.
+func WithScopeResolver(fn func(scope string, data any) (narrowed string, ok bool)) Option {
+	return func(m *Manager) {
+		m.scopeOf = fn
+	}
+}
+
+// WithChannel subscribes a notification channel to events in the given
+// scopes. If events is not empty, only events with those names are sent.
+func WithChannel(ch Channel, scopes, events []string) Option {
+	return func(m *Manager) {
+		m.channels = append(m.channels, subscription{ch, scopes, events})
+	}
+}
+
+// matchScope returns true if any of the scopes match. Scopes are
+// hierarchical: a subscription to "treasury" receives events for
+// "treasury/approvals".
+func matchScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == ScopeAll || s == scope || strings.HasPrefix(scope, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if the webhook is subscribed to the scope.
+func (w Webhook) matches(scope string) bool {
+	return matchScope(w.Scopes, scope)
+}
+
+// matches returns true if the channel is subscribed to the event.
+func (sub subscription) matches(scope, event string) bool {
+	if !matchScope(sub.scopes, scope) {
+		return false
+	} else if len(sub.events) == 0 {
+		return true
+	}
+	for _, e := range sub.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops the manager and waits for pending deliveries to finish.
+func (m *Manager) Close() error {
+	m.tg.Stop()
+	return nil
+}
+
+// AddWebhook adds a webhook. A random secret is generated to sign its events.
+func (m *Manager) AddWebhook(callbackURL string, scopes []string) (Webhook, error) {
+	return m.AddTenantWebhook("", callbackURL, scopes)
+}
+
+// AddTenantWebhook adds a webhook that only receives events owned by the
+// tenant.
+func (m *Manager) AddTenantWebhook(tenant, callbackURL string, scopes []string) (Webhook, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return Webhook{}, fmt.Errorf("failed to parse callback URL: %w", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return Webhook{}, fmt.Errorf("unsupported callback URL scheme %q", u.Scheme)
+	} else if len(scopes) == 0 {
+		return Webhook{}, errors.New("at least one scope is required")
+	}
+
+	hook, err := m.store.AddWebhook(Webhook{
+		CallbackURL: callbackURL,
+		Scopes:      scopes,
+		SecretKey:   hex.EncodeToString(frand.Bytes(16)),
+		DateCreated: time.Now().Truncate(time.Second),
+		Tenant:      tenant,
+	})
+	if err != nil {
+		return Webhook{}, fmt.Errorf("failed to add webhook: %w", err)
+	}
+
+	m.mu.Lock()
+	m.hooks[hook.ID] = hook
+	m.mu.Unlock()
+	return hook, nil
+}
+
+// SubscribeWebhook adds scopes to the tenant's webhook with the callback URL,
+// adding the webhook if it does not exist.
+func (m *Manager) SubscribeWebhook(tenant, callbackURL string, scopes []string) (Webhook, error) {
+	m.mu.Lock()
+	var existing *Webhook
+	for _, hook := range m.hooks {
+		if hook.CallbackURL == callbackURL {
+			existing = &hook
+			break
+		}
+	}
+	m.mu.Unlock()
+
+	if existing == nil {
+		return m.AddTenantWebhook(tenant, callbackURL, scopes)
+	} else if existing.Tenant != tenant {
+		return Webhook{}, errors.New("callback URL is registered to another webhook")
+	}
+
+	hook := *existing
+	hook.Scopes = append([]string(nil), hook.Scopes...)
+	for _, scope := range scopes {
+		if !slices.Contains(hook.Scopes, scope) {
+			hook.Scopes = append(hook.Scopes, scope)
+		}
+	}
+	if len(hook.Scopes) == len(existing.Scopes) {
+		return hook, nil
+	} else if err := m.store.UpdateWebhookScopes(hook.ID, hook.Scopes); err != nil {
+		return Webhook{}, fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	m.mu.Lock()
+	m.hooks[hook.ID] = hook
+	m.mu.Unlock()
+	return hook, nil
+}
+
+// RemoveWebhook removes a webhook.
+func (m *Manager) RemoveWebhook(id int64) error {
+	if err := m.store.RemoveWebhook(id); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	delete(m.hooks, id)
+	delete(m.failing, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// Webhooks returns all registered webhooks.
+func (m *Manager) Webhooks() []Webhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hooks := make([]Webhook, 0, len(m.hooks))
+	for _, hook := range m.hooks {
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// FailingWebhooks returns the webhooks whose last event could not be
+// delivered, along with the delivery error.
+func (m *Manager) FailingWebhooks() map[int64]error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failing := make(map[int64]error, len(m.failing))
+	for id, err := range m.failing {
+		failing[id] = err
+	}
+	return failing
+}
+
+func (m *Manager) setFailing(id int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.hooks[id]; !ok {
+		return // webhook was removed
+	} else if err == nil {
+		delete(m.failing, id)
+	} else {
+		m.failing[id] = err
+	}
+}
+
+func (m *Manager) deliver(ctx context.Context, hook Webhook, buf []byte) error {
+	mac := hmac.New(sha256.New, []byte(hook.SecretKey))
+	mac.Write(buf)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.CallbackURL, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, sig)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// BroadcastEvent sends an event to every webhook and notification channel
+// subscribed to the scope. Events are delivered asynchronously and retried on
+// failure.
+func (m *Manager) BroadcastEvent(scope, event string, data any) error {
+	ev := Event{
+		ID:        frand.Entropy256(),
+		Scope:     scope,
+		Event:     event,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var tenant string
+	var owned bool
+	if m.tenantOf != nil {
+		tenant, owned = m.tenantOf(scope, data)
+	}
+	narrowed := scope
+	if m.scopeOf != nil {
+		if s, ok := m.scopeOf(scope, data); ok {
+			narrowed = s
+		}
+	}
+
+	m.mu.Lock()
+	var hooks []Webhook
+	for _, hook := range m.hooks {
+		if !hook.matches(scope) && !hook.matches(narrowed) {
+			continue
+		} else if hook.Tenant != "" && (!owned || hook.Tenant != tenant) {
+			continue
+		}
+		hooks = append(hooks, hook)
+	}
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		log := m.log.With(zap.Int64("webhook", hook.ID), zap.String("scope", scope), zap.String("event", event))
+		err := m.deliverAsync(log, func(ctx context.Context) error {
+			return m.deliver(ctx, hook, buf)
+		}, func(err error) {
+			m.setFailing(hook.ID, err)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range m.channels {
+		if !sub.matches(scope, event) && !sub.matches(narrowed, event) {
+			continue
+		}
+		ch := sub.channel
+		log := m.log.With(zap.String("channel", ch.Name()), zap.String("scope", scope), zap.String("event", event))
+		err := m.deliverAsync(log, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+			defer cancel()
+			return ch.Send(ctx, ev)
+		}, func(error) {})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverAsync calls fn in a new goroutine, retrying on failure. done is
+// called with the final error, or nil if delivery succeeded.
+func (m *Manager) deliverAsync(log *zap.Logger, fn func(context.Context) error, done func(error)) error {
+	ctx, cancel, err := m.tg.AddWithContext(context.Background())
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer cancel()
+
+		var err error
+		for attempt := 1; attempt <= deliveryAttempts; attempt++ {
+			err = fn(ctx)
+			if err == nil {
+				done(nil)
+				return
+			}
+			log.Debug("failed to deliver event", zap.Int("attempt", attempt), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		log.Warn("giving up on event delivery", zap.Error(err))
+		done(err)
+	}()
+	return nil
+}
+
+// NewManager creates a new webhook manager.
+func NewManager(store Store, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		store:  store,
+		client: &http.Client{},
+		log:    zap.NewNop(),
+		tg:     threadgroup.New(),
+		hooks:  make(map[int64]Webhook),
+
+		failing: make(map[int64]error),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	hooks, err := store.Webhooks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	for _, hook := range hooks {
+		m.hooks[hook.ID] = hook
+	}
+	return m, nil
+}
@@ -0,0 +1,288 @@
+package webhooks_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.thebigfile.com/walletd/persist/sqlite"
+	"go.thebigfile.com/walletd/webhooks"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestBroadcastEvent(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	type delivery struct {
+		body []byte
+		sig  string
+	}
+	received := make(chan delivery, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{body, r.Header.Get(webhooks.HeaderSignature)}
+	}))
+	defer srv.Close()
+
+	wh, err := webhooks.NewManager(db, webhooks.WithLogger(log.Named("webhooks")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wh.Close()
+
+	if _, err := wh.AddWebhook("ftp://foo", []string{"treasury"}); err == nil {
+		t.Fatal("expected error for unsupported scheme")
+	} else if _, err := wh.AddWebhook(srv.URL, nil); err == nil {
+		t.Fatal("expected error for missing scopes")
+	}
+
+	hook, err := wh.AddWebhook(srv.URL, []string{"treasury"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the webhook should be loaded from the store
+	wh2, err := webhooks.NewManager(db)
+	if err != nil {
+		t.Fatal(err)
+	} else if hooks := wh2.Webhooks(); len(hooks) != 1 || hooks[0].ID != hook.ID || hooks[0].SecretKey != hook.SecretKey {
+		t.Fatalf("expected webhook to be persisted, got %+v", hooks)
+	}
+	wh2.Close()
+
+	// events outside of the webhook's scopes should not be delivered
+	if err := wh.BroadcastEvent("wallets", "foo", nil); err != nil {
+		t.Fatal(err)
+	} else if err := wh.BroadcastEvent("treasury/approvals", "pending", map[string]int{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case d := <-received:
+		mac := hmac.New(sha256.New, []byte(hook.SecretKey))
+		mac.Write(d.body)
+		if d.sig != hex.EncodeToString(mac.Sum(nil)) {
+			t.Fatal("invalid signature")
+		}
+		var ev webhooks.Event
+		if err := json.Unmarshal(d.body, &ev); err != nil {
+			t.Fatal(err)
+		} else if ev.Scope != "treasury/approvals" || ev.Event != "pending" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	select {
+	case <-received:
+		t.Fatal("unexpected event delivered")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := wh.RemoveWebhook(hook.ID); err != nil {
+		t.Fatal(err)
+	} else if err := wh.RemoveWebhook(hook.ID); err == nil {
+		t.Fatal("expected error removing missing webhook")
+	} else if len(wh.Webhooks()) != 0 {
+		t.Fatal("expected no webhooks")
+	}
+}
+
+type mockChannel struct {
+	events chan webhooks.Event
+}
+
+func (mc *mockChannel) Name() string { return "mock" }
+
+func (mc *mockChannel) Send(_ context.Context, ev webhooks.Event) error {
+	mc.events <- ev
+	return nil
+}
+
+func TestChannels(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ch := &mockChannel{events: make(chan webhooks.Event, 10)}
+	wh, err := webhooks.NewManager(db, webhooks.WithLogger(log.Named("webhooks")), webhooks.WithChannel(ch, []string{"wallets"}, []string{"v2Transaction"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wh.Close()
+
+	for _, ev := range [][2]string{
+		{"alerts", "register"},
+		{"wallets", "miner"},
+		{"wallets", "v2Transaction"},
+	} {
+		if err := wh.BroadcastEvent(ev[0], ev[1], nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case ev := <-ch.events:
+		if ev.Scope != "wallets" || ev.Event != "v2Transaction" {
+			t.Fatalf("unexpected event %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+
+	select {
+	case ev := <-ch.events:
+		t.Fatalf("unexpected event delivered: %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTenantWebhooks(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Query().Get("hook")
+	}))
+	defer srv.Close()
+
+	// event data is owned by the tenant named in it
+	resolver := func(_ string, data any) (string, bool) {
+		tenant, ok := data.(string)
+		return tenant, ok
+	}
+	wh, err := webhooks.NewManager(db, webhooks.WithLogger(log.Named("webhooks")), webhooks.WithTenantResolver(resolver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wh.Close()
+
+	if _, err := wh.AddWebhook(srv.URL+"?hook=admin", []string{"all"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := wh.AddTenantWebhook("alice", srv.URL+"?hook=alice", []string{"all"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := wh.AddTenantWebhook("bob", srv.URL+"?hook=bob", []string{"all"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(hooks ...string) {
+		t.Helper()
+		got := make(map[string]bool)
+		for range hooks {
+			select {
+			case hook := <-received:
+				got[hook] = true
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected deliveries to %v, got %v", hooks, got)
+			}
+		}
+		for _, hook := range hooks {
+			if !got[hook] {
+				t.Fatalf("expected delivery to %q, got %v", hook, got)
+			}
+		}
+		select {
+		case hook := <-received:
+			t.Fatalf("unexpected delivery to %q", hook)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if err := wh.BroadcastEvent("wallets", "foo", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	expect("admin", "alice")
+
+	// events without a tenant are only sent to unrestricted webhooks
+	if err := wh.BroadcastEvent("wallets", "foo", nil); err != nil {
+		t.Fatal(err)
+	}
+	expect("admin")
+}
+
+func TestScopeResolver(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	db, err := sqlite.OpenDatabase(filepath.Join(t.TempDir(), "walletd.sqlite3"), log.Named("sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Query().Get("hook")
+	}))
+	defer srv.Close()
+
+	// event data names the resource the event belongs to
+	resolver := func(scope string, data any) (string, bool) {
+		id, ok := data.(string)
+		return scope + "/" + id, ok
+	}
+	wh, err := webhooks.NewManager(db, webhooks.WithLogger(log.Named("webhooks")), webhooks.WithScopeResolver(resolver))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wh.Close()
+
+	if _, err := wh.AddWebhook(srv.URL+"?hook=all", []string{"wallets"}); err != nil {
+		t.Fatal(err)
+	} else if _, err := wh.AddWebhook(srv.URL+"?hook=1", []string{"wallets/1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(hooks ...string) {
+		t.Helper()
+		got := make(map[string]bool)
+		for range hooks {
+			select {
+			case hook := <-received:
+				got[hook] = true
+			case <-time.After(5 * time.Second):
+				t.Fatalf("expected deliveries to %v, got %v", hooks, got)
+			}
+		}
+		for _, hook := range hooks {
+			if !got[hook] {
+				t.Fatalf("expected delivery to %q, got %v", hook, got)
+			}
+		}
+		select {
+		case hook := <-received:
+			t.Fatalf("unexpected delivery to %q", hook)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if err := wh.BroadcastEvent("wallets", "foo", "1"); err != nil {
+		t.Fatal(err)
+	}
+	expect("all", "1")
+
+	if err := wh.BroadcastEvent("wallets", "foo", "2"); err != nil {
+		t.Fatal(err)
+	}
+	expect("all")
+}